@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commandv2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/v2/cmd/client/general"
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/cluster/history"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// HistoryCmd returns history command.
+func HistoryCmd() *cobra.Command {
+	var from, to int64
+
+	examples := []general.Example{
+		{Desc: "List the versions of an object.", Command: "egctl history <name>"},
+		{Desc: "Show the diff between version 3 and the current spec of an object.", Command: "egctl history <name> --diff 3"},
+		{Desc: "Show the diff between version 3 and version 5 of an object.", Command: "egctl history <name> --diff 3 --to 5"},
+	}
+	cmd := &cobra.Command{
+		Use:     "history",
+		Short:   "List the versions of an object or show the diff between them",
+		Example: createMultiExample(examples),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one object name")
+			}
+			if cmd.Flags().Changed("to") && !cmd.Flags().Changed("diff") {
+				return errors.New("--to requires --diff")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if cmd.Flags().Changed("diff") {
+				query := url.Values{}
+				query.Set("from", fmt.Sprint(from))
+				if cmd.Flags().Changed("to") {
+					query.Set("to", fmt.Sprint(to))
+				}
+				body, err := handleReq(http.MethodGet, makePath(general.ObjectDiffURL, args[0])+"?"+query.Encode(), nil)
+				if err != nil {
+					general.ExitWithError(err)
+					return
+				}
+				fmt.Print(string(body))
+				return
+			}
+
+			body, err := handleReq(http.MethodGet, makePath(general.ObjectVersionsURL, args[0]), nil)
+			if err != nil {
+				general.ExitWithError(err)
+				return
+			}
+			if !general.CmdGlobalFlags.DefaultFormat() {
+				general.PrintBody(body)
+				return
+			}
+
+			versions := []*history.Version{}
+			if err := codectool.Unmarshal(body, &versions); err != nil {
+				general.ExitWithErrorf("unmarshal versions failed: %v", err)
+			}
+			table := [][]string{{"VERSION", "ACTION", "TIME"}}
+			for _, v := range versions {
+				table = append(table, []string{fmt.Sprint(v.Version), v.Action, v.Time})
+			}
+			general.PrintTable(table)
+		},
+	}
+	cmd.Flags().Int64Var(&from, "diff", 0, "Show the diff from this version.")
+	cmd.Flags().Int64Var(&to, "to", 0, "The version to diff to, the current spec by default.")
+	return cmd
+}
+
+// RollbackCmd returns rollback command.
+func RollbackCmd() *cobra.Command {
+	var version int64
+	var all, dryRun bool
+
+	examples := []general.Example{
+		{Desc: "Roll an object back to version 3.", Command: "egctl rollback <name> --version 3"},
+		{Desc: "Report the changes to roll the whole config back to version 3.", Command: "egctl rollback --all --version 3 --dry-run"},
+		{Desc: "Roll the whole config back to version 3.", Command: "egctl rollback --all --version 3"},
+	}
+	cmd := &cobra.Command{
+		Use:     "rollback",
+		Short:   "Roll an object or the whole config back to a version",
+		Example: createMultiExample(examples),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all == (len(args) == 1) || len(args) > 1 {
+				return errors.New("requires either one object name or --all")
+			}
+			if dryRun && !all {
+				return errors.New("--dry-run requires --all")
+			}
+			if !cmd.Flags().Changed("version") {
+				return errors.New("requires --version")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			query.Set("version", fmt.Sprint(version))
+
+			if !all {
+				_, err := handleReq(http.MethodPost, makePath(general.ObjectRollbackURL, args[0])+"?"+query.Encode(), nil)
+				if err != nil {
+					general.ExitWithError(err)
+					return
+				}
+				general.Infof("%s is rolled back to version %d", args[0], version)
+				return
+			}
+
+			if dryRun {
+				query.Set("dryRun", "true")
+			}
+			body, err := handleReq(http.MethodPost, makePath(general.ConfigRollbackURL)+"?"+query.Encode(), nil)
+			if err != nil {
+				general.ExitWithError(err)
+				return
+			}
+			if !general.CmdGlobalFlags.DefaultFormat() {
+				general.PrintBody(body)
+				return
+			}
+
+			result := &api.ConfigRollbackResult{}
+			if err := codectool.Unmarshal(body, result); err != nil {
+				general.ExitWithErrorf("unmarshal rollback result failed: %v", err)
+			}
+			if len(result.Changes) == 0 {
+				general.Infof("nothing to roll back to version %d", version)
+				return
+			}
+			table := [][]string{{"NAME", "ACTION"}}
+			for _, c := range result.Changes {
+				table = append(table, []string{c.Name, c.Action})
+			}
+			general.PrintTable(table)
+			if !dryRun {
+				general.Infof("the config is rolled back to version %d", version)
+			}
+		},
+	}
+	cmd.Flags().Int64Var(&version, "version", 0, "The version to roll back to.")
+	cmd.Flags().BoolVar(&all, "all", false, "Roll the whole config back.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only report the changes to roll the whole config back.")
+	return cmd
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commandv2
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/v2/cmd/client/general"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+	"github.com/spf13/cobra"
+)
+
+// MeshCmd returns mesh command.
+func MeshCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mesh",
+		Short: "Operate the service mesh through the admin API of the mesh master",
+	}
+
+	cmd.AddCommand(meshServiceCmd())
+	cmd.AddCommand(meshInstanceCmd())
+	cmd.AddCommand(meshCanaryCmd())
+	cmd.AddCommand(meshTenantCmd())
+	return cmd
+}
+
+func meshServiceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "View mesh services",
+	}
+
+	cmd.AddCommand(meshServiceListCmd())
+	cmd.AddCommand(meshServiceDescribeCmd())
+	return cmd
+}
+
+func meshServiceListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List mesh services",
+		Example: createExample("List all mesh services", "egctl mesh service list"),
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			body, err := handleReq(http.MethodGet, makePath(general.MeshServicesURL), nil)
+			if err != nil {
+				general.ExitWithError(err)
+			}
+			if !general.CmdGlobalFlags.DefaultFormat() {
+				general.PrintBody(body)
+				return
+			}
+
+			services := []*spec.Service{}
+			err = codectool.Unmarshal(body, &services)
+			if err != nil {
+				general.ExitWithErrorf("unmarshal mesh services failed: %v", err)
+			}
+
+			table := [][]string{{"NAME", "TENANT", "INGRESS-PORT", "EGRESS-PORT"}}
+			for _, s := range services {
+				ingressPort, egressPort := "-", "-"
+				if s.Sidecar != nil {
+					ingressPort = strconv.Itoa(s.Sidecar.IngressPort)
+					egressPort = strconv.Itoa(s.Sidecar.EgressPort)
+				}
+				table = append(table, []string{s.Name, s.RegisterTenant, ingressPort, egressPort})
+			}
+			general.PrintTable(table)
+		},
+	}
+
+	return cmd
+}
+
+func meshServiceDescribeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "describe",
+		Short:   "Describe a mesh service",
+		Example: createExample("Describe a mesh service", "egctl mesh service describe <service>"),
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			body, err := handleReq(http.MethodGet, makePath(general.MeshServiceURL, args[0]), nil)
+			if err != nil {
+				general.ExitWithError(err)
+			}
+			general.PrintBody(body)
+		},
+	}
+
+	return cmd
+}
+
+func meshInstanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "instance",
+		Short: "View mesh service instances",
+	}
+
+	cmd.AddCommand(meshInstanceListCmd())
+	cmd.AddCommand(meshInstanceConfigCmd())
+	return cmd
+}
+
+func meshInstanceConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "config",
+		Short:   "Show the effective configuration the sidecar of a mesh service instance is running",
+		Example: createExample("Show the effective sidecar configuration of an instance", "egctl mesh instance config <service> <instance-id>"),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 2 {
+				return nil
+			}
+			return fmt.Errorf("requires service name and instance id")
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			body, err := handleReq(http.MethodGet, makePath(general.MeshServiceInstanceConfigURL, args[0], args[1]), nil)
+			if err != nil {
+				general.ExitWithError(err)
+			}
+			general.PrintBody(body)
+		},
+	}
+
+	return cmd
+}
+
+func meshInstanceListCmd() *cobra.Command {
+	examples := []general.Example{
+		{Desc: "List all mesh service instances", Command: "egctl mesh instance list"},
+		{Desc: "List instances of a mesh service", Command: "egctl mesh instance list <service>"},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List mesh service instances",
+		Example: createMultiExample(examples),
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			body, err := handleReq(http.MethodGet, makePath(general.MeshServiceInstancesURL), nil)
+			if err != nil {
+				general.ExitWithError(err)
+			}
+
+			instances := []*spec.ServiceInstanceSpec{}
+			err = codectool.Unmarshal(body, &instances)
+			if err != nil {
+				general.ExitWithErrorf("unmarshal mesh service instances failed: %v", err)
+			}
+			if len(args) == 1 {
+				instances = general.Filter(instances, func(i *spec.ServiceInstanceSpec) bool {
+					return i.ServiceName == args[0]
+				})
+			}
+
+			if !general.CmdGlobalFlags.DefaultFormat() {
+				general.PrintBody(codectool.MustMarshalJSON(instances))
+				return
+			}
+
+			table := [][]string{{"SERVICE", "INSTANCE-ID", "IP", "PORT", "STATUS", "LABELS"}}
+			for _, i := range instances {
+				table = append(table, []string{i.ServiceName, i.InstanceID, i.IP,
+					strconv.Itoa(int(i.Port)), i.Status, formatMeshLabels(i.Labels)})
+			}
+			general.PrintTable(table)
+		},
+	}
+
+	return cmd
+}
+
+func formatMeshLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func meshCanaryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "canary",
+		Short: "Manage mesh service canaries",
+	}
+
+	cmd.AddCommand(meshCanarySetCmd())
+	return cmd
+}
+
+func meshCanarySetCmd() *cobra.Command {
+	var services []string
+	var labels, headers map[string]string
+	var priority int
+
+	examples := []general.Example{
+		{
+			Desc:    "Route requests with header X-Location: Beijing to order instances labeled version=v2",
+			Command: "egctl mesh canary set order-beijing --services order --labels version=v2 --headers X-Location=Beijing",
+		},
+		{
+			Desc:    "Update the priority of an existing canary",
+			Command: "egctl mesh canary set order-beijing --services order --labels version=v2 --headers X-Location=Beijing --priority 1",
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "set",
+		Short:   "Create or update a mesh service canary",
+		Example: createMultiExample(examples),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("requires canary name")
+			}
+			if len(services) == 0 {
+				return fmt.Errorf("services are required")
+			}
+			if len(labels) == 0 {
+				return fmt.Errorf("labels are required")
+			}
+			if len(headers) == 0 {
+				return fmt.Errorf("headers are required")
+			}
+			// the priority is kept or defaults to 5 if it is not set.
+			if cmd.Flags().Changed("priority") && (priority < 1 || priority > 9) {
+				return fmt.Errorf("priority must be in [1, 9]")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			canary := &spec.ServiceCanary{
+				Name:     args[0],
+				Priority: priority,
+				Selector: &spec.ServiceSelector{
+					MatchServices:       services,
+					MatchInstanceLabels: labels,
+				},
+				TrafficRules: &spec.TrafficRules{
+					Headers: map[string]*stringtool.StringMatcher{},
+				},
+			}
+			for k, v := range headers {
+				canary.TrafficRules.Headers[k] = &stringtool.StringMatcher{Exact: v}
+			}
+
+			action := general.CreateCmd
+			body, err := handleReq(http.MethodGet, makePath(general.MeshServiceCanaryURL, canary.Name), nil)
+			if err == nil {
+				action = "update"
+				oldCanary := &spec.ServiceCanary{}
+				if codectool.Unmarshal(body, oldCanary) == nil && canary.Priority == 0 {
+					canary.Priority = oldCanary.Priority
+				}
+				_, err = handleReq(http.MethodPut, makePath(general.MeshServiceCanaryURL, canary.Name),
+					codectool.MustMarshalJSON(canary))
+			} else {
+				_, err = handleReq(http.MethodPost, makePath(general.MeshServiceCanariesURL),
+					codectool.MustMarshalJSON(canary))
+			}
+			if err != nil {
+				general.ExitWithError(general.ErrorMsg(action, err, "ServiceCanary", canary.Name))
+			}
+			fmt.Println(general.SuccessMsg(action, "ServiceCanary", canary.Name))
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&services, "services", nil, "Services whose instances are selected by the canary.")
+	cmd.Flags().StringToStringVar(&labels, "labels", nil, "Labels of the selected instances, e.g. version=v2.")
+	cmd.Flags().StringToStringVar(&headers, "headers", nil, "Exact values of request headers to route to the canary, e.g. X-Location=Beijing.")
+	cmd.Flags().IntVar(&priority, "priority", 0, "Priority of the canary in [1, 9], the smaller number gets higher priority, default is 5.")
+	return cmd
+}
+
+func meshTenantCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tenant",
+		Short: "Manage mesh tenants",
+	}
+
+	cmd.AddCommand(meshTenantCreateCmd())
+	return cmd
+}
+
+func meshTenantCreateCmd() *cobra.Command {
+	var description string
+
+	cmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Create a mesh tenant",
+		Example: createExample("Create a mesh tenant", "egctl mesh tenant create <tenant> --description <description>"),
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			tenant := &spec.Tenant{
+				Name:        args[0],
+				Description: description,
+			}
+			_, err := handleReq(http.MethodPost, makePath(general.MeshTenantsURL), codectool.MustMarshalJSON(tenant))
+			if err != nil {
+				general.ExitWithError(general.ErrorMsg(general.CreateCmd, err, "Tenant", tenant.Name))
+			}
+			fmt.Println(general.SuccessMsg(general.CreateCmd, "Tenant", tenant.Name))
+		},
+	}
+
+	cmd.Flags().StringVar(&description, "description", "", "Description of the tenant.")
+	return cmd
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commandv2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeshCanarySetArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	validate := func(args ...string) error {
+		cmd := meshCanarySetCmd()
+		if err := cmd.ParseFlags(args); err != nil {
+			return err
+		}
+		return cmd.Args(cmd, cmd.Flags().Args())
+	}
+	flags := []string{"--services", "order", "--labels", "version=v2", "--headers", "X-Location=Beijing"}
+
+	assert.NoError(validate(append([]string{"order-beijing"}, flags...)...))
+	assert.Error(validate(flags...))
+	assert.Error(validate(append([]string{"a", "b"}, flags...)...))
+
+	assert.Error(validate("order-beijing", "--labels", "version=v2", "--headers", "X-Location=Beijing"))
+	assert.Error(validate("order-beijing", "--services", "order", "--headers", "X-Location=Beijing"))
+	assert.Error(validate("order-beijing", "--services", "order", "--labels", "version=v2"))
+
+	// the priority is optional, but must be in [1, 9] if it is set.
+	for _, p := range []string{"1", "9"} {
+		assert.NoError(validate(append([]string{"order-beijing", "--priority", p}, flags...)...))
+	}
+	for _, p := range []string{"0", "10", "-1"} {
+		assert.Error(validate(append([]string{"order-beijing", "--priority", p}, flags...)...))
+	}
+}
+
+func TestFormatMeshLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("-", formatMeshLabels(nil))
+	assert.Equal("-", formatMeshLabels(map[string]string{}))
+	assert.Equal("version=v1", formatMeshLabels(map[string]string{"version": "v1"}))
+	assert.Equal("region=beijing,version=v2", formatMeshLabels(map[string]string{
+		"version": "v2",
+		"region":  "beijing",
+	}))
+}
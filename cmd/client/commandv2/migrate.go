@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commandv2
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/v2/cmd/client/general"
+	"github.com/megaease/easegress/v2/pkg/cluster/migration"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// MigrateCmd returns migrate command.
+func MigrateCmd() *cobra.Command {
+	var dryRun bool
+
+	examples := []general.Example{
+		{Desc: "Report the object specs to migrate without changing them.", Command: "egctl migrate --dry-run"},
+		{Desc: "Migrate the object specs stored by older versions.", Command: "egctl migrate"},
+	}
+	cmd := &cobra.Command{
+		Use:     "migrate",
+		Short:   "Migrate the object specs stored by older versions to the current schema",
+		Example: createMultiExample(examples),
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			path := makePath(general.MigrationsURL)
+			if dryRun {
+				path += "?dryRun=true"
+			}
+			body, err := handleReq(http.MethodPost, path, nil)
+			if err != nil {
+				general.ExitWithError(err)
+				return
+			}
+			if !general.CmdGlobalFlags.DefaultFormat() {
+				general.PrintBody(body)
+				return
+			}
+
+			report := &migration.Report{}
+			if err := codectool.Unmarshal(body, report); err != nil {
+				general.ExitWithErrorf("unmarshal migration report failed: %v", err)
+			}
+			printMigrationReport(report)
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only report the object specs to migrate.")
+	return cmd
+}
+
+func printMigrationReport(report *migration.Report) {
+	table := [][]string{{"NAME", "KIND", "FROM", "RESULT"}}
+	for _, r := range report.Migrated {
+		table = append(table, []string{r.Name, r.Kind, r.From, strings.Join(r.Changes, "; ")})
+	}
+	for _, r := range report.Failed {
+		table = append(table, []string{r.Name, r.Kind, r.From, "FAILED: " + r.Error})
+	}
+	if len(table) > 1 {
+		general.PrintTable(table)
+	}
+
+	action := "migrated"
+	if report.DryRun {
+		action = "to migrate"
+	}
+	general.Infof("%d of %d objects %s, %d failed", len(report.Migrated), report.Total, action, len(report.Failed))
+	if len(report.Failed) > 0 {
+		general.ExitWithError(fmt.Errorf("failed to migrate %d objects", len(report.Failed)))
+	}
+}
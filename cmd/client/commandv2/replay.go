@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package commandv2
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/megaease/easegress/v2/cmd/client/general"
+	"github.com/megaease/easegress/v2/pkg/filters/requestrecorder"
+	"github.com/spf13/cobra"
+)
+
+// ReplayCmd returns replay command.
+func ReplayCmd() *cobra.Command {
+	opts := &requestrecorder.ReplayOptions{}
+	examples := []general.Example{
+		{Desc: "Replay the requests recorded by a RequestRecorder filter as fast as possible.", Command: "egctl replay records.jsonl --target http://127.0.0.1:10080"},
+		{Desc: "Replay the requests at 100 requests per second with 10 concurrent connections.", Command: "egctl replay records.jsonl --target http://127.0.0.1:10080 --rate 100 --concurrency 10"},
+		{Desc: "Replay the requests with their recorded hosts.", Command: "egctl replay records.jsonl --target http://127.0.0.1:10080 --keep-host"},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "replay",
+		Short:   "Replay the requests recorded by a RequestRecorder filter against a target",
+		Args:    cobra.ExactArgs(1),
+		Example: createMultiExample(examples),
+		Run: func(cmd *cobra.Command, args []string) {
+			if opts.Target == "" {
+				general.ExitWithErrorf("target is required")
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				general.ExitWithError(err)
+			}
+			defer f.Close()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			result, err := requestrecorder.Replay(ctx, f, opts)
+			if result != nil {
+				printReplayResult(result)
+			}
+			if err != nil && err != context.Canceled {
+				general.ExitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Target, "target", "", "The URL to send the requests to, only the scheme and host are used")
+	cmd.Flags().Float64Var(&opts.Rate, "rate", 0, "Requests per second, 0 means as fast as possible")
+	cmd.Flags().IntVar(&opts.Concurrency, "concurrency", 1, "Max number of requests in flight")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 10*time.Second, "Timeout of each request")
+	cmd.Flags().BoolVar(&opts.KeepHost, "keep-host", false, "Send the requests with their recorded hosts")
+	return cmd
+}
+
+func printReplayResult(result *requestrecorder.ReplayResult) {
+	fmt.Printf("Total: %d, Failed: %d, Duration: %v, Avg Latency: %v, Max Latency: %v\n\n",
+		result.Total, result.Failed, result.Duration.Round(time.Millisecond),
+		result.AvgLatency.Round(time.Microsecond), result.MaxLatency.Round(time.Microsecond))
+
+	codes := make([]int, 0, len(result.StatusCodes))
+	for code := range result.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	table := [][]string{{"STATUS CODE", "COUNT"}}
+	for _, code := range codes {
+		table = append(table, []string{strconv.Itoa(code), strconv.Itoa(result.StatusCodes[code])})
+	}
+	general.PrintTable(table)
+
+	if len(result.Errors) == 0 {
+		return
+	}
+	fmt.Println()
+	table = [][]string{{"ERROR", "COUNT"}}
+	for msg, count := range result.Errors {
+		table = append(table, []string{msg, strconv.Itoa(count)})
+	}
+	general.PrintTable(table)
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package commandv2 provides the new version of commands.
+package commandv2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/v2/cmd/client/general"
+	"github.com/megaease/easegress/v2/pkg/cluster/snapshot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// SnapshotCmd returns snapshot command.
+func SnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Back up and restore the cluster data",
+	}
+	cmd.AddCommand(createSnapshotCmd())
+	cmd.AddCommand(listSnapshotsCmd())
+	cmd.AddCommand(downloadSnapshotCmd())
+	cmd.AddCommand(restoreSnapshotCmd())
+	cmd.AddCommand(deleteSnapshotCmd())
+	return cmd
+}
+
+func requireSnapshotName(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("requires one snapshot name")
+	}
+	return nil
+}
+
+func createSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Take a snapshot of the cluster data and store it",
+		Example: createExample("Take a snapshot of the cluster data.", "egctl snapshot create"),
+		Run: func(cmd *cobra.Command, args []string) {
+			body, err := handleReq(http.MethodPost, makePath(general.SnapshotsURL), nil)
+			if err != nil {
+				general.ExitWithError(err)
+				return
+			}
+			general.PrintBody(body)
+		},
+	}
+	return cmd
+}
+
+func listSnapshotsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the stored snapshots",
+		Example: createExample("List the stored snapshots.", "egctl snapshot list"),
+		Run: func(cmd *cobra.Command, args []string) {
+			body, err := handleReq(http.MethodGet, makePath(general.SnapshotsURL), nil)
+			if err != nil {
+				general.ExitWithError(err)
+				return
+			}
+			if !general.CmdGlobalFlags.DefaultFormat() {
+				general.PrintBody(body)
+				return
+			}
+
+			infos := []*snapshot.Info{}
+			if err := codectool.Unmarshal(body, &infos); err != nil {
+				general.ExitWithErrorf("unmarshal snapshots failed: %v", err)
+			}
+			table := [][]string{{"NAME", "SIZE", "AGE"}}
+			for _, info := range infos {
+				age := general.DurationMostSignificantUnit(time.Since(info.CreatedAt))
+				table = append(table, []string{info.Name, fmt.Sprintf("%d", info.Size), age})
+			}
+			general.PrintTable(table)
+		},
+	}
+	return cmd
+}
+
+func downloadSnapshotCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:     "download",
+		Short:   "Download a stored snapshot",
+		Example: createExample("Download a stored snapshot.", "egctl snapshot download <name> --output-file <path/to/file>"),
+		Args:    requireSnapshotName,
+		Run: func(cmd *cobra.Command, args []string) {
+			body, err := handleReq(http.MethodGet, makePath(general.SnapshotItemURL, args[0]), nil)
+			if err != nil {
+				general.ExitWithError(err)
+				return
+			}
+			if output == "" {
+				output = args[0]
+			}
+			if err := os.WriteFile(output, body, 0o600); err != nil {
+				general.ExitWithErrorf("write snapshot to %s failed: %v", output, err)
+			}
+			general.Infof("snapshot %s is downloaded to %s", args[0], output)
+		},
+	}
+	cmd.Flags().StringVar(&output, "output-file", "", "Path of the downloaded file, the snapshot name by default.")
+	return cmd
+}
+
+func restoreSnapshotCmd() *cobra.Command {
+	var file string
+
+	examples := []general.Example{
+		{Desc: "Restore the cluster data from a stored snapshot.", Command: "egctl snapshot restore <name>"},
+		{Desc: "Restore the cluster data from a local snapshot file.", Command: "egctl snapshot restore -f <path/to/file>"},
+	}
+	cmd := &cobra.Command{
+		Use:     "restore",
+		Short:   "Restore the cluster data from a stored or local snapshot",
+		Example: createMultiExample(examples),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 1) == (file != "") {
+				return errors.New("requires either one snapshot name or a snapshot file")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var body []byte
+			var err error
+			if file == "" {
+				body, err = handleReq(http.MethodPost, makePath(general.SnapshotRestoreURL, args[0]), nil)
+			} else {
+				body, err = restoreSnapshotFile(file)
+			}
+			if err != nil {
+				general.ExitWithError(err)
+				return
+			}
+			general.PrintBody(body)
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "A local snapshot file, gzipped or not.")
+	return cmd
+}
+
+// restoreSnapshotFile uploads a local snapshot file, it is sent as plain
+// JSON because the request body is encoded as JSON.
+func restoreSnapshotFile(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s, err := snapshot.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	data, err = codectool.MarshalJSON(s)
+	if err != nil {
+		return nil, err
+	}
+	return handleReq(http.MethodPost, makePath(general.SnapshotUploadRestoreURL), data)
+}
+
+func deleteSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a stored snapshot",
+		Example: createExample("Delete a stored snapshot.", "egctl snapshot delete <name>"),
+		Args:    requireSnapshotName,
+		Run: func(cmd *cobra.Command, args []string) {
+			_, err := handleReq(http.MethodDelete, makePath(general.SnapshotItemURL, args[0]), nil)
+			if err != nil {
+				general.ExitWithError(err)
+				return
+			}
+			general.Infof("snapshot %s is deleted", args[0])
+		},
+	}
+	return cmd
+}
@@ -40,6 +40,14 @@ const (
 	ObjectTemplateURL = APIURL + "/objects-yaml/%s/%s"
 	// ObjectAPIResources is the URL of object api resources.
 	ObjectAPIResources = APIURL + "/object-api-resources"
+	// ObjectVersionsURL is the URL of the versions of an object.
+	ObjectVersionsURL = APIURL + "/objects/%s/versions"
+	// ObjectDiffURL is the URL of the diff between versions of an object.
+	ObjectDiffURL = APIURL + "/objects/%s/diff"
+	// ObjectRollbackURL is the URL to roll back an object.
+	ObjectRollbackURL = APIURL + "/objects/%s/rollback"
+	// ConfigRollbackURL is the URL to roll back the whole config.
+	ConfigRollbackURL = APIURL + "/config/rollback"
 
 	// StatusObjectsURL is the URL of status objects.
 	StatusObjectsURL = APIURL + "/status/objects"
@@ -72,9 +80,36 @@ const (
 	// LogsLevelURL is the URL of logs level.
 	LogsLevelURL = APIURL + "/logs/level"
 
+	// SnapshotsURL is the URL of cluster snapshots.
+	SnapshotsURL = APIURL + "/snapshots"
+	// SnapshotItemURL is the URL of a cluster snapshot.
+	SnapshotItemURL = APIURL + "/snapshots/%s"
+	// SnapshotRestoreURL is the URL to restore the cluster from a stored snapshot.
+	SnapshotRestoreURL = APIURL + "/snapshots/%s/restore"
+	// SnapshotUploadRestoreURL is the URL to restore the cluster from an uploaded snapshot.
+	SnapshotUploadRestoreURL = APIURL + "/snapshots/restore"
+
+	// MigrationsURL is the URL to migrate the object specs.
+	MigrationsURL = APIURL + "/migrations"
+
 	// MetricsURL is the URL of metrics.
 	MetricsURL = APIURL + "/metrics"
 
+	// MeshServicesURL is the URL of mesh services.
+	MeshServicesURL = APIURL + "/mesh/services"
+	// MeshServiceURL is the URL of a mesh service.
+	MeshServiceURL = APIURL + "/mesh/services/%s"
+	// MeshServiceInstancesURL is the URL of mesh service instances.
+	MeshServiceInstancesURL = APIURL + "/mesh/serviceinstances"
+	// MeshServiceInstanceConfigURL is the URL of the effective sidecar config of a mesh service instance.
+	MeshServiceInstanceConfigURL = APIURL + "/mesh/serviceinstances/%s/%s/config"
+	// MeshServiceCanariesURL is the URL of mesh service canaries.
+	MeshServiceCanariesURL = APIURL + "/mesh/servicecanaries"
+	// MeshServiceCanaryURL is the URL of a mesh service canary.
+	MeshServiceCanaryURL = APIURL + "/mesh/servicecanaries/%s"
+	// MeshTenantsURL is the URL of mesh tenants.
+	MeshTenantsURL = APIURL + "/mesh/tenants"
+
 	// HTTPProtocol is prefix for HTTP protocol
 	HTTPProtocol = "http://"
 	// HTTPSProtocol is prefix for HTTPS protocol
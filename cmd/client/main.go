@@ -85,6 +85,7 @@ func main() {
 	addCommandWithGroup(
 		advancedGroup,
 		commandv2.ConvertCmd(),
+		commandv2.MeshCmd(),
 	)
 
 	addCommandWithGroup(
@@ -98,6 +99,11 @@ func main() {
 		commandv2.ConfigCmd(),
 		commandv2.LogsCmd(),
 		commandv2.MetricsCmd(),
+		commandv2.ReplayCmd(),
+		commandv2.SnapshotCmd(),
+		commandv2.MigrateCmd(),
+		commandv2.HistoryCmd(),
+		commandv2.RollbackCmd(),
 	)
 
 	addCommandWithGroup(
@@ -101,10 +101,15 @@ func (s *Server) registerAPIs() {
 	group.Entries = append(group.Entries, s.listAPIEntries()...)
 	group.Entries = append(group.Entries, s.memberAPIEntries()...)
 	group.Entries = append(group.Entries, s.objectAPIEntries()...)
+	group.Entries = append(group.Entries, s.historyAPIEntries()...)
 	group.Entries = append(group.Entries, s.metadataAPIEntries()...)
 	group.Entries = append(group.Entries, s.healthAPIEntries()...)
 	group.Entries = append(group.Entries, s.aboutAPIEntries()...)
 	group.Entries = append(group.Entries, s.customDataAPIEntries()...)
+	group.Entries = append(group.Entries, s.experimentAPIEntries()...)
+	group.Entries = append(group.Entries, s.coordinationAPIEntries()...)
+	group.Entries = append(group.Entries, s.snapshotAPIEntries()...)
+	group.Entries = append(group.Entries, s.migrationAPIEntries()...)
 	group.Entries = append(group.Entries, s.profileAPIEntries()...)
 	group.Entries = append(group.Entries, s.prometheusMetricsAPIEntries()...)
 	group.Entries = append(group.Entries, s.logsAPIEntries()...)
@@ -134,6 +139,11 @@ func (s *Server) healthAPIEntries() []*Entry {
 			Method:  "GET",
 			Handler: func(w http.ResponseWriter, r *http.Request) { /* 200 by default */ },
 		},
+		{
+			Path:    "/status/health",
+			Method:  "GET",
+			Handler: s.clusterHealth,
+		},
 	}
 }
 
@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/history"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 )
@@ -102,18 +103,23 @@ func (s *Server) _listObjects() []*supervisor.Spec {
 }
 
 func (s *Server) _putObject(spec *supervisor.Spec) {
-	err := s.cluster.Put(s.cluster.Layout().ConfigObjectKey(spec.Name()),
-		spec.JSONConfig())
-	if err != nil {
-		ClusterPanic(err)
-	}
+	config := spec.JSONConfig()
+	s._applyObjects(map[string]*string{spec.Name(): &config})
 }
 
 func (s *Server) _deleteObject(name string) {
-	err := s.cluster.Delete(s.cluster.Layout().ConfigObjectKey(name))
+	s._applyObjects(map[string]*string{name: nil})
+}
+
+// _applyObjects changes the objects and records their versions in the
+// history, nil specs delete the objects. The caller must increase the
+// config version after it.
+func (s *Server) _applyObjects(specs map[string]*string) []*history.Change {
+	changes, err := s.history.Apply(s._getVersion()+1, specs)
 	if err != nil {
 		ClusterPanic(err)
 	}
+	return changes
 }
 
 // _getStatusObject returns the status object with the specified name.
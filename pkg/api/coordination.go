@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+)
+
+const (
+	// ElectionPrefix is the URL prefix of APIs for public elections.
+	ElectionPrefix = "/elections"
+	// LockPrefix is the URL prefix of APIs for public locks.
+	LockPrefix = "/locks"
+)
+
+func (s *Server) coordinationAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ElectionPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listElections,
+		},
+		{
+			Path:    ElectionPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.getElection,
+		},
+		{
+			Path:    LockPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listLocks,
+		},
+		{
+			Path:    LockPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.getLock,
+		},
+	}
+}
+
+func (s *Server) listElections(w http.ResponseWriter, r *http.Request) {
+	result, err := cluster.ListElections(s.cluster)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	WriteBody(w, r, result)
+}
+
+func (s *Server) getElection(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	elections, err := cluster.ListElections(s.cluster)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	for _, e := range elections {
+		if e.Name == name {
+			WriteBody(w, r, e)
+			return
+		}
+	}
+	HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("election %s not found", name))
+}
+
+func (s *Server) listLocks(w http.ResponseWriter, r *http.Request) {
+	result, err := cluster.ListLocks(s.cluster)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	WriteBody(w, r, result)
+}
+
+func (s *Server) getLock(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	locks, err := cluster.ListLocks(s.cluster)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	for _, l := range locks {
+		if l.Name == name {
+			WriteBody(w, r, l)
+			return
+		}
+	}
+	HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("lock %s not found", name))
+}
@@ -20,9 +20,11 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/megaease/easegress/v2/pkg/cluster/customdata"
+	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 )
 
@@ -195,6 +197,10 @@ func (s *Server) deleteCustomDataKind(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) listCustomData(w http.ResponseWriter, r *http.Request) {
 	kind := chi.URLParam(r, "kind")
+	if watch, _ := strconv.ParseBool(r.URL.Query().Get("watch")); watch {
+		s.watchCustomData(w, r, kind)
+		return
+	}
 
 	result, err := s.cds.ListData(kind)
 	if err != nil {
@@ -204,6 +210,33 @@ func (s *Server) listCustomData(w http.ResponseWriter, r *http.Request) {
 	WriteBody(w, r, result)
 }
 
+// watchCustomData streams the changes of the custom data of the kind as
+// newline delimited JSON events, until the client disconnects.
+func (s *Server) watchCustomData(w http.ResponseWriter, r *http.Request, kind string) {
+	k, err := s.cds.GetKind(kind)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if k == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("kind %s not found", kind))
+		return
+	}
+
+	flusher := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	err = s.cds.WatchEvents(r.Context(), kind, func(e *customdata.Event) {
+		w.Write(codectool.MustMarshalJSON(e))
+		w.Write([]byte("\n"))
+		flusher.Flush()
+	})
+	if err != nil {
+		logger.Errorf("watch custom data of kind %s failed: %v", kind, err)
+	}
+}
+
 func (s *Server) getCustomData(w http.ResponseWriter, r *http.Request) {
 	kind := chi.URLParam(r, "kind")
 	id := chi.URLParam(r, "id")
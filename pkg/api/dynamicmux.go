@@ -135,6 +135,10 @@ func (m *dynamicMux) reloadAPIs() {
 		}
 	}
 
+	// The metrics API is aliased to /metrics intentionally, which is the
+	// default path scraped by Prometheus.
+	router.Get(PrometheusMetricsPrefix, prometheusMetricsHandler.ServeHTTP)
+
 	m.router.Store(router)
 }
 
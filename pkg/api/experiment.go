@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/experiment"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// ExperimentPrefix is the URL prefix of APIs for experiments.
+const ExperimentPrefix = "/experiments"
+
+func (s *Server) experimentAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ExperimentPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listExperiments,
+		},
+		{
+			Path:    ExperimentPrefix,
+			Method:  http.MethodPost,
+			Handler: s.createExperiment,
+		},
+		{
+			Path:    ExperimentPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.getExperiment,
+		},
+		{
+			Path:    ExperimentPrefix + "/{name}",
+			Method:  http.MethodPut,
+			Handler: s.updateExperiment,
+		},
+		{
+			Path:    ExperimentPrefix + "/{name}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteExperiment,
+		},
+		{
+			Path:    ExperimentPrefix + "/{name}/metrics",
+			Method:  http.MethodGet,
+			Handler: s.getExperimentMetrics,
+		},
+	}
+}
+
+func (s *Server) _getExperiment(name string) *experiment.Experiment {
+	value, err := s.cluster.Get(s.cluster.Layout().ExperimentKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		return nil
+	}
+
+	e := &experiment.Experiment{}
+	codectool.MustUnmarshal([]byte(*value), e)
+	return e
+}
+
+func (s *Server) _putExperiment(e *experiment.Experiment) {
+	key := s.cluster.Layout().ExperimentKey(e.Name)
+	if err := s.cluster.Put(key, string(codectool.MustMarshalJSON(e))); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) readExperiment(r *http.Request) (*experiment.Experiment, error) {
+	e := &experiment.Experiment{}
+	if err := codectool.Decode(r.Body, e); err != nil {
+		return nil, err
+	}
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (s *Server) listExperiments(w http.ResponseWriter, r *http.Request) {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ExperimentPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	result := make([]*experiment.Experiment, 0, len(kvs))
+	for _, v := range kvs {
+		e := &experiment.Experiment{}
+		codectool.MustUnmarshal([]byte(v), e)
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	WriteBody(w, r, result)
+}
+
+func (s *Server) getExperiment(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	e := s._getExperiment(name)
+	if e == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	WriteBody(w, r, e)
+}
+
+func (s *Server) createExperiment(w http.ResponseWriter, r *http.Request) {
+	e, err := s.readExperiment(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getExperiment(e.Name) != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("conflict name: %s", e.Name))
+		return
+	}
+	s._putExperiment(e)
+
+	w.WriteHeader(http.StatusCreated)
+	location := fmt.Sprintf("%s/%s", r.URL.Path, e.Name)
+	w.Header().Set("Location", location)
+}
+
+func (s *Server) updateExperiment(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	e, err := s.readExperiment(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if e.Name != name {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("inconsistent name in url and body"))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getExperiment(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	s._putExperiment(e)
+}
+
+func (s *Server) deleteExperiment(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getExperiment(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if err := s.cluster.Delete(s.cluster.Layout().ExperimentKey(name)); err != nil {
+		ClusterPanic(err)
+	}
+	experiment.ResetMetrics(name)
+}
+
+func (s *Server) getExperimentMetrics(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if s._getExperiment(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	WriteBody(w, r, experiment.Metrics(name))
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/cluster/history"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+// ConfigRollbackPrefix is the URL prefix of API to roll back the whole config.
+const ConfigRollbackPrefix = "/config/rollback"
+
+// ConfigRollbackResult is the result of rolling back the whole config.
+type ConfigRollbackResult struct {
+	Version int64             `json:"version"`
+	DryRun  bool              `json:"dryRun"`
+	Changes []*history.Change `json:"changes"`
+}
+
+func (s *Server) historyAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/versions",
+			Method:  http.MethodGet,
+			Handler: s.listObjectVersions,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/versions/{version}",
+			Method:  http.MethodGet,
+			Handler: s.getObjectVersion,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/diff",
+			Method:  http.MethodGet,
+			Handler: s.diffObjectVersions,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/rollback",
+			Method:  http.MethodPost,
+			Handler: s.rollbackObject,
+		},
+		{
+			Path:    ConfigRollbackPrefix,
+			Method:  http.MethodPost,
+			Handler: s.rollbackConfig,
+		},
+	}
+}
+
+func parseVersion(value string) (int64, error) {
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid version %q", value)
+	}
+	return version, nil
+}
+
+func (s *Server) listObjectVersions(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	versions, err := s.history.List(name)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if len(versions) == 0 && s._getObject(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	WriteBody(w, r, versions)
+}
+
+func (s *Server) _getObjectVersion(w http.ResponseWriter, r *http.Request, name, value string) *history.Version {
+	version, err := parseVersion(value)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return nil
+	}
+
+	v, err := s.history.Get(name, version)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if v == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("version %d of %s not found", version, name))
+	}
+	return v
+}
+
+func (s *Server) getObjectVersion(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if v := s._getObjectVersion(w, r, name, chi.URLParam(r, "version")); v != nil {
+		WriteBody(w, r, v)
+	}
+}
+
+// diffObjectVersions returns the unified diff between the versions from and
+// to of the object, to is the current spec if it is empty.
+func (s *Server) diffObjectVersions(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	from := s._getObjectVersion(w, r, name, r.URL.Query().Get("from"))
+	if from == nil {
+		return
+	}
+
+	var to *history.Version
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to = s._getObjectVersion(w, r, name, value); to == nil {
+			return
+		}
+	} else {
+		to = &history.Version{Version: s._getVersion()}
+		if spec := s._getObject(name); spec != nil {
+			to.Spec = spec.JSONConfig()
+		}
+	}
+
+	diff, err := history.Diff(from, to)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(diff))
+}
+
+// _validateChange validates the change of the object to the spec in JSON,
+// nil spec deletes the object.
+func (s *Server) _validateChange(name string, spec *string) error {
+	current := s._getObject(name)
+
+	if spec == nil {
+		if current == nil {
+			return nil
+		}
+		if current.Categroy() == supervisor.CategorySystemController {
+			return fmt.Errorf("can't delete system controller object")
+		}
+		for _, hook := range objectValidateHooks {
+			if err := hook(OperationTypeDelete, current); err != nil {
+				return fmt.Errorf("validate failed: %v", err)
+			}
+		}
+		return nil
+	}
+
+	newSpec, err := s.super.NewSpec(*spec)
+	if err != nil {
+		return fmt.Errorf("bad spec: %v", err)
+	}
+
+	operation := OperationTypeUpdate
+	if current == nil {
+		if newSpec.Categroy() == supervisor.CategorySystemController {
+			return fmt.Errorf("can't create system controller object")
+		}
+		operation = OperationTypeCreate
+	} else if current.Kind() != newSpec.Kind() {
+		return fmt.Errorf("different kinds: %s, %s", current.Kind(), newSpec.Kind())
+	}
+
+	for _, hook := range objectValidateHooks {
+		if err := hook(operation, newSpec); err != nil {
+			return fmt.Errorf("validate failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// rollbackObject rolls the object back to a version, which is recorded as
+// a new version.
+func (s *Server) rollbackObject(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	v := s._getObjectVersion(w, r, name, r.URL.Query().Get("version"))
+	if v == nil {
+		return
+	}
+
+	var spec *string
+	if v.Action != history.ActionDeleted {
+		spec = &v.Spec
+	}
+	if err := s._validateChange(name, spec); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	changes := s._applyObjects(map[string]*string{name: spec})
+	if len(changes) > 0 {
+		s.upgradeConfigVersion(w, r)
+	}
+	WriteBody(w, r, changes)
+}
+
+// rollbackConfig rolls all the objects back to their versions at a config
+// version in one transaction, it only reports the changes with dryRun=true.
+// The objects not changed since the history is recorded are kept.
+func (s *Server) rollbackConfig(w http.ResponseWriter, r *http.Request) {
+	version, err := parseVersion(r.URL.Query().Get("version"))
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	dryRun := false
+	if value := r.URL.Query().Get("dryRun"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid dryRun %s: %v", value, err))
+			return
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if version > s._getVersion() {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("version %d is newer than the current one", version))
+		return
+	}
+
+	specs, err := s.history.SpecsAt(version)
+	if errors.Is(err, history.ErrOutOfHistory) {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	result := &ConfigRollbackResult{Version: version, DryRun: dryRun, Changes: []*history.Change{}}
+	changes := map[string]*string{}
+	for name, spec := range specs {
+		current, err := s.cluster.Get(s.cluster.Layout().ConfigObjectKey(name))
+		if err != nil {
+			ClusterPanic(err)
+		}
+		if (current == nil && spec == nil) || (current != nil && spec != nil && *current == *spec) {
+			continue
+		}
+		if err := s._validateChange(name, spec); err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s: %v", name, err))
+			return
+		}
+		changes[name] = spec
+		result.Changes = append(result.Changes, &history.Change{Name: name, Action: history.ActionOf(current, spec)})
+	}
+
+	if !dryRun && len(changes) > 0 {
+		result.Changes = s._applyObjects(changes)
+		s.upgradeConfigVersion(w, r)
+	}
+	sort.Slice(result.Changes, func(i, j int) bool { return result.Changes[i].Name < result.Changes[j].Name })
+	WriteBody(w, r, result)
+}
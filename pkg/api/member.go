@@ -98,3 +98,21 @@ func (s *Server) purgeMember(w http.ResponseWriter, r *http.Request) {
 
 	s._purgeMember(memberName)
 }
+
+// clusterHealth responds the health of the cluster, the status code is 503
+// if the cluster is unhealthy, so it could be used by load balancers.
+func (s *Server) clusterHealth(w http.ResponseWriter, r *http.Request) {
+	health, err := s.cluster.Health()
+	if err != nil {
+		HandleAPIError(w, r, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	if !health.Healthy {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(codectool.MustMarshalJSON(health))
+		return
+	}
+	WriteBody(w, r, health)
+}
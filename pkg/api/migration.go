@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/megaease/easegress/v2/pkg/cluster/migration"
+)
+
+// MigrationPrefix is the URL prefix of APIs for migrating object specs.
+const MigrationPrefix = "/migrations"
+
+func (s *Server) migrationAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    MigrationPrefix,
+			Method:  http.MethodPost,
+			Handler: s.migrateObjects,
+		},
+	}
+}
+
+// migrateObjects migrates the object specs stored by older versions to the
+// current schema, it only reports the changes with dryRun=true.
+func (s *Server) migrateObjects(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if value := r.URL.Query().Get("dryRun"); value != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid dryRun %s: %v", value, err))
+			return
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	report, err := migration.Run(s.cluster, dryRun)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	if !dryRun && len(report.Migrated) > 0 {
+		version := s._plusOneVersion()
+		w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", version))
+	}
+	WriteBody(w, r, report)
+}
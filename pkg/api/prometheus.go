@@ -26,12 +26,16 @@ const (
 	PrometheusMetricsPrefix = "/metrics"
 )
 
+// prometheusMetricsHandler is shared by the metrics API and its alias
+// without the API prefix.
+var prometheusMetricsHandler = promhttp.Handler()
+
 func (s *Server) prometheusMetricsAPIEntries() []*Entry {
 	return []*Entry{
 		{
 			Path:    PrometheusMetricsPrefix,
 			Method:  "GET",
-			Handler: promhttp.Handler().ServeHTTP,
+			Handler: prometheusMetricsHandler.ServeHTTP,
 		},
 	}
 }
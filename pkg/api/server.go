@@ -28,6 +28,8 @@ import (
 
 	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/cluster/customdata"
+	"github.com/megaease/easegress/v2/pkg/cluster/history"
+	"github.com/megaease/easegress/v2/pkg/cluster/snapshot"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/option"
 	pprof "github.com/megaease/easegress/v2/pkg/profile"
@@ -43,8 +45,11 @@ type (
 		cluster cluster.Cluster
 		super   *supervisor.Supervisor
 		cds     *customdata.Store
+		history *history.History
 		profile pprof.Profile
 
+		snapshots *snapshot.Manager
+
 		mutex      cluster.Mutex
 		mutexMutex sync.Mutex
 	}
@@ -97,6 +102,12 @@ func MustNewServer(opt *option.Options, cls cluster.Cluster, super *supervisor.S
 	kindPrefix := cls.Layout().CustomDataKindPrefix()
 	dataPrefix := cls.Layout().CustomDataPrefix()
 	s.cds = customdata.NewStore(cls, kindPrefix, dataPrefix)
+	s.history = history.New(cls, opt.ObjectHistoryLimit)
+
+	s.snapshots, err = snapshot.NewManager(opt, cls)
+	if err != nil {
+		logger.Errorf("create snapshot manager failed: %v", err)
+	}
 
 	s.registerAPIs()
 
@@ -129,6 +140,9 @@ func (s *Server) Close(wg *sync.WaitGroup) {
 	}
 
 	s.router.close()
+	if s.snapshots != nil {
+		s.snapshots.Close()
+	}
 
 	logger.Infof("server stopped")
 }
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/cluster/snapshot"
+)
+
+// SnapshotPrefix is the URL prefix of APIs for cluster snapshots.
+const SnapshotPrefix = "/snapshots"
+
+func (s *Server) snapshotAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    SnapshotPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listSnapshots,
+		},
+		{
+			Path:    SnapshotPrefix,
+			Method:  http.MethodPost,
+			Handler: s.takeSnapshot,
+		},
+		{
+			Path:    SnapshotPrefix + "/restore",
+			Method:  http.MethodPost,
+			Handler: s.restoreUploadedSnapshot,
+		},
+		{
+			Path:    SnapshotPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.getSnapshot,
+		},
+		{
+			Path:    SnapshotPrefix + "/{name}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteSnapshot,
+		},
+		{
+			Path:    SnapshotPrefix + "/{name}/restore",
+			Method:  http.MethodPost,
+			Handler: s.restoreSnapshot,
+		},
+	}
+}
+
+func (s *Server) handleSnapshotError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == snapshot.ErrNotFound {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	HandleAPIError(w, r, http.StatusInternalServerError, err)
+}
+
+func (s *Server) listSnapshots(w http.ResponseWriter, r *http.Request) {
+	infos, err := s.snapshots.List()
+	if err != nil {
+		s.handleSnapshotError(w, r, err)
+		return
+	}
+	WriteBody(w, r, infos)
+}
+
+func (s *Server) takeSnapshot(w http.ResponseWriter, r *http.Request) {
+	info, err := s.snapshots.Take()
+	if err != nil {
+		s.handleSnapshotError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", r.URL.Path, info.Name))
+	WriteBody(w, r, info)
+}
+
+func (s *Server) getSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := snapshot.ValidateName(name); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := s.snapshots.Load(name)
+	if err != nil {
+		s.handleSnapshotError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Write(data)
+}
+
+func (s *Server) deleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := snapshot.ValidateName(name); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.snapshots.Delete(name); err != nil {
+		s.handleSnapshotError(w, r, err)
+	}
+}
+
+func (s *Server) restoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := snapshot.ValidateName(name); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := s.snapshots.Load(name)
+	if err != nil {
+		s.handleSnapshotError(w, r, err)
+		return
+	}
+	s._restoreSnapshot(w, r, data)
+}
+
+func (s *Server) restoreUploadedSnapshot(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	s._restoreSnapshot(w, r, data)
+}
+
+func (s *Server) _restoreSnapshot(w http.ResponseWriter, r *http.Request, data []byte) {
+	snap, err := snapshot.Unmarshal(data)
+	if err == nil {
+		err = snap.Validate(s.cluster.Layout())
+	}
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	result, err := s.snapshots.Restore(snap)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	version := s._plusOneVersion()
+	w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", version))
+	WriteBody(w, r, result)
+}
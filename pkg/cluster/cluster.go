@@ -26,10 +26,14 @@ import (
 	"sync"
 	"time"
 
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
 	"go.etcd.io/etcd/server/v3/embed"
 
+	"github.com/megaease/easegress/v2/pkg/cluster/discovery"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/option"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
@@ -67,7 +71,7 @@ type (
 
 		LastDefragTime string `json:"lastDefragTime,omitempty"`
 
-		// Etcd is non-nil only if it's cluster status is primary.
+		// Etcd is non-nil only if it's cluster status is primary or learner.
 		Etcd *EtcdStatus `json:"etcd,omitempty"`
 	}
 
@@ -120,14 +124,17 @@ type cluster struct {
 
 	layout *Layout
 
-	server       *embed.Etcd
-	client       *clientv3.Client
-	lease        *clientv3.LeaseID
-	session      *concurrency.Session
-	serverMutex  sync.RWMutex
-	clientMutex  sync.RWMutex
-	leaseMutex   sync.RWMutex
-	sessionMutex sync.RWMutex
+	server      *embed.Etcd
+	client      *clientv3.Client
+	localClient *clientv3.Client
+	// localWatchClient creates the watchers of localClient.
+	localWatchClient pb.WatchClient
+	lease            *clientv3.LeaseID
+	session          *concurrency.Session
+	serverMutex      sync.RWMutex
+	clientMutex      sync.RWMutex
+	leaseMutex       sync.RWMutex
+	sessionMutex     sync.RWMutex
 
 	done chan struct{}
 }
@@ -141,7 +148,11 @@ func New(opt *option.Options) (Cluster, error) {
 		return nil, fmt.Errorf("invalid cluster request timeout: %v", err)
 	}
 
-	if len(opt.GetPeerURLs()) == 0 {
+	if err := discovery.Bootstrap(opt); err != nil {
+		return nil, fmt.Errorf("discover primary members failed: %v", err)
+	}
+
+	if len(opt.GetEtcdEndpoints()) == 0 {
 		return nil, fmt.Errorf("no peer urls in cluster.initial-cluster for primary and cluster.primary-listen-peer-url for secondary")
 	}
 
@@ -211,6 +222,10 @@ func (c *cluster) run() {
 		go c.defrag()
 	}
 
+	if c.opt.RunEtcdServer() && c.opt.Cluster.Promotion.Policy == "auto" {
+		go c.promote()
+	}
+
 	go c.heartbeat()
 }
 
@@ -236,6 +251,19 @@ func (c *cluster) getReady() error {
 		return nil
 	}
 
+	// learners join the cluster through the primary members.
+	if c.opt.ClusterRole == "learner" {
+		_, err := c.getClient()
+		if err != nil {
+			return err
+		}
+
+		err = c.checkClusterName()
+		if err != nil {
+			return err
+		}
+	}
+
 	done, timeout, err := c.startServer()
 	if err != nil {
 		return fmt.Errorf("start server failed: %v", err)
@@ -310,9 +338,9 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 		return c.client, nil
 	}
 
-	endpoints := c.opt.GetPeerURLs()
+	endpoints := c.opt.GetEtcdEndpoints()
 	logger.Infof("client connect with endpoints: %v", endpoints)
-	client, err := clientv3.New(clientv3.Config{
+	config := clientv3.Config{
 		Endpoints:            endpoints,
 		AutoSyncInterval:     autoSyncInterval,
 		DialTimeout:          dialTimeout,
@@ -320,7 +348,11 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 		DialKeepAliveTimeout: dialKeepAliveTimeout,
 		LogConfig:            logger.EtcdClientLoggerConfig(c.opt, logger.EtcdClientFilename),
 		MaxCallSendMsgSize:   c.opt.Cluster.MaxCallSendMsgSize,
-	})
+	}
+	if err := c.configClientSecurity(&config); err != nil {
+		return nil, err
+	}
+	client, err := clientv3.New(config)
 	if err != nil {
 		return nil, fmt.Errorf("create client failed: %v", err)
 	}
@@ -332,6 +364,33 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 	return client, nil
 }
 
+// configClientSecurity configures the TLS and authentication of the client.
+func (c *cluster) configClientSecurity(config *clientv3.Config) error {
+	opts := &c.opt.Cluster
+	if c.opt.UseEtcdTLS() {
+		certFile, keyFile, caFile := c.opt.GetEtcdClientTLS()
+		tlsInfo := transport.TLSInfo{
+			CertFile:      certFile,
+			KeyFile:       keyFile,
+			TrustedCAFile: caFile,
+		}
+		tlsConfig, err := tlsInfo.ClientConfig()
+		if err != nil {
+			return fmt.Errorf("create etcd client tls config failed: %v", err)
+		}
+		config.TLS = tlsConfig
+	}
+	config.Username = opts.EtcdUsername
+	config.Password = opts.EtcdPassword
+
+	// the external etcd cluster may advertise the client URLs which are
+	// not reachable from Easegress, so they are not synchronized.
+	if len(opts.EtcdEndpoints) > 0 {
+		config.AutoSyncInterval = 0
+	}
+	return nil
+}
+
 func (c *cluster) closeClient() {
 	c.clientMutex.Lock()
 	defer c.clientMutex.Unlock()
@@ -582,6 +641,11 @@ func (c *cluster) startServer() (done, timeout chan struct{}, err error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	if c.opt.ClusterRole == "learner" {
+		if err := c.configLearner(etcdConfig); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	server, err := embed.StartEtcd(etcdConfig)
 	if err != nil {
@@ -616,6 +680,13 @@ func (c *cluster) startServer() (done, timeout chan struct{}, err error) {
 					panic(err)
 				}
 			}
+			if c.opt.ClusterRole == "primary" && c.opt.Cluster.EtcdUsername != "" {
+				if err := c.enableAuth(); err != nil {
+					err = fmt.Errorf("enable etcd authentication failed: %v", err)
+					logger.Errorf("%v", err)
+					panic(err)
+				}
+			}
 			go monitorServer(c.server)
 			logger.Infof("server is ready")
 			close(done)
@@ -628,6 +699,44 @@ func (c *cluster) startServer() (done, timeout chan struct{}, err error) {
 	return done, timeout, nil
 }
 
+// enableAuth enables the authentication of the embedded etcd with the root
+// user, it does nothing if the authentication is already enabled.
+func (c *cluster) enableAuth() error {
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.requestContext()
+	defer cancel()
+
+	status, err := client.AuthStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Enabled {
+		return nil
+	}
+
+	opts := &c.opt.Cluster
+	_, err = client.UserAddWithOptions(ctx, option.EtcdRootUser, opts.EtcdPassword,
+		&clientv3.UserAddOptions{NoPassword: opts.EtcdPassword == ""})
+	if err != nil && err != rpctypes.ErrUserAlreadyExist {
+		return err
+	}
+	_, err = client.UserGrantRole(ctx, option.EtcdRootUser, option.EtcdRootUser)
+	if err != nil {
+		return err
+	}
+	_, err = client.AuthEnable(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("etcd authentication is enabled")
+	return nil
+}
+
 func (c *cluster) closeServer() {
 	c.serverMutex.Lock()
 	defer c.serverMutex.Unlock()
@@ -636,6 +745,11 @@ func (c *cluster) closeServer() {
 		return
 	}
 
+	if c.localClient != nil {
+		c.localClient.Close()
+		c.localClient = nil
+		c.localWatchClient = nil
+	}
 	closeEtcdServer(c.server)
 	c.server = nil
 }
@@ -706,7 +820,7 @@ func (c *cluster) syncStatus() error {
 		Options: *c.opt,
 	}
 
-	if c.opt.ClusterRole == "primary" {
+	if c.opt.RunEtcdServer() {
 		server, err := c.getServer()
 		if err != nil {
 			return err
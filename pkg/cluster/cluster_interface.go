@@ -18,6 +18,7 @@
 package cluster
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -55,11 +56,15 @@ type (
 		// increase/decrease an integer by one, which is very useful to create
 		// a cluster-level counter.
 		STM(apply func(concurrency.STM) error) error
+		// STMWithContext is the same as STM, but the transaction is aborted
+		// once the context is done.
+		STMWithContext(ctx context.Context, apply func(concurrency.STM) error) error
 
 		Watcher() (Watcher, error)
 		Syncer(pullInterval time.Duration) (Syncer, error)
 
 		Mutex(name string) (Mutex, error)
+		Election(name string, ttl time.Duration) (Election, error)
 
 		CloseServer(wg *sync.WaitGroup)
 		StartServer() (chan struct{}, chan struct{}, error)
@@ -67,6 +72,8 @@ type (
 		Close(wg *sync.WaitGroup)
 
 		PurgeMember(member string) error
+
+		Health() (*Health, error)
 	}
 
 	// ClientOp is client operation option type for etcd client used in cluster and watcher
@@ -18,6 +18,7 @@
 package cluster
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
 	"os"
@@ -30,6 +31,7 @@ import (
 	"github.com/phayes/freeport"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
 
 	"github.com/megaease/easegress/v2/pkg/env"
@@ -252,6 +254,126 @@ func TestCluster(t *testing.T) {
 	defer closeClusters([]*cluster{secondaryNode})
 }
 
+func createLearnerNode(clusterName string, primaryListenPeerURLs []string) *cluster {
+	ports, err := freeport.GetFreePorts(3)
+	check(err)
+	name := "learner-member-x"
+	opt := option.New()
+	opt.Name = name
+	opt.ClusterName = clusterName
+	opt.ClusterRole = "learner"
+	opt.ClusterRequestTimeout = "10s"
+	opt.Cluster.ListenClientURLs = []string{fmt.Sprintf("http://localhost:%d", ports[0])}
+	opt.Cluster.AdvertiseClientURLs = opt.Cluster.ListenClientURLs
+	opt.Cluster.ListenPeerURLs = []string{fmt.Sprintf("http://localhost:%d", ports[1])}
+	opt.Cluster.InitialAdvertisePeerURLs = opt.Cluster.ListenPeerURLs
+	opt.Cluster.PrimaryListenPeerURLs = primaryListenPeerURLs
+	opt.APIAddr = fmt.Sprintf("localhost:%d", ports[2])
+	opt.HomeDir = filepath.Join(tempDir, name)
+	opt.DataDir = "data"
+	opt.LogDir = "log"
+
+	err = opt.Parse()
+	check(err)
+
+	env.InitServerDir(opt)
+
+	clusterInstance, err := New(opt)
+	check(err)
+	return clusterInstance.(*cluster)
+}
+
+func TestClusterLearner(t *testing.T) {
+	assert := assert.New(t)
+
+	opts, _ := mockMembers(1)
+	cls, err := New(opts[0])
+	assert.Nil(err)
+	primary := cls.(*cluster)
+	defer closeClusters([]*cluster{primary})
+
+	learner := createLearnerNode(opts[0].ClusterName, opts[0].Cluster.InitialAdvertisePeerURLs)
+	defer closeClusters([]*cluster{learner})
+
+	server, err := learner.getServer()
+	assert.Nil(err)
+	assert.True(server.Server.IsLearner())
+	assert.False(learner.IsLeader())
+
+	client, err := primary.getClient()
+	assert.Nil(err)
+	resp, err := client.MemberList(context.Background())
+	assert.Nil(err)
+	assert.Equal(2, len(resp.Members))
+	for _, m := range resp.Members {
+		assert.Equal(m.Name == learner.opt.Name, m.IsLearner)
+	}
+
+	// the reads and watches are served by the local replica.
+	readClient, err := learner.getReadClient()
+	assert.Nil(err)
+	assert.NotEqual(learner.client, readClient)
+
+	watcher, err := learner.Watcher()
+	assert.Nil(err)
+	defer watcher.Close()
+	ch, err := watcher.Watch("/learner/key")
+	assert.Nil(err)
+
+	assert.Nil(primary.Put("/learner/key", "primary"))
+	assert.Equal("primary", *<-ch)
+
+	// the writes are sent to the primary members.
+	assert.Nil(learner.Put("/learner/key", "learner"))
+	assert.Equal("learner", *<-ch)
+	value, err := primary.Get("/learner/key")
+	assert.Nil(err)
+	assert.Equal("learner", *value)
+	value, err = learner.Get("/learner/key")
+	assert.Nil(err)
+	assert.Equal("learner", *value)
+
+	assert.Nil(learner.syncStatus())
+	status, err := primary.Get(learner.Layout().StatusMemberKey())
+	assert.Nil(err)
+	assert.Contains(*status, `"etcd"`)
+
+	assert.Nil(primary.syncStatus())
+	health, err := primary.Health()
+	assert.Nil(err)
+	assert.True(health.Healthy)
+	assert.Equal(primary.opt.Name, health.Leader)
+	assert.Len(health.Members, 2)
+	for _, m := range health.Members {
+		assert.True(m.Healthy, "%v", m.Errors)
+		assert.NotEmpty(m.LastHeartbeatTime)
+		assert.NotZero(m.DBSize)
+	}
+
+	// the learner rejoins with its data after restarting.
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	learner.CloseServer(wg)
+	done, _, err := learner.StartServer()
+	assert.Nil(err)
+	<-done
+	server, err = learner.getServer()
+	assert.Nil(err)
+	assert.True(server.Server.IsLearner())
+	value, err = learner.Get("/learner/key")
+	assert.Nil(err)
+	assert.Equal("learner", *value)
+
+	// the healthy learner is promoted to keep two voting members.
+	assert.Nil(learner.syncStatus())
+	primary.opt.Cluster.Promotion.Voters = 2
+	state := &promotionState{lastSeen: map[uint64]time.Time{}}
+	assert.Eventually(func() bool {
+		return primary.runPromotion(state) == nil && !server.Server.IsLearner()
+	}, 10*time.Second, 100*time.Millisecond)
+	assert.Nil(primary.runPromotion(state))
+}
+
 func TestLease(t *testing.T) {
 	_, err := strToLease("266394")
 	if err != nil {
@@ -639,6 +761,38 @@ func TestInvalidConfig(t *testing.T) {
 	assert.NotNil(err)
 }
 
+func TestConfigClientSecurity(t *testing.T) {
+	assert := assert.New(t)
+
+	opt := option.New()
+	c := &cluster{opt: opt}
+	config := &clientv3.Config{AutoSyncInterval: autoSyncInterval}
+	assert.Nil(c.configClientSecurity(config))
+	assert.Empty(config.Username)
+	assert.Equal(autoSyncInterval, config.AutoSyncInterval)
+
+	opt.UseStandaloneEtcd = true
+	opt.Cluster.EtcdEndpoints = []string{"http://10.0.0.1:2379"}
+	opt.Cluster.EtcdUsername = "root"
+	opt.Cluster.EtcdPassword = "password"
+	assert.Nil(c.configClientSecurity(config))
+	assert.Equal("root", config.Username)
+	assert.Equal("password", config.Password)
+	assert.Nil(config.TLS)
+	assert.Zero(config.AutoSyncInterval)
+
+	opt.Cluster.EtcdCAFile = filepath.Join(t.TempDir(), "not-exist.pem")
+	assert.NotNil(c.configClientSecurity(config))
+
+	// primary members fall back to the TLS of the peer traffic.
+	opt = option.New()
+	opt.ClusterRole = "primary"
+	opt.Cluster.PeerTrustedCAFile = filepath.Join(t.TempDir(), "not-exist.pem")
+	c = &cluster{opt: opt}
+	assert.True(opt.UseEtcdTLS())
+	assert.NotNil(c.configClientSecurity(&clientv3.Config{}))
+}
+
 func TestRunDefrag(t *testing.T) {
 	assert := assert.New(t)
 	etcdDirName, err := os.MkdirTemp("", "cluster-test")
@@ -683,3 +837,55 @@ func TestRunDefrag(t *testing.T) {
 
 	assert.NotNil(cluster.checkClusterName())
 }
+
+func TestEnableAuth(t *testing.T) {
+	assert := assert.New(t)
+	etcdDirName, err := os.MkdirTemp("", "cluster-test")
+	check(err)
+	defer os.RemoveAll(etcdDirName)
+
+	opt := CreateOptionsForTest(etcdDirName)
+	opt.Cluster.EtcdUsername = option.EtcdRootUser
+	opt.Cluster.EtcdPassword = "password"
+
+	cluster := &cluster{
+		opt:            opt,
+		requestTimeout: 10 * time.Second,
+		done:           make(chan struct{}),
+	}
+	cluster.initLayout()
+	cluster.run()
+	defer func() {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		cluster.CloseServer(wg)
+		wg.Wait()
+	}()
+
+	client, err := cluster.getClient()
+	assert.Nil(err)
+	ctx, cancel := cluster.requestContext()
+	defer cancel()
+	status, err := client.AuthStatus(ctx)
+	assert.Nil(err)
+	assert.True(status.Enabled)
+
+	// the client is authenticated after the authentication is enabled.
+	assert.Nil(cluster.Put("/auth-test", "value"))
+	value, err := cluster.Get("/auth-test")
+	assert.Nil(err)
+	assert.Equal("value", *value)
+
+	// enabling it again is a no-op.
+	assert.Nil(cluster.enableAuth())
+
+	// the clients without credentials are rejected.
+	anonymous, err := clientv3.New(clientv3.Config{
+		Endpoints:   opt.Cluster.AdvertiseClientURLs,
+		DialTimeout: dialTimeout,
+	})
+	assert.Nil(err)
+	defer anonymous.Close()
+	_, err = anonymous.Get(ctx, "/auth-test")
+	assert.NotNil(err)
+}
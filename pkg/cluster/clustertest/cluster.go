@@ -19,6 +19,7 @@
 package clustertest
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -45,13 +46,16 @@ type MockedCluster struct {
 	MockedDelete                 func(key string) error
 	MockedDeletePrefix           func(prefix string) error
 	MockedSTM                    func(apply func(concurrency.STM) error) error
+	MockedSTMWithContext         func(ctx context.Context, apply func(concurrency.STM) error) error
 	MockedWatcher                func() (cluster.Watcher, error)
 	MockedSyncer                 func(pullInterval time.Duration) (cluster.Syncer, error)
 	MockedMutex                  func(name string) (cluster.Mutex, error)
+	MockedElection               func(name string, ttl time.Duration) (cluster.Election, error)
 	MockedCloseServer            func(wg *sync.WaitGroup)
 	MockedStartServer            func() (chan struct{}, chan struct{}, error)
 	MockedClose                  func(wg *sync.WaitGroup)
 	MockedPurgeMember            func(member string) error
+	MockedHealth                 func() (*cluster.Health, error)
 }
 
 var _ cluster.Cluster = (*MockedCluster)(nil)
@@ -181,6 +185,14 @@ func (mc *MockedCluster) STM(apply func(concurrency.STM) error) error {
 	return nil
 }
 
+// STMWithContext implements interface function STMWithContext
+func (mc *MockedCluster) STMWithContext(ctx context.Context, apply func(concurrency.STM) error) error {
+	if mc.MockedSTMWithContext != nil {
+		return mc.MockedSTMWithContext(ctx, apply)
+	}
+	return nil
+}
+
 // Watcher implements interface function Watcher
 func (mc *MockedCluster) Watcher() (cluster.Watcher, error) {
 	if mc.MockedWatcher != nil {
@@ -205,6 +217,14 @@ func (mc *MockedCluster) Mutex(name string) (cluster.Mutex, error) {
 	return nil, nil
 }
 
+// Election implements interface function Election
+func (mc *MockedCluster) Election(name string, ttl time.Duration) (cluster.Election, error) {
+	if mc.MockedElection != nil {
+		return mc.MockedElection(name, ttl)
+	}
+	return nil, nil
+}
+
 // CloseServer implements interface function CloseServer
 func (mc *MockedCluster) CloseServer(wg *sync.WaitGroup) {
 	if mc.MockedCloseServer != nil {
@@ -235,6 +255,14 @@ func (mc *MockedCluster) PurgeMember(member string) error {
 	return nil
 }
 
+// Health implements interface function Health
+func (mc *MockedCluster) Health() (*cluster.Health, error) {
+	if mc.MockedHealth != nil {
+		return mc.MockedHealth()
+	}
+	return &cluster.Health{Healthy: true}, nil
+}
+
 // MockedSTM is a mocked cocurrency.STM
 type MockedSTM struct {
 	// embed concurrency.STM for commit & reset
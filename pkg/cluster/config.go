@@ -21,6 +21,7 @@ import (
 	"net/url"
 	"path/filepath"
 
+	"go.etcd.io/etcd/client/pkg/v3/transport"
 	"go.etcd.io/etcd/server/v3/embed"
 
 	"github.com/megaease/easegress/v2/pkg/common"
@@ -96,6 +97,19 @@ func CreateStaticClusterEtcdConfig(opt *option.Options) (*embed.Config, error) {
 	ec.SnapshotCount = snapshotCount
 	ec.Logger = "zap"
 
+	ec.ClientTLSInfo = transport.TLSInfo{
+		CertFile:       opt.Cluster.ClientCertFile,
+		KeyFile:        opt.Cluster.ClientKeyFile,
+		TrustedCAFile:  opt.Cluster.ClientTrustedCAFile,
+		ClientCertAuth: opt.Cluster.ClientCertAuth,
+	}
+	ec.PeerTLSInfo = transport.TLSInfo{
+		CertFile:       opt.Cluster.PeerCertFile,
+		KeyFile:        opt.Cluster.PeerKeyFile,
+		TrustedCAFile:  opt.Cluster.PeerTrustedCAFile,
+		ClientCertAuth: opt.Cluster.PeerClientCertAuth,
+	}
+
 	ec.LogOutputs = []string{"stdout"}
 	if opt.AbsLogDir != "" {
 		ec.LogOutputs = []string{common.NormalizeZapLogPath(filepath.Join(opt.AbsLogDir, logFilename))}
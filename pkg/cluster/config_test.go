@@ -54,3 +54,32 @@ func TestCreateEtcdConfigFailures(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateEtcdConfigTLS(t *testing.T) {
+	ports, err := freeport.GetFreePorts(3)
+	if err != nil {
+		panic(fmt.Errorf("get %d free ports failed: %v", 3, err))
+	}
+
+	opt := mockTestOpt(ports)
+	opt.Cluster.ClientCertFile = "client-cert.pem"
+	opt.Cluster.ClientKeyFile = "client-key.pem"
+	opt.Cluster.ClientTrustedCAFile = "client-ca.pem"
+	opt.Cluster.ClientCertAuth = true
+	opt.Cluster.PeerCertFile = "peer-cert.pem"
+	opt.Cluster.PeerKeyFile = "peer-key.pem"
+	opt.Cluster.PeerTrustedCAFile = "peer-ca.pem"
+
+	ec, err := CreateStaticClusterEtcdConfig(opt)
+	if err != nil {
+		t.Fatalf("create etcd config failed: %v", err)
+	}
+	if ec.ClientTLSInfo.CertFile != "client-cert.pem" || ec.ClientTLSInfo.KeyFile != "client-key.pem" ||
+		ec.ClientTLSInfo.TrustedCAFile != "client-ca.pem" || !ec.ClientTLSInfo.ClientCertAuth {
+		t.Errorf("unexpected client tls info: %v", ec.ClientTLSInfo)
+	}
+	if ec.PeerTLSInfo.CertFile != "peer-cert.pem" || ec.PeerTLSInfo.KeyFile != "peer-key.pem" ||
+		ec.PeerTLSInfo.TrustedCAFile != "peer-ca.pem" || ec.PeerTLSInfo.ClientCertAuth {
+		t.Errorf("unexpected peer tls info: %v", ec.PeerTLSInfo)
+	}
+}
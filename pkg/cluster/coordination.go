@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+// campaignRetryInterval is the interval to campaign again after a failure
+// or the end of a term.
+var campaignRetryInterval = time.Second
+
+type (
+	// ElectionInfo is the information of a public election.
+	ElectionInfo struct {
+		Name string `json:"name"`
+		// Leader is the value of the elected candidate.
+		Leader string `json:"leader,omitempty"`
+		// Candidates are sorted by their campaign time, the first one is
+		// the leader.
+		Candidates []*CandidateInfo `json:"candidates"`
+	}
+
+	// CandidateInfo is the information of a candidate of an election.
+	CandidateInfo struct {
+		Value string `json:"value"`
+		Lease string `json:"lease"`
+	}
+
+	// LockInfo is the information of a public lock.
+	LockInfo struct {
+		Name string `json:"name"`
+		// Holder is the member holding the lock.
+		Holder string `json:"holder"`
+		Lease  string `json:"lease"`
+		// Waiters is the number of sessions waiting for the lock.
+		Waiters int `json:"waiters"`
+	}
+
+	// owner is a key under the prefix of an election or a lock.
+	owner struct {
+		name  string
+		lease string
+		kv    *mvccpb.KeyValue
+	}
+)
+
+// NewElection creates a public election with the name, the candidates of
+// the same name on all members compete for the leadership.
+func NewElection(cls Cluster, name string, ttl time.Duration) (Election, error) {
+	return cls.Election(cls.Layout().ElectionPrefix(name), ttl)
+}
+
+// NewMutex creates a public mutex with the name. The mutex is bound to the
+// session of the member, so there should be only one mutex of a name in a
+// member, which is shared by goroutines.
+func NewMutex(cls Cluster, name string) (Mutex, error) {
+	return cls.Mutex(cls.Layout().LockPrefix(name))
+}
+
+// RunElected runs the task on only one member of the cluster at a time,
+// like a cron-style task. It campaigns for the election with the name, and
+// runs the task once elected. The context of the task is cancelled when the
+// leadership is lost, the task should return then. The member resigns
+// when the task returns, and campaigns again. RunElected blocks until the
+// context is cancelled.
+func RunElected(ctx context.Context, cls Cluster, name, value string, ttl time.Duration, task func(ctx context.Context)) {
+	for ctx.Err() == nil {
+		if err := runTerm(ctx, cls, name, value, ttl, task); err != nil {
+			logger.Errorf("run elected task of election %s failed: %v", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(campaignRetryInterval):
+		}
+	}
+}
+
+func runTerm(ctx context.Context, cls Cluster, name, value string, ttl time.Duration, task func(ctx context.Context)) error {
+	e, err := NewElection(cls, name, ttl)
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	if err := e.Campaign(ctx, value); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("campaign failed: %v", err)
+	}
+	logger.Infof("%s is elected in election %s", value, name)
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-e.Done():
+			logger.Errorf("%s lost the leadership of election %s", value, name)
+			cancel()
+		case <-taskCtx.Done():
+		}
+	}()
+
+	task(taskCtx)
+	return nil
+}
+
+// ListElections lists the public elections.
+func ListElections(cls Cluster) ([]*ElectionInfo, error) {
+	groups, err := listOwners(cls, cls.Layout().ElectionsPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ElectionInfo, 0, len(groups))
+	for _, owners := range groups {
+		info := &ElectionInfo{Name: owners[0].name}
+		for _, o := range owners {
+			info.Candidates = append(info.Candidates, &CandidateInfo{
+				Value: string(o.kv.Value),
+				Lease: o.lease,
+			})
+		}
+		info.Leader = info.Candidates[0].Value
+		result = append(result, info)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// ListLocks lists the held public locks.
+func ListLocks(cls Cluster) ([]*LockInfo, error) {
+	groups, err := listOwners(cls, cls.Layout().LocksPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	// the locks are held by the sessions of the member leases.
+	leases, err := cls.GetPrefix(cls.Layout().LeasePrefix())
+	if err != nil {
+		return nil, err
+	}
+	members := map[string]string{}
+	for k, v := range leases {
+		members[v] = strings.TrimPrefix(k, cls.Layout().LeasePrefix())
+	}
+
+	result := make([]*LockInfo, 0, len(groups))
+	for _, owners := range groups {
+		result = append(result, &LockInfo{
+			Name:    owners[0].name,
+			Holder:  members[owners[0].lease],
+			Lease:   owners[0].lease,
+			Waiters: len(owners) - 1,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// listOwners returns the owners under the prefix grouped by name, every
+// group is sorted by the creation revision, so the first one is the
+// leader of an election or the holder of a lock.
+func listOwners(cls Cluster, prefix string) (map[string][]*owner, error) {
+	kvs, err := cls.GetRawPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]*owner{}
+	for k, kv := range kvs {
+		// the key is prefix + name + "/" + lease in hex.
+		key := strings.TrimPrefix(k, prefix)
+		i := strings.LastIndex(key, "/")
+		if i <= 0 {
+			continue
+		}
+		o := &owner{name: key[:i], lease: key[i+1:], kv: kv}
+		groups[o.name] = append(groups[o.name], o)
+	}
+
+	for _, owners := range groups {
+		sort.Slice(owners, func(i, j int) bool {
+			return owners[i].kv.CreateRevision < owners[j].kv.CreateRevision
+		})
+	}
+	return groups, nil
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoordination(t *testing.T) {
+	assert := assert.New(t)
+
+	opts, _ := mockMembers(1)
+	cls, err := New(opts[0])
+	assert.Nil(err)
+	c := cls.(*cluster)
+	defer closeClusters([]*cluster{c})
+	_, err = c.getClient()
+	assert.Nil(err)
+
+	// locks
+	m, err := NewMutex(c, "cron")
+	assert.Nil(err)
+	assert.Nil(m.TryLock())
+	assert.ErrorIs(m.TryLock(), ErrLocked)
+
+	locks, err := ListLocks(c)
+	assert.Nil(err)
+	assert.Len(locks, 1)
+	assert.Equal("cron", locks[0].Name)
+	assert.Equal(opts[0].Name, locks[0].Holder)
+	assert.Equal(0, locks[0].Waiters)
+
+	assert.Nil(m.Unlock())
+	locks, err = ListLocks(c)
+	assert.Nil(err)
+	assert.Len(locks, 0)
+
+	// elections
+	oldInterval := campaignRetryInterval
+	campaignRetryInterval = 10 * time.Millisecond
+	defer func() { campaignRetryInterval = oldInterval }()
+
+	var mutex sync.Mutex
+	running := map[string]bool{}
+	concurrent := false
+	task := func(value string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			mutex.Lock()
+			running[value] = true
+			concurrent = concurrent || len(running) > 1
+			mutex.Unlock()
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(200 * time.Millisecond):
+			}
+
+			mutex.Lock()
+			delete(running, value)
+			mutex.Unlock()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	for _, value := range []string{"runner-1", "runner-2"} {
+		value := value
+		go func() {
+			defer wg.Done()
+			RunElected(ctx, c, "cron", value, time.Second, task(value))
+		}()
+	}
+
+	assert.Eventually(func() bool {
+		elections, err := ListElections(c)
+		if err != nil || len(elections) != 1 {
+			return false
+		}
+		e := elections[0]
+		return e.Name == "cron" && len(e.Candidates) == 2 && e.Leader == e.Candidates[0].Value
+	}, 10*time.Second, 10*time.Millisecond)
+
+	time.Sleep(500 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	mutex.Lock()
+	assert.False(concurrent)
+	mutex.Unlock()
+
+	assert.Eventually(func() bool {
+		elections, err := ListElections(c)
+		return err == nil && len(elections) == 0
+	}, 10*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package customdata
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+// cacheRetryInterval is the interval to sync the data again after a failure.
+var cacheRetryInterval = 5 * time.Second
+
+// Cache keeps a local copy of the custom data of a kind, which is synced
+// from the cluster in background. Filters could look up the data at request
+// time with it, without accessing the cluster.
+type Cache struct {
+	store  *Store
+	kind   string
+	data   atomic.Pointer[map[string]Data]
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewCache creates a cache of the custom data of kind 'kind'.
+func NewCache(store *Store, kind string) *Cache {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cache{
+		store:  store,
+		kind:   kind,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go c.run(ctx)
+	return c
+}
+
+func (c *Cache) run(ctx context.Context) {
+	defer close(c.done)
+
+	for {
+		err := c.store.syncData(ctx, c.kind, func(m map[string]Data) {
+			c.data.Store(&m)
+		})
+		if err == nil {
+			return
+		}
+		logger.Errorf("sync custom data of kind %s failed: %v", c.kind, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cacheRetryInterval):
+		}
+	}
+}
+
+// Ready returns whether the data has been synced from the cluster.
+func (c *Cache) Ready() bool {
+	return c.data.Load() != nil
+}
+
+// Get returns the custom data by its ID, or nil if not found.
+// The returned data is shared and must not be modified.
+func (c *Cache) Get(id string) Data {
+	m := c.data.Load()
+	if m == nil {
+		return nil
+	}
+	return (*m)[id]
+}
+
+// List returns all the custom data of the kind.
+// The returned data is shared and must not be modified.
+func (c *Cache) List() []Data {
+	m := c.data.Load()
+	if m == nil {
+		return nil
+	}
+
+	result := make([]Data, 0, len(*m))
+	for _, d := range *m {
+		result = append(result, d)
+	}
+	return result
+}
+
+// Close stops syncing the data.
+func (c *Cache) Close() {
+	c.cancel()
+	<-c.done
+}
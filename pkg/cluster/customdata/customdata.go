@@ -21,6 +21,7 @@ package customdata
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/megaease/easegress/v2/pkg/cluster"
@@ -73,6 +74,23 @@ func (k *Kind) dataID(data Data) string {
 	return id
 }
 
+const (
+	// EventPut is the type of the event that a custom data is created or
+	// updated.
+	EventPut = "put"
+	// EventDelete is the type of the event that a custom data is deleted.
+	EventDelete = "delete"
+)
+
+// Event is a change of a custom data
+type Event struct {
+	Type string `json:"type"`
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	// Data is the new value of the custom data, it is empty for deletions.
+	Data Data `json:"data,omitempty"`
+}
+
 // Store defines the storage for custom data
 type Store struct {
 	cluster    cluster.Cluster
@@ -384,6 +402,18 @@ func (s *Store) DeleteAllData(kind string) error {
 
 // Watch watches the data of custom data kind 'kind'
 func (s *Store) Watch(ctx context.Context, kind string, onChange func([]Data)) error {
+	return s.syncData(ctx, kind, func(m map[string]Data) {
+		data := make([]Data, 0, len(m))
+		for _, d := range m {
+			data = append(data, d)
+		}
+		onChange(data)
+	})
+}
+
+// syncData calls onChange with the full copy of the data of kind 'kind',
+// indexed by ID, whenever the data changes.
+func (s *Store) syncData(ctx context.Context, kind string, onChange func(map[string]Data)) error {
 	syncer, err := s.cluster.Syncer(5 * time.Minute)
 	if err != nil {
 		return err
@@ -401,14 +431,54 @@ func (s *Store) Watch(ctx context.Context, kind string, onChange func([]Data)) e
 			syncer.Close()
 			return nil
 		case m := <-ch:
-			data := make([]Data, 0, len(m))
-			for _, v := range m {
+			data := make(map[string]Data, len(m))
+			for k, v := range m {
 				d, err := unmarshalData(v.Value)
 				if err == nil {
-					data = append(data, d)
+					data[strings.TrimPrefix(k, prefix)] = d
 				}
 			}
 			onChange(data)
 		}
 	}
 }
+
+// WatchEvents watches the changes of the data of custom data kind 'kind',
+// onEvent is called for every change until ctx is done.
+func (s *Store) WatchEvents(ctx context.Context, kind string, onEvent func(*Event)) error {
+	watcher, err := s.cluster.Watcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	prefix := s.dataPrefix(kind)
+	ch, err := watcher.WatchRawPrefix(prefix)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("watch custom data of kind %s canceled", kind)
+			}
+			for k, e := range m {
+				event := &Event{Kind: kind, ID: strings.TrimPrefix(k, prefix)}
+				if e == nil {
+					event.Type = EventDelete
+				} else {
+					data, err := unmarshalData(e.Kv.Value)
+					if err != nil {
+						continue
+					}
+					event.Type, event.Data = EventPut, data
+				}
+				onEvent(event)
+			}
+		}
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/util/dynamicobject"
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
 )
 
@@ -582,3 +583,91 @@ func TestWatch(t *testing.T) {
 
 	cancel()
 }
+
+func TestWatchEvents(t *testing.T) {
+	cls := clustertest.NewMockedCluster()
+	s := NewStore(cls, "/kind/", "/data/")
+
+	ch := make(chan map[string]*clientv3.Event, 10)
+	watcher := clustertest.NewMockedWatcher()
+	watcher.MockedWatchRawPrefix = func(prefix string) (<-chan map[string]*clientv3.Event, error) {
+		if prefix != "/data/kind1/" {
+			t.Errorf("prefix should be '/data/kind1/' instead of %q", prefix)
+		}
+		return ch, nil
+	}
+	cls.MockedWatcher = func() (cluster.Watcher, error) {
+		return watcher, nil
+	}
+
+	ch <- map[string]*clientv3.Event{
+		"/data/kind1/data1": {Kv: &mvccpb.KeyValue{Value: []byte(`{"name": "data1"}`)}},
+	}
+	ch <- map[string]*clientv3.Event{"/data/kind1/data1": nil}
+	close(ch)
+
+	var events []*Event
+	err := s.WatchEvents(context.Background(), "kind1", func(e *Event) {
+		events = append(events, e)
+	})
+	if err == nil {
+		t.Errorf("WatchEvents should fail when the watcher is canceled")
+	}
+	if len(events) != 2 {
+		t.Fatalf("there should be 2 events instead of %d", len(events))
+	}
+	if e := events[0]; e.Type != EventPut || e.ID != "data1" || e.Data.GetString("name") != "data1" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if e := events[1]; e.Type != EventDelete || e.ID != "data1" || e.Data != nil {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestCache(t *testing.T) {
+	cls := clustertest.NewMockedCluster()
+	s := NewStore(cls, "/kind/", "/data/")
+
+	ch := make(chan map[string]*mvccpb.KeyValue, 10)
+	syncer := clustertest.NewMockedSyncer()
+	syncer.MockedSyncRawPrefix = func(prefix string) (<-chan map[string]*mvccpb.KeyValue, error) {
+		return ch, nil
+	}
+	cls.MockedSyncer = func(pullInterval time.Duration) (cluster.Syncer, error) {
+		return syncer, nil
+	}
+
+	c := NewCache(s, "kind1")
+	defer c.Close()
+	if c.Ready() || c.Get("data1") != nil || c.List() != nil {
+		t.Errorf("cache should be empty before synced")
+	}
+
+	ch <- map[string]*mvccpb.KeyValue{
+		"/data/kind1/data1": {Value: []byte(`{"name": "data1", "value": "v1"}`)},
+		"/data/kind1/data2": {Value: []byte(`{"name": "data2"}`)},
+	}
+	waitFor := func(cond func() bool) {
+		for i := 0; i < 100 && !cond(); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !cond() {
+			t.Fatalf("cache is not synced")
+		}
+	}
+	waitFor(c.Ready)
+	if v := c.Get("data1").GetString("value"); v != "v1" {
+		t.Errorf("value should be 'v1' instead of %q", v)
+	}
+	if l := len(c.List()); l != 2 {
+		t.Errorf("there should be 2 data instead of %d", l)
+	}
+
+	ch <- map[string]*mvccpb.KeyValue{
+		"/data/kind1/data1": {Value: []byte(`{"name": "data1", "value": "v2"}`)},
+	}
+	waitFor(func() bool { return c.Get("data2") == nil })
+	if v := c.Get("data1").GetString("value"); v != "v2" {
+		t.Errorf("value should be 'v2' instead of %q", v)
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package discovery discovers the primary members of the cluster while
+// bootstrapping, from DNS SRV records, cloud instance tags or Kubernetes
+// services.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/wal"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+// retryInterval is the interval to retry discovering the primary members.
+var retryInterval = 5 * time.Second
+
+type (
+	// Peer is a discovered primary member.
+	Peer struct {
+		// Name is the name of the member, it is only a hint because the
+		// member names are published after the members start.
+		Name    string
+		PeerURL string
+	}
+
+	// Discoverer discovers the primary members.
+	Discoverer interface {
+		Discover(ctx context.Context) ([]*Peer, error)
+	}
+)
+
+// New creates a discoverer of the discovery type.
+func New(opt *option.Options) (Discoverer, error) {
+	d := &opt.Cluster.Discovery
+	scheme := "http"
+	if opt.UseEtcdTLS() {
+		scheme = "https"
+	}
+
+	switch d.Type {
+	case "dns-srv":
+		return newSRVDiscoverer(d), nil
+	case "ec2":
+		return newEC2Discoverer(d, scheme), nil
+	case "gce":
+		return newGCEDiscoverer(d, scheme), nil
+	case "kubernetes":
+		return newKubernetesDiscoverer(d, scheme)
+	default:
+		return nil, fmt.Errorf("unknown discovery type %s", d.Type)
+	}
+}
+
+// Bootstrap discovers the primary members and fills cluster.initial-cluster
+// for primary members, or cluster.primary-listen-peer-urls for the others.
+// It does nothing if the discovery isn't configured, or the primary member
+// has joined the cluster before.
+func Bootstrap(opt *option.Options) error {
+	d := &opt.Cluster.Discovery
+	if d.Type == "" {
+		return nil
+	}
+	if opt.ClusterRole == "primary" && hasWAL(opt) {
+		// the initial cluster is ignored while restarting, but it must
+		// contain the member itself.
+		logger.Infof("skip discovery: member %s has joined the cluster", opt.Name)
+		opt.Cluster.InitialCluster = map[string]string{opt.Name: opt.Cluster.InitialAdvertisePeerURLs[0]}
+		return nil
+	}
+
+	discoverer, err := New(opt)
+	if err != nil {
+		return err
+	}
+	timeout, err := time.ParseDuration(d.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid discovery timeout %s: %v", d.Timeout, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return discover(ctx, opt, discoverer)
+}
+
+// discover retries until the discovered peers are applied or the context
+// is done.
+func discover(ctx context.Context, opt *option.Options, discoverer Discoverer) error {
+	d := &opt.Cluster.Discovery
+	for {
+		peers, err := discoverer.Discover(ctx)
+		if err == nil {
+			err = apply(opt, peers)
+		}
+		if err == nil {
+			return nil
+		}
+
+		logger.Warnf("discover primary members by %s failed, retry in %v: %v", d.Type, retryInterval, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("discover primary members by %s timeout: %v", d.Type, err)
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func hasWAL(opt *option.Options) bool {
+	walDir := opt.AbsWALDir
+	if walDir == "" {
+		walDir = filepath.Join(opt.AbsDataDir, "member", "wal")
+	}
+	return wal.Exist(walDir)
+}
+
+// apply applies the discovered peers to the options.
+func apply(opt *option.Options, peers []*Peer) error {
+	if len(peers) == 0 {
+		return fmt.Errorf("no primary members found")
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].PeerURL < peers[j].PeerURL
+	})
+
+	if opt.ClusterRole != "primary" {
+		urls := make([]string, 0, len(peers))
+		for _, p := range peers {
+			urls = append(urls, p.PeerURL)
+		}
+		opt.Cluster.PrimaryListenPeerURLs = urls
+		logger.Infof("discovered primary members: %v", urls)
+		return nil
+	}
+
+	expectedSize := opt.Cluster.Discovery.ExpectedSize
+	if expectedSize > 0 && len(peers) != expectedSize {
+		return fmt.Errorf("found %d primary members, expected %d", len(peers), expectedSize)
+	}
+
+	initialCluster := map[string]string{}
+	foundSelf := false
+	for i, p := range peers {
+		name := p.Name
+		if !foundSelf && isSelf(opt, p.PeerURL) {
+			name, foundSelf = opt.Name, true
+		} else if name == "" || name == opt.Name {
+			name = fmt.Sprintf("discovered-member-%d", i)
+		}
+		if _, exists := initialCluster[name]; exists {
+			name = fmt.Sprintf("%s-%d", name, i)
+		}
+		initialCluster[name] = p.PeerURL
+	}
+	if !foundSelf {
+		return fmt.Errorf("member %s with peer urls %v is not in discovered primary members",
+			opt.Name, opt.Cluster.InitialAdvertisePeerURLs)
+	}
+
+	opt.Cluster.InitialCluster = initialCluster
+	logger.Infof("discovered initial cluster: %s", opt.InitialClusterToString())
+	return nil
+}
+
+// isSelf returns true if the peer URL is one of the advertised peer URLs of
+// the member, the hosts are compared by their addresses, because the member
+// may advertise a host name but the peer is discovered by the address.
+func isSelf(opt *option.Options, peerURL string) bool {
+	pu, err := url.Parse(peerURL)
+	if err != nil {
+		return false
+	}
+
+	for _, s := range opt.Cluster.InitialAdvertisePeerURLs {
+		if s == peerURL {
+			return true
+		}
+		su, err := url.Parse(s)
+		if err != nil || su.Port() != pu.Port() {
+			continue
+		}
+		if strings.EqualFold(su.Hostname(), pu.Hostname()) {
+			return true
+		}
+		if sameAddrs(su.Hostname(), pu.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameAddrs(host1, host2 string) bool {
+	addrs1, err := net.LookupHost(host1)
+	if err != nil {
+		return false
+	}
+	addrs2, err := net.LookupHost(host2)
+	if err != nil {
+		return false
+	}
+	for _, a1 := range addrs1 {
+		for _, a2 := range addrs2 {
+			if a1 == a2 {
+				return true
+			}
+		}
+	}
+	return false
+}
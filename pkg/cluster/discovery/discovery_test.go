@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+type fakeDiscoverer struct {
+	peers [][]*Peer
+	calls int
+}
+
+func (d *fakeDiscoverer) Discover(ctx context.Context) ([]*Peer, error) {
+	d.calls++
+	if d.calls > len(d.peers) {
+		return nil, fmt.Errorf("no more peers")
+	}
+	return d.peers[d.calls-1], nil
+}
+
+func newOptions(role string) *option.Options {
+	opt := option.New()
+	opt.Name = "member-1"
+	opt.ClusterRole = role
+	opt.Cluster.InitialAdvertisePeerURLs = []string{"http://10.0.0.1:2380"}
+	opt.Cluster.Discovery.Type = "dns-srv"
+	return opt
+}
+
+func TestApply(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(apply(newOptions("primary"), nil))
+
+	// primary
+	opt := newOptions("primary")
+	opt.Cluster.Discovery.ExpectedSize = 3
+	peers := []*Peer{
+		{Name: "node-c", PeerURL: "http://10.0.0.3:2380"},
+		{Name: "node-a", PeerURL: "http://10.0.0.1:2380"},
+	}
+	assert.Error(apply(opt, peers))
+
+	peers = append(peers, &Peer{Name: "node-c", PeerURL: "http://10.0.0.2:2380"})
+	assert.NoError(apply(opt, peers))
+	assert.Equal(map[string]string{
+		"member-1": "http://10.0.0.1:2380",
+		"node-c":   "http://10.0.0.2:2380",
+		"node-c-2": "http://10.0.0.3:2380",
+	}, opt.Cluster.InitialCluster)
+
+	// the member itself isn't discovered
+	opt = newOptions("primary")
+	opt.Cluster.InitialAdvertisePeerURLs = []string{"http://10.0.0.9:2380"}
+	assert.Error(apply(opt, peers))
+
+	// the host name of the member itself
+	opt = newOptions("primary")
+	opt.Cluster.InitialAdvertisePeerURLs = []string{"http://localhost:2380"}
+	assert.NoError(apply(opt, []*Peer{
+		{Name: "member-1", PeerURL: "http://127.0.0.1:2380"},
+		{Name: "", PeerURL: "http://10.0.0.2:2380"},
+	}))
+	assert.Equal(map[string]string{
+		"member-1":            "http://127.0.0.1:2380",
+		"discovered-member-0": "http://10.0.0.2:2380",
+	}, opt.Cluster.InitialCluster)
+
+	// secondary
+	opt = newOptions("secondary")
+	assert.NoError(apply(opt, peers))
+	assert.Equal([]string{
+		"http://10.0.0.1:2380",
+		"http://10.0.0.2:2380",
+		"http://10.0.0.3:2380",
+	}, opt.Cluster.PrimaryListenPeerURLs)
+}
+
+func TestDiscover(t *testing.T) {
+	assert := assert.New(t)
+
+	interval := retryInterval
+	retryInterval = 10 * time.Millisecond
+	defer func() {
+		retryInterval = interval
+	}()
+
+	opt := newOptions("primary")
+	d := &fakeDiscoverer{peers: [][]*Peer{
+		{{Name: "node-2", PeerURL: "http://10.0.0.2:2380"}},
+		{{Name: "node-2", PeerURL: "http://10.0.0.2:2380"}, {Name: "node-1", PeerURL: "http://10.0.0.1:2380"}},
+	}}
+	assert.NoError(discover(context.Background(), opt, d))
+	assert.Equal(2, d.calls)
+	assert.Equal(map[string]string{
+		"member-1": "http://10.0.0.1:2380",
+		"node-2":   "http://10.0.0.2:2380",
+	}, opt.Cluster.InitialCluster)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(discover(ctx, newOptions("primary"), &fakeDiscoverer{}))
+}
+
+func TestBootstrap(t *testing.T) {
+	assert := assert.New(t)
+
+	opt := newOptions("primary")
+	opt.Cluster.Discovery.Type = ""
+	assert.NoError(Bootstrap(opt))
+
+	opt = newOptions("primary")
+	opt.Cluster.Discovery.Type = "unknown"
+	assert.Error(Bootstrap(opt))
+
+	opt = newOptions("primary")
+	opt.Cluster.Discovery.Timeout = "invalid"
+	assert.Error(Bootstrap(opt))
+
+	// the member which has joined the cluster skips the discovery.
+	dir, err := os.MkdirTemp("", "discovery-test")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	assert.NoError(os.MkdirAll(dir+"/member/wal", 0o700))
+	assert.NoError(os.WriteFile(dir+"/member/wal/0000000000000000-0000000000000000.wal", nil, 0o600))
+
+	opt = newOptions("primary")
+	opt.Cluster.Discovery.Type = "unknown"
+	opt.AbsDataDir = dir
+	assert.NoError(Bootstrap(opt))
+	assert.Equal(map[string]string{"member-1": "http://10.0.0.1:2380"}, opt.Cluster.InitialCluster)
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+const (
+	ec2APIVersion = "2016-11-15"
+	// the SHA256 hash of the empty payload.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+type (
+	// ec2Discoverer discovers the primary members from the running EC2
+	// instances with the tags, by their private IP addresses.
+	ec2Discoverer struct {
+		region   string
+		endpoint string
+		tags     map[string]string
+		scheme   string
+		port     int
+
+		loadConfig func(ctx context.Context, region string) (aws.Config, error)
+		signer     *v4.Signer
+		client     *http.Client
+	}
+
+	ec2DescribeInstancesResponse struct {
+		Reservations []struct {
+			Instances []struct {
+				InstanceID       string `xml:"instanceId"`
+				PrivateIPAddress string `xml:"privateIpAddress"`
+				Tags             []struct {
+					Key   string `xml:"key"`
+					Value string `xml:"value"`
+				} `xml:"tagSet>item"`
+			} `xml:"instancesSet>item"`
+		} `xml:"reservationSet>item"`
+		NextToken string `xml:"nextToken"`
+	}
+)
+
+func newEC2Discoverer(opts *option.DiscoveryOptions, scheme string) *ec2Discoverer {
+	return &ec2Discoverer{
+		region:     opts.EC2Region,
+		endpoint:   opts.EC2Endpoint,
+		tags:       opts.Tags,
+		scheme:     scheme,
+		port:       opts.PeerPort,
+		loadConfig: loadAWSConfig,
+		signer:     v4.NewSigner(),
+		client:     http.DefaultClient,
+	}
+}
+
+// loadAWSConfig loads the credentials from the environment variables, the
+// shared config files or the IAM role of the instance, the region falls
+// back to the one of the instance.
+func loadAWSConfig(ctx context.Context, region string) (aws.Config, error) {
+	if region != "" {
+		return config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	}
+	return config.LoadDefaultConfig(ctx, config.WithEC2IMDSRegion())
+}
+
+func (d *ec2Discoverer) Discover(ctx context.Context) ([]*Peer, error) {
+	cfg, err := d.loadConfig(ctx, d.region)
+	if err != nil {
+		return nil, fmt.Errorf("load aws config failed: %v", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("unknown region of ec2 instances")
+	}
+	credentials, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve aws credentials failed: %v", err)
+	}
+
+	endpoint := d.endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://ec2.%s.amazonaws.com", cfg.Region)
+	}
+
+	var peers []*Peer
+	token := ""
+	for {
+		resp, err := d.describeInstances(ctx, endpoint, cfg.Region, credentials, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resp.Reservations {
+			for _, i := range r.Instances {
+				if i.PrivateIPAddress == "" {
+					continue
+				}
+				name := i.InstanceID
+				for _, t := range i.Tags {
+					if t.Key == "Name" && t.Value != "" {
+						name = t.Value
+					}
+				}
+				peers = append(peers, &Peer{
+					Name:    name,
+					PeerURL: fmt.Sprintf("%s://%s", d.scheme, net.JoinHostPort(i.PrivateIPAddress, strconv.Itoa(d.port))),
+				})
+			}
+		}
+
+		if resp.NextToken == "" {
+			return peers, nil
+		}
+		token = resp.NextToken
+	}
+}
+
+func (d *ec2Discoverer) describeInstances(ctx context.Context, endpoint, region string,
+	credentials aws.Credentials, token string,
+) (*ec2DescribeInstancesResponse, error) {
+	q := url.Values{}
+	q.Set("Action", "DescribeInstances")
+	q.Set("Version", ec2APIVersion)
+	q.Set("Filter.1.Name", "instance-state-name")
+	q.Set("Filter.1.Value.1", "running")
+	keys := make([]string, 0, len(d.tags))
+	for k := range d.tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		q.Set(fmt.Sprintf("Filter.%d.Name", i+2), "tag:"+k)
+		q.Set(fmt.Sprintf("Filter.%d.Value.1", i+2), d.tags[k])
+	}
+	if token != "" {
+		q.Set("NextToken", token)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	err = d.signer.SignHTTP(ctx, credentials, req, emptyPayloadHash, "ec2", region, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("sign request failed: %v", err)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("describe ec2 instances failed: %s: %s", resp.Status, data)
+	}
+
+	result := &ec2DescribeInstancesResponse{}
+	if err := xml.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("unmarshal ec2 instances failed: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+const ec2Page1 = `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <reservationSet>
+    <item>
+      <instancesSet>
+        <item>
+          <instanceId>i-0001</instanceId>
+          <privateIpAddress>10.0.0.1</privateIpAddress>
+          <tagSet>
+            <item><key>Name</key><value>node-1</value></item>
+            <item><key>cluster</key><value>easegress</value></item>
+          </tagSet>
+        </item>
+        <item>
+          <instanceId>i-0002</instanceId>
+        </item>
+      </instancesSet>
+    </item>
+  </reservationSet>
+  <nextToken>page-2</nextToken>
+</DescribeInstancesResponse>`
+
+const ec2Page2 = `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <reservationSet>
+    <item>
+      <instancesSet>
+        <item>
+          <instanceId>i-0003</instanceId>
+          <privateIpAddress>10.0.0.3</privateIpAddress>
+        </item>
+      </instancesSet>
+    </item>
+  </reservationSet>
+</DescribeInstancesResponse>`
+
+func TestEC2Discoverer(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=key-id/") ||
+			q.Get("Action") != "DescribeInstances" ||
+			q.Get("Filter.1.Value.1") != "running" ||
+			q.Get("Filter.2.Name") != "tag:cluster" ||
+			q.Get("Filter.2.Value.1") != "easegress" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if q.Get("NextToken") == "page-2" {
+			fmt.Fprint(w, ec2Page2)
+		} else {
+			fmt.Fprint(w, ec2Page1)
+		}
+	}))
+	defer server.Close()
+
+	d := newEC2Discoverer(&option.DiscoveryOptions{
+		EC2Region:   "us-east-1",
+		EC2Endpoint: server.URL,
+		Tags:        map[string]string{"cluster": "easegress"},
+		PeerPort:    2380,
+	}, "https")
+	d.loadConfig = func(ctx context.Context, region string) (aws.Config, error) {
+		return aws.Config{
+			Region: region,
+			Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+				return aws.Credentials{AccessKeyID: "key-id", SecretAccessKey: "secret"}, nil
+			}),
+		}, nil
+	}
+
+	peers, err := d.Discover(context.Background())
+	assert.NoError(err)
+	assert.Equal([]*Peer{
+		{Name: "node-1", PeerURL: "https://10.0.0.1:2380"},
+		{Name: "i-0003", PeerURL: "https://10.0.0.3:2380"},
+	}, peers)
+
+	d.tags = map[string]string{"cluster": "other"}
+	_, err = d.Discover(context.Background())
+	assert.Error(err)
+
+	d.region = ""
+	_, err = d.Discover(context.Background())
+	assert.Error(err)
+}
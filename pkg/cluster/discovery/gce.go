@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+const (
+	gceMetadataURL = "http://metadata.google.internal/computeMetadata/v1"
+	gceComputeURL  = "https://compute.googleapis.com/compute/v1"
+)
+
+type (
+	// gceDiscoverer discovers the primary members from the running GCE
+	// instances with the labels, by the internal IP addresses of their
+	// first network interfaces. It authenticates with the default service
+	// account of the instance.
+	gceDiscoverer struct {
+		project string
+		labels  map[string]string
+		scheme  string
+		port    int
+
+		metadataURL string
+		computeURL  string
+		client      *http.Client
+	}
+
+	gceInstanceList struct {
+		Items map[string]struct {
+			Instances []gceInstance `json:"instances"`
+		} `json:"items"`
+		NextPageToken string `json:"nextPageToken"`
+	}
+
+	gceInstance struct {
+		Name              string            `json:"name"`
+		Status            string            `json:"status"`
+		Labels            map[string]string `json:"labels"`
+		NetworkInterfaces []struct {
+			NetworkIP string `json:"networkIP"`
+		} `json:"networkInterfaces"`
+	}
+
+	gceToken struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}
+)
+
+func newGCEDiscoverer(opts *option.DiscoveryOptions, scheme string) *gceDiscoverer {
+	return &gceDiscoverer{
+		project:     opts.GCEProject,
+		labels:      opts.Tags,
+		scheme:      scheme,
+		port:        opts.PeerPort,
+		metadataURL: gceMetadataURL,
+		computeURL:  gceComputeURL,
+		client:      http.DefaultClient,
+	}
+}
+
+func (d *gceDiscoverer) Discover(ctx context.Context) ([]*Peer, error) {
+	project := d.project
+	if project == "" {
+		data, err := d.getMetadata(ctx, "project/project-id")
+		if err != nil {
+			return nil, fmt.Errorf("get project id failed: %v", err)
+		}
+		project = strings.TrimSpace(string(data))
+	}
+
+	data, err := d.getMetadata(ctx, "instance/service-accounts/default/token")
+	if err != nil {
+		return nil, fmt.Errorf("get access token failed: %v", err)
+	}
+	token := &gceToken{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("unmarshal access token failed: %v", err)
+	}
+
+	var peers []*Peer
+	pageToken := ""
+	for {
+		list, err := d.listInstances(ctx, project, token, pageToken)
+		if err != nil {
+			return nil, err
+		}
+
+		// sort the zones to keep the order of the peers stable.
+		zones := make([]string, 0, len(list.Items))
+		for zone := range list.Items {
+			zones = append(zones, zone)
+		}
+		sort.Strings(zones)
+
+		for _, zone := range zones {
+			for _, i := range list.Items[zone].Instances {
+				if !d.match(&i) {
+					continue
+				}
+				peers = append(peers, &Peer{
+					Name:    i.Name,
+					PeerURL: fmt.Sprintf("%s://%s", d.scheme, net.JoinHostPort(i.NetworkInterfaces[0].NetworkIP, strconv.Itoa(d.port))),
+				})
+			}
+		}
+
+		if list.NextPageToken == "" {
+			return peers, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+// match checks the instance again, because the filter of the aggregated
+// list is not guaranteed to be applied to the labels.
+func (d *gceDiscoverer) match(i *gceInstance) bool {
+	if i.Status != "RUNNING" {
+		return false
+	}
+	if len(i.NetworkInterfaces) == 0 || i.NetworkInterfaces[0].NetworkIP == "" {
+		return false
+	}
+	for k, v := range d.labels {
+		if i.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *gceDiscoverer) getMetadata(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.metadataURL+"/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return d.do(req)
+}
+
+func (d *gceDiscoverer) listInstances(ctx context.Context, project string, token *gceToken, pageToken string) (*gceInstanceList, error) {
+	filters := []string{`status = "RUNNING"`}
+	keys := make([]string, 0, len(d.labels))
+	for k := range d.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		filters = append(filters, fmt.Sprintf(`labels.%s = "%s"`, k, d.labels[k]))
+	}
+
+	q := url.Values{}
+	q.Set("filter", strings.Join(filters, " AND "))
+	if pageToken != "" {
+		q.Set("pageToken", pageToken)
+	}
+
+	u := fmt.Sprintf("%s/projects/%s/aggregated/instances?%s", d.computeURL, url.PathEscape(project), q.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	tokenType := token.TokenType
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+	req.Header.Set("Authorization", tokenType+" "+token.AccessToken)
+
+	data, err := d.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("list gce instances failed: %v", err)
+	}
+	list := &gceInstanceList{}
+	if err := json.Unmarshal(data, list); err != nil {
+		return nil, fmt.Errorf("unmarshal gce instances failed: %v", err)
+	}
+	return list, nil
+}
+
+func (d *gceDiscoverer) do(req *http.Request) ([]byte, error) {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, data)
+	}
+	return data, nil
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+func TestGCEDiscoverer(t *testing.T) {
+	assert := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata/project/project-id", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, "my-project")
+	})
+	mux.HandleFunc("/metadata/instance/service-accounts/default/token", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`)
+	})
+	mux.HandleFunc("/compute/projects/my-project/aggregated/instances", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(`status = "RUNNING" AND labels.cluster = "easegress"`, r.URL.Query().Get("filter"))
+		if r.URL.Query().Get("pageToken") == "page-2" {
+			fmt.Fprint(w, `{"items":{"zones/us-central1-b":{"instances":[
+				{"name":"node-3","status":"RUNNING","labels":{"cluster":"easegress"},"networkInterfaces":[{"networkIP":"10.0.0.3"}]}
+			]}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"items":{
+			"zones/us-central1-a":{"instances":[
+				{"name":"node-1","status":"RUNNING","labels":{"cluster":"easegress"},"networkInterfaces":[{"networkIP":"10.0.0.1"}]},
+				{"name":"node-2","status":"STOPPED","labels":{"cluster":"easegress"},"networkInterfaces":[{"networkIP":"10.0.0.2"}]},
+				{"name":"other","status":"RUNNING","labels":{"cluster":"other"},"networkInterfaces":[{"networkIP":"10.0.0.9"}]}
+			]},
+			"zones/us-central1-c":{}
+		},"nextPageToken":"page-2"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	d := newGCEDiscoverer(&option.DiscoveryOptions{
+		Tags:     map[string]string{"cluster": "easegress"},
+		PeerPort: 2380,
+	}, "http")
+	d.metadataURL = server.URL + "/metadata"
+	d.computeURL = server.URL + "/compute"
+
+	peers, err := d.Discover(context.Background())
+	assert.NoError(err)
+	assert.Equal([]*Peer{
+		{Name: "node-1", PeerURL: "http://10.0.0.1:2380"},
+		{Name: "node-3", PeerURL: "http://10.0.0.3:2380"},
+	}, peers)
+
+	d.project = "not-exist"
+	_, err = d.Discover(context.Background())
+	assert.Error(err)
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+	"github.com/megaease/easegress/v2/pkg/util/k8s"
+)
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// kubernetesDiscoverer discovers the primary members from the endpoints of
+// a headless service, the addresses not ready are included because the
+// members are not ready before the cluster is bootstrapped.
+type kubernetesDiscoverer struct {
+	namespace string
+	service   string
+	scheme    string
+	port      int
+
+	client kubernetes.Interface
+}
+
+func newKubernetesDiscoverer(opts *option.DiscoveryOptions, scheme string) (*kubernetesDiscoverer, error) {
+	client, err := k8s.NewK8sClientInCluster()
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := opts.KubernetesNamespace
+	if namespace == "" {
+		namespace = "default"
+		if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+			namespace = strings.TrimSpace(string(data))
+		}
+	}
+
+	return &kubernetesDiscoverer{
+		namespace: namespace,
+		service:   opts.KubernetesService,
+		scheme:    scheme,
+		port:      opts.PeerPort,
+		client:    client,
+	}, nil
+}
+
+func (d *kubernetesDiscoverer) Discover(ctx context.Context) ([]*Peer, error) {
+	endpoints, err := d.client.CoreV1().Endpoints(d.namespace).Get(ctx, d.service, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get endpoints of service %s/%s failed: %v", d.namespace, d.service, err)
+	}
+
+	var peers []*Peer
+	for _, subset := range endpoints.Subsets {
+		addrs := append(subset.Addresses, subset.NotReadyAddresses...)
+		for _, addr := range addrs {
+			name := addr.IP
+			if addr.TargetRef != nil && addr.TargetRef.Name != "" {
+				name = addr.TargetRef.Name
+			} else if addr.Hostname != "" {
+				name = addr.Hostname
+			}
+			peers = append(peers, &Peer{
+				Name:    name,
+				PeerURL: fmt.Sprintf("%s://%s", d.scheme, net.JoinHostPort(addr.IP, strconv.Itoa(d.port))),
+			})
+		}
+	}
+	return peers, nil
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKubernetesDiscoverer(t *testing.T) {
+	assert := assert.New(t)
+
+	client := fake.NewSimpleClientset(&corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "easegress", Name: "easegress-primary"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{
+				IP:        "10.0.0.1",
+				TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "easegress-0"},
+			}},
+			NotReadyAddresses: []corev1.EndpointAddress{
+				{IP: "10.0.0.2", Hostname: "easegress-1"},
+				{IP: "10.0.0.3"},
+			},
+		}},
+	})
+
+	d := &kubernetesDiscoverer{
+		namespace: "easegress",
+		service:   "easegress-primary",
+		scheme:    "http",
+		port:      2380,
+		client:    client,
+	}
+	peers, err := d.Discover(context.Background())
+	assert.NoError(err)
+	assert.Equal([]*Peer{
+		{Name: "easegress-0", PeerURL: "http://10.0.0.1:2380"},
+		{Name: "easegress-1", PeerURL: "http://10.0.0.2:2380"},
+		{Name: "10.0.0.3", PeerURL: "http://10.0.0.3:2380"},
+	}, peers)
+
+	d.service = "not-exist"
+	_, err = d.Discover(context.Background())
+	assert.Error(err)
+
+	// not in a kubernetes cluster
+	_, err = newKubernetesDiscoverer(nil, "http")
+	assert.Error(err)
+}
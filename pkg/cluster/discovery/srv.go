@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+// srvDiscoverer discovers the primary members from the DNS SRV records
+// following the convention of etcd, the peers in _etcd-server-ssl._tcp
+// use https and the ones in _etcd-server._tcp use http.
+type srvDiscoverer struct {
+	domain string
+	suffix string
+
+	lookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+func newSRVDiscoverer(opts *option.DiscoveryOptions) *srvDiscoverer {
+	suffix := ""
+	if opts.SRVName != "" {
+		suffix = "-" + opts.SRVName
+	}
+	return &srvDiscoverer{
+		domain:    opts.SRVDomain,
+		suffix:    suffix,
+		lookupSRV: net.DefaultResolver.LookupSRV,
+	}
+}
+
+func (d *srvDiscoverer) Discover(ctx context.Context) ([]*Peer, error) {
+	var peers []*Peer
+	var errs []string
+	for _, service := range []struct{ name, scheme string }{
+		{"etcd-server-ssl", "https"},
+		{"etcd-server", "http"},
+	} {
+		_, addrs, err := d.lookupSRV(ctx, service.name+d.suffix, "tcp", d.domain)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		for _, addr := range addrs {
+			host := strings.TrimSuffix(addr.Target, ".")
+			peers = append(peers, &Peer{
+				Name:    strings.SplitN(host, ".", 2)[0],
+				PeerURL: fmt.Sprintf("%s://%s", service.scheme, net.JoinHostPort(host, fmt.Sprintf("%d", addr.Port))),
+			})
+		}
+	}
+
+	if len(peers) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("lookup srv records of %s failed: %s", d.domain, strings.Join(errs, "; "))
+	}
+	return peers, nil
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+func TestSRVDiscoverer(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newSRVDiscoverer(&option.DiscoveryOptions{SRVDomain: "example.com", SRVName: "prod"})
+	d.lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		assert.Equal("tcp", proto)
+		assert.Equal("example.com", name)
+		if service == "etcd-server-ssl-prod" {
+			return "", nil, fmt.Errorf("no such host")
+		}
+		assert.Equal("etcd-server-prod", service)
+		return "", []*net.SRV{
+			{Target: "node-1.example.com.", Port: 2380},
+			{Target: "node-2.example.com.", Port: 2380},
+		}, nil
+	}
+
+	peers, err := d.Discover(context.Background())
+	assert.NoError(err)
+	assert.Equal([]*Peer{
+		{Name: "node-1", PeerURL: "http://node-1.example.com:2380"},
+		{Name: "node-2", PeerURL: "http://node-2.example.com:2380"},
+	}, peers)
+
+	d.lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, fmt.Errorf("no such host")
+	}
+	_, err = d.Discover(context.Background())
+	assert.Error(err)
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// Election is a cluster level leader election. Every election runs
+// in its own session, whose lease expires after the TTL if the member
+// stops keeping it alive, so another candidate takes over quickly.
+type Election interface {
+	// Campaign blocks until the candidate is elected with value,
+	// or the context is cancelled.
+	Campaign(ctx context.Context, value string) error
+	// Resign gives up the leadership, other candidates will be
+	// elected immediately.
+	Resign() error
+	// Leader returns the value of the current leader, it is empty
+	// if there is no leader.
+	Leader() (string, error)
+	// Done returns a channel which is closed when the session of the
+	// election is lost, the leadership is lost too in this case.
+	Done() <-chan struct{}
+	// Close resigns and closes the session of the election.
+	Close() error
+}
+
+type election struct {
+	session *concurrency.Session
+	e       *concurrency.Election
+	timeout time.Duration
+}
+
+func (e *election) Campaign(ctx context.Context, value string) error {
+	return e.e.Campaign(ctx, value)
+}
+
+func (e *election) Resign() error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	return e.e.Resign(ctx)
+}
+
+func (e *election) Leader() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	resp, err := e.e.Leader(ctx)
+	if errors.Is(err, concurrency.ErrElectionNoLeader) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(resp.Kvs[0].Value), nil
+}
+
+func (e *election) Done() <-chan struct{} {
+	return e.session.Done()
+}
+
+func (e *election) Close() error {
+	e.Resign()
+	return e.session.Close()
+}
+
+func (c *cluster) Election(name string, ttl time.Duration) (Election, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	seconds := int(ttl.Seconds())
+	if seconds < minTTL {
+		seconds = minTTL
+	}
+
+	session, err := concurrency.NewSession(client, concurrency.WithTTL(seconds))
+	if err != nil {
+		return nil, fmt.Errorf("create session failed: %v", err)
+	}
+
+	return &election{
+		session: session,
+		e:       concurrency.NewElection(session, name),
+		timeout: c.requestTimeout,
+	}, nil
+}
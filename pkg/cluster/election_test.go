@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestElection(t *testing.T) {
+	opts, _ := mockMembers(1)
+	cls, err := New(opts[0])
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	c := cls.(*cluster)
+	if _, err = c.getClient(); err != nil {
+		t.Fatalf("get ready failed: %v", err)
+	}
+
+	e1, err := c.Election("/test/election/", time.Second)
+	if err != nil {
+		t.Fatalf("create election failed: %v", err)
+	}
+	e2, err := c.Election("/test/election/", time.Second)
+	if err != nil {
+		t.Fatalf("create election failed: %v", err)
+	}
+	defer e2.Close()
+
+	if leader, err := e1.Leader(); err != nil || leader != "" {
+		t.Errorf("leader should be empty, got %q, %v", leader, err)
+	}
+
+	if err = e1.Campaign(context.Background(), "member-1"); err != nil {
+		t.Fatalf("campaign failed: %v", err)
+	}
+	if leader, _ := e2.Leader(); leader != "member-1" {
+		t.Errorf("leader should be member-1, got %q", leader)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err = e2.Campaign(ctx, "member-2"); err == nil {
+		t.Errorf("campaign should fail when there is a leader")
+	}
+
+	elected := make(chan error, 1)
+	go func() {
+		elected <- e2.Campaign(context.Background(), "member-2")
+	}()
+
+	e1.Close()
+	select {
+	case err = <-elected:
+		if err != nil {
+			t.Fatalf("campaign failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("member-2 should be elected after member-1 closed")
+	}
+
+	if leader, _ := e2.Leader(); leader != "member-2" {
+		t.Errorf("leader should be member-2, got %q", leader)
+	}
+}
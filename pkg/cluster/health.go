@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// heartbeatTimeout is the time after which a member without heartbeat is
+// considered unhealthy.
+const heartbeatTimeout = 3 * HeartbeatInterval
+
+const (
+	// RoleLeader is the role of the leader of the embedded etcd.
+	RoleLeader = "leader"
+	// RoleFollower is the role of the voting members except the leader.
+	RoleFollower = "follower"
+	// RoleLearner is the role of the non-voting members.
+	RoleLearner = "learner"
+	// RoleSecondary is the role of the members without embedded etcd.
+	RoleSecondary = "secondary"
+)
+
+type (
+	// Health is the health of the cluster. The cluster is healthy if it
+	// has a leader, a quorum of healthy voting members and no alarms.
+	Health struct {
+		Healthy     bool            `json:"healthy"`
+		ClusterName string          `json:"clusterName"`
+		Leader      string          `json:"leader,omitempty"`
+		Members     []*MemberHealth `json:"members"`
+	}
+
+	// MemberHealth is the health of a member.
+	MemberHealth struct {
+		Name    string `json:"name"`
+		ID      string `json:"id,omitempty"`
+		Role    string `json:"role"`
+		Healthy bool   `json:"healthy"`
+
+		RaftTerm         uint64 `json:"raftTerm,omitempty"`
+		RaftIndex        uint64 `json:"raftIndex,omitempty"`
+		RaftAppliedIndex uint64 `json:"raftAppliedIndex,omitempty"`
+		// Lag is the number of raft entries the member falls behind the
+		// leader.
+		Lag uint64 `json:"lag"`
+		// DBSize is the size of the backend database in bytes, and
+		// DBSizeInUse is the size in use, the difference could be
+		// reclaimed by defragmentation.
+		DBSize      int64 `json:"dbSize,omitempty"`
+		DBSizeInUse int64 `json:"dbSizeInUse,omitempty"`
+
+		// RFC3339 format
+		LastHeartbeatTime string `json:"lastHeartbeatTime,omitempty"`
+
+		// Alarms are the raised alarms of the member, like NOSPACE and
+		// CORRUPT.
+		Alarms []string `json:"alarms,omitempty"`
+		Errors []string `json:"errors,omitempty"`
+	}
+
+	// healthInput is the raw data to check the health of the cluster.
+	healthInput struct {
+		members    []*pb.Member
+		statuses   map[uint64]*pb.StatusResponse
+		errs       map[uint64]error
+		alarms     []*pb.AlarmMember
+		heartbeats map[string]*MemberStatus
+	}
+)
+
+// Health returns the health of the cluster, the members of the embedded
+// etcd are checked through their client URLs.
+func (c *cluster) Health() (*Health, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.requestContext()
+	defer cancel()
+
+	listResp, err := client.MemberList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list members failed: %v", err)
+	}
+	alarmResp, err := client.AlarmList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list alarms failed: %v", err)
+	}
+
+	input := &healthInput{
+		members:    listResp.Members,
+		statuses:   map[uint64]*pb.StatusResponse{},
+		errs:       map[uint64]error{},
+		alarms:     alarmResp.Alarms,
+		heartbeats: map[string]*MemberStatus{},
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, m := range listResp.Members {
+		if len(m.ClientURLs) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(m *pb.Member) {
+			defer wg.Done()
+			var resp *pb.StatusResponse
+			var err error
+			for _, url := range m.ClientURLs {
+				var r *clientv3.StatusResponse
+				if r, err = client.Status(ctx, url); err == nil {
+					resp = (*pb.StatusResponse)(r)
+					break
+				}
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				input.errs[m.ID] = err
+			} else {
+				input.statuses[m.ID] = resp
+			}
+		}(m)
+	}
+	wg.Wait()
+
+	kvs, err := c.GetPrefix(c.Layout().StatusMemberPrefix())
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range kvs {
+		status := &MemberStatus{}
+		if err := codectool.UnmarshalJSON([]byte(v), status); err != nil {
+			logger.Errorf("unmarshal member status failed: %v", err)
+			continue
+		}
+		input.heartbeats[status.Options.Name] = status
+	}
+
+	return input.health(c.opt.ClusterName, time.Now()), nil
+}
+
+func (in *healthInput) health(clusterName string, now time.Time) *Health {
+	h := &Health{ClusterName: clusterName}
+
+	// the leader reported by the member with the largest term wins.
+	var leaderID, term uint64
+	for _, s := range in.statuses {
+		if s.Leader != 0 && s.RaftTerm >= term {
+			leaderID, term = s.Leader, s.RaftTerm
+		}
+	}
+	var leaderIndex uint64
+	if s, ok := in.statuses[leaderID]; ok {
+		leaderIndex = s.RaftIndex
+	}
+
+	alarms := map[uint64][]string{}
+	for _, a := range in.alarms {
+		if a.Alarm != pb.AlarmType_NONE {
+			alarms[a.MemberID] = append(alarms[a.MemberID], a.Alarm.String())
+		}
+	}
+
+	heartbeatHealthy := func(mh *MemberHealth) {
+		status, ok := in.heartbeats[mh.Name]
+		if !ok {
+			return
+		}
+		mh.LastHeartbeatTime = status.LastHeartbeatTime
+		t, err := time.Parse(time.RFC3339, status.LastHeartbeatTime)
+		if err != nil || now.Sub(t) > heartbeatTimeout {
+			mh.Healthy = false
+			mh.Errors = append(mh.Errors, "heartbeat timeout")
+		}
+	}
+
+	voters, healthyVoters := 0, 0
+	names := map[string]struct{}{}
+	for _, m := range in.members {
+		mh := &MemberHealth{
+			Name:    m.Name,
+			ID:      fmt.Sprintf("%x", m.ID),
+			Role:    RoleFollower,
+			Healthy: true,
+			Alarms:  alarms[m.ID],
+		}
+		names[m.Name] = struct{}{}
+
+		switch {
+		case m.IsLearner:
+			mh.Role = RoleLearner
+		case m.ID == leaderID:
+			mh.Role = RoleLeader
+			h.Leader = m.Name
+		}
+
+		if s, ok := in.statuses[m.ID]; ok {
+			mh.RaftTerm = s.RaftTerm
+			mh.RaftIndex = s.RaftIndex
+			mh.RaftAppliedIndex = s.RaftAppliedIndex
+			mh.DBSize = s.DbSize
+			mh.DBSizeInUse = s.DbSizeInUse
+			if leaderIndex > s.RaftIndex {
+				mh.Lag = leaderIndex - s.RaftIndex
+			}
+			if len(s.Errors) != 0 {
+				mh.Healthy = false
+				mh.Errors = append(mh.Errors, s.Errors...)
+			}
+		} else if err, ok := in.errs[m.ID]; ok {
+			mh.Healthy = false
+			mh.Errors = append(mh.Errors, err.Error())
+		} else {
+			mh.Healthy = false
+			mh.Errors = append(mh.Errors, "not started")
+		}
+		if len(mh.Alarms) != 0 {
+			mh.Healthy = false
+		}
+		heartbeatHealthy(mh)
+
+		if !m.IsLearner {
+			voters++
+			if mh.Healthy {
+				healthyVoters++
+			}
+		}
+		h.Members = append(h.Members, mh)
+	}
+
+	for name, status := range in.heartbeats {
+		if _, ok := names[name]; ok || status.Etcd != nil {
+			continue
+		}
+		mh := &MemberHealth{Name: name, Role: RoleSecondary, Healthy: true}
+		heartbeatHealthy(mh)
+		h.Members = append(h.Members, mh)
+	}
+
+	sort.Slice(h.Members, func(i, j int) bool {
+		return h.Members[i].Name < h.Members[j].Name
+	})
+
+	h.Healthy = leaderID != 0 && len(alarms) == 0 && healthyVoters > voters/2
+	return h
+}
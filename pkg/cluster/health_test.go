@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+func TestHealthOfMembers(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	heartbeat := func(name string, ago time.Duration, etcd bool) *MemberStatus {
+		status := &MemberStatus{
+			Options:           option.Options{Name: name},
+			LastHeartbeatTime: now.Add(-ago).Format(time.RFC3339),
+		}
+		if etcd {
+			status.Etcd = &EtcdStatus{}
+		}
+		return status
+	}
+
+	input := &healthInput{
+		members: []*pb.Member{
+			{ID: 1, Name: "m1"},
+			{ID: 2, Name: "m2"},
+			{ID: 3, Name: "m3"},
+			{ID: 4, Name: "l1", IsLearner: true},
+			{ID: 5, IsLearner: true},
+		},
+		statuses: map[uint64]*pb.StatusResponse{
+			1: {Leader: 1, RaftTerm: 3, RaftIndex: 100, DbSize: 4096, DbSizeInUse: 2048},
+			2: {Leader: 1, RaftTerm: 3, RaftIndex: 90},
+			4: {Leader: 1, RaftTerm: 3, RaftIndex: 100},
+		},
+		errs: map[uint64]error{
+			3: fmt.Errorf("context deadline exceeded"),
+		},
+		heartbeats: map[string]*MemberStatus{
+			"m1": heartbeat("m1", time.Second, true),
+			"m2": heartbeat("m2", time.Second, true),
+			"l1": heartbeat("l1", time.Minute, true),
+			"s1": heartbeat("s1", time.Second, false),
+		},
+	}
+
+	h := input.health("test-cluster", now)
+	assert.True(h.Healthy)
+	assert.Equal("m1", h.Leader)
+	assert.Len(h.Members, 6)
+
+	members := map[string]*MemberHealth{}
+	for _, m := range h.Members {
+		members[m.Name] = m
+	}
+	assert.Equal(RoleLeader, members["m1"].Role)
+	assert.True(members["m1"].Healthy)
+	assert.Equal(int64(4096), members["m1"].DBSize)
+	assert.Equal(RoleFollower, members["m2"].Role)
+	assert.Equal(uint64(10), members["m2"].Lag)
+	assert.False(members["m3"].Healthy)
+	assert.Contains(members["m3"].Errors, "context deadline exceeded")
+	assert.Equal(RoleLearner, members["l1"].Role)
+	assert.False(members["l1"].Healthy)
+	assert.Contains(members["l1"].Errors, "heartbeat timeout")
+	assert.False(members[""].Healthy)
+	assert.Equal(RoleSecondary, members["s1"].Role)
+	assert.True(members["s1"].Healthy)
+
+	// the alarms make the cluster unhealthy.
+	input.alarms = []*pb.AlarmMember{{MemberID: 2, Alarm: pb.AlarmType_NOSPACE}}
+	h = input.health("test-cluster", now)
+	assert.False(h.Healthy)
+	for _, m := range h.Members {
+		if m.Name == "m2" {
+			assert.Equal([]string{"NOSPACE"}, m.Alarms)
+			assert.False(m.Healthy)
+		}
+	}
+
+	// the cluster without quorum is unhealthy.
+	input.alarms = nil
+	delete(input.statuses, 2)
+	h = input.health("test-cluster", now)
+	assert.False(h.Healthy)
+	assert.Equal("m1", h.Leader)
+}
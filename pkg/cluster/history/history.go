@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package history keeps the versions of object specs, so that objects could
+// be rolled back to their previous versions.
+package history
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// ActionCreated is the action creating an object.
+	ActionCreated = "created"
+	// ActionUpdated is the action updating an object.
+	ActionUpdated = "updated"
+	// ActionDeleted is the action deleting an object.
+	ActionDeleted = "deleted"
+)
+
+// ErrOutOfHistory is returned when the versions before the requested one
+// are pruned.
+var ErrOutOfHistory = errors.New("out of history")
+
+type (
+	// History records a version of an object whenever it is changed. The
+	// versions are numbered by the config version of the cluster, so the
+	// versions of all objects at a config version make up the whole config
+	// then. The changes must be serialized by the caller.
+	History struct {
+		cls   cluster.Cluster
+		limit int
+	}
+
+	// Version is a version of an object.
+	Version struct {
+		// Version is the config version of the cluster after the change.
+		Version int64  `json:"version"`
+		Action  string `json:"action"`
+		// Time is in RFC3339 format, it is empty for the versions before
+		// the history is recorded.
+		Time string `json:"time,omitempty"`
+		// Spec is the spec in JSON, it is empty for deletions.
+		Spec string `json:"spec,omitempty"`
+	}
+
+	// Change is a change applied to an object.
+	Change struct {
+		Name   string `json:"name"`
+		Action string `json:"action"`
+	}
+)
+
+// New creates a History keeping limit versions at most for every object,
+// the history is disabled if limit is 0.
+func New(cls cluster.Cluster, limit int) *History {
+	return &History{cls: cls, limit: limit}
+}
+
+func (h *History) versionKey(name string, version int64) string {
+	// the versions are padded to be sorted as strings.
+	return fmt.Sprintf("%s%020d", h.cls.Layout().ConfigObjectHistoryKeyPrefix(name), version)
+}
+
+// Apply changes the objects and records their versions in one transaction,
+// the specs are in JSON and nil specs delete the objects. The version is the
+// config version after the changes.
+func (h *History) Apply(version int64, specs map[string]*string) ([]*Change, error) {
+	layout := h.cls.Layout()
+	kvs := map[string]*string{}
+	changes := []*Change{}
+
+	for name, spec := range specs {
+		current, err := h.cls.Get(layout.ConfigObjectKey(name))
+		if err != nil {
+			return nil, err
+		}
+
+		action := ActionOf(current, spec)
+		if action == "" {
+			continue
+		}
+		kvs[layout.ConfigObjectKey(name)] = spec
+		changes = append(changes, &Change{Name: name, Action: action})
+
+		if h.limit <= 0 {
+			continue
+		}
+
+		versions, err := h.List(name)
+		if err != nil {
+			return nil, err
+		}
+		// the spec before the first recorded change is kept as the
+		// baseline, so that the change could be rolled back.
+		if len(versions) == 0 && current != nil {
+			versions = append(versions, &Version{
+				Version: version - 1,
+				Action:  ActionUpdated,
+				Spec:    *current,
+			})
+			kvs[h.versionKey(name, version-1)] = h.marshal(versions[0])
+		}
+
+		v := &Version{
+			Version: version,
+			Action:  action,
+			Time:    time.Now().Format(time.RFC3339),
+		}
+		if spec != nil {
+			v.Spec = *spec
+		}
+		versions = append(versions, v)
+		kvs[h.versionKey(name, version)] = h.marshal(v)
+
+		for i := 0; i < len(versions)-h.limit; i++ {
+			kvs[h.versionKey(name, versions[i].Version)] = nil
+		}
+	}
+
+	if len(kvs) == 0 {
+		return changes, nil
+	}
+	if err := h.cls.PutAndDelete(kvs); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes, nil
+}
+
+// ActionOf returns the action changing the current spec to the new one, nil
+// specs are for objects not existing. It returns empty if both are nil.
+func ActionOf(current, spec *string) string {
+	switch {
+	case current == nil && spec == nil:
+		return ""
+	case current == nil:
+		return ActionCreated
+	case spec == nil:
+		return ActionDeleted
+	default:
+		return ActionUpdated
+	}
+}
+
+func (h *History) marshal(v *Version) *string {
+	s := string(codectool.MustMarshalJSON(v))
+	return &s
+}
+
+// List lists the versions of the object, from the oldest to the latest.
+func (h *History) List(name string) ([]*Version, error) {
+	kvs, err := h.cls.GetPrefix(h.cls.Layout().ConfigObjectHistoryKeyPrefix(name))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*Version, 0, len(kvs))
+	for _, value := range kvs {
+		v := &Version{}
+		if err := codectool.UnmarshalJSON([]byte(value), v); err != nil {
+			return nil, fmt.Errorf("unmarshal version of %s failed: %v", name, err)
+		}
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// Get returns the version of the object, or nil if not found.
+func (h *History) Get(name string, version int64) (*Version, error) {
+	value, err := h.cls.Get(h.versionKey(name, version))
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	v := &Version{}
+	if err := codectool.UnmarshalJSON([]byte(*value), v); err != nil {
+		return nil, fmt.Errorf("unmarshal version of %s failed: %v", name, err)
+	}
+	return v, nil
+}
+
+// SpecsAt returns the specs of the objects at the config version, the specs
+// are nil for the objects not existing then. Only the objects with history
+// are returned, because the others are not changed since the history is
+// recorded.
+func (h *History) SpecsAt(version int64) (map[string]*string, error) {
+	prefix := h.cls.Layout().ConfigObjectHistoryPrefix()
+	kvs, err := h.cls.GetPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	all := map[string][]*Version{}
+	for key, value := range kvs {
+		// the key is prefix + name + "/" + version.
+		i := strings.LastIndex(key, "/")
+		if i < len(prefix) {
+			continue
+		}
+		name := key[len(prefix):i]
+
+		v := &Version{}
+		if err := codectool.UnmarshalJSON([]byte(value), v); err != nil {
+			return nil, fmt.Errorf("unmarshal version of %s failed: %v", name, err)
+		}
+		all[name] = append(all[name], v)
+	}
+
+	specs := map[string]*string{}
+	for name, versions := range all {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+
+		v, err := at(versions, version)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if v != nil && v.Action != ActionDeleted {
+			spec := v.Spec
+			specs[name] = &spec
+		} else {
+			specs[name] = nil
+		}
+	}
+	return specs, nil
+}
+
+// at returns the latest version not after the config version, or nil if the
+// object is created after it.
+func at(versions []*Version, version int64) (*Version, error) {
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].Version > version })
+	if i > 0 {
+		return versions[i-1], nil
+	}
+	if versions[0].Action == ActionCreated {
+		return nil, nil
+	}
+	// the versions before it are pruned.
+	return nil, fmt.Errorf("%w: version %d is before the oldest version %d", ErrOutOfHistory, version, versions[0].Version)
+}
+
+// Diff returns the unified diff of the specs of two versions in YAML.
+func Diff(from, to *Version) (string, error) {
+	a, err := specYAML(from)
+	if err != nil {
+		return "", err
+	}
+	b, err := specYAML(to)
+	if err != nil {
+		return "", err
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(a),
+		B:        difflib.SplitLines(b),
+		FromFile: "version " + strconv.FormatInt(from.Version, 10),
+		ToFile:   "version " + strconv.FormatInt(to.Version, 10),
+		Context:  3,
+	})
+}
+
+func specYAML(v *Version) (string, error) {
+	if v.Spec == "" {
+		return "", nil
+	}
+	y, err := codectool.JSONToYAML([]byte(v.Spec))
+	if err != nil {
+		return "", fmt.Errorf("convert spec of version %d to yaml failed: %v", v.Version, err)
+	}
+	return string(y), nil
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package history
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+)
+
+func newMockedCluster(kvs map[string]string) *clustertest.MockedCluster {
+	layout := &cluster.Layout{}
+
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return layout
+	}
+	cls.MockedGet = func(key string) (*string, error) {
+		if v, ok := kvs[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	cls.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		result := map[string]string{}
+		for k, v := range kvs {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = v
+			}
+		}
+		return result, nil
+	}
+	cls.MockedPutAndDelete = func(m map[string]*string) error {
+		for k, v := range m {
+			if v == nil {
+				delete(kvs, k)
+			} else {
+				kvs[k] = *v
+			}
+		}
+		return nil
+	}
+	return cls
+}
+
+func TestHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	v1 := `{"name":"demo","kind":"HTTPServer","port":10080}`
+	v2 := `{"name":"demo","kind":"HTTPServer","port":10081}`
+	v3 := `{"name":"demo","kind":"HTTPServer","port":10082}`
+	other := `{"name":"other","kind":"HTTPServer","port":10090}`
+
+	layout := &cluster.Layout{}
+	kvs := map[string]string{layout.ConfigObjectKey("demo"): v1}
+	h := New(newMockedCluster(kvs), 3)
+
+	// the spec before the first change is kept as the baseline.
+	changes, err := h.Apply(5, map[string]*string{"demo": &v2, "other": &other})
+	assert.NoError(err)
+	assert.Equal([]*Change{{"demo", ActionUpdated}, {"other", ActionCreated}}, changes)
+	assert.Equal(v2, kvs[layout.ConfigObjectKey("demo")])
+
+	versions, err := h.List("demo")
+	assert.NoError(err)
+	assert.Len(versions, 2)
+	assert.Equal(int64(4), versions[0].Version)
+	assert.Equal(v1, versions[0].Spec)
+	assert.Empty(versions[0].Time)
+	assert.Equal(int64(5), versions[1].Version)
+	assert.Equal(v2, versions[1].Spec)
+	assert.NotEmpty(versions[1].Time)
+
+	_, err = h.Apply(6, map[string]*string{"demo": &v3, "other": nil})
+	assert.NoError(err)
+	assert.NotContains(kvs, layout.ConfigObjectKey("other"))
+
+	// deleting a nonexistent object changes nothing.
+	changes, err = h.Apply(7, map[string]*string{"other": nil})
+	assert.NoError(err)
+	assert.Empty(changes)
+
+	v, err := h.Get("other", 6)
+	assert.NoError(err)
+	assert.Equal(ActionDeleted, v.Action)
+	assert.Empty(v.Spec)
+	v, err = h.Get("other", 7)
+	assert.NoError(err)
+	assert.Nil(v)
+
+	specs, err := h.SpecsAt(5)
+	assert.NoError(err)
+	assert.Equal(v2, *specs["demo"])
+	assert.Equal(other, *specs["other"])
+	specs, err = h.SpecsAt(4)
+	assert.NoError(err)
+	assert.Equal(v1, *specs["demo"])
+	assert.Nil(specs["other"])
+
+	// the versions beyond the limit are pruned.
+	_, err = h.Apply(8, map[string]*string{"demo": &v1})
+	assert.NoError(err)
+	versions, err = h.List("demo")
+	assert.NoError(err)
+	assert.Len(versions, 3)
+	assert.Equal(int64(5), versions[0].Version)
+	_, err = h.SpecsAt(4)
+	assert.ErrorIs(err, ErrOutOfHistory)
+
+	// the history is disabled with limit 0.
+	h = New(newMockedCluster(kvs), 0)
+	_, err = h.Apply(9, map[string]*string{"demo": &v2})
+	assert.NoError(err)
+	assert.Equal(v2, kvs[layout.ConfigObjectKey("demo")])
+	versions, err = h.List("demo")
+	assert.NoError(err)
+	assert.Len(versions, 3)
+}
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	from := &Version{Version: 1, Spec: `{"name":"demo","kind":"HTTPServer","port":10080}`}
+	to := &Version{Version: 2, Spec: `{"name":"demo","kind":"HTTPServer","port":10081}`}
+	diff, err := Diff(from, to)
+	assert.NoError(err)
+	assert.Contains(diff, "--- version 1")
+	assert.Contains(diff, "+++ version 2")
+	assert.Contains(diff, "-port: 10080")
+	assert.Contains(diff, "+port: 10081")
+
+	diff, err = Diff(to, &Version{Version: 3, Action: ActionDeleted})
+	assert.NoError(err)
+	assert.Contains(diff, "-kind: HTTPServer")
+
+	_, err = Diff(&Version{Spec: "{"}, to)
+	assert.Error(err)
+}
@@ -31,6 +31,7 @@ const (
 	NamespaceSystemPrefix  = "eg-"
 	NamespacetrafficPrefix = "eg-traffic-"
 
+	leasePrefix               = "/leases/"
 	leaseFormat               = "/leases/%s" //+memberName
 	statusMemberPrefix        = "/status/members/"
 	statusMemberFormat        = "/status/members/%s" // +memberName
@@ -40,16 +41,51 @@ const (
 	configObjectPrefix        = "/config/objects/"
 	configObjectFormat        = "/config/objects/%s" // +objectName
 	configVersion             = "/config/version"
+	configObjectHistoryPrefix = "/config/object-history/"
+	configObjectHistoryFormat = "/config/object-history/%s/" // +objectName
 	wasmCodeEvent             = "/wasm/code"
-	wasmDataPrefixFormat      = "/wasm/data/%s/%s/" // + pipelineName + filterName
+	wasmDataPrefixFormat      = "/wasm/data/%s/%s/"        // + pipelineName + filterName
+	luaDataPrefixFormat       = "/lua/data/%s/%s/"         // + pipelineName + filterName
+	responseCacheFormat       = "/response-cache/%s/%s/%s" // + pipelineName + filterName + key
+	csrfTokenFormat           = "/csrf-tokens/%s/%s/%s"    // + pipelineName + filterName + session
+	rateLimiterFormat         = "/rate-limiter/%s/%s/%s"   // + pipelineName + filterName + key
+	experimentPrefix          = "/experiments/"
+	experimentFormat          = "/experiments/%s" // + experimentName
 	customDataKindPrefix      = "/custom-data-kinds/"
 	customDataPrefix          = "/custom-data/"
+	electionsPrefix           = "/elections/"
+	electionFormat            = "/elections/%s" // + electionName
+	locksPrefix               = "/locks/"
+	lockFormat                = "/locks/%s" // + lockName
 
 	// the cluster name of this eg group will be registered under this path in etcd
 	// any new member(primary or secondary ) will be rejected if it is configured a different cluster name
 	clusterNameKey = "/eg/cluster/name"
 )
 
+// dataPrefixes are the prefixes of all the data written by Easegress,
+// including the data of the controllers out of this package, such as the
+// MeshController and the FaaSController. The other keys may belong to other
+// applications sharing the etcd cluster.
+var dataPrefixes = []string{
+	leasePrefix,
+	"/status/",
+	"/config/",
+	"/wasm/",
+	"/lua/",
+	"/response-cache/",
+	"/csrf-tokens/",
+	"/rate-limiter/",
+	experimentPrefix,
+	customDataKindPrefix,
+	customDataPrefix,
+	electionsPrefix,
+	locksPrefix,
+	"/eg/",
+	"/mesh/",
+	"/faas/",
+}
+
 type (
 	// Layout represents storage tree layout.
 	Layout struct {
@@ -78,11 +114,21 @@ func (c *cluster) Layout() *Layout {
 	return c.layout
 }
 
+// DataPrefixes returns the prefixes of all the data written by Easegress.
+func (l *Layout) DataPrefixes() []string {
+	return dataPrefixes
+}
+
 // ClusterNameKey returns the key of the cluster name.
 func (l *Layout) ClusterNameKey() string {
 	return clusterNameKey
 }
 
+// LeasePrefix returns the prefix of member leases.
+func (l *Layout) LeasePrefix() string {
+	return leasePrefix
+}
+
 // Lease returns the key of own member lease.
 func (l *Layout) Lease() string {
 	return fmt.Sprintf(leaseFormat, l.memberName)
@@ -133,6 +179,16 @@ func (l *Layout) ConfigObjectKey(name string) string {
 	return fmt.Sprintf(configObjectFormat, name)
 }
 
+// ConfigObjectHistoryPrefix returns the prefix of the history of all objects.
+func (l *Layout) ConfigObjectHistoryPrefix() string {
+	return configObjectHistoryPrefix
+}
+
+// ConfigObjectHistoryKeyPrefix returns the prefix of the history of an object.
+func (l *Layout) ConfigObjectHistoryKeyPrefix(name string) string {
+	return fmt.Sprintf(configObjectHistoryFormat, name)
+}
+
 // ConfigVersion returns the key of config version.
 func (l *Layout) ConfigVersion() string {
 	return configVersion
@@ -148,6 +204,36 @@ func (l *Layout) WasmDataPrefix(pipeline string, name string) string {
 	return fmt.Sprintf(wasmDataPrefixFormat, pipeline, name)
 }
 
+// LuaDataPrefix returns the prefix of lua data
+func (l *Layout) LuaDataPrefix(pipeline string, name string) string {
+	return fmt.Sprintf(luaDataPrefixFormat, pipeline, name)
+}
+
+// ResponseCacheKey returns the key of a shared response cache entry
+func (l *Layout) ResponseCacheKey(pipeline, name, key string) string {
+	return fmt.Sprintf(responseCacheFormat, pipeline, name, key)
+}
+
+// CSRFTokenKey returns the key of the CSRF token of a session
+func (l *Layout) CSRFTokenKey(pipeline, name, session string) string {
+	return fmt.Sprintf(csrfTokenFormat, pipeline, name, session)
+}
+
+// RateLimiterKey returns the key of the shared state of a rate limiter
+func (l *Layout) RateLimiterKey(pipeline, name, key string) string {
+	return fmt.Sprintf(rateLimiterFormat, pipeline, name, key)
+}
+
+// ExperimentPrefix returns the prefix of all experiments
+func (l *Layout) ExperimentPrefix() string {
+	return experimentPrefix
+}
+
+// ExperimentKey returns the key of an experiment
+func (l *Layout) ExperimentKey(name string) string {
+	return fmt.Sprintf(experimentFormat, name)
+}
+
 // CustomDataPrefix returns the prefix of all custom data
 func (l *Layout) CustomDataPrefix() string {
 	return customDataPrefix
@@ -157,3 +243,23 @@ func (l *Layout) CustomDataPrefix() string {
 func (l *Layout) CustomDataKindPrefix() string {
 	return customDataKindPrefix
 }
+
+// ElectionsPrefix returns the prefix of all public elections
+func (l *Layout) ElectionsPrefix() string {
+	return electionsPrefix
+}
+
+// ElectionPrefix returns the prefix of the candidates of a public election
+func (l *Layout) ElectionPrefix(name string) string {
+	return fmt.Sprintf(electionFormat, name)
+}
+
+// LocksPrefix returns the prefix of all public locks
+func (l *Layout) LocksPrefix() string {
+	return locksPrefix
+}
+
+// LockPrefix returns the prefix of the owners of a public lock
+func (l *Layout) LockPrefix(name string) string {
+	return fmt.Sprintf(lockFormat, name)
+}
@@ -67,6 +67,12 @@ func TestLayout(t *testing.T) {
 		t.Error("WasmDataPrefix empty")
 	}
 
+	assert.Equal("/lua/data/pipeline/lua/", l.LuaDataPrefix("pipeline", "lua"))
+	assert.Equal("/rate-limiter/pipeline/limiter/key", l.RateLimiterKey("pipeline", "limiter", "key"))
+	assert.Equal("/leases/", l.LeasePrefix())
+	assert.Equal("/experiments/", l.ExperimentPrefix())
+	assert.Equal("/experiments/exp", l.ExperimentKey("exp"))
+
 	assert.Equal(customDataPrefix, l.CustomDataPrefix())
 	assert.Equal(customDataKindPrefix, l.CustomDataKindPrefix())
 
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/v3client"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/v3rpc"
+	"go.etcd.io/etcd/server/v3/proxy/grpcproxy/adapter"
+	"go.etcd.io/etcd/server/v3/wal"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+// configLearner configures the embedded etcd server to join the cluster as
+// a learner, which replicates the data but doesn't vote. The learner is
+// added through the primary members, unless it has joined before.
+func (c *cluster) configLearner(ec *embed.Config) error {
+	ec.ClusterState = embed.ClusterStateFlagExisting
+
+	walDir := ec.WalDir
+	if walDir == "" {
+		walDir = filepath.Join(ec.Dir, "member", "wal")
+	}
+	if wal.Exist(walDir) {
+		// the initial cluster is ignored while restarting, but it must
+		// contain the member itself.
+		ec.InitialCluster = ec.InitialClusterFromName(ec.Name)
+		return nil
+	}
+
+	members, id, err := c.addLearner()
+	if err != nil {
+		return fmt.Errorf("add learner failed: %v", err)
+	}
+
+	var initialCluster []string
+	for _, m := range members {
+		name := m.Name
+		if m.ID == id {
+			name = c.opt.Name
+		}
+		for _, u := range m.PeerURLs {
+			initialCluster = append(initialCluster, fmt.Sprintf("%s=%s", name, u))
+		}
+	}
+	ec.InitialCluster = strings.Join(initialCluster, ",")
+
+	logger.Infof("join cluster as learner %x with initial cluster: %s", id, ec.InitialCluster)
+	return nil
+}
+
+// addLearner adds the member as a learner to the cluster, the one added
+// before is reused if it has not started yet. It returns the members of
+// the cluster and the ID of the learner.
+func (c *cluster) addLearner() ([]*pb.Member, uint64, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := c.requestContext()
+	defer cancel()
+
+	listResp, err := client.MemberList(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	peerURLs := c.opt.Cluster.InitialAdvertisePeerURLs
+	for _, m := range listResp.Members {
+		if m.Name == c.opt.Name {
+			return nil, 0, fmt.Errorf("member %s exists, purge it before joining again", c.opt.Name)
+		}
+		if m.Name == "" && samePeerURLs(m.PeerURLs, peerURLs) {
+			return listResp.Members, m.ID, nil
+		}
+	}
+
+	addResp, err := client.MemberAddAsLearner(ctx, peerURLs)
+	if err != nil {
+		return nil, 0, err
+	}
+	return addResp.Members, addResp.Member.ID, nil
+}
+
+func samePeerURLs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// getReadClient returns the client for reads and watches. Learner members
+// use the in-process client of the embedded etcd server, so that they are
+// served by the local replica instead of the primary members. The etcd
+// authentication isn't supported by the in-process client, so learners
+// with an etcd username use the normal client.
+func (c *cluster) getReadClient() (*clientv3.Client, error) {
+	if c.opt.ClusterRole != "learner" || c.opt.Cluster.EtcdUsername != "" {
+		return c.getClient()
+	}
+
+	c.serverMutex.RLock()
+	if c.localClient != nil {
+		client := c.localClient
+		c.serverMutex.RUnlock()
+		return client, nil
+	}
+	c.serverMutex.RUnlock()
+
+	c.serverMutex.Lock()
+	defer c.serverMutex.Unlock()
+
+	// DCL
+	if c.localClient != nil {
+		return c.localClient, nil
+	}
+	if c.server != nil {
+		c.localClient = v3client.New(c.server.Server)
+		c.localWatchClient = adapter.WatchServerToWatchClient(v3rpc.NewWatchServer(c.server.Server))
+		return c.localClient, nil
+	}
+
+	// the server is not ready while joining the cluster.
+	return c.getClient()
+}
+
+// newWatcher creates a watcher of the client. The in-process client has no
+// connection, so its watchers are created on the embedded etcd server.
+func (c *cluster) newWatcher(client *clientv3.Client) clientv3.Watcher {
+	c.serverMutex.RLock()
+	defer c.serverMutex.RUnlock()
+
+	if c.localClient != nil && client == c.localClient {
+		return clientv3.NewWatchFromWatchClient(c.localWatchClient, client)
+	}
+	return clientv3.NewWatcher(client)
+}
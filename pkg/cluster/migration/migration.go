@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package migration converts the object specs stored by older versions of
+// Easegress to the current schema.
+package migration
+
+import (
+	"fmt"
+	"sort"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// CurrentVersion is the version of the current schema of object specs.
+const CurrentVersion = "easegress.megaease.com/v2"
+
+type (
+	// Migration converts object specs from one version to the next one.
+	Migration struct {
+		From string
+		To   string
+
+		// Convert converts the spec in place, and returns the descriptions
+		// of the changes. It must not set the version of the spec.
+		Convert func(spec map[string]interface{}) ([]string, error)
+	}
+
+	// Result is the result of migrating an object spec.
+	Result struct {
+		Name    string   `json:"name"`
+		Kind    string   `json:"kind"`
+		From    string   `json:"from"`
+		To      string   `json:"to"`
+		Changes []string `json:"changes,omitempty"`
+		Error   string   `json:"error,omitempty"`
+	}
+
+	// Report is the report of migrating the object specs in the cluster.
+	Report struct {
+		DryRun bool `json:"dryRun"`
+		// Total is the number of the object specs.
+		Total int `json:"total"`
+		// Migrated are the object specs migrated, or to be migrated in a
+		// dry run.
+		Migrated []*Result `json:"migrated"`
+		// Failed are the object specs which can't be migrated, they are
+		// kept unchanged.
+		Failed []*Result `json:"failed"`
+	}
+)
+
+// migrations are the registered migrations, indexed by their From versions.
+var migrations = map[string]*Migration{}
+
+func register(m *Migration) {
+	if _, exists := migrations[m.From]; exists {
+		panic(fmt.Errorf("migration from %s registered already", m.From))
+	}
+	migrations[m.From] = m
+}
+
+// Version returns the version of the spec, specs without a version are
+// detected by their kinds.
+func Version(spec map[string]interface{}) string {
+	if version, ok := spec["version"].(string); ok && version != "" {
+		return version
+	}
+	if kind, _ := spec["kind"].(string); legacyKinds[kind] {
+		return v1Version
+	}
+	return CurrentVersion
+}
+
+// Migrate converts the object spec in JSON or YAML to the current version.
+// It returns the converted spec in JSON, and a nil result if the spec is
+// current already.
+func Migrate(config string) (string, *Result, error) {
+	spec := map[string]interface{}{}
+	if err := codectool.Unmarshal([]byte(config), &spec); err != nil {
+		return "", nil, fmt.Errorf("unmarshal spec failed: %v", err)
+	}
+
+	version := Version(spec)
+	if version == CurrentVersion {
+		return config, nil, nil
+	}
+
+	result := &Result{From: version}
+	result.Name, _ = spec["name"].(string)
+	result.Kind, _ = spec["kind"].(string)
+
+	for version != CurrentVersion {
+		m := migrations[version]
+		if m == nil {
+			err := fmt.Errorf("unsupported version %s", version)
+			result.Error = err.Error()
+			return "", result, err
+		}
+
+		changes, err := m.Convert(spec)
+		if err != nil {
+			err = fmt.Errorf("migrate from %s to %s failed: %v", m.From, m.To, err)
+			result.Error = err.Error()
+			return "", result, err
+		}
+		result.Changes = append(result.Changes, changes...)
+		version = m.To
+	}
+
+	spec["version"] = CurrentVersion
+	result.To = CurrentVersion
+
+	buff, err := codectool.MarshalJSON(spec)
+	if err != nil {
+		return "", nil, fmt.Errorf("marshal spec failed: %v", err)
+	}
+	return string(buff), result, nil
+}
+
+// Run migrates the object specs stored in the cluster. The specs are
+// migrated one by one in transactions, so it is safe to run on several
+// members at the same time. Nothing is changed in a dry run.
+func Run(cls cluster.Cluster, dryRun bool) (*Report, error) {
+	kvs, err := cls.GetPrefix(cls.Layout().ConfigObjectPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	report := &Report{
+		DryRun:   dryRun,
+		Total:    len(kvs),
+		Migrated: []*Result{},
+		Failed:   []*Result{},
+	}
+	for _, key := range keys {
+		var result *Result
+		var err error
+		if dryRun {
+			_, result, err = Migrate(kvs[key])
+		} else {
+			result, err = migrateKey(cls, key)
+		}
+
+		switch {
+		case result == nil && err != nil:
+			report.Failed = append(report.Failed, &Result{Name: key, Error: err.Error()})
+		case result == nil:
+		case err != nil:
+			report.Failed = append(report.Failed, result)
+		default:
+			report.Migrated = append(report.Migrated, result)
+		}
+	}
+
+	return report, nil
+}
+
+func migrateKey(cls cluster.Cluster, key string) (*Result, error) {
+	var result *Result
+	var migrateErr error
+	err := cls.STM(func(s concurrency.STM) error {
+		result, migrateErr = nil, nil
+
+		config := s.Get(key)
+		if config == "" {
+			return nil
+		}
+		var spec string
+		spec, result, migrateErr = Migrate(config)
+		if migrateErr == nil && result != nil {
+			s.Put(key, spec)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	return result, migrateErr
+}
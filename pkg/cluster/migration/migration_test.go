@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const v1Pipeline = `
+name: pipeline-demo
+kind: HTTPPipeline
+flow:
+- filter: proxy
+filters:
+- name: proxy
+  kind: Proxy
+  mainPool:
+    servers:
+    - url: http://127.0.0.1:9095
+    loadBalance:
+      policy: roundRobin
+  candidatePools:
+  - filter:
+      headers:
+        X-Canary:
+          exact: "true"
+    servers:
+    - url: http://127.0.0.1:9096
+  failureCodes: [503, 504]
+`
+
+func TestMigrate(t *testing.T) {
+	assert := assert.New(t)
+
+	config, result, err := Migrate(v1Pipeline)
+	assert.NoError(err)
+	assert.Equal("pipeline-demo", result.Name)
+	assert.Equal("HTTPPipeline", result.Kind)
+	assert.Equal(v1Version, result.From)
+	assert.Equal(CurrentVersion, result.To)
+	assert.Len(result.Changes, 4)
+
+	spec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(config), &spec))
+	assert.Equal("Pipeline", spec["kind"])
+	assert.Equal(CurrentVersion, spec["version"])
+	proxy := spec["filters"].([]interface{})[0].(map[string]interface{})
+	assert.NotContains(proxy, "mainPool")
+	assert.NotContains(proxy, "candidatePools")
+	assert.NotContains(proxy, "failureCodes")
+	pools := proxy["pools"].([]interface{})
+	assert.Len(pools, 2)
+	assert.Contains(pools[0], "filter")
+	assert.NotContains(pools[1], "filter")
+	assert.Equal([]interface{}{503.0, 504.0}, pools[1].(map[string]interface{})["failureCodes"])
+
+	// the current specs are unchanged.
+	current := `{"name":"server-demo","kind":"HTTPServer","version":"easegress.megaease.com/v2","port":10080}`
+	config, result, err = Migrate(current)
+	assert.NoError(err)
+	assert.Nil(result)
+	assert.Equal(current, config)
+	config, result, err = Migrate(`{"name":"server-demo","kind":"HTTPServer"}`)
+	assert.NoError(err)
+	assert.Nil(result)
+
+	// the other v1 specs only get the new version.
+	config, result, err = Migrate(`{"name":"server-demo","kind":"HTTPServer","version":"easegress.megaease.com/v1"}`)
+	assert.NoError(err)
+	assert.Empty(result.Changes)
+	assert.Contains(config, CurrentVersion)
+
+	_, result, err = Migrate(`{"name":"demo","kind":"HTTPServer","version":"easegress.megaease.com/v0"}`)
+	assert.Error(err)
+	assert.Contains(result.Error, "unsupported version")
+
+	_, result, err = Migrate(strings.Replace(v1Pipeline, "kind: Proxy", "kind: Retryer", 1))
+	assert.Error(err)
+	assert.Contains(result.Error, "Retry resilience policy")
+
+	_, _, err = Migrate(strings.Replace(v1Pipeline, "  mainPool:", "  pools: []\n  mainPool:", 1))
+	assert.Error(err)
+
+	_, _, err = Migrate("not: [valid")
+	assert.Error(err)
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	layout := &cluster.Layout{}
+	kvs := map[string]string{
+		layout.ConfigObjectKey("pipeline-demo"): v1Pipeline,
+		layout.ConfigObjectKey("server-demo"):   `{"name":"server-demo","kind":"HTTPServer","port":10080}`,
+		layout.ConfigObjectKey("bad-demo"):      `{"name":"bad-demo","kind":"HTTPServer","version":"v0"}`,
+	}
+
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return layout
+	}
+	cls.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		result := map[string]string{}
+		for k, v := range kvs {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = v
+			}
+		}
+		return result, nil
+	}
+	cls.MockedSTM = func(apply func(concurrency.STM) error) error {
+		return apply(&clustertest.MockedSTM{
+			MockedGet: func(key ...string) string {
+				return kvs[key[0]]
+			},
+			MockedPut: func(key, val string, opts ...clientv3.OpOption) {
+				kvs[key] = val
+			},
+		})
+	}
+
+	report, err := Run(cls, true)
+	assert.NoError(err)
+	assert.True(report.DryRun)
+	assert.Equal(3, report.Total)
+	assert.Len(report.Migrated, 1)
+	assert.Len(report.Failed, 1)
+	assert.Equal(v1Pipeline, kvs[layout.ConfigObjectKey("pipeline-demo")])
+
+	report, err = Run(cls, false)
+	assert.NoError(err)
+	assert.Len(report.Migrated, 1)
+	assert.Equal("pipeline-demo", report.Migrated[0].Name)
+	assert.Len(report.Failed, 1)
+	assert.Equal("bad-demo", report.Failed[0].Name)
+	assert.Contains(kvs[layout.ConfigObjectKey("pipeline-demo")], `"kind":"Pipeline"`)
+
+	// nothing to migrate at the second time.
+	report, err = Run(cls, false)
+	assert.NoError(err)
+	assert.Empty(report.Migrated)
+}
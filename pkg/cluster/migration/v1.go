@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"fmt"
+)
+
+const v1Version = "easegress.megaease.com/v1"
+
+var (
+	// legacyKinds are the kinds only exist in v1.
+	legacyKinds = map[string]bool{
+		"HTTPPipeline": true,
+	}
+
+	// removedFilters are the v1 filters removed in v2, with hints to
+	// replace them.
+	removedFilters = map[string]string{
+		"APIAggregator":  "use the Proxy filters with the ResponseBuilder filter instead",
+		"Bridge":         "use the Proxy filter instead",
+		"CircuitBreaker": "use the CircuitBreaker resilience policy of the pipeline instead",
+		"Retryer":        "use the Retry resilience policy of the pipeline instead",
+		"TimeLimiter":    "use the timeout of the Proxy pools instead",
+	}
+)
+
+func init() {
+	register(&Migration{
+		From:    v1Version,
+		To:      CurrentVersion,
+		Convert: convertV1,
+	})
+}
+
+// convertV1 converts a v1 spec to v2. The HTTPPipeline is renamed to
+// Pipeline, and the pools of its Proxy filters are merged.
+func convertV1(spec map[string]interface{}) ([]string, error) {
+	kind, _ := spec["kind"].(string)
+	if kind != "HTTPPipeline" {
+		return nil, nil
+	}
+
+	spec["kind"] = "Pipeline"
+	changes := []string{"kind HTTPPipeline is renamed to Pipeline"}
+
+	filters, _ := spec["filters"].([]interface{})
+	for i, f := range filters {
+		filter, ok := f.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("filter %d is not an object", i)
+		}
+		name, _ := filter["name"].(string)
+		filterKind, _ := filter["kind"].(string)
+
+		if hint, removed := removedFilters[filterKind]; removed {
+			return nil, fmt.Errorf("filter %s: kind %s is removed, %s", name, filterKind, hint)
+		}
+		if filterKind == "Proxy" {
+			proxyChanges, err := convertV1Proxy(filter)
+			if err != nil {
+				return nil, fmt.Errorf("filter %s: %v", name, err)
+			}
+			for _, c := range proxyChanges {
+				changes = append(changes, fmt.Sprintf("filter %s: %s", name, c))
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// convertV1Proxy merges the mainPool and candidatePools of the Proxy filter
+// into pools, the main pool is the only one without filter in v2. The
+// failureCodes of the filter are moved to every pool.
+func convertV1Proxy(filter map[string]interface{}) ([]string, error) {
+	var changes []string
+	if _, ok := filter["pools"]; ok {
+		if _, ok := filter["mainPool"]; ok {
+			return nil, fmt.Errorf("both pools and mainPool are defined")
+		}
+		return nil, nil
+	}
+
+	mainPool, ok := filter["mainPool"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mainPool is required")
+	}
+
+	var pools []interface{}
+	if candidates, ok := filter["candidatePools"].([]interface{}); ok {
+		pools = append(pools, candidates...)
+		delete(filter, "candidatePools")
+		changes = append(changes, "candidatePools are moved to pools")
+	}
+	pools = append(pools, mainPool)
+	delete(filter, "mainPool")
+	changes = append(changes, "mainPool is moved to pools")
+
+	if codes, ok := filter["failureCodes"]; ok {
+		for i, p := range pools {
+			pool, ok := p.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("pool %d is not an object", i)
+			}
+			if _, exists := pool["failureCodes"]; !exists {
+				pool["failureCodes"] = codes
+			}
+		}
+		delete(filter, "failureCodes")
+		changes = append(changes, "failureCodes are moved to pools")
+	}
+
+	filter["pools"] = pools
+	return changes, nil
+}
@@ -19,15 +19,22 @@ package cluster
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
 	"go.etcd.io/etcd/client/v3/concurrency"
 )
 
+// ErrLocked is returned by TryLock when the mutex is held by others.
+var ErrLocked = errors.New("mutex is locked by another session")
+
 // Mutex is a cluster level mutex.
 type Mutex interface {
 	Lock() error
+	// TryLock locks the mutex if it is not held by others, or returns
+	// ErrLocked immediately.
+	TryLock() error
 	Unlock() error
 }
 
@@ -57,6 +64,25 @@ func (m *mutex) Lock() (err error) {
 	return
 }
 
+func (m *mutex) TryLock() error {
+	// the mutex is held by another goroutine of this member.
+	if !m.lock.TryLock() {
+		return ErrLocked
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	err := m.m.TryLock(ctx)
+	if err != nil {
+		m.lock.Unlock()
+	}
+	if errors.Is(err, concurrency.ErrLocked) {
+		return ErrLocked
+	}
+	return err
+}
+
 func (m *mutex) Unlock() error {
 	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
 	defer cancel()
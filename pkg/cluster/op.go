@@ -18,6 +18,7 @@
 package cluster
 
 import (
+	"context"
 	"time"
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
@@ -131,7 +132,7 @@ func (c *cluster) Get(key string) (*string, error) {
 }
 
 func (c *cluster) GetRaw(key string) (*mvccpb.KeyValue, error) {
-	client, err := c.getClient()
+	client, err := c.getReadClient()
 	if err != nil {
 		return nil, err
 	}
@@ -167,7 +168,7 @@ func (c *cluster) GetPrefix(prefix string) (map[string]string, error) {
 func (c *cluster) GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue, error) {
 	kvs := make(map[string]*mvccpb.KeyValue)
 
-	client, err := c.getClient()
+	client, err := c.getReadClient()
 	if err != nil {
 		return kvs, err
 	}
@@ -191,7 +192,7 @@ func (c *cluster) GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue, erro
 func (c *cluster) GetWithOp(key string, op ...ClientOp) (map[string]string, error) {
 	kvs := make(map[string]string)
 
-	client, err := c.getClient()
+	client, err := c.getReadClient()
 	if err != nil {
 		return kvs, err
 	}
@@ -226,6 +227,15 @@ func (c *cluster) STM(apply func(concurrency.STM) error) error {
 	return err
 }
 
+func (c *cluster) STMWithContext(ctx context.Context, apply func(concurrency.STM) error) error {
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+	_, err = concurrency.NewSTM(client, apply, concurrency.WithAbortContext(ctx))
+	return err
+}
+
 func (c *cluster) PutUnderTimeout(key, value string, timeout time.Duration) error {
 	client, err := c.getClient()
 	if err != nil {
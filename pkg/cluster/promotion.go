@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+type (
+	// promotionPlan is the membership change to restore the number of
+	// voting members, at most one of the IDs is non-zero.
+	promotionPlan struct {
+		promote uint64
+		remove  uint64
+		name    string
+	}
+
+	// promotionState is the state of the members observed by the leader.
+	promotionState struct {
+		// lastSeen is the last heartbeat time of the members, the members
+		// without status are seen when they are observed at the first time.
+		lastSeen map[uint64]time.Time
+	}
+)
+
+// promote promotes healthy learners to replace the lost voting members, it
+// only works on the leader of the embedded etcd.
+func (c *cluster) promote() {
+	state := &promotionState{lastSeen: map[uint64]time.Time{}}
+	for {
+		select {
+		case <-time.After(HeartbeatInterval):
+			if !c.IsLeader() {
+				state.lastSeen = map[uint64]time.Time{}
+				continue
+			}
+			if err := c.runPromotion(state); err != nil {
+				logger.Errorf("run promotion failed: %v", err)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *cluster) runPromotion(state *promotionState) error {
+	lostTimeout, err := time.ParseDuration(c.opt.Cluster.Promotion.LostTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid lost timeout: %v", err)
+	}
+	voters := c.opt.Cluster.Promotion.Voters
+	if voters == 0 {
+		voters = len(c.opt.Cluster.InitialCluster)
+	}
+
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.requestContext()
+	listResp, err := client.MemberList(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	kvs, err := c.GetPrefix(c.Layout().StatusMemberPrefix())
+	if err != nil {
+		return err
+	}
+	heartbeats := map[string]time.Time{}
+	for _, v := range kvs {
+		status := &MemberStatus{}
+		if err := codectool.UnmarshalJSON([]byte(v), status); err != nil {
+			logger.Errorf("unmarshal member status failed: %v", err)
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, status.LastHeartbeatTime)
+		if err != nil {
+			continue
+		}
+		heartbeats[status.Options.Name] = t
+	}
+
+	plan := state.plan(listResp.Members, heartbeats, voters, lostTimeout, time.Now())
+	if plan == nil {
+		return nil
+	}
+
+	ctx, cancel = c.requestContext()
+	defer cancel()
+
+	if plan.promote != 0 {
+		if _, err := client.MemberPromote(ctx, plan.promote); err != nil {
+			return fmt.Errorf("promote learner %s(%x) failed: %v", plan.name, plan.promote, err)
+		}
+		logger.Infof("promoted learner %s(%x) to voting member", plan.name, plan.promote)
+		return nil
+	}
+
+	if _, err := client.MemberRemove(ctx, plan.remove); err != nil {
+		return fmt.Errorf("remove lost member %s(%x) failed: %v", plan.name, plan.remove, err)
+	}
+	delete(state.lastSeen, plan.remove)
+	logger.Infof("removed lost member %s(%x) which has been replaced", plan.name, plan.remove)
+	return nil
+}
+
+// plan returns the membership change to make. A healthy learner is
+// promoted if the healthy voting members are less than the expected ones,
+// then the lost voting members are removed if the voting members are more
+// than expected. Nothing changes if there are no learners to promote, so
+// that the lost members could rejoin.
+func (s *promotionState) plan(members []*pb.Member, heartbeats map[string]time.Time,
+	voters int, lostTimeout time.Duration, now time.Time,
+) *promotionPlan {
+	isHealthy := func(m *pb.Member) bool {
+		if t, ok := heartbeats[m.Name]; ok && t.After(s.lastSeen[m.ID]) {
+			s.lastSeen[m.ID] = t
+		}
+		if _, ok := s.lastSeen[m.ID]; !ok {
+			s.lastSeen[m.ID] = now
+		}
+		return now.Sub(s.lastSeen[m.ID]) <= lostTimeout
+	}
+
+	ids := map[uint64]struct{}{}
+	for _, m := range members {
+		ids[m.ID] = struct{}{}
+	}
+	for id := range s.lastSeen {
+		if _, ok := ids[id]; !ok {
+			delete(s.lastSeen, id)
+		}
+	}
+
+	var lost, learners []*pb.Member
+	healthyVoters := 0
+	for _, m := range members {
+		healthy := isHealthy(m)
+		switch {
+		case m.IsLearner:
+			// the learners which have not started are not ready.
+			if healthy && m.Name != "" {
+				learners = append(learners, m)
+			}
+		case healthy:
+			healthyVoters++
+		default:
+			lost = append(lost, m)
+		}
+	}
+
+	if healthyVoters < voters && len(learners) > 0 {
+		sort.Slice(learners, func(i, j int) bool {
+			return learners[i].Name < learners[j].Name
+		})
+		return &promotionPlan{promote: learners[0].ID, name: learners[0].Name}
+	}
+
+	if len(lost) > 0 && healthyVoters+len(lost) > voters && healthyVoters >= voters {
+		return &promotionPlan{remove: lost[0].ID, name: lost[0].Name}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+func TestPromotionPlan(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	lostTimeout := time.Minute
+	members := []*pb.Member{
+		{ID: 1, Name: "primary-1"},
+		{ID: 2, Name: "primary-2"},
+		{ID: 3, Name: "primary-3"},
+		{ID: 4, Name: "learner-b", IsLearner: true},
+		{ID: 5, Name: "learner-a", IsLearner: true},
+		{ID: 6, Name: "", IsLearner: true},
+	}
+	heartbeats := map[string]time.Time{
+		"primary-1": now,
+		"primary-2": now,
+		"primary-3": now,
+		"learner-a": now,
+		"learner-b": now,
+	}
+
+	// all voting members are healthy.
+	state := &promotionState{lastSeen: map[uint64]time.Time{}}
+	assert.Nil(state.plan(members, heartbeats, 3, lostTimeout, now))
+
+	// the lost member is replaced by the first healthy learner.
+	heartbeats["primary-3"] = now.Add(-2 * lostTimeout)
+	state = &promotionState{lastSeen: map[uint64]time.Time{}}
+	plan := state.plan(members, heartbeats, 3, lostTimeout, now)
+	assert.Equal(&promotionPlan{promote: 5, name: "learner-a"}, plan)
+
+	// the lost member is removed after the learner is promoted.
+	members[4].IsLearner = false
+	plan = state.plan(members, heartbeats, 3, lostTimeout, now)
+	assert.Equal(&promotionPlan{remove: 3, name: "primary-3"}, plan)
+
+	members = append(members[:2], members[3:]...)
+	assert.Nil(state.plan(members, heartbeats, 3, lostTimeout, now))
+	assert.NotContains(state.lastSeen, uint64(3))
+
+	// the lost member is kept if there is no learner to promote.
+	members = []*pb.Member{
+		{ID: 1, Name: "primary-1"},
+		{ID: 2, Name: "primary-2"},
+		{ID: 3, Name: "primary-3"},
+	}
+	state = &promotionState{lastSeen: map[uint64]time.Time{}}
+	assert.Nil(state.plan(members, heartbeats, 3, lostTimeout, now))
+
+	// the members without status are lost after the timeout since they
+	// were observed.
+	delete(heartbeats, "primary-3")
+	members = append(members, &pb.Member{ID: 4, Name: "learner-a", IsLearner: true})
+	state = &promotionState{lastSeen: map[uint64]time.Time{}}
+	assert.Nil(state.plan(members, heartbeats, 3, lostTimeout, now))
+	heartbeats["learner-a"] = now.Add(2 * lostTimeout)
+	heartbeats["primary-1"] = now.Add(2 * lostTimeout)
+	heartbeats["primary-2"] = now.Add(2 * lostTimeout)
+	plan = state.plan(members, heartbeats, 3, lostTimeout, now.Add(2*lostTimeout))
+	assert.Equal(&promotionPlan{promote: 4, name: "learner-a"}, plan)
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+// Manager takes the snapshots of the cluster data on demand or on
+// schedule, and manages the stored ones.
+type Manager struct {
+	cls         cluster.Cluster
+	clusterName string
+	storage     Storage
+	maxBackups  int
+	// standalone is true if the member uses standalone etcd, there is no
+	// leader then, so every member with a schedule takes the snapshots.
+	standalone bool
+
+	// mutex serializes taking and pruning snapshots of this member.
+	mutex sync.Mutex
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewManager creates a snapshot manager, it takes snapshots periodically
+// if the interval is configured.
+func NewManager(opt *option.Options, cls cluster.Cluster) (*Manager, error) {
+	opts := &opt.Snapshot
+	m := &Manager{
+		cls:         cls,
+		clusterName: opt.ClusterName,
+		maxBackups:  opts.MaxBackups,
+		standalone:  opt.UseStandaloneEtcd,
+		done:        make(chan struct{}),
+	}
+
+	if opts.S3Bucket != "" {
+		s, err := newS3Storage(opts)
+		if err != nil {
+			return nil, err
+		}
+		m.storage = s
+	} else {
+		m.storage = newLocalStorage(opt.AbsSnapshotDir)
+	}
+
+	if opts.Interval != "" {
+		interval, err := time.ParseDuration(opts.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot interval %s: %v", opts.Interval, err)
+		}
+		m.wg.Add(1)
+		go m.run(interval)
+	}
+	return m, nil
+}
+
+func (m *Manager) run(interval time.Duration) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+
+		// only one member takes the scheduled snapshots.
+		if !m.standalone && !m.cls.IsLeader() {
+			continue
+		}
+		info, err := m.Take()
+		if err != nil {
+			logger.Errorf("take scheduled snapshot failed: %v", err)
+			continue
+		}
+		logger.Infof("scheduled snapshot %s is taken", info.Name)
+	}
+}
+
+// Take takes a snapshot of the cluster data and stores it, the oldest
+// snapshots are pruned if there are more than the max backups.
+func (m *Manager) Take() (*Info, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	info, err := m.save(newName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.prune(); err != nil {
+		logger.Errorf("prune snapshots failed: %v", err)
+	}
+	return info, nil
+}
+
+// save takes a snapshot of the cluster data and stores it with the name
+// returned by nameOf.
+func (m *Manager) save(nameOf func(time.Time) string) (*Info, error) {
+	s, err := Take(m.cls, m.clusterName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("marshal snapshot failed: %v", err)
+	}
+
+	name := nameOf(s.CreatedAt)
+	if err := m.storage.Save(name, data); err != nil {
+		return nil, fmt.Errorf("save snapshot %s failed: %v", name, err)
+	}
+	return &Info{Name: name, Size: int64(len(data)), CreatedAt: s.CreatedAt}, nil
+}
+
+// prune deletes the oldest snapshots taken by the managers if there are
+// more than the max backups, the other files in the storage are kept.
+func (m *Manager) prune() error {
+	if m.maxBackups <= 0 {
+		return nil
+	}
+
+	infos, err := m.storage.List()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, info := range infos {
+		if isSnapshotName(info.Name) {
+			names = append(names, info.Name)
+		}
+	}
+	for len(names) > m.maxBackups {
+		if err := m.storage.Delete(names[0]); err != nil && err != ErrNotFound {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// List lists the stored snapshots, the oldest comes first.
+func (m *Manager) List() ([]*Info, error) {
+	return m.storage.List()
+}
+
+// Load loads the data of a stored snapshot.
+func (m *Manager) Load(name string) ([]byte, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	return m.storage.Load(name)
+}
+
+// Delete deletes a stored snapshot.
+func (m *Manager) Delete(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	return m.storage.Delete(name)
+}
+
+// Restore restores the cluster data from a snapshot. A snapshot of the
+// current data is taken first, so that the cluster could be recovered if
+// the restoration fails halfway, it is not pruned.
+func (m *Manager) Restore(s *Snapshot) (*RestoreResult, error) {
+	m.mutex.Lock()
+	backup, err := m.save(newBackupName)
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("take backup snapshot failed: %v", err)
+	}
+
+	result, err := Restore(m.cls, s)
+	if err != nil {
+		return nil, fmt.Errorf("%v, the data before the restoration is kept in snapshot %s", err, backup.Name)
+	}
+	result.Backup = backup.Name
+	logger.Infof("cluster data is restored from the snapshot of cluster %s at revision %d: %d put, %d deleted, backup %s",
+		s.ClusterName, s.Revision, result.Put, result.Deleted, backup.Name)
+	return result, nil
+}
+
+// Close stops taking the scheduled snapshots.
+func (m *Manager) Close() {
+	close(m.done)
+	m.wg.Wait()
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestManager(t *testing.T) {
+	assert := assert.New(t)
+
+	cls, _ := newMemoryCluster(map[string]string{
+		"/config/objects/server": "server-spec",
+	})
+	opt := &option.Options{
+		ClusterName:    "cluster",
+		AbsSnapshotDir: t.TempDir(),
+		Snapshot:       option.SnapshotOptions{MaxBackups: 2},
+	}
+	m, err := NewManager(opt, cls)
+	assert.Nil(err)
+	defer m.Close()
+
+	// the oldest snapshots are pruned, the other files are kept.
+	old := time.Now().Add(-time.Hour)
+	m.storage.Save("backup", []byte("backup"))
+	m.storage.Save(newName(old), []byte("old"))
+	m.storage.Save(newName(old.Add(time.Minute)), []byte("old"))
+
+	info, err := m.Take()
+	assert.Nil(err)
+	infos, err := m.List()
+	assert.Nil(err)
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	assert.ElementsMatch([]string{"backup", newName(old.Add(time.Minute)), info.Name}, names)
+
+	data, err := m.Load(info.Name)
+	assert.Nil(err)
+	s, err := Unmarshal(data)
+	assert.Nil(err)
+	assert.Equal("cluster", s.ClusterName)
+
+	cls.PutAndDelete(map[string]*string{"/config/objects/server": nil})
+	result, err := m.Restore(s)
+	assert.Nil(err)
+	assert.Equal(1, result.Put)
+	v, _ := cls.Get("/config/objects/server")
+	assert.Equal("server-spec", *v)
+
+	// the data before the restoration is backed up.
+	data, err = m.Load(result.Backup)
+	assert.Nil(err)
+	backup, err := Unmarshal(data)
+	assert.Nil(err)
+	assert.Empty(backup.KVs)
+
+	_, err = m.Load("../backup")
+	assert.NotNil(err)
+	assert.Nil(m.Delete("backup"))
+	assert.Equal(ErrNotFound, m.Delete("backup"))
+}
+
+func TestManagerSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	cls, _ := newMemoryCluster(map[string]string{})
+	isLeader := false
+	cls.MockedIsLeader = func() bool {
+		return isLeader
+	}
+	opt := &option.Options{
+		AbsSnapshotDir: t.TempDir(),
+		Snapshot:       option.SnapshotOptions{Interval: "10ms"},
+	}
+
+	m, err := NewManager(opt, cls)
+	assert.Nil(err)
+	time.Sleep(50 * time.Millisecond)
+	infos, _ := m.List()
+	assert.Empty(infos)
+	m.Close()
+
+	isLeader = true
+	m, err = NewManager(opt, cls)
+	assert.Nil(err)
+	assert.Eventually(func() bool {
+		infos, _ := m.List()
+		return len(infos) > 0
+	}, 3*time.Second, 10*time.Millisecond)
+	m.Close()
+
+	opt.Snapshot.Interval = "invalid"
+	_, err = NewManager(opt, cls)
+	assert.NotNil(err)
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	s3Timeout       = 5 * time.Minute
+)
+
+type (
+	// s3Storage stores the snapshots in an S3 compatible object storage,
+	// the requests are signed with AWS signature version 4.
+	s3Storage struct {
+		endpoint       *url.URL
+		region         string
+		bucket         string
+		prefix         string
+		forcePathStyle bool
+		credentials    aws.Credentials
+		signer         *v4.Signer
+		client         *http.Client
+	}
+
+	s3ListResult struct {
+		Contents []struct {
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			LastModified time.Time `xml:"LastModified"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+)
+
+func newS3Storage(opts *option.SnapshotOptions) (*s3Storage, error) {
+	region := opts.S3Region
+	if region == "" {
+		region = defaultS3Region
+	}
+
+	endpoint := opts.S3Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint %s: %v", endpoint, err)
+	}
+
+	// the credentials fall back to the standard AWS environment variables.
+	credentials := aws.Credentials{
+		AccessKeyID:     opts.S3AccessKeyID,
+		SecretAccessKey: opts.S3SecretAccessKey,
+	}
+	if credentials.AccessKeyID == "" {
+		credentials.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		credentials.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		credentials.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	prefix := strings.Trim(opts.S3Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &s3Storage{
+		endpoint:       u,
+		region:         region,
+		bucket:         opts.S3Bucket,
+		prefix:         prefix,
+		forcePathStyle: opts.S3ForcePathStyle,
+		credentials:    credentials,
+		signer: v4.NewSigner(func(o *v4.SignerOptions) {
+			// S3 does not escape the path twice.
+			o.DisableURIPathEscaping = true
+		}),
+		client: &http.Client{Timeout: s3Timeout},
+	}, nil
+}
+
+// bucketURL returns the URL of the bucket, in path style or virtual hosted
+// style.
+func (s *s3Storage) bucketURL() *url.URL {
+	u := *s.endpoint
+	if s.forcePathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/"
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/"
+	}
+	return &u
+}
+
+func (s *s3Storage) objectURL(name string) *url.URL {
+	u := s.bucketURL()
+	u.Path += s.prefix + name
+	return u
+}
+
+func (s *s3Storage) do(method string, u *url.URL, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	err = s.signer.SignHTTP(context.Background(), s.credentials, req, payloadHash, "s3", s.region, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("sign request failed: %v", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("s3 %s %s failed: %s: %s", method, u.Path, resp.Status, data)
+	}
+	return data, nil
+}
+
+func (s *s3Storage) Save(name string, data []byte) error {
+	_, err := s.do(http.MethodPut, s.objectURL(name), data)
+	return err
+}
+
+func (s *s3Storage) Load(name string) ([]byte, error) {
+	return s.do(http.MethodGet, s.objectURL(name), nil)
+}
+
+func (s *s3Storage) Delete(name string) error {
+	// S3 returns 204 even if the object does not exist.
+	if _, err := s.do(http.MethodHead, s.objectURL(name), nil); err != nil {
+		return err
+	}
+	_, err := s.do(http.MethodDelete, s.objectURL(name), nil)
+	return err
+}
+
+func (s *s3Storage) List() ([]*Info, error) {
+	infos := []*Info{}
+	token := ""
+	for {
+		u := s.bucketURL()
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", s.prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = q.Encode()
+
+		data, err := s.do(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		result := &s3ListResult{}
+		if err := xml.Unmarshal(data, result); err != nil {
+			return nil, fmt.Errorf("unmarshal s3 list result failed: %v", err)
+		}
+
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, s.prefix)
+			if ValidateName(name) != nil {
+				continue
+			}
+			infos = append(infos, &Info{Name: name, Size: c.Size, CreatedAt: c.LastModified.UTC()})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sortInfos(infos)
+	return infos, nil
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package snapshot provides the backup and restore of the cluster data.
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// rootPrefix is the prefix of all the keys, only the keys of the
+	// Easegress data prefixes are taken and restored.
+	rootPrefix = "/"
+
+	// maxBatchOps and maxBatchBytes keep the transactions of a restoration
+	// below the limits of the etcd server.
+	maxBatchOps   = 1000
+	maxBatchBytes = 4 * 1024 * 1024
+)
+
+type (
+	// Snapshot is a consistent copy of the persistent cluster data, which
+	// includes the object specs, the mesh state, the custom data and so on,
+	// but excludes the runtime state like member statuses and the keys
+	// attached to leases.
+	Snapshot struct {
+		ClusterName string    `json:"clusterName"`
+		Revision    int64     `json:"revision"`
+		CreatedAt   time.Time `json:"createdAt"`
+		KVs         []*KV     `json:"kvs"`
+	}
+
+	// KV is a key-value pair of a snapshot, the value is base64 encoded in
+	// JSON as it may be binary.
+	KV struct {
+		Key   string `json:"key"`
+		Value []byte `json:"value"`
+	}
+
+	// RestoreResult is the result of a restoration.
+	RestoreResult struct {
+		Put     int `json:"put"`
+		Deleted int `json:"deleted"`
+		// Backup is the name of the snapshot taken before the restoration.
+		Backup string `json:"backup,omitempty"`
+	}
+)
+
+// isEasegressKey reports whether the key is under the data prefixes of
+// Easegress, the other keys of a shared etcd cluster are never touched.
+func isEasegressKey(layout *cluster.Layout, key string) bool {
+	for _, prefix := range layout.DataPrefixes() {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRuntimeKey reports whether the key belongs to the runtime state, which
+// is rebuilt by the members and must not be restored.
+func isRuntimeKey(layout *cluster.Layout, key string) bool {
+	if key == layout.ClusterNameKey() || key == layout.ConfigVersion() {
+		return true
+	}
+	for _, prefix := range []string{layout.LeasePrefix(), layout.StatusMemberPrefix(), layout.StatusObjectsPrefix()} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// persistentKVs returns the persistent key-values of Easegress, they are
+// read in one request, so they are consistent at a revision.
+func persistentKVs(cls cluster.Cluster) (map[string][]byte, int64, error) {
+	kvs, err := cls.GetRawPrefix(rootPrefix)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := make(map[string][]byte, len(kvs))
+	revision := int64(0)
+	for k, kv := range kvs {
+		if kv.Lease != 0 || !isEasegressKey(cls.Layout(), k) || isRuntimeKey(cls.Layout(), k) {
+			continue
+		}
+		result[k] = kv.Value
+		if kv.ModRevision > revision {
+			revision = kv.ModRevision
+		}
+	}
+	return result, revision, nil
+}
+
+// Take takes a snapshot of the cluster data.
+func Take(cls cluster.Cluster, clusterName string) (*Snapshot, error) {
+	kvs, revision, err := persistentKVs(cls)
+	if err != nil {
+		return nil, fmt.Errorf("read cluster data failed: %v", err)
+	}
+
+	s := &Snapshot{
+		ClusterName: clusterName,
+		Revision:    revision,
+		CreatedAt:   time.Now().UTC(),
+		KVs:         make([]*KV, 0, len(kvs)),
+	}
+	for k, v := range kvs {
+		s.KVs = append(s.KVs, &KV{Key: k, Value: v})
+	}
+	sort.Slice(s.KVs, func(i, j int) bool {
+		return s.KVs[i].Key < s.KVs[j].Key
+	})
+	return s, nil
+}
+
+// Restore restores the cluster data to the snapshot: the keys in the
+// snapshot are put, and the other persistent keys of Easegress are deleted.
+// The changes are committed in as few transactions as the etcd limits allow,
+// but they are not atomic if there are several transactions: if one of them
+// fails, the committed ones are kept and the cluster data is a mix of the
+// snapshot and the previous data, restore the snapshot again or the backup
+// taken by the Manager to recover.
+func Restore(cls cluster.Cluster, s *Snapshot) (*RestoreResult, error) {
+	current, _, err := persistentKVs(cls)
+	if err != nil {
+		return nil, fmt.Errorf("read cluster data failed: %v", err)
+	}
+
+	result := &RestoreResult{}
+	batch, batchBytes := map[string]*string{}, 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := cls.PutAndDelete(batch); err != nil {
+			return fmt.Errorf("write cluster data failed: %v", err)
+		}
+		batch, batchBytes = map[string]*string{}, 0
+		return nil
+	}
+	add := func(key string, value *string) error {
+		size := len(key)
+		if value != nil {
+			size += len(*value)
+		}
+		if len(batch) >= maxBatchOps || (len(batch) > 0 && batchBytes+size > maxBatchBytes) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		batch[key] = value
+		batchBytes += size
+		return nil
+	}
+
+	keys := make(map[string]struct{}, len(s.KVs))
+	for _, kv := range s.KVs {
+		keys[kv.Key] = struct{}{}
+		if v, ok := current[kv.Key]; ok && bytes.Equal(v, kv.Value) {
+			continue
+		}
+		value := string(kv.Value)
+		if err := add(kv.Key, &value); err != nil {
+			return nil, err
+		}
+		result.Put++
+	}
+	for k := range current {
+		if _, ok := keys[k]; ok {
+			continue
+		}
+		if err := add(k, nil); err != nil {
+			return nil, err
+		}
+		result.Deleted++
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Validate validates the snapshot against the layout of the cluster.
+func (s *Snapshot) Validate(layout *cluster.Layout) error {
+	for _, kv := range s.KVs {
+		if !isEasegressKey(layout, kv.Key) {
+			return fmt.Errorf("invalid key %s", kv.Key)
+		}
+		if isRuntimeKey(layout, kv.Key) {
+			return fmt.Errorf("key %s belongs to the runtime state", kv.Key)
+		}
+	}
+	return nil
+}
+
+// Marshal marshals the snapshot to gzipped JSON.
+func (s *Snapshot) Marshal() ([]byte, error) {
+	data, err := codectool.MarshalJSON(s)
+	if err != nil {
+		return nil, err
+	}
+
+	buff := &bytes.Buffer{}
+	zw := gzip.NewWriter(buff)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// Unmarshal unmarshals a snapshot from gzipped or plain JSON.
+func Unmarshal(data []byte) (*Snapshot, error) {
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Snapshot{}
+	if err := codectool.UnmarshalJSON(data, s); err != nil {
+		return nil, fmt.Errorf("unmarshal snapshot failed: %v", err)
+	}
+	return s, nil
+}
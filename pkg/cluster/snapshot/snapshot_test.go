@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+)
+
+// newMemoryCluster returns a mocked cluster storing the data in a map, the
+// keys in leased are attached to a lease.
+func newMemoryCluster(data map[string]string, leased ...string) (*clustertest.MockedCluster, *int) {
+	var lock sync.Mutex
+	revision := int64(1)
+	kvs := map[string]*mvccpb.KeyValue{}
+	for k, v := range data {
+		kvs[k] = &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v), ModRevision: revision}
+	}
+	for _, k := range leased {
+		kvs[k].Lease = 1
+	}
+
+	txns := 0
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	cls.MockedGetRawPrefix = func(prefix string) (map[string]*mvccpb.KeyValue, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		result := map[string]*mvccpb.KeyValue{}
+		for k, kv := range kvs {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = kv
+			}
+		}
+		return result, nil
+	}
+	cls.MockedGet = func(key string) (*string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if kv, ok := kvs[key]; ok {
+			v := string(kv.Value)
+			return &v, nil
+		}
+		return nil, nil
+	}
+	cls.MockedPutAndDelete = func(m map[string]*string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		txns++
+		revision++
+		for k, v := range m {
+			if v == nil {
+				delete(kvs, k)
+			} else {
+				kvs[k] = &mvccpb.KeyValue{Key: []byte(k), Value: []byte(*v), ModRevision: revision}
+			}
+		}
+		return nil
+	}
+	return cls, &txns
+}
+
+func TestTakeAndRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	cls, txns := newMemoryCluster(map[string]string{
+		"/config/objects/pipeline": "pipeline-spec",
+		"/config/objects/server":   "server-spec",
+		"/config/version":          "10",
+		"/mesh/tenants/tenant":     "tenant-spec",
+		"/custom-data/kind/data":   "data",
+		"/eg/cluster/name":         "cluster",
+		"/leases/member":           "1234",
+		"/status/members/member":   "status",
+		"/status/objects/ns/obj/m": "status",
+		"/rate-limiter/p/f/key":    "state",
+		"/other-app/key":           "other",
+	}, "/rate-limiter/p/f/key")
+
+	s, err := Take(cls, "cluster")
+	assert.Nil(err)
+	assert.Equal("cluster", s.ClusterName)
+	assert.Equal(int64(1), s.Revision)
+	keys := []string{}
+	for _, kv := range s.KVs {
+		keys = append(keys, kv.Key)
+	}
+	assert.Equal([]string{
+		"/config/objects/pipeline",
+		"/config/objects/server",
+		"/custom-data/kind/data",
+		"/mesh/tenants/tenant",
+	}, keys)
+
+	data, err := s.Marshal()
+	assert.Nil(err)
+	s2, err := Unmarshal(data)
+	assert.Nil(err)
+	assert.Equal(s.KVs, s2.KVs)
+	assert.Nil(s2.Validate(cls.Layout()))
+
+	// change the cluster data and restore it.
+	cls.PutAndDelete(map[string]*string{
+		"/config/objects/server": nil,
+		"/config/objects/new":    &[]string{"new-spec"}[0],
+		"/mesh/tenants/tenant":   &[]string{"changed"}[0],
+	})
+	result, err := Restore(cls, s2)
+	assert.Nil(err)
+	assert.Equal(&RestoreResult{Put: 2, Deleted: 1}, result)
+	assert.Equal(2, *txns)
+
+	s3, err := Take(cls, "cluster")
+	assert.Nil(err)
+	assert.Equal(s.KVs, s3.KVs)
+
+	// the runtime state and the keys of other applications are kept.
+	v, _ := cls.Get("/status/members/member")
+	assert.Equal("status", *v)
+	v, _ = cls.Get("/other-app/key")
+	assert.Equal("other", *v)
+	v, _ = cls.Get("/config/version")
+	assert.Equal("10", *v)
+
+	// restoring the same data changes nothing.
+	result, err = Restore(cls, s2)
+	assert.Nil(err)
+	assert.Equal(&RestoreResult{}, result)
+	assert.Equal(2, *txns)
+}
+
+func TestRestoreBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	cls, txns := newMemoryCluster(map[string]string{})
+	s := &Snapshot{}
+	for i := 0; i < maxBatchOps*2+1; i++ {
+		s.KVs = append(s.KVs, &KV{Key: "/custom-data/kind/" + strings.Repeat("k", i+1), Value: []byte("v")})
+	}
+	result, err := Restore(cls, s)
+	assert.Nil(err)
+	assert.Equal(maxBatchOps*2+1, result.Put)
+	assert.Equal(3, *txns)
+
+	kvs, _ := cls.GetRawPrefix("/")
+	assert.Equal(maxBatchOps*2+1, len(kvs))
+}
+
+func TestSnapshotValidateAndUnmarshal(t *testing.T) {
+	assert := assert.New(t)
+
+	layout := &cluster.Layout{}
+	assert.NotNil((&Snapshot{KVs: []*KV{{Key: "config"}}}).Validate(layout))
+	assert.NotNil((&Snapshot{KVs: []*KV{{Key: "/status/members/m"}}}).Validate(layout))
+	assert.NotNil((&Snapshot{KVs: []*KV{{Key: "/leases/m"}}}).Validate(layout))
+	assert.NotNil((&Snapshot{KVs: []*KV{{Key: "/other-app/key"}}}).Validate(layout))
+	assert.Nil((&Snapshot{KVs: []*KV{{Key: "/config/objects/o"}}}).Validate(layout))
+
+	// plain JSON is accepted too.
+	s, err := Unmarshal([]byte(`{"clusterName": "c", "kvs": [{"key": "/a", "value": "dmFsdWU="}]}`))
+	assert.Nil(err)
+	assert.Equal("c", s.ClusterName)
+	assert.Equal([]byte("value"), s.KVs[0].Value)
+
+	_, err = Unmarshal([]byte("not json"))
+	assert.NotNil(err)
+	_, err = Unmarshal([]byte{0x1f, 0x8b, 0x00})
+	assert.NotNil(err)
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotNamePrefix = "snapshot-"
+	backupNamePrefix   = "pre-restore-"
+	snapshotNameSuffix = ".json.gz"
+	snapshotTimeFormat = "20060102T150405Z"
+)
+
+// ErrNotFound is returned if the snapshot does not exist.
+var ErrNotFound = errors.New("snapshot not found")
+
+var snapshotNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type (
+	// Storage stores the snapshots.
+	Storage interface {
+		Save(name string, data []byte) error
+		Load(name string) ([]byte, error)
+		Delete(name string) error
+		// List returns the stored snapshots, the oldest comes first.
+		List() ([]*Info, error)
+	}
+
+	// Info is the information of a stored snapshot.
+	Info struct {
+		Name      string    `json:"name"`
+		Size      int64     `json:"size"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+
+	// localStorage stores the snapshots in a local directory.
+	localStorage struct {
+		dir string
+	}
+)
+
+// ValidateName validates the name of a snapshot, which must not contain
+// path separators.
+func ValidateName(name string) error {
+	if !snapshotNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name %q", name)
+	}
+	return nil
+}
+
+// newName returns the name of the snapshot created at t.
+func newName(t time.Time) string {
+	return snapshotNamePrefix + t.UTC().Format(snapshotTimeFormat) + snapshotNameSuffix
+}
+
+// newBackupName returns the name of the snapshot taken before a restoration
+// at t, these snapshots are never pruned.
+func newBackupName(t time.Time) string {
+	return backupNamePrefix + t.UTC().Format(snapshotTimeFormat) + snapshotNameSuffix
+}
+
+// isSnapshotName reports whether the name is created by newName, only these
+// snapshots are pruned.
+func isSnapshotName(name string) bool {
+	return strings.HasPrefix(name, snapshotNamePrefix) && strings.HasSuffix(name, snapshotNameSuffix)
+}
+
+func sortInfos(infos []*Info) {
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].CreatedAt.Equal(infos[j].CreatedAt) {
+			return infos[i].CreatedAt.Before(infos[j].CreatedAt)
+		}
+		return infos[i].Name < infos[j].Name
+	})
+}
+
+func newLocalStorage(dir string) *localStorage {
+	return &localStorage{dir: dir}
+}
+
+func (s *localStorage) Save(name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so a partial snapshot is never
+	// listed.
+	tmp := filepath.Join(s.dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, name))
+}
+
+func (s *localStorage) Load(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *localStorage) Delete(name string) error {
+	err := os.Remove(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *localStorage) List() ([]*Info, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return []*Info{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*Info, 0, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() || ValidateName(e.Name()) != nil {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, &Info{
+			Name:      e.Name(),
+			Size:      fi.Size(),
+			CreatedAt: fi.ModTime().UTC(),
+		})
+	}
+	sortInfos(infos)
+	return infos, nil
+}
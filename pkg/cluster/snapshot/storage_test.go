@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+// startS3Server starts a fake S3 server serving the bucket in path style.
+func startS3Server(t *testing.T, bucket string) (*httptest.Server, map[string][]byte) {
+	var lock sync.Mutex
+	objects := map[string][]byte{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key-id/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		key, ok := strings.CutPrefix(r.URL.Path, "/"+bucket+"/")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case key == "" && r.Method == http.MethodGet:
+			prefix := r.URL.Query().Get("prefix")
+			keys := []string{}
+			for k := range objects {
+				if strings.HasPrefix(k, prefix) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			fmt.Fprint(w, "<ListBucketResult>")
+			for _, k := range keys {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>2023-10-01T00:00:00.000Z</LastModified></Contents>", k, len(objects[k]))
+			}
+			fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+		case r.Method == http.MethodPut:
+			objects[key], _ = io.ReadAll(r.Body)
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			data, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method == http.MethodGet {
+				w.Write(data)
+			}
+		case r.Method == http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, objects
+}
+
+func testStorage(assert *assert.Assertions, s Storage) {
+	infos, err := s.List()
+	assert.Nil(err)
+	assert.Empty(infos)
+
+	assert.Nil(s.Save("snapshot-1.json.gz", []byte("data-1")))
+	assert.Nil(s.Save("snapshot-2.json.gz", []byte("data-22")))
+
+	data, err := s.Load("snapshot-2.json.gz")
+	assert.Nil(err)
+	assert.Equal([]byte("data-22"), data)
+	_, err = s.Load("snapshot-3.json.gz")
+	assert.Equal(ErrNotFound, err)
+
+	infos, err = s.List()
+	assert.Nil(err)
+	assert.Equal(2, len(infos))
+	assert.Equal("snapshot-1.json.gz", infos[0].Name)
+	assert.Equal(int64(6), infos[0].Size)
+	assert.Equal("snapshot-2.json.gz", infos[1].Name)
+
+	assert.Nil(s.Delete("snapshot-1.json.gz"))
+	assert.Equal(ErrNotFound, s.Delete("snapshot-1.json.gz"))
+	infos, err = s.List()
+	assert.Nil(err)
+	assert.Equal(1, len(infos))
+}
+
+func TestLocalStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	testStorage(assert, newLocalStorage(dir))
+
+	// the files which are not snapshots are not listed.
+	os.Mkdir(filepath.Join(dir, "sub"), 0o750)
+	os.WriteFile(filepath.Join(dir, ".tmp"), nil, 0o600)
+	infos, err := newLocalStorage(dir).List()
+	assert.Nil(err)
+	assert.Equal(1, len(infos))
+}
+
+func TestS3Storage(t *testing.T) {
+	assert := assert.New(t)
+
+	server, objects := startS3Server(t, "backup")
+	s, err := newS3Storage(&option.SnapshotOptions{
+		S3Endpoint:        server.URL,
+		S3Bucket:          "backup",
+		S3Prefix:          "/easegress/",
+		S3AccessKeyID:     "key-id",
+		S3SecretAccessKey: "secret",
+		S3ForcePathStyle:  true,
+	})
+	assert.Nil(err)
+	testStorage(assert, s)
+	_, ok := objects["easegress/snapshot-2.json.gz"]
+	assert.True(ok)
+
+	// wrong credentials are rejected.
+	s.credentials.AccessKeyID = "other"
+	_, err = s.List()
+	assert.NotNil(err)
+
+	// virtual hosted style URLs.
+	s, err = newS3Storage(&option.SnapshotOptions{S3Bucket: "backup", S3Region: "eu-west-1"})
+	assert.Nil(err)
+	assert.Equal("https://backup.s3.eu-west-1.amazonaws.com/snapshot-1.json.gz", s.objectURL("snapshot-1.json.gz").String())
+}
+
+func TestValidateName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(ValidateName("snapshot-20231001T000000Z.json.gz"))
+	assert.Nil(ValidateName("backup_1"))
+	assert.NotNil(ValidateName(""))
+	assert.NotNil(ValidateName(".hidden"))
+	assert.NotNil(ValidateName("../etc/passwd"))
+	assert.NotNil(ValidateName("a/b"))
+
+	name := newName(time.Date(2023, 10, 1, 8, 30, 0, 0, time.UTC))
+	assert.Equal("snapshot-20231001T083000Z.json.gz", name)
+	assert.True(isSnapshotName(name))
+	assert.False(isSnapshotName("backup_1"))
+}
@@ -38,7 +38,7 @@ type syncer struct {
 var _ Syncer = (*syncer)(nil)
 
 func (c *cluster) Syncer(pullInterval time.Duration) (Syncer, error) {
-	client, err := c.getClient()
+	client, err := c.getReadClient()
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +78,7 @@ func (s *syncer) watch(key string, prefix bool) (clientv3.Watcher, clientv3.Watc
 	if prefix {
 		opts = append(opts, clientv3.WithPrefix())
 	}
-	watcher := clientv3.NewWatcher(s.client)
+	watcher := s.cluster.newWatcher(s.client)
 	watchChan := watcher.Watch(context.Background(), key, opts...)
 	logger.Debugf("watcher created for key %s (prefix: %v)", key, prefix)
 	return watcher, watchChan
@@ -35,12 +35,12 @@ type (
 )
 
 func (c *cluster) Watcher() (Watcher, error) {
-	client, err := c.getClient()
+	client, err := c.getReadClient()
 	if err != nil {
 		return nil, fmt.Errorf("get client failed: %v", err)
 	}
 
-	w := clientv3.NewWatcher(client)
+	w := c.newWatcher(client)
 
 	return &watcher{
 		w:    w,
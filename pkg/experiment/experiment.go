@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package experiment defines A/B testing experiments and their metrics.
+package experiment
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+// headerPrefix is the prefix of the default variant header.
+const headerPrefix = "X-Experiment-"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+type (
+	// Experiment is an A/B testing experiment, the requests matching the
+	// targeting rule are assigned to the variants by their weights.
+	Experiment struct {
+		Name      string     `json:"name" jsonschema:"required"`
+		Paused    bool       `json:"paused,omitempty"`
+		Header    string     `json:"header,omitempty"`
+		KeyHeader string     `json:"keyHeader,omitempty"`
+		KeyCookie string     `json:"keyCookie,omitempty"`
+		Targeting *Targeting `json:"targeting,omitempty"`
+		Variants  []*Variant `json:"variants" jsonschema:"required"`
+	}
+
+	// Targeting selects the requests in an experiment.
+	Targeting struct {
+		Hosts   []string                             `json:"hosts,omitempty" jsonschema:"uniqueItems=true"`
+		Methods []string                             `json:"methods,omitempty" jsonschema:"uniqueItems=true"`
+		Path    *stringtool.StringMatcher            `json:"path,omitempty"`
+		Headers map[string]*stringtool.StringMatcher `json:"headers,omitempty"`
+		// Permil is the permil of the matched traffic in the experiment,
+		// 0 means all.
+		Permil uint32 `json:"permil,omitempty" jsonschema:"minimum=0,maximum=1000"`
+	}
+
+	// Variant is a variant of an experiment.
+	Variant struct {
+		Name   string `json:"name" jsonschema:"required"`
+		Weight int    `json:"weight" jsonschema:"minimum=0"`
+	}
+)
+
+func validateMatcher(sm *stringtool.StringMatcher) error {
+	if err := sm.Validate(); err != nil {
+		return err
+	}
+	if _, err := regexp.Compile(sm.RegEx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate validates the experiment.
+func (e *Experiment) Validate() error {
+	if !validName.MatchString(e.Name) {
+		return fmt.Errorf("invalid experiment name %q", e.Name)
+	}
+
+	if len(e.Variants) == 0 {
+		return fmt.Errorf("experiment %s: no variants", e.Name)
+	}
+	names := map[string]struct{}{}
+	total := 0
+	for _, v := range e.Variants {
+		if v.Name == "" {
+			return fmt.Errorf("experiment %s: empty variant name", e.Name)
+		}
+		if _, ok := names[v.Name]; ok {
+			return fmt.Errorf("experiment %s: duplicated variant %s", e.Name, v.Name)
+		}
+		names[v.Name] = struct{}{}
+		if v.Weight < 0 {
+			return fmt.Errorf("experiment %s: negative weight of variant %s", e.Name, v.Name)
+		}
+		total += v.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("experiment %s: total weight of variants is 0", e.Name)
+	}
+
+	t := e.Targeting
+	if t == nil {
+		return nil
+	}
+	if t.Permil > 1000 {
+		return fmt.Errorf("experiment %s: permil must be in range [0, 1000]", e.Name)
+	}
+	if t.Path != nil {
+		if err := validateMatcher(t.Path); err != nil {
+			return fmt.Errorf("experiment %s: invalid path: %v", e.Name, err)
+		}
+	}
+	for k, v := range t.Headers {
+		if err := validateMatcher(v); err != nil {
+			return fmt.Errorf("experiment %s: invalid header %s: %v", e.Name, k, err)
+		}
+	}
+	return nil
+}
+
+// Init initializes the experiment, it must be called after Validate.
+func (e *Experiment) Init() {
+	if e.Header == "" {
+		e.Header = headerPrefix + e.Name
+	}
+	if t := e.Targeting; t != nil {
+		if t.Path != nil {
+			t.Path.Init()
+		}
+		for _, v := range t.Headers {
+			v.Init()
+		}
+	}
+}
+
+func (t *Targeting) match(req *httpprot.Request) bool {
+	if len(t.Hosts) > 0 && !stringtool.StrInSlice(req.Host(), t.Hosts) {
+		return false
+	}
+	if len(t.Methods) > 0 && !stringtool.StrInSlice(req.Method(), t.Methods) {
+		return false
+	}
+	if t.Path != nil && !t.Path.Match(req.Path()) {
+		return false
+	}
+	for k, v := range t.Headers {
+		if !v.MatchAny(req.HTTPHeader().Values(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+// key returns the key to assign the variant, the client IP is used if
+// the request has no configured key.
+func (e *Experiment) key(req *httpprot.Request) string {
+	if e.KeyHeader != "" {
+		if v := req.HTTPHeader().Get(e.KeyHeader); v != "" {
+			return v
+		}
+	}
+	if e.KeyCookie != "" {
+		if c, err := req.Cookie(e.KeyCookie); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+	return req.RealIP()
+}
+
+func hash(parts ...string) uint32 {
+	h := fnv.New32a()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return h.Sum32()
+}
+
+// Assign assigns the request to a variant, it returns an empty string if
+// the request is not in the experiment. The same key is always assigned
+// to the same variant as long as the variants are not changed.
+func (e *Experiment) Assign(req *httpprot.Request) string {
+	if e.Paused {
+		return ""
+	}
+	if e.Targeting != nil && !e.Targeting.match(req) {
+		return ""
+	}
+
+	key := e.key(req)
+	if t := e.Targeting; t != nil && t.Permil > 0 {
+		if hash(e.Name, "traffic", key)%1000 >= t.Permil {
+			return ""
+		}
+	}
+
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	n := int(hash(e.Name, key) % uint32(total))
+	for _, v := range e.Variants {
+		if n < v.Weight {
+			return v.Name
+		}
+		n -= v.Weight
+	}
+	return ""
+}
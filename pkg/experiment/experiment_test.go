@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package experiment
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newExperiment(t *testing.T, yamlConfig string) *Experiment {
+	e := &Experiment{}
+	codectool.MustUnmarshal([]byte(yamlConfig), e)
+	if err := e.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e.Init()
+	return e
+}
+
+func newRequest(t *testing.T, method, path string, header http.Header) *httpprot.Request {
+	stdr, _ := http.NewRequest(method, "http://example.com"+path, nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+	return req
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, yamlConfig := range []string{`
+name: "bad name"
+variants: [{name: a, weight: 1}]
+`, `
+name: exp
+`, `
+name: exp
+variants: [{name: a, weight: 1}, {name: a, weight: 1}]
+`, `
+name: exp
+variants: [{name: a, weight: 0}]
+`, `
+name: exp
+variants: [{name: a, weight: -1}, {name: b, weight: 2}]
+`, `
+name: exp
+variants: [{name: a, weight: 1}]
+targeting:
+  permil: 2000
+`, `
+name: exp
+variants: [{name: a, weight: 1}]
+targeting:
+  path:
+    regex: "[a-"
+`} {
+		e := &Experiment{}
+		codectool.MustUnmarshal([]byte(yamlConfig), e)
+		assert.Error(e.Validate(), yamlConfig)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	assert := assert.New(t)
+
+	e := newExperiment(t, `
+name: checkout
+keyHeader: X-User-ID
+targeting:
+  methods: [GET]
+  path:
+    prefix: /shop/
+  permil: 500
+variants:
+- name: control
+  weight: 1
+- name: treatment
+  weight: 3
+`)
+	assert.Equal("X-Experiment-checkout", e.Header)
+
+	// requests not matching the targeting rule are not in the experiment.
+	assert.Equal("", e.Assign(newRequest(t, http.MethodPost, "/shop/", nil)))
+	assert.Equal("", e.Assign(newRequest(t, http.MethodGet, "/other", nil)))
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		header := http.Header{"X-User-Id": []string{fmt.Sprintf("user-%d", i)}}
+		v := e.Assign(newRequest(t, http.MethodGet, "/shop/cart", header))
+		counts[v]++
+
+		// the assignment is consistent.
+		assert.Equal(v, e.Assign(newRequest(t, http.MethodGet, "/shop/items", header)))
+	}
+	assert.InDelta(2000, counts[""], 200)
+	assert.InDelta(500, counts["control"], 100)
+	assert.InDelta(1500, counts["treatment"], 200)
+
+	e.Paused = true
+	header := http.Header{"X-User-Id": []string{"user-1"}}
+	assert.Equal("", e.Assign(newRequest(t, http.MethodGet, "/shop/", header)))
+}
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	Record("exp", "a", 200, 10*time.Millisecond)
+	Record("exp", "a", 503, 30*time.Millisecond)
+	Record("exp", "b", 200, 10*time.Millisecond)
+
+	m := Metrics("exp")
+	assert.Len(m, 2)
+	assert.Equal(uint64(2), m["a"].Requests)
+	assert.Equal(uint64(1), m["a"].Errors)
+	assert.Equal(0.5, m["a"].ErrorRate)
+	assert.Equal(20.0, m["a"].AvgLatency)
+	assert.Equal(uint64(0), m["b"].Errors)
+
+	ResetMetrics("exp")
+	assert.Empty(Metrics("exp"))
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package experiment
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+)
+
+type (
+	// VariantMetrics is the metrics of a variant in this member.
+	VariantMetrics struct {
+		Requests uint64 `json:"requests"`
+		// Errors is the number of requests with 5xx responses.
+		Errors    uint64  `json:"errors"`
+		ErrorRate float64 `json:"errorRate"`
+		// AvgLatency is the average latency in milliseconds.
+		AvgLatency float64 `json:"avgLatency"`
+	}
+
+	variantStat struct {
+		requests uint64
+		errors   uint64
+		latency  time.Duration
+	}
+
+	promMetrics struct {
+		requests *prometheus.CounterVec
+		errors   *prometheus.CounterVec
+		duration *prometheus.HistogramVec
+	}
+)
+
+var (
+	lock  sync.Mutex
+	stats = map[string]map[string]*variantStat{}
+
+	promOnce sync.Once
+	prom     *promMetrics
+)
+
+func getPromMetrics() *promMetrics {
+	promOnce.Do(func() {
+		labels := []string{"experiment", "variant"}
+		prom = &promMetrics{
+			requests: prometheushelper.NewCounter(
+				"experiment_total_requests",
+				"the total count of requests of an experiment variant",
+				labels),
+			errors: prometheushelper.NewCounter(
+				"experiment_total_error_requests",
+				"the total count of requests with 5xx responses of an experiment variant",
+				labels),
+			duration: prometheushelper.NewHistogram(
+				prometheus.HistogramOpts{
+					Name:    "experiment_requests_duration",
+					Help:    "request processing duration histogram of an experiment variant",
+					Buckets: prometheushelper.DefaultDurationBuckets(),
+				},
+				labels),
+		}
+	})
+	return prom
+}
+
+// Record records the result of a request assigned to the variant.
+func Record(experiment, variant string, statusCode int, latency time.Duration) {
+	isError := statusCode >= 500
+
+	lock.Lock()
+	vs := stats[experiment]
+	if vs == nil {
+		vs = map[string]*variantStat{}
+		stats[experiment] = vs
+	}
+	s := vs[variant]
+	if s == nil {
+		s = &variantStat{}
+		vs[variant] = s
+	}
+	s.requests++
+	if isError {
+		s.errors++
+	}
+	s.latency += latency
+	lock.Unlock()
+
+	m := getPromMetrics()
+	labels := prometheus.Labels{"experiment": experiment, "variant": variant}
+	m.requests.With(labels).Inc()
+	if isError {
+		m.errors.With(labels).Inc()
+	}
+	m.duration.With(labels).Observe(latency.Seconds())
+}
+
+// Metrics returns the metrics of the variants of the experiment.
+func Metrics(experiment string) map[string]*VariantMetrics {
+	lock.Lock()
+	defer lock.Unlock()
+
+	result := map[string]*VariantMetrics{}
+	for name, s := range stats[experiment] {
+		m := &VariantMetrics{Requests: s.requests, Errors: s.errors}
+		if s.requests > 0 {
+			m.ErrorRate = float64(s.errors) / float64(s.requests)
+			m.AvgLatency = float64(s.latency) / float64(s.requests) / float64(time.Millisecond)
+		}
+		result[name] = m
+	}
+	return result
+}
+
+// ResetMetrics resets the metrics of the experiment.
+func ResetMetrics(experiment string) {
+	lock.Lock()
+	delete(stats, experiment)
+	lock.Unlock()
+}
@@ -0,0 +1,364 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package bodytransformer provides the BodyTransformer filter.
+package bodytransformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of BodyTransformer.
+	Kind = "BodyTransformer"
+
+	resultTransformFailed = "transformFailed"
+
+	targetRequest  = "request"
+	targetResponse = "response"
+
+	keyContentLength   = "Content-Length"
+	keyContentEncoding = "Content-Encoding"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "BodyTransformer reshapes the JSON body of the request or the response.",
+	Results:     []string{resultTransformFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{Target: targetRequest}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &BodyTransformer{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// BodyTransformer is filter BodyTransformer.
+	BodyTransformer struct {
+		spec  *Spec
+		rules []*rule
+	}
+
+	// Spec describes the BodyTransformer.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Target string  `json:"target,omitempty" jsonschema:"enum=request,enum=response"`
+		Rules  []*Rule `json:"rules" jsonschema:"required,minItems=1"`
+	}
+
+	// Rule is a group of transformations applied when its condition is met.
+	Rule struct {
+		When *Condition `json:"when,omitempty"`
+		// Mappings move or copy the values between fields.
+		Mappings []*Mapping `json:"mappings,omitempty"`
+		// Remove removes the fields.
+		Remove []string `json:"remove,omitempty"`
+		// Set sets the fields to constants.
+		Set []*Constant `json:"set,omitempty"`
+	}
+
+	// Condition is the condition of a rule, the field at the path must
+	// exist, and must equal to the value if it is specified.
+	Condition struct {
+		Path   string      `json:"path" jsonschema:"required"`
+		Equals interface{} `json:"equals,omitempty"`
+		// Absent inverts the condition to require the field not exist.
+		Absent bool `json:"absent,omitempty"`
+	}
+
+	// Mapping maps the value of a source field to a destination field,
+	// the source field is removed unless Keep is true.
+	Mapping struct {
+		From string `json:"from" jsonschema:"required"`
+		To   string `json:"to" jsonschema:"required"`
+		Keep bool   `json:"keep,omitempty"`
+	}
+
+	// Constant is a constant value of a field.
+	Constant struct {
+		Path  string      `json:"path" jsonschema:"required"`
+		Value interface{} `json:"value"`
+	}
+
+	rule struct {
+		spec     *Rule
+		when     path
+		equals   string
+		mappings []*mapping
+		remove   []path
+		set      []*constant
+	}
+
+	mapping struct {
+		from path
+		to   path
+		keep bool
+	}
+
+	constant struct {
+		path  path
+		value interface{}
+	}
+)
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	_, err := compileRules(s.Rules)
+	return err
+}
+
+func compileRules(specs []*Rule) ([]*rule, error) {
+	var rules []*rule
+	for i, spec := range specs {
+		r, err := compileRule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func compileRule(spec *Rule) (*rule, error) {
+	r := &rule{spec: spec}
+
+	var err error
+	if spec.When != nil {
+		if r.when, err = parsePath(spec.When.Path); err != nil {
+			return nil, err
+		}
+		if spec.When.Equals != nil {
+			r.equals = canonical(spec.When.Equals)
+		}
+	}
+
+	for _, m := range spec.Mappings {
+		from, err := parsePath(m.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := parsePath(m.To)
+		if err != nil {
+			return nil, err
+		}
+		r.mappings = append(r.mappings, &mapping{from: from, to: to, keep: m.Keep})
+	}
+
+	for _, s := range spec.Remove {
+		p, err := parsePath(s)
+		if err != nil {
+			return nil, err
+		}
+		r.remove = append(r.remove, p)
+	}
+
+	for _, c := range spec.Set {
+		p, err := parsePath(c.Path)
+		if err != nil {
+			return nil, err
+		}
+		r.set = append(r.set, &constant{path: p, value: c.Value})
+	}
+
+	return r, nil
+}
+
+// canonical returns the canonical JSON of the value for comparing, numbers
+// decoded from the spec and from the body have different types.
+func canonical(v interface{}) string {
+	buff, err := codectool.MarshalJSON(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(buff)
+}
+
+func (r *rule) match(doc interface{}) bool {
+	if r.when == nil {
+		return true
+	}
+
+	v, ok := r.when.get(doc)
+	if r.spec.When.Absent {
+		return !ok
+	}
+	if !ok {
+		return false
+	}
+	return r.spec.When.Equals == nil || canonical(v) == r.equals
+}
+
+func (r *rule) apply(doc interface{}) (interface{}, error) {
+	var err error
+
+	for _, m := range r.mappings {
+		v, ok := m.from.get(doc)
+		if !ok {
+			continue
+		}
+		if !m.keep {
+			doc, _ = m.from.remove(doc)
+		}
+		if doc, err = m.to.set(doc, v); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range r.remove {
+		doc, _ = p.remove(doc)
+	}
+
+	for _, c := range r.set {
+		// Values are copied, so that documents don't share them.
+		var v interface{}
+		if err := codectool.UnmarshalJSON(codectool.MustMarshalJSON(c.value), &v); err != nil {
+			return nil, err
+		}
+		if doc, err = c.path.set(doc, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// Name returns the name of the BodyTransformer filter instance.
+func (bt *BodyTransformer) Name() string {
+	return bt.spec.Name()
+}
+
+// Kind returns the kind of BodyTransformer.
+func (bt *BodyTransformer) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the BodyTransformer
+func (bt *BodyTransformer) Spec() filters.Spec {
+	return bt.spec
+}
+
+// Init initializes BodyTransformer.
+func (bt *BodyTransformer) Init() {
+	bt.reload()
+}
+
+// Inherit inherits previous generation of BodyTransformer.
+func (bt *BodyTransformer) Inherit(previousGeneration filters.Filter) {
+	bt.reload()
+}
+
+func (bt *BodyTransformer) reload() {
+	rules, err := compileRules(bt.spec.Rules)
+	if err != nil {
+		logger.Errorf("BUG: compile rules failed: %v", err)
+	}
+	bt.rules = rules
+}
+
+// transform transforms the JSON body, the second return value is false
+// if no rule matches.
+func (bt *BodyTransformer) transform(body []byte) ([]byte, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false, err
+	}
+
+	matched := false
+	for _, r := range bt.rules {
+		if !r.match(doc) {
+			continue
+		}
+
+		matched = true
+		var err error
+		if doc, err = r.apply(doc); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if !matched {
+		return nil, false, nil
+	}
+
+	data, err := json.Marshal(doc)
+	return data, true, err
+}
+
+// Handle transforms the body of the request or the response.
+func (bt *BodyTransformer) Handle(ctx *context.Context) string {
+	var msg interface {
+		IsStream() bool
+		RawPayload() []byte
+		SetPayload(interface{})
+		HTTPHeader() http.Header
+	}
+
+	if bt.spec.Target == targetResponse {
+		resp, ok := ctx.GetInputResponse().(*httpprot.Response)
+		if !ok || resp == nil {
+			return ""
+		}
+		msg = resp
+	} else {
+		msg = ctx.GetInputRequest().(*httpprot.Request)
+	}
+
+	// Compressed bodies are not transformed.
+	if msg.IsStream() || len(msg.RawPayload()) == 0 || msg.HTTPHeader().Get(keyContentEncoding) != "" {
+		return ""
+	}
+
+	data, matched, err := bt.transform(msg.RawPayload())
+	if err != nil {
+		ctx.AddTag(fmt.Sprintf("bodyTransformer: transform failed: %v", err))
+		return resultTransformFailed
+	}
+	if !matched {
+		return ""
+	}
+
+	msg.SetPayload(data)
+	msg.HTTPHeader().Set(keyContentLength, strconv.Itoa(len(data)))
+	return ""
+}
+
+// Status returns status.
+func (bt *BodyTransformer) Status() interface{} {
+	return nil
+}
+
+// Close closes BodyTransformer.
+func (bt *BodyTransformer) Close() {}
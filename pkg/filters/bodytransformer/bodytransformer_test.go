@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodytransformer
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newBodyTransformer(t *testing.T, yamlConfig string) *BodyTransformer {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bt := kind.CreateInstance(spec).(*BodyTransformer)
+	bt.Init()
+	return bt
+}
+
+func TestPath(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := parsePath(`a.b\.c.0`)
+	assert.Nil(err)
+	assert.Equal(path{"a", "b.c", "0"}, p)
+
+	_, err = parsePath("a..b")
+	assert.NotNil(err)
+	_, err = parsePath("")
+	assert.NotNil(err)
+
+	var doc interface{}
+	codectool.MustUnmarshalJSON([]byte(`{"a":{"list":[1,2,3]}}`), &doc)
+
+	v, ok := path{"a", "list", "1"}.get(doc)
+	assert.True(ok)
+	assert.EqualValues(2, v)
+	_, ok = path{"a", "list", "3"}.get(doc)
+	assert.False(ok)
+
+	doc, err = path{"a", "list", "3"}.set(doc, 4)
+	assert.Nil(err)
+	doc, err = path{"x", "y"}.set(doc, "z")
+	assert.Nil(err)
+	_, err = path{"a", "list", "9"}.set(doc, 4)
+	assert.NotNil(err)
+	_, err = path{"x", "y", "z"}.set(doc, 4)
+	assert.NotNil(err)
+
+	doc, ok = path{"a", "list", "0"}.remove(doc)
+	assert.True(ok)
+	_, ok = path{"a", "missing"}.remove(doc)
+	assert.False(ok)
+
+	assert.Equal(`{"a":{"list":[2,3,4]},"x":{"y":"z"}}`, string(codectool.MustMarshalJSON(doc)))
+}
+
+func TestBodyTransformer(t *testing.T) {
+	assert := assert.New(t)
+
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: transformer
+rules:
+- mappings:
+  - from: user.fullName
+    to: user.name
+  - from: items.0.id
+    to: firstItemID
+    keep: true
+  remove: [user.password]
+  set:
+  - path: meta.source
+    value: easegress
+- when:
+    path: version
+    equals: 2
+  set:
+  - path: meta.v2
+    value: true
+- when:
+    path: legacy
+  remove: [items]
+`)
+	assert.Equal(Kind, bt.Kind().Name)
+	assert.Equal("transformer", bt.Name())
+
+	body := `{"version":2,"user":{"fullName":"Bob","password":"secret"},"items":[{"id":12345678901234567890}]}`
+	stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader(body))
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(err)
+	req.FetchPayload(0)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	assert.Equal("", bt.Handle(ctx))
+
+	want := `{"firstItemID":12345678901234567890,"items":[{"id":12345678901234567890}],` +
+		`"meta":{"source":"easegress","v2":true},"user":{"name":"Bob"},"version":2}`
+	assert.Equal(want, string(req.RawPayload()))
+	assert.Equal(strconv.Itoa(len(want)), req.HTTPHeader().Get(keyContentLength))
+
+	stdr, _ = http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("not json"))
+	req, _ = httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	assert.Equal(resultTransformFailed, bt.Handle(ctx))
+
+	newBT := kind.CreateInstance(bt.spec).(*BodyTransformer)
+	newBT.Inherit(bt)
+	assert.Nil(newBT.Status())
+	newBT.Close()
+}
+
+func TestBodyTransformerResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: transformer
+target: response
+rules:
+- when:
+    path: error
+    absent: true
+  mappings:
+  - from: data
+    to: result
+`)
+
+	ctx := context.New(nil)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetPayload([]byte(`{"data":[1,2]}`))
+	ctx.SetInputResponse(resp)
+	assert.Equal("", bt.Handle(ctx))
+	assert.Equal(`{"result":[1,2]}`, string(resp.RawPayload()))
+
+	resp.SetPayload([]byte(`{"data":[1,2],"error":"x"}`))
+	assert.Equal("", bt.Handle(ctx))
+	assert.Equal(`{"data":[1,2],"error":"x"}`, string(resp.RawPayload()))
+
+	spec := &Spec{Rules: []*Rule{{Remove: []string{"a..b"}}}}
+	assert.NotNil(spec.Validate())
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodytransformer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// path is a parsed field path, e.g. `user.addresses.0.city`, numeric
+// segments index arrays, and `\.` escapes a dot in field names.
+type path []string
+
+func parsePath(s string) (path, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var p path
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			sb.WriteByte(s[i])
+		case c == '.':
+			p = append(p, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	p = append(p, sb.String())
+
+	for _, seg := range p {
+		if seg == "" {
+			return nil, fmt.Errorf("path %s has empty segment", s)
+		}
+	}
+	return p, nil
+}
+
+func index(seg string, length int) (int, bool) {
+	i, err := strconv.Atoi(seg)
+	if err != nil || i < 0 || i >= length {
+		return 0, false
+	}
+	return i, true
+}
+
+// get returns the value at the path.
+func (p path) get(doc interface{}) (interface{}, bool) {
+	cur := doc
+	for _, seg := range p {
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			next, ok := v[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []interface{}:
+			i, ok := index(seg, len(v))
+			if !ok {
+				return nil, false
+			}
+			cur = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// set sets the value at the path, missing objects on the path are
+// created, the new document is returned as the root may be replaced.
+func (p path) set(doc interface{}, value interface{}) (interface{}, error) {
+	if len(p) == 0 {
+		return value, nil
+	}
+
+	seg := p[0]
+	switch v := doc.(type) {
+	case nil:
+		child, err := p[1:].set(nil, value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{seg: child}, nil
+	case map[string]interface{}:
+		child, err := p[1:].set(v[seg], value)
+		if err != nil {
+			return nil, err
+		}
+		v[seg] = child
+		return v, nil
+	case []interface{}:
+		// The index equal to the length appends to the array.
+		if seg == strconv.Itoa(len(v)) {
+			child, err := p[1:].set(nil, value)
+			if err != nil {
+				return nil, err
+			}
+			return append(v, child), nil
+		}
+		i, ok := index(seg, len(v))
+		if !ok {
+			return nil, fmt.Errorf("index %s out of range", seg)
+		}
+		child, err := p[1:].set(v[i], value)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = child
+		return v, nil
+	default:
+		return nil, fmt.Errorf("field %s of a non-object value", seg)
+	}
+}
+
+// remove removes the value at the path, it returns false if the value
+// doesn't exist.
+func (p path) remove(doc interface{}) (interface{}, bool) {
+	if len(p) == 0 {
+		return doc, false
+	}
+
+	parent, ok := p[:len(p)-1].get(doc)
+	if !ok {
+		return doc, false
+	}
+
+	last := p[len(p)-1]
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := v[last]; !ok {
+			return doc, false
+		}
+		delete(v, last)
+		return doc, true
+	case []interface{}:
+		i, ok := index(last, len(v))
+		if !ok {
+			return doc, false
+		}
+		arr := append(v[:i:i], v[i+1:]...)
+		if len(p) == 1 {
+			return arr, true
+		}
+		newDoc, err := p[:len(p)-1].set(doc, arr)
+		if err != nil {
+			return doc, false
+		}
+		return newDoc, true
+	default:
+		return doc, false
+	}
+}
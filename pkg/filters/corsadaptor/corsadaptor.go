@@ -19,8 +19,11 @@
 package corsadaptor
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 
 	"github.com/rs/cors"
 
@@ -58,21 +61,44 @@ type (
 	CORSAdaptor struct {
 		spec *Spec
 		cors *cors.Cors
+
+		origins       []string
+		originRegexps []*regexp.Regexp
 	}
 
 	// Spec describes of CORSAdaptor.
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
-		AllowedOrigins   []string `json:"allowedOrigins,omitempty"`
-		AllowedMethods   []string `json:"allowedMethods,omitempty" jsonschema:"uniqueItems=true,format=httpmethod-array"`
-		AllowedHeaders   []string `json:"allowedHeaders,omitempty"`
-		AllowCredentials bool     `json:"allowCredentials,omitempty"`
-		ExposedHeaders   []string `json:"exposedHeaders,omitempty"`
-		MaxAge           int      `json:"maxAge,omitempty"`
+		AllowedOrigins       []string `json:"allowedOrigins,omitempty"`
+		AllowedOriginRegexps []string `json:"allowedOriginRegexps,omitempty"`
+		AllowedMethods       []string `json:"allowedMethods,omitempty" jsonschema:"uniqueItems=true,format=httpmethod-array"`
+		AllowedHeaders       []string `json:"allowedHeaders,omitempty"`
+		AllowCredentials     bool     `json:"allowCredentials,omitempty"`
+		ExposedHeaders       []string `json:"exposedHeaders,omitempty"`
+		MaxAge               int      `json:"maxAge,omitempty"`
+		AllowPrivateNetwork  bool     `json:"allowPrivateNetwork,omitempty"`
+		OptionsSuccessStatus int      `json:"optionsSuccessStatus,omitempty" jsonschema:"minimum=200,maximum=299"`
 	}
 )
 
+// Validate validates the spec of CORSAdaptor.
+func (spec *Spec) Validate() error {
+	for _, o := range spec.AllowedOrigins {
+		if strings.Count(o, "*") > 1 {
+			return fmt.Errorf("allowed origin %q contains more than one wildcard", o)
+		}
+	}
+
+	for _, expr := range spec.AllowedOriginRegexps {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid allowed origin regexp %q: %v", expr, err)
+		}
+	}
+
+	return nil
+}
+
 // Name returns the name of the CORSAdaptor filter instance.
 func (a *CORSAdaptor) Name() string {
 	return a.spec.Name()
@@ -99,14 +125,58 @@ func (a *CORSAdaptor) Inherit(_ filters.Filter) {
 }
 
 func (a *CORSAdaptor) reload() {
-	a.cors = cors.New(cors.Options{
-		AllowedOrigins:   a.spec.AllowedOrigins,
-		AllowedMethods:   a.spec.AllowedMethods,
-		AllowedHeaders:   a.spec.AllowedHeaders,
-		AllowCredentials: a.spec.AllowCredentials,
-		ExposedHeaders:   a.spec.ExposedHeaders,
-		MaxAge:           a.spec.MaxAge,
-	})
+	opts := cors.Options{
+		AllowedOrigins:       a.spec.AllowedOrigins,
+		AllowedMethods:       a.spec.AllowedMethods,
+		AllowedHeaders:       a.spec.AllowedHeaders,
+		AllowCredentials:     a.spec.AllowCredentials,
+		ExposedHeaders:       a.spec.ExposedHeaders,
+		MaxAge:               a.spec.MaxAge,
+		AllowPrivateNetwork:  a.spec.AllowPrivateNetwork,
+		OptionsSuccessStatus: a.spec.OptionsSuccessStatus,
+	}
+
+	// rs/cors ignores AllowedOrigins once a custom origin function is set,
+	// so the allowed origins are matched by allowOrigin together with the
+	// regular expressions.
+	if len(a.spec.AllowedOriginRegexps) > 0 {
+		a.origins = nil
+		for _, o := range a.spec.AllowedOrigins {
+			a.origins = append(a.origins, strings.ToLower(o))
+		}
+
+		a.originRegexps = nil
+		for _, expr := range a.spec.AllowedOriginRegexps {
+			a.originRegexps = append(a.originRegexps, regexp.MustCompile(expr))
+		}
+
+		opts.AllowOriginFunc = a.allowOrigin
+	}
+
+	a.cors = cors.New(opts)
+}
+
+func (a *CORSAdaptor) allowOrigin(origin string) bool {
+	lower := strings.ToLower(origin)
+	for _, o := range a.origins {
+		if o == "*" || o == lower {
+			return true
+		}
+		if prefix, suffix, found := strings.Cut(o, "*"); found {
+			if len(lower) >= len(prefix)+len(suffix) &&
+				strings.HasPrefix(lower, prefix) && strings.HasSuffix(lower, suffix) {
+				return true
+			}
+		}
+	}
+
+	for _, re := range a.originRegexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Handle handles cross-origin requests.
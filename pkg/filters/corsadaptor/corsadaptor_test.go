@@ -130,4 +130,93 @@ allowedOrigins:
 			t.Error("request should be rejected")
 		}
 	})
+	t.Run("CORS origin regexps", func(t *testing.T) {
+		const yamlConfig = `
+kind: CORSAdaptor
+name: cors
+allowedOrigins:
+  - https://*.megaease.com
+allowedOriginRegexps:
+  - ^https://app-[0-9]+\.example\.com$
+`
+		rawSpec := make(map[string]interface{})
+		codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+		spec, e := filters.NewSpec(nil, "", rawSpec)
+		assert.Nil(e)
+
+		cors := kind.CreateInstance(spec)
+		cors.Init()
+
+		cases := map[string]bool{
+			"https://www.megaease.com":   true,
+			"https://app-12.example.com": true,
+			"https://app-x.example.com":  false,
+			"https://megaease.org":       false,
+		}
+		for origin, allowed := range cases {
+			ctx := context.New(nil)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			assert.Nil(err)
+			req.Header.Set("Origin", origin)
+			setRequest(t, ctx, req)
+
+			result := cors.Handle(ctx)
+			if allowed {
+				assert.Equal("", result, origin)
+				resp := ctx.GetOutputResponse().(*httpprot.Response)
+				assert.Equal(origin, resp.Header().Get("Access-Control-Allow-Origin"))
+			} else {
+				assert.Equal(resultRejected, result, origin)
+			}
+		}
+	})
+
+	t.Run("CORS private network", func(t *testing.T) {
+		const yamlConfig = `
+kind: CORSAdaptor
+name: cors
+allowPrivateNetwork: true
+optionsSuccessStatus: 200
+maxAge: 600
+`
+		rawSpec := make(map[string]interface{})
+		codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+		spec, e := filters.NewSpec(nil, "", rawSpec)
+		assert.Nil(e)
+
+		cors := kind.CreateInstance(spec)
+		cors.Init()
+
+		ctx := context.New(nil)
+		req, err := http.NewRequest(http.MethodOptions, "http://example.com", nil)
+		assert.Nil(err)
+		req.Header.Set("Origin", "http://public.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		req.Header.Set("Access-Control-Request-Private-Network", "true")
+		setRequest(t, ctx, req)
+
+		assert.Equal(resultPreflighted, cors.Handle(ctx))
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(http.StatusOK, resp.StatusCode())
+		assert.Equal("true", resp.Header().Get("Access-Control-Allow-Private-Network"))
+		assert.Equal("600", resp.Header().Get("Access-Control-Max-Age"))
+	})
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{AllowedOriginRegexps: []string{"^https://[a-z+\\.com$"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{AllowedOrigins: []string{"https://*.*.com"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{
+		AllowedOrigins:       []string{"https://*.megaease.com"},
+		AllowedOriginRegexps: []string{"^https://[a-z]+\\.com$"},
+	}
+	assert.NoError(spec.Validate())
 }
@@ -0,0 +1,369 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package csrfprotector provides CSRFProtector filter.
+package csrfprotector
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of CSRFProtector.
+	Kind = "CSRFProtector"
+
+	resultRejected = "rejected"
+
+	modeDoubleSubmit = "doubleSubmit"
+	modeSynchronizer = "synchronizer"
+
+	tokenBytes = 32
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "CSRFProtector protects browser-facing applications against cross-site request forgery.",
+	Results:     []string{resultRejected},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Mode:        modeDoubleSubmit,
+			CookieName:  "csrf_token",
+			HeaderName:  "X-CSRF-Token",
+			FormField:   "csrf_token",
+			SafeMethods: []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace},
+			SameSite:    "Lax",
+			TokenTTL:    "12h",
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &CSRFProtector{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// CSRFProtector is filter CSRFProtector.
+	CSRFProtector struct {
+		spec     *Spec
+		ttl      time.Duration
+		sameSite http.SameSite
+		store    tokenStore
+	}
+
+	// Spec describes the CSRFProtector.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Mode        string                      `json:"mode,omitempty" jsonschema:"enum=doubleSubmit,enum=synchronizer"`
+		SafeMethods []string                    `json:"safeMethods,omitempty" jsonschema:"uniqueItems=true,format=httpmethod-array"`
+		ExemptPaths []*stringtool.StringMatcher `json:"exemptPaths,omitempty"`
+		HeaderName  string                      `json:"headerName,omitempty"`
+		FormField   string                      `json:"formField,omitempty"`
+
+		// CookieName is the cookie of the token in the double submit cookie
+		// pattern.
+		CookieName   string `json:"cookieName,omitempty"`
+		CookiePath   string `json:"cookiePath,omitempty"`
+		CookieDomain string `json:"cookieDomain,omitempty"`
+		SecureCookie bool   `json:"secureCookie,omitempty"`
+		SameSite     string `json:"sameSite,omitempty" jsonschema:"enum=Lax,enum=Strict,enum=None"`
+		// Secret signs the tokens in the double submit cookie pattern, so
+		// that cookies planted by other sites, e.g. subdomains, are rejected.
+		Secret string `json:"secret,omitempty" jsonschema:"writeOnly=true"`
+
+		// SessionCookie is the cookie of the application session in the
+		// synchronizer token pattern, tokens are bound to the sessions.
+		SessionCookie string `json:"sessionCookie,omitempty"`
+		TokenTTL      string `json:"tokenTTL,omitempty" jsonschema:"format=duration"`
+	}
+)
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	if s.Mode == modeSynchronizer && s.SessionCookie == "" {
+		return fmt.Errorf("sessionCookie is required in synchronizer mode")
+	}
+	if s.HeaderName == "" && s.FormField == "" {
+		return fmt.Errorf("headerName or formField is required")
+	}
+	for i, p := range s.ExemptPaths {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("exemptPaths %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the CSRFProtector filter instance.
+func (cp *CSRFProtector) Name() string {
+	return cp.spec.Name()
+}
+
+// Kind returns the kind of CSRFProtector.
+func (cp *CSRFProtector) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the CSRFProtector
+func (cp *CSRFProtector) Spec() filters.Spec {
+	return cp.spec
+}
+
+// Init initializes CSRFProtector.
+func (cp *CSRFProtector) Init() {
+	cp.reload()
+}
+
+// Inherit inherits previous generation of CSRFProtector, the tokens in
+// memory are kept.
+func (cp *CSRFProtector) Inherit(previousGeneration filters.Filter) {
+	cp.reload()
+	prev, ok := previousGeneration.(*CSRFProtector).store.(*memoryStore)
+	if _, isMemory := cp.store.(*memoryStore); ok && isMemory {
+		cp.store = prev
+	}
+}
+
+func (cp *CSRFProtector) reload() {
+	for _, p := range cp.spec.ExemptPaths {
+		p.Init()
+	}
+
+	ttl, err := time.ParseDuration(cp.spec.TokenTTL)
+	if err != nil || ttl <= 0 {
+		ttl = 12 * time.Hour
+	}
+	cp.ttl = ttl
+
+	switch cp.spec.SameSite {
+	case "Strict":
+		cp.sameSite = http.SameSiteStrictMode
+	case "None":
+		cp.sameSite = http.SameSiteNoneMode
+	default:
+		cp.sameSite = http.SameSiteLaxMode
+	}
+
+	if super := cp.spec.Super(); super != nil && super.Cluster() != nil {
+		cp.store = &clusterStore{
+			cls:      super.Cluster(),
+			pipeline: cp.spec.Pipeline(),
+			name:     cp.spec.Name(),
+		}
+	} else {
+		cp.store = newMemoryStore()
+	}
+}
+
+func (cp *CSRFProtector) exempted(req *httpprot.Request) bool {
+	if stringtool.StrInSlice(req.Method(), cp.spec.SafeMethods) {
+		return true
+	}
+	for _, p := range cp.spec.ExemptPaths {
+		if p.Match(req.Path()) {
+			return true
+		}
+	}
+	return false
+}
+
+func newToken() string {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		logger.Errorf("BUG: generate csrf token failed: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (cp *CSRFProtector) sign(token string) string {
+	mac := hmac.New(sha256.New, []byte(cp.spec.Secret))
+	mac.Write([]byte(token))
+	return token + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validCookieToken checks the signature of the token in the cookie.
+func (cp *CSRFProtector) validCookieToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	if cp.spec.Secret == "" {
+		return true
+	}
+	i := strings.LastIndexByte(token, '.')
+	return i > 0 && hmac.Equal([]byte(cp.sign(token[:i])), []byte(token))
+}
+
+// submittedToken returns the token in the header, or in the form field of
+// url encoded bodies.
+func (cp *CSRFProtector) submittedToken(req *httpprot.Request) string {
+	if cp.spec.HeaderName != "" {
+		if token := req.HTTPHeader().Get(cp.spec.HeaderName); token != "" {
+			return token
+		}
+	}
+
+	if cp.spec.FormField == "" || req.IsStream() {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.HTTPHeader().Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" {
+		return ""
+	}
+	form, err := url.ParseQuery(string(req.RawPayload()))
+	if err != nil {
+		return ""
+	}
+	return form.Get(cp.spec.FormField)
+}
+
+func outputResponse(ctx *context.Context) *httpprot.Response {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+		ctx.SetOutputResponse(resp)
+	}
+	return resp
+}
+
+func reject(ctx *context.Context, reason string) string {
+	resp := outputResponse(ctx)
+	resp.SetStatusCode(http.StatusForbidden)
+	resp.SetPayload([]byte("CSRF token " + reason))
+	ctx.AddTag("csrf: " + reason)
+	return resultRejected
+}
+
+func sameToken(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// Handle verifies the CSRF token of unsafe requests, and issues tokens to
+// the clients which don't have one.
+func (cp *CSRFProtector) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if cp.spec.Mode == modeSynchronizer {
+		return cp.handleSynchronizer(ctx, req)
+	}
+	return cp.handleDoubleSubmit(ctx, req)
+}
+
+func (cp *CSRFProtector) handleDoubleSubmit(ctx *context.Context, req *httpprot.Request) string {
+	var token string
+	if c, err := req.Cookie(cp.spec.CookieName); err == nil && cp.validCookieToken(c.Value) {
+		token = c.Value
+	}
+
+	if !cp.exempted(req) {
+		if token == "" {
+			return reject(ctx, "cookie missing")
+		}
+		if !sameToken(cp.submittedToken(req), token) {
+			return reject(ctx, "mismatch")
+		}
+		return ""
+	}
+
+	if token == "" {
+		token = newToken()
+		if cp.spec.Secret != "" {
+			token = cp.sign(token)
+		}
+
+		// The cookie is readable by scripts, which submit it in the header.
+		cookie := &http.Cookie{
+			Name:     cp.spec.CookieName,
+			Value:    token,
+			Path:     cp.spec.CookiePath,
+			Domain:   cp.spec.CookieDomain,
+			MaxAge:   int(cp.ttl.Seconds()),
+			Secure:   cp.spec.SecureCookie,
+			SameSite: cp.sameSite,
+		}
+		if cookie.Path == "" {
+			cookie.Path = "/"
+		}
+		outputResponse(ctx).HTTPHeader().Add("Set-Cookie", cookie.String())
+	}
+
+	cp.exposeToken(ctx, req, token)
+	return ""
+}
+
+func (cp *CSRFProtector) handleSynchronizer(ctx *context.Context, req *httpprot.Request) string {
+	var session string
+	if c, err := req.Cookie(cp.spec.SessionCookie); err == nil {
+		session = c.Value
+	}
+
+	if !cp.exempted(req) {
+		if session == "" {
+			return reject(ctx, "session missing")
+		}
+		if !sameToken(cp.submittedToken(req), cp.store.get(session)) {
+			return reject(ctx, "mismatch")
+		}
+		return ""
+	}
+
+	// No session, no token to protect it.
+	if session == "" {
+		return ""
+	}
+
+	token := cp.store.get(session)
+	if token == "" {
+		token = newToken()
+		cp.store.put(session, token, cp.ttl)
+	}
+	cp.exposeToken(ctx, req, token)
+	return ""
+}
+
+// exposeToken passes the token to the backend, which may render it into the
+// forms, and to the client, whose scripts may submit it in the header.
+func (cp *CSRFProtector) exposeToken(ctx *context.Context, req *httpprot.Request, token string) {
+	if cp.spec.HeaderName == "" {
+		return
+	}
+	req.HTTPHeader().Set(cp.spec.HeaderName, token)
+	outputResponse(ctx).HTTPHeader().Set(cp.spec.HeaderName, token)
+}
+
+// Status returns status.
+func (cp *CSRFProtector) Status() interface{} { return nil }
+
+// Close closes CSRFProtector.
+func (cp *CSRFProtector) Close() {}
@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package csrfprotector
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newCSRFProtector(t *testing.T, yamlConfig string) *CSRFProtector {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cp := kind.CreateInstance(spec).(*CSRFProtector)
+	cp.Init()
+	return cp
+}
+
+type testRequest struct {
+	method  string
+	path    string
+	body    string
+	header  map[string]string
+	cookies map[string]string
+}
+
+func handle(cp *CSRFProtector, tr *testRequest) (string, *httpprot.Request, *httpprot.Response) {
+	stdr, _ := http.NewRequest(tr.method, "http://example.com"+tr.path, strings.NewReader(tr.body))
+	for k, v := range tr.header {
+		stdr.Header.Set(k, v)
+	}
+	for k, v := range tr.cookies {
+		stdr.AddCookie(&http.Cookie{Name: k, Value: v})
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	result := cp.Handle(ctx)
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	return result, req, resp
+}
+
+func responseCookie(resp *httpprot.Response, name string) *http.Cookie {
+	for _, c := range (&http.Response{Header: resp.HTTPHeader()}).Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestDoubleSubmit(t *testing.T) {
+	assert := assert.New(t)
+
+	cp := newCSRFProtector(t, `
+name: csrf
+kind: CSRFProtector
+secret: my-secret
+secureCookie: true
+exemptPaths:
+- prefix: /webhooks/
+`)
+
+	// a safe request gets the token
+	result, req, resp := handle(cp, &testRequest{method: http.MethodGet, path: "/form"})
+	assert.Equal("", result)
+	cookie := responseCookie(resp, "csrf_token")
+	assert.NotNil(cookie)
+	assert.True(cookie.Secure)
+	assert.False(cookie.HttpOnly)
+	assert.Equal(http.SameSiteLaxMode, cookie.SameSite)
+	token := cookie.Value
+	assert.Equal(token, req.HTTPHeader().Get("X-CSRF-Token"))
+	assert.Equal(token, resp.HTTPHeader().Get("X-CSRF-Token"))
+
+	// the token is reused
+	result, _, resp = handle(cp, &testRequest{method: http.MethodGet, path: "/form", cookies: map[string]string{"csrf_token": token}})
+	assert.Equal("", result)
+	assert.Nil(responseCookie(resp, "csrf_token"))
+
+	cookies := map[string]string{"csrf_token": token}
+	result, _, _ = handle(cp, &testRequest{method: http.MethodPost, path: "/submit", cookies: cookies, header: map[string]string{"X-CSRF-Token": token}})
+	assert.Equal("", result)
+
+	result, _, _ = handle(cp, &testRequest{
+		method:  http.MethodPost,
+		path:    "/submit",
+		cookies: cookies,
+		header:  map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+		body:    "name=x&csrf_token=" + token,
+	})
+	assert.Equal("", result)
+
+	// missing or mismatched tokens
+	result, _, resp = handle(cp, &testRequest{method: http.MethodPost, path: "/submit", cookies: cookies})
+	assert.Equal(resultRejected, result)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+	result, _, _ = handle(cp, &testRequest{method: http.MethodDelete, path: "/submit", header: map[string]string{"X-CSRF-Token": token}})
+	assert.Equal(resultRejected, result)
+
+	// planted cookie without a valid signature
+	result, _, _ = handle(cp, &testRequest{
+		method:  http.MethodPost,
+		path:    "/submit",
+		cookies: map[string]string{"csrf_token": "planted.sig"},
+		header:  map[string]string{"X-CSRF-Token": "planted.sig"},
+	})
+	assert.Equal(resultRejected, result)
+
+	// exempted path
+	result, _, _ = handle(cp, &testRequest{method: http.MethodPost, path: "/webhooks/github"})
+	assert.Equal("", result)
+}
+
+func TestSynchronizer(t *testing.T) {
+	assert := assert.New(t)
+
+	cp := newCSRFProtector(t, `
+name: csrf
+kind: CSRFProtector
+mode: synchronizer
+sessionCookie: SESSIONID
+tokenTTL: 1h
+`)
+
+	// no session, nothing to protect
+	result, req, _ := handle(cp, &testRequest{method: http.MethodGet, path: "/"})
+	assert.Equal("", result)
+	assert.Equal("", req.HTTPHeader().Get("X-CSRF-Token"))
+
+	session := map[string]string{"SESSIONID": "s1"}
+	result, req, resp := handle(cp, &testRequest{method: http.MethodGet, path: "/form", cookies: session})
+	assert.Equal("", result)
+	token := req.HTTPHeader().Get("X-CSRF-Token")
+	assert.NotEmpty(token)
+	assert.Equal(token, resp.HTTPHeader().Get("X-CSRF-Token"))
+	assert.Nil(responseCookie(resp, "csrf_token"))
+
+	_, req, _ = handle(cp, &testRequest{method: http.MethodGet, path: "/form", cookies: session})
+	assert.Equal(token, req.HTTPHeader().Get("X-CSRF-Token"))
+
+	result, _, _ = handle(cp, &testRequest{method: http.MethodPut, path: "/submit", cookies: session, header: map[string]string{"X-CSRF-Token": token}})
+	assert.Equal("", result)
+
+	// the token of another session
+	result, _, _ = handle(cp, &testRequest{method: http.MethodPut, path: "/submit", cookies: map[string]string{"SESSIONID": "s2"}, header: map[string]string{"X-CSRF-Token": token}})
+	assert.Equal(resultRejected, result)
+	result, _, _ = handle(cp, &testRequest{method: http.MethodPut, path: "/submit", header: map[string]string{"X-CSRF-Token": token}})
+	assert.Equal(resultRejected, result)
+
+	// tokens survive reloads
+	cp2 := newCSRFProtector(t, `
+name: csrf
+kind: CSRFProtector
+mode: synchronizer
+sessionCookie: SESSIONID
+`)
+	cp2.Inherit(cp)
+	result, _, _ = handle(cp2, &testRequest{method: http.MethodPut, path: "/submit", cookies: session, header: map[string]string{"X-CSRF-Token": token}})
+	assert.Equal("", result)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Mode: modeSynchronizer, HeaderName: "X-CSRF-Token"}
+	assert.NotNil(spec.Validate())
+	spec.SessionCookie = "SESSIONID"
+	assert.Nil(spec.Validate())
+	spec.HeaderName = ""
+	assert.NotNil(spec.Validate())
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package csrfprotector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+type (
+	// tokenStore keeps the tokens of the sessions for the synchronizer
+	// token pattern.
+	tokenStore interface {
+		get(session string) string
+		put(session, token string, ttl time.Duration)
+	}
+
+	// memoryStore is used if the cluster is not available.
+	memoryStore struct {
+		mutex   sync.Mutex
+		tokens  map[string]*memoryToken
+		nextGC  time.Time
+		gcEvery time.Duration
+	}
+
+	memoryToken struct {
+		token   string
+		expires time.Time
+	}
+
+	// clusterStore shares the tokens among the cluster members.
+	clusterStore struct {
+		cls      cluster.Cluster
+		pipeline string
+		name     string
+	}
+)
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		tokens:  map[string]*memoryToken{},
+		gcEvery: time.Minute,
+	}
+}
+
+func (ms *memoryStore) get(session string) string {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	t := ms.tokens[session]
+	if t == nil || time.Now().After(t.expires) {
+		return ""
+	}
+	return t.token
+}
+
+func (ms *memoryStore) put(session, token string, ttl time.Duration) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	now := time.Now()
+	if now.After(ms.nextGC) {
+		for k, t := range ms.tokens {
+			if now.After(t.expires) {
+				delete(ms.tokens, k)
+			}
+		}
+		ms.nextGC = now.Add(ms.gcEvery)
+	}
+
+	ms.tokens[session] = &memoryToken{token: token, expires: now.Add(ttl)}
+}
+
+func (cs *clusterStore) key(session string) string {
+	// Sessions are hashed to keep them secret in the cluster.
+	sum := sha256.Sum256([]byte(session))
+	return cs.cls.Layout().CSRFTokenKey(cs.pipeline, cs.name, hex.EncodeToString(sum[:]))
+}
+
+func (cs *clusterStore) get(session string) string {
+	value, err := cs.cls.Get(cs.key(session))
+	if err != nil {
+		logger.Errorf("get csrf token failed: %v", err)
+		return ""
+	}
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func (cs *clusterStore) put(session, token string, ttl time.Duration) {
+	if err := cs.cls.PutUnderTimeout(cs.key(session), token, ttl); err != nil {
+		logger.Errorf("put csrf token failed: %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package datamasker provides the DataMasker filter.
+package datamasker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/redact"
+)
+
+const (
+	// Kind is the kind of DataMasker.
+	Kind = "DataMasker"
+
+	targetRequest  = "request"
+	targetResponse = "response"
+
+	actionMask     = "mask"
+	actionTokenize = "tokenize"
+
+	defaultMask = "***"
+
+	// wildcard matches all the elements of an array or all the fields
+	// of an object in a field path.
+	wildcard = "*"
+
+	keyContentLength   = "Content-Length"
+	keyContentEncoding = "Content-Encoding"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "DataMasker masks or tokenizes sensitive data in the request or the response.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{Target: targetRequest, Action: actionMask}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &DataMasker{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// DataMasker is filter DataMasker.
+	DataMasker struct {
+		spec *Spec
+
+		headers []string
+		fields  [][]string
+		matcher *redact.Matcher
+		key     []byte
+		replace redact.Replacer
+	}
+
+	// Spec describes the DataMasker.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Target string `json:"target,omitempty" jsonschema:"enum=request,enum=response"`
+		// Headers are the names of headers whose values are masked.
+		Headers []string `json:"headers,omitempty"`
+		// Fields are the paths of the fields of the JSON body whose values
+		// are masked, like `user.cards.*.number`.
+		Fields []string `json:"fields,omitempty"`
+		// Patterns are the regular expressions of the data masked in the
+		// body.
+		Patterns []string `json:"patterns,omitempty"`
+		// Builtins are the builtin patterns of the data masked in the body.
+		Builtins []string `json:"builtins,omitempty" jsonschema:"uniqueItems=true,enum=creditCard,enum=email,enum=ssn"`
+
+		Action string `json:"action,omitempty" jsonschema:"enum=mask,enum=tokenize"`
+		Mask   string `json:"mask,omitempty"`
+		// TokenKey is the key to generate tokens, a random key is used if
+		// it is empty.
+		TokenKey string `json:"tokenKey,omitempty"`
+	}
+)
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	if len(s.Headers) == 0 && len(s.Fields) == 0 && len(s.Patterns) == 0 && len(s.Builtins) == 0 {
+		return fmt.Errorf("nothing to mask")
+	}
+	for _, f := range s.Fields {
+		if _, err := parseField(f); err != nil {
+			return err
+		}
+	}
+	if _, err := redact.NewMatcher(s.Patterns, s.Builtins); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseField parses a field path, which is separated by dots.
+func parseField(s string) ([]string, error) {
+	segs := strings.Split(s, ".")
+	for _, seg := range segs {
+		if seg == "" {
+			return nil, fmt.Errorf("field %s has empty segment", s)
+		}
+	}
+	return segs, nil
+}
+
+// Name returns the name of the DataMasker filter instance.
+func (dm *DataMasker) Name() string {
+	return dm.spec.Name()
+}
+
+// Kind returns the kind of DataMasker.
+func (dm *DataMasker) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the DataMasker.
+func (dm *DataMasker) Spec() filters.Spec {
+	return dm.spec
+}
+
+// Init initializes DataMasker.
+func (dm *DataMasker) Init() {
+	dm.reload(nil)
+}
+
+// Inherit inherits previous generation of DataMasker.
+func (dm *DataMasker) Inherit(previousGeneration filters.Filter) {
+	// The random key is inherited to keep the tokens unchanged.
+	dm.reload(previousGeneration.(*DataMasker).key)
+}
+
+func (dm *DataMasker) reload(key []byte) {
+	dm.headers = nil
+	for _, h := range dm.spec.Headers {
+		dm.headers = append(dm.headers, http.CanonicalHeaderKey(h))
+	}
+
+	dm.fields = nil
+	for _, f := range dm.spec.Fields {
+		segs, _ := parseField(f)
+		dm.fields = append(dm.fields, segs)
+	}
+
+	matcher, err := redact.NewMatcher(dm.spec.Patterns, dm.spec.Builtins)
+	if err != nil {
+		logger.Errorf("BUG: create matcher failed: %v", err)
+	}
+	dm.matcher = matcher
+
+	if dm.spec.Action != actionTokenize {
+		mask := dm.spec.Mask
+		if mask == "" {
+			mask = defaultMask
+		}
+		dm.replace = redact.Mask(mask)
+		return
+	}
+
+	switch {
+	case dm.spec.TokenKey != "":
+		dm.key = []byte(dm.spec.TokenKey)
+	case key != nil:
+		dm.key = key
+	default:
+		dm.key = make([]byte, 32)
+		rand.Read(dm.key)
+	}
+	dm.replace = redact.Tokenize(dm.key)
+}
+
+// maskField masks the values at the path in the document, the new
+// document is returned as the root may be replaced.
+func (dm *DataMasker) maskField(doc interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		switch v := doc.(type) {
+		case nil:
+			return nil
+		case string:
+			return dm.replace(v)
+		default:
+			return dm.replace(string(codectool.MustMarshalJSON(v)))
+		}
+	}
+
+	seg := path[0]
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if seg == wildcard {
+			for k, child := range v {
+				v[k] = dm.maskField(child, path[1:])
+			}
+		} else if child, ok := v[seg]; ok {
+			v[seg] = dm.maskField(child, path[1:])
+		}
+	case []interface{}:
+		if seg == wildcard {
+			for i, child := range v {
+				v[i] = dm.maskField(child, path[1:])
+			}
+		} else if i, err := strconv.Atoi(seg); err == nil && i >= 0 && i < len(v) {
+			v[i] = dm.maskField(v[i], path[1:])
+		}
+	}
+	return doc
+}
+
+// maskBody masks the body, the second return value is false if the body
+// is not changed.
+func (dm *DataMasker) maskBody(body []byte) ([]byte, bool) {
+	result := body
+
+	if len(dm.fields) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+
+		// Fields are not masked if the body is not JSON.
+		var doc interface{}
+		if err := decoder.Decode(&doc); err == nil {
+			for _, path := range dm.fields {
+				doc = dm.maskField(doc, path)
+			}
+			if data, err := json.Marshal(doc); err == nil {
+				result = data
+			}
+		}
+	}
+
+	if dm.matcher != nil {
+		result = []byte(dm.matcher.Replace(string(result), dm.replace))
+	}
+
+	return result, !bytes.Equal(result, body)
+}
+
+// Handle masks the headers and the body of the request or the response.
+func (dm *DataMasker) Handle(ctx *context.Context) string {
+	var msg interface {
+		IsStream() bool
+		RawPayload() []byte
+		SetPayload(interface{})
+		HTTPHeader() http.Header
+	}
+
+	if dm.spec.Target == targetResponse {
+		resp, ok := ctx.GetInputResponse().(*httpprot.Response)
+		if !ok || resp == nil {
+			return ""
+		}
+		msg = resp
+	} else {
+		msg = ctx.GetInputRequest().(*httpprot.Request)
+	}
+
+	header := msg.HTTPHeader()
+	for _, key := range dm.headers {
+		values := header[key]
+		for i, v := range values {
+			values[i] = dm.replace(v)
+		}
+	}
+
+	// Compressed bodies are not masked.
+	if msg.IsStream() || len(msg.RawPayload()) == 0 || header.Get(keyContentEncoding) != "" {
+		return ""
+	}
+
+	if len(dm.fields) == 0 && dm.matcher == nil {
+		return ""
+	}
+
+	data, changed := dm.maskBody(msg.RawPayload())
+	if !changed {
+		return ""
+	}
+
+	msg.SetPayload(data)
+	header.Set(keyContentLength, strconv.Itoa(len(data)))
+	return ""
+}
+
+// Status returns status.
+func (dm *DataMasker) Status() interface{} {
+	return nil
+}
+
+// Close closes DataMasker.
+func (dm *DataMasker) Close() {}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package datamasker
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newDataMasker(t *testing.T, yamlConfig string) *DataMasker {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dm := kind.CreateInstance(spec).(*DataMasker)
+	dm.Init()
+	return dm
+}
+
+func TestDataMasker(t *testing.T) {
+	assert := assert.New(t)
+
+	dm := newDataMasker(t, `
+kind: DataMasker
+name: masker
+headers: [x-card]
+fields: [user.password, user.cards.*.cvv, age]
+builtins: [creditCard]
+`)
+	assert.Equal(Kind, dm.Kind().Name)
+	assert.Equal("masker", dm.Name())
+
+	body := `{"age":30,"user":{"password":"secret","cards":[{"number":"4111 1111 1111 1111","cvv":"123"},{"cvv":456}]}}`
+	stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader(body))
+	stdr.Header.Set("X-Card", "4111111111111111")
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(err)
+	req.FetchPayload(0)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	assert.Equal("", dm.Handle(ctx))
+
+	want := `{"age":"***","user":{"cards":[{"cvv":"***","number":"***"},{"cvv":"***"}],"password":"***"}}`
+	assert.Equal(want, string(req.RawPayload()))
+	assert.Equal(strconv.Itoa(len(want)), req.HTTPHeader().Get(keyContentLength))
+	assert.Equal("***", req.HTTPHeader().Get("X-Card"))
+
+	// patterns are still masked in non-JSON bodies.
+	stdr, _ = http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("card=4111111111111111"))
+	req, _ = httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	assert.Equal("", dm.Handle(ctx))
+	assert.Equal("card=***", string(req.RawPayload()))
+
+	newDM := kind.CreateInstance(dm.spec).(*DataMasker)
+	newDM.Inherit(dm)
+	assert.Nil(newDM.Status())
+	newDM.Close()
+}
+
+func TestDataMaskerTokenize(t *testing.T) {
+	assert := assert.New(t)
+
+	dm := newDataMasker(t, `
+kind: DataMasker
+name: masker
+target: response
+action: tokenize
+builtins: [email]
+`)
+
+	ctx := context.New(nil)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetPayload([]byte(`contact: bob@example.com, bob@example.com, alice@example.com`))
+	ctx.SetInputResponse(resp)
+	assert.Equal("", dm.Handle(ctx))
+
+	tokens := strings.Split(strings.TrimPrefix(string(resp.RawPayload()), "contact: "), ", ")
+	assert.Len(tokens, 3)
+	assert.True(strings.HasPrefix(tokens[0], "tok_"))
+	assert.Equal(tokens[0], tokens[1])
+	assert.NotEqual(tokens[0], tokens[2])
+
+	// the random key is inherited, so the tokens are unchanged.
+	newDM := kind.CreateInstance(dm.spec).(*DataMasker)
+	newDM.Inherit(dm)
+	resp.SetPayload([]byte(`bob@example.com`))
+	assert.Equal("", newDM.Handle(ctx))
+	assert.Equal(tokens[0], string(resp.RawPayload()))
+
+	spec := &Spec{}
+	assert.NotNil(spec.Validate())
+	spec = &Spec{Fields: []string{"a..b"}}
+	assert.NotNil(spec.Validate())
+	spec = &Spec{Patterns: []string{"[a-"}}
+	assert.NotNil(spec.Validate())
+}
@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package experimenter provides the Experimenter filter.
+package experimenter
+
+import (
+	stdcontext "context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/experiment"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of Experimenter.
+	Kind = "Experimenter"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Experimenter assigns requests to the variants of A/B testing experiments.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Experimenter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Experimenter is filter Experimenter.
+	Experimenter struct {
+		spec *Spec
+
+		experiments atomic.Pointer[[]*experiment.Experiment]
+
+		cluster cluster.Cluster
+		stopCtx stdcontext.Context
+		cancel  stdcontext.CancelFunc
+	}
+
+	// Spec describes the Experimenter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Experiments are the names of experiments to run, empty means
+		// all experiments.
+		Experiments []string `json:"experiments,omitempty" jsonschema:"uniqueItems=true"`
+	}
+
+	// Status is the status of Experimenter.
+	Status struct {
+		// Experiments are the metrics of the variants of the running
+		// experiments in this member.
+		Experiments map[string]map[string]*experiment.VariantMetrics `json:"experiments"`
+	}
+
+	assignment struct {
+		experiment string
+		variant    string
+	}
+)
+
+// Name returns the name of the Experimenter filter instance.
+func (e *Experimenter) Name() string {
+	return e.spec.Name()
+}
+
+// Kind returns the kind of Experimenter.
+func (e *Experimenter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Experimenter.
+func (e *Experimenter) Spec() filters.Spec {
+	return e.spec
+}
+
+// Init initializes Experimenter.
+func (e *Experimenter) Init() {
+	e.reload()
+}
+
+// Inherit inherits previous generation of Experimenter.
+func (e *Experimenter) Inherit(previousGeneration filters.Filter) {
+	e.reload()
+	e.experiments.Store(previousGeneration.(*Experimenter).experiments.Load())
+}
+
+func (e *Experimenter) reload() {
+	e.stopCtx, e.cancel = stdcontext.WithCancel(stdcontext.Background())
+	if e.spec.Super() == nil || e.spec.Super().Cluster() == nil {
+		logger.Errorf("%s: no cluster to watch the experiments", e.Name())
+		return
+	}
+	e.cluster = e.spec.Super().Cluster()
+	go e.watchExperiments()
+}
+
+func (e *Experimenter) watchExperiments() {
+	var (
+		syncer cluster.Syncer
+		err    error
+		ch     <-chan map[string]string
+	)
+
+	prefix := e.cluster.Layout().ExperimentPrefix()
+	for {
+		syncer, err = e.cluster.Syncer(time.Minute)
+		if err != nil {
+			logger.Errorf("failed to create syncer: %v", err)
+		} else if ch, err = syncer.SyncPrefix(prefix); err != nil {
+			logger.Errorf("failed to sync prefix: %v", err)
+			syncer.Close()
+		} else {
+			break
+		}
+
+		select {
+		case <-time.After(10 * time.Second):
+		case <-e.stopCtx.Done():
+			return
+		}
+	}
+
+	defer syncer.Close()
+
+	for {
+		select {
+		case <-e.stopCtx.Done():
+			return
+		case kvs := <-ch:
+			logger.Infof("%s: experiments updated", e.Name())
+			e.updateExperiments(kvs)
+		}
+	}
+}
+
+// updateExperiments updates the running experiments, the experiments are
+// sorted by name so that the headers are set in a stable order.
+func (e *Experimenter) updateExperiments(kvs map[string]string) {
+	exps := make([]*experiment.Experiment, 0, len(kvs))
+	for key, value := range kvs {
+		exp := &experiment.Experiment{}
+		if err := codectool.Unmarshal([]byte(value), exp); err != nil {
+			logger.Warnf("%s: invalid experiment %s: %v", e.Name(), key, err)
+			continue
+		}
+		if err := exp.Validate(); err != nil {
+			logger.Warnf("%s: invalid experiment %s: %v", e.Name(), key, err)
+			continue
+		}
+		if len(e.spec.Experiments) > 0 && !stringtool.StrInSlice(exp.Name, e.spec.Experiments) {
+			continue
+		}
+		exp.Init()
+		exps = append(exps, exp)
+	}
+
+	sort.Slice(exps, func(i, j int) bool {
+		return exps[i].Name < exps[j].Name
+	})
+	e.experiments.Store(&exps)
+}
+
+// Handle assigns the request to the variants of the experiments, and sets
+// the variants to the request headers. The metrics of the variants are
+// recorded when the request finishes.
+func (e *Experimenter) Handle(ctx *context.Context) string {
+	exps := e.experiments.Load()
+	if exps == nil {
+		return ""
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	var assignments []assignment
+	for _, exp := range *exps {
+		// the header is removed if the request is not in the experiment,
+		// so that clients cannot choose a variant.
+		variant := exp.Assign(req)
+		if variant == "" {
+			req.HTTPHeader().Del(exp.Header)
+			continue
+		}
+		req.HTTPHeader().Set(exp.Header, variant)
+		assignments = append(assignments, assignment{exp.Name, variant})
+	}
+
+	if len(assignments) == 0 {
+		return ""
+	}
+
+	start := time.Now()
+	ctx.OnFinish(func() {
+		code := 0
+		if resp, ok := ctx.GetOutputResponse().(*httpprot.Response); ok {
+			code = resp.StatusCode()
+		}
+		latency := time.Since(start)
+		for _, a := range assignments {
+			experiment.Record(a.experiment, a.variant, code, latency)
+		}
+	})
+	return ""
+}
+
+// Status returns status.
+func (e *Experimenter) Status() interface{} {
+	s := &Status{Experiments: map[string]map[string]*experiment.VariantMetrics{}}
+	if exps := e.experiments.Load(); exps != nil {
+		for _, exp := range *exps {
+			s.Experiments[exp.Name] = experiment.Metrics(exp.Name)
+		}
+	}
+	return s
+}
+
+// Close closes Experimenter.
+func (e *Experimenter) Close() {
+	e.cancel()
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package experimenter
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/experiment"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newExperimenter(t *testing.T, yamlConfig string) *Experimenter {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	e := kind.CreateInstance(spec).(*Experimenter)
+	e.Init()
+	return e
+}
+
+func newContext(t *testing.T, header http.Header) (*context.Context, *httpprot.Request) {
+	ctx := context.New(nil)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+	ctx.SetInputRequest(req)
+
+	return ctx, req
+}
+
+func TestExperimenter(t *testing.T) {
+	assert := assert.New(t)
+
+	e := newExperimenter(t, `
+kind: Experimenter
+name: experimenter
+experiments: [search, invalid]
+`)
+	defer e.Close()
+	assert.Equal(Kind, e.Kind().Name)
+	assert.Equal("experimenter", e.Name())
+
+	// no experiments yet.
+	ctx, _ := newContext(t, nil)
+	assert.Equal("", e.Handle(ctx))
+
+	e.updateExperiments(map[string]string{
+		"/experiments/search":  `{"name": "search", "header": "X-Search", "variants": [{"name": "new", "weight": 1}]}`,
+		"/experiments/other":   `{"name": "other", "variants": [{"name": "a", "weight": 1}]}`,
+		"/experiments/invalid": `{"name": "invalid", "variants": []}`,
+	})
+	assert.Len(*e.experiments.Load(), 1)
+
+	// the variant header is overwritten.
+	ctx, req := newContext(t, http.Header{"X-Search": []string{"fake"}})
+	assert.Equal("", e.Handle(ctx))
+	assert.Equal("new", req.HTTPHeader().Get("X-Search"))
+	assert.Empty(req.HTTPHeader().Get("X-Experiment-other"))
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusInternalServerError)
+	ctx.SetOutputResponse(resp)
+	ctx.Finish()
+
+	status := e.Status().(*Status)
+	m := status.Experiments["search"]["new"]
+	assert.Equal(uint64(1), m.Requests)
+	assert.Equal(uint64(1), m.Errors)
+	experiment.ResetMetrics("search")
+
+	// the experiments are inherited until the new generation syncs them.
+	e2 := newExperimenter(t, `
+kind: Experimenter
+name: experimenter
+`)
+	e2.Inherit(e)
+	defer e2.Close()
+	assert.Len(*e2.experiments.Load(), 1)
+}
@@ -0,0 +1,400 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package extauthz provides the ExtAuthz filter.
+package extauthz
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of ExtAuthz.
+	Kind = "ExtAuthz"
+
+	resultDenied = "denied"
+	resultFailed = "failed"
+
+	protocolHTTP = "http"
+	protocolGRPC = "grpc"
+
+	failureModeOpen   = "open"
+	failureModeClosed = "closed"
+
+	defaultTimeout         = 200 * time.Millisecond
+	defaultCacheTTL        = 10 * time.Second
+	defaultCacheMaxEntries = 1024
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ExtAuthz authorizes requests by an external authorization service.",
+	Results:     []string{resultDenied, resultFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Protocol:      protocolHTTP,
+			FailureMode:   failureModeClosed,
+			StatusOnError: http.StatusForbidden,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ExtAuthz{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ExtAuthz is filter ExtAuthz.
+	ExtAuthz struct {
+		spec *Spec
+
+		authorizer authorizer
+		timeout    time.Duration
+		cache      *lru.Cache
+		cacheTTL   time.Duration
+
+		allowed   uint64
+		denied    uint64
+		failed    uint64
+		cacheHits uint64
+	}
+
+	// Spec describes the ExtAuthz.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Protocol        string     `json:"protocol,omitempty" jsonschema:"enum=http,enum=grpc"`
+		URL             string     `json:"url,omitempty"`
+		Address         string     `json:"address,omitempty"`
+		Timeout         string     `json:"timeout,omitempty" jsonschema:"format=duration"`
+		AllowedHeaders  []string   `json:"allowedHeaders,omitempty" jsonschema:"uniqueItems=true"`
+		UpstreamHeaders []string   `json:"upstreamHeaders,omitempty" jsonschema:"uniqueItems=true"`
+		FailureMode     string     `json:"failureMode,omitempty" jsonschema:"enum=open,enum=closed"`
+		StatusOnError   int        `json:"statusOnError,omitempty" jsonschema:"minimum=100,maximum=599"`
+		Cache           *CacheSpec `json:"cache,omitempty"`
+	}
+
+	// CacheSpec describes the cache of the authorization decisions.
+	CacheSpec struct {
+		TTL        string `json:"ttl,omitempty" jsonschema:"format=duration"`
+		MaxEntries int    `json:"maxEntries,omitempty" jsonschema:"minimum=1"`
+	}
+
+	// Status is the status of ExtAuthz.
+	Status struct {
+		Allowed   uint64 `json:"allowed"`
+		Denied    uint64 `json:"denied"`
+		Failed    uint64 `json:"failed"`
+		CacheHits uint64 `json:"cacheHits"`
+	}
+
+	// authorizer checks a request with the authorization service.
+	authorizer interface {
+		check(ctx stdcontext.Context, r *checkRequest) (*decision, error)
+		close()
+	}
+
+	// checkRequest is the request to check, the path is escaped as it is
+	// sent to the authorization service.
+	checkRequest struct {
+		method   string
+		scheme   string
+		host     string
+		path     string
+		query    string
+		proto    string
+		clientIP string
+		headers  http.Header
+	}
+
+	// decision is the decision of the authorization service.
+	decision struct {
+		allowed bool
+
+		// for allowed requests, the headers to set or add to, and the
+		// headers to remove from the upstream request.
+		setHeaders    http.Header
+		addHeaders    http.Header
+		removeHeaders []string
+
+		// for denied requests, the response to the client.
+		status  int
+		headers http.Header
+		body    []byte
+	}
+
+	cacheEntry struct {
+		decision *decision
+		expireAt time.Time
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	switch spec.Protocol {
+	case protocolHTTP:
+		if spec.URL == "" {
+			return fmt.Errorf("url is required for protocol http")
+		}
+		u, err := url.Parse(spec.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url %q: %v", spec.URL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid scheme of url %q", spec.URL)
+		}
+	case protocolGRPC:
+		if spec.Address == "" {
+			return fmt.Errorf("address is required for protocol grpc")
+		}
+	default:
+		return fmt.Errorf("invalid protocol %q", spec.Protocol)
+	}
+
+	if spec.FailureMode != failureModeOpen && spec.FailureMode != failureModeClosed {
+		return fmt.Errorf("invalid failure mode %q", spec.FailureMode)
+	}
+	if spec.Timeout != "" {
+		if _, err := time.ParseDuration(spec.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %q: %v", spec.Timeout, err)
+		}
+	}
+	if spec.Cache != nil && spec.Cache.TTL != "" {
+		if _, err := time.ParseDuration(spec.Cache.TTL); err != nil {
+			return fmt.Errorf("invalid cache ttl %q: %v", spec.Cache.TTL, err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the ExtAuthz filter instance.
+func (ea *ExtAuthz) Name() string {
+	return ea.spec.Name()
+}
+
+// Kind returns the kind of ExtAuthz.
+func (ea *ExtAuthz) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ExtAuthz
+func (ea *ExtAuthz) Spec() filters.Spec {
+	return ea.spec
+}
+
+// Init initializes ExtAuthz.
+func (ea *ExtAuthz) Init() {
+	ea.reload()
+}
+
+// Inherit inherits previous generation of ExtAuthz.
+func (ea *ExtAuthz) Inherit(_ filters.Filter) {
+	ea.reload()
+}
+
+func (ea *ExtAuthz) reload() {
+	spec := ea.spec
+
+	ea.timeout = defaultTimeout
+	if spec.Timeout != "" {
+		ea.timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+
+	if spec.Protocol == protocolGRPC {
+		ea.authorizer = newGRPCAuthorizer(spec.Address)
+	} else {
+		ea.authorizer = newHTTPAuthorizer(spec.URL, spec.UpstreamHeaders)
+	}
+
+	if spec.Cache != nil {
+		ea.cacheTTL = defaultCacheTTL
+		if spec.Cache.TTL != "" {
+			ea.cacheTTL, _ = time.ParseDuration(spec.Cache.TTL)
+		}
+		size := spec.Cache.MaxEntries
+		if size == 0 {
+			size = defaultCacheMaxEntries
+		}
+		ea.cache, _ = lru.New(size)
+	}
+}
+
+// Handle authorizes the request.
+func (ea *ExtAuthz) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	cr := ea.newCheckRequest(req)
+
+	d, err := ea.check(req.Context(), cr)
+	if err != nil {
+		atomic.AddUint64(&ea.failed, 1)
+		logger.Errorf("%s: failed to check request: %v", ea.spec.Name(), err)
+		if ea.spec.FailureMode == failureModeOpen {
+			ctx.AddTag("ext authz failed, request is allowed")
+			return ""
+		}
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(ea.spec.StatusOnError)
+		ctx.SetOutputResponse(resp)
+		return resultFailed
+	}
+
+	if !d.allowed {
+		atomic.AddUint64(&ea.denied, 1)
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(d.status)
+		for k, vs := range d.headers {
+			for _, v := range vs {
+				resp.HTTPHeader().Add(k, v)
+			}
+		}
+		if len(d.body) > 0 {
+			resp.SetPayload(d.body)
+		}
+		ctx.SetOutputResponse(resp)
+		return resultDenied
+	}
+
+	atomic.AddUint64(&ea.allowed, 1)
+	h := req.HTTPHeader()
+	for k, vs := range d.setHeaders {
+		h.Del(k)
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+	for k, vs := range d.addHeaders {
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+	for _, k := range d.removeHeaders {
+		h.Del(k)
+	}
+	return ""
+}
+
+func (ea *ExtAuthz) newCheckRequest(req *httpprot.Request) *checkRequest {
+	cr := &checkRequest{
+		method:   req.Method(),
+		scheme:   req.Scheme(),
+		host:     req.Host(),
+		path:     req.URL().EscapedPath(),
+		query:    req.URL().RawQuery,
+		proto:    req.Proto(),
+		clientIP: req.RealIP(),
+	}
+
+	if len(ea.spec.AllowedHeaders) == 0 {
+		cr.headers = req.HTTPHeader().Clone()
+		return cr
+	}
+
+	cr.headers = http.Header{}
+	for _, k := range ea.spec.AllowedHeaders {
+		if vs := req.HTTPHeader().Values(k); len(vs) > 0 {
+			cr.headers[http.CanonicalHeaderKey(k)] = append([]string(nil), vs...)
+		}
+	}
+	return cr
+}
+
+// check checks the request, the decision is taken from the cache if
+// possible, errors are never cached.
+func (ea *ExtAuthz) check(ctx stdcontext.Context, cr *checkRequest) (*decision, error) {
+	var key string
+	if ea.cache != nil {
+		key = cr.cacheKey()
+		if v, ok := ea.cache.Get(key); ok {
+			e := v.(*cacheEntry)
+			if time.Now().Before(e.expireAt) {
+				atomic.AddUint64(&ea.cacheHits, 1)
+				return e.decision, nil
+			}
+			ea.cache.Remove(key)
+		}
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(ctx, ea.timeout)
+	defer cancel()
+
+	d, err := ea.authorizer.check(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+
+	if ea.cache != nil {
+		ea.cache.Add(key, &cacheEntry{decision: d, expireAt: time.Now().Add(ea.cacheTTL)})
+	}
+	return d, nil
+}
+
+// cacheKey returns the cache key of the request, which includes all the
+// information sent to the authorization service.
+func (cr *checkRequest) cacheKey() string {
+	var b strings.Builder
+	for _, s := range []string{cr.method, cr.scheme, cr.host, cr.path, cr.query, cr.clientIP} {
+		b.WriteString(s)
+		b.WriteByte('\n')
+	}
+
+	keys := make([]string, 0, len(cr.headers))
+	for k := range cr.headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(cr.headers[k], ","))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Status returns status.
+func (ea *ExtAuthz) Status() interface{} {
+	return &Status{
+		Allowed:   atomic.LoadUint64(&ea.allowed),
+		Denied:    atomic.LoadUint64(&ea.denied),
+		Failed:    atomic.LoadUint64(&ea.failed),
+		CacheHits: atomic.LoadUint64(&ea.cacheHits),
+	}
+}
+
+// Close closes ExtAuthz.
+func (ea *ExtAuthz) Close() {
+	if ea.authorizer != nil {
+		ea.authorizer.close()
+	}
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extauthz
+
+import (
+	stdcontext "context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/assert"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newSpec(yamlConfig string) (*Spec, error) {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		return nil, err
+	}
+	return spec.(*Spec), nil
+}
+
+func newExtAuthz(t *testing.T, yamlConfig string) *ExtAuthz {
+	spec, err := newSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ea := kind.CreateInstance(spec).(*ExtAuthz)
+	ea.Init()
+	t.Cleanup(ea.Close)
+	return ea
+}
+
+func newContext(token string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/api/users?id=1", nil)
+	stdr.RemoteAddr = "192.168.1.1:1234"
+	if token != "" {
+		stdr.Header.Set("Authorization", "Bearer "+token)
+	}
+	stdr.Header.Set("Cookie", "session=abc")
+	stdr.Header.Set("X-User", "spoofed")
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, cfg := range []string{
+		"protocol: http",
+		"protocol: http\nurl: ftp://authz",
+		"protocol: grpc",
+		"protocol: unknown\nurl: http://authz",
+		"url: http://authz\nfailureMode: unknown",
+		"url: http://authz\ntimeout: abc",
+		"url: http://authz\ncache:\n  ttl: abc",
+	} {
+		_, err := newSpec("kind: ExtAuthz\nname: authz\n" + cfg)
+		assert.NotNil(err, cfg)
+	}
+
+	_, err := newSpec("kind: ExtAuthz\nname: authz\nurl: http://authz")
+	assert.Nil(err)
+	_, err = newSpec("kind: ExtAuthz\nname: authz\nprotocol: grpc\naddress: 127.0.0.1:9000")
+	assert.Nil(err)
+}
+
+func TestHTTP(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		assert.Equal("/authz/api/users", r.URL.Path)
+		assert.Equal("id=1", r.URL.RawQuery)
+		assert.Equal("", r.Header.Get("Cookie"))
+		assert.Equal("192.168.1.1", r.Header.Get("X-Forwarded-For"))
+		assert.Equal("example.com", r.Header.Get("X-Forwarded-Host"))
+
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("unauthorized"))
+			return
+		}
+		w.Header().Set("X-User", "alice")
+		w.Header().Set("X-Internal", "secret")
+	}))
+	defer server.Close()
+
+	ea := newExtAuthz(t, `
+kind: ExtAuthz
+name: authz
+url: `+server.URL+`/authz
+allowedHeaders: [Authorization]
+upstreamHeaders: [X-User]
+cache:
+  ttl: 1m
+`)
+
+	ctx := newContext("good")
+	assert.Equal("", ea.Handle(ctx))
+	h := ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	assert.Equal("alice", h.Get("X-User"))
+	assert.Equal("", h.Get("X-Internal"))
+
+	ctx = newContext("bad")
+	assert.Equal(resultDenied, ea.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode())
+	assert.Equal("Bearer", resp.HTTPHeader().Get("WWW-Authenticate"))
+	assert.Equal("unauthorized", string(resp.RawPayload()))
+
+	// the decisions are cached.
+	assert.Equal("", ea.Handle(newContext("good")))
+	assert.Equal(resultDenied, ea.Handle(newContext("bad")))
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	s := ea.Status().(*Status)
+	assert.Equal(uint64(2), s.Allowed)
+	assert.Equal(uint64(2), s.Denied)
+	assert.Equal(uint64(2), s.CacheHits)
+}
+
+func TestFailureMode(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	ea := newExtAuthz(t, `
+kind: ExtAuthz
+name: authz
+url: `+url+`
+statusOnError: 503
+`)
+	ctx := newContext("good")
+	assert.Equal(resultFailed, ea.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ea = newExtAuthz(t, `
+kind: ExtAuthz
+name: authz
+url: `+url+`
+failureMode: open
+`)
+	ctx = newContext("good")
+	assert.Equal("", ea.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+	assert.Equal(uint64(1), ea.Status().(*Status).Failed)
+}
+
+func TestEscapedPath(t *testing.T) {
+	assert := assert.New(t)
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	ea := newExtAuthz(t, `
+kind: ExtAuthz
+name: authz
+url: `+server.URL+`/authz
+failureMode: open
+`)
+
+	// the escaped characters are kept, so the checked path is the same
+	// as the one sent to the backend.
+	for _, path := range []string{"/x%25zz", "/a%3Fb=c", "/a%23b"} {
+		ctx := newContext("good")
+		req := ctx.GetInputRequest().(*httpprot.Request)
+		u, err := url.Parse("http://example.com" + path + "?id=1")
+		assert.Nil(err)
+		req.Std().URL = u
+		assert.Equal(resultDenied, ea.Handle(ctx), path)
+	}
+	assert.Equal([]string{"/authz/x%25zz?id=1", "/authz/a%3Fb=c?id=1", "/authz/a%23b?id=1"}, paths)
+
+	// the requests which can't be checked are denied, even in failure
+	// mode open.
+	d, err := newHTTPAuthorizer(server.URL, nil).check(stdcontext.Background(), &checkRequest{
+		method: "BAD METHOD", path: "/",
+	})
+	assert.Nil(err)
+	assert.False(d.allowed)
+	assert.Equal(http.StatusForbidden, d.status)
+}
+
+type authzServer struct {
+	authv3.UnimplementedAuthorizationServer
+}
+
+func headerOption(k, v string, append bool) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header: &corev3.HeaderValue{Key: k, Value: v},
+		Append: wrapperspb.Bool(append),
+	}
+}
+
+func (s *authzServer) Check(ctx stdcontext.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	httpReq := req.GetAttributes().GetRequest().GetHttp()
+	if httpReq.GetHeaders()["authorization"] != "Bearer good" ||
+		httpReq.GetPath() != "/api/users?id=1" ||
+		req.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress() != "192.168.1.1" {
+		return &authv3.CheckResponse{
+			Status: &rpcstatus.Status{Code: int32(codes.PermissionDenied)},
+			HttpResponse: &authv3.CheckResponse_DeniedResponse{
+				DeniedResponse: &authv3.DeniedHttpResponse{
+					Status:  &typev3.HttpStatus{Code: typev3.StatusCode_Unauthorized},
+					Headers: []*corev3.HeaderValueOption{headerOption("WWW-Authenticate", "Bearer", false)},
+					Body:    "unauthorized",
+				},
+			},
+		}, nil
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{
+				Headers: []*corev3.HeaderValueOption{
+					headerOption("X-User", "alice", false),
+					headerOption("X-Roles", "admin", true),
+				},
+				HeadersToRemove: []string{"Cookie"},
+			},
+		},
+	}, nil
+}
+
+func TestGRPC(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	server := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(server, &authzServer{})
+	go server.Serve(l)
+	defer server.Stop()
+
+	ea := newExtAuthz(t, `
+kind: ExtAuthz
+name: authz
+protocol: grpc
+address: `+l.Addr().String()+`
+timeout: 5s
+`)
+
+	ctx := newContext("good")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Roles", "user")
+	assert.Equal("", ea.Handle(ctx))
+	h := ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	assert.Equal("alice", h.Get("X-User"))
+	assert.Equal([]string{"user", "admin"}, h.Values("X-Roles"))
+	assert.Equal("", h.Get("Cookie"))
+
+	ctx = newContext("bad")
+	assert.Equal(resultDenied, ea.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode())
+	assert.Equal("Bearer", resp.HTTPHeader().Get("WWW-Authenticate"))
+	assert.Equal("unauthorized", string(resp.RawPayload()))
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extauthz
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// grpcAuthorizer checks requests with a gRPC authorization service which
+// implements the Envoy ext_authz protocol.
+type grpcAuthorizer struct {
+	conn   *grpc.ClientConn
+	client authv3.AuthorizationClient
+	err    error
+}
+
+func newGRPCAuthorizer(address string) *grpcAuthorizer {
+	// the connection is established in background, so this only fails on
+	// invalid options.
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return &grpcAuthorizer{err: fmt.Errorf("failed to dial %s: %v", address, err)}
+	}
+	return &grpcAuthorizer{conn: conn, client: authv3.NewAuthorizationClient(conn)}
+}
+
+func (a *grpcAuthorizer) check(ctx stdcontext.Context, cr *checkRequest) (*decision, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+
+	headers := make(map[string]string, len(cr.headers)+1)
+	for k, vs := range cr.headers {
+		headers[strings.ToLower(k)] = strings.Join(vs, ",")
+	}
+	headers[":authority"] = cr.host
+
+	path := cr.path
+	if cr.query != "" {
+		path += "?" + cr.query
+	}
+
+	resp, err := a.client.Check(ctx, &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Source: &authv3.AttributeContext_Peer{
+				Address: &corev3.Address{
+					Address: &corev3.Address_SocketAddress{
+						SocketAddress: &corev3.SocketAddress{Address: cr.clientIP},
+					},
+				},
+			},
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method:   cr.method,
+					Headers:  headers,
+					Path:     path,
+					Host:     cr.host,
+					Scheme:   cr.scheme,
+					Protocol: cr.proto,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if codes.Code(resp.GetStatus().GetCode()) == codes.OK {
+		d := &decision{allowed: true, setHeaders: http.Header{}, addHeaders: http.Header{}}
+		ok := resp.GetOkResponse()
+		for _, h := range ok.GetHeaders() {
+			k, v := h.GetHeader().GetKey(), h.GetHeader().GetValue()
+			if h.GetAppend().GetValue() {
+				d.addHeaders.Add(k, v)
+			} else {
+				d.setHeaders.Add(k, v)
+			}
+		}
+		d.removeHeaders = ok.GetHeadersToRemove()
+		return d, nil
+	}
+
+	d := &decision{status: http.StatusForbidden, headers: http.Header{}}
+	if denied := resp.GetDeniedResponse(); denied != nil {
+		if code := int(denied.GetStatus().GetCode()); code != 0 {
+			d.status = code
+		}
+		for _, h := range denied.GetHeaders() {
+			d.headers.Add(h.GetHeader().GetKey(), h.GetHeader().GetValue())
+		}
+		d.body = []byte(denied.GetBody())
+	}
+	return d, nil
+}
+
+func (a *grpcAuthorizer) close() {
+	if a.conn != nil {
+		a.conn.Close()
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extauthz
+
+import (
+	stdcontext "context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+// maxDeniedBodySize is the max size of the body of a denied response to
+// return to the client.
+const maxDeniedBodySize = 64 * 1024
+
+// hopHeaders are the headers which are not copied between the requests
+// and responses.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Content-Length",
+}
+
+// httpAuthorizer checks requests with an HTTP authorization service, the
+// method and the path of the request are kept, with the url of the service
+// as the prefix of the path. A 2xx response allows the request, and any
+// other response denies it and is returned to the client.
+type httpAuthorizer struct {
+	url             string
+	upstreamHeaders []string
+	client          *http.Client
+}
+
+func newHTTPAuthorizer(url string, upstreamHeaders []string) *httpAuthorizer {
+	return &httpAuthorizer{
+		url:             strings.TrimSuffix(url, "/"),
+		upstreamHeaders: upstreamHeaders,
+		client: &http.Client{
+			// the redirections are returned to the client.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (a *httpAuthorizer) check(ctx stdcontext.Context, cr *checkRequest) (*decision, error) {
+	u := a.url + cr.path
+	if cr.query != "" {
+		u += "?" + cr.query
+	}
+	req, err := http.NewRequestWithContext(ctx, cr.method, u, nil)
+	if err != nil {
+		// The request is built from the client request, so the error is
+		// caused by the client, it is denied rather than failed, otherwise
+		// the clients could bypass the check in failure mode open.
+		logger.Warnf("failed to build the check request, deny it: %v", err)
+		return &decision{status: http.StatusForbidden}, nil
+	}
+
+	req.Header = cr.headers.Clone()
+	for _, k := range hopHeaders {
+		req.Header.Del(k)
+	}
+	req.Header.Set("X-Forwarded-For", cr.clientIP)
+	req.Header.Set("X-Forwarded-Host", cr.host)
+	req.Header.Set("X-Forwarded-Proto", cr.scheme)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxDeniedBodySize))
+		d := &decision{allowed: true, setHeaders: http.Header{}}
+		for _, k := range a.upstreamHeaders {
+			if vs := resp.Header.Values(k); len(vs) > 0 {
+				d.setHeaders[http.CanonicalHeaderKey(k)] = vs
+			}
+		}
+		return d, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDeniedBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	d := &decision{status: resp.StatusCode, headers: resp.Header.Clone(), body: body}
+	for _, k := range hopHeaders {
+		d.headers.Del(k)
+	}
+	return d, nil
+}
+
+func (a *httpAuthorizer) close() {
+	a.client.CloseIdleConnections()
+}
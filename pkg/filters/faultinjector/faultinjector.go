@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package faultinjector provides FaultInjector filter.
+package faultinjector
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of FaultInjector.
+	Kind = "FaultInjector"
+
+	resultAborted = "aborted"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "FaultInjector delays or aborts a percentage of requests.",
+	Results:     []string{resultAborted},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &FaultInjector{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// FaultInjector is filter FaultInjector.
+	FaultInjector struct {
+		spec *Spec
+
+		delay  time.Duration
+		random func() float64
+	}
+
+	// Spec describes the FaultInjector.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+		Rule             `json:",inline"`
+	}
+
+	// Rule is the detailed config of FaultInjector.
+	Rule struct {
+		Headers         map[string]*stringtool.StringMatcher `json:"headers,omitempty"`
+		MatchAllHeaders bool                                 `json:"matchAllHeaders,omitempty"`
+		Delay           *DelayFault                          `json:"delay,omitempty"`
+		Abort           *AbortFault                          `json:"abort,omitempty"`
+	}
+
+	// DelayFault delays a percentage of requests.
+	DelayFault struct {
+		Percentage float64 `json:"percentage" jsonschema:"required,minimum=0,maximum=100"`
+		Duration   string  `json:"duration" jsonschema:"required,format=duration"`
+	}
+
+	// AbortFault aborts a percentage of requests with a status code.
+	AbortFault struct {
+		Percentage float64 `json:"percentage" jsonschema:"required,minimum=0,maximum=100"`
+		Code       int     `json:"code" jsonschema:"required,format=httpcode"`
+		Body       string  `json:"body,omitempty"`
+	}
+)
+
+// Validate validates the rule.
+func (r *Rule) Validate() error {
+	if r.Delay == nil && r.Abort == nil {
+		return errors.New("none of delay and abort is specified")
+	}
+
+	for key, m := range r.Headers {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("header %s: %v", key, err)
+		}
+	}
+
+	if r.Delay != nil {
+		if _, err := time.ParseDuration(r.Delay.Duration); err != nil {
+			return fmt.Errorf("invalid delay duration %s: %v", r.Delay.Duration, err)
+		}
+	}
+
+	return nil
+}
+
+// Name returns the name of the FaultInjector filter instance.
+func (fi *FaultInjector) Name() string {
+	return fi.spec.Name()
+}
+
+// Kind returns the kind of FaultInjector.
+func (fi *FaultInjector) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the FaultInjector
+func (fi *FaultInjector) Spec() filters.Spec {
+	return fi.spec
+}
+
+// Init initializes FaultInjector.
+func (fi *FaultInjector) Init() {
+	fi.reload()
+}
+
+// Inherit inherits previous generation of FaultInjector.
+func (fi *FaultInjector) Inherit(previousGeneration filters.Filter) {
+	fi.Init()
+}
+
+func (fi *FaultInjector) reload() {
+	for _, m := range fi.spec.Headers {
+		m.Init()
+	}
+
+	if fi.spec.Delay != nil {
+		fi.delay, _ = time.ParseDuration(fi.spec.Delay.Duration)
+	}
+
+	if fi.random == nil {
+		fi.random = rand.Float64
+	}
+}
+
+// Handle injects faults to Context.
+func (fi *FaultInjector) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if !fi.match(req) {
+		return ""
+	}
+
+	if fi.spec.Delay != nil && fi.hit(fi.spec.Delay.Percentage) {
+		logger.Debugf("inject delay for %v ...", fi.delay)
+		select {
+		case <-req.Context().Done():
+			logger.Debugf("request cancelled in the middle of delay injection")
+		case <-time.After(fi.delay):
+		}
+	}
+
+	if fi.spec.Abort != nil && fi.hit(fi.spec.Abort.Percentage) {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(fi.spec.Abort.Code)
+		resp.SetPayload([]byte(fi.spec.Abort.Body))
+		ctx.SetOutputResponse(resp)
+		return resultAborted
+	}
+
+	return ""
+}
+
+// hit reports whether the current request falls into the percentage.
+func (fi *FaultInjector) hit(percentage float64) bool {
+	return fi.random()*100 < percentage
+}
+
+func (fi *FaultInjector) match(req *httpprot.Request) bool {
+	if len(fi.spec.Headers) == 0 {
+		return true
+	}
+
+	header := req.HTTPHeader()
+	for key, m := range fi.spec.Headers {
+		values := header.Values(key)
+
+		var matched bool
+		if len(values) == 0 {
+			matched = m.Empty
+		} else if !m.Empty {
+			matched = m.MatchAny(values)
+		}
+
+		if matched && !fi.spec.MatchAllHeaders {
+			return true
+		}
+		if !matched && fi.spec.MatchAllHeaders {
+			return false
+		}
+	}
+
+	return fi.spec.MatchAllHeaders
+}
+
+// Status returns status.
+func (fi *FaultInjector) Status() interface{} {
+	return nil
+}
+
+// Close closes FaultInjector.
+func (fi *FaultInjector) Close() {
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package faultinjector
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newFaultInjector(t *testing.T, yamlConfig string) *FaultInjector {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fi := kind.CreateInstance(spec).(*FaultInjector)
+	fi.Init()
+	return fi
+}
+
+func newContext(t *testing.T, header http.Header) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/users", nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(`
+kind: FaultInjector
+name: fault
+`), &rawSpec)
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NotNil(err)
+
+	rawSpec = make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(`
+kind: FaultInjector
+name: fault
+abort:
+  percentage: 120
+  code: 503
+`), &rawSpec)
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.NotNil(err)
+}
+
+func TestAbort(t *testing.T) {
+	assert := assert.New(t)
+
+	fi := newFaultInjector(t, `
+kind: FaultInjector
+name: fault
+abort:
+  percentage: 50
+  code: 503
+  body: injected
+`)
+	assert.Equal(Kind, fi.Kind().Name)
+	assert.Equal("fault", fi.Name())
+
+	fi.random = func() float64 { return 0.3 }
+	ctx := newContext(t, nil)
+	assert.Equal(resultAborted, fi.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(503, resp.StatusCode())
+	body, err := io.ReadAll(resp.GetPayload())
+	assert.Nil(err)
+	assert.Equal("injected", string(body))
+
+	fi.random = func() float64 { return 0.7 }
+	ctx = newContext(t, nil)
+	assert.Equal("", fi.Handle(ctx))
+}
+
+func TestDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	fi := newFaultInjector(t, `
+kind: FaultInjector
+name: fault
+delay:
+  percentage: 100
+  duration: 20ms
+`)
+
+	start := time.Now()
+	assert.Equal("", fi.Handle(newContext(t, nil)))
+	assert.GreaterOrEqual(time.Since(start), 20*time.Millisecond)
+}
+
+func TestHeaderMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	fi := newFaultInjector(t, `
+kind: FaultInjector
+name: fault
+matchAllHeaders: true
+headers:
+  X-Chaos:
+    exact: "true"
+  X-User:
+    prefix: test-
+abort:
+  percentage: 100
+  code: 500
+`)
+
+	assert.Equal("", fi.Handle(newContext(t, nil)))
+	assert.Equal("", fi.Handle(newContext(t, http.Header{"X-Chaos": {"true"}})))
+	assert.Equal(resultAborted, fi.Handle(newContext(t, http.Header{
+		"X-Chaos": {"true"},
+		"X-User":  {"test-1"},
+	})))
+
+	fi.spec.MatchAllHeaders = false
+	assert.Equal(resultAborted, fi.Handle(newContext(t, http.Header{"X-Chaos": {"true"}})))
+	assert.Equal("", fi.Handle(newContext(t, http.Header{"X-Chaos": {"false"}})))
+}
@@ -0,0 +1,438 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package geoip provides the GeoIP filter.
+package geoip
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+)
+
+const (
+	// Kind is the kind of GeoIP.
+	Kind = "GeoIP"
+
+	resultBlocked = "blocked"
+
+	maxRoutes             = 10
+	unknownCountry        = "unknown"
+	defaultReloadInterval = time.Minute
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "GeoIP blocks, routes or tags requests by the country or ASN of the client.",
+	Results:     []string{resultBlocked},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &GeoIP{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	for i := 0; i < maxRoutes; i++ {
+		kind.Results = append(kind.Results, routeResult(i))
+	}
+	filters.Register(kind)
+}
+
+type (
+	// GeoIP is filter GeoIP.
+	GeoIP struct {
+		spec *Spec
+
+		databases []*database
+		counters  sync.Map
+		metrics   *prometheus.CounterVec
+
+		stopCtx stdcontext.Context
+		cancel  stdcontext.CancelFunc
+	}
+
+	// Spec describes the GeoIP.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Databases      []string `json:"databases" jsonschema:"required,minItems=1"`
+		ReloadInterval string   `json:"reloadInterval,omitempty" jsonschema:"format=duration"`
+
+		AllowCountries []string `json:"allowCountries,omitempty" jsonschema:"uniqueItems=true"`
+		BlockCountries []string `json:"blockCountries,omitempty" jsonschema:"uniqueItems=true"`
+		AllowASNs      []uint   `json:"allowASNs,omitempty" jsonschema:"uniqueItems=true"`
+		BlockASNs      []uint   `json:"blockASNs,omitempty" jsonschema:"uniqueItems=true"`
+		BlockUnknown   bool     `json:"blockUnknown,omitempty"`
+
+		CountryHeader string   `json:"countryHeader,omitempty"`
+		ASNHeader     string   `json:"asnHeader,omitempty"`
+		Routes        []*Route `json:"routes,omitempty" jsonschema:"maxItems=10"`
+	}
+
+	// Route routes the requests from the countries or ASNs to the result
+	// route<N>, where N is the index of the route.
+	Route struct {
+		Countries []string `json:"countries,omitempty" jsonschema:"uniqueItems=true"`
+		ASNs      []uint   `json:"asns,omitempty" jsonschema:"uniqueItems=true"`
+	}
+
+	// Status is the status of GeoIP.
+	Status struct {
+		Countries map[string]*CountryStatus `json:"countries"`
+	}
+
+	// CountryStatus is the status of requests from a country.
+	CountryStatus struct {
+		Requests uint64 `json:"requests"`
+		Blocked  uint64 `json:"blocked"`
+	}
+
+	countryCounter struct {
+		requests uint64
+		blocked  uint64
+	}
+
+	// database is a MaxMind format database which is reloaded when the
+	// file changes.
+	database struct {
+		path    string
+		reader  atomic.Pointer[maxminddb.Reader]
+		modTime time.Time
+		size    int64
+	}
+
+	// record is the fields used by GeoIP, which are compatible with the
+	// GeoIP2/GeoLite2 Country, City and ASN databases.
+	record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		ASN uint `maxminddb:"autonomous_system_number"`
+	}
+)
+
+func routeResult(i int) string {
+	return fmt.Sprintf("route%d", i)
+}
+
+// Validate validates the spec of GeoIP.
+func (spec *Spec) Validate() error {
+	if len(spec.Routes) > maxRoutes {
+		return fmt.Errorf("at most %d routes are supported", maxRoutes)
+	}
+	for i, r := range spec.Routes {
+		if len(r.Countries) == 0 && len(r.ASNs) == 0 {
+			return fmt.Errorf("route %d: countries and asns are both empty", i)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the GeoIP filter instance.
+func (g *GeoIP) Name() string {
+	return g.spec.Name()
+}
+
+// Kind returns the kind of GeoIP.
+func (g *GeoIP) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the GeoIP.
+func (g *GeoIP) Spec() filters.Spec {
+	return g.spec
+}
+
+// Init initializes GeoIP.
+func (g *GeoIP) Init() {
+	g.reload()
+}
+
+// Inherit inherits previous generation of GeoIP.
+func (g *GeoIP) Inherit(_ filters.Filter) {
+	g.Init()
+}
+
+func (g *GeoIP) reload() {
+	g.databases = nil
+	for _, path := range g.spec.Databases {
+		db := &database{path: path}
+		if err := db.load(); err != nil {
+			logger.Errorf("%s: load geoip database failed: %v", g.Name(), err)
+		}
+		g.databases = append(g.databases, db)
+	}
+
+	g.metrics = g.newMetrics()
+
+	interval := defaultReloadInterval
+	if g.spec.ReloadInterval != "" {
+		interval, _ = time.ParseDuration(g.spec.ReloadInterval)
+	}
+
+	g.stopCtx, g.cancel = stdcontext.WithCancel(stdcontext.Background())
+	go g.watchDatabases(interval)
+}
+
+func (g *GeoIP) newMetrics() *prometheus.CounterVec {
+	super := g.spec.Super()
+	if super == nil {
+		return nil
+	}
+
+	labels := []string{"clusterName", "clusterRole", "instanceName",
+		"filterName", "kind", "country", "action"}
+	counter := prometheushelper.NewCounter("geoip_total_requests",
+		"the total count of requests by country", labels)
+	if counter == nil {
+		return nil
+	}
+
+	return counter.MustCurryWith(prometheus.Labels{
+		"clusterName":  super.Options().ClusterName,
+		"clusterRole":  super.Options().ClusterRole,
+		"instanceName": super.Options().Name,
+		"filterName":   g.Name(),
+		"kind":         Kind,
+	})
+}
+
+func (g *GeoIP) watchDatabases(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stopCtx.Done():
+			return
+		case <-ticker.C:
+			for _, db := range g.databases {
+				if !db.changed() {
+					continue
+				}
+				if err := db.load(); err != nil {
+					logger.Errorf("%s: reload geoip database failed: %v", g.Name(), err)
+				} else {
+					logger.Infof("%s: geoip database %s reloaded", g.Name(), db.path)
+				}
+			}
+		}
+	}
+}
+
+// load loads the database into memory, so the previous reader can be
+// dropped safely while it is still being used.
+func (db *database) load() error {
+	fi, err := os.Stat(db.path)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", db.path, err)
+	}
+
+	db.reader.Store(reader)
+	db.modTime, db.size = fi.ModTime(), fi.Size()
+	return nil
+}
+
+func (db *database) changed() bool {
+	fi, err := os.Stat(db.path)
+	if err != nil {
+		return false
+	}
+	return !fi.ModTime().Equal(db.modTime) || fi.Size() != db.size
+}
+
+// lookup looks up ip in all databases, the country and ASN are taken from
+// the first database which has them.
+func (g *GeoIP) lookup(ip net.IP) (country string, asn uint) {
+	for _, db := range g.databases {
+		reader := db.reader.Load()
+		if reader == nil {
+			continue
+		}
+
+		r := &record{}
+		if err := reader.Lookup(ip, r); err != nil {
+			logger.Debugf("%s: lookup %s failed: %v", g.Name(), ip, err)
+			continue
+		}
+		if country == "" {
+			country = r.Country.ISOCode
+		}
+		if asn == 0 {
+			asn = r.ASN
+		}
+	}
+	return
+}
+
+// Handle blocks, routes or tags the request.
+func (g *GeoIP) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	var country string
+	var asn uint
+	if ip := net.ParseIP(req.RealIP()); ip != nil {
+		country, asn = g.lookup(ip)
+	}
+
+	blocked := g.blocked(country, asn)
+	g.count(country, blocked)
+
+	if blocked {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusForbidden)
+		ctx.SetOutputResponse(resp)
+		return resultBlocked
+	}
+
+	g.tag(req, country, asn)
+
+	for i, r := range g.spec.Routes {
+		if matchCountry(r.Countries, country) || matchASN(r.ASNs, asn) {
+			return routeResult(i)
+		}
+	}
+
+	return ""
+}
+
+func (g *GeoIP) blocked(country string, asn uint) bool {
+	spec := g.spec
+	if country == "" && asn == 0 {
+		return spec.BlockUnknown
+	}
+
+	if len(spec.AllowCountries) > 0 || len(spec.AllowASNs) > 0 {
+		if !matchCountry(spec.AllowCountries, country) && !matchASN(spec.AllowASNs, asn) {
+			return true
+		}
+	}
+
+	return matchCountry(spec.BlockCountries, country) || matchASN(spec.BlockASNs, asn)
+}
+
+// tag sets the country and ASN headers, the headers sent by the client
+// are removed, so they can't be spoofed.
+func (g *GeoIP) tag(req *httpprot.Request, country string, asn uint) {
+	h := req.HTTPHeader()
+	if g.spec.CountryHeader != "" {
+		h.Del(g.spec.CountryHeader)
+		if country != "" {
+			h.Set(g.spec.CountryHeader, country)
+		}
+	}
+	if g.spec.ASNHeader != "" {
+		h.Del(g.spec.ASNHeader)
+		if asn != 0 {
+			h.Set(g.spec.ASNHeader, strconv.FormatUint(uint64(asn), 10))
+		}
+	}
+}
+
+func (g *GeoIP) count(country string, blocked bool) {
+	if country == "" {
+		country = unknownCountry
+	}
+
+	v, ok := g.counters.Load(country)
+	if !ok {
+		v, _ = g.counters.LoadOrStore(country, &countryCounter{})
+	}
+	c := v.(*countryCounter)
+	atomic.AddUint64(&c.requests, 1)
+
+	action := "allowed"
+	if blocked {
+		atomic.AddUint64(&c.blocked, 1)
+		action = resultBlocked
+	}
+
+	if g.metrics != nil {
+		g.metrics.WithLabelValues(country, action).Inc()
+	}
+}
+
+func matchCountry(countries []string, country string) bool {
+	if country == "" {
+		return false
+	}
+	for _, c := range countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchASN(asns []uint, asn uint) bool {
+	if asn == 0 {
+		return false
+	}
+	for _, a := range asns {
+		if a == asn {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns status.
+func (g *GeoIP) Status() interface{} {
+	s := &Status{Countries: map[string]*CountryStatus{}}
+	g.counters.Range(func(key, value any) bool {
+		c := value.(*countryCounter)
+		s.Countries[key.(string)] = &CountryStatus{
+			Requests: atomic.LoadUint64(&c.requests),
+			Blocked:  atomic.LoadUint64(&c.blocked),
+		}
+		return true
+	})
+	return s
+}
+
+// Close closes GeoIP.
+func (g *GeoIP) Close() {
+	g.cancel()
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geoip
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+// writeDatabase writes a MaxMind format database, networks maps CIDRs to
+// their records.
+func writeDatabase(t *testing.T, path string, networks map[string]mmdbtype.Map) {
+	tree, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            "Test",
+		IncludeReservedNetworks: true,
+	})
+	assert.Nil(t, err)
+
+	for cidr, data := range networks {
+		_, network, _ := net.ParseCIDR(cidr)
+		assert.Nil(t, tree.Insert(network, data))
+	}
+
+	f, err := os.Create(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	_, err = tree.WriteTo(f)
+	assert.Nil(t, err)
+}
+
+func countryRecord(code string) mmdbtype.Map {
+	return mmdbtype.Map{
+		"country": mmdbtype.Map{"iso_code": mmdbtype.String(code)},
+	}
+}
+
+func asnRecord(asn uint32) mmdbtype.Map {
+	return mmdbtype.Map{
+		"autonomous_system_number": mmdbtype.Uint32(asn),
+	}
+}
+
+func newGeoIP(t *testing.T, yamlConfig string) *GeoIP {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	g := kind.CreateInstance(spec).(*GeoIP)
+	g.Init()
+	return g
+}
+
+func newContext(ip string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	stdr.RemoteAddr = ip + ":1234"
+	stdr.Header.Set("X-Geo-Country", "spoofed")
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestGeoIP(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	countryDB := filepath.Join(dir, "country.mmdb")
+	asnDB := filepath.Join(dir, "asn.mmdb")
+	writeDatabase(t, countryDB, map[string]mmdbtype.Map{
+		"1.1.1.0/24": countryRecord("AU"),
+		"2.2.2.0/24": countryRecord("CN"),
+		"3.3.3.0/24": countryRecord("US"),
+	})
+	writeDatabase(t, asnDB, map[string]mmdbtype.Map{
+		"3.3.3.0/24": asnRecord(16509),
+		"4.4.4.0/24": asnRecord(64512),
+	})
+
+	g := newGeoIP(t, `
+kind: GeoIP
+name: geoip
+databases: [`+countryDB+`, `+asnDB+`]
+blockCountries: [cn]
+blockASNs: [64512]
+countryHeader: X-Geo-Country
+asnHeader: X-Geo-ASN
+routes:
+- countries: [AU]
+- asns: [16509]
+`)
+	defer g.Close()
+
+	ctx := newContext("1.1.1.1")
+	assert.Equal("route0", g.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("AU", req.HTTPHeader().Get("X-Geo-Country"))
+	assert.Equal("", req.HTTPHeader().Get("X-Geo-ASN"))
+
+	ctx = newContext("3.3.3.3")
+	assert.Equal("route1", g.Handle(ctx))
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("US", req.HTTPHeader().Get("X-Geo-Country"))
+	assert.Equal("16509", req.HTTPHeader().Get("X-Geo-ASN"))
+
+	ctx = newContext("2.2.2.2")
+	assert.Equal(resultBlocked, g.Handle(ctx))
+	assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	assert.Equal(resultBlocked, g.Handle(newContext("4.4.4.4")))
+
+	ctx = newContext("5.5.5.5")
+	assert.Equal("", g.Handle(ctx))
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("", req.HTTPHeader().Get("X-Geo-Country"))
+
+	status := g.Status().(*Status)
+	assert.Equal(uint64(1), status.Countries["AU"].Requests)
+	assert.Equal(uint64(1), status.Countries["CN"].Blocked)
+	assert.Equal(uint64(2), status.Countries[unknownCountry].Requests)
+	assert.Equal(uint64(1), status.Countries[unknownCountry].Blocked)
+}
+
+func TestAllowList(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	db := filepath.Join(dir, "country.mmdb")
+	writeDatabase(t, db, map[string]mmdbtype.Map{
+		"1.1.1.0/24": countryRecord("AU"),
+		"2.2.2.0/24": countryRecord("CN"),
+	})
+
+	g := newGeoIP(t, `
+kind: GeoIP
+name: geoip
+databases: [`+db+`]
+allowCountries: [AU]
+blockUnknown: true
+`)
+	defer g.Close()
+
+	assert.Equal("", g.Handle(newContext("1.1.1.1")))
+	assert.Equal(resultBlocked, g.Handle(newContext("2.2.2.2")))
+	assert.Equal(resultBlocked, g.Handle(newContext("5.5.5.5")))
+
+	spec := &Spec{Routes: []*Route{{}}}
+	assert.Error(spec.Validate())
+}
+
+func TestReload(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	db := filepath.Join(dir, "country.mmdb")
+	writeDatabase(t, db, map[string]mmdbtype.Map{
+		"1.1.1.0/24": countryRecord("AU"),
+	})
+
+	g := newGeoIP(t, `
+kind: GeoIP
+name: geoip
+databases: [`+db+`]
+reloadInterval: 10ms
+blockCountries: [CN]
+`)
+	defer g.Close()
+
+	assert.Equal("", g.Handle(newContext("1.1.1.1")))
+
+	// replace the file like the database updaters do.
+	tmp := filepath.Join(dir, "country.mmdb.tmp")
+	writeDatabase(t, tmp, map[string]mmdbtype.Map{
+		"1.1.1.0/24": countryRecord("CN"),
+		"2.2.2.0/24": countryRecord("AU"),
+	})
+	assert.Nil(os.Rename(tmp, db))
+
+	assert.Eventually(func() bool {
+		return g.Handle(newContext("1.1.1.1")) == resultBlocked
+	}, 3*time.Second, 20*time.Millisecond)
+
+	newG := kind.CreateInstance(g.spec)
+	newG.Inherit(g)
+	newG.Close()
+}
@@ -0,0 +1,311 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpctranscoder provides GRPCTranscoder filter.
+package grpctranscoder
+
+import (
+	stdctx "context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of GRPCTranscoder.
+	Kind = "GRPCTranscoder"
+
+	resultNotMatched  = "notMatched"
+	resultClientError = "clientError"
+	resultServerError = "serverError"
+
+	metadataHeaderPrefix = "Grpc-Metadata-"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "GRPCTranscoder transcodes REST/JSON requests to gRPC calls and the responses back to JSON.",
+	Results:     []string{resultNotMatched, resultClientError, resultServerError},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &GRPCTranscoder{spec: spec.(*Spec)}
+	},
+}
+
+// reservedHeaders are not forwarded to the upstream as gRPC metadata.
+var reservedHeaders = map[string]struct{}{
+	"connection":        {},
+	"content-length":    {},
+	"content-type":      {},
+	"host":              {},
+	"keep-alive":        {},
+	"proxy-connection":  {},
+	"te":                {},
+	"trailer":           {},
+	"transfer-encoding": {},
+	"upgrade":           {},
+	"accept-encoding":   {},
+	"user-agent":        {},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// GRPCTranscoder is filter GRPCTranscoder.
+	GRPCTranscoder struct {
+		spec    *Spec
+		routes  []*route
+		conns   []*grpc.ClientConn
+		next    uint64
+		timeout time.Duration
+	}
+
+	// Spec describes the GRPCTranscoder.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		DescriptorSet      string   `json:"descriptorSet,omitempty"`
+		DescriptorSetFile  string   `json:"descriptorSetFile,omitempty"`
+		Servers            []string `json:"servers" jsonschema:"required,minItems=1"`
+		Timeout            string   `json:"timeout,omitempty" jsonschema:"format=duration"`
+		Rules              []*Rule  `json:"rules,omitempty"`
+		DisableAnnotations bool     `json:"disableAnnotations,omitempty"`
+		DiscardUnknown     bool     `json:"discardUnknown,omitempty"`
+		UseProtoNames      bool     `json:"useProtoNames,omitempty"`
+		EmitUnpopulated    bool     `json:"emitUnpopulated,omitempty"`
+	}
+
+	// Rule binds an HTTP method and path template to a gRPC method, like
+	// the google.api.http annotation.
+	Rule struct {
+		Method       string `json:"method" jsonschema:"required"`
+		HTTPMethod   string `json:"httpMethod" jsonschema:"required,format=httpmethod"`
+		Path         string `json:"path" jsonschema:"required"`
+		Body         string `json:"body,omitempty"`
+		ResponseBody string `json:"responseBody,omitempty"`
+	}
+)
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	if s.Timeout != "" {
+		if _, err := time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout: %v", err)
+		}
+	}
+
+	routes, err := s.buildRoutes()
+	if err != nil {
+		return err
+	}
+	if len(routes) == 0 {
+		return fmt.Errorf("no rules or google.api.http annotations")
+	}
+	return nil
+}
+
+// Name returns the name of the GRPCTranscoder filter instance.
+func (gt *GRPCTranscoder) Name() string {
+	return gt.spec.Name()
+}
+
+// Kind returns the kind of GRPCTranscoder.
+func (gt *GRPCTranscoder) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the GRPCTranscoder
+func (gt *GRPCTranscoder) Spec() filters.Spec {
+	return gt.spec
+}
+
+// Init initializes GRPCTranscoder.
+func (gt *GRPCTranscoder) Init() {
+	gt.reload()
+}
+
+// Inherit inherits previous generation of GRPCTranscoder.
+func (gt *GRPCTranscoder) Inherit(previousGeneration filters.Filter) {
+	gt.reload()
+}
+
+func (gt *GRPCTranscoder) reload() {
+	routes, err := gt.spec.buildRoutes()
+	if err != nil {
+		logger.Errorf("BUG: build routes of %s failed: %v", gt.spec.Name(), err)
+	}
+	gt.routes = routes
+
+	gt.timeout, _ = time.ParseDuration(gt.spec.Timeout)
+
+	for _, server := range gt.spec.Servers {
+		// Dial doesn't block, the connection is established on the first call.
+		conn, err := grpc.Dial(server, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			logger.Errorf("dial gRPC server %s failed: %v", server, err)
+			continue
+		}
+		gt.conns = append(gt.conns, conn)
+	}
+}
+
+func (gt *GRPCTranscoder) nextConn() *grpc.ClientConn {
+	if len(gt.conns) == 0 {
+		return nil
+	}
+	n := atomic.AddUint64(&gt.next, 1)
+	return gt.conns[n%uint64(len(gt.conns))]
+}
+
+func isReserved(key string) bool {
+	_, ok := reservedHeaders[key]
+	return ok || strings.HasPrefix(key, "grpc-")
+}
+
+func outgoingMetadata(h http.Header) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range h {
+		k = strings.ToLower(k)
+		if !isReserved(k) {
+			md[k] = v
+		}
+	}
+	return md
+}
+
+func setErrorResponse(ctx *context.Context, err error, md ...metadata.MD) {
+	code, body := encodeError(err)
+	setResponse(ctx, code, body, md...)
+}
+
+func setResponse(ctx *context.Context, code int, body []byte, md ...metadata.MD) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	for _, m := range md {
+		for k, v := range m {
+			if isReserved(k) {
+				continue
+			}
+			for _, s := range v {
+				resp.HTTPHeader().Add(metadataHeaderPrefix+k, s)
+			}
+		}
+	}
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.HTTPHeader().Set("Content-Length", strconv.Itoa(len(body)))
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+}
+
+// Handle transcodes the request to a gRPC call, and the result of the call
+// to the response.
+func (gt *GRPCTranscoder) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	var rt *route
+	var vars map[string]string
+	for _, r := range gt.routes {
+		if v, ok := r.match(req.Method(), req.Path()); ok {
+			rt, vars = r, v
+			break
+		}
+	}
+	if rt == nil {
+		return resultNotMatched
+	}
+
+	body := req.RawPayload()
+	if req.IsStream() {
+		data, err := io.ReadAll(req.GetPayload())
+		if err != nil {
+			setErrorResponse(ctx, status.Error(codes.InvalidArgument, err.Error()))
+			return resultClientError
+		}
+		body = data
+	}
+
+	in, err := buildRequest(rt, body, vars, req.URL().Query(), gt.spec.DiscardUnknown)
+	if err != nil {
+		setErrorResponse(ctx, status.Error(codes.InvalidArgument, err.Error()))
+		return resultClientError
+	}
+
+	conn := gt.nextConn()
+	if conn == nil {
+		setErrorResponse(ctx, status.Error(codes.Unavailable, "no available server"))
+		return resultServerError
+	}
+
+	callCtx := metadata.NewOutgoingContext(req.Context(), outgoingMetadata(req.HTTPHeader()))
+	if gt.timeout > 0 {
+		var cancel stdctx.CancelFunc
+		callCtx, cancel = stdctx.WithTimeout(callCtx, gt.timeout)
+		defer cancel()
+	}
+
+	out := dynamicpb.NewMessage(rt.method.Output())
+	var header, trailer metadata.MD
+	err = conn.Invoke(callCtx, rt.fullMethod, in, out, grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		setErrorResponse(ctx, err, header, trailer)
+		return resultServerError
+	}
+
+	opts := protojson.MarshalOptions{
+		UseProtoNames:   gt.spec.UseProtoNames,
+		EmitUnpopulated: gt.spec.EmitUnpopulated,
+	}
+	data, err := encodeResponse(rt, out, opts)
+	if err != nil {
+		setErrorResponse(ctx, status.Error(codes.Internal, err.Error()))
+		return resultServerError
+	}
+
+	setResponse(ctx, http.StatusOK, data, header, trailer)
+	return ""
+}
+
+// Status returns status.
+func (gt *GRPCTranscoder) Status() interface{} { return nil }
+
+// Close closes GRPCTranscoder.
+func (gt *GRPCTranscoder) Close() {
+	for _, conn := range gt.conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,411 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpctranscoder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+	label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	if repeated {
+		label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	}
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     typ.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+func httpOptions(rule *annotations.HttpRule) *descriptorpb.MethodOptions {
+	opts := &descriptorpb.MethodOptions{}
+	proto.SetExtension(opts, annotations.E_Http, rule)
+	return opts
+}
+
+// libraryDescriptorSet returns the descriptor set of:
+//
+//	package test.v1;
+//	message Book { int64 id = 1; string title = 2; string shelf = 3; repeated string tags = 4; }
+//	message GetBookRequest { string shelf = 1; int64 id = 2; repeated string tags = 3; }
+//	message CreateBookRequest { string shelf = 1; Book book = 2; }
+//	service Library {
+//	  rpc GetBook(GetBookRequest) returns (Book) { option (google.api.http) = { get: "/v1/shelves/{shelf}/books/{id}" }; }
+//	  rpc CreateBook(CreateBookRequest) returns (Book) { option (google.api.http) = { post: "/v1/shelves/{shelf}/books" body: "book" }; }
+//	  rpc Touch(GetBookRequest) returns (Book);
+//	}
+func libraryDescriptorSet() *descriptorpb.FileDescriptorSet {
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	i64 := descriptorpb.FieldDescriptorProto_TYPE_INT64
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/v1/library.proto"),
+		Package: proto.String("test.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Book"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, i64, "", false),
+					field("title", 2, str, "", false),
+					field("shelf", 3, str, "", false),
+					field("tags", 4, str, "", true),
+				},
+			},
+			{
+				Name: proto.String("GetBookRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("shelf", 1, str, "", false),
+					field("id", 2, i64, "", false),
+					field("tags", 3, str, "", true),
+				},
+			},
+			{
+				Name: proto.String("CreateBookRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("shelf", 1, str, "", false),
+					field("book", 2, msg, ".test.v1.Book", false),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Library"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{
+					Name:       proto.String("GetBook"),
+					InputType:  proto.String(".test.v1.GetBookRequest"),
+					OutputType: proto.String(".test.v1.Book"),
+					Options: httpOptions(&annotations.HttpRule{
+						Pattern: &annotations.HttpRule_Get{Get: "/v1/shelves/{shelf}/books/{id}"},
+					}),
+				},
+				{
+					Name:       proto.String("CreateBook"),
+					InputType:  proto.String(".test.v1.CreateBookRequest"),
+					OutputType: proto.String(".test.v1.Book"),
+					Options: httpOptions(&annotations.HttpRule{
+						Pattern: &annotations.HttpRule_Post{Post: "/v1/shelves/{shelf}/books"},
+						Body:    "book",
+					}),
+				},
+				{
+					Name:       proto.String("Touch"),
+					InputType:  proto.String(".test.v1.GetBookRequest"),
+					OutputType: proto.String(".test.v1.Book"),
+				},
+			},
+		}},
+	}
+
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}}
+}
+
+// startLibraryServer starts a gRPC server implementing the Library service
+// with dynamic messages.
+func startLibraryServer(t *testing.T) string {
+	files, err := protodesc.NewFiles(libraryDescriptorSet())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d, _ := files.FindDescriptorByName("test.v1.Library")
+	sd := d.(protoreflect.ServiceDescriptor)
+
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		fullMethod, _ := grpc.MethodFromServerStream(stream)
+		md := sd.Methods().ByName(protoreflect.Name(fullMethod[strings.LastIndex(fullMethod, "/")+1:]))
+		if md == nil {
+			return status.Error(codes.Unimplemented, "unknown method")
+		}
+
+		in := dynamicpb.NewMessage(md.Input())
+		if err := stream.RecvMsg(in); err != nil {
+			return err
+		}
+		fields := md.Input().Fields()
+
+		if incoming, ok := metadata.FromIncomingContext(stream.Context()); ok {
+			stream.SetHeader(metadata.Pairs("x-echo", strings.Join(incoming.Get("x-request-id"), ",")))
+		}
+
+		out := dynamicpb.NewMessage(md.Output())
+		outFields := md.Output().Fields()
+		switch md.Name() {
+		case "GetBook", "Touch":
+			id := in.Get(fields.ByName("id")).Int()
+			if id == 404 {
+				return status.Error(codes.NotFound, "book not found")
+			}
+			out.Set(outFields.ByName("id"), protoreflect.ValueOfInt64(id))
+			out.Set(outFields.ByName("shelf"), in.Get(fields.ByName("shelf")))
+			out.Set(outFields.ByName("title"), protoreflect.ValueOfString(fmt.Sprintf("book-%d", id)))
+			tags := out.Mutable(outFields.ByName("tags")).List()
+			inTags := in.Get(fields.ByName("tags")).List()
+			for i := 0; i < inTags.Len(); i++ {
+				tags.Append(inTags.Get(i))
+			}
+		case "CreateBook":
+			book := in.Get(fields.ByName("book")).Message()
+			book.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+				out.Set(outFields.ByNumber(fd.Number()), v)
+				return true
+			})
+			out.Set(outFields.ByName("shelf"), in.Get(fields.ByName("shelf")))
+		}
+		return stream.SendMsg(out)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := grpc.NewServer(grpc.UnknownServiceHandler(handler))
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	return l.Addr().String()
+}
+
+func newTranscoder(t *testing.T, yamlConfig string) *GRPCTranscoder {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gt := kind.CreateInstance(spec).(*GRPCTranscoder)
+	gt.Init()
+	t.Cleanup(gt.Close)
+	return gt
+}
+
+func descriptorSetBase64(t *testing.T) string {
+	data, err := proto.Marshal(libraryDescriptorSet())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func handle(gt *GRPCTranscoder, method, url, body string, header http.Header) (string, *httpprot.Response) {
+	stdr, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	result := gt.Handle(ctx)
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	return result, resp
+}
+
+func TestTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	pt, err := compileTemplate("/v1/{name=shelves/*/books/*}:publish")
+	assert.Nil(err)
+	vars, ok := pt.match("/v1/shelves/s1/books/b1:publish")
+	assert.True(ok)
+	assert.Equal(map[string]string{"name": "shelves/s1/books/b1"}, vars)
+	_, ok = pt.match("/v1/shelves/s1/books/b1")
+	assert.False(ok)
+
+	pt, err = compileTemplate("/v1/files/{path=**}")
+	assert.Nil(err)
+	vars, ok = pt.match("/v1/files/a/b/c.txt")
+	assert.True(ok)
+	assert.Equal("a/b/c.txt", vars["path"])
+
+	pt, err = compileTemplate("/v1/{book.id}/*")
+	assert.Nil(err)
+	vars, ok = pt.match("/v1/7/x")
+	assert.True(ok)
+	assert.Equal("7", vars["book.id"])
+
+	for _, bad := range []string{"v1/a", "/v1/{a", "/v1//a", "/v1/a/", "/v1/{a=}", "/v1/{=a}", "/v1/{a={b}}"} {
+		_, err = compileTemplate(bad)
+		assert.NotNil(err, bad)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	newSpec := func(yamlConfig string) error {
+		rawSpec := make(map[string]interface{})
+		codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		return err
+	}
+
+	desc := descriptorSetBase64(t)
+	assert.NotNil(newSpec(`
+name: transcoder
+kind: GRPCTranscoder
+servers: ["127.0.0.1:1"]
+`))
+	assert.NotNil(newSpec(`
+name: transcoder
+kind: GRPCTranscoder
+servers: ["127.0.0.1:1"]
+descriptorSet: ` + desc + `
+disableAnnotations: true
+`))
+	assert.NotNil(newSpec(`
+name: transcoder
+kind: GRPCTranscoder
+servers: ["127.0.0.1:1"]
+descriptorSet: ` + desc + `
+rules:
+- method: test.v1.Library/Missing
+  httpMethod: GET
+  path: /v1/missing
+`))
+	assert.NotNil(newSpec(`
+name: transcoder
+kind: GRPCTranscoder
+servers: ["127.0.0.1:1"]
+descriptorSet: ` + desc + `
+rules:
+- method: test.v1.Library/Touch
+  httpMethod: POST
+  path: /v1/{unknown}:touch
+`))
+	assert.Nil(newSpec(`
+name: transcoder
+kind: GRPCTranscoder
+servers: ["127.0.0.1:1"]
+descriptorSet: ` + desc + `
+rules:
+- method: test.v1.Library/Touch
+  httpMethod: POST
+  path: /v1/shelves/{shelf}/books/{id}:touch
+`))
+}
+
+func TestTranscode(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := startLibraryServer(t)
+	gt := newTranscoder(t, `
+name: transcoder
+kind: GRPCTranscoder
+servers: ["`+addr+`"]
+timeout: 5s
+descriptorSet: `+descriptorSetBase64(t)+`
+rules:
+- method: test.v1.Library/Touch
+  httpMethod: POST
+  path: /v1/shelves/{shelf}/books/{id}:touch
+  responseBody: title
+`)
+
+	header := http.Header{"X-Request-Id": []string{"abc"}}
+	result, resp := handle(gt, http.MethodGet, "http://example.com/v1/shelves/s1/books/7?tags=a&tags=b", "", header)
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+	assert.Equal("abc", resp.HTTPHeader().Get("Grpc-Metadata-X-Echo"))
+	assert.JSONEq(`{"id":"7","title":"book-7","shelf":"s1","tags":["a","b"]}`, string(resp.RawPayload()))
+
+	result, resp = handle(gt, http.MethodPost, "http://example.com/v1/shelves/s2/books", `{"id":"9","title":"new"}`, nil)
+	assert.Equal("", result)
+	assert.JSONEq(`{"id":"9","title":"new","shelf":"s2"}`, string(resp.RawPayload()))
+
+	result, resp = handle(gt, http.MethodPost, "http://example.com/v1/shelves/s1/books/8:touch", "", nil)
+	assert.Equal("", result)
+	assert.Equal(`"book-8"`, string(resp.RawPayload()))
+
+	result, resp = handle(gt, http.MethodGet, "http://example.com/v1/shelves/s1/books/404", "", nil)
+	assert.Equal(resultServerError, result)
+	assert.Equal(http.StatusNotFound, resp.StatusCode())
+	assert.JSONEq(`{"code":5,"message":"book not found"}`, string(resp.RawPayload()))
+
+	result, resp = handle(gt, http.MethodGet, "http://example.com/v1/shelves/s1/books/abc", "", nil)
+	assert.Equal(resultClientError, result)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode())
+
+	result, _ = handle(gt, http.MethodGet, "http://example.com/v1/shelves/s1/books/7?unknown=1", "", nil)
+	assert.Equal(resultClientError, result)
+
+	result, _ = handle(gt, http.MethodPost, "http://example.com/v1/shelves/s1/books", `{"unknown":1}`, nil)
+	assert.Equal(resultClientError, result)
+
+	result, _ = handle(gt, http.MethodDelete, "http://example.com/v1/shelves/s1/books/7", "", nil)
+	assert.Equal(resultNotMatched, result)
+}
+
+func TestTranscodeUnavailable(t *testing.T) {
+	assert := assert.New(t)
+
+	gt := newTranscoder(t, `
+name: transcoder
+kind: GRPCTranscoder
+servers: ["127.0.0.1:1"]
+timeout: 1s
+descriptorSet: `+descriptorSetBase64(t)+`
+discardUnknown: true
+`)
+
+	result, resp := handle(gt, http.MethodGet, "http://example.com/v1/shelves/s1/books/7?unknown=1", "", nil)
+	assert.Equal(resultServerError, result)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode())
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpctranscoder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// route binds an HTTP method and path template to a gRPC method.
+type route struct {
+	httpMethod   string
+	template     *pathTemplate
+	method       protoreflect.MethodDescriptor
+	fullMethod   string
+	body         string
+	responseBody string
+}
+
+func (s *Spec) loadDescriptors() (*protoregistry.Files, error) {
+	var data []byte
+	var err error
+
+	switch {
+	case s.DescriptorSet != "":
+		data, err = base64.StdEncoding.DecodeString(s.DescriptorSet)
+		if err != nil {
+			return nil, fmt.Errorf("decode descriptor set: %v", err)
+		}
+	case s.DescriptorSetFile != "":
+		data, err = os.ReadFile(s.DescriptorSetFile)
+		if err != nil {
+			return nil, fmt.Errorf("read descriptor set: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("descriptorSet or descriptorSetFile is required")
+	}
+
+	// The google.api.http extension is registered by the annotations
+	// package, so it is decoded into the method options here.
+	set := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("unmarshal descriptor set: %v", err)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("build descriptors: %v", err)
+	}
+	return files, nil
+}
+
+// buildRoutes builds the routes from the rules of the spec and the
+// google.api.http annotations in the descriptors, routes from the rules
+// take precedence.
+func (s *Spec) buildRoutes() ([]*route, error) {
+	files, err := s.loadDescriptors()
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []*route
+	for i, r := range s.Rules {
+		rt, err := newRoute(files, r.Method, r.HTTPMethod, r.Path, r.Body, r.ResponseBody)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		routes = append(routes, rt)
+	}
+
+	if s.DisableAnnotations {
+		return routes, nil
+	}
+
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				var rts []*route
+				rts, err = annotatedRoutes(files, methods.Get(j))
+				if err != nil {
+					return false
+				}
+				routes = append(routes, rts...)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return routes, nil
+}
+
+func annotatedRoutes(files *protoregistry.Files, md protoreflect.MethodDescriptor) ([]*route, error) {
+	opts, ok := md.Options().(*descriptorpb.MethodOptions)
+	if !ok || opts == nil || !proto.HasExtension(opts, annotations.E_Http) {
+		return nil, nil
+	}
+	// Streaming methods can't be transcoded, their annotations are ignored.
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, nil
+	}
+
+	rule := proto.GetExtension(opts, annotations.E_Http).(*annotations.HttpRule)
+	bindings := append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+
+	var routes []*route
+	for _, b := range bindings {
+		var httpMethod, path string
+		switch p := b.GetPattern().(type) {
+		case *annotations.HttpRule_Get:
+			httpMethod, path = http.MethodGet, p.Get
+		case *annotations.HttpRule_Put:
+			httpMethod, path = http.MethodPut, p.Put
+		case *annotations.HttpRule_Post:
+			httpMethod, path = http.MethodPost, p.Post
+		case *annotations.HttpRule_Delete:
+			httpMethod, path = http.MethodDelete, p.Delete
+		case *annotations.HttpRule_Patch:
+			httpMethod, path = http.MethodPatch, p.Patch
+		case *annotations.HttpRule_Custom:
+			httpMethod, path = p.Custom.GetKind(), p.Custom.GetPath()
+		default:
+			continue
+		}
+
+		rt, err := newRoute(files, string(md.FullName()), httpMethod, path, b.GetBody(), b.GetResponseBody())
+		if err != nil {
+			return nil, fmt.Errorf("annotation of %s: %v", md.FullName(), err)
+		}
+		routes = append(routes, rt)
+	}
+	return routes, nil
+}
+
+func newRoute(files *protoregistry.Files, method, httpMethod, path, body, responseBody string) (*route, error) {
+	name := strings.ReplaceAll(strings.TrimPrefix(method, "/"), "/", ".")
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("method %s not found", method)
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", method)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("streaming method %s is not supported", method)
+	}
+
+	template, err := compileTemplate(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range template.fields {
+		if _, err := findField(md.Input(), f); err != nil {
+			return nil, fmt.Errorf("path variable %s: %v", f, err)
+		}
+	}
+
+	if body != "" && body != "*" {
+		if md.Input().Fields().ByName(protoreflect.Name(body)) == nil {
+			return nil, fmt.Errorf("body field %s not found in %s", body, md.Input().FullName())
+		}
+	}
+	if responseBody != "" {
+		if md.Output().Fields().ByName(protoreflect.Name(responseBody)) == nil {
+			return nil, fmt.Errorf("response body field %s not found in %s", responseBody, md.Output().FullName())
+		}
+	}
+
+	return &route{
+		httpMethod:   strings.ToUpper(httpMethod),
+		template:     template,
+		method:       md,
+		fullMethod:   fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name()),
+		body:         body,
+		responseBody: responseBody,
+	}, nil
+}
+
+func (r *route) match(method, path string) (map[string]string, bool) {
+	if r.httpMethod != method {
+		return nil, false
+	}
+	return r.template.match(path)
+}
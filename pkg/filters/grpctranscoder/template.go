@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpctranscoder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pathTemplate is a compiled google.api.http path template, e.g.
+// "/v1/{name=shelves/*}/books/{book.id}:publish".
+type pathTemplate struct {
+	re     *regexp.Regexp
+	fields []string
+}
+
+func compileTemplate(t string) (*pathTemplate, error) {
+	if !strings.HasPrefix(t, "/") {
+		return nil, fmt.Errorf("template %q must start with /", t)
+	}
+
+	body, verb := t[1:], ""
+	if i := strings.LastIndex(body, ":"); i > strings.LastIndex(body, "/") && i > strings.LastIndex(body, "}") {
+		body, verb = body[:i], body[i+1:]
+		if verb == "" {
+			return nil, fmt.Errorf("template %q has an empty verb", t)
+		}
+	}
+
+	pt := &pathTemplate{}
+	pattern, err := pt.parseSegments(body, true)
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %v", t, err)
+	}
+	if verb != "" {
+		pattern += ":" + regexp.QuoteMeta(verb)
+	}
+
+	pt.re, err = regexp.Compile("^/" + pattern + "$")
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %v", t, err)
+	}
+	return pt, nil
+}
+
+// parseSegments converts the segments to a regular expression, variables
+// are only allowed at the top level.
+func (pt *pathTemplate) parseSegments(s string, topLevel bool) (string, error) {
+	var parts []string
+
+	for len(s) > 0 {
+		var seg string
+		if s[0] == '{' {
+			if !topLevel {
+				return "", fmt.Errorf("nested variable")
+			}
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed variable")
+			}
+			seg, s = s[:end+1], s[end+1:]
+		} else {
+			end := strings.IndexByte(s, '/')
+			if end < 0 {
+				end = len(s)
+			}
+			seg, s = s[:end], s[end:]
+		}
+
+		if s != "" {
+			if s[0] != '/' {
+				return "", fmt.Errorf("unexpected %q after %q", s, seg)
+			}
+			s = s[1:]
+			if s == "" {
+				return "", fmt.Errorf("trailing slash")
+			}
+		}
+
+		part, err := pt.parseSegment(seg)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 0 {
+		return "", nil
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+func (pt *pathTemplate) parseSegment(seg string) (string, error) {
+	switch {
+	case seg == "":
+		return "", fmt.Errorf("empty segment")
+	case seg == "*":
+		return "[^/]+", nil
+	case seg == "**":
+		return ".+", nil
+	case seg[0] != '{':
+		return regexp.QuoteMeta(seg), nil
+	}
+
+	field, sub, hasSub := strings.Cut(seg[1:len(seg)-1], "=")
+	if field == "" {
+		return "", fmt.Errorf("variable without field path")
+	}
+	pt.fields = append(pt.fields, field)
+
+	if !hasSub {
+		return "([^/]+)", nil
+	}
+	pattern, err := pt.parseSegments(sub, false)
+	if err != nil {
+		return "", err
+	}
+	if pattern == "" {
+		return "", fmt.Errorf("variable %s has an empty pattern", field)
+	}
+	return "(" + pattern + ")", nil
+}
+
+// match returns the values of the variables if path matches the template.
+func (pt *pathTemplate) match(path string) (map[string]string, bool) {
+	m := pt.re.FindStringSubmatch(path)
+	if m == nil {
+		return nil, false
+	}
+
+	vars := make(map[string]string, len(pt.fields))
+	for i, f := range pt.fields {
+		vars[f] = m[i+1]
+	}
+	return vars, true
+}
@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpctranscoder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// findField resolves a dotted field path, each name could be either the
+// proto name or the JSON name of the field.
+func findField(md protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, error) {
+	var fds []protoreflect.FieldDescriptor
+
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		if md == nil {
+			return nil, fmt.Errorf("%s is not a message", strings.Join(names[:i], "."))
+		}
+
+		fields := md.Fields()
+		fd := fields.ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = fields.ByJSONName(name)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("field %s not found in %s", name, md.FullName())
+		}
+		if fd.IsMap() || (fd.IsList() && i < len(names)-1) {
+			return nil, fmt.Errorf("field %s can't be bound", name)
+		}
+
+		fds = append(fds, fd)
+		md = fd.Message()
+	}
+
+	return fds, nil
+}
+
+// setField sets the field at path, all values are appended to repeated
+// fields, the last value wins for the others.
+func setField(msg protoreflect.Message, path string, values []string) error {
+	fds, err := findField(msg.Descriptor(), path)
+	if err != nil {
+		return err
+	}
+
+	for _, fd := range fds[:len(fds)-1] {
+		msg = msg.Mutable(fd).Message()
+	}
+
+	fd := fds[len(fds)-1]
+	if fd.IsList() {
+		list := msg.Mutable(fd).List()
+		for _, s := range values {
+			v, err := parseValue(fd, s)
+			if err != nil {
+				return fmt.Errorf("field %s: %v", path, err)
+			}
+			list.Append(v)
+		}
+		return nil
+	}
+
+	v, err := parseValue(fd, values[len(values)-1])
+	if err != nil {
+		return fmt.Errorf("field %s: %v", path, err)
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+func parseValue(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			b, err = base64.URLEncoding.DecodeString(s)
+		}
+		return protoreflect.ValueOfBytes(b), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid enum value %q", s)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	default:
+		// Messages are well known types like google.protobuf.Timestamp,
+		// whose JSON representation is a string or a number.
+		msg := dynamicpb.NewMessage(fd.Message())
+		err := protojson.Unmarshal([]byte(strconv.Quote(s)), msg)
+		if err != nil {
+			err = protojson.Unmarshal([]byte(s), msg)
+		}
+		return protoreflect.ValueOfMessage(msg), err
+	}
+}
+
+// buildRequest builds the request message from the body, the path
+// variables and the query parameters.
+func buildRequest(rt *route, body []byte, vars map[string]string, query url.Values, discardUnknown bool) (*dynamicpb.Message, error) {
+	msg := dynamicpb.NewMessage(rt.method.Input())
+	opts := protojson.UnmarshalOptions{DiscardUnknown: discardUnknown}
+
+	switch {
+	case rt.body == "" || len(body) == 0:
+	case rt.body == "*":
+		if err := opts.Unmarshal(body, msg); err != nil {
+			return nil, fmt.Errorf("unmarshal body: %v", err)
+		}
+	default:
+		fd := rt.method.Input().Fields().ByName(protoreflect.Name(rt.body))
+		wrapped := fmt.Sprintf(`{%q:%s}`, fd.JSONName(), body)
+		if err := opts.Unmarshal([]byte(wrapped), msg); err != nil {
+			return nil, fmt.Errorf("unmarshal body: %v", err)
+		}
+	}
+
+	for f, v := range vars {
+		if err := setField(msg, f, []string{v}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Query parameters are not bound if the whole body is mapped to the
+	// request message.
+	if rt.body == "*" {
+		return msg, nil
+	}
+	for k, v := range query {
+		if _, ok := vars[k]; ok || len(v) == 0 {
+			continue
+		}
+		if _, err := findField(rt.method.Input(), k); err != nil {
+			if discardUnknown {
+				continue
+			}
+			return nil, fmt.Errorf("query parameter %s: %v", k, err)
+		}
+		if err := setField(msg, k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+// encodeResponse encodes the response message, or the response body field
+// of it, to JSON.
+func encodeResponse(rt *route, msg *dynamicpb.Message, opts protojson.MarshalOptions) ([]byte, error) {
+	if rt.responseBody == "" {
+		return opts.Marshal(msg)
+	}
+
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(rt.responseBody))
+	opts.EmitUnpopulated = true
+	data, err := opts.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	key := fd.JSONName()
+	if opts.UseProtoNames {
+		key = string(fd.Name())
+	}
+	return fields[key], nil
+}
+
+// encodeError encodes err as a google.rpc.Status in JSON.
+func encodeError(err error) (int, []byte) {
+	st := status.Convert(err)
+	data, e := protojson.Marshal(st.Proto())
+	if e != nil {
+		// The details may refer to unknown types.
+		p := st.Proto()
+		p.Details = nil
+		data, _ = protojson.Marshal(p)
+	}
+	return httpStatus(st.Code()), data
+}
+
+// httpStatus maps a gRPC code to the HTTP status code, as described in
+// google/rpc/code.proto.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
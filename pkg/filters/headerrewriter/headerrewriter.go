@@ -0,0 +1,317 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package headerrewriter provides the HeaderRewriter filter.
+package headerrewriter
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	sprig "github.com/go-task/slim-sprig"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of HeaderRewriter.
+	Kind = "HeaderRewriter"
+
+	resultTemplateErr = "templateErr"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "HeaderRewriter adds, removes and rewrites headers of requests and responses with templates.",
+	Results:     []string{resultTemplateErr},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &HeaderRewriter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// HeaderRewriter is filter HeaderRewriter.
+	HeaderRewriter struct {
+		spec *Spec
+
+		request  *rules
+		response *rules
+	}
+
+	// Spec describes the HeaderRewriter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		LeftDelim  string    `json:"leftDelim,omitempty"`
+		RightDelim string    `json:"rightDelim,omitempty"`
+		Request    *RuleSpec `json:"request,omitempty"`
+		Response   *RuleSpec `json:"response,omitempty"`
+	}
+
+	// RuleSpec describes how to manipulate the headers, the values of Set
+	// and Add are templates.
+	RuleSpec struct {
+		Rename map[string]string `json:"rename,omitempty"`
+		Remove []string          `json:"remove,omitempty" jsonschema:"uniqueItems=true"`
+		Set    map[string]string `json:"set,omitempty"`
+		Add    map[string]string `json:"add,omitempty"`
+	}
+
+	rules struct {
+		spec *RuleSpec
+		set  map[string]*value
+		add  map[string]*value
+	}
+
+	// value is the value of a header, which is a static string or a
+	// template.
+	value struct {
+		static   string
+		template *template.Template
+	}
+
+	// templateData is the data of the templates, the headers are the
+	// ones before any modification.
+	templateData struct {
+		Method     string
+		Scheme     string
+		Host       string
+		Path       string
+		Query      url.Values
+		ClientIP   string
+		Header     http.Header
+		Params     map[string]string
+		StatusCode int
+		RespHeader http.Header
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Request == nil && spec.Response == nil {
+		return fmt.Errorf("neither request nor response is specified")
+	}
+	if _, err := spec.newRules(spec.Request); err != nil {
+		return fmt.Errorf("invalid request rules: %v", err)
+	}
+	if _, err := spec.newRules(spec.Response); err != nil {
+		return fmt.Errorf("invalid response rules: %v", err)
+	}
+	return nil
+}
+
+func (spec *Spec) newRules(rs *RuleSpec) (*rules, error) {
+	if rs == nil {
+		return nil, nil
+	}
+
+	r := &rules{spec: rs}
+	var err error
+	if r.set, err = spec.newValues(rs.Set); err != nil {
+		return nil, err
+	}
+	if r.add, err = spec.newValues(rs.Add); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (spec *Spec) newValues(m map[string]string) (map[string]*value, error) {
+	leftDelim := spec.LeftDelim
+	if leftDelim == "" {
+		leftDelim = "{{"
+	}
+
+	values := make(map[string]*value, len(m))
+	for k, v := range m {
+		if !strings.Contains(v, leftDelim) {
+			values[k] = &value{static: v}
+			continue
+		}
+
+		t := template.New(k).Delims(spec.LeftDelim, spec.RightDelim)
+		t.Funcs(sprig.TxtFuncMap())
+		t, err := t.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template of header %s: %v", k, err)
+		}
+		values[k] = &value{template: t}
+	}
+	return values, nil
+}
+
+// Name returns the name of the HeaderRewriter filter instance.
+func (hr *HeaderRewriter) Name() string {
+	return hr.spec.Name()
+}
+
+// Kind returns the kind of HeaderRewriter.
+func (hr *HeaderRewriter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the HeaderRewriter
+func (hr *HeaderRewriter) Spec() filters.Spec {
+	return hr.spec
+}
+
+// Init initializes HeaderRewriter.
+func (hr *HeaderRewriter) Init() {
+	hr.reload()
+}
+
+// Inherit inherits previous generation of HeaderRewriter.
+func (hr *HeaderRewriter) Inherit(_ filters.Filter) {
+	hr.reload()
+}
+
+func (hr *HeaderRewriter) reload() {
+	var err error
+	if hr.request, err = hr.spec.newRules(hr.spec.Request); err != nil {
+		logger.Errorf("BUG: %v", err)
+	}
+	if hr.response, err = hr.spec.newRules(hr.spec.Response); err != nil {
+		logger.Errorf("BUG: %v", err)
+	}
+}
+
+// Handle rewrites the headers of the request, and the response if there
+// is one.
+func (hr *HeaderRewriter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+
+	data := newTemplateData(ctx, req, resp)
+
+	if hr.request != nil {
+		if err := hr.request.apply(req.HTTPHeader(), data); err != nil {
+			logger.Errorf("%s: failed to rewrite request headers: %v", hr.Name(), err)
+			return resultTemplateErr
+		}
+	}
+
+	if hr.response != nil && resp != nil {
+		if err := hr.response.apply(resp.HTTPHeader(), data); err != nil {
+			logger.Errorf("%s: failed to rewrite response headers: %v", hr.Name(), err)
+			return resultTemplateErr
+		}
+	}
+
+	return ""
+}
+
+func newTemplateData(ctx *context.Context, req *httpprot.Request, resp *httpprot.Response) *templateData {
+	data := &templateData{
+		Method:   req.Method(),
+		Scheme:   req.Scheme(),
+		Host:     req.Host(),
+		Path:     req.Path(),
+		Query:    req.URL().Query(),
+		ClientIP: req.RealIP(),
+		Header:   req.HTTPHeader().Clone(),
+	}
+	data.Params, _ = ctx.GetData("HTTP_ROUTE_PARAMS").(map[string]string)
+	if resp != nil {
+		data.StatusCode = resp.StatusCode()
+		data.RespHeader = resp.HTTPHeader().Clone()
+	}
+	return data
+}
+
+// apply evaluates all the values first, so the templates always see the
+// original headers, and then renames, removes, sets and adds the headers
+// in order.
+func (r *rules) apply(h http.Header, data *templateData) error {
+	set, err := evaluate(r.set, data)
+	if err != nil {
+		return err
+	}
+	add, err := evaluate(r.add, data)
+	if err != nil {
+		return err
+	}
+
+	for from, to := range r.spec.Rename {
+		if vs := h.Values(from); len(vs) > 0 {
+			vs = append([]string(nil), vs...)
+			h.Del(from)
+			h[http.CanonicalHeaderKey(to)] = vs
+		}
+	}
+	for _, k := range r.spec.Remove {
+		h.Del(k)
+	}
+	for k, v := range set {
+		// an empty value removes the header, so the templates can decide
+		// whether to set a header.
+		if v == "" {
+			h.Del(k)
+		} else {
+			h.Set(k, v)
+		}
+	}
+	for k, v := range add {
+		if v != "" {
+			h.Add(k, v)
+		}
+	}
+	return nil
+}
+
+var lineBreakReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+func evaluate(values map[string]*value, data *templateData) (map[string]string, error) {
+	result := make(map[string]string, len(values))
+	var buf bytes.Buffer
+	for k, v := range values {
+		if v.template == nil {
+			result[k] = v.static
+			continue
+		}
+
+		buf.Reset()
+		if err := v.template.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		// line breaks are not allowed in header values.
+		result[k] = strings.TrimSpace(lineBreakReplacer.Replace(buf.String()))
+	}
+	return result, nil
+}
+
+// Status returns status.
+func (hr *HeaderRewriter) Status() interface{} {
+	return nil
+}
+
+// Close closes HeaderRewriter.
+func (hr *HeaderRewriter) Close() {
+}
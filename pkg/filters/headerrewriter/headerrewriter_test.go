@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package headerrewriter
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newSpec(yamlConfig string) (filters.Spec, error) {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	return filters.NewSpec(nil, "", rawSpec)
+}
+
+func newHeaderRewriter(t *testing.T, yamlConfig string) *HeaderRewriter {
+	spec, err := newSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hr := kind.CreateInstance(spec).(*HeaderRewriter)
+	hr.Init()
+	return hr
+}
+
+func newContext() *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/users/123?lang=en", nil)
+	stdr.RemoteAddr = "192.168.1.1:1234"
+	stdr.Header.Set("Authorization", "Bearer token")
+	stdr.Header.Set("X-Old", "old")
+	stdr.Header.Set("X-Debug", "1")
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newSpec("kind: HeaderRewriter\nname: hr")
+	assert.NotNil(err)
+
+	_, err = newSpec("kind: HeaderRewriter\nname: hr\nrequest:\n  set:\n    X-Foo: '{{ .Header.Get '")
+	assert.NotNil(err)
+
+	_, err = newSpec("kind: HeaderRewriter\nname: hr\nresponse:\n  add:\n    X-Foo: '{{ .Header.Get \"X-Bar\" }}'")
+	assert.Nil(err)
+}
+
+func TestRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	hr := newHeaderRewriter(t, `
+kind: HeaderRewriter
+name: hr
+request:
+  rename:
+    X-Old: X-New
+  remove: [X-Debug]
+  set:
+    X-Request-ID: '{{ .Header.Get "X-Request-ID" | default uuidv4 }}'
+    X-Client-IP: '{{ .ClientIP }}'
+    X-Token: '{{ .Header.Get "Authorization" | trimPrefix "Bearer " }}'
+    X-User-ID: '{{ .Params.id }}'
+    X-Lang: '{{ .Query.Get "lang" }}'
+    X-Timestamp: '{{ now | unixEpoch }}'
+    X-Empty: '{{ .Header.Get "X-Nothing" }}'
+    X-Static: static
+  add:
+    X-Route: '{{ .Method }} {{ .Host }}{{ .Path }}'
+`)
+
+	ctx := newContext()
+	ctx.SetData("HTTP_ROUTE_PARAMS", map[string]string{"id": "123"})
+	assert.Equal("", hr.Handle(ctx))
+
+	h := ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	assert.Equal("", h.Get("X-Old"))
+	assert.Equal("old", h.Get("X-New"))
+	assert.Equal("", h.Get("X-Debug"))
+	assert.Regexp(regexp.MustCompile("^[0-9a-f-]{36}$"), h.Get("X-Request-ID"))
+	assert.Equal("192.168.1.1", h.Get("X-Client-IP"))
+	assert.Equal("token", h.Get("X-Token"))
+	assert.Equal("123", h.Get("X-User-ID"))
+	assert.Equal("en", h.Get("X-Lang"))
+	ts, err := strconv.ParseInt(h.Get("X-Timestamp"), 10, 64)
+	assert.Nil(err)
+	assert.InDelta(time.Now().Unix(), ts, 5)
+	assert.Empty(h.Values("X-Empty"))
+	assert.Equal("static", h.Get("X-Static"))
+	assert.Equal("GET example.com/users/123", h.Get("X-Route"))
+
+	// an existing request ID is kept.
+	ctx = newContext()
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Request-ID", "abc")
+	assert.Equal("", hr.Handle(ctx))
+	assert.Equal("abc", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Request-ID"))
+}
+
+func TestResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	hr := newHeaderRewriter(t, `
+kind: HeaderRewriter
+name: hr
+leftDelim: "[["
+rightDelim: "]]"
+response:
+  remove: [Server]
+  set:
+    X-Status: '[[ .StatusCode ]]'
+    X-Request-ID: '[[ .Header.Get "X-Request-ID" ]]'
+    X-Cache: '[[ if eq (.RespHeader.Get "Age") "" ]]miss[[ else ]]hit[[ end ]]'
+`)
+
+	// no response, nothing to do.
+	ctx := newContext()
+	assert.Equal("", hr.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+
+	ctx = newContext()
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Request-ID", "abc")
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusCreated)
+	resp.HTTPHeader().Set("Server", "backend")
+	ctx.SetOutputResponse(resp)
+
+	assert.Equal("", hr.Handle(ctx))
+	h := resp.HTTPHeader()
+	assert.Equal("", h.Get("Server"))
+	assert.Equal("201", h.Get("X-Status"))
+	assert.Equal("abc", h.Get("X-Request-ID"))
+	assert.Equal("miss", h.Get("X-Cache"))
+}
+
+func TestTemplateError(t *testing.T) {
+	assert := assert.New(t)
+
+	hr := newHeaderRewriter(t, `
+kind: HeaderRewriter
+name: hr
+request:
+  set:
+    X-Foo: '{{ .Unknown }}'
+`)
+	assert.Equal(resultTemplateErr, hr.Handle(newContext()))
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ipfilter provides the IPFilter filter.
+package ipfilter
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	ipfilterutil "github.com/megaease/easegress/v2/pkg/util/ipfilter"
+)
+
+const (
+	// Kind is the kind of IPFilter.
+	Kind = "IPFilter"
+
+	resultDenied = "denied"
+
+	defaultForwardedHeader = "X-Forwarded-For"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "IPFilter allows or denies requests by the IP of the client.",
+	Results:     []string{resultDenied},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &IPFilter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// IPFilter is filter IPFilter.
+	IPFilter struct {
+		spec *Spec
+
+		static         *ipfilterutil.IPFilter
+		dynamic        atomic.Pointer[ipfilterutil.IPFilter]
+		trustedProxies *ipfilterutil.IPFilter
+
+		cluster cluster.Cluster
+		stopCtx stdcontext.Context
+		cancel  stdcontext.CancelFunc
+	}
+
+	// Spec describes the IPFilter.
+	Spec struct {
+		filters.BaseSpec  `json:",inline"`
+		ipfilterutil.Spec `json:",inline"`
+
+		TrustedProxies  []string `json:"trustedProxies,omitempty" jsonschema:"uniqueItems=true,format=ipcidr-array"`
+		TrustedHops     int      `json:"trustedHops,omitempty" jsonschema:"minimum=0"`
+		ForwardedHeader string   `json:"forwardedHeader,omitempty"`
+		DynamicListKind string   `json:"dynamicListKind,omitempty"`
+	}
+)
+
+// Validate validates the spec of IPFilter.
+func (spec *Spec) Validate() error {
+	if len(spec.TrustedProxies) > 0 && spec.TrustedHops > 0 {
+		return fmt.Errorf("trustedProxies and trustedHops can't be both specified")
+	}
+	return nil
+}
+
+// Name returns the name of the IPFilter filter instance.
+func (f *IPFilter) Name() string {
+	return f.spec.Name()
+}
+
+// Kind returns the kind of IPFilter.
+func (f *IPFilter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the IPFilter.
+func (f *IPFilter) Spec() filters.Spec {
+	return f.spec
+}
+
+// Init initializes IPFilter.
+func (f *IPFilter) Init() {
+	f.reload()
+}
+
+// Inherit inherits previous generation of IPFilter.
+func (f *IPFilter) Inherit(_ filters.Filter) {
+	f.Init()
+}
+
+func (f *IPFilter) reload() {
+	f.static = ipfilterutil.New(&f.spec.Spec)
+
+	if len(f.spec.TrustedProxies) > 0 {
+		f.trustedProxies = ipfilterutil.New(&ipfilterutil.Spec{
+			BlockByDefault: true,
+			AllowIPs:       f.spec.TrustedProxies,
+		})
+	}
+
+	f.stopCtx, f.cancel = stdcontext.WithCancel(stdcontext.Background())
+	if f.spec.DynamicListKind == "" {
+		return
+	}
+	if f.spec.Super() == nil || f.spec.Super().Cluster() == nil {
+		logger.Errorf("%s: no cluster to watch the dynamic list", f.Name())
+		return
+	}
+	f.cluster = f.spec.Super().Cluster()
+	go f.watchDynamicList()
+}
+
+func (f *IPFilter) watchDynamicList() {
+	var (
+		syncer cluster.Syncer
+		err    error
+		ch     <-chan map[string]string
+	)
+
+	prefix := f.cluster.Layout().CustomDataPrefix() + f.spec.DynamicListKind + "/"
+	for {
+		syncer, err = f.cluster.Syncer(time.Minute)
+		if err != nil {
+			logger.Errorf("failed to create syncer: %v", err)
+		} else if ch, err = syncer.SyncPrefix(prefix); err != nil {
+			logger.Errorf("failed to sync prefix: %v", err)
+			syncer.Close()
+		} else {
+			break
+		}
+
+		select {
+		case <-time.After(10 * time.Second):
+		case <-f.stopCtx.Done():
+			return
+		}
+	}
+
+	defer syncer.Close()
+
+	for {
+		select {
+		case <-f.stopCtx.Done():
+			return
+		case kvs := <-ch:
+			logger.Infof("%s: dynamic ip list updated", f.Name())
+			f.dynamic.Store(f.buildDynamicFilter(kvs))
+		}
+	}
+}
+
+// buildDynamicFilter merges the IP lists of all custom data items, each
+// item has the allowIPs and blockIPs fields.
+func (f *IPFilter) buildDynamicFilter(kvs map[string]string) *ipfilterutil.IPFilter {
+	spec := &ipfilterutil.Spec{}
+	for key, value := range kvs {
+		item := &ipfilterutil.Spec{}
+		if err := codectool.Unmarshal([]byte(value), item); err != nil {
+			logger.Warnf("%s: invalid dynamic ip list %s: %v", f.Name(), key, err)
+			continue
+		}
+		spec.AllowIPs = append(spec.AllowIPs, validIPs(key, item.AllowIPs)...)
+		spec.BlockIPs = append(spec.BlockIPs, validIPs(key, item.BlockIPs)...)
+	}
+
+	if len(spec.AllowIPs) == 0 && len(spec.BlockIPs) == 0 {
+		return nil
+	}
+	return ipfilterutil.New(spec)
+}
+
+func validIPs(key string, ips []string) []string {
+	result := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if net.ParseIP(ip) != nil {
+			result = append(result, ip)
+		} else if _, _, err := net.ParseCIDR(ip); err == nil {
+			result = append(result, ip)
+		} else {
+			logger.Warnf("invalid ip or cidr %s in dynamic ip list %s", ip, key)
+		}
+	}
+	return result
+}
+
+// Handle allows or denies the request by the IP of the client.
+func (f *IPFilter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	ip := f.clientIP(req)
+	if f.static.Allow(ip) && f.dynamic.Load().Allow(ip) {
+		return ""
+	}
+
+	logger.Debugf("%s: request from %s is denied", f.Name(), ip)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusForbidden)
+	ctx.SetOutputResponse(resp)
+	return resultDenied
+}
+
+// clientIP derives the IP of the client. Without trusted proxies, it is
+// the IP of the peer. Otherwise, the forwarded header is walked from right
+// to left, skipping the trusted proxies, or the specified number of hops.
+func (f *IPFilter) clientIP(req *httpprot.Request) string {
+	peer := req.Std().RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+
+	if f.trustedProxies == nil && f.spec.TrustedHops == 0 {
+		return peer
+	}
+
+	header := f.spec.ForwardedHeader
+	if header == "" {
+		header = defaultForwardedHeader
+	}
+
+	var forwarded []string
+	for _, v := range req.HTTPHeader().Values(header) {
+		for _, ip := range strings.Split(v, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				forwarded = append(forwarded, ip)
+			}
+		}
+	}
+	if len(forwarded) == 0 {
+		return peer
+	}
+
+	if f.trustedProxies != nil {
+		if !f.trustedProxies.Allow(peer) {
+			return peer
+		}
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			if !f.trustedProxies.Allow(forwarded[i]) {
+				return forwarded[i]
+			}
+		}
+		return forwarded[0]
+	}
+
+	// The peer is the nearest proxy, and every proxy appends the IP of
+	// its peer, so the client is the last but (hops - 1) one.
+	if i := len(forwarded) - f.spec.TrustedHops; i >= 0 {
+		return forwarded[i]
+	}
+	return forwarded[0]
+}
+
+// Status returns status.
+func (f *IPFilter) Status() interface{} {
+	return nil
+}
+
+// Close closes IPFilter.
+func (f *IPFilter) Close() {
+	f.cancel()
+}
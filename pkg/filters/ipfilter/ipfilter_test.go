@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ipfilter
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newFilter(t *testing.T, yamlConfig string) *IPFilter {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f := kind.CreateInstance(spec).(*IPFilter)
+	f.Init()
+	return f
+}
+
+func newContext(remoteAddr string, forwarded ...string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	stdr.RemoteAddr = remoteAddr
+	for _, v := range forwarded {
+		stdr.Header.Add("X-Forwarded-For", v)
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestIPFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFilter(t, `
+kind: IPFilter
+name: ipfilter
+blockIPs: [203.0.113.0/24, 2001:db8::1]
+`)
+	defer f.Close()
+
+	assert.Equal("", f.Handle(newContext("198.51.100.1:1234")))
+	assert.Equal(resultDenied, f.Handle(newContext("203.0.113.9:1234")))
+	assert.Equal(resultDenied, f.Handle(newContext("[2001:db8::1]:1234")))
+
+	// X-Forwarded-For is ignored without trusted proxies.
+	assert.Equal("", f.Handle(newContext("198.51.100.1:1234", "203.0.113.9")))
+
+	ctx := newContext("203.0.113.9:1234")
+	f.Handle(ctx)
+	assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	f = newFilter(t, `
+kind: IPFilter
+name: ipfilter
+allowIPs: [10.0.0.0/8]
+`)
+	defer f.Close()
+	assert.Equal("", f.Handle(newContext("10.1.2.3:1234")))
+	assert.Equal(resultDenied, f.Handle(newContext("11.1.2.3:1234")))
+}
+
+func TestTrustedProxies(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFilter(t, `
+kind: IPFilter
+name: ipfilter
+blockIPs: [203.0.113.9]
+trustedProxies: [10.0.0.0/8]
+`)
+	defer f.Close()
+
+	assert.Equal(resultDenied, f.Handle(newContext("10.0.0.1:1234", "203.0.113.9")))
+	assert.Equal(resultDenied, f.Handle(newContext("10.0.0.1:1234", "203.0.113.9, 10.0.0.2")))
+	assert.Equal(resultDenied, f.Handle(newContext("10.0.0.1:1234", "1.1.1.1", "203.0.113.9, 10.0.0.2")))
+
+	// spoofed by clients.
+	assert.Equal("", f.Handle(newContext("10.0.0.1:1234", "203.0.113.9, 198.51.100.1")))
+	assert.Equal("", f.Handle(newContext("198.51.100.1:1234", "203.0.113.9")))
+
+	assert.Equal("198.51.100.1", f.clientIP(newContext("10.0.0.1:1234", "198.51.100.1").GetInputRequest().(*httpprot.Request)))
+	assert.Equal("10.0.0.3", f.clientIP(newContext("10.0.0.1:1234", "10.0.0.3, 10.0.0.2").GetInputRequest().(*httpprot.Request)))
+
+	f = newFilter(t, `
+kind: IPFilter
+name: ipfilter
+blockIPs: [203.0.113.9]
+trustedHops: 2
+`)
+	defer f.Close()
+	assert.Equal(resultDenied, f.Handle(newContext("10.0.0.1:1234", "1.1.1.1, 203.0.113.9, 10.0.0.2")))
+	assert.Equal(resultDenied, f.Handle(newContext("10.0.0.1:1234", "203.0.113.9")))
+	assert.Equal("", f.Handle(newContext("10.0.0.1:1234", "203.0.113.9, 1.1.1.1, 10.0.0.2")))
+
+	spec := &Spec{TrustedProxies: []string{"10.0.0.0/8"}, TrustedHops: 1}
+	assert.Error(spec.Validate())
+}
+
+func TestDynamicList(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFilter(t, `
+kind: IPFilter
+name: ipfilter
+`)
+	defer f.Close()
+
+	f.dynamic.Store(f.buildDynamicFilter(map[string]string{
+		"/custom-data/blocklist/a": `{"name": "a", "blockIPs": ["203.0.113.0/24", "invalid"]}`,
+		"/custom-data/blocklist/b": `{"name": "b", "blockIPs": ["198.51.100.1"]}`,
+		"/custom-data/blocklist/c": `invalid`,
+	}))
+	assert.Equal(resultDenied, f.Handle(newContext("203.0.113.9:1234")))
+	assert.Equal(resultDenied, f.Handle(newContext("198.51.100.1:1234")))
+	assert.Equal("", f.Handle(newContext("198.51.100.2:1234")))
+
+	f.dynamic.Store(f.buildDynamicFilter(map[string]string{}))
+	assert.Equal("", f.Handle(newContext("203.0.113.9:1234")))
+
+	newF := kind.CreateInstance(f.spec)
+	newF.Inherit(f)
+	assert.Nil(newF.Status())
+	newF.Close()
+}
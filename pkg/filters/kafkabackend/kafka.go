@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/megaease/easegress/v2/pkg/context"
@@ -71,6 +72,13 @@ type (
 		Err  string `json:"err"`
 		Code int    `json:"code"`
 	}
+
+	// Ack is the acknowledgment of a message sent by SyncProducer.
+	Ack struct {
+		Topic     string `json:"topic"`
+		Partition int32  `json:"partition"`
+		Offset    int64  `json:"offset"`
+	}
 )
 
 var _ filters.Filter = (*Kafka)(nil)
@@ -105,15 +113,49 @@ func (k *Kafka) setHeader() {
 	}
 }
 
+func (k *Kafka) newConfig() *sarama.Config {
+	spec := k.spec
+
+	config := sarama.NewConfig()
+	config.ClientID = spec.Name()
+	config.Version = sarama.V1_0_0_0
+
+	switch spec.Acks {
+	case acksNone:
+		config.Producer.RequiredAcks = sarama.NoResponse
+	case acksAll:
+		config.Producer.RequiredAcks = sarama.WaitForAll
+	case acksLeader:
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+	}
+	if spec.Retries > 0 {
+		config.Producer.Retry.Max = spec.Retries
+	}
+	if spec.Idempotent {
+		// The idempotent producer requires one in-flight request per
+		// connection, so that the messages are not reordered by retries.
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
+	}
+
+	if b := spec.Batch; b != nil {
+		config.Producer.Flush.Messages = b.Messages
+		config.Producer.Flush.Bytes = b.Bytes
+		if b.FlushInterval != "" {
+			config.Producer.Flush.Frequency, _ = time.ParseDuration(b.FlushInterval)
+		}
+	}
+
+	return config
+}
+
 // Init init Kafka
 func (k *Kafka) Init() {
 	spec := k.spec
 	k.done = make(chan struct{})
 	k.setHeader()
 
-	config := sarama.NewConfig()
-	config.ClientID = spec.Name()
-	config.Version = sarama.V1_0_0_0
+	config := k.newConfig()
 	if spec.Sync {
 		config.Producer.Return.Successes = true
 		producer, err := sarama.NewSyncProducer(k.spec.Backend, config)
@@ -205,14 +247,19 @@ func (k *Kafka) Handle(ctx *context.Context) (result string) {
 	if key != "" {
 		msg.Key = sarama.StringEncoder(key)
 	}
+	for _, h := range k.spec.Headers {
+		for _, v := range req.HTTPHeader().Values(h) {
+			msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(h), Value: []byte(v)})
+		}
+	}
 
 	if k.spec.Sync {
-		_, _, err = k.syncProcuder.SendMessage(msg)
+		partition, offset, err := k.syncProcuder.SendMessage(msg)
 		if err != nil {
 			logger.Errorf("send message to kafka failed: %v", err)
 			setErrResponse(ctx, err)
 		} else {
-			setSuccessResponse(ctx)
+			setSuccessResponse(ctx, &Ack{Topic: topic, Partition: partition, Offset: offset})
 		}
 		return ""
 	}
@@ -221,12 +268,15 @@ func (k *Kafka) Handle(ctx *context.Context) (result string) {
 	return ""
 }
 
-func setSuccessResponse(ctx *context.Context) {
+func setSuccessResponse(ctx *context.Context, ack *Ack) {
 	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
 	if resp == nil {
 		resp, _ = httpprot.NewResponse(nil)
 	}
 	resp.SetStatusCode(http.StatusOK)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	data, _ := codectool.MarshalJSON(ack)
+	resp.SetPayload(data)
 	ctx.SetOutputResponse(resp)
 }
 
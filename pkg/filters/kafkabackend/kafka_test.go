@@ -23,6 +23,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/megaease/easegress/v2/pkg/context"
@@ -301,3 +302,69 @@ func TestHandleHTTPSync(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal("text", string(value))
 }
+
+func TestDeliveryOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Idempotent: true}
+	assert.NotNil(spec.Validate())
+	spec = &Spec{Batch: &Batch{FlushInterval: "abc"}}
+	assert.NotNil(spec.Validate())
+
+	spec = &Spec{
+		Acks:       acksAll,
+		Idempotent: true,
+		Retries:    5,
+		Batch: &Batch{
+			Messages:      100,
+			Bytes:         1024,
+			FlushInterval: "10ms",
+		},
+	}
+	assert.Nil(spec.Validate())
+	spec.BaseSpec.MetaSpec.Name = "kafka"
+
+	k := Kafka{spec: spec}
+	config := k.newConfig()
+	config.Producer.Return.Successes = true
+	assert.Nil(config.Validate())
+	assert.Equal(sarama.WaitForAll, config.Producer.RequiredAcks)
+	assert.True(config.Producer.Idempotent)
+	assert.Equal(5, config.Producer.Retry.Max)
+	assert.Equal(100, config.Producer.Flush.Messages)
+	assert.Equal(1024, config.Producer.Flush.Bytes)
+	assert.Equal(10*time.Millisecond, config.Producer.Flush.Frequency)
+
+	k.spec = &Spec{Acks: acksNone}
+	assert.Equal(sarama.NoResponse, k.newConfig().Producer.RequiredAcks)
+}
+
+func TestHandleHTTPSyncAck(t *testing.T) {
+	assert := assert.New(t)
+	kafka := Kafka{
+		spec: &Spec{
+			Sync:    true,
+			Topic:   &Topic{Default: "events"},
+			Headers: []string{"X-Request-Id"},
+		},
+		syncProcuder: newMockSyncProducer(),
+		done:         make(chan struct{}),
+	}
+	kafka.setHeader()
+	defer kafka.Close()
+
+	ctx := context.New(nil)
+	req, err := http.NewRequest(http.MethodPost, "127.0.0.1", strings.NewReader("text"))
+	assert.Nil(err)
+	req.Header.Add("X-Request-Id", "abc")
+	setRequest(t, ctx, req)
+
+	assert.Equal("", kafka.Handle(ctx))
+
+	msg := kafka.syncProcuder.(*mockSyncProducer).msgs[0]
+	assert.Equal([]sarama.RecordHeader{{Key: []byte("X-Request-Id"), Value: []byte("abc")}}, msg.Headers)
+
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.JSONEq(`{"topic":"events","partition":0,"offset":0}`, string(resp.RawPayload()))
+}
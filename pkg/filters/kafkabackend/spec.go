@@ -17,7 +17,18 @@
 
 package kafka
 
-import "github.com/megaease/easegress/v2/pkg/filters"
+import (
+	"fmt"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/filters"
+)
+
+const (
+	acksNone   = "none"
+	acksLeader = "leader"
+	acksAll    = "all"
+)
 
 type (
 	// Spec is spec of Kafka
@@ -29,6 +40,26 @@ type (
 
 		Topic *Topic `json:"topic" jsonschema:"required"`
 		Key   Key    `json:"key,omitempty"`
+
+		// Headers are the request headers copied to the message headers.
+		Headers []string `json:"headers,omitempty" jsonschema:"uniqueItems=true"`
+
+		// Acks is the acknowledgment required from the brokers, the
+		// leader is used if it is empty.
+		Acks string `json:"acks,omitempty" jsonschema:"enum=,enum=none,enum=leader,enum=all"`
+		// Idempotent makes the retries never write duplicated messages,
+		// it requires Acks to be all.
+		Idempotent bool   `json:"idempotent,omitempty"`
+		Retries    int    `json:"retries,omitempty" jsonschema:"minimum=0"`
+		Batch      *Batch `json:"batch,omitempty"`
+	}
+
+	// Batch defines how messages are batched before sent to the brokers,
+	// a batch is sent when any of the limits is reached.
+	Batch struct {
+		Messages      int    `json:"messages,omitempty" jsonschema:"minimum=0"`
+		Bytes         int    `json:"bytes,omitempty" jsonschema:"minimum=0"`
+		FlushInterval string `json:"flushInterval,omitempty" jsonschema:"format=duration"`
 	}
 
 	// Topic defined ways to get Kafka topic
@@ -48,3 +79,16 @@ type (
 		Dynamic *Dynamic `json:"dynamic,omitempty"`
 	}
 )
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	if s.Idempotent && s.Acks != acksAll {
+		return fmt.Errorf("idempotent requires acks to be all")
+	}
+	if s.Batch != nil && s.Batch.FlushInterval != "" {
+		if _, err := time.ParseDuration(s.Batch.FlushInterval); err != nil {
+			return fmt.Errorf("invalid flush interval %s: %v", s.Batch.FlushInterval, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package loadshedder provides the LoadShedder filter.
+package loadshedder
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of LoadShedder.
+	Kind = "LoadShedder"
+
+	resultShed = "shed"
+
+	// latencyWeight is the weight of a new sample in the moving average
+	// of the latency.
+	latencyWeight = 0.1
+
+	// cpuSampleInterval is the interval to sample the CPU usage.
+	cpuSampleInterval = time.Second
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "LoadShedder sheds excess load when the in-flight requests, latency or CPU usage is too high.",
+	Results:     []string{resultShed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{RetryAfter: 1}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &LoadShedder{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+// processCPUTime returns the CPU time used by the process, it is replaced
+// in tests.
+var processCPUTime = getProcessCPUTime
+
+type (
+	// LoadShedder is filter LoadShedder.
+	LoadShedder struct {
+		spec       *Spec
+		maxLatency time.Duration
+
+		inflight int64
+		shed     uint64
+
+		lock    sync.Mutex
+		latency float64
+
+		// cpu is the CPU usage in percentage multiplied by 100.
+		cpu  int64
+		done chan struct{}
+	}
+
+	// Spec describes the LoadShedder.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		MaxInflight     int64            `json:"maxInflight,omitempty" jsonschema:"minimum=0"`
+		MaxLatency      string           `json:"maxLatency,omitempty" jsonschema:"format=duration"`
+		MaxCPU          float64          `json:"maxCPU,omitempty" jsonschema:"minimum=0,maximum=100"`
+		RetryAfter      int              `json:"retryAfter,omitempty" jsonschema:"minimum=0"`
+		PriorityClasses []*PriorityClass `json:"priorityClasses,omitempty"`
+	}
+
+	// PriorityClass is a class of requests with the same priority.
+	PriorityClass struct {
+		Name      string                               `json:"name" jsonschema:"required"`
+		Priority  int                                  `json:"priority,omitempty" jsonschema:"minimum=0"`
+		NeverShed bool                                 `json:"neverShed,omitempty"`
+		Methods   []string                             `json:"methods,omitempty" jsonschema:"uniqueItems=true"`
+		Path      *stringtool.StringMatcher            `json:"path,omitempty"`
+		Headers   map[string]*stringtool.StringMatcher `json:"headers,omitempty"`
+	}
+
+	// Status is the status of LoadShedder.
+	Status struct {
+		Inflight int64 `json:"inflight"`
+		// Latency is the moving average of the latency in milliseconds.
+		Latency float64 `json:"latency"`
+		// CPU is the CPU usage of the process in percentage.
+		CPU float64 `json:"cpu"`
+		// ShedProbability is the probability of shedding a request of
+		// the lowest priority.
+		ShedProbability float64 `json:"shedProbability"`
+		Shed            uint64  `json:"shed"`
+	}
+)
+
+func validateMatcher(sm *stringtool.StringMatcher) error {
+	if err := sm.Validate(); err != nil {
+		return err
+	}
+	if _, err := regexp.Compile(sm.RegEx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.MaxInflight == 0 && spec.MaxLatency == "" && spec.MaxCPU == 0 {
+		return fmt.Errorf("at least one of maxInflight, maxLatency and maxCPU must be specified")
+	}
+	if spec.MaxLatency != "" {
+		if d, err := time.ParseDuration(spec.MaxLatency); err != nil || d <= 0 {
+			return fmt.Errorf("invalid maxLatency %s", spec.MaxLatency)
+		}
+	}
+
+	for _, pc := range spec.PriorityClasses {
+		if pc.Path != nil {
+			if err := validateMatcher(pc.Path); err != nil {
+				return fmt.Errorf("priority class %s: invalid path: %v", pc.Name, err)
+			}
+		}
+		for k, v := range pc.Headers {
+			if err := validateMatcher(v); err != nil {
+				return fmt.Errorf("priority class %s: invalid header %s: %v", pc.Name, k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// match returns whether the request belongs to the priority class.
+func (pc *PriorityClass) match(req *httpprot.Request) bool {
+	if len(pc.Methods) > 0 && !stringtool.StrInSlice(req.Method(), pc.Methods) {
+		return false
+	}
+	if pc.Path != nil && !pc.Path.Match(req.Path()) {
+		return false
+	}
+	for k, v := range pc.Headers {
+		if !v.MatchAny(req.HTTPHeader().Values(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Name returns the name of the LoadShedder filter instance.
+func (ls *LoadShedder) Name() string {
+	return ls.spec.Name()
+}
+
+// Kind returns the kind of LoadShedder.
+func (ls *LoadShedder) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the LoadShedder.
+func (ls *LoadShedder) Spec() filters.Spec {
+	return ls.spec
+}
+
+// Init initializes LoadShedder.
+func (ls *LoadShedder) Init() {
+	ls.reload()
+}
+
+// Inherit inherits previous generation of LoadShedder.
+func (ls *LoadShedder) Inherit(_ filters.Filter) {
+	ls.reload()
+}
+
+func (ls *LoadShedder) reload() {
+	if ls.spec.MaxLatency != "" {
+		ls.maxLatency, _ = time.ParseDuration(ls.spec.MaxLatency)
+	}
+	for _, pc := range ls.spec.PriorityClasses {
+		if pc.Path != nil {
+			pc.Path.Init()
+		}
+		for _, v := range pc.Headers {
+			v.Init()
+		}
+	}
+
+	ls.done = make(chan struct{})
+	if ls.spec.MaxCPU > 0 {
+		go ls.sampleCPU()
+	}
+}
+
+// sampleCPU samples the CPU usage of the process periodically, the usage
+// is relative to all CPUs.
+func (ls *LoadShedder) sampleCPU() {
+	ticker := time.NewTicker(cpuSampleInterval)
+	defer ticker.Stop()
+
+	lastCPU, lastTime := processCPUTime(), time.Now()
+	for {
+		select {
+		case <-ls.done:
+			return
+		case now := <-ticker.C:
+			cpu := processCPUTime()
+			elapsed := now.Sub(lastTime) * time.Duration(runtime.NumCPU())
+			if elapsed > 0 {
+				usage := float64(cpu-lastCPU) / float64(elapsed) * 100
+				atomic.StoreInt64(&ls.cpu, int64(usage*100))
+			}
+			lastCPU, lastTime = cpu, now
+		}
+	}
+}
+
+func (ls *LoadShedder) recordLatency(d time.Duration) {
+	ls.lock.Lock()
+	if ls.latency == 0 {
+		ls.latency = float64(d)
+	} else {
+		ls.latency += (float64(d) - ls.latency) * latencyWeight
+	}
+	ls.lock.Unlock()
+}
+
+func (ls *LoadShedder) getLatency() time.Duration {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+	return time.Duration(ls.latency)
+}
+
+func (ls *LoadShedder) getCPU() float64 {
+	return float64(atomic.LoadInt64(&ls.cpu)) / 100
+}
+
+// shedProbability returns the probability to shed a request of the
+// lowest priority. The load is the max ratio of the signals to their
+// thresholds, and the excess part of the load is shed.
+func (ls *LoadShedder) shedProbability() float64 {
+	load := 0.0
+	if max := ls.spec.MaxInflight; max > 0 {
+		load = math.Max(load, float64(atomic.LoadInt64(&ls.inflight))/float64(max))
+	}
+	if ls.maxLatency > 0 {
+		load = math.Max(load, float64(ls.getLatency())/float64(ls.maxLatency))
+	}
+	if max := ls.spec.MaxCPU; max > 0 {
+		load = math.Max(load, ls.getCPU()/max)
+	}
+
+	if load <= 1 {
+		return 0
+	}
+	return 1 - 1/load
+}
+
+func (ls *LoadShedder) shouldShed(priority int) bool {
+	p := ls.shedProbability()
+	return p > 0 && rand.Float64() < math.Pow(p, float64(priority+1))
+}
+
+// Handle sheds the request if the load is too high. Requests of higher
+// priorities are less likely to be shed, the probability of shedding a
+// request of priority n is p^(n+1), where p is the probability of the
+// lowest priority.
+func (ls *LoadShedder) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	priority, neverShed := 0, false
+	for _, pc := range ls.spec.PriorityClasses {
+		if pc.match(req) {
+			priority, neverShed = pc.Priority, pc.NeverShed
+			break
+		}
+	}
+
+	// requests which are never shed are still counted in the load.
+	if !neverShed && ls.shouldShed(priority) {
+		atomic.AddUint64(&ls.shed, 1)
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusServiceUnavailable)
+		if ls.spec.RetryAfter > 0 {
+			resp.HTTPHeader().Set("Retry-After", strconv.Itoa(ls.spec.RetryAfter))
+		}
+		ctx.SetOutputResponse(resp)
+		return resultShed
+	}
+
+	start := time.Now()
+	atomic.AddInt64(&ls.inflight, 1)
+	ctx.OnFinish(func() {
+		atomic.AddInt64(&ls.inflight, -1)
+		ls.recordLatency(time.Since(start))
+	})
+	return ""
+}
+
+// Status returns status.
+func (ls *LoadShedder) Status() interface{} {
+	return &Status{
+		Inflight:        atomic.LoadInt64(&ls.inflight),
+		Latency:         float64(ls.getLatency()) / float64(time.Millisecond),
+		CPU:             ls.getCPU(),
+		ShedProbability: ls.shedProbability(),
+		Shed:            atomic.LoadUint64(&ls.shed),
+	}
+}
+
+// Close closes LoadShedder.
+func (ls *LoadShedder) Close() {
+	close(ls.done)
+}
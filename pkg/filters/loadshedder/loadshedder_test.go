@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadshedder
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newLoadShedder(t *testing.T, yamlConfig string) *LoadShedder {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ls := kind.CreateInstance(spec).(*LoadShedder)
+	ls.Init()
+	return ls
+}
+
+func newContext(t *testing.T, path string) *context.Context {
+	ctx := context.New(nil)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1"+path, nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+	ctx.SetInputRequest(req)
+
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, yamlConfig := range []string{`
+kind: LoadShedder
+name: shedder
+`, `
+kind: LoadShedder
+name: shedder
+maxLatency: abc
+`, `
+kind: LoadShedder
+name: shedder
+maxInflight: 10
+priorityClasses:
+- name: health
+  path:
+    regex: "[a-"
+`} {
+		rawSpec := map[string]interface{}{}
+		codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		assert.Error(err)
+	}
+}
+
+func TestShedByInflight(t *testing.T) {
+	assert := assert.New(t)
+
+	ls := newLoadShedder(t, `
+kind: LoadShedder
+name: shedder
+maxInflight: 10
+retryAfter: 5
+priorityClasses:
+- name: health
+  neverShed: true
+  path:
+    exact: /healthz
+- name: admin
+  priority: 3
+  path:
+    prefix: /admin/
+`)
+	defer ls.Close()
+	assert.Equal(Kind, ls.Kind().Name)
+	assert.Equal("shedder", ls.Name())
+
+	var ctxs []*context.Context
+	for i := 0; i < 10; i++ {
+		ctx := newContext(t, "/")
+		assert.Equal("", ls.Handle(ctx))
+		ctxs = append(ctxs, ctx)
+	}
+	assert.Equal(0.0, ls.shedProbability())
+
+	// the load is 2 with 20 in-flight requests, half of the requests of
+	// the lowest priority are shed.
+	for i := 0; i < 10; i++ {
+		ctx := newContext(t, "/healthz")
+		assert.Equal("", ls.Handle(ctx))
+		ctxs = append(ctxs, ctx)
+	}
+	assert.Equal(0.5, ls.shedProbability())
+
+	shed := 0
+	for i := 0; i < 1000; i++ {
+		ctx := newContext(t, "/")
+		if ls.Handle(ctx) == resultShed {
+			shed++
+			resp := ctx.GetOutputResponse().(*httpprot.Response)
+			assert.Equal(http.StatusServiceUnavailable, resp.StatusCode())
+			assert.Equal("5", resp.HTTPHeader().Get("Retry-After"))
+		} else {
+			ctx.Finish()
+		}
+	}
+	assert.InDelta(500, shed, 100)
+
+	// requests of a higher priority are less likely to be shed.
+	shed = 0
+	for i := 0; i < 1000; i++ {
+		ctx := newContext(t, "/admin/users")
+		if ls.Handle(ctx) == resultShed {
+			shed++
+		} else {
+			ctx.Finish()
+		}
+	}
+	assert.InDelta(62, shed, 50)
+
+	for _, ctx := range ctxs {
+		ctx.Finish()
+	}
+	status := ls.Status().(*Status)
+	assert.Equal(int64(0), status.Inflight)
+	assert.Equal(0.0, status.ShedProbability)
+	assert.True(status.Shed > 0)
+}
+
+func TestShedByLatencyAndCPU(t *testing.T) {
+	assert := assert.New(t)
+
+	ls := newLoadShedder(t, `
+kind: LoadShedder
+name: shedder
+maxLatency: 100ms
+`)
+	ls.recordLatency(400 * time.Millisecond)
+	assert.Equal(0.75, ls.shedProbability())
+	ls.Close()
+
+	cpu := time.Duration(0)
+	processCPUTime = func() time.Duration {
+		cpu += 2 * time.Second
+		return cpu
+	}
+	defer func() { processCPUTime = getProcessCPUTime }()
+
+	ls = newLoadShedder(t, `
+kind: LoadShedder
+name: shedder
+maxCPU: 1
+`)
+	defer ls.Close()
+	assert.Eventually(func() bool {
+		return ls.shedProbability() > 0
+	}, 3*time.Second, 100*time.Millisecond)
+}
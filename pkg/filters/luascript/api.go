@@ -0,0 +1,375 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package luascript
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+// registerAPI registers the API of Easegress to the VM, which are the
+// global tables: request, response, kv, log, ctx and params.
+func (v *vm) registerAPI() {
+	L := v.L
+
+	L.SetGlobal("request", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"get_method":  v.requestGetMethod,
+		"set_method":  v.requestSetMethod,
+		"get_path":    v.requestGetPath,
+		"set_path":    v.requestSetPath,
+		"get_query":   v.requestGetQuery,
+		"set_query":   v.requestSetQuery,
+		"get_host":    v.requestGetHost,
+		"set_host":    v.requestSetHost,
+		"get_scheme":  v.requestGetScheme,
+		"get_real_ip": v.requestGetRealIP,
+		"get_header":  v.requestGetHeader,
+		"set_header":  v.requestSetHeader,
+		"add_header":  v.requestAddHeader,
+		"del_header":  v.requestDelHeader,
+		"get_cookie":  v.requestGetCookie,
+		"get_body":    v.requestGetBody,
+		"set_body":    v.requestSetBody,
+	}))
+
+	L.SetGlobal("response", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"get_status": v.responseGetStatus,
+		"set_status": v.responseSetStatus,
+		"get_header": v.responseGetHeader,
+		"set_header": v.responseSetHeader,
+		"add_header": v.responseAddHeader,
+		"del_header": v.responseDelHeader,
+		"get_body":   v.responseGetBody,
+		"set_body":   v.responseSetBody,
+	}))
+
+	L.SetGlobal("kv", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"get":    v.kvGet,
+		"put":    v.kvPut,
+		"delete": v.kvDelete,
+		"incr":   v.kvIncr,
+	}))
+
+	L.SetGlobal("log", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"debug": v.logFunc(logger.Debugf),
+		"info":  v.logFunc(logger.Infof),
+		"warn":  v.logFunc(logger.Warnf),
+		"error": v.logFunc(logger.Errorf),
+	}))
+
+	L.SetGlobal("ctx", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"add_tag": v.ctxAddTag,
+	}))
+
+	params := L.NewTable()
+	if v.host != nil {
+		for k, val := range v.host.spec.Parameters {
+			params.RawSetString(k, lua.LString(val))
+		}
+	}
+	L.SetGlobal("params", params)
+}
+
+func (v *vm) request(L *lua.LState) *httpprot.Request {
+	if v.ctx == nil {
+		L.RaiseError("request is only available in the handle function")
+	}
+	return v.ctx.GetInputRequest().(*httpprot.Request)
+}
+
+// response returns the response, and creates one if there isn't and
+// create is true.
+func (v *vm) response(L *lua.LState, create bool) *httpprot.Response {
+	if v.ctx == nil {
+		L.RaiseError("response is only available in the handle function")
+	}
+	resp, _ := v.ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil && create {
+		resp, _ = httpprot.NewResponse(nil)
+		v.ctx.SetOutputResponse(resp)
+	}
+	return resp
+}
+
+// request functions
+
+func (v *vm) requestGetMethod(L *lua.LState) int {
+	L.Push(lua.LString(v.request(L).Method()))
+	return 1
+}
+
+func (v *vm) requestSetMethod(L *lua.LState) int {
+	v.request(L).SetMethod(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestGetPath(L *lua.LState) int {
+	L.Push(lua.LString(v.request(L).Path()))
+	return 1
+}
+
+func (v *vm) requestSetPath(L *lua.LState) int {
+	v.request(L).SetPath(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestGetQuery(L *lua.LState) int {
+	L.Push(lua.LString(v.request(L).URL().RawQuery))
+	return 1
+}
+
+func (v *vm) requestSetQuery(L *lua.LState) int {
+	v.request(L).URL().RawQuery = L.CheckString(1)
+	return 0
+}
+
+func (v *vm) requestGetHost(L *lua.LState) int {
+	L.Push(lua.LString(v.request(L).Host()))
+	return 1
+}
+
+func (v *vm) requestSetHost(L *lua.LState) int {
+	v.request(L).SetHost(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestGetScheme(L *lua.LState) int {
+	L.Push(lua.LString(v.request(L).Scheme()))
+	return 1
+}
+
+func (v *vm) requestGetRealIP(L *lua.LState) int {
+	L.Push(lua.LString(v.request(L).RealIP()))
+	return 1
+}
+
+func (v *vm) requestGetHeader(L *lua.LState) int {
+	return getHeader(L, v.request(L).HTTPHeader())
+}
+
+func (v *vm) requestSetHeader(L *lua.LState) int {
+	v.request(L).HTTPHeader().Set(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) requestAddHeader(L *lua.LState) int {
+	v.request(L).HTTPHeader().Add(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) requestDelHeader(L *lua.LState) int {
+	v.request(L).HTTPHeader().Del(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestGetCookie(L *lua.LState) int {
+	c, err := v.request(L).Cookie(L.CheckString(1))
+	if err != nil {
+		L.Push(lua.LNil)
+	} else {
+		L.Push(lua.LString(c.Value))
+	}
+	return 1
+}
+
+func (v *vm) requestGetBody(L *lua.LState) int {
+	req := v.request(L)
+	// the body of a stream request can only be read once.
+	if req.IsStream() {
+		L.Push(lua.LNil)
+	} else {
+		L.Push(lua.LString(req.RawPayload()))
+	}
+	return 1
+}
+
+func (v *vm) requestSetBody(L *lua.LState) int {
+	req := v.request(L)
+	body := L.CheckString(1)
+	req.SetPayload([]byte(body))
+	req.ContentLength = int64(len(body))
+	req.HTTPHeader().Set("Content-Length", strconv.Itoa(len(body)))
+	return 0
+}
+
+// response functions
+
+func (v *vm) responseGetStatus(L *lua.LState) int {
+	resp := v.response(L, false)
+	if resp == nil {
+		L.Push(lua.LNil)
+	} else {
+		L.Push(lua.LNumber(resp.StatusCode()))
+	}
+	return 1
+}
+
+func (v *vm) responseSetStatus(L *lua.LState) int {
+	code := L.CheckInt(1)
+	if code < 100 || code > 999 {
+		L.ArgError(1, "invalid status code")
+	}
+	v.response(L, true).SetStatusCode(code)
+	return 0
+}
+
+func (v *vm) responseGetHeader(L *lua.LState) int {
+	resp := v.response(L, false)
+	if resp == nil {
+		L.Push(lua.LNil)
+		return 1
+	}
+	return getHeader(L, resp.HTTPHeader())
+}
+
+func (v *vm) responseSetHeader(L *lua.LState) int {
+	v.response(L, true).HTTPHeader().Set(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) responseAddHeader(L *lua.LState) int {
+	v.response(L, true).HTTPHeader().Add(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) responseDelHeader(L *lua.LState) int {
+	if resp := v.response(L, false); resp != nil {
+		resp.HTTPHeader().Del(L.CheckString(1))
+	}
+	return 0
+}
+
+func (v *vm) responseGetBody(L *lua.LState) int {
+	resp := v.response(L, false)
+	if resp == nil || resp.IsStream() {
+		L.Push(lua.LNil)
+	} else {
+		L.Push(lua.LString(resp.RawPayload()))
+	}
+	return 1
+}
+
+func (v *vm) responseSetBody(L *lua.LState) int {
+	resp := v.response(L, true)
+	resp.SetPayload([]byte(L.CheckString(1)))
+	resp.HTTPHeader().Del("Content-Length")
+	return 0
+}
+
+// getHeader pushes the first value of the header, or nil if the header
+// doesn't exist.
+func getHeader(L *lua.LState, h http.Header) int {
+	name := L.CheckString(1)
+	if vals := h.Values(name); len(vals) > 0 {
+		L.Push(lua.LString(vals[0]))
+	} else {
+		L.Push(lua.LNil)
+	}
+	return 1
+}
+
+// kv functions, the keys are in the prefix of the filter, and the values
+// are read from a local copy synchronized from the cluster, so a put is
+// not visible to get immediately.
+
+func (v *vm) kvKey(L *lua.LState) string {
+	if v.host == nil || v.host.Cluster() == nil {
+		L.RaiseError("kv store is not available")
+	}
+	key := L.CheckString(1)
+	if key == "" {
+		L.ArgError(1, "empty key")
+	}
+	return v.host.dataPrefix + key
+}
+
+func (v *vm) kvGet(L *lua.LState) int {
+	key := v.kvKey(L)
+	if kv := v.host.Data()[key]; kv != nil {
+		L.Push(lua.LString(kv.Value))
+	} else {
+		L.Push(lua.LNil)
+	}
+	return 1
+}
+
+func (v *vm) kvPut(L *lua.LState) int {
+	key := v.kvKey(L)
+	val := L.CheckString(2)
+	if err := v.host.Cluster().Put(key, val); err != nil {
+		L.RaiseError("failed to put %s: %v", key, err)
+	}
+	return 0
+}
+
+func (v *vm) kvDelete(L *lua.LState) int {
+	key := v.kvKey(L)
+	if err := v.host.Cluster().Delete(key); err != nil {
+		L.RaiseError("failed to delete %s: %v", key, err)
+	}
+	return 0
+}
+
+// kvIncr adds the delta, which is 1 by default, to the integer value of
+// the key atomically, and returns the result.
+func (v *vm) kvIncr(L *lua.LState) int {
+	key := v.kvKey(L)
+	delta := int64(L.OptInt(2, 1))
+	result := int64(0)
+
+	addFunc := func(stm concurrency.STM) error {
+		result, _ = strconv.ParseInt(stm.Get(key), 0, 64)
+		result += delta
+		stm.Put(key, strconv.FormatInt(result, 10))
+		return nil
+	}
+	if err := v.host.Cluster().STM(addFunc); err != nil {
+		L.RaiseError("failed to increase %s: %v", key, err)
+	}
+
+	L.Push(lua.LNumber(result))
+	return 1
+}
+
+// misc functions
+
+func (v *vm) logFunc(fn func(template string, args ...interface{})) lua.LGFunction {
+	return func(L *lua.LState) int {
+		msgs := make([]string, L.GetTop())
+		for i := range msgs {
+			msgs[i] = L.ToStringMeta(L.Get(i + 1)).String()
+		}
+		fn("%s", strings.Join(msgs, " "))
+		return 0
+	}
+}
+
+func (v *vm) ctxAddTag(L *lua.LState) int {
+	if v.ctx == nil {
+		L.RaiseError("ctx is only available in the handle function")
+	}
+	v.ctx.AddTag(L.CheckString(1))
+	return 0
+}
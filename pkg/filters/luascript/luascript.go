@@ -0,0 +1,302 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package luascript provides the LuaScript filter.
+package luascript
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of LuaScript.
+	Kind = "LuaScript"
+
+	resultOutOfVM   = "outOfVM"
+	resultLuaError  = "luaError"
+	maxResults      = 10
+	handlerFuncName = "handle"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "LuaScript runs Lua scripts to handle requests and responses",
+	Results:     []string{resultOutOfVM, resultLuaError},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			MaxConcurrency: 10,
+			Timeout:        "100ms",
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &LuaScript{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	for i := 0; i < maxResults; i++ {
+		kind.Results = append(kind.Results, fmt.Sprintf("result%d", i))
+	}
+	filters.Register(kind)
+}
+
+type (
+	// LuaScript is filter LuaScript.
+	LuaScript struct {
+		spec *Spec
+
+		pool       *vmPool
+		dataPrefix string
+		data       atomic.Value
+		chStop     chan struct{}
+
+		numOfRequest  int64
+		numOfLuaError int64
+	}
+
+	// Spec is the spec of LuaScript.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Code           string            `json:"code" jsonschema:"required"`
+		MaxConcurrency int32             `json:"maxConcurrency" jsonschema:"required,minimum=1"`
+		Timeout        string            `json:"timeout" jsonschema:"required,format=duration"`
+		Parameters     map[string]string `json:"parameters,omitempty"`
+	}
+
+	// Status is the status of LuaScript.
+	Status struct {
+		Health        string `json:"health"`
+		NumOfRequest  int64  `json:"numOfRequest"`
+		NumOfLuaError int64  `json:"numOfLuaError"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	proto, err := spec.compile()
+	if err != nil {
+		return err
+	}
+
+	// run the code in a VM to check the handle function.
+	v, err := newVM(nil, proto, 0)
+	if err != nil {
+		return err
+	}
+	v.L.Close()
+	return nil
+}
+
+// compile compiles the code, which is the path of a script file or the
+// script itself.
+func (spec *Spec) compile() (*lua.FunctionProto, error) {
+	code, name := spec.Code, "<code>"
+	if _, err := os.Stat(spec.Code); err == nil {
+		data, err := os.ReadFile(spec.Code)
+		if err != nil {
+			return nil, err
+		}
+		code, name = string(data), spec.Code
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(code), name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lua code: %v", err)
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile lua code: %v", err)
+	}
+	return proto, nil
+}
+
+// Name returns the name of the LuaScript filter instance.
+func (ls *LuaScript) Name() string {
+	return ls.spec.Name()
+}
+
+// Kind returns the kind of LuaScript.
+func (ls *LuaScript) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the LuaScript
+func (ls *LuaScript) Spec() filters.Spec {
+	return ls.spec
+}
+
+// Cluster returns the cluster, it is nil if the filter is not running in
+// a cluster, e.g. in tests.
+func (ls *LuaScript) Cluster() cluster.Cluster {
+	if ls.spec.Super() == nil {
+		return nil
+	}
+	return ls.spec.Super().Cluster()
+}
+
+// Data returns the shared data
+func (ls *LuaScript) Data() map[string]*mvccpb.KeyValue {
+	d := ls.data.Load()
+	if d == nil {
+		return map[string]*mvccpb.KeyValue{}
+	}
+	return d.(map[string]*mvccpb.KeyValue)
+}
+
+// Init initializes LuaScript.
+func (ls *LuaScript) Init() {
+	ls.reload()
+}
+
+// Inherit inherits previous generation of LuaScript.
+func (ls *LuaScript) Inherit(_ filters.Filter) {
+	ls.reload()
+}
+
+func (ls *LuaScript) reload() {
+	ls.chStop = make(chan struct{})
+
+	proto, err := ls.spec.compile()
+	if err != nil {
+		logger.Errorf("%s: %v", ls.spec.Name(), err)
+	} else {
+		timeout, _ := time.ParseDuration(ls.spec.Timeout)
+		ls.pool = newVMPool(ls, proto, int(ls.spec.MaxConcurrency), timeout)
+	}
+
+	if c := ls.Cluster(); c != nil {
+		ls.dataPrefix = c.Layout().LuaDataPrefix(ls.spec.Pipeline(), ls.spec.Name())
+		go ls.watchData(c)
+	}
+}
+
+func (ls *LuaScript) watchData(c cluster.Cluster) {
+	var (
+		ch     <-chan map[string]*mvccpb.KeyValue
+		syncer cluster.Syncer
+		err    error
+	)
+
+	for {
+		syncer, err = c.Syncer(time.Minute)
+		if err == nil {
+			ch, err = syncer.SyncRawPrefix(ls.dataPrefix)
+			if err == nil {
+				break
+			}
+		}
+		logger.Errorf("failed to watch lua data: %v", err)
+		select {
+		case <-time.After(10 * time.Second):
+		case <-ls.chStop:
+			return
+		}
+	}
+
+	defer syncer.Close()
+	for {
+		select {
+		case data := <-ch:
+			ls.data.Store(data)
+		case <-ls.chStop:
+			return
+		}
+	}
+}
+
+// Handle runs the handle function of the script.
+func (ls *LuaScript) Handle(ctx *context.Context) (result string) {
+	if ls.pool == nil {
+		ctx.AddTag("lua VM pool is not initialized")
+		return resultOutOfVM
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	vm := ls.pool.get(req.Context())
+	if vm == nil {
+		ctx.AddTag("failed to get a lua VM")
+		return resultOutOfVM
+	}
+	atomic.AddInt64(&ls.numOfRequest, 1)
+
+	result, err := vm.run(req.Context(), ctx)
+	if err != nil {
+		logger.Errorf("%s: lua error: %v", ls.spec.Name(), err)
+		atomic.AddInt64(&ls.numOfLuaError, 1)
+		// the VM may be in an inconsistent state, drop it and a new one
+		// will be created later.
+		vm = nil
+		result = resultLuaError
+	}
+	ls.pool.put(vm)
+
+	return result
+}
+
+// Status returns Status generated by the filter.
+func (ls *LuaScript) Status() interface{} {
+	s := &Status{Health: "ready"}
+	if ls.pool == nil {
+		s.Health = "VM pool is not initialized"
+	}
+	s.NumOfRequest = atomic.LoadInt64(&ls.numOfRequest)
+	s.NumOfLuaError = atomic.LoadInt64(&ls.numOfLuaError)
+	return s
+}
+
+// Close closes LuaScript.
+func (ls *LuaScript) Close() {
+	close(ls.chStop)
+	if ls.pool != nil {
+		ls.pool.close()
+	}
+}
+
+// resultOf converts the value returned by the script to a filter result.
+func resultOf(v lua.LValue) (string, error) {
+	switch v.Type() {
+	case lua.LTNil:
+		return "", nil
+	case lua.LTString:
+		s := v.String()
+		if s == "" {
+			return "", nil
+		}
+		for _, r := range kind.Results {
+			if r == s {
+				return s, nil
+			}
+		}
+		return "", fmt.Errorf("invalid result %q", s)
+	}
+	return "", fmt.Errorf("invalid result type %s", v.Type())
+}
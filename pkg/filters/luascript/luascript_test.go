@@ -0,0 +1,252 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package luascript
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newSpec(yamlConfig string, super *supervisor.Supervisor) (filters.Spec, error) {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	return filters.NewSpec(super, "pipeline", rawSpec)
+}
+
+func newLuaScript(t *testing.T, code string, super *supervisor.Supervisor) *LuaScript {
+	spec, err := newSpec(`
+kind: LuaScript
+name: lua
+maxConcurrency: 2
+timeout: 100ms
+parameters:
+  greeting: hello
+code: |
+`+indent(code), super)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ls := kind.CreateInstance(spec).(*LuaScript)
+	ls.Init()
+	t.Cleanup(ls.Close)
+	return ls
+}
+
+func indent(code string) string {
+	lines := strings.Split(strings.TrimSpace(code), "\n")
+	for i := range lines {
+		lines[i] = "  " + lines[i]
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func newContext(t *testing.T, body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/api?a=1", strings.NewReader(body))
+	stdr.Header.Set("X-User", "alice")
+	req, _ := httpprot.NewRequest(stdr)
+	assert.Nil(t, req.FetchPayload(0))
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, code := range []string{
+		"function handle(",
+		"local x = 1",
+		"error('boom')",
+	} {
+		_, err := newSpec(`
+kind: LuaScript
+name: lua
+code: |
+`+indent(code), nil)
+		assert.NotNil(err, code)
+	}
+
+	path := filepath.Join(t.TempDir(), "script.lua")
+	os.WriteFile(path, []byte("function handle() end"), 0o644)
+	_, err := newSpec(`
+kind: LuaScript
+name: lua
+code: `+path, nil)
+	assert.Nil(err)
+}
+
+func TestRequestAndResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	ls := newLuaScript(t, `
+function handle()
+  if request.get_header("X-User") ~= "alice" then
+    return "result1"
+  end
+  request.set_header("X-Greeting", params.greeting)
+  request.del_header("X-User")
+  request.set_path("/v2" .. request.get_path())
+  request.set_query(request.get_query() .. "&b=2")
+  request.set_body(string.upper(request.get_body()))
+  ctx.add_tag("lua")
+  if request.get_method() == "DELETE" then
+    response.set_status(403)
+    response.set_header("X-Reason", "denied")
+    response.set_body("denied")
+    return "result0"
+  end
+end
+`, nil)
+
+	ctx := newContext(t, "body")
+	assert.Equal("", ls.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("hello", req.HTTPHeader().Get("X-Greeting"))
+	assert.Equal("", req.HTTPHeader().Get("X-User"))
+	assert.Equal("/v2/api", req.Path())
+	assert.Equal("a=1&b=2", req.URL().RawQuery)
+	assert.Equal("BODY", string(req.RawPayload()))
+	assert.Equal(int64(4), req.ContentLength)
+	assert.Nil(ctx.GetOutputResponse())
+
+	ctx = newContext(t, "")
+	ctx.GetInputRequest().(*httpprot.Request).SetMethod(http.MethodDelete)
+	assert.Equal("result0", ls.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+	assert.Equal("denied", resp.HTTPHeader().Get("X-Reason"))
+	assert.Equal("denied", string(resp.RawPayload()))
+
+	ctx = newContext(t, "")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Del("X-User")
+	assert.Equal("result1", ls.Handle(ctx))
+
+	s := ls.Status().(*Status)
+	assert.Equal("ready", s.Health)
+	assert.Equal(int64(3), s.NumOfRequest)
+	assert.Equal(int64(0), s.NumOfLuaError)
+}
+
+func TestErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	ls := newLuaScript(t, `
+function handle()
+  local mode = request.get_header("X-Mode")
+  if mode == "error" then
+    error("boom")
+  elseif mode == "loop" then
+    while true do end
+  elseif mode == "result" then
+    return "unknown"
+  elseif mode == "sandbox" then
+    return os.getenv("HOME")
+  elseif mode == "kv" then
+    kv.get("key")
+  end
+end
+`, nil)
+
+	for _, mode := range []string{"error", "loop", "result", "sandbox", "kv"} {
+		ctx := newContext(t, "")
+		ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Mode", mode)
+		start := time.Now()
+		assert.Equal(resultLuaError, ls.Handle(ctx), mode)
+		assert.Less(time.Since(start), time.Second)
+	}
+
+	// the VMs are recreated after errors.
+	assert.Equal("", ls.Handle(newContext(t, "")))
+	assert.Equal(int64(5), ls.Status().(*Status).NumOfLuaError)
+}
+
+func TestKV(t *testing.T) {
+	assert := assert.New(t)
+
+	store := map[string]string{}
+	clusterInstance := clustertest.NewMockedCluster()
+	syncer := clustertest.NewMockedSyncer()
+	clusterInstance.MockedSyncer = func(time.Duration) (cluster.Syncer, error) {
+		return syncer, nil
+	}
+	dataCh := make(chan map[string]*mvccpb.KeyValue)
+	syncer.MockedSyncRawPrefix = func(prefix string) (<-chan map[string]*mvccpb.KeyValue, error) {
+		assert.Equal("/lua/data/pipeline/lua/", prefix)
+		return dataCh, nil
+	}
+	clusterInstance.MockedPut = func(key, value string) error {
+		store[key] = value
+		return nil
+	}
+	clusterInstance.MockedDelete = func(key string) error {
+		delete(store, key)
+		return nil
+	}
+	super := supervisor.NewMock(nil, clusterInstance, nil, nil, false, nil, nil)
+
+	ls := newLuaScript(t, `
+function handle()
+  local user = request.get_header("X-User")
+  local quota = kv.get("quota/" .. user)
+  if quota == nil then
+    kv.put("quota/" .. user, "10")
+    return
+  end
+  kv.delete("quota/" .. user)
+  response.set_header("X-Quota", quota)
+end
+`, super)
+
+	assert.Equal("", ls.Handle(newContext(t, "")))
+	assert.Equal("10", store["/lua/data/pipeline/lua/quota/alice"])
+
+	dataCh <- map[string]*mvccpb.KeyValue{
+		"/lua/data/pipeline/lua/quota/alice": {Value: []byte("10")},
+	}
+	assert.Eventually(func() bool {
+		return len(ls.Data()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	ctx := newContext(t, "")
+	assert.Equal("", ls.Handle(ctx))
+	assert.Equal("10", ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get("X-Quota"))
+	assert.Empty(store)
+}
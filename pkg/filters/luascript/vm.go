@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package luascript
+
+import (
+	stdcontext "context"
+	"fmt"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+type (
+	// vm is a Lua VM, it runs one request at a time.
+	vm struct {
+		host    *LuaScript
+		L       *lua.LState
+		handle  *lua.LFunction
+		ctx     *context.Context
+		timeout time.Duration
+	}
+
+	// vmPool is a pool of Lua VMs, the VMs are created on demand, and the
+	// number of VMs never exceeds its capacity.
+	vmPool struct {
+		host    *LuaScript
+		proto   *lua.FunctionProto
+		timeout time.Duration
+		vms     chan *vm
+	}
+)
+
+func newVMPool(host *LuaScript, proto *lua.FunctionProto, size int, timeout time.Duration) *vmPool {
+	p := &vmPool{
+		host:    host,
+		proto:   proto,
+		timeout: timeout,
+		vms:     make(chan *vm, size),
+	}
+	// nil means a VM can be created.
+	for i := 0; i < size; i++ {
+		p.vms <- nil
+	}
+	return p
+}
+
+// get gets a VM from the pool, it waits until a VM is available or the
+// timeout is reached, and returns nil on timeout and errors.
+func (p *vmPool) get(ctx stdcontext.Context) *vm {
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	var v *vm
+	select {
+	case v = <-p.vms:
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return nil
+	}
+
+	if v != nil {
+		return v
+	}
+
+	v, err := newVM(p.host, p.proto, p.timeout)
+	if err != nil {
+		logger.Errorf("failed to create lua VM: %v", err)
+		p.vms <- nil
+		return nil
+	}
+	return v
+}
+
+// put puts a VM back to the pool, v could be nil if the VM is no longer
+// usable.
+func (p *vmPool) put(v *vm) {
+	p.vms <- v
+}
+
+// close closes the VMs which are in the pool, the VMs which are in use
+// are released by the garbage collector.
+func (p *vmPool) close() {
+	for {
+		select {
+		case v := <-p.vms:
+			if v != nil {
+				v.L.Close()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// sandboxLibs are the standard libraries available to the scripts, the
+// libraries to access the OS and the file system are excluded.
+var sandboxLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+func newVM(host *LuaScript, proto *lua.FunctionProto, timeout time.Duration) (*vm, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range sandboxLibs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	v := &vm{host: host, L: L, timeout: timeout}
+	v.registerAPI()
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 0, nil); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("failed to run lua code: %v", err)
+	}
+
+	fn, ok := L.GetGlobal(handlerFuncName).(*lua.LFunction)
+	if !ok {
+		L.Close()
+		return nil, fmt.Errorf("lua code hasn't defined function '%s'", handlerFuncName)
+	}
+	v.handle = fn
+	return v, nil
+}
+
+// run runs the handle function of the script with ctx.
+func (v *vm) run(reqCtx stdcontext.Context, ctx *context.Context) (string, error) {
+	timeoutCtx, cancel := stdcontext.WithTimeout(reqCtx, v.timeout)
+	defer cancel()
+
+	v.ctx = ctx
+	v.L.SetContext(timeoutCtx)
+	defer func() {
+		v.ctx = nil
+		v.L.RemoveContext()
+	}()
+
+	err := v.L.CallByParam(lua.P{Fn: v.handle, NRet: 1, Protect: true})
+	if err != nil {
+		return "", err
+	}
+
+	ret := v.L.Get(-1)
+	v.L.Pop(1)
+	return resultOf(ret)
+}
@@ -19,9 +19,16 @@
 package mock
 
 import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
 	"strings"
+	"text/template"
 	"time"
 
+	sprig "github.com/go-task/slim-sprig"
+
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters"
 	"github.com/megaease/easegress/v2/pkg/logger"
@@ -33,13 +40,14 @@ const (
 	// Kind is the kind of Mock.
 	Kind = "Mock"
 
-	resultMocked = "mocked"
+	resultMocked   = "mocked"
+	resultBuildErr = "buildErr"
 )
 
 var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "Mock mocks the response.",
-	Results:     []string{resultMocked},
+	Results:     []string{resultMocked, resultBuildErr},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
@@ -72,19 +80,76 @@ type (
 		Headers map[string]string `json:"headers,omitempty"`
 		Body    string            `json:"body,omitempty"`
 		Delay   string            `json:"delay,omitempty" jsonschema:"format=duration"`
+		// Template indicates the body and the header values are templates,
+		// which are rendered with the request.
+		Template bool `json:"template,omitempty"`
 
-		delay time.Duration
+		delay   time.Duration
+		body    *template.Template
+		headers map[string]*template.Template
 	}
 
 	// MatchRule is the rule to match a request
 	MatchRule struct {
 		Path            string                               `json:"path,omitempty" jsonschema:"pattern=^/"`
 		PathPrefix      string                               `json:"pathPrefix,omitempty" jsonschema:"pattern=^/"`
+		Methods         []string                             `json:"methods,omitempty" jsonschema:"uniqueItems=true,format=httpmethod-array"`
 		Headers         map[string]*stringtool.StringMatcher `json:"headers,omitempty"`
 		MatchAllHeaders bool                                 `json:"matchAllHeaders,omitempty"`
 	}
 )
 
+// templateFuncs are the functions which can be used in the templates
+// besides the sprig functions.
+var templateFuncs = template.FuncMap{
+	"randInt": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + rand.Intn(max-min)
+	},
+	"header": func(header http.Header, key string) string {
+		return header.Get(key)
+	},
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(sprig.TxtFuncMap()).Funcs(templateFuncs).Parse(text)
+}
+
+// Validate validates the Spec.
+func (spec *Spec) Validate() error {
+	for i, r := range spec.Rules {
+		if err := r.parseTemplates(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) parseTemplates() error {
+	if !r.Template {
+		return nil
+	}
+
+	body, err := parseTemplate(r.Body)
+	if err != nil {
+		return fmt.Errorf("invalid body template: %v", err)
+	}
+
+	headers := make(map[string]*template.Template, len(r.Headers))
+	for key, value := range r.Headers {
+		t, err := parseTemplate(value)
+		if err != nil {
+			return fmt.Errorf("invalid template of header %s: %v", key, err)
+		}
+		headers[key] = t
+	}
+
+	r.body, r.headers = body, headers
+	return nil
+}
+
 // Name returns the name of the Mock filter instance.
 func (m *Mock) Name() string {
 	return m.spec.Name()
@@ -112,6 +177,7 @@ func (m *Mock) Inherit(previousGeneration filters.Filter) {
 
 func (m *Mock) reload() {
 	for _, r := range m.spec.Rules {
+		r.parseTemplates()
 		if r.Delay == "" {
 			continue
 		}
@@ -123,8 +189,7 @@ func (m *Mock) reload() {
 func (m *Mock) Handle(ctx *context.Context) string {
 	result := ""
 	if rule := m.match(ctx); rule != nil {
-		m.mock(ctx, rule)
-		result = resultMocked
+		result = m.mock(ctx, rule)
 	}
 	return result
 }
@@ -150,6 +215,20 @@ func (m *Mock) match(ctx *context.Context) *Rule {
 		return strings.HasPrefix(path, rule.Match.PathPrefix)
 	}
 
+	matchMethod := func(rule *Rule) bool {
+		if len(rule.Match.Methods) == 0 {
+			return true
+		}
+
+		for _, m := range rule.Match.Methods {
+			if strings.EqualFold(m, req.Method()) {
+				return true
+			}
+		}
+
+		return false
+	}
+
 	matchOneHeader := func(key string, rule *stringtool.StringMatcher) bool {
 		values := header.Values(key)
 		if len(values) == 0 {
@@ -189,7 +268,7 @@ func (m *Mock) match(ctx *context.Context) *Rule {
 	}
 
 	for _, rule := range m.spec.Rules {
-		if matchPath(rule) && matchHeader(rule) {
+		if matchPath(rule) && matchMethod(rule) && matchHeader(rule) {
 			return rule
 		}
 	}
@@ -197,18 +276,58 @@ func (m *Mock) match(ctx *context.Context) *Rule {
 	return nil
 }
 
-func (m *Mock) mock(ctx *context.Context, rule *Rule) {
+// render renders the headers and the body of the rule with the request.
+func (m *Mock) render(ctx *context.Context, rule *Rule) (http.Header, []byte, error) {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	data := map[string]interface{}{
+		"req":       req.ToBuilderRequest(ctx.Namespace()),
+		"data":      ctx.Data(),
+		"namespace": ctx.Namespace(),
+	}
+
+	var buf bytes.Buffer
+	header := http.Header{}
+	for key, t := range rule.headers {
+		buf.Reset()
+		if err := t.Execute(&buf, data); err != nil {
+			return nil, nil, fmt.Errorf("render header %s: %v", key, err)
+		}
+		header.Set(key, buf.String())
+	}
+
+	buf.Reset()
+	if err := rule.body.Execute(&buf, data); err != nil {
+		return nil, nil, fmt.Errorf("render body: %v", err)
+	}
+	return header, buf.Bytes(), nil
+}
+
+func (m *Mock) mock(ctx *context.Context, rule *Rule) string {
 	resp, _ := httpprot.NewResponse(nil)
 
-	resp.SetStatusCode(rule.Code)
-	for key, value := range rule.Headers {
-		resp.Std().Header.Set(key, value)
+	if rule.body != nil {
+		header, body, err := m.render(ctx, rule)
+		if err != nil {
+			logger.Errorf("%s: %v", m.Name(), err)
+			resp.SetStatusCode(http.StatusInternalServerError)
+			ctx.SetOutputResponse(resp)
+			return resultBuildErr
+		}
+		for key := range header {
+			resp.Std().Header.Set(key, header.Get(key))
+		}
+		resp.SetPayload(body)
+	} else {
+		for key, value := range rule.Headers {
+			resp.Std().Header.Set(key, value)
+		}
+		resp.SetPayload([]byte(rule.Body))
 	}
-	resp.SetPayload([]byte(rule.Body))
+	resp.SetStatusCode(rule.Code)
 	ctx.SetOutputResponse(resp)
 
 	if rule.delay <= 0 {
-		return
+		return resultMocked
 	}
 
 	req := ctx.GetInputRequest().(*httpprot.Request)
@@ -218,6 +337,7 @@ func (m *Mock) mock(ctx *context.Context, rule *Rule) {
 		logger.Debugf("request cancelled in the middle of delay mocking")
 	case <-time.After(rule.delay):
 	}
+	return resultMocked
 }
 
 // Status returns status.
@@ -213,3 +213,123 @@ rules:
 		assert.Equal(204, resp.StatusCode())
 	}
 }
+
+func TestMockMethods(t *testing.T) {
+	assert := assert.New(t)
+	const yamlConfig = `
+kind: Mock
+name: mock
+rules:
+- match:
+    path: /orders
+    methods: [POST, PUT]
+  code: 201
+  body: 'created'
+`
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, e := filters.NewSpec(nil, "", rawSpec)
+	if e != nil {
+		t.Errorf("unexpected error: %v", e)
+	}
+
+	m := kind.CreateInstance(spec)
+	m.Init()
+	defer m.Close()
+
+	ctx := context.New(nil)
+	{
+		req, err := http.NewRequest(http.MethodPost, "http://example.com/orders", nil)
+		assert.Nil(err)
+		setRequest(t, ctx, "id1", req)
+
+		ctx.UseNamespace("id1")
+		assert.Equal(resultMocked, m.Handle(ctx))
+
+		resp := ctx.GetResponse("id1").(*httpprot.Response)
+		assert.Equal(201, resp.StatusCode())
+	}
+
+	{
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/orders", nil)
+		assert.Nil(err)
+		setRequest(t, ctx, "id2", req)
+
+		ctx.UseNamespace("id2")
+		assert.Equal("", m.Handle(ctx))
+	}
+}
+
+func TestMockTemplate(t *testing.T) {
+	assert := assert.New(t)
+	const yamlConfig = `
+kind: Mock
+name: mock
+rules:
+- match:
+    pathPrefix: /users/
+  code: 200
+  template: true
+  headers:
+    Content-Type: application/json
+    X-Request-Id: '{{uuidv4}}'
+  body: '{"path":"{{.req.URL.Path}}","user":"{{header .req.Header "X-User"}}","n":{{randInt 1 10}},"year":{{now | date "2006"}}}'
+- match:
+    path: /broken
+  code: 200
+  template: true
+  body: '{{.req.Missing}}'
+`
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, e := filters.NewSpec(nil, "", rawSpec)
+	if e != nil {
+		t.Errorf("unexpected error: %v", e)
+	}
+
+	m := kind.CreateInstance(spec)
+	m.Init()
+	defer m.Close()
+
+	ctx := context.New(nil)
+	{
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/users/1", nil)
+		assert.Nil(err)
+		req.Header.Set("X-User", "alice")
+		setRequest(t, ctx, "id1", req)
+
+		ctx.UseNamespace("id1")
+		assert.Equal(resultMocked, m.Handle(ctx))
+
+		resp := ctx.GetResponse("id1").(*httpprot.Response)
+		assert.Equal(200, resp.StatusCode())
+		assert.Equal("application/json", resp.Std().Header.Get("Content-Type"))
+		assert.Len(resp.Std().Header.Get("X-Request-Id"), 36)
+
+		body := map[string]interface{}{}
+		codectool.MustUnmarshal(resp.RawPayload(), &body)
+		assert.Equal("/users/1", body["path"])
+		assert.Equal("alice", body["user"])
+		assert.GreaterOrEqual(body["n"], float64(1))
+		assert.Less(body["n"], float64(10))
+		assert.NotZero(body["year"])
+	}
+
+	{
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/broken", nil)
+		assert.Nil(err)
+		setRequest(t, ctx, "id2", req)
+
+		ctx.UseNamespace("id2")
+		assert.Equal(resultBuildErr, m.Handle(ctx))
+		resp := ctx.GetResponse("id2").(*httpprot.Response)
+		assert.Equal(http.StatusInternalServerError, resp.StatusCode())
+	}
+
+	invalid := &Spec{Rules: []*Rule{{Code: 200, Template: true, Body: "{{.req"}}}
+	assert.NotNil(invalid.Validate())
+	invalid = &Spec{Rules: []*Rule{{Code: 200, Body: "{{.req"}}}
+	assert.Nil(invalid.Validate())
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mqttpublisher provides the MQTTPublisher filter.
+package mqttpublisher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	sprig "github.com/go-task/slim-sprig"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of MQTTPublisher.
+	Kind = "MQTTPublisher"
+
+	resultInvalidTopic  = "invalidTopic"
+	resultPublishFailed = "publishFailed"
+
+	defaultTimeout = 5 * time.Second
+
+	// headerRetained overrides the retained flag of a message.
+	headerRetained = "X-Mqtt-Retained"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "MQTTPublisher publishes HTTP requests to an MQTT broker.",
+	Results:     []string{resultInvalidTopic, resultPublishFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &MQTTPublisher{spec: spec.(*Spec)}
+	},
+}
+
+var templateRegexp = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// MQTTPublisher is filter MQTTPublisher.
+	MQTTPublisher struct {
+		spec *Spec
+
+		topic     *template.Template
+		path      *regexp.Regexp
+		pathNames []string
+		timeout   time.Duration
+		publisher publisher
+	}
+
+	// Spec describes the MQTTPublisher.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Broker is the URL of the broker, like tcp://127.0.0.1:1883.
+		Broker   string `json:"broker" jsonschema:"required"`
+		ClientID string `json:"clientID,omitempty"`
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty" jsonschema:"writeOnly=true"`
+
+		// Path is the pattern of the request path, like /devices/{id},
+		// the values of the templates can be used in the topic.
+		Path string `json:"path,omitempty"`
+		// Topic is the template of the topic of the messages.
+		Topic    string `json:"topic" jsonschema:"required"`
+		QoS      byte   `json:"qos,omitempty" jsonschema:"minimum=0,maximum=2"`
+		Retained bool   `json:"retained,omitempty"`
+		// Timeout is the timeout to wait for the acknowledgment of the
+		// broker.
+		Timeout string `json:"timeout,omitempty" jsonschema:"format=duration"`
+	}
+
+	// Ack is the response of a published message.
+	Ack struct {
+		Topic string `json:"topic"`
+		QoS   byte   `json:"qos"`
+	}
+
+	// Err is the response of a failed message.
+	Err struct {
+		Err  string `json:"err"`
+		Code int    `json:"code"`
+	}
+
+	// topicData is the data to render the topic template.
+	topicData struct {
+		Method string
+		Path   string
+		Header http.Header
+		Query  url.Values
+		Vars   map[string]string
+	}
+
+	publisher interface {
+		publish(topic string, qos byte, retained bool, payload []byte, timeout time.Duration) error
+		close()
+	}
+
+	pahoPublisher struct {
+		client paho.Client
+	}
+)
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	if _, err := url.Parse(s.Broker); err != nil {
+		return fmt.Errorf("invalid broker %s: %v", s.Broker, err)
+	}
+	if _, err := parseTopic(s.Topic); err != nil {
+		return err
+	}
+	if _, _, err := parsePath(s.Path); err != nil {
+		return err
+	}
+	if s.Timeout != "" {
+		if _, err := time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %s: %v", s.Timeout, err)
+		}
+	}
+	return nil
+}
+
+func parseTopic(topic string) (*template.Template, error) {
+	t, err := template.New("").Funcs(sprig.TxtFuncMap()).Parse(topic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topic template %s: %v", topic, err)
+	}
+	return t, nil
+}
+
+// parsePath parses the path pattern into a regular expression and the
+// names of the templates.
+func parsePath(path string) (*regexp.Regexp, []string, error) {
+	if path == "" {
+		return nil, nil, nil
+	}
+
+	var sb strings.Builder
+	var names []string
+	sb.WriteString("^")
+	last := 0
+	for _, loc := range templateRegexp.FindAllStringSubmatchIndex(path, -1) {
+		sb.WriteString(regexp.QuoteMeta(path[last:loc[0]]))
+		sb.WriteString("([^/]+)")
+		names = append(names, path[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(path[last:]))
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid path %s: %v", path, err)
+	}
+	return re, names, nil
+}
+
+// Name returns the name of the MQTTPublisher filter instance.
+func (mp *MQTTPublisher) Name() string {
+	return mp.spec.Name()
+}
+
+// Kind returns the kind of MQTTPublisher.
+func (mp *MQTTPublisher) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the MQTTPublisher.
+func (mp *MQTTPublisher) Spec() filters.Spec {
+	return mp.spec
+}
+
+// Init initializes MQTTPublisher.
+func (mp *MQTTPublisher) Init() {
+	mp.reload()
+}
+
+// Inherit inherits previous generation of MQTTPublisher.
+func (mp *MQTTPublisher) Inherit(previousGeneration filters.Filter) {
+	mp.reload()
+}
+
+func (mp *MQTTPublisher) reload() {
+	spec := mp.spec
+
+	mp.topic, _ = parseTopic(spec.Topic)
+	mp.path, mp.pathNames, _ = parsePath(spec.Path)
+	mp.timeout = defaultTimeout
+	if spec.Timeout != "" {
+		mp.timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+
+	mp.publisher = newPahoPublisher(spec)
+}
+
+func newPahoPublisher(spec *Spec) *pahoPublisher {
+	clientID := spec.ClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("%s-%d", spec.Name(), time.Now().UnixNano())
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(spec.Broker).
+		SetClientID(clientID).
+		SetUsername(spec.Username).
+		SetPassword(spec.Password).
+		SetAutoReconnect(true).
+		// Connecting is retried in background, so a broker which is not
+		// ready doesn't block the pipeline.
+		SetConnectRetry(true).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logger.Warnf("%s: connection to MQTT broker %s lost: %v", spec.Name(), spec.Broker, err)
+		})
+
+	client := paho.NewClient(opts)
+	client.Connect()
+	return &pahoPublisher{client: client}
+}
+
+func (p *pahoPublisher) publish(topic string, qos byte, retained bool, payload []byte, timeout time.Duration) error {
+	token := p.client.Publish(topic, qos, retained, payload)
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("publish timeout")
+	}
+	return token.Error()
+}
+
+func (p *pahoPublisher) close() {
+	p.client.Disconnect(250)
+}
+
+// buildTopic builds the topic of the request.
+func (mp *MQTTPublisher) buildTopic(req *httpprot.Request) (string, error) {
+	data := &topicData{
+		Method: req.Method(),
+		Path:   req.Path(),
+		Header: req.HTTPHeader(),
+		Query:  req.Std().URL.Query(),
+		Vars:   map[string]string{},
+	}
+
+	if mp.path != nil {
+		m := mp.path.FindStringSubmatch(req.Path())
+		if m == nil {
+			return "", fmt.Errorf("path %s doesn't match %s", req.Path(), mp.spec.Path)
+		}
+		for i, name := range mp.pathNames {
+			data.Vars[name] = m[i+1]
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := mp.topic.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	// Wildcards are not allowed in the topics of published messages.
+	topic := buf.String()
+	if topic == "" || strings.ContainsAny(topic, "+#\x00") {
+		return "", fmt.Errorf("invalid topic %q", topic)
+	}
+	return topic, nil
+}
+
+func setResponse(ctx *context.Context, code int, v interface{}) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	data, _ := codectool.MarshalJSON(v)
+	resp.SetStatusCode(code)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.HTTPHeader().Set("Content-Length", strconv.Itoa(len(data)))
+	resp.SetPayload(data)
+	ctx.SetOutputResponse(resp)
+}
+
+// Handle publishes the body of the request to the topic.
+func (mp *MQTTPublisher) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	topic, err := mp.buildTopic(req)
+	if err != nil {
+		setResponse(ctx, http.StatusBadRequest, &Err{Err: err.Error(), Code: http.StatusBadRequest})
+		return resultInvalidTopic
+	}
+
+	body, err := io.ReadAll(req.GetPayload())
+	if err != nil {
+		setResponse(ctx, http.StatusBadRequest, &Err{Err: err.Error(), Code: http.StatusBadRequest})
+		return resultPublishFailed
+	}
+
+	retained := mp.spec.Retained
+	if v := req.HTTPHeader().Get(headerRetained); v != "" {
+		retained, _ = strconv.ParseBool(v)
+	}
+
+	err = mp.publisher.publish(topic, mp.spec.QoS, retained, body, mp.timeout)
+	if err != nil {
+		logger.Errorf("%s: publish to topic %s failed: %v", mp.Name(), topic, err)
+		setResponse(ctx, http.StatusServiceUnavailable, &Err{Err: err.Error(), Code: http.StatusServiceUnavailable})
+		return resultPublishFailed
+	}
+
+	setResponse(ctx, http.StatusOK, &Ack{Topic: topic, QoS: mp.spec.QoS})
+	return ""
+}
+
+// Status returns status.
+func (mp *MQTTPublisher) Status() interface{} {
+	return nil
+}
+
+// Close closes MQTTPublisher.
+func (mp *MQTTPublisher) Close() {
+	mp.publisher.close()
+}
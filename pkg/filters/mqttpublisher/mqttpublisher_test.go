@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttpublisher
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+type message struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  string
+}
+
+type mockPublisher struct {
+	messages []*message
+	err      error
+}
+
+func (p *mockPublisher) publish(topic string, qos byte, retained bool, payload []byte, timeout time.Duration) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, &message{topic, qos, retained, string(payload)})
+	return nil
+}
+
+func (p *mockPublisher) close() {}
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newMQTTPublisher(t *testing.T, yamlConfig string) (*MQTTPublisher, *mockPublisher) {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mp := kind.CreateInstance(spec).(*MQTTPublisher)
+	mp.Init()
+	mp.publisher.close()
+
+	p := &mockPublisher{}
+	mp.publisher = p
+	return mp, p
+}
+
+func newContext(t *testing.T, method, url, body string, header http.Header) *context.Context {
+	stdr, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+	req.FetchPayload(0)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestMQTTPublisher(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, p := newMQTTPublisher(t, `
+kind: MQTTPublisher
+name: mqtt-publisher
+broker: tcp://127.0.0.1:1
+path: /devices/{id}/{action}
+topic: '{{.Header.Get "X-Tenant"}}/devices/{{.Vars.id}}/{{.Vars.action}}'
+qos: 1
+timeout: 1s
+`)
+	defer mp.Close()
+	assert.Equal(Kind, mp.Kind().Name)
+	assert.Equal("mqtt-publisher", mp.Name())
+	assert.Nil(mp.Status())
+
+	header := http.Header{"X-Tenant": []string{"acme"}}
+	ctx := newContext(t, http.MethodPost, "http://example.com/devices/lamp-1/on", `{"level":80}`, header)
+	assert.Equal("", mp.Handle(ctx))
+	assert.Equal(&message{"acme/devices/lamp-1/on", 1, false, `{"level":80}`}, p.messages[0])
+
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.JSONEq(`{"topic":"acme/devices/lamp-1/on","qos":1}`, string(resp.RawPayload()))
+
+	header.Set("X-Mqtt-Retained", "true")
+	ctx = newContext(t, http.MethodPost, "http://example.com/devices/lamp-1/off", ``, header)
+	assert.Equal("", mp.Handle(ctx))
+	assert.True(p.messages[1].retained)
+
+	// the path doesn't match.
+	ctx = newContext(t, http.MethodPost, "http://example.com/lamp-1", `{}`, header)
+	assert.Equal(resultInvalidTopic, mp.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// wildcards are not allowed.
+	header.Set("X-Tenant", "#")
+	ctx = newContext(t, http.MethodPost, "http://example.com/devices/lamp-1/on", `{}`, header)
+	assert.Equal(resultInvalidTopic, mp.Handle(ctx))
+
+	p.err = fmt.Errorf("publish timeout")
+	header.Set("X-Tenant", "acme")
+	ctx = newContext(t, http.MethodPost, "http://example.com/devices/lamp-1/on", `{}`, header)
+	assert.Equal(resultPublishFailed, mp.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Broker: "tcp://127.0.0.1:1883", Topic: "a/{{.Vars.id}}", Path: "/{id}", Timeout: "1s"}
+	assert.Nil(spec.Validate())
+
+	spec = &Spec{Broker: "tcp://127.0.0.1:1883", Topic: "a/{{.Vars.id"}
+	assert.NotNil(spec.Validate())
+
+	spec = &Spec{Broker: "tcp://127.0.0.1:1883", Topic: "a", Timeout: "abc"}
+	assert.NotNil(spec.Validate())
+
+	spec = &Spec{Broker: "://", Topic: "a"}
+	assert.NotNil(spec.Validate())
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/MicahParks/keyfunc"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters"
@@ -82,6 +83,9 @@ type OIDCAdaptor struct {
 	redirectPath string
 	oidcConfig   *oidcConfig
 	jwks         *keyfunc.JWKS
+
+	sessionTTL time.Duration
+	refreshes  singleflight.Group
 }
 
 // Spec defines the spec of OIDCAdaptor.
@@ -91,16 +95,26 @@ type Spec struct {
 	CookieName string `json:"cookieName"`
 
 	ClientID     string `json:"clientId" jsonschema:"required"`
-	ClientSecret string `json:"clientSecret" jsonschema:"required"`
+	ClientSecret string `json:"clientSecret" jsonschema:"required,writeOnly=true"`
 
 	Discovery string `json:"discovery"`
+	// Issuer is used to discover the provider configuration at
+	// <issuer>/.well-known/openid-configuration if Discovery is empty.
+	Issuer string `json:"issuer,omitempty"`
 
 	// If Discovery not configured, following should be configured for OAuth2
 	AuthorizationEndpoint string `json:"authorizationEndpoint"`
 	TokenEndpoint         string `json:"tokenEndpoint"`
 	UserInfoEndpoint      string `json:"userinfoEndpoint"`
 
-	RedirectURI string `json:"redirectURI" jsonschema:"required"`
+	RedirectURI string   `json:"redirectURI" jsonschema:"required"`
+	Scopes      []string `json:"scopes,omitempty"`
+
+	// ManageSession makes the gateway keep the tokens in a session
+	// identified by the cookie, and refresh them when they expire.
+	ManageSession bool   `json:"manageSession,omitempty"`
+	SessionTTL    string `json:"sessionTTL,omitempty" jsonschema:"format=duration"`
+	SecureCookie  bool   `json:"secureCookie,omitempty"`
 }
 
 type oidcConfig struct {
@@ -133,6 +147,23 @@ func init() {
 	filters.Register(kind)
 }
 
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.SessionTTL != "" {
+		if _, err := time.ParseDuration(spec.SessionTTL); err != nil {
+			return fmt.Errorf("invalid sessionTTL: %v", err)
+		}
+	}
+	return nil
+}
+
+func (spec *Spec) discoveryURL() string {
+	if spec.Discovery != "" || spec.Issuer == "" {
+		return spec.Discovery
+	}
+	return strings.TrimSuffix(spec.Issuer, "/") + "/.well-known/openid-configuration"
+}
+
 // Name returns the name of the OIDCAdaptor filter instance.
 func (o *OIDCAdaptor) Name() string {
 	return o.spec.Name()
@@ -152,7 +183,7 @@ func (o *OIDCAdaptor) Kind() *filters.Kind {
 func (o *OIDCAdaptor) Init() {
 	// delegate store interface operation to itself for testing
 	o.store = o
-	if len(o.spec.Discovery) > 0 {
+	if len(o.spec.discoveryURL()) > 0 {
 		o.initDiscoveryOIDCConf()
 	} else {
 		o.oidcConfig = &oidcConfig{
@@ -169,12 +200,16 @@ func (o *OIDCAdaptor) Init() {
 		logger.Errorf("parse redirectURI error: %s", err)
 	}
 	o.redirectPath = parsed.Path
+
+	o.sessionTTL = defaultSessionTTL
+	if o.spec.SessionTTL != "" {
+		o.sessionTTL, _ = time.ParseDuration(o.spec.SessionTTL)
+	}
 }
 
 // Inherit inherits previous generation of the filter instance.
 func (o *OIDCAdaptor) Inherit(previousGeneration filters.Filter) {
 	o.Init()
-	previousGeneration.Close()
 }
 
 // Handle handles the request.
@@ -187,6 +222,14 @@ func (o *OIDCAdaptor) Handle(ctx *context.Context) (result string) {
 	}
 	spec := o.spec
 
+	if o.oidcConfig == nil {
+		return errorResp(rw, "invalid OIDC provider configuration")
+	}
+
+	if spec.ManageSession {
+		return o.handleSession(ctx)
+	}
+
 	if len(spec.CookieName) != 0 {
 		if _, e := req.Cookie(spec.CookieName); e == nil {
 			return ""
@@ -218,12 +261,21 @@ func (o *OIDCAdaptor) Close() {
 
 func (o *OIDCAdaptor) initDiscoveryOIDCConf() {
 	// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationRequest
-	req, _ := http.NewRequest(http.MethodGet, o.spec.Discovery, nil)
+	discovery := o.spec.discoveryURL()
+	req, _ := http.NewRequest(http.MethodGet, discovery, nil)
 	resp, err := httpCli.Do(req)
 	var oidcConf oidcConfig
 	err = readResp(resp, err, &oidcConf)
 	if err != nil {
-		logger.Errorf("req discovery endpoint['%s'] error: %s", err)
+		logger.Errorf("req discovery endpoint['%s'] error: %s", discovery, err)
+	}
+	// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationValidation
+	// the configuration of another issuer is never used, or its tokens
+	// would be accepted.
+	if o.spec.Issuer != "" && oidcConf.Issuer != "" &&
+		strings.TrimSuffix(oidcConf.Issuer, "/") != strings.TrimSuffix(o.spec.Issuer, "/") {
+		logger.Errorf("issuer of discovery endpoint['%s'] is %s, but %s is expected", discovery, oidcConf.Issuer, o.spec.Issuer)
+		return
 	}
 	o.oidcConfig = &oidcConf
 	var interval time.Duration
@@ -246,16 +298,11 @@ func (o *OIDCAdaptor) initDiscoveryOIDCConf() {
 func (o *OIDCAdaptor) handleOIDCCallback(ctx *context.Context) string {
 	req := ctx.GetInputRequest().(*httpprot.Request)
 	rw := ctx.GetOutputResponse().(*httpprot.Response)
-	spec := o.spec
-	authCode := req.Std().URL.Query().Get("code")
 	state := req.Std().URL.Query().Get("state")
-	err := o.validateCodeAndState(authCode, state)
-	if err != nil {
-		return filterResp(rw, http.StatusForbidden, err.Error())
-	}
-	oidcToken, err := o.fetchOIDCToken(authCode, state, spec, rw, req)
+
+	oidcToken, userInfo, status, err := o.authenticate(req)
 	if err != nil {
-		return errorResp(rw, "fetch OIDC token error: "+err.Error())
+		return filterResp(rw, status, err.Error())
 	}
 	if o.setAccessTokenHeader {
 		if len(req.HTTPHeader().Get("X-Access-Token")) == 0 {
@@ -265,44 +312,72 @@ func (o *OIDCAdaptor) handleOIDCCallback(ctx *context.Context) string {
 	reqURL := o.store.get(clusterCacheKey("request_url", state))
 	req.Header().Set("X-Origin-Request-URL", reqURL)
 
+	if len(oidcToken.IDToken) > 0 && o.setIDTokenHeader {
+		req.Header().Set("X-ID-Token", oidcToken.IDToken)
+	}
+	if o.setUserInfoHeader {
+		setUserInfoHeader(req, userInfo)
+	}
+	return ""
+}
+
+// authenticate exchanges the authorization code of the callback request
+// for the tokens, and gets the user info from the ID token or the user info
+// endpoint, the returned status code should be used on errors.
+func (o *OIDCAdaptor) authenticate(req *httpprot.Request) (*oidcIDToken, map[string]any, int, error) {
+	spec := o.spec
+	authCode := req.Std().URL.Query().Get("code")
+	state := req.Std().URL.Query().Get("state")
+	nonce, err := o.validateCodeAndState(authCode, state)
+	if err != nil {
+		return nil, nil, http.StatusForbidden, err
+	}
+	oidcToken, err := o.fetchOIDCToken(url.Values{
+		"code":         {authCode},
+		"grant_type":   {"authorization_code"},
+		"state":        {state},
+		"redirect_uri": {spec.RedirectURI},
+	}, spec)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, fmt.Errorf("fetch OIDC token error: %v", err)
+	}
+
 	userInfo := map[string]any{}
 	if len(oidcToken.IDToken) > 0 {
 		parseToken, err := o.validateIDToken(oidcToken.IDToken)
 		if err != nil {
-			return filterResp(rw, http.StatusUnauthorized, "invalid oidc id token")
-		}
-		if o.setIDTokenHeader {
-			req.Header().Set("X-ID-Token", oidcToken.IDToken)
+			return nil, nil, http.StatusUnauthorized, fmt.Errorf("invalid oidc id token")
 		}
 		if claims, ok := parseToken.Claims.(jwt.MapClaims); ok {
+			// the nonce is always sent, so it must be in the ID token.
+			if n, ok := claims["nonce"]; !ok || n != nonce {
+				return nil, nil, http.StatusUnauthorized, fmt.Errorf("invalid oidc id token nonce")
+			}
 			userInfo = claims
 		}
 	} else {
 		err := o.fetchOAuth2Userinfo(authCode, oidcToken.AccessToken, &userInfo)
 		if err != nil {
-			return errorResp(rw, "fetch OAuth2 userinfo error: "+err.Error())
+			return nil, nil, http.StatusInternalServerError, fmt.Errorf("fetch OAuth2 userinfo error: %v", err)
 		}
 	}
-	if o.setUserInfoHeader {
-		jsonBytes, err := json.Marshal(userInfo)
-		if err != nil {
-			logger.Errorf("marshal oidc userinfo to json error: %s", err)
-		}
-		req.Header().Set("X-User-Info", base64.StdEncoding.EncodeToString(jsonBytes))
+	return oidcToken, userInfo, http.StatusOK, nil
+}
+
+func setUserInfoHeader(req *httpprot.Request, userInfo map[string]any) {
+	jsonBytes, err := json.Marshal(userInfo)
+	if err != nil {
+		logger.Errorf("marshal oidc userinfo to json error: %s", err)
 	}
-	return ""
+	req.Header().Set("X-User-Info", base64.StdEncoding.EncodeToString(jsonBytes))
 }
 
-func (o *OIDCAdaptor) fetchOIDCToken(authCode string, state string, spec *Spec, rw *httpprot.Response, req *httpprot.Request) (*oidcIDToken, error) {
+// fetchOIDCToken requests the token endpoint with the grant in tokenFormData,
+// which is either an authorization code or a refresh token.
+func (o *OIDCAdaptor) fetchOIDCToken(tokenFormData url.Values, spec *Spec) (*oidcIDToken, error) {
 	// client_secret_post || client_secret_basic
-	tokenFormData := url.Values{
-		"client_id":     {o.spec.ClientID},
-		"client_secret": {o.spec.ClientSecret},
-		"code":          {authCode},
-		"grant_type":    {"authorization_code"},
-		"state":         {state},
-		"redirect_uri":  {spec.RedirectURI},
-	}
+	tokenFormData.Set("client_id", spec.ClientID)
+	tokenFormData.Set("client_secret", spec.ClientSecret)
 	// https://openid.net/specs/openid-connect-core-1_0.html#TokenRequest
 	tokenReq, _ := http.NewRequest(http.MethodPost, o.oidcConfig.TokenEndpoint, strings.NewReader(tokenFormData.Encode()))
 	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -313,6 +388,9 @@ func (o *OIDCAdaptor) fetchOIDCToken(authCode string, state string, spec *Spec,
 	resp, err := httpCli.Do(tokenReq)
 	var oidcToken oidcIDToken
 	err = readResp(resp, err, &oidcToken)
+	if err == nil && oidcToken.AccessToken == "" {
+		err = fmt.Errorf("no access token in response")
+	}
 	if err != nil {
 		logger.Errorf("handle oidc tokenRequest['%s'] error: %s", o.oidcConfig.TokenEndpoint, err)
 		return nil, err
@@ -354,19 +432,21 @@ func (o *OIDCAdaptor) validateIDToken(idJwtToken string) (*jwt.Token, error) {
 	return parseJwtToken, nil
 }
 
-func (o *OIDCAdaptor) validateCodeAndState(code, state string) error {
+// validateCodeAndState validates the callback, and returns the nonce sent
+// with the authorization request of the state.
+func (o *OIDCAdaptor) validateCodeAndState(code, state string) (string, error) {
 	errFmt := "oidc callback: %s"
 	if len(state) == 0 {
-		return fmt.Errorf(errFmt, "empty state")
+		return "", fmt.Errorf(errFmt, "empty state")
 	}
-	cacheState := o.store.get(clusterCacheKey("state", state))
-	if cacheState != "1" {
-		return fmt.Errorf(errFmt, "invalid state")
+	nonce := o.store.get(clusterCacheKey("state", state))
+	if nonce == "" {
+		return "", fmt.Errorf(errFmt, "invalid state")
 	}
 	if len(code) == 0 {
-		return fmt.Errorf(errFmt, "invalid code")
+		return "", fmt.Errorf(errFmt, "invalid code")
 	}
-	return nil
+	return nonce, nil
 }
 
 func (o *OIDCAdaptor) buildAuthorizeURL(req *httpprot.Request) string {
@@ -375,10 +455,12 @@ func (o *OIDCAdaptor) buildAuthorizeURL(req *httpprot.Request) string {
 	authURLBuilder.WriteString(o.oidcConfig.AuthorizationEndpoint)
 	authURLBuilder.WriteString("?client_id=" + o.spec.ClientID)
 	state := strings.ReplaceAll(uuid.New().String(), "-", "")
+	// nonce is optional, it is kept with the state to verify the ID token
+	nonce := strings.ReplaceAll(uuid.New().String(), "-", "")
 	// state is recommended
 	authURLBuilder.WriteString("&state=" + state)
 	// End-user may spend some time doing login stuff, so we use a 10-minute timeout
-	err := o.store.put(clusterCacheKey("state", state), "1", 10*time.Minute)
+	err := o.store.put(clusterCacheKey("state", state), nonce, 10*time.Minute)
 	if err != nil {
 		logger.Errorf("put oidc state error: %s", err)
 	}
@@ -393,12 +475,12 @@ func (o *OIDCAdaptor) buildAuthorizeURL(req *httpprot.Request) string {
 	if err != nil {
 		logger.Errorf("put origin request url error: %s", err)
 	}
-	// nonce is optional
-	nonce := strings.ReplaceAll(uuid.New().String(), "-", "")
 	authURLBuilder.WriteString("&nonce=" + nonce)
 	authURLBuilder.WriteString("&response_type=code")
 	authURLBuilder.WriteString("&scope=")
-	if len(o.oidcConfig.ScopesSupported) > 0 {
+	if len(o.spec.Scopes) > 0 {
+		authURLBuilder.WriteString(url.QueryEscape(strings.Join(o.spec.Scopes, " ")))
+	} else if len(o.oidcConfig.ScopesSupported) > 0 {
 		authURLBuilder.WriteString(strings.Join(o.oidcConfig.ScopesSupported, "+"))
 	} else {
 		authURLBuilder.WriteString("user")
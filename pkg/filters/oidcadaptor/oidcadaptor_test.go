@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oidcadaptor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+type memoryStore struct {
+	sync.Mutex
+	values map[string]string
+}
+
+func (ms *memoryStore) put(key, value string, timeout time.Duration) error {
+	ms.Lock()
+	defer ms.Unlock()
+	ms.values[key] = value
+	return nil
+}
+
+func (ms *memoryStore) get(key string) string {
+	ms.Lock()
+	defer ms.Unlock()
+	return ms.values[key]
+}
+
+// provider is a fake OpenID provider.
+type provider struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	nonce     string
+	noNonce   bool
+	refreshes int
+}
+
+func newProvider(t *testing.T) *provider {
+	p := &provider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[]}`))
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			if r.PostForm.Get("code") != "good-code" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+			claims := jwt.MapClaims{"sub": "alice", "nonce": p.nonce}
+			if p.noNonce {
+				delete(claims, "nonce")
+			}
+			idToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token":  "access-1",
+				"refresh_token": "refresh-1",
+				"id_token":      idToken,
+				// expires immediately to force a refresh
+				"expires_in": 1,
+			})
+		case "refresh_token":
+			if r.PostForm.Get("refresh_token") != "refresh-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+			p.refreshes++
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "access-2",
+				"expires_in":   3600,
+			})
+		}
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func newOIDCAdaptor(t *testing.T, yamlConfig string) (*OIDCAdaptor, *memoryStore) {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	o := kind.CreateInstance(spec).(*OIDCAdaptor)
+	o.Init()
+	ms := &memoryStore{values: map[string]string{}}
+	o.store = ms
+	return o, ms
+}
+
+func handle(o *OIDCAdaptor, target string, cookies ...*http.Cookie) (string, *httpprot.Request, *httpprot.Response) {
+	stdr := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, c := range cookies {
+		stdr.AddCookie(c)
+	}
+	req, _ := httpprot.NewRequest(stdr)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	result := o.Handle(ctx)
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	return result, req, resp
+}
+
+func TestSessionFlow(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newProvider(t)
+	o, _ := newOIDCAdaptor(t, `
+name: oidc
+kind: OIDCAdaptor
+clientId: client
+clientSecret: secret
+issuer: `+p.URL+`
+redirectURI: http://example.com/oidc/callback
+scopes: [openid, profile]
+manageSession: true
+sessionTTL: 1h
+`)
+	assert.Equal(p.URL+"/token", o.oidcConfig.TokenEndpoint)
+
+	// not logged in, redirected to the provider
+	result, _, resp := handle(o, "http://example.com/app?x=1")
+	assert.Equal(resultFiltered, result)
+	assert.Equal(http.StatusFound, resp.StatusCode())
+	location, err := url.Parse(resp.HTTPHeader().Get("Location"))
+	assert.Nil(err)
+	assert.Equal(p.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal("openid profile", location.Query().Get("scope"))
+	state := location.Query().Get("state")
+	p.nonce = location.Query().Get("nonce")
+
+	// invalid state and code
+	result, _, resp = handle(o, "http://example.com/oidc/callback?code=good-code&state=unknown")
+	assert.Equal(resultFiltered, result)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+	result, _, resp = handle(o, "http://example.com/oidc/callback?code=bad-code&state="+state)
+	assert.Equal(resultFiltered, result)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode())
+
+	// ID tokens without the nonce are rejected
+	p.noNonce = true
+	result, _, resp = handle(o, "http://example.com/oidc/callback?code=good-code&state="+state)
+	assert.Equal(resultFiltered, result)
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode())
+	p.noNonce = false
+
+	// callback creates the session and redirects to the original URL
+	result, _, resp = handle(o, "http://example.com/oidc/callback?code=good-code&state="+state)
+	assert.Equal(resultFiltered, result)
+	assert.Equal(http.StatusFound, resp.StatusCode())
+	assert.Equal("http://example.com/app?x=1", resp.HTTPHeader().Get("Location"))
+	cookies := (&http.Response{Header: resp.HTTPHeader()}).Cookies()
+	assert.Len(cookies, 1)
+	cookie := cookies[0]
+	assert.Equal(defaultSessionCookieName, cookie.Name)
+	assert.True(cookie.HttpOnly)
+	assert.Equal(3600, cookie.MaxAge)
+
+	// the access token is expired, so it is refreshed
+	result, req, _ := handle(o, "http://example.com/app", cookie)
+	assert.Equal("", result)
+	assert.Equal("access-2", req.HTTPHeader().Get("X-Access-Token"))
+	assert.NotEmpty(req.HTTPHeader().Get("X-Id-Token"))
+	assert.NotEmpty(req.HTTPHeader().Get("X-User-Info"))
+
+	result, req, _ = handle(o, "http://example.com/app", cookie)
+	assert.Equal("", result)
+	assert.Equal("access-2", req.HTTPHeader().Get("X-Access-Token"))
+	assert.Equal(1, p.refreshes)
+
+	// unknown sessions are redirected
+	result, _, resp = handle(o, "http://example.com/app", &http.Cookie{Name: defaultSessionCookieName, Value: "forged"})
+	assert.Equal(resultFiltered, result)
+	assert.Equal(http.StatusFound, resp.StatusCode())
+}
+
+func TestSessionRefreshFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newProvider(t)
+	o, ms := newOIDCAdaptor(t, `
+name: oidc
+kind: OIDCAdaptor
+clientId: client
+clientSecret: secret
+discovery: `+p.URL+`/.well-known/openid-configuration
+redirectURI: http://example.com/oidc/callback
+manageSession: true
+`)
+
+	s := &session{
+		AccessToken:  "access-1",
+		RefreshToken: "revoked",
+		Expiry:       time.Now().Add(-time.Minute),
+		Deadline:     time.Now().Add(time.Hour),
+	}
+	assert.Nil(o.saveSession("sid", s))
+	assert.NotEmpty(ms.get(clusterCacheKey("session", "sid")))
+
+	result, _, resp := handle(o, "http://example.com/app", &http.Cookie{Name: defaultSessionCookieName, Value: "sid"})
+	assert.Equal(resultFiltered, result)
+	assert.Equal(http.StatusFound, resp.StatusCode())
+}
+
+func TestIssuerMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newProvider(t)
+	o, _ := newOIDCAdaptor(t, `
+name: oidc
+kind: OIDCAdaptor
+clientId: client
+clientSecret: secret
+issuer: https://accounts.example.com
+discovery: `+p.URL+`/.well-known/openid-configuration
+redirectURI: http://example.com/oidc/callback
+`)
+	assert.Nil(o.oidcConfig)
+
+	result, _, resp := handle(o, "http://example.com/app")
+	assert.Equal(resultFiltered, result)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode())
+}
+
+func TestSpecValidate(t *testing.T) {
+	spec := &Spec{SessionTTL: "1x"}
+	assert.NotNil(t, spec.Validate())
+	spec.SessionTTL = "8h"
+	assert.Nil(t, spec.Validate())
+
+	spec = &Spec{Issuer: "https://accounts.example.com/"}
+	assert.Equal(t, "https://accounts.example.com/.well-known/openid-configuration", spec.discoveryURL())
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oidcadaptor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	defaultSessionTTL        = 24 * time.Hour
+	defaultSessionCookieName = "eg-oidc-session"
+
+	// tokens are refreshed a little earlier than they expire, so that they
+	// are still valid when they reach the backend.
+	refreshSkew = 30 * time.Second
+)
+
+// session is the login session of an End-User, kept in the cluster so that
+// all nodes of the cluster share it.
+type session struct {
+	AccessToken  string         `json:"accessToken"`
+	RefreshToken string         `json:"refreshToken,omitempty"`
+	IDToken      string         `json:"idToken,omitempty"`
+	Expiry       time.Time      `json:"expiry,omitempty"`
+	Deadline     time.Time      `json:"deadline"`
+	UserInfo     map[string]any `json:"userInfo,omitempty"`
+}
+
+func (s *session) expired(now time.Time) bool {
+	return !s.Expiry.IsZero() && now.Add(refreshSkew).After(s.Expiry)
+}
+
+func (s *session) update(token *oidcIDToken, now time.Time) {
+	s.AccessToken = token.AccessToken
+	// The refresh token and the ID token are optional in refresh responses.
+	if token.RefreshToken != "" {
+		s.RefreshToken = token.RefreshToken
+	}
+	if token.IDToken != "" {
+		s.IDToken = token.IDToken
+	}
+	s.Expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		s.Expiry = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+}
+
+func (o *OIDCAdaptor) sessionCookieName() string {
+	if o.spec.CookieName != "" {
+		return o.spec.CookieName
+	}
+	return defaultSessionCookieName
+}
+
+func (o *OIDCAdaptor) loadSession(id string) *session {
+	data := o.store.get(clusterCacheKey("session", id))
+	if data == "" {
+		return nil
+	}
+	s := &session{}
+	if err := json.Unmarshal([]byte(data), s); err != nil {
+		logger.Errorf("unmarshal oidc session error: %s", err)
+		return nil
+	}
+	if time.Now().After(s.Deadline) {
+		return nil
+	}
+	return s
+}
+
+func (o *OIDCAdaptor) saveSession(id string, s *session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return o.store.put(clusterCacheKey("session", id), string(data), time.Until(s.Deadline))
+}
+
+// refreshSession refreshes the tokens of an expired session, concurrent
+// requests of the same session share one refresh.
+func (o *OIDCAdaptor) refreshSession(id string, s *session) (*session, bool) {
+	if s.RefreshToken == "" {
+		return nil, false
+	}
+
+	v, err, _ := o.refreshes.Do(id, func() (interface{}, error) {
+		token, err := o.fetchOIDCToken(url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {s.RefreshToken},
+		}, o.spec)
+		if err != nil {
+			return nil, err
+		}
+
+		refreshed := *s
+		refreshed.update(token, time.Now())
+		if err = o.saveSession(id, &refreshed); err != nil {
+			logger.Errorf("save oidc session error: %s", err)
+		}
+		return &refreshed, nil
+	})
+	if err != nil {
+		return nil, false
+	}
+	return v.(*session), true
+}
+
+// handleSession handles the request when the gateway manages the sessions:
+// requests with a valid session are passed to the backend with the tokens
+// in headers, the callback creates the session, and the others are
+// redirected to the authorization endpoint.
+func (o *OIDCAdaptor) handleSession(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	rw := ctx.GetOutputResponse().(*httpprot.Response)
+
+	// The headers are only trusted if they are set by the gateway.
+	for _, h := range []string{"X-Access-Token", "X-ID-Token", "X-User-Info", "X-Origin-Request-URL"} {
+		req.HTTPHeader().Del(h)
+	}
+
+	if c, err := req.Cookie(o.sessionCookieName()); err == nil && c.Value != "" {
+		if s := o.loadSession(c.Value); s != nil {
+			ok := true
+			if s.expired(time.Now()) {
+				s, ok = o.refreshSession(c.Value, s)
+			}
+			if ok {
+				o.setSessionHeaders(req, s)
+				return ""
+			}
+		}
+	}
+
+	if req.Path() == o.redirectPath {
+		return o.handleSessionCallback(ctx)
+	}
+
+	rw.SetStatusCode(http.StatusFound)
+	rw.Header().Set("Location", o.buildAuthorizeURL(req))
+	return resultFiltered
+}
+
+func (o *OIDCAdaptor) handleSessionCallback(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	rw := ctx.GetOutputResponse().(*httpprot.Response)
+	state := req.Std().URL.Query().Get("state")
+
+	token, userInfo, status, err := o.authenticate(req)
+	if err != nil {
+		return filterResp(rw, status, err.Error())
+	}
+
+	now := time.Now()
+	s := &session{Deadline: now.Add(o.sessionTTL), UserInfo: userInfo}
+	s.update(token, now)
+
+	id := strings.ReplaceAll(uuid.New().String(), "-", "")
+	if err = o.saveSession(id, s); err != nil {
+		return errorResp(rw, "save oidc session error: "+err.Error())
+	}
+
+	cookie := &http.Cookie{
+		Name:     o.sessionCookieName(),
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(o.sessionTTL.Seconds()),
+		Secure:   o.spec.SecureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	rw.HTTPHeader().Add("Set-Cookie", cookie.String())
+
+	location := o.store.get(clusterCacheKey("request_url", state))
+	if location == "" {
+		location = "/"
+	}
+	rw.SetStatusCode(http.StatusFound)
+	rw.Header().Set("Location", location)
+	return resultFiltered
+}
+
+func (o *OIDCAdaptor) setSessionHeaders(req *httpprot.Request, s *session) {
+	if o.setAccessTokenHeader {
+		req.Header().Set("X-Access-Token", s.AccessToken)
+	}
+	if o.setIDTokenHeader && s.IDToken != "" {
+		req.Header().Set("X-ID-Token", s.IDToken)
+	}
+	if o.setUserInfoHeader {
+		setUserInfoHeader(req, s.UserInfo)
+	}
+}
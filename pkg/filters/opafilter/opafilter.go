@@ -20,18 +20,23 @@ package opafilter
 
 import (
 	stdctx "context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/textproto"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/open-policy-agent/opa/rego"
 
+	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
 	"github.com/megaease/easegress/v2/pkg/util/stringtool"
 )
 
@@ -40,11 +45,14 @@ const (
 	kindName          = "OPAFilter"
 	resultFiltered    = "opaDenied"
 	opaErrorHeaderKey = "x-eg-opa-error"
+	defaultDecision   = "data.http.allow"
+	maxResults        = 10
 )
 
 var (
 	errOpaNoResult          = errors.New("received no results from rego policy. Are you setting data.http.allow")
 	errOpaInvalidResultType = errors.New("got an invalid type from repo policy. Only a boolean or map is valid")
+	errOpaNoPolicy          = errors.New("no rego policy is loaded")
 )
 
 var kind = &filters.Kind{
@@ -65,7 +73,10 @@ var kind = &filters.Kind{
 type OPAFilter struct {
 	spec                  *Spec
 	includedHeadersParsed []string `yaml:"includedHeadersParsed"`
-	regoQuery             *rego.PreparedEvalQuery
+	regoQuery             atomic.Pointer[rego.PreparedEvalQuery]
+
+	stopCtx stdctx.Context
+	cancel  stdctx.CancelFunc
 }
 
 // Spec is the spec of the OPAFilter.
@@ -75,12 +86,78 @@ type Spec struct {
 	IncludedHeaders  string `yaml:"includedHeaders"`
 	ReadBody         bool   `yaml:"readBody"`
 	Policy           string `yaml:"policy"`
+	// PolicyKind is the kind of the custom data whose items are rego
+	// policies, the policies are reloaded when the items change.
+	PolicyKind string `yaml:"policyKind"`
+	// Decision is the rule to evaluate, its value is a boolean, or an
+	// object with the allow, status_code, headers, body and result fields.
+	Decision string `yaml:"decision"`
+}
+
+// policyItem is a custom data item of the PolicyKind.
+type policyItem struct {
+	Name   string `json:"name"`
+	Policy string `json:"policy"`
+}
+
+// decision is the evaluation result of the decision rule.
+type decision struct {
+	allow      bool
+	statusCode int
+	headers    map[string]string
+	body       string
+	result     string
 }
 
 func init() {
+	for i := 0; i < maxResults; i++ {
+		kind.Results = append(kind.Results, fmt.Sprintf("result%d", i))
+	}
 	filters.Register(kind)
 }
 
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Policy == "" && spec.PolicyKind == "" {
+		return fmt.Errorf("neither policy nor policyKind is specified")
+	}
+	if spec.PolicyKind != "" && spec.Policy == "" {
+		return nil
+	}
+	_, err := spec.prepare(nil)
+	return err
+}
+
+// prepare prepares the query of the decision rule with the inline policy
+// and the policies from the custom data.
+func (spec *Spec) prepare(policies map[string]string) (*rego.PreparedEvalQuery, error) {
+	decision := spec.Decision
+	if decision == "" {
+		decision = defaultDecision
+	}
+
+	options := []func(*rego.Rego){rego.Query("result = " + decision)}
+	if spec.Policy != "" {
+		options = append(options, rego.Module("inline.rego.policy", spec.Policy))
+	}
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		options = append(options, rego.Module(name+".rego", policies[name]))
+	}
+
+	ctx, cancelFunc := stdctx.WithTimeout(stdctx.Background(), 5*time.Second)
+	defer cancelFunc()
+	query, err := rego.New(options...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create PrepareForEval rego query: %s", err)
+	}
+	return &query, nil
+}
+
 // Name returns the name of the OPAFilter filter instance.
 func (o *OPAFilter) Name() string {
 	return o.spec.Name()
@@ -111,23 +188,93 @@ func (o *OPAFilter) Init() {
 		}
 	}
 	o.includedHeadersParsed = o.includedHeadersParsed[:n]
-	ctx, cancelFunc := stdctx.WithTimeout(stdctx.Background(), 5*time.Second)
-	query, err := rego.New(
-		rego.Query("result = data.http.allow"),
-		rego.Module("inline.rego.policy", o.spec.Policy),
-	).PrepareForEval(ctx)
-	defer cancelFunc()
+
+	o.stopCtx, o.cancel = stdctx.WithCancel(stdctx.Background())
+	if o.spec.PolicyKind == "" {
+		query, err := o.spec.prepare(nil)
+		if err != nil {
+			panic(err)
+		}
+		o.regoQuery.Store(query)
+		return
+	}
+
+	if o.spec.Super() == nil || o.spec.Super().Cluster() == nil {
+		logger.Errorf("%s: no cluster to watch the policies", o.Name())
+		return
+	}
+	go o.watchPolicies(o.spec.Super().Cluster())
+}
+
+func (o *OPAFilter) watchPolicies(c cluster.Cluster) {
+	var (
+		syncer cluster.Syncer
+		err    error
+		ch     <-chan map[string]string
+	)
+
+	prefix := c.Layout().CustomDataPrefix() + o.spec.PolicyKind + "/"
+	for {
+		syncer, err = c.Syncer(time.Minute)
+		if err != nil {
+			logger.Errorf("failed to create syncer: %v", err)
+		} else if ch, err = syncer.SyncPrefix(prefix); err != nil {
+			logger.Errorf("failed to sync prefix: %v", err)
+			syncer.Close()
+		} else {
+			break
+		}
+
+		select {
+		case <-time.After(10 * time.Second):
+		case <-o.stopCtx.Done():
+			return
+		}
+	}
+
+	defer syncer.Close()
+
+	for {
+		select {
+		case <-o.stopCtx.Done():
+			return
+		case kvs := <-ch:
+			o.reloadPolicies(kvs)
+		}
+	}
+}
+
+// reloadPolicies prepares the query with the policies of the custom data
+// items, the previous query is kept if the policies are invalid.
+func (o *OPAFilter) reloadPolicies(kvs map[string]string) {
+	policies := make(map[string]string, len(kvs))
+	for key, value := range kvs {
+		item := &policyItem{}
+		if err := codectool.Unmarshal([]byte(value), item); err != nil {
+			logger.Warnf("%s: invalid policy %s: %v", o.Name(), key, err)
+			continue
+		}
+		policies[item.Name] = item.Policy
+	}
+
+	query, err := o.spec.prepare(policies)
 	if err != nil {
-		panic(fmt.Sprintf("cannot create PrepareForEval rego query: %s", err))
-	} else {
-		o.regoQuery = &query
+		logger.Errorf("%s: failed to reload policies, keep the previous ones: %v", o.Name(), err)
+		return
 	}
+	o.regoQuery.Store(query)
+	logger.Infof("%s: %d policies reloaded", o.Name(), len(policies))
 }
 
 // Inherit inherits previous generation of filter instance.
 func (o *OPAFilter) Inherit(previousGeneration filters.Filter) {
 	o.Init()
-	previousGeneration.Close()
+	// the policies are kept until the new ones are loaded.
+	if prev, ok := previousGeneration.(*OPAFilter); ok && o.regoQuery.Load() == nil &&
+		prev.spec.PolicyKind == o.spec.PolicyKind && prev.spec.Policy == o.spec.Policy &&
+		prev.spec.Decision == o.spec.Decision {
+		o.regoQuery.CompareAndSwap(nil, prev.regoQuery.Load())
+	}
 }
 
 // Handle handles the request.
@@ -148,6 +295,9 @@ func (o *OPAFilter) Status() interface{} {
 
 // Close closes the filter instance.
 func (o *OPAFilter) Close() {
+	if o.cancel != nil {
+		o.cancel()
+	}
 }
 
 func (o *OPAFilter) evalRequest(r *httpprot.Request, w *httpprot.Response) string {
@@ -181,23 +331,106 @@ func (o *OPAFilter) evalRequest(r *httpprot.Request, w *httpprot.Response) strin
 			"body":       body,
 		},
 	}
-	results, err := o.regoQuery.Eval(r.Context(), rego.EvalInput(input))
+	query := o.regoQuery.Load()
+	if query == nil {
+		return o.opaError(w, errOpaNoPolicy)
+	}
+	results, err := query.Eval(r.Context(), rego.EvalInput(input))
 	if err != nil {
 		return o.opaError(w, err)
 	}
 	if len(results) == 0 {
 		return o.opaError(w, errOpaNoResult)
 	}
-	result := results[0].Bindings["result"]
-	var allow, ok bool
-	if allow, ok = result.(bool); !ok {
-		return o.opaError(w, errOpaInvalidResultType)
+	d, err := parseDecision(results[0].Bindings["result"])
+	if err != nil {
+		return o.opaError(w, err)
 	}
-	if !allow {
-		w.SetStatusCode(o.spec.DefaultStatus)
+
+	if !d.allow {
+		status := d.statusCode
+		if status == 0 {
+			status = o.spec.DefaultStatus
+		}
+		w.SetStatusCode(status)
+		for k, v := range d.headers {
+			w.HTTPHeader().Set(k, v)
+		}
+		if d.body != "" {
+			w.SetPayload(d.body)
+		}
 		return resultFiltered
 	}
-	return ""
+
+	for k, v := range d.headers {
+		r.HTTPHeader().Set(k, v)
+	}
+	return d.result
+}
+
+// parseDecision parses the result of the decision rule, which is a boolean
+// or an object.
+func parseDecision(result interface{}) (*decision, error) {
+	switch v := result.(type) {
+	case bool:
+		return &decision{allow: v}, nil
+	case map[string]interface{}:
+		return parseDecisionObject(v)
+	}
+	return nil, errOpaInvalidResultType
+}
+
+func parseDecisionObject(obj map[string]interface{}) (*decision, error) {
+	d := &decision{}
+	if v, ok := obj["allow"]; ok {
+		allow, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("allow must be a boolean")
+		}
+		d.allow = allow
+	}
+
+	if v, ok := obj["status_code"]; ok {
+		n, ok := v.(json.Number)
+		code, err := n.Int64()
+		if !ok || err != nil || code < 100 || code > 999 {
+			return nil, fmt.Errorf("invalid status_code %v", v)
+		}
+		d.statusCode = int(code)
+	}
+
+	if v, ok := obj["headers"]; ok {
+		headers, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("headers must be an object")
+		}
+		d.headers = make(map[string]string, len(headers))
+		for k, hv := range headers {
+			s, ok := hv.(string)
+			if !ok {
+				return nil, fmt.Errorf("value of header %s must be a string", k)
+			}
+			d.headers[k] = s
+		}
+	}
+
+	if v, ok := obj["body"]; ok {
+		body, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("body must be a string")
+		}
+		d.body = body
+	}
+
+	if v, ok := obj["result"]; ok {
+		result, _ := v.(string)
+		if !stringtool.StrInSlice(result, kind.Results) || result == resultFiltered {
+			return nil, fmt.Errorf("invalid result %v", v)
+		}
+		d.result = result
+	}
+
+	return d, nil
 }
 
 func (o *OPAFilter) opaError(resp *httpprot.Response, err error) string {
@@ -20,18 +20,29 @@ package opafilter
 import (
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 )
 
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
 func setRequest(t *testing.T, ctx *context.Context, stdReq *http.Request) {
 	req, err := httpprot.NewRequest(stdReq)
 	assert.Nil(t, err)
@@ -250,3 +261,114 @@ func buildYamlConf(t *testing.T, tc *testCase) string {
 	}
 	return string(buf)
 }
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, cfg := range []string{
+		"name: opa\nkind: OPAFilter",
+		"name: opa\nkind: OPAFilter\npolicy: 'package http\n  allow = '",
+	} {
+		rawSpec := make(map[string]interface{})
+		codectool.MustUnmarshal([]byte(cfg), &rawSpec)
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		assert.NotNil(err, cfg)
+	}
+}
+
+func TestDecisionObject(t *testing.T) {
+	assert := assert.New(t)
+
+	opaFilter := createOPAFilter(`
+name: opa
+kind: OPAFilter
+decision: data.http.authz.decision
+policy: |
+  package http.authz
+  default decision = {"allow": false, "status_code": 401, "headers": {"WWW-Authenticate": "Bearer"}, "body": "go away"}
+  decision = {"allow": true, "headers": {"X-User": "admin"}, "result": "result1"} {
+    input.request.headers["Authorization"] == "admin"
+  }
+  decision = {"allow": true} {
+    input.request.headers["Authorization"] == "user"
+  }
+includedHeaders: Authorization
+`, nil, nil)
+
+	ctx := context.New(nil)
+	setRequest(t, ctx, httptest.NewRequest(http.MethodGet, "https://example.com", nil))
+	assert.Equal(resultFiltered, opaFilter.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(401, resp.StatusCode())
+	assert.Equal("Bearer", resp.HTTPHeader().Get("WWW-Authenticate"))
+	assert.Equal("go away", string(resp.RawPayload()))
+
+	ctx = context.New(nil)
+	r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	r.Header.Set("Authorization", "admin")
+	setRequest(t, ctx, r)
+	assert.Equal("result1", opaFilter.Handle(ctx))
+	assert.Equal("admin", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-User"))
+
+	ctx = context.New(nil)
+	r = httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	r.Header.Set("Authorization", "user")
+	setRequest(t, ctx, r)
+	assert.Equal("", opaFilter.Handle(ctx))
+}
+
+func TestPolicyKind(t *testing.T) {
+	assert := assert.New(t)
+
+	clusterInstance := clustertest.NewMockedCluster()
+	syncer := clustertest.NewMockedSyncer()
+	clusterInstance.MockedSyncer = func(time.Duration) (cluster.Syncer, error) {
+		return syncer, nil
+	}
+	ch := make(chan map[string]string)
+	syncer.MockedSyncPrefix = func(prefix string) (<-chan map[string]string, error) {
+		assert.Equal("/custom-data/opa-policies/", prefix)
+		return ch, nil
+	}
+	super := supervisor.NewMock(nil, clusterInstance, nil, nil, false, nil, nil)
+
+	opaFilter := createOPAFilter(`
+name: opa
+kind: OPAFilter
+policyKind: opa-policies
+`, nil, super)
+	defer opaFilter.Close()
+
+	handle := func(path string) string {
+		ctx := context.New(nil)
+		setRequest(t, ctx, httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil))
+		return opaFilter.Handle(ctx)
+	}
+
+	// requests are denied before the policies are loaded.
+	assert.Equal(resultFiltered, handle("/public"))
+
+	ch <- map[string]string{
+		"default": "name: default\npolicy: |\n  package http\n  default allow = false\n",
+		"public":  "name: public\npolicy: |\n  package http\n  allow { input.request.path_parts[0] == \"public\" }\n",
+	}
+	assert.Eventually(func() bool { return handle("/public") == "" }, time.Second, 10*time.Millisecond)
+	assert.Equal(resultFiltered, handle("/private"))
+
+	// invalid policies are ignored, and the previous ones are kept.
+	ch <- map[string]string{"bad": "name: bad\npolicy: package http allow ="}
+	ch <- map[string]string{
+		"default": "name: default\npolicy: |\n  package http\n  default allow = true\n",
+	}
+	assert.Eventually(func() bool { return handle("/private") == "" }, time.Second, 10*time.Millisecond)
+
+	// the policies are kept when the filter is reloaded.
+	newFilter := createOPAFilter(`
+name: opa
+kind: OPAFilter
+policyKind: opa-policies
+`, opaFilter, super)
+	defer newFilter.Close()
+	opaFilter = newFilter
+	assert.Equal("", handle("/private"))
+}
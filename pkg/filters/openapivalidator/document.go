@@ -0,0 +1,579 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapivalidator
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	inPath   = "path"
+	inQuery  = "query"
+	inHeader = "header"
+	inCookie = "cookie"
+	inBody   = "body"
+
+	refParameterPrefix   = "#/components/parameters/"
+	refRequestBodyPrefix = "#/components/requestBodies/"
+	refResponsePrefix    = "#/components/responses/"
+	refHeaderPrefix      = "#/components/headers/"
+
+	// defaultResponse is the response of the status codes not defined.
+	defaultResponse = "default"
+)
+
+var templateRegexp = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+type (
+	// document is the part of an OpenAPI 3 document used in validation.
+	document struct {
+		OpenAPI    string               `json:"openapi"`
+		Paths      map[string]*pathItem `json:"paths"`
+		Components struct {
+			Schemas       map[string]interface{}  `json:"schemas"`
+			Parameters    map[string]*parameter   `json:"parameters"`
+			RequestBodies map[string]*requestBody `json:"requestBodies"`
+			Responses     map[string]*response    `json:"responses"`
+			Headers       map[string]*parameter   `json:"headers"`
+		} `json:"components"`
+	}
+
+	pathItem struct {
+		Parameters []*parameter `json:"parameters"`
+		Get        *operation   `json:"get"`
+		Put        *operation   `json:"put"`
+		Post       *operation   `json:"post"`
+		Delete     *operation   `json:"delete"`
+		Options    *operation   `json:"options"`
+		Head       *operation   `json:"head"`
+		Patch      *operation   `json:"patch"`
+		Trace      *operation   `json:"trace"`
+	}
+
+	operation struct {
+		OperationID string               `json:"operationId"`
+		Parameters  []*parameter         `json:"parameters"`
+		RequestBody *requestBody         `json:"requestBody"`
+		Responses   map[string]*response `json:"responses"`
+	}
+
+	parameter struct {
+		Ref      string                 `json:"$ref"`
+		Name     string                 `json:"name"`
+		In       string                 `json:"in"`
+		Required bool                   `json:"required"`
+		Explode  *bool                  `json:"explode"`
+		Schema   map[string]interface{} `json:"schema"`
+	}
+
+	requestBody struct {
+		Ref      string                `json:"$ref"`
+		Required bool                  `json:"required"`
+		Content  map[string]*mediaType `json:"content"`
+	}
+
+	response struct {
+		Ref     string                `json:"$ref"`
+		Headers map[string]*parameter `json:"headers"`
+		Content map[string]*mediaType `json:"content"`
+	}
+
+	mediaType struct {
+		Schema map[string]interface{} `json:"schema"`
+	}
+
+	// route is a compiled operation.
+	route struct {
+		method  string
+		path    string
+		pattern *regexp.Regexp
+		// templates is the number of the templated segments, routes with
+		// fewer templates are matched first.
+		templates int
+		params    []*param
+		body      *body
+		// responses are the responses of the status codes, like `200`,
+		// `2XX` and `default`.
+		responses map[string]*responseContract
+	}
+
+	responseContract struct {
+		headers []*param
+		body    *body
+	}
+
+	param struct {
+		name     string
+		in       string
+		required bool
+		typ      string
+		itemType string
+		explode  bool
+		schema   *gojsonschema.Schema
+	}
+
+	body struct {
+		required bool
+		// content is the schemas of the media types, the schema is nil if
+		// the body of the media type is not validated.
+		content map[string]*gojsonschema.Schema
+	}
+
+	// validationError is an error of a part of the request.
+	validationError struct {
+		In      string `json:"in"`
+		Name    string `json:"name,omitempty"`
+		Message string `json:"message"`
+	}
+)
+
+// loadDocument loads and compiles an OpenAPI 3 document.
+func loadDocument(data []byte) ([]*route, error) {
+	doc := &document{}
+	if err := codectool.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", doc.OpenAPI)
+	}
+
+	c := &compiler{doc: doc}
+	for name, s := range doc.Components.Schemas {
+		doc.Components.Schemas[name] = convertNullable(s)
+	}
+
+	var routes []*route
+	for path, item := range doc.Paths {
+		for method, op := range item.operations() {
+			r, err := c.compileRoute(path, method, item, op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", method, path, err)
+			}
+			routes = append(routes, r)
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].templates != routes[j].templates {
+			return routes[i].templates < routes[j].templates
+		}
+		return routes[i].path < routes[j].path
+	})
+	return routes, nil
+}
+
+func (pi *pathItem) operations() map[string]*operation {
+	ops := map[string]*operation{}
+	for method, op := range map[string]*operation{
+		http.MethodGet:     pi.Get,
+		http.MethodPut:     pi.Put,
+		http.MethodPost:    pi.Post,
+		http.MethodDelete:  pi.Delete,
+		http.MethodOptions: pi.Options,
+		http.MethodHead:    pi.Head,
+		http.MethodPatch:   pi.Patch,
+		http.MethodTrace:   pi.Trace,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+// convertNullable converts the `nullable` of OpenAPI 3.0 to the `null`
+// type of JSON schema.
+func convertNullable(schema interface{}) interface{} {
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = convertNullable(child)
+		}
+		if nullable, _ := v["nullable"].(bool); nullable {
+			if typ, ok := v["type"].(string); ok {
+				v["type"] = []interface{}{typ, "null"}
+			}
+			if enum, ok := v["enum"].([]interface{}); ok {
+				v["enum"] = append(enum, nil)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = convertNullable(child)
+		}
+	}
+	return schema
+}
+
+type compiler struct {
+	doc *document
+}
+
+// compileSchema compiles the schema, the schemas of the components are
+// put in the root so that the references to them can be resolved.
+func (c *compiler) compileSchema(schema map[string]interface{}) (*gojsonschema.Schema, error) {
+	root := map[string]interface{}{
+		"components": map[string]interface{}{
+			"schemas": c.doc.Components.Schemas,
+		},
+		"allOf": []interface{}{convertNullable(schema)},
+	}
+	return gojsonschema.NewSchema(gojsonschema.NewGoLoader(root))
+}
+
+func (c *compiler) compileRoute(path, method string, item *pathItem, op *operation) (*route, error) {
+	r := &route{method: method, path: path}
+
+	// The templates are replaced with groups, and the others are quoted.
+	var sb strings.Builder
+	sb.WriteString("^")
+	last := 0
+	for _, loc := range templateRegexp.FindAllStringIndex(path, -1) {
+		sb.WriteString(regexp.QuoteMeta(path[last:loc[0]]))
+		sb.WriteString("([^/]+)")
+		last = loc[1]
+		r.templates++
+	}
+	sb.WriteString(regexp.QuoteMeta(path[last:]))
+	sb.WriteString("$")
+	pattern, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, err
+	}
+	r.pattern = pattern
+
+	// Parameters of the operation override the ones of the path.
+	params := map[string]*parameter{}
+	var keys []string
+	for _, p := range append(append([]*parameter{}, item.Parameters...), op.Parameters...) {
+		p, err := c.resolveParameter(p)
+		if err != nil {
+			return nil, err
+		}
+		key := p.In + ":" + p.Name
+		if _, ok := params[key]; !ok {
+			keys = append(keys, key)
+		}
+		params[key] = p
+	}
+	for _, key := range keys {
+		p, err := c.compileParam(params[key])
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %v", params[key].Name, err)
+		}
+		r.params = append(r.params, p)
+	}
+
+	if op.RequestBody != nil {
+		rb := op.RequestBody
+		if rb.Ref != "" {
+			name := strings.TrimPrefix(rb.Ref, refRequestBodyPrefix)
+			if rb = c.doc.Components.RequestBodies[name]; rb == nil {
+				return nil, fmt.Errorf("unresolved reference %s", op.RequestBody.Ref)
+			}
+		}
+		if r.body, err = c.compileBody(rb.Required, rb.Content); err != nil {
+			return nil, fmt.Errorf("request body: %v", err)
+		}
+	}
+
+	r.responses = map[string]*responseContract{}
+	for code, resp := range op.Responses {
+		rc, err := c.compileResponse(resp)
+		if err != nil {
+			return nil, fmt.Errorf("response %s: %v", code, err)
+		}
+		// Ranges like `2xx` are case insensitive.
+		if code != defaultResponse {
+			code = strings.ToUpper(code)
+		}
+		r.responses[code] = rc
+	}
+
+	return r, nil
+}
+
+func (c *compiler) compileBody(required bool, content map[string]*mediaType) (*body, error) {
+	b := &body{required: required, content: map[string]*gojsonschema.Schema{}}
+	for mt, media := range content {
+		var schema *gojsonschema.Schema
+		if media != nil && media.Schema != nil && isJSON(mt) {
+			var err error
+			if schema, err = c.compileSchema(media.Schema); err != nil {
+				return nil, fmt.Errorf("%s: %v", mt, err)
+			}
+		}
+		b.content[mt] = schema
+	}
+	return b, nil
+}
+
+func (c *compiler) compileResponse(resp *response) (*responseContract, error) {
+	if resp.Ref != "" {
+		ref := resp.Ref
+		if resp = c.doc.Components.Responses[strings.TrimPrefix(ref, refResponsePrefix)]; resp == nil {
+			return nil, fmt.Errorf("unresolved reference %s", ref)
+		}
+	}
+
+	rc := &responseContract{}
+	for name, h := range resp.Headers {
+		if h.Ref != "" {
+			ref := h.Ref
+			if h = c.doc.Components.Headers[strings.TrimPrefix(ref, refHeaderPrefix)]; h == nil {
+				return nil, fmt.Errorf("unresolved reference %s", ref)
+			}
+		}
+		// Headers of responses have no name and location.
+		p, err := c.compileParam(&parameter{
+			Name:     name,
+			In:       inHeader,
+			Required: h.Required,
+			Schema:   h.Schema,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %v", name, err)
+		}
+		rc.headers = append(rc.headers, p)
+	}
+
+	if len(resp.Content) > 0 {
+		b, err := c.compileBody(false, resp.Content)
+		if err != nil {
+			return nil, err
+		}
+		rc.body = b
+	}
+	return rc, nil
+}
+
+func (c *compiler) resolveParameter(p *parameter) (*parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	name := strings.TrimPrefix(p.Ref, refParameterPrefix)
+	if resolved := c.doc.Components.Parameters[name]; resolved != nil {
+		return resolved, nil
+	}
+	return nil, fmt.Errorf("unresolved reference %s", p.Ref)
+}
+
+func (c *compiler) compileParam(p *parameter) (*param, error) {
+	switch p.In {
+	case inPath, inQuery, inHeader, inCookie:
+	default:
+		return nil, fmt.Errorf("unknown location %q", p.In)
+	}
+
+	result := &param{
+		name:     p.Name,
+		in:       p.In,
+		required: p.Required || p.In == inPath,
+		// explode is true by default for the form style of query.
+		explode: p.In == inQuery && (p.Explode == nil || *p.Explode),
+	}
+	if p.In == inHeader {
+		result.name = http.CanonicalHeaderKey(p.Name)
+	}
+	if p.Schema == nil {
+		return result, nil
+	}
+
+	result.typ, _ = p.Schema["type"].(string)
+	if items, ok := p.Schema["items"].(map[string]interface{}); ok {
+		result.itemType, _ = items["type"].(string)
+	}
+	schema, err := c.compileSchema(p.Schema)
+	if err != nil {
+		return nil, err
+	}
+	result.schema = schema
+	return result, nil
+}
+
+// response returns the contract of the status code, it returns nil if the
+// status code is not defined.
+func (r *route) response(code int) *responseContract {
+	s := strconv.Itoa(code)
+	if rc := r.responses[s]; rc != nil {
+		return rc
+	}
+	if rc := r.responses[s[:1]+"XX"]; rc != nil {
+		return rc
+	}
+	return r.responses[defaultResponse]
+}
+
+// isJSON returns whether the media type is JSON.
+func isJSON(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// match matches the path, it returns the values of the path templates.
+func (r *route) match(path string) ([]string, bool) {
+	m := r.pattern.FindStringSubmatch(path)
+	if m == nil {
+		return nil, false
+	}
+	return m[1:], true
+}
+
+// pathParams returns the values of the path parameters in the order of
+// the templates.
+func (r *route) pathParams(values []string) map[string]string {
+	result := map[string]string{}
+	names := templateRegexp.FindAllStringSubmatch(r.path, -1)
+	for i, name := range names {
+		if i < len(values) {
+			result[name[1]] = values[i]
+		}
+	}
+	return result
+}
+
+// convert converts the string to the type of the schema.
+func convert(s, typ string) (interface{}, error) {
+	switch typ {
+	case "integer":
+		return strconv.ParseInt(s, 10, 64)
+	case "number":
+		return strconv.ParseFloat(s, 64)
+	case "boolean":
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
+
+// value converts the raw values of the parameter to the value validated
+// against the schema.
+func (p *param) value(values []string) (interface{}, error) {
+	if p.typ != "array" {
+		return convert(values[0], p.typ)
+	}
+
+	if !p.explode {
+		values = strings.Split(values[0], ",")
+	}
+	items := make([]interface{}, 0, len(values))
+	for _, s := range values {
+		v, err := convert(s, p.itemType)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+// validate validates the raw values of the parameter.
+func (p *param) validate(values []string) *validationError {
+	if len(values) == 0 {
+		if p.required {
+			return &validationError{In: p.in, Name: p.name, Message: "is required"}
+		}
+		return nil
+	}
+
+	// Objects are not supported, only the presence is validated.
+	if p.schema == nil || p.typ == "object" {
+		return nil
+	}
+
+	v, err := p.value(values)
+	if err != nil {
+		return &validationError{In: p.in, Name: p.name, Message: fmt.Sprintf("invalid %s", p.typ)}
+	}
+
+	result, err := p.schema.Validate(gojsonschema.NewGoLoader(v))
+	if err != nil {
+		return &validationError{In: p.in, Name: p.name, Message: err.Error()}
+	}
+	if result.Valid() {
+		return nil
+	}
+	message := "invalid value"
+	if errs := schemaErrors(result); len(errs) > 0 {
+		message = errs[0].Description()
+	}
+	return &validationError{In: p.in, Name: p.name, Message: message}
+}
+
+// schemaErrors returns the errors of the result, except the one of the
+// `allOf` added by compileSchema.
+func schemaErrors(result *gojsonschema.Result) []gojsonschema.ResultError {
+	var errs []gojsonschema.ResultError
+	for _, e := range result.Errors() {
+		if e.Type() == "number_all_of" && e.Field() == gojsonschema.STRING_CONTEXT_ROOT {
+			continue
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// schemaOf returns the schema of the content type of the body, the second
+// return value is false if the content type is not allowed.
+func (b *body) schemaOf(contentType string) (*gojsonschema.Schema, bool) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = contentType
+	}
+
+	if schema, ok := b.content[mt]; ok {
+		return schema, true
+	}
+	if typ, _, found := strings.Cut(mt, "/"); found {
+		if schema, ok := b.content[typ+"/*"]; ok {
+			return schema, true
+		}
+	}
+	schema, ok := b.content["*/*"]
+	return schema, ok
+}
+
+// validateBody validates the JSON body against the schema.
+func validateBody(schema *gojsonschema.Schema, data []byte) []*validationError {
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return []*validationError{{In: inBody, Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	var errs []*validationError
+	for _, e := range schemaErrors(result) {
+		name := e.Field()
+		if name == gojsonschema.STRING_CONTEXT_ROOT {
+			name = ""
+		}
+		errs = append(errs, &validationError{In: inBody, Name: name, Message: e.Description()})
+	}
+	return errs
+}
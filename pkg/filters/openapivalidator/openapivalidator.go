@@ -0,0 +1,353 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package openapivalidator provides the OpenAPIValidator filter.
+package openapivalidator
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of OpenAPIValidator.
+	Kind = "OpenAPIValidator"
+
+	resultInvalid = "invalid"
+
+	targetRequest  = "request"
+	targetResponse = "response"
+
+	onViolationReject = "reject"
+	onViolationLog    = "log"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "OpenAPIValidator validates requests or responses against an OpenAPI 3 document.",
+	Results:     []string{resultInvalid},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{Target: targetRequest, OnViolation: onViolationReject}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &OpenAPIValidator{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// OpenAPIValidator is filter OpenAPIValidator.
+	OpenAPIValidator struct {
+		spec   *Spec
+		routes []*route
+	}
+
+	// Spec describes the OpenAPIValidator.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Document is the content of the OpenAPI document, in YAML or JSON.
+		Document string `json:"document,omitempty"`
+		// File is the path of the OpenAPI document file.
+		File string `json:"file,omitempty"`
+		// BasePath is trimmed from the request path before matching the
+		// paths of the document.
+		BasePath string `json:"basePath,omitempty"`
+		// AllowUnknownOperations allows the requests not defined in the
+		// document, they are rejected by default.
+		AllowUnknownOperations bool `json:"allowUnknownOperations,omitempty"`
+		// Target is what to validate, the request or the response.
+		Target string `json:"target,omitempty" jsonschema:"enum=request,enum=response"`
+		// OnViolation is what to do with the violations, invalid responses
+		// are replaced with 502 responses if it is reject.
+		OnViolation string `json:"onViolation,omitempty" jsonschema:"enum=reject,enum=log"`
+	}
+
+	// errorResponse is the body of the response of violations.
+	errorResponse struct {
+		Message string             `json:"message"`
+		Errors  []*validationError `json:"errors,omitempty"`
+	}
+)
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	if (s.Document == "") == (s.File == "") {
+		return fmt.Errorf("exactly one of document and file is required")
+	}
+	_, err := s.load()
+	return err
+}
+
+func (s *Spec) load() ([]*route, error) {
+	data := []byte(s.Document)
+	if s.File != "" {
+		var err error
+		if data, err = os.ReadFile(s.File); err != nil {
+			return nil, err
+		}
+	}
+	return loadDocument(data)
+}
+
+// Name returns the name of the OpenAPIValidator filter instance.
+func (v *OpenAPIValidator) Name() string {
+	return v.spec.Name()
+}
+
+// Kind returns the kind of OpenAPIValidator.
+func (v *OpenAPIValidator) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the OpenAPIValidator.
+func (v *OpenAPIValidator) Spec() filters.Spec {
+	return v.spec
+}
+
+// Init initializes OpenAPIValidator.
+func (v *OpenAPIValidator) Init() {
+	v.reload()
+}
+
+// Inherit inherits previous generation of OpenAPIValidator.
+func (v *OpenAPIValidator) Inherit(previousGeneration filters.Filter) {
+	v.reload()
+}
+
+func (v *OpenAPIValidator) reload() {
+	routes, err := v.spec.load()
+	if err != nil {
+		logger.Errorf("%s: load OpenAPI document failed: %v", v.Name(), err)
+	}
+	v.routes = routes
+}
+
+// violate handles the violations, it sets the error response if the
+// violations are rejected.
+func (v *OpenAPIValidator) violate(ctx *context.Context, status int, message string, errs []*validationError) string {
+	body := codectool.MustMarshalJSON(&errorResponse{Message: message, Errors: errs})
+	ctx.AddTag("openAPIValidator: " + message)
+
+	if v.spec.OnViolation == onViolationLog {
+		req := ctx.GetInputRequest().(*httpprot.Request)
+		logger.Warnf("%s: %s %s %s: %s", v.Name(), v.spec.Target, req.Method(), req.Path(), body)
+		return ""
+	}
+
+	// Invalid responses are replaced, so the headers of them are dropped.
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil || v.spec.Target == targetResponse {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(status)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.HTTPHeader().Set("Content-Length", strconv.Itoa(len(body)))
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	return resultInvalid
+}
+
+// match matches the request to a route, it returns the status code and
+// the message if no route matches.
+func (v *OpenAPIValidator) match(req *httpprot.Request) (*route, []string, int, string) {
+	path := req.Path()
+	if v.spec.BasePath != "" {
+		if !strings.HasPrefix(path, v.spec.BasePath) {
+			return nil, nil, http.StatusNotFound, "operation not found"
+		}
+		path = strings.TrimPrefix(path, v.spec.BasePath)
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	found := false
+	for _, r := range v.routes {
+		values, ok := r.match(path)
+		if !ok {
+			continue
+		}
+		if r.method == req.Method() {
+			return r, values, 0, ""
+		}
+		found = true
+	}
+
+	if found {
+		return nil, nil, http.StatusMethodNotAllowed, "method not allowed"
+	}
+	return nil, nil, http.StatusNotFound, "operation not found"
+}
+
+// allowedMethods returns the methods of the path of the request.
+func (v *OpenAPIValidator) allowedMethods(req *httpprot.Request) string {
+	path := strings.TrimPrefix(req.Path(), v.spec.BasePath)
+	var methods []string
+	for _, r := range v.routes {
+		if _, ok := r.match(path); ok && !stringtool.StrInSlice(r.method, methods) {
+			methods = append(methods, r.method)
+		}
+	}
+	return strings.Join(methods, ", ")
+}
+
+// validateMessageBody validates the body of the request or the response, the
+// second return value is false if the content type is not allowed.
+func validateMessageBody(b *body, payload []byte, header http.Header) ([]*validationError, bool) {
+	if len(payload) == 0 {
+		if b.required {
+			return []*validationError{{In: inBody, Message: "is required"}}, true
+		}
+		return nil, true
+	}
+
+	schema, ok := b.schemaOf(header.Get("Content-Type"))
+	if !ok {
+		return nil, false
+	}
+	if schema == nil {
+		return nil, true
+	}
+	return validateBody(schema, payload), true
+}
+
+// Handle validates the request or the response against the operation in
+// the document.
+func (v *OpenAPIValidator) Handle(ctx *context.Context) string {
+	if v.spec.Target == targetResponse {
+		return v.handleResponse(ctx)
+	}
+	return v.handleRequest(ctx)
+}
+
+func (v *OpenAPIValidator) handleRequest(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	rt, values, status, message := v.match(req)
+	if rt == nil {
+		if v.spec.AllowUnknownOperations {
+			return ""
+		}
+		result := v.violate(ctx, status, message, nil)
+		if result != "" && status == http.StatusMethodNotAllowed {
+			ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Set("Allow", v.allowedMethods(req))
+		}
+		return result
+	}
+
+	var errs []*validationError
+	pathParams := rt.pathParams(values)
+	query := req.Std().URL.Query()
+	for _, p := range rt.params {
+		var raw []string
+		switch p.in {
+		case inPath:
+			raw = []string{pathParams[p.name]}
+		case inQuery:
+			raw = query[p.name]
+		case inHeader:
+			raw = req.HTTPHeader()[p.name]
+		case inCookie:
+			if c, err := req.Cookie(p.name); err == nil {
+				raw = []string{c.Value}
+			}
+		}
+		if err := p.validate(raw); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Streaming bodies are not validated.
+	if rt.body != nil && !req.IsStream() {
+		bodyErrs, ok := validateMessageBody(rt.body, req.RawPayload(), req.HTTPHeader())
+		if !ok {
+			return v.violate(ctx, http.StatusUnsupportedMediaType, "unsupported media type", nil)
+		}
+		errs = append(errs, bodyErrs...)
+	}
+
+	if len(errs) > 0 {
+		return v.violate(ctx, http.StatusBadRequest, "invalid request", errs)
+	}
+	return ""
+}
+
+func (v *OpenAPIValidator) handleResponse(ctx *context.Context) string {
+	resp, _ := ctx.GetInputResponse().(*httpprot.Response)
+	if resp == nil {
+		return ""
+	}
+
+	// Responses of unknown operations are not validated.
+	rt, _, _, _ := v.match(ctx.GetInputRequest().(*httpprot.Request))
+	if rt == nil {
+		return ""
+	}
+
+	rc := rt.response(resp.StatusCode())
+	if rc == nil {
+		message := fmt.Sprintf("unexpected status code %d", resp.StatusCode())
+		return v.violate(ctx, http.StatusBadGateway, message, nil)
+	}
+
+	var errs []*validationError
+	for _, p := range rc.headers {
+		if err := p.validate(resp.HTTPHeader()[p.name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Streaming and compressed bodies are not validated.
+	if rc.body != nil && !resp.IsStream() && resp.HTTPHeader().Get("Content-Encoding") == "" {
+		bodyErrs, ok := validateMessageBody(rc.body, resp.RawPayload(), resp.HTTPHeader())
+		if !ok {
+			errs = append(errs, &validationError{
+				In:      inHeader,
+				Name:    "Content-Type",
+				Message: "unexpected media type " + resp.HTTPHeader().Get("Content-Type"),
+			})
+		}
+		errs = append(errs, bodyErrs...)
+	}
+
+	if len(errs) > 0 {
+		return v.violate(ctx, http.StatusBadGateway, "invalid response", errs)
+	}
+	return ""
+}
+
+// Status returns status.
+func (v *OpenAPIValidator) Status() interface{} {
+	return nil
+}
+
+// Close closes OpenAPIValidator.
+func (v *OpenAPIValidator) Close() {}
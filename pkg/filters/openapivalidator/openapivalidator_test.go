@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapivalidator
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+const petstore = `
+openapi: 3.0.3
+info:
+  title: Petstore
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      parameters:
+      - name: limit
+        in: query
+        schema:
+          type: integer
+          maximum: 100
+      - name: tags
+        in: query
+        schema:
+          type: array
+          items:
+            type: string
+    post:
+      parameters:
+      - $ref: '#/components/parameters/RequestID'
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+  /pets/mine:
+    get: {}
+  /pets/{petId}:
+    parameters:
+    - name: petId
+      in: path
+      schema:
+        type: integer
+    get: {}
+components:
+  parameters:
+    RequestID:
+      name: X-Request-ID
+      in: header
+      required: true
+      schema:
+        type: string
+        format: uuid
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+          minLength: 1
+        tag:
+          type: string
+          nullable: true
+`
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newOpenAPIValidator(t *testing.T, yamlConfig string) *OpenAPIValidator {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	v := kind.CreateInstance(spec).(*OpenAPIValidator)
+	v.Init()
+	return v
+}
+
+func handle(t *testing.T, v *OpenAPIValidator, method, url, body string, header http.Header) (string, *httpprot.Response) {
+	stdr, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for k, vs := range header {
+		stdr.Header[k] = vs
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+	req.FetchPayload(0)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	result := v.Handle(ctx)
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	return result, resp
+}
+
+func TestOpenAPIValidator(t *testing.T) {
+	assert := assert.New(t)
+
+	file := filepath.Join(t.TempDir(), "petstore.yaml")
+	os.WriteFile(file, []byte(petstore), 0o644)
+
+	v := newOpenAPIValidator(t, `
+kind: OpenAPIValidator
+name: validator
+basePath: /v1
+file: `+file)
+	assert.Equal(Kind, v.Kind().Name)
+	assert.Equal("validator", v.Name())
+
+	result, _ := handle(t, v, http.MethodGet, "http://example.com/v1/pets?limit=10&tags=a&tags=b", "", nil)
+	assert.Equal("", result)
+	result, _ = handle(t, v, http.MethodGet, "http://example.com/v1/pets/mine", "", nil)
+	assert.Equal("", result)
+	result, _ = handle(t, v, http.MethodGet, "http://example.com/v1/pets/12", "", nil)
+	assert.Equal("", result)
+
+	result, resp := handle(t, v, http.MethodGet, "http://example.com/v1/pets?limit=1000", "", nil)
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode())
+	errResp := &errorResponse{}
+	codectool.MustUnmarshal(resp.RawPayload(), errResp)
+	assert.Len(errResp.Errors, 1)
+	assert.Equal("query", errResp.Errors[0].In)
+	assert.Equal("limit", errResp.Errors[0].Name)
+
+	result, _ = handle(t, v, http.MethodGet, "http://example.com/v1/pets/abc", "", nil)
+	assert.Equal(resultInvalid, result)
+
+	result, resp = handle(t, v, http.MethodGet, "http://example.com/v1/stores", "", nil)
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusNotFound, resp.StatusCode())
+	result, resp = handle(t, v, http.MethodGet, "http://example.com/pets", "", nil)
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusNotFound, resp.StatusCode())
+
+	result, resp = handle(t, v, http.MethodDelete, "http://example.com/v1/pets", "", nil)
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode())
+	assert.Contains(resp.HTTPHeader().Get("Allow"), http.MethodPost)
+
+	header := http.Header{
+		"X-Request-Id": []string{"6f1c0e2a-4f6b-4c2a-9b3e-0d5f2a1c9e7b"},
+		"Content-Type": []string{"application/json; charset=utf-8"},
+	}
+	result, _ = handle(t, v, http.MethodPost, "http://example.com/v1/pets", `{"name":"kitty","tag":null}`, header)
+	assert.Equal("", result)
+
+	result, resp = handle(t, v, http.MethodPost, "http://example.com/v1/pets", `{"tag":1}`, header)
+	assert.Equal(resultInvalid, result)
+	errResp = &errorResponse{}
+	codectool.MustUnmarshal(resp.RawPayload(), errResp)
+	assert.Len(errResp.Errors, 2)
+	for _, e := range errResp.Errors {
+		assert.Equal("body", e.In)
+	}
+
+	result, _ = handle(t, v, http.MethodPost, "http://example.com/v1/pets", ``, header)
+	assert.Equal(resultInvalid, result)
+	result, _ = handle(t, v, http.MethodPost, "http://example.com/v1/pets", `{"name":`, header)
+	assert.Equal(resultInvalid, result)
+
+	result, resp = handle(t, v, http.MethodPost, "http://example.com/v1/pets", `name=kitty`, http.Header{
+		"X-Request-Id": header["X-Request-Id"],
+		"Content-Type": []string{"application/x-www-form-urlencoded"},
+	})
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusUnsupportedMediaType, resp.StatusCode())
+
+	result, resp = handle(t, v, http.MethodPost, "http://example.com/v1/pets", `{"name":"kitty"}`, http.Header{
+		"Content-Type": header["Content-Type"],
+	})
+	assert.Equal(resultInvalid, result)
+	errResp = &errorResponse{}
+	codectool.MustUnmarshal(resp.RawPayload(), errResp)
+	assert.Equal("X-Request-Id", errResp.Errors[0].Name)
+
+	newV := kind.CreateInstance(v.spec).(*OpenAPIValidator)
+	newV.Inherit(v)
+	assert.Nil(newV.Status())
+	newV.Close()
+}
+
+func TestOpenAPIValidatorAllowUnknown(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Document: petstore, AllowUnknownOperations: true}
+	assert.Nil(spec.Validate())
+	v := kind.CreateInstance(spec).(*OpenAPIValidator)
+	v.Init()
+
+	result, _ := handle(t, v, http.MethodGet, "http://example.com/stores", "", nil)
+	assert.Equal("", result)
+
+	spec = &Spec{}
+	assert.NotNil(spec.Validate())
+	spec = &Spec{Document: "openapi: 2.0"}
+	assert.NotNil(spec.Validate())
+	spec = &Spec{Document: `
+openapi: 3.0.0
+paths:
+  /pets:
+    get:
+      parameters:
+      - $ref: '#/components/parameters/Missing'
+`}
+	assert.NotNil(spec.Validate())
+}
+
+func TestOpenAPIValidatorResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	document := `
+openapi: 3.1.0
+paths:
+  /pets/{petId}:
+    get:
+      responses:
+        "200":
+          headers:
+            X-Rate-Limit:
+              required: true
+              schema:
+                type: integer
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+        4xx:
+          $ref: '#/components/responses/Error'
+components:
+  responses:
+    Error:
+      content:
+        application/json:
+          schema:
+            type: object
+            required: [message]
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+`
+	spec := &Spec{Document: document, Target: targetResponse, OnViolation: onViolationReject}
+	assert.Nil(spec.Validate())
+	v := kind.CreateInstance(spec).(*OpenAPIValidator)
+	v.Init()
+
+	check := func(code int, body string, header http.Header) (string, *httpprot.Response) {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/pets/1", nil)
+		req, _ := httpprot.NewRequest(stdr)
+		ctx := context.New(nil)
+		ctx.SetInputRequest(req)
+
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(code)
+		resp.HTTPHeader().Set("Content-Type", "application/json")
+		for k, vs := range header {
+			resp.HTTPHeader()[k] = vs
+		}
+		resp.SetPayload([]byte(body))
+		ctx.SetInputResponse(resp)
+
+		result := v.Handle(ctx)
+		return result, ctx.GetOutputResponse().(*httpprot.Response)
+	}
+
+	rateLimit := http.Header{"X-Rate-Limit": []string{"100"}}
+	result, _ := check(http.StatusOK, `{"name":"kitty"}`, rateLimit)
+	assert.Equal("", result)
+	result, _ = check(http.StatusNotFound, `{"message":"not found"}`, nil)
+	assert.Equal("", result)
+
+	result, resp := check(http.StatusOK, `{}`, http.Header{"X-Rate-Limit": []string{"abc"}})
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusBadGateway, resp.StatusCode())
+	assert.Empty(resp.HTTPHeader().Get("X-Rate-Limit"))
+	errResp := &errorResponse{}
+	codectool.MustUnmarshal(resp.RawPayload(), errResp)
+	assert.Equal("invalid response", errResp.Message)
+	assert.Len(errResp.Errors, 2)
+
+	result, _ = check(http.StatusOK, `<pet/>`, http.Header{
+		"X-Rate-Limit": []string{"100"},
+		"Content-Type": []string{"text/xml"},
+	})
+	assert.Equal(resultInvalid, result)
+
+	result, resp = check(http.StatusInternalServerError, `oops`, nil)
+	assert.Equal(resultInvalid, result)
+	codectool.MustUnmarshal(resp.RawPayload(), errResp)
+	assert.Equal("unexpected status code 500", errResp.Message)
+
+	// violations are only logged.
+	spec.OnViolation = onViolationLog
+	result, resp = check(http.StatusOK, `{}`, nil)
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+}
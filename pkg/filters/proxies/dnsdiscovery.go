@@ -0,0 +1,352 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxies
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+const (
+	// DNSRecordTypeA resolves the A and AAAA records of the name.
+	DNSRecordTypeA = "A"
+	// DNSRecordTypeAAAA resolves the AAAA records of the name only.
+	DNSRecordTypeAAAA = "AAAA"
+	// DNSRecordTypeSRV resolves the SRV records of the name.
+	DNSRecordTypeSRV = "SRV"
+
+	defaultDNSMinRefreshInterval = 5 * time.Second
+	defaultDNSMaxRefreshInterval = 5 * time.Minute
+	dnsQueryTimeout              = 5 * time.Second
+	resolvConfPath               = "/etc/resolv.conf"
+)
+
+// DNSDiscoverySpec is the spec to discover the servers by resolving a DNS
+// name periodically, the interval respects the TTL of the records.
+type DNSDiscoverySpec struct {
+	Name string `json:"name" jsonschema:"required"`
+	// Type is the type of the records, A by default which resolves both
+	// the A and AAAA records.
+	Type string `json:"type,omitempty" jsonschema:"enum=,enum=A,enum=AAAA,enum=SRV"`
+	// Scheme is the scheme of the server URLs, http by default.
+	Scheme string `json:"scheme,omitempty" jsonschema:"enum=,enum=http,enum=https"`
+	// Port is the port of the servers resolved from the A/AAAA records,
+	// the default port of the scheme is used if it is zero.
+	Port int `json:"port,omitempty" jsonschema:"minimum=0,maximum=65535"`
+	// Nameservers are the addresses of the DNS servers, the ones in
+	// /etc/resolv.conf are used if it is empty.
+	Nameservers []string `json:"nameservers,omitempty"`
+	// MinRefreshInterval and MaxRefreshInterval are the bounds of the
+	// re-resolution interval, which is the min TTL of the records.
+	MinRefreshInterval string `json:"minRefreshInterval,omitempty" jsonschema:"format=duration"`
+	MaxRefreshInterval string `json:"maxRefreshInterval,omitempty" jsonschema:"format=duration"`
+}
+
+// dnsResolver resolves the servers according to a DNSDiscoverySpec.
+type dnsResolver struct {
+	spec        *DNSDiscoverySpec
+	nameservers []string
+	minInterval time.Duration
+	maxInterval time.Duration
+	client      *dns.Client
+}
+
+// Validate validates DNSDiscoverySpec.
+func (spec *DNSDiscoverySpec) Validate() error {
+	if spec.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	switch spec.Type {
+	case "", DNSRecordTypeA, DNSRecordTypeAAAA, DNSRecordTypeSRV:
+	default:
+		return fmt.Errorf("invalid type %s", spec.Type)
+	}
+	if spec.Type == DNSRecordTypeSRV && spec.Port != 0 {
+		return fmt.Errorf("port is not supported for SRV records")
+	}
+
+	var intervals [2]time.Duration
+	for i, v := range []string{spec.MinRefreshInterval, spec.MaxRefreshInterval} {
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid refresh interval %s: %v", v, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid refresh interval %s: must be positive", v)
+		}
+		intervals[i] = d
+	}
+	if intervals[0] > 0 && intervals[1] > 0 && intervals[0] > intervals[1] {
+		return fmt.Errorf("minRefreshInterval is greater than maxRefreshInterval")
+	}
+	return nil
+}
+
+func newDNSResolver(spec *DNSDiscoverySpec) *dnsResolver {
+	r := &dnsResolver{
+		spec:        spec,
+		minInterval: defaultDNSMinRefreshInterval,
+		maxInterval: defaultDNSMaxRefreshInterval,
+		client:      &dns.Client{Timeout: dnsQueryTimeout},
+	}
+	if spec.MinRefreshInterval != "" {
+		r.minInterval, _ = time.ParseDuration(spec.MinRefreshInterval)
+	}
+	if spec.MaxRefreshInterval != "" {
+		r.maxInterval, _ = time.ParseDuration(spec.MaxRefreshInterval)
+	}
+	if r.minInterval > r.maxInterval {
+		r.maxInterval = r.minInterval
+	}
+
+	for _, ns := range spec.Nameservers {
+		if _, _, err := net.SplitHostPort(ns); err != nil {
+			ns = net.JoinHostPort(ns, "53")
+		}
+		r.nameservers = append(r.nameservers, ns)
+	}
+	return r
+}
+
+// getNameservers returns the nameservers to query, the ones in
+// /etc/resolv.conf are reloaded every time as they may change.
+func (r *dnsResolver) getNameservers() ([]string, error) {
+	if len(r.nameservers) > 0 {
+		return r.nameservers, nil
+	}
+
+	cfg, err := dns.ClientConfigFromFile(resolvConfPath)
+	if err != nil {
+		return nil, err
+	}
+	var servers []string
+	for _, s := range cfg.Servers {
+		servers = append(servers, net.JoinHostPort(s, cfg.Port))
+	}
+	return servers, nil
+}
+
+// query sends the query to the nameservers until one of them answers.
+func (r *dnsResolver) query(name string, qtype uint16) (*dns.Msg, error) {
+	nameservers, err := r.getNameservers()
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+
+	err = fmt.Errorf("no nameserver")
+	for _, ns := range nameservers {
+		var resp *dns.Msg
+		resp, _, err = r.client.Exchange(m, ns)
+		if err == nil && resp.Truncated {
+			tcp := &dns.Client{Net: "tcp", Timeout: r.client.Timeout}
+			resp, _, err = tcp.Exchange(m, ns)
+		}
+		if err != nil {
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			err = fmt.Errorf("query %s failed: %s", name, dns.RcodeToString[resp.Rcode])
+			continue
+		}
+		return resp, nil
+	}
+	return nil, err
+}
+
+// resolve resolves the servers, and returns the interval to resolve them
+// again.
+func (r *dnsResolver) resolve() ([]*Server, time.Duration, error) {
+	scheme := r.spec.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	var servers []*Server
+	ttl := uint32(0)
+	updateTTL := func(hdr *dns.RR_Header) {
+		if ttl == 0 || hdr.Ttl < ttl {
+			ttl = hdr.Ttl
+		}
+	}
+
+	switch r.spec.Type {
+	case DNSRecordTypeSRV:
+		resp, err := r.query(r.spec.Name, dns.TypeSRV)
+		if err != nil {
+			return nil, r.minInterval, err
+		}
+
+		// only the records with the lowest priority are used.
+		var records []*dns.SRV
+		for _, rr := range resp.Answer {
+			srv, ok := rr.(*dns.SRV)
+			if !ok {
+				continue
+			}
+			updateTTL(&srv.Hdr)
+			if len(records) > 0 && srv.Priority > records[0].Priority {
+				continue
+			}
+			if len(records) > 0 && srv.Priority < records[0].Priority {
+				records = records[:0]
+			}
+			records = append(records, srv)
+		}
+
+		maxWeight := uint16(0)
+		for _, srv := range records {
+			if srv.Weight > maxWeight {
+				maxWeight = srv.Weight
+			}
+		}
+		for _, srv := range records {
+			host := strings.TrimSuffix(srv.Target, ".")
+			svr := &Server{URL: fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))}
+			// scale the weights to 1-100 if any of them is not zero.
+			if maxWeight > 0 {
+				svr.Weight = int(srv.Weight) * 100 / int(maxWeight)
+				if svr.Weight == 0 {
+					svr.Weight = 1
+				}
+			}
+			servers = append(servers, svr)
+		}
+
+	default:
+		port := r.spec.Port
+		if port == 0 {
+			port = 80
+			if scheme == "https" {
+				port = 443
+			}
+		}
+
+		qtypes := []uint16{dns.TypeA, dns.TypeAAAA}
+		if r.spec.Type == DNSRecordTypeAAAA {
+			qtypes = qtypes[1:]
+		}
+		for _, qtype := range qtypes {
+			resp, err := r.query(r.spec.Name, qtype)
+			if err != nil {
+				return nil, r.minInterval, err
+			}
+			for _, rr := range resp.Answer {
+				var ip net.IP
+				switch v := rr.(type) {
+				case *dns.A:
+					ip = v.A
+				case *dns.AAAA:
+					ip = v.AAAA
+				default:
+					continue
+				}
+				updateTTL(rr.Header())
+				addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+				servers = append(servers, &Server{URL: scheme + "://" + addr})
+			}
+		}
+	}
+
+	if len(servers) == 0 {
+		return nil, r.minInterval, fmt.Errorf("no record found for %s", r.spec.Name)
+	}
+
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].URL < servers[j].URL
+	})
+
+	interval := time.Duration(ttl) * time.Second
+	if interval < r.minInterval {
+		interval = r.minInterval
+	} else if interval > r.maxInterval {
+		interval = r.maxInterval
+	}
+	return servers, interval, nil
+}
+
+// sameServers reports whether the two sorted server lists are the same.
+func sameServers(a, b []*Server) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].URL != b[i].URL || a[i].Weight != b[i].Weight {
+			return false
+		}
+	}
+	return true
+}
+
+// watchDNS resolves the servers periodically, and recreates the load
+// balancer once they change. The last resolved servers are kept if the
+// resolution fails.
+func (spb *ServerPoolBase) watchDNS(spec *ServerPoolBaseSpec) {
+	r := newDNSResolver(spec.DNS)
+
+	servers, interval, err := r.resolve()
+	if err != nil {
+		logger.Warnf("%s: first try to resolve %s failed(will try again): %v", spb.Name, spec.DNS.Name, err)
+		servers = spec.Servers
+	}
+	spb.createLoadBalancer(spec.LoadBalance, servers)
+
+	spb.wg.Add(1)
+	go func() {
+		defer spb.wg.Done()
+
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-spb.done:
+				return
+			case <-timer.C:
+			}
+
+			var next []*Server
+			next, interval, err = r.resolve()
+			timer.Reset(interval)
+			if err != nil {
+				logger.Warnf("%s: resolve %s failed: %v", spb.Name, spec.DNS.Name, err)
+				continue
+			}
+			if sameServers(servers, next) {
+				continue
+			}
+
+			logger.Infof("%s: servers of %s changed to %v", spb.Name, spec.DNS.Name, next)
+			servers = next
+			spb.createLoadBalancer(spec.LoadBalance, servers)
+		}
+	}()
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxies
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+// startDNSServer starts a DNS server which answers the records returned
+// by fn, and returns its address.
+func startDNSServer(t *testing.T, fn func(q dns.Question) []dns.RR) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	server := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Answer = fn(r.Question[0])
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestDNSDiscoverySpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil((&DNSDiscoverySpec{Name: "example.com", MinRefreshInterval: "1s", MaxRefreshInterval: "1m"}).Validate())
+	assert.Nil((&DNSDiscoverySpec{Name: "_http._tcp.example.com", Type: "SRV"}).Validate())
+	assert.NotNil((&DNSDiscoverySpec{}).Validate())
+	assert.NotNil((&DNSDiscoverySpec{Name: "example.com", Type: "MX"}).Validate())
+	assert.NotNil((&DNSDiscoverySpec{Name: "example.com", Type: "SRV", Port: 80}).Validate())
+	assert.NotNil((&DNSDiscoverySpec{Name: "example.com", MinRefreshInterval: "1m", MaxRefreshInterval: "1s"}).Validate())
+	assert.NotNil((&DNSDiscoverySpec{Name: "example.com", MinRefreshInterval: "abc"}).Validate())
+
+	spec := &ServerPoolBaseSpec{DNS: &DNSDiscoverySpec{Name: "example.com"}}
+	assert.Nil(spec.Validate())
+	spec.ServiceName = "test"
+	assert.NotNil(spec.Validate())
+}
+
+func TestDNSResolver(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := startDNSServer(t, func(q dns.Question) []dns.RR {
+		var records []string
+		switch q.Qtype {
+		case dns.TypeA:
+			records = []string{q.Name + " 30 IN A 10.0.0.2", q.Name + " 60 IN A 10.0.0.1"}
+		case dns.TypeAAAA:
+			records = []string{q.Name + " 60 IN AAAA ::1"}
+		case dns.TypeSRV:
+			records = []string{
+				q.Name + " 120 IN SRV 10 10 8080 a.example.com.",
+				q.Name + " 120 IN SRV 10 5 8081 b.example.com.",
+				q.Name + " 120 IN SRV 20 5 8082 c.example.com.",
+			}
+		}
+		var rrs []dns.RR
+		for _, r := range records {
+			rr, _ := dns.NewRR(r)
+			rrs = append(rrs, rr)
+		}
+		return rrs
+	})
+
+	r := newDNSResolver(&DNSDiscoverySpec{Name: "svc.example.com", Nameservers: []string{addr}})
+	servers, interval, err := r.resolve()
+	assert.Nil(err)
+	assert.Equal(30*time.Second, interval)
+	assert.Equal(3, len(servers))
+	assert.Equal("http://10.0.0.1:80", servers[0].URL)
+	assert.Equal("http://10.0.0.2:80", servers[1].URL)
+	assert.Equal("http://[::1]:80", servers[2].URL)
+
+	r = newDNSResolver(&DNSDiscoverySpec{
+		Name:               "svc.example.com",
+		Type:               "AAAA",
+		Scheme:             "https",
+		Nameservers:        []string{addr},
+		MaxRefreshInterval: "10s",
+	})
+	servers, interval, err = r.resolve()
+	assert.Nil(err)
+	assert.Equal(10*time.Second, interval)
+	assert.Equal(1, len(servers))
+	assert.Equal("https://[::1]:443", servers[0].URL)
+
+	// only the records with the lowest priority are used.
+	r = newDNSResolver(&DNSDiscoverySpec{Name: "_http._tcp.example.com", Type: "SRV", Nameservers: []string{addr}})
+	servers, interval, err = r.resolve()
+	assert.Nil(err)
+	assert.Equal(120*time.Second, interval)
+	assert.Equal(2, len(servers))
+	assert.Equal("http://a.example.com:8080", servers[0].URL)
+	assert.Equal(100, servers[0].Weight)
+	assert.Equal("http://b.example.com:8081", servers[1].URL)
+	assert.Equal(50, servers[1].Weight)
+}
+
+func TestWatchDNS(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	ip := "10.0.0.1"
+	addr := startDNSServer(t, func(q dns.Question) []dns.RR {
+		if q.Qtype != dns.TypeA {
+			return nil
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		rr, _ := dns.NewRR(q.Name + " 0 IN A " + ip)
+		return []dns.RR{rr}
+	})
+
+	spec := &ServerPoolBaseSpec{
+		DNS: &DNSDiscoverySpec{
+			Name:               "svc.example.com",
+			Port:               8080,
+			Nameservers:        []string{addr},
+			MinRefreshInterval: "10ms",
+		},
+	}
+	sp := &ServerPoolBase{}
+	sp.Init(&MockServerPoolImpl{}, supervisor.NewDefaultMock(), "test", spec)
+	defer sp.Close()
+
+	assert.Equal("http://10.0.0.1:8080", sp.LoadBalancer().ChooseServer(nil).URL)
+
+	lock.Lock()
+	ip = "10.0.0.2"
+	lock.Unlock()
+	assert.Eventually(func() bool {
+		return sp.LoadBalancer().ChooseServer(nil).URL == "http://10.0.0.2:8080"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -24,27 +24,37 @@ import (
 	"net"
 	"net/url"
 	"sync"
+	"time"
 
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters/proxies"
 	"github.com/megaease/easegress/v2/pkg/protocols/grpcprot"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
 	"github.com/megaease/easegress/v2/pkg/util/objectpool"
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/resilience"
 )
 
+// maxReqFramesBytes is the max total size of the request messages buffered
+// for retrying, the calls with larger requests are not retried.
+const maxReqFramesBytes = 4 << 20
+
 type (
 	// serverPoolError is the error returned by handler function of
 	// a server pool.
 	serverPoolError struct {
-		status *status.Status
-		result string
+		status    *status.Status
+		result    string
+		retryable bool
 	}
 	// MultiPool manage multi Pool.
 	MultiPool struct {
@@ -88,8 +98,12 @@ func (spe serverPoolError) Error() string {
 	return fmt.Sprintf("server pool error, status code=%+v, result=%s", spe.status, spe.result)
 }
 
-// Result returns the result string.
+// Result returns the result string, calls exceeding their deadlines
+// result in timeout.
 func (spe serverPoolError) Result() string {
+	if spe.status.Code() == codes.DeadlineExceeded {
+		return resultTimeout
+	}
 	return spe.result
 }
 
@@ -97,6 +111,11 @@ func (spe serverPoolError) Code() int {
 	return int(spe.status.Proto().GetCode())
 }
 
+// Retryable returns whether the call could be retried.
+func (spe serverPoolError) Retryable() bool {
+	return spe.retryable
+}
+
 // serverPoolContext records the context information in calling the
 // handler function.
 type serverPoolContext struct {
@@ -109,6 +128,22 @@ type serverPoolContext struct {
 	req *grpcprot.Request
 	// resp is just response data
 	resp *grpcprot.Response
+
+	// reqFrames are the buffered request messages for retrying.
+	reqFrames []*emptypb.Empty
+	// reqFramesBytes is the total size of reqFrames.
+	reqFramesBytes int
+	// reqFramesDropped is true if reqFrames exceeded maxReqFramesBytes
+	// and were dropped, the call can't be retried then.
+	reqFramesDropped bool
+	// reqEOF is true if all request messages have been received.
+	reqEOF bool
+	// respStarted is true if any response has been sent to the client,
+	// the call can't be retried then.
+	respStarted bool
+	// err is the error which is not a failure, so it is not reported
+	// to the resilience wrappers.
+	err *serverPoolError
 }
 
 var desc = &grpc.StreamDesc{
@@ -127,7 +162,11 @@ type ServerPool struct {
 	spec  *ServerPoolSpec
 
 	filter                RequestMatcher
+	failureCodes          map[codes.Code]struct{}
+	retryWrapper          resilience.Wrapper
 	circuitBreakerWrapper resilience.Wrapper
+
+	metrics *metrics
 }
 
 // ServerPoolSpec is the spec for a server pool.
@@ -136,13 +175,26 @@ type ServerPoolSpec struct {
 
 	SpanName             string              `json:"spanName,omitempty"`
 	Filter               *RequestMatcherSpec `json:"filter,omitempty"`
+	RetryPolicy          string              `json:"retryPolicy,omitempty"`
 	CircuitBreakerPolicy string              `json:"circuitBreakerPolicy,omitempty"`
+
+	// FailureCodes are the gRPC status codes which are reported as failures
+	// to the resilience policies, all non-OK codes are failures if it is empty.
+	FailureCodes []int `json:"failureCodes,omitempty" jsonschema:"uniqueItems=true"`
 }
 
 // Validate validates ServerPoolSpec.
 func (sps *ServerPoolSpec) Validate() error {
-	if sps.ServiceName == "" && len(sps.Servers) == 0 {
-		return fmt.Errorf("both serviceName and servers are empty")
+	if sps.ServiceName == "" && sps.DNS == nil && len(sps.Servers) == 0 {
+		return fmt.Errorf("serviceName, dns and servers are all empty")
+	}
+	if sps.DNS != nil {
+		if sps.ServiceName != "" {
+			return fmt.Errorf("serviceName and dns can't be set at the same time")
+		}
+		if err := sps.DNS.Validate(); err != nil {
+			return fmt.Errorf("dns: %v", err)
+		}
 	}
 
 	serversGotWeight := 0
@@ -155,6 +207,12 @@ func (sps *ServerPoolSpec) Validate() error {
 		msgFmt := "not all servers have weight(%d/%d)"
 		return fmt.Errorf(msgFmt, serversGotWeight, len(sps.Servers))
 	}
+
+	for _, code := range sps.FailureCodes {
+		if code <= int(codes.OK) || code > int(codes.Unauthenticated) {
+			return fmt.Errorf("invalid gRPC failure code %d", code)
+		}
+	}
 	return nil
 }
 
@@ -169,11 +227,27 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 		sp.filter = NewRequestMatcher(spec.Filter)
 	}
 
+	sp.failureCodes = map[codes.Code]struct{}{}
+	for _, code := range spec.FailureCodes {
+		sp.failureCodes[codes.Code(code)] = struct{}{}
+	}
+
 	sp.BaseServerPool.Init(sp, proxy.super, name, &spec.BaseServerPoolSpec)
 
+	sp.metrics = sp.newMetrics(name)
+
 	return sp
 }
 
+func (sp *ServerPool) inFailureCodes(code codes.Code) bool {
+	if len(sp.failureCodes) == 0 {
+		return code != codes.OK
+	}
+
+	_, exists := sp.failureCodes[code]
+	return exists
+}
+
 // CreateLoadBalancer creates a load balancer according to spec.
 func (sp *ServerPool) CreateLoadBalancer(spec *LoadBalanceSpec, servers []*Server) LoadBalancer {
 	if spec.Policy == "forward" {
@@ -187,7 +261,20 @@ func (sp *ServerPool) CreateLoadBalancer(spec *LoadBalanceSpec, servers []*Serve
 
 // InjectResiliencePolicy injects resilience policies to the server pool.
 func (sp *ServerPool) InjectResiliencePolicy(policies map[string]resilience.Policy) {
-	name := sp.spec.CircuitBreakerPolicy
+	name := sp.spec.RetryPolicy
+	if name != "" {
+		p := policies[name]
+		if p == nil {
+			panic(fmt.Errorf("retry policy %s not found", name))
+		}
+		policy, ok := p.(*resilience.RetryPolicy)
+		if !ok {
+			panic(fmt.Errorf("policy %s is not a retry policy", name))
+		}
+		sp.retryWrapper = policy.CreateWrapper()
+	}
+
+	name = sp.spec.CircuitBreakerPolicy
 	if name != "" {
 		p := policies[name]
 		if p == nil {
@@ -214,6 +301,12 @@ func (sp *ServerPool) handle(ctx *context.Context) string {
 		spCtx.stdw.SetTrailer(spCtx.resp.RawTrailer().GetMD())
 	}()
 
+	startTime := fasttime.Now()
+	code := codes.OK
+	defer func() {
+		sp.exportPrometheusMetrics(spCtx.req.FullMethod(), code, fasttime.Since(startTime))
+	}()
+
 	handler := func(stdctx stdcontext.Context) error {
 		if sp.proxy.timeout > 0 {
 			var cancel stdcontext.CancelFunc
@@ -221,24 +314,46 @@ func (sp *ServerPool) handle(ctx *context.Context) string {
 			defer cancel()
 		}
 
+		spCtx.err = nil
 		err := sp.doHandle(stdctx, spCtx)
 		if err == nil {
 			return nil
 		}
+		if err == resilience.ErrShortCircuited {
+			return err
+		}
 
+		spe := err.(serverPoolError)
 		spCtx.LazyAddTag(func() string {
-			return fmt.Sprintf("status code: %d", err.(serverPoolError).Code())
+			return fmt.Sprintf("status code: %d", spe.Code())
 		})
 
-		return err
+		// Only failures are reported to the resilience wrappers.
+		if !sp.inFailureCodes(spe.status.Code()) {
+			spCtx.err = &spe
+			return nil
+		}
+
+		// The request messages must be replayed to retry, so all of
+		// them must have been received, and nothing has been sent to
+		// the client.
+		spe.retryable = spCtx.reqEOF && !spCtx.respStarted && !spCtx.reqFramesDropped
+		return spe
 	}
 
+	if sp.retryWrapper != nil {
+		spCtx.reqFrames = []*emptypb.Empty{}
+		handler = sp.retryWrapper.Wrap(handler)
+	}
 	if sp.circuitBreakerWrapper != nil {
 		handler = sp.circuitBreakerWrapper.Wrap(handler)
 	}
 
 	// call the handler.
 	err := handler(spCtx.req.Context())
+	if err == nil && spCtx.err != nil {
+		err = *spCtx.err
+	}
 	if err == nil {
 		spCtx.Context.SetOutputResponse(spCtx.resp)
 		return ""
@@ -249,6 +364,7 @@ func (sp *ServerPool) handle(ctx *context.Context) string {
 	if err == resilience.ErrShortCircuited {
 		logger.Debugf("%s: short circuited by circuit break policy", sp.Name)
 		spCtx.AddTag("short circuited")
+		code = codes.Unavailable
 		sp.buildOutputResponse(spCtx, status.Newf(codes.Unavailable, "short circuited by circuit break policy"))
 		return resultShortCircuited
 	}
@@ -257,6 +373,7 @@ func (sp *ServerPool) handle(ctx *context.Context) string {
 	// response in most cases, but for failure status codes, the
 	// response is already there.
 	if spe, ok := err.(serverPoolError); ok {
+		code = spe.status.Code()
 		sp.buildOutputResponse(spCtx, spe.status)
 		return spe.Result()
 	}
@@ -276,25 +393,39 @@ func (sp *ServerPool) getTarget(rawTarget string) string {
 	return target
 }
 
-func (sp *ServerPool) doHandle(ctx stdcontext.Context, spCtx *serverPoolContext) error {
+func (sp *ServerPool) doHandle(ctx stdcontext.Context, spCtx *serverPoolContext) (err error) {
 	lb := sp.LoadBalancer()
 	svr := lb.ChooseServer(spCtx.req)
 	// if there's no available server.
 	if svr == nil {
 		logger.Debugf("%s: no available server", sp.Name)
-		return serverPoolError{status.New(codes.InvalidArgument, "no available server"), resultClientError}
+		return serverPoolError{status: status.New(codes.InvalidArgument, "no available server"), result: resultClientError}
 	}
+
+	// check the circuit breaker of the server if there is one.
+	done, err := resilience.EnterBackend(ctx, svr.URL)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// only failures are reported to the circuit breaker.
+		if spe, ok := err.(serverPoolError); ok && !sp.inFailureCodes(spe.status.Code()) {
+			done(nil)
+		} else {
+			done(err)
+		}
+	}()
 	target := sp.getTarget(svr.URL)
 	lb.ReturnServer(svr, spCtx.req, spCtx.resp)
 	if target == "" {
 		logger.Debugf("request %v from %v context target address %s invalid", spCtx.req.FullMethod(), spCtx.req.RealIP(), target)
-		return serverPoolError{status.New(codes.Internal, "server url invalid"), resultInternalError}
+		return serverPoolError{status: status.New(codes.Internal, "server url invalid"), result: resultInternalError}
 	}
 
 	// maybe be rewritten by grpcserver.MuxPath#rewrite
 	fullMethodName := spCtx.req.FullMethod()
 	if fullMethodName == "" {
-		return serverPoolError{status.New(codes.InvalidArgument, "unknown called method from context"), resultClientError}
+		return serverPoolError{status: status.New(codes.InvalidArgument, "unknown called method from context"), result: resultClientError}
 	}
 
 	borrowCtx, cancel := stdcontext.WithCancel(stdcontext.Background())
@@ -343,8 +474,14 @@ func (sp *ServerPool) biTransport(ctx *serverPoolContext, proxyAsClientStream gr
 	// Explicitly *do not Close* c2sErrChan and c2sErrChan, otherwise the select below will not terminate.
 	// Channels do not have to be closed, it is just a control flow mechanism, see
 	// https://groups.google.com/forum/#!msg/golang-nuts/pZwdYRGxCIk/qpbHxRRPJdUJ
-	c2sErrChan := sp.forwardS2C(ctx.stdr, proxyAsClientStream, nil)
-	s2cErrChan := sp.forwardC2S(proxyAsClientStream, ctx.stdw, ctx.resp.RawHeader())
+	var c2sErrChan chan error
+	if ctx.reqEOF {
+		// this is a retry, all request messages are buffered.
+		c2sErrChan = sp.replay(ctx.reqFrames, proxyAsClientStream)
+	} else {
+		c2sErrChan = sp.forwardS2C(ctx, proxyAsClientStream)
+	}
+	s2cErrChan := sp.forwardC2S(ctx, proxyAsClientStream, ctx.resp.RawHeader())
 	// We don't know which side is going to stop sending first, so we need a select between the two.
 	for {
 		select {
@@ -352,12 +489,13 @@ func (sp *ServerPool) biTransport(ctx *serverPoolContext, proxyAsClientStream gr
 			if c2sErr == io.EOF {
 				// this is the happy case where the sender has encountered io.EOF, and won't be sending anymore./
 				// the server --> client may continue pumping though.
+				ctx.reqEOF = true
 				proxyAsClientStream.CloseSend()
 			} else {
 				// however, we may have gotten a receive error (stream disconnected, a read error etc) in which case we need
 				// to cancel the clientStream to the backend, let all of its goroutines be freed up by the CancelFunc and
 				// exit with an error to the stack
-				return serverPoolError{status.Convert(c2sErr), resultServerError}
+				return serverPoolError{status: status.Convert(c2sErr), result: resultServerError}
 			}
 		case s2cErr := <-s2cErrChan:
 			// This happens when the clientStream has nothing else to offer (io.EOF), returned a gRPC error. In those two
@@ -366,7 +504,7 @@ func (sp *ServerPool) biTransport(ctx *serverPoolContext, proxyAsClientStream gr
 			ctx.resp.SetTrailer(grpcprot.NewTrailer(proxyAsClientStream.Trailer()))
 			// c2sErr will contain RPC error from client code. If not io.EOF return the RPC error as server stream error.
 			if s2cErr != io.EOF {
-				return serverPoolError{status.Convert(s2cErr), resultServerError}
+				return serverPoolError{status: status.Convert(s2cErr), result: resultServerError}
 			}
 			return nil
 		}
@@ -378,7 +516,8 @@ func (sp *ServerPool) buildOutputResponse(spCtx *serverPoolContext, s *status.St
 	spCtx.SetOutputResponse(spCtx.resp)
 }
 
-func (sp *ServerPool) forwardC2S(src grpc.ClientStream, dst grpc.ServerStream, header *grpcprot.Header) chan error {
+func (sp *ServerPool) forwardC2S(ctx *serverPoolContext, src grpc.ClientStream, header *grpcprot.Header) chan error {
+	dst := ctx.stdw
 	ret := make(chan error, 1)
 	go func() {
 		f := &emptypb.Empty{}
@@ -387,6 +526,7 @@ func (sp *ServerPool) forwardC2S(src grpc.ClientStream, dst grpc.ServerStream, h
 				ret <- err // this can be io.EOF which is happy case
 				return
 			}
+			ctx.respStarted = true
 			if i == 0 {
 				// This is a bit of a hack, but client to server headers are only readable after first client msg is
 				// received but must be written to server stream before the first msg is flushed.
@@ -414,15 +554,23 @@ func (sp *ServerPool) forwardC2S(src grpc.ClientStream, dst grpc.ServerStream, h
 	return ret
 }
 
-func (sp *ServerPool) forwardS2C(src grpc.ServerStream, dst grpc.ClientStream, header *grpcprot.Header) chan error {
+func (sp *ServerPool) forwardS2C(ctx *serverPoolContext, dst grpc.ClientStream) chan error {
+	src := ctx.stdr
 	ret := make(chan error, 1)
 	go func() {
 		f := &emptypb.Empty{}
 		for i := 0; ; i++ {
+			// the messages are kept to be replayed in retrying.
+			if ctx.reqFrames != nil {
+				f = &emptypb.Empty{}
+			}
 			if err := src.RecvMsg(f); err != nil {
 				ret <- err // this can be io.EOF which is happy case
 				return
 			}
+			if ctx.reqFrames != nil {
+				ctx.bufferReqFrame(f)
+			}
 			if err := dst.SendMsg(f); err != nil {
 				ret <- err
 				return
@@ -431,3 +579,68 @@ func (sp *ServerPool) forwardS2C(src grpc.ServerStream, dst grpc.ClientStream, h
 	}()
 	return ret
 }
+
+// bufferReqFrame buffers the request message for retrying, the buffered
+// messages are dropped once they exceed maxReqFramesBytes.
+func (ctx *serverPoolContext) bufferReqFrame(f *emptypb.Empty) {
+	ctx.reqFramesBytes += proto.Size(f)
+	if ctx.reqFramesBytes > maxReqFramesBytes {
+		ctx.reqFrames = nil
+		ctx.reqFramesDropped = true
+		return
+	}
+	ctx.reqFrames = append(ctx.reqFrames, f)
+}
+
+// replay sends the buffered request messages to dst.
+func (sp *ServerPool) replay(frames []*emptypb.Empty, dst grpc.ClientStream) chan error {
+	ret := make(chan error, 1)
+	go func() {
+		for _, f := range frames {
+			if err := dst.SendMsg(f); err != nil {
+				ret <- err
+				return
+			}
+		}
+		ret <- io.EOF
+	}()
+	return ret
+}
+
+type metrics struct {
+	TotalCalls   *prometheus.CounterVec
+	CallDuration prometheus.ObserverVec
+}
+
+func (sp *ServerPool) newMetrics(name string) *metrics {
+	commonLabels := prometheus.Labels{
+		"proxyName":    name,
+		"kind":         Kind,
+		"clusterName":  sp.proxy.super.Options().ClusterName,
+		"clusterRole":  sp.proxy.super.Options().ClusterRole,
+		"instanceName": sp.proxy.super.Options().Name,
+	}
+	callLabels := []string{"clusterName", "clusterRole", "instanceName",
+		"proxyName", "kind", "method", "code"}
+	return &metrics{
+		TotalCalls: prometheushelper.NewCounter("grpcproxy_total_calls",
+			"the total count of gRPC calls",
+			callLabels).MustCurryWith(commonLabels),
+		CallDuration: prometheushelper.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "grpcproxy_call_duration",
+				Help:    "a histogram of the duration of gRPC calls in milliseconds.",
+				Buckets: prometheushelper.DefaultDurationBuckets(),
+			},
+			callLabels).MustCurryWith(commonLabels),
+	}
+}
+
+func (sp *ServerPool) exportPrometheusMetrics(method string, code codes.Code, duration time.Duration) {
+	labels := prometheus.Labels{
+		"method": method,
+		"code":   code.String(),
+	}
+	sp.metrics.TotalCalls.With(labels).Inc()
+	sp.metrics.CallDuration.With(labels).Observe(float64(duration.Milliseconds()))
+}
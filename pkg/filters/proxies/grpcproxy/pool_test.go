@@ -19,6 +19,7 @@ package grpcproxy
 
 import (
 	"context"
+	"io"
 	"math/rand"
 	"sync"
 	"testing"
@@ -28,8 +29,11 @@ import (
 	"github.com/megaease/easegress/v2/pkg/filters/proxies"
 	"github.com/megaease/easegress/v2/pkg/util/objectpool"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func TestSPSValidate(t *testing.T) {
@@ -173,6 +177,16 @@ func TestServerPoolError(t *testing.T) {
 	assert.Equal(t, "ok", spe.Result())
 	assert.Equal(t, int(codes.OK), spe.Code())
 	assert.Equal(t, "server pool error, status code=rpc error: code = OK desc = ok, result=ok", spe.Error())
+	assert.False(t, spe.Retryable())
+
+	spe.retryable = true
+	assert.True(t, spe.Retryable())
+
+	spe = serverPoolError{
+		result: resultServerError,
+		status: status.New(codes.DeadlineExceeded, "context deadline exceeded"),
+	}
+	assert.Equal(t, resultTimeout, spe.Result())
 }
 
 func TestServerPoolSpecValidate(t *testing.T) {
@@ -193,6 +207,52 @@ func TestServerPoolSpecValidate(t *testing.T) {
 
 	sps.Servers[0].Weight = 1
 	assert.Error(t, sps.Validate())
+
+	sps.Servers[0].Weight = 0
+	sps.FailureCodes = []int{int(codes.Unavailable), int(codes.ResourceExhausted)}
+	assert.NoError(t, sps.Validate())
+
+	sps.FailureCodes = []int{int(codes.OK)}
+	assert.Error(t, sps.Validate())
+
+	sps.FailureCodes = []int{100}
+	assert.Error(t, sps.Validate())
+}
+
+func TestInFailureCodes(t *testing.T) {
+	at := assert.New(t)
+
+	s := `
+kind: GRPCProxy
+pools:
+ - loadBalance:
+     policy: roundRobin
+   servers:
+    - url: http://192.168.1.1:80
+   serviceName: easegress
+   failureCodes: [14]
+ - loadBalance:
+     policy: roundRobin
+   servers:
+    - url: http://192.168.1.1:80
+   serviceName: easegress
+   filter:
+     policy: random
+     permil: 50
+maxIdleConnsPerHost: 2
+connectTimeout: 100ms
+borrowTimeout: 100ms
+name: grpcforwardproxy
+`
+	proxy := newTestProxy(s, at)
+	defer proxy.Close()
+
+	at.True(proxy.mainPool.inFailureCodes(codes.Unavailable))
+	at.False(proxy.mainPool.inFailureCodes(codes.NotFound))
+	at.False(proxy.mainPool.inFailureCodes(codes.OK))
+
+	at.True(proxy.candidatePools[0].inFailureCodes(codes.NotFound))
+	at.False(proxy.candidatePools[0].inFailureCodes(codes.OK))
 }
 
 func TestGetTarget(t *testing.T) {
@@ -241,3 +301,50 @@ name: grpcforwardproxy
 	request.Header().Set("targetAddress", "192.168.1.1")
 	at.Equal("", proxy.mainPool.getTarget(proxy.mainPool.LoadBalancer().ChooseServer(request).URL))
 }
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	sent []interface{}
+}
+
+func (s *fakeClientStream) SendMsg(m interface{}) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestReplay(t *testing.T) {
+	at := assert.New(t)
+
+	sp := &ServerPool{}
+	frames := []*emptypb.Empty{{}, {}}
+	cs := &fakeClientStream{}
+
+	err := <-sp.replay(frames, cs)
+	at.Equal(io.EOF, err)
+	at.Len(cs.sent, 2)
+	at.True(cs.sent[0] == frames[0])
+	at.True(cs.sent[1] == frames[1])
+}
+
+func TestBufferReqFrame(t *testing.T) {
+	at := assert.New(t)
+
+	// a message of 1.5MiB
+	data := protowire.AppendTag(nil, 1, protowire.BytesType)
+	data = protowire.AppendBytes(data, make([]byte, 3<<19))
+
+	ctx := &serverPoolContext{reqFrames: []*emptypb.Empty{}}
+	for i := 0; i < 2; i++ {
+		f := &emptypb.Empty{}
+		at.NoError(GrpcCodec{}.Unmarshal(data, f))
+		ctx.bufferReqFrame(f)
+	}
+	at.Len(ctx.reqFrames, 2)
+	at.False(ctx.reqFramesDropped)
+
+	f := &emptypb.Empty{}
+	at.NoError(GrpcCodec{}.Unmarshal(data, f))
+	ctx.bufferReqFrame(f)
+	at.Nil(ctx.reqFrames)
+	at.True(ctx.reqFramesDropped)
+}
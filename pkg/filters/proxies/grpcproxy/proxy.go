@@ -43,6 +43,7 @@ const (
 	resultServerError   = "serverError"
 
 	// result for resilience
+	resultTimeout        = "timeout"
 	resultShortCircuited = "shortCircuited"
 )
 
@@ -54,6 +55,7 @@ var (
 			resultInternalError,
 			resultClientError,
 			resultServerError,
+			resultTimeout,
 			resultShortCircuited,
 		},
 		DefaultSpec: func() filters.Spec {
@@ -26,6 +26,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/filters"
 	"github.com/megaease/easegress/v2/pkg/filters/proxies"
 	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/option"
 	"github.com/megaease/easegress/v2/pkg/protocols/grpcprot"
 	"github.com/megaease/easegress/v2/pkg/resilience"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
@@ -49,6 +50,10 @@ func newTestProxy(yamlSpec string, assert *assert.Assertions) *Proxy {
 	assert.NoError(err)
 
 	proxy := kind.CreateInstance(spec).(*Proxy)
+
+	proxy.super = supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+
 	proxy.Init()
 
 	assert.Nil(proxy.Status())
@@ -159,7 +164,7 @@ name: grpcforwardproxy
 	p.reload()
 	assertions.True(oldPool == p.connectionPool)
 
-	p1 := &Proxy{spec: p.spec}
+	p1 := &Proxy{spec: p.spec, super: p.super}
 	p1.Inherit(p)
 	p.Close()
 	p1.Close()
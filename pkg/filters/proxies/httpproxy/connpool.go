@@ -0,0 +1,377 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpproxy
+
+import (
+	stdctx "context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/proxyprotocol"
+)
+
+const (
+	defaultDialTimeout     = 30 * time.Second
+	defaultTCPKeepAlive    = 60 * time.Second
+	defaultIdleConnTimeout = 90 * time.Second
+
+	// unixSocketHostSuffix is the suffix of the hosts standing for unix
+	// sockets in the URLs of the requests to the servers. The host is the
+	// hex encoded path of the socket, so the connections are pooled per
+	// socket like the ones to TCP servers.
+	unixSocketHostSuffix = ".unix-socket"
+)
+
+type (
+	// ConnectionPoolSpec is the spec of the connections to the servers.
+	ConnectionPoolSpec struct {
+		// MaxIdleConns and MaxIdleConnsPerHost override the ones of the
+		// proxy if they are not zero.
+		MaxIdleConns        int `json:"maxIdleConns,omitempty" jsonschema:"minimum=0"`
+		MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty" jsonschema:"minimum=0"`
+		// MaxConnsPerHost limits the connections to a server, including
+		// the ones in use, the requests wait for the connections once the
+		// limit is reached. No limit if it is zero.
+		MaxConnsPerHost int    `json:"maxConnsPerHost,omitempty" jsonschema:"minimum=0"`
+		IdleConnTimeout string `json:"idleConnTimeout,omitempty" jsonschema:"format=duration"`
+		DialTimeout     string `json:"dialTimeout,omitempty" jsonschema:"format=duration"`
+		// TCPKeepAlive is the interval of the TCP keepalive probes, it is
+		// disabled if the interval is negative.
+		TCPKeepAlive string `json:"tcpKeepAlive,omitempty" jsonschema:"format=duration"`
+		// HappyEyeballsDelay is the delay before falling back to IPv4 if
+		// the IPv6 connection is not established, it is disabled if the
+		// delay is negative.
+		HappyEyeballsDelay string `json:"happyEyeballsDelay,omitempty" jsonschema:"format=duration"`
+	}
+
+	// ConnectionPoolStatus is the status of the connections of a pool.
+	ConnectionPoolStatus struct {
+		Active     int64   `json:"active"`
+		Idle       int64   `json:"idle"`
+		Created    uint64  `json:"created"`
+		Requests   uint64  `json:"requests"`
+		Reused     uint64  `json:"reused"`
+		ReuseRatio float64 `json:"reuseRatio"`
+	}
+
+	// connStats is the statistics of the connections of a pool, the
+	// connections are attributed to the pool of the request dialing them.
+	connStats struct {
+		open     atomic.Int64
+		active   atomic.Int64
+		created  atomic.Uint64
+		requests atomic.Uint64
+		reused   atomic.Uint64
+
+		// onChange is called once the statistics change, and onCreated
+		// is called once a connection is created.
+		onChange  func(s *connStats)
+		onCreated func()
+	}
+
+	connStatsKey struct{}
+
+	// clientAddrs are the addresses of the client connection, which are
+	// sent in the PROXY header.
+	clientAddrs struct {
+		src, dst net.Addr
+	}
+
+	clientAddrsKey struct{}
+
+	// trackedConn is a connection which updates the statistics on close.
+	trackedConn struct {
+		net.Conn
+		stats     *connStats
+		closeOnce sync.Once
+	}
+
+	// trackedTransport is a round tripper which tracks the connections
+	// used by the requests.
+	trackedTransport struct {
+		http.RoundTripper
+	}
+
+	// trackedBody is a response body which marks the connection idle
+	// on close.
+	trackedBody struct {
+		io.ReadCloser
+		stats     *connStats
+		closeOnce sync.Once
+	}
+)
+
+// Validate validates ConnectionPoolSpec.
+func (spec *ConnectionPoolSpec) Validate() error {
+	durations := map[string]string{
+		"idleConnTimeout":    spec.IdleConnTimeout,
+		"dialTimeout":        spec.DialTimeout,
+		"tcpKeepAlive":       spec.TCPKeepAlive,
+		"happyEyeballsDelay": spec.HappyEyeballsDelay,
+	}
+	for name, v := range durations {
+		if v == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid %s %s: %v", name, v, err)
+		}
+	}
+	return nil
+}
+
+func (spec *ConnectionPoolSpec) dialer() *net.Dialer {
+	d := &net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: defaultTCPKeepAlive,
+	}
+	if spec == nil {
+		return d
+	}
+
+	if spec.DialTimeout != "" {
+		d.Timeout, _ = time.ParseDuration(spec.DialTimeout)
+	}
+	if spec.TCPKeepAlive != "" {
+		d.KeepAlive, _ = time.ParseDuration(spec.TCPKeepAlive)
+	}
+	if spec.HappyEyeballsDelay != "" {
+		d.FallbackDelay, _ = time.ParseDuration(spec.HappyEyeballsDelay)
+	}
+	return d
+}
+
+func (spec *ConnectionPoolSpec) idleConnTimeout() time.Duration {
+	if spec == nil || spec.IdleConnTimeout == "" {
+		return defaultIdleConnTimeout
+	}
+	d, _ := time.ParseDuration(spec.IdleConnTimeout)
+	return d
+}
+
+func withConnStats(ctx stdctx.Context, stats *connStats) stdctx.Context {
+	if stats == nil {
+		return ctx
+	}
+	return stdctx.WithValue(ctx, connStatsKey{}, stats)
+}
+
+func getConnStats(ctx stdctx.Context) *connStats {
+	stats, _ := ctx.Value(connStatsKey{}).(*connStats)
+	return stats
+}
+
+func (s *connStats) changed() {
+	if s.onChange != nil {
+		s.onChange(s)
+	}
+}
+
+func (s *connStats) status() *ConnectionPoolStatus {
+	status := &ConnectionPoolStatus{
+		Active:   s.active.Load(),
+		Created:  s.created.Load(),
+		Requests: s.requests.Load(),
+		Reused:   s.reused.Load(),
+	}
+	// The connections of HTTP/2 are shared by the requests, so the
+	// active requests may be more than the open connections.
+	if idle := s.open.Load() - status.Active; idle > 0 {
+		status.Idle = idle
+	}
+	if status.Requests > 0 {
+		status.ReuseRatio = float64(status.Reused) / float64(status.Requests)
+	}
+	return status
+}
+
+// unixSocketHost returns the host standing for the unix socket in the
+// URLs of the requests.
+func unixSocketHost(path string) string {
+	return hex.EncodeToString([]byte(path)) + unixSocketHostSuffix
+}
+
+// unixSocketPath returns the path of the unix socket if addr, which could
+// have a port, is a host returned by unixSocketHost.
+func unixSocketPath(addr string) (string, bool) {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	if !strings.HasSuffix(host, unixSocketHostSuffix) {
+		return "", false
+	}
+	path, err := hex.DecodeString(strings.TrimSuffix(host, unixSocketHostSuffix))
+	if err != nil {
+		return "", false
+	}
+	return string(path), true
+}
+
+// unixSocketDial wraps the dial function to connect to the unix sockets
+// for the hosts returned by unixSocketHost.
+func unixSocketDial(dial func(stdctx.Context, string, string) (net.Conn, error)) func(stdctx.Context, string, string) (net.Conn, error) {
+	return func(ctx stdctx.Context, network, addr string) (net.Conn, error) {
+		if path, ok := unixSocketPath(addr); ok {
+			return dial(ctx, "unix", path)
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// proxyFromEnvironment is http.ProxyFromEnvironment, except that the
+// requests to the unix sockets are never sent to a proxy.
+func proxyFromEnvironment(req *http.Request) (*url.URL, error) {
+	if _, ok := unixSocketPath(req.URL.Host); ok {
+		return nil, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// withClientAddrs returns a context carrying the addresses of the client
+// connection of req.
+func withClientAddrs(ctx stdctx.Context, req *http.Request) stdctx.Context {
+	addrs := &clientAddrs{}
+	if ap, err := netip.ParseAddrPort(req.RemoteAddr); err == nil {
+		addrs.src = net.TCPAddrFromAddrPort(ap)
+	}
+	addrs.dst, _ = req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return stdctx.WithValue(ctx, clientAddrsKey{}, addrs)
+}
+
+func proxyProtocolVersion(version string) int {
+	switch version {
+	case "v1":
+		return 1
+	case "v2":
+		return 2
+	}
+	return 0
+}
+
+// proxyProtocolDial wraps the dial function to send the PROXY header with
+// the addresses of the client on the created connections. A header without
+// addresses is sent if they are unknown.
+func proxyProtocolDial(dial func(stdctx.Context, string, string) (net.Conn, error), version int) func(stdctx.Context, string, string) (net.Conn, error) {
+	return func(ctx stdctx.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		var src, dst net.Addr
+		if addrs, ok := ctx.Value(clientAddrsKey{}).(*clientAddrs); ok {
+			src, dst = addrs.src, addrs.dst
+		}
+		if err = proxyprotocol.WriteHeader(conn, version, src, dst); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("write proxy protocol header failed: %v", err)
+		}
+		return conn, nil
+	}
+}
+
+// trackDial wraps the dial function to track the created connections.
+func trackDial(dial func(stdctx.Context, string, string) (net.Conn, error)) func(stdctx.Context, string, string) (net.Conn, error) {
+	return func(ctx stdctx.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		stats := getConnStats(ctx)
+		if err != nil || stats == nil {
+			return conn, err
+		}
+
+		stats.open.Add(1)
+		stats.created.Add(1)
+		if stats.onCreated != nil {
+			stats.onCreated()
+		}
+		stats.changed()
+		return &trackedConn{Conn: conn, stats: stats}, nil
+	}
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stats.open.Add(-1)
+		c.stats.changed()
+	})
+	return c.Conn.Close()
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *trackedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	stats := getConnStats(req.Context())
+	if stats == nil {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			stats.requests.Add(1)
+			if info.Reused {
+				stats.reused.Add(1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	stats.active.Add(1)
+	stats.changed()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		stats.active.Add(-1)
+		stats.changed()
+		return nil, err
+	}
+
+	// The body of an upgraded connection is also a writer, keep it as is.
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		stats.active.Add(-1)
+		stats.changed()
+		return resp, nil
+	}
+
+	resp.Body = &trackedBody{ReadCloser: resp.Body, stats: stats}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// round tripper.
+func (t *trackedTransport) CloseIdleConnections() {
+	if c, ok := t.RoundTripper.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+func (b *trackedBody) Close() error {
+	b.closeOnce.Do(func() {
+		b.stats.active.Add(-1)
+		b.stats.changed()
+	})
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpproxy
+
+import (
+	stdctx "context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/proxyprotocol"
+)
+
+func TestConnectionPoolSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &ConnectionPoolSpec{
+		MaxConnsPerHost:    10,
+		IdleConnTimeout:    "30s",
+		DialTimeout:        "3s",
+		TCPKeepAlive:       "-1s",
+		HappyEyeballsDelay: "100ms",
+	}
+	assert.NoError(spec.Validate())
+
+	d := spec.dialer()
+	assert.Equal(3*time.Second, d.Timeout)
+	assert.True(d.KeepAlive < 0)
+	assert.Equal(100*time.Millisecond, d.FallbackDelay)
+	assert.Equal(30*time.Second, spec.idleConnTimeout())
+
+	var nilSpec *ConnectionPoolSpec
+	assert.Equal(defaultDialTimeout, nilSpec.dialer().Timeout)
+	assert.Equal(defaultIdleConnTimeout, nilSpec.idleConnTimeout())
+
+	spec.DialTimeout = "abc"
+	assert.Error(spec.Validate())
+}
+
+func TestConnectionPool(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer svr.Close()
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+connectionPool:
+  maxConnsPerHost: 1
+  idleConnTimeout: 10s
+pools:
+- servers:
+  - url: `+svr.URL+`
+- filter:
+    headers:
+      X-Pool:
+        exact: candidate
+  connectionPool:
+    dialTimeout: 1s
+  servers:
+  - url: `+svr.URL, assert)
+	defer proxy.Close()
+
+	assert.Nil(proxy.mainPool.client)
+	assert.NotNil(proxy.candidatePools[0].client)
+
+	for i := 0; i < 3; i++ {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", nil)
+		ctx := getCtx(stdr)
+		assert.Equal("", proxy.Handle(ctx))
+	}
+
+	status := proxy.Status().(*Status).MainPool.ConnectionPool
+	assert.Equal(uint64(1), status.Created)
+	assert.Equal(uint64(3), status.Requests)
+	assert.Equal(uint64(2), status.Reused)
+	assert.InDelta(2.0/3, status.ReuseRatio, 0.001)
+	assert.Equal(int64(0), status.Active)
+	assert.Equal(int64(1), status.Idle)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", nil)
+	stdr.Header.Set("X-Pool", "candidate")
+	assert.Equal("", proxy.Handle(getCtx(stdr)))
+
+	status = proxy.Status().(*Status).CandidatePools[0].ConnectionPool
+	assert.Equal(uint64(1), status.Created)
+	assert.Equal(uint64(0), status.Reused)
+}
+
+func TestProxyProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.RemoteAddr)
+	}))
+	svr.Listener = proxyprotocol.NewListener(svr.Listener, time.Second)
+	svr.Start()
+	defer svr.Close()
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- proxyProtocol: v2
+  servers:
+  - url: `+svr.URL, assert)
+	defer proxy.Close()
+
+	for _, addr := range []string{"203.0.113.7:56324", "203.0.113.8:56325"} {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", nil)
+		local := &net.TCPAddr{IP: net.ParseIP("192.168.0.11"), Port: 80}
+		stdr = stdr.WithContext(stdctx.WithValue(stdr.Context(), http.LocalAddrContextKey, local))
+		stdr.RemoteAddr = addr
+		ctx := getCtx(stdr)
+		assert.Equal("", proxy.Handle(ctx))
+
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(addr, string(resp.RawPayload()))
+	}
+
+	spec := &ServerPoolSpec{
+		BaseServerPoolSpec: BaseServerPoolSpec{Servers: []*Server{{URL: svr.URL}}},
+		Protocol:           protocolH2C,
+		ProxyProtocol:      "v1",
+	}
+	assert.Error(spec.Validate())
+}
+
+func TestUnixSocketServer(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "app.sock")
+	l, err := net.Listen("unix", path)
+	assert.Nil(err)
+	svr := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host+r.URL.Path)
+	})}
+	go svr.Serve(l)
+	defer svr.Close()
+
+	host := unixSocketHost(path)
+	p, ok := unixSocketPath(host + ":80")
+	assert.True(ok)
+	assert.Equal(path, p)
+	_, ok = unixSocketPath("www.megaease.com:80")
+	assert.False(ok)
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: unix://`+path, assert)
+	defer proxy.Close()
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/api", nil)
+	ctx := getCtx(stdr)
+	assert.Equal("", proxy.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("www.megaease.com/api", string(resp.RawPayload()))
+
+	// the health checks connect to the socket too.
+	server := &Server{URL: "unix://" + path}
+	hc := NewHTTPHealthChecker(nil, &ProxyHealthCheckSpec{Type: "tcp"})
+	assert.True(hc.Check(server))
+	hc = NewHTTPHealthChecker(nil, &ProxyHealthCheckSpec{HTTPHealthCheckSpec: HTTPHealthCheckSpec{URI: "/healthz"}})
+	assert.True(hc.Check(server))
+}
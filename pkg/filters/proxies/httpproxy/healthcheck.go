@@ -19,15 +19,24 @@ package httpproxy
 
 import (
 	"bytes"
+	stdctx "context"
 	"crypto/tls"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
 	"github.com/megaease/easegress/v2/pkg/filters/proxies"
 	"github.com/megaease/easegress/v2/pkg/logger"
 )
@@ -36,12 +45,24 @@ const (
 	regexpType   = "regexp"
 	exactType    = "exact"
 	containsType = "contains"
+
+	healthCheckTypeHTTP = "http"
+	healthCheckTypeTCP  = "tcp"
+	healthCheckTypeGRPC = "grpc"
 )
 
 // ProxyHealthCheckSpec is the spec of http proxy health check.
 type ProxyHealthCheckSpec struct {
 	proxies.HealthCheckSpec `json:",inline"`
 	HTTPHealthCheckSpec     `json:",inline"`
+
+	// Type is the type of the probes, http by default. The tcp probes
+	// check whether the connections could be established, and the grpc
+	// probes use the gRPC health checking protocol.
+	Type string `json:"type,omitempty" jsonschema:"enum=,enum=http,enum=tcp,enum=grpc"`
+	// GRPCService is the service checked by the grpc probes, the overall
+	// health of the server is checked if it is empty.
+	GRPCService string `json:"grpcService,omitempty"`
 }
 
 // HTTPHealthCheckSpec is the spec of HTTP health check.
@@ -52,7 +73,7 @@ type HTTPHealthCheckSpec struct {
 	Headers  map[string]string `json:"headers,omitempty"`
 	Body     string            `json:"body,omitempty"`
 	Username string            `json:"username,omitempty"`
-	Password string            `json:"password,omitempty"`
+	Password string            `json:"password,omitempty" jsonschema:"writeOnly=true"`
 
 	Match *HealthCheckMatch `json:"match,omitempty"`
 }
@@ -200,6 +221,18 @@ func (spec *HTTPHealthCheckSpec) Validate() error {
 
 // Validate validates HealthCheckSpec.
 func (spec *ProxyHealthCheckSpec) Validate() error {
+	switch spec.Type {
+	case "", healthCheckTypeHTTP:
+	case healthCheckTypeTCP, healthCheckTypeGRPC:
+		if spec.URI != "" || spec.Path != "" || spec.Match != nil || spec.Body != "" {
+			return fmt.Errorf("uri, path, match and body are only supported by http health check")
+		}
+	default:
+		return fmt.Errorf("invalid health check type: %s", spec.Type)
+	}
+	if spec.GRPCService != "" && spec.Type != healthCheckTypeGRPC {
+		return fmt.Errorf("grpcService is only supported by grpc health check")
+	}
 	return spec.HTTPHealthCheckSpec.Validate()
 }
 
@@ -254,11 +287,18 @@ func (hc *httpHealthChecker) Check(server *proxies.Server) bool {
 // Close closes the health checker.
 func (hc *httpHealthChecker) Close() {}
 
-// NewHTTPHealthChecker creates a new HTTP health checker.
+// NewHTTPHealthChecker creates a new HTTP health checker, or a TCP/gRPC
+// health checker according to the type of the spec.
 func NewHTTPHealthChecker(tlsConfig *tls.Config, spec *ProxyHealthCheckSpec) proxies.HealthChecker {
 	if spec == nil {
 		return nil
 	}
+	switch spec.Type {
+	case healthCheckTypeTCP:
+		return &tcpHealthChecker{spec: spec}
+	case healthCheckTypeGRPC:
+		return &grpcHealthChecker{spec: spec, tlsConfig: tlsConfig}
+	}
 	if spec.Method == "" {
 		spec.Method = http.MethodGet
 	}
@@ -292,7 +332,8 @@ func NewHTTPHealthChecker(tlsConfig *tls.Config, spec *ProxyHealthCheckSpec) pro
 	transport := &http.Transport{
 		TLSClientConfig:   tlsConfig,
 		DisableKeepAlives: true,
-		Proxy:             http.ProxyFromEnvironment, // use proxy from environment variables
+		Proxy:             proxyFromEnvironment, // use proxy from environment variables
+		DialContext:       unixSocketDial((&net.Dialer{}).DialContext),
 	}
 	return &httpHealthChecker{
 		spec: spec,
@@ -304,6 +345,82 @@ func NewHTTPHealthChecker(tlsConfig *tls.Config, spec *ProxyHealthCheckSpec) pro
 	}
 }
 
+type tcpHealthChecker struct {
+	spec *ProxyHealthCheckSpec
+}
+
+// BaseSpec returns the base spec.
+func (hc *tcpHealthChecker) BaseSpec() proxies.HealthCheckSpec {
+	return hc.spec.HealthCheckSpec
+}
+
+// Check checks whether a connection to the server could be established.
+func (hc *tcpHealthChecker) Check(server *proxies.Server) bool {
+	network, addr := "tcp", getAddr(server, hc.spec.Port)
+	if path := server.UnixSocketPath(); path != "" {
+		network, addr = "unix", path
+	}
+	conn, err := net.DialTimeout(network, addr, hc.spec.GetTimeout())
+	if err != nil {
+		logger.Warnf("tcp health check %s failed: %v", addr, err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Close closes the health checker.
+func (hc *tcpHealthChecker) Close() {}
+
+type grpcHealthChecker struct {
+	spec      *ProxyHealthCheckSpec
+	tlsConfig *tls.Config
+}
+
+// BaseSpec returns the base spec.
+func (hc *grpcHealthChecker) BaseSpec() proxies.HealthCheckSpec {
+	return hc.spec.HealthCheckSpec
+}
+
+// Check checks the health of the server with the gRPC health checking
+// protocol, the server is healthy only if its status is SERVING.
+func (hc *grpcHealthChecker) Check(server *proxies.Server) bool {
+	addr := getAddr(server, hc.spec.Port)
+
+	creds := insecure.NewCredentials()
+	if strings.HasPrefix(server.URL, "https://") {
+		creds = credentials.NewTLS(hc.tlsConfig)
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		logger.Warnf("grpc health check %s failed: %v", addr, err)
+		return false
+	}
+	defer conn.Close()
+
+	ctx, cancel := stdctx.WithTimeout(stdctx.Background(), hc.spec.GetTimeout())
+	defer cancel()
+
+	for k, v := range hc.spec.Headers {
+		ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+	}
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{
+		Service: hc.spec.GRPCService,
+	})
+	if err != nil {
+		logger.Warnf("grpc health check %s failed: %v", addr, err)
+		return false
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		logger.Warnf("grpc health check %s failed: status is %s", addr, resp.Status)
+		return false
+	}
+	return true
+}
+
+// Close closes the health checker.
+func (hc *grpcHealthChecker) Close() {}
+
 // WSProxyHealthCheckSpec is the spec of ws proxy health check.
 type WSProxyHealthCheckSpec struct {
 	proxies.HealthCheckSpec `json:",inline"`
@@ -450,11 +567,34 @@ func NewWebSocketHealthChecker(spec *WSProxyHealthCheckSpec) proxies.HealthCheck
 	return res
 }
 
+// getAddr returns the host:port of the server, the port is replaced if it
+// is not zero.
+func getAddr(server *proxies.Server, port int) string {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		return server.URL
+	}
+
+	if port == 0 {
+		if p := u.Port(); p != "" {
+			return u.Host
+		}
+		port = 80
+		if u.Scheme == "https" || u.Scheme == "wss" {
+			port = 443
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+}
+
 func getURL(server *proxies.Server, uri *url.URL, port int, ws bool) string {
 	serverURL, err := url.Parse(server.URL)
 	if err != nil {
 		return server.URL
 	}
+	if path := server.UnixSocketPath(); path != "" {
+		serverURL = &url.URL{Scheme: "http", Host: unixSocketHost(path)}
+	}
 	target := &url.URL{}
 	if uri != nil {
 		target.Host = serverURL.Host
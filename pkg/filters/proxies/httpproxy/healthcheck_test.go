@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"sync/atomic"
 	"testing"
@@ -29,6 +30,9 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/megaease/easegress/v2/pkg/filters/proxies"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func TestHTTPHealthCheckSpec(t *testing.T) {
@@ -222,6 +226,15 @@ func TestHTTPHealthCheckSpec(t *testing.T) {
 		},
 	}
 	assert.Equal(t, expected, hc.spec, "default spec")
+
+	assert.Nil(t, (&ProxyHealthCheckSpec{Type: "tcp"}).Validate())
+	assert.Nil(t, (&ProxyHealthCheckSpec{Type: "grpc", GRPCService: "echo"}).Validate())
+	assert.NotNil(t, (&ProxyHealthCheckSpec{Type: "udp"}).Validate())
+	assert.NotNil(t, (&ProxyHealthCheckSpec{GRPCService: "echo"}).Validate())
+	assert.NotNil(t, (&ProxyHealthCheckSpec{
+		Type:                "tcp",
+		HTTPHealthCheckSpec: HTTPHealthCheckSpec{URI: "/healthz"},
+	}).Validate())
 }
 
 func startServer(port int, handler http.Handler, checkReq func() *http.Request) (*http.Server, error) {
@@ -628,3 +641,53 @@ func TestWebSocketHealthCheck(t *testing.T) {
 		assert.False(hc.Check(s))
 	}
 }
+
+func TestTCPHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	addr := l.Addr().(*net.TCPAddr)
+
+	spec := &ProxyHealthCheckSpec{Type: "tcp"}
+	hc := NewHTTPHealthChecker(nil, spec).(*tcpHealthChecker)
+	assert.True(hc.Check(&proxies.Server{URL: "http://" + addr.String()}))
+
+	// the port of the health check overrides the one of the server.
+	spec.Port = addr.Port
+	assert.True(hc.Check(&proxies.Server{URL: "http://127.0.0.1"}))
+
+	l.Close()
+	assert.False(hc.Check(&proxies.Server{URL: "http://127.0.0.1"}))
+}
+
+func TestGRPCHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	healthServer := health.NewServer()
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(l)
+	defer server.Stop()
+
+	healthServer.SetServingStatus("echo", healthpb.HealthCheckResponse_SERVING)
+	s := &proxies.Server{URL: "http://" + l.Addr().String()}
+
+	hc := NewHTTPHealthChecker(nil, &ProxyHealthCheckSpec{Type: "grpc"}).(*grpcHealthChecker)
+	assert.True(hc.Check(s))
+
+	hc = NewHTTPHealthChecker(nil, &ProxyHealthCheckSpec{Type: "grpc", GRPCService: "echo"}).(*grpcHealthChecker)
+	assert.True(hc.Check(s))
+
+	healthServer.SetServingStatus("echo", healthpb.HealthCheckResponse_NOT_SERVING)
+	assert.False(hc.Check(s))
+
+	hc = NewHTTPHealthChecker(nil, &ProxyHealthCheckSpec{Type: "grpc", GRPCService: "unknown"}).(*grpcHealthChecker)
+	assert.False(hc.Check(s))
+
+	server.Stop()
+	hc = NewHTTPHealthChecker(nil, &ProxyHealthCheckSpec{Type: "grpc"}).(*grpcHealthChecker)
+	assert.False(hc.Check(s))
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpproxy
+
+import (
+	stdcontext "context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencySamples is the number of recent latencies used to calculate
+	// the percentile.
+	latencySamples = 512
+
+	// latencyRefreshInterval is the interval to recalculate the percentile.
+	latencyRefreshInterval = time.Second
+
+	// minHedgingSamples is the min number of samples before hedging with a
+	// percentile delay, there's no hedging before that.
+	minHedgingSamples = 20
+)
+
+type (
+	// hedging sends a hedged request to another server if the response of
+	// the first request does not come back after the delay. The delay is
+	// fixed, or a percentile of the recent latencies.
+	hedging struct {
+		delay      time.Duration
+		percentile float64
+
+		lock        sync.Mutex
+		samples     []time.Duration
+		next        int
+		cached      time.Duration
+		refreshedAt time.Time
+	}
+
+	hedgingResult struct {
+		svr    *Server
+		stdReq *http.Request
+		resp   *http.Response
+		err    error
+		cancel stdcontext.CancelFunc
+		index  int
+	}
+)
+
+func newHedging(delay time.Duration, percentile float64) *hedging {
+	if delay <= 0 && percentile <= 0 {
+		return nil
+	}
+	return &hedging{delay: delay, percentile: percentile}
+}
+
+// record records the latency of a request.
+func (h *hedging) record(d time.Duration) {
+	if h.percentile <= 0 {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.samples) < latencySamples {
+		h.samples = append(h.samples, d)
+		return
+	}
+	h.samples[h.next] = d
+	h.next = (h.next + 1) % latencySamples
+}
+
+// getDelay returns the hedging delay, zero means no hedging.
+func (h *hedging) getDelay() time.Duration {
+	if h.percentile <= 0 {
+		return h.delay
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.samples) < minHedgingSamples {
+		return 0
+	}
+
+	now := time.Now()
+	if now.Sub(h.refreshedAt) < latencyRefreshInterval {
+		return h.cached
+	}
+
+	sorted := make([]time.Duration, len(h.samples))
+	copy(sorted, h.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(float64(len(sorted)) * h.percentile / 100)
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+
+	h.cached, h.refreshedAt = sorted[idx], now
+	return h.cached
+}
+
+// isIdempotent returns whether the method is idempotent as defined in
+// RFC 7231, only requests with idempotent methods are hedged.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// sendRequest sends the request to the server, and sends a hedged request
+// to another server if the response does not come back in time, without
+// cancelling the first one. The first successful response wins, and the
+// other request is cancelled.
+func (sp *ServerPool) sendRequest(stdctx stdcontext.Context, spCtx *serverPoolContext, svr *Server) (*Server, *http.Response, error) {
+	start := time.Now()
+
+	var delay time.Duration
+	if sp.hedging != nil && !spCtx.req.IsStream() && isIdempotent(spCtx.req.Method()) {
+		delay = sp.hedging.getDelay()
+	}
+	if delay <= 0 {
+		resp, err := sp.sendRequestTo(svr, spCtx.stdReq)
+		if err == nil && sp.hedging != nil {
+			sp.hedging.record(time.Since(start))
+		}
+		return svr, resp, err
+	}
+
+	results := make(chan *hedgingResult, 2)
+	var cancels []stdcontext.CancelFunc
+	send := func(svr *Server, stdReq *http.Request, cancel stdcontext.CancelFunc) {
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := sp.sendRequestTo(svr, stdReq)
+			results <- &hedgingResult{svr: svr, stdReq: stdReq, resp: resp, err: err, cancel: cancel, index: index}
+		}()
+	}
+
+	ctx, cancel := stdcontext.WithCancel(stdctx)
+	send(svr, spCtx.stdReq.WithContext(ctx), cancel)
+
+	pending := 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var winner *hedgingResult
+	for winner == nil && pending > 0 {
+		select {
+		case <-timer.C:
+			hedged := sp.LoadBalancer().ChooseServer(spCtx.req)
+			if hedged == nil {
+				continue
+			}
+			hctx := &serverPoolContext{req: spCtx.req, span: spCtx.span}
+			ctx, cancel := stdcontext.WithCancel(stdctx)
+			if err := hctx.prepareRequest(sp, hedged, ctx, false); err != nil {
+				cancel()
+				continue
+			}
+			spCtx.AddTag("hedged request sent")
+			pending++
+			send(hedged, hctx.stdReq, cancel)
+
+		case r := <-results:
+			pending--
+			if r.err == nil || pending == 0 {
+				winner = r
+			} else {
+				r.cancel()
+			}
+		}
+	}
+
+	// cancel the other request and discard its response, note the
+	// request of the winner must not be cancelled as its body is not
+	// read yet.
+	if pending > 0 {
+		for i, cancel := range cancels {
+			if i != winner.index {
+				cancel()
+			}
+		}
+		go func() {
+			r := <-results
+			if r.err == nil {
+				io.Copy(io.Discard, r.resp.Body)
+				r.resp.Body.Close()
+			}
+		}()
+	}
+
+	if winner.err == nil {
+		sp.hedging.record(time.Since(start))
+	}
+	spCtx.stdReq = winner.stdReq
+	return winner.svr, winner.resp, winner.err
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpproxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/resilience"
+)
+
+func TestHedgingDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(newHedging(0, 0))
+
+	h := newHedging(10*time.Millisecond, 0)
+	assert.Equal(10*time.Millisecond, h.getDelay())
+
+	h = newHedging(0, 90)
+	for i := 1; i < minHedgingSamples; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(time.Duration(0), h.getDelay())
+
+	for i := minHedgingSamples; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(91*time.Millisecond, h.getDelay())
+}
+
+func TestHedgedRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.1:9096
+  loadBalance:
+    policy: roundRobin
+  retryPolicy: retry
+`
+	proxy := newTestProxy(yamlConfig, assert)
+	policy, err := resilience.NewPolicy(map[string]interface{}{
+		"kind":         "Retry",
+		"name":         "retry",
+		"maxAttempts":  1,
+		"hedgingDelay": "10ms",
+	})
+	assert.NoError(err)
+	proxy.InjectResiliencePolicy(map[string]resilience.Policy{"retry": policy})
+
+	var cancelled int32
+	old := fnSendRequest
+	defer func() { fnSendRequest = old }()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		// the first server is slow.
+		if r.URL.Host == "127.0.0.1:9095" {
+			select {
+			case <-r.Context().Done():
+				atomic.StoreInt32(&cancelled, 1)
+				return nil, r.Context().Err()
+			case <-time.After(time.Second):
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"X-Server": []string{r.URL.Host}},
+			Body:       io.NopCloser(strings.NewReader("body")),
+		}, nil
+	}
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	ctx := getCtx(stdr)
+	assert.Equal("", proxy.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("127.0.0.1:9096", resp.Header().Get("X-Server"))
+
+	assert.Eventually(func() bool {
+		return atomic.LoadInt32(&cancelled) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// non-idempotent requests are not hedged.
+	stdr, _ = http.NewRequest(http.MethodPost, "http://127.0.0.1/", nil)
+	ctx = getCtx(stdr)
+	start := time.Now()
+	assert.Equal("", proxy.Handle(ctx))
+	assert.True(time.Since(start) >= time.Second)
+}
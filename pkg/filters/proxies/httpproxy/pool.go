@@ -19,11 +19,13 @@ package httpproxy
 
 import (
 	stdcontext "context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/textproto"
 	"strings"
+	"sync"
 	"time"
 
 	gohttpstat "github.com/tcnksm/go-httpstat"
@@ -35,6 +37,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpstat"
 	"github.com/megaease/easegress/v2/pkg/resilience"
 	"github.com/megaease/easegress/v2/pkg/tracing"
+	"github.com/megaease/easegress/v2/pkg/util/deadline"
 	"github.com/megaease/easegress/v2/pkg/util/fasttime"
 	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
 	"github.com/megaease/easegress/v2/pkg/util/readers"
@@ -137,9 +140,16 @@ func removeHopByHopHeaders(h http.Header) {
 
 func (spCtx *serverPoolContext) prepareRequest(pool *ServerPool, svr *Server, ctx stdcontext.Context, mirror bool) error {
 	req := spCtx.req
+	ctx = withConnStats(ctx, pool.connStats)
+	if pool.spec.ProxyProtocol != "" {
+		ctx = withClientAddrs(ctx, req.Std())
+	}
 
 	u := req.Std().URL
 	url := svr.URL + u.EscapedPath()
+	if path := svr.UnixSocketPath(); path != "" {
+		url = "http://" + unixSocketHost(path) + u.EscapedPath()
+	}
 	if rq := req.Std().URL.RawQuery; rq != "" {
 		url += "?" + rq
 	}
@@ -176,6 +186,10 @@ func (spCtx *serverPoolContext) prepareRequest(pool *ServerPool, svr *Server, ct
 		spCtx.span.InjectHTTP(stdr)
 	}
 
+	// the deadline of ctx includes the timeouts of the server pool and
+	// the current attempt.
+	deadline.Propagate(ctx, stdr.Header)
+
 	spCtx.stdReq = stdr
 	return nil
 }
@@ -197,6 +211,12 @@ type ServerPool struct {
 	memoryCache   *MemoryCache
 	metrics       *metrics
 	healthChecker proxies.HealthChecker
+	hedging       *hedging
+	connStats     *connStats
+
+	// client is the client of the pool if it uses a different protocol
+	// or connection pool than the proxy.
+	client *http.Client
 }
 
 // ServerPoolSpec is the spec for a server pool.
@@ -212,6 +232,25 @@ type ServerPoolSpec struct {
 	MemoryCache          *MemoryCacheSpec      `json:"memoryCache,omitempty"`
 	HealthCheck          *ProxyHealthCheckSpec `json:"healthCheck,omitempty"`
 
+	// Protocol is the protocol to talk to the servers, http1 by default,
+	// which upgrades to HTTP/2 if the server supports it by ALPN.
+	Protocol string     `json:"protocol,omitempty" jsonschema:"enum=,enum=http1,enum=http2,enum=h2c"`
+	HTTP2    *HTTP2Spec `json:"http2,omitempty"`
+
+	// ConnectionPool overrides the connection pool of the proxy.
+	ConnectionPool *ConnectionPoolSpec `json:"connectionPool,omitempty"`
+
+	// ProxyProtocol is the version of the PROXY protocol header sent to
+	// the servers, which carries the address of the client. No header is
+	// sent if it is empty.
+	ProxyProtocol string `json:"proxyProtocol,omitempty" jsonschema:"enum=,enum=v1,enum=v2"`
+
+	// BodyMode is the mode of handling the response bodies, buffer reads
+	// the bodies into memory and stream never does, serverMaxBodySize is
+	// the cap of the bodies in both modes. Bodies are buffered by default
+	// unless serverMaxBodySize is -1.
+	BodyMode string `json:"bodyMode,omitempty" jsonschema:"enum=,enum=buffer,enum=stream"`
+
 	// FailureCodes would be 5xx if it isn't assigned any value.
 	FailureCodes []int `json:"failureCodes,omitempty" jsonschema:"uniqueItems=true"`
 }
@@ -223,15 +262,50 @@ func (spec *ServerPoolSpec) Validate() error {
 	if spec.ServiceName != "" && spec.HealthCheck != nil {
 		return fmt.Errorf("serviceName and healthCheck can't be set at the same time")
 	}
+	if spec.HTTP2 != nil {
+		if spec.Protocol != protocolHTTP2 && spec.Protocol != protocolH2C {
+			return fmt.Errorf("http2 is only supported when protocol is http2 or h2c")
+		}
+		if err := spec.HTTP2.Validate(); err != nil {
+			return err
+		}
+	}
+	if spec.ConnectionPool != nil {
+		if err := spec.ConnectionPool.Validate(); err != nil {
+			return fmt.Errorf("connectionPool: %v", err)
+		}
+	}
+	if spec.ProxyProtocol != "" && (spec.Protocol == protocolHTTP2 || spec.Protocol == protocolH2C) {
+		return fmt.Errorf("proxyProtocol is not supported when protocol is http2 or h2c")
+	}
 	if spec.HealthCheck != nil {
 		return spec.HealthCheck.Validate()
 	}
 	return nil
 }
 
+// Validate validates HTTP2Spec.
+func (spec *HTTP2Spec) Validate() error {
+	if spec.ReadIdleTimeout != "" {
+		if _, err := time.ParseDuration(spec.ReadIdleTimeout); err != nil {
+			return fmt.Errorf("invalid readIdleTimeout %s: %v", spec.ReadIdleTimeout, err)
+		}
+	}
+	if spec.PingTimeout != "" {
+		if _, err := time.ParseDuration(spec.PingTimeout); err != nil {
+			return fmt.Errorf("invalid pingTimeout %s: %v", spec.PingTimeout, err)
+		}
+	}
+	return nil
+}
+
 // ServerPoolStatus is the status of Pool.
 type ServerPoolStatus struct {
-	Stat *httpstat.Status `json:"stat"`
+	Stat           *httpstat.Status                 `json:"stat"`
+	CircuitBreaker *resilience.CircuitBreakerStatus `json:"circuitBreaker,omitempty"`
+	ConnectionPool *ConnectionPoolStatus            `json:"connectionPool,omitempty"`
+	EjectedServers []string                         `json:"ejectedServers,omitempty"`
+	StickySession  *proxies.StickySessionStatus     `json:"stickySession,omitempty"`
 }
 
 // NewServerPool creates a new server pool according to spec.
@@ -268,10 +342,46 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 		sp.failureCodes[code] = struct{}{}
 	}
 
+	if spec.Protocol == protocolHTTP2 || spec.Protocol == protocolH2C || spec.ConnectionPool != nil || spec.ProxyProtocol != "" {
+		connectionPool := spec.ConnectionPool
+		if connectionPool == nil {
+			connectionPool = proxy.spec.ConnectionPool
+		}
+		sp.client = HTTPClient(tlsConfig, &HTTPClientSpec{
+			MaxIdleConns:        proxy.spec.MaxIdleConns,
+			MaxIdleConnsPerHost: proxy.spec.MaxIdleConnsPerHost,
+			MaxRedirection:      &proxy.spec.MaxRedirection,
+			Protocol:            spec.Protocol,
+			HTTP2:               spec.HTTP2,
+			ConnectionPool:      connectionPool,
+			ProxyProtocol:       proxyProtocolVersion(spec.ProxyProtocol),
+		}, 0)
+	}
+
 	sp.metrics = sp.newMetrics(name)
+	sp.connStats = &connStats{
+		onChange:  sp.exportConnectionMetrics,
+		onCreated: sp.metrics.CreatedConnections.Inc,
+	}
 	return sp
 }
 
+// httpClient returns the client to send requests to the servers.
+func (sp *ServerPool) httpClient() *http.Client {
+	if sp.client != nil {
+		return sp.client
+	}
+	return sp.proxy.client
+}
+
+// Close closes the server pool.
+func (sp *ServerPool) Close() {
+	sp.BaseServerPool.Close()
+	if sp.client != nil {
+		sp.client.CloseIdleConnections()
+	}
+}
+
 // CreateLoadBalancer creates a load balancer according to spec.
 func (sp *ServerPool) CreateLoadBalancer(spec *LoadBalanceSpec, servers []*Server) LoadBalancer {
 	lb := proxies.NewGeneralLoadBalancer(spec, servers)
@@ -280,7 +390,17 @@ func (sp *ServerPool) CreateLoadBalancer(spec *LoadBalanceSpec, servers []*Serve
 }
 
 func (sp *ServerPool) status() *ServerPoolStatus {
-	s := &ServerPoolStatus{Stat: sp.httpStat.Status()}
+	s := &ServerPoolStatus{
+		Stat:           sp.httpStat.Status(),
+		ConnectionPool: sp.connStats.status(),
+	}
+	if w, ok := sp.circuitBreakerWrapper.(resilience.CircuitBreakerWrapper); ok {
+		s.CircuitBreaker = w.Status()
+	}
+	if lb, ok := sp.LoadBalancer().(*proxies.GeneralLoadBalancer); ok {
+		s.EjectedServers = lb.EjectedServers()
+		s.StickySession = lb.StickySessionStatus()
+	}
 	return s
 }
 
@@ -297,6 +417,8 @@ func (sp *ServerPool) InjectResiliencePolicy(policies map[string]resilience.Poli
 			panic(fmt.Errorf("policy %s is not a retry policy", name))
 		}
 		sp.retryWrapper = policy.CreateWrapper()
+		delay, percentile, _ := policy.ParseHedgingDelay()
+		sp.hedging = newHedging(delay, percentile)
 	}
 
 	name = sp.spec.CircuitBreakerPolicy
@@ -366,7 +488,7 @@ func (sp *ServerPool) handleMirror(spCtx *serverPoolContext) {
 		return
 	}
 
-	resp, err := fnSendRequest(spCtx.stdReq, sp.proxy.client)
+	resp, err := fnSendRequest(spCtx.stdReq, sp.httpClient())
 	if err != nil {
 		return
 	}
@@ -398,7 +520,11 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 
 	// wrap the handler function to meet the requirement of resilience
 	// wrappers.
+	attempts := 0
 	handler := func(stdctx stdcontext.Context) error {
+		attempts++
+		ctx.SetData("HTTP_UPSTREAM_ATTEMPTS", attempts)
+
 		if sp.timeout > 0 {
 			var cancel stdcontext.CancelFunc
 			stdctx, cancel = stdcontext.WithTimeout(stdctx, sp.timeout)
@@ -432,7 +558,12 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 	}
 
 	// call the handler.
-	err := handler(spCtx.req.Context())
+	stdctx := spCtx.req.Context()
+	if !isIdempotent(spCtx.req.Method()) {
+		stdctx = resilience.WithNonIdempotent(stdctx)
+	}
+	err := handler(stdctx)
+	ctx.SetData("HTTP_UPSTREAM_DURATION", fasttime.Since(spCtx.startTime))
 	if err == nil {
 		return ""
 	}
@@ -459,7 +590,7 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 	panic(fmt.Errorf("should not reach here"))
 }
 
-func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolContext) error {
+func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolContext) (err error) {
 	svr := sp.LoadBalancer().ChooseServer(spCtx.req)
 
 	// if there's no available server.
@@ -468,6 +599,15 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 		return serverPoolError{http.StatusServiceUnavailable, resultInternalError}
 	}
 
+	// check the circuit breaker of the server if there is one.
+	done, err := resilience.EnterBackend(stdctx, svr.URL)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		done(err)
+	}()
+
 	// prepare the request to send.
 	statResult := &gohttpstat.Result{}
 	stdctx = gohttpstat.WithHTTPStat(stdctx, statResult)
@@ -476,7 +616,8 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 		return serverPoolError{http.StatusInternalServerError, resultInternalError}
 	}
 
-	resp, err := fnSendRequest(spCtx.stdReq, sp.proxy.client)
+	svr, resp, err := sp.sendRequest(stdctx, spCtx, svr)
+	spCtx.SetData("HTTP_UPSTREAM_ADDR", svr.URL)
 	if err != nil {
 		logger.Errorf("%s: failed to send request: %v", sp.Name, err)
 
@@ -485,6 +626,11 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 			return fmt.Sprintf("trace %v", statResult)
 		})
 
+		// the request body streamed from the client exceeds the limit.
+		if errors.Is(err, httpprot.ErrRequestEntityTooLarge) {
+			return serverPoolError{http.StatusRequestEntityTooLarge, resultClientError}
+		}
+
 		if err := spCtx.stdReq.Context().Err(); err == nil {
 			return serverPoolError{http.StatusServiceUnavailable, resultServerError}
 		} else if err == stdcontext.DeadlineExceeded {
@@ -519,6 +665,51 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 	return nil
 }
 
+// sendRequestTo sends the request to the server, and tracks the request
+// if the load balancer supports. The 5xx responses and the failures of
+// sending the request are reported as errors, except the cancellation by
+// the client.
+func (sp *ServerPool) sendRequestTo(svr *Server, stdReq *http.Request) (*http.Response, error) {
+	tracker, ok := sp.LoadBalancer().(proxies.RequestTracker)
+	if !ok {
+		return fnSendRequest(stdReq, sp.httpClient())
+	}
+
+	tracker.StartRequest(svr)
+	start := fasttime.Now()
+	resp, err := fnSendRequest(stdReq, sp.httpClient())
+	latency := fasttime.Since(start)
+
+	if err != nil {
+		if stdReq.Context().Err() != stdcontext.Canceled {
+			tracker.ReportResult(svr, true, latency)
+		}
+		tracker.EndRequest(svr)
+		return nil, err
+	}
+
+	tracker.ReportResult(svr, resp.StatusCode >= 500, latency)
+	// The body of an upgraded connection is also a writer, keep it as is.
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		tracker.EndRequest(svr)
+		return resp, nil
+	}
+	resp.Body = &requestEndBody{ReadCloser: resp.Body, end: func() { tracker.EndRequest(svr) }}
+	return resp, nil
+}
+
+// requestEndBody is a response body which ends the request on close.
+type requestEndBody struct {
+	io.ReadCloser
+	end       func()
+	closeOnce sync.Once
+}
+
+func (b *requestEndBody) Close() error {
+	b.closeOnce.Do(b.end)
+	return b.ReadCloser.Close()
+}
+
 func (sp *ServerPool) mergeResponseHeader(dst, src http.Header) http.Header {
 	for k, v := range src {
 		// CORS Headers
@@ -555,7 +746,12 @@ func (sp *ServerPool) buildResponse(spCtx *serverPoolContext) (err error) {
 	if maxBodySize == 0 {
 		maxBodySize = sp.proxy.spec.ServerMaxBodySize
 	}
-	if err = resp.FetchPayload(maxBodySize); err != nil {
+	bodyMode := sp.spec.BodyMode
+	// Server-Sent Events never end, so they are always streamed.
+	if resp.IsEventStream() {
+		bodyMode, maxBodySize = httpprot.BodyModeStream, -1
+	}
+	if err = fetchResponsePayload(resp, bodyMode, maxBodySize); err != nil {
 		logger.Errorf("%s: failed to fetch response payload: %v, please consider to set serverMaxBodySize of Proxy to -1.", sp.Name, err)
 		body.Close()
 		return err
@@ -584,6 +780,21 @@ func (sp *ServerPool) buildResponse(spCtx *serverPoolContext) (err error) {
 	return nil
 }
 
+// fetchResponsePayload initializes the payload of the response according
+// to the body mode, the max body size is optional in stream mode, and the
+// default one is used for a negative max body size in buffer mode.
+func fetchResponsePayload(resp *httpprot.Response, bodyMode string, maxBodySize int64) error {
+	switch bodyMode {
+	case httpprot.BodyModeStream:
+		return resp.StreamPayload(maxBodySize)
+	case httpprot.BodyModeBuffer:
+		if maxBodySize < 0 {
+			maxBodySize = 0
+		}
+	}
+	return resp.FetchPayload(maxBodySize)
+}
+
 func (sp *ServerPool) buildResponseFromCache(spCtx *serverPoolContext) bool {
 	if sp.memoryCache == nil {
 		return false
@@ -664,6 +875,11 @@ type (
 		ResponseBodySize           prometheus.ObserverVec
 		RequestBodySizePercentage  prometheus.ObserverVec
 		ResponseBodySizePercentage prometheus.ObserverVec
+
+		ActiveConnections  prometheus.Gauge
+		IdleConnections    prometheus.Gauge
+		CreatedConnections prometheus.Counter
+		ConnectionReuse    prometheus.Gauge
 	}
 )
 
@@ -713,9 +929,28 @@ func (sp *ServerPool) newMetrics(name string) *metrics {
 				Objectives: prometheushelper.DefaultObjectives(),
 			},
 			proxyLabels).MustCurryWith(commonLabels),
+		ActiveConnections: prometheushelper.NewGauge("proxy_active_connections",
+			"the count of connections to the servers serving requests",
+			proxyLabels[:5]).With(commonLabels),
+		IdleConnections: prometheushelper.NewGauge("proxy_idle_connections",
+			"the count of idle connections to the servers",
+			proxyLabels[:5]).With(commonLabels),
+		CreatedConnections: prometheushelper.NewCounter("proxy_created_connections",
+			"the total count of connections created to the servers",
+			proxyLabels[:5]).With(commonLabels),
+		ConnectionReuse: prometheushelper.NewGauge("proxy_connection_reuse_ratio",
+			"the ratio of requests sent over reused connections",
+			proxyLabels[:5]).With(commonLabels),
 	}
 }
 
+func (sp *ServerPool) exportConnectionMetrics(stats *connStats) {
+	s := stats.status()
+	sp.metrics.ActiveConnections.Set(float64(s.Active))
+	sp.metrics.IdleConnections.Set(float64(s.Idle))
+	sp.metrics.ConnectionReuse.Set(s.ReuseRatio)
+}
+
 func (sp *ServerPool) exportPrometheusMetrics(stat *httpstat.Metric) {
 	labels := prometheus.Labels{
 		"loadBalancePolicy": "",
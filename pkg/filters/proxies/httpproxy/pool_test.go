@@ -18,9 +18,16 @@
 package httpproxy
 
 import (
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/option"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
@@ -77,6 +84,149 @@ servers:
 	assert.NoError(spec.Validate())
 }
 
+func TestServerPoolProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &ServerPoolSpec{}
+	codectool.MustUnmarshal([]byte(`
+servers:
+- url: http://192.168.1.1
+http2:
+  pingTimeout: 1s
+`), spec)
+	assert.Error(spec.Validate())
+
+	spec.Protocol = protocolH2C
+	assert.NoError(spec.Validate())
+	spec.HTTP2.ReadIdleTimeout = "abc"
+	assert.Error(spec.Validate())
+
+	svr := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}), &http2.Server{}))
+	defer svr.Close()
+
+	spec = &ServerPoolSpec{}
+	codectool.MustUnmarshal([]byte(`
+protocol: h2c
+servers:
+- url: `+svr.URL), spec)
+	assert.NoError(spec.Validate())
+
+	p := kind.CreateInstance(kind.DefaultSpec()).(*Proxy)
+	p.super = supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	sp := NewServerPool(p, spec, "test")
+	defer sp.Close()
+	assert.NotNil(sp.client)
+
+	resp, err := sp.httpClient().Get(svr.URL)
+	assert.NoError(err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal("HTTP/2.0", string(body))
+}
+
+func TestServerPoolBodyMode(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+		// flush to send the response without the content length.
+		w.(http.Flusher).Flush()
+	}))
+	defer svr.Close()
+
+	newProxy := func(bodyMode string, maxBodySize int64) *Proxy {
+		return newTestProxy(fmt.Sprintf(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: %s
+  bodyMode: %q
+  serverMaxBodySize: %d
+`, svr.URL, bodyMode, maxBodySize), assert)
+	}
+
+	handle := func(p *Proxy, req *httpprot.Request) *httpprot.Response {
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		p.Handle(ctx)
+		return ctx.GetOutputResponse().(*httpprot.Response)
+	}
+
+	newRequest := func(body string) *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodPost, svr.URL, strings.NewReader(body))
+		stdr.ContentLength = -1
+		req, _ := httpprot.NewRequest(stdr)
+		return req
+	}
+
+	// the response is streamed, and limited by serverMaxBodySize.
+	p := newProxy(httpprot.BodyModeStream, 5)
+	req := newRequest("hello")
+	req.FetchPayload(0)
+	resp := handle(p, req)
+	assert.True(resp.IsStream())
+	data, err := io.ReadAll(resp.GetPayload())
+	assert.NoError(err)
+	assert.Equal("hello", string(data))
+	resp.Close()
+
+	req = newRequest("hello world")
+	req.FetchPayload(0)
+	resp = handle(p, req)
+	_, err = io.ReadAll(resp.GetPayload())
+	assert.Equal(httpprot.ErrResponseEntityTooLarge, err)
+	resp.Close()
+	p.Close()
+
+	// the response is buffered with the default limit.
+	p = newProxy(httpprot.BodyModeBuffer, -1)
+	req = newRequest("hello")
+	req.FetchPayload(0)
+	resp = handle(p, req)
+	assert.False(resp.IsStream())
+	assert.Equal("hello", string(resp.RawPayload()))
+	p.Close()
+
+	// the streamed request body exceeds the limit.
+	p = newProxy("", 0)
+	defer p.Close()
+	req = newRequest("hello world")
+	assert.NoError(req.StreamPayload(5))
+	resp = handle(p, req)
+	assert.Equal(http.StatusRequestEntityTooLarge, resp.StatusCode())
+}
+
+func TestServerPoolUpstreamData(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer svr.Close()
+
+	p := newTestProxy(fmt.Sprintf(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: %s
+`, svr.URL), assert)
+	defer p.Close()
+
+	stdr, _ := http.NewRequest(http.MethodGet, svr.URL, nil)
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+	p.Handle(ctx)
+
+	assert.Equal(svr.URL, ctx.GetData("HTTP_UPSTREAM_ADDR"))
+	assert.Equal(1, ctx.GetData("HTTP_UPSTREAM_ATTEMPTS"))
+	assert.NotNil(ctx.GetData("HTTP_UPSTREAM_DURATION"))
+}
+
 func TestInjectResilience(t *testing.T) {
 	assert := assert.New(t)
 
@@ -221,3 +371,44 @@ func TestInFailureCodes(t *testing.T) {
 	assert.False(sp.inFailureCodes(500))
 	assert.True(sp.inFailureCodes(400))
 }
+
+func TestOutlierDetection(t *testing.T) {
+	assert := assert.New(t)
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer good.Close()
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: `+bad.URL+`
+  - url: `+good.URL+`
+  loadBalance:
+    policy: roundRobin
+    outlierDetection:
+      consecutiveErrors: 1
+      baseEjectionTime: 1h
+`, assert)
+	defer proxy.Close()
+
+	codes := map[int]int{}
+	for i := 0; i < 10; i++ {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", nil)
+		ctx := getCtx(stdr)
+		proxy.Handle(ctx)
+		codes[ctx.GetOutputResponse().(*httpprot.Response).StatusCode()]++
+	}
+
+	// only the first request is sent to the bad server.
+	assert.Equal(1, codes[http.StatusInternalServerError])
+	assert.Equal(9, codes[http.StatusOK])
+	assert.Equal([]string{bad.URL}, proxy.Status().(*Status).MainPool.EjectedServers)
+}
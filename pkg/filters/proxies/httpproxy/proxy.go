@@ -28,6 +28,8 @@ import (
 	"net/http"
 	"time"
 
+	"golang.org/x/net/http2"
+
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters"
 	"github.com/megaease/easegress/v2/pkg/filters/proxies"
@@ -49,6 +51,11 @@ const (
 	// result for resilience
 	resultTimeout        = "timeout"
 	resultShortCircuited = "shortCircuited"
+
+	// protocols to talk to the servers.
+	protocolHTTP1 = "http1"
+	protocolHTTP2 = "http2"
+	protocolH2C   = "h2c"
 )
 
 var kind = &filters.Kind{
@@ -114,8 +121,11 @@ type (
 		MTLS                *MTLS             `json:"mtls,omitempty"`
 		MaxIdleConns        int               `json:"maxIdleConns,omitempty"`
 		MaxIdleConnsPerHost int               `json:"maxIdleConnsPerHost,omitempty"`
-		MaxRedirection      int               `json:"maxRedirection,omitempty"`
-		ServerMaxBodySize   int64             `json:"serverMaxBodySize,omitempty"`
+		// ConnectionPool is the default spec of the connections to the
+		// servers of the pools.
+		ConnectionPool    *ConnectionPoolSpec `json:"connectionPool,omitempty"`
+		MaxRedirection    int                 `json:"maxRedirection,omitempty"`
+		ServerMaxBodySize int64               `json:"serverMaxBodySize,omitempty"`
 	}
 
 	// Status is the status of Proxy.
@@ -128,7 +138,7 @@ type (
 	// MTLS is the configuration for client side mTLS.
 	MTLS struct {
 		CertBase64         string `json:"certBase64" jsonschema:"required,format=base64"`
-		KeyBase64          string `json:"keyBase64" jsonschema:"required,format=base64"`
+		KeyBase64          string `json:"keyBase64" jsonschema:"required,format=base64,writeOnly=true"`
 		RootCertBase64     string `json:"rootCertBase64" jsonschema:"required,format=base64"`
 		InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
 	}
@@ -138,6 +148,26 @@ type (
 		MaxIdleConns        int
 		MaxIdleConnsPerHost int
 		MaxRedirection      *int
+		Protocol            string
+		HTTP2               *HTTP2Spec
+		ConnectionPool      *ConnectionPoolSpec
+		// ProxyProtocol is the version of the PROXY protocol header sent
+		// on the connections, no header is sent if it is zero.
+		ProxyProtocol int
+	}
+
+	// HTTP2Spec is the spec of the HTTP/2 connections to the servers.
+	HTTP2Spec struct {
+		// ReadIdleTimeout is the timeout after which a health check using
+		// ping frame is carried out if no frame is received on a connection.
+		ReadIdleTimeout string `json:"readIdleTimeout,omitempty" jsonschema:"format=duration"`
+		// PingTimeout is the timeout after which a connection is closed if
+		// a response to ping is not received.
+		PingTimeout string `json:"pingTimeout,omitempty" jsonschema:"format=duration"`
+		// StrictMaxConcurrentStreams makes the requests wait for the streams
+		// of a connection, instead of opening new connections, when the limit
+		// of concurrent streams of the server is reached.
+		StrictMaxConcurrentStreams bool `json:"strictMaxConcurrentStreams,omitempty"`
 	}
 
 	// Server is the backend server.
@@ -170,6 +200,12 @@ func (s *Spec) Validate() error {
 		return fmt.Errorf("one and only one mainPool is required")
 	}
 
+	if s.ConnectionPool != nil {
+		if err := s.ConnectionPool.Validate(); err != nil {
+			return fmt.Errorf("connectionPool: %v", err)
+		}
+	}
+
 	if s.MirrorPool != nil {
 		if s.MirrorPool.Filter == nil {
 			return fmt.Errorf("filter of mirrorPool is required")
@@ -182,30 +218,88 @@ func (s *Spec) Validate() error {
 	return nil
 }
 
+// http2Transport creates the transport of HTTP/2, connections are multiplexed
+// by the requests to the same server.
+func http2Transport(tlsCfg *tls.Config, spec *HTTPClientSpec, dialFunc func(stdctx.Context, string, string) (net.Conn, error)) *http2.Transport {
+	t := &http2.Transport{
+		TLSClientConfig: tlsCfg,
+	}
+
+	// h2c uses HTTP/2 with prior knowledge over plain TCP connections.
+	if spec.Protocol == protocolH2C {
+		t.AllowHTTP = true
+		t.DialTLSContext = func(ctx stdctx.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialFunc(ctx, network, addr)
+		}
+	} else {
+		t.DialTLSContext = func(ctx stdctx.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			conn, err := dialFunc(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			tlsConn := tls.Client(conn, cfg)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		}
+	}
+
+	if spec.HTTP2 != nil {
+		t.ReadIdleTimeout, _ = time.ParseDuration(spec.HTTP2.ReadIdleTimeout)
+		t.PingTimeout, _ = time.ParseDuration(spec.HTTP2.PingTimeout)
+		t.StrictMaxConcurrentStreams = spec.HTTP2.StrictMaxConcurrentStreams
+	}
+	return t
+}
+
 func HTTPClient(tlsCfg *tls.Config, spec *HTTPClientSpec, timeout time.Duration) *http.Client {
-	dialFunc := func(ctx stdctx.Context, network, addr string) (net.Conn, error) {
-		return (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 60 * time.Second,
-		}).DialContext(ctx, network, addr)
+	dialFunc := unixSocketDial(spec.ConnectionPool.dialer().DialContext)
+	if spec.ProxyProtocol != 0 {
+		dialFunc = proxyProtocolDial(dialFunc, spec.ProxyProtocol)
 	}
+	dialFunc = trackDial(dialFunc)
 
-	client := &http.Client{
-		// NOTE: Timeout could be no limit, real client or server could cancel it.
-		Timeout: timeout,
-		Transport: &http.Transport{
-			Proxy:              http.ProxyFromEnvironment,
+	maxIdleConns, maxIdleConnsPerHost, maxConnsPerHost := spec.MaxIdleConns, spec.MaxIdleConnsPerHost, 0
+	if cp := spec.ConnectionPool; cp != nil {
+		if cp.MaxIdleConns > 0 {
+			maxIdleConns = cp.MaxIdleConns
+		}
+		if cp.MaxIdleConnsPerHost > 0 {
+			maxIdleConnsPerHost = cp.MaxIdleConnsPerHost
+		}
+		maxConnsPerHost = cp.MaxConnsPerHost
+	}
+
+	var transport http.RoundTripper
+	switch spec.Protocol {
+	case protocolHTTP2, protocolH2C:
+		transport = http2Transport(tlsCfg, spec, dialFunc)
+	default:
+		transport = &http.Transport{
+			Proxy:              proxyFromEnvironment,
 			DialContext:        dialFunc,
 			TLSClientConfig:    tlsCfg,
 			DisableCompression: false,
 			// NOTE: The large number of Idle Connections can
 			// reduce overhead of building connections.
-			MaxIdleConns:          spec.MaxIdleConns,
-			MaxIdleConnsPerHost:   spec.MaxIdleConnsPerHost,
-			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:        maxIdleConns,
+			MaxIdleConnsPerHost: maxIdleConnsPerHost,
+			MaxConnsPerHost:     maxConnsPerHost,
+			IdleConnTimeout:     spec.ConnectionPool.idleConnTimeout(),
+			// the PROXY header carries the address of one client, so the
+			// connections can't be shared by the clients.
+			DisableKeepAlives:     spec.ProxyProtocol != 0,
 			TLSHandshakeTimeout:   10 * time.Second,
 			ExpectContinueTimeout: 1 * time.Second,
-		},
+		}
+	}
+
+	client := &http.Client{
+		// NOTE: Timeout could be no limit, real client or server could cancel it.
+		Timeout:   timeout,
+		Transport: &trackedTransport{RoundTripper: transport},
 	}
 	if spec.MaxRedirection != nil {
 		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
@@ -305,6 +399,7 @@ func (p *Proxy) reload() {
 		MaxIdleConns:        p.spec.MaxIdleConns,
 		MaxIdleConnsPerHost: p.spec.MaxIdleConnsPerHost,
 		MaxRedirection:      &p.spec.MaxRedirection,
+		ConnectionPool:      p.spec.ConnectionPool,
 	}
 	p.client = HTTPClient(tlsCfg, clientSpec, 0)
 }
@@ -24,6 +24,11 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"nhooyr.io/websocket"
 
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters/proxies"
@@ -31,7 +36,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpstat"
 	"github.com/megaease/easegress/v2/pkg/util/fasttime"
-	"nhooyr.io/websocket"
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
 )
 
 // WebSocketServerPool defines a server pool.
@@ -43,6 +48,8 @@ type WebSocketServerPool struct {
 	spec          *WebSocketServerPoolSpec
 	httpStat      *httpstat.HTTPStat
 	healthChecker proxies.HealthChecker
+	idleTimeout   time.Duration
+	metrics       *wsMetrics
 }
 
 // WebSocketServerPoolSpec is the spec for a server pool.
@@ -53,10 +60,26 @@ type WebSocketServerPoolSpec struct {
 	Filter             *RequestMatcherSpec `json:"filter,omitempty"`
 	InsecureSkipVerify bool                `json:"insecureSkipVerify,omitempty"`
 	OriginPatterns     []string            `json:"originPatterns,omitempty"`
+	// IdleTimeout closes the connections if no message is transferred in
+	// either direction in the duration.
+	IdleTimeout string `json:"idleTimeout,omitempty" jsonschema:"format=duration"`
 
 	HealthCheck *WSProxyHealthCheckSpec `json:"healthCheck,omitempty"`
 }
 
+// Validate validates WebSocketServerPoolSpec.
+func (spec *WebSocketServerPoolSpec) Validate() error {
+	if err := spec.BaseServerPoolSpec.Validate(); err != nil {
+		return err
+	}
+	if spec.IdleTimeout != "" {
+		if _, err := time.ParseDuration(spec.IdleTimeout); err != nil {
+			return fmt.Errorf("invalid idleTimeout %s: %v", spec.IdleTimeout, err)
+		}
+	}
+	return nil
+}
+
 // NewWebSocketServerPool creates a new server pool according to spec.
 func NewWebSocketServerPool(proxy *WebSocketProxy, spec *WebSocketServerPoolSpec, name string) *WebSocketServerPool {
 	sp := &WebSocketServerPool{
@@ -69,6 +92,10 @@ func NewWebSocketServerPool(proxy *WebSocketProxy, spec *WebSocketServerPoolSpec
 		sp.filter = NewRequestMatcher(spec.Filter)
 	}
 	sp.Init(sp, proxy.super, name, &spec.BaseServerPoolSpec)
+	if spec.IdleTimeout != "" {
+		sp.idleTimeout, _ = time.ParseDuration(spec.IdleTimeout)
+	}
+	sp.metrics = sp.newMetrics(name)
 	return sp
 }
 
@@ -239,6 +266,19 @@ func (sp *WebSocketServerPool) handle(ctx *context.Context) (result string) {
 		return resultServerError
 	}
 
+	sp.metrics.TotalConnections.With(nil).Inc()
+	sp.metrics.ActiveConnections.With(nil).Inc()
+	defer func() {
+		sp.metrics.ActiveConnections.With(nil).Dec()
+		sp.metrics.ConnectionDuration.With(nil).Observe(fasttime.Since(startTime).Seconds())
+	}()
+	clientMessages := sp.metrics.TotalMessages.With(prometheus.Labels{"direction": "client"})
+	serverMessages := sp.metrics.TotalMessages.With(prometheus.Labels{"direction": "server"})
+
+	// lastActive is the unix nano time of the last transferred message.
+	var lastActive atomic.Int64
+	lastActive.Store(fasttime.Now().UnixNano())
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 
@@ -269,6 +309,8 @@ func (sp *WebSocketServerPool) handle(ctx *context.Context) (result string) {
 				break
 			}
 			metric.ReqSize += uint64(len(m))
+			clientMessages.Inc()
+			lastActive.Store(fasttime.Now().UnixNano())
 		}
 	}()
 
@@ -297,16 +339,36 @@ func (sp *WebSocketServerPool) handle(ctx *context.Context) (result string) {
 				break
 			}
 			metric.RespSize += uint64(len(m))
+			serverMessages.Inc()
+			lastActive.Store(fasttime.Now().UnixNano())
 		}
 	}()
 
 	go func() {
-		select {
-		case <-stop:
-		case <-sp.Done():
+		var idle <-chan time.Time
+		if sp.idleTimeout > 0 {
+			ticker := time.NewTicker(sp.idleTimeout / 2)
+			defer ticker.Stop()
+			idle = ticker.C
+		}
+
+		for {
+			select {
+			case <-stop:
+			case <-sp.Done():
+			case <-idle:
+				if fasttime.Since(time.Unix(0, lastActive.Load())) < sp.idleTimeout {
+					continue
+				}
+				logger.Debugf("%s: close idle connection from %s", sp.Name, req.RealIP())
+				svrConn.Close(websocket.StatusGoingAway, "idle timeout")
+				clntConn.Close(websocket.StatusGoingAway, "idle timeout")
+				return
+			}
+			svrConn.Close(websocket.StatusBadGateway, "")
+			clntConn.Close(websocket.StatusBadGateway, "")
+			return
 		}
-		svrConn.Close(websocket.StatusBadGateway, "")
-		clntConn.Close(websocket.StatusBadGateway, "")
 	}()
 
 	wg.Wait()
@@ -323,3 +385,46 @@ func (sp *WebSocketServerPool) status() *ServerPoolStatus {
 		Stat: sp.httpStat.Status(),
 	}
 }
+
+type wsMetrics struct {
+	TotalConnections   *prometheus.CounterVec
+	ActiveConnections  *prometheus.GaugeVec
+	TotalMessages      *prometheus.CounterVec
+	ConnectionDuration prometheus.ObserverVec
+}
+
+// newMetrics creates the metrics of the WebSocket connections.
+func (sp *WebSocketServerPool) newMetrics(name string) *wsMetrics {
+	commonLabels := prometheus.Labels{
+		"proxyName":    name,
+		"kind":         WebSocketProxyKind,
+		"clusterName":  "",
+		"clusterRole":  "",
+		"instanceName": "",
+	}
+	if super := sp.proxy.super; super != nil {
+		commonLabels["clusterName"] = super.Options().ClusterName
+		commonLabels["clusterRole"] = super.Options().ClusterRole
+		commonLabels["instanceName"] = super.Options().Name
+	}
+
+	labels := []string{"clusterName", "clusterRole", "instanceName", "proxyName", "kind"}
+	return &wsMetrics{
+		TotalConnections: prometheushelper.NewCounter("websocketproxy_total_connections",
+			"the total count of WebSocket connections",
+			labels).MustCurryWith(commonLabels),
+		ActiveConnections: prometheushelper.NewGauge("websocketproxy_active_connections",
+			"the count of active WebSocket connections",
+			labels).MustCurryWith(commonLabels),
+		TotalMessages: prometheushelper.NewCounter("websocketproxy_total_messages",
+			"the total count of WebSocket messages, direction is the sender of the messages",
+			append(labels, "direction")).MustCurryWith(commonLabels),
+		ConnectionDuration: prometheushelper.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "websocketproxy_connection_duration",
+				Help:    "a histogram of the duration of WebSocket connections in seconds.",
+				Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+			},
+			labels).MustCurryWith(commonLabels),
+	}
+}
@@ -18,12 +18,17 @@
 package httpproxy
 
 import (
+	stdctx "context"
 	"crypto/tls"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
 	"github.com/stretchr/testify/assert"
+	"nhooyr.io/websocket"
 )
 
 func TestDialServer(t *testing.T) {
@@ -72,3 +77,59 @@ func TestDialServer(t *testing.T) {
 	_, _, err = sp.dialServer(svr, req)
 	assert.Error(err)
 }
+
+func TestWebSocketIdleTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		for {
+			typ, m, err := conn.Read(stdctx.Background())
+			if err != nil {
+				return
+			}
+			conn.Write(stdctx.Background(), typ, m)
+		}
+	}))
+	defer backend.Close()
+
+	proxy := newTestWebSocketProxy(`
+name: wsproxy
+kind: WebSocketProxy
+pools:
+- servers:
+  - url: `+backend.URL+`
+  idleTimeout: 100ms
+`, assert)
+	defer proxy.Close()
+
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := getCtx(r)
+		ctx.SetData("HTTP_RESPONSE_WRITER", w)
+		proxy.Handle(ctx)
+	}))
+	defer frontend.Close()
+
+	u := "ws" + strings.TrimPrefix(frontend.URL, "http")
+	conn, _, err := websocket.Dial(stdctx.Background(), u, nil)
+	assert.NoError(err)
+	defer conn.CloseNow()
+
+	assert.NoError(conn.Write(stdctx.Background(), websocket.MessageText, []byte("hello")))
+	_, m, err := conn.Read(stdctx.Background())
+	assert.NoError(err)
+	assert.Equal("hello", string(m))
+
+	ctx, cancel := stdctx.WithTimeout(stdctx.Background(), 3*time.Second)
+	defer cancel()
+	_, _, err = conn.Read(ctx)
+	assert.Equal(websocket.StatusGoingAway, websocket.CloseStatus(err))
+
+	spec := &WebSocketServerPoolSpec{IdleTimeout: "abc"}
+	spec.ServiceName = "demo"
+	assert.Error(spec.Validate())
+}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"hash/fnv"
 	"math/rand"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -42,6 +44,19 @@ const (
 	// LoadBalancePolicyCookieHash is the load balance policy of HTTP cookie hash,
 	// which is the shorthand of headerHash with hash key Set-Cookie.
 	LoadBalancePolicyCookieHash = "cookieHash"
+	// LoadBalancePolicyLeastConnections is the load balance policy of
+	// choosing the server with less in-flight requests from two random ones.
+	LoadBalancePolicyLeastConnections = "leastConnections"
+	// LoadBalancePolicyEWMA is the load balance policy of choosing the
+	// server with lower latency and less in-flight requests from two random
+	// ones.
+	LoadBalancePolicyEWMA = "ewma"
+	// LoadBalancePolicyRingHash is the load balance policy of consistent
+	// hash with a hash ring.
+	LoadBalancePolicyRingHash = "ringHash"
+	// LoadBalancePolicyMaglev is the load balance policy of consistent hash
+	// with a Maglev lookup table.
+	LoadBalancePolicyMaglev = "maglev"
 )
 
 // LoadBalancer is the interface of a load balancer.
@@ -51,6 +66,18 @@ type LoadBalancer interface {
 	Close()
 }
 
+// RequestTracker is the interface of load balancers which track the
+// requests sent to the servers.
+type RequestTracker interface {
+	// StartRequest is called before sending a request to the server, and
+	// EndRequest is called once the request completes.
+	StartRequest(server *Server)
+	EndRequest(server *Server)
+	// ReportResult reports the result of a request once its response is
+	// received or it fails, latency is the time to receive the response.
+	ReportResult(server *Server, failed bool, latency time.Duration)
+}
+
 // LoadBalanceSpec is the spec to create a load balancer.
 //
 // TODO: this spec currently include all options for all load balance policies,
@@ -64,6 +91,12 @@ type LoadBalanceSpec struct {
 	// Deprecated: HealthCheck is protocol related. It should be moved to protocol spec.
 	// This one is kept for backward compatibility.
 	HealthCheck *HealthCheckSpec `json:"healthCheck,omitempty"`
+	// OutlierDetection ejects the servers according to the results of
+	// the requests sent to them.
+	OutlierDetection *OutlierDetectionSpec `json:"outlierDetection,omitempty"`
+	// SlowStart ramps up the traffic share of the servers gradually once
+	// they are added or become healthy again.
+	SlowStart *SlowStartSpec `json:"slowStart,omitempty"`
 }
 
 // LoadBalancePolicy is the interface of a load balance policy.
@@ -83,6 +116,11 @@ type GeneralLoadBalancer struct {
 	ss     SessionSticker
 	hc     HealthChecker
 	hcSpec *HealthCheckSpec
+	od     *outlierDetector
+	slow   *slowStart
+
+	// lock protects the health status of the servers.
+	lock sync.Mutex
 }
 
 // NewGeneralLoadBalancer creates a new GeneralLoadBalancer.
@@ -116,6 +154,14 @@ func (glb *GeneralLoadBalancer) Init(
 			lbp = &HeaderHashLoadBalancePolicy{spec: glb.spec}
 		case LoadBalancePolicyCookieHash:
 			lbp = &HeaderHashLoadBalancePolicy{spec: &LoadBalanceSpec{HeaderHashKey: "Cookie"}}
+		case LoadBalancePolicyLeastConnections:
+			lbp = &LeastConnectionsLoadBalancePolicy{}
+		case LoadBalancePolicyEWMA:
+			lbp = &EWMALoadBalancePolicy{}
+		case LoadBalancePolicyRingHash:
+			lbp = &RingHashLoadBalancePolicy{spec: glb.spec}
+		case LoadBalancePolicyMaglev:
+			lbp = &MaglevLoadBalancePolicy{spec: glb.spec}
 		default:
 			logger.Errorf("unsupported load balancing policy: %s", glb.spec.Policy)
 			lbp = &RoundRobinLoadBalancePolicy{}
@@ -130,6 +176,14 @@ func (glb *GeneralLoadBalancer) Init(
 		glb.ss = ss
 	}
 
+	if glb.spec.SlowStart != nil {
+		glb.slow = newSlowStart(glb.spec.SlowStart)
+	}
+
+	if glb.spec.OutlierDetection != nil {
+		glb.od = newOutlierDetector(glb.spec.OutlierDetection, glb.servers, glb.updateHealthyServers)
+	}
+
 	if hc == nil {
 		return
 	}
@@ -161,12 +215,15 @@ func (glb *GeneralLoadBalancer) Init(
 }
 
 func (glb *GeneralLoadBalancer) checkServers() {
-	changed := false
+	results := make([]bool, len(glb.servers))
+	for i, svr := range glb.servers {
+		results[i] = glb.hc.Check(svr)
+	}
 
-	servers := make([]*Server, 0, len(glb.servers))
-	for _, svr := range glb.servers {
-		succ := glb.hc.Check(svr)
-		if succ {
+	glb.lock.Lock()
+	changed := false
+	for i, svr := range glb.servers {
+		if results[i] {
 			if svr.HealthCounter < 0 {
 				svr.HealthCounter = 0
 			}
@@ -174,6 +231,7 @@ func (glb *GeneralLoadBalancer) checkServers() {
 			if svr.Unhealth && svr.HealthCounter >= glb.hcSpec.Passes {
 				logger.Warnf("server:%v becomes healthy.", svr.ID())
 				svr.Unhealth = false
+				svr.startWarmup(time.Now())
 				changed = true
 			}
 		} else {
@@ -187,14 +245,30 @@ func (glb *GeneralLoadBalancer) checkServers() {
 				changed = true
 			}
 		}
+	}
+	glb.lock.Unlock()
 
-		if svr.Healthy() {
-			servers = append(servers, svr)
-		}
+	if changed {
+		glb.updateHealthyServers()
 	}
+}
 
-	if !changed {
-		return
+// updateHealthyServers updates the healthy servers, which are the servers
+// passing the health check and not ejected by the outlier detection.
+func (glb *GeneralLoadBalancer) updateHealthyServers() {
+	var ejected map[*Server]bool
+	if glb.od != nil {
+		ejected = glb.od.ejectedServers()
+	}
+
+	glb.lock.Lock()
+	defer glb.lock.Unlock()
+
+	servers := make([]*Server, 0, len(glb.servers))
+	for _, svr := range glb.servers {
+		if svr.Healthy() && !ejected[svr] {
+			servers = append(servers, svr)
+		}
 	}
 
 	glb.healthyServers.Store(newServerGroup(servers))
@@ -203,6 +277,48 @@ func (glb *GeneralLoadBalancer) checkServers() {
 	}
 }
 
+// StartRequest marks the start of a request sent to the server.
+func (glb *GeneralLoadBalancer) StartRequest(server *Server) {
+	server.activeRequests.Add(1)
+}
+
+// EndRequest marks the end of a request sent to the server.
+func (glb *GeneralLoadBalancer) EndRequest(server *Server) {
+	server.activeRequests.Add(-1)
+}
+
+// ReportResult reports the result of a request sent to the server, which
+// is used by the outlier detection and the latency based policies.
+func (glb *GeneralLoadBalancer) ReportResult(server *Server, failed bool, latency time.Duration) {
+	server.recordLatency(latency)
+	if glb.od != nil {
+		glb.od.report(server, failed, latency)
+	}
+}
+
+// StickySessionStatus returns the status of the sticky session, nil if it
+// has no status.
+func (glb *GeneralLoadBalancer) StickySessionStatus() *StickySessionStatus {
+	if s, ok := glb.ss.(interface{ Status() *StickySessionStatus }); ok {
+		return s.Status()
+	}
+	return nil
+}
+
+// EjectedServers returns the servers ejected by the outlier detection.
+func (glb *GeneralLoadBalancer) EjectedServers() []string {
+	if glb.od == nil {
+		return nil
+	}
+
+	var servers []string
+	for svr := range glb.od.ejectedServers() {
+		servers = append(servers, svr.ID())
+	}
+	sort.Strings(servers)
+	return servers
+}
+
 // ChooseServer chooses a server according to the load balancing spec.
 func (glb *GeneralLoadBalancer) ChooseServer(req protocols.Request) *Server {
 	sg := glb.healthyServers.Load()
@@ -216,7 +332,18 @@ func (glb *GeneralLoadBalancer) ChooseServer(req protocols.Request) *Server {
 		}
 	}
 
-	return glb.lbp.ChooseServer(req, sg)
+	svr := glb.lbp.ChooseServer(req, sg)
+	if glb.slow == nil {
+		return svr
+	}
+
+	// the servers warming up reject some requests, choose another server
+	// in this case, but at most a few times.
+	now := time.Now()
+	for i := 0; i < slowStartRetries && !glb.slow.accept(svr, now); i++ {
+		svr = glb.lbp.ChooseServer(req, sg)
+	}
+	return svr
 }
 
 // ReturnServer returns a server to the load balancer.
@@ -235,6 +362,9 @@ func (glb *GeneralLoadBalancer) Close() {
 	if glb.ss != nil {
 		glb.ss.Close()
 	}
+	if glb.od != nil {
+		glb.od.close()
+	}
 }
 
 // RandomLoadBalancePolicy is a load balance policy that chooses a server randomly.
@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxies
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/spaolacci/murmur3"
+
+	"github.com/megaease/easegress/v2/pkg/protocols"
+)
+
+const (
+	// ringHashReplicas is the number of virtual nodes of a server on the
+	// hash ring, it is scaled by weight/100 if the servers have weights.
+	ringHashReplicas = 160
+	// maglevTableSize is the size of the Maglev lookup table, which must
+	// be a prime.
+	maglevTableSize = 65537
+)
+
+// pickTwo picks two different servers randomly, the two servers are the
+// same one if there's only one server.
+func pickTwo(sg *ServerGroup) (*Server, *Server) {
+	n := len(sg.Servers)
+	if n == 1 {
+		return sg.Servers[0], sg.Servers[0]
+	}
+	i := rand.Intn(n)
+	j := rand.Intn(n - 1)
+	if j >= i {
+		j++
+	}
+	return sg.Servers[i], sg.Servers[j]
+}
+
+// LeastConnectionsLoadBalancePolicy is a load balance policy that chooses
+// the server with less in-flight requests from two random servers.
+type LeastConnectionsLoadBalancePolicy struct{}
+
+// ChooseServer chooses a server by the power of two choices.
+func (lbp *LeastConnectionsLoadBalancePolicy) ChooseServer(req protocols.Request, sg *ServerGroup) *Server {
+	a, b := pickTwo(sg)
+	ca, cb := a.activeRequests.Load(), b.activeRequests.Load()
+
+	// compare the in-flight requests per weight.
+	if sg.TotalWeight > 0 {
+		ca, cb = ca*int64(b.Weight), cb*int64(a.Weight)
+	}
+	if cb < ca {
+		return b
+	}
+	return a
+}
+
+// EWMALoadBalancePolicy is a load balance policy that chooses the server
+// with lower cost from two random servers, the cost is the moving average
+// of the latency multiplied by the number of in-flight requests plus one.
+type EWMALoadBalancePolicy struct{}
+
+// ChooseServer chooses a server by the power of two choices.
+func (lbp *EWMALoadBalancePolicy) ChooseServer(req protocols.Request, sg *ServerGroup) *Server {
+	a, b := pickTwo(sg)
+	cost := func(s *Server) float64 {
+		c := float64(s.latencyEWMA.Load()) * float64(s.activeRequests.Load()+1)
+		if sg.TotalWeight > 0 {
+			c /= float64(s.Weight)
+		}
+		return c
+	}
+	if cost(b) < cost(a) {
+		return b
+	}
+	return a
+}
+
+// hashKey returns the key to calculate the hash of the request, which is
+// the value of the header if headerHashKey is set, or the client IP.
+func hashKey(spec *LoadBalanceSpec, req protocols.Request) string {
+	if spec.HeaderHashKey != "" {
+		if v, ok := req.Header().Get(spec.HeaderHashKey).(string); ok && v != "" {
+			return v
+		}
+	}
+	return req.RealIP()
+}
+
+// hashRing is a consistent hash ring of a server group.
+type hashRing struct {
+	sg      *ServerGroup
+	hashes  []uint64
+	servers []*Server
+}
+
+func newHashRing(sg *ServerGroup) *hashRing {
+	type node struct {
+		hash   uint64
+		server *Server
+	}
+
+	var nodes []node
+	for _, svr := range sg.Servers {
+		replicas := ringHashReplicas
+		if sg.TotalWeight > 0 {
+			replicas = (svr.Weight*ringHashReplicas + 99) / 100
+		}
+		for i := 0; i < replicas; i++ {
+			h := murmur3.Sum64([]byte(svr.ID() + "-" + strconv.Itoa(i)))
+			nodes = append(nodes, node{hash: h, server: svr})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].hash < nodes[j].hash
+	})
+
+	r := &hashRing{
+		sg:      sg,
+		hashes:  make([]uint64, len(nodes)),
+		servers: make([]*Server, len(nodes)),
+	}
+	for i, n := range nodes {
+		r.hashes[i], r.servers[i] = n.hash, n.server
+	}
+	return r
+}
+
+func (r *hashRing) get(key string) *Server {
+	h := murmur3.Sum64([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.servers[i]
+}
+
+// RingHashLoadBalancePolicy is a load balance policy that chooses a server
+// by consistent hash with a hash ring.
+type RingHashLoadBalancePolicy struct {
+	spec *LoadBalanceSpec
+	ring atomic.Pointer[hashRing]
+}
+
+// ChooseServer chooses a server by consistent hash.
+func (lbp *RingHashLoadBalancePolicy) ChooseServer(req protocols.Request, sg *ServerGroup) *Server {
+	// the ring is rebuilt once the server group changes.
+	r := lbp.ring.Load()
+	if r == nil || r.sg != sg {
+		r = newHashRing(sg)
+		lbp.ring.Store(r)
+	}
+	return r.get(hashKey(lbp.spec, req))
+}
+
+// maglevTable is a Maglev lookup table of a server group.
+type maglevTable struct {
+	sg    *ServerGroup
+	table []*Server
+}
+
+// newMaglevTable populates the lookup table, every server fills the table
+// with its own permutation by turns, and a server with weight fills more
+// entries in each turn.
+func newMaglevTable(sg *ServerGroup) *maglevTable {
+	n := len(sg.Servers)
+	offsets := make([]uint64, n)
+	skips := make([]uint64, n)
+	next := make([]uint64, n)
+	for i, svr := range sg.Servers {
+		id := []byte(svr.ID())
+		offsets[i] = murmur3.Sum64WithSeed(id, 0) % maglevTableSize
+		skips[i] = murmur3.Sum64WithSeed(id, 1)%(maglevTableSize-1) + 1
+	}
+
+	table := make([]*Server, maglevTableSize)
+	filled := 0
+	for filled < maglevTableSize {
+		for i, svr := range sg.Servers {
+			turns := 1
+			if sg.TotalWeight > 0 {
+				turns = svr.Weight
+			}
+			for t := 0; t < turns && filled < maglevTableSize; t++ {
+				c := (offsets[i] + next[i]*skips[i]) % maglevTableSize
+				for table[c] != nil {
+					next[i]++
+					c = (offsets[i] + next[i]*skips[i]) % maglevTableSize
+				}
+				table[c] = svr
+				next[i]++
+				filled++
+			}
+		}
+	}
+
+	return &maglevTable{sg: sg, table: table}
+}
+
+// MaglevLoadBalancePolicy is a load balance policy that chooses a server
+// by consistent hash with a Maglev lookup table.
+type MaglevLoadBalancePolicy struct {
+	spec  *LoadBalanceSpec
+	table atomic.Pointer[maglevTable]
+}
+
+// ChooseServer chooses a server by consistent hash.
+func (lbp *MaglevLoadBalancePolicy) ChooseServer(req protocols.Request, sg *ServerGroup) *Server {
+	// the table is rebuilt once the server group changes.
+	t := lbp.table.Load()
+	if t == nil || t.sg != sg {
+		t = newMaglevTable(sg)
+		lbp.table.Store(t)
+	}
+	h := murmur3.Sum64([]byte(hashKey(lbp.spec, req)))
+	return t.table[h%maglevTableSize]
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxies
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeastConnectionsLoadBalancePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := []*Server{{URL: "http://192.168.1.1"}, {URL: "http://192.168.1.2"}}
+	lb := NewGeneralLoadBalancer(&LoadBalanceSpec{Policy: LoadBalancePolicyLeastConnections}, servers)
+	lb.Init(nil, nil, nil)
+
+	lb.StartRequest(servers[0])
+	for i := 0; i < 10; i++ {
+		assert.Equal(servers[1], lb.ChooseServer(nil))
+	}
+	lb.EndRequest(servers[0])
+	lb.StartRequest(servers[1])
+	for i := 0; i < 10; i++ {
+		assert.Equal(servers[0], lb.ChooseServer(nil))
+	}
+
+	// the in-flight requests are compared per weight.
+	servers = []*Server{{URL: "http://192.168.1.1", Weight: 10}, {URL: "http://192.168.1.2", Weight: 1}}
+	lb = NewGeneralLoadBalancer(&LoadBalanceSpec{Policy: LoadBalancePolicyLeastConnections}, servers)
+	lb.Init(nil, nil, nil)
+	lb.StartRequest(servers[0])
+	lb.StartRequest(servers[0])
+	lb.StartRequest(servers[1])
+	for i := 0; i < 10; i++ {
+		assert.Equal(servers[0], lb.ChooseServer(nil))
+	}
+}
+
+func TestEWMALoadBalancePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := []*Server{{URL: "http://192.168.1.1"}, {URL: "http://192.168.1.2"}}
+	lb := NewGeneralLoadBalancer(&LoadBalanceSpec{Policy: LoadBalancePolicyEWMA}, servers)
+	lb.Init(nil, nil, nil)
+
+	lb.ReportResult(servers[0], false, 100*time.Millisecond)
+	lb.ReportResult(servers[1], false, 10*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		assert.Equal(servers[1], lb.ChooseServer(nil))
+	}
+
+	// the in-flight requests increase the cost.
+	for i := 0; i < 10; i++ {
+		lb.StartRequest(servers[1])
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal(servers[0], lb.ChooseServer(nil))
+	}
+
+	// the latency is averaged.
+	servers[0].recordLatency(200 * time.Millisecond)
+	assert.Equal(int64(120*time.Millisecond), servers[0].latencyEWMA.Load())
+}
+
+func TestConsistentHashLoadBalancePolicy(t *testing.T) {
+	for _, policy := range []string{LoadBalancePolicyRingHash, LoadBalancePolicyMaglev} {
+		t.Run(policy, func(t *testing.T) {
+			assert := assert.New(t)
+
+			spec := &LoadBalanceSpec{Policy: policy, HeaderHashKey: "X-User"}
+			servers := prepareServers(10)
+			lb := NewGeneralLoadBalancer(spec, servers)
+			lb.Init(nil, nil, nil)
+
+			newRequest := func(user string) *httpprot.Request {
+				req := &http.Request{Header: http.Header{}}
+				req.Header.Add("X-User", user)
+				req.Header.Add("X-Real-Ip", "192.168.0.1")
+				r, _ := httpprot.NewRequest(req)
+				return r
+			}
+
+			counter := map[*Server]int{}
+			chosen := map[string]*Server{}
+			for i := 0; i < 1000; i++ {
+				user := fmt.Sprintf("user-%d", i)
+				svr := lb.ChooseServer(newRequest(user))
+				counter[svr]++
+				chosen[user] = svr
+				assert.Equal(svr, lb.ChooseServer(newRequest(user)))
+			}
+			assert.Equal(10, len(counter))
+			// the servers with higher weight get more requests.
+			assert.Greater(counter[servers[9]], counter[servers[0]])
+
+			// the client IP is used if the header is missing.
+			svr := lb.ChooseServer(newRequest(""))
+			assert.Equal(svr, lb.ChooseServer(newRequest("")))
+
+			// only a few requests are moved to other servers once a server
+			// is removed.
+			removed := servers[5]
+			lb.healthyServers.Store(newServerGroup(append(servers[:5:5], servers[6:]...)))
+			moved := 0
+			for user, old := range chosen {
+				svr := lb.ChooseServer(newRequest(user))
+				assert.NotEqual(removed, svr)
+				if old != removed && svr != old {
+					moved++
+				}
+			}
+			assert.Less(moved, 50)
+		})
+	}
+}
@@ -0,0 +1,316 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxies
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+const (
+	defaultOutlierDetectionInterval = 10 * time.Second
+	defaultBaseEjectionTime         = 30 * time.Second
+	defaultMaxEjectionTime          = 300 * time.Second
+	defaultMaxEjectionPercent       = 50
+	defaultOutlierMinRequests       = 5
+)
+
+// OutlierDetectionSpec is the spec of the passive health check, which
+// tracks the results of the requests sent to the servers, and ejects the
+// servers exceeding the thresholds for a period of time.
+type OutlierDetectionSpec struct {
+	// ConsecutiveErrors ejects a server once the number of its successive
+	// errors reaches it, disabled if it is zero.
+	ConsecutiveErrors int `json:"consecutiveErrors,omitempty" jsonschema:"minimum=0"`
+	// ErrorPercentage ejects a server once its error percentage in an
+	// interval reaches it, disabled if it is zero.
+	ErrorPercentage int `json:"errorPercentage,omitempty" jsonschema:"minimum=0,maximum=100"`
+	// LatencyThreshold ejects a server once its average latency in an
+	// interval exceeds it, disabled if it is empty.
+	LatencyThreshold string `json:"latencyThreshold,omitempty" jsonschema:"format=duration"`
+	// MinRequests is the min number of requests in an interval to check
+	// the error percentage and latency of a server.
+	MinRequests int `json:"minRequests,omitempty" jsonschema:"minimum=0"`
+	// Interval is the interval of the error percentage and latency checks.
+	Interval string `json:"interval,omitempty" jsonschema:"format=duration"`
+	// BaseEjectionTime is the ejection time of a server for the first
+	// time, it is multiplied by the times the server is ejected in a row,
+	// but no more than MaxEjectionTime.
+	BaseEjectionTime string `json:"baseEjectionTime,omitempty" jsonschema:"format=duration"`
+	MaxEjectionTime  string `json:"maxEjectionTime,omitempty" jsonschema:"format=duration"`
+	// MaxEjectionPercent is the max percentage of the servers could be
+	// ejected at the same time, but at least one server could be ejected.
+	MaxEjectionPercent int `json:"maxEjectionPercent,omitempty" jsonschema:"minimum=0,maximum=100"`
+}
+
+// outlierDetector implements the passive health check of the servers.
+type outlierDetector struct {
+	consecutiveErrors  int
+	errorPercentage    int
+	latencyThreshold   time.Duration
+	minRequests        int
+	interval           time.Duration
+	baseEjectionTime   time.Duration
+	maxEjectionTime    time.Duration
+	maxEjectionPercent int
+
+	// onChange is called once the ejected servers change.
+	onChange func()
+
+	lock    sync.Mutex
+	servers map[*Server]*outlierStat
+	ejected int
+	done    chan struct{}
+}
+
+type outlierStat struct {
+	requests          int
+	errors            int
+	latency           time.Duration
+	consecutiveErrors int
+
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// Validate validates OutlierDetectionSpec.
+func (spec *OutlierDetectionSpec) Validate() error {
+	durations := map[string]string{
+		"latencyThreshold": spec.LatencyThreshold,
+		"interval":         spec.Interval,
+		"baseEjectionTime": spec.BaseEjectionTime,
+		"maxEjectionTime":  spec.MaxEjectionTime,
+	}
+	for name, v := range durations {
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %s: %v", name, v, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid %s %s: must be positive", name, v)
+		}
+	}
+
+	if spec.ConsecutiveErrors == 0 && spec.ErrorPercentage == 0 && spec.LatencyThreshold == "" {
+		return fmt.Errorf("none of consecutiveErrors, errorPercentage and latencyThreshold is set")
+	}
+	return nil
+}
+
+func newOutlierDetector(spec *OutlierDetectionSpec, servers []*Server, onChange func()) *outlierDetector {
+	od := &outlierDetector{
+		consecutiveErrors:  spec.ConsecutiveErrors,
+		errorPercentage:    spec.ErrorPercentage,
+		minRequests:        spec.MinRequests,
+		interval:           defaultOutlierDetectionInterval,
+		baseEjectionTime:   defaultBaseEjectionTime,
+		maxEjectionTime:    defaultMaxEjectionTime,
+		maxEjectionPercent: spec.MaxEjectionPercent,
+		onChange:           onChange,
+		servers:            make(map[*Server]*outlierStat, len(servers)),
+		done:               make(chan struct{}),
+	}
+
+	parse := func(v string, d *time.Duration) {
+		if v != "" {
+			*d, _ = time.ParseDuration(v)
+		}
+	}
+	parse(spec.LatencyThreshold, &od.latencyThreshold)
+	parse(spec.Interval, &od.interval)
+	parse(spec.BaseEjectionTime, &od.baseEjectionTime)
+	parse(spec.MaxEjectionTime, &od.maxEjectionTime)
+	if od.minRequests <= 0 {
+		od.minRequests = defaultOutlierMinRequests
+	}
+	if od.maxEjectionPercent <= 0 {
+		od.maxEjectionPercent = defaultMaxEjectionPercent
+	}
+
+	for _, svr := range servers {
+		od.servers[svr] = &outlierStat{}
+	}
+
+	go od.run()
+	return od
+}
+
+func (od *outlierDetector) run() {
+	ticker := time.NewTicker(od.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-od.done:
+			return
+		case now := <-ticker.C:
+			od.check(now)
+		}
+	}
+}
+
+// report records the result of a request sent to the server.
+func (od *outlierDetector) report(svr *Server, failed bool, latency time.Duration) {
+	od.lock.Lock()
+	changed := od.doReport(svr, failed, latency)
+	od.lock.Unlock()
+
+	if changed {
+		od.onChange()
+	}
+}
+
+func (od *outlierDetector) doReport(svr *Server, failed bool, latency time.Duration) bool {
+	stat := od.servers[svr]
+	// the server is not in the pool or already ejected.
+	if stat == nil || !stat.ejectedUntil.IsZero() {
+		return false
+	}
+
+	stat.requests++
+	stat.latency += latency
+	if !failed {
+		stat.consecutiveErrors = 0
+		return false
+	}
+
+	stat.errors++
+	stat.consecutiveErrors++
+	if od.consecutiveErrors == 0 || stat.consecutiveErrors < od.consecutiveErrors {
+		return false
+	}
+	reason := fmt.Sprintf("%d consecutive errors", stat.consecutiveErrors)
+	return od.eject(svr, stat, time.Now(), reason)
+}
+
+// check brings back the servers whose ejection time is over, and ejects
+// the servers exceeding the error percentage or latency threshold.
+func (od *outlierDetector) check(now time.Time) {
+	od.lock.Lock()
+	changed := od.doCheck(now)
+	od.lock.Unlock()
+
+	if changed {
+		od.onChange()
+	}
+}
+
+func (od *outlierDetector) doCheck(now time.Time) bool {
+	changed := false
+
+	// sort the servers to make the ejection order stable, as the number
+	// of ejected servers is limited.
+	servers := make([]*Server, 0, len(od.servers))
+	for svr := range od.servers {
+		servers = append(servers, svr)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].URL < servers[j].URL
+	})
+
+	for _, svr := range servers {
+		stat := od.servers[svr]
+
+		if !stat.ejectedUntil.IsZero() {
+			if now.Before(stat.ejectedUntil) {
+				continue
+			}
+			logger.Infof("server %s is brought back after ejection", svr.ID())
+			stat.ejectedUntil = time.Time{}
+			svr.startWarmup(now)
+			od.ejected--
+			changed = true
+			continue
+		}
+
+		requests, errors, latency := stat.requests, stat.errors, stat.latency
+		stat.requests, stat.errors, stat.latency = 0, 0, 0
+
+		if requests < od.minRequests {
+			// the server behaves well, decrease its ejection times.
+			if errors == 0 && stat.ejections > 0 {
+				stat.ejections--
+			}
+			continue
+		}
+
+		var reason string
+		if od.errorPercentage > 0 && errors*100 >= od.errorPercentage*requests {
+			reason = fmt.Sprintf("error percentage %d%%", errors*100/requests)
+		} else if od.latencyThreshold > 0 && latency/time.Duration(requests) > od.latencyThreshold {
+			reason = fmt.Sprintf("average latency %v", latency/time.Duration(requests))
+		}
+
+		if reason == "" {
+			if stat.ejections > 0 {
+				stat.ejections--
+			}
+			continue
+		}
+		if od.eject(svr, stat, now, reason) {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// eject ejects the server if the max ejection percentage is not reached.
+func (od *outlierDetector) eject(svr *Server, stat *outlierStat, now time.Time, reason string) bool {
+	if od.ejected > 0 && (od.ejected+1)*100 > od.maxEjectionPercent*len(od.servers) {
+		logger.Warnf("server %s is not ejected for %s: max ejection percentage reached", svr.ID(), reason)
+		return false
+	}
+
+	stat.ejections++
+	d := od.baseEjectionTime * time.Duration(stat.ejections)
+	if d > od.maxEjectionTime {
+		d = od.maxEjectionTime
+	}
+	stat.ejectedUntil = now.Add(d)
+	stat.requests, stat.errors, stat.latency, stat.consecutiveErrors = 0, 0, 0, 0
+	od.ejected++
+
+	logger.Warnf("server %s is ejected for %v: %s", svr.ID(), d, reason)
+	return true
+}
+
+// ejectedServers returns the ejected servers.
+func (od *outlierDetector) ejectedServers() map[*Server]bool {
+	od.lock.Lock()
+	defer od.lock.Unlock()
+
+	servers := map[*Server]bool{}
+	for svr, stat := range od.servers {
+		if !stat.ejectedUntil.IsZero() {
+			servers[svr] = true
+		}
+	}
+	return servers
+}
+
+func (od *outlierDetector) close() {
+	close(od.done)
+}
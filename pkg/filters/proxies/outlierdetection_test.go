@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxies
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutlierDetectionSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil((&OutlierDetectionSpec{ConsecutiveErrors: 3}).Validate())
+	assert.Nil((&OutlierDetectionSpec{LatencyThreshold: "1s", Interval: "5s"}).Validate())
+	assert.NotNil((&OutlierDetectionSpec{}).Validate())
+	assert.NotNil((&OutlierDetectionSpec{ErrorPercentage: 50, Interval: "abc"}).Validate())
+	assert.NotNil((&OutlierDetectionSpec{ErrorPercentage: 50, BaseEjectionTime: "-1s"}).Validate())
+
+	spec := &ServerPoolBaseSpec{
+		Servers: prepareServers(2),
+		LoadBalance: &LoadBalanceSpec{
+			OutlierDetection: &OutlierDetectionSpec{},
+		},
+	}
+	assert.NotNil(spec.Validate())
+}
+
+func TestOutlierDetection(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := prepareServers(4)
+	spec := &LoadBalanceSpec{
+		OutlierDetection: &OutlierDetectionSpec{
+			ConsecutiveErrors: 2,
+			ErrorPercentage:   50,
+			LatencyThreshold:  "100ms",
+			MinRequests:       4,
+			Interval:          "1h",
+			BaseEjectionTime:  "10s",
+			MaxEjectionTime:   "15s",
+		},
+	}
+	lb := NewGeneralLoadBalancer(spec, servers)
+	lb.Init(nil, nil, nil)
+	defer lb.Close()
+
+	healthy := func() int {
+		return len(lb.healthyServers.Load().Servers)
+	}
+
+	// consecutive errors
+	lb.ReportResult(servers[0], true, time.Millisecond)
+	lb.ReportResult(servers[0], false, time.Millisecond)
+	lb.ReportResult(servers[0], true, time.Millisecond)
+	assert.Equal(4, healthy())
+	lb.ReportResult(servers[0], true, time.Millisecond)
+	assert.Equal(3, healthy())
+	assert.Equal([]string{servers[0].URL}, lb.EjectedServers())
+
+	// error percentage
+	for i := 0; i < 4; i++ {
+		lb.ReportResult(servers[1], i%2 == 0, time.Millisecond)
+	}
+	// latency
+	for i := 0; i < 4; i++ {
+		lb.ReportResult(servers[2], false, time.Second)
+	}
+	// too few requests
+	lb.ReportResult(servers[3], true, time.Second)
+
+	now := time.Now()
+	lb.od.check(now)
+	// at most half of the servers could be ejected.
+	assert.Equal(2, healthy())
+	assert.Equal([]string{servers[0].URL, servers[1].URL}, lb.EjectedServers())
+
+	// the ejected servers are brought back after the ejection time.
+	lb.od.check(now.Add(11 * time.Second))
+	assert.Equal(4, healthy())
+	assert.Nil(lb.EjectedServers())
+
+	// the ejection time is longer for the servers ejected again.
+	lb.ReportResult(servers[0], true, time.Millisecond)
+	lb.ReportResult(servers[0], true, time.Millisecond)
+	assert.Equal(3, healthy())
+	lb.od.check(time.Now().Add(11 * time.Second))
+	assert.Equal(3, healthy())
+	lb.od.check(time.Now().Add(16 * time.Second))
+	assert.Equal(4, healthy())
+}
+
+func TestOutlierDetectionMinEjection(t *testing.T) {
+	assert := assert.New(t)
+
+	// at least one server could be ejected.
+	servers := prepareServers(1)
+	spec := &LoadBalanceSpec{
+		OutlierDetection: &OutlierDetectionSpec{
+			ConsecutiveErrors:  1,
+			MaxEjectionPercent: 10,
+		},
+	}
+	lb := NewGeneralLoadBalancer(spec, servers)
+	lb.Init(nil, nil, nil)
+	defer lb.Close()
+
+	lb.ReportResult(servers[0], true, time.Millisecond)
+	assert.Nil(lb.ChooseServer(nil))
+}
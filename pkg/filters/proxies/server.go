@@ -22,6 +22,18 @@ import (
 	"net"
 	"net/url"
 	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencyEWMADecay is the weight of the history in the exponentially
+	// weighted moving average of the latency.
+	latencyEWMADecay = 0.8
+
+	// unixSocketScheme is the scheme of the servers listening on unix
+	// sockets, the URL is in the format of unix:///path/to/socket.
+	unixSocketScheme = "unix"
 )
 
 // Server is a backend proxy server.
@@ -35,6 +47,16 @@ type Server struct {
 	// HealthCounter is used to count the number of successive health checks
 	// result, positive for healthy, negative for unhealthy
 	HealthCounter int `json:"-"`
+
+	// activeRequests is the number of the in-flight requests, and
+	// latencyEWMA is the exponentially weighted moving average of the
+	// latency in nanoseconds, they are used by the load balance policies.
+	activeRequests atomic.Int64
+	latencyEWMA    atomic.Int64
+	// warmupStart is the time in unix nanoseconds when the server is added
+	// to the pool or becomes healthy again, it is zero if the server is not
+	// warming up.
+	warmupStart atomic.Int64
 }
 
 // String implements the Stringer interface.
@@ -47,6 +69,19 @@ func (s *Server) ID() string {
 	return s.URL
 }
 
+// UnixSocketPath returns the path of the unix socket if the server URL is
+// in the format of unix:///path/to/socket, or an empty string otherwise.
+func (s *Server) UnixSocketPath() string {
+	if !strings.HasPrefix(s.URL, unixSocketScheme+"://") {
+		return ""
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || u.Host != "" {
+		return ""
+	}
+	return u.Path
+}
+
 // CheckAddrPattern checks whether the server address is host name or ip:port,
 // not all error cases are handled.
 func (s *Server) CheckAddrPattern() {
@@ -54,6 +89,12 @@ func (s *Server) CheckAddrPattern() {
 	if err != nil {
 		return
 	}
+
+	// A unix socket has no host name, so the host of the request is kept.
+	if u.Scheme == unixSocketScheme {
+		s.AddrIsHostName = false
+		return
+	}
 	host := u.Host
 
 	square := strings.LastIndexByte(host, ']')
@@ -72,6 +113,25 @@ func (s *Server) CheckAddrPattern() {
 	s.AddrIsHostName = net.ParseIP(host) == nil
 }
 
+// startWarmup marks the server as warming up from now on.
+func (s *Server) startWarmup(now time.Time) {
+	s.warmupStart.Store(now.UnixNano())
+}
+
+// recordLatency updates the moving average of the latency.
+func (s *Server) recordLatency(latency time.Duration) {
+	for {
+		old := s.latencyEWMA.Load()
+		v := int64(latency)
+		if old > 0 {
+			v = int64(float64(old)*latencyEWMADecay + float64(latency)*(1-latencyEWMADecay))
+		}
+		if s.latencyEWMA.CompareAndSwap(old, v) {
+			return
+		}
+	}
+}
+
 // Healthy returns whether the server is healthy
 func (s *Server) Healthy() bool {
 	return !s.Unhealth
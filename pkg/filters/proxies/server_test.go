@@ -68,4 +68,16 @@ func TestCheckAddrPattern(t *testing.T) {
 	server.URL = "faas-func-name.default.example.com"
 	server.CheckAddrPattern()
 	assert.True(server.AddrIsHostName, "address should not be IP:port")
+
+	server.URL = "unix:///var/run/app.sock"
+	server.CheckAddrPattern()
+	assert.False(server.AddrIsHostName, "unix socket should not be host name")
+}
+
+func TestUnixSocketPath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("/var/run/app.sock", (&Server{URL: "unix:///var/run/app.sock"}).UnixSocketPath())
+	assert.Equal("", (&Server{URL: "unix://host/app.sock"}).UnixSocketPath())
+	assert.Equal("", (&Server{URL: "http://127.0.0.1:8080"}).UnixSocketPath())
 }
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/object/serviceregistry"
@@ -41,6 +42,9 @@ type ServerPoolBase struct {
 	done         chan struct{}
 	wg           sync.WaitGroup
 	loadBalancer atomic.Value
+
+	// servers are the servers of the current load balancer by their IDs.
+	servers map[string]*Server
 }
 
 // ServerPoolBaseSpec is the spec for a base server pool.
@@ -51,12 +55,24 @@ type ServerPoolBaseSpec struct {
 	ServiceRegistry string           `json:"serviceRegistry,omitempty"`
 	ServiceName     string           `json:"serviceName,omitempty"`
 	LoadBalance     *LoadBalanceSpec `json:"loadBalance,omitempty"`
+	// DNS discovers the servers by resolving a DNS name, the servers are
+	// used if the first resolution fails.
+	DNS *DNSDiscoverySpec `json:"dns,omitempty"`
 }
 
 // Validate validates ServerPoolSpec.
 func (sps *ServerPoolBaseSpec) Validate() error {
-	if sps.ServiceName == "" && len(sps.Servers) == 0 {
-		return fmt.Errorf("both serviceName and servers are empty")
+	if sps.ServiceName == "" && sps.DNS == nil && len(sps.Servers) == 0 {
+		return fmt.Errorf("serviceName, dns and servers are all empty")
+	}
+
+	if sps.DNS != nil {
+		if sps.ServiceName != "" {
+			return fmt.Errorf("serviceName and dns can't be set at the same time")
+		}
+		if err := sps.DNS.Validate(); err != nil {
+			return fmt.Errorf("dns: %v", err)
+		}
 	}
 
 	serversGotWeight := 0
@@ -74,6 +90,24 @@ func (sps *ServerPoolBaseSpec) Validate() error {
 		return fmt.Errorf("can not open health check for service discovery")
 	}
 
+	if sps.LoadBalance != nil && sps.LoadBalance.StickySession != nil {
+		if err := sps.LoadBalance.StickySession.Validate(); err != nil {
+			return fmt.Errorf("stickySession: %v", err)
+		}
+	}
+
+	if sps.LoadBalance != nil && sps.LoadBalance.SlowStart != nil {
+		if err := sps.LoadBalance.SlowStart.Validate(); err != nil {
+			return fmt.Errorf("slowStart: %v", err)
+		}
+	}
+
+	if sps.LoadBalance != nil && sps.LoadBalance.OutlierDetection != nil {
+		if err := sps.LoadBalance.OutlierDetection.Validate(); err != nil {
+			return fmt.Errorf("outlierDetection: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -83,6 +117,11 @@ func (spb *ServerPoolBase) Init(spImpl ServerPoolImpl, super *supervisor.Supervi
 	spb.Name = name
 	spb.done = make(chan struct{})
 
+	if spec.DNS != nil {
+		spb.watchDNS(spec)
+		return
+	}
+
 	if spec.ServiceRegistry == "" || spec.ServiceName == "" {
 		spb.createLoadBalancer(spec.LoadBalance, spec.Servers)
 		return
@@ -126,9 +165,20 @@ func (spb *ServerPoolBase) LoadBalancer() LoadBalancer {
 }
 
 func (spb *ServerPoolBase) createLoadBalancer(spec *LoadBalanceSpec, servers []*Server) {
+	// the servers added to the pool are warming up, except the ones of
+	// the first load balancer.
+	now := time.Now()
+	known := make(map[string]*Server, len(servers))
 	for _, server := range servers {
 		server.CheckAddrPattern()
+		if old := spb.servers[server.ID()]; old != nil {
+			server.warmupStart.Store(old.warmupStart.Load())
+		} else if spb.servers != nil {
+			server.startWarmup(now)
+		}
+		known[server.ID()] = server
 	}
+	spb.servers = known
 
 	if spec == nil {
 		spec = &LoadBalanceSpec{}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxies
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultSlowStartMinWeightPercent = 10
+	// slowStartRetries is the max times to choose another server if the
+	// chosen one is warming up and rejects the request.
+	slowStartRetries = 3
+)
+
+// SlowStartSpec is the spec of slow start, the traffic share of a server
+// is ramped up gradually in the window once it is added to the pool or
+// becomes healthy again.
+type SlowStartSpec struct {
+	Window string `json:"window" jsonschema:"required,format=duration"`
+	// Aggression controls the speed of ramping up, the traffic share of a
+	// server is (elapsed/window)^(1/aggression), 1 means linear.
+	Aggression float64 `json:"aggression,omitempty" jsonschema:"minimum=0"`
+	// MinWeightPercent is the traffic share of a server at the beginning
+	// of the window, in percentage.
+	MinWeightPercent int `json:"minWeightPercent,omitempty" jsonschema:"minimum=0,maximum=100"`
+}
+
+type slowStart struct {
+	window     time.Duration
+	aggression float64
+	minFactor  float64
+}
+
+// Validate validates SlowStartSpec.
+func (spec *SlowStartSpec) Validate() error {
+	d, err := time.ParseDuration(spec.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window %s: %v", spec.Window, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("invalid window %s: must be positive", spec.Window)
+	}
+	if spec.Aggression < 0 {
+		return fmt.Errorf("invalid aggression %v: must not be negative", spec.Aggression)
+	}
+	return nil
+}
+
+func newSlowStart(spec *SlowStartSpec) *slowStart {
+	ss := &slowStart{
+		aggression: spec.Aggression,
+		minFactor:  float64(spec.MinWeightPercent) / 100,
+	}
+	ss.window, _ = time.ParseDuration(spec.Window)
+	if ss.aggression <= 0 {
+		ss.aggression = 1
+	}
+	if spec.MinWeightPercent <= 0 {
+		ss.minFactor = defaultSlowStartMinWeightPercent / 100.0
+	}
+	return ss
+}
+
+// factor returns the traffic share of the server, which is 1 if the server
+// is not warming up.
+func (ss *slowStart) factor(svr *Server, now time.Time) float64 {
+	start := svr.warmupStart.Load()
+	if start == 0 {
+		return 1
+	}
+
+	elapsed := now.Sub(time.Unix(0, start))
+	if elapsed >= ss.window {
+		return 1
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	f := math.Pow(float64(elapsed)/float64(ss.window), 1/ss.aggression)
+	return math.Max(f, ss.minFactor)
+}
+
+// accept reports whether the request could be sent to the server.
+func (ss *slowStart) accept(svr *Server, now time.Time) bool {
+	f := ss.factor(svr, now)
+	return f >= 1 || rand.Float64() < f
+}
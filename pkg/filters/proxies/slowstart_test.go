@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxies
+
+import (
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/object/serviceregistry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowStartSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil((&SlowStartSpec{Window: "30s", Aggression: 2}).Validate())
+	assert.NotNil((&SlowStartSpec{}).Validate())
+	assert.NotNil((&SlowStartSpec{Window: "-1s"}).Validate())
+	assert.NotNil((&SlowStartSpec{Window: "30s", Aggression: -1}).Validate())
+
+	spec := &ServerPoolBaseSpec{
+		Servers:     prepareServers(2),
+		LoadBalance: &LoadBalanceSpec{SlowStart: &SlowStartSpec{}},
+	}
+	assert.NotNil(spec.Validate())
+}
+
+func TestSlowStartFactor(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	svr := &Server{URL: "http://192.168.1.1"}
+
+	ss := newSlowStart(&SlowStartSpec{Window: "100s"})
+	assert.Equal(1.0, ss.factor(svr, now))
+
+	svr.startWarmup(now)
+	assert.InDelta(0.1, ss.factor(svr, now), 0.001)
+	assert.InDelta(0.5, ss.factor(svr, now.Add(50*time.Second)), 0.001)
+	assert.Equal(1.0, ss.factor(svr, now.Add(100*time.Second)))
+
+	ss = newSlowStart(&SlowStartSpec{Window: "100s", Aggression: 2, MinWeightPercent: 1})
+	assert.InDelta(0.01, ss.factor(svr, now), 0.001)
+	assert.InDelta(0.5, ss.factor(svr, now.Add(25*time.Second)), 0.001)
+}
+
+func TestSlowStart(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &ServerPoolBaseSpec{
+		LoadBalance: &LoadBalanceSpec{
+			SlowStart: &SlowStartSpec{Window: "1h", MinWeightPercent: 1},
+		},
+	}
+	sp := &ServerPoolBase{spImpl: &MockServerPoolImpl{}}
+
+	instances := map[string]*serviceregistry.ServiceInstanceSpec{
+		"1": {Address: "192.168.1.1", Port: 80},
+	}
+	sp.useService(spec, instances)
+	// the servers of the first load balancer are not warming up.
+	for _, svr := range sp.servers {
+		assert.Zero(svr.warmupStart.Load())
+	}
+
+	instances["2"] = &serviceregistry.ServiceInstanceSpec{Address: "192.168.1.2", Port: 80}
+	sp.useService(spec, instances)
+	assert.Zero(sp.servers["http://192.168.1.1:80"].warmupStart.Load())
+	start := sp.servers["http://192.168.1.2:80"].warmupStart.Load()
+	assert.NotZero(start)
+
+	counter := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counter[sp.LoadBalancer().ChooseServer(nil).URL]++
+	}
+	assert.Less(counter["http://192.168.1.2:80"], 100)
+
+	// the warming up state is kept across load balancers.
+	instances["3"] = &serviceregistry.ServiceInstanceSpec{Address: "192.168.1.3", Port: 80}
+	sp.useService(spec, instances)
+	assert.Equal(start, sp.servers["http://192.168.1.2:80"].warmupStart.Load())
+}
@@ -22,8 +22,11 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"hash/maphash"
 	"net/http"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -40,6 +43,15 @@ const (
 	StickySessionModeDurationBased = "DurationBased"
 	// StickySessionModeApplicationBased uses a load balancer-generated cookie depends on app cookie for stickiness.
 	StickySessionModeApplicationBased = "ApplicationBased"
+	// StickySessionModeConsistentHash hashes a header, a cookie or the client IP onto the hash ring of the servers.
+	StickySessionModeConsistentHash = "ConsistentHash"
+
+	// StickySessionHashOnHeader hashes the value of a header.
+	StickySessionHashOnHeader = "header"
+	// StickySessionHashOnCookie hashes the value of the load balancer cookie, which is issued if absent.
+	StickySessionHashOnCookie = "cookie"
+	// StickySessionHashOnIP hashes the client IP.
+	StickySessionHashOnIP = "ip"
 
 	// StickySessionDefaultLBCookieName is the default name of the load balancer-generated cookie.
 	StickySessionDefaultLBCookieName = "EG_SESSION"
@@ -50,13 +62,61 @@ const (
 
 // StickySessionSpec is the spec for sticky session.
 type StickySessionSpec struct {
-	Mode string `json:"mode" jsonschema:"required,enum=CookieConsistentHash,enum=DurationBased,enum=ApplicationBased"`
+	Mode string `json:"mode" jsonschema:"required,enum=CookieConsistentHash,enum=DurationBased,enum=ApplicationBased,enum=ConsistentHash"`
 	// AppCookieName is the user-defined cookie name in CookieConsistentHash and ApplicationBased mode.
 	AppCookieName string `json:"appCookieName,omitempty"`
 	// LBCookieName is the generated cookie name in DurationBased and ApplicationBased mode.
 	LBCookieName string `json:"lbCookieName,omitempty"`
 	// LBCookieExpire is the expire seconds of generated cookie in DurationBased and ApplicationBased mode.
 	LBCookieExpire string `json:"lbCookieExpire,omitempty" jsonschema:"format=duration"`
+	// HashOn is the key to hash in ConsistentHash mode, the generated cookie
+	// is used if it is cookie.
+	HashOn string `json:"hashOn,omitempty" jsonschema:"enum=,enum=header,enum=cookie,enum=ip"`
+	// HeaderName is the header to hash in ConsistentHash mode if HashOn is header.
+	HeaderName string `json:"headerName,omitempty"`
+}
+
+// StickySessionStatus is the status of the consistent hash ring in
+// ConsistentHash mode.
+type StickySessionStatus struct {
+	HashOn  string   `json:"hashOn"`
+	Servers []string `json:"servers"`
+	// Rebalances is the times the ring is rebuilt because of the changes
+	// of the servers, and MovedRatio is the estimated ratio of the keys
+	// moved to other servers in the last rebalance.
+	Rebalances    uint64    `json:"rebalances"`
+	LastRebalance time.Time `json:"lastRebalance,omitempty"`
+	MovedRatio    float64   `json:"movedRatio"`
+}
+
+// Validate validates StickySessionSpec.
+func (spec *StickySessionSpec) Validate() error {
+	if spec.LBCookieExpire != "" {
+		if _, err := time.ParseDuration(spec.LBCookieExpire); err != nil {
+			return fmt.Errorf("invalid lbCookieExpire %s: %v", spec.LBCookieExpire, err)
+		}
+	}
+
+	if spec.Mode != StickySessionModeConsistentHash {
+		if spec.HashOn != "" || spec.HeaderName != "" {
+			return fmt.Errorf("hashOn and headerName are only supported in %s mode", StickySessionModeConsistentHash)
+		}
+		return nil
+	}
+
+	switch spec.HashOn {
+	case StickySessionHashOnHeader:
+		if spec.HeaderName == "" {
+			return fmt.Errorf("headerName is required when hashOn is header")
+		}
+	case StickySessionHashOnCookie, StickySessionHashOnIP:
+		if spec.HeaderName != "" {
+			return fmt.Errorf("headerName is only supported when hashOn is header")
+		}
+	default:
+		return fmt.Errorf("invalid hashOn %q, must be one of header, cookie and ip", spec.HashOn)
+	}
+	return nil
 }
 
 // SessionSticker is the interface for session stickiness.
@@ -90,6 +150,11 @@ type HTTPSessionSticker struct {
 	spec           *StickySessionSpec
 	consistentHash atomic.Pointer[consistent.Consistent]
 	cookieExpire   time.Duration
+
+	// ring and status are used in ConsistentHash mode.
+	ring      atomic.Pointer[hashRing]
+	statusMux sync.Mutex
+	status    StickySessionStatus
 }
 
 // NewHTTPSessionSticker creates a new HTTPSessionSticker.
@@ -110,6 +175,11 @@ func NewHTTPSessionSticker(spec *StickySessionSpec) SessionSticker {
 
 // UpdateServers update the servers for the HTTPSessionSticker.
 func (ss *HTTPSessionSticker) UpdateServers(servers []*Server) {
+	if ss.spec.Mode == StickySessionModeConsistentHash {
+		ss.updateRing(servers)
+		return
+	}
+
 	if ss.spec.Mode != StickySessionModeCookieConsistentHash {
 		return
 	}
@@ -134,6 +204,88 @@ func (ss *HTTPSessionSticker) UpdateServers(servers []*Server) {
 	ss.consistentHash.Store(consistent.New(members, cfg))
 }
 
+// ringMovedSamples is the number of the sample keys to estimate the ratio
+// of the keys moved in a rebalance.
+const ringMovedSamples = 1024
+
+// updateRing rebuilds the hash ring with the servers, and estimates the
+// ratio of the keys moved to other servers.
+func (ss *HTTPSessionSticker) updateRing(servers []*Server) {
+	ss.statusMux.Lock()
+	defer ss.statusMux.Unlock()
+
+	ring := newHashRing(newServerGroup(servers))
+	old := ss.ring.Swap(ring)
+
+	ss.status.HashOn = ss.spec.HashOn
+	ss.status.Servers = make([]string, len(servers))
+	for i, s := range servers {
+		ss.status.Servers[i] = s.ID()
+	}
+
+	if old == nil {
+		return
+	}
+
+	moved := 0
+	if len(ring.servers) == 0 || len(old.servers) == 0 {
+		moved = ringMovedSamples
+	} else {
+		for i := 0; i < ringMovedSamples; i++ {
+			key := strconv.Itoa(i)
+			if ring.get(key) != old.get(key) {
+				moved++
+			}
+		}
+	}
+
+	ss.status.Rebalances++
+	ss.status.LastRebalance = time.Now()
+	ss.status.MovedRatio = float64(moved) / ringMovedSamples
+}
+
+// getServerByHashRing returns the server by hashing the key of the request
+// onto the hash ring, a cookie is added to the request if the key is the
+// cookie and the request doesn't have it.
+func (ss *HTTPSessionSticker) getServerByHashRing(req *httpprot.Request) *Server {
+	ring := ss.ring.Load()
+	if ring == nil || len(ring.servers) == 0 {
+		return nil
+	}
+
+	var key string
+	switch ss.spec.HashOn {
+	case StickySessionHashOnHeader:
+		key = req.HTTPHeader().Get(ss.spec.HeaderName)
+		if key == "" {
+			return nil
+		}
+	case StickySessionHashOnCookie:
+		if cookie, err := req.Cookie(ss.spec.LBCookieName); err == nil && cookie.Value != "" {
+			key = cookie.Value
+		} else {
+			key = strconv.FormatUint(new(maphash.Hash).Sum64(), 16)
+			req.AddCookie(&http.Cookie{Name: ss.spec.LBCookieName, Value: key})
+		}
+	default:
+		key = req.RealIP()
+	}
+
+	return ring.get(key)
+}
+
+// Status returns the status of the hash ring in ConsistentHash mode.
+func (ss *HTTPSessionSticker) Status() *StickySessionStatus {
+	if ss.spec.Mode != StickySessionModeConsistentHash {
+		return nil
+	}
+
+	ss.statusMux.Lock()
+	defer ss.statusMux.Unlock()
+	status := ss.status
+	return &status
+}
+
 func (ss *HTTPSessionSticker) getServerByConsistentHash(req *httpprot.Request) *Server {
 	cookie, err := req.Cookie(ss.spec.AppCookieName)
 	if err != nil {
@@ -185,6 +337,8 @@ func (ss *HTTPSessionSticker) GetServer(req protocols.Request, sg *ServerGroup)
 		return ss.getServerByConsistentHash(httpreq)
 	case StickySessionModeDurationBased, StickySessionModeApplicationBased:
 		return ss.getServerByLBCookie(httpreq, sg)
+	case StickySessionModeConsistentHash:
+		return ss.getServerByHashRing(httpreq)
 	}
 
 	return nil
@@ -214,6 +368,19 @@ func (ss *HTTPSessionSticker) ReturnServer(server *Server, req protocols.Request
 
 	setCookie := false
 	switch ss.spec.Mode {
+	case StickySessionModeConsistentHash:
+		// the cookie is issued in getServerByHashRing if it is absent,
+		// and it is refreshed in every response.
+		if ss.spec.HashOn == StickySessionHashOnCookie {
+			httpreq := req.(*httpprot.Request)
+			if cookie, err := httpreq.Cookie(ss.spec.LBCookieName); err == nil {
+				httpresp.SetCookie(&http.Cookie{
+					Name:    ss.spec.LBCookieName,
+					Value:   cookie.Value,
+					Expires: time.Now().Add(ss.cookieExpire),
+				})
+			}
+		}
 	case StickySessionModeDurationBased:
 		setCookie = true
 	case StickySessionModeApplicationBased:
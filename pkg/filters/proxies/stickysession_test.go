@@ -134,3 +134,98 @@ func BenchmarkSign(b *testing.B) {
 		sign([]byte("192.168.1.2"))
 	}
 }
+
+func TestStickySessionSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil((&StickySessionSpec{Mode: StickySessionModeDurationBased, LBCookieExpire: "1h"}).Validate())
+	assert.Nil((&StickySessionSpec{Mode: StickySessionModeConsistentHash, HashOn: "header", HeaderName: "X-User"}).Validate())
+	assert.Nil((&StickySessionSpec{Mode: StickySessionModeConsistentHash, HashOn: "cookie"}).Validate())
+	assert.Nil((&StickySessionSpec{Mode: StickySessionModeConsistentHash, HashOn: "ip"}).Validate())
+
+	assert.NotNil((&StickySessionSpec{Mode: StickySessionModeDurationBased, LBCookieExpire: "abc"}).Validate())
+	assert.NotNil((&StickySessionSpec{Mode: StickySessionModeDurationBased, HashOn: "ip"}).Validate())
+	assert.NotNil((&StickySessionSpec{Mode: StickySessionModeConsistentHash}).Validate())
+	assert.NotNil((&StickySessionSpec{Mode: StickySessionModeConsistentHash, HashOn: "header"}).Validate())
+	assert.NotNil((&StickySessionSpec{Mode: StickySessionModeConsistentHash, HashOn: "ip", HeaderName: "X-User"}).Validate())
+}
+
+func TestStickySession_HashRing(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := prepareServers(10)
+	spec := &LoadBalanceSpec{
+		Policy: LoadBalancePolicyRoundRobin,
+		StickySession: &StickySessionSpec{
+			Mode:       StickySessionModeConsistentHash,
+			HashOn:     StickySessionHashOnHeader,
+			HeaderName: "X-User",
+		},
+	}
+	lb := NewGeneralLoadBalancer(spec, servers)
+	lb.Init(NewHTTPSessionSticker, nil, nil)
+
+	newRequest := func(user string) *httpprot.Request {
+		req := &http.Request{Header: http.Header{}}
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		r, _ := httpprot.NewRequest(req)
+		return r
+	}
+
+	svr1 := lb.ChooseServer(newRequest("user-1"))
+	for i := 0; i < 10; i++ {
+		assert.Equal(svr1, lb.ChooseServer(newRequest("user-1")))
+	}
+
+	// the load balance policy is used if the header is missing.
+	assert.NotEqual(lb.ChooseServer(newRequest("")), lb.ChooseServer(newRequest("")))
+
+	status := lb.StickySessionStatus()
+	assert.Equal(10, len(status.Servers))
+	assert.Equal(uint64(0), status.Rebalances)
+
+	// rebalance
+	lb.ss.UpdateServers(servers[:9])
+	status = lb.StickySessionStatus()
+	assert.Equal(9, len(status.Servers))
+	assert.Equal(uint64(1), status.Rebalances)
+	assert.Greater(status.MovedRatio, 0.0)
+	assert.Less(status.MovedRatio, 0.3)
+}
+
+func TestStickySession_HashRingCookie(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := prepareServers(10)
+	spec := &LoadBalanceSpec{
+		StickySession: &StickySessionSpec{
+			Mode:   StickySessionModeConsistentHash,
+			HashOn: StickySessionHashOnCookie,
+		},
+	}
+	lb := NewGeneralLoadBalancer(spec, servers)
+	lb.Init(NewHTTPSessionSticker, nil, nil)
+
+	// the cookie is issued if absent.
+	r, _ := httpprot.NewRequest(&http.Request{Header: http.Header{}})
+	svr1 := lb.ChooseServer(r)
+	resp, _ := httpprot.NewResponse(&http.Response{Header: http.Header{}})
+	lb.ReturnServer(svr1, r, resp)
+	c := readCookie(resp.Cookies(), StickySessionDefaultLBCookieName)
+	assert.NotNil(c)
+
+	for i := 0; i < 10; i++ {
+		req := &http.Request{Header: http.Header{}}
+		req.AddCookie(&http.Cookie{Name: StickySessionDefaultLBCookieName, Value: c.Value})
+		r, _ = httpprot.NewRequest(req)
+		assert.Equal(svr1, lb.ChooseServer(r))
+
+		resp, _ = httpprot.NewResponse(&http.Response{Header: http.Header{}})
+		lb.ReturnServer(svr1, r, resp)
+		assert.Equal(c.Value, readCookie(resp.Cookies(), StickySessionDefaultLBCookieName).Value)
+	}
+
+	assert.Nil(NewGeneralLoadBalancer(&LoadBalanceSpec{}, servers).StickySessionStatus())
+}
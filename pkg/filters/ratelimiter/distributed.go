@@ -0,0 +1,339 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	stdcontext "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	librl "github.com/megaease/easegress/v2/pkg/util/ratelimiter"
+)
+
+const (
+	backendCluster = "cluster"
+	backendRedis   = "redis"
+
+	defaultRetryInterval  = time.Second
+	defaultRedisKeyPrefix = "easegress:rate-limiter:"
+	redisTimeout          = 100 * time.Millisecond
+	// clusterTimeout bounds the transaction to acquire tokens from the
+	// cluster, which may take several round trips if it conflicts.
+	clusterTimeout = 500 * time.Millisecond
+
+	// minDistributedRefreshPeriod is the min refresh period when the quota
+	// is shared, shorter periods result in too many requests to the backend.
+	minDistributedRefreshPeriod = 100 * time.Millisecond
+)
+
+type (
+	// DistributedSpec describes how the quota is shared by all the
+	// Easegress members.
+	DistributedSpec struct {
+		Backend             string     `json:"backend,omitempty" jsonschema:"enum=,enum=cluster,enum=redis"`
+		Redis               *RedisSpec `json:"redis,omitempty"`
+		Burst               int        `json:"burst,omitempty" jsonschema:"minimum=1"`
+		LocalLimitForPeriod int        `json:"localLimitForPeriod,omitempty" jsonschema:"minimum=1"`
+		RetryInterval       string     `json:"retryInterval,omitempty" jsonschema:"format=duration"`
+	}
+
+	// RedisSpec describes the Redis server to store the shared state.
+	RedisSpec struct {
+		Address   string `json:"address" jsonschema:"required"`
+		Username  string `json:"username,omitempty"`
+		Password  string `json:"password,omitempty" jsonschema:"writeOnly=true"`
+		DB        int    `json:"db,omitempty"`
+		KeyPrefix string `json:"keyPrefix,omitempty"`
+	}
+
+	// tokenStore is the storage of the number of tokens permitted by all
+	// members in a period.
+	tokenStore interface {
+		// acquire acquires at most n tokens from the period, and returns
+		// the number of tokens actually acquired.
+		acquire(key string, period int64, n, limit int, periodDuration time.Duration) (int, error)
+		close()
+	}
+
+	clusterStore struct {
+		cls      cluster.Cluster
+		pipeline string
+		name     string
+	}
+
+	clusterUsage struct {
+		Period int64 `json:"period"`
+		Used   int   `json:"used"`
+	}
+
+	redisStore struct {
+		client *redis.Client
+		prefix string
+	}
+
+	// distributedLimiter shares the quota of a URL with the other members
+	// by acquiring tokens from the store in batches, it degrades to the
+	// local limiter if the store is unavailable.
+	distributedLimiter struct {
+		lock sync.Mutex
+
+		name  string
+		key   string
+		store tokenStore
+
+		limit         int
+		burst         int
+		period        time.Duration
+		retryInterval time.Duration
+
+		currentPeriod int64
+		tokens        int
+		exhausted     bool
+		// acquiring is closed when the in-flight acquisition of tokens
+		// from the store completes, it is nil if there is none.
+		acquiring chan struct{}
+
+		local         *librl.RateLimiter
+		degradedUntil time.Time
+	}
+)
+
+// Validate validates the DistributedSpec.
+func (spec *DistributedSpec) Validate() error {
+	switch spec.Backend {
+	case "", backendCluster:
+	case backendRedis:
+		if spec.Redis == nil || spec.Redis.Address == "" {
+			return fmt.Errorf("address of redis is required")
+		}
+	default:
+		return fmt.Errorf("unknown backend %s", spec.Backend)
+	}
+
+	if spec.RetryInterval != "" {
+		if _, err := time.ParseDuration(spec.RetryInterval); err != nil {
+			return fmt.Errorf("invalid retryInterval %s: %v", spec.RetryInterval, err)
+		}
+	}
+
+	return nil
+}
+
+func newTokenStore(spec *DistributedSpec, cls cluster.Cluster, pipeline, name string) tokenStore {
+	if spec.Backend == backendRedis {
+		prefix := spec.Redis.KeyPrefix
+		if prefix == "" {
+			prefix = defaultRedisKeyPrefix
+		}
+		client := redis.NewClient(&redis.Options{
+			Addr:         spec.Redis.Address,
+			Username:     spec.Redis.Username,
+			Password:     spec.Redis.Password,
+			DB:           spec.Redis.DB,
+			DialTimeout:  redisTimeout,
+			ReadTimeout:  redisTimeout,
+			WriteTimeout: redisTimeout,
+		})
+		return &redisStore{client: client, prefix: prefix + pipeline + ":" + name + ":"}
+	}
+
+	if cls == nil {
+		return nil
+	}
+	return &clusterStore{cls: cls, pipeline: pipeline, name: name}
+}
+
+func (cs *clusterStore) acquire(key string, period int64, n, limit int, _ time.Duration) (int, error) {
+	key = cs.cls.Layout().RateLimiterKey(cs.pipeline, cs.name, key)
+	granted := 0
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), clusterTimeout)
+	defer cancel()
+
+	err := cs.cls.STMWithContext(ctx, func(stm concurrency.STM) error {
+		usage := clusterUsage{}
+		if v := stm.Get(key); v != "" {
+			if err := json.Unmarshal([]byte(v), &usage); err != nil {
+				logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+			}
+		}
+		if usage.Period != period {
+			usage = clusterUsage{Period: period}
+		}
+
+		granted = limit - usage.Used
+		if granted > n {
+			granted = n
+		}
+		if granted <= 0 {
+			granted = 0
+			return nil
+		}
+
+		usage.Used += granted
+		data, _ := json.Marshal(usage)
+		stm.Put(key, string(data))
+		return nil
+	})
+
+	return granted, err
+}
+
+func (cs *clusterStore) close() {
+}
+
+func (rs *redisStore) acquire(key string, period int64, n, limit int, periodDuration time.Duration) (int, error) {
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), redisTimeout)
+	defer cancel()
+
+	key = fmt.Sprintf("%s%s:%d", rs.prefix, key, period)
+
+	pipe := rs.client.TxPipeline()
+	incr := pipe.IncrBy(ctx, key, int64(n))
+	pipe.PExpire(ctx, key, 2*periodDuration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	// the tokens over the limit are counted too, but they are never
+	// granted to anyone, so it is safe.
+	used := int(incr.Val()) - n
+	granted := limit - used
+	if granted > n {
+		granted = n
+	}
+	if granted < 0 {
+		granted = 0
+	}
+	return granted, nil
+}
+
+func (rs *redisStore) close() {
+	rs.client.Close()
+}
+
+// urlKey returns the key of the URL in the store, the methods are included
+// as there could be rules with the same URL but different methods.
+func urlKey(u *URLRule) string {
+	sum := sha256.Sum256([]byte(strings.Join(u.Methods, ",") + " " + u.ID()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func newDistributedLimiter(name string, u *URLRule, spec *DistributedSpec, store tokenStore, policy *librl.Policy) *distributedLimiter {
+	dl := &distributedLimiter{
+		name:          name,
+		key:           urlKey(u),
+		store:         store,
+		limit:         policy.LimitForPeriod,
+		burst:         spec.Burst,
+		period:        policy.LimitRefreshPeriod,
+		retryInterval: defaultRetryInterval,
+	}
+
+	if dl.burst <= 0 {
+		dl.burst = dl.limit / 10
+		if dl.burst == 0 {
+			dl.burst = 1
+		}
+	}
+	if spec.RetryInterval != "" {
+		dl.retryInterval, _ = time.ParseDuration(spec.RetryInterval)
+	}
+
+	localPolicy := *policy
+	if spec.LocalLimitForPeriod > 0 {
+		localPolicy.LimitForPeriod = spec.LocalLimitForPeriod
+	}
+	dl.local = librl.New(&localPolicy)
+
+	return dl
+}
+
+// AcquirePermission acquires a permission, requests are rejected without
+// waiting once the quota of the current period is used up by all members.
+// The lock is not held while acquiring tokens from the store, the other
+// requests wait for the in-flight acquisition instead.
+func (dl *distributedLimiter) AcquirePermission() (bool, time.Duration) {
+	for {
+		dl.lock.Lock()
+
+		now := time.Now()
+		if dl.store == nil || now.Before(dl.degradedUntil) {
+			dl.lock.Unlock()
+			return dl.local.AcquirePermission()
+		}
+
+		period := now.UnixNano() / int64(dl.period)
+		if period != dl.currentPeriod {
+			dl.currentPeriod, dl.tokens, dl.exhausted = period, 0, false
+		}
+
+		if dl.tokens > 0 || dl.exhausted {
+			permitted := dl.tokens > 0
+			if permitted {
+				dl.tokens--
+			}
+			dl.lock.Unlock()
+			return permitted, 0
+		}
+
+		if acquiring := dl.acquiring; acquiring != nil {
+			dl.lock.Unlock()
+			<-acquiring
+			continue
+		}
+
+		acquiring := make(chan struct{})
+		dl.acquiring = acquiring
+		dl.lock.Unlock()
+
+		granted, err := dl.store.acquire(dl.key, period, dl.burst, dl.limit, dl.period)
+
+		dl.lock.Lock()
+		dl.acquiring = nil
+		close(acquiring)
+		if err != nil {
+			logger.Warnf("rate limiter %s failed to acquire tokens, degrade to local limit for %s: %v",
+				dl.name, dl.retryInterval, err)
+			dl.degradedUntil = now.Add(dl.retryInterval)
+			dl.lock.Unlock()
+			return dl.local.AcquirePermission()
+		}
+		// the tokens of a passed period are dropped.
+		if period == dl.currentPeriod {
+			dl.tokens = granted
+			dl.exhausted = granted < dl.burst
+		}
+		dl.lock.Unlock()
+	}
+}
+
+// SetStateListener sets the state listener of the local limiter.
+func (dl *distributedLimiter) SetStateListener(listener librl.EventListenerFunc) {
+	dl.local.SetStateListener(listener)
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	stdcontext "context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	librl "github.com/megaease/easegress/v2/pkg/util/ratelimiter"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+	"github.com/megaease/easegress/v2/pkg/util/urlrule"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestDistributedSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &DistributedSpec{}
+	assert.NoError(spec.Validate())
+
+	spec = &DistributedSpec{Backend: backendRedis}
+	assert.Error(spec.Validate())
+
+	spec = &DistributedSpec{Backend: "unknown"}
+	assert.Error(spec.Validate())
+
+	spec = &DistributedSpec{Backend: backendRedis, Redis: &RedisSpec{Address: "127.0.0.1:6379"}, RetryInterval: "abc"}
+	assert.Error(spec.Validate())
+}
+
+type failingStore struct{}
+
+func (fs *failingStore) acquire(string, int64, int, int, time.Duration) (int, error) {
+	return 0, assert.AnError
+}
+
+func (fs *failingStore) close() {}
+
+// blockingStore blocks the acquisitions until release is closed.
+type blockingStore struct {
+	calls   chan struct{}
+	release chan struct{}
+}
+
+func (bs *blockingStore) acquire(_ string, _ int64, n, _ int, _ time.Duration) (int, error) {
+	bs.calls <- struct{}{}
+	<-bs.release
+	return n, nil
+}
+
+func (bs *blockingStore) close() {}
+
+func newTestURLRule() *URLRule {
+	u := &URLRule{URLRule: urlrule.URLRule{Methods: []string{"GET"}, URL: stringtool.StringMatcher{Prefix: "/"}}}
+	u.Init()
+	return u
+}
+
+func TestRedisStore(t *testing.T) {
+	assert := assert.New(t)
+
+	mr := miniredis.RunT(t)
+	spec := &DistributedSpec{
+		Backend: backendRedis,
+		Redis:   &RedisSpec{Address: mr.Addr()},
+		Burst:   3,
+	}
+	policy := librl.NewPolicy(0, time.Hour, 10)
+
+	// two members share the same quota.
+	s1 := newTokenStore(spec, nil, "pipeline", "limiter")
+	s2 := newTokenStore(spec, nil, "pipeline", "limiter")
+	defer s1.close()
+	defer s2.close()
+
+	u := newTestURLRule()
+	dl1 := newDistributedLimiter("limiter", u, spec, s1, policy)
+	dl2 := newDistributedLimiter("limiter", u, spec, s2, policy)
+
+	permitted := 0
+	for i := 0; i < 10; i++ {
+		if ok, _ := dl1.AcquirePermission(); ok {
+			permitted++
+		}
+		if ok, _ := dl2.AcquirePermission(); ok {
+			permitted++
+		}
+	}
+	assert.Equal(10, permitted)
+}
+
+func TestDistributedLimiterDegrade(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &DistributedSpec{LocalLimitForPeriod: 2, RetryInterval: "1h"}
+	policy := librl.NewPolicy(0, time.Hour, 10)
+
+	dl := newDistributedLimiter("limiter", newTestURLRule(), spec, &failingStore{}, policy)
+
+	permitted := 0
+	for i := 0; i < 10; i++ {
+		if ok, _ := dl.AcquirePermission(); ok {
+			permitted++
+		}
+	}
+	assert.Equal(2, permitted)
+	assert.True(dl.degradedUntil.After(time.Now()))
+
+	// no store means there is no cluster, the local limit is used.
+	dl = newDistributedLimiter("limiter", newTestURLRule(), spec, nil, policy)
+	ok, _ := dl.AcquirePermission()
+	assert.True(ok)
+}
+
+func TestClusterStoreTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout { return &cluster.Layout{} }
+	cls.MockedSTMWithContext = func(ctx stdcontext.Context, apply func(concurrency.STM) error) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	store := newTokenStore(&DistributedSpec{}, cls, "pipeline", "limiter")
+	start := time.Now()
+	_, err := store.acquire("key", 1, 1, 10, time.Second)
+	assert.Error(err)
+	assert.Less(time.Since(start), 2*clusterTimeout)
+}
+
+func TestDistributedLimiterAcquiring(t *testing.T) {
+	assert := assert.New(t)
+
+	store := &blockingStore{calls: make(chan struct{}, 2), release: make(chan struct{})}
+	policy := librl.NewPolicy(0, time.Hour, 10)
+	dl := newDistributedLimiter("limiter", newTestURLRule(), &DistributedSpec{Burst: 2}, store, policy)
+
+	results := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			ok, _ := dl.AcquirePermission()
+			results <- ok
+		}()
+	}
+
+	// the lock is not held while acquiring, and only one acquisition is
+	// in flight.
+	<-store.calls
+	assert.Eventually(func() bool {
+		if !dl.lock.TryLock() {
+			return false
+		}
+		defer dl.lock.Unlock()
+		return dl.acquiring != nil
+	}, time.Second, time.Millisecond)
+	assert.Len(store.calls, 0)
+
+	close(store.release)
+	assert.True(<-results)
+	assert.True(<-results)
+	assert.Len(store.calls, 0)
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	sprig "github.com/go-task/slim-sprig"
+	"github.com/golang-jwt/jwt"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	librl "github.com/megaease/easegress/v2/pkg/util/ratelimiter"
+)
+
+const (
+	algorithmFixedWindow   = "fixedWindow"
+	algorithmSlidingWindow = "slidingWindow"
+	algorithmGCRA          = "gcra"
+
+	// minIdleTimeout is the min duration before the limiter of an idle key
+	// is removed.
+	minIdleTimeout = time.Minute
+)
+
+type (
+	// keyedLimiter keeps a standalone limiter for each key.
+	keyedLimiter struct {
+		lock        sync.Mutex
+		create      func() *keyEntry
+		entries     map[string]*keyEntry
+		idleTimeout time.Duration
+		lastGC      time.Time
+	}
+
+	keyEntry struct {
+		fixed      *librl.RateLimiter
+		quota      librl.QuotaLimiter
+		lastAccess time.Time
+	}
+
+	// keyTemplateData is the data of the key template.
+	keyTemplateData struct {
+		Method   string
+		Host     string
+		Path     string
+		Query    url.Values
+		ClientIP string
+		Header   http.Header
+		Claims   map[string]interface{}
+	}
+)
+
+func validateAlgorithm(p *Policy) error {
+	switch p.Algorithm {
+	case "", algorithmFixedWindow, algorithmSlidingWindow, algorithmGCRA:
+		return nil
+	default:
+		return fmt.Errorf("policy '%s': unknown algorithm %s", p.Name, p.Algorithm)
+	}
+}
+
+func newKeyTemplate(key string) (*template.Template, error) {
+	return template.New("key").Funcs(sprig.TxtFuncMap()).Parse(key)
+}
+
+func newKeyedLimiter(p *Policy, policy *librl.Policy) *keyedLimiter {
+	kl := &keyedLimiter{
+		entries:     map[string]*keyEntry{},
+		idleTimeout: 2 * policy.LimitRefreshPeriod,
+		lastGC:      time.Now(),
+	}
+	if kl.idleTimeout < minIdleTimeout {
+		kl.idleTimeout = minIdleTimeout
+	}
+
+	switch p.Algorithm {
+	case algorithmSlidingWindow:
+		kl.create = func() *keyEntry {
+			return &keyEntry{quota: librl.NewSlidingWindow(policy.LimitForPeriod, policy.LimitRefreshPeriod)}
+		}
+	case algorithmGCRA:
+		burst := p.Burst
+		if burst <= 0 {
+			burst = policy.LimitForPeriod
+		}
+		kl.create = func() *keyEntry {
+			return &keyEntry{quota: librl.NewGCRA(policy.LimitForPeriod, policy.LimitRefreshPeriod, burst)}
+		}
+	default:
+		kl.create = func() *keyEntry {
+			return &keyEntry{fixed: librl.New(policy)}
+		}
+	}
+
+	return kl
+}
+
+// acquire acquires a permission for the key, the quota is nil if the
+// algorithm does not support quota reports.
+func (kl *keyedLimiter) acquire(key string) (bool, time.Duration, *librl.Quota) {
+	now := time.Now()
+
+	kl.lock.Lock()
+	if now.Sub(kl.lastGC) > kl.idleTimeout {
+		for k, e := range kl.entries {
+			if now.Sub(e.lastAccess) > kl.idleTimeout {
+				delete(kl.entries, k)
+			}
+		}
+		kl.lastGC = now
+	}
+	e := kl.entries[key]
+	if e == nil {
+		e = kl.create()
+		kl.entries[key] = e
+	}
+	e.lastAccess = now
+	kl.lock.Unlock()
+
+	if e.fixed != nil {
+		permitted, d := e.fixed.AcquirePermission()
+		return permitted, d, nil
+	}
+	permitted, quota := e.quota.Allow()
+	return permitted, 0, quota
+}
+
+// limitKey evaluates the key template of the request, requests share the
+// same limiter if the template is not configured.
+func (rl *RateLimiter) limitKey(ctx *context.Context, req *httpprot.Request) string {
+	if rl.keyTemplate == nil {
+		return ""
+	}
+
+	data := &keyTemplateData{
+		Method:   req.Method(),
+		Host:     req.Host(),
+		Path:     req.Path(),
+		Query:    req.URL().Query(),
+		ClientIP: req.RealIP(),
+		Header:   req.HTTPHeader(),
+	}
+	if rl.keyUsesClaims {
+		data.Claims = parseClaims(req)
+	}
+
+	var buf bytes.Buffer
+	if err := rl.keyTemplate.Execute(&buf, data); err != nil {
+		ctx.AddTag(fmt.Sprintf("rateLimiter: failed to evaluate key: %v", err))
+		return ""
+	}
+	return buf.String()
+}
+
+// parseClaims parses the claims of the bearer token without verifying it,
+// the token should be verified by a Validator before the RateLimiter.
+func parseClaims(req *httpprot.Request) map[string]interface{} {
+	const prefix = "Bearer "
+
+	auth := req.HTTPHeader().Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(auth[len(prefix):], claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// setQuotaHeaders sets the RateLimit-* headers defined by the IETF draft
+// "RateLimit header fields for HTTP".
+func setQuotaHeaders(h http.Header, quota *librl.Quota, permitted bool) {
+	reset := strconv.Itoa(int(math.Ceil(quota.Reset.Seconds())))
+	h.Set("RateLimit-Limit", strconv.Itoa(quota.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(quota.Remaining))
+	h.Set("RateLimit-Reset", reset)
+	if !permitted {
+		h.Set("Retry-After", reset)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newSpec(yamlConfig string) (filters.Spec, error) {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	return filters.NewSpec(nil, "", rawSpec)
+}
+
+func newRateLimiter(t *testing.T, yamlConfig string) *RateLimiter {
+	spec, err := newSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rl := kind.CreateInstance(spec).(*RateLimiter)
+	rl.Init()
+	return rl
+}
+
+func newContext(header http.Header) (*context.Context, *httptest.ResponseRecorder) {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/api", nil)
+	stdr.Header = header
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	w := httptest.NewRecorder()
+	ctx.SetData("HTTP_RESPONSE_WRITER", w)
+	return ctx, w
+}
+
+func TestKeyedValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newSpec(`
+kind: RateLimiter
+name: rl
+policies:
+- name: p
+  algorithm: unknown
+defaultPolicyRef: p
+urls:
+- url:
+    prefix: /
+`)
+	assert.Error(err)
+
+	_, err = newSpec(`
+kind: RateLimiter
+name: rl
+policies:
+- name: p
+defaultPolicyRef: p
+key: '{{ .Header.Get '
+urls:
+- url:
+    prefix: /
+`)
+	assert.Error(err)
+
+	_, err = newSpec(`
+kind: RateLimiter
+name: rl
+policies:
+- name: p
+  algorithm: slidingWindow
+defaultPolicyRef: p
+urls:
+- url:
+    prefix: /
+distributed:
+  backend: cluster
+`)
+	assert.Error(err)
+
+	_, err = newSpec(`
+kind: RateLimiter
+name: rl
+policies:
+- name: p
+  algorithm: gcra
+defaultPolicyRef: p
+key: '{{ .ClientIP }}'
+urls:
+- url:
+    prefix: /
+`)
+	assert.NoError(err)
+}
+
+func TestSlidingWindowByHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	rl := newRateLimiter(t, `
+kind: RateLimiter
+name: rl
+policies:
+- name: p
+  algorithm: slidingWindow
+  limitRefreshPeriod: 1m
+  limitForPeriod: 2
+defaultPolicyRef: p
+key: '{{ .Header.Get "X-API-Key" }}'
+rateLimitHeaders: true
+urls:
+- url:
+    prefix: /
+`)
+
+	for i := 0; i < 2; i++ {
+		ctx, w := newContext(http.Header{"X-Api-Key": []string{"a"}})
+		assert.Equal("", rl.Handle(ctx))
+		assert.Equal("2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal([]string{"1", "0"}[i], w.Header().Get("RateLimit-Remaining"))
+	}
+
+	ctx, _ := newContext(http.Header{"X-Api-Key": []string{"a"}})
+	assert.Equal(resultRateLimited, rl.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode())
+	assert.NotEmpty(resp.Header().Get("Retry-After"))
+	assert.Equal("0", resp.Header().Get("RateLimit-Remaining"))
+
+	// other keys have their own quota.
+	ctx, _ = newContext(http.Header{"X-Api-Key": []string{"b"}})
+	assert.Equal("", rl.Handle(ctx))
+}
+
+func TestGCRAByClaim(t *testing.T) {
+	assert := assert.New(t)
+
+	rl := newRateLimiter(t, `
+kind: RateLimiter
+name: rl
+policies:
+- name: p
+  algorithm: gcra
+  limitRefreshPeriod: 1m
+  limitForPeriod: 10
+  burst: 1
+defaultPolicyRef: p
+key: '{{ .Claims.sub }}'
+urls:
+- url:
+    prefix: /
+`)
+
+	sign := func(sub string) http.Header {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": sub})
+		s, _ := token.SignedString([]byte("secret"))
+		return http.Header{"Authorization": []string{"Bearer " + s}}
+	}
+
+	ctx, w := newContext(sign("alice"))
+	assert.Equal("", rl.Handle(ctx))
+	assert.Empty(w.Header().Get("RateLimit-Limit"))
+
+	ctx, _ = newContext(sign("alice"))
+	assert.Equal(resultRateLimited, rl.Handle(ctx))
+
+	ctx, _ = newContext(sign("bob"))
+	assert.Equal("", rl.Handle(ctx))
+}
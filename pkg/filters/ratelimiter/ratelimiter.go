@@ -22,8 +22,11 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
+	"text/template"
 	"time"
 
+	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters"
 	"github.com/megaease/easegress/v2/pkg/logger"
@@ -61,19 +64,32 @@ type (
 		TimeoutDuration    string `json:"timeoutDuration,omitempty" jsonschema:"format=duration"`
 		LimitRefreshPeriod string `json:"limitRefreshPeriod,omitempty" jsonschema:"format=duration"`
 		LimitForPeriod     int    `json:"limitForPeriod,omitempty" jsonschema:"minimum=1"`
+		Algorithm          string `json:"algorithm,omitempty" jsonschema:"enum=,enum=fixedWindow,enum=slidingWindow,enum=gcra"`
+		Burst              int    `json:"burst,omitempty" jsonschema:"minimum=1"`
 	}
 
 	// URLRule defines the rate limiter rule for a URL pattern
 	URLRule struct {
 		urlrule.URLRule `json:",inline"`
 		policy          *Policy
-		rl              *librl.RateLimiter
+		rl              limiter
+		keyed           *keyedLimiter
+	}
+
+	// limiter is the rate limiter of a URL, it could be a local one or a
+	// distributed one.
+	limiter interface {
+		AcquirePermission() (bool, time.Duration)
+		SetStateListener(listener librl.EventListenerFunc)
 	}
 
 	// Spec is the configuration of a rate limiter
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 		Rule             `json:",inline"`
+		Distributed      *DistributedSpec `json:"distributed,omitempty"`
+		Key              string           `json:"key,omitempty"`
+		RateLimitHeaders bool             `json:"rateLimitHeaders,omitempty"`
 	}
 
 	// Rule is the detailed config of RateLimiter.
@@ -85,12 +101,41 @@ type (
 
 	// RateLimiter defines the rate limiter
 	RateLimiter struct {
-		spec *Spec
+		spec          *Spec
+		store         tokenStore
+		keyTemplate   *template.Template
+		keyUsesClaims bool
 	}
 )
 
 // Validate implements custom validation for Spec
 func (spec Spec) Validate() error {
+	for _, p := range spec.Policies {
+		if err := validateAlgorithm(p); err != nil {
+			return err
+		}
+	}
+
+	if spec.Key != "" {
+		if _, err := newKeyTemplate(spec.Key); err != nil {
+			return fmt.Errorf("invalid key: %v", err)
+		}
+	}
+
+	if spec.Distributed != nil {
+		if err := spec.Distributed.Validate(); err != nil {
+			return err
+		}
+		if spec.Key != "" {
+			return fmt.Errorf("key is not supported by distributed rate limiter")
+		}
+		for _, p := range spec.Policies {
+			if p.Algorithm != "" && p.Algorithm != algorithmFixedWindow {
+				return fmt.Errorf("algorithm %s is not supported by distributed rate limiter", p.Algorithm)
+			}
+		}
+	}
+
 URLLoop:
 	for _, u := range spec.URLs {
 		name := u.PolicyRef
@@ -110,7 +155,7 @@ URLLoop:
 	return nil
 }
 
-func (url *URLRule) createRateLimiter() {
+func (url *URLRule) createPolicy() *librl.Policy {
 	policy := librl.Policy{
 		LimitForPeriod: url.policy.LimitForPeriod,
 	}
@@ -131,7 +176,7 @@ func (url *URLRule) createRateLimiter() {
 		policy.LimitRefreshPeriod = 10 * time.Millisecond
 	}
 
-	url.rl = librl.New(&policy)
+	return &policy
 }
 
 // Name returns the name of the RateLimiter filter instance.
@@ -150,6 +195,9 @@ func (rl *RateLimiter) Spec() filters.Spec {
 }
 
 func (rl *RateLimiter) setStateListenerForURL(u *URLRule) {
+	if u.rl == nil {
+		return
+	}
 	u.rl.SetStateListener(func(event *librl.Event) {
 		logger.Infof("state of rate limiter '%s' on URL(%s) transited to %s at %d",
 			rl.spec.Name(),
@@ -177,7 +225,19 @@ func (rl *RateLimiter) bindPolicyToURL(u *URLRule) {
 func (rl *RateLimiter) createRateLimiterForURL(u *URLRule) {
 	u.Init()
 	rl.bindPolicyToURL(u)
-	u.createRateLimiter()
+
+	policy := u.createPolicy()
+	if rl.keyTemplate != nil || (u.policy.Algorithm != "" && u.policy.Algorithm != algorithmFixedWindow) {
+		u.keyed = newKeyedLimiter(u.policy, policy)
+	} else if spec := rl.spec.Distributed; spec != nil {
+		if policy.LimitRefreshPeriod < minDistributedRefreshPeriod {
+			policy.LimitRefreshPeriod = minDistributedRefreshPeriod
+		}
+		u.rl = newDistributedLimiter(rl.spec.Name(), u, spec, rl.store, policy)
+	} else {
+		u.rl = librl.New(policy)
+	}
+
 	rl.setStateListenerForURL(u)
 }
 
@@ -208,7 +268,24 @@ func isSamePolicy(spec1, spec2 *Spec, policyName string) bool {
 }
 
 func (rl *RateLimiter) reload(previousGeneration *RateLimiter) {
-	if previousGeneration == nil {
+	if rl.spec.Key != "" {
+		rl.keyTemplate, _ = newKeyTemplate(rl.spec.Key)
+		rl.keyUsesClaims = strings.Contains(rl.spec.Key, ".Claims")
+	}
+
+	if spec := rl.spec.Distributed; spec != nil {
+		var cls cluster.Cluster
+		if super := rl.spec.Super(); super != nil {
+			cls = super.Cluster()
+		}
+		rl.store = newTokenStore(spec, cls, rl.spec.Pipeline(), rl.spec.Name())
+	}
+
+	// the state of distributed limiters is kept in the store, and the
+	// store of the previous generation is closed after inheriting, so
+	// they are always recreated.
+	if previousGeneration == nil || rl.spec.Distributed != nil || previousGeneration.spec.Distributed != nil ||
+		rl.spec.Key != previousGeneration.spec.Key {
 		for _, u := range rl.spec.URLs {
 			rl.createRateLimiterForURL(u)
 		}
@@ -227,8 +304,8 @@ OuterLoop:
 
 			url.Init()
 			rl.bindPolicyToURL(url)
-			url.rl = prev.rl
-			prev.rl = nil
+			url.rl, url.keyed = prev.rl, prev.keyed
+			prev.rl, prev.keyed = nil, nil
 			rl.setStateListenerForURL(url)
 			continue OuterLoop
 		}
@@ -254,7 +331,18 @@ func (rl *RateLimiter) Handle(ctx *context.Context) string {
 			continue
 		}
 
-		permitted, d := u.rl.AcquirePermission()
+		var permitted bool
+		var d time.Duration
+		var quota *librl.Quota
+		if u.keyed != nil {
+			permitted, d, quota = u.keyed.acquire(rl.limitKey(ctx, req))
+		} else {
+			permitted, d = u.rl.AcquirePermission()
+		}
+		if !rl.spec.RateLimitHeaders {
+			quota = nil
+		}
+
 		if !permitted {
 			ctx.AddTag("rateLimiter: too many requests")
 
@@ -265,11 +353,23 @@ func (rl *RateLimiter) Handle(ctx *context.Context) string {
 
 			resp.SetStatusCode(http.StatusTooManyRequests)
 			resp.HTTPHeader().Set("X-EG-Rate-Limiter", "too-many-requests")
+			if quota != nil {
+				setQuotaHeaders(resp.HTTPHeader(), quota, false)
+			}
 
 			ctx.SetOutputResponse(resp)
 			return resultRateLimited
 		}
 
+		// the response is not available yet, so the headers are set to
+		// the response writer, which are kept unless the response has
+		// the same headers.
+		if quota != nil {
+			if w, ok := ctx.GetData("HTTP_RESPONSE_WRITER").(http.ResponseWriter); ok {
+				setQuotaHeaders(w.Header(), quota, true)
+			}
+		}
+
 		if d <= 0 {
 			break
 		}
@@ -294,4 +394,7 @@ func (rl *RateLimiter) Status() interface{} {
 
 // Close closes RateLimiter.
 func (rl *RateLimiter) Close() {
+	if rl.store != nil {
+		rl.store.close()
+	}
 }
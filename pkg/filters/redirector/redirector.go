@@ -20,6 +20,9 @@ package redirector
 
 import (
 	"errors"
+	"fmt"
+	"net"
+	"net/url"
 	"regexp"
 	"strings"
 
@@ -73,18 +76,43 @@ func init() {
 type (
 	// Redirector is filter to redirect HTTP requests.
 	Redirector struct {
-		spec *Spec
-		re   *regexp.Regexp
+		spec  *Spec
+		re    *regexp.Regexp
+		rules []*rule
 	}
 
 	// Spec describes the Redirector.
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
-		Match       string `json:"match" jsonschema:"required"`
-		MatchPart   string `json:"matchPart,omitempty" jsonschema:"enum=uri,enum=path,enum=full"` // default uri
-		Replacement string `json:"replacement" jsonschema:"required"`
-		StatusCode  int    `json:"statusCode,omitempty"` // default 301
+		Match       string      `json:"match,omitempty"`
+		MatchPart   string      `json:"matchPart,omitempty" jsonschema:"enum=uri,enum=path,enum=full"` // default uri
+		Replacement string      `json:"replacement,omitempty"`
+		StatusCode  int         `json:"statusCode,omitempty"` // default 301
+		Rules       []*RuleSpec `json:"rules,omitempty"`
+	}
+
+	// RuleSpec describes a redirect rule. Scheme, Host and Path are the
+	// conditions to match the request, empty ones match everything. The
+	// redirect fields replace the corresponding parts of the request URL,
+	// RedirectHost and RedirectPath can reference the capture groups of
+	// Host and Path respectively.
+	RuleSpec struct {
+		Scheme string `json:"scheme,omitempty" jsonschema:"enum=,enum=http,enum=https"`
+		Host   string `json:"host,omitempty" jsonschema:"format=regexp"`
+		Path   string `json:"path,omitempty" jsonschema:"format=regexp"`
+
+		RedirectScheme string `json:"redirectScheme,omitempty" jsonschema:"enum=,enum=http,enum=https"`
+		RedirectHost   string `json:"redirectHost,omitempty"`
+		RedirectPath   string `json:"redirectPath,omitempty"`
+		StripQuery     bool   `json:"stripQuery,omitempty"`
+		StatusCode     int    `json:"statusCode,omitempty"` // default to the status code of the spec
+	}
+
+	rule struct {
+		spec   *RuleSpec
+		hostRe *regexp.Regexp
+		pathRe *regexp.Regexp
 	}
 )
 
@@ -93,6 +121,17 @@ func (s *Spec) Validate() error {
 	if _, ok := statusCodeMap[s.StatusCode]; !ok {
 		return errors.New("invalid status code of Redirector, support 300, 301, 302, 303, 304, 307, 308")
 	}
+	if len(s.Rules) > 0 {
+		if s.Match != "" || s.Replacement != "" {
+			return errors.New("match/replacement and rules of Redirector are mutually exclusive")
+		}
+		for i, r := range s.Rules {
+			if err := r.Validate(); err != nil {
+				return fmt.Errorf("invalid rule %d of Redirector: %v", i, err)
+			}
+		}
+		return nil
+	}
 	s.MatchPart = strings.ToLower(s.MatchPart)
 	if !stringtool.StrInSlice(s.MatchPart, []string{matchPartURI, matchPartFull, matchPartPath}) {
 		return errors.New("invalid match part of Redirector, only uri, full and path are supported")
@@ -107,6 +146,25 @@ func (s *Spec) Validate() error {
 	return nil
 }
 
+// Validate validates the rule.
+func (r *RuleSpec) Validate() error {
+	if r.StatusCode != 0 {
+		if _, ok := statusCodeMap[r.StatusCode]; !ok {
+			return errors.New("invalid status code, support 300, 301, 302, 303, 304, 307, 308")
+		}
+	}
+	if r.RedirectScheme == "" && r.RedirectHost == "" && r.RedirectPath == "" && !r.StripQuery {
+		return errors.New("none of redirectScheme, redirectHost, redirectPath and stripQuery is specified")
+	}
+	if _, err := regexp.Compile(r.Host); err != nil {
+		return err
+	}
+	if _, err := regexp.Compile(r.Path); err != nil {
+		return err
+	}
+	return nil
+}
+
 // Name returns the name of the Redirector filter instance.
 func (r *Redirector) Name() string {
 	return r.spec.Name()
@@ -133,7 +191,19 @@ func (r *Redirector) Inherit(previousGeneration filters.Filter) {
 }
 
 func (r *Redirector) reload() {
-	r.re = regexp.MustCompile(r.spec.Match)
+	if len(r.spec.Rules) == 0 {
+		r.re = regexp.MustCompile(r.spec.Match)
+		return
+	}
+
+	r.rules = make([]*rule, 0, len(r.spec.Rules))
+	for _, rs := range r.spec.Rules {
+		r.rules = append(r.rules, &rule{
+			spec:   rs,
+			hostRe: regexp.MustCompile(rs.Host),
+			pathRe: regexp.MustCompile(rs.Path),
+		})
+	}
 }
 
 func (r *Redirector) getMatchInput(req *httpprot.Request) string {
@@ -148,15 +218,93 @@ func (r *Redirector) getMatchInput(req *httpprot.Request) string {
 	}
 }
 
-func (r *Redirector) updateResponse(resp *httpprot.Response, newLocation string) {
-	resp.SetStatusCode(r.spec.StatusCode)
-	resp.SetPayload([]byte(statusCodeMap[r.spec.StatusCode]))
+func (r *Redirector) updateResponse(resp *httpprot.Response, statusCode int, newLocation string) {
+	resp.SetStatusCode(statusCode)
+	resp.SetPayload([]byte(statusCodeMap[statusCode]))
 	resp.Header().Add("Location", newLocation)
 }
 
+// location returns the location to redirect the request to, or an empty
+// string if the rule does not match the request.
+func (r *rule) location(req *httpprot.Request) string {
+	scheme := req.Scheme()
+	if r.spec.Scheme != "" && r.spec.Scheme != scheme {
+		return ""
+	}
+
+	host := req.Host()
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = host, ""
+	}
+	hostMatch := r.hostRe.FindStringSubmatchIndex(hostname)
+	if hostMatch == nil {
+		return ""
+	}
+
+	path := req.Path()
+	pathMatch := r.pathRe.FindStringSubmatchIndex(path)
+	if pathMatch == nil {
+		return ""
+	}
+
+	u := url.URL{Scheme: scheme, Host: host, Path: path, RawQuery: req.URL().RawQuery}
+	if r.spec.RedirectScheme != "" && r.spec.RedirectScheme != scheme {
+		// the port is for the original scheme, so it is dropped.
+		u.Scheme, u.Host, port = r.spec.RedirectScheme, hostname, ""
+	}
+	if r.spec.RedirectHost != "" {
+		u.Host = string(r.hostRe.ExpandString(nil, r.spec.RedirectHost, hostname, hostMatch))
+		if port != "" && !strings.Contains(u.Host, ":") {
+			u.Host = net.JoinHostPort(u.Host, port)
+		}
+	}
+	if r.spec.RedirectPath != "" {
+		u.Path = string(r.pathRe.ExpandString(nil, r.spec.RedirectPath, path, pathMatch))
+	}
+	if r.spec.StripQuery {
+		u.RawQuery = ""
+	}
+
+	return u.String()
+}
+
+func (r *Redirector) handleRules(ctx *context.Context, req *httpprot.Request) string {
+	current := (&url.URL{
+		Scheme:   req.Scheme(),
+		Host:     req.Host(),
+		Path:     req.Path(),
+		RawQuery: req.URL().RawQuery,
+	}).String()
+
+	for _, rule := range r.rules {
+		location := rule.location(req)
+		// don't redirect the request to itself, it results in a loop.
+		if location == "" || location == current {
+			continue
+		}
+
+		statusCode := rule.spec.StatusCode
+		if statusCode == 0 {
+			statusCode = r.spec.StatusCode
+		}
+
+		resp, _ := httpprot.NewResponse(nil)
+		r.updateResponse(resp, statusCode, location)
+		ctx.SetOutputResponse(resp)
+		return resultRedirected
+	}
+
+	return ""
+}
+
 // Handle Redirector Context.
 func (r *Redirector) Handle(ctx *context.Context) string {
 	req := ctx.GetInputRequest().(*httpprot.Request)
+	if len(r.rules) > 0 {
+		return r.handleRules(ctx, req)
+	}
+
 	matchInput := r.getMatchInput(req)
 	newLocation := r.re.ReplaceAllString(matchInput, r.spec.Replacement)
 
@@ -170,7 +318,7 @@ func (r *Redirector) Handle(ctx *context.Context) string {
 	}
 
 	resp, _ := httpprot.NewResponse(nil)
-	r.updateResponse(resp, newLocation)
+	r.updateResponse(resp, r.spec.StatusCode, newLocation)
 	ctx.SetOutputResponse(resp)
 	return resultRedirected
 }
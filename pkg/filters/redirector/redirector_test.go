@@ -18,6 +18,7 @@
 package redirector
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"testing"
@@ -296,3 +297,74 @@ replacement: "123"
 		}
 	}
 }
+
+func TestRules(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlStr := `
+name: filter
+kind: Redirector
+rules:
+- scheme: http
+  redirectScheme: https
+  statusCode: 308
+- host: '^(.+)\.old\.com$'
+  redirectHost: '${1}.new.com'
+- path: '^/docs/(.*)$'
+  redirectPath: '/manual/$1'
+  stripQuery: true
+  statusCode: 302
+`
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlStr), &rawSpec)
+	s, err := filters.NewSpec(nil, "pipeline1", rawSpec)
+	assert.Nil(err)
+
+	r := kind.CreateInstance(s)
+	r.Init()
+
+	for _, c := range []struct {
+		reqURL   string
+		location string
+		code     int
+	}{
+		{"http://example.com:8080/foo?a=1", "https://example.com/foo?a=1", 308},
+		{"https://www.old.com:8443/foo?a=1", "https://www.new.com:8443/foo?a=1", 301},
+		{"https://example.com/docs/intro?a=1", "https://example.com/manual/intro", 302},
+		{"https://example.com/foo", "", 0},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, c.reqURL, nil)
+		req.Host = req.URL.Host
+		if req.URL.Scheme == "https" {
+			req.TLS = &tls.ConnectionState{}
+		}
+		httpReq, _ := httpprot.NewRequest(req)
+
+		ctx := context.New(nil)
+		ctx.SetInputRequest(httpReq)
+		result := r.Handle(ctx)
+
+		if c.location == "" {
+			assert.Equal("", result, c.reqURL)
+			assert.Nil(ctx.GetOutputResponse(), c.reqURL)
+			continue
+		}
+
+		assert.Equal(resultRedirected, result, c.reqURL)
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(c.location, resp.Header().Get("Location"), c.reqURL)
+		assert.Equal(c.code, resp.StatusCode(), c.reqURL)
+	}
+
+	for _, y := range []string{
+		"name: filter\nkind: Redirector\nmatch: '.*'\nreplacement: '123'\nrules:\n- redirectScheme: https",
+		"name: filter\nkind: Redirector\nrules:\n- scheme: http",
+		"name: filter\nkind: Redirector\nrules:\n- path: '++'\n  redirectPath: /",
+		"name: filter\nkind: Redirector\nrules:\n- redirectScheme: https\n  statusCode: 200",
+	} {
+		rawSpec := map[string]interface{}{}
+		codectool.MustUnmarshal([]byte(y), &rawSpec)
+		_, err := filters.NewSpec(nil, "pipeline1", rawSpec)
+		assert.NotNil(err, y)
+	}
+}
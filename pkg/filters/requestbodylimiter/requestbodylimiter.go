@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package requestbodylimiter provides the RequestBodyLimiter filter.
+package requestbodylimiter
+
+import (
+	stdcontext "context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/readers"
+)
+
+const (
+	// Kind is the kind of RequestBodyLimiter.
+	Kind = "RequestBodyLimiter"
+
+	resultTooLarge = "tooLarge"
+
+	// idleTimeout is the duration before the bandwidth limiter of an idle
+	// connection is removed.
+	idleTimeout = time.Minute
+)
+
+var errTooLarge = errors.New("request body is too large")
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "RequestBodyLimiter limits the size and the bandwidth of the request body.",
+	Results:     []string{resultTooLarge},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &RequestBodyLimiter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// RequestBodyLimiter is filter RequestBodyLimiter.
+	RequestBodyLimiter struct {
+		spec *Spec
+
+		lock     sync.Mutex
+		limiters map[string]*connLimiter
+		lastGC   time.Time
+	}
+
+	// connLimiter is the bandwidth limiter of a connection, the requests
+	// of the same connection, e.g. the streams of HTTP/2, share it.
+	connLimiter struct {
+		limiter    *rate.Limiter
+		lastAccess time.Time
+	}
+
+	// Spec describes the RequestBodyLimiter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		MaxBodySize int64 `json:"maxBodySize,omitempty" jsonschema:"minimum=0"`
+		Bandwidth   int64 `json:"bandwidth,omitempty" jsonschema:"minimum=0"`
+	}
+
+	// throttleReader limits the read speed of r with limiter.
+	throttleReader struct {
+		ctx     stdcontext.Context
+		r       io.Reader
+		limiter *rate.Limiter
+	}
+)
+
+// Validate validates the spec of RequestBodyLimiter.
+func (spec *Spec) Validate() error {
+	if spec.MaxBodySize == 0 && spec.Bandwidth == 0 {
+		return fmt.Errorf("at least one of maxBodySize and bandwidth must be specified")
+	}
+	return nil
+}
+
+// Name returns the name of the RequestBodyLimiter filter instance.
+func (rl *RequestBodyLimiter) Name() string {
+	return rl.spec.Name()
+}
+
+// Kind returns the kind of RequestBodyLimiter.
+func (rl *RequestBodyLimiter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the RequestBodyLimiter.
+func (rl *RequestBodyLimiter) Spec() filters.Spec {
+	return rl.spec
+}
+
+// Init initializes RequestBodyLimiter.
+func (rl *RequestBodyLimiter) Init() {
+	rl.limiters = map[string]*connLimiter{}
+	rl.lastGC = time.Now()
+}
+
+// Inherit inherits previous generation of RequestBodyLimiter.
+func (rl *RequestBodyLimiter) Inherit(_ filters.Filter) {
+	rl.Init()
+}
+
+// Handle limits the request body.
+func (rl *RequestBodyLimiter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	if max := rl.spec.MaxBodySize; max > 0 {
+		// reject the request early if its length is known, so a stream
+		// body is not read at all.
+		size := req.ContentLength
+		if !req.IsStream() {
+			size = int64(len(req.RawPayload()))
+		}
+		if size > max {
+			resp, _ := httpprot.NewResponse(nil)
+			resp.SetStatusCode(http.StatusRequestEntityTooLarge)
+			ctx.SetOutputResponse(resp)
+			return resultTooLarge
+		}
+	}
+
+	// The payload has been read into memory if it is not a stream, there
+	// is nothing more to check or to throttle.
+	if !req.IsStream() {
+		return ""
+	}
+
+	var r io.Reader = req.GetPayload()
+	if rl.spec.MaxBodySize > 0 && req.ContentLength < 0 {
+		r = readers.NewLimitReader(r, rl.spec.MaxBodySize, errTooLarge)
+	}
+	if rl.spec.Bandwidth > 0 {
+		r = &throttleReader{
+			ctx:     req.Context(),
+			r:       r,
+			limiter: rl.connLimiter(req.Std().RemoteAddr),
+		}
+	}
+	req.SetPayload(r)
+
+	return ""
+}
+
+// connLimiter returns the bandwidth limiter of the connection from addr,
+// the remote address identifies a connection.
+func (rl *RequestBodyLimiter) connLimiter(addr string) *rate.Limiter {
+	now := time.Now()
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if now.Sub(rl.lastGC) > idleTimeout {
+		for k, cl := range rl.limiters {
+			if now.Sub(cl.lastAccess) > idleTimeout {
+				delete(rl.limiters, k)
+			}
+		}
+		rl.lastGC = now
+	}
+
+	cl := rl.limiters[addr]
+	if cl == nil {
+		bandwidth := rl.spec.Bandwidth
+		cl = &connLimiter{limiter: rate.NewLimiter(rate.Limit(bandwidth), int(bandwidth))}
+		rl.limiters[addr] = cl
+	}
+	cl.lastAccess = now
+	return cl.limiter
+}
+
+// Read implements io.Reader.
+func (tr *throttleReader) Read(p []byte) (int, error) {
+	if burst := tr.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		if werr := tr.limiter.WaitN(tr.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// Status returns status.
+func (rl *RequestBodyLimiter) Status() interface{} {
+	return nil
+}
+
+// Close closes RequestBodyLimiter.
+func (rl *RequestBodyLimiter) Close() {
+}
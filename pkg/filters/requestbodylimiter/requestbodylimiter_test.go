@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestbodylimiter
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newLimiter(t *testing.T, yamlConfig string) *RequestBodyLimiter {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rl := kind.CreateInstance(spec).(*RequestBodyLimiter)
+	rl.Init()
+	return rl
+}
+
+// newContext creates a context whose request body is body, the length of
+// the body is unknown if chunked is true.
+func newContext(t *testing.T, body string, stream, chunked bool) *context.Context {
+	ctx := context.New(nil)
+
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/", strings.NewReader(body))
+	if chunked {
+		stdr.ContentLength = -1
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+	if stream {
+		req.FetchPayload(-1)
+	} else {
+		req.FetchPayload(0)
+	}
+	ctx.SetInputRequest(req)
+
+	return ctx
+}
+
+func TestMaxBodySize(t *testing.T) {
+	assert := assert.New(t)
+
+	rl := newLimiter(t, `
+kind: RequestBodyLimiter
+name: limiter
+maxBodySize: 10
+`)
+
+	ctx := newContext(t, "0123456789", false, false)
+	assert.Equal("", rl.Handle(ctx))
+
+	ctx = newContext(t, "0123456789a", false, false)
+	assert.Equal(resultTooLarge, rl.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusRequestEntityTooLarge, resp.StatusCode())
+
+	// stream with known length is rejected without reading the body.
+	ctx = newContext(t, "0123456789a", true, false)
+	assert.Equal(resultTooLarge, rl.Handle(ctx))
+
+	// stream with unknown length fails while reading.
+	ctx = newContext(t, "0123456789a", true, true)
+	assert.Equal("", rl.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	_, err := io.ReadAll(req.GetPayload())
+	assert.Equal(errTooLarge, err)
+
+	ctx = newContext(t, "0123456789", true, true)
+	assert.Equal("", rl.Handle(ctx))
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	data, err := io.ReadAll(req.GetPayload())
+	assert.Nil(err)
+	assert.Equal("0123456789", string(data))
+}
+
+func TestBandwidth(t *testing.T) {
+	assert := assert.New(t)
+
+	rl := newLimiter(t, `
+kind: RequestBodyLimiter
+name: limiter
+bandwidth: 100
+`)
+
+	body := strings.Repeat("a", 250)
+	ctx := newContext(t, body, true, false)
+	assert.Equal("", rl.Handle(ctx))
+
+	start := time.Now()
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	data, err := io.ReadAll(req.GetPayload())
+	assert.Nil(err)
+	assert.Equal(body, string(data))
+
+	// the first 100 bytes are sent immediately, the others take 1.5s.
+	assert.GreaterOrEqual(time.Since(start), 1400*time.Millisecond)
+
+	spec := &Spec{}
+	assert.Error(spec.Validate())
+
+	newRL := kind.CreateInstance(rl.spec)
+	newRL.Inherit(rl)
+	assert.Nil(newRL.Status())
+	newRL.Close()
+}
+
+func TestConnLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	rl := newLimiter(t, `
+kind: RequestBodyLimiter
+name: limiter
+bandwidth: 100
+`)
+
+	// the requests of the same connection share the limiter.
+	l := rl.connLimiter("127.0.0.1:10000")
+	assert.Same(l, rl.connLimiter("127.0.0.1:10000"))
+	assert.NotSame(l, rl.connLimiter("127.0.0.1:10001"))
+
+	// the limiters of idle connections are removed.
+	rl.limiters["127.0.0.1:10000"].lastAccess = time.Now().Add(-2 * idleTimeout)
+	rl.lastGC = time.Now().Add(-2 * idleTimeout)
+	assert.NotSame(l, rl.connLimiter("127.0.0.1:10000"))
+	assert.Len(rl.limiters, 2)
+}
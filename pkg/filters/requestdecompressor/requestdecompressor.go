@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package requestdecompressor provides the RequestDecompressor filter.
+package requestdecompressor
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/readers"
+)
+
+const (
+	// Kind is the kind of RequestDecompressor.
+	Kind = "RequestDecompressor"
+
+	resultInvalidBody = "invalidBody"
+	resultTooLarge    = "tooLarge"
+
+	encodingGzip    = "gzip"
+	encodingXGzip   = "x-gzip"
+	encodingDeflate = "deflate"
+
+	keyContentEncoding = "Content-Encoding"
+	keyContentLength   = "Content-Length"
+)
+
+var (
+	defaultEncodings = []string{encodingGzip, encodingDeflate}
+
+	errTooLarge = errors.New("decompressed body is too large")
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "RequestDecompressor decompresses the gzip or deflate request body.",
+	Results:     []string{resultInvalidBody, resultTooLarge},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{MaxDecompressedSize: httpprot.DefaultMaxPayloadSize}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &RequestDecompressor{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// RequestDecompressor is filter RequestDecompressor.
+	RequestDecompressor struct {
+		spec      *Spec
+		encodings map[string]bool
+	}
+
+	// Spec describes the RequestDecompressor.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Encodings           []string `json:"encodings,omitempty" jsonschema:"uniqueItems=true"`
+		MaxDecompressedSize int64    `json:"maxDecompressedSize,omitempty" jsonschema:"minimum=1"`
+	}
+)
+
+// Validate validates the spec of RequestDecompressor.
+func (spec *Spec) Validate() error {
+	for _, e := range spec.Encodings {
+		if e != encodingGzip && e != encodingDeflate {
+			return fmt.Errorf("unsupported encoding %q, must be %s or %s", e, encodingGzip, encodingDeflate)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the RequestDecompressor filter instance.
+func (rd *RequestDecompressor) Name() string {
+	return rd.spec.Name()
+}
+
+// Kind returns the kind of RequestDecompressor.
+func (rd *RequestDecompressor) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the RequestDecompressor.
+func (rd *RequestDecompressor) Spec() filters.Spec {
+	return rd.spec
+}
+
+// Init initializes RequestDecompressor.
+func (rd *RequestDecompressor) Init() {
+	rd.reload()
+}
+
+// Inherit inherits previous generation of RequestDecompressor.
+func (rd *RequestDecompressor) Inherit(_ filters.Filter) {
+	rd.Init()
+}
+
+func (rd *RequestDecompressor) reload() {
+	encodings := rd.spec.Encodings
+	if len(encodings) == 0 {
+		encodings = defaultEncodings
+	}
+
+	rd.encodings = map[string]bool{}
+	for _, e := range encodings {
+		rd.encodings[e] = true
+	}
+	if rd.encodings[encodingGzip] {
+		rd.encodings[encodingXGzip] = true
+	}
+}
+
+// Handle decompresses the request body.
+func (rd *RequestDecompressor) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	encodings := rd.parseEncodings(req.HTTPHeader().Values(keyContentEncoding))
+	if len(encodings) == 0 {
+		return ""
+	}
+	if !req.IsStream() && len(req.RawPayload()) == 0 {
+		req.HTTPHeader().Del(keyContentEncoding)
+		return ""
+	}
+
+	// The encodings are listed in the order they were applied, so they
+	// are removed in the reverse order.
+	r := req.GetPayload()
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		if r, err = newReader(encodings[i], r); err != nil {
+			return rd.reject(ctx, resultInvalidBody, http.StatusBadRequest, err)
+		}
+	}
+	r = readers.NewLimitReader(r, rd.maxDecompressedSize(), errTooLarge)
+
+	if req.IsStream() {
+		req.SetPayload(r)
+		req.ContentLength = -1
+		req.HTTPHeader().Del(keyContentLength)
+	} else {
+		data, err := io.ReadAll(r)
+		if err == errTooLarge {
+			return rd.reject(ctx, resultTooLarge, http.StatusRequestEntityTooLarge, err)
+		}
+		if err != nil {
+			return rd.reject(ctx, resultInvalidBody, http.StatusBadRequest, err)
+		}
+		req.SetPayload(data)
+		req.ContentLength = int64(len(data))
+		req.HTTPHeader().Set(keyContentLength, strconv.Itoa(len(data)))
+	}
+
+	req.HTTPHeader().Del(keyContentEncoding)
+	return ""
+}
+
+// parseEncodings returns the content codings of the request, or nil if
+// the body is not encoded or any of the codings is not supported.
+func (rd *RequestDecompressor) parseEncodings(values []string) []string {
+	var encodings []string
+	for _, v := range values {
+		for _, e := range strings.Split(v, ",") {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if e == "" || e == "identity" {
+				continue
+			}
+			if !rd.encodings[e] {
+				return nil
+			}
+			encodings = append(encodings, e)
+		}
+	}
+	return encodings
+}
+
+func (rd *RequestDecompressor) maxDecompressedSize() int64 {
+	if rd.spec.MaxDecompressedSize > 0 {
+		return rd.spec.MaxDecompressedSize
+	}
+	return httpprot.DefaultMaxPayloadSize
+}
+
+func (rd *RequestDecompressor) reject(ctx *context.Context, result string, code int, err error) string {
+	logger.Debugf("%s: decompress request body failed: %v", rd.Name(), err)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	ctx.SetOutputResponse(resp)
+	return result
+}
+
+func newReader(encoding string, r io.Reader) (io.Reader, error) {
+	if encoding != encodingDeflate {
+		return gzip.NewReader(r)
+	}
+
+	// "deflate" should be the zlib format, but some clients send raw
+	// deflate data, so check the zlib header to tell them apart.
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// Status returns status.
+func (rd *RequestDecompressor) Status() interface{} {
+	return nil
+}
+
+// Close closes RequestDecompressor.
+func (rd *RequestDecompressor) Close() {
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestdecompressor
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+var body = strings.Repeat("Easegress is a Cloud Native traffic orchestration system. ", 100)
+
+func newDecompressor(t *testing.T, yamlConfig string) *RequestDecompressor {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rd := kind.CreateInstance(spec).(*RequestDecompressor)
+	rd.Init()
+	return rd
+}
+
+func newContext(t *testing.T, encoding string, payload []byte, stream bool) *context.Context {
+	ctx := context.New(nil)
+
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/", bytes.NewReader(payload))
+	if encoding != "" {
+		stdr.Header.Set("Content-Encoding", encoding)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+	if stream {
+		req.FetchPayload(-1)
+	} else {
+		req.FetchPayload(0)
+	}
+	ctx.SetInputRequest(req)
+
+	return ctx
+}
+
+func compress(encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	assert := assert.New(t)
+
+	rd := newDecompressor(t, `
+kind: RequestDecompressor
+name: decompressor
+`)
+
+	for _, encoding := range []string{"gzip", "deflate", "raw"} {
+		header := encoding
+		if encoding == "raw" {
+			header = "deflate"
+		}
+
+		ctx := newContext(t, header, compress(encoding, []byte(body)), false)
+		assert.Equal("", rd.Handle(ctx))
+		req := ctx.GetInputRequest().(*httpprot.Request)
+		assert.Equal(body, string(req.RawPayload()))
+		assert.Equal("", req.HTTPHeader().Get("Content-Encoding"))
+		assert.Equal(int64(len(body)), req.ContentLength)
+	}
+
+	// stacked encodings.
+	data := compress("gzip", compress("deflate", []byte(body)))
+	ctx := newContext(t, "deflate, gzip", data, false)
+	assert.Equal("", rd.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal(body, string(req.RawPayload()))
+
+	// stream.
+	ctx = newContext(t, "gzip", compress("gzip", []byte(body)), true)
+	assert.Equal("", rd.Handle(ctx))
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.True(req.IsStream())
+	data, err := io.ReadAll(req.GetPayload())
+	assert.Nil(err)
+	assert.Equal(body, string(data))
+
+	// not encoded or unsupported.
+	ctx = newContext(t, "", []byte(body), false)
+	assert.Equal("", rd.Handle(ctx))
+	ctx = newContext(t, "br", []byte(body), false)
+	assert.Equal("", rd.Handle(ctx))
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("br", req.HTTPHeader().Get("Content-Encoding"))
+	assert.Equal(body, string(req.RawPayload()))
+
+	// invalid body.
+	ctx = newContext(t, "gzip", []byte(body), false)
+	assert.Equal(resultInvalidBody, rd.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode())
+}
+
+func TestDecompressionBomb(t *testing.T) {
+	assert := assert.New(t)
+
+	rd := newDecompressor(t, `
+kind: RequestDecompressor
+name: decompressor
+encodings: [gzip]
+maxDecompressedSize: 1024
+`)
+
+	// exactly the limit.
+	data := compress("gzip", bytes.Repeat([]byte{'a'}, 1024))
+	ctx := newContext(t, "gzip", data, false)
+	assert.Equal("", rd.Handle(ctx))
+
+	bomb := compress("gzip", make([]byte, 10*1024*1024))
+	ctx = newContext(t, "gzip", bomb, false)
+	assert.Equal(resultTooLarge, rd.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusRequestEntityTooLarge, resp.StatusCode())
+
+	ctx = newContext(t, "gzip", bomb, true)
+	assert.Equal("", rd.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	_, err := io.ReadAll(req.GetPayload())
+	assert.Equal(errTooLarge, err)
+
+	// deflate is not enabled.
+	ctx = newContext(t, "deflate", compress("deflate", []byte(body)), false)
+	assert.Equal("", rd.Handle(ctx))
+
+	spec := &Spec{Encodings: []string{"br"}}
+	assert.Error(spec.Validate())
+
+	newRD := kind.CreateInstance(rd.spec)
+	newRD.Inherit(rd)
+	assert.Nil(newRD.Status())
+	newRD.Close()
+}
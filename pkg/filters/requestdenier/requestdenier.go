@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package requestdenier provides RequestDenier filter.
+package requestdenier
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of RequestDenier.
+	Kind = "RequestDenier"
+
+	resultDenied = "denied"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "RequestDenier denies requests matching the deny rules.",
+	Results:     []string{resultDenied},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &RequestDenier{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// RequestDenier is filter RequestDenier.
+	RequestDenier struct {
+		spec *Spec
+		hits []*uint64
+	}
+
+	// Spec describes the RequestDenier.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Rules []*Rule `json:"rules" jsonschema:"required"`
+	}
+
+	// Rule is the deny rule.
+	Rule struct {
+		Methods []string                 `json:"methods,omitempty" jsonschema:"uniqueItems=true,format=httpmethod-array"`
+		URL     stringtool.StringMatcher `json:"url" jsonschema:"required"`
+		Code    int                      `json:"code,omitempty" jsonschema:"format=httpcode"`
+		Body    string                   `json:"body,omitempty"`
+	}
+
+	// Status is the status of RequestDenier.
+	Status struct {
+		Rules []*RuleStatus `json:"rules"`
+	}
+
+	// RuleStatus is the status of a deny rule.
+	RuleStatus struct {
+		ID   string `json:"id"`
+		Hits uint64 `json:"hits"`
+	}
+)
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	for i, r := range s.Rules {
+		if err := r.URL.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// ID returns the ID of the rule, rules with the same methods and URL pattern
+// share the same ID.
+func (r *Rule) ID() string {
+	var url string
+	switch {
+	case r.URL.Exact != "":
+		url = r.URL.Exact
+	case r.URL.Prefix != "":
+		url = r.URL.Prefix + "*"
+	default:
+		url = "~" + r.URL.RegEx
+	}
+
+	if len(r.Methods) == 0 {
+		return url
+	}
+	return strings.Join(r.Methods, ",") + " " + url
+}
+
+func (r *Rule) match(req *httpprot.Request) bool {
+	if len(r.Methods) > 0 && !stringtool.StrInSlice(req.Method(), r.Methods) {
+		return false
+	}
+	return r.URL.Match(req.Path())
+}
+
+// Name returns the name of the RequestDenier filter instance.
+func (rd *RequestDenier) Name() string {
+	return rd.spec.Name()
+}
+
+// Kind returns the kind of RequestDenier.
+func (rd *RequestDenier) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the RequestDenier
+func (rd *RequestDenier) Spec() filters.Spec {
+	return rd.spec
+}
+
+// Init initializes RequestDenier.
+func (rd *RequestDenier) Init() {
+	rd.reload(nil)
+}
+
+// Inherit inherits previous generation of RequestDenier, the hit counters
+// of unchanged rules are kept.
+func (rd *RequestDenier) Inherit(previousGeneration filters.Filter) {
+	rd.reload(previousGeneration.(*RequestDenier))
+}
+
+func (rd *RequestDenier) reload(previous *RequestDenier) {
+	prevHits := map[string]*uint64{}
+	if previous != nil {
+		for i, r := range previous.spec.Rules {
+			prevHits[r.ID()] = previous.hits[i]
+		}
+	}
+
+	rd.hits = make([]*uint64, len(rd.spec.Rules))
+	for i, r := range rd.spec.Rules {
+		r.URL.Init()
+		if hits, ok := prevHits[r.ID()]; ok {
+			rd.hits[i] = hits
+		} else {
+			rd.hits[i] = new(uint64)
+		}
+	}
+}
+
+// Handle denies the request if it matches any of the rules.
+func (rd *RequestDenier) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	for i, r := range rd.spec.Rules {
+		if !r.match(req) {
+			continue
+		}
+
+		atomic.AddUint64(rd.hits[i], 1)
+
+		code := r.Code
+		if code == 0 {
+			code = http.StatusForbidden
+		}
+
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(code)
+		resp.SetPayload([]byte(r.Body))
+		ctx.SetOutputResponse(resp)
+		return resultDenied
+	}
+
+	return ""
+}
+
+// Status returns status.
+func (rd *RequestDenier) Status() interface{} {
+	s := &Status{Rules: make([]*RuleStatus, len(rd.spec.Rules))}
+	for i, r := range rd.spec.Rules {
+		s.Rules[i] = &RuleStatus{
+			ID:   r.ID(),
+			Hits: atomic.LoadUint64(rd.hits[i]),
+		}
+	}
+	return s
+}
+
+// Close closes RequestDenier.
+func (rd *RequestDenier) Close() {
+}
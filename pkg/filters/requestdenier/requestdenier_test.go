@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestdenier
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+const yamlConfig = `
+kind: RequestDenier
+name: denier
+rules:
+- url:
+    prefix: /actuator/
+- methods: [DELETE]
+  url:
+    exact: /users
+  code: 405
+  body: not allowed
+`
+
+func newRequestDenier(t *testing.T, yamlConfig string) *RequestDenier {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return kind.CreateInstance(spec).(*RequestDenier)
+}
+
+func newContext(t *testing.T, method, url string) *context.Context {
+	stdr, _ := http.NewRequest(method, url, nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestRequestDenier(t *testing.T) {
+	assert := assert.New(t)
+
+	rd := newRequestDenier(t, yamlConfig)
+	rd.Init()
+	assert.Equal(Kind, rd.Kind().Name)
+	assert.Equal("denier", rd.Name())
+
+	ctx := newContext(t, http.MethodGet, "http://example.com/actuator/health")
+	assert.Equal(resultDenied, rd.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+
+	ctx = newContext(t, http.MethodDelete, "http://example.com/users")
+	assert.Equal(resultDenied, rd.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode())
+	body, err := io.ReadAll(resp.GetPayload())
+	assert.Nil(err)
+	assert.Equal("not allowed", string(body))
+
+	assert.Equal("", rd.Handle(newContext(t, http.MethodGet, "http://example.com/users")))
+	assert.Equal("", rd.Handle(newContext(t, http.MethodGet, "http://example.com/actuator")))
+
+	status := rd.Status().(*Status)
+	assert.Equal(2, len(status.Rules))
+	assert.Equal("/actuator/*", status.Rules[0].ID)
+	assert.Equal(uint64(1), status.Rules[0].Hits)
+	assert.Equal("DELETE /users", status.Rules[1].ID)
+	assert.Equal(uint64(1), status.Rules[1].Hits)
+}
+
+func TestInheritKeepsHits(t *testing.T) {
+	assert := assert.New(t)
+
+	rd := newRequestDenier(t, yamlConfig)
+	rd.Init()
+	rd.Handle(newContext(t, http.MethodGet, "http://example.com/actuator/env"))
+
+	newRD := newRequestDenier(t, `
+kind: RequestDenier
+name: denier
+rules:
+- url:
+    regex: ^/internal/.*
+- url:
+    prefix: /actuator/
+`)
+	newRD.Inherit(rd)
+	rd.Close()
+
+	status := newRD.Status().(*Status)
+	assert.Equal("~^/internal/.*", status.Rules[0].ID)
+	assert.Equal(uint64(0), status.Rules[0].Hits)
+	assert.Equal(uint64(1), status.Rules[1].Hits)
+
+	assert.Equal(resultDenied, newRD.Handle(newContext(t, http.MethodPost, "http://example.com/internal/x")))
+	assert.Equal(uint64(1), newRD.Status().(*Status).Rules[0].Hits)
+}
+
+func TestSpecValidate(t *testing.T) {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(`
+kind: RequestDenier
+name: denier
+rules:
+- methods: [GET]
+  url: {}
+`), &rawSpec)
+
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NotNil(t, err)
+}
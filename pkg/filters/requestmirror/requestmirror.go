@@ -0,0 +1,296 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package requestmirror provides the RequestMirror filter.
+package requestmirror
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/filters/proxies"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of RequestMirror.
+	Kind = "RequestMirror"
+
+	defaultPermil         = 1000
+	defaultMaxBodySize    = 1024 * 1024
+	defaultTimeout        = 5 * time.Second
+	defaultMaxConcurrency = 100
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "RequestMirror duplicates requests to a secondary backend asynchronously.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Permil:         defaultPermil,
+			MaxBodySize:    defaultMaxBodySize,
+			MaxConcurrency: defaultMaxConcurrency,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &RequestMirror{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// RequestMirror is filter RequestMirror.
+	RequestMirror struct {
+		spec *Spec
+
+		lb       *proxies.GeneralLoadBalancer
+		client   *http.Client
+		timeout  time.Duration
+		inflight int32
+		httpStat *httpstat.HTTPStat
+
+		mirrored        uint64
+		skippedBodySize uint64
+		dropped         uint64
+		failed          uint64
+
+		done   stdcontext.Context
+		cancel stdcontext.CancelFunc
+	}
+
+	// Spec describes the RequestMirror.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Servers        []*proxies.Server        `json:"servers" jsonschema:"required,minItems=1"`
+		LoadBalance    *proxies.LoadBalanceSpec `json:"loadBalance,omitempty"`
+		Permil         uint32                   `json:"permil,omitempty" jsonschema:"minimum=1,maximum=1000"`
+		MaxBodySize    int64                    `json:"maxBodySize,omitempty"`
+		Timeout        string                   `json:"timeout,omitempty" jsonschema:"format=duration"`
+		MaxConcurrency int32                    `json:"maxConcurrency,omitempty" jsonschema:"minimum=1"`
+	}
+
+	// Status is the status of RequestMirror.
+	Status struct {
+		// Mirrored is the number of requests sent to the mirror backend.
+		Mirrored uint64 `json:"mirrored"`
+		// SkippedBodySize is the number of requests not mirrored because
+		// their bodies are streams or larger than maxBodySize.
+		SkippedBodySize uint64 `json:"skippedBodySize"`
+		// Dropped is the number of requests not mirrored because there
+		// are too many mirrored requests in flight.
+		Dropped uint64 `json:"dropped"`
+		// Failed is the number of mirrored requests which failed to get a
+		// response.
+		Failed uint64 `json:"failed"`
+
+		Stat *httpstat.Status `json:"stat"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if len(spec.Servers) == 0 {
+		return fmt.Errorf("no servers")
+	}
+	if spec.Permil == 0 || spec.Permil > 1000 {
+		return fmt.Errorf("permil must be in range [1, 1000]")
+	}
+	if spec.Timeout != "" {
+		if _, err := time.ParseDuration(spec.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %s: %v", spec.Timeout, err)
+		}
+	}
+	if lb := spec.LoadBalance; lb != nil {
+		if lb.StickySession != nil || lb.HealthCheck != nil {
+			return fmt.Errorf("sticky session and health check are not supported")
+		}
+		if lb.Policy == proxies.LoadBalancePolicyHeaderHash && lb.HeaderHashKey == "" {
+			return fmt.Errorf("headerHash needs to specify headerHashKey")
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the RequestMirror filter instance.
+func (rm *RequestMirror) Name() string {
+	return rm.spec.Name()
+}
+
+// Kind returns the kind of RequestMirror.
+func (rm *RequestMirror) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the RequestMirror
+func (rm *RequestMirror) Spec() filters.Spec {
+	return rm.spec
+}
+
+// Init initializes RequestMirror.
+func (rm *RequestMirror) Init() {
+	rm.reload()
+}
+
+// Inherit inherits previous generation of RequestMirror.
+func (rm *RequestMirror) Inherit(_ filters.Filter) {
+	rm.reload()
+}
+
+func (rm *RequestMirror) reload() {
+	for _, s := range rm.spec.Servers {
+		s.CheckAddrPattern()
+	}
+
+	lbSpec := rm.spec.LoadBalance
+	if lbSpec == nil {
+		lbSpec = &proxies.LoadBalanceSpec{}
+	}
+	rm.lb = proxies.NewGeneralLoadBalancer(lbSpec, rm.spec.Servers)
+	rm.lb.Init(nil, nil, nil)
+
+	rm.timeout = defaultTimeout
+	if rm.spec.Timeout != "" {
+		rm.timeout, _ = time.ParseDuration(rm.spec.Timeout)
+	}
+
+	rm.client = &http.Client{
+		Timeout: rm.timeout,
+		// the mirror backend should not make Easegress follow redirects.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	rm.httpStat = httpstat.New()
+	rm.done, rm.cancel = stdcontext.WithCancel(stdcontext.Background())
+}
+
+// Handle duplicates the request to the mirror backend if it is selected,
+// it never changes the request and always returns an empty result.
+func (rm *RequestMirror) Handle(ctx *context.Context) string {
+	if rand.Uint32()%1000 >= rm.spec.Permil {
+		return ""
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if req.IsStream() || (rm.spec.MaxBodySize > 0 && req.PayloadSize() > rm.spec.MaxBodySize) {
+		atomic.AddUint64(&rm.skippedBodySize, 1)
+		return ""
+	}
+
+	if atomic.AddInt32(&rm.inflight, 1) > rm.spec.MaxConcurrency {
+		atomic.AddInt32(&rm.inflight, -1)
+		atomic.AddUint64(&rm.dropped, 1)
+		return ""
+	}
+
+	svr := rm.lb.ChooseServer(req)
+	stdr, err := rm.prepareRequest(req, svr)
+	if err != nil {
+		atomic.AddInt32(&rm.inflight, -1)
+		logger.Errorf("%s: failed to prepare mirror request: %v", rm.Name(), err)
+		atomic.AddUint64(&rm.failed, 1)
+		return ""
+	}
+
+	atomic.AddUint64(&rm.mirrored, 1)
+	go rm.send(stdr)
+	return ""
+}
+
+// prepareRequest creates the request to the mirror server, the payload
+// is copied so that the mirror request is independent of the original
+// one, which could be modified or closed by the following filters.
+func (rm *RequestMirror) prepareRequest(req *httpprot.Request, svr *proxies.Server) (*http.Request, error) {
+	url := svr.URL + req.Std().URL.EscapedPath()
+	if rq := req.Std().URL.RawQuery; rq != "" {
+		url += "?" + rq
+	}
+
+	var payload io.Reader
+	if body := req.RawPayload(); len(body) > 0 {
+		payload = bytes.NewReader(append([]byte(nil), body...))
+	}
+
+	stdr, err := http.NewRequestWithContext(rm.done, req.Method(), url, payload)
+	if err != nil {
+		return nil, err
+	}
+	stdr.Header = req.HTTPHeader().Clone()
+
+	// only set host when server address is not host name OR
+	// server is explicitly told to keep the host of the request.
+	if !svr.AddrIsHostName || svr.KeepHost {
+		stdr.Host = req.Host()
+	}
+
+	return stdr, nil
+}
+
+func (rm *RequestMirror) send(stdr *http.Request) {
+	defer atomic.AddInt32(&rm.inflight, -1)
+
+	startAt := fasttime.Now()
+	metric := &httpstat.Metric{ReqSize: uint64(stdr.ContentLength)}
+
+	resp, err := rm.client.Do(stdr)
+	if err != nil {
+		logger.Debugf("%s: failed to send mirror request: %v", rm.Name(), err)
+		atomic.AddUint64(&rm.failed, 1)
+		metric.StatusCode = http.StatusServiceUnavailable
+	} else {
+		n, _ := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		metric.StatusCode = resp.StatusCode
+		metric.RespSize = uint64(n)
+	}
+
+	metric.Duration = fasttime.Since(startAt)
+	rm.httpStat.Stat(metric)
+}
+
+// Status returns status.
+func (rm *RequestMirror) Status() interface{} {
+	return &Status{
+		Mirrored:        atomic.LoadUint64(&rm.mirrored),
+		SkippedBodySize: atomic.LoadUint64(&rm.skippedBodySize),
+		Dropped:         atomic.LoadUint64(&rm.dropped),
+		Failed:          atomic.LoadUint64(&rm.failed),
+		Stat:            rm.httpStat.Status(),
+	}
+}
+
+// Close closes RequestMirror, the mirror requests in flight are canceled.
+func (rm *RequestMirror) Close() {
+	rm.cancel()
+	rm.lb.Close()
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestmirror
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newSpec(yamlConfig string) (filters.Spec, error) {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	return filters.NewSpec(nil, "", rawSpec)
+}
+
+func newRequestMirror(t *testing.T, yamlConfig string) *RequestMirror {
+	spec, err := newSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rm := kind.CreateInstance(spec).(*RequestMirror)
+	rm.Init()
+	return rm
+}
+
+func newContext(body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/orders?id=1", strings.NewReader(body))
+	stdr.Header.Set("X-Foo", "bar")
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newSpec("kind: RequestMirror\nname: rm")
+	assert.NotNil(err)
+
+	_, err = newSpec("kind: RequestMirror\nname: rm\nservers:\n- url: http://127.0.0.1:9095\ntimeout: abc")
+	assert.NotNil(err)
+
+	_, err = newSpec("kind: RequestMirror\nname: rm\nservers:\n- url: http://127.0.0.1:9095\nloadBalance:\n  policy: headerHash")
+	assert.NotNil(err)
+
+	spec, err := newSpec("kind: RequestMirror\nname: rm\nservers:\n- url: http://127.0.0.1:9095")
+	assert.Nil(err)
+	assert.Equal(uint32(1000), spec.(*Spec).Permil)
+}
+
+func TestMirror(t *testing.T) {
+	assert := assert.New(t)
+
+	var received int32
+	headers := make(chan string, 10)
+	bodies := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		body, _ := io.ReadAll(r.Body)
+		headers <- r.URL.RequestURI() + " " + r.Header.Get("X-Foo")
+		bodies <- string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	rm := newRequestMirror(t, `
+kind: RequestMirror
+name: rm
+maxBodySize: 10
+servers:
+- url: `+server.URL)
+	defer rm.Close()
+
+	assert.Equal("", rm.Handle(newContext("hello")))
+	select {
+	case h := <-headers:
+		assert.Equal("/orders?id=1 bar", h)
+		assert.Equal("hello", <-bodies)
+	case <-time.After(3 * time.Second):
+		t.Fatal("mirror request not received")
+	}
+
+	// body too large
+	assert.Equal("", rm.Handle(newContext("hello world")))
+
+	assert.Eventually(func() bool {
+		return rm.Status().(*Status).Stat.Count == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	status := rm.Status().(*Status)
+	assert.Equal(uint64(1), status.Mirrored)
+	assert.Equal(uint64(1), status.SkippedBodySize)
+	assert.Equal(uint64(0), status.Failed)
+	assert.Equal(uint64(0), status.Stat.ErrCount)
+	assert.Equal(int32(1), atomic.LoadInt32(&received))
+}
+
+func TestMirrorFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	rm := newRequestMirror(t, `
+kind: RequestMirror
+name: rm
+timeout: 100ms
+maxConcurrency: 1
+servers:
+- url: `+url)
+	defer rm.Close()
+
+	rm.Inherit(rm)
+
+	assert.Equal("", rm.Handle(newContext("hello")))
+	assert.Eventually(func() bool {
+		return rm.Status().(*Status).Failed == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// simulate a mirror request in flight
+	atomic.AddInt32(&rm.inflight, 1)
+	assert.Equal("", rm.Handle(newContext("hello")))
+	assert.Equal(uint64(1), rm.Status().(*Status).Dropped)
+}
+
+func TestPermil(t *testing.T) {
+	assert := assert.New(t)
+
+	rm := newRequestMirror(t, `
+kind: RequestMirror
+name: rm
+permil: 1
+servers:
+- url: http://127.0.0.1:1
+`)
+	defer rm.Close()
+
+	rm.spec.Permil = 0
+	for i := 0; i < 100; i++ {
+		rm.Handle(newContext(""))
+	}
+	assert.Equal(uint64(0), rm.Status().(*Status).Mirrored)
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestrecorder
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+// Record is a recorded request, records are saved as JSON lines.
+type Record struct {
+	Time   time.Time   `json:"time"`
+	Method string      `json:"method"`
+	Host   string      `json:"host"`
+	URI    string      `json:"uri"`
+	Header http.Header `json:"header,omitempty"`
+	// Body is encoded in base64 in JSON.
+	Body []byte `json:"body,omitempty"`
+}
+
+// NewRecord creates a record from a request, the payload of the request
+// must have been fetched.
+func NewRecord(req *httpprot.Request) *Record {
+	rec := &Record{
+		Time:   time.Now(),
+		Method: req.Method(),
+		Host:   req.Host(),
+		URI:    req.Std().URL.RequestURI(),
+		Header: req.HTTPHeader().Clone(),
+	}
+	if body := req.RawPayload(); len(body) > 0 {
+		rec.Body = append([]byte(nil), body...)
+	}
+	return rec
+}
+
+// ReadRecords reads records from r one by one and calls fn for each of
+// them, it stops at the first error returned by fn.
+func ReadRecords(r io.Reader, fn func(*Record) error) error {
+	decoder := json.NewDecoder(r)
+	for {
+		rec := &Record{}
+		err := decoder.Decode(rec)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(rec); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestrecorder
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const defaultReplayTimeout = 10 * time.Second
+
+type (
+	// ReplayOptions are the options to replay recorded requests.
+	ReplayOptions struct {
+		// Target is the URL to send the requests to, only the scheme and
+		// the host are used.
+		Target string
+		// Rate is the number of requests sent per second, zero means as
+		// fast as possible.
+		Rate float64
+		// Concurrency is the max number of requests in flight.
+		Concurrency int
+		// Timeout is the timeout of each request.
+		Timeout time.Duration
+		// KeepHost sends the requests with their recorded hosts instead of
+		// the host of the target.
+		KeepHost bool
+	}
+
+	// ReplayResult is the result of a replay.
+	ReplayResult struct {
+		Total       int            `json:"total"`
+		Failed      int            `json:"failed"`
+		StatusCodes map[int]int    `json:"statusCodes"`
+		Duration    time.Duration  `json:"duration"`
+		MaxLatency  time.Duration  `json:"maxLatency"`
+		AvgLatency  time.Duration  `json:"avgLatency"`
+		Errors      map[string]int `json:"errors,omitempty"`
+
+		mutex        sync.Mutex
+		totalLatency time.Duration
+	}
+)
+
+// Replay reads the records from r and sends them to the target, it
+// returns after all the requests are completed or ctx is done.
+func Replay(ctx stdcontext.Context, r io.Reader, opts *ReplayOptions) (*ReplayResult, error) {
+	target, err := url.Parse(opts.Target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %s: %v", opts.Target, err)
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid target %s: scheme and host are required", opts.Target)
+	}
+
+	limit := rate.Inf
+	if opts.Rate > 0 {
+		limit = rate.Limit(opts.Rate)
+	}
+	limiter := rate.NewLimiter(limit, 1)
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultReplayTimeout
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	result := &ReplayResult{
+		StatusCodes: map[int]int{},
+		Errors:      map[string]int{},
+	}
+
+	var wg sync.WaitGroup
+	startAt := time.Now()
+
+	err = ReadRecords(r, func(rec *Record) error {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result.add(replayOne(ctx, client, target, rec, opts.KeepHost))
+		}()
+		return nil
+	})
+
+	wg.Wait()
+	result.Duration = time.Since(startAt)
+	if result.Total > 0 {
+		result.AvgLatency = result.totalLatency / time.Duration(result.Total)
+	}
+	return result, err
+}
+
+type replayOutcome struct {
+	statusCode int
+	latency    time.Duration
+	err        error
+}
+
+func replayOne(ctx stdcontext.Context, client *http.Client, target *url.URL, rec *Record, keepHost bool) *replayOutcome {
+	url := target.Scheme + "://" + target.Host + rec.URI
+
+	var body io.Reader
+	if len(rec.Body) > 0 {
+		body = bytes.NewReader(rec.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, rec.Method, url, body)
+	if err != nil {
+		return &replayOutcome{err: err}
+	}
+	for k, vs := range rec.Header {
+		req.Header[k] = vs
+	}
+	if keepHost && rec.Host != "" {
+		req.Host = rec.Host
+	}
+
+	startAt := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return &replayOutcome{err: err, latency: time.Since(startAt)}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return &replayOutcome{statusCode: resp.StatusCode, latency: time.Since(startAt)}
+}
+
+func (r *ReplayResult) add(o *replayOutcome) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Total++
+	r.totalLatency += o.latency
+	if o.latency > r.MaxLatency {
+		r.MaxLatency = o.latency
+	}
+
+	if o.err != nil {
+		r.Failed++
+		// the error message contains the URL, which makes the
+		// errors of the same kind different.
+		msg := o.err.Error()
+		if i := strings.LastIndex(msg, ": "); i >= 0 {
+			msg = msg[i+2:]
+		}
+		r.Errors[msg]++
+		return
+	}
+	r.StatusCodes[o.statusCode]++
+}
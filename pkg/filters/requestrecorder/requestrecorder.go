@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package requestrecorder provides the RequestRecorder filter, and the
+// functions to replay the recorded requests.
+package requestrecorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of RequestRecorder.
+	Kind = "RequestRecorder"
+
+	defaultPermil      = 1000
+	defaultMaxBodySize = 64 * 1024
+	defaultBufferSize  = 1024
+
+	redactedValue = "REDACTED"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "RequestRecorder records requests to a file, so that they can be replayed later.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Permil:      defaultPermil,
+			MaxBodySize: defaultMaxBodySize,
+			BufferSize:  defaultBufferSize,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &RequestRecorder{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// RequestRecorder is filter RequestRecorder.
+	RequestRecorder struct {
+		spec *Spec
+
+		methods map[string]struct{}
+		file    *os.File
+		records chan *Record
+		wg      sync.WaitGroup
+
+		recorded uint64
+		skipped  uint64
+		dropped  uint64
+		failed   uint64
+	}
+
+	// Spec describes the RequestRecorder.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		File          string                               `json:"file" jsonschema:"required"`
+		Permil        uint32                               `json:"permil,omitempty" jsonschema:"minimum=1,maximum=1000"`
+		Methods       []string                             `json:"methods,omitempty" jsonschema:"uniqueItems=true"`
+		Path          *stringtool.StringMatcher            `json:"path,omitempty"`
+		Headers       map[string]*stringtool.StringMatcher `json:"headers,omitempty"`
+		MaxBodySize   int64                                `json:"maxBodySize,omitempty"`
+		RedactHeaders []string                             `json:"redactHeaders,omitempty" jsonschema:"uniqueItems=true"`
+		BufferSize    int                                  `json:"bufferSize,omitempty" jsonschema:"minimum=1"`
+	}
+
+	// Status is the status of RequestRecorder.
+	Status struct {
+		// Recorded is the number of requests written to the file.
+		Recorded uint64 `json:"recorded"`
+		// Skipped is the number of matched requests not recorded because
+		// their bodies are streams or larger than maxBodySize.
+		Skipped uint64 `json:"skipped"`
+		// Dropped is the number of matched requests not recorded because
+		// the buffer is full.
+		Dropped uint64 `json:"dropped"`
+		// Failed is the number of requests failed to be written.
+		Failed uint64 `json:"failed"`
+	}
+)
+
+func validateMatcher(sm *stringtool.StringMatcher) error {
+	if err := sm.Validate(); err != nil {
+		return err
+	}
+	if _, err := regexp.Compile(sm.RegEx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.File == "" {
+		return fmt.Errorf("file is required")
+	}
+	if spec.Permil == 0 || spec.Permil > 1000 {
+		return fmt.Errorf("permil must be in range [1, 1000]")
+	}
+	if spec.Path != nil {
+		if err := validateMatcher(spec.Path); err != nil {
+			return fmt.Errorf("invalid path: %v", err)
+		}
+	}
+	for k, v := range spec.Headers {
+		if err := validateMatcher(v); err != nil {
+			return fmt.Errorf("invalid header %s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the RequestRecorder filter instance.
+func (rr *RequestRecorder) Name() string {
+	return rr.spec.Name()
+}
+
+// Kind returns the kind of RequestRecorder.
+func (rr *RequestRecorder) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the RequestRecorder
+func (rr *RequestRecorder) Spec() filters.Spec {
+	return rr.spec
+}
+
+// Init initializes RequestRecorder.
+func (rr *RequestRecorder) Init() {
+	rr.reload()
+}
+
+// Inherit inherits previous generation of RequestRecorder.
+func (rr *RequestRecorder) Inherit(_ filters.Filter) {
+	rr.reload()
+}
+
+func (rr *RequestRecorder) reload() {
+	rr.methods = make(map[string]struct{}, len(rr.spec.Methods))
+	for _, m := range rr.spec.Methods {
+		rr.methods[m] = struct{}{}
+	}
+	if rr.spec.Path != nil {
+		rr.spec.Path.Init()
+	}
+	for _, v := range rr.spec.Headers {
+		v.Init()
+	}
+
+	file, err := os.OpenFile(rr.spec.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		logger.Errorf("%s: failed to open record file: %v", rr.Name(), err)
+	}
+	rr.file = file
+
+	rr.records = make(chan *Record, rr.spec.BufferSize)
+	rr.wg.Add(1)
+	go rr.run()
+}
+
+// run writes the records to the file, a record is written with a single
+// call to Write, so that the lines are not interleaved when there are
+// multiple writers, e.g. the previous generation of the filter.
+func (rr *RequestRecorder) run() {
+	defer rr.wg.Done()
+
+	for rec := range rr.records {
+		if rr.file == nil {
+			atomic.AddUint64(&rr.failed, 1)
+			continue
+		}
+
+		data, err := json.Marshal(rec)
+		if err == nil {
+			_, err = rr.file.Write(append(data, '\n'))
+		}
+		if err != nil {
+			logger.Errorf("%s: failed to write record: %v", rr.Name(), err)
+			atomic.AddUint64(&rr.failed, 1)
+			continue
+		}
+		atomic.AddUint64(&rr.recorded, 1)
+	}
+}
+
+func (rr *RequestRecorder) match(req *httpprot.Request) bool {
+	if len(rr.methods) > 0 {
+		if _, ok := rr.methods[req.Method()]; !ok {
+			return false
+		}
+	}
+	if rr.spec.Path != nil && !rr.spec.Path.Match(req.Path()) {
+		return false
+	}
+	for k, v := range rr.spec.Headers {
+		if !v.MatchAny(req.HTTPHeader().Values(k)) {
+			return false
+		}
+	}
+	return rand.Uint32()%1000 < rr.spec.Permil
+}
+
+// Handle records the request if it matches, it never changes the request
+// and always returns an empty result.
+func (rr *RequestRecorder) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if !rr.match(req) {
+		return ""
+	}
+
+	if req.IsStream() || (rr.spec.MaxBodySize > 0 && req.PayloadSize() > rr.spec.MaxBodySize) {
+		atomic.AddUint64(&rr.skipped, 1)
+		return ""
+	}
+
+	rec := NewRecord(req)
+	for _, k := range rr.spec.RedactHeaders {
+		if rec.Header.Get(k) != "" {
+			rec.Header.Set(k, redactedValue)
+		}
+	}
+
+	select {
+	case rr.records <- rec:
+	default:
+		atomic.AddUint64(&rr.dropped, 1)
+	}
+	return ""
+}
+
+// Status returns status.
+func (rr *RequestRecorder) Status() interface{} {
+	return &Status{
+		Recorded: atomic.LoadUint64(&rr.recorded),
+		Skipped:  atomic.LoadUint64(&rr.skipped),
+		Dropped:  atomic.LoadUint64(&rr.dropped),
+		Failed:   atomic.LoadUint64(&rr.failed),
+	}
+}
+
+// Close closes RequestRecorder, the buffered records are written to the
+// file before it returns.
+func (rr *RequestRecorder) Close() {
+	close(rr.records)
+	rr.wg.Wait()
+	if rr.file != nil {
+		rr.file.Close()
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestrecorder
+
+import (
+	stdcontext "context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newSpec(yamlConfig string) (filters.Spec, error) {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	return filters.NewSpec(nil, "", rawSpec)
+}
+
+func newRequestRecorder(t *testing.T, yamlConfig string) *RequestRecorder {
+	spec, err := newSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rr := kind.CreateInstance(spec).(*RequestRecorder)
+	rr.Init()
+	return rr
+}
+
+func newContext(method, url, body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(method, url, strings.NewReader(body))
+	stdr.Header.Set("X-Env", "test")
+	stdr.Header.Set("Authorization", "Bearer token")
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newSpec("kind: RequestRecorder\nname: rr")
+	assert.NotNil(err)
+
+	_, err = newSpec("kind: RequestRecorder\nname: rr\nfile: /tmp/a.jsonl\npath:\n  regex: '('")
+	assert.NotNil(err)
+
+	_, err = newSpec("kind: RequestRecorder\nname: rr\nfile: /tmp/a.jsonl\nheaders:\n  X-Env: {}")
+	assert.NotNil(err)
+
+	spec, err := newSpec("kind: RequestRecorder\nname: rr\nfile: /tmp/a.jsonl")
+	assert.Nil(err)
+	assert.Equal(uint32(1000), spec.(*Spec).Permil)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	file := filepath.Join(t.TempDir(), "records.jsonl")
+	rr := newRequestRecorder(t, `
+kind: RequestRecorder
+name: rr
+file: `+file+`
+methods: [POST, PUT]
+path:
+  prefix: /api/
+headers:
+  X-Env:
+    exact: test
+maxBodySize: 10
+redactHeaders: [Authorization]
+`)
+
+	rr.Handle(newContext(http.MethodPost, "http://example.com/api/orders?id=1", "hello"))
+	rr.Handle(newContext(http.MethodPut, "http://example.com/api/orders/1", ""))
+	// not matched
+	rr.Handle(newContext(http.MethodGet, "http://example.com/api/orders", ""))
+	rr.Handle(newContext(http.MethodPost, "http://example.com/other", ""))
+	// body too large
+	rr.Handle(newContext(http.MethodPost, "http://example.com/api/orders", "hello world"))
+	rr.Close()
+
+	status := rr.Status().(*Status)
+	assert.Equal(uint64(2), status.Recorded)
+	assert.Equal(uint64(1), status.Skipped)
+	assert.Equal(uint64(0), status.Failed)
+
+	f, err := os.Open(file)
+	assert.Nil(err)
+	var records []*Record
+	err = ReadRecords(f, func(rec *Record) error {
+		records = append(records, rec)
+		return nil
+	})
+	f.Close()
+	assert.Nil(err)
+	assert.Len(records, 2)
+	assert.Equal(http.MethodPost, records[0].Method)
+	assert.Equal("/api/orders?id=1", records[0].URI)
+	assert.Equal("example.com", records[0].Host)
+	assert.Equal("hello", string(records[0].Body))
+	assert.Equal(redactedValue, records[0].Header.Get("Authorization"))
+
+	var received int32
+	bodies := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		body, _ := io.ReadAll(r.Body)
+		bodies <- r.Method + " " + r.Host + r.URL.RequestURI() + " " + string(body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	f, _ = os.Open(file)
+	defer f.Close()
+	result, err := Replay(stdcontext.Background(), f, &ReplayOptions{
+		Target:      server.URL,
+		Rate:        100,
+		Concurrency: 2,
+		KeepHost:    true,
+	})
+	assert.Nil(err)
+	assert.Equal(2, result.Total)
+	assert.Equal(0, result.Failed)
+	assert.Equal(2, result.StatusCodes[http.StatusCreated])
+
+	close(bodies)
+	var got []string
+	for b := range bodies {
+		got = append(got, b)
+	}
+	assert.ElementsMatch([]string{
+		"POST example.com/api/orders?id=1 hello",
+		"PUT example.com/api/orders/1 ",
+	}, got)
+}
+
+func TestReplayFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Replay(stdcontext.Background(), strings.NewReader(""), &ReplayOptions{Target: "no-scheme"})
+	assert.NotNil(err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	target := server.URL
+	server.Close()
+
+	records := `{"method":"GET","uri":"/a"}
+{"method":"GET","uri":"/b"}
+`
+	result, err := Replay(stdcontext.Background(), strings.NewReader(records), &ReplayOptions{
+		Target:  target,
+		Timeout: time.Second,
+	})
+	assert.Nil(err)
+	assert.Equal(2, result.Total)
+	assert.Equal(2, result.Failed)
+	assert.Len(result.Errors, 1)
+
+	_, err = Replay(stdcontext.Background(), strings.NewReader("not json"), &ReplayOptions{Target: target})
+	assert.NotNil(err)
+}
@@ -0,0 +1,476 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package responsecache provides the ResponseCache filter.
+package responsecache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of ResponseCache.
+	Kind = "ResponseCache"
+
+	resultHit = "hit"
+
+	defaultMaxEntryBytes  = 1 << 20
+	defaultMaxMemoryBytes = 64 << 20
+
+	keyCacheControl = "Cache-Control"
+	keyETag         = "ETag"
+	keyIfNoneMatch  = "If-None-Match"
+	keyAge          = "Age"
+	keySetCookie    = "Set-Cookie"
+	keyVary         = "Vary"
+	keyAuth         = "Authorization"
+	keyCookie       = "Cookie"
+
+	// dataKeyPrefix is the prefix of the context data key which records
+	// the lookup of a request, the data tells the second run of the filter
+	// in the same flow to store the response.
+	dataKeyPrefix = "RESPONSE_CACHE_"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ResponseCache caches the responses of the upstream.",
+	Results:     []string{resultHit},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Methods: []string{http.MethodGet, http.MethodHead},
+			Codes:   []int{http.StatusOK},
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ResponseCache{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ResponseCache is filter ResponseCache.
+	ResponseCache struct {
+		spec *Spec
+
+		ttl    time.Duration
+		memory *memoryStore
+		shared *sharedStore
+
+		hits   uint64
+		misses uint64
+	}
+
+	// Spec describes the ResponseCache.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// TTL is the time to live of the responses without max-age.
+		TTL     string   `json:"ttl" jsonschema:"required,format=duration"`
+		Methods []string `json:"methods,omitempty" jsonschema:"uniqueItems=true,format=httpmethod-array"`
+		Codes   []int    `json:"codes,omitempty" jsonschema:"uniqueItems=true,format=httpcode-array"`
+		// Headers are the request headers which are part of the cache key
+		// besides the method and the URL.
+		Headers        []string `json:"headers,omitempty" jsonschema:"uniqueItems=true"`
+		MaxEntryBytes  uint32   `json:"maxEntryBytes,omitempty"`
+		MaxMemoryBytes uint64   `json:"maxMemoryBytes,omitempty"`
+		// Shared enables the cache tier shared by the cluster members,
+		// it is looked up when the local cache misses. Every local miss
+		// costs a synchronous read of the cluster storage, and only the
+		// entries smaller than maxSharedEntryBytes are shared.
+		Shared bool `json:"shared,omitempty"`
+	}
+
+	// Status is the status of ResponseCache.
+	Status struct {
+		Entries int    `json:"entries"`
+		Bytes   uint64 `json:"bytes"`
+		Hits    uint64 `json:"hits"`
+		Misses  uint64 `json:"misses"`
+	}
+
+	// lookup is the result of looking up the cache for a request.
+	lookup struct {
+		key string
+		// stale is the stale entry being revalidated with its ETag.
+		stale *entry
+	}
+)
+
+// Name returns the name of the ResponseCache filter instance.
+func (rc *ResponseCache) Name() string {
+	return rc.spec.Name()
+}
+
+// Kind returns the kind of ResponseCache.
+func (rc *ResponseCache) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ResponseCache
+func (rc *ResponseCache) Spec() filters.Spec {
+	return rc.spec
+}
+
+// Init initializes ResponseCache.
+func (rc *ResponseCache) Init() {
+	rc.reload()
+	rc.memory = newMemoryStore(rc.maxMemoryBytes())
+}
+
+// Inherit inherits previous generation of ResponseCache, the cached
+// responses are kept.
+func (rc *ResponseCache) Inherit(previousGeneration filters.Filter) {
+	rc.reload()
+
+	prev := previousGeneration.(*ResponseCache)
+	rc.memory = prev.memory
+	rc.memory.setMaxBytes(rc.maxMemoryBytes())
+	rc.hits = atomic.LoadUint64(&prev.hits)
+	rc.misses = atomic.LoadUint64(&prev.misses)
+}
+
+func (rc *ResponseCache) reload() {
+	ttl, err := time.ParseDuration(rc.spec.TTL)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", rc.spec.TTL, err)
+		ttl = 10 * time.Second
+	}
+	rc.ttl = ttl
+
+	if rc.spec.Shared && rc.spec.Super() != nil && rc.spec.Super().Cluster() != nil {
+		rc.shared = &sharedStore{
+			cls:      rc.spec.Super().Cluster(),
+			pipeline: rc.spec.Pipeline(),
+			name:     rc.spec.Name(),
+		}
+	}
+}
+
+func (rc *ResponseCache) maxMemoryBytes() uint64 {
+	if rc.spec.MaxMemoryBytes == 0 {
+		return defaultMaxMemoryBytes
+	}
+	return rc.spec.MaxMemoryBytes
+}
+
+func (rc *ResponseCache) maxEntryBytes() int {
+	if rc.spec.MaxEntryBytes == 0 {
+		return defaultMaxEntryBytes
+	}
+	return int(rc.spec.MaxEntryBytes)
+}
+
+func (rc *ResponseCache) dataKey() string {
+	return dataKeyPrefix + rc.spec.Name()
+}
+
+// Handle looks up the cache for the request when it runs before the
+// proxy, and stores the response when it runs again after the proxy.
+func (rc *ResponseCache) Handle(ctx *context.Context) string {
+	if l, ok := ctx.GetData(rc.dataKey()).(*lookup); ok {
+		rc.store(ctx, l)
+		return ""
+	}
+
+	return rc.load(ctx)
+}
+
+func (rc *ResponseCache) key(req *httpprot.Request) string {
+	parts := []string{req.Method(), " ", req.Scheme(), "://", req.Host(), req.URL().RequestURI()}
+	for _, h := range rc.spec.Headers {
+		parts = append(parts, "\n", h, ":", strings.Join(req.HTTPHeader().Values(h), ","))
+	}
+	return stringtool.Cat(parts...)
+}
+
+func (rc *ResponseCache) load(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	if !stringtool.StrInSlice(req.Method(), rc.spec.Methods) {
+		return ""
+	}
+
+	reqDirectives := parseCacheControl(req.HTTPHeader().Values(keyCacheControl))
+	if _, ok := reqDirectives["no-store"]; ok {
+		return ""
+	}
+
+	l := &lookup{key: rc.key(req)}
+	ctx.SetData(rc.dataKey(), l)
+
+	// no-cache requires the response from the upstream, which is still
+	// stored for the following requests.
+	if _, ok := reqDirectives["no-cache"]; ok {
+		atomic.AddUint64(&rc.misses, 1)
+		return ""
+	}
+
+	e := rc.memory.get(l.key)
+	if e != nil && !e.matchVary(req) {
+		e = nil
+	}
+	if (e == nil || !e.fresh(time.Now())) && rc.shared != nil {
+		if se := rc.shared.get(l.key); se != nil && se.matchVary(req) {
+			rc.memory.put(se)
+			e = se
+		}
+	}
+
+	if e == nil {
+		atomic.AddUint64(&rc.misses, 1)
+		return ""
+	}
+
+	if !e.fresh(time.Now()) {
+		atomic.AddUint64(&rc.misses, 1)
+		// Revalidate the stale entry, unless the client does it itself.
+		if e.ETag != "" && req.HTTPHeader().Get(keyIfNoneMatch) == "" {
+			req.HTTPHeader().Set(keyIfNoneMatch, e.ETag)
+			l.stale = e
+		}
+		return ""
+	}
+
+	atomic.AddUint64(&rc.hits, 1)
+	ctx.SetData(rc.dataKey(), nil)
+
+	if e.ETag != "" && etagMatch(req.HTTPHeader().Get(keyIfNoneMatch), e.ETag) {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusNotModified)
+		resp.HTTPHeader().Set(keyETag, e.ETag)
+		ctx.SetOutputResponse(resp)
+		return resultHit
+	}
+
+	ctx.SetOutputResponse(e.response(time.Now()))
+	return resultHit
+}
+
+func (rc *ResponseCache) store(ctx *context.Context, l *lookup) {
+	resp, ok := ctx.GetInputResponse().(*httpprot.Response)
+	if !ok || resp == nil {
+		return
+	}
+
+	respDirectives := parseCacheControl(resp.HTTPHeader().Values(keyCacheControl))
+
+	if l.stale != nil && resp.StatusCode() == http.StatusNotModified {
+		e := *l.stale
+		e.Stored = time.Now()
+		e.Expires = e.Stored.Add(rc.responseTTL(respDirectives))
+		rc.put(&e)
+		ctx.SetOutputResponse(e.response(time.Now()))
+		return
+	}
+
+	if resp.IsStream() || !rc.matchCode(resp.StatusCode()) {
+		return
+	}
+
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := respDirectives[d]; ok {
+			return
+		}
+	}
+
+	// Responses setting cookies are specific to the client.
+	if resp.HTTPHeader().Get(keySetCookie) != "" {
+		return
+	}
+
+	// Responses to the requests with credentials are specific to the
+	// client, unless they are explicitly allowed in shared caches.
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if req.HTTPHeader().Get(keyAuth) != "" || req.HTTPHeader().Get(keyCookie) != "" {
+		_, public := respDirectives["public"]
+		_, sMaxAge := respDirectives["s-maxage"]
+		if !public && !sMaxAge {
+			return
+		}
+	}
+
+	vary, ok := varyValues(req, resp)
+	if !ok {
+		return
+	}
+
+	body := resp.RawPayload()
+	if len(body) > rc.maxEntryBytes() {
+		return
+	}
+
+	ttl := rc.responseTTL(respDirectives)
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	header := resp.HTTPHeader().Clone()
+	header.Del(keyAge)
+	rc.put(&entry{
+		Key:        l.key,
+		StatusCode: resp.StatusCode(),
+		Header:     header,
+		Body:       append([]byte(nil), body...),
+		ETag:       resp.HTTPHeader().Get(keyETag),
+		Vary:       vary,
+		Stored:     now,
+		Expires:    now.Add(ttl),
+	})
+}
+
+// varyValues returns the values of the request headers listed in the
+// Vary header of the response, false means the response varies on
+// something other than the request headers and can't be cached.
+func varyValues(req *httpprot.Request, resp *httpprot.Response) (map[string]string, bool) {
+	var vary map[string]string
+	for _, value := range resp.HTTPHeader().Values(keyVary) {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, false
+			}
+			if vary == nil {
+				vary = make(map[string]string)
+			}
+			name = http.CanonicalHeaderKey(name)
+			vary[name] = strings.Join(req.HTTPHeader().Values(name), ",")
+		}
+	}
+	return vary, true
+}
+
+// matchVary reports whether the request selects the entry, that is, the
+// request headers listed in Vary are the same as the stored ones.
+func (e *entry) matchVary(req *httpprot.Request) bool {
+	for name, value := range e.Vary {
+		if strings.Join(req.HTTPHeader().Values(name), ",") != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (rc *ResponseCache) matchCode(code int) bool {
+	for _, c := range rc.spec.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (rc *ResponseCache) put(e *entry) {
+	rc.memory.put(e)
+	if rc.shared != nil {
+		go rc.shared.put(e)
+	}
+}
+
+// responseTTL returns the TTL of the response, s-maxage is preferred as
+// the cache is shared by the clients.
+func (rc *ResponseCache) responseTTL(directives map[string]string) time.Duration {
+	for _, d := range []string{"s-maxage", "max-age"} {
+		v, ok := directives[d]
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			continue
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	return rc.ttl
+}
+
+func (e *entry) response(now time.Time) *httpprot.Response {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(e.StatusCode)
+	for k, values := range e.Header {
+		for _, v := range values {
+			resp.HTTPHeader().Add(k, v)
+		}
+	}
+	resp.HTTPHeader().Set(keyAge, strconv.Itoa(int(now.Sub(e.Stored).Seconds())))
+	resp.SetPayload(e.Body)
+	return resp
+}
+
+// parseCacheControl parses the Cache-Control header values into directives.
+func parseCacheControl(values []string) map[string]string {
+	directives := map[string]string{}
+	for _, value := range values {
+		for _, d := range strings.Split(value, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			name, arg, _ := strings.Cut(d, "=")
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+// etagMatch reports whether the If-None-Match header matches the ETag.
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(v), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns status.
+func (rc *ResponseCache) Status() interface{} {
+	entries, bytes := rc.memory.stat()
+	return &Status{
+		Entries: entries,
+		Bytes:   bytes,
+		Hits:    atomic.LoadUint64(&rc.hits),
+		Misses:  atomic.LoadUint64(&rc.misses),
+	}
+}
+
+// Close closes ResponseCache.
+func (rc *ResponseCache) Close() {}
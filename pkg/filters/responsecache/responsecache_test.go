@@ -0,0 +1,311 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package responsecache
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+const yamlConfig = `
+kind: ResponseCache
+name: cache
+ttl: 10s
+headers: [Accept-Language]
+maxEntryBytes: 16
+`
+
+func newResponseCache(t *testing.T, yamlConfig string) *ResponseCache {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rc := kind.CreateInstance(spec).(*ResponseCache)
+	rc.Init()
+	return rc
+}
+
+func newContext(t *testing.T, method, url string, header http.Header) *context.Context {
+	stdr, _ := http.NewRequest(method, url, nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+// serve runs the cache filter around an upstream returning resp, it
+// returns the response to the client and whether the upstream is called.
+func serve(rc *ResponseCache, ctx *context.Context, upstream func(req *httpprot.Request) *httpprot.Response) (*httpprot.Response, bool) {
+	if rc.Handle(ctx) == resultHit {
+		return ctx.GetOutputResponse().(*httpprot.Response), false
+	}
+
+	ctx.SetOutputResponse(upstream(ctx.GetInputRequest().(*httpprot.Request)))
+	rc.Handle(ctx)
+	return ctx.GetOutputResponse().(*httpprot.Response), true
+}
+
+func newUpstreamResponse(code int, body string, header http.Header) *httpprot.Response {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	for k, v := range header {
+		resp.HTTPHeader()[k] = v
+	}
+	resp.SetPayload([]byte(body))
+	return resp
+}
+
+func TestResponseCache(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newResponseCache(t, yamlConfig)
+	assert.Equal(Kind, rc.Kind().Name)
+	assert.Equal("cache", rc.Name())
+
+	calls := 0
+	upstream := func(req *httpprot.Request) *httpprot.Response {
+		calls++
+		return newUpstreamResponse(http.StatusOK, "hello", http.Header{"Etag": {`"v1"`}})
+	}
+
+	header := http.Header{"Accept-Language": {"en"}}
+	resp, called := serve(rc, newContext(t, http.MethodGet, "http://example.com/a?x=1", header), upstream)
+	assert.True(called)
+	assert.Equal("hello", string(resp.RawPayload()))
+
+	resp, called = serve(rc, newContext(t, http.MethodGet, "http://example.com/a?x=1", header), upstream)
+	assert.False(called)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("hello", string(resp.RawPayload()))
+	assert.NotEmpty(resp.HTTPHeader().Get(keyAge))
+
+	// Different query, selected header and method are different keys.
+	serve(rc, newContext(t, http.MethodGet, "http://example.com/a?x=2", header), upstream)
+	serve(rc, newContext(t, http.MethodGet, "http://example.com/a?x=1", http.Header{"Accept-Language": {"fr"}}), upstream)
+	serve(rc, newContext(t, http.MethodPost, "http://example.com/a?x=1", header), upstream)
+	assert.Equal(4, calls)
+
+	// Conditional requests are answered with 304.
+	resp, called = serve(rc, newContext(t, http.MethodGet, "http://example.com/a?x=1",
+		http.Header{"Accept-Language": {"en"}, "If-None-Match": {`"v1"`}}), upstream)
+	assert.False(called)
+	assert.Equal(http.StatusNotModified, resp.StatusCode())
+
+	// no-cache goes to the upstream.
+	_, called = serve(rc, newContext(t, http.MethodGet, "http://example.com/a?x=1",
+		http.Header{"Accept-Language": {"en"}, "Cache-Control": {"no-cache"}}), upstream)
+	assert.True(called)
+
+	status := rc.Status().(*Status)
+	assert.Equal(uint64(2), status.Hits)
+	assert.Equal(3, status.Entries)
+
+	newRC := kind.CreateInstance(rc.spec).(*ResponseCache)
+	newRC.Inherit(rc)
+	_, called = serve(newRC, newContext(t, http.MethodGet, "http://example.com/a?x=1", header), upstream)
+	assert.False(called)
+	newRC.Close()
+}
+
+func TestResponseCacheNotStored(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newResponseCache(t, yamlConfig)
+
+	cases := []*httpprot.Response{
+		newUpstreamResponse(http.StatusInternalServerError, "error", nil),
+		newUpstreamResponse(http.StatusOK, "private", http.Header{"Cache-Control": {"private"}}),
+		newUpstreamResponse(http.StatusOK, "no-store", http.Header{"Cache-Control": {"no-store"}}),
+		newUpstreamResponse(http.StatusOK, "max-age=0", http.Header{"Cache-Control": {"max-age=0"}}),
+		newUpstreamResponse(http.StatusOK, "cookie", http.Header{"Set-Cookie": {"a=b"}}),
+		newUpstreamResponse(http.StatusOK, "a body larger than max entry bytes", nil),
+	}
+
+	for _, c := range cases {
+		upstream := func(req *httpprot.Request) *httpprot.Response { return c }
+		serve(rc, newContext(t, http.MethodGet, "http://example.com/", nil), upstream)
+		_, called := serve(rc, newContext(t, http.MethodGet, "http://example.com/", nil), upstream)
+		assert.True(called, string(c.RawPayload()))
+	}
+}
+
+func TestResponseCacheCredentials(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		header http.Header
+		cached bool
+	}{
+		{header: nil, cached: false},
+		{header: http.Header{"Cache-Control": {"public"}}, cached: true},
+		{header: http.Header{"Cache-Control": {"s-maxage=60"}}, cached: true},
+		{header: http.Header{"Cache-Control": {"max-age=60"}}, cached: false},
+	}
+
+	for _, credential := range []string{"Authorization", "Cookie"} {
+		for _, c := range cases {
+			rc := newResponseCache(t, yamlConfig)
+			upstream := func(req *httpprot.Request) *httpprot.Response {
+				return newUpstreamResponse(http.StatusOK, "hello", c.header)
+			}
+
+			header := http.Header{credential: {"secret"}}
+			serve(rc, newContext(t, http.MethodGet, "http://example.com/", header), upstream)
+			_, called := serve(rc, newContext(t, http.MethodGet, "http://example.com/", header), upstream)
+			assert.Equal(!c.cached, called, "%s %v", credential, c.header)
+		}
+	}
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newResponseCache(t, yamlConfig)
+
+	calls := 0
+	upstream := func(req *httpprot.Request) *httpprot.Response {
+		calls++
+		return newUpstreamResponse(http.StatusOK, req.HTTPHeader().Get("Accept-Encoding"), http.Header{"Vary": {"accept-encoding"}})
+	}
+
+	gzip := http.Header{"Accept-Encoding": {"gzip"}}
+	br := http.Header{"Accept-Encoding": {"br"}}
+
+	serve(rc, newContext(t, http.MethodGet, "http://example.com/", gzip), upstream)
+	resp, called := serve(rc, newContext(t, http.MethodGet, "http://example.com/", gzip), upstream)
+	assert.False(called)
+	assert.Equal("gzip", string(resp.RawPayload()))
+
+	// The stored variant doesn't match, and is replaced.
+	resp, called = serve(rc, newContext(t, http.MethodGet, "http://example.com/", br), upstream)
+	assert.True(called)
+	assert.Equal("br", string(resp.RawPayload()))
+	resp, called = serve(rc, newContext(t, http.MethodGet, "http://example.com/", br), upstream)
+	assert.False(called)
+	assert.Equal("br", string(resp.RawPayload()))
+	assert.Equal(2, calls)
+
+	// Vary: * is never cached.
+	upstream = func(req *httpprot.Request) *httpprot.Response {
+		return newUpstreamResponse(http.StatusOK, "star", http.Header{"Vary": {"*"}})
+	}
+	serve(rc, newContext(t, http.MethodGet, "http://example.com/star", nil), upstream)
+	_, called = serve(rc, newContext(t, http.MethodGet, "http://example.com/star", nil), upstream)
+	assert.True(called)
+}
+
+func TestSharedStoreEntrySize(t *testing.T) {
+	assert := assert.New(t)
+
+	puts := 0
+	cls := clustertest.NewMockedCluster()
+	cls.MockedPutUnderTimeout = func(key, value string, timeout time.Duration) error {
+		puts++
+		assert.LessOrEqual(len(value), maxSharedEntryBytes)
+		return nil
+	}
+	ss := &sharedStore{cls: cls, pipeline: "pipeline", name: "cache"}
+
+	expires := time.Now().Add(time.Minute)
+	ss.put(&entry{Key: "small", Body: []byte("hello"), Expires: expires})
+	ss.put(&entry{Key: "large", Body: []byte(strings.Repeat("a", maxSharedEntryBytes)), Expires: expires})
+	assert.Equal(1, puts)
+}
+
+func TestResponseCacheRevalidate(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newResponseCache(t, yamlConfig)
+
+	var ifNoneMatch string
+	upstream := func(req *httpprot.Request) *httpprot.Response {
+		ifNoneMatch = req.HTTPHeader().Get(keyIfNoneMatch)
+		if ifNoneMatch == `"v1"` {
+			return newUpstreamResponse(http.StatusNotModified, "", nil)
+		}
+		return newUpstreamResponse(http.StatusOK, "hello", http.Header{"Etag": {`"v1"`}, "Cache-Control": {"max-age=60"}})
+	}
+
+	serve(rc, newContext(t, http.MethodGet, "http://example.com/", nil), upstream)
+
+	// Make the entry stale.
+	e := rc.memory.get(rc.key(newContext(t, http.MethodGet, "http://example.com/", nil).GetInputRequest().(*httpprot.Request)))
+	assert.NotNil(e)
+	e.Expires = time.Now().Add(-time.Second)
+
+	resp, called := serve(rc, newContext(t, http.MethodGet, "http://example.com/", nil), upstream)
+	assert.True(called)
+	assert.Equal(`"v1"`, ifNoneMatch)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("hello", string(resp.RawPayload()))
+
+	_, called = serve(rc, newContext(t, http.MethodGet, "http://example.com/", nil), upstream)
+	assert.False(called)
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	assert := assert.New(t)
+
+	ms := newMemoryStore(100)
+	for _, key := range []string{"a", "b", "c"} {
+		ms.put(&entry{Key: key, Body: make([]byte, 39)})
+	}
+
+	assert.Nil(ms.get("a"))
+	assert.NotNil(ms.get("b"))
+	ms.put(&entry{Key: "d", Body: make([]byte, 39)})
+	assert.Nil(ms.get("c"))
+	assert.NotNil(ms.get("b"))
+
+	entries, bytes := ms.stat()
+	assert.Equal(2, entries)
+	assert.Equal(uint64(80), bytes)
+
+	ms.setMaxBytes(50)
+	entries, _ = ms.stat()
+	assert.Equal(1, entries)
+
+	ms.put(&entry{Key: "e", Body: make([]byte, 100)})
+	assert.Nil(ms.get("e"))
+}
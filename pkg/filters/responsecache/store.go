@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package responsecache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// maxSharedEntryBytes is the max size of an encoded entry in the shared
+// tier, it is kept well below the request size limit of the cluster
+// storage (1.5MiB by default), as every entry is a write to all members.
+const maxSharedEntryBytes = 64 << 10
+
+type (
+	// entry is a cached response.
+	entry struct {
+		Key        string            `json:"key"`
+		StatusCode int               `json:"statusCode"`
+		Header     http.Header       `json:"header"`
+		Body       []byte            `json:"body"`
+		ETag       string            `json:"etag,omitempty"`
+		Vary       map[string]string `json:"vary,omitempty"` // request header values selected by Vary
+		Stored     time.Time         `json:"stored"`
+		Expires    time.Time         `json:"expires"`
+	}
+
+	// memoryStore is a LRU cache limited by the total size of entries,
+	// stale entries are kept until evicted, so that they can be
+	// revalidated with their ETags.
+	memoryStore struct {
+		mutex    sync.Mutex
+		maxBytes uint64
+		bytes    uint64
+		lru      *list.List
+		entries  map[string]*list.Element
+	}
+
+	// sharedStore is the cache tier shared by the cluster members, the
+	// entries are stored in the cluster storage and removed on expiration.
+	// It is read synchronously on every miss of the memory store, and the
+	// entries larger than maxSharedEntryBytes are not shared.
+	sharedStore struct {
+		cls      cluster.Cluster
+		pipeline string
+		name     string
+	}
+)
+
+func (e *entry) size() uint64 {
+	size := len(e.Key) + len(e.Body) + len(e.ETag)
+	for k, v := range e.Vary {
+		size += len(k) + len(v)
+	}
+	for k, values := range e.Header {
+		size += len(k)
+		for _, v := range values {
+			size += len(v)
+		}
+	}
+	return uint64(size)
+}
+
+func (e *entry) fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+func newMemoryStore(maxBytes uint64) *memoryStore {
+	return &memoryStore{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (ms *memoryStore) get(key string) *entry {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	elem, ok := ms.entries[key]
+	if !ok {
+		return nil
+	}
+
+	ms.lru.MoveToFront(elem)
+	return elem.Value.(*entry)
+}
+
+func (ms *memoryStore) put(e *entry) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if elem, ok := ms.entries[e.Key]; ok {
+		ms.removeElement(elem)
+	}
+
+	size := e.size()
+	if size > ms.maxBytes {
+		return
+	}
+
+	ms.entries[e.Key] = ms.lru.PushFront(e)
+	ms.bytes += size
+	ms.evict()
+}
+
+func (ms *memoryStore) setMaxBytes(maxBytes uint64) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.maxBytes = maxBytes
+	ms.evict()
+}
+
+func (ms *memoryStore) evict() {
+	for ms.bytes > ms.maxBytes {
+		ms.removeElement(ms.lru.Back())
+	}
+}
+
+func (ms *memoryStore) removeElement(elem *list.Element) {
+	e := ms.lru.Remove(elem).(*entry)
+	delete(ms.entries, e.Key)
+	ms.bytes -= e.size()
+}
+
+// stat returns the number of entries and their total size.
+func (ms *memoryStore) stat() (int, uint64) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	return len(ms.entries), ms.bytes
+}
+
+func (ss *sharedStore) clusterKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return ss.cls.Layout().ResponseCacheKey(ss.pipeline, ss.name, hex.EncodeToString(sum[:]))
+}
+
+func (ss *sharedStore) get(key string) *entry {
+	value, err := ss.cls.Get(ss.clusterKey(key))
+	if err != nil {
+		logger.Errorf("get shared response cache of %s failed: %v", key, err)
+		return nil
+	}
+	if value == nil {
+		return nil
+	}
+
+	e := &entry{}
+	if err := codectool.UnmarshalJSON([]byte(*value), e); err != nil {
+		logger.Errorf("BUG: unmarshal %s to json failed: %v", *value, err)
+		return nil
+	}
+
+	// Keys are hashed, so it is checked against collisions.
+	if e.Key != key {
+		return nil
+	}
+
+	return e
+}
+
+func (ss *sharedStore) put(e *entry) {
+	// The lease TTL of the cluster storage is in seconds.
+	timeout := time.Until(e.Expires)
+	if timeout < time.Second {
+		return
+	}
+
+	buff, err := codectool.MarshalJSON(e)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to json failed: %v", e, err)
+		return
+	}
+	if len(buff) > maxSharedEntryBytes {
+		return
+	}
+
+	err = ss.cls.PutUnderTimeout(ss.clusterKey(e.Key), string(buff), timeout)
+	if err != nil {
+		logger.Errorf("put shared response cache of %s failed: %v", e.Key, err)
+	}
+}
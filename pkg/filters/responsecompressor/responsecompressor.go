@@ -0,0 +1,349 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package responsecompressor provides the ResponseCompressor filter.
+package responsecompressor
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/readers"
+)
+
+const (
+	// Kind is the kind of ResponseCompressor.
+	Kind = "ResponseCompressor"
+
+	resultCompressFailed = "compressFailed"
+
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+
+	keyAcceptEncoding  = "Accept-Encoding"
+	keyContentEncoding = "Content-Encoding"
+	keyContentLength   = "Content-Length"
+	keyContentType     = "Content-Type"
+	keyContentRange    = "Content-Range"
+	keyCacheControl    = "Cache-Control"
+	keyETag            = "ETag"
+	keyVary            = "Vary"
+
+	defaultMinLength = 1024
+)
+
+var (
+	defaultEncodings = []string{encodingBrotli, encodingGzip}
+
+	defaultContentTypes = []string{
+		"text/*",
+		"application/json",
+		"application/javascript",
+		"application/xml",
+		"application/xhtml+xml",
+		"application/rss+xml",
+		"application/wasm",
+		"image/svg+xml",
+	}
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ResponseCompressor compresses the response body with the encoding accepted by the client.",
+	Results:     []string{resultCompressFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{MinLength: defaultMinLength}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ResponseCompressor{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ResponseCompressor is filter ResponseCompressor.
+	ResponseCompressor struct {
+		spec *Spec
+
+		encodings    []string
+		contentTypes []string
+	}
+
+	// Spec describes the ResponseCompressor.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Encodings    []string `json:"encodings,omitempty" jsonschema:"uniqueItems=true"`
+		GzipLevel    int      `json:"gzipLevel,omitempty" jsonschema:"minimum=1,maximum=9"`
+		BrotliLevel  int      `json:"brotliLevel,omitempty" jsonschema:"minimum=1,maximum=11"`
+		MinLength    uint32   `json:"minLength,omitempty"`
+		ContentTypes []string `json:"contentTypes,omitempty"`
+	}
+)
+
+// Validate validates the spec of ResponseCompressor.
+func (spec *Spec) Validate() error {
+	for _, e := range spec.Encodings {
+		if e != encodingGzip && e != encodingBrotli {
+			return fmt.Errorf("unsupported encoding %q, must be %s or %s", e, encodingGzip, encodingBrotli)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the ResponseCompressor filter instance.
+func (rc *ResponseCompressor) Name() string {
+	return rc.spec.Name()
+}
+
+// Kind returns the kind of ResponseCompressor.
+func (rc *ResponseCompressor) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ResponseCompressor.
+func (rc *ResponseCompressor) Spec() filters.Spec {
+	return rc.spec
+}
+
+// Init initializes ResponseCompressor.
+func (rc *ResponseCompressor) Init() {
+	rc.reload()
+}
+
+// Inherit inherits previous generation of ResponseCompressor.
+func (rc *ResponseCompressor) Inherit(_ filters.Filter) {
+	rc.Init()
+}
+
+func (rc *ResponseCompressor) reload() {
+	rc.encodings = rc.spec.Encodings
+	if len(rc.encodings) == 0 {
+		rc.encodings = defaultEncodings
+	}
+
+	rc.contentTypes = nil
+	for _, ct := range rc.spec.ContentTypes {
+		rc.contentTypes = append(rc.contentTypes, strings.ToLower(ct))
+	}
+	if len(rc.contentTypes) == 0 {
+		rc.contentTypes = defaultContentTypes
+	}
+}
+
+// Handle compresses the output response.
+func (rc *ResponseCompressor) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil || !rc.compressible(req, resp) {
+		return ""
+	}
+
+	if !rc.longEnough(resp) {
+		return ""
+	}
+
+	addVary(resp.HTTPHeader())
+
+	encoding := rc.negotiate(req.HTTPHeader().Values(keyAcceptEncoding))
+	if encoding == "" {
+		return ""
+	}
+
+	cr := readers.NewCompressReader(resp.GetPayload(), rc.newWriter(encoding))
+	if resp.IsStream() {
+		resp.SetPayload(cr)
+		resp.ContentLength = -1
+		resp.HTTPHeader().Del(keyContentLength)
+	} else {
+		data, err := io.ReadAll(cr)
+		cr.Close()
+		if err != nil {
+			logger.Errorf("compress response body failed, %v", err)
+			return resultCompressFailed
+		}
+		resp.SetPayload(data)
+		resp.ContentLength = int64(len(data))
+		resp.HTTPHeader().Set(keyContentLength, strconv.Itoa(len(data)))
+	}
+
+	resp.HTTPHeader().Set(keyContentEncoding, encoding)
+
+	// The compressed body is no longer byte-for-byte identical to the
+	// upstream one, so a strong ETag must be weakened.
+	if etag := resp.HTTPHeader().Get(keyETag); strings.HasPrefix(etag, `"`) {
+		resp.HTTPHeader().Set(keyETag, "W/"+etag)
+	}
+
+	return ""
+}
+
+func (rc *ResponseCompressor) compressible(req *httpprot.Request, resp *httpprot.Response) bool {
+	if req.Method() == http.MethodHead {
+		return false
+	}
+
+	code := resp.StatusCode()
+	if code < 200 || code == http.StatusNoContent ||
+		code == http.StatusPartialContent || code == http.StatusNotModified {
+		return false
+	}
+
+	h := resp.HTTPHeader()
+	if ce := h.Get(keyContentEncoding); ce != "" && ce != "identity" {
+		return false
+	}
+	if h.Get(keyContentRange) != "" {
+		return false
+	}
+	for _, cc := range h.Values(keyCacheControl) {
+		if strings.Contains(strings.ToLower(cc), "no-transform") {
+			return false
+		}
+	}
+
+	return rc.matchContentType(h.Get(keyContentType))
+}
+
+func (rc *ResponseCompressor) matchContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, ct := range rc.contentTypes {
+		if ct == "*" || ct == "*/*" || ct == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(ct, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rc *ResponseCompressor) longEnough(resp *httpprot.Response) bool {
+	if !resp.IsStream() {
+		return len(resp.RawPayload()) >= int(rc.spec.MinLength)
+	}
+
+	// The length of a stream is unknown unless the upstream tells it.
+	l, err := strconv.ParseInt(resp.HTTPHeader().Get(keyContentLength), 10, 64)
+	if err != nil {
+		return true
+	}
+	return l >= int64(rc.spec.MinLength)
+}
+
+// negotiate chooses the encoding with the highest quality value in the
+// Accept-Encoding header, the order of the configured encodings breaks
+// ties. It returns an empty string if none of the encodings is acceptable.
+func (rc *ResponseCompressor) negotiate(acceptEncodings []string) string {
+	qvalues := map[string]float64{}
+	for _, ae := range acceptEncodings {
+		for _, item := range strings.Split(ae, ",") {
+			coding, params, _ := strings.Cut(item, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding == "" {
+				continue
+			}
+
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				k, v, _ := strings.Cut(param, "=")
+				if strings.TrimSpace(k) != "q" {
+					continue
+				}
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+			qvalues[coding] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, e := range rc.encodings {
+		q, ok := qvalues[e]
+		if !ok {
+			q = qvalues["*"]
+		}
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+
+	return best
+}
+
+func (rc *ResponseCompressor) newWriter(encoding string) func(w io.Writer) io.WriteCloser {
+	if encoding == encodingBrotli {
+		level := rc.spec.BrotliLevel
+		if level == 0 {
+			level = brotli.DefaultCompression
+		}
+		return func(w io.Writer) io.WriteCloser {
+			return brotli.NewWriterLevel(w, level)
+		}
+	}
+
+	level := rc.spec.GzipLevel
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return func(w io.Writer) io.WriteCloser {
+		// the level is validated by the spec, so no error here.
+		zw, _ := gzip.NewWriterLevel(w, level)
+		return zw
+	}
+}
+
+func addVary(h http.Header) {
+	for _, v := range h.Values(keyVary) {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "*" || strings.EqualFold(f, keyAcceptEncoding) {
+				return
+			}
+		}
+	}
+	h.Add(keyVary, keyAcceptEncoding)
+}
+
+// Status returns status.
+func (rc *ResponseCompressor) Status() interface{} {
+	return nil
+}
+
+// Close closes ResponseCompressor.
+func (rc *ResponseCompressor) Close() {
+}
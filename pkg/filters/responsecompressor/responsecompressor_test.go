@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package responsecompressor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+var body = strings.Repeat("Easegress is a Cloud Native traffic orchestration system. ", 100)
+
+func newCompressor(t *testing.T, yamlConfig string) *ResponseCompressor {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rc := kind.CreateInstance(spec).(*ResponseCompressor)
+	rc.Init()
+	return rc
+}
+
+func newContext(t *testing.T, method, acceptEncoding, contentType string, payload interface{}) *context.Context {
+	ctx := context.New(nil)
+
+	stdr, _ := http.NewRequest(method, "http://127.0.0.1/", nil)
+	if acceptEncoding != "" {
+		stdr.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+	ctx.SetInputRequest(req)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.HTTPHeader().Set("Content-Type", contentType)
+	resp.HTTPHeader().Set("ETag", `"v1"`)
+	resp.SetPayload(payload)
+	ctx.SetOutputResponse(resp)
+
+	return ctx
+}
+
+func TestCompress(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newCompressor(t, `
+kind: ResponseCompressor
+name: compressor
+`)
+
+	// brotli is preferred.
+	ctx := newContext(t, http.MethodGet, "gzip, deflate, br", "text/html; charset=utf-8", []byte(body))
+	assert.Equal("", rc.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("br", resp.HTTPHeader().Get("Content-Encoding"))
+	assert.Equal("Accept-Encoding", resp.HTTPHeader().Get("Vary"))
+	assert.Equal(`W/"v1"`, resp.HTTPHeader().Get("ETag"))
+	data, err := io.ReadAll(brotli.NewReader(bytes.NewReader(resp.RawPayload())))
+	assert.Nil(err)
+	assert.Equal(body, string(data))
+
+	// quality values are respected.
+	ctx = newContext(t, http.MethodGet, "br;q=0.5, gzip", "application/json", []byte(body))
+	rc.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("gzip", resp.HTTPHeader().Get("Content-Encoding"))
+	zr, err := gzip.NewReader(bytes.NewReader(resp.RawPayload()))
+	assert.Nil(err)
+	data, err = io.ReadAll(zr)
+	assert.Nil(err)
+	assert.Equal(body, string(data))
+
+	// stream payload.
+	ctx = newContext(t, http.MethodGet, "gzip", "text/plain", strings.NewReader(body))
+	rc.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("gzip", resp.HTTPHeader().Get("Content-Encoding"))
+	zr, err = gzip.NewReader(resp.GetPayload())
+	assert.Nil(err)
+	data, err = io.ReadAll(zr)
+	assert.Nil(err)
+	assert.Equal(body, string(data))
+
+	// no acceptable encoding.
+	ctx = newContext(t, http.MethodGet, "gzip;q=0, *;q=0", "text/plain", []byte(body))
+	rc.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("", resp.HTTPHeader().Get("Content-Encoding"))
+	assert.Equal("Accept-Encoding", resp.HTTPHeader().Get("Vary"))
+	assert.Equal(`"v1"`, resp.HTTPHeader().Get("ETag"))
+
+	// wildcard.
+	ctx = newContext(t, http.MethodGet, "*", "text/plain", []byte(body))
+	rc.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("br", resp.HTTPHeader().Get("Content-Encoding"))
+
+	// content type not matched.
+	ctx = newContext(t, http.MethodGet, "gzip", "image/png", []byte(body))
+	rc.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("", resp.HTTPHeader().Get("Content-Encoding"))
+
+	// too short.
+	ctx = newContext(t, http.MethodGet, "gzip", "text/plain", []byte("short"))
+	rc.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("", resp.HTTPHeader().Get("Content-Encoding"))
+
+	// HEAD request.
+	ctx = newContext(t, http.MethodHead, "gzip", "text/plain", []byte(body))
+	rc.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("", resp.HTTPHeader().Get("Content-Encoding"))
+
+	// already encoded.
+	ctx = newContext(t, http.MethodGet, "gzip", "text/plain", []byte(body))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	resp.HTTPHeader().Set("Content-Encoding", "deflate")
+	rc.Handle(ctx)
+	assert.Equal("deflate", resp.HTTPHeader().Get("Content-Encoding"))
+	assert.Equal(body, string(resp.RawPayload()))
+
+	// no-transform.
+	ctx = newContext(t, http.MethodGet, "gzip", "text/plain", []byte(body))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	resp.HTTPHeader().Set("Cache-Control", "public, no-transform")
+	rc.Handle(ctx)
+	assert.Equal("", resp.HTTPHeader().Get("Content-Encoding"))
+}
+
+func TestCustomSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newCompressor(t, `
+kind: ResponseCompressor
+name: compressor
+encodings: [gzip]
+gzipLevel: 9
+minLength: 10
+contentTypes: [application/*]
+`)
+
+	ctx := newContext(t, http.MethodGet, "br, gzip", "application/octet-stream", []byte("0123456789abcdef"))
+	rc.Handle(ctx)
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("gzip", resp.HTTPHeader().Get("Content-Encoding"))
+
+	ctx = newContext(t, http.MethodGet, "br", "application/octet-stream", []byte("0123456789abcdef"))
+	rc.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("", resp.HTTPHeader().Get("Content-Encoding"))
+
+	ctx = newContext(t, http.MethodGet, "gzip", "text/html", []byte("0123456789abcdef"))
+	rc.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("", resp.HTTPHeader().Get("Content-Encoding"))
+
+	spec := &Spec{Encodings: []string{"deflate"}}
+	assert.Error(spec.Validate())
+
+	newRC := kind.CreateInstance(rc.spec)
+	newRC.Inherit(rc)
+	assert.Nil(newRC.Status())
+	newRC.Close()
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package stickycanary provides the StickyCanary filter.
+package stickycanary
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of StickyCanary.
+	Kind = "StickyCanary"
+
+	cohortCanary = "canary"
+	cohortStable = "stable"
+
+	// buckets is the number of buckets, a client is assigned to one of
+	// them, and the first permil buckets are the canary cohort.
+	buckets = 1000
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "StickyCanary assigns clients to the canary cohort consistently.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			CookieName:   "eg-canary",
+			CookieMaxAge: 30 * 24 * 3600,
+			Header:       "X-Canary",
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &StickyCanary{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// StickyCanary is filter StickyCanary.
+	StickyCanary struct {
+		spec *Spec
+
+		canary uint64
+		stable uint64
+	}
+
+	// Spec describes the StickyCanary.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Permil       uint32 `json:"permil" jsonschema:"minimum=0,maximum=1000"`
+		Experiment   string `json:"experiment,omitempty"`
+		KeyHeader    string `json:"keyHeader,omitempty"`
+		KeyCookie    string `json:"keyCookie,omitempty"`
+		Header       string `json:"header,omitempty"`
+		CookieName   string `json:"cookieName,omitempty"`
+		CookieMaxAge int    `json:"cookieMaxAge,omitempty" jsonschema:"minimum=0"`
+		CookiePath   string `json:"cookiePath,omitempty"`
+		CookieDomain string `json:"cookieDomain,omitempty"`
+	}
+
+	// Status is the status of StickyCanary.
+	Status struct {
+		Canary uint64 `json:"canary"`
+		Stable uint64 `json:"stable"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Header == "" {
+		return fmt.Errorf("header is required")
+	}
+	if spec.Permil > buckets {
+		return fmt.Errorf("permil must be in range [0, 1000]")
+	}
+	return nil
+}
+
+// Name returns the name of the StickyCanary filter instance.
+func (sc *StickyCanary) Name() string {
+	return sc.spec.Name()
+}
+
+// Kind returns the kind of StickyCanary.
+func (sc *StickyCanary) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the StickyCanary.
+func (sc *StickyCanary) Spec() filters.Spec {
+	return sc.spec
+}
+
+// Init initializes StickyCanary.
+func (sc *StickyCanary) Init() {
+}
+
+// Inherit inherits previous generation of StickyCanary.
+func (sc *StickyCanary) Inherit(_ filters.Filter) {
+	sc.Init()
+}
+
+// bucket returns the bucket of the client. The bucket saved in the cookie
+// is used first, then the hash of the key, and a random bucket is used if
+// the request has no key.
+func (sc *StickyCanary) bucket(req *httpprot.Request) (uint32, bool) {
+	if c, err := req.Cookie(sc.spec.CookieName); err == nil {
+		if b, err := strconv.ParseUint(c.Value, 10, 32); err == nil && b < buckets {
+			return uint32(b), true
+		}
+	}
+
+	key := ""
+	if sc.spec.KeyHeader != "" {
+		key = req.HTTPHeader().Get(sc.spec.KeyHeader)
+	}
+	if key == "" && sc.spec.KeyCookie != "" {
+		if c, err := req.Cookie(sc.spec.KeyCookie); err == nil {
+			key = c.Value
+		}
+	}
+	if key == "" {
+		return uint32(rand.Intn(buckets)), false
+	}
+
+	// the experiment is hashed together with the key, so that the cohorts
+	// of different experiments are independent.
+	hash := fnv.New32a()
+	hash.Write([]byte(sc.spec.Experiment))
+	hash.Write([]byte(key))
+	return hash.Sum32() % buckets, false
+}
+
+// Handle assigns the client to a cohort, and sets the cohort to the request
+// header, so that the Proxy could route the request by the header.
+func (sc *StickyCanary) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	b, fromCookie := sc.bucket(req)
+
+	// as the bucket of a client never changes, increasing permil only
+	// moves clients from the stable cohort to the canary cohort.
+	cohort := cohortStable
+	if b < sc.spec.Permil {
+		cohort = cohortCanary
+		atomic.AddUint64(&sc.canary, 1)
+	} else {
+		atomic.AddUint64(&sc.stable, 1)
+	}
+	req.HTTPHeader().Set(sc.spec.Header, cohort)
+
+	if fromCookie || sc.spec.CookieName == "" {
+		return ""
+	}
+
+	cookie := &http.Cookie{
+		Name:   sc.spec.CookieName,
+		Value:  strconv.Itoa(int(b)),
+		Path:   sc.spec.CookiePath,
+		Domain: sc.spec.CookieDomain,
+		MaxAge: sc.spec.CookieMaxAge,
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	if w, ok := ctx.GetData("HTTP_RESPONSE_WRITER").(http.ResponseWriter); ok {
+		w.Header().Add("Set-Cookie", cookie.String())
+	}
+	return ""
+}
+
+// Status returns status.
+func (sc *StickyCanary) Status() interface{} {
+	return &Status{
+		Canary: atomic.LoadUint64(&sc.canary),
+		Stable: atomic.LoadUint64(&sc.stable),
+	}
+}
+
+// Close closes StickyCanary.
+func (sc *StickyCanary) Close() {
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stickycanary
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newStickyCanary(t *testing.T, yamlConfig string) *StickyCanary {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sc := kind.CreateInstance(spec).(*StickyCanary)
+	sc.Init()
+	return sc
+}
+
+func newContext(t *testing.T, header http.Header) (*context.Context, *httpprot.Request, *httptest.ResponseRecorder) {
+	ctx := context.New(nil)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+	ctx.SetInputRequest(req)
+
+	w := httptest.NewRecorder()
+	ctx.SetData("HTTP_RESPONSE_WRITER", w)
+	return ctx, req, w
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(`
+kind: StickyCanary
+name: canary
+permil: 100
+header: ""
+`), &rawSpec)
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+}
+
+func TestStickyCanary(t *testing.T) {
+	assert := assert.New(t)
+
+	sc := newStickyCanary(t, `
+kind: StickyCanary
+name: canary
+permil: 300
+keyHeader: X-User-ID
+`)
+	assert.Equal(Kind, sc.Kind().Name)
+	assert.Equal("canary", sc.Name())
+
+	// the cohort of a key is consistent, and is saved to the cookie.
+	cohorts := map[string]string{}
+	canary := 0
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		ctx, req, w := newContext(t, http.Header{"X-User-Id": []string{user}})
+		assert.Equal("", sc.Handle(ctx))
+		cohorts[user] = req.HTTPHeader().Get("X-Canary")
+		if cohorts[user] == cohortCanary {
+			canary++
+		}
+
+		cookies := w.Result().Cookies()
+		assert.Len(cookies, 1)
+		assert.Equal("eg-canary", cookies[0].Name)
+
+		// the cookie takes effect even without the key.
+		ctx, req, w = newContext(t, http.Header{"Cookie": []string{cookies[0].String()}})
+		sc.Handle(ctx)
+		assert.Equal(cohorts[user], req.HTTPHeader().Get("X-Canary"))
+		assert.Empty(w.Result().Cookies())
+	}
+	assert.InDelta(300, canary, 60)
+
+	status := sc.Status().(*Status)
+	assert.Equal(uint64(2000), status.Canary+status.Stable)
+
+	// increasing permil only moves clients from stable to canary.
+	sc = newStickyCanary(t, `
+kind: StickyCanary
+name: canary
+permil: 600
+keyHeader: X-User-ID
+`)
+	for user, cohort := range cohorts {
+		ctx, req, _ := newContext(t, http.Header{"X-User-Id": []string{user}})
+		sc.Handle(ctx)
+		if cohort == cohortCanary {
+			assert.Equal(cohortCanary, req.HTTPHeader().Get("X-Canary"))
+		}
+	}
+
+	// clients without a key get a random bucket.
+	ctx, req, w := newContext(t, nil)
+	sc.Handle(ctx)
+	assert.NotEmpty(req.HTTPHeader().Get("X-Canary"))
+	assert.Len(w.Result().Cookies(), 1)
+
+	sc.Inherit(sc)
+	sc.Close()
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package timeout provides the Timeout filter.
+package timeout
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/deadline"
+)
+
+const (
+	// Kind is the kind of Timeout.
+	Kind = "Timeout"
+
+	resultTimeout = "timeout"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Timeout sets the deadline of requests and propagates it to upstreams.",
+	Results:     []string{resultTimeout},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Timeout{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Timeout is filter Timeout.
+	Timeout struct {
+		spec    *Spec
+		timeout time.Duration
+	}
+
+	// Spec describes the Timeout.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Timeout         string                `json:"timeout" jsonschema:"required,format=duration"`
+		Propagation     *deadline.Propagation `json:"propagation,omitempty"`
+		InheritDeadline bool                  `json:"inheritDeadline,omitempty"`
+	}
+)
+
+// Validate validates the spec of Timeout.
+func (spec *Spec) Validate() error {
+	d, err := time.ParseDuration(spec.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %s: %v", spec.Timeout, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+
+	if spec.Propagation != nil {
+		return spec.Propagation.Validate()
+	}
+	if spec.InheritDeadline {
+		return fmt.Errorf("propagation is required to inherit deadline")
+	}
+	return nil
+}
+
+// Name returns the name of the Timeout filter instance.
+func (t *Timeout) Name() string {
+	return t.spec.Name()
+}
+
+// Kind returns the kind of Timeout.
+func (t *Timeout) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Timeout.
+func (t *Timeout) Spec() filters.Spec {
+	return t.spec
+}
+
+// Init initializes Timeout.
+func (t *Timeout) Init() {
+	t.timeout, _ = time.ParseDuration(t.spec.Timeout)
+}
+
+// Inherit inherits previous generation of Timeout.
+func (t *Timeout) Inherit(_ filters.Filter) {
+	t.Init()
+}
+
+// Handle sets the deadline of the request, filters after it, like the
+// Proxy, use the deadline to cancel requests to upstreams and to abort
+// retries that cannot finish in time.
+func (t *Timeout) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	stdctx := req.Context()
+
+	timeout := t.timeout
+	p := t.spec.Propagation
+	if t.spec.InheritDeadline {
+		if v := req.HTTPHeader().Get(p.Header); v != "" {
+			d, err := deadline.Parse(v, p.Format, time.Now())
+			if err != nil {
+				ctx.AddTag(fmt.Sprintf("timeout: invalid deadline %s", v))
+			} else if d < timeout {
+				timeout = d
+			}
+		}
+	}
+
+	// the deadline of the client has already passed, there's no need to
+	// handle the request anymore.
+	if timeout <= 0 {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusGatewayTimeout)
+		ctx.SetOutputResponse(resp)
+		return resultTimeout
+	}
+
+	stdctx, cancel := stdcontext.WithTimeout(stdctx, timeout)
+	ctx.OnFinish(cancel)
+	if p != nil {
+		stdctx = deadline.WithPropagation(stdctx, p)
+	}
+	req.SetContext(stdctx)
+
+	return ""
+}
+
+// Status returns status.
+func (t *Timeout) Status() interface{} {
+	return nil
+}
+
+// Close closes Timeout.
+func (t *Timeout) Close() {
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package timeout
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/deadline"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTimeout(t *testing.T, yamlConfig string) *Timeout {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	to := kind.CreateInstance(spec).(*Timeout)
+	to.Init()
+	return to
+}
+
+func newContext(t *testing.T, header http.Header) (*context.Context, *httpprot.Request) {
+	ctx := context.New(nil)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.Nil(t, err)
+	ctx.SetInputRequest(req)
+
+	return ctx, req
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, yamlConfig := range []string{`
+kind: Timeout
+name: timeout
+timeout: abc
+`, `
+kind: Timeout
+name: timeout
+timeout: 1s
+inheritDeadline: true
+`, `
+kind: Timeout
+name: timeout
+timeout: 1s
+propagation:
+  header: X-Deadline
+  format: unknown
+`} {
+		rawSpec := map[string]interface{}{}
+		codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		assert.Error(err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	to := newTimeout(t, `
+kind: Timeout
+name: timeout
+timeout: 1s
+propagation:
+  header: grpc-timeout
+  format: grpc
+inheritDeadline: true
+`)
+	assert.Equal(Kind, to.Kind().Name)
+	assert.Equal("timeout", to.Name())
+	assert.Nil(to.Status())
+
+	ctx, req := newContext(t, nil)
+	assert.Equal("", to.Handle(ctx))
+	d, ok := req.Context().Deadline()
+	assert.True(ok)
+	assert.InDelta(float64(time.Second), float64(time.Until(d)), float64(100*time.Millisecond))
+
+	h := http.Header{}
+	deadline.Propagate(req.Context(), h)
+	assert.NotEmpty(h.Get("grpc-timeout"))
+
+	// the request context is canceled when the request finishes.
+	ctx.Finish()
+	assert.Error(req.Context().Err())
+
+	// a shorter deadline of the client is inherited.
+	ctx, req = newContext(t, http.Header{"Grpc-Timeout": []string{"100m"}})
+	assert.Equal("", to.Handle(ctx))
+	d, _ = req.Context().Deadline()
+	assert.True(time.Until(d) <= 100*time.Millisecond)
+	ctx.Finish()
+
+	// the deadline of the client has passed.
+	ctx, _ = newContext(t, http.Header{"Grpc-Timeout": []string{"0m"}})
+	assert.Equal(resultTimeout, to.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusGatewayTimeout, resp.StatusCode())
+
+	to.Inherit(to)
+	to.Close()
+}
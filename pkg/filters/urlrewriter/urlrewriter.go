@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package urlrewriter provides the URLRewriter filter.
+package urlrewriter
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/urlrewriter"
+)
+
+const (
+	// Kind is the kind of URLRewriter.
+	Kind = "URLRewriter"
+
+	resultRewriteLoop = "rewriteLoop"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "URLRewriter rewrites the path, query and host of requests with regular expressions.",
+	Results:     []string{resultRewriteLoop},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &URLRewriter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// URLRewriter is filter URLRewriter.
+	URLRewriter struct {
+		spec     *Spec
+		rewriter *urlrewriter.Rewriter
+	}
+
+	// Spec describes the URLRewriter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Rules []*urlrewriter.Rule `json:"rules" jsonschema:"required,minItems=1"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if len(spec.Rules) == 0 {
+		return fmt.Errorf("no rules")
+	}
+	for i, r := range spec.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the URLRewriter filter instance.
+func (ur *URLRewriter) Name() string {
+	return ur.spec.Name()
+}
+
+// Kind returns the kind of URLRewriter.
+func (ur *URLRewriter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the URLRewriter
+func (ur *URLRewriter) Spec() filters.Spec {
+	return ur.spec
+}
+
+// Init initializes URLRewriter.
+func (ur *URLRewriter) Init() {
+	ur.reload()
+}
+
+// Inherit inherits previous generation of URLRewriter.
+func (ur *URLRewriter) Inherit(_ filters.Filter) {
+	ur.reload()
+}
+
+func (ur *URLRewriter) reload() {
+	var err error
+	if ur.rewriter, err = urlrewriter.New(ur.spec.Rules); err != nil {
+		logger.Errorf("BUG: %v", err)
+	}
+}
+
+// Handle rewrites the URL of the request.
+func (ur *URLRewriter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	if _, err := ur.rewriter.Rewrite(req.Std()); err != nil {
+		logger.Errorf("%s: failed to rewrite %s: %v", ur.Name(), req.RequestURI, err)
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetOutputResponse(resp)
+		return resultRewriteLoop
+	}
+
+	return ""
+}
+
+// Status returns status.
+func (ur *URLRewriter) Status() interface{} {
+	return nil
+}
+
+// Close closes URLRewriter.
+func (ur *URLRewriter) Close() {
+}
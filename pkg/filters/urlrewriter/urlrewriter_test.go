@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package urlrewriter
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newSpec(yamlConfig string) (filters.Spec, error) {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	return filters.NewSpec(nil, "", rawSpec)
+}
+
+func newURLRewriter(t *testing.T, yamlConfig string) *URLRewriter {
+	spec, err := newSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ur := kind.CreateInstance(spec).(*URLRewriter)
+	ur.Init()
+	return ur
+}
+
+func newContext(url string) (*context.Context, *httpprot.Request) {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, url, nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx, req
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newSpec("kind: URLRewriter\nname: ur")
+	assert.NotNil(err)
+
+	_, err = newSpec("kind: URLRewriter\nname: ur\nrules:\n- match: '('\n  path: /a")
+	assert.NotNil(err)
+
+	_, err = newSpec("kind: URLRewriter\nname: ur\nrules:\n- match: '^/a'\n  path: /b")
+	assert.Nil(err)
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	ur := newURLRewriter(t, `
+kind: URLRewriter
+name: ur
+rules:
+- match: '^/api/v1/(?P<rest>.*)$'
+  path: '/${rest}'
+  query: 'version=1'
+  appendQuery: true
+  host: 'backend-v1.example.com'
+  last: true
+`)
+	assert.Equal(Kind, ur.Kind().Name)
+	assert.Equal("ur", ur.Name())
+
+	ctx, req := newContext("http://example.com/api/v1/users?id=1")
+	assert.Equal("", ur.Handle(ctx))
+	assert.Equal("/users", req.Path())
+	assert.Equal("version=1&id=1", req.URL().RawQuery)
+	assert.Equal("backend-v1.example.com", req.Host())
+
+	ur.Inherit(ur)
+	ur.Close()
+}
+
+func TestRewriteLoop(t *testing.T) {
+	assert := assert.New(t)
+
+	ur := newURLRewriter(t, `
+kind: URLRewriter
+name: ur
+rules:
+- match: '^/a$'
+  path: /b
+  restart: true
+- match: '^/b$'
+  path: /a
+  restart: true
+`)
+
+	ctx, _ := newContext("http://example.com/a")
+	assert.Equal(resultRewriteLoop, ur.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode())
+	assert.Nil(ur.Status())
+}
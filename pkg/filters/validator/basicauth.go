@@ -105,7 +105,7 @@ type (
 		Insecure     bool   `json:"insecure,omitempty"`
 		ServerName   string `json:"serverName,omitempty"`
 		CertBase64   string `json:"certBase64,omitempty" jsonschema:"format=base64"`
-		KeyBase64    string `json:"keyBase64,omitempty" jsonschema:"format=base64"`
+		KeyBase64    string `json:"keyBase64,omitempty" jsonschema:"format=base64,writeOnly=true"`
 		certificates []tls.Certificate
 	}
 
@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validator
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+type (
+	// HMACValidatorSpec defines the configuration of the HMAC signature
+	// validator, which is mostly used for webhooks and partner APIs.
+	HMACValidatorSpec struct {
+		Algorithm string `json:"algorithm,omitempty" jsonschema:"enum=sha1,enum=sha256,enum=sha512"`
+		// Secrets are tried in order, a request is valid if it is signed by
+		// any of them, which allows rotating the secrets.
+		Secrets         []string `json:"secrets" jsonschema:"required,minItems=1,writeOnly=true"`
+		SignatureHeader string   `json:"signatureHeader" jsonschema:"required"`
+		// SignaturePrefix is removed from the signature header, e.g. "sha256=".
+		SignaturePrefix string `json:"signaturePrefix,omitempty"`
+		Encoding        string `json:"encoding,omitempty" jsonschema:"enum=hex,enum=base64"`
+		// SignedParts are joined by Separator to build the string to sign,
+		// a part is one of method, path, query, timestamp, nonce, body and
+		// header:<name>, the default is the body only.
+		SignedParts []string `json:"signedParts,omitempty"`
+		Separator   string   `json:"separator,omitempty"`
+
+		// TimestampHeader is the header of the signing time in Unix seconds,
+		// requests signed earlier or later than MaxClockSkew are rejected,
+		// the timestamp must be one of the SignedParts.
+		TimestampHeader string `json:"timestampHeader,omitempty"`
+		MaxClockSkew    string `json:"maxClockSkew,omitempty" jsonschema:"format=duration"`
+		// NonceHeader is the header of a unique value of each request, a
+		// nonce can be used only once in MaxClockSkew, it must be one of the
+		// SignedParts. New nonces are rejected when MaxNonceEntries unexpired
+		// nonces are remembered.
+		NonceHeader     string `json:"nonceHeader,omitempty"`
+		MaxNonceEntries int    `json:"maxNonceEntries,omitempty" jsonschema:"minimum=1"`
+	}
+
+	// HMACValidator defines the HMAC signature validator
+	HMACValidator struct {
+		spec    *HMACValidatorSpec
+		newHash func() hash.Hash
+		skew    time.Duration
+		nonces  *nonceCache
+	}
+
+	// nonceCache remembers the nonces until they expire.
+	nonceCache struct {
+		mutex      sync.Mutex
+		maxEntries int
+		entries    map[string]time.Time
+	}
+)
+
+const (
+	defaultMaxClockSkew    = 5 * time.Minute
+	defaultMaxNonceEntries = 100000
+)
+
+// Validate validates the spec.
+func (spec *HMACValidatorSpec) Validate() error {
+	for _, p := range spec.SignedParts {
+		switch {
+		case p == "method", p == "path", p == "query", p == "body":
+		case p == "timestamp":
+			if spec.TimestampHeader == "" {
+				return fmt.Errorf("timestampHeader is required to sign the timestamp")
+			}
+		case p == "nonce":
+			if spec.NonceHeader == "" {
+				return fmt.Errorf("nonceHeader is required to sign the nonce")
+			}
+		case strings.HasPrefix(p, "header:") && len(p) > len("header:"):
+		default:
+			return fmt.Errorf("unknown signed part %q", p)
+		}
+	}
+	if spec.NonceHeader != "" && spec.TimestampHeader == "" {
+		return fmt.Errorf("timestampHeader is required if nonceHeader is specified")
+	}
+	// Unsigned timestamps and nonces could be replaced by attackers to
+	// replay the requests.
+	if spec.TimestampHeader != "" && !stringtool.StrInSlice("timestamp", spec.SignedParts) {
+		return fmt.Errorf("timestamp must be signed if timestampHeader is specified")
+	}
+	if spec.NonceHeader != "" && !stringtool.StrInSlice("nonce", spec.SignedParts) {
+		return fmt.Errorf("nonce must be signed if nonceHeader is specified")
+	}
+	return nil
+}
+
+// NewHMACValidator creates a new HMAC signature validator
+func NewHMACValidator(spec *HMACValidatorSpec) *HMACValidator {
+	v := &HMACValidator{spec: spec, skew: defaultMaxClockSkew}
+
+	switch spec.Algorithm {
+	case "sha1":
+		v.newHash = sha1.New
+	case "sha512":
+		v.newHash = sha512.New
+	default:
+		v.newHash = sha256.New
+	}
+
+	if d, err := time.ParseDuration(spec.MaxClockSkew); err == nil && d > 0 {
+		v.skew = d
+	}
+
+	if spec.NonceHeader != "" {
+		maxEntries := spec.MaxNonceEntries
+		if maxEntries <= 0 {
+			maxEntries = defaultMaxNonceEntries
+		}
+		v.nonces = &nonceCache{maxEntries: maxEntries, entries: map[string]time.Time{}}
+	}
+
+	return v
+}
+
+// add adds the nonce, it fails if the nonce is already used or the cache
+// is full of unexpired nonces, evicting them would allow replays.
+func (c *nonceCache) add(nonce string, expires time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if exp, ok := c.entries[nonce]; ok && now.Before(exp) {
+		return fmt.Errorf("nonce is already used")
+	}
+
+	if len(c.entries) >= c.maxEntries {
+		for k, exp := range c.entries {
+			if now.After(exp) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			return fmt.Errorf("too many nonces")
+		}
+	}
+
+	c.entries[nonce] = expires
+	return nil
+}
+
+func (v *HMACValidator) stringToSign(req *httpprot.Request) ([]byte, error) {
+	parts := v.spec.SignedParts
+	if len(parts) == 0 {
+		parts = []string{"body"}
+	}
+
+	hdr := req.HTTPHeader()
+	var sb strings.Builder
+	for i, p := range parts {
+		if i > 0 {
+			sb.WriteString(v.spec.Separator)
+		}
+		switch p {
+		case "method":
+			sb.WriteString(req.Method())
+		case "path":
+			sb.WriteString(req.Path())
+		case "query":
+			sb.WriteString(req.URL().RawQuery)
+		case "timestamp":
+			sb.WriteString(hdr.Get(v.spec.TimestampHeader))
+		case "nonce":
+			sb.WriteString(hdr.Get(v.spec.NonceHeader))
+		case "body":
+			if req.IsStream() {
+				return nil, fmt.Errorf("request body is too large to verify")
+			}
+			sb.Write(req.RawPayload())
+		default:
+			sb.WriteString(hdr.Get(strings.TrimPrefix(p, "header:")))
+		}
+	}
+
+	return []byte(sb.String()), nil
+}
+
+func (v *HMACValidator) decodeSignature(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), v.spec.SignaturePrefix)
+	if v.spec.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return hex.DecodeString(s)
+}
+
+func (v *HMACValidator) checkTimestamp(req *httpprot.Request) (time.Time, error) {
+	value := req.HTTPHeader().Get(v.spec.TimestampHeader)
+	sec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %q", value)
+	}
+
+	ts := time.Unix(sec, 0)
+	if d := time.Since(ts); d > v.skew || d < -v.skew {
+		return time.Time{}, fmt.Errorf("timestamp is out of the allowed clock skew")
+	}
+	return ts, nil
+}
+
+// Validate validates the HMAC signature of a http request
+func (v *HMACValidator) Validate(req *httpprot.Request) error {
+	header := req.HTTPHeader().Get(v.spec.SignatureHeader)
+	if header == "" {
+		return fmt.Errorf("no signature")
+	}
+	signature, err := v.decodeSignature(header)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding")
+	}
+
+	var ts time.Time
+	if v.spec.TimestampHeader != "" {
+		if ts, err = v.checkTimestamp(req); err != nil {
+			return err
+		}
+	}
+
+	data, err := v.stringToSign(req)
+	if err != nil {
+		return err
+	}
+
+	matched := false
+	for _, secret := range v.spec.Secrets {
+		mac := hmac.New(v.newHash, []byte(secret))
+		mac.Write(data)
+		if hmac.Equal(mac.Sum(nil), signature) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	// The nonce is checked after the signature, so that the nonces of
+	// forged requests can't be used to reject the genuine ones.
+	if v.nonces != nil {
+		nonce := req.HTTPHeader().Get(v.spec.NonceHeader)
+		if nonce == "" {
+			return fmt.Errorf("no nonce")
+		}
+		// A replay is rejected by the timestamp check after ts+skew.
+		if err := v.nonces.add(nonce, ts.Add(v.skew)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
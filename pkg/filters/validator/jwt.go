@@ -23,45 +23,226 @@ import (
 	"encoding/pem"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/MicahParks/keyfunc"
 	"github.com/golang-jwt/jwt/v4"
 
+	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
 )
 
-// JWTValidatorSpec defines the configuration of JWT validator
-type JWTValidatorSpec struct {
-	Algorithm string `json:"algorithm" jsonschema:"enum=HS256,enum=HS384,enum=HS512,enum=RS256,enum=RS384,enum=RS512,enum=ES256,enum=ES384,enum=ES512,enum=EdDSA"`
-	// PublicKey is in hex encoding
-	PublicKey string `json:"publicKey" jsonschema:"pattern=^$|^[A-Fa-f0-9]+$"`
-	// Secret is in hex encoding
-	Secret string `json:"secret" jsonschema:"pattern=^$|^[A-Fa-f0-9]+$"`
-	// CookieName specifies the name of a cookie, if not empty, and the cookie with
-	// this name both exists and has a non-empty value, its value is used as token
-	// string, the Authorization header is used to get the token string otherwise.
-	CookieName string `json:"cookieName,omitempty"`
+type (
+	// JWTValidatorSpec defines the configuration of JWT validator
+	JWTValidatorSpec struct {
+		Algorithm string `json:"algorithm,omitempty" jsonschema:"enum=HS256,enum=HS384,enum=HS512,enum=RS256,enum=RS384,enum=RS512,enum=ES256,enum=ES384,enum=ES512,enum=EdDSA"`
+		// PublicKey is in hex encoding
+		PublicKey string `json:"publicKey" jsonschema:"pattern=^$|^[A-Fa-f0-9]+$"`
+		// Secret is in hex encoding
+		Secret string `json:"secret" jsonschema:"pattern=^$|^[A-Fa-f0-9]+$,writeOnly=true"`
+		// JWKS specifies the JSON Web Key Set to verify the signatures, the
+		// key is selected by the kid header of the token.
+		JWKS *JWKSSpec `json:"jwks,omitempty"`
+		// CookieName specifies the name of a cookie, if not empty, and the cookie with
+		// this name both exists and has a non-empty value, its value is used as token
+		// string, the Authorization header is used to get the token string otherwise.
+		CookieName string `json:"cookieName,omitempty"`
+
+		Issuer            string          `json:"issuer,omitempty"`
+		Audiences         []string        `json:"audiences,omitempty"`
+		RequireExpiration bool            `json:"requireExpiration,omitempty"`
+		Claims            []*JWTClaimRule `json:"claims,omitempty"`
+		// ClaimHeaders maps the claims of the token to the request headers
+		// to set.
+		ClaimHeaders  map[string]string     `json:"claimHeaders,omitempty"`
+		ErrorResponse *JWTErrorResponseSpec `json:"errorResponse,omitempty"`
+	}
+
+	// JWKSSpec defines the JSON Web Key Set endpoint.
+	JWKSSpec struct {
+		URL             string `json:"url" jsonschema:"required,format=url"`
+		RefreshInterval string `json:"refreshInterval,omitempty" jsonschema:"format=duration"`
+		// RefreshRateLimit limits the refreshes triggered by unknown key IDs.
+		RefreshRateLimit string `json:"refreshRateLimit,omitempty" jsonschema:"format=duration"`
+	}
+
+	// JWTClaimRule requires the claim to exist, and to be one of the values
+	// if they are not empty, a claim of array passes if any of its elements
+	// is one of the values.
+	JWTClaimRule struct {
+		Name   string   `json:"name" jsonschema:"required"`
+		Values []string `json:"values,omitempty"`
+	}
+
+	// JWTErrorResponseSpec is the response to reject the requests failed
+	// the validation.
+	JWTErrorResponseSpec struct {
+		StatusCode int               `json:"statusCode,omitempty" jsonschema:"format=httpcode"`
+		Headers    map[string]string `json:"headers,omitempty"`
+		Body       string            `json:"body,omitempty"`
+	}
+
+	// JWTValidator defines the JWT validator
+	JWTValidator struct {
+		spec *JWTValidatorSpec
+		key  interface{}
+
+		jwksMutex       sync.Mutex
+		jwks            *keyfunc.JWKS
+		jwksLastAttempt time.Time
+	}
+)
+
+const (
+	defaultJWKSRefreshInterval  = time.Hour
+	defaultJWKSRefreshRateLimit = time.Minute
+)
+
+// Validate validates the spec.
+func (spec *JWTValidatorSpec) Validate() error {
+	if spec.JWKS != nil {
+		if spec.PublicKey != "" || spec.Secret != "" {
+			return fmt.Errorf("jwks can't be used with publicKey or secret")
+		}
+		return nil
+	}
+	if spec.Algorithm == "" {
+		return fmt.Errorf("algorithm is required if jwks is not specified")
+	}
+	return nil
+}
+
+func (spec *JWKSSpec) durations() (interval, rateLimit time.Duration) {
+	interval, rateLimit = defaultJWKSRefreshInterval, defaultJWKSRefreshRateLimit
+	if d, err := time.ParseDuration(spec.RefreshInterval); err == nil && d > 0 {
+		interval = d
+	}
+	if d, err := time.ParseDuration(spec.RefreshRateLimit); err == nil && d > 0 {
+		rateLimit = d
+	}
+	return
 }
 
 // NewJWTValidator creates a new JWT validator
 func NewJWTValidator(spec *JWTValidatorSpec) *JWTValidator {
-	var key interface{}
-	if len(spec.PublicKey) > 0 {
+	v := &JWTValidator{spec: spec}
+
+	switch {
+	case spec.JWKS != nil:
+		v.getJWKS()
+	case len(spec.PublicKey) > 0:
 		publicKeyBytes, _ := hex.DecodeString(spec.PublicKey)
 		p, _ := pem.Decode(publicKeyBytes)
-		key, _ = x509.ParsePKIXPublicKey(p.Bytes)
-	} else {
-		key, _ = hex.DecodeString(spec.Secret)
+		v.key, _ = x509.ParsePKIXPublicKey(p.Bytes)
+	default:
+		v.key, _ = hex.DecodeString(spec.Secret)
+	}
+
+	return v
+}
+
+// getJWKS returns the JWKS, it is fetched again on failures, but not more
+// often than the refresh rate limit.
+func (v *JWTValidator) getJWKS() (*keyfunc.JWKS, error) {
+	v.jwksMutex.Lock()
+	defer v.jwksMutex.Unlock()
+
+	if v.jwks != nil {
+		return v.jwks, nil
 	}
-	return &JWTValidator{
-		spec: spec,
-		key:  key,
+
+	interval, rateLimit := v.spec.JWKS.durations()
+	if time.Since(v.jwksLastAttempt) < rateLimit {
+		return nil, fmt.Errorf("jwks from %s is not available", v.spec.JWKS.URL)
 	}
+	v.jwksLastAttempt = time.Now()
+
+	jwks, err := keyfunc.Get(v.spec.JWKS.URL, keyfunc.Options{
+		RefreshInterval:   interval,
+		RefreshRateLimit:  rateLimit,
+		RefreshTimeout:    10 * time.Second,
+		RefreshUnknownKID: true,
+		RefreshErrorHandler: func(err error) {
+			logger.Errorf("refresh jwks from %s failed: %v", v.spec.JWKS.URL, err)
+		},
+	})
+	if err != nil {
+		logger.Errorf("get jwks from %s failed: %v", v.spec.JWKS.URL, err)
+		return nil, fmt.Errorf("jwks from %s is not available", v.spec.JWKS.URL)
+	}
+
+	v.jwks = jwks
+	return jwks, nil
 }
 
-// JWTValidator defines the JWT validator
-type JWTValidator struct {
-	spec *JWTValidatorSpec
-	key  interface{}
+func (v *JWTValidator) keyFunc(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	if v.spec.Algorithm != "" && alg != v.spec.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", alg)
+	}
+	if v.spec.JWKS == nil {
+		return v.key, nil
+	}
+
+	jwks, err := v.getJWKS()
+	if err != nil {
+		return nil, err
+	}
+	return jwks.Keyfunc(token)
+}
+
+func (v *JWTValidator) validateClaims(claims jwt.MapClaims) error {
+	if v.spec.RequireExpiration {
+		if _, ok := claims["exp"]; !ok {
+			return fmt.Errorf("token has no expiration")
+		}
+	}
+
+	if v.spec.Issuer != "" && !claims.VerifyIssuer(v.spec.Issuer, true) {
+		return fmt.Errorf("unexpected issuer")
+	}
+
+	if len(v.spec.Audiences) > 0 {
+		matched := false
+		for _, aud := range v.spec.Audiences {
+			if claims.VerifyAudience(aud, true) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("unexpected audience")
+		}
+	}
+
+	for _, r := range v.spec.Claims {
+		if !r.match(claims[r.Name]) {
+			return fmt.Errorf("claim %s doesn't satisfy the rule", r.Name)
+		}
+	}
+
+	return nil
+}
+
+func (r *JWTClaimRule) match(claim interface{}) bool {
+	if claim == nil {
+		return false
+	}
+	if len(r.Values) == 0 {
+		return true
+	}
+
+	if list, ok := claim.([]interface{}); ok {
+		for _, c := range list {
+			if stringtool.StrInSlice(fmt.Sprint(c), r.Values) {
+				return true
+			}
+		}
+		return false
+	}
+	return stringtool.StrInSlice(fmt.Sprint(claim), r.Values)
 }
 
 // Validate validates the JWT token of a http request
@@ -83,17 +264,42 @@ func (v *JWTValidator) Validate(req *httpprot.Request) error {
 		token = authHdr[len(prefix):]
 	}
 	// jwt.Parse does everything including parsing and verification
-	t, e := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if alg := token.Method.Alg(); alg != v.spec.Algorithm {
-			return nil, fmt.Errorf("unexpected signing method: %v", alg)
-		}
-		return v.key, nil
-	})
+	t, e := jwt.Parse(token, v.keyFunc)
 	if e != nil {
 		return e
 	}
 	if !t.Valid {
 		return fmt.Errorf("invalid jwt token")
 	}
+
+	claims, _ := t.Claims.(jwt.MapClaims)
+	if e = v.validateClaims(claims); e != nil {
+		return e
+	}
+	if len(v.spec.ClaimHeaders) > 0 {
+		setClaimHeaders(req.HTTPHeader(), v.spec.ClaimHeaders, claims)
+	}
 	return nil
 }
+
+func (r *JWTErrorResponseSpec) apply(resp *httpprot.Response) {
+	if r.StatusCode != 0 {
+		resp.SetStatusCode(r.StatusCode)
+	}
+	for k, v := range r.Headers {
+		resp.HTTPHeader().Set(k, v)
+	}
+	if r.Body != "" {
+		resp.SetPayload([]byte(r.Body))
+	}
+}
+
+// Close closes the validator.
+func (v *JWTValidator) Close() {
+	v.jwksMutex.Lock()
+	defer v.jwksMutex.Unlock()
+
+	if v.jwks != nil {
+		v.jwks.EndBackground()
+	}
+}
@@ -19,11 +19,16 @@ package validator
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 
@@ -37,15 +42,22 @@ type (
 		EndPoint     string `json:"endPoint" jsonschema:"required"`
 		BasicAuth    string `json:"basicAuth,omitempty"`
 		ClientID     string `json:"clientId,omitempty"`
-		ClientSecret string `json:"clientSecret,omitempty"`
+		ClientSecret string `json:"clientSecret,omitempty" jsonschema:"writeOnly=true"`
 		InsecureTLS  bool   `json:"insecureTls,omitempty"`
+		// CacheTTL is the duration to cache the introspection results, the
+		// results are not cached if it is empty.
+		CacheTTL        string `json:"cacheTTL,omitempty" jsonschema:"format=duration"`
+		MaxCacheEntries int    `json:"maxCacheEntries,omitempty" jsonschema:"minimum=1"`
+		// ClaimHeaders maps the claims of the introspection response to the
+		// request headers to set.
+		ClaimHeaders map[string]string `json:"claimHeaders,omitempty"`
 	}
 
 	// OAuth2JWT defines the validator configuration for OAuth2 self encoded access token
 	OAuth2JWT struct {
 		Algorithm string `json:"algorithm" jsonschema:"enum=HS256,enum=HS384,enum=HS512"`
 		// Secret is in hex encoding
-		Secret      string `json:"secret" jsonschema:"required,pattern=^[A-Fa-f0-9]+$"`
+		Secret      string `json:"secret" jsonschema:"required,pattern=^[A-Fa-f0-9]+$,writeOnly=true"`
 		secretBytes []byte
 	}
 
@@ -59,6 +71,7 @@ type (
 	OAuth2Validator struct {
 		spec   *OAuth2ValidatorSpec
 		client *http.Client
+		cache  *introspectionCache
 	}
 
 	tokenInfo struct {
@@ -73,9 +86,92 @@ type (
 		Subject   string `json:"sub"`
 		Audience  string `json:"aud"`
 		Issuer    string `json:"iss"`
+
+		claims map[string]interface{}
+	}
+
+	// introspectionCache caches the introspection results by the hash of
+	// the tokens.
+	introspectionCache struct {
+		mutex      sync.Mutex
+		ttl        time.Duration
+		maxEntries int
+		entries    map[string]*cachedTokenInfo
+	}
+
+	cachedTokenInfo struct {
+		info    *tokenInfo
+		expires time.Time
 	}
 )
 
+const defaultMaxCacheEntries = 10000
+
+func newIntrospectionCache(ttl time.Duration, maxEntries int) *introspectionCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxCacheEntries
+	}
+	return &introspectionCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[string]*cachedTokenInfo{},
+	}
+}
+
+func cacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *introspectionCache) get(token string) *tokenInfo {
+	key := cacheKey(token)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e := c.entries[key]
+	if e == nil {
+		return nil
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return e.info
+}
+
+// put caches the result, the result of an active token is not cached
+// after the token expires.
+func (c *introspectionCache) put(token string, ti *tokenInfo) {
+	now := time.Now()
+	expires := now.Add(c.ttl)
+	if ti.Active && ti.ExpiresAt > 0 {
+		if exp := time.Unix(ti.ExpiresAt, 0); exp.Before(expires) {
+			expires = exp
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.entries) >= c.maxEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	// Evict random entries if still full.
+	for k := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			break
+		}
+		delete(c.entries, k)
+	}
+
+	c.entries[cacheKey(token)] = &cachedTokenInfo{info: ti, expires: expires}
+}
+
 // NewOAuth2Validator creates a new OAuth2 validator
 func NewOAuth2Validator(spec *OAuth2ValidatorSpec) *OAuth2Validator {
 	if spec.JWT != nil {
@@ -89,6 +185,12 @@ func NewOAuth2Validator(spec *OAuth2ValidatorSpec) *OAuth2Validator {
 		} else {
 			v.client = http.DefaultClient
 		}
+		if spec.TokenIntrospect.CacheTTL != "" {
+			ttl, _ := time.ParseDuration(spec.TokenIntrospect.CacheTTL)
+			if ttl > 0 {
+				v.cache = newIntrospectionCache(ttl, spec.TokenIntrospect.MaxCacheEntries)
+			}
+		}
 	}
 	return v
 }
@@ -101,7 +203,7 @@ var fnSendRequest = func(client *http.Client, r *http.Request) (*http.Response,
 func (v *OAuth2Validator) introspectToken(tokenStr string) (*tokenInfo, error) {
 	var body bytes.Buffer
 	body.WriteString("token=")
-	body.WriteString(tokenStr)
+	body.WriteString(url.QueryEscape(tokenStr))
 	if v.spec.TokenIntrospect.ClientID != "" {
 		body.WriteString("&client_id=")
 		body.WriteString(v.spec.TokenIntrospect.ClientID)
@@ -120,6 +222,12 @@ func (v *OAuth2Validator) introspectToken(tokenStr string) (*tokenInfo, error) {
 	if e != nil {
 		return nil, e
 	}
+	defer resp.Body.Close()
+
+	data, e := io.ReadAll(resp.Body)
+	if e != nil {
+		return nil, e
+	}
 
 	var ti struct {
 		tokenInfo
@@ -127,16 +235,58 @@ func (v *OAuth2Validator) introspectToken(tokenStr string) (*tokenInfo, error) {
 		ErrorDesc string `json:"error_description"`
 	}
 
-	if e = codectool.DecodeJSON(resp.Body, &ti); e != nil {
+	if e = codectool.UnmarshalJSON(data, &ti); e != nil {
 		return nil, e
 	}
 	if ti.Error != "" {
 		return nil, fmt.Errorf("%s: %s", ti.Error, ti.ErrorDesc)
 	}
 
+	if len(v.spec.TokenIntrospect.ClaimHeaders) > 0 {
+		if e = codectool.UnmarshalJSON(data, &ti.claims); e != nil {
+			return nil, e
+		}
+	}
+
 	return &ti.tokenInfo, nil
 }
 
+// tokenInfo returns the introspection result of the token, from the cache
+// if possible, errors are not cached.
+func (v *OAuth2Validator) tokenInfo(tokenStr string) (*tokenInfo, error) {
+	if v.cache != nil {
+		if ti := v.cache.get(tokenStr); ti != nil {
+			return ti, nil
+		}
+	}
+
+	ti, e := v.introspectToken(tokenStr)
+	if e != nil {
+		return nil, e
+	}
+	if v.cache != nil {
+		v.cache.put(tokenStr, ti)
+	}
+	return ti, nil
+}
+
+func setClaimHeaders(hdr http.Header, claimHeaders map[string]string, claims map[string]interface{}) {
+	for claim, name := range claimHeaders {
+		// Remove the header from the client even if the claim is absent.
+		hdr.Del(name)
+
+		switch c := claims[claim].(type) {
+		case nil:
+		case string:
+			hdr.Set(name, c)
+		default:
+			if data, err := codectool.MarshalJSON(c); err == nil {
+				hdr.Set(name, string(data))
+			}
+		}
+	}
+}
+
 // Validate validates the access token of a http request
 func (v *OAuth2Validator) Validate(req *httpprot.Request) error {
 	const prefix = "Bearer "
@@ -150,15 +300,19 @@ func (v *OAuth2Validator) Validate(req *httpprot.Request) error {
 
 	var subject, scope string
 	if v.spec.TokenIntrospect != nil {
-		ti, e := v.introspectToken(tokenStr)
+		ti, e := v.tokenInfo(tokenStr)
 		if e != nil {
 			return e
 		}
 		if !ti.Active {
 			return fmt.Errorf("oauth2 authorization failed, token is inactive")
 		}
+		if ti.ExpiresAt > 0 && time.Now().Unix() >= ti.ExpiresAt {
+			return fmt.Errorf("oauth2 authorization failed, token is expired")
+		}
 		subject = ti.Subject
 		scope = ti.Scope
+		setClaimHeaders(hdr, v.spec.TokenIntrospect.ClaimHeaders, ti.claims)
 	} else {
 		token, e := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 			if alg := token.Method.Alg(); alg != v.spec.JWT.Algorithm {
@@ -64,6 +64,7 @@ type (
 		signer    *signer.Signer
 		oauth2    *OAuth2Validator
 		basicAuth *BasicAuthValidator
+		hmac      *HMACValidator
 	}
 
 	// Spec describes the Validator.
@@ -75,12 +76,14 @@ type (
 		Signature *signer.Spec              `json:"signature,omitempty"`
 		OAuth2    *OAuth2ValidatorSpec      `json:"oauth2,omitempty"`
 		BasicAuth *BasicAuthValidatorSpec   `json:"basicAuth,omitempty"`
+		HMAC      *HMACValidatorSpec        `json:"hmac,omitempty"`
 	}
 )
 
 // Validate verifies that at least one of the validations is defined.
 func (spec Spec) Validate() error {
-	if spec == (Spec{}) {
+	if spec.Headers == nil && spec.JWT == nil && spec.Signature == nil &&
+		spec.OAuth2 == nil && spec.BasicAuth == nil && spec.HMAC == nil {
 		return fmt.Errorf("none of the validations are defined")
 	}
 	return nil
@@ -127,13 +130,16 @@ func (v *Validator) reload() {
 	if v.spec.BasicAuth != nil {
 		v.basicAuth = NewBasicAuthValidator(v.spec.BasicAuth, v.spec.Super())
 	}
+	if v.spec.HMAC != nil {
+		v.hmac = NewHMACValidator(v.spec.HMAC)
+	}
 }
 
 // Handle validates the request in the context.
 func (v *Validator) Handle(ctx *context.Context) string {
 	req := ctx.GetInputRequest().(*httpprot.Request)
 
-	prepareErrorResponse := func(status int, tagPrefix string, err error) {
+	prepareErrorResponse := func(status int, tagPrefix string, err error) *httpprot.Response {
 		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
 		if resp == nil {
 			resp, _ = httpprot.NewResponse(nil)
@@ -142,6 +148,7 @@ func (v *Validator) Handle(ctx *context.Context) string {
 		resp.SetStatusCode(status)
 		ctx.SetOutputResponse(resp)
 		ctx.AddTag(stringtool.Cat(tagPrefix, err.Error()))
+		return resp
 	}
 
 	if v.headers != nil {
@@ -152,7 +159,10 @@ func (v *Validator) Handle(ctx *context.Context) string {
 	}
 	if v.jwt != nil {
 		if err := v.jwt.Validate(req); err != nil {
-			prepareErrorResponse(http.StatusUnauthorized, "JWT validator: ", err)
+			resp := prepareErrorResponse(http.StatusUnauthorized, "JWT validator: ", err)
+			if v.spec.JWT.ErrorResponse != nil {
+				v.spec.JWT.ErrorResponse.apply(resp)
+			}
 			return resultInvalid
 		}
 	}
@@ -178,6 +188,12 @@ func (v *Validator) Handle(ctx *context.Context) string {
 			return resultInvalid
 		}
 	}
+	if v.hmac != nil {
+		if err := v.hmac.Validate(req); err != nil {
+			prepareErrorResponse(http.StatusUnauthorized, "hmac validator: ", err)
+			return resultInvalid
+		}
+	}
 
 	return ""
 }
@@ -187,6 +203,9 @@ func (v *Validator) Status() interface{} { return nil }
 
 // Close closes validations.
 func (v *Validator) Close() {
+	if v.jwt != nil {
+		v.jwt.Close()
+	}
 	if v.basicAuth != nil {
 		v.basicAuth.Close()
 	}
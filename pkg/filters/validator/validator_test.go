@@ -18,15 +18,27 @@
 package validator
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
+
 	cluster "github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
 	"github.com/megaease/easegress/v2/pkg/context"
@@ -243,6 +255,154 @@ jwt:
 	}
 }
 
+type jwksServer struct {
+	*httptest.Server
+	mutex sync.Mutex
+	keys  map[string]*rsa.PrivateKey
+	hits  int
+}
+
+func newJWKSServer() *jwksServer {
+	js := &jwksServer{keys: map[string]*rsa.PrivateKey{}}
+	js.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js.mutex.Lock()
+		defer js.mutex.Unlock()
+		js.hits++
+
+		var keys []map[string]string
+		for kid, key := range js.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		codectool.MustEncodeJSON(w, map[string]interface{}{"keys": keys})
+	}))
+	return js
+}
+
+func (js *jwksServer) rotate(kid string) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	js.mutex.Lock()
+	js.keys = map[string]*rsa.PrivateKey{kid: key}
+	js.mutex.Unlock()
+}
+
+func (js *jwksServer) sign(kid string, claims jwt.MapClaims) string {
+	js.mutex.Lock()
+	key := js.keys[kid]
+	js.mutex.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	s, _ := token.SignedString(key)
+	return s
+}
+
+func TestJWTWithJWKS(t *testing.T) {
+	assert := assert.New(t)
+
+	js := newJWKSServer()
+	defer js.Close()
+	js.rotate("key1")
+
+	yamlConfig := `
+kind: Validator
+name: validator
+jwt:
+  jwks:
+    url: ` + js.URL + `
+    refreshRateLimit: 1ms
+  issuer: https://issuer.example.com
+  audiences: [api, web]
+  requireExpiration: true
+  claims:
+  - name: roles
+    values: [admin]
+  - name: email
+  claimHeaders:
+    sub: X-User-Id
+    roles: X-User-Roles
+  errorResponse:
+    statusCode: 403
+    headers:
+      Content-Type: application/json
+    body: '{"error":"forbidden"}'
+`
+	v := createValidator(yamlConfig, nil, nil)
+	defer v.Close()
+
+	handle := func(token string) (string, *context.Context) {
+		ctx := context.New(nil)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		assert.Nil(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-User-Id", "spoofed")
+		setRequest(t, ctx, req)
+		return v.Handle(ctx), ctx
+	}
+
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   "https://issuer.example.com",
+			"aud":   []string{"web"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"sub":   "alice",
+			"email": "alice@example.com",
+			"roles": []string{"dev", "admin"},
+		}
+	}
+
+	result, ctx := handle(js.sign("key1", claims()))
+	assert.Equal("", result)
+	hdr := ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	assert.Equal("alice", hdr.Get("X-User-Id"))
+	assert.Equal(`["dev","admin"]`, hdr.Get("X-User-Roles"))
+
+	for _, change := range []func(c jwt.MapClaims){
+		func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" },
+		func(c jwt.MapClaims) { c["aud"] = "mobile" },
+		func(c jwt.MapClaims) { delete(c, "exp") },
+		func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		func(c jwt.MapClaims) { c["roles"] = "dev" },
+		func(c jwt.MapClaims) { delete(c, "email") },
+	} {
+		c := claims()
+		change(c)
+		result, ctx = handle(js.sign("key1", c))
+		assert.Equal(resultInvalid, result)
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(http.StatusForbidden, resp.StatusCode())
+		assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+		assert.Equal(`{"error":"forbidden"}`, string(resp.RawPayload()))
+	}
+
+	// the key is rotated, the unknown kid triggers a refresh
+	js.rotate("key2")
+	time.Sleep(10 * time.Millisecond)
+	result, _ = handle(js.sign("key2", claims()))
+	assert.Equal("", result)
+	assert.Equal(2, js.hits)
+}
+
+func TestJWTValidatorSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &JWTValidatorSpec{}
+	assert.NotNil(spec.Validate())
+	spec.Algorithm = "HS256"
+	assert.Nil(spec.Validate())
+
+	spec = &JWTValidatorSpec{JWKS: &JWKSSpec{URL: "http://127.0.0.1/jwks"}, Secret: "3132"}
+	assert.NotNil(spec.Validate())
+	spec.Secret = ""
+	assert.Nil(spec.Validate())
+}
+
 func TestOAuth2JWT(t *testing.T) {
 	assert := assert.New(t)
 
@@ -350,6 +510,182 @@ oauth2:
 	}
 }
 
+func TestOAuth2TokenIntrospectCache(t *testing.T) {
+	assert := assert.New(t)
+	yamlConfig := `
+kind: Validator
+name: validator
+oauth2:
+  tokenIntrospect:
+    endPoint: http://oauth2.megaease.com/
+    clientId: megaease
+    clientSecret: secret
+    cacheTTL: 1m
+    maxCacheEntries: 1
+    claimHeaders:
+      username: X-User-Name
+      roles: X-User-Roles
+      email: X-User-Email
+`
+	v := createValidator(yamlConfig, nil, nil)
+
+	calls := 0
+	body := `{"active": true, "sub": "1234", "username": "alice", "roles": ["admin", "dev"]}`
+	fnSendRequest = func(client *http.Client, r *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{Body: io.NopCloser(strings.NewReader(body))}, nil
+	}
+
+	handle := func(token string) (string, http.Header) {
+		ctx := context.New(nil)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		assert.Nil(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-User-Email", "spoofed@example.com")
+		setRequest(t, ctx, req)
+		return v.Handle(ctx), ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	}
+
+	result, hdr := handle("token1")
+	assert.Equal("", result)
+	assert.Equal("alice", hdr.Get("X-User-Name"))
+	assert.Equal(`["admin","dev"]`, hdr.Get("X-User-Roles"))
+	assert.Equal("", hdr.Get("X-User-Email"))
+	assert.Equal("1234", hdr.Get("X-Authenticated-Userid"))
+
+	result, hdr = handle("token1")
+	assert.Equal("", result)
+	assert.Equal("alice", hdr.Get("X-User-Name"))
+	assert.Equal(1, calls)
+
+	// the cache holds one entry only, token1 is evicted
+	body = `{"active": false}`
+	result, _ = handle("token2")
+	assert.Equal(resultInvalid, result)
+	result, _ = handle("token2")
+	assert.Equal(resultInvalid, result)
+	assert.Equal(2, calls)
+
+	result, _ = handle("token1")
+	assert.Equal(resultInvalid, result)
+	assert.Equal(3, calls)
+
+	// expired tokens are rejected even if they are active
+	body = fmt.Sprintf(`{"active": true, "exp": %d}`, time.Now().Add(-time.Second).Unix())
+	result, _ = handle("token3")
+	assert.Equal(resultInvalid, result)
+}
+
+func TestHMAC(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: Validator
+name: validator
+hmac:
+  algorithm: sha256
+  secrets: [old-secret, new-secret]
+  signatureHeader: X-Signature
+  signaturePrefix: sha256=
+  signedParts: [timestamp, nonce, method, path, header:X-Partner, body]
+  separator: "\n"
+  timestampHeader: X-Timestamp
+  nonceHeader: X-Nonce
+  maxClockSkew: 1m
+`
+	v := createValidator(yamlConfig, nil, nil)
+
+	sign := func(secret, ts, nonce, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(ts + "\n" + nonce + "\nPOST\n/hook\nacme\n" + body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	handle := func(signature, ts, nonce, body string) string {
+		ctx := context.New(nil)
+		req, err := http.NewRequest(http.MethodPost, "http://example.com/hook", strings.NewReader(body))
+		assert.Nil(err)
+		req.Header.Set("X-Signature", signature)
+		req.Header.Set("X-Timestamp", ts)
+		req.Header.Set("X-Nonce", nonce)
+		req.Header.Set("X-Partner", "acme")
+		r, err := httpprot.NewRequest(req)
+		assert.Nil(err)
+		assert.Nil(r.FetchPayload(0))
+		ctx.SetInputRequest(r)
+		return v.Handle(ctx)
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	body := `{"event":"push"}`
+
+	assert.Equal("", handle(sign("new-secret", now, "n1", body), now, "n1", body))
+	assert.Equal("", handle(sign("old-secret", now, "n2", body), now, "n2", body))
+
+	// replayed nonce
+	assert.Equal(resultInvalid, handle(sign("new-secret", now, "n1", body), now, "n1", body))
+	// forged requests don't consume the nonce
+	assert.Equal(resultInvalid, handle(sign("bad-secret", now, "n3", body), now, "n3", body))
+	assert.Equal("", handle(sign("new-secret", now, "n3", body), now, "n3", body))
+	// tampered body
+	assert.Equal(resultInvalid, handle(sign("new-secret", now, "n4", body), now, "n4", `{"event":"delete"}`))
+	// clock skew
+	old := strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10)
+	assert.Equal(resultInvalid, handle(sign("new-secret", old, "n5", body), old, "n5", body))
+	// bad encoding and missing signature
+	assert.Equal(resultInvalid, handle("sha256=xyz", now, "n6", body))
+	assert.Equal(resultInvalid, handle("", now, "n7", body))
+}
+
+func TestHMACSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &HMACValidatorSpec{SignedParts: []string{"body", "header:X-A"}}
+	assert.Nil(spec.Validate())
+	spec.SignedParts = []string{"cookie"}
+	assert.NotNil(spec.Validate())
+	spec.SignedParts = []string{"timestamp"}
+	assert.NotNil(spec.Validate())
+	spec.SignedParts, spec.NonceHeader = nil, "X-Nonce"
+	assert.NotNil(spec.Validate())
+	// the timestamp and nonce must be signed
+	spec.TimestampHeader = "X-Timestamp"
+	spec.SignedParts = []string{"nonce", "body"}
+	assert.NotNil(spec.Validate())
+	spec.SignedParts = []string{"timestamp", "body"}
+	assert.NotNil(spec.Validate())
+	spec.SignedParts = []string{"timestamp", "nonce", "body"}
+	assert.Nil(spec.Validate())
+
+	// GitHub style webhook signature with base64 encoding
+	v := NewHMACValidator(&HMACValidatorSpec{
+		Secrets:         []string{"secret"},
+		SignatureHeader: "X-Hub-Signature",
+		Encoding:        "base64",
+		Algorithm:       "sha1",
+	})
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write([]byte("payload"))
+
+	stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("payload"))
+	stdr.Header.Set("X-Hub-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	assert.Nil(v.Validate(req))
+
+	c := &nonceCache{maxEntries: 2, entries: map[string]time.Time{}}
+	exp := time.Now().Add(time.Minute)
+	assert.Nil(c.add("a", exp))
+	assert.NotNil(c.add("a", exp))
+	assert.Nil(c.add("b", exp))
+	// unexpired nonces are never evicted
+	assert.NotNil(c.add("c", exp))
+	assert.Len(c.entries, 2)
+	c.entries["b"] = time.Now().Add(-time.Second)
+	assert.Nil(c.add("c", exp))
+	assert.NotNil(c.add("a", exp))
+}
+
 func TestSignature(t *testing.T) {
 	// This test is almost covered by signer
 
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waf
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	coreruleset "github.com/corazawaf/coraza-coreruleset/v4"
+)
+
+const (
+	crsDir = "@owasp_crs/"
+
+	crsInitialization       = crsDir + "REQUEST-901-INITIALIZATION.conf"
+	crsBlockingEvaluation   = crsDir + "REQUEST-949-BLOCKING-EVALUATION.conf"
+	defaultParanoiaLevel    = 1
+	defaultAnomalyThreshold = 5
+)
+
+// rootFS reads the embedded files of the OWASP CRS, whose names contain a
+// "@", and the files of the OS otherwise.
+type rootFS struct{}
+
+func embedded(name string) (string, bool) {
+	if i := strings.Index(name, "@"); i != -1 {
+		return name[i:], true
+	}
+	return name, false
+}
+
+// Open implements fs.FS.
+func (rootFS) Open(name string) (fs.File, error) {
+	if n, ok := embedded(name); ok {
+		return coreruleset.FS.Open(n)
+	}
+	return os.Open(name)
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (rootFS) ReadFile(name string) ([]byte, error) {
+	if n, ok := embedded(name); ok {
+		return fs.ReadFile(coreruleset.FS, n)
+	}
+	return os.ReadFile(name)
+}
+
+// Glob implements fs.GlobFS.
+func (rootFS) Glob(pattern string) ([]string, error) {
+	if p, ok := embedded(pattern); ok {
+		return fs.Glob(coreruleset.FS, p)
+	}
+	return filepath.Glob(pattern)
+}
+
+// crsFiles returns the CRS rule files matching the patterns, the
+// initialization and the blocking evaluation files are always included,
+// otherwise the anomaly scoring doesn't work.
+func crsFiles(patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"*.conf"}
+	}
+
+	set := map[string]struct{}{
+		crsInitialization:     {},
+		crsBlockingEvaluation: {},
+	}
+	for _, p := range patterns {
+		files, err := fs.Glob(coreruleset.FS, crsDir+p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid crs include pattern %q: %v", p, err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("crs include pattern %q matches no files", p)
+		}
+		for _, f := range files {
+			if strings.HasSuffix(f, ".conf") {
+				set[f] = struct{}{}
+			}
+		}
+	}
+
+	files := make([]string, 0, len(set))
+	for f := range set {
+		files = append(files, f)
+	}
+	// the files are numbered in the order they must be loaded.
+	sort.Strings(files)
+	return files, nil
+}
+
+// directives builds the SecLang directives of the spec.
+func (spec *Spec) directives() (string, error) {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, format+"\n", args...)
+	}
+
+	line("Include @coraza.conf-recommended")
+	if spec.Mode == modeDetectionOnly {
+		line("SecRuleEngine DetectionOnly")
+	} else {
+		line("SecRuleEngine On")
+	}
+	// the response is not inspected, and the audit events are generated
+	// by the filter itself.
+	line("SecResponseBodyAccess Off")
+	line("SecAuditEngine Off")
+	if spec.RequestBodyLimit > 0 {
+		line("SecRequestBodyLimit %d", spec.RequestBodyLimit)
+	}
+
+	if crs := spec.CRS; crs != nil {
+		paranoiaLevel := crs.ParanoiaLevel
+		if paranoiaLevel == 0 {
+			paranoiaLevel = defaultParanoiaLevel
+		}
+		threshold := crs.InboundAnomalyThreshold
+		if threshold == 0 {
+			threshold = defaultAnomalyThreshold
+		}
+
+		line("Include @crs-setup.conf.example")
+		line(`SecAction "id:900000,phase:1,pass,t:none,nolog,setvar:tx.blocking_paranoia_level=%d"`, paranoiaLevel)
+		line(`SecAction "id:900110,phase:1,pass,t:none,nolog,setvar:tx.inbound_anomaly_score_threshold=%d,setvar:tx.outbound_anomaly_score_threshold=4"`, threshold)
+
+		files, err := crsFiles(crs.Include)
+		if err != nil {
+			return "", err
+		}
+		for _, f := range files {
+			line("Include %s", f)
+		}
+	}
+
+	for _, f := range spec.DirectivesFiles {
+		line("Include %s", f)
+	}
+	if spec.Directives != "" {
+		line("%s", spec.Directives)
+	}
+
+	for _, id := range spec.ExcludeRuleIDs {
+		line("SecRuleRemoveById %d", id)
+	}
+	for _, tag := range spec.ExcludeRuleTags {
+		line("SecRuleRemoveByTag %q", tag)
+	}
+
+	return b.String(), nil
+}
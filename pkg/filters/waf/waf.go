@@ -0,0 +1,370 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package waf provides the WAF filter.
+package waf
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/types"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of WAF.
+	Kind = "WAF"
+
+	resultBlocked = "blocked"
+
+	modeBlock         = "block"
+	modeDetectionOnly = "detectionOnly"
+
+	actionBlocked  = "blocked"
+	actionDetected = "detected"
+
+	defaultMaxAuditEvents = 100
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "WAF inspects requests with the Coraza engine and the OWASP Core Rule Set.",
+	Results:     []string{resultBlocked},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Mode:           modeBlock,
+			MaxAuditEvents: defaultMaxAuditEvents,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &WAF{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// WAF is filter WAF.
+	WAF struct {
+		spec *Spec
+		waf  coraza.WAF
+
+		requests uint64
+		blocked  uint64
+		detected uint64
+
+		eventsLock sync.Mutex
+		events     []*AuditEvent
+		next       int
+	}
+
+	// Spec describes the WAF.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Mode             string   `json:"mode,omitempty" jsonschema:"enum=block,enum=detectionOnly"`
+		CRS              *CRSSpec `json:"crs,omitempty"`
+		Directives       string   `json:"directives,omitempty"`
+		DirectivesFiles  []string `json:"directivesFiles,omitempty"`
+		ExcludeRuleIDs   []int    `json:"excludeRuleIDs,omitempty" jsonschema:"uniqueItems=true"`
+		ExcludeRuleTags  []string `json:"excludeRuleTags,omitempty" jsonschema:"uniqueItems=true"`
+		RequestBodyLimit int64    `json:"requestBodyLimit,omitempty" jsonschema:"minimum=0"`
+		MaxAuditEvents   int      `json:"maxAuditEvents,omitempty" jsonschema:"minimum=0"`
+	}
+
+	// CRSSpec describes the OWASP Core Rule Set.
+	CRSSpec struct {
+		ParanoiaLevel           int      `json:"paranoiaLevel,omitempty" jsonschema:"minimum=1,maximum=4"`
+		InboundAnomalyThreshold int      `json:"inboundAnomalyThreshold,omitempty" jsonschema:"minimum=1"`
+		Include                 []string `json:"include,omitempty"`
+	}
+
+	// Status is the status of WAF.
+	Status struct {
+		Requests uint64        `json:"requests"`
+		Blocked  uint64        `json:"blocked"`
+		Detected uint64        `json:"detected"`
+		Events   []*AuditEvent `json:"events,omitempty"`
+	}
+
+	// AuditEvent is the audit event of a request which matched rules.
+	AuditEvent struct {
+		Time          time.Time      `json:"time"`
+		TransactionID string         `json:"transactionID"`
+		ClientIP      string         `json:"clientIP"`
+		Method        string         `json:"method"`
+		URI           string         `json:"uri"`
+		Action        string         `json:"action"`
+		StatusCode    int            `json:"statusCode,omitempty"`
+		Rules         []*MatchedRule `json:"rules"`
+	}
+
+	// MatchedRule is a rule matched by a request.
+	MatchedRule struct {
+		ID       int      `json:"id"`
+		Message  string   `json:"message"`
+		Severity string   `json:"severity"`
+		Tags     []string `json:"tags,omitempty"`
+		Data     string   `json:"data,omitempty"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Mode != "" && spec.Mode != modeBlock && spec.Mode != modeDetectionOnly {
+		return fmt.Errorf("invalid mode %q", spec.Mode)
+	}
+	if spec.CRS == nil && spec.Directives == "" && len(spec.DirectivesFiles) == 0 {
+		return fmt.Errorf("none of crs, directives and directivesFiles is specified")
+	}
+	if crs := spec.CRS; crs != nil {
+		if crs.ParanoiaLevel < 0 || crs.ParanoiaLevel > 4 {
+			return fmt.Errorf("invalid paranoia level %d", crs.ParanoiaLevel)
+		}
+		if crs.InboundAnomalyThreshold < 0 {
+			return fmt.Errorf("invalid inbound anomaly threshold %d", crs.InboundAnomalyThreshold)
+		}
+	}
+
+	_, err := spec.newWAF()
+	return err
+}
+
+func (spec *Spec) newWAF() (coraza.WAF, error) {
+	directives, err := spec.directives()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := coraza.NewWAFConfig().WithRootFS(rootFS{}).WithDirectives(directives)
+	waf, err := coraza.NewWAF(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create waf failed: %v", err)
+	}
+	return waf, nil
+}
+
+// Name returns the name of the WAF filter instance.
+func (w *WAF) Name() string {
+	return w.spec.Name()
+}
+
+// Kind returns the kind of WAF.
+func (w *WAF) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the WAF
+func (w *WAF) Spec() filters.Spec {
+	return w.spec
+}
+
+// Init initializes WAF.
+func (w *WAF) Init() {
+	w.reload()
+}
+
+// Inherit inherits previous generation of WAF.
+func (w *WAF) Inherit(_ filters.Filter) {
+	w.Init()
+}
+
+func (w *WAF) reload() {
+	waf, err := w.spec.newWAF()
+	if err != nil {
+		// the spec has been validated, so this should never happen.
+		logger.Errorf("BUG: %v", err)
+		return
+	}
+	w.waf = waf
+}
+
+// Handle inspects the request.
+func (w *WAF) Handle(ctx *context.Context) string {
+	atomic.AddUint64(&w.requests, 1)
+	if w.waf == nil {
+		return ""
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	tx := w.waf.NewTransaction()
+	defer func() {
+		tx.ProcessLogging()
+		tx.Close()
+	}()
+
+	it := w.process(tx, req)
+	w.audit(tx, req, it)
+	if it == nil {
+		return ""
+	}
+
+	code := it.Status
+	if code == 0 || it.Action != "deny" {
+		code = http.StatusForbidden
+	}
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	ctx.SetOutputResponse(resp)
+	return resultBlocked
+}
+
+func (w *WAF) process(tx types.Transaction, req *httpprot.Request) *types.Interruption {
+	stdr := req.Std()
+
+	clientPort := 0
+	if _, port, err := net.SplitHostPort(stdr.RemoteAddr); err == nil {
+		clientPort, _ = strconv.Atoi(port)
+	}
+	tx.ProcessConnection(req.RealIP(), clientPort, "", 0)
+	tx.ProcessURI(requestURI(stdr), req.Method(), req.Proto())
+	if tx.IsRuleEngineOff() {
+		return nil
+	}
+
+	for k, vs := range req.HTTPHeader() {
+		for _, v := range vs {
+			tx.AddRequestHeader(k, v)
+		}
+	}
+	if host := req.Host(); host != "" {
+		tx.AddRequestHeader("Host", host)
+		tx.SetServerName(host)
+	}
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		return it
+	}
+
+	// the body of a stream request is not inspected, as it can only be
+	// read once.
+	if tx.IsRequestBodyAccessible() && !req.IsStream() {
+		if it, _, err := tx.WriteRequestBody(req.RawPayload()); err != nil {
+			logger.Errorf("%s: write request body failed: %v", w.spec.Name(), err)
+			return nil
+		} else if it != nil {
+			return it
+		}
+	}
+	it, err := tx.ProcessRequestBody()
+	if err != nil {
+		logger.Errorf("%s: process request body failed: %v", w.spec.Name(), err)
+		return nil
+	}
+	return it
+}
+
+// requestURI returns the unmodified request URI if the request is from
+// the server.
+func requestURI(stdr *http.Request) string {
+	if stdr.RequestURI != "" {
+		return stdr.RequestURI
+	}
+	return stdr.URL.RequestURI()
+}
+
+func (w *WAF) audit(tx types.Transaction, req *httpprot.Request, it *types.Interruption) {
+	var rules []*MatchedRule
+	for _, mr := range tx.MatchedRules() {
+		// rules without messages are the helper rules, like the ones
+		// setting the variables.
+		if mr.Message() == "" {
+			continue
+		}
+		rule := mr.Rule()
+		rules = append(rules, &MatchedRule{
+			ID:       rule.ID(),
+			Message:  mr.Message(),
+			Severity: rule.Severity().String(),
+			Tags:     rule.Tags(),
+			Data:     mr.Data(),
+		})
+	}
+	if len(rules) == 0 && it == nil {
+		return
+	}
+
+	event := &AuditEvent{
+		Time:          time.Now(),
+		TransactionID: tx.ID(),
+		ClientIP:      req.RealIP(),
+		Method:        req.Method(),
+		URI:           requestURI(req.Std()),
+		Action:        actionDetected,
+		Rules:         rules,
+	}
+	if it != nil {
+		event.Action = actionBlocked
+		event.StatusCode = it.Status
+		atomic.AddUint64(&w.blocked, 1)
+	} else {
+		atomic.AddUint64(&w.detected, 1)
+	}
+
+	logger.Infof("%s: waf audit event: %s", w.spec.Name(), codectool.MustMarshalJSON(event))
+	w.addEvent(event)
+}
+
+func (w *WAF) addEvent(event *AuditEvent) {
+	max := w.spec.MaxAuditEvents
+	if max <= 0 {
+		return
+	}
+
+	w.eventsLock.Lock()
+	defer w.eventsLock.Unlock()
+
+	if len(w.events) < max {
+		w.events = append(w.events, event)
+		return
+	}
+	w.events[w.next] = event
+	w.next = (w.next + 1) % max
+}
+
+// Status returns status.
+func (w *WAF) Status() interface{} {
+	s := &Status{
+		Requests: atomic.LoadUint64(&w.requests),
+		Blocked:  atomic.LoadUint64(&w.blocked),
+		Detected: atomic.LoadUint64(&w.detected),
+	}
+
+	w.eventsLock.Lock()
+	defer w.eventsLock.Unlock()
+	// the oldest event first.
+	s.Events = append(s.Events, w.events[w.next:]...)
+	s.Events = append(s.Events, w.events[:w.next]...)
+	return s
+}
+
+// Close closes WAF.
+func (w *WAF) Close() {
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waf
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newSpec(t *testing.T, yamlConfig string) (*Spec, error) {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		return nil, err
+	}
+	return spec.(*Spec), nil
+}
+
+func newWAF(t *testing.T, yamlConfig string) *WAF {
+	spec, err := newSpec(t, yamlConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := kind.CreateInstance(spec).(*WAF)
+	w.Init()
+	return w
+}
+
+func newContext(t *testing.T, method, url, body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(method, url, strings.NewReader(body))
+	stdr.RemoteAddr = "192.168.1.1:1234"
+	stdr.Header.Set("User-Agent", "Mozilla/5.0")
+	stdr.Header.Set("Accept", "*/*")
+	if body != "" {
+		stdr.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	assert.Nil(t, req.FetchPayload(0))
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+const customDirectives = `
+kind: WAF
+name: waf
+directives: |
+  SecRule ARGS:id "@rx ^[0-9]+$" "id:1001,phase:1,pass,nolog"
+  SecRule ARGS:id "!@rx ^[0-9]+$" "id:1002,phase:1,deny,status:400,log,msg:'invalid id',tag:'custom'"
+  SecRule REQUEST_BODY "@contains evil" "id:1003,phase:2,deny,log,msg:'evil body'"
+`
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newSpec(t, `
+kind: WAF
+name: waf
+`)
+	assert.NotNil(err)
+
+	_, err = newSpec(t, `
+kind: WAF
+name: waf
+mode: unknown
+directives: SecRuleEngine On
+`)
+	assert.NotNil(err)
+
+	_, err = newSpec(t, `
+kind: WAF
+name: waf
+directives: SecUnknownDirective On
+`)
+	assert.NotNil(err)
+
+	_, err = newSpec(t, `
+kind: WAF
+name: waf
+crs:
+  include: ["REQUEST-999-*.conf"]
+`)
+	assert.NotNil(err)
+
+	_, err = newSpec(t, customDirectives)
+	assert.Nil(err)
+}
+
+func TestDirectives(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newWAF(t, customDirectives)
+
+	ctx := newContext(t, http.MethodGet, "http://127.0.0.1/?id=123", "")
+	assert.Equal("", w.Handle(ctx))
+
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/?id=abc", "")
+	assert.Equal(resultBlocked, w.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext(t, http.MethodPost, "http://127.0.0.1/?id=1", "a=evil")
+	assert.Equal(resultBlocked, w.Handle(ctx))
+	assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	s := w.Status().(*Status)
+	assert.Equal(uint64(3), s.Requests)
+	assert.Equal(uint64(2), s.Blocked)
+	assert.Len(s.Events, 2)
+	assert.Equal(actionBlocked, s.Events[0].Action)
+	assert.Equal(1002, s.Events[0].Rules[0].ID)
+	assert.Equal("invalid id", s.Events[0].Rules[0].Message)
+	assert.Equal([]string{"custom"}, s.Events[0].Rules[0].Tags)
+	assert.Equal(1003, s.Events[1].Rules[0].ID)
+}
+
+func TestDetectionOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newWAF(t, customDirectives+"mode: detectionOnly\n")
+
+	ctx := newContext(t, http.MethodGet, "http://127.0.0.1/?id=abc", "")
+	assert.Equal("", w.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+
+	s := w.Status().(*Status)
+	assert.Equal(uint64(0), s.Blocked)
+	assert.Equal(uint64(1), s.Detected)
+	assert.Equal(actionDetected, s.Events[0].Action)
+}
+
+func TestDirectivesFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "rules.conf")
+	os.WriteFile(path, []byte(`SecRule REQUEST_URI "@beginsWith /admin" "id:2001,phase:1,deny,log,msg:'admin'"`), 0o644)
+
+	w := newWAF(t, `
+kind: WAF
+name: waf
+directivesFiles: ["`+path+`"]
+`)
+
+	ctx := newContext(t, http.MethodGet, "http://127.0.0.1/admin", "")
+	assert.Equal(resultBlocked, w.Handle(ctx))
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/user", "")
+	assert.Equal("", w.Handle(ctx))
+}
+
+func TestAuditEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newWAF(t, customDirectives+"maxAuditEvents: 2\n")
+	for _, id := range []string{"a", "b", "c"} {
+		w.Handle(newContext(t, http.MethodGet, "http://127.0.0.1/?id="+id, ""))
+	}
+
+	s := w.Status().(*Status)
+	assert.Len(s.Events, 2)
+	assert.Equal("/?id=b", s.Events[0].URI)
+	assert.Equal("/?id=c", s.Events[1].URI)
+}
+
+func TestCRS(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newWAF(t, `
+kind: WAF
+name: waf
+crs:
+  paranoiaLevel: 1
+`)
+
+	ctx := newContext(t, http.MethodGet, "http://127.0.0.1/?q=hello", "")
+	assert.Equal("", w.Handle(ctx))
+
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/?id=1%27%20OR%20%271%27%3D%271", "")
+	assert.Equal(resultBlocked, w.Handle(ctx))
+
+	ctx = newContext(t, http.MethodPost, "http://127.0.0.1/", "q=<script>alert(1)</script>")
+	assert.Equal(resultBlocked, w.Handle(ctx))
+
+	// exclude the SQL injection rules.
+	w = newWAF(t, `
+kind: WAF
+name: waf
+crs:
+  include: ["REQUEST-942-*.conf"]
+excludeRuleTags: ["attack-sqli"]
+`)
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/?id=1%27%20OR%20%271%27%3D%271", "")
+	assert.Equal("", w.Handle(ctx))
+
+	// only the SQL injection rules are included.
+	w = newWAF(t, `
+kind: WAF
+name: waf
+crs:
+  include: ["REQUEST-942-*.conf"]
+`)
+	ctx = newContext(t, http.MethodPost, "http://127.0.0.1/", "q=<script>alert(1)</script>")
+	assert.Equal("", w.Handle(ctx))
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/?id=1%27%20OR%20%271%27%3D%271", "")
+	assert.Equal(resultBlocked, w.Handle(ctx))
+}
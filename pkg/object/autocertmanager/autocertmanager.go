@@ -123,6 +123,10 @@ type (
 	CertificateStatus struct {
 		Name       string    `json:"name"`
 		ExpireTime time.Time `json:"expireTime"`
+		// LastRenewTime and LastRenewError are the result of the last
+		// renewal on this member, they are empty on the other members.
+		LastRenewTime  time.Time `json:"lastRenewTime,omitempty"`
+		LastRenewError string    `json:"lastRenewError,omitempty"`
 	}
 
 	// Status is the status of AutoCertManager.
@@ -224,7 +228,8 @@ func (acm *AutoCertManager) findDomain(name string, exactMatch bool) *Domain {
 		if exactMatch || !domain.isWildcard() {
 			continue
 		}
-		if strings.HasSuffix(name, domain.Name[1:]) {
+		// The wildcard matches exactly one level of subdomain.
+		if dot := strings.IndexByte(name, '.'); dot > 0 && name[dot:] == domain.Name[1:] {
 			return domain
 		}
 	}
@@ -271,10 +276,15 @@ func (acm *AutoCertManager) Status() *supervisor.Status {
 	status := &Status{}
 	for i := range acm.domains {
 		d := &acm.domains[i]
-		status.Domains = append(status.Domains, CertificateStatus{
+		cs := CertificateStatus{
 			Name:       d.Name,
 			ExpireTime: d.certExpireTime(),
-		})
+		}
+		if r := d.renewResult(); r != nil {
+			cs.LastRenewTime = r.time
+			cs.LastRenewError = r.err
+		}
+		status.Domains = append(status.Domains, cs)
 	}
 	return &supervisor.Status{ObjectStatus: status}
 }
@@ -304,31 +314,54 @@ func (acm *AutoCertManager) renew() bool {
 		}
 
 		logger.Infof("begin renew certificate for domain %s", d.Name)
-		if err := d.renewCert(acm); err == nil {
+		err := d.renewCert(acm)
+		if err == nil {
 			logger.Infof("certificate for domain %s has been renewed", d.Name)
 		} else {
 			logger.Errorf("failed to renew certificate for domain %s: %v", d.Name, err)
 			allSucc = false
 		}
+		d.setRenewResult(err)
 	}
 
 	return allSucc
 }
 
+// createAcmeClient creates the ACME client with the account key stored in
+// the cluster, so the account is shared by all members and kept across
+// restarts. A new account is registered if there's no account key.
 func (acm *AutoCertManager) createAcmeClient() error {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, err := acm.storage.getAccountKey(acm.spec.DirectoryURL, acm.spec.Email)
 	if err != nil {
-		logger.Errorf("failed to generate new account: %v", err)
+		logger.Errorf("failed to load account key: %v", err)
 		return err
 	}
 
+	var newKey *ecdsa.PrivateKey
+	if key == nil {
+		newKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			logger.Errorf("failed to generate new account: %v", err)
+			return err
+		}
+		key = newKey
+	}
+
 	cl := &acme.Client{Key: key, DirectoryURL: acm.spec.DirectoryURL}
 	acct := &acme.Account{Contact: []string{"mailto:" + acm.spec.Email}}
-	if _, err := cl.Register(acm.stopCtx, acct, acme.AcceptTOS); err != nil {
+	_, err = cl.Register(acm.stopCtx, acct, acme.AcceptTOS)
+	if err != nil && err != acme.ErrAccountAlreadyExists {
 		logger.Errorf("failed to register: %v", err)
 		return err
 	}
 
+	if newKey != nil {
+		if err := acm.storage.putAccountKey(acm.spec.DirectoryURL, acm.spec.Email, newKey); err != nil {
+			logger.Errorf("failed to store account key: %v", err)
+			return err
+		}
+	}
+
 	acm.client = cl
 	return nil
 }
@@ -344,21 +377,17 @@ func (acm *AutoCertManager) watchCertificate() {
 	acm.storage.watchCertificate(acm.stopCtx, onChange)
 }
 
+// run renews the certificates periodically. Only the leader creates the
+// ACME client and renews certificates, the other members get the renewed
+// certificates from the cluster.
 func (acm *AutoCertManager) run() {
-	for {
-		if err := acm.createAcmeClient(); err == nil {
-			break
-		}
-		select {
-		case <-acm.stopCtx.Done():
-			return
-		case <-time.After(30 * time.Second):
-		}
-	}
-
 	for {
 		waitDuration := time.Hour
-		if allSucc := acm.renew(); !allSucc {
+		switch {
+		case !acm.super.Cluster().IsLeader():
+		case acm.client == nil && acm.createAcmeClient() != nil:
+			waitDuration = 30 * time.Second
+		case !acm.renew():
 			waitDuration = 10 * time.Minute
 		}
 
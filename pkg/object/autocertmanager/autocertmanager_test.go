@@ -633,9 +633,37 @@ directoryURL: ` + url
 		t.Error("token should exist")
 	}
 
-	if len(acm.Status().ObjectStatus.(*Status).Domains) != 2 {
+	status := acm.Status().ObjectStatus.(*Status)
+	if len(status.Domains) != 2 {
 		t.Error("bad status")
 	}
+	for _, d := range status.Domains {
+		if d.LastRenewTime.IsZero() || d.LastRenewError != "" {
+			t.Errorf("bad renew status of domain %s", d.Name)
+		}
+	}
+
+	// the account key is stored in the cluster and reused.
+	accountKey, err := acm.storage.getAccountKey(acm.spec.DirectoryURL, acm.spec.Email)
+	if err != nil || accountKey == nil {
+		t.Errorf("account key should have been stored: %v", err)
+	}
+	acm.client = nil
+	if err := acm.createAcmeClient(); err != nil {
+		t.Errorf("createAcmeClient failed: %v", err)
+	} else if !accountKey.(*ecdsa.PrivateKey).Equal(acm.client.Key) {
+		t.Error("account key should have been reused")
+	}
+
+	if acm.findDomain("www.megaease.com", false) != &acm.domains[0] {
+		t.Error("domain www.megaease.com should be found")
+	}
+	if acm.findDomain("api.megaease.com", false) != &acm.domains[1] {
+		t.Error("wildcard domain should be found")
+	}
+	if acm.findDomain("a.b.megaease.com", false) != nil {
+		t.Error("wildcard domain should match only one level of subdomain")
+	}
 	if acm.spec.Domains[0].Zone() != "" {
 		t.Error("bad status")
 	}
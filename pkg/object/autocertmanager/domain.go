@@ -40,10 +40,17 @@ type Domain struct {
 	*DomainSpec
 	nameInPunyCode string
 	certificate    atomic.Value
+	lastRenew      atomic.Value
 	cleanups       []func() error
 	ctx            context.Context
 }
 
+// renewResult is the result of a renewal.
+type renewResult struct {
+	time time.Time
+	err  string
+}
+
 // isWildcard returns whether the domain is for a wildcard one
 func (d *Domain) isWildcard() bool {
 	return d.nameInPunyCode[0] == '*'
@@ -65,6 +72,21 @@ func (d *Domain) certExpireTime() time.Time {
 	return cert.Leaf.NotAfter
 }
 
+func (d *Domain) setRenewResult(err error) {
+	r := &renewResult{time: time.Now()}
+	if err != nil {
+		r.err = err.Error()
+	}
+	d.lastRenew.Store(r)
+}
+
+func (d *Domain) renewResult() *renewResult {
+	if x := d.lastRenew.Load(); x != nil {
+		return x.(*renewResult)
+	}
+	return nil
+}
+
 func (d *Domain) updateCert(cert *tls.Certificate) {
 	for {
 		oldCert := d.cert()
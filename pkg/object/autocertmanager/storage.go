@@ -23,8 +23,10 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"strings"
@@ -40,6 +42,7 @@ const (
 	autoCertManagerCert        = "autocert/cert/%s"
 	autoCertManagerHTTPToken   = "autocert/http/%s/%s"
 	autoCertManagerTLSALPNCert = "autocert/tlsalpn/%s"
+	autoCertManagerAccountKey  = "autocert/account/%s"
 )
 
 type storage struct {
@@ -58,6 +61,13 @@ func domainTLSALPNCert(name string) string {
 	return fmt.Sprintf(autoCertManagerTLSALPNCert, name)
 }
 
+// accountKeyName returns the key of the account key, accounts are
+// different for different directories and emails.
+func accountKeyName(directoryURL, email string) string {
+	sum := sha256.Sum256([]byte(directoryURL + "\n" + email))
+	return fmt.Sprintf(autoCertManagerAccountKey, hex.EncodeToString(sum[:8]))
+}
+
 func encodeCertificate(cert *tls.Certificate) ([]byte, error) {
 	// contains PEM-encoded data
 	var buf bytes.Buffer
@@ -289,6 +299,33 @@ func (s *storage) deleteTLSALPNCert(domain string) error {
 	return s.cls.Delete(key)
 }
 
+// getAccountKey returns the key of the ACME account, nil is returned if
+// the account key does not exist.
+func (s *storage) getAccountKey(directoryURL, email string) (crypto.Signer, error) {
+	kv, err := s.cls.GetRaw(accountKeyName(directoryURL, email))
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, nil
+	}
+
+	block, _ := pem.Decode(kv.Value)
+	if block == nil {
+		return nil, fmt.Errorf("invalid account key")
+	}
+	return parsePrivateKey(block.Bytes)
+}
+
+func (s *storage) putAccountKey(directoryURL, email string, key *ecdsa.PrivateKey) error {
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	value := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+	return s.cls.Put(accountKeyName(directoryURL, email), string(value))
+}
+
 func (s *storage) watchCertificate(ctx context.Context, onChange func(domain string, cert *tls.Certificate)) {
 	var (
 		syncer cluster.Syncer
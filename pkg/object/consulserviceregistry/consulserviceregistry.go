@@ -82,7 +82,7 @@ type (
 		Address      string   `json:"address" jsonschema:"required"`
 		Scheme       string   `json:"scheme" jsonschema:"required,enum=http,enum=https"`
 		Datacenter   string   `json:"datacenter,omitempty"`
-		Token        string   `json:"token,omitempty"`
+		Token        string   `json:"token,omitempty" jsonschema:"writeOnly=true"`
 		Namespace    string   `json:"namespace,omitempty"`
 		SyncInterval string   `json:"syncInterval" jsonschema:"required,format=duration"`
 		ServiceTags  []string `json:"serviceTags,omitempty"`
@@ -0,0 +1,1004 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/redact"
+	"github.com/megaease/easegress/v2/pkg/util/tlssni"
+)
+
+const (
+	accessLogFormatCommon = "common"
+	accessLogFormatJSON   = "json"
+	accessLogFormatCustom = "custom"
+
+	accessLogDestinationStdout = "stdout"
+	accessLogDestinationFile   = "file"
+	accessLogDestinationSyslog = "syslog"
+	accessLogDestinationHTTP   = "http"
+	accessLogDestinationKafka  = "kafka"
+
+	accessLogProtocolElasticsearch = "elasticsearch"
+	accessLogProtocolLoki          = "loki"
+
+	accessLogDropReasonQueueFull   = "queueFull"
+	accessLogDropReasonWriteFailed = "writeFailed"
+
+	accessLogRedacted = "***"
+
+	accessLogChanSize             = 4096
+	defaultAccessLogBatchSize     = 100
+	defaultAccessLogFlushInterval = time.Second
+	defaultAccessLogHTTPTimeout   = 5 * time.Second
+	defaultAccessLogSyslogTimeout = 5 * time.Second
+	defaultAccessLogMaxRetries    = 3
+	accessLogRetryBackoff         = 100 * time.Millisecond
+	accessLogDropWarnInterval     = 10 * time.Second
+	commonLogTimeFormat           = "02/Jan/2006:15:04:05 -0700"
+)
+
+type (
+	// AccessLogSpec describes the access log of the server.
+	AccessLogSpec struct {
+		// Format is the format of the access log, accessLogFormat of
+		// the server is used if it is empty.
+		Format string `json:"format,omitempty" jsonschema:"enum=,enum=common,enum=json,enum=custom"`
+		// Template is the template of the custom format, it has the same
+		// syntax as accessLogFormat.
+		Template string `json:"template,omitempty"`
+
+		// Destination is where the access log is written to, the access
+		// log file of Easegress is used if it is empty.
+		Destination string               `json:"destination,omitempty" jsonschema:"enum=,enum=stdout,enum=file,enum=syslog,enum=http,enum=kafka"`
+		File        string               `json:"file,omitempty"`
+		Syslog      *AccessLogSyslogSpec `json:"syslog,omitempty"`
+		HTTP        *AccessLogHTTPSpec   `json:"http,omitempty"`
+		Kafka       *AccessLogKafkaSpec  `json:"kafka,omitempty"`
+		// Rotation is the rotation of the file, the file is never rotated
+		// by Easegress if it is nil.
+		Rotation *AccessLogRotationSpec `json:"rotation,omitempty"`
+
+		// QueueSize is the max count of the access logs waiting to be
+		// written, the new ones are dropped once the queue is full.
+		QueueSize int `json:"queueSize,omitempty" jsonschema:"minimum=0"`
+		// MaxRetries is the max times to retry writing a batch of access
+		// logs, the batch is dropped if all the retries fail.
+		MaxRetries int `json:"maxRetries,omitempty" jsonschema:"minimum=0"`
+
+		// SampleRate is the ratio of logged requests, default is 1.
+		SampleRate float64 `json:"sampleRate,omitempty" jsonschema:"minimum=0,maximum=1"`
+
+		// RedactHeaders and RedactQueryParams are the names of request and
+		// response headers and query parameters whose values are redacted.
+		RedactHeaders     []string `json:"redactHeaders,omitempty"`
+		RedactQueryParams []string `json:"redactQueryParams,omitempty"`
+		// RedactPatterns and RedactBuiltins are the regular expressions
+		// and the builtin patterns of the data redacted in the log lines.
+		RedactPatterns []string `json:"redactPatterns,omitempty"`
+		RedactBuiltins []string `json:"redactBuiltins,omitempty" jsonschema:"uniqueItems=true,enum=creditCard,enum=email,enum=ssn"`
+
+		// HostOverrides are the access logs of the requests to the hosts,
+		// the first one matching the host of a request is used.
+		HostOverrides []*AccessLogHostSpec `json:"hostOverrides,omitempty"`
+	}
+
+	// AccessLogHostSpec describes the access log of the requests to the
+	// hosts, the format, destination and sampling are not inherited from
+	// the access log of the server, but the redaction is.
+	AccessLogHostSpec struct {
+		// Hosts are the hosts of the requests, a host could be a wildcard
+		// like *.example.com.
+		Hosts []string `json:"hosts" jsonschema:"required,minItems=1"`
+
+		Format      string                 `json:"format,omitempty" jsonschema:"enum=,enum=common,enum=json,enum=custom"`
+		Template    string                 `json:"template,omitempty"`
+		Destination string                 `json:"destination,omitempty" jsonschema:"enum=,enum=stdout,enum=file,enum=syslog,enum=http,enum=kafka"`
+		File        string                 `json:"file,omitempty"`
+		Syslog      *AccessLogSyslogSpec   `json:"syslog,omitempty"`
+		HTTP        *AccessLogHTTPSpec     `json:"http,omitempty"`
+		Kafka       *AccessLogKafkaSpec    `json:"kafka,omitempty"`
+		Rotation    *AccessLogRotationSpec `json:"rotation,omitempty"`
+		QueueSize   int                    `json:"queueSize,omitempty" jsonschema:"minimum=0"`
+		MaxRetries  int                    `json:"maxRetries,omitempty" jsonschema:"minimum=0"`
+		SampleRate  float64                `json:"sampleRate,omitempty" jsonschema:"minimum=0,maximum=1"`
+	}
+
+	// AccessLogRotationSpec describes the rotation of the access log file,
+	// the file is rotated once it exceeds the max size, or the interval
+	// elapses.
+	AccessLogRotationSpec struct {
+		// MaxSize is the max size of the file in megabytes, default is 100.
+		MaxSize int `json:"maxSize,omitempty" jsonschema:"minimum=0"`
+		// Interval rotates the file periodically, the rotations are
+		// aligned to the interval in UTC, e.g. 24h rotates at midnight.
+		Interval string `json:"interval,omitempty" jsonschema:"format=duration"`
+		// MaxBackups and MaxAgeDays limit the rotated files retained, all
+		// of them are retained by default.
+		MaxBackups int  `json:"maxBackups,omitempty" jsonschema:"minimum=0"`
+		MaxAgeDays int  `json:"maxAgeDays,omitempty" jsonschema:"minimum=0"`
+		Compress   bool `json:"compress,omitempty"`
+	}
+
+	// AccessLogSyslogSpec describes the syslog server of the access log.
+	AccessLogSyslogSpec struct {
+		Network string `json:"network,omitempty" jsonschema:"enum=,enum=udp,enum=tcp"`
+		Address string `json:"address" jsonschema:"required"`
+		Tag     string `json:"tag,omitempty"`
+		// Timeout is the timeout of connecting and writing to the server.
+		Timeout string `json:"timeout,omitempty" jsonschema:"format=duration"`
+	}
+
+	// AccessLogHTTPSpec describes the HTTP collector of the access log, the
+	// access logs are posted to it in batches, one log per line.
+	AccessLogHTTPSpec struct {
+		URL           string            `json:"url" jsonschema:"required,format=url"`
+		Headers       map[string]string `json:"headers,omitempty"`
+		BatchSize     int               `json:"batchSize,omitempty" jsonschema:"minimum=1"`
+		FlushInterval string            `json:"flushInterval,omitempty" jsonschema:"format=duration"`
+		Timeout       string            `json:"timeout,omitempty" jsonschema:"format=duration"`
+
+		// Protocol is the protocol of the collector, the access logs are
+		// posted as plain text lines if it is empty.
+		Protocol string `json:"protocol,omitempty" jsonschema:"enum=,enum=elasticsearch,enum=loki"`
+		// Index is the index of the documents of the elasticsearch bulk
+		// API, it is required by the elasticsearch protocol.
+		Index string `json:"index,omitempty"`
+		// Labels are the labels of the stream of the loki push API.
+		Labels map[string]string `json:"labels,omitempty"`
+	}
+
+	// AccessLogKafkaSpec describes the Kafka topic of the access log, each
+	// access log is a message of the topic.
+	AccessLogKafkaSpec struct {
+		Brokers       []string `json:"brokers" jsonschema:"required,minItems=1"`
+		Topic         string   `json:"topic" jsonschema:"required"`
+		BatchSize     int      `json:"batchSize,omitempty" jsonschema:"minimum=1"`
+		FlushInterval string   `json:"flushInterval,omitempty" jsonschema:"format=duration"`
+		Timeout       string   `json:"timeout,omitempty" jsonschema:"format=duration"`
+	}
+
+	accessLogger struct {
+		format            string
+		formatter         *accessLogFormatter
+		sampleRate        float64
+		redactHeaders     map[string]struct{}
+		redactQueryParams map[string]struct{}
+		redactMatcher     *redact.Matcher
+
+		// writer is nil if the access log file of Easegress is used.
+		writer *accessLogWriter
+
+		hosts []*hostAccessLogger
+	}
+
+	// hostAccessLogger is the access logger of the requests to the hosts.
+	hostAccessLogger struct {
+		hosts  []string
+		logger *accessLogger
+	}
+
+	// accessLogSink is the destination of access logs.
+	accessLogSink interface {
+		write(lines []string) error
+		close() error
+	}
+
+	// accessLogWriter writes access logs asynchronously in batches, so
+	// slow destinations don't block the requests, logs are dropped if
+	// the destination can't catch up.
+	accessLogWriter struct {
+		sink          accessLogSink
+		batchSize     int
+		flushInterval time.Duration
+		maxRetries    int
+		// dropped counts the dropped access logs by reason, it is nil in
+		// the tests.
+		dropped *prometheus.CounterVec
+		// queueFullDrops counts the access logs dropped since the last
+		// warning, the warnings are logged once in an interval.
+		queueFullDrops atomic.Int64
+		lastDropWarnAt atomic.Int64
+
+		lines chan string
+		done  chan struct{}
+		wg    sync.WaitGroup
+	}
+
+	fileAccessLogSink struct {
+		file *os.File
+	}
+
+	// rotateFileAccessLogSink writes to the file rotated by size and time.
+	rotateFileAccessLogSink struct {
+		file     *lumberjack.Logger
+		interval time.Duration
+		rotateAt time.Time
+	}
+
+	stdoutAccessLogSink struct{}
+
+	syslogAccessLogSink struct {
+		network  string
+		address  string
+		tag      string
+		hostname string
+		timeout  time.Duration
+		conn     net.Conn
+	}
+
+	httpAccessLogSink struct {
+		url      string
+		headers  map[string]string
+		client   *http.Client
+		protocol string
+		index    string
+		labels   map[string]string
+	}
+
+	kafkaAccessLogSink struct {
+		brokers  []string
+		topic    string
+		config   *sarama.Config
+		producer sarama.SyncProducer
+	}
+)
+
+// Validate validates the AccessLogSpec.
+func (spec *AccessLogSpec) Validate() error {
+	switch spec.Format {
+	case accessLogFormatCustom:
+		if spec.Template == "" {
+			return fmt.Errorf("template is required for custom access log format")
+		}
+		if _, err := parseAccessLogTemplate(spec.Template); err != nil {
+			return fmt.Errorf("invalid access log template: %v", err)
+		}
+	case "", accessLogFormatCommon, accessLogFormatJSON:
+	default:
+		return fmt.Errorf("unknown access log format %s", spec.Format)
+	}
+
+	if _, err := redact.NewMatcher(spec.RedactPatterns, spec.RedactBuiltins); err != nil {
+		return fmt.Errorf("invalid redact patterns: %v", err)
+	}
+
+	switch spec.Destination {
+	case accessLogDestinationFile:
+		if spec.File == "" {
+			return fmt.Errorf("file is required for file access log destination")
+		}
+		if r := spec.Rotation; r != nil && r.Interval != "" {
+			d, err := time.ParseDuration(r.Interval)
+			if err != nil {
+				return fmt.Errorf("invalid rotation interval %s: %v", r.Interval, err)
+			}
+			if d <= 0 {
+				return fmt.Errorf("invalid rotation interval %s: must be positive", r.Interval)
+			}
+		}
+	case accessLogDestinationSyslog:
+		if spec.Syslog == nil || spec.Syslog.Address == "" {
+			return fmt.Errorf("syslog address is required for syslog access log destination")
+		}
+		if spec.Syslog.Timeout != "" {
+			if _, err := time.ParseDuration(spec.Syslog.Timeout); err != nil {
+				return fmt.Errorf("invalid duration %s: %v", spec.Syslog.Timeout, err)
+			}
+		}
+	case accessLogDestinationHTTP:
+		if spec.HTTP == nil || spec.HTTP.URL == "" {
+			return fmt.Errorf("http url is required for http access log destination")
+		}
+		switch spec.HTTP.Protocol {
+		case accessLogProtocolElasticsearch:
+			if spec.HTTP.Index == "" {
+				return fmt.Errorf("index is required for elasticsearch protocol")
+			}
+		case "", accessLogProtocolLoki:
+		default:
+			return fmt.Errorf("unknown http protocol %s", spec.HTTP.Protocol)
+		}
+		for _, d := range []string{spec.HTTP.FlushInterval, spec.HTTP.Timeout} {
+			if d == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(d); err != nil {
+				return fmt.Errorf("invalid duration %s: %v", d, err)
+			}
+		}
+	case accessLogDestinationKafka:
+		if spec.Kafka == nil || len(spec.Kafka.Brokers) == 0 || spec.Kafka.Topic == "" {
+			return fmt.Errorf("kafka brokers and topic are required for kafka access log destination")
+		}
+		for _, d := range []string{spec.Kafka.FlushInterval, spec.Kafka.Timeout} {
+			if d == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(d); err != nil {
+				return fmt.Errorf("invalid duration %s: %v", d, err)
+			}
+		}
+	case "", accessLogDestinationStdout:
+	default:
+		return fmt.Errorf("unknown access log destination %s", spec.Destination)
+	}
+	if spec.Rotation != nil && spec.Destination != accessLogDestinationFile {
+		return fmt.Errorf("rotation is only supported for file access log destination")
+	}
+
+	for i, h := range spec.HostOverrides {
+		if len(h.Hosts) == 0 {
+			return fmt.Errorf("hostOverrides[%d]: hosts is empty", i)
+		}
+		if err := h.accessLogSpec(spec).Validate(); err != nil {
+			return fmt.Errorf("hostOverrides[%d]: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+// accessLogSpec returns the access log spec of the hosts, the redaction
+// is inherited from the access log spec of the server.
+func (h *AccessLogHostSpec) accessLogSpec(server *AccessLogSpec) *AccessLogSpec {
+	return &AccessLogSpec{
+		Format:            h.Format,
+		Template:          h.Template,
+		Destination:       h.Destination,
+		File:              h.File,
+		Syslog:            h.Syslog,
+		HTTP:              h.HTTP,
+		Kafka:             h.Kafka,
+		Rotation:          h.Rotation,
+		QueueSize:         h.QueueSize,
+		MaxRetries:        h.MaxRetries,
+		SampleRate:        h.SampleRate,
+		RedactHeaders:     server.RedactHeaders,
+		RedactQueryParams: server.RedactQueryParams,
+		RedactPatterns:    server.RedactPatterns,
+		RedactBuiltins:    server.RedactBuiltins,
+	}
+}
+
+func parseAccessLogTemplate(format string) (*template.Template, error) {
+	varReg := regexp.MustCompile(`\{\{([a-zA-z]*)\}\}`)
+	expr := varReg.ReplaceAllString(format, "{{.$1}}")
+	escapeReg := regexp.MustCompile(`(\[|\])`)
+	expr = escapeReg.ReplaceAllString(expr, "{{`$1`}}")
+	return template.New("").Parse(expr)
+}
+
+// newAccessLogger creates the access logger of the server, dropped counts
+// the access logs dropped by the writers, it could be nil.
+func newAccessLogger(spec *Spec, dropped *prometheus.CounterVec) *accessLogger {
+	if spec.AccessLog == nil {
+		return &accessLogger{
+			sampleRate: 1,
+			formatter:  newAccessLogFormatter(spec.AccessLogFormat),
+		}
+	}
+
+	al := newSpecAccessLogger(spec.AccessLog, spec.AccessLogFormat, dropped)
+	for _, h := range spec.AccessLog.HostOverrides {
+		al.hosts = append(al.hosts, &hostAccessLogger{
+			hosts:  h.Hosts,
+			logger: newSpecAccessLogger(h.accessLogSpec(spec.AccessLog), spec.AccessLogFormat, dropped),
+		})
+	}
+	return al
+}
+
+// newSpecAccessLogger creates an access logger from the spec, defaultFormat
+// is the template used if the format is empty.
+func newSpecAccessLogger(alSpec *AccessLogSpec, defaultFormat string, dropped *prometheus.CounterVec) *accessLogger {
+	al := &accessLogger{sampleRate: 1}
+
+	al.format = alSpec.Format
+	switch al.format {
+	case accessLogFormatCustom:
+		al.formatter = newAccessLogFormatter(alSpec.Template)
+	case accessLogFormatCommon, accessLogFormatJSON:
+	default:
+		al.formatter = newAccessLogFormatter(defaultFormat)
+	}
+
+	if alSpec.SampleRate > 0 && alSpec.SampleRate < 1 {
+		al.sampleRate = alSpec.SampleRate
+	}
+
+	if len(alSpec.RedactHeaders) > 0 {
+		al.redactHeaders = make(map[string]struct{})
+		for _, h := range alSpec.RedactHeaders {
+			al.redactHeaders[http.CanonicalHeaderKey(h)] = struct{}{}
+		}
+	}
+	if len(alSpec.RedactQueryParams) > 0 {
+		al.redactQueryParams = make(map[string]struct{})
+		for _, p := range alSpec.RedactQueryParams {
+			al.redactQueryParams[p] = struct{}{}
+		}
+	}
+	matcher, err := redact.NewMatcher(alSpec.RedactPatterns, alSpec.RedactBuiltins)
+	if err != nil {
+		logger.Errorf("BUG: create redact matcher failed: %v", err)
+	}
+	al.redactMatcher = matcher
+
+	sink, err := newAccessLogSink(alSpec)
+	if err != nil {
+		logger.Errorf("create access log destination %s failed, fallback to default: %v", alSpec.Destination, err)
+	} else if sink != nil {
+		al.writer = newAccessLogWriter(sink, alSpec, dropped)
+	}
+
+	return al
+}
+
+func newAccessLogSink(spec *AccessLogSpec) (accessLogSink, error) {
+	switch spec.Destination {
+	case accessLogDestinationStdout:
+		return &stdoutAccessLogSink{}, nil
+	case accessLogDestinationFile:
+		if spec.Rotation != nil {
+			return newRotateFileAccessLogSink(spec.File, spec.Rotation), nil
+		}
+		file, err := os.OpenFile(spec.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		return &fileAccessLogSink{file: file}, nil
+	case accessLogDestinationSyslog:
+		network := spec.Syslog.Network
+		if network == "" {
+			network = "udp"
+		}
+		tag := spec.Syslog.Tag
+		if tag == "" {
+			tag = "easegress"
+		}
+		timeout := defaultAccessLogSyslogTimeout
+		if spec.Syslog.Timeout != "" {
+			timeout, _ = time.ParseDuration(spec.Syslog.Timeout)
+		}
+		hostname, _ := os.Hostname()
+		return &syslogAccessLogSink{
+			network:  network,
+			address:  spec.Syslog.Address,
+			tag:      tag,
+			hostname: hostname,
+			timeout:  timeout,
+		}, nil
+	case accessLogDestinationHTTP:
+		timeout := defaultAccessLogHTTPTimeout
+		if spec.HTTP.Timeout != "" {
+			timeout, _ = time.ParseDuration(spec.HTTP.Timeout)
+		}
+		return &httpAccessLogSink{
+			url:      spec.HTTP.URL,
+			headers:  spec.HTTP.Headers,
+			client:   &http.Client{Timeout: timeout},
+			protocol: spec.HTTP.Protocol,
+			index:    spec.HTTP.Index,
+			labels:   spec.HTTP.Labels,
+		}, nil
+	case accessLogDestinationKafka:
+		return newKafkaAccessLogSink(spec.Kafka), nil
+	default:
+		return nil, nil
+	}
+}
+
+// forHost returns the access logger of the requests to the host.
+func (al *accessLogger) forHost(host string) *accessLogger {
+	if len(al.hosts) == 0 {
+		return al
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, h := range al.hosts {
+		if tlssni.MatchHost(h.hosts, host) {
+			return h.logger
+		}
+	}
+	return al
+}
+
+func (al *accessLogger) log(build func() *accessLog) {
+	if al.sampleRate < 1 && rand.Float64() >= al.sampleRate {
+		return
+	}
+
+	if al.writer == nil {
+		logger.LazyHTTPAccess(func() string {
+			return al.formatLog(build())
+		})
+		return
+	}
+
+	al.writer.write(al.formatLog(build()))
+}
+
+func (al *accessLogger) formatLog(log *accessLog) string {
+	line := al.formatLine(log)
+	if al.redactMatcher != nil {
+		line = al.redactMatcher.Replace(line, redact.Mask(accessLogRedacted))
+	}
+	return line
+}
+
+func (al *accessLogger) formatLine(log *accessLog) string {
+	switch al.format {
+	case accessLogFormatCommon:
+		host, _, err := net.SplitHostPort(log.RemoteAddr)
+		if err != nil {
+			host = log.RemoteAddr
+		}
+		return fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %d`, host,
+			log.startAt.Format(commonLogTimeFormat), log.Method, log.URI,
+			log.Proto, log.StatusCode, log.RespSize)
+	case accessLogFormatJSON:
+		buff, err := codectool.MarshalJSON(&struct {
+			*accessLog
+			Duration         string `json:"duration"`
+			UpstreamDuration string `json:"upstreamDuration"`
+		}{log, log.Duration.String(), log.UpstreamDuration.String()})
+		if err != nil {
+			logger.Errorf("marshal access log to json failed: %v", err)
+		}
+		return string(buff)
+	default:
+		return al.formatter.format(log)
+	}
+}
+
+func (al *accessLogger) printHeader(header http.Header) string {
+	if len(al.redactHeaders) == 0 {
+		return printHeader(header)
+	}
+
+	redacted := make(http.Header, len(header))
+	for key, values := range header {
+		if _, ok := al.redactHeaders[key]; ok {
+			values = []string{accessLogRedacted}
+		}
+		redacted[key] = values
+	}
+	return printHeader(redacted)
+}
+
+func (al *accessLogger) redactURI(uri string) string {
+	if len(al.redactQueryParams) == 0 {
+		return uri
+	}
+
+	path, rawQuery, found := strings.Cut(uri, "?")
+	if !found {
+		return uri
+	}
+
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if _, ok := al.redactQueryParams[key]; ok {
+			params[i] = url.QueryEscape(key) + "=" + accessLogRedacted
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+func (al *accessLogger) close() {
+	if al.writer != nil {
+		al.writer.close()
+	}
+	for _, h := range al.hosts {
+		h.logger.close()
+	}
+}
+
+func newAccessLogWriter(sink accessLogSink, spec *AccessLogSpec, dropped *prometheus.CounterVec) *accessLogWriter {
+	queueSize := accessLogChanSize
+	if spec.QueueSize > 0 {
+		queueSize = spec.QueueSize
+	}
+
+	w := &accessLogWriter{
+		sink:          sink,
+		batchSize:     defaultAccessLogBatchSize,
+		flushInterval: defaultAccessLogFlushInterval,
+		maxRetries:    defaultAccessLogMaxRetries,
+		dropped:       dropped,
+		lines:         make(chan string, queueSize),
+		done:          make(chan struct{}),
+	}
+	if spec.MaxRetries > 0 {
+		w.maxRetries = spec.MaxRetries
+	}
+
+	// the batch options of the network destinations.
+	var batchSize int
+	var flushInterval string
+	switch {
+	case spec.HTTP != nil:
+		batchSize, flushInterval = spec.HTTP.BatchSize, spec.HTTP.FlushInterval
+	case spec.Kafka != nil:
+		batchSize, flushInterval = spec.Kafka.BatchSize, spec.Kafka.FlushInterval
+	}
+	if batchSize > 0 {
+		w.batchSize = batchSize
+	}
+	if d, err := time.ParseDuration(flushInterval); err == nil && d > 0 {
+		w.flushInterval = d
+	}
+
+	w.wg.Add(1)
+	go w.run()
+
+	return w
+}
+
+func (w *accessLogWriter) write(line string) {
+	select {
+	case w.lines <- line:
+	default:
+		w.drop(accessLogDropReasonQueueFull, 1)
+	}
+}
+
+func (w *accessLogWriter) drop(reason string, count int) {
+	if w.dropped != nil {
+		w.dropped.WithLabelValues(reason).Add(float64(count))
+	}
+	if reason != accessLogDropReasonQueueFull {
+		logger.Errorf("%d access logs are dropped since the destination keeps failing", count)
+		return
+	}
+
+	// The queue keeps full under heavy load, so the warnings are limited
+	// to one in an interval, the counter has the accurate numbers.
+	w.queueFullDrops.Add(int64(count))
+	now := time.Now().UnixNano()
+	last := w.lastDropWarnAt.Load()
+	if now-last < int64(accessLogDropWarnInterval) || !w.lastDropWarnAt.CompareAndSwap(last, now) {
+		return
+	}
+	logger.Warnf("%d access logs are dropped since the destination is too slow", w.queueFullDrops.Swap(0))
+}
+
+// writeBatch writes the batch to the sink, and retries with backoff if it
+// fails, the new access logs are queued or dropped during the retries.
+func (w *accessLogWriter) writeBatch(batch []string) {
+	backoff := accessLogRetryBackoff
+	for i := 0; ; i++ {
+		err := w.sink.write(batch)
+		if err == nil {
+			return
+		}
+		logger.Errorf("write %d access logs failed: %v", len(batch), err)
+		if i >= w.maxRetries {
+			w.drop(accessLogDropReasonWriteFailed, len(batch))
+			return
+		}
+
+		select {
+		case <-w.done:
+			w.drop(accessLogDropReasonWriteFailed, len(batch))
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (w *accessLogWriter) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]string, 0, w.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		w.writeBatch(batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case line := <-w.lines:
+			batch = append(batch, line)
+			if len(batch) >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-w.done:
+			for {
+				select {
+				case line := <-w.lines:
+					batch = append(batch, line)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *accessLogWriter) close() {
+	close(w.done)
+	w.wg.Wait()
+	if err := w.sink.close(); err != nil {
+		logger.Errorf("close access log destination failed: %v", err)
+	}
+}
+
+func joinLines(lines []string) []byte {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func (s *stdoutAccessLogSink) write(lines []string) error {
+	_, err := os.Stdout.Write(joinLines(lines))
+	return err
+}
+
+func (s *stdoutAccessLogSink) close() error {
+	return nil
+}
+
+func (s *fileAccessLogSink) write(lines []string) error {
+	_, err := s.file.Write(joinLines(lines))
+	return err
+}
+
+func (s *fileAccessLogSink) close() error {
+	return s.file.Close()
+}
+
+func newRotateFileAccessLogSink(filename string, spec *AccessLogRotationSpec) *rotateFileAccessLogSink {
+	s := &rotateFileAccessLogSink{
+		file: &lumberjack.Logger{
+			Filename:   filename,
+			MaxSize:    spec.MaxSize,
+			MaxBackups: spec.MaxBackups,
+			MaxAge:     spec.MaxAgeDays,
+			Compress:   spec.Compress,
+			LocalTime:  true,
+		},
+	}
+	if spec.Interval != "" {
+		s.interval, _ = time.ParseDuration(spec.Interval)
+		s.rotateAt = time.Now().Truncate(s.interval).Add(s.interval)
+	}
+	return s
+}
+
+func (s *rotateFileAccessLogSink) write(lines []string) error {
+	if s.interval > 0 {
+		if now := time.Now(); !now.Before(s.rotateAt) {
+			s.rotateAt = now.Truncate(s.interval).Add(s.interval)
+			if err := s.file.Rotate(); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := s.file.Write(joinLines(lines))
+	return err
+}
+
+func (s *rotateFileAccessLogSink) close() error {
+	return s.file.Close()
+}
+
+func (s *syslogAccessLogSink) write(lines []string) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+
+	// Facility local0 and severity informational, in the format of RFC 3164.
+	for _, line := range lines {
+		msg := fmt.Sprintf("<134>%s %s %s: %s\n",
+			time.Now().Format(time.Stamp), s.hostname, s.tag, line)
+		if _, err := s.conn.Write([]byte(msg)); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *syslogAccessLogSink) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// body returns the request body of the lines and its content type
+// according to the protocol.
+func (s *httpAccessLogSink) body(lines []string) ([]byte, string, error) {
+	switch s.protocol {
+	case accessLogProtocolElasticsearch:
+		// the lines which are not JSON objects, like the common format,
+		// are wrapped as the message field of the documents.
+		action, err := codectool.MarshalJSON(map[string]interface{}{"index": map[string]string{"_index": s.index}})
+		if err != nil {
+			return nil, "", err
+		}
+		var buf bytes.Buffer
+		for _, line := range lines {
+			doc := []byte(line)
+			if !strings.HasPrefix(line, "{") || !json.Valid(doc) {
+				doc, _ = codectool.MarshalJSON(map[string]string{"message": line})
+			}
+			buf.Write(action)
+			buf.WriteByte('\n')
+			buf.Write(doc)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+
+	case accessLogProtocolLoki:
+		labels := s.labels
+		if len(labels) == 0 {
+			labels = map[string]string{"job": "easegress"}
+		}
+		// the timestamps are increased by 1ns to keep the order of the
+		// lines in the stream.
+		now := time.Now().UnixNano()
+		values := make([][2]string, len(lines))
+		for i, line := range lines {
+			values[i] = [2]string{fmt.Sprint(now + int64(i)), line}
+		}
+		body, err := codectool.MarshalJSON(map[string]interface{}{
+			"streams": []map[string]interface{}{{"stream": labels, "values": values}},
+		})
+		return body, "application/json", err
+
+	default:
+		return joinLines(lines), "text/plain; charset=utf-8", nil
+	}
+}
+
+func (s *httpAccessLogSink) write(lines []string) error {
+	body, contentType, err := s.body(lines)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	// the bulk API of elasticsearch responds 200 even if some of the
+	// documents are rejected.
+	if s.protocol == accessLogProtocolElasticsearch {
+		var result struct {
+			Errors bool `json:"errors"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.Errors {
+			return fmt.Errorf("some documents are rejected by elasticsearch")
+		}
+	}
+
+	return nil
+}
+
+func (s *httpAccessLogSink) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func newKafkaAccessLogSink(spec *AccessLogKafkaSpec) *kafkaAccessLogSink {
+	config := sarama.NewConfig()
+	config.ClientID = "easegress-access-log"
+	config.Version = sarama.V1_0_0_0
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForLocal
+	if spec.Timeout != "" {
+		timeout, _ := time.ParseDuration(spec.Timeout)
+		config.Producer.Timeout = timeout
+		config.Net.DialTimeout = timeout
+	}
+
+	return &kafkaAccessLogSink{
+		brokers: spec.Brokers,
+		topic:   spec.Topic,
+		config:  config,
+	}
+}
+
+func (s *kafkaAccessLogSink) write(lines []string) error {
+	// the producer is created on the first write, so that the server
+	// starts even if the brokers are unavailable.
+	if s.producer == nil {
+		producer, err := sarama.NewSyncProducer(s.brokers, s.config)
+		if err != nil {
+			return err
+		}
+		s.producer = producer
+	}
+
+	msgs := make([]*sarama.ProducerMessage, len(lines))
+	for i, line := range lines {
+		msgs[i] = &sarama.ProducerMessage{Topic: s.topic, Value: sarama.StringEncoder(line)}
+	}
+	return s.producer.SendMessages(msgs)
+}
+
+func (s *kafkaAccessLogSink) close() error {
+	if s.producer == nil {
+		return nil
+	}
+	return s.producer.Close()
+}
@@ -0,0 +1,408 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&AccessLogSpec{}).Validate())
+	assert.NoError((&AccessLogSpec{Format: "custom", Template: "{{Method}}"}).Validate())
+	assert.Error((&AccessLogSpec{Format: "custom"}).Validate())
+	assert.Error((&AccessLogSpec{Format: "xml"}).Validate())
+	assert.Error((&AccessLogSpec{Destination: "file"}).Validate())
+	assert.Error((&AccessLogSpec{Destination: "syslog"}).Validate())
+	assert.Error((&AccessLogSpec{Destination: "http"}).Validate())
+	assert.Error((&AccessLogSpec{
+		Destination: "http",
+		HTTP:        &AccessLogHTTPSpec{URL: "http://127.0.0.1", FlushInterval: "1x"},
+	}).Validate())
+
+	assert.NoError((&AccessLogSpec{
+		Destination: "file",
+		File:        "access.log",
+		Rotation:    &AccessLogRotationSpec{MaxSize: 10, Interval: "24h"},
+	}).Validate())
+	assert.Error((&AccessLogSpec{Rotation: &AccessLogRotationSpec{}}).Validate())
+	assert.Error((&AccessLogSpec{
+		Destination: "file",
+		File:        "access.log",
+		Rotation:    &AccessLogRotationSpec{Interval: "-1h"},
+	}).Validate())
+
+	assert.NoError((&AccessLogSpec{
+		Destination: "http",
+		HTTP:        &AccessLogHTTPSpec{URL: "http://127.0.0.1:9200/_bulk", Protocol: "elasticsearch", Index: "logs"},
+	}).Validate())
+	assert.Error((&AccessLogSpec{
+		Destination: "http",
+		HTTP:        &AccessLogHTTPSpec{URL: "http://127.0.0.1:9200/_bulk", Protocol: "elasticsearch"},
+	}).Validate())
+	assert.NoError((&AccessLogSpec{
+		Destination: "kafka",
+		Kafka:       &AccessLogKafkaSpec{Brokers: []string{"127.0.0.1:9092"}, Topic: "logs", FlushInterval: "2s"},
+	}).Validate())
+	assert.Error((&AccessLogSpec{Destination: "kafka", Kafka: &AccessLogKafkaSpec{Topic: "logs"}}).Validate())
+
+	assert.NoError((&AccessLogSpec{HostOverrides: []*AccessLogHostSpec{
+		{Hosts: []string{"*.example.com"}, Format: "json"},
+	}}).Validate())
+	assert.Error((&AccessLogSpec{HostOverrides: []*AccessLogHostSpec{{}}}).Validate())
+	assert.Error((&AccessLogSpec{HostOverrides: []*AccessLogHostSpec{
+		{Hosts: []string{"example.com"}, Format: "xml"},
+	}}).Validate())
+	assert.Error((&AccessLogSpec{
+		RedactBuiltins: []string{"unknown"},
+		HostOverrides:  []*AccessLogHostSpec{{Hosts: []string{"example.com"}}},
+	}).Validate())
+}
+
+func TestAccessLoggerFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	startAt := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	log := &accessLog{
+		RemoteAddr: "192.168.1.1:8080",
+		Method:     "GET",
+		URI:        "/abc",
+		Proto:      "HTTP/1.1",
+		StatusCode: 200,
+		Duration:   time.Second,
+		RespSize:   10,
+		startAt:    startAt,
+	}
+
+	al := newAccessLogger(&Spec{AccessLog: &AccessLogSpec{Format: "common"}}, nil)
+	assert.Equal(`192.168.1.1 - - [02/Jan/2023:03:04:05 +0000] "GET /abc HTTP/1.1" 200 10`, al.formatLog(log))
+
+	al = newAccessLogger(&Spec{AccessLog: &AccessLogSpec{Format: "json"}}, nil)
+	s := al.formatLog(log)
+	assert.Contains(s, `"method":"GET"`)
+	assert.Contains(s, `"statusCode":200`)
+	assert.Contains(s, `"duration":"1s"`)
+
+	al = newAccessLogger(&Spec{AccessLog: &AccessLogSpec{Format: "custom", Template: "{{Method}} {{URI}}"}}, nil)
+	assert.Equal("GET /abc", al.formatLog(log))
+
+	al = newAccessLogger(&Spec{AccessLogFormat: "{{StatusCode}}", AccessLog: &AccessLogSpec{}}, nil)
+	assert.Equal("200", al.formatLog(log))
+
+	log.Route = "/abc"
+	log.Backend = "pipeline"
+	log.UpstreamAddr = "http://127.0.0.1:9095"
+	log.UpstreamAttempts = 2
+	log.UpstreamDuration = 500 * time.Millisecond
+	al = newAccessLogger(&Spec{AccessLog: &AccessLogSpec{
+		Format:   "custom",
+		Template: "{{Route}} {{Backend}} {{UpstreamAddr}} {{UpstreamAttempts}} {{UpstreamDuration}}",
+	}}, nil)
+	assert.Equal("/abc pipeline http://127.0.0.1:9095 2 500ms", al.formatLog(log))
+
+	al = newAccessLogger(&Spec{AccessLog: &AccessLogSpec{Format: "json"}}, nil)
+	s = al.formatLog(log)
+	assert.Contains(s, `"upstreamAttempts":2`)
+	assert.Contains(s, `"upstreamDuration":"500ms"`)
+}
+
+func TestAccessLoggerHostOverrides(t *testing.T) {
+	assert := assert.New(t)
+
+	al := newAccessLogger(&Spec{AccessLog: &AccessLogSpec{
+		Format:        "custom",
+		Template:      "default",
+		RedactHeaders: []string{"authorization"},
+		HostOverrides: []*AccessLogHostSpec{
+			{Hosts: []string{"*.example.com"}, Format: "custom", Template: "example"},
+			{Hosts: []string{"www.megaease.com"}},
+		},
+	}}, nil)
+	defer al.close()
+
+	log := &accessLog{StatusCode: 200}
+	assert.Equal("example", al.forHost("api.example.com").formatLog(log))
+	assert.Equal("example", al.forHost("api.example.com:8080").formatLog(log))
+	assert.Equal("default", al.forHost("example.com").formatLog(log))
+	assert.Equal("default", al.forHost("").formatLog(log))
+
+	// the format of the server is not inherited, but the redaction is.
+	assert.True(strings.HasPrefix(al.forHost("www.megaease.com").formatLog(log), "["))
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	assert.Equal("Authorization: [***]", al.forHost("api.example.com").printHeader(h))
+}
+
+func TestRotateFileAccessLogSink(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "access.log")
+	s := newRotateFileAccessLogSink(file, &AccessLogRotationSpec{Interval: "1h"})
+	defer s.close()
+
+	assert.True(s.rotateAt.After(time.Now()))
+	assert.NoError(s.write([]string{"a"}))
+
+	// the file is rotated once the time passes.
+	s.rotateAt = time.Now().Add(-time.Second)
+	assert.NoError(s.write([]string{"b"}))
+	assert.True(s.rotateAt.After(time.Now()))
+
+	data, err := os.ReadFile(file)
+	assert.NoError(err)
+	assert.Equal("b\n", string(data))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(err)
+	assert.Equal(2, len(entries))
+}
+
+func TestAccessLoggerRedact(t *testing.T) {
+	assert := assert.New(t)
+
+	al := newAccessLogger(&Spec{AccessLog: &AccessLogSpec{
+		RedactHeaders:     []string{"authorization"},
+		RedactQueryParams: []string{"token"},
+	}}, nil)
+
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	assert.Equal("Authorization: [***]", al.printHeader(h))
+
+	assert.Equal("/abc?token=***&a=1", al.redactURI("/abc?token=secret&a=1"))
+	assert.Equal("/abc", al.redactURI("/abc"))
+
+	al = newAccessLogger(&Spec{AccessLog: &AccessLogSpec{
+		Format:         "custom",
+		Template:       "{{URI}}",
+		RedactPatterns: []string{`secret-\w+`},
+		RedactBuiltins: []string{"creditCard"},
+	}}, nil)
+	assert.Equal("/pay?card=***&key=***", al.formatLog(&accessLog{URI: "/pay?card=4111111111111111&key=secret-abc"}))
+
+	spec := &AccessLogSpec{RedactBuiltins: []string{"unknown"}}
+	assert.NotNil(spec.Validate())
+}
+
+func TestAccessLoggerDestination(t *testing.T) {
+	assert := assert.New(t)
+
+	file := filepath.Join(t.TempDir(), "access.log")
+	al := newAccessLogger(&Spec{AccessLog: &AccessLogSpec{
+		Format:      "custom",
+		Template:    "{{Method}} {{URI}}",
+		Destination: "file",
+		File:        file,
+	}}, nil)
+	al.log(func() *accessLog { return &accessLog{Method: "GET", URI: "/abc"} })
+	al.close()
+
+	data, err := os.ReadFile(file)
+	assert.NoError(err)
+	assert.Equal("GET /abc\n", string(data))
+
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer server.Close()
+
+	al = newAccessLogger(&Spec{AccessLog: &AccessLogSpec{
+		Format:      "custom",
+		Template:    "{{Method}}",
+		Destination: "http",
+		HTTP:        &AccessLogHTTPSpec{URL: server.URL, BatchSize: 2},
+	}}, nil)
+	defer al.close()
+	al.log(func() *accessLog { return &accessLog{Method: "GET"} })
+	al.log(func() *accessLog { return &accessLog{Method: "POST"} })
+
+	select {
+	case body := <-bodies:
+		assert.Equal("GET\nPOST\n", body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("access logs are not posted")
+	}
+
+	al = newAccessLogger(&Spec{AccessLog: &AccessLogSpec{SampleRate: 0.5}}, nil)
+	assert.Equal(0.5, al.sampleRate)
+	assert.True(strings.HasPrefix(al.formatLog(&accessLog{Time: "now"}), "[now]"))
+}
+
+func TestAccessLogHTTPProtocols(t *testing.T) {
+	assert := assert.New(t)
+
+	type request struct {
+		contentType string
+		body        string
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{r.Header.Get("Content-Type"), string(body)}
+		if strings.Contains(string(body), "rejected") {
+			w.Write([]byte(`{"errors":true}`))
+		}
+	}))
+	defer server.Close()
+
+	s := &httpAccessLogSink{url: server.URL, client: http.DefaultClient, protocol: "elasticsearch", index: "logs"}
+	assert.NoError(s.write([]string{`{"method":"GET"}`, "GET /abc"}))
+	r := <-requests
+	assert.Equal("application/x-ndjson", r.contentType)
+	assert.Equal(`{"index":{"_index":"logs"}}
+{"method":"GET"}
+{"index":{"_index":"logs"}}
+{"message":"GET /abc"}
+`, r.body)
+
+	assert.Error(s.write([]string{"rejected"}))
+	<-requests
+
+	s = &httpAccessLogSink{url: server.URL, client: http.DefaultClient, protocol: "loki", labels: map[string]string{"app": "eg"}}
+	assert.NoError(s.write([]string{"GET /abc", "POST /abc"}))
+	r = <-requests
+	assert.Equal("application/json", r.contentType)
+	assert.Contains(r.body, `"stream":{"app":"eg"}`)
+	assert.Contains(r.body, `"GET /abc"]`)
+	assert.Contains(r.body, `"POST /abc"]`)
+}
+
+type mockSyncProducer struct {
+	sarama.SyncProducer
+	msgs []*sarama.ProducerMessage
+}
+
+func (p *mockSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func (p *mockSyncProducer) Close() error {
+	return nil
+}
+
+func TestKafkaAccessLogSink(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newKafkaAccessLogSink(&AccessLogKafkaSpec{Brokers: []string{"127.0.0.1:9092"}, Topic: "logs", Timeout: "1s"})
+	assert.Equal(time.Second, s.config.Producer.Timeout)
+
+	producer := &mockSyncProducer{}
+	s.producer = producer
+	assert.NoError(s.write([]string{"GET", "POST"}))
+	assert.Equal(2, len(producer.msgs))
+	assert.Equal("logs", producer.msgs[0].Topic)
+	v, _ := producer.msgs[1].Value.Encode()
+	assert.Equal("POST", string(v))
+	assert.NoError(s.close())
+}
+
+type failingAccessLogSink struct {
+	writes int
+}
+
+func (s *failingAccessLogSink) write(lines []string) error {
+	s.writes++
+	return errors.New("failed")
+}
+
+func (s *failingAccessLogSink) close() error {
+	return nil
+}
+
+func TestAccessLogWriterDrop(t *testing.T) {
+	assert := assert.New(t)
+
+	dropped := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dropped"}, []string{"reason"})
+	sink := &failingAccessLogSink{}
+	w := newAccessLogWriter(sink, &AccessLogSpec{QueueSize: 1, MaxRetries: 1}, dropped)
+	assert.Equal(1, cap(w.lines))
+
+	// the batch is dropped after the retries.
+	w.write("GET")
+	assert.Eventually(func() bool {
+		return testutil.ToFloat64(dropped.WithLabelValues(accessLogDropReasonWriteFailed)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	w.close()
+	assert.Equal(2, sink.writes)
+
+	// the new access logs are dropped once the queue is full.
+	w = &accessLogWriter{lines: make(chan string, 1), dropped: dropped}
+	w.write("GET")
+	w.write("POST")
+	assert.Equal(1.0, testutil.ToFloat64(dropped.WithLabelValues(accessLogDropReasonQueueFull)))
+	assert.Equal(int64(0), w.queueFullDrops.Load())
+
+	// the warnings are limited, the drops are counted until the next one.
+	w.write("PUT")
+	w.write("DELETE")
+	assert.Equal(3.0, testutil.ToFloat64(dropped.WithLabelValues(accessLogDropReasonQueueFull)))
+	assert.Equal(int64(2), w.queueFullDrops.Load())
+
+	w.lastDropWarnAt.Store(time.Now().Add(-accessLogDropWarnInterval).UnixNano())
+	w.write("PATCH")
+	assert.Equal(int64(0), w.queueFullDrops.Load())
+}
+
+func TestSyslogAccessLogSink(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&AccessLogSpec{Destination: "syslog", Syslog: &AccessLogSyslogSpec{Address: "127.0.0.1:514", Timeout: "1"}}).Validate())
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer conn.Close()
+
+	spec := &AccessLogSpec{Destination: "syslog", Syslog: &AccessLogSyslogSpec{Address: conn.LocalAddr().String(), Timeout: "2s"}}
+	assert.NoError(spec.Validate())
+	sink, err := newAccessLogSink(spec)
+	assert.NoError(err)
+	s := sink.(*syslogAccessLogSink)
+	assert.Equal(2*time.Second, s.timeout)
+	defer s.close()
+
+	assert.NoError(s.write([]string{"GET /abc"}))
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(string(buf[:n]), "<134>"))
+	assert.True(strings.HasSuffix(string(buf[:n]), "easegress: GET /abc\n"))
+
+	spec.Syslog.Timeout = ""
+	sink, _ = newAccessLogSink(spec)
+	assert.Equal(defaultAccessLogSyslogTimeout, sink.(*syslogAccessLogSink).timeout)
+}
@@ -0,0 +1,374 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bytes"
+	stdcontext "context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/megaease/easegress/v2/pkg/cluster/customdata"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/k8s"
+)
+
+const (
+	defaultCertReloadInterval = 30 * time.Second
+	defaultCertExpiryWarning  = 7 * 24 * time.Hour
+
+	// certExpiryWarnInterval is the min interval between the expiry
+	// warnings of the same certificate.
+	certExpiryWarnInterval = time.Hour
+	certSourceLoadTimeout  = 10 * time.Second
+)
+
+type (
+	// CertSourceSpec describes a source of the certificate and key, which
+	// is reloaded once changed. Only one of the certFile/keyFile,
+	// kubernetesSecret and customData could be set.
+	CertSourceSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		// CertFile and KeyFile are the files of the PEM encoded certificate
+		// and key.
+		CertFile string `json:"certFile,omitempty"`
+		KeyFile  string `json:"keyFile,omitempty"`
+		// KubernetesSecret is the TLS secret in the format of namespace/name,
+		// the certificate and key are tls.crt and tls.key of it.
+		KubernetesSecret string `json:"kubernetesSecret,omitempty"`
+		// CustomData is the custom data in the format of kind/id, the
+		// certificate and key are the fields cert and key of it.
+		CustomData string `json:"customData,omitempty"`
+	}
+
+	// certWatcher loads the certificates from the sources periodically,
+	// and checks the expiry of all certificates of the server.
+	certWatcher struct {
+		name      string
+		superSpec *supervisor.Spec
+		interval  time.Duration
+		warning   time.Duration
+		onChange  func()
+		expiry    *prometheus.GaugeVec
+
+		lock    sync.Mutex
+		static  map[string]*x509.Certificate
+		sources []*certSource
+
+		k8sClient kubernetes.Interface
+		cds       *customdata.Store
+
+		lastWarn map[string]time.Time
+		done     chan struct{}
+	}
+
+	certSource struct {
+		spec *CertSourceSpec
+		hash [sha256.Size]byte
+		cert *tls.Certificate
+		leaf *x509.Certificate
+	}
+)
+
+// Validate validates CertSourceSpec.
+func (s *CertSourceSpec) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+
+	n := 0
+	if s.CertFile != "" || s.KeyFile != "" {
+		if s.CertFile == "" || s.KeyFile == "" {
+			return fmt.Errorf("certFile and keyFile must be set together")
+		}
+		n++
+	}
+	if s.KubernetesSecret != "" {
+		if ns, name, ok := strings.Cut(s.KubernetesSecret, "/"); !ok || ns == "" || name == "" {
+			return fmt.Errorf("invalid kubernetesSecret %s, the format is namespace/name", s.KubernetesSecret)
+		}
+		n++
+	}
+	if s.CustomData != "" {
+		if kind, id, ok := strings.Cut(s.CustomData, "/"); !ok || kind == "" || id == "" {
+			return fmt.Errorf("invalid customData %s, the format is kind/id", s.CustomData)
+		}
+		n++
+	}
+
+	if n != 1 {
+		return fmt.Errorf("only one of certFile/keyFile, kubernetesSecret and customData must be set")
+	}
+	return nil
+}
+
+// namedCertificates returns the certificates in the spec by their names,
+// the invalid ones are ignored.
+func (spec *Spec) namedCertificates() map[string]*x509.Certificate {
+	certs := map[string]*x509.Certificate{}
+	add := func(name string, certPem, keyPem []byte) {
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			return
+		}
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+			certs[name] = leaf
+		}
+	}
+
+	if spec.CertBase64 != "" && spec.KeyBase64 != "" {
+		certPem, _ := base64.StdEncoding.DecodeString(spec.CertBase64)
+		keyPem, _ := base64.StdEncoding.DecodeString(spec.KeyBase64)
+		add("certBase64", certPem, keyPem)
+	}
+	for k, v := range spec.Certs {
+		add("certs/"+k, tryDecodeBase64Pem(v), tryDecodeBase64Pem(spec.Keys[k]))
+	}
+	for i, h := range spec.TLSHosts {
+		add(fmt.Sprintf("tlsHosts/%d", i), tryDecodeBase64Pem(h.CertBase64), tryDecodeBase64Pem(h.KeyBase64))
+	}
+
+	return certs
+}
+
+// newCertWatcher creates a certWatcher and loads the certificates from the
+// sources, onChange is called once the certificates are reloaded.
+func newCertWatcher(superSpec *supervisor.Spec, spec *Spec, expiry *prometheus.GaugeVec, onChange func()) *certWatcher {
+	w := &certWatcher{
+		name:      superSpec.Name(),
+		superSpec: superSpec,
+		interval:  defaultCertReloadInterval,
+		warning:   defaultCertExpiryWarning,
+		onChange:  onChange,
+		expiry:    expiry,
+		static:    spec.namedCertificates(),
+		lastWarn:  map[string]time.Time{},
+		done:      make(chan struct{}),
+	}
+	if spec.CertReloadInterval != "" {
+		w.interval, _ = time.ParseDuration(spec.CertReloadInterval)
+	}
+	if spec.CertExpiryWarning != "" {
+		w.warning, _ = time.ParseDuration(spec.CertExpiryWarning)
+	}
+	for _, s := range spec.CertSources {
+		w.sources = append(w.sources, &certSource{spec: s})
+	}
+
+	w.reload()
+	w.checkExpiry()
+
+	go w.run()
+
+	return w
+}
+
+func (w *certWatcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if w.reload() {
+				w.onChange()
+			}
+			w.checkExpiry()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// certificates returns the loaded certificates of the sources.
+func (w *certWatcher) certificates() []tls.Certificate {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var certs []tls.Certificate
+	for _, s := range w.sources {
+		if s.cert != nil {
+			certs = append(certs, *s.cert)
+		}
+	}
+	return certs
+}
+
+// reload reloads the certificates of the sources, and reports whether
+// any of them is changed. The last loaded certificate of a source is kept
+// if the reloading fails.
+func (w *certWatcher) reload() bool {
+	changed := false
+	for _, s := range w.sources {
+		certPem, keyPem, err := w.load(s.spec)
+		if err != nil {
+			logger.Errorf("httpserver %s: load certificate %s failed: %v", w.name, s.spec.Name, err)
+			continue
+		}
+
+		hash := sha256.Sum256(bytes.Join([][]byte{certPem, keyPem}, []byte{0}))
+		if hash == s.hash {
+			continue
+		}
+
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			logger.Errorf("httpserver %s: certificate %s is invalid: %v", w.name, s.spec.Name, err)
+			continue
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			logger.Errorf("httpserver %s: certificate %s is invalid: %v", w.name, s.spec.Name, err)
+			continue
+		}
+
+		w.lock.Lock()
+		s.hash, s.cert, s.leaf = hash, &cert, leaf
+		w.lock.Unlock()
+
+		logger.Infof("httpserver %s: certificate %s loaded, expires at %s",
+			w.name, s.spec.Name, leaf.NotAfter.Format(time.RFC3339))
+		changed = true
+	}
+	return changed
+}
+
+// load loads the PEM encoded certificate and key of the source.
+func (w *certWatcher) load(s *CertSourceSpec) ([]byte, []byte, error) {
+	switch {
+	case s.CertFile != "":
+		certPem, err := os.ReadFile(s.CertFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		keyPem, err := os.ReadFile(s.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return certPem, keyPem, nil
+
+	case s.KubernetesSecret != "":
+		if w.k8sClient == nil {
+			client, err := k8s.NewK8sClientInCluster()
+			if err != nil {
+				return nil, nil, err
+			}
+			w.k8sClient = client
+		}
+
+		ns, name, _ := strings.Cut(s.KubernetesSecret, "/")
+		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), certSourceLoadTimeout)
+		defer cancel()
+		secret, err := w.k8sClient.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey], nil
+
+	default:
+		if w.cds == nil {
+			cls := w.superSpec.Super().Cluster()
+			w.cds = customdata.NewStore(cls, cls.Layout().CustomDataKindPrefix(), cls.Layout().CustomDataPrefix())
+		}
+
+		kind, id, _ := strings.Cut(s.CustomData, "/")
+		data, err := w.cds.GetData(kind, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if data == nil {
+			return nil, nil, fmt.Errorf("custom data %s not found", s.CustomData)
+		}
+		return tryDecodeBase64Pem(data.GetString("cert")), tryDecodeBase64Pem(data.GetString("key")), nil
+	}
+}
+
+// leaves returns the leaf certificates of the server by their names.
+func (w *certWatcher) leaves() map[string]*x509.Certificate {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	leaves := make(map[string]*x509.Certificate, len(w.static)+len(w.sources))
+	for name, leaf := range w.static {
+		leaves[name] = leaf
+	}
+	for _, s := range w.sources {
+		if s.leaf != nil {
+			leaves["certSources/"+s.spec.Name] = s.leaf
+		}
+	}
+	return leaves
+}
+
+// checkExpiry exports the expiry time of the certificates, and warns if
+// they are going to expire.
+func (w *certWatcher) checkExpiry() {
+	leaves := w.leaves()
+	names := make([]string, 0, len(leaves))
+	for name := range leaves {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	for _, name := range names {
+		leaf := leaves[name]
+		if w.expiry != nil {
+			w.expiry.WithLabelValues(name).Set(float64(leaf.NotAfter.Unix()))
+		}
+
+		left := leaf.NotAfter.Sub(now)
+		if left > w.warning || now.Sub(w.lastWarn[name]) < certExpiryWarnInterval {
+			continue
+		}
+		w.lastWarn[name] = now
+
+		if left <= 0 {
+			logger.Errorf("httpserver %s: certificate %s (%s) expired at %s",
+				w.name, name, leaf.Subject, leaf.NotAfter.Format(time.RFC3339))
+		} else {
+			logger.Warnf("httpserver %s: certificate %s (%s) expires in %s",
+				w.name, name, leaf.Subject, left.Round(time.Minute))
+		}
+	}
+}
+
+// close stops the watcher and removes its metrics.
+func (w *certWatcher) close() {
+	close(w.done)
+	if w.expiry == nil {
+		return
+	}
+	for name := range w.leaves() {
+		w.expiry.DeleteLabelValues(name)
+	}
+}
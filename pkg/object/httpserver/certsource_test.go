@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/megaease/easegress/v2/pkg/context/contexttest"
+	"github.com/megaease/easegress/v2/pkg/option"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+func writeCertFiles(t *testing.T, dir, host string) {
+	cert, key := genCertPem(t, host)
+	certPem, _ := base64.StdEncoding.DecodeString(cert)
+	keyPem, _ := base64.StdEncoding.DecodeString(key)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "tls.crt"), certPem, 0o600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "tls.key"), keyPem, 0o600))
+}
+
+func TestCertSourceSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil((&CertSourceSpec{Name: "a", CertFile: "a.crt", KeyFile: "a.key"}).Validate())
+	assert.Nil((&CertSourceSpec{Name: "a", KubernetesSecret: "default/tls"}).Validate())
+	assert.Nil((&CertSourceSpec{Name: "a", CustomData: "certs/www"}).Validate())
+
+	assert.NotNil((&CertSourceSpec{CertFile: "a.crt", KeyFile: "a.key"}).Validate())
+	assert.NotNil((&CertSourceSpec{Name: "a", CertFile: "a.crt"}).Validate())
+	assert.NotNil((&CertSourceSpec{Name: "a", KubernetesSecret: "tls"}).Validate())
+	assert.NotNil((&CertSourceSpec{Name: "a", CustomData: "certs/"}).Validate())
+	assert.NotNil((&CertSourceSpec{Name: "a"}).Validate())
+	assert.NotNil((&CertSourceSpec{Name: "a", CustomData: "certs/www", KubernetesSecret: "default/tls"}).Validate())
+
+	spec := &Spec{
+		HTTPS: true,
+		Port:  443,
+		CertSources: []*CertSourceSpec{
+			{Name: "a", CertFile: "a.crt", KeyFile: "a.key"},
+		},
+		CertReloadInterval: "10s",
+		CertExpiryWarning:  "72h",
+	}
+	assert.Nil(spec.Validate())
+
+	spec.CertSources = append(spec.CertSources, &CertSourceSpec{Name: "a", CustomData: "certs/www"})
+	assert.NotNil(spec.Validate())
+	spec.CertSources = spec.CertSources[:1]
+
+	spec.CertReloadInterval = "0s"
+	assert.NotNil(spec.Validate())
+}
+
+func TestCertWatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	superSpec, err := supervisor.NewSpec(`
+kind: HTTPServer
+name: test
+port: 80
+https: false
+keepAlive: true
+`)
+	assert.Nil(err)
+
+	dir := t.TempDir()
+	writeCertFiles(t, dir, "v1.example.com")
+
+	cert, key := genCertPem(t, "static.example.com")
+	spec := &Spec{
+		HTTPS:      true,
+		CertBase64: cert,
+		KeyBase64:  key,
+		CertSources: []*CertSourceSpec{
+			{Name: "file", CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key")},
+			{Name: "secret", KubernetesSecret: "default/tls"},
+		},
+		CertReloadInterval: "1h",
+		CertExpiryWarning:  "2h",
+	}
+
+	changed := 0
+	w := newCertWatcher(superSpec, spec, nil, func() { changed++ })
+	defer w.close()
+
+	// the secret is not loaded without kubernetes.
+	assert.Equal(1, len(w.certificates()))
+	assert.Equal("v1.example.com", w.leaves()["certSources/file"].Subject.CommonName)
+	assert.Equal("static.example.com", w.leaves()["certBase64"].Subject.CommonName)
+
+	secretCert, secretKey := genCertPem(t, "secret.example.com")
+	certPem, _ := base64.StdEncoding.DecodeString(secretCert)
+	keyPem, _ := base64.StdEncoding.DecodeString(secretKey)
+	w.k8sClient = fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tls"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPem,
+			corev1.TLSPrivateKeyKey: keyPem,
+		},
+	})
+
+	assert.True(w.reload())
+	assert.Equal(2, len(w.certificates()))
+	assert.Equal("secret.example.com", w.leaves()["certSources/secret"].Subject.CommonName)
+
+	// nothing changed.
+	assert.False(w.reload())
+
+	// the invalid certificate is ignored.
+	assert.Nil(os.WriteFile(filepath.Join(dir, "tls.crt"), []byte("invalid"), 0o600))
+	assert.False(w.reload())
+	assert.Equal("v1.example.com", w.leaves()["certSources/file"].Subject.CommonName)
+
+	writeCertFiles(t, dir, "v2.example.com")
+	assert.True(w.reload())
+	assert.Equal("v2.example.com", w.leaves()["certSources/file"].Subject.CommonName)
+
+	// all certificates expire within the warning period, but the warnings
+	// of a certificate are rate limited.
+	w.checkExpiry()
+	assert.Equal(3, len(w.lastWarn))
+	last := w.lastWarn["certBase64"]
+	w.checkExpiry()
+	assert.Equal(last, w.lastWarn["certBase64"])
+}
+
+func TestRuntimeReloadCerts(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	writeCertFiles(t, dir, "v1.example.com")
+
+	port := 38443
+	yamlConfig := fmt.Sprintf(`
+kind: HTTPServer
+name: test
+port: %d
+https: true
+keepAlive: true
+certReloadInterval: 50ms
+certSources:
+- name: file
+  certFile: %s
+  keyFile: %s
+`, port, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	super := supervisor.NewMock(option.New(), nil, nil, nil, false, nil, nil)
+	superSpec, err := super.NewSpec(yamlConfig)
+	assert.Nil(err)
+
+	r := newRuntime(superSpec, &contexttest.MockedMuxMapper{})
+	defer r.Close()
+	r.eventChan <- &eventReload{nextSuperSpec: superSpec, muxMapper: &contexttest.MockedMuxMapper{}}
+
+	serverName := func() string {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp",
+			fmt.Sprintf("127.0.0.1:%d", port), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			return ""
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	assert.Eventually(func() bool { return serverName() == "v1.example.com" }, 3*time.Second, 50*time.Millisecond)
+
+	// the certificate is swapped without restarting the server.
+	server := r.server
+	writeCertFiles(t, dir, "v2.example.com")
+	assert.Eventually(func() bool { return serverName() == "v2.example.com" }, 3*time.Second, 50*time.Millisecond)
+
+	cert, key := genCertPem(t, "static.example.com")
+	nextSpec := *superSpec.ObjectSpec().(*Spec)
+	nextSpec.CertSources = nil
+	nextSpec.CertBase64, nextSpec.KeyBase64 = cert, key
+	assert.False(r.needRestartServer(&nextSpec))
+	nextSpec.HTTPS = false
+	assert.True(r.needRestartServer(&nextSpec))
+
+	assert.True(server == r.server)
+}
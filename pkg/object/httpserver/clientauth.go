@@ -0,0 +1,370 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	defaultOCSPTimeout       = 3 * time.Second
+	defaultOCSPCacheDuration = time.Hour
+)
+
+type (
+	// ClientAuthSpec describes the verification of the client certificates
+	// in addition to the verification by the CA.
+	ClientAuthSpec struct {
+		// MaxVerifyDepth is the max number of intermediate certificates
+		// between the client certificate and the CA, no limit if it is 0.
+		MaxVerifyDepth int `json:"maxVerifyDepth,omitempty" jsonschema:"minimum=0"`
+		// CRLBase64 is the PEM encoded certificate revocation lists.
+		CRLBase64 string `json:"crlBase64,omitempty" jsonschema:"format=base64"`
+		// CRLFile is the file of the PEM encoded certificate revocation
+		// lists, it is reloaded once modified.
+		CRLFile string    `json:"crlFile,omitempty"`
+		OCSP    *OCSPSpec `json:"ocsp,omitempty"`
+	}
+
+	// OCSPSpec describes the revocation check of client certificates by
+	// OCSP.
+	OCSPSpec struct {
+		// ResponderURL overrides the OCSP server in the certificates.
+		ResponderURL string `json:"responderURL,omitempty"`
+		Timeout      string `json:"timeout,omitempty" jsonschema:"format=duration"`
+		// FailOpen accepts the certificates if the responder is not
+		// available, the certificates are rejected by default.
+		FailOpen bool `json:"failOpen,omitempty"`
+	}
+
+	// clientCertVerifier verifies the chains of the client certificates
+	// which have been verified by the CA.
+	clientCertVerifier struct {
+		spec *ClientAuthSpec
+		crls []*x509.RevocationList
+		file *crlFile
+		ocsp *ocspChecker
+	}
+
+	// crlFile is the revocation lists loaded from a file.
+	crlFile struct {
+		path    string
+		lock    sync.Mutex
+		modTime time.Time
+		crls    []*x509.RevocationList
+		err     error
+	}
+
+	ocspChecker struct {
+		spec    *OCSPSpec
+		client  *http.Client
+		lock    sync.Mutex
+		results map[string]*ocspResult
+	}
+
+	ocspResult struct {
+		err   error
+		until time.Time
+	}
+)
+
+// Validate validates ClientAuthSpec.
+func (spec *ClientAuthSpec) Validate() error {
+	if spec.CRLBase64 != "" {
+		if _, err := parseCRLs(tryDecodeBase64Pem(spec.CRLBase64)); err != nil {
+			return fmt.Errorf("invalid crlBase64: %v", err)
+		}
+	}
+	if spec.OCSP != nil && spec.OCSP.Timeout != "" {
+		if _, err := time.ParseDuration(spec.OCSP.Timeout); err != nil {
+			return fmt.Errorf("invalid ocsp timeout %s: %v", spec.OCSP.Timeout, err)
+		}
+	}
+	if spec.OCSP != nil && spec.OCSP.ResponderURL != "" {
+		if _, err := url.ParseRequestURI(spec.OCSP.ResponderURL); err != nil {
+			return fmt.Errorf("invalid ocsp responderURL %s: %v", spec.OCSP.ResponderURL, err)
+		}
+	}
+	return nil
+}
+
+// parseCRLs parses the PEM encoded revocation lists.
+func parseCRLs(data []byte) ([]*x509.RevocationList, error) {
+	var crls []*x509.RevocationList
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		crls = append(crls, crl)
+	}
+	if len(crls) == 0 {
+		return nil, fmt.Errorf("no revocation list found")
+	}
+	return crls, nil
+}
+
+func newClientCertVerifier(spec *ClientAuthSpec) *clientCertVerifier {
+	v := &clientCertVerifier{spec: spec}
+	if spec.CRLBase64 != "" {
+		v.crls, _ = parseCRLs(tryDecodeBase64Pem(spec.CRLBase64))
+	}
+	if spec.CRLFile != "" {
+		v.file = &crlFile{path: spec.CRLFile}
+	}
+	if spec.OCSP != nil {
+		timeout := defaultOCSPTimeout
+		if spec.OCSP.Timeout != "" {
+			timeout, _ = time.ParseDuration(spec.OCSP.Timeout)
+		}
+		v.ocsp = &ocspChecker{
+			spec:    spec.OCSP,
+			client:  &http.Client{Timeout: timeout},
+			results: map[string]*ocspResult{},
+		}
+	}
+	return v
+}
+
+// verify is the VerifyPeerCertificate callback of tls.Config, the client
+// certificate is accepted if one of the verified chains passes.
+func (v *clientCertVerifier) verify(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	err := fmt.Errorf("no verified certificate chain")
+	for _, chain := range verifiedChains {
+		if err = v.verifyChain(chain); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (v *clientCertVerifier) verifyChain(chain []*x509.Certificate) error {
+	// The chain includes the client certificate and the CA.
+	if depth := len(chain) - 2; v.spec.MaxVerifyDepth > 0 && depth > v.spec.MaxVerifyDepth {
+		return fmt.Errorf("verify depth %d exceeds %d", depth, v.spec.MaxVerifyDepth)
+	}
+
+	crls := v.crls
+	if v.file != nil {
+		fileCRLs, err := v.file.get()
+		if err != nil {
+			return err
+		}
+		crls = append(crls[:len(crls):len(crls)], fileCRLs...)
+	}
+
+	for i := 0; i < len(chain)-1; i++ {
+		if err := checkCRLs(crls, chain[i], chain[i+1]); err != nil {
+			return err
+		}
+	}
+
+	if v.ocsp != nil && len(chain) > 1 {
+		return v.ocsp.check(chain[0], chain[1])
+	}
+	return nil
+}
+
+// checkCRLs checks whether the certificate is revoked by the revocation
+// lists of its issuer.
+func checkCRLs(crls []*x509.RevocationList, cert, issuer *x509.Certificate) error {
+	for _, crl := range crls {
+		if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+			continue
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			continue
+		}
+		for _, rc := range crl.RevokedCertificateEntries {
+			if rc.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("certificate %s is revoked", cert.Subject)
+			}
+		}
+	}
+	return nil
+}
+
+// get returns the revocation lists in the file, the file is reloaded if
+// it is modified. The last loaded lists are used if the reloading fails.
+func (f *crlFile) get() ([]*x509.RevocationList, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		if f.crls == nil {
+			return nil, fmt.Errorf("load crl file %s failed: %v", f.path, err)
+		}
+		return f.crls, nil
+	}
+	if fi.ModTime().Equal(f.modTime) {
+		return f.crls, f.err
+	}
+
+	f.modTime = fi.ModTime()
+	data, err := os.ReadFile(f.path)
+	if err == nil {
+		var crls []*x509.RevocationList
+		if crls, err = parseCRLs(data); err == nil {
+			f.crls, f.err = crls, nil
+			return f.crls, nil
+		}
+	}
+
+	logger.Errorf("load crl file %s failed: %v", f.path, err)
+	if f.crls == nil {
+		f.err = fmt.Errorf("load crl file %s failed: %v", f.path, err)
+	}
+	return f.crls, f.err
+}
+
+// check checks the revocation status of the certificate by OCSP, the
+// results are cached until the next update of the responses.
+func (c *ocspChecker) check(cert, issuer *x509.Certificate) error {
+	key := issuer.SerialNumber.String() + "/" + cert.SerialNumber.String()
+	now := time.Now()
+
+	c.lock.Lock()
+	r := c.results[key]
+	c.lock.Unlock()
+	if r != nil && now.Before(r.until) {
+		return r.err
+	}
+
+	until, err := c.query(cert, issuer)
+	if err == nil || !until.IsZero() {
+		c.lock.Lock()
+		c.results[key] = &ocspResult{err: err, until: until}
+		c.lock.Unlock()
+		return err
+	}
+
+	if c.spec.FailOpen {
+		logger.Warnf("ocsp check of %s failed, the certificate is accepted: %v", cert.Subject, err)
+		return nil
+	}
+	return err
+}
+
+// query queries the responder, until is zero if the responder is not
+// available.
+func (c *ocspChecker) query(cert, issuer *x509.Certificate) (time.Time, error) {
+	responder := c.spec.ResponderURL
+	if responder == "" {
+		if len(cert.OCSPServer) == 0 {
+			return time.Time{}, fmt.Errorf("no ocsp server for certificate %s", cert.Subject)
+		}
+		responder = cert.OCSPServer[0]
+	}
+
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("create ocsp request failed: %v", err)
+	}
+	resp, err := c.client.Post(responder, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("query ocsp server %s failed: %v", responder, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read ocsp response failed: %v", err)
+	}
+	ocspResp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse ocsp response failed: %v", err)
+	}
+
+	until := ocspResp.NextUpdate
+	if until.IsZero() {
+		until = time.Now().Add(defaultOCSPCacheDuration)
+	}
+
+	switch ocspResp.Status {
+	case ocsp.Good:
+		return until, nil
+	case ocsp.Revoked:
+		return until, fmt.Errorf("certificate %s is revoked", cert.Subject)
+	default:
+		return until, fmt.Errorf("revocation status of certificate %s is unknown", cert.Subject)
+	}
+}
+
+// setClientCertHeader sets the header of the verified client certificate
+// in the format of X-Forwarded-Client-Cert, the header sent by the client
+// is always removed.
+func setClientCertHeader(r *httpprot.Request, header string) {
+	r.HTTPHeader().Del(header)
+
+	state := r.Std().TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	cert := state.PeerCertificates[0]
+	hash := sha256.Sum256(cert.Raw)
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+
+	var sb strings.Builder
+	sb.WriteString("Hash=")
+	sb.WriteString(hex.EncodeToString(hash[:]))
+	sb.WriteString(";Cert=")
+	sb.WriteString(quoteHeaderValue(url.QueryEscape(string(certPem))))
+	sb.WriteString(";Subject=")
+	sb.WriteString(quoteHeaderValue(cert.Subject.String()))
+	for _, u := range cert.URIs {
+		sb.WriteString(";URI=")
+		sb.WriteString(u.String())
+	}
+	for _, dns := range cert.DNSNames {
+		sb.WriteString(";DNS=")
+		sb.WriteString(dns)
+	}
+	r.HTTPHeader().Set(header, sb.String())
+}
+
+func quoteHeaderValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+}
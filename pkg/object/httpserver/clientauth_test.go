@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate signed by the parent, or a self-signed
+// CA if parent is nil.
+func newTestCert(t *testing.T, name string, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func newTestCRL(t *testing.T, issuer *testCert, revoked ...*testCert) []byte {
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, c := range revoked {
+		tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   c.cert.SerialNumber,
+			RevocationTime: time.Now(),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, issuer.cert, issuer.key)
+	assert.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func TestClientCertVerifier(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCert(t, "ca", 1, nil)
+	inter := newTestCert(t, "intermediate", 2, ca)
+	good := newTestCert(t, "good", 3, inter)
+	revoked := newTestCert(t, "revoked", 4, inter)
+
+	chain := func(c *testCert) [][]*x509.Certificate {
+		return [][]*x509.Certificate{{c.cert, inter.cert, ca.cert}}
+	}
+
+	// verify depth
+	v := newClientCertVerifier(&ClientAuthSpec{MaxVerifyDepth: 1})
+	assert.Nil(v.verify(nil, chain(good)))
+	v = newClientCertVerifier(&ClientAuthSpec{MaxVerifyDepth: 1})
+	assert.NotNil(v.verify(nil, [][]*x509.Certificate{{good.cert, inter.cert, inter.cert, ca.cert}}))
+	assert.NotNil(v.verify(nil, nil))
+
+	// crl
+	crl := newTestCRL(t, inter, revoked)
+	spec := &ClientAuthSpec{CRLBase64: base64.StdEncoding.EncodeToString(crl)}
+	assert.Nil(spec.Validate())
+	v = newClientCertVerifier(spec)
+	assert.Nil(v.verify(nil, chain(good)))
+	assert.NotNil(v.verify(nil, chain(revoked)))
+
+	// the crl signed by another issuer is ignored.
+	other := newTestCert(t, "intermediate", 5, ca)
+	v = newClientCertVerifier(&ClientAuthSpec{CRLBase64: string(newTestCRL(t, other, revoked))})
+	assert.Nil(v.verify(nil, chain(revoked)))
+
+	assert.NotNil((&ClientAuthSpec{CRLBase64: "abc"}).Validate())
+
+	// crl file
+	file := filepath.Join(t.TempDir(), "crl.pem")
+	v = newClientCertVerifier(&ClientAuthSpec{CRLFile: file})
+	assert.NotNil(v.verify(nil, chain(good)))
+
+	assert.Nil(os.WriteFile(file, newTestCRL(t, inter), 0o600))
+	assert.Nil(v.verify(nil, chain(revoked)))
+
+	assert.Nil(os.WriteFile(file, crl, 0o600))
+	modTime := time.Now().Add(time.Second)
+	assert.Nil(os.Chtimes(file, modTime, modTime))
+	assert.NotNil(v.verify(nil, chain(revoked)))
+	assert.Nil(v.verify(nil, chain(good)))
+}
+
+func TestOCSPChecker(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCert(t, "ca", 1, nil)
+	good := newTestCert(t, "good", 2, ca)
+	revoked := newTestCert(t, "revoked", 3, ca)
+
+	queries := 0
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		assert.Nil(err)
+
+		status := ocsp.Good
+		if req.SerialNumber.Cmp(revoked.cert.SerialNumber) == 0 {
+			status = ocsp.Revoked
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, ca.key)
+		assert.Nil(err)
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	spec := &ClientAuthSpec{OCSP: &OCSPSpec{ResponderURL: responder.URL, Timeout: "1s"}}
+	assert.Nil(spec.Validate())
+	v := newClientCertVerifier(spec)
+
+	assert.Nil(v.verify(nil, [][]*x509.Certificate{{good.cert, ca.cert}}))
+	assert.NotNil(v.verify(nil, [][]*x509.Certificate{{revoked.cert, ca.cert}}))
+
+	// the results are cached.
+	assert.Nil(v.verify(nil, [][]*x509.Certificate{{good.cert, ca.cert}}))
+	assert.Equal(2, queries)
+
+	// the responder is not available.
+	responder.Close()
+	another := newTestCert(t, "another", 4, ca)
+	assert.NotNil(v.verify(nil, [][]*x509.Certificate{{another.cert, ca.cert}}))
+	spec.OCSP.FailOpen = true
+	assert.Nil(v.verify(nil, [][]*x509.Certificate{{another.cert, ca.cert}}))
+
+	assert.NotNil((&ClientAuthSpec{OCSP: &OCSPSpec{Timeout: "abc"}}).Validate())
+}
+
+func TestSetClientCertHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	const header = "X-Forwarded-Client-Cert"
+	ca := newTestCert(t, "ca", 1, nil)
+	client := newTestCert(t, "client.example.com", 2, ca)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "https://www.example.com", nil)
+	stdr.Header.Set(header, "forged")
+	req, _ := httpprot.NewRequest(stdr)
+
+	// the header sent by the client is removed.
+	setClientCertHeader(req, header)
+	assert.Empty(req.HTTPHeader().Get(header))
+
+	stdr.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{client.cert},
+		VerifiedChains:   [][]*x509.Certificate{{client.cert, ca.cert}},
+	}
+	setClientCertHeader(req, header)
+	v := req.HTTPHeader().Get(header)
+	assert.True(strings.HasPrefix(v, "Hash="))
+	assert.Contains(v, `;Subject="CN=client.example.com"`)
+	assert.Contains(v, ";DNS=client.example.com")
+	assert.Contains(v, ";Cert=\""+url.QueryEscape("-----BEGIN CERTIFICATE-----"))
+}
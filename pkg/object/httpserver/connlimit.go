@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+const rejectReasonConnectionsPerIP = "connectionsPerIP"
+
+type (
+	// connLimiter tracks the connections accepted by the server, and
+	// enforces the per client IP and per connection limits.
+	connLimiter struct {
+		maxPerIP    int
+		maxRequests uint64
+		metrics     *metrics
+
+		lock  sync.Mutex
+		perIP map[string]int
+		conns map[*limitedConn]struct{}
+	}
+
+	// limitedListener is a listener whose connections are tracked by the
+	// limiter.
+	limitedListener struct {
+		net.Listener
+		limiter *connLimiter
+	}
+
+	// limitedConn is a connection tracked by the limiter, it is counted
+	// for its client IP on the first request, as the IP may be unknown
+	// before that, e.g. the PROXY header is not read yet.
+	limitedConn struct {
+		net.Conn
+		limiter *connLimiter
+
+		countOnce sync.Once
+		ip        string
+		counted   bool
+		rejected  bool
+		requests  atomic.Uint64
+		closeOnce sync.Once
+	}
+
+	limitedConnKey struct{}
+)
+
+func newConnLimiter(spec *Spec, m *metrics) *connLimiter {
+	return &connLimiter{
+		maxPerIP:    int(spec.MaxConnectionsPerIP),
+		maxRequests: uint64(spec.MaxRequestsPerConnection),
+		metrics:     m,
+		perIP:       map[string]int{},
+		conns:       map[*limitedConn]struct{}{},
+	}
+}
+
+func (l *connLimiter) newListener(listener net.Listener) net.Listener {
+	return &limitedListener{Listener: listener, limiter: l}
+}
+
+// Accept accepts a connection and tracks it.
+func (ll *limitedListener) Accept() (net.Conn, error) {
+	conn, err := ll.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l := ll.limiter
+	l.metrics.ActiveConnections.WithLabelValues().Inc()
+
+	lc := &limitedConn{Conn: conn, limiter: l}
+	l.lock.Lock()
+	l.conns[lc] = struct{}{}
+	l.lock.Unlock()
+	return lc, nil
+}
+
+// activeConnections returns the count of the open connections, including
+// the ones hijacked from the HTTP server.
+func (l *connLimiter) activeConnections() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.conns)
+}
+
+// closeAll closes all the open connections.
+func (l *connLimiter) closeAll() {
+	l.lock.Lock()
+	conns := make([]*limitedConn, 0, len(l.conns))
+	for lc := range l.conns {
+		conns = append(conns, lc)
+	}
+	l.lock.Unlock()
+
+	for _, lc := range conns {
+		lc.Close()
+	}
+}
+
+// connContext puts the tracked connection into the context of the
+// requests on it, it is the ConnContext of http.Server. The connections
+// of HTTPS servers are wrapped by TLS above the limited listener.
+func (l *connLimiter) connContext(ctx stdcontext.Context, c net.Conn) stdcontext.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if lc, ok := c.(*limitedConn); ok {
+		return stdcontext.WithValue(ctx, limitedConnKey{}, lc)
+	}
+	return ctx
+}
+
+// count counts the connection for the client IP, and reports whether
+// the connection exceeds the limit.
+func (lc *limitedConn) count(remoteAddr string) bool {
+	lc.countOnce.Do(func() {
+		l := lc.limiter
+		if l.maxPerIP <= 0 {
+			return
+		}
+
+		ip, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			ip = remoteAddr
+		}
+
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		if l.perIP[ip] >= l.maxPerIP {
+			lc.rejected = true
+			return
+		}
+		l.perIP[ip]++
+		lc.ip, lc.counted = ip, true
+	})
+	return lc.rejected
+}
+
+// Close closes the connection and stops tracking it.
+func (lc *limitedConn) Close() error {
+	lc.closeOnce.Do(func() {
+		l := lc.limiter
+		l.metrics.ActiveConnections.WithLabelValues().Dec()
+
+		// wait for the counting in progress.
+		lc.countOnce.Do(func() {})
+
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		delete(l.conns, lc)
+		if !lc.counted {
+			return
+		}
+		if l.perIP[lc.ip]--; l.perIP[lc.ip] <= 0 {
+			delete(l.perIP, lc.ip)
+		}
+	})
+	return lc.Conn.Close()
+}
+
+// handler wraps the handler to enforce the limits on the requests.
+func (l *connLimiter) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lc, ok := req.Context().Value(limitedConnKey{}).(*limitedConn)
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if lc.count(req.RemoteAddr) {
+			l.metrics.RejectedRequests.WithLabelValues(rejectReasonConnectionsPerIP).Inc()
+			w.Header().Set("Connection", "close")
+			http.Error(w, "too many connections from the client", http.StatusTooManyRequests)
+			return
+		}
+
+		// HTTP/2 connections are not closed by the header.
+		n := lc.requests.Add(1)
+		if l.maxRequests > 0 && n >= l.maxRequests && req.ProtoMajor == 1 {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context/contexttest"
+	"github.com/megaease/easegress/v2/pkg/option"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+func TestConnLimits(t *testing.T) {
+	testConnLimits(t, false)
+}
+
+func TestConnLimitsHTTPS(t *testing.T) {
+	testConnLimits(t, true)
+}
+
+func testConnLimits(t *testing.T, https bool) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	yaml := fmt.Sprintf(`
+kind: HTTPServer
+name: test
+address: 127.0.0.1
+port: %d
+keepAlive: true
+https: %v
+maxConnectionsPerIP: 1
+maxRequestsPerConnection: 2
+`, port, https)
+	if https {
+		cert, key := genCertPem(t, "127.0.0.1")
+		yaml += fmt.Sprintf("certBase64: %s\nkeyBase64: %s\n", cert, key)
+	}
+	superSpec, err := super.NewSpec(yaml)
+	assert.NoError(err)
+
+	svr := &HTTPServer{}
+	svr.Init(superSpec, &contexttest.MockedMuxMapper{})
+	defer svr.Close()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	dial := func() (net.Conn, error) {
+		if https {
+			return tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+		}
+		return net.Dial("tcp", addr)
+	}
+
+	var conn1 net.Conn
+	assert.Eventually(func() bool {
+		conn1, err = dial()
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	defer conn1.Close()
+
+	get := func(conn net.Conn, r *bufio.Reader) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/", nil)
+		assert.NoError(req.Write(conn))
+		resp, err := http.ReadResponse(r, req)
+		assert.NoError(err)
+		resp.Body.Close()
+		return resp
+	}
+
+	r1 := bufio.NewReader(conn1)
+	resp := get(conn1, r1)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	assert.False(resp.Close)
+
+	// the second connection from the same IP is rejected.
+	conn2, err := dial()
+	assert.NoError(err)
+	defer conn2.Close()
+	resp = get(conn2, bufio.NewReader(conn2))
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode)
+	assert.True(resp.Close)
+
+	// the connection is closed after serving the max requests.
+	resp = get(conn1, r1)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	assert.True(resp.Close)
+
+	// a new connection is allowed once the previous one is closed.
+	assert.Eventually(func() bool {
+		conn3, err := dial()
+		if err != nil {
+			return false
+		}
+		defer conn3.Close()
+		return get(conn3, bufio.NewReader(conn3)).StatusCode == http.StatusNotFound
+	}, time.Second, 10*time.Millisecond)
+}
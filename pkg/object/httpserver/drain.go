@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	stdcontext "context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	drainPollInterval   = 100 * time.Millisecond
+)
+
+type (
+	// drain drains the connections of a closed server, the new requests
+	// are not accepted, and the in-flight ones are waited until the
+	// deadline.
+	drain struct {
+		name     string
+		server   *http.Server
+		limiter  *connLimiter
+		startAt  time.Time
+		deadline time.Time
+	}
+
+	// drainSet is the set of the drains in progress.
+	drainSet struct {
+		lock   sync.Mutex
+		drains map[*drain]struct{}
+	}
+
+	// DrainStatus is the status of draining the connections of a closed
+	// server.
+	DrainStatus struct {
+		StartedAt   string `json:"startedAt"`
+		Deadline    string `json:"deadline"`
+		Connections int    `json:"connections"`
+	}
+)
+
+// drainTimeout returns the drain timeout of the spec.
+func (spec *Spec) drainTimeout() time.Duration {
+	if spec.DrainTimeout == "" {
+		return defaultDrainTimeout
+	}
+	d, _ := time.ParseDuration(spec.DrainTimeout)
+	return d
+}
+
+// start starts draining the connections, it returns once the listeners
+// are closed, and the returned channel is closed once the drain finishes.
+func (d *drain) start() <-chan struct{} {
+	listenersClosed := make(chan struct{})
+	d.server.RegisterOnShutdown(func() {
+		close(listenersClosed)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.run()
+	}()
+
+	<-listenersClosed
+	return done
+}
+
+func (d *drain) run() {
+	ctx, cancel := stdcontext.WithDeadline(stdcontext.Background(), d.deadline)
+	defer cancel()
+
+	// Shutdown closes the idle connections, and sends 'Connection: close'
+	// or GOAWAY to the active ones once their requests finish.
+	if err := d.server.Shutdown(ctx); err != nil {
+		logger.Warnf("shutdown http1/2 server %s failed: %v", d.name, err)
+	}
+
+	// The hijacked connections, e.g. WebSockets and HTTP/2 without TLS,
+	// are not waited by Shutdown.
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for d.limiter.activeConnections() > 0 {
+		select {
+		case <-ctx.Done():
+			logger.Warnf("httpserver %s: close %d connections not drained in time",
+				d.name, d.limiter.activeConnections())
+			d.limiter.closeAll()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *drain) status() *DrainStatus {
+	return &DrainStatus{
+		StartedAt:   d.startAt.Format(time.RFC3339),
+		Deadline:    d.deadline.Format(time.RFC3339),
+		Connections: d.limiter.activeConnections(),
+	}
+}
+
+func (ds *drainSet) add(d *drain) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	if ds.drains == nil {
+		ds.drains = map[*drain]struct{}{}
+	}
+	ds.drains[d] = struct{}{}
+}
+
+func (ds *drainSet) remove(d *drain) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	delete(ds.drains, d)
+}
+
+func (ds *drainSet) status() []*DrainStatus {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	var result []*DrainStatus
+	for d := range ds.drains {
+		result = append(result, d.status())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt < result[j].StartedAt
+	})
+	return result
+}
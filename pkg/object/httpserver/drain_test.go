@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+func TestDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(`
+kind: HTTPServer
+name: test
+port: 10080
+keepAlive: true
+https: false
+drainTimeout: 500ms
+`)
+	assert.NoError(err)
+	spec := superSpec.ObjectSpec().(*Spec)
+	assert.Equal(500*time.Millisecond, spec.drainTimeout())
+	assert.Equal(defaultDrainTimeout, (&Spec{}).drainTimeout())
+
+	newDrain := func(handler http.HandlerFunc) (*drain, string) {
+		limiter := newConnLimiter(spec, (&runtime{superSpec: superSpec}).newMetrics("test"))
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(err)
+		srv := &http.Server{Handler: handler}
+		go srv.Serve(limiter.newListener(l))
+
+		now := time.Now()
+		return &drain{
+			name:     "test",
+			server:   srv,
+			limiter:  limiter,
+			startAt:  now,
+			deadline: now.Add(spec.drainTimeout()),
+		}, l.Addr().String()
+	}
+
+	// the in-flight request is finished, and the connection is closed.
+	release := make(chan struct{})
+	d, addr := newDrain(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(err)
+	defer conn.Close()
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/", nil)
+	assert.NoError(req.Write(conn))
+	assert.Eventually(func() bool {
+		return d.limiter.activeConnections() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	done := d.start()
+	_, err = net.Dial("tcp", addr)
+	assert.Error(err)
+	assert.Equal(1, d.status().Connections)
+
+	close(release)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.True(resp.Close)
+	<-done
+	assert.Equal(0, d.limiter.activeConnections())
+
+	// the hijacked connection is closed after the timeout.
+	d, addr = newDrain(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Hijacker).Hijack()
+	})
+	conn, err = net.Dial("tcp", addr)
+	assert.NoError(err)
+	defer conn.Close()
+	assert.NoError(req.Write(conn))
+	assert.Eventually(func() bool {
+		return d.limiter.activeConnections() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	start := time.Now()
+	<-d.start()
+	assert.GreaterOrEqual(time.Since(start), 400*time.Millisecond)
+	assert.Equal(0, d.limiter.activeConnections())
+
+	ds := &drainSet{}
+	ds.add(d)
+	assert.Len(ds.status(), 1)
+	ds.remove(d)
+	assert.Len(ds.status(), 0)
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/object/httpserver/routers"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+// heartbeatLine is a comment line, which is ignored by the clients.
+var heartbeatLine = []byte(":\n")
+
+// eventStreamWriter writes Server-Sent Events to the client, every write
+// is flushed immediately.
+type eventStreamWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	lineStart bool
+	lastWrite time.Time
+}
+
+// Write writes the data to the client.
+func (w *eventStreamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.lineStart = p[n-1] == '\n'
+	}
+	w.lastWrite = fasttime.Now()
+	return n, err
+}
+
+// heartbeat writes a comment line if nothing is written in the interval.
+// It is only written at the start of a line, so it never splits an event.
+func (w *eventStreamWriter) heartbeat(interval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.lineStart || fasttime.Since(w.lastWrite) < interval {
+		return
+	}
+	w.w.Write(heartbeatLine)
+	w.lastWrite = fasttime.Now()
+}
+
+// activityReader records the time of the last read of the events.
+type activityReader struct {
+	r        io.Reader
+	lastRead atomic.Int64
+}
+
+func (r *activityReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.lastRead.Store(fasttime.Now().UnixNano())
+	}
+	return n, err
+}
+
+// copyEventStream copies the events from r to the client, it sends
+// heartbeats to the client when the stream is idle, and closes r if no
+// event is received in the idle timeout.
+func copyEventStream(stdw http.ResponseWriter, r io.Reader, spec *routers.EventStream) int64 {
+	w := &eventStreamWriter{
+		w:         NewResponseFlushWriter(stdw),
+		lineStart: true,
+		lastWrite: fasttime.Now(),
+	}
+
+	var heartbeatInterval, idleTimeout time.Duration
+	if spec != nil {
+		heartbeatInterval, _ = time.ParseDuration(spec.HeartbeatInterval)
+		idleTimeout, _ = time.ParseDuration(spec.IdleTimeout)
+	}
+	if heartbeatInterval <= 0 && idleTimeout <= 0 {
+		n, _ := io.Copy(w, r)
+		return n
+	}
+
+	tick := heartbeatInterval
+	if tick <= 0 || (idleTimeout > 0 && idleTimeout < tick) {
+		tick = idleTimeout
+	}
+
+	ar := &activityReader{r: r}
+	ar.lastRead.Store(fasttime.Now().UnixNano())
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(tick / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			if idleTimeout > 0 && fasttime.Since(time.Unix(0, ar.lastRead.Load())) >= idleTimeout {
+				// Closing the stream unblocks the copying.
+				if c, ok := r.(io.Closer); ok {
+					c.Close()
+				}
+				return
+			}
+			if heartbeatInterval > 0 {
+				w.heartbeat(heartbeatInterval)
+			}
+		}
+	}()
+
+	n, _ := io.Copy(w, ar)
+	close(done)
+	return n
+}
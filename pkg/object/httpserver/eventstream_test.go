@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/object/httpserver/routers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyEventStream(t *testing.T) {
+	assert := assert.New(t)
+
+	w := httptest.NewRecorder()
+	n := copyEventStream(w, strings.NewReader("data: a\n\n"), nil)
+	assert.Equal(int64(9), n)
+	assert.Equal("data: a\n\n", w.Body.String())
+	assert.True(w.Flushed)
+
+	// heartbeats are sent between the events only.
+	r, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("data: a\n\n"))
+		time.Sleep(300 * time.Millisecond)
+		pw.Write([]byte("data: b"))
+		time.Sleep(300 * time.Millisecond)
+		pw.Write([]byte("\n\n"))
+		pw.Close()
+	}()
+
+	w = httptest.NewRecorder()
+	n = copyEventStream(w, r, &routers.EventStream{HeartbeatInterval: "50ms"})
+	assert.Equal(int64(18), n)
+	body := w.Body.String()
+	assert.True(strings.HasPrefix(body, "data: a\n\n:\n"))
+	assert.True(strings.HasSuffix(body, ":\ndata: b\n\n"))
+
+	// the stream is closed if no event is received.
+	r, pw = io.Pipe()
+	defer pw.Close()
+	w = httptest.NewRecorder()
+	start := time.Now()
+	n = copyEventStream(w, r, &routers.EventStream{IdleTimeout: "100ms"})
+	assert.Equal(int64(0), n)
+	assert.Less(time.Since(start), 2*time.Second)
+}
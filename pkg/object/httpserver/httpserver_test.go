@@ -18,7 +18,12 @@
 package httpserver
 
 import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -70,3 +75,37 @@ https: false
 	svr2.Close()
 	time.Sleep(200 * time.Millisecond)
 }
+
+func TestHTTPServerUnixSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "easegress.sock")
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(fmt.Sprintf(`
+kind: HTTPServer
+name: test
+keepAlive: true
+https: false
+unixSocket: %s
+`, path))
+	assert.NoError(err)
+
+	svr := &HTTPServer{}
+	svr.Init(superSpec, &contexttest.MockedMuxMapper{})
+	defer svr.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx stdcontext.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	assert.Eventually(func() bool {
+		resp, err := client.Get("http://www.megaease.com/")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusNotFound
+	}, time.Second, 10*time.Millisecond)
+}
@@ -21,10 +21,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"mime"
 	"net/http"
 	"reflect"
-	"regexp"
 	"strings"
 	"sync/atomic"
 	"text/template"
@@ -46,6 +44,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/util/ipfilter"
 	"github.com/megaease/easegress/v2/pkg/util/readers"
 	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+	"github.com/megaease/easegress/v2/pkg/util/urlrewriter"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -62,12 +61,12 @@ type (
 	}
 
 	muxInstance struct {
-		superSpec          *supervisor.Spec
-		spec               *Spec
-		httpStat           *httpstat.HTTPStat
-		topN               *httpstat.TopN
-		metrics            *metrics
-		accessLogFormatter *accessLogFormatter
+		superSpec    *supervisor.Spec
+		spec         *Spec
+		httpStat     *httpstat.HTTPStat
+		topN         *httpstat.TopN
+		metrics      *metrics
+		accessLogger *accessLogger
 
 		muxMapper context.MuxMapper
 
@@ -75,6 +74,7 @@ type (
 
 		tracer   *tracing.Tracer
 		ipFilter *ipfilter.IPFilter
+		rewriter *urlrewriter.Rewriter
 
 		router routers.Router
 	}
@@ -89,19 +89,32 @@ type (
 	}
 
 	accessLog struct {
-		Time        string
-		RemoteAddr  string
-		RealIP      string
-		Method      string
-		URI         string
-		Proto       string
-		StatusCode  int
-		Duration    time.Duration
-		ReqSize     uint64
-		RespSize    uint64
-		ReqHeaders  string
-		RespHeaders string
-		Tags        string
+		Time        string        `json:"time"`
+		RemoteAddr  string        `json:"remoteAddr"`
+		RealIP      string        `json:"realIP"`
+		Method      string        `json:"method"`
+		Host        string        `json:"host"`
+		URI         string        `json:"uri"`
+		Proto       string        `json:"proto"`
+		StatusCode  int           `json:"statusCode"`
+		Duration    time.Duration `json:"-"`
+		ReqSize     uint64        `json:"reqSize"`
+		RespSize    uint64        `json:"respSize"`
+		ReqHeaders  string        `json:"reqHeaders"`
+		RespHeaders string        `json:"respHeaders"`
+		Tags        string        `json:"tags"`
+
+		// Route and Backend are the path and backend of the matched route.
+		Route   string `json:"route"`
+		Backend string `json:"backend"`
+		// UpstreamAddr, UpstreamAttempts and UpstreamDuration are reported
+		// by the proxy filters, they are the server of the last attempt,
+		// the count of the attempts and the total time of them.
+		UpstreamAddr     string        `json:"upstreamAddr"`
+		UpstreamAttempts int           `json:"upstreamAttempts"`
+		UpstreamDuration time.Duration `json:"-"`
+
+		startAt time.Time
 	}
 )
 
@@ -110,6 +123,7 @@ var (
 	forbidden        = &cachedRoute{code: http.StatusForbidden}
 	methodNotAllowed = &cachedRoute{code: http.StatusMethodNotAllowed}
 	badRequest       = &cachedRoute{code: http.StatusBadRequest}
+	rewriteLoop      = &cachedRoute{code: http.StatusInternalServerError}
 )
 
 func (mi *muxInstance) getRouteFromCache(req *httpprot.Request) *cachedRoute {
@@ -141,9 +155,11 @@ func newMux(httpStat *httpstat.HTTPStat, topN *httpstat.TopN,
 		spec:      &Spec{},
 		tracer:    tracing.NoopTracer,
 		muxMapper: mapper,
-		httpStat:  httpStat,
-		topN:      topN,
-		metrics:   metrics,
+
+		accessLogger: newAccessLogger(&Spec{}, nil),
+		httpStat:     httpStat,
+		topN:         topN,
+		metrics:      metrics,
 	})
 
 	return m
@@ -171,25 +187,44 @@ func (m *mux) reload(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
 		tracer = oldInst.tracer
 	}
 
+	var al *accessLogger
+	if oldInst.accessLogger != nil && reflect.DeepEqual(oldInst.spec.AccessLog, spec.AccessLog) &&
+		oldInst.spec.AccessLogFormat == spec.AccessLogFormat {
+		al = oldInst.accessLogger
+	} else {
+		if oldInst.accessLogger != nil {
+			defer oldInst.accessLogger.close()
+		}
+		al = newAccessLogger(spec, oldInst.metrics.DroppedAccessLogs)
+	}
+
 	routerKind := "Ordered"
 	if spec.RouterKind != "" {
 		routerKind = spec.RouterKind
 	}
 
 	inst := &muxInstance{
-		superSpec:          superSpec,
-		spec:               spec,
-		muxMapper:          muxMapper,
-		httpStat:           m.httpStat,
-		topN:               m.topN,
-		metrics:            oldInst.metrics,
-		ipFilter:           ipfilter.New(spec.IPFilter),
-		tracer:             tracer,
-		accessLogFormatter: newAccessLogFormatter(spec.AccessLogFormat),
+		superSpec:    superSpec,
+		spec:         spec,
+		muxMapper:    muxMapper,
+		httpStat:     m.httpStat,
+		topN:         m.topN,
+		metrics:      oldInst.metrics,
+		ipFilter:     ipfilter.New(spec.IPFilter),
+		tracer:       tracer,
+		accessLogger: al,
 	}
 	spec.Rules.Init()
 	inst.router = routers.Create(routerKind, spec.Rules)
 
+	if len(spec.Rewrites) > 0 {
+		rewriter, err := urlrewriter.New(spec.Rewrites)
+		if err != nil {
+			logger.Errorf("BUG: new url rewriter failed: %v", err)
+		}
+		inst.rewriter = rewriter
+	}
+
 	if spec.CacheSize > 0 {
 		arc, err := lru.NewARC(int(spec.CacheSize))
 		if err != nil {
@@ -244,17 +279,21 @@ func (mi *muxInstance) sendResponse(ctx *context.Context, stdw http.ResponseWrit
 	// Send the response
 	header := stdw.Header()
 	for k, v := range resp.HTTPHeader() {
+		// cookies set to the writer by filters are kept.
+		if k == "Set-Cookie" {
+			header[k] = append(header[k], v...)
+			continue
+		}
 		header[k] = v
 	}
 	stdw.WriteHeader(resp.StatusCode())
 
-	var writer io.Writer
-	if responseNeedFlush(resp) {
-		writer = NewResponseFlushWriter(stdw)
+	var respBodySize int64
+	if resp.IsEventStream() {
+		respBodySize = copyEventStream(stdw, resp.GetPayload(), mi.eventStreamSpec(ctx))
 	} else {
-		writer = stdw
+		respBodySize, _ = io.Copy(stdw, resp.GetPayload())
 	}
-	respBodySize, _ := io.Copy(writer, resp.GetPayload())
 
 	return resp.StatusCode(), uint64(respBodySize) + uint64(resp.MetaSize()), header
 }
@@ -287,16 +326,15 @@ func NewResponseFlushWriter(w http.ResponseWriter) *ResponseFlushWriter {
 	}
 }
 
-func responseNeedFlush(resp *httpprot.Response) bool {
-	resCTHeader := resp.Std().Header.Get("Content-Type")
-	resCT, _, err := mime.ParseMediaType(resCTHeader)
-
-	// For Server-Sent Events responses, flush immediately.
-	// The MIME type is defined in https://www.w3.org/TR/eventsource/#text-event-stream
-	if err == nil && resCT == "text/event-stream" {
-		return true
+// eventStreamSpec returns the spec of Server-Sent Events responses of the
+// route of the request, the paths override the server.
+func (mi *muxInstance) eventStreamSpec(ctx *context.Context) *routers.EventStream {
+	if r, ok := ctx.GetRoute(); ok {
+		if route, ok := r.(routers.Route); ok && route.GetEventStream() != nil {
+			return route.GetEventStream()
+		}
 	}
-	return false
+	return mi.spec.EventStream
 }
 
 func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
@@ -322,9 +360,27 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	// get topN here, as the path could be modified later.
 	topN := mi.topN.Stat(req.Path())
 
+	// Normalize the request before routing, so that the routes can't be
+	// bypassed by ambiguous requests.
+	var route *cachedRoute
+	if !mi.normalize(req) {
+		route = badRequest
+	}
+
+	// Rewrite the URL before routing, so that the routes are searched
+	// with the rewritten request.
+	if route == nil && !mi.rewrite(req) {
+		route = rewriteLoop
+	}
+
 	routeCtx := routers.NewContext(req)
-	route := mi.search(routeCtx)
+	if route == nil {
+		route = mi.search(routeCtx)
+	}
 	ctx.SetRoute(route.route)
+	if len(routeCtx.Params.Keys) > 0 {
+		ctx.SetData("HTTP_ROUTE_PARAMS", routeCtx.GetCaptures())
+	}
 
 	var respHeader http.Header
 
@@ -359,23 +415,33 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		span.End()
 
 		// Write access log.
-		logger.LazyHTTPAccess(func() string {
+		al := mi.accessLogger.forHost(stdr.Host)
+		al.log(func() *accessLog {
 			log := &accessLog{
 				Time:        fasttime.Format(startAt, fasttime.RFC3339Milli),
 				RemoteAddr:  stdr.RemoteAddr,
 				RealIP:      req.RealIP(),
 				Method:      stdr.Method,
-				URI:         stdr.RequestURI,
+				Host:        stdr.Host,
+				URI:         al.redactURI(stdr.RequestURI),
 				Proto:       stdr.Proto,
 				StatusCode:  metric.StatusCode,
 				Duration:    metric.Duration,
 				ReqSize:     metric.ReqSize,
 				RespSize:    metric.RespSize,
 				Tags:        ctx.Tags(),
-				ReqHeaders:  printHeader(stdr.Header),
-				RespHeaders: printHeader(respHeader),
+				ReqHeaders:  al.printHeader(stdr.Header),
+				RespHeaders: al.printHeader(respHeader),
+				startAt:     startAt,
+			}
+			if route.code == 0 {
+				log.Route = routePath(route.route)
+				log.Backend = route.route.GetBackend()
 			}
-			return mi.accessLogFormatter.format(log)
+			log.UpstreamAddr, _ = ctx.GetData("HTTP_UPSTREAM_ADDR").(string)
+			log.UpstreamAttempts, _ = ctx.GetData("HTTP_UPSTREAM_ATTEMPTS").(int)
+			log.UpstreamDuration, _ = ctx.GetData("HTTP_UPSTREAM_DURATION").(time.Duration)
+			return log
 		})
 	}()
 
@@ -398,12 +464,19 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	if mi.spec.XForwardedFor {
 		appendXForwardedFor(req)
 	}
+	if mi.spec.ClientCertHeader != "" {
+		setClientCertHeader(req, mi.spec.ClientCertHeader)
+	}
 
 	maxBodySize := route.route.GetClientMaxBodySize()
 	if maxBodySize == 0 {
 		maxBodySize = mi.spec.ClientMaxBodySize
 	}
-	err := req.FetchPayload(maxBodySize)
+	bodyMode := route.route.GetBodyMode()
+	if bodyMode == "" {
+		bodyMode = mi.spec.BodyMode
+	}
+	err := fetchRequestPayload(req, bodyMode, maxBodySize)
 	if err == httpprot.ErrRequestEntityTooLarge {
 		logger.Errorf("%s: %s, you may need to increase 'clientMaxBodySize' or set it to -1", mi.superSpec.Name(), err.Error())
 		buildFailureResponse(ctx, http.StatusRequestEntityTooLarge)
@@ -424,6 +497,45 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	}
 }
 
+// normalize normalizes the request according to the spec, it returns
+// false if the request is rejected.
+func (mi *muxInstance) normalize(req *httpprot.Request) bool {
+	spec := mi.spec.Normalization
+	if spec == nil {
+		return true
+	}
+
+	if spec.RejectAmbiguousHeaders {
+		if name := ambiguousHeader(req.HTTPHeader()); name != "" {
+			logger.Debugf("%s: reject [%s %s] with ambiguous header %s", mi.superSpec.Name(), req.Method(), req.RequestURI, name)
+			mi.metrics.RejectedRequests.WithLabelValues(rejectReasonAmbiguousHeader).Inc()
+			return false
+		}
+	}
+
+	if spec.NormalizePath {
+		if p := normalizePath(req.Path()); p != req.Path() {
+			// the raw path is dropped as it is different from the path.
+			u := req.Std().URL
+			u.Path, u.RawPath = p, ""
+			mi.metrics.NormalizedRequests.WithLabelValues().Inc()
+		}
+	}
+	return true
+}
+
+func (mi *muxInstance) rewrite(req *httpprot.Request) bool {
+	if mi.rewriter == nil {
+		return true
+	}
+
+	if _, err := mi.rewriter.Rewrite(req.Std()); err != nil {
+		logger.Errorf("%s: failed to rewrite [%s %s]: %v", mi.superSpec.Name(), req.Method(), req.RequestURI, err)
+		return false
+	}
+	return true
+}
+
 func (mi *muxInstance) search(context *routers.RouteContext) *cachedRoute {
 	req := context.Request
 	ip := req.RealIP()
@@ -503,6 +615,7 @@ func (mi *muxInstance) close() {
 	if err := mi.tracer.Close(); err != nil {
 		logger.Errorf("%s close tracer failed: %v", mi.superSpec.Name(), err)
 	}
+	mi.accessLogger.close()
 }
 
 func (m *mux) close() {
@@ -531,11 +644,7 @@ func newAccessLogFormatter(format string) *accessLogFormatter {
 	if format == "" {
 		format = defaultAccessLogFormat
 	}
-	varReg := regexp.MustCompile(`\{\{([a-zA-z]*)\}\}`)
-	expr := varReg.ReplaceAllString(format, "{{.$1}}")
-	escapeReg := regexp.MustCompile(`(\[|\])`)
-	expr = escapeReg.ReplaceAllString(expr, "{{`$1`}}")
-	tpl := template.Must(template.New("").Parse(expr))
+	tpl := template.Must(parseAccessLogTemplate(format))
 	return &accessLogFormatter{template: tpl}
 }
 
@@ -547,6 +656,17 @@ func (formatter *accessLogFormatter) format(log *accessLog) string {
 	return buf.String()
 }
 
+// routePath returns the path, path prefix or path regexp of the route.
+func routePath(route routers.Route) string {
+	if p := route.GetExactPath(); p != "" {
+		return p
+	}
+	if p := route.GetPathPrefix(); p != "" {
+		return p
+	}
+	return route.GetPathRegexp()
+}
+
 func printHeader(header http.Header) string {
 	buf := bytes.Buffer{}
 	i := 0
@@ -559,3 +679,18 @@ func printHeader(header http.Header) string {
 	}
 	return buf.String()
 }
+
+// fetchRequestPayload initializes the payload of the request according to
+// the body mode, the max body size is optional in stream mode, and the
+// default one is used for a negative max body size in buffer mode.
+func fetchRequestPayload(req *httpprot.Request, bodyMode string, maxBodySize int64) error {
+	switch bodyMode {
+	case httpprot.BodyModeStream:
+		return req.StreamPayload(maxBodySize)
+	case httpprot.BodyModeBuffer:
+		if maxBodySize < 0 {
+			maxBodySize = 0
+		}
+	}
+	return req.FetchPayload(maxBodySize)
+}
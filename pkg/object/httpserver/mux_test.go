@@ -103,6 +103,33 @@ func TestBuildFailureResponse(t *testing.T) {
 	assert.Equal(http.StatusNotFound, resp.StatusCode())
 }
 
+func TestFetchRequestPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	newRequest := func() *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodPost, "http://www.megaease.com/", strings.NewReader("hello"))
+		req, _ := httpprot.NewRequest(stdr)
+		return req
+	}
+
+	req := newRequest()
+	assert.Nil(fetchRequestPayload(req, "", -1))
+	assert.True(req.IsStream())
+
+	req = newRequest()
+	assert.Nil(fetchRequestPayload(req, httpprot.BodyModeBuffer, -1))
+	assert.False(req.IsStream())
+	assert.Equal("hello", string(req.RawPayload()))
+
+	req = newRequest()
+	assert.Nil(fetchRequestPayload(req, httpprot.BodyModeStream, 0))
+	assert.True(req.IsStream())
+
+	req = newRequest()
+	assert.Equal(httpprot.ErrRequestEntityTooLarge, fetchRequestPayload(req, httpprot.BodyModeStream, 2))
+	assert.Equal(httpprot.ErrRequestEntityTooLarge, fetchRequestPayload(req, httpprot.BodyModeBuffer, 2))
+}
+
 func TestAppendXForwardFor(t *testing.T) {
 	const xForwardedFor = "X-Forwarded-For"
 
@@ -227,6 +254,58 @@ rules:
 	assert.Equal(http.StatusBadRequest, stdw.Code)
 }
 
+func TestServeHTTPRewrites(t *testing.T) {
+	assert := assert.New(t)
+
+	mm := &contexttest.MockedMuxMapper{}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), newMockMetrics(), mm)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+rewrites:
+- match: '^/old/(.*)$'
+  path: /new/$1
+  host: www.megaease.com
+- match: '^/loop$'
+  path: /loop
+  restart: true
+rules:
+- host: www.megaease.com
+  paths:
+  - pathPrefix: /new
+    backend: new-pipeline
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	assert.NotPanics(func() { m.reload(superSpec, mm) })
+
+	var path, host string
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return &contexttest.MockedHandler{
+			MockedHandle: func(ctx *context.Context) string {
+				req := ctx.GetInputRequest().(*httpprot.Request)
+				path, host = req.Path(), req.Host()
+				return ""
+			},
+		}, true
+	}
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.cn/old/abc", http.NoBody)
+	stdw := httptest.NewRecorder()
+	m.ServeHTTP(stdw, stdr)
+	assert.Equal("/new/abc", path)
+	assert.Equal("www.megaease.com", host)
+
+	stdr, _ = http.NewRequest(http.MethodGet, "http://www.megaease.com/loop", http.NoBody)
+	stdw = httptest.NewRecorder()
+	m.ServeHTTP(stdw, stdr)
+	assert.Equal(http.StatusInternalServerError, stdw.Code)
+}
+
 func TestMuxInstanceSearch(t *testing.T) {
 	assert := assert.New(t)
 
@@ -0,0 +1,313 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	rejectReasonConflictingLength = "conflictingLength"
+	rejectReasonAmbiguousHeader   = "ambiguousHeader"
+
+	// maxFramingLineSize is the max size of a line the framing inspector
+	// buffers, it stops inspecting the connection once a line exceeds it,
+	// and such requests are rejected by the HTTP server anyway.
+	maxFramingLineSize = http.DefaultMaxHeaderBytes + 4096
+)
+
+const (
+	framingStateHead = iota
+	framingStateBody
+	framingStateChunkSize
+	framingStateChunkData
+	framingStateChunkDataEnd
+	framingStateTrailer
+	framingStatePassthrough
+)
+
+// singletonHeaders are the headers which must not have multiple values.
+var singletonHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Content-Type",
+	"Content-Encoding",
+}
+
+type (
+	// framingListener is a listener whose connections are inspected by
+	// framingInspector.
+	framingListener struct {
+		net.Listener
+		metrics *metrics
+	}
+
+	// framingConn is a connection whose data is inspected by
+	// framingInspector before it is read by the HTTP server.
+	framingConn struct {
+		net.Conn
+		metrics   *metrics
+		inspector framingInspector
+		// upgraded is set once the server switches the protocol.
+		upgraded atomic.Bool
+		err      error
+	}
+
+	// framingInspector follows the framing of the HTTP/1 requests on a
+	// connection, to find out the raw headers of every request, which
+	// are normalized by the HTTP server before they are visible to the
+	// handlers, e.g. the Content-Length header is removed silently if
+	// there's a Transfer-Encoding header.
+	framingInspector struct {
+		state     int
+		line      []byte
+		remaining int64
+
+		requestLine    bool
+		http10         bool
+		connect        bool
+		contentLengths int
+		contentLength  int64
+		chunked        bool
+		transferCoding bool
+	}
+)
+
+var errConflictingLength = fmt.Errorf("conflicting Content-Length and Transfer-Encoding")
+
+func newFramingListener(l net.Listener, m *metrics) net.Listener {
+	return &framingListener{Listener: l, metrics: m}
+}
+
+// Accept accepts a connection and inspects it.
+func (fl *framingListener) Accept() (net.Conn, error) {
+	conn, err := fl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &framingConn{Conn: conn, metrics: fl.metrics}, nil
+}
+
+// Read reads data from the connection, it fails once the framing of a
+// request conflicts, before the end of the request headers is returned,
+// so the HTTP server responds 400 and closes the connection.
+func (fc *framingConn) Read(p []byte) (int, error) {
+	if fc.err != nil {
+		return 0, fc.err
+	}
+
+	n, err := fc.Conn.Read(p)
+	if n > 0 && !fc.upgraded.Load() {
+		if m, e := fc.inspector.inspect(p[:n]); e != nil {
+			fc.metrics.RejectedRequests.WithLabelValues(rejectReasonConflictingLength).Inc()
+			// the data before the violation is returned first, as the
+			// server ignores the errors before it starts reading a request.
+			fc.err = e
+			if m == 0 {
+				return 0, e
+			}
+			return m, nil
+		}
+	}
+	return n, err
+}
+
+// Write writes data to the connection, and stops the inspection once the
+// protocol is switched.
+func (fc *framingConn) Write(p []byte) (int, error) {
+	if bytes.HasPrefix(p, []byte("HTTP/1.1 101 ")) {
+		fc.upgraded.Store(true)
+	}
+	return fc.Conn.Write(p)
+}
+
+// inspect inspects the data read from the connection, if it fails, it
+// returns the size of the data before the end of the violating request
+// headers.
+func (fi *framingInspector) inspect(p []byte) (int, error) {
+	size := len(p)
+	for len(p) > 0 && fi.state != framingStatePassthrough {
+		if fi.state == framingStateBody || fi.state == framingStateChunkData {
+			n := int64(len(p))
+			if n > fi.remaining {
+				n = fi.remaining
+			}
+			p = p[n:]
+			if fi.remaining -= n; fi.remaining > 0 {
+				continue
+			}
+			if fi.state == framingStateBody {
+				fi.state = framingStateHead
+			} else {
+				fi.state = framingStateChunkDataEnd
+			}
+			continue
+		}
+
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			if len(fi.line)+len(p) > maxFramingLineSize {
+				fi.state = framingStatePassthrough
+				return 0, nil
+			}
+			fi.line = append(fi.line, p...)
+			return 0, nil
+		}
+
+		line := p[:i]
+		p = p[i+1:]
+		if len(fi.line) > 0 {
+			fi.line = append(fi.line, line...)
+			line = fi.line
+		}
+		err := fi.handleLine(bytes.TrimSuffix(line, []byte("\r")))
+		fi.line = fi.line[:0]
+		if err != nil {
+			return size - len(p) - 1, err
+		}
+	}
+	return 0, nil
+}
+
+// handleLine handles a line of the request headers or the chunked body.
+func (fi *framingInspector) handleLine(line []byte) error {
+	switch fi.state {
+	case framingStateHead:
+		return fi.handleHeadLine(line)
+
+	case framingStateChunkSize:
+		if i := bytes.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		size, err := strconv.ParseInt(string(bytes.TrimSpace(line)), 16, 64)
+		if err != nil || size < 0 {
+			fi.state = framingStatePassthrough
+		} else if size == 0 {
+			fi.state = framingStateTrailer
+		} else {
+			fi.state, fi.remaining = framingStateChunkData, size
+		}
+
+	case framingStateChunkDataEnd:
+		if len(line) > 0 {
+			fi.state = framingStatePassthrough
+		} else {
+			fi.state = framingStateChunkSize
+		}
+
+	case framingStateTrailer:
+		if len(line) == 0 {
+			fi.state = framingStateHead
+		}
+	}
+	return nil
+}
+
+// handleHeadLine handles a line of the request line and headers.
+func (fi *framingInspector) handleHeadLine(line []byte) error {
+	if !fi.requestLine {
+		// the blank lines before the request line are ignored.
+		if len(line) == 0 {
+			return nil
+		}
+		// HTTP/2 with prior knowledge.
+		if bytes.HasPrefix(line, []byte("PRI * HTTP/2.0")) {
+			fi.state = framingStatePassthrough
+			return nil
+		}
+		*fi = framingInspector{line: fi.line, requestLine: true}
+		fi.http10 = bytes.HasSuffix(line, []byte("HTTP/1.0"))
+		fi.connect = bytes.HasPrefix(line, []byte(http.MethodConnect+" "))
+		return nil
+	}
+
+	if len(line) > 0 {
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok {
+			return nil
+		}
+		value = bytes.TrimSpace(value)
+		switch strings.ToLower(string(name)) {
+		case "content-length":
+			fi.contentLengths++
+			fi.contentLength, _ = strconv.ParseInt(string(value), 10, 64)
+		case "transfer-encoding":
+			fi.transferCoding = true
+			fi.chunked = bytes.HasSuffix(bytes.ToLower(value), []byte("chunked"))
+		}
+		return nil
+	}
+
+	// the end of the headers.
+	fi.requestLine = false
+	if fi.contentLengths > 1 || (fi.contentLengths > 0 && fi.transferCoding) {
+		return errConflictingLength
+	}
+
+	switch {
+	case fi.connect:
+		// the data after the headers is not HTTP anymore.
+		fi.state = framingStatePassthrough
+	case fi.chunked && !fi.http10:
+		// Transfer-Encoding is ignored in HTTP/1.0.
+		fi.state = framingStateChunkSize
+	case fi.contentLength > 0:
+		fi.state, fi.remaining = framingStateBody, fi.contentLength
+	}
+	return nil
+}
+
+// normalizePath removes the dot-segments and merges the duplicate slashes
+// of the path, the trailing slash is kept.
+func normalizePath(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		return p
+	}
+
+	cleaned := path.Clean(p)
+	if cleaned == "/" {
+		return cleaned
+	}
+	if strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..") {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// ambiguousHeader returns the name of the first ambiguous header, which
+// contains underscores, or is a singleton header with multiple values.
+func ambiguousHeader(h http.Header) string {
+	for k := range h {
+		if strings.IndexByte(k, '_') >= 0 {
+			return k
+		}
+	}
+	for _, k := range singletonHeaders {
+		if len(h[k]) > 1 {
+			return k
+		}
+	}
+	return ""
+}
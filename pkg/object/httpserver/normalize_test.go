@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context/contexttest"
+	"github.com/megaease/easegress/v2/pkg/option"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+func TestNormalizePath(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := map[string]string{
+		"/":               "/",
+		"//":              "/",
+		"/a//b":           "/a/b",
+		"/a/./b/":         "/a/b/",
+		"/a/b/..":         "/a/",
+		"/a/b/../../../c": "/c",
+		"/a/.":            "/a/",
+		"*":               "*",
+	}
+	for p, expected := range cases {
+		assert.Equal(expected, normalizePath(p), p)
+	}
+}
+
+func TestAmbiguousHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	h := http.Header{}
+	h.Add("X-Real-Ip", "192.168.1.1")
+	h.Add("Accept", "text/html")
+	h.Add("Accept", "application/json")
+	assert.Equal("", ambiguousHeader(h))
+
+	h.Add("Authorization", "a")
+	h.Add("Authorization", "b")
+	assert.Equal("Authorization", ambiguousHeader(h))
+
+	h = http.Header{"X_real_ip": []string{"192.168.1.1"}}
+	assert.Equal("X_real_ip", ambiguousHeader(h))
+}
+
+func TestFramingInspector(t *testing.T) {
+	assert := assert.New(t)
+
+	inspect := func(data string, pieceSize int) error {
+		fi := &framingInspector{}
+		for len(data) > 0 {
+			n := pieceSize
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := fi.inspect([]byte(data[:n])); err != nil {
+				return err
+			}
+			data = data[n:]
+		}
+		return nil
+	}
+
+	valid := "POST /a HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello" +
+		"POST /b HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5;ext=1\r\nhello\r\n0\r\nX-Trailer: 1\r\n\r\n" +
+		"GET /c HTTP/1.1\r\nHost: a\r\n\r\n"
+	// the body looks like headers, but it is not inspected.
+	smuggledBody := "POST /a HTTP/1.1\r\nContent-Length: 55\r\n\r\n" +
+		"GET /b HTTP/1.1\r\nContent-Length: 1\r\nTransfer-Encoding: chunked\r\n\r\n"
+	conflicting := "GET /c HTTP/1.1\r\nHost: a\r\n\r\n" +
+		"POST /a HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"
+	multiple := "POST /a HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello"
+	smuggled := "POST /b HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"0\r\n\r\n" +
+		"POST /a HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n"
+
+	for _, size := range []int{1, 7, 4096} {
+		assert.Nil(inspect(valid, size))
+		assert.Nil(inspect(smuggledBody, size))
+		assert.Equal(errConflictingLength, inspect(conflicting, size))
+		assert.Equal(errConflictingLength, inspect(multiple, size))
+		assert.Equal(errConflictingLength, inspect(smuggled, size))
+	}
+
+	// the data before the end of the violating headers is returned.
+	head := "POST /a HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n"
+	n, err := (&framingInspector{}).inspect([]byte(head + "0\r\n\r\n"))
+	assert.Equal(errConflictingLength, err)
+	assert.Equal(len(head)-1, n)
+
+	// HTTP/2 with prior knowledge is not inspected.
+	assert.Nil(inspect("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\nContent-Length: 1\r\nTransfer-Encoding: chunked\r\n\r\n", 4096))
+}
+
+func TestRequestNormalization(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(fmt.Sprintf(`
+kind: HTTPServer
+name: test
+address: 127.0.0.1
+port: %d
+keepAlive: true
+https: false
+normalization:
+  rejectConflictingLength: true
+  normalizePath: true
+  rejectAmbiguousHeaders: true
+rules:
+- paths:
+  - path: /api/users
+    backend: users
+`, port))
+	assert.NoError(err)
+
+	svr := &HTTPServer{}
+	svr.Init(superSpec, &contexttest.MockedMuxMapper{})
+	defer svr.Close()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	var conn net.Conn
+	assert.Eventually(func() bool {
+		conn, err = net.Dial("tcp", addr)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	send := func(raw string) *http.Response {
+		_, err := conn.Write([]byte(raw))
+		assert.NoError(err)
+		resp, err := http.ReadResponse(r, nil)
+		assert.NoError(err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// the path is normalized, and the backend is not found by the mock mapper.
+	resp := send("GET /api/./public/..//users HTTP/1.1\r\nHost: a\r\n\r\n")
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+
+	resp = send("GET /api/users HTTP/1.1\r\nHost: a\r\nX_Real_IP: 1.1.1.1\r\n\r\n")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	resp = send("POST /api/users HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.True(resp.Close || strings.EqualFold(resp.Header.Get("Connection"), "close"))
+}
+
+func TestNormalizationValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Port:          10080,
+		HTTPS:         true,
+		Normalization: &NormalizationSpec{RejectConflictingLength: true},
+	}
+	err := spec.Validate()
+	assert.ErrorContains(err, "rejectConflictingLength")
+
+	spec.HTTPS = false
+	assert.NoError(spec.Validate())
+}
@@ -58,6 +58,10 @@ type (
 		GetBackend() string
 		// GetClientMaxBodySize is used to get the clientMaxBodySize corresponding to the route.
 		GetClientMaxBodySize() int64
+		// GetBodyMode is used to get the mode of handling the request body corresponding to the route.
+		GetBodyMode() string
+		// GetEventStream is used to get the spec of Server-Sent Events responses corresponding to the route.
+		GetEventStream() *EventStream
 
 		// NOTE: Currently we only support path information in readonly.
 		// Without further requirements, we choose not to expose too much information.
@@ -23,6 +23,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/util/ipfilter"
@@ -72,16 +73,44 @@ type Path struct {
 	Methods           []string       `json:"methods,omitempty" jsonschema:"uniqueItems=true,format=httpmethod-array"`
 	Backend           string         `json:"backend" jsonschema:"required"`
 	ClientMaxBodySize int64          `json:"clientMaxBodySize,omitempty"`
+	BodyMode          string         `json:"bodyMode,omitempty" jsonschema:"enum=,enum=buffer,enum=stream"`
 	Headers           Headers        `json:"headers,omitempty"`
 	Queries           Queries        `json:"queries,omitempty"`
 	MatchAllHeader    bool           `json:"matchAllHeader,omitempty"`
 	MatchAllQuery     bool           `json:"matchAllQuery,omitempty"`
+	EventStream       *EventStream   `json:"eventStream,omitempty"`
 
 	ipFilter             *ipfilter.IPFilter
 	method               MethodType
 	cacheable, matchable bool
 }
 
+// EventStream is the spec of sending Server-Sent Events responses.
+type EventStream struct {
+	// HeartbeatInterval is the interval of the comment lines sent to the
+	// clients when no event is received from the backend, which keeps the
+	// connections through proxies with idle timeouts.
+	HeartbeatInterval string `json:"heartbeatInterval,omitempty" jsonschema:"format=duration"`
+	// IdleTimeout closes the response if no event is received from the
+	// backend in the duration.
+	IdleTimeout string `json:"idleTimeout,omitempty" jsonschema:"format=duration"`
+}
+
+// Validate validates EventStream.
+func (es *EventStream) Validate() error {
+	if es.HeartbeatInterval != "" {
+		if _, err := time.ParseDuration(es.HeartbeatInterval); err != nil {
+			return fmt.Errorf("invalid heartbeatInterval %s: %v", es.HeartbeatInterval, err)
+		}
+	}
+	if es.IdleTimeout != "" {
+		if _, err := time.ParseDuration(es.IdleTimeout); err != nil {
+			return fmt.Errorf("invalid idleTimeout %s: %v", es.IdleTimeout, err)
+		}
+	}
+	return nil
+}
+
 // Headers represents the set of headers.
 type Headers []*Header
 
@@ -222,6 +251,9 @@ func (p *Path) Validate() error {
 		return fmt.Errorf("rewriteTarget is specified but path is empty")
 	}
 
+	if p.EventStream != nil {
+		return p.EventStream.Validate()
+	}
 	return nil
 }
 
@@ -275,6 +307,16 @@ func (p *Path) GetClientMaxBodySize() int64 {
 	return p.ClientMaxBodySize
 }
 
+// GetBodyMode is used to get the mode of handling the request body corresponding to the route.
+func (p *Path) GetBodyMode() string {
+	return p.BodyMode
+}
+
+// GetEventStream returns the spec of Server-Sent Events responses of the route.
+func (p *Path) GetEventStream() *EventStream {
+	return p.EventStream
+}
+
 // GetExactPath returns the exact path of the route.
 func (p *Path) GetExactPath() string {
 	return p.Path
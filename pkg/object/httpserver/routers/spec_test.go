@@ -199,6 +199,7 @@ func TestPathInit(t *testing.T) {
 		},
 		Backend:           "foo",
 		ClientMaxBodySize: 1000,
+		BodyMode:          "stream",
 	}
 
 	path.Init(nil)
@@ -209,6 +210,7 @@ func TestPathInit(t *testing.T) {
 	assert.NotNil(path.Queries[0].re)
 	assert.Equal("foo", path.GetBackend())
 	assert.EqualValues(1000, path.GetClientMaxBodySize())
+	assert.Equal("stream", path.GetBodyMode())
 
 	path.Methods = []string{"GET", "POST"}
 	path.Init(nil)
@@ -235,6 +237,17 @@ func TestPathValidate(t *testing.T) {
 	p.PathRegexp = ""
 	p.RewriteTarget = ""
 	assert.NoError(t, p.Validate())
+
+	p.EventStream = &EventStream{HeartbeatInterval: "15s", IdleTimeout: "5m"}
+	assert.NoError(t, p.Validate())
+	assert.Equal(t, p.EventStream, p.GetEventStream())
+
+	p.EventStream.HeartbeatInterval = "abc"
+	assert.Error(t, p.Validate())
+
+	p.EventStream.HeartbeatInterval = ""
+	p.EventStream.IdleTimeout = "abc"
+	assert.Error(t, p.Validate())
 }
 
 func TestPathInit2(t *testing.T) {
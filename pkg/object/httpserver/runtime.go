@@ -19,9 +19,11 @@ package httpserver
 
 import (
 	"bytes"
-	stdcontext "context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"reflect"
@@ -30,6 +32,8 @@ import (
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/graceupdate"
@@ -40,11 +44,20 @@ import (
 	"github.com/megaease/easegress/v2/pkg/util/filterwriter"
 	"github.com/megaease/easegress/v2/pkg/util/limitlistener"
 	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+	"github.com/megaease/easegress/v2/pkg/util/protosniff"
+	"github.com/megaease/easegress/v2/pkg/util/proxyprotocol"
+	"github.com/megaease/easegress/v2/pkg/util/tlssni"
+	"github.com/megaease/easegress/v2/pkg/util/unixsocket"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
 	defaultKeepAliveTimeout = 60 * time.Second
+	defaultAltSvcMaxAge     = 24 * time.Hour
+
+	// defaultTCPDialTimeout is the default timeout to dial the TCP
+	// backends of the forwarded connections.
+	defaultTCPDialTimeout = 10 * time.Second
 
 	checkFailedTimeout = 10 * time.Second
 
@@ -73,7 +86,8 @@ type (
 		nextSuperSpec *supervisor.Spec
 		muxMapper     context.MuxMapper
 	}
-	eventClose struct{ done chan struct{} }
+	eventClose        struct{ done chan struct{} }
+	eventCertsChanged struct{}
 
 	runtime struct {
 		superSpec *supervisor.Spec
@@ -84,6 +98,11 @@ type (
 		roundNum  uint64
 		eventChan chan interface{}
 
+		// tlsConf is the latest TLS config, which is used by the servers
+		// for the new connections.
+		tlsConf     atomic.Value // *tls.Config
+		certWatcher *certWatcher
+
 		// status
 		state atomic.Value // stateType
 		err   atomic.Value // error
@@ -92,6 +111,12 @@ type (
 		topN          *httpstat.TopN
 		metrics       *metrics
 		limitListener *limitlistener.LimitListener
+		limiter       *connLimiter
+
+		// drainTimeout is the drain timeout of the latest spec.
+		drainTimeout time.Duration
+		// drains are the drains of the closed servers in progress.
+		drains drainSet
 	}
 
 	// Status contains all status generated by runtime, for displaying to users.
@@ -104,6 +129,10 @@ type (
 
 		*httpstat.Status
 		TopN []*httpstat.Item `json:"topN"`
+
+		// Drains are the drains of the connections of the closed servers
+		// in progress, after the server is restarted or stopped.
+		Drains []*DrainStatus `json:"drains,omitempty"`
 	}
 )
 
@@ -115,6 +144,7 @@ func newRuntime(superSpec *supervisor.Spec, muxMapper context.MuxMapper) *runtim
 		topN:      httpstat.NewTopN(topNum),
 	}
 
+	r.drainTimeout = defaultDrainTimeout
 	r.metrics = r.newMetrics(r.superSpec.Name())
 	r.mux = newMux(r.httpStat, r.topN, r.metrics, muxMapper)
 	r.setState(stateNil)
@@ -145,6 +175,7 @@ func (r *runtime) Status() *Status {
 		Error:  r.getError().Error(),
 		Status: status,
 		TopN:   r.topN.Status(),
+		Drains: r.drains.status(),
 	}
 }
 
@@ -158,6 +189,8 @@ func (r *runtime) fsm() {
 			r.handleEventServeFailed(e)
 		case *eventReload:
 			r.handleEventReload(e)
+		case *eventCertsChanged:
+			r.handleEventCertsChanged(e)
 		case *eventClose:
 			r.handleEventClose(e)
 			// NOTE: We don't close hs.eventChan,
@@ -181,6 +214,11 @@ func (r *runtime) reload(nextSuperSpec *supervisor.Spec, muxMapper context.MuxMa
 		r.limitListener.SetMaxConnection(nextSpec.MaxConnections)
 	}
 
+	if nextSpec != nil {
+		r.drainTimeout = nextSpec.drainTimeout()
+		r.reloadCerts(nextSpec)
+	}
+
 	// NOTE: Due to the mechanism of supervisor,
 	// nextSpec must not be nil, just defensive programming here.
 	switch {
@@ -242,26 +280,106 @@ func (r *runtime) needRestartServer(nextSpec *Spec) bool {
 	x.Tracing, y.Tracing = nil, nil
 	x.IPFilter, y.IPFilter = nil, nil
 	x.Rules, y.Rules = nil, nil
+	x.DrainTimeout, y.DrainTimeout = "", ""
+
+	// The certificates are swapped without restarting the server.
+	if x.HTTPS && y.HTTPS {
+		clearTLSOptions(&x)
+		clearTLSOptions(&y)
+	}
 
 	// The update of rules need not to shutdown server.
 	return !reflect.DeepEqual(x, y)
 }
 
+// clearTLSOptions clears the options which only affect the TLS config.
+func clearTLSOptions(spec *Spec) {
+	spec.AutoCert = false
+	spec.CaCertBase64 = ""
+	spec.ClientAuth = nil
+	spec.CertBase64, spec.KeyBase64 = "", ""
+	spec.Certs, spec.Keys = nil, nil
+	spec.TLSHosts = nil
+	spec.CertSources = nil
+	spec.CertReloadInterval = ""
+	spec.CertExpiryWarning = ""
+}
+
+// reloadCerts restarts the certificate watcher and updates the TLS config
+// with the spec.
+func (r *runtime) reloadCerts(spec *Spec) {
+	if r.certWatcher != nil {
+		r.certWatcher.close()
+		r.certWatcher = nil
+	}
+	if !spec.HTTPS {
+		return
+	}
+
+	r.certWatcher = newCertWatcher(r.superSpec, spec, r.metrics.CertificateExpiry, func() {
+		r.eventChan <- &eventCertsChanged{}
+	})
+	r.updateTLSConfig(spec)
+}
+
+// updateTLSConfig builds the TLS config, which takes effect on the new
+// connections, the existing connections are not affected. The current
+// config is kept if the building fails.
+func (r *runtime) updateTLSConfig(spec *Spec) {
+	var certs []tls.Certificate
+	if r.certWatcher != nil {
+		certs = r.certWatcher.certificates()
+	}
+
+	conf, err := spec.tlsConfigWithCerts(certs)
+	if err != nil {
+		logger.Errorf("httpserver %s: build tls config failed, keep using the current one: %v",
+			r.superSpec.Name(), err)
+		return
+	}
+	// The protocols added by the servers only apply to the config of
+	// serverTLSConfig.
+	conf.NextProtos = []string{"h2", "http/1.1", "acme-tls/1"}
+	r.tlsConf.Store(conf)
+}
+
+// serverTLSConfig returns the TLS config of the servers, which resolves
+// to the latest config of the runtime for every handshake.
+func (r *runtime) serverTLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+			conf, _ := r.tlsConf.Load().(*tls.Config)
+			if conf == nil {
+				return nil, fmt.Errorf("tls config of httpserver %s is not ready", r.superSpec.Name())
+			}
+			if conf.GetConfigForClient != nil {
+				hostConf, err := conf.GetConfigForClient(chi)
+				if err != nil || hostConf != nil {
+					return hostConf, err
+				}
+			}
+			return conf, nil
+		},
+	}
+}
+
 func (r *runtime) startServer() {
 	r.roundNum++
 	r.setState(stateRunning)
 	r.setError(nil)
 
-	if r.spec.HTTP3 {
-		r.startHTTP3Server()
-	} else {
+	if !r.spec.HTTP3 {
+		r.startHTTP1And2Server()
+		return
+	}
+
+	r.startHTTP3Server()
+	if r.spec.AltSvc != nil {
 		r.startHTTP1And2Server()
 	}
 }
 
 func (r *runtime) startHTTP3Server() {
-	tlsConfig, _ := r.spec.tlsConfig()
-
 	keepAliveTimeout := defaultKeepAliveTimeout
 	if r.spec.KeepAliveTimeout != "" {
 		keepAliveTimeout, _ = time.ParseDuration(r.spec.KeepAliveTimeout)
@@ -270,7 +388,7 @@ func (r *runtime) startHTTP3Server() {
 	r.server3 = &http3.Server{
 		Addr:      fmt.Sprintf("%s:%d", r.spec.Address, r.spec.Port),
 		Handler:   r.mux,
-		TLSConfig: tlsConfig,
+		TLSConfig: r.serverTLSConfig(),
 		QuicConfig: &quic.Config{
 			MaxIdleTimeout: keepAliveTimeout,
 		},
@@ -278,6 +396,9 @@ func (r *runtime) startHTTP3Server() {
 	if r.spec.KeepAlive {
 		r.server3.QuicConfig.KeepAlivePeriod = keepAliveTimeout
 	}
+	if r.spec.MaxConcurrentStreams > 0 {
+		r.server3.QuicConfig.MaxIncomingStreams = int64(r.spec.MaxConcurrentStreams)
+	}
 
 	// to avoid data race
 	roundNum := r.roundNum
@@ -302,15 +423,30 @@ func (r *runtime) startHTTP1And2Server() {
 	fw := filterwriter.New(os.Stderr, func(p []byte) bool {
 		return !bytes.Contains(p, []byte("TLS handshake error"))
 	})
+	var handler http.Handler = r.mux
+	if r.spec.HTTP3 {
+		// Advertise HTTP/3 to the clients connected over TCP.
+		altSvc := r.spec.altSvcHeader()
+		handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Alt-Svc", altSvc)
+			r.mux.ServeHTTP(w, req)
+		})
+	}
+
+	limiter := newConnLimiter(r.spec, r.metrics)
+	handler = limiter.handler(handler)
+	r.limiter = limiter
+
 	r.server = &http.Server{
 		Addr:        fmt.Sprintf("%s:%d", r.spec.Address, r.spec.Port),
-		Handler:     r.mux,
+		Handler:     handler,
 		IdleTimeout: keepAliveTimeout,
 		ErrorLog:    log.New(fw, "", log.LstdFlags),
+		ConnContext: limiter.connContext,
 	}
 	r.server.SetKeepAlivesEnabled(r.spec.KeepAlive)
 
-	listener, err := gnet.Listen("tcp", fmt.Sprintf("%s:%d", r.spec.Address, r.spec.Port))
+	listener, err := r.listen()
 	if err != nil {
 		logger.Errorf("httpserver %s failed to listen: %v", r.superSpec.Name(), err)
 		r.setState(stateFailed)
@@ -324,15 +460,45 @@ func (r *runtime) startHTTP1And2Server() {
 	spec := r.spec
 	roundNum := r.roundNum
 	srv := r.server
+	if spec.HTTPS {
+		srv.TLSConfig = r.serverTLSConfig()
+		if spec.MaxConcurrentStreams > 0 {
+			http2.ConfigureServer(srv, &http2.Server{
+				IdleTimeout:          keepAliveTimeout,
+				MaxConcurrentStreams: spec.MaxConcurrentStreams,
+			})
+		}
+	}
+
+	var serveListener net.Listener = limitListener
+	if spec.ProxyProtocol {
+		serveListener = proxyprotocol.NewListener(serveListener, proxyprotocol.DefaultHeaderTimeout)
+	}
+	if len(spec.TLSPassthrough) > 0 {
+		serveListener = r.newPassthroughListener(serveListener, spec.TLSPassthrough)
+	}
+	if spec.ProtocolDetection != nil {
+		serveListener = r.newSniffListener(serveListener, spec.ProtocolDetection)
+		h2s := &http2.Server{
+			IdleTimeout:          keepAliveTimeout,
+			MaxConcurrentStreams: spec.MaxConcurrentStreams,
+		}
+		// Configure the server with h2s, so that the HTTP/2 connections
+		// get GOAWAY once the server is shut down.
+		http2.ConfigureServer(srv, h2s)
+		srv.Handler = h2c.NewHandler(handler, h2s)
+	}
+	if spec.Normalization != nil && spec.Normalization.RejectConflictingLength {
+		serveListener = newFramingListener(serveListener, r.metrics)
+	}
+	serveListener = limiter.newListener(serveListener)
 
 	go func() {
 		var err error
 		if spec.HTTPS {
-			tlsConfig, _ := spec.tlsConfig()
-			srv.TLSConfig = tlsConfig
-			err = srv.ServeTLS(limitListener, "", "")
+			err = srv.ServeTLS(serveListener, "", "")
 		} else {
-			err = srv.Serve(limitListener)
+			err = srv.Serve(serveListener)
 		}
 		if err != http.ErrServerClosed {
 			r.eventChan <- &eventServeFailed{
@@ -343,25 +509,134 @@ func (r *runtime) startHTTP1And2Server() {
 	}()
 }
 
-func (r *runtime) closeServer() {
+// listen listens on the TCP port, or the unix socket if it is set.
+func (r *runtime) listen() (net.Listener, error) {
+	if r.spec.UnixSocket == "" {
+		return gnet.Listen("tcp", fmt.Sprintf("%s:%d", r.spec.Address, r.spec.Port))
+	}
+
+	path := r.spec.UnixSocket
+	if err := unixsocket.RemoveStale(path); err != nil {
+		return nil, err
+	}
+	l, err := gnet.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// The socket may be inherited by the new process on graceful update,
+	// so it is not removed on close, the stale one is removed on listening.
+	if ul, ok := l.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	return l, nil
+}
+
+// newSniffListener creates a listener which serves HTTP/1 and HTTP/2 connections,
+// and forwards the other connections to the TCP backend.
+func (r *runtime) newSniffListener(l net.Listener, spec *ProtocolDetectionSpec) net.Listener {
+	timeout := protosniff.DefaultTimeout
+	if spec.SniffTimeout != "" {
+		timeout, _ = time.ParseDuration(spec.SniffTimeout)
+	}
+	dialTimeout := defaultTCPDialTimeout
+	if spec.DialTimeout != "" {
+		dialTimeout, _ = time.ParseDuration(spec.DialTimeout)
+	}
+
+	name := r.superSpec.Name()
+	backend := spec.TCPBackend
+
+	return protosniff.NewListener(l, timeout, func(conn *protosniff.Conn) {
+		if backend == "" {
+			logger.Debugf("httpserver %s: close %s connection from %s without tcp backend",
+				name, conn.Protocol(), conn.RemoteAddr())
+			conn.Close()
+			return
+		}
+		forwardTCP(name, conn, backend, dialTimeout)
+	})
+}
+
+// newPassthroughListener creates a listener which forwards the TLS
+// connections of the passthrough hosts to their backends, the other
+// connections are served by the server.
+func (r *runtime) newPassthroughListener(l net.Listener, passthrough []*TLSPassthroughSpec) net.Listener {
+	name := r.superSpec.Name()
+
+	return tlssni.NewListener(l, tlssni.DefaultTimeout, func(conn *tlssni.Conn) bool {
+		for _, p := range passthrough {
+			if tlssni.MatchHost(p.Hosts, conn.ServerName()) {
+				go forwardTCP(name, conn, p.Backend, defaultTCPDialTimeout)
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// forwardTCP forwards the data of conn to the TCP backend as is, conn is
+// closed once both directions finish.
+func forwardTCP(name string, conn net.Conn, backend string, dialTimeout time.Duration) {
+	defer conn.Close()
+
+	upstream, err := net.DialTimeout("tcp", backend, dialTimeout)
+	if err != nil {
+		logger.Errorf("httpserver %s: dial tcp backend %s failed: %v", name, backend, err)
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(upstream, conn)
+		if c, ok := upstream.(*net.TCPConn); ok {
+			c.CloseWrite()
+		}
+		close(done)
+	}()
+	io.Copy(conn, upstream)
+	// Unblock the copying from the client.
+	conn.Close()
+	<-done
+}
+
+// closeServer closes the servers, it returns once the listeners are
+// closed, and the returned channel is closed once the connections of the
+// HTTP/1 and HTTP/2 server are drained.
+func (r *runtime) closeServer() <-chan struct{} {
 	if r.server3 != nil {
 		err := r.server3.Close()
 		if err != nil {
 			logger.Warnf("shutdown http3 server %s failed: %v", r.superSpec.Name(), err)
 		}
-		return
+		r.server3 = nil
 	}
 
-	if r.server != nil {
-		// NOTE: It's safe to shutdown serve failed server.
-		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 30*time.Second)
-		defer cancel()
-		err := r.server.Shutdown(ctx)
-		if err != nil {
-			logger.Warnf("shutdown http1/2 server %s failed: %v",
-				r.superSpec.Name(), err)
-		}
+	done := make(chan struct{})
+	if r.server == nil {
+		close(done)
+		return done
 	}
+
+	// NOTE: It's safe to shutdown serve failed server.
+	now := time.Now()
+	d := &drain{
+		name:     r.superSpec.Name(),
+		server:   r.server,
+		limiter:  r.limiter,
+		startAt:  now,
+		deadline: now.Add(r.drainTimeout),
+	}
+	r.server, r.limiter = nil, nil
+
+	r.drains.add(d)
+	drained := d.start()
+	go func() {
+		<-drained
+		r.drains.remove(d)
+		close(done)
+	}()
+	return done
 }
 
 func (r *runtime) checkFailed(timeout time.Duration) {
@@ -396,9 +671,20 @@ func (r *runtime) handleEventReload(e *eventReload) {
 	r.reload(e.nextSuperSpec, e.muxMapper)
 }
 
+func (r *runtime) handleEventCertsChanged(e *eventCertsChanged) {
+	if r.spec != nil && r.spec.HTTPS {
+		r.updateTLSConfig(r.spec)
+	}
+}
+
 func (r *runtime) handleEventClose(e *eventClose) {
 	r.setState(stateClosed)
-	r.closeServer()
+	if r.certWatcher != nil {
+		r.certWatcher.close()
+		r.certWatcher = nil
+	}
+	// wait for the drain, so that the in-flight requests are handled.
+	<-r.closeServer()
 	r.mux.close()
 	close(e.done)
 }
@@ -460,6 +746,13 @@ type (
 		P999          *prometheus.GaugeVec
 		ReqSize       *prometheus.GaugeVec
 		RespSize      *prometheus.GaugeVec
+
+		CertificateExpiry *prometheus.GaugeVec
+		ActiveConnections *prometheus.GaugeVec
+		RejectedRequests  *prometheus.CounterVec
+
+		NormalizedRequests *prometheus.CounterVec
+		DroppedAccessLogs  *prometheus.CounterVec
 	}
 )
 
@@ -619,6 +912,26 @@ func (r *runtime) newMetrics(name string) *metrics {
 			"httpserver_resp_size",
 			"The total size of the http responses in this statistic window",
 			httpserverLabels[:5]).MustCurryWith(commonLabels),
+		CertificateExpiry: prometheushelper.NewGauge(
+			"httpserver_certificate_expiry_timestamp_seconds",
+			"the expiry time of the certificates in unix seconds",
+			append(httpserverLabels[:5:5], "certificate")).MustCurryWith(commonLabels),
+		ActiveConnections: prometheushelper.NewGauge(
+			"httpserver_active_connections",
+			"the count of the open connections",
+			httpserverLabels[:5]).MustCurryWith(commonLabels),
+		RejectedRequests: prometheushelper.NewCounter(
+			"httpserver_rejected_requests",
+			"the total count of the requests rejected by the connection limits or the normalization",
+			append(httpserverLabels[:5:5], "reason")).MustCurryWith(commonLabels),
+		NormalizedRequests: prometheushelper.NewCounter(
+			"httpserver_normalized_requests",
+			"the total count of the requests whose paths are normalized",
+			httpserverLabels[:5]).MustCurryWith(commonLabels),
+		DroppedAccessLogs: prometheushelper.NewCounter(
+			"httpserver_dropped_access_logs",
+			"the total count of the access logs dropped by the queue overflow or the write failures",
+			append(httpserverLabels[:5:5], "reason")).MustCurryWith(commonLabels),
 	}
 }
 
@@ -22,11 +22,15 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"net"
+	"time"
 
 	"github.com/megaease/easegress/v2/pkg/object/autocertmanager"
 	"github.com/megaease/easegress/v2/pkg/object/httpserver/routers"
 	"github.com/megaease/easegress/v2/pkg/tracing"
 	"github.com/megaease/easegress/v2/pkg/util/ipfilter"
+	"github.com/megaease/easegress/v2/pkg/util/tlssni"
+	"github.com/megaease/easegress/v2/pkg/util/urlrewriter"
 )
 
 type (
@@ -37,38 +41,271 @@ type (
 		HTTPS             bool          `json:"https" jsonschema:"required"`
 		AutoCert          bool          `json:"autoCert,omitempty"`
 		XForwardedFor     bool          `json:"xForwardedFor,omitempty"`
+		ProxyProtocol     bool          `json:"proxyProtocol,omitempty"`
 		Address           string        `json:"address,omitempty"`
-		Port              uint16        `json:"port" jsonschema:"required,minimum=1"`
+		Port              uint16        `json:"port"`
+		UnixSocket        string        `json:"unixSocket,omitempty"`
 		ClientMaxBodySize int64         `json:"clientMaxBodySize,omitempty"`
+		BodyMode          string        `json:"bodyMode,omitempty" jsonschema:"enum=,enum=buffer,enum=stream"`
 		KeepAliveTimeout  string        `json:"keepAliveTimeout,omitempty" jsonschema:"format=duration"`
 		MaxConnections    uint32        `json:"maxConnections,omitempty" jsonschema:"minimum=1"`
 		CacheSize         uint32        `json:"cacheSize,omitempty"`
 		Tracing           *tracing.Spec `json:"tracing,omitempty"`
 		CaCertBase64      string        `json:"caCertBase64,omitempty" jsonschema:"format=base64"`
+		// ClientAuth is the verification of client certificates in addition
+		// to CaCertBase64.
+		ClientAuth *ClientAuthSpec `json:"clientAuth,omitempty"`
+		// ClientCertHeader is the header forwarding the verified client
+		// certificate to the backends, no header is forwarded if it is empty.
+		ClientCertHeader string `json:"clientCertHeader,omitempty"`
+
+		// MaxConnectionsPerIP limits the connections from a client IP, the
+		// requests on the connections exceeding it get 429 responses.
+		MaxConnectionsPerIP uint32 `json:"maxConnectionsPerIP,omitempty"`
+		// MaxConcurrentStreams limits the concurrent streams of an HTTP/2
+		// connection, the default of HTTP/2 is used if it is zero.
+		MaxConcurrentStreams uint32 `json:"maxConcurrentStreams,omitempty"`
+		// MaxRequestsPerConnection closes an HTTP/1 connection once it has
+		// served the requests.
+		MaxRequestsPerConnection uint32 `json:"maxRequestsPerConnection,omitempty"`
+		// Normalization is the strict normalization of the requests, which
+		// defends against request smuggling and route bypassing.
+		Normalization *NormalizationSpec `json:"normalization,omitempty"`
+		// DrainTimeout is the max time to wait for the in-flight requests
+		// once the server is stopped or restarted, the connections are
+		// closed after it.
+		DrainTimeout string `json:"drainTimeout,omitempty" jsonschema:"format=duration"`
 
 		// Support multiple certs, preserve the certbase64 and keybase64
 		// for backward compatibility
 		CertBase64 string `json:"certBase64,omitempty" jsonschema:"format=base64"`
-		KeyBase64  string `json:"keyBase64,omitempty" jsonschema:"format=base64"`
+		KeyBase64  string `json:"keyBase64,omitempty" jsonschema:"format=base64,writeOnly=true"`
 
 		// Certs saved as map, key is domain name, value is cert
 		Certs map[string]string `json:"certs,omitempty"`
 		// Keys saved as map, key is domain name, value is secret
-		Keys map[string]string `json:"keys,omitempty"`
+		Keys map[string]string `json:"keys,omitempty" jsonschema:"writeOnly=true"`
+
+		// TLSHosts are the TLS settings of specific hosts, which are chosen
+		// by the server name in the ClientHello. The other hosts use the
+		// settings above.
+		TLSHosts []*TLSHostSpec `json:"tlsHosts,omitempty"`
+		// TLSPassthrough forwards the TLS connections of specific hosts to
+		// the backends without terminating the TLS.
+		TLSPassthrough []*TLSPassthroughSpec `json:"tlsPassthrough,omitempty"`
+
+		// CertSources are the certificates loaded from files, Kubernetes
+		// secrets or custom data, which are reloaded once changed without
+		// restarting the server.
+		CertSources        []*CertSourceSpec `json:"certSources,omitempty"`
+		CertReloadInterval string            `json:"certReloadInterval,omitempty" jsonschema:"format=duration"`
+		// CertExpiryWarning is how long before the certificates expire
+		// to log warnings.
+		CertExpiryWarning string `json:"certExpiryWarning,omitempty" jsonschema:"format=duration"`
 
 		RouterKind string `json:"routerKind,omitempty" jsonschema:"enum=,enum=Ordered,enum=RadixTree"`
 
-		IPFilter *ipfilter.Spec `json:"ipFilter,omitempty"`
-		Rules    routers.Rules  `json:"rules,omitempty"`
+		IPFilter *ipfilter.Spec      `json:"ipFilter,omitempty"`
+		Rewrites []*urlrewriter.Rule `json:"rewrites,omitempty"`
+		Rules    routers.Rules       `json:"rules,omitempty"`
 
 		GlobalFilter string `json:"globalFilter,omitempty"`
 
-		AccessLogFormat string `json:"accessLogFormat,omitempty"`
+		AccessLogFormat string         `json:"accessLogFormat,omitempty"`
+		AccessLog       *AccessLogSpec `json:"accessLog,omitempty"`
+
+		ProtocolDetection *ProtocolDetectionSpec `json:"protocolDetection,omitempty"`
+
+		// EventStream is the default spec of sending Server-Sent Events
+		// responses, which could be overridden by the paths.
+		EventStream *routers.EventStream `json:"eventStream,omitempty"`
+
+		// AltSvc serves HTTP/1.1 and HTTP/2 over TCP alongside HTTP/3 on the
+		// same port, and advertises HTTP/3 to the clients with the Alt-Svc
+		// header. Only HTTP/3 is served if it is nil.
+		AltSvc *AltSvcSpec `json:"altSvc,omitempty"`
+	}
+
+	// TLSHostSpec describes the TLS settings of hosts.
+	TLSHostSpec struct {
+		// Hosts are the server names, a host could be a wildcard like
+		// *.example.com.
+		Hosts      []string `json:"hosts" jsonschema:"required,minItems=1"`
+		CertBase64 string   `json:"certBase64" jsonschema:"required"`
+		KeyBase64  string   `json:"keyBase64" jsonschema:"required,writeOnly=true"`
+		MinVersion string   `json:"minVersion,omitempty" jsonschema:"enum=,enum=TLS1.0,enum=TLS1.1,enum=TLS1.2,enum=TLS1.3"`
+		MaxVersion string   `json:"maxVersion,omitempty" jsonschema:"enum=,enum=TLS1.0,enum=TLS1.1,enum=TLS1.2,enum=TLS1.3"`
+
+		// CaCertBase64 and ClientAuth override the client certificate
+		// verification of the server.
+		CaCertBase64 string          `json:"caCertBase64,omitempty" jsonschema:"format=base64"`
+		ClientAuth   *ClientAuthSpec `json:"clientAuth,omitempty"`
+	}
+
+	// TLSPassthroughSpec describes the hosts whose TLS connections are
+	// forwarded to the backend as is, the backend terminates the TLS.
+	TLSPassthroughSpec struct {
+		// Hosts are the server names, a host could be a wildcard like
+		// *.example.com.
+		Hosts   []string `json:"hosts" jsonschema:"required,minItems=1"`
+		Backend string   `json:"backend" jsonschema:"required"`
+	}
+
+	// AltSvcSpec describes the advertisement of HTTP/3.
+	AltSvcSpec struct {
+		// MaxAge is how long the clients remember HTTP/3 is available.
+		MaxAge string `json:"maxAge,omitempty" jsonschema:"format=duration"`
+	}
+
+	// ProtocolDetectionSpec describes the protocol detection of accepted connections.
+	// HTTP/1.1 and HTTP/2 with prior knowledge are served by the server, raw TCP
+	// connections are forwarded to TCPBackend, or closed if it is empty.
+	ProtocolDetectionSpec struct {
+		SniffTimeout string `json:"sniffTimeout,omitempty" jsonschema:"format=duration"`
+		TCPBackend   string `json:"tcpBackend,omitempty"`
+		// DialTimeout is the timeout to dial TCPBackend, default is 10s.
+		DialTimeout string `json:"dialTimeout,omitempty" jsonschema:"format=duration"`
+	}
+
+	// NormalizationSpec describes the strict normalization of the requests.
+	NormalizationSpec struct {
+		// RejectConflictingLength rejects the HTTP/1 requests with both the
+		// Content-Length and Transfer-Encoding headers, or multiple
+		// Content-Length headers. It can't be enabled with HTTPS, as the
+		// raw headers are unavailable once TLS is terminated.
+		RejectConflictingLength bool `json:"rejectConflictingLength,omitempty"`
+		// NormalizePath removes the dot-segments and merges the duplicate
+		// slashes of the request paths before route matching.
+		NormalizePath bool `json:"normalizePath,omitempty"`
+		// RejectAmbiguousHeaders rejects the requests with underscores in
+		// header names, or multiple values of a singleton header.
+		RejectAmbiguousHeaders bool `json:"rejectAmbiguousHeaders,omitempty"`
 	}
 )
 
 // Validate validates HTTPServerSpec.
 func (spec *Spec) Validate() error {
+	if spec.UnixSocket == "" && spec.Port == 0 {
+		return fmt.Errorf("port is required if unixSocket is empty")
+	}
+	if spec.UnixSocket != "" && spec.Port != 0 {
+		return fmt.Errorf("port and unixSocket can't be set at the same time")
+	}
+	if spec.UnixSocket != "" && spec.HTTP3 {
+		return fmt.Errorf("unixSocket is not supported when http3 enabled")
+	}
+
+	for i, r := range spec.Rewrites {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("invalid rewrite %d: %v", i, err)
+		}
+	}
+
+	if spec.AccessLog != nil {
+		if err := spec.AccessLog.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if spec.ProtocolDetection != nil {
+		if spec.HTTPS || spec.HTTP3 {
+			return fmt.Errorf("protocol detection is not supported when https or http3 enabled")
+		}
+		if spec.ProtocolDetection.TCPBackend != "" {
+			if _, _, err := net.SplitHostPort(spec.ProtocolDetection.TCPBackend); err != nil {
+				return fmt.Errorf("invalid tcpBackend %s: %v", spec.ProtocolDetection.TCPBackend, err)
+			}
+		}
+	}
+
+	if spec.Normalization != nil && spec.Normalization.RejectConflictingLength && spec.HTTPS {
+		return fmt.Errorf("rejectConflictingLength is not supported when https enabled")
+	}
+
+	if spec.AltSvc != nil {
+		if !spec.HTTP3 {
+			return fmt.Errorf("altSvc is only supported when http3 enabled")
+		}
+		if spec.AltSvc.MaxAge != "" {
+			if _, err := time.ParseDuration(spec.AltSvc.MaxAge); err != nil {
+				return fmt.Errorf("invalid altSvc maxAge %s: %v", spec.AltSvc.MaxAge, err)
+			}
+		}
+	}
+
+	if spec.DrainTimeout != "" {
+		if _, err := time.ParseDuration(spec.DrainTimeout); err != nil {
+			return fmt.Errorf("invalid drainTimeout %s: %v", spec.DrainTimeout, err)
+		}
+	}
+
+	if spec.EventStream != nil {
+		if err := spec.EventStream.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for i, p := range spec.TLSPassthrough {
+		if !spec.HTTPS {
+			return fmt.Errorf("tlsPassthrough is only supported when https enabled")
+		}
+		if spec.HTTP3 && spec.AltSvc == nil {
+			return fmt.Errorf("tlsPassthrough is not supported when only http3 is served")
+		}
+		if len(p.Hosts) == 0 {
+			return fmt.Errorf("tlsPassthrough %d: hosts is empty", i)
+		}
+		if _, _, err := net.SplitHostPort(p.Backend); err != nil {
+			return fmt.Errorf("tlsPassthrough %d: invalid backend %s: %v", i, p.Backend, err)
+		}
+	}
+
+	if spec.ClientAuth != nil {
+		if spec.CaCertBase64 == "" {
+			return fmt.Errorf("clientAuth requires caCertBase64")
+		}
+		if err := spec.ClientAuth.Validate(); err != nil {
+			return err
+		}
+	}
+	for i, h := range spec.TLSHosts {
+		if h.ClientAuth == nil {
+			continue
+		}
+		if h.CaCertBase64 == "" && spec.CaCertBase64 == "" {
+			return fmt.Errorf("tlsHosts %d: clientAuth requires caCertBase64", i)
+		}
+		if err := h.ClientAuth.Validate(); err != nil {
+			return fmt.Errorf("tlsHosts %d: %v", i, err)
+		}
+	}
+
+	names := map[string]bool{}
+	for i, s := range spec.CertSources {
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("certSources %d: %v", i, err)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("certSources %d: duplicated name %s", i, s.Name)
+		}
+		names[s.Name] = true
+	}
+	if spec.CertReloadInterval != "" {
+		d, err := time.ParseDuration(spec.CertReloadInterval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid certReloadInterval %s", spec.CertReloadInterval)
+		}
+	}
+	if spec.CertExpiryWarning != "" {
+		if _, err := time.ParseDuration(spec.CertExpiryWarning); err != nil {
+			return fmt.Errorf("invalid certExpiryWarning %s: %v", spec.CertExpiryWarning, err)
+		}
+	}
+
+	if spec.ProxyProtocol && spec.HTTP3 {
+		return fmt.Errorf("proxy protocol is not supported when http3 enabled")
+	}
+
 	if !spec.HTTPS {
 		if spec.HTTP3 {
 			return fmt.Errorf("https is disabled when http3 enabled")
@@ -76,13 +313,23 @@ func (spec *Spec) Validate() error {
 		return nil
 	}
 
-	if spec.CertBase64 == "" && spec.KeyBase64 == "" && len(spec.Certs) == 0 && len(spec.Keys) == 0 && !spec.AutoCert {
-		return fmt.Errorf("certBase64/keyBase64, certs/keys are both empty and autocert is disabled when https enabled")
+	if spec.CertBase64 == "" && spec.KeyBase64 == "" && len(spec.Certs) == 0 && len(spec.Keys) == 0 &&
+		len(spec.TLSHosts) == 0 && len(spec.CertSources) == 0 && !spec.AutoCert {
+		return fmt.Errorf("certBase64/keyBase64, certs/keys, tlsHosts and certSources are all empty and autocert is disabled when https enabled")
 	}
 	_, err := spec.tlsConfig()
 	return err
 }
 
+// altSvcHeader returns the value of the Alt-Svc header advertising HTTP/3.
+func (spec *Spec) altSvcHeader() string {
+	maxAge := defaultAltSvcMaxAge
+	if spec.AltSvc.MaxAge != "" {
+		maxAge, _ = time.ParseDuration(spec.AltSvc.MaxAge)
+	}
+	return fmt.Sprintf(`h3=":%d"; ma=%d`, spec.Port, int64(maxAge.Seconds()))
+}
+
 func tryDecodeBase64Pem(pem string) []byte {
 	// The pem could in base64 encoding or plain text. It starts with '-' if it is
 	// in plain text, and '-' is not a valid character in standard base64 encoding.
@@ -95,6 +342,12 @@ func tryDecodeBase64Pem(pem string) []byte {
 }
 
 func (spec *Spec) tlsConfig() (*tls.Config, error) {
+	return spec.tlsConfigWithCerts(nil)
+}
+
+// tlsConfigWithCerts returns the TLS config with the certificates in the
+// spec and the extra ones, which are loaded from the cert sources.
+func (spec *Spec) tlsConfigWithCerts(extra []tls.Certificate) (*tls.Config, error) {
 	var certificates []tls.Certificate
 
 	if spec.CertBase64 != "" && spec.KeyBase64 != "" {
@@ -123,7 +376,10 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 		certificates = append(certificates, cert)
 	}
 
-	if len(certificates) == 0 && !spec.AutoCert {
+	certificates = append(certificates, extra...)
+
+	// The certificates of the sources may be not loaded yet.
+	if len(certificates) == 0 && len(spec.TLSHosts) == 0 && len(spec.CertSources) == 0 && !spec.AutoCert {
 		return nil, fmt.Errorf("none valid certs and secret")
 	}
 
@@ -152,13 +408,101 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 	// if caCertBase64 configuration is provided, should enable tls.ClientAuth and
 	// add the root cert
 	if len(spec.CaCertBase64) != 0 {
-		rootCertPem, _ := base64.StdEncoding.DecodeString(spec.CaCertBase64)
-		certPool := x509.NewCertPool()
-		certPool.AppendCertsFromPEM(rootCertPem)
+		setClientAuth(tlsConf, spec.CaCertBase64, spec.ClientAuth)
+	}
 
-		tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
-		tlsConf.ClientCAs = certPool
+	if len(spec.TLSHosts) > 0 {
+		hostConfs := make([]*tls.Config, len(spec.TLSHosts))
+		for i, h := range spec.TLSHosts {
+			conf, err := h.tlsConfig(tlsConf)
+			if err != nil {
+				return nil, fmt.Errorf("tlsHosts %d: %v", i, err)
+			}
+			hostConfs[i] = conf
+		}
+
+		tlsConf.GetConfigForClient = func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+			for i, h := range spec.TLSHosts {
+				if tlssni.MatchHost(h.Hosts, chi.ServerName) {
+					return hostConfs[i], nil
+				}
+			}
+			// nil means using the default config.
+			return nil, nil
+		}
 	}
 
 	return tlsConf, nil
 }
+
+// tlsConfig returns the TLS config of the hosts, which inherits the other
+// settings from the default config.
+func (h *TLSHostSpec) tlsConfig(defaultConf *tls.Config) (*tls.Config, error) {
+	if len(h.Hosts) == 0 {
+		return nil, fmt.Errorf("hosts is empty")
+	}
+
+	cert, err := tls.X509KeyPair(tryDecodeBase64Pem(h.CertBase64), tryDecodeBase64Pem(h.KeyBase64))
+	if err != nil {
+		return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+	}
+
+	conf := defaultConf.Clone()
+	conf.Certificates = []tls.Certificate{cert}
+	// The certificate of the hosts takes precedence over autocert.
+	conf.GetCertificate = nil
+	// The protocols added by http.Server only apply to the default config,
+	// and http3.Server overrides the protocols of the returned config.
+	conf.NextProtos = []string{"h2", "http/1.1"}
+
+	if h.CaCertBase64 != "" {
+		setClientAuth(conf, h.CaCertBase64, h.ClientAuth)
+	} else if h.ClientAuth != nil {
+		conf.VerifyPeerCertificate = newClientCertVerifier(h.ClientAuth).verify
+	}
+
+	if conf.MinVersion, err = parseTLSVersion(h.MinVersion); err != nil {
+		return nil, err
+	}
+	if conf.MaxVersion, err = parseTLSVersion(h.MaxVersion); err != nil {
+		return nil, err
+	}
+	if conf.MinVersion != 0 && conf.MaxVersion != 0 && conf.MinVersion > conf.MaxVersion {
+		return nil, fmt.Errorf("minVersion %s is greater than maxVersion %s", h.MinVersion, h.MaxVersion)
+	}
+
+	return conf, nil
+}
+
+// setClientAuth requires and verifies the client certificates by the CA
+// and the client auth spec.
+func setClientAuth(conf *tls.Config, caCertBase64 string, clientAuth *ClientAuthSpec) {
+	rootCertPem, _ := base64.StdEncoding.DecodeString(caCertBase64)
+	certPool := x509.NewCertPool()
+	certPool.AppendCertsFromPEM(rootCertPem)
+
+	conf.ClientAuth = tls.RequireAndVerifyClientCert
+	conf.ClientCAs = certPool
+	conf.VerifyPeerCertificate = nil
+	if clientAuth != nil {
+		conf.VerifyPeerCertificate = newClientCertVerifier(clientAuth).verify
+	}
+}
+
+// parseTLSVersion parses the TLS version, 0 is returned for empty version,
+// which means the default version of crypto/tls.
+func parseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "":
+		return 0, nil
+	case "TLS1.0":
+		return tls.VersionTLS10, nil
+	case "TLS1.1":
+		return tls.VersionTLS11, nil
+	case "TLS1.2":
+		return tls.VersionTLS12, nil
+	case "TLS1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid tls version %s", v)
+}
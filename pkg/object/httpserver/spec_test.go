@@ -18,11 +18,20 @@
 package httpserver
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/logger"
@@ -108,6 +117,100 @@ rules:
 	superSpec, err = supervisor.NewSpec(yamlConfig)
 	assert.True(strings.Contains(err.Error(), "keepAliveTimeout: invalid duration"))
 	assert.Nil(superSpec)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+protocolDetection:
+  sniffTimeout: 100ms
+  tcpBackend: 127.0.0.1:8080
+`
+	superSpec, err = supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	assert.NotNil(superSpec)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+protocolDetection:
+  tcpBackend: no-port
+`
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.Error(err)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+https: true
+autoCert: true
+protocolDetection: {}
+`
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.Error(err)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+rewrites:
+- match: '^/a'
+  last: true
+`
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.Error(err)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+altSvc:
+  maxAge: 1h
+`
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.Error(err)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+keepAlive: true
+https: false
+unixSocket: /var/run/easegress.sock
+`
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+keepAlive: true
+https: false
+unixSocket: /var/run/easegress.sock
+`
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.Error(err)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+keepAlive: true
+https: false
+`
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.Error(err)
+}
+
+func TestAltSvcHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Port: 10443, HTTP3: true, AltSvc: &AltSvcSpec{}}
+	assert.Equal(`h3=":10443"; ma=86400`, spec.altSvcHeader())
+
+	spec.AltSvc.MaxAge = "1h"
+	assert.Equal(`h3=":10443"; ma=3600`, spec.altSvcHeader())
 }
 
 func TestTlsConfig(t *testing.T) {
@@ -257,3 +360,96 @@ rules: []`, validSpec: true, mTLSExpected: true,
 		})
 	}
 }
+
+// genCertPem generates a self-signed certificate of the host.
+func genCertPem(t *testing.T, host string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return base64.StdEncoding.EncodeToString(certPem), base64.StdEncoding.EncodeToString(keyPem)
+}
+
+func TestTLSHosts(t *testing.T) {
+	assert := assert.New(t)
+
+	defaultCert, defaultKey := genCertPem(t, "example.com")
+	hostCert, hostKey := genCertPem(t, "*.example.org")
+
+	spec := &Spec{
+		Port:       443,
+		HTTPS:      true,
+		CertBase64: defaultCert,
+		KeyBase64:  defaultKey,
+		TLSHosts: []*TLSHostSpec{{
+			Hosts:      []string{"*.example.org"},
+			CertBase64: hostCert,
+			KeyBase64:  hostKey,
+			MinVersion: "TLS1.2",
+		}},
+	}
+	assert.Nil(spec.Validate())
+
+	tlsConf, err := spec.tlsConfig()
+	assert.Nil(err)
+
+	conf, err := tlsConf.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	assert.Nil(err)
+	assert.Equal(uint16(tls.VersionTLS12), conf.MinVersion)
+	assert.Equal(1, len(conf.Certificates))
+	assert.Equal("*.example.org", conf.Certificates[0].Leaf.Subject.CommonName)
+
+	conf, err = tlsConf.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "example.com"})
+	assert.Nil(err)
+	assert.Nil(conf)
+
+	// only tlsHosts is enough for https.
+	spec.CertBase64, spec.KeyBase64 = "", ""
+	assert.Nil(spec.Validate())
+
+	spec.TLSHosts[0].MaxVersion = "TLS1.1"
+	assert.NotNil(spec.Validate())
+	spec.TLSHosts[0].MaxVersion = "TLS2.0"
+	assert.NotNil(spec.Validate())
+	spec.TLSHosts[0].MaxVersion = ""
+	spec.TLSHosts[0].KeyBase64 = defaultKey
+	assert.NotNil(spec.Validate())
+
+	spec.TLSHosts[0].KeyBase64 = hostKey
+	spec.TLSPassthrough = []*TLSPassthroughSpec{{Hosts: []string{"db.example.com"}, Backend: "10.0.0.1:443"}}
+	assert.Nil(spec.Validate())
+	spec.TLSPassthrough[0].Backend = "10.0.0.1"
+	assert.NotNil(spec.Validate())
+	spec.TLSPassthrough[0].Backend = "10.0.0.1:443"
+	spec.HTTPS = false
+	assert.NotNil(spec.Validate())
+
+	spec.HTTPS = true
+	spec.ClientAuth = &ClientAuthSpec{MaxVerifyDepth: 1}
+	assert.NotNil(spec.Validate())
+	spec.ClientAuth = nil
+	spec.TLSHosts[0].ClientAuth = &ClientAuthSpec{MaxVerifyDepth: 1}
+	assert.NotNil(spec.Validate())
+	spec.TLSHosts[0].CaCertBase64 = defaultCert
+	assert.Nil(spec.Validate())
+
+	tlsConf, err = spec.tlsConfig()
+	assert.Nil(err)
+	conf, err = tlsConf.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	assert.Nil(err)
+	assert.Equal(tls.RequireAndVerifyClientCert, conf.ClientAuth)
+	assert.NotNil(conf.VerifyPeerCertificate)
+}
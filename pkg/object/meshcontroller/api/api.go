@@ -26,6 +26,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/api"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 	"github.com/megaease/easegress/v2/pkg/util/k8s"
@@ -49,6 +50,27 @@ const (
 	// MeshIngressPath is the mesh ingress path.
 	MeshIngressPath = "/mesh/ingresses/{ingressName}"
 
+	// MeshTLSSecretPrefix is the mesh TLS secret prefix.
+	MeshTLSSecretPrefix = "/mesh/tlssecrets"
+
+	// MeshTLSSecretPath is the mesh TLS secret path.
+	MeshTLSSecretPath = "/mesh/tlssecrets/{secretName}"
+
+	// MeshWasmModulePrefix is the mesh WebAssembly module prefix.
+	MeshWasmModulePrefix = "/mesh/wasmmodules"
+
+	// MeshWasmModulePath is the mesh WebAssembly module path.
+	MeshWasmModulePath = "/mesh/wasmmodules/{moduleName}"
+
+	// MeshEgressGatewayPrefix is the mesh egress gateway prefix.
+	MeshEgressGatewayPrefix = "/mesh/egressgateways"
+
+	// MeshEgressGatewayPath is the mesh egress gateway path.
+	MeshEgressGatewayPath = "/mesh/egressgateways/{egressGatewayName}"
+
+	// MeshEgressGatewayInstancePrefix is the mesh egress gateway instance prefix.
+	MeshEgressGatewayInstancePrefix = "/mesh/egressgateways/{egressGatewayName}/instances"
+
 	// MeshServicePrefix is mesh service prefix.
 	MeshServicePrefix = "/mesh/services"
 
@@ -82,6 +104,18 @@ const (
 	// MeshServiceInstancePath is the mesh service path.
 	MeshServiceInstancePath = "/mesh/serviceinstances/{serviceName}/{instanceID}"
 
+	// MeshServiceInstanceConfigPath is the path of the effective sidecar config of service instance.
+	MeshServiceInstanceConfigPath = "/mesh/serviceinstances/{serviceName}/{instanceID}/config"
+
+	// MeshServiceTopologyPath is the mesh service topology path.
+	MeshServiceTopologyPath = "/mesh/topology"
+
+	// MeshAggregatedMetricsPath is the mesh aggregated metrics path.
+	MeshAggregatedMetricsPath = "/mesh/metrics"
+
+	// MeshFederationCatalogPath is the path of the catalog exported to federation peers.
+	MeshFederationCatalogPath = "/mesh/federation/catalog"
+
 	// MeshHTTPRouteGroupPrefix is the mesh HTTP route groups prefix.
 	MeshHTTPRouteGroupPrefix = "/mesh/httproutegroups"
 
@@ -122,8 +156,9 @@ const (
 type (
 	// API is the struct with the service
 	API struct {
-		k8sClient *kubernetes.Clientset
+		k8sClient kubernetes.Interface
 		service   *service.Service
+		admin     *spec.Admin
 	}
 )
 
@@ -131,14 +166,18 @@ const apiGroupName = "mesh_admin"
 
 // New creates a API
 func New(superSpec *supervisor.Spec) *API {
+	api := &API{
+		service: service.New(superSpec),
+		admin:   superSpec.ObjectSpec().(*spec.Admin),
+	}
+
+	// NOTE: Assign the client only on success, a nil clientset in the
+	// interface is not nil.
 	k8sClient, err := k8s.NewK8sClientInCluster()
 	if err != nil {
 		logger.Errorf("new k8s client failed: %v", err)
-	}
-
-	api := &API{
-		service:   service.New(superSpec),
-		k8sClient: k8sClient,
+	} else {
+		api.k8sClient = k8sClient
 	}
 
 	api.registerAPIs()
@@ -165,6 +204,22 @@ func (a *API) registerAPIs() {
 			{Path: MeshIngressPath, Method: "GET", Handler: a.getIngress},
 			{Path: MeshIngressPath, Method: "PUT", Handler: a.updateIngress},
 			{Path: MeshIngressPath, Method: "DELETE", Handler: a.deleteIngress},
+			{Path: MeshTLSSecretPrefix, Method: "GET", Handler: a.listTLSSecrets},
+			{Path: MeshTLSSecretPrefix, Method: "POST", Handler: a.createTLSSecret},
+			{Path: MeshTLSSecretPath, Method: "GET", Handler: a.getTLSSecret},
+			{Path: MeshTLSSecretPath, Method: "PUT", Handler: a.updateTLSSecret},
+			{Path: MeshTLSSecretPath, Method: "DELETE", Handler: a.deleteTLSSecret},
+			{Path: MeshWasmModulePrefix, Method: "GET", Handler: a.listWasmModules},
+			{Path: MeshWasmModulePrefix, Method: "POST", Handler: a.createWasmModule},
+			{Path: MeshWasmModulePath, Method: "GET", Handler: a.getWasmModule},
+			{Path: MeshWasmModulePath, Method: "PUT", Handler: a.updateWasmModule},
+			{Path: MeshWasmModulePath, Method: "DELETE", Handler: a.deleteWasmModule},
+			{Path: MeshEgressGatewayPrefix, Method: "GET", Handler: a.listEgressGateways},
+			{Path: MeshEgressGatewayPrefix, Method: "POST", Handler: a.createEgressGateway},
+			{Path: MeshEgressGatewayPath, Method: "GET", Handler: a.getEgressGateway},
+			{Path: MeshEgressGatewayPath, Method: "PUT", Handler: a.updateEgressGateway},
+			{Path: MeshEgressGatewayPath, Method: "DELETE", Handler: a.deleteEgressGateway},
+			{Path: MeshEgressGatewayInstancePrefix, Method: "GET", Handler: a.listEgressGatewayInstances},
 			{Path: MeshServicePrefix, Method: "GET", Handler: a.listServices},
 			{Path: MeshServicePrefix, Method: "POST", Handler: a.createService},
 			{Path: MeshServicePath, Method: "GET", Handler: a.getService},
@@ -178,6 +233,11 @@ func (a *API) registerAPIs() {
 			{Path: MeshServiceInstancePrefix, Method: "GET", Handler: a.listServiceInstanceSpecs},
 			{Path: MeshServiceInstancePath, Method: "GET", Handler: a.getServiceInstanceSpec},
 			{Path: MeshServiceInstancePath, Method: "DELETE", Handler: a.offlineServiceInstance},
+			{Path: MeshServiceInstanceConfigPath, Method: "GET", Handler: a.getServiceInstanceConfig},
+
+			{Path: MeshServiceTopologyPath, Method: "GET", Handler: a.getServiceTopology},
+			{Path: MeshAggregatedMetricsPath, Method: "GET", Handler: a.getAggregatedMetrics},
+			{Path: MeshFederationCatalogPath, Method: "GET", Handler: a.getFederationCatalog},
 
 			{Path: MeshServiceMockPath, Method: "POST", Handler: a.createPartOfService(mockMeta)},
 			{Path: MeshServiceMockPath, Method: "GET", Handler: a.getPartOfService(mockMeta)},
@@ -293,6 +353,13 @@ func (a *API) readAPISpec(r *http.Request, pbSpec interface{}, spec interface{})
 		return err
 	}
 
+	// NOTE: Unmarshal the body into spec again to keep the fields
+	// which are not defined in the pb spec yet, such as sidecar ports.
+	err = codectool.UnmarshalJSON(body, spec)
+	if err != nil {
+		return fmt.Errorf("unmarshal %s to spec %#v failed: %v", string(body), spec, err)
+	}
+
 	vr := v.Validate(spec)
 	if !vr.Valid() {
 		return fmt.Errorf("validate failed:\n%s", vr)
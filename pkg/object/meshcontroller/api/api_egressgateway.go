@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/v"
+)
+
+func (a *API) readEgressGatewayName(r *http.Request) (string, error) {
+	name := chi.URLParam(r, "egressGatewayName")
+	if name == "" {
+		return "", fmt.Errorf("empty egress gateway name")
+	}
+
+	return name, nil
+}
+
+func (a *API) readEgressGateway(r *http.Request) (*spec.EgressGateway, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	egressGateway := &spec.EgressGateway{}
+	err = codectool.UnmarshalJSON(body, egressGateway)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to spec failed: %v", string(body), err)
+	}
+
+	vr := v.Validate(egressGateway)
+	if !vr.Valid() {
+		return nil, fmt.Errorf("validate failed:\n%s", vr)
+	}
+
+	return egressGateway, nil
+}
+
+func (a *API) listEgressGateways(w http.ResponseWriter, r *http.Request) {
+	egressGateways := a.service.ListEgressGatewaySpecs()
+	sort.Slice(egressGateways, func(i, j int) bool {
+		return egressGateways[i].Name < egressGateways[j].Name
+	})
+
+	buff := codectool.MustMarshalJSON(egressGateways)
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) createEgressGateway(w http.ResponseWriter, r *http.Request) {
+	egressGateway, err := a.readEgressGateway(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetEgressGatewaySpec(egressGateway.Name) != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("%s existed", egressGateway.Name))
+		return
+	}
+
+	a.service.PutEgressGatewaySpec(egressGateway)
+
+	w.Header().Set("Location", path.Join(r.URL.Path, egressGateway.Name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *API) getEgressGateway(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readEgressGatewayName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	egressGateway := a.service.GetEgressGatewaySpec(name)
+	if egressGateway == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	buff := codectool.MustMarshalJSON(egressGateway)
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) updateEgressGateway(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readEgressGatewayName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	egressGateway, err := a.readEgressGateway(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if name != egressGateway.Name {
+		api.HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("name conflict: %s %s", name, egressGateway.Name))
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetEgressGatewaySpec(name) == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	a.service.PutEgressGatewaySpec(egressGateway)
+}
+
+func (a *API) deleteEgressGateway(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readEgressGatewayName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetEgressGatewaySpec(name) == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	a.service.DeleteEgressGatewaySpec(name)
+}
+
+func (a *API) listEgressGatewayInstances(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readEgressGatewayName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	instances := a.service.ListEgressGatewayInstanceSpecs(name)
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].InstanceID < instances[j].InstanceID
+	})
+
+	buff := codectool.MustMarshalJSON(instances)
+	a.writeJSONBody(w, buff)
+}
@@ -76,6 +76,12 @@ func (a *API) createIngress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	secrets, err := a.fetchIngressSecrets(ingressSpec)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
 	a.service.Lock()
 	defer a.service.Unlock()
 
@@ -85,6 +91,7 @@ func (a *API) createIngress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.importIngressSecrets(secrets)
 	a.service.PutIngressSpec(ingressSpec)
 
 	w.Header().Set("Location", path.Join(r.URL.Path, ingressSpec.Name))
@@ -133,6 +140,12 @@ func (a *API) updateIngress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	secrets, err := a.fetchIngressSecrets(ingressSpec)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
 	a.service.Lock()
 	defer a.service.Unlock()
 
@@ -142,6 +155,7 @@ func (a *API) updateIngress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.importIngressSecrets(secrets)
 	a.service.PutIngressSpec(ingressSpec)
 }
 
@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func (a *API) getAggregatedMetrics(w http.ResponseWriter, r *http.Request) {
+	services := a.service.ListServiceSpecs()
+	instances := a.service.ListAllServiceInstanceSpecs()
+	statuses := a.service.ListAllServiceInstanceStatuses()
+
+	metrics := spec.NewAggregatedMetrics(services, instances, statuses)
+
+	buff := codectool.MustMarshalJSON(metrics)
+	a.writeJSONBody(w, buff)
+}
@@ -91,6 +91,9 @@ func (a *API) createService(w http.ResponseWriter, r *http.Request) {
 	serviceSpec := &spec.Service{}
 
 	err := a.readAPISpec(r, pbServiceSpec, serviceSpec)
+	if err == nil {
+		err = a.validateServiceSecurity(serviceSpec)
+	}
 	if err != nil {
 		api.HandleAPIError(w, r, http.StatusBadRequest, err)
 		return
@@ -121,6 +124,15 @@ func (a *API) createService(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 }
 
+// validateServiceSecurity validates the service against the security
+// mode of the mesh.
+func (a *API) validateServiceSecurity(serviceSpec *spec.Service) error {
+	if a.admin.EnablemTLS() && serviceSpec.Sidecar != nil {
+		return serviceSpec.Sidecar.ValidateMTLS()
+	}
+	return nil
+}
+
 func (a *API) getService(w http.ResponseWriter, r *http.Request) {
 	serviceName, err := a.readServiceName(r)
 	if err != nil {
@@ -154,6 +166,9 @@ func (a *API) updateService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	err = a.readAPISpec(r, pbServiceSpec, serviceSpec)
+	if err == nil {
+		err = a.validateServiceSecurity(serviceSpec)
+	}
 	if err != nil {
 		api.HandleAPIError(w, r, http.StatusBadRequest, err)
 		return
@@ -96,6 +96,23 @@ func (a *API) getServiceInstanceSpec(w http.ResponseWriter, r *http.Request) {
 	a.writeJSONBody(w, buff)
 }
 
+func (a *API) getServiceInstanceConfig(w http.ResponseWriter, r *http.Request) {
+	serviceName, instanceID, err := a.readServiceInstanceInfo(w, r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	config := a.service.GetServiceInstanceConfig(serviceName, instanceID)
+	if config == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("config of %s/%s not found", serviceName, instanceID))
+		return
+	}
+
+	buff := codectool.MustMarshalJSON(config)
+	a.writeJSONBody(w, buff)
+}
+
 func (a *API) offlineServiceInstance(w http.ResponseWriter, r *http.Request) {
 	serviceName, instanceID, err := a.readServiceInstanceInfo(w, r)
 	if err != nil {
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/v"
+)
+
+const (
+	defaultSecretNamespace = "default"
+
+	// k8sRequestTimeout is the timeout of fetching the secrets from
+	// Kubernetes, so a slow API server doesn't stall the mesh API.
+	k8sRequestTimeout = 10 * time.Second
+)
+
+// redactTLSSecret returns a copy of the secret without the private key,
+// the key is write-only in the API.
+func redactTLSSecret(secret *spec.TLSSecret) *spec.TLSSecret {
+	redacted := *secret
+	redacted.KeyBase64 = ""
+	return &redacted
+}
+
+func (a *API) readTLSSecretName(r *http.Request) (string, error) {
+	name := chi.URLParam(r, "secretName")
+	if name == "" {
+		return "", fmt.Errorf("empty secret name")
+	}
+
+	return name, nil
+}
+
+func (a *API) readTLSSecret(r *http.Request) (*spec.TLSSecret, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	secret := &spec.TLSSecret{}
+	err = codectool.UnmarshalJSON(body, secret)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to spec failed: %v", string(body), err)
+	}
+
+	vr := v.Validate(secret)
+	if !vr.Valid() {
+		return nil, fmt.Errorf("validate failed:\n%s", vr)
+	}
+
+	return secret, nil
+}
+
+func (a *API) listTLSSecrets(w http.ResponseWriter, r *http.Request) {
+	secrets := a.service.ListTLSSecrets()
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+
+	redacted := make([]*spec.TLSSecret, 0, len(secrets))
+	for _, secret := range secrets {
+		redacted = append(redacted, redactTLSSecret(secret))
+	}
+
+	buff := codectool.MustMarshalJSON(redacted)
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) createTLSSecret(w http.ResponseWriter, r *http.Request) {
+	secret, err := a.readTLSSecret(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetTLSSecret(secret.Name) != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("%s existed", secret.Name))
+		return
+	}
+
+	a.service.PutTLSSecret(secret)
+
+	w.Header().Set("Location", path.Join(r.URL.Path, secret.Name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *API) getTLSSecret(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readTLSSecretName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	secret := a.service.GetTLSSecret(name)
+	if secret == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	buff := codectool.MustMarshalJSON(redactTLSSecret(secret))
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) updateTLSSecret(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readTLSSecretName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	secret, err := a.readTLSSecret(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if name != secret.Name {
+		api.HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("name conflict: %s %s", name, secret.Name))
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetTLSSecret(name) == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	a.service.PutTLSSecret(secret)
+}
+
+func (a *API) deleteTLSSecret(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readTLSSecretName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetTLSSecret(name) == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	a.service.DeleteTLSSecret(name)
+}
+
+// fetchIngressSecrets fetches the TLS secrets of the ingress which don't
+// exist in the mesh from Kubernetes, it must be called without the lock.
+func (a *API) fetchIngressSecrets(ingress *spec.Ingress) ([]*spec.TLSSecret, error) {
+	var secrets []*spec.TLSSecret
+	for _, tls := range ingress.TLS {
+		if a.service.GetTLSSecret(tls.SecretName) != nil {
+			continue
+		}
+
+		if a.k8sClient == nil {
+			return nil, fmt.Errorf("tls secret %s not found", tls.SecretName)
+		}
+
+		namespace := tls.SecretNamespace
+		if namespace == "" {
+			namespace = defaultSecretNamespace
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), k8sRequestTimeout)
+		secret, err := a.k8sClient.CoreV1().Secrets(namespace).Get(ctx, tls.SecretName, metav1.GetOptions{})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("get secret %s/%s failed: %v", namespace, tls.SecretName, err)
+		}
+
+		cert, key := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+		if len(cert) == 0 || len(key) == 0 {
+			return nil, fmt.Errorf("secret %s/%s is not a TLS secret", namespace, tls.SecretName)
+		}
+
+		secrets = append(secrets, &spec.TLSSecret{
+			Name:             tls.SecretName,
+			CertBase64:       base64.StdEncoding.EncodeToString(cert),
+			KeyBase64:        base64.StdEncoding.EncodeToString(key),
+			KubernetesSecret: spec.KubernetesSecretSource(namespace, tls.SecretName),
+		})
+	}
+
+	return secrets, nil
+}
+
+// importIngressSecrets imports the fetched secrets which still don't exist
+// in the mesh, the caller must hold the lock. The imported secrets are
+// imported again by the master on changes.
+func (a *API) importIngressSecrets(secrets []*spec.TLSSecret) {
+	for _, secret := range secrets {
+		if a.service.GetTLSSecret(secret.Name) == nil {
+			a.service.PutTLSSecret(secret)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+// meshKind registers the kind of the mesh controller to create its specs,
+// the mesh controller itself can't be imported.
+type meshKind struct{}
+
+func (meshKind) Category() supervisor.ObjectCategory         { return supervisor.CategoryBusinessController }
+func (meshKind) Kind() string                                { return "MeshController" }
+func (meshKind) DefaultSpec() interface{}                    { return &spec.Admin{} }
+func (meshKind) Init(*supervisor.Spec)                       {}
+func (meshKind) Inherit(*supervisor.Spec, supervisor.Object) {}
+func (meshKind) Status() *supervisor.Status                  { return &supervisor.Status{} }
+func (meshKind) Close()                                      {}
+
+type localMutex struct{ sync.Mutex }
+
+func (m *localMutex) Lock() error    { m.Mutex.Lock(); return nil }
+func (m *localMutex) TryLock() error { m.Mutex.Lock(); return nil }
+func (m *localMutex) Unlock() error  { m.Mutex.Unlock(); return nil }
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	supervisor.Register(&meshKind{})
+	os.Exit(m.Run())
+}
+
+// newTestAPI creates an API whose service is backed by an in-memory cluster.
+func newTestAPI(t *testing.T) *API {
+	var mutex sync.Mutex
+	data := map[string]string{}
+
+	cls := clustertest.NewMockedCluster()
+	cls.MockedGet = func(key string) (*string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if v, ok := data[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	cls.MockedGetRawPrefix = func(prefix string) (map[string]*mvccpb.KeyValue, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		kvs := map[string]*mvccpb.KeyValue{}
+		for k, v := range data {
+			if strings.HasPrefix(k, prefix) {
+				kvs[k] = &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v)}
+			}
+		}
+		return kvs, nil
+	}
+	cls.MockedPut = func(key, value string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		data[key] = value
+		return nil
+	}
+	storeMutex := &localMutex{}
+	cls.MockedMutex = func(string) (cluster.Mutex, error) { return storeMutex, nil }
+
+	super := supervisor.NewMock(nil, cls, nil, nil, false, nil, nil)
+	superSpec, err := super.NewSpec(`
+kind: MeshController
+name: mesh-controller
+heartbeatInterval: 5s
+registryType: eureka
+apiPort: 13009
+ingressPort: 13010
+`)
+	if err != nil {
+		t.Fatalf("create spec failed: %v", err)
+	}
+
+	return &API{service: service.New(superSpec), admin: superSpec.ObjectSpec().(*spec.Admin)}
+}
+
+func TestTLSSecretsRedacted(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newTestAPI(t)
+	a.k8sClient = fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "web"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("cert"),
+			corev1.TLSPrivateKeyKey: []byte("private-key"),
+		},
+	})
+
+	router := chi.NewRouter()
+	router.Post(MeshIngressPrefix, a.createIngress)
+	router.Get(MeshTLSSecretPrefix, a.listTLSSecrets)
+	router.Get(MeshTLSSecretPath, a.getTLSSecret)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	// the secret of the ingress is imported from Kubernetes.
+	w := serve(http.MethodPost, MeshIngressPrefix, `{
+		"name": "web",
+		"rules": [{"host": "example.com", "paths": [{"path": "/", "backend": "order"}]}],
+		"tls": [{"hosts": ["example.com"], "secretName": "web", "secretNamespace": "prod"}]
+	}`)
+	assert.Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	key := base64.StdEncoding.EncodeToString([]byte("private-key"))
+	secret := a.service.GetTLSSecret("web")
+	if assert.NotNil(secret) {
+		assert.Equal(key, secret.KeyBase64)
+	}
+
+	// the private key is never returned.
+	for _, path := range []string{MeshTLSSecretPrefix, MeshTLSSecretPrefix + "/web"} {
+		w = serve(http.MethodGet, path, "")
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Contains(w.Body.String(), base64.StdEncoding.EncodeToString([]byte("cert")))
+		assert.NotContains(w.Body.String(), key)
+	}
+	assert.Equal(key, a.service.GetTLSSecret("web").KeyBase64)
+
+	// the missing secret fails the ingress.
+	w = serve(http.MethodPost, MeshIngressPrefix, `{
+		"name": "api",
+		"rules": [{"paths": [{"path": "/", "backend": "order"}]}],
+		"tls": [{"hosts": ["api.example.com"], "secretName": "api"}]
+	}`)
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/v"
+)
+
+func (a *API) readWasmModuleName(r *http.Request) (string, error) {
+	name := chi.URLParam(r, "moduleName")
+	if name == "" {
+		return "", fmt.Errorf("empty module name")
+	}
+
+	return name, nil
+}
+
+func (a *API) readWasmModule(r *http.Request) (*spec.WasmModule, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	module := &spec.WasmModule{}
+	err = codectool.UnmarshalJSON(body, module)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to spec failed: %v", string(body), err)
+	}
+
+	vr := v.Validate(module)
+	if !vr.Valid() {
+		return nil, fmt.Errorf("validate failed:\n%s", vr)
+	}
+
+	return module, nil
+}
+
+func (a *API) listWasmModules(w http.ResponseWriter, r *http.Request) {
+	modules := a.service.ListWasmModules()
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Name < modules[j].Name
+	})
+
+	buff := codectool.MustMarshalJSON(modules)
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) createWasmModule(w http.ResponseWriter, r *http.Request) {
+	module, err := a.readWasmModule(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetWasmModule(module.Name) != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("%s existed", module.Name))
+		return
+	}
+
+	a.service.PutWasmModule(module)
+
+	w.Header().Set("Location", path.Join(r.URL.Path, module.Name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *API) getWasmModule(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readWasmModuleName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	module := a.service.GetWasmModule(name)
+	if module == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	buff := codectool.MustMarshalJSON(module)
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) updateWasmModule(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readWasmModuleName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	module, err := a.readWasmModule(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if name != module.Name {
+		api.HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("name conflict: %s %s", name, module.Name))
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetWasmModule(name) == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	a.service.PutWasmModule(module)
+}
+
+func (a *API) deleteWasmModule(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readWasmModuleName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetWasmModule(name) == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	a.service.DeleteWasmModule(name)
+}
@@ -55,6 +55,7 @@ type (
 		mutex       sync.Mutex
 		inf         informer.Informer
 		superSpec   *supervisor.Spec
+		isLeader    func() bool
 	}
 
 	// CertProvider is the interface declaring the methods for the Certificate provider, such as
@@ -87,7 +88,7 @@ type (
 )
 
 // NewCertManager creates a certmanager.
-func NewCertManager(superSpec *supervisor.Spec, service *service.Service, certProviderType string, appCertTTL, rootCertTTL time.Duration, store storage.Storage) *CertManager {
+func NewCertManager(superSpec *supervisor.Spec, service *service.Service, isLeader func() bool, certProviderType string, appCertTTL, rootCertTTL time.Duration, store storage.Storage) *CertManager {
 	inf := informer.NewInformer(store, "")
 	cm := &CertManager{
 		service:     service,
@@ -96,6 +97,7 @@ func NewCertManager(superSpec *supervisor.Spec, service *service.Service, certPr
 		done:        make(chan struct{}),
 		inf:         inf,
 		superSpec:   superSpec,
+		isLeader:    isLeader,
 	}
 
 	switch certProviderType {
@@ -130,8 +132,14 @@ func (cm *CertManager) run() {
 	}
 }
 
+// Sign signs the certs which are missing or about to expire, it does
+// nothing if the master is not the leader.
+func (cm *CertManager) Sign() {
+	cm.sign()
+}
+
 func (cm *CertManager) sign() {
-	if !cm.superSpec.Super().Cluster().IsLeader() {
+	if !cm.isLeader() {
 		return
 	}
 
@@ -289,7 +297,7 @@ func (cm *CertManager) SignServiceInstances(instanceSpecs []*spec.ServiceInstanc
 			continue
 		}
 		originCert := cm.service.GetServiceInstanceCert(v.ServiceName, v.InstanceID)
-		if cm.needSign(originCert) {
+		if cm.needSign(originCert) || !HasIdentity(originCert, spec.InstanceIdentity(v.ServiceName, v.InstanceID)) {
 			newCert, err := cm.Provider.SignAppCertAndKey(v.ServiceName, v.InstanceID, v.IP, cm.appCertTTL)
 			if err != nil {
 				logger.Errorf("%s sign instance: %s cert failed, err: %v", v.ServiceName, v.InstanceID, err)
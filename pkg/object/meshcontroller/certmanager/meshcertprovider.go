@@ -28,6 +28,7 @@ import (
 	"fmt"
 	"math/big"
 	"net"
+	"net/url"
 	"sync"
 	"time"
 
@@ -59,6 +60,40 @@ func uniqID(serviceName, host, ip string) string {
 
 // SignAppCertAndKey  Signs a cert, key pair for one service
 func (mp *MeshCertProvider) SignAppCertAndKey(serviceName, host, ip string, ttl time.Duration) (cert *spec.Certificate, err error) {
+	cert, err = mp.signCert(serviceName, host, ip, spec.InstanceIdentity(serviceName, host), ttl)
+	if err != nil {
+		return
+	}
+
+	mp.SetAppCertAndKey(serviceName, host, ip, cert)
+	return
+}
+
+// SignMasterCert signs a cert of the mesh master with the root cert, which
+// is used by the servers of the master accepting the mTLS connections of
+// the instances. The root key is only used in the master.
+func SignMasterCert(rootCert *spec.Certificate, memberName string, ttl time.Duration) (*spec.Certificate, error) {
+	mp := NewMeshCertProvider()
+	mp.RootCert = rootCert
+	return mp.signCert(memberName, memberName, "", spec.MasterIdentity(memberName), ttl)
+}
+
+// HasIdentity returns whether the cert carries the identity, the certs
+// signed by older versions don't.
+func HasIdentity(cert *spec.Certificate, identity *url.URL) bool {
+	x509Cert, err := decodeCertPEM(cert.CertBase64)
+	if err != nil {
+		return false
+	}
+	for _, u := range x509Cert.URIs {
+		if u.String() == identity.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func (mp *MeshCertProvider) signCert(serviceName, host, ip string, identity *url.URL, ttl time.Duration) (cert *spec.Certificate, err error) {
 	if mp.RootCert == nil {
 		err = fmt.Errorf("not root cert found")
 		return
@@ -93,7 +128,11 @@ func (mp *MeshCertProvider) SignAppCertAndKey(serviceName, host, ip string, ttl
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 		KeyUsage:     x509.KeyUsageDigitalSignature,
 		DNSNames:     []string{"*"},
-		IPAddresses:  []net.IP{net.ParseIP(ip), net.IPv6loopback},
+		IPAddresses:  []net.IP{net.IPv6loopback},
+		URIs:         []*url.URL{identity},
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		x509Cert.IPAddresses = append([]net.IP{parsed}, x509Cert.IPAddresses...)
 	}
 
 	certPrivKey, err := rsa.GenerateKey(rand.Reader, 4096)
@@ -128,8 +167,6 @@ func (mp *MeshCertProvider) SignAppCertAndKey(serviceName, host, ip string, ttl
 		SignTime:    now.Format(time.RFC3339),
 		HOST:        host,
 	}
-
-	mp.SetAppCertAndKey(serviceName, host, ip, cert)
 	return
 }
 
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configpush
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/layout"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/storage"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+const subscribeRetryInterval = 3 * time.Second
+
+type (
+	// Client runs in workers, it subscribes to one of the config push
+	// servers and keeps a replica of the configuration of its instance.
+	Client struct {
+		masters []string
+		request *SubscribeRequest
+		store   storage.Storage
+
+		mutex    sync.RWMutex
+		synced   bool
+		version  uint64
+		data     map[string]*mvccpb.KeyValue
+		watchers map[*watcher]struct{}
+
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+
+	watcher struct {
+		notify chan struct{}
+	}
+)
+
+// NewClient creates a config push client for the instance, it tries
+// the masters in order until one of them accepts the subscription. The
+// cert of the instance and the root cert are read from the store, the
+// subscription fails until the cert of the instance is signed.
+func NewClient(masters []string, serviceName, instanceID string, store storage.Storage) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		masters: masters,
+		request: &SubscribeRequest{
+			ServiceName: serviceName,
+			InstanceID:  instanceID,
+		},
+		store:    store,
+		data:     make(map[string]*mvccpb.KeyValue),
+		watchers: make(map[*watcher]struct{}),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	go c.run(ctx)
+
+	return c
+}
+
+func (c *Client) run(ctx context.Context) {
+	for i := 0; ; i++ {
+		master := c.masters[i%len(c.masters)]
+		err := c.subscribe(ctx, master)
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		logger.Errorf("subscribe to config push server %s failed: %v", master, err)
+
+		select {
+		case <-c.done:
+			return
+		case <-time.After(subscribeRetryInterval):
+		}
+	}
+}
+
+// tlsConfig returns the TLS config with the current certs, the rotated
+// certs are used when subscribing again.
+func (c *Client) tlsConfig() (*tls.Config, error) {
+	value, err := c.store.Get(layout.RootCertKey())
+	if err != nil {
+		return nil, fmt.Errorf("get root cert failed: %v", err)
+	}
+	root, err := unmarshalCert(value)
+	if err != nil {
+		return nil, fmt.Errorf("root cert: %v", err)
+	}
+	pool, err := certPool(root)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err = c.store.Get(layout.ServiceInstanceCertKey(c.request.ServiceName, c.request.InstanceID))
+	if err != nil {
+		return nil, fmt.Errorf("get instance cert failed: %v", err)
+	}
+	cert, err := unmarshalCert(value)
+	if err != nil {
+		return nil, fmt.Errorf("instance cert: %v", err)
+	}
+	tc, err := tlsCert(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{tc},
+		// the server cert is verified by verifyMaster against the root
+		// cert and the identity of masters instead of the address.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verifyMaster(pool),
+	}, nil
+}
+
+func (c *Client) subscribe(ctx context.Context, master string) error {
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	conn, err := grpc.DialContext(ctx, master,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                keepaliveTime,
+			Timeout:             keepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], subscribeURI)
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(c.request); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		snapshot := &Snapshot{}
+		if err := stream.RecvMsg(snapshot); err != nil {
+			return err
+		}
+		if err := c.apply(snapshot); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) apply(snapshot *Snapshot) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if snapshot.Full {
+		logger.Infof("received full config snapshot with %d keys", len(snapshot.Puts))
+		c.data = make(map[string]*mvccpb.KeyValue, len(snapshot.Puts))
+	} else if !c.synced || snapshot.Version != c.version+1 {
+		return fmt.Errorf("unexpected config snapshot version %d, want %d", snapshot.Version, c.version+1)
+	}
+
+	for _, kv := range snapshot.Puts {
+		c.data[kv.Key] = kv.raw()
+	}
+	for _, key := range snapshot.Deletes {
+		delete(c.data, key)
+	}
+	c.version = snapshot.Version
+	c.synced = true
+
+	for w := range c.watchers {
+		w.wake()
+	}
+
+	return nil
+}
+
+func (w *watcher) wake() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Client) addWatcher(w *watcher) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.watchers[w] = struct{}{}
+	if c.synced {
+		w.wake()
+	}
+}
+
+func (c *Client) removeWatcher(w *watcher) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.watchers, w)
+}
+
+// get returns the key values of the key, or of the keys with the prefix.
+func (c *Client) get(key string, prefix bool) map[string]*mvccpb.KeyValue {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	result := make(map[string]*mvccpb.KeyValue)
+	if !prefix {
+		if kv := c.data[key]; kv != nil {
+			result[key] = kv
+		}
+		return result
+	}
+
+	for k, kv := range c.data {
+		if strings.HasPrefix(k, key) {
+			result[k] = kv
+		}
+	}
+	return result
+}
+
+// Close closes the client.
+func (c *Client) Close() {
+	close(c.done)
+	c.cancel()
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configpush
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/certmanager"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/layout"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/storage"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+// fakeCluster is an in-memory cluster, the changes are sent to all the
+// syncers of the matched prefixes.
+type fakeCluster struct {
+	*clustertest.MockedCluster
+
+	mutex    sync.Mutex
+	revision int64
+	data     map[string]*mvccpb.KeyValue
+	channels map[string][]chan map[string]*mvccpb.KeyValue
+}
+
+func newFakeCluster() *fakeCluster {
+	fc := &fakeCluster{
+		MockedCluster: clustertest.NewMockedCluster(),
+		data:          make(map[string]*mvccpb.KeyValue),
+		channels:      make(map[string][]chan map[string]*mvccpb.KeyValue),
+	}
+
+	fc.MockedGet = func(key string) (*string, error) {
+		fc.mutex.Lock()
+		defer fc.mutex.Unlock()
+		kv := fc.data[key]
+		if kv == nil {
+			return nil, nil
+		}
+		value := string(kv.Value)
+		return &value, nil
+	}
+	fc.MockedGetRawPrefix = func(prefix string) (map[string]*mvccpb.KeyValue, error) {
+		fc.mutex.Lock()
+		defer fc.mutex.Unlock()
+		return fc.prefixData(prefix), nil
+	}
+	fc.MockedSyncer = func(time.Duration) (cluster.Syncer, error) {
+		syncer := clustertest.NewMockedSyncer()
+		syncer.MockedSyncRawPrefix = func(prefix string) (<-chan map[string]*mvccpb.KeyValue, error) {
+			fc.mutex.Lock()
+			defer fc.mutex.Unlock()
+			ch := make(chan map[string]*mvccpb.KeyValue, 10)
+			fc.channels[prefix] = append(fc.channels[prefix], ch)
+			return ch, nil
+		}
+		return syncer, nil
+	}
+
+	return fc
+}
+
+func (fc *fakeCluster) prefixData(prefix string) map[string]*mvccpb.KeyValue {
+	result := make(map[string]*mvccpb.KeyValue)
+	for k, kv := range fc.data {
+		if strings.HasPrefix(k, prefix) {
+			result[k] = kv
+		}
+	}
+	return result
+}
+
+func (fc *fakeCluster) put(key string, value *string) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	fc.revision++
+	if value == nil {
+		delete(fc.data, key)
+	} else {
+		fc.data[key] = &mvccpb.KeyValue{
+			Key:         []byte(key),
+			Value:       []byte(*value),
+			ModRevision: fc.revision,
+		}
+	}
+
+	for prefix, channels := range fc.channels {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		for _, ch := range channels {
+			ch <- fc.prefixData(prefix)
+		}
+	}
+}
+
+func (fc *fakeCluster) putString(key, value string) {
+	fc.put(key, &value)
+}
+
+func (fc *fakeCluster) putCert(t *testing.T, key string, cert interface{}) {
+	buff, err := codectool.MarshalJSON(cert)
+	if err != nil {
+		t.Fatalf("marshal cert failed: %v", err)
+	}
+	fc.putString(key, string(buff))
+}
+
+// newMesh creates a cluster with the root cert and the cert of instance
+// order/order-1.
+func newMesh(t *testing.T) *fakeCluster {
+	fc := newFakeCluster()
+
+	provider := certmanager.NewMeshCertProvider()
+	root, err := provider.SignRootCertAndKey(time.Hour)
+	if err != nil {
+		t.Fatalf("sign root cert failed: %v", err)
+	}
+	cert, err := provider.SignAppCertAndKey("order", "order-1", "127.0.0.1", time.Hour)
+	if err != nil {
+		t.Fatalf("sign instance cert failed: %v", err)
+	}
+
+	fc.putCert(t, layout.RootCertKey(), root)
+	fc.putCert(t, layout.ServiceInstanceCertKey("order", "order-1"), cert)
+	return fc
+}
+
+func startServer(t *testing.T, fc *fakeCluster) (*Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	s := newServer(fc, "master-1")
+	go s.serve(listener)
+	return s, listener.Addr().String()
+}
+
+func newTestClient(masters []string, fc *fakeCluster) *Client {
+	return NewClient(masters, "order", "order-1", storage.New("test", fc))
+}
+
+func waitValue(c *Client, key, value string) func() bool {
+	return func() bool {
+		kv := c.get(key, false)[key]
+		if value == "" {
+			return kv == nil
+		}
+		return kv != nil && string(kv.Value) == value
+	}
+}
+
+func TestPushSnapshots(t *testing.T) {
+	assert := assert.New(t)
+
+	fc := newMesh(t)
+	fc.putString(layout.ServiceSpecKey("order"), "spec-1")
+	fc.putString(layout.ServiceSpecKey("delivery"), "spec-1")
+
+	s, addr := startServer(t, fc)
+	defer s.Close()
+	c := newTestClient([]string{addr}, fc)
+	defer c.Close()
+
+	// full snapshot
+	assert.Eventually(waitValue(c, layout.ServiceSpecKey("order"), "spec-1"), 10*time.Second, 10*time.Millisecond)
+	assert.Eventually(func() bool { return s.Subscribers() == 1 }, time.Second, 10*time.Millisecond)
+	assert.Len(c.get(layout.ServiceSpecPrefix(), true), 2)
+	assert.Len(c.get(layout.ServiceInstanceCertKey("order", "order-1"), false), 1)
+
+	// delta snapshots
+	fc.putString(layout.ServiceSpecKey("order"), "spec-2")
+	assert.Eventually(waitValue(c, layout.ServiceSpecKey("order"), "spec-2"), time.Second, 10*time.Millisecond)
+	fc.put(layout.ServiceSpecKey("delivery"), nil)
+	assert.Eventually(waitValue(c, layout.ServiceSpecKey("delivery"), ""), time.Second, 10*time.Millisecond)
+
+	// the root key and the certs of other instances are never pushed.
+	fc.putString(layout.ServiceInstanceCertKey("delivery", "delivery-1"), "cert")
+	fc.putString(layout.ServiceSpecKey("payment"), "spec-1")
+	assert.Eventually(waitValue(c, layout.ServiceSpecKey("payment"), "spec-1"), time.Second, 10*time.Millisecond)
+	assert.Empty(c.get(layout.RootCertKey(), false))
+	assert.Empty(c.get(layout.ServiceInstanceCertKey("delivery", "delivery-1"), false))
+}
+
+func TestResubscribe(t *testing.T) {
+	assert := assert.New(t)
+
+	fc := newMesh(t)
+	fc.putString(layout.ServiceSpecKey("order"), "spec-1")
+	fc.putString(layout.ServiceSpecKey("delivery"), "spec-1")
+
+	s1, addr1 := startServer(t, fc)
+	s2, addr2 := startServer(t, fc)
+	defer s2.Close()
+	c := newTestClient([]string{addr1, addr2}, fc)
+	defer c.Close()
+
+	assert.Eventually(waitValue(c, layout.ServiceSpecKey("delivery"), "spec-1"), 10*time.Second, 10*time.Millisecond)
+
+	// the keys changed while resubscribing are synced by the full snapshot.
+	s1.Close()
+	fc.put(layout.ServiceSpecKey("delivery"), nil)
+	fc.putString(layout.ServiceSpecKey("order"), "spec-2")
+
+	assert.Eventually(waitValue(c, layout.ServiceSpecKey("order"), "spec-2"), 3*subscribeRetryInterval, 10*time.Millisecond)
+	assert.Nil(c.get(layout.ServiceSpecKey("delivery"), false)[layout.ServiceSpecKey("delivery")])
+	assert.Equal(1, s2.Subscribers())
+}
+
+func TestSubscribeIdentity(t *testing.T) {
+	assert := assert.New(t)
+
+	fc := newMesh(t)
+	s, addr := startServer(t, fc)
+	defer s.Close()
+
+	// the cert of order-1 can't subscribe to the configuration of order-2.
+	cert, _ := fc.Get(layout.ServiceInstanceCertKey("order", "order-1"))
+	fc.putString(layout.ServiceInstanceCertKey("order", "order-2"), *cert)
+
+	c := &Client{
+		request: &SubscribeRequest{ServiceName: "order", InstanceID: "order-2"},
+		store:   storage.New("test", fc),
+		data:    make(map[string]*mvccpb.KeyValue),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var err error
+	for i := 0; i < 100; i++ {
+		err = c.subscribe(ctx, addr)
+		if status.Code(err) != codes.Unavailable {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+
+	// no cert of the instance.
+	c.request.InstanceID = "order-3"
+	assert.Error(c.subscribe(ctx, addr))
+}
+
+func TestApplyVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &Client{
+		data:     make(map[string]*mvccpb.KeyValue),
+		watchers: make(map[*watcher]struct{}),
+	}
+	kv := func(key string) *KeyValue {
+		return &KeyValue{Key: key, Value: "value"}
+	}
+
+	// a delta snapshot before the full one
+	assert.Error(c.apply(&Snapshot{Version: 1, Puts: []*KeyValue{kv("a")}}))
+
+	assert.NoError(c.apply(&Snapshot{Version: 1, Full: true, Puts: []*KeyValue{kv("a"), kv("b")}}))
+	assert.NoError(c.apply(&Snapshot{Version: 2, Puts: []*KeyValue{kv("c")}, Deletes: []string{"a"}}))
+	assert.Len(c.get("", true), 2)
+
+	// version gaps and duplicates
+	assert.Error(c.apply(&Snapshot{Version: 4, Deletes: []string{"b"}}))
+	assert.Error(c.apply(&Snapshot{Version: 2, Deletes: []string{"b"}}))
+	assert.Len(c.get("", true), 2)
+
+	// a full snapshot replaces all the data
+	assert.NoError(c.apply(&Snapshot{Version: 1, Full: true, Puts: []*KeyValue{kv("d")}}))
+	assert.Len(c.get("", true), 1)
+	assert.Len(c.get("d", false), 1)
+}
+
+func TestIsPushed(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isPushed(layout.ServiceSpecKey("order")))
+	assert.True(isPushed(layout.ServiceInstanceCertKey("order", "order-1")))
+	assert.False(isPushed(layout.RootCertKey()))
+	assert.False(isPushed(layout.TLSSecretPrefix()))
+	assert.False(isPushed(layout.ServiceInstanceStatusKey("order", "order-1")))
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package configpush pushes configuration snapshots from mesh masters to
+// workers through gRPC streams, so that workers don't need to hold their
+// own etcd watches.
+package configpush
+
+import (
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/layout"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc"
+)
+
+const (
+	serviceName  = "easegress.mesh.ConfigPush"
+	streamName   = "Subscribe"
+	subscribeURI = "/" + serviceName + "/" + streamName
+)
+
+type (
+	// SubscribeRequest is the request of a worker to subscribe to the
+	// configuration of its instance.
+	SubscribeRequest struct {
+		ServiceName string `json:"serviceName"`
+		InstanceID  string `json:"instanceID"`
+	}
+
+	// Snapshot is the configuration pushed to a worker. The first
+	// snapshot of a stream is a full one, the following ones only
+	// contain the keys changed since the previous snapshot.
+	Snapshot struct {
+		Version uint64      `json:"version"`
+		Full    bool        `json:"full"`
+		Puts    []*KeyValue `json:"puts,omitempty"`
+		Deletes []string    `json:"deletes,omitempty"`
+	}
+
+	// KeyValue is a pushed key value.
+	KeyValue struct {
+		Key            string `json:"key"`
+		Value          string `json:"value"`
+		CreateRevision int64  `json:"createRevision"`
+		ModRevision    int64  `json:"modRevision"`
+		Version        int64  `json:"version"`
+	}
+
+	// jsonCodec encodes the messages in JSON, so that no generated
+	// protobuf code is needed.
+	jsonCodec struct{}
+)
+
+// pushedPrefixes are the prefixes of the keys pushed to workers. Instance
+// statuses and configs are reported by workers and never watched by them,
+// so they are not pushed to avoid the churn of heartbeats. The root cert
+// carrying the root key and the TLS secrets are never pushed, workers
+// don't watch them.
+var pushedPrefixes = []string{
+	layout.ServiceSpecPrefix(),
+	layout.AllServiceInstanceSpecPrefix(),
+	layout.TenantPrefix(),
+	layout.IngressPrefix(),
+	layout.WasmModulePrefix(),
+	layout.EgressGatewayPrefix(),
+	layout.AllEgressGatewayInstanceSpecPrefix(),
+	layout.HTTPRouteGroupPrefix(),
+	layout.TrafficTargetPrefix(),
+	layout.CustomResourceKindPrefix(),
+	layout.AllCustomResourcePrefix(),
+	layout.ServiceCanaryPrefix(),
+	layout.AllServiceCertPrefix(),
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    streamName,
+			Handler:       subscribeHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+// isPushed returns whether the key or prefix is covered by the pushed prefixes.
+func isPushed(key string) bool {
+	for _, prefix := range pushedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isVisible returns whether the key is pushed to the instance, the
+// certs of other instances are never pushed.
+func (r *SubscribeRequest) isVisible(key string) bool {
+	if strings.HasPrefix(key, layout.AllServiceCertPrefix()) {
+		return key == layout.ServiceInstanceCertKey(r.ServiceName, r.InstanceID)
+	}
+	return true
+}
+
+func newKeyValue(kv *mvccpb.KeyValue) *KeyValue {
+	return &KeyValue{
+		Key:            string(kv.Key),
+		Value:          string(kv.Value),
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+	}
+}
+
+func (kv *KeyValue) raw() *mvccpb.KeyValue {
+	return &mvccpb.KeyValue{
+		Key:            []byte(kv.Key),
+		Value:          []byte(kv.Value),
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+	}
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return codectool.MarshalJSON(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return codectool.UnmarshalJSON(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
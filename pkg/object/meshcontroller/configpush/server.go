@@ -0,0 +1,364 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configpush
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/certmanager"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/layout"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	syncerPullInterval = time.Minute
+	keepaliveTime      = 30 * time.Second
+	keepaliveTimeout   = 10 * time.Second
+
+	// masterCertTTL is the TTL of the cert of the server, it is signed
+	// again when half of the TTL passed or the root cert changed.
+	masterCertTTL = 24 * time.Hour
+)
+
+type (
+	// Server runs in masters, it watches etcd once for all workers and
+	// pushes the configuration of every subscribed instance to it.
+	Server struct {
+		cls        cluster.Cluster
+		name       string
+		grpcServer *grpc.Server
+
+		certMutex  sync.Mutex
+		rootCert   string
+		cert       *tls.Certificate
+		certExpire time.Time
+
+		mutex       sync.RWMutex
+		ready       bool
+		data        map[string]map[string]*mvccpb.KeyValue // prefix -> key -> kv
+		syncers     []cluster.Syncer
+		subscribers map[*subscriber]struct{}
+
+		done chan struct{}
+	}
+
+	subscriber struct {
+		notify chan struct{}
+	}
+)
+
+// NewServer creates a config push server listening on the port, name is
+// the member name of the master.
+func NewServer(cls cluster.Cluster, port int, name string) *Server {
+	s := newServer(cls, name)
+	go s.run(port)
+	return s
+}
+
+func newServer(cls cluster.Cluster, name string) *Server {
+	s := &Server{
+		cls:         cls,
+		name:        name,
+		data:        make(map[string]map[string]*mvccpb.KeyValue),
+		subscribers: make(map[*subscriber]struct{}),
+		done:        make(chan struct{}),
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ClientAuth:         tls.RequireAndVerifyClientCert,
+		GetConfigForClient: s.tlsConfig,
+	}
+	s.grpcServer = grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.ForceServerCodec(jsonCodec{}),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    keepaliveTime,
+			Timeout: keepaliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             keepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+	)
+	s.grpcServer.RegisterService(&serviceDesc, s)
+
+	return s
+}
+
+func (s *Server) run(port int) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		logger.Errorf("config push server listen on %d failed: %v", port, err)
+		return
+	}
+
+	logger.Infof("config push server listens on %d", port)
+	s.serve(listener)
+}
+
+func (s *Server) serve(listener net.Listener) {
+	for !s.load() {
+		select {
+		case <-s.done:
+			listener.Close()
+			return
+		case <-time.After(time.Second):
+		}
+	}
+
+	if err := s.grpcServer.Serve(listener); err != nil {
+		logger.Errorf("config push server serve failed: %v", err)
+	}
+}
+
+// tlsConfig returns the TLS config for a connection, so that the rotated
+// root cert is used by new connections.
+func (s *Server) tlsConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	value, err := s.cls.Get(layout.RootCertKey())
+	if err != nil {
+		return nil, fmt.Errorf("get root cert failed: %v", err)
+	}
+	root, err := unmarshalCert(value)
+	if err != nil {
+		return nil, fmt.Errorf("root cert: %v", err)
+	}
+	pool, err := certPool(root)
+	if err != nil {
+		return nil, err
+	}
+
+	s.certMutex.Lock()
+	defer s.certMutex.Unlock()
+
+	if s.cert == nil || s.rootCert != root.CertBase64 || time.Now().After(s.certExpire) {
+		cert, err := certmanager.SignMasterCert(root, s.name, masterCertTTL)
+		if err != nil {
+			return nil, fmt.Errorf("sign master cert failed: %v", err)
+		}
+		tc, err := tlsCert(cert)
+		if err != nil {
+			return nil, err
+		}
+		s.cert = &tc
+		s.rootCert = root.CertBase64
+		s.certExpire = time.Now().Add(masterCertTTL / 2)
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*s.cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		NextProtos:   []string{"h2"},
+	}, nil
+}
+
+// load loads the pushed data and starts to watch it, subscribers are
+// rejected until it succeeds, so that they never get a partial snapshot.
+func (s *Server) load() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	for _, prefix := range pushedPrefixes {
+		kvs, err := s.cls.GetRawPrefix(prefix)
+		if err != nil {
+			logger.Errorf("config push server load %s failed: %v", prefix, err)
+			s.closeSyncers()
+			return false
+		}
+		s.data[prefix] = kvs
+
+		syncer, err := s.cls.Syncer(syncerPullInterval)
+		if err != nil {
+			logger.Errorf("config push server create syncer failed: %v", err)
+			s.closeSyncers()
+			return false
+		}
+		ch, err := syncer.SyncRawPrefix(prefix)
+		if err != nil {
+			logger.Errorf("config push server sync %s failed: %v", prefix, err)
+			syncer.Close()
+			s.closeSyncers()
+			return false
+		}
+		s.syncers = append(s.syncers, syncer)
+
+		go s.sync(prefix, ch)
+	}
+
+	s.ready = true
+	return true
+}
+
+func (s *Server) closeSyncers() {
+	for _, syncer := range s.syncers {
+		syncer.Close()
+	}
+	s.syncers = nil
+}
+
+func (s *Server) sync(prefix string, ch <-chan map[string]*mvccpb.KeyValue) {
+	for kvs := range ch {
+		s.mutex.Lock()
+		s.data[prefix] = kvs
+		for sub := range s.subscribers {
+			select {
+			case sub.notify <- struct{}{}:
+			default:
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+func subscribeHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(*Server).subscribe(stream)
+}
+
+func (s *Server) subscribe(stream grpc.ServerStream) error {
+	req := &SubscribeRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	if err := checkIdentity(stream.Context(), req); err != nil {
+		logger.Warnf("reject config push subscription of %s/%s: %v", req.ServiceName, req.InstanceID, err)
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	sub := &subscriber{notify: make(chan struct{}, 1)}
+	if !s.addSubscriber(sub) {
+		return status.Error(codes.Unavailable, "config push server is not ready")
+	}
+	defer s.removeSubscriber(sub)
+
+	logger.Infof("%s/%s subscribed to config push", req.ServiceName, req.InstanceID)
+
+	// sent records the mod revision of every key which has been sent.
+	sent := make(map[string]int64)
+	snapshot := s.diff(req, sent)
+	snapshot.Full = true
+
+	var version uint64
+	for {
+		if snapshot.Full || len(snapshot.Puts) != 0 || len(snapshot.Deletes) != 0 {
+			version++
+			snapshot.Version = version
+			if err := stream.SendMsg(snapshot); err != nil {
+				logger.Warnf("push config to %s/%s failed: %v", req.ServiceName, req.InstanceID, err)
+				return err
+			}
+		}
+
+		select {
+		case <-sub.notify:
+		case <-stream.Context().Done():
+			return nil
+		case <-s.done:
+			return nil
+		}
+
+		snapshot = s.diff(req, sent)
+	}
+}
+
+// diff computes the changes of the configuration of the instance since
+// the last snapshot, and updates sent accordingly.
+func (s *Server) diff(req *SubscribeRequest, sent map[string]int64) *Snapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	snapshot := &Snapshot{}
+	current := make(map[string]struct{}, len(sent))
+	for _, kvs := range s.data {
+		for key, kv := range kvs {
+			if !req.isVisible(key) {
+				continue
+			}
+			current[key] = struct{}{}
+
+			if rev, exists := sent[key]; exists && rev == kv.ModRevision {
+				continue
+			}
+			sent[key] = kv.ModRevision
+			snapshot.Puts = append(snapshot.Puts, newKeyValue(kv))
+		}
+	}
+
+	for key := range sent {
+		if _, exists := current[key]; !exists {
+			delete(sent, key)
+			snapshot.Deletes = append(snapshot.Deletes, key)
+		}
+	}
+
+	return snapshot
+}
+
+func (s *Server) addSubscriber(sub *subscriber) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.ready {
+		return false
+	}
+	s.subscribers[sub] = struct{}{}
+	return true
+}
+
+func (s *Server) removeSubscriber(sub *subscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.subscribers, sub)
+}
+
+// Subscribers returns the number of the subscribed workers.
+func (s *Server) Subscribers() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return len(s.subscribers)
+}
+
+// Close closes the server.
+func (s *Server) Close() {
+	s.mutex.Lock()
+	close(s.done)
+	s.closeSyncers()
+	s.mutex.Unlock()
+
+	s.grpcServer.Stop()
+}
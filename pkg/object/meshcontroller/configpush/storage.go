@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configpush
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/storage"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type (
+	pushStorage struct {
+		storage.Storage
+		client *Client
+	}
+
+	// syncer serves the pushed keys from the replica of the client, and
+	// falls back to the syncer of the storage for the others.
+	syncer struct {
+		client *Client
+		store  storage.Storage
+
+		mutex    sync.Mutex
+		fallback cluster.Syncer
+		done     chan struct{}
+	}
+)
+
+var _ cluster.Syncer = (*syncer)(nil)
+
+// NewStorage wraps the storage, the reads and writes still go to the
+// storage, but the syncers are served by the client instead of etcd watches.
+func NewStorage(store storage.Storage, client *Client) storage.Storage {
+	return &pushStorage{
+		Storage: store,
+		client:  client,
+	}
+}
+
+func (ps *pushStorage) Syncer() (cluster.Syncer, error) {
+	return &syncer{
+		client: ps.client,
+		store:  ps.Storage,
+		done:   make(chan struct{}),
+	}, nil
+}
+
+func (s *syncer) getFallback() (cluster.Syncer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.fallback != nil {
+		return s.fallback, nil
+	}
+
+	fallback, err := s.store.Syncer()
+	if err != nil {
+		return nil, err
+	}
+	s.fallback = fallback
+	return fallback, nil
+}
+
+func (s *syncer) run(key string, prefix bool, send func(data map[string]*mvccpb.KeyValue)) {
+	w := &watcher{notify: make(chan struct{}, 1)}
+	s.client.addWatcher(w)
+	defer s.client.removeWatcher(w)
+
+	data := make(map[string]*mvccpb.KeyValue)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-w.notify:
+			newData := s.client.get(key, prefix)
+			if !isDataEqual(data, newData) {
+				data = newData
+				send(data)
+			}
+		}
+	}
+}
+
+// Sync syncs a given key's value through the returned channel.
+func (s *syncer) Sync(key string) (<-chan *string, error) {
+	if !isPushed(key) {
+		fallback, err := s.getFallback()
+		if err != nil {
+			return nil, err
+		}
+		return fallback.Sync(key)
+	}
+
+	ch := make(chan *string, 10)
+
+	fn := func(data map[string]*mvccpb.KeyValue) {
+		if kv := data[key]; kv == nil {
+			ch <- nil
+		} else {
+			value := string(kv.Value)
+			ch <- &value
+		}
+	}
+
+	go func() {
+		defer close(ch)
+		s.run(key, false, fn)
+	}()
+
+	return ch, nil
+}
+
+// SyncRaw syncs a given key's raw mvccpb structure through the returned channel.
+func (s *syncer) SyncRaw(key string) (<-chan *mvccpb.KeyValue, error) {
+	if !isPushed(key) {
+		fallback, err := s.getFallback()
+		if err != nil {
+			return nil, err
+		}
+		return fallback.SyncRaw(key)
+	}
+
+	ch := make(chan *mvccpb.KeyValue, 10)
+
+	fn := func(data map[string]*mvccpb.KeyValue) {
+		ch <- data[key]
+	}
+
+	go func() {
+		defer close(ch)
+		s.run(key, false, fn)
+	}()
+
+	return ch, nil
+}
+
+// SyncPrefix syncs the values of the keys with the same prefix through the returned channel.
+func (s *syncer) SyncPrefix(prefix string) (<-chan map[string]string, error) {
+	if !isPushed(prefix) {
+		fallback, err := s.getFallback()
+		if err != nil {
+			return nil, err
+		}
+		return fallback.SyncPrefix(prefix)
+	}
+
+	ch := make(chan map[string]string, 10)
+
+	fn := func(data map[string]*mvccpb.KeyValue) {
+		m := make(map[string]string, len(data))
+		for k, v := range data {
+			m[k] = string(v.Value)
+		}
+		ch <- m
+	}
+
+	go func() {
+		defer close(ch)
+		s.run(prefix, true, fn)
+	}()
+
+	return ch, nil
+}
+
+// SyncRawPrefix syncs the keys with the same prefix in raw mvccpb structure
+// format through the returned channel.
+func (s *syncer) SyncRawPrefix(prefix string) (<-chan map[string]*mvccpb.KeyValue, error) {
+	if !isPushed(prefix) {
+		fallback, err := s.getFallback()
+		if err != nil {
+			return nil, err
+		}
+		return fallback.SyncRawPrefix(prefix)
+	}
+
+	ch := make(chan map[string]*mvccpb.KeyValue, 10)
+
+	fn := func(data map[string]*mvccpb.KeyValue) {
+		ch <- data
+	}
+
+	go func() {
+		defer close(ch)
+		s.run(prefix, true, fn)
+	}()
+
+	return ch, nil
+}
+
+// Close closes the syncer.
+func (s *syncer) Close() {
+	close(s.done)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.fallback != nil {
+		s.fallback.Close()
+	}
+}
+
+func isDataEqual(data1, data2 map[string]*mvccpb.KeyValue) bool {
+	if len(data1) != len(data2) {
+		return false
+	}
+
+	for k, kv1 := range data1 {
+		kv2, exists := data2[k]
+		if !exists || !bytes.Equal(kv1.Value, kv2.Value) {
+			return false
+		}
+	}
+
+	return true
+}
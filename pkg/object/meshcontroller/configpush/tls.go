@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configpush
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// The servers and clients authenticate each other with the certs signed
+// by the mesh root cert. A client presents the cert of its instance, and
+// can only subscribe to the configuration of the instance. A server
+// presents a cert of the master signed by itself.
+
+func unmarshalCert(value *string) (*spec.Certificate, error) {
+	if value == nil {
+		return nil, fmt.Errorf("cert not found")
+	}
+	cert := &spec.Certificate{}
+	if err := codectool.Unmarshal([]byte(*value), cert); err != nil {
+		return nil, fmt.Errorf("unmarshal cert failed: %v", err)
+	}
+	return cert, nil
+}
+
+func tlsCert(cert *spec.Certificate) (tls.Certificate, error) {
+	certPEM, err := base64.StdEncoding.DecodeString(cert.CertBase64)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("decode cert failed: %v", err)
+	}
+	keyPEM, err := base64.StdEncoding.DecodeString(cert.KeyBase64)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("decode key failed: %v", err)
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// certPool returns the pool of the root cert, only the cert is used.
+func certPool(root *spec.Certificate) (*x509.CertPool, error) {
+	certPEM, err := base64.StdEncoding.DecodeString(root.CertBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decode root cert failed: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(certPEM) {
+		return nil, fmt.Errorf("no root cert in pem")
+	}
+	return pool, nil
+}
+
+// verifyMaster returns the function verifying the cert of a server is
+// signed by the root cert and identifies a mesh master. The address of the
+// server is not verified, as the certs are not bound to addresses.
+func verifyMaster(pool *x509.CertPool) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("no server cert")
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("parse server cert failed: %v", err)
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         pool,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		if err != nil {
+			return fmt.Errorf("verify server cert failed: %v", err)
+		}
+
+		for _, u := range certs[0].URIs {
+			if spec.IsMasterIdentity(u) {
+				return nil
+			}
+		}
+		return fmt.Errorf("server cert is not of a mesh master")
+	}
+}
+
+// checkIdentity checks the verified client cert identifies the instance
+// of the request.
+func checkIdentity(ctx context.Context, req *SubscribeRequest) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return fmt.Errorf("no peer")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return fmt.Errorf("no verified client cert")
+	}
+
+	identity := spec.InstanceIdentity(req.ServiceName, req.InstanceID).String()
+	for _, u := range info.State.VerifiedChains[0][0].URIs {
+		if u.String() == identity {
+			return nil
+		}
+	}
+	return fmt.Errorf("client cert is not of %s/%s", req.ServiceName, req.InstanceID)
+}
@@ -0,0 +1,316 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package egressgateway implements the egress gateway for service mesh.
+package egressgateway
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/informer"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/storage"
+	"github.com/megaease/easegress/v2/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+type (
+	// EgressGateway is the egress gateway, one instance of it serves the
+	// egress gateway spec with the same name.
+	EgressGateway struct {
+		mutex sync.Mutex
+
+		superSpec *supervisor.Spec
+
+		name       string
+		informer   informer.Informer
+		service    *service.Service
+		tc         *trafficcontroller.TrafficController
+		instanceID string
+		IP         string
+		namespace  string
+
+		heartbeatInterval time.Duration
+		// instance is the registered instance spec, nil means the
+		// instance is not registered.
+		instance          *spec.ServiceInstanceSpec
+		lastHeartbeatTime string
+
+		httpServer *supervisor.ObjectEntity
+		// key is the host of the external service.
+		pipelines map[string]*supervisor.ObjectEntity
+
+		done chan struct{}
+	}
+
+	// Status is the status of EgressGateway.
+	Status struct {
+		Name       string `json:"name"`
+		InstanceID string `json:"instanceID"`
+		IP         string `json:"ip"`
+
+		// The fields below are empty if the instance is not registered.
+		Port              uint32 `json:"port,omitempty"`
+		InstanceStatus    string `json:"instanceStatus,omitempty"`
+		LastHeartbeatTime string `json:"lastHeartbeatTime,omitempty"`
+	}
+)
+
+// New creates a mesh egress gateway.
+func New(superSpec *supervisor.Spec, name string) *EgressGateway {
+	entity, exists := superSpec.Super().GetSystemController(trafficcontroller.Kind)
+	if !exists {
+		panic(fmt.Errorf("BUG: traffic controller not found"))
+	}
+
+	tc, ok := entity.Instance().(*trafficcontroller.TrafficController)
+	if !ok {
+		panic(fmt.Errorf("BUG: want *TrafficController, got %T", entity.Instance()))
+	}
+
+	store := storage.New(superSpec.Name(), superSpec.Super().Cluster())
+
+	instanceID := os.Getenv(spec.PodEnvHostname)
+	applicationIP := os.Getenv(spec.PodEnvApplicationIP)
+
+	if len(instanceID) == 0 || len(applicationIP) == 0 {
+		panic(fmt.Errorf("need environment HOSTNAME: %s and APPLICATION_IP: %s to start egress gateway", instanceID, applicationIP))
+	}
+
+	heartbeatInterval, err := time.ParseDuration(superSpec.ObjectSpec().(*spec.Admin).HeartbeatInterval)
+	if err != nil {
+		logger.Errorf("BUG: parse heartbeat interval failed: %v, fallback to default(5s)", err)
+		heartbeatInterval = 5 * time.Second
+	}
+
+	eg := &EgressGateway{
+		superSpec: superSpec,
+
+		name:       name,
+		informer:   informer.NewInformer(store, ""),
+		service:    service.New(superSpec),
+		tc:         tc,
+		namespace:  superSpec.Name(),
+		instanceID: instanceID,
+		IP:         applicationIP,
+
+		heartbeatInterval: heartbeatInterval,
+
+		pipelines: make(map[string]*supervisor.ObjectEntity),
+		done:      make(chan struct{}),
+	}
+
+	err = eg.informer.OnPartOfEgressGatewaySpec(name, eg.handleEgressGateway)
+	if err != nil && err != informer.ErrAlreadyWatched {
+		logger.Errorf("watch egress gateway %s failed: %v", name, err)
+	}
+
+	eg.reload(eg.service.GetEgressGatewaySpec(name))
+
+	go eg.heartbeat()
+
+	return eg
+}
+
+// heartbeat reports the heartbeat of the registered instance, the master
+// brings the instance down if no heartbeat and cleans it finally, so the
+// instance is registered again if it has been cleaned.
+func (eg *EgressGateway) heartbeat() {
+	routine := func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Errorf("%s: heartbeat recover from: %v, stack trace:\n%s\n",
+					eg.superSpec.Name(), err, debug.Stack())
+			}
+		}()
+
+		eg.mutex.Lock()
+		defer eg.mutex.Unlock()
+
+		if eg.instance == nil {
+			return
+		}
+
+		eg.updateHeartbeat()
+
+		instance := eg.service.GetEgressGatewayInstanceSpec(eg.name, eg.instanceID)
+		if instance == nil {
+			logger.Warnf("egress gateway %s/%s was cleaned, register it again", eg.name, eg.instanceID)
+			eg.instance.Status = spec.ServiceStatusUp
+			eg.service.PutEgressGatewayInstanceSpec(eg.instance)
+			return
+		}
+		// the status is updated by the master according to the heartbeat.
+		eg.instance.Status = instance.Status
+	}
+
+	for {
+		select {
+		case <-eg.done:
+			return
+		case <-time.After(eg.heartbeatInterval):
+			routine()
+		}
+	}
+}
+
+func (eg *EgressGateway) updateHeartbeat() {
+	eg.lastHeartbeatTime = time.Now().Format(time.RFC3339)
+	eg.service.PutEgressGatewayInstanceStatus(&spec.ServiceInstanceStatus{
+		ServiceName:       eg.name,
+		InstanceID:        eg.instanceID,
+		LastHeartbeatTime: eg.lastHeartbeatTime,
+	})
+}
+
+func (eg *EgressGateway) deregister() {
+	eg.instance = nil
+	eg.lastHeartbeatTime = ""
+	eg.service.DeleteEgressGatewayInstanceSpec(eg.name, eg.instanceID)
+	eg.service.DeleteEgressGatewayInstanceStatus(eg.name, eg.instanceID)
+}
+
+func (eg *EgressGateway) handleEgressGateway(event informer.Event, egressGateway *spec.EgressGateway) (continueWatch bool) {
+	continueWatch = true
+
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("%s: handleEgressGateway recover from: %v, stack trace:\n%s\n",
+				eg.superSpec.Name(), err, debug.Stack())
+		}
+	}()
+
+	if event.EventType == informer.EventDelete {
+		eg.reload(nil)
+	} else {
+		eg.reload(egressGateway)
+	}
+
+	return
+}
+
+// reload applies the egress gateway spec, nil means the spec doesn't exist
+// and all the traffic of this instance is stopped.
+func (eg *EgressGateway) reload(egressGateway *spec.EgressGateway) {
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+
+	if egressGateway == nil {
+		logger.Warnf("egress gateway %s not found", eg.name)
+		eg.deregister()
+		eg.tc.Clean(eg.namespace)
+		eg.httpServer = nil
+		eg.pipelines = make(map[string]*supervisor.ObjectEntity)
+		return
+	}
+
+	pipelines := make(map[string]*supervisor.ObjectEntity)
+	for _, es := range egressGateway.ExternalServices {
+		superSpec, err := egressGateway.PipelineSpec(es)
+		if err != nil {
+			logger.Errorf("get egress gateway pipeline for %s failed: %v", es.Host, err)
+			continue
+		}
+
+		entity, err := eg.tc.ApplyPipelineForSpec(eg.namespace, superSpec)
+		if err != nil {
+			logger.Errorf("apply http pipeline %s failed: %v", superSpec.Name(), err)
+			continue
+		}
+
+		pipelines[es.Host] = entity
+	}
+
+	for host, entity := range eg.pipelines {
+		if _, exists := pipelines[host]; exists {
+			continue
+		}
+		err := eg.tc.DeletePipeline(eg.namespace, entity.Spec().Name())
+		if err != nil {
+			logger.Errorf("delete http pipeline %s failed: %v", entity.Spec().Name(), err)
+		}
+	}
+	eg.pipelines = pipelines
+
+	superSpec, err := egressGateway.HTTPServerSpec()
+	if err != nil {
+		logger.Errorf("get egress gateway http server spec failed: %v", err)
+		return
+	}
+
+	if eg.httpServer != nil && eg.httpServer.Spec().Name() != superSpec.Name() {
+		eg.tc.DeleteTrafficGate(eg.namespace, eg.httpServer.Spec().Name())
+	}
+
+	entity, err := eg.tc.ApplyTrafficGateForSpec(eg.namespace, superSpec)
+	if err != nil {
+		logger.Errorf("apply http server failed: %v", err)
+		return
+	}
+	eg.httpServer = entity
+
+	// the status is reported before the spec, otherwise the master
+	// cleans the instance without status.
+	eg.updateHeartbeat()
+	eg.instance = &spec.ServiceInstanceSpec{
+		ServiceName: eg.name,
+		InstanceID:  eg.instanceID,
+		IP:          eg.IP,
+		Port:        uint32(egressGateway.ListenPort()),
+		Status:      spec.ServiceStatusUp,
+	}
+	eg.service.PutEgressGatewayInstanceSpec(eg.instance)
+}
+
+// Status returns the status of EgressGateway.
+func (eg *EgressGateway) Status() *supervisor.Status {
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+
+	status := &Status{
+		Name:       eg.name,
+		InstanceID: eg.instanceID,
+		IP:         eg.IP,
+	}
+	if eg.instance != nil {
+		status.Port = eg.instance.Port
+		status.InstanceStatus = eg.instance.Status
+		status.LastHeartbeatTime = eg.lastHeartbeatTime
+	}
+
+	return &supervisor.Status{
+		ObjectStatus: status,
+	}
+}
+
+// Close closes the egress gateway.
+func (eg *EgressGateway) Close() {
+	close(eg.done)
+
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+
+	eg.informer.Close()
+	eg.deregister()
+	eg.tc.Clean(eg.namespace)
+}
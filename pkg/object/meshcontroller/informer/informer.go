@@ -84,6 +84,15 @@ type (
 	// IngressSpecsFunc is the callback function type for ingress specs.
 	IngressSpecsFunc func(value map[string]*spec.Ingress) bool
 
+	// TLSSecretsFunc is the callback function type for TLS secrets.
+	TLSSecretsFunc func(value map[string]*spec.TLSSecret) bool
+
+	// WasmModulesFunc is the callback function type for WebAssembly modules.
+	WasmModulesFunc func(value map[string]*spec.WasmModule) bool
+
+	// EgressGatewaySpecFunc is the callback function type for egress gateway spec.
+	EgressGatewaySpecFunc func(event Event, value *spec.EgressGateway) bool
+
 	// ServiceCertsFunc is the callback function type for service certs.
 	ServiceCertsFunc func(value map[string]*spec.Certificate) bool
 
@@ -129,6 +138,13 @@ type (
 		OnPartOfIngressSpec(serviceName string, fn IngressSpecFunc) error
 		OnAllIngressSpecs(fn IngressSpecsFunc) error
 
+		OnAllTLSSecrets(fn TLSSecretsFunc) error
+
+		OnAllWasmModules(fn WasmModulesFunc) error
+
+		OnPartOfEgressGatewaySpec(name string, fn EgressGatewaySpecFunc) error
+		OnEgressGatewayInstanceSpecs(name string, fn ServiceInstanceSpecsFunc) error
+
 		OnPartOfHTTPRouteGroupSpec(groupName string, fn HTTPRouteGroupSpecFunc) error
 		OnAllHTTPRouteGroupSpecs(fn HTTPRouteGroupSpecsFunc) error
 
@@ -614,6 +630,92 @@ func (inf *meshInformer) OnAllIngressSpecs(fn IngressSpecsFunc) error {
 	return inf.onSpecs(storeKey, syncerKey, specsFunc)
 }
 
+// OnAllTLSSecrets watches all TLS secrets
+func (inf *meshInformer) OnAllTLSSecrets(fn TLSSecretsFunc) error {
+	storeKey := layout.TLSSecretPrefix()
+	syncerKey := "prefix-tls-secret"
+
+	specsFunc := func(kvs map[string]string) bool {
+		secrets := make(map[string]*spec.TLSSecret)
+		for k, v := range kvs {
+			secret := &spec.TLSSecret{}
+			if err := codectool.Unmarshal([]byte(v), secret); err != nil {
+				logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+				continue
+			}
+			secrets[k] = secret
+		}
+
+		return fn(secrets)
+	}
+
+	return inf.onSpecs(storeKey, syncerKey, specsFunc)
+}
+
+// OnAllWasmModules watches all WebAssembly modules
+func (inf *meshInformer) OnAllWasmModules(fn WasmModulesFunc) error {
+	storeKey := layout.WasmModulePrefix()
+	syncerKey := "prefix-wasm-module"
+
+	specsFunc := func(kvs map[string]string) bool {
+		modules := make(map[string]*spec.WasmModule)
+		for k, v := range kvs {
+			module := &spec.WasmModule{}
+			if err := codectool.Unmarshal([]byte(v), module); err != nil {
+				logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+				continue
+			}
+			modules[k] = module
+		}
+
+		return fn(modules)
+	}
+
+	return inf.onSpecs(storeKey, syncerKey, specsFunc)
+}
+
+// OnPartOfEgressGatewaySpec watches one egress gateway's spec
+func (inf *meshInformer) OnPartOfEgressGatewaySpec(name string, fn EgressGatewaySpecFunc) error {
+	storeKey := layout.EgressGatewaySpecKey(name)
+	syncerKey := fmt.Sprintf("egress-gateway-spec-%s", name)
+
+	specFunc := func(event Event, value string) bool {
+		egressGateway := &spec.EgressGateway{}
+		if event.EventType != EventDelete {
+			if err := codectool.Unmarshal([]byte(value), egressGateway); err != nil {
+				logger.Errorf("BUG: unmarshal %s to json failed: %v", value, err)
+				return true
+			}
+		}
+		return fn(event, egressGateway)
+	}
+
+	return inf.onSpecPart(storeKey, syncerKey, specFunc)
+}
+
+// OnEgressGatewayInstanceSpecs watches all instance specs of an egress gateway,
+// egress gateways are mesh wide, so the instances are not filtered by tenant.
+func (inf *meshInformer) OnEgressGatewayInstanceSpecs(name string, fn ServiceInstanceSpecsFunc) error {
+	storeKey := layout.EgressGatewayInstanceSpecPrefix(name)
+	syncerKey := fmt.Sprintf("prefix-egress-gateway-instance-spec-%s", name)
+
+	specsFunc := func(kvs map[string]string) bool {
+		instanceSpecs := make(map[string]*spec.ServiceInstanceSpec)
+		for k, v := range kvs {
+			instanceSpec := &spec.ServiceInstanceSpec{}
+			if err := codectool.Unmarshal([]byte(v), instanceSpec); err != nil {
+				logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+				continue
+			}
+			instanceSpecs[k] = instanceSpec
+		}
+
+		return fn(instanceSpecs)
+	}
+
+	return inf.onSpecs(storeKey, syncerKey, specsFunc)
+}
+
 func (inf *meshInformer) onCert(storeKey, syncerKey string, fn CertFunc) error {
 	specFunc := func(event Event, value string) bool {
 		cert := &spec.Certificate{}
@@ -49,10 +49,17 @@ type (
 		namespace  string
 
 		httpServer *supervisor.ObjectEntity
+		tlsServer  *supervisor.ObjectEntity
 		// key is the backend name instead of pipeline name.
 		backendPipelines map[string]*supervisor.ObjectEntity
 		ingressBackends  map[string]struct{}
 		ingressRules     []*spec.IngressRule
+		// key is the host, value is the secret name.
+		ingressTLSHosts map[string]string
+
+		federationServer *supervisor.ObjectEntity
+		// key is the service name.
+		federationPipelines map[string]*supervisor.ObjectEntity
 	}
 
 	// Status is the traffic controller status
@@ -92,8 +99,11 @@ func New(superSpec *supervisor.Spec) *IngressController {
 		backendPipelines: make(map[string]*supervisor.ObjectEntity),
 		ingressBackends:  make(map[string]struct{}),
 		ingressRules:     []*spec.IngressRule{},
+		ingressTLSHosts:  make(map[string]string),
 		instanceID:       instanceID,
 		IP:               applicationIP,
+
+		federationPipelines: make(map[string]*supervisor.ObjectEntity),
 	}
 
 	ic.putIngressControllerInstance()
@@ -125,6 +135,11 @@ func New(superSpec *supervisor.Spec) *IngressController {
 		}
 	}
 
+	err = ic.informer.OnAllTLSSecrets(ic.handleTLSSecrets)
+	if err != nil && err != informer.ErrAlreadyWatched {
+		logger.Errorf("watch tls secret failed: %v", err)
+	}
+
 	ic.reloadTraffic()
 
 	return ic
@@ -215,6 +230,21 @@ func (ic *IngressController) handleServiceCanaries(serviceCanaries map[string]*s
 	return
 }
 
+func (ic *IngressController) handleTLSSecrets(secrets map[string]*spec.TLSSecret) (continueWatch bool) {
+	continueWatch = true
+
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("%s: handleTLSSecrets recover from: %v, stack trace:\n%s\n",
+				ic.superSpec.Name(), err, debug.Stack())
+		}
+	}()
+
+	ic.reloadTraffic()
+
+	return
+}
+
 func (ic *IngressController) reloadTraffic() {
 	ic.mutex.Lock()
 	defer ic.mutex.Unlock()
@@ -222,11 +252,20 @@ func (ic *IngressController) reloadTraffic() {
 	ic._reloadIngress()
 	ic._reloadPipelines()
 	ic._reloadHTTPServer()
+	ic._reloadTLSServer()
+	ic._reloadFederationGateway()
 }
 
 func (ic *IngressController) _reloadIngress() {
 	ingressBackends, ingressRules := make(map[string]struct{}), []*spec.IngressRule{}
+	ingressTLSHosts := make(map[string]string)
 	for _, ingress := range ic.service.ListIngressSpecs() {
+		for _, tls := range ingress.TLS {
+			for _, host := range tls.Hosts {
+				ingressTLSHosts[host] = tls.SecretName
+			}
+		}
+
 		for _, rule := range ingress.Rules {
 			for _, path := range rule.Paths {
 				ingressBackends[path.Backend] = struct{}{}
@@ -241,6 +280,7 @@ func (ic *IngressController) _reloadIngress() {
 	}
 
 	ic.ingressBackends, ic.ingressRules = ingressBackends, ingressRules
+	ic.ingressTLSHosts = ingressTLSHosts
 }
 
 func (ic *IngressController) _reloadPipelines() {
@@ -316,6 +356,137 @@ func (ic *IngressController) _reloadHTTPServer() {
 	ic.httpServer = entity
 }
 
+func (ic *IngressController) _reloadTLSServer() {
+	port := ic.spec.IngressTLSPort
+	if port == 0 {
+		if len(ic.ingressTLSHosts) > 0 {
+			logger.Warnf("ingress TLS port is not configured, TLS of ingresses is ignored")
+		}
+		return
+	}
+
+	var rules []*spec.IngressRule
+	var secrets []*spec.TLSSecret
+	secretAdded := make(map[string]struct{})
+	for _, rule := range ic.ingressRules {
+		secretName, exists := ic.ingressTLSHosts[rule.Host]
+		if !exists {
+			continue
+		}
+
+		if _, added := secretAdded[secretName]; !added {
+			secret := ic.service.GetTLSSecret(secretName)
+			if secret == nil {
+				logger.Errorf("tls secret %s of host %s not found", secretName, rule.Host)
+				continue
+			}
+			secrets = append(secrets, secret)
+			secretAdded[secretName] = struct{}{}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if len(secrets) == 0 {
+		if ic.tlsServer != nil {
+			err := ic.tc.DeleteTrafficGate(ic.namespace, ic.tlsServer.Spec().Name())
+			if err != nil {
+				logger.Errorf("delete https server failed: %v", err)
+			}
+			ic.tlsServer = nil
+		}
+		return
+	}
+
+	superSpec, err := spec.IngressControllerTLSServerSpec(port, rules, secrets)
+	if err != nil {
+		logger.Errorf("get ingress https server spec failed: %v", err)
+		return
+	}
+
+	entity, err := ic.tc.ApplyTrafficGateForSpec(ic.namespace, superSpec)
+	if err != nil {
+		logger.Errorf("apply https server failed: %v", err)
+		return
+	}
+
+	ic.tlsServer = entity
+}
+
+// _reloadFederationGateway routes the traffic from federation peers to the
+// local instances of the services.
+func (ic *IngressController) _reloadFederationGateway() {
+	if ic.spec.Federation == nil {
+		return
+	}
+
+	var cert, rootCert *spec.Certificate
+	if ic.spec.EnablemTLS() {
+		cert = ic.service.GetIngressControllerInstanceCert(ic.instanceID)
+		rootCert = ic.service.GetRootCert()
+	}
+
+	canaries := ic.service.ListServiceCanaries()
+	pipelines := make(map[string]*supervisor.ObjectEntity)
+	var services []*spec.Service
+	for _, serviceSpec := range ic.service.ListServiceSpecs() {
+		if serviceSpec.IsFederated() {
+			continue
+		}
+
+		instanceSpecs := ic.service.ListServiceInstanceSpecs(serviceSpec.Name)
+		upInstance := 0
+		for _, instanceSpec := range instanceSpecs {
+			if !instanceSpec.IsFederated() && instanceSpec.Status == spec.ServiceStatusUp {
+				upInstance++
+			}
+		}
+		if upInstance == 0 {
+			continue
+		}
+
+		superSpec, err := serviceSpec.FederationGatewayPipelineSpec(instanceSpecs, canaries, cert, rootCert)
+		if err != nil {
+			logger.Errorf("get federation gateway pipeline for %s failed: %v",
+				serviceSpec.Name, err)
+			continue
+		}
+
+		entity, err := ic.tc.ApplyPipelineForSpec(ic.namespace, superSpec)
+		if err != nil {
+			logger.Errorf("apply http pipeline %s failed: %v", superSpec.Name(), err)
+			continue
+		}
+
+		pipelines[serviceSpec.Name] = entity
+		services = append(services, serviceSpec)
+	}
+
+	superSpec, err := spec.FederationGatewayHTTPServerSpec(ic.spec.Federation.ListenPort(), services)
+	if err != nil {
+		logger.Errorf("get federation gateway http server spec failed: %v", err)
+	} else {
+		entity, err := ic.tc.ApplyTrafficGateForSpec(ic.namespace, superSpec)
+		if err != nil {
+			logger.Errorf("apply federation gateway http server failed: %v", err)
+		} else {
+			ic.federationServer = entity
+		}
+	}
+
+	for name, entity := range ic.federationPipelines {
+		if _, exists := pipelines[name]; exists {
+			continue
+		}
+		err := ic.tc.DeletePipeline(ic.namespace, entity.Spec().Name())
+		if err != nil {
+			logger.Errorf("delete http pipeline %s failed: %v",
+				entity.Spec().Name(), err)
+		}
+	}
+	ic.federationPipelines = pipelines
+}
+
 // Status returns the status of IngressController.
 func (ic *IngressController) Status() *supervisor.Status {
 	return &supervisor.Status{
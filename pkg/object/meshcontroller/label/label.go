@@ -18,6 +18,12 @@
 // Package label defines labels.
 package label
 
+import (
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
 const (
 	// KeyRole is the key of role
 	KeyRole = "mesh-role"
@@ -29,6 +35,8 @@ const (
 	KeyApplicationPort = "mesh-application-port"
 	// KeyAliveProbe is the key of keepalive probe
 	KeyAliveProbe = "mesh-alive-probe"
+	// KeyEgressGatewayName is the key of egress gateway name
+	KeyEgressGatewayName = "mesh-egress-gateway-name"
 
 	// ValueRoleMaster is the name of master
 	ValueRoleMaster = "master"
@@ -36,4 +44,34 @@ const (
 	ValueRoleWorker = "worker"
 	// ValueRoleIngressController is the name of ingress controller
 	ValueRoleIngressController = "ingress-controller"
+	// ValueRoleEgressGateway is the name of egress gateway
+	ValueRoleEgressGateway = "egress-gateway"
+
+	// AnnotationServiceName is the annotation of the mesh service name of
+	// a Kubernetes pod, the pods with it are registered automatically.
+	AnnotationServiceName = "mesh.megaease.com/service-name"
+	// AnnotationServiceLabels is the annotation of the instance labels of
+	// a Kubernetes pod, in the format of `key1=value1,key2=value2`.
+	AnnotationServiceLabels = "mesh.megaease.com/service-labels"
 )
+
+// DecodeLabels decodes labels in the format of `key1=value1,key2=value2`.
+func DecodeLabels(labelStr string) map[string]string {
+	labelMap := make(map[string]string)
+	if len(labelStr) == 0 {
+		return labelMap
+	}
+
+	labelSlice := strings.Split(labelStr, ",")
+
+	for _, v := range labelSlice {
+		kv := strings.Split(v, "=")
+		if len(kv) == 2 {
+			labelMap[kv[0]] = kv[1]
+		} else {
+			logger.Errorf("%s: invalid label: %s", labelStr, v)
+		}
+	}
+
+	return labelMap
+}
@@ -32,6 +32,7 @@ const (
 	serviceInstanceStatusPrefix    = "/mesh/service-instances/status/%s/"   // +serviceName
 	serviceInstanceSpec            = "/mesh/service-instances/spec/%s/%s"   // +serviceName +instanceID
 	serviceInstanceStatus          = "/mesh/service-instances/status/%s/%s" // +serviceName +instanceID
+	serviceInstanceConfig          = "/mesh/service-instances/config/%s/%s" // +serviceName +instanceID
 
 	allIngressControllerInstanceSpecPrefix = "/mesh/ingresscontroller/spec/"
 	ingressControllerInstanceSpecKey       = "/mesh/ingresscontroller/spec/%s" //+instanceID
@@ -42,6 +43,22 @@ const (
 	ingress       = "/mesh/ingress/%s" // + ingressName
 	ingressPrefix = "/mesh/ingress/"
 
+	tlsSecret       = "/mesh/tls-secrets/%s" // + secretName
+	tlsSecretPrefix = "/mesh/tls-secrets/"
+
+	wasmModule       = "/mesh/wasm-modules/%s" // + moduleName
+	wasmModulePrefix = "/mesh/wasm-modules/"
+
+	egressGateway       = "/mesh/egress-gateways/%s" // + egressGatewayName
+	egressGatewayPrefix = "/mesh/egress-gateways/"
+
+	allEgressGatewayInstanceSpecPrefix = "/mesh/egress-gateway-instances/spec/"
+	egressGatewayInstanceSpecPrefix    = "/mesh/egress-gateway-instances/spec/%s/"   // +egressGatewayName
+	egressGatewayInstanceSpec          = "/mesh/egress-gateway-instances/spec/%s/%s" // +egressGatewayName +instanceID
+
+	allEgressGatewayInstanceStatusPrefix = "/mesh/egress-gateway-instances/status/"
+	egressGatewayInstanceStatus          = "/mesh/egress-gateway-instances/status/%s/%s" // +egressGatewayName +instanceID
+
 	serviceInstanceCert                    = "/mesh/cert/service-cert/%s/%s" // +serviceName +instanceID
 	allServiceCertPrefix                   = "/mesh/cert/service-cert/"
 	rootCert                               = "/mesh/cert/root-cert"
@@ -61,6 +78,8 @@ const (
 
 	serviceCanaryPrefix = "/mesh/service-canary/"
 	serviceCanary       = "/mesh/service-canary/%s"
+
+	masterElection = "/mesh/master-election/"
 )
 
 // ServiceSpecPrefix returns the prefix of service.
@@ -83,6 +102,11 @@ func ServiceInstanceStatusKey(serviceName, instanceID string) string {
 	return fmt.Sprintf(serviceInstanceStatus, serviceName, instanceID)
 }
 
+// ServiceInstanceConfigKey returns the key of the effective sidecar config of service instance.
+func ServiceInstanceConfigKey(serviceName, instanceID string) string {
+	return fmt.Sprintf(serviceInstanceConfig, serviceName, instanceID)
+}
+
 // ServiceInstanceSpecPrefix returns the prefix of service instance specs.
 func ServiceInstanceSpecPrefix(serviceName string) string {
 	return fmt.Sprintf(serviceInstanceSpecPrefix, serviceName)
@@ -123,6 +147,61 @@ func IngressPrefix() string {
 	return ingressPrefix
 }
 
+// TLSSecretKey returns the key of TLS secret.
+func TLSSecretKey(name string) string {
+	return fmt.Sprintf(tlsSecret, name)
+}
+
+// TLSSecretPrefix returns the prefix of TLS secrets.
+func TLSSecretPrefix() string {
+	return tlsSecretPrefix
+}
+
+// WasmModuleKey returns the key of WebAssembly module.
+func WasmModuleKey(name string) string {
+	return fmt.Sprintf(wasmModule, name)
+}
+
+// WasmModulePrefix returns the prefix of WebAssembly modules.
+func WasmModulePrefix() string {
+	return wasmModulePrefix
+}
+
+// EgressGatewaySpecKey returns the key of egress gateway spec.
+func EgressGatewaySpecKey(name string) string {
+	return fmt.Sprintf(egressGateway, name)
+}
+
+// EgressGatewayPrefix returns the prefix of egress gateways.
+func EgressGatewayPrefix() string {
+	return egressGatewayPrefix
+}
+
+// EgressGatewayInstanceSpecKey returns the key of egress gateway instance spec.
+func EgressGatewayInstanceSpecKey(name, instanceID string) string {
+	return fmt.Sprintf(egressGatewayInstanceSpec, name, instanceID)
+}
+
+// EgressGatewayInstanceSpecPrefix returns the prefix of egress gateway instance specs.
+func EgressGatewayInstanceSpecPrefix(name string) string {
+	return fmt.Sprintf(egressGatewayInstanceSpecPrefix, name)
+}
+
+// AllEgressGatewayInstanceSpecPrefix returns the prefix of all egress gateway instance specs.
+func AllEgressGatewayInstanceSpecPrefix() string {
+	return allEgressGatewayInstanceSpecPrefix
+}
+
+// EgressGatewayInstanceStatusKey returns the key of egress gateway instance status.
+func EgressGatewayInstanceStatusKey(name, instanceID string) string {
+	return fmt.Sprintf(egressGatewayInstanceStatus, name, instanceID)
+}
+
+// AllEgressGatewayInstanceStatusPrefix returns the prefix of all egress gateway instance statuses.
+func AllEgressGatewayInstanceStatusPrefix() string {
+	return allEgressGatewayInstanceStatusPrefix
+}
+
 // HTTPRouteGroupKey returns the key of HTTP route group spec.
 func HTTPRouteGroupKey(t string) string {
 	return fmt.Sprintf(httpRouteGroup, t)
@@ -212,3 +291,8 @@ func ServiceCanaryPrefix() string {
 func ServiceCanaryKey(serviceCanaryName string) string {
 	return fmt.Sprintf(serviceCanary, serviceCanaryName)
 }
+
+// MasterElectionPrefix returns the prefix of the mesh master leader election.
+func MasterElectionPrefix() string {
+	return masterElection
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/layout"
+)
+
+const (
+	// masterLeaderTTL is the TTL of the election session, the leadership
+	// moves to another master within it after the leader crashes.
+	masterLeaderTTL = 5 * time.Second
+
+	electionRetryInterval = time.Second
+)
+
+// leaderElection elects one master among all members running the mesh
+// controller in master mode, only the leader runs the master routines.
+type leaderElection struct {
+	cls       cluster.Cluster
+	candidate string
+	onElected func()
+
+	isLeader atomic.Bool
+
+	mutex    sync.Mutex
+	election cluster.Election
+
+	done chan struct{}
+}
+
+func newLeaderElection(cls cluster.Cluster, candidate string, onElected func()) *leaderElection {
+	return &leaderElection{
+		cls:       cls,
+		candidate: candidate,
+		onElected: onElected,
+		done:      make(chan struct{}),
+	}
+}
+
+func (l *leaderElection) start() {
+	go l.run()
+}
+
+func (l *leaderElection) run() {
+	for {
+		err := l.campaign()
+		select {
+		case <-l.done:
+			return
+		default:
+		}
+
+		if err != nil {
+			logger.Errorf("mesh master %s campaign failed: %v", l.candidate, err)
+		}
+
+		select {
+		case <-l.done:
+			return
+		case <-time.After(electionRetryInterval):
+		}
+	}
+}
+
+// campaign blocks until the candidate is elected and then loses the
+// leadership, or the election is closed.
+func (l *leaderElection) campaign() error {
+	election, err := l.cls.Election(layout.MasterElectionPrefix(), masterLeaderTTL)
+	if err != nil {
+		return err
+	}
+	if election == nil {
+		return fmt.Errorf("leader election is not supported by the cluster")
+	}
+
+	l.setElection(election)
+	defer func() {
+		l.isLeader.Store(false)
+		l.setElection(nil)
+		election.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-l.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := election.Campaign(ctx, l.candidate); err != nil {
+		return err
+	}
+
+	l.isLeader.Store(true)
+	logger.Infof("mesh master %s is elected as the leader", l.candidate)
+	if l.onElected != nil {
+		l.onElected()
+	}
+
+	select {
+	case <-l.done:
+		return nil
+	case <-election.Done():
+		return fmt.Errorf("session of the election is lost")
+	}
+}
+
+func (l *leaderElection) setElection(election cluster.Election) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.election = election
+}
+
+// IsLeader returns whether this master is the leader.
+func (l *leaderElection) IsLeader() bool {
+	return l.isLeader.Load()
+}
+
+// Leader returns the name of the current leader.
+func (l *leaderElection) Leader() string {
+	l.mutex.Lock()
+	election := l.election
+	l.mutex.Unlock()
+
+	if l.IsLeader() {
+		return l.candidate
+	}
+	if election == nil {
+		return ""
+	}
+
+	leader, err := election.Leader()
+	if err != nil {
+		logger.Errorf("get leader of mesh master failed: %v", err)
+		return ""
+	}
+	return leader
+}
+
+func (l *leaderElection) close() {
+	close(l.done)
+}
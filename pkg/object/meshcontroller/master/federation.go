@@ -0,0 +1,304 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	meshapi "github.com/megaease/easegress/v2/pkg/object/meshcontroller/api"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const federationFetchTimeout = 5 * time.Second
+
+// federation pulls the catalogs of the federation peers and imports their
+// services and instances into this mesh.
+type federation struct {
+	spec       *spec.Federation
+	service    *service.Service
+	client     *http.Client
+	needHandle func() bool
+
+	done chan struct{}
+}
+
+func newFederation(federationSpec *spec.Federation, service *service.Service, needHandle func() bool) *federation {
+	f := &federation{
+		spec:       federationSpec,
+		service:    service,
+		client:     &http.Client{Timeout: federationFetchTimeout},
+		needHandle: needHandle,
+		done:       make(chan struct{}),
+	}
+
+	go f.run()
+
+	return f
+}
+
+func (f *federation) run() {
+	ticker := time.NewTicker(f.spec.SyncIntervalDuration())
+
+	for {
+		select {
+		case <-f.done:
+			ticker.Stop()
+			return
+
+		case <-ticker.C:
+			if f.needHandle() {
+				f.sync()
+			}
+		}
+	}
+}
+
+func (f *federation) sync() {
+	defer func() {
+		if err := recover(); err != nil {
+			format := "failed to sync federation %v, stack trace: \n%s\n"
+			logger.Errorf(format, err, debug.Stack())
+		}
+	}()
+
+	peers := map[string]struct{}{}
+	for _, peer := range f.spec.Peers {
+		peers[spec.FederationRegistryName(peer.ClusterName)] = struct{}{}
+
+		catalog, err := f.fetchCatalog(peer)
+		if err != nil {
+			logger.Errorf("fetch catalog of federation peer %s failed: %v", peer.ClusterName, err)
+			f.markOutOfService(peer)
+			continue
+		}
+
+		f.importCatalog(peer, catalog)
+	}
+
+	f.cleanRemovedPeers(peers)
+}
+
+func (f *federation) fetchCatalog(peer *spec.FederationPeer) (*spec.FederationCatalog, error) {
+	var lastErr error
+	for _, addr := range peer.APIAddresses {
+		url := strings.TrimSuffix(addr, "/") + api.APIPrefixV2 + meshapi.MeshFederationCatalogPath
+
+		catalog, err := f.fetchCatalogFrom(url)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if catalog.ClusterName != peer.ClusterName {
+			return nil, fmt.Errorf("cluster name of %s is %s, want %s", addr, catalog.ClusterName, peer.ClusterName)
+		}
+
+		return catalog, nil
+	}
+
+	return nil, lastErr
+}
+
+func (f *federation) fetchCatalogFrom(url string) (*spec.FederationCatalog, error) {
+	resp, err := f.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body of %s failed: %v", url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returns %d: %s", url, resp.StatusCode, string(body))
+	}
+
+	catalog := &spec.FederationCatalog{}
+	err = codectool.UnmarshalJSON(body, catalog)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal catalog from %s failed: %v", url, err)
+	}
+
+	return catalog, nil
+}
+
+func (f *federation) importCatalog(peer *spec.FederationPeer, catalog *spec.FederationCatalog) {
+	f.service.Lock()
+	defer f.service.Unlock()
+
+	registryName := spec.FederationRegistryName(peer.ClusterName)
+
+	// The services defined locally or imported from other peers take
+	// precedence, but the instances are always imported for active-active
+	// deployments across clusters.
+	services := map[string]struct{}{}
+	for _, s := range catalog.Services {
+		services[s.Name] = struct{}{}
+
+		local := f.service.GetServiceSpec(s.Name)
+		if local != nil && local.RegistryName != registryName {
+			continue
+		}
+
+		imported := peer.ImportService(s)
+		if local == nil || !sameJSON(local, imported) {
+			f.service.PutServiceSpec(imported)
+			logger.Infof("import service %s from federation peer %s", s.Name, peer.ClusterName)
+		}
+		f.addToTenant(imported)
+	}
+
+	for _, s := range f.service.ListServiceSpecs() {
+		if s.RegistryName != registryName {
+			continue
+		}
+		if _, exists := services[s.Name]; !exists {
+			f.deleteService(s)
+		}
+	}
+
+	instances := map[string]*spec.ServiceInstanceSpec{}
+	indexes := map[string]int{}
+	for _, instance := range catalog.Instances {
+		imported := peer.ImportInstance(instance, indexes[instance.ServiceName])
+		if imported == nil {
+			continue
+		}
+		indexes[instance.ServiceName]++
+		instances[imported.Key()] = imported
+	}
+
+	for _, instance := range f.service.ListAllServiceInstanceSpecs() {
+		if instance.RegistryName != registryName {
+			continue
+		}
+
+		imported, exists := instances[instance.Key()]
+		if !exists {
+			f.service.DeleteServiceInstanceSpec(instance.ServiceName, instance.InstanceID)
+			continue
+		}
+
+		if sameJSON(instance, imported) {
+			delete(instances, instance.Key())
+		}
+	}
+
+	for _, instance := range instances {
+		f.service.PutServiceInstanceSpec(instance)
+	}
+}
+
+// markOutOfService brings down the instances of an unreachable peer, so
+// that the traffic goes to the other clusters.
+func (f *federation) markOutOfService(peer *spec.FederationPeer) {
+	f.service.Lock()
+	defer f.service.Unlock()
+
+	registryName := spec.FederationRegistryName(peer.ClusterName)
+	for _, instance := range f.service.ListAllServiceInstanceSpecs() {
+		if instance.RegistryName != registryName || instance.Status == spec.ServiceStatusOutOfService {
+			continue
+		}
+		instance.Status = spec.ServiceStatusOutOfService
+		f.service.PutServiceInstanceSpec(instance)
+	}
+}
+
+// cleanRemovedPeers deletes the services and instances imported from the
+// peers which are removed from the spec.
+func (f *federation) cleanRemovedPeers(peers map[string]struct{}) {
+	f.service.Lock()
+	defer f.service.Unlock()
+
+	for _, s := range f.service.ListServiceSpecs() {
+		if !s.IsFederated() {
+			continue
+		}
+		if _, exists := peers[s.RegistryName]; !exists {
+			f.deleteService(s)
+		}
+	}
+
+	for _, instance := range f.service.ListAllServiceInstanceSpecs() {
+		if !instance.IsFederated() {
+			continue
+		}
+		if _, exists := peers[instance.RegistryName]; !exists {
+			f.service.DeleteServiceInstanceSpec(instance.ServiceName, instance.InstanceID)
+		}
+	}
+}
+
+func (f *federation) addToTenant(s *spec.Service) {
+	tenant := f.service.GetTenantSpec(s.RegisterTenant)
+	if tenant == nil {
+		tenant = &spec.Tenant{
+			Name:        s.RegisterTenant,
+			CreatedAt:   time.Now().Format(time.RFC3339),
+			Description: "created by federation",
+		}
+	}
+
+	for _, name := range tenant.Services {
+		if name == s.Name {
+			return
+		}
+	}
+
+	tenant.Services = append(tenant.Services, s.Name)
+	f.service.PutTenantSpec(tenant)
+}
+
+func (f *federation) deleteService(s *spec.Service) {
+	f.service.DeleteServiceSpec(s.Name)
+	logger.Infof("delete service %s imported by federation", s.Name)
+
+	tenant := f.service.GetTenantSpec(s.RegisterTenant)
+	if tenant == nil {
+		return
+	}
+
+	services := tenant.Services[:0]
+	for _, name := range tenant.Services {
+		if name != s.Name {
+			services = append(services, name)
+		}
+	}
+	tenant.Services = services
+	f.service.PutTenantSpec(tenant)
+}
+
+func (f *federation) close() {
+	close(f.done)
+}
+
+func sameJSON(a, b interface{}) bool {
+	return string(codectool.MustMarshalJSON(a)) == string(codectool.MustMarshalJSON(b))
+}
@@ -25,12 +25,14 @@ import (
 	"github.com/megaease/easegress/v2/pkg/api"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/certmanager"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/configpush"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/layout"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/service"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/storage"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/k8s"
 )
 
 const (
@@ -45,6 +47,11 @@ type (
 		spec              *spec.Admin
 		heartbeatInterval time.Duration
 		certManager       *certmanager.CertManager
+		federation        *federation
+		leader            *leaderElection
+		configPush        *configpush.Server
+		podRegistry       *podRegistry
+		secretImporter    *secretImporter
 
 		store   storage.Storage
 		service *service.Service
@@ -53,7 +60,14 @@ type (
 	}
 
 	// Status is the status of mesh master.
-	Status struct{}
+	Status struct {
+		Leader   string `json:"leader"`
+		IsLeader bool   `json:"isLeader"`
+
+		// ConfigPushSubscribers is the number of workers subscribed to
+		// the config push server of this master.
+		ConfigPushSubscribers int `json:"configPushSubscribers,omitempty"`
+	}
 )
 
 // New creates a mesh master.
@@ -80,7 +94,29 @@ func New(superSpec *supervisor.Spec) *Master {
 	}
 	m.heartbeatInterval = heartbeat
 
+	m.leader = newLeaderElection(m.super.Cluster(), m.super.Options().Name, m.onElected)
 	m.initMTLS()
+	if m.spec.Federation != nil {
+		m.federation = newFederation(m.spec.Federation, m.service, m.needHandle)
+	}
+	if m.spec.ConfigPush != nil {
+		m.configPush = configpush.NewServer(m.super.Cluster(), m.spec.ConfigPush.ServerPort(), m.super.Options().Name)
+	}
+	if m.spec.PodRegistry != nil {
+		if clientset, err := newPodClientset(m.spec.PodRegistry); err != nil {
+			logger.Errorf("create pod registry failed: %v", err)
+		} else {
+			m.podRegistry = newPodRegistry(clientset, m.spec.PodRegistry, superSpec.Name(), m.service, m.needHandle, m.deleteInstance)
+		}
+	}
+	if m.spec.IngressTLSPort != 0 {
+		if clientset, err := k8s.NewK8sClientInCluster(); err != nil {
+			logger.Errorf("create k8s client for importing secrets failed: %v", err)
+		} else {
+			m.secretImporter = newSecretImporter(clientset, m.service, m.needHandle)
+		}
+	}
+	m.leader.start()
 	go m.run()
 
 	return m
@@ -101,7 +137,7 @@ func (m *Master) initMTLS() error {
 		return err
 	}
 
-	m.certManager = certmanager.NewCertManager(m.superSpec, m.service, m.spec.Security.CertProvider, appCertTTL, rootCertTTL, m.store)
+	m.certManager = certmanager.NewCertManager(m.superSpec, m.service, m.needHandle, m.spec.Security.CertProvider, appCertTTL, rootCertTTL, m.store)
 
 	return nil
 }
@@ -118,14 +154,31 @@ func (m *Master) run() {
 		case <-ticker.C:
 			if m.needHandle() {
 				m.checkServiceInstances()
+				m.checkEgressGatewayInstances()
 			}
 		}
 	}
 }
 
-// only handle master routines when it's the cluster leader.
+// only handle master routines when it's the elected leader of mesh masters.
 func (m *Master) needHandle() bool {
-	return m.superSpec.Super().Cluster().IsLeader()
+	return m.leader.IsLeader()
+}
+
+// onElected takes over the master routines without waiting for their
+// next round, so that the failover is fast.
+func (m *Master) onElected() {
+	if m.certManager != nil {
+		go m.certManager.Sign()
+	}
+	if m.podRegistry != nil {
+		go m.podRegistry.resync()
+	}
+	if m.secretImporter != nil {
+		go m.secretImporter.resync()
+	}
+	go m.checkServiceInstances()
+	go m.checkEgressGatewayInstances()
 }
 
 func (m *Master) checkServiceInstances() {
@@ -143,6 +196,9 @@ func (m *Master) checkServiceInstances() {
 		if !m.isMeshRegistryName(_spec.RegistryName) {
 			continue
 		}
+		if m.podRegistry != nil && m.podRegistry.manages(_spec.ServiceName, _spec.InstanceID) {
+			continue
+		}
 
 		// TODO: improve search performance
 		var status *spec.ServiceInstanceStatus
@@ -159,11 +215,41 @@ func (m *Master) checkServiceInstances() {
 			continue
 		}
 
-		m.checkLastHeartbeatTime(_spec, status.LastHeartbeatTime)
+		m.checkLastHeartbeatTime(_spec, status.LastHeartbeatTime, m.deleteInstance, m.updateInstanceStatus)
 	}
 }
 
-func (m *Master) checkLastHeartbeatTime(_spec *spec.ServiceInstanceSpec, lastHeartbeatTime string) {
+// checkEgressGatewayInstances checks the heartbeats of the egress gateway
+// instances in the same way as the service instances.
+func (m *Master) checkEgressGatewayInstances() {
+	defer func() {
+		if err := recover(); err != nil {
+			format := "failed to check egress gateway instances %v, stack trace: \n%s\n"
+			logger.Errorf(format, err, debug.Stack())
+		}
+	}()
+
+	statuses := make(map[string]*spec.ServiceInstanceStatus)
+	for _, status := range m.service.ListAllEgressGatewayInstanceStatuses() {
+		statuses[layout.EgressGatewayInstanceStatusKey(status.ServiceName, status.InstanceID)] = status
+	}
+
+	for _, _spec := range m.service.ListAllEgressGatewayInstanceSpecs() {
+		status := statuses[layout.EgressGatewayInstanceStatusKey(_spec.ServiceName, _spec.InstanceID)]
+		if status == nil {
+			format := "status of egress gateway %s/%s not found, need to delete"
+			logger.Warnf(format, _spec.ServiceName, _spec.InstanceID)
+			m.deleteEgressGatewayInstance(_spec)
+			continue
+		}
+
+		m.checkLastHeartbeatTime(_spec, status.LastHeartbeatTime, m.deleteEgressGatewayInstance, m.updateEgressGatewayInstanceStatus)
+	}
+}
+
+func (m *Master) checkLastHeartbeatTime(_spec *spec.ServiceInstanceSpec, lastHeartbeatTime string,
+	deleteInstance func(*spec.ServiceInstanceSpec), updateStatus func(*spec.ServiceInstanceSpec, string),
+) {
 	t, err := time.Parse(time.RFC3339, lastHeartbeatTime)
 	if err != nil {
 		logger.Errorf("BUG: parse last heartbeat time %s failed: %v", lastHeartbeatTime, err)
@@ -176,7 +262,7 @@ func (m *Master) checkLastHeartbeatTime(_spec *spec.ServiceInstanceSpec, lastHea
 	if gap > defaultDeadRecordExistTime {
 		format := "%s/%s expired for %s, need to be deleted"
 		logger.Warnf(format, _spec.ServiceName, _spec.InstanceID, gap.String())
-		m.deleteInstance(_spec)
+		deleteInstance(_spec)
 		return
 	}
 
@@ -184,14 +270,14 @@ func (m *Master) checkLastHeartbeatTime(_spec *spec.ServiceInstanceSpec, lastHea
 	if gap > m.heartbeatInterval*2 {
 		if _spec.Status != spec.ServiceStatusOutOfService {
 			logger.Warnf("%s/%s expired for %s", _spec.ServiceName, _spec.InstanceID, gap.String())
-			m.updateInstanceStatus(_spec, spec.ServiceStatusOutOfService)
+			updateStatus(_spec, spec.ServiceStatusOutOfService)
 		}
 		return
 	}
 
 	if _spec.Status == spec.ServiceStatusOutOfService {
 		logger.Infof("%s/%s heartbeat recovered, make it UP", _spec.ServiceName, _spec.InstanceID)
-		m.updateInstanceStatus(_spec, spec.ServiceStatusUp)
+		updateStatus(_spec, spec.ServiceStatusUp)
 	}
 }
 
@@ -210,6 +296,24 @@ func (m *Master) deleteInstance(_spec *spec.ServiceInstanceSpec) {
 	} else {
 		logger.Infof("clean instance status: %s", statusKey)
 	}
+
+	configKey := layout.ServiceInstanceConfigKey(_spec.ServiceName, _spec.InstanceID)
+	if err = m.store.Delete(configKey); err != nil {
+		api.ClusterPanic(err)
+	} else {
+		logger.Infof("clean instance config: %s", configKey)
+	}
+}
+
+func (m *Master) deleteEgressGatewayInstance(_spec *spec.ServiceInstanceSpec) {
+	m.service.DeleteEgressGatewayInstanceSpec(_spec.ServiceName, _spec.InstanceID)
+	m.service.DeleteEgressGatewayInstanceStatus(_spec.ServiceName, _spec.InstanceID)
+	logger.Infof("clean egress gateway instance: %s/%s", _spec.ServiceName, _spec.InstanceID)
+}
+
+func (m *Master) updateEgressGatewayInstanceStatus(_spec *spec.ServiceInstanceSpec, status string) {
+	_spec.Status = status
+	m.service.PutEgressGatewayInstanceSpec(_spec)
 }
 
 func (m *Master) isMeshRegistryName(registryName string) bool {
@@ -243,12 +347,33 @@ func (m *Master) Close() {
 	if m.spec.EnablemTLS() {
 		m.certManager.Close()
 	}
+	if m.federation != nil {
+		m.federation.close()
+	}
+	if m.configPush != nil {
+		m.configPush.Close()
+	}
+	if m.podRegistry != nil {
+		m.podRegistry.close()
+	}
+	if m.secretImporter != nil {
+		m.secretImporter.close()
+	}
+	m.leader.close()
 	close(m.done)
 }
 
 // Status returns the status of master.
 func (m *Master) Status() *supervisor.Status {
+	status := &Status{
+		Leader:   m.leader.Leader(),
+		IsLeader: m.leader.IsLeader(),
+	}
+	if m.configPush != nil {
+		status.ConfigPushSubscribers = m.configPush.Subscribers()
+	}
+
 	return &supervisor.Status{
-		ObjectStatus: nil,
+		ObjectStatus: status,
 	}
 }
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/layout"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/storage"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+// meshKind registers the kind of the mesh controller to create its specs,
+// the mesh controller itself can't be imported.
+type meshKind struct{}
+
+func (meshKind) Category() supervisor.ObjectCategory         { return supervisor.CategoryBusinessController }
+func (meshKind) Kind() string                                { return "MeshController" }
+func (meshKind) DefaultSpec() interface{}                    { return &spec.Admin{} }
+func (meshKind) Init(*supervisor.Spec)                       {}
+func (meshKind) Inherit(*supervisor.Spec, supervisor.Object) {}
+func (meshKind) Status() *supervisor.Status                  { return &supervisor.Status{} }
+func (meshKind) Close()                                      {}
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	supervisor.Register(&meshKind{})
+	os.Exit(m.Run())
+}
+
+// newTestMaster creates a master whose service is backed by an in-memory
+// cluster, its routines are not started.
+func newTestMaster(t *testing.T) *Master {
+	var mutex sync.Mutex
+	data := map[string]string{}
+
+	cls := clustertest.NewMockedCluster()
+	cls.MockedGet = func(key string) (*string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if v, ok := data[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	cls.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		kvs := map[string]string{}
+		for k, v := range data {
+			if strings.HasPrefix(k, prefix) {
+				kvs[k] = v
+			}
+		}
+		return kvs, nil
+	}
+	cls.MockedGetRaw = func(key string) (*mvccpb.KeyValue, error) {
+		value, _ := cls.MockedGet(key)
+		if value == nil {
+			return nil, nil
+		}
+		return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(*value)}, nil
+	}
+	cls.MockedGetRawPrefix = func(prefix string) (map[string]*mvccpb.KeyValue, error) {
+		kvs, _ := cls.MockedGetPrefix(prefix)
+		raw := map[string]*mvccpb.KeyValue{}
+		for k, v := range kvs {
+			raw[k] = &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v)}
+		}
+		return raw, nil
+	}
+	cls.MockedPut = func(key, value string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		data[key] = value
+		return nil
+	}
+	cls.MockedDelete = func(key string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		delete(data, key)
+		return nil
+	}
+
+	super := supervisor.NewMock(nil, cls, nil, nil, false, nil, nil)
+	superSpec, err := super.NewSpec(`
+kind: MeshController
+name: mesh-controller
+heartbeatInterval: 5s
+registryType: eureka
+apiPort: 13009
+ingressPort: 13010
+`)
+	if err != nil {
+		t.Fatalf("create spec failed: %v", err)
+	}
+
+	return &Master{
+		superSpec:         superSpec,
+		heartbeatInterval: 5 * time.Second,
+		store:             storage.New(superSpec.Name(), cls),
+		service:           service.New(superSpec),
+	}
+}
+
+func TestCheckEgressGatewayInstances(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMaster(t)
+	svc, store := m.service, m.store
+
+	putInstance := func(id string, status string, heartbeat time.Time) {
+		svc.PutEgressGatewayInstanceSpec(&spec.ServiceInstanceSpec{
+			ServiceName: "egress", InstanceID: id, IP: "10.0.0.1", Port: 8080, Status: status,
+		})
+		if !heartbeat.IsZero() {
+			svc.PutEgressGatewayInstanceStatus(&spec.ServiceInstanceStatus{
+				ServiceName: "egress", InstanceID: id, LastHeartbeatTime: heartbeat.Format(time.RFC3339),
+			})
+		}
+	}
+
+	now := time.Now()
+	putInstance("alive", spec.ServiceStatusUp, now)
+	putInstance("silent", spec.ServiceStatusUp, now.Add(-time.Minute))
+	putInstance("recovered", spec.ServiceStatusOutOfService, now)
+	putInstance("dead", spec.ServiceStatusOutOfService, now.Add(-time.Hour))
+	putInstance("no-status", spec.ServiceStatusUp, time.Time{})
+
+	m.checkEgressGatewayInstances()
+
+	statuses := map[string]string{}
+	for _, instance := range svc.ListEgressGatewayInstanceSpecs("egress") {
+		statuses[instance.InstanceID] = instance.Status
+	}
+	assert.Equal(map[string]string{
+		"alive":     spec.ServiceStatusUp,
+		"silent":    spec.ServiceStatusOutOfService,
+		"recovered": spec.ServiceStatusUp,
+	}, statuses)
+
+	value, _ := store.Get(layout.EgressGatewayInstanceStatusKey("egress", "dead"))
+	assert.Nil(value)
+	assert.Len(svc.ListAllEgressGatewayInstanceStatuses(), 3)
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corev1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/label"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+)
+
+const podResyncPeriod = 10 * time.Minute
+
+// podRegistry registers the service instances from the lifecycle of the
+// Kubernetes pods annotated with the mesh service name, the instance ID is
+// the pod name, which is also the hostname of the sidecar in the pod.
+type podRegistry struct {
+	spec           *spec.PodRegistry
+	registryName   string
+	service        *service.Service
+	needHandle     func() bool
+	deleteInstance func(*spec.ServiceInstanceSpec)
+
+	pods []corev1.PodInformer
+
+	mutex sync.RWMutex
+	// managed are the keys of the instances registered from pods.
+	managed map[string]struct{}
+
+	done chan struct{}
+}
+
+// newPodClientset creates the Kubernetes clientset to watch the pods.
+func newPodClientset(podRegistrySpec *spec.PodRegistry) (kubernetes.Interface, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags(podRegistrySpec.MasterURL, podRegistrySpec.KubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("build kubeconfig failed: %v", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("build kubernetes clientset failed: %v", err)
+	}
+
+	return clientset, nil
+}
+
+func newPodRegistry(clientset kubernetes.Interface, podRegistrySpec *spec.PodRegistry, registryName string,
+	service *service.Service, needHandle func() bool, deleteInstance func(*spec.ServiceInstanceSpec),
+) *podRegistry {
+	r := &podRegistry{
+		spec:           podRegistrySpec,
+		registryName:   registryName,
+		service:        service,
+		needHandle:     needHandle,
+		deleteInstance: deleteInstance,
+		managed:        make(map[string]struct{}),
+		done:           make(chan struct{}),
+	}
+
+	namespaces := podRegistrySpec.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	factory := informers.NewSharedInformerFactory(clientset, podResyncPeriod)
+	for _, ns := range namespaces {
+		informer := corev1.New(factory, ns, nil).Pods()
+		informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    r.onPod,
+			UpdateFunc: func(_, newObj interface{}) { r.onPod(newObj) },
+			DeleteFunc: r.onDeletePod,
+		})
+		r.pods = append(r.pods, informer)
+	}
+
+	factory.Start(r.done)
+
+	return r
+}
+
+func podInstanceKey(serviceName, instanceID string) string {
+	return serviceName + "/" + instanceID
+}
+
+// manages returns whether the instance is registered from a pod, the pod
+// lifecycle is authoritative for these instances, so the heartbeat checking
+// skips them.
+func (r *podRegistry) manages(serviceName, instanceID string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	_, ok := r.managed[podInstanceKey(serviceName, instanceID)]
+	return ok
+}
+
+func isPodReady(pod *apicorev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.PodIP == "" || pod.Status.Phase != apicorev1.PodRunning {
+		return false
+	}
+
+	for _, c := range pod.Status.Conditions {
+		if c.Type == apicorev1.PodReady {
+			return c.Status == apicorev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func (r *podRegistry) onPod(obj interface{}) {
+	pod, ok := obj.(*apicorev1.Pod)
+	if !ok {
+		return
+	}
+
+	serviceName := pod.Annotations[label.AnnotationServiceName]
+	if serviceName == "" {
+		return
+	}
+
+	r.mutex.Lock()
+	r.managed[podInstanceKey(serviceName, pod.Name)] = struct{}{}
+	r.mutex.Unlock()
+
+	if r.needHandle() {
+		r.register(pod, serviceName)
+	}
+}
+
+func (r *podRegistry) onDeletePod(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	pod, ok := obj.(*apicorev1.Pod)
+	if !ok {
+		return
+	}
+
+	serviceName := pod.Annotations[label.AnnotationServiceName]
+	if serviceName == "" {
+		return
+	}
+
+	r.mutex.Lock()
+	delete(r.managed, podInstanceKey(serviceName, pod.Name))
+	r.mutex.Unlock()
+
+	if r.needHandle() {
+		r.deregister(serviceName, pod.Name)
+	}
+}
+
+func (r *podRegistry) register(pod *apicorev1.Pod, serviceName string) {
+	defer func() {
+		if err := recover(); err != nil {
+			format := "failed to register pod %s/%s %v, stack trace: \n%s\n"
+			logger.Errorf(format, pod.Namespace, pod.Name, err, debug.Stack())
+		}
+	}()
+
+	origin := r.service.GetServiceInstanceSpec(serviceName, pod.Name)
+
+	if !isPodReady(pod) {
+		if origin != nil && origin.Status != spec.ServiceStatusOutOfService {
+			logger.Infof("pod %s/%s is not ready, make it OUT_OF_SERVICE", pod.Namespace, pod.Name)
+			origin.Status = spec.ServiceStatusOutOfService
+			r.service.PutServiceInstanceSpec(origin)
+		}
+		return
+	}
+
+	serviceSpec := r.service.GetServiceSpec(serviceName)
+	if serviceSpec == nil {
+		logger.Warnf("service %s of pod %s/%s not found", serviceName, pod.Namespace, pod.Name)
+		return
+	}
+
+	instance := &spec.ServiceInstanceSpec{
+		AgentType:    "None",
+		RegistryName: r.registryName,
+		ServiceName:  serviceName,
+		InstanceID:   pod.Name,
+		IP:           pod.Status.PodIP,
+		Port:         uint32(serviceSpec.Sidecar.IngressPort),
+		Ports:        serviceSpec.SidecarInstancePorts(),
+		Labels:       label.DecodeLabels(pod.Annotations[label.AnnotationServiceLabels]),
+		Status:       spec.ServiceStatusUp,
+	}
+
+	if origin != nil {
+		if origin.Status == spec.ServiceStatusUp && !needUpdatePodInstance(origin, instance) {
+			return
+		}
+		// The agent type is reported by the sidecar.
+		instance.AgentType = origin.AgentType
+	}
+
+	instance.RegistryTime = time.Now().Format(time.RFC3339)
+	r.service.PutServiceInstanceSpec(instance)
+	logger.Infof("register instance %s/%s from pod %s", serviceName, pod.Name, pod.Namespace)
+}
+
+func needUpdatePodInstance(origin, instance *spec.ServiceInstanceSpec) bool {
+	if origin.IP != instance.IP || origin.Port != instance.Port {
+		return true
+	}
+
+	if len(origin.Labels) != len(instance.Labels) {
+		return true
+	}
+	for k, v := range instance.Labels {
+		if origin.Labels[k] != v {
+			return true
+		}
+	}
+
+	if len(origin.Ports) != len(instance.Ports) {
+		return true
+	}
+	for i, p := range instance.Ports {
+		if *origin.Ports[i] != *p {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *podRegistry) deregister(serviceName, instanceID string) {
+	defer func() {
+		if err := recover(); err != nil {
+			format := "failed to deregister instance %s/%s %v, stack trace: \n%s\n"
+			logger.Errorf(format, serviceName, instanceID, err, debug.Stack())
+		}
+	}()
+
+	instance := r.service.GetServiceInstanceSpec(serviceName, instanceID)
+	if instance == nil {
+		return
+	}
+
+	logger.Infof("pod of instance %s/%s is deleted, deregister it", serviceName, instanceID)
+	r.deleteInstance(instance)
+}
+
+// resync registers the instances of all pods, it is called when the
+// master becomes the leader, since the events before are ignored.
+func (r *podRegistry) resync() {
+	for _, informer := range r.pods {
+		if !informer.Informer().HasSynced() {
+			continue
+		}
+
+		pods, err := informer.Lister().List(labels.Everything())
+		if err != nil {
+			logger.Errorf("list pods failed: %v", err)
+			continue
+		}
+
+		for _, pod := range pods {
+			r.onPod(pod)
+		}
+	}
+}
+
+func (r *podRegistry) close() {
+	close(r.done)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/label"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+)
+
+func newPod(name, serviceName, ip string, ready bool) *apicorev1.Pod {
+	pod := &apicorev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Status: apicorev1.PodStatus{
+			Phase: apicorev1.PodRunning,
+			PodIP: ip,
+			Conditions: []apicorev1.PodCondition{
+				{Type: apicorev1.PodReady, Status: apicorev1.ConditionFalse},
+			},
+		},
+	}
+	if serviceName != "" {
+		pod.Annotations = map[string]string{
+			label.AnnotationServiceName:   serviceName,
+			label.AnnotationServiceLabels: "version=v2",
+		}
+	}
+	if ready {
+		pod.Status.Conditions[0].Status = apicorev1.ConditionTrue
+	}
+	return pod
+}
+
+func TestPodRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMaster(t)
+	svc := m.service
+	instanceOf := func(id string) *spec.ServiceInstanceSpec { return svc.GetServiceInstanceSpec("order", id) }
+
+	svc.PutServiceSpec(&spec.Service{
+		Name:    "order",
+		Sidecar: &spec.Sidecar{IngressPort: 13001, EgressPort: 13002},
+	})
+	// the pod of the instance is deleted while the master isn't the leader.
+	svc.PutServiceInstanceSpec(&spec.ServiceInstanceSpec{
+		RegistryName: m.superSpec.Name(), ServiceName: "order", InstanceID: "order-0",
+		IP: "10.0.0.1", Port: 13001, Status: spec.ServiceStatusUp,
+	})
+
+	clientset := fake.NewSimpleClientset(
+		newPod("order-1", "order", "10.0.0.2", true),
+		newPod("plain", "", "10.0.0.3", true),
+	)
+
+	var leader atomic.Bool
+	r := newPodRegistry(clientset, &spec.PodRegistry{}, m.superSpec.Name(), svc, leader.Load, m.deleteInstance)
+	defer r.close()
+	m.podRegistry = r
+
+	// the events are ignored until the master becomes the leader.
+	assert.Eventually(r.pods[0].Informer().HasSynced, 5*time.Second, 10*time.Millisecond)
+	assert.True(r.manages("order", "order-1"))
+	assert.False(r.manages("", "plain"))
+	assert.Nil(instanceOf("order-1"))
+
+	leader.Store(true)
+	r.resync()
+	instance := instanceOf("order-1")
+	if assert.NotNil(instance) {
+		assert.Equal(spec.ServiceStatusUp, instance.Status)
+		assert.Equal("10.0.0.2", instance.IP)
+		assert.Equal(uint32(13001), instance.Port)
+		assert.Equal(map[string]string{"version": "v2"}, instance.Labels)
+	}
+
+	// the stale instance is cleaned, but the instances of the pods are
+	// kept without heartbeats.
+	m.checkServiceInstances()
+	assert.Nil(instanceOf("order-0"))
+	assert.NotNil(instanceOf("order-1"))
+
+	updatePod := func(pod *apicorev1.Pod) {
+		_, err := clientset.CoreV1().Pods("default").Update(context.Background(), pod, metav1.UpdateOptions{})
+		assert.NoError(err)
+	}
+	statusOf := func(id, status, ip string) func() bool {
+		return func() bool {
+			instance := instanceOf(id)
+			return instance != nil && instance.Status == status && instance.IP == ip
+		}
+	}
+
+	updatePod(newPod("order-1", "order", "10.0.0.2", false))
+	assert.Eventually(statusOf("order-1", spec.ServiceStatusOutOfService, "10.0.0.2"), 5*time.Second, 10*time.Millisecond)
+
+	updatePod(newPod("order-1", "order", "10.0.0.4", true))
+	assert.Eventually(statusOf("order-1", spec.ServiceStatusUp, "10.0.0.4"), 5*time.Second, 10*time.Millisecond)
+
+	err := clientset.CoreV1().Pods("default").Delete(context.Background(), "order-1", metav1.DeleteOptions{})
+	assert.NoError(err)
+	assert.Eventually(func() bool { return instanceOf("order-1") == nil }, 5*time.Second, 10*time.Millisecond)
+	assert.False(r.manages("order", "order-1"))
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"encoding/base64"
+	"runtime/debug"
+
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corev1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+)
+
+// secretImporter watches the Kubernetes TLS secrets, and imports them
+// again when the ones imported by the ingresses change, so that the
+// rotated certificates are served.
+type secretImporter struct {
+	service    *service.Service
+	needHandle func() bool
+
+	secrets corev1.SecretInformer
+
+	done chan struct{}
+}
+
+func newSecretImporter(clientset kubernetes.Interface, service *service.Service, needHandle func() bool) *secretImporter {
+	si := &secretImporter{
+		service:    service,
+		needHandle: needHandle,
+		done:       make(chan struct{}),
+	}
+
+	// Only TLS secrets could be imported, so the others are not cached.
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, podResyncPeriod,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = "type=" + string(apicorev1.SecretTypeTLS)
+		}))
+	si.secrets = factory.Core().V1().Secrets()
+	si.secrets.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    si.onSecret,
+		UpdateFunc: func(_, newObj interface{}) { si.onSecret(newObj) },
+	})
+
+	factory.Start(si.done)
+
+	return si
+}
+
+func (si *secretImporter) onSecret(obj interface{}) {
+	secret, ok := obj.(*apicorev1.Secret)
+	if !ok || !si.needHandle() {
+		return
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			format := "failed to import secret %s/%s %v, stack trace: \n%s\n"
+			logger.Errorf(format, secret.Namespace, secret.Name, err, debug.Stack())
+		}
+	}()
+
+	cert, key := secret.Data[apicorev1.TLSCertKey], secret.Data[apicorev1.TLSPrivateKeyKey]
+	if len(cert) == 0 || len(key) == 0 {
+		return
+	}
+	certBase64 := base64.StdEncoding.EncodeToString(cert)
+	keyBase64 := base64.StdEncoding.EncodeToString(key)
+
+	source := spec.KubernetesSecretSource(secret.Namespace, secret.Name)
+	for _, s := range si.service.ListTLSSecrets() {
+		if s.KubernetesSecret != source {
+			continue
+		}
+		if s.CertBase64 == certBase64 && s.KeyBase64 == keyBase64 {
+			continue
+		}
+
+		s.CertBase64, s.KeyBase64 = certBase64, keyBase64
+		si.service.PutTLSSecret(s)
+		logger.Infof("import TLS secret %s again from changed secret %s", s.Name, source)
+	}
+}
+
+// resync imports the changed secrets, it is called when the master
+// becomes the leader, since the events before are ignored.
+func (si *secretImporter) resync() {
+	if !si.secrets.Informer().HasSynced() {
+		return
+	}
+
+	secrets, err := si.secrets.Lister().List(labels.Everything())
+	if err != nil {
+		logger.Errorf("list secrets failed: %v", err)
+		return
+	}
+
+	for _, secret := range secrets {
+		si.onSecret(secret)
+	}
+}
+
+func (si *secretImporter) close() {
+	close(si.done)
+}
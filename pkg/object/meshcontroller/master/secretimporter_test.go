@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"context"
+	"encoding/base64"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+)
+
+func newTLSSecret(namespace, name, cert string) *apicorev1.Secret {
+	return &apicorev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Type:       apicorev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			apicorev1.TLSCertKey:       []byte(cert),
+			apicorev1.TLSPrivateKeyKey: []byte("key"),
+		},
+	}
+}
+
+func TestSecretImporter(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := newTestMaster(t).service
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	certOf := func(name string) string { return svc.GetTLSSecret(name).CertBase64 }
+
+	svc.PutTLSSecret(&spec.TLSSecret{
+		Name: "web", CertBase64: encode("cert-1"), KeyBase64: encode("key"),
+		KubernetesSecret: spec.KubernetesSecretSource("prod", "web"),
+	})
+	// the secrets created in the mesh are never overwritten.
+	svc.PutTLSSecret(&spec.TLSSecret{
+		Name: "manual", CertBase64: encode("cert-1"), KeyBase64: encode("key"),
+	})
+
+	clientset := fake.NewSimpleClientset(
+		newTLSSecret("prod", "web", "cert-2"),
+		newTLSSecret("prod", "manual", "cert-2"),
+	)
+
+	var leader atomic.Bool
+	si := newSecretImporter(clientset, svc, leader.Load)
+	defer si.close()
+
+	// the events are ignored until the master becomes the leader.
+	assert.Eventually(si.secrets.Informer().HasSynced, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(encode("cert-1"), certOf("web"))
+
+	leader.Store(true)
+	si.resync()
+	assert.Equal(encode("cert-2"), certOf("web"))
+	assert.Equal(encode("cert-1"), certOf("manual"))
+
+	// the rotated secret is imported again.
+	_, err := clientset.CoreV1().Secrets("prod").Update(context.Background(),
+		newTLSSecret("prod", "web", "cert-3"), metav1.UpdateOptions{})
+	assert.NoError(err)
+	assert.Eventually(func() bool { return certOf("web") == encode("cert-3") }, 5*time.Second, 10*time.Millisecond)
+
+	// secrets with the same name in other namespaces are not the source.
+	_, err = clientset.CoreV1().Secrets("default").Create(context.Background(),
+		newTLSSecret("default", "web", "cert-4"), metav1.CreateOptions{})
+	assert.NoError(err)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(encode("cert-3"), certOf("web"))
+	assert.Equal(encode("cert-1"), certOf("manual"))
+}
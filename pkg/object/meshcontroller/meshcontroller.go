@@ -24,6 +24,7 @@ import (
 	egapi "github.com/megaease/easegress/v2/pkg/api"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/api"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/egressgateway"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/ingresscontroller"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/label"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/master"
@@ -62,6 +63,7 @@ type (
 		master            *master.Master
 		worker            *worker.Worker
 		ingressController *ingresscontroller.IngressController
+		egressGateway     *egressgateway.EgressGateway
 	}
 )
 
@@ -137,6 +139,12 @@ func (mc *MeshController) reload() {
 		logger.Infof("%s running in ingress controller role", mc.superSpec.Name())
 		mc.role = label.ValueRoleIngressController
 		mc.ingressController = ingresscontroller.New(mc.superSpec)
+
+	case label.ValueRoleEgressGateway:
+		egressGatewayName := mc.superSpec.Super().Options().Labels[label.KeyEgressGatewayName]
+		logger.Infof("%s running in egress gateway role for %s", mc.superSpec.Name(), egressGatewayName)
+		mc.role = label.ValueRoleEgressGateway
+		mc.egressGateway = egressgateway.New(mc.superSpec, egressGatewayName)
 	}
 }
 
@@ -150,6 +158,10 @@ func (mc *MeshController) Status() *supervisor.Status {
 		return mc.worker.Status()
 	}
 
+	if mc.egressGateway != nil {
+		return mc.egressGateway.Status()
+	}
+
 	return mc.ingressController.Status()
 }
 
@@ -171,4 +183,9 @@ func (mc *MeshController) Close() {
 		mc.ingressController.Close()
 		return
 	}
+
+	if mc.egressGateway != nil {
+		mc.egressGateway.Close()
+		return
+	}
 }
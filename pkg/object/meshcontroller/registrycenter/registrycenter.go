@@ -102,6 +102,7 @@ func (rcs *Server) Register(serviceSpec *spec.Service, ingressReady ReadyFunc, e
 	}
 
 	rcs.instanceSpec.Port = uint32(serviceSpec.Sidecar.IngressPort)
+	rcs.instanceSpec.Ports = serviceSpec.SidecarInstancePorts()
 
 	go rcs.register(rcs.instanceSpec, ingressReady, egressReady)
 
@@ -166,6 +167,15 @@ func needUpdateRecord(originIns, ins *spec.ServiceInstanceSpec) bool {
 		return true
 	}
 
+	if len(originIns.Ports) != len(ins.Ports) {
+		return true
+	}
+	for i, p := range ins.Ports {
+		if *originIns.Ports[i] != *p {
+			return true
+		}
+	}
+
 	return false
 }
 
@@ -465,6 +465,52 @@ func (s *Service) DeleteServiceInstanceSpec(serviceName, instanceID string) {
 	}
 }
 
+// GetServiceInstanceConfig gets the effective sidecar config of service instance.
+func (s *Service) GetServiceInstanceConfig(serviceName, instanceID string) *spec.SidecarConfig {
+	value, err := s.store.Get(layout.ServiceInstanceConfigKey(serviceName, instanceID))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	config := &spec.SidecarConfig{}
+	err = codectool.Unmarshal([]byte(*value), config)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unmarshal %s to json failed: %v", *value, err))
+	}
+
+	return config
+}
+
+// GetFederationCatalog gets the services and instances exported to the
+// federation peers, the ones imported from peers are excluded.
+func (s *Service) GetFederationCatalog() *spec.FederationCatalog {
+	catalog := &spec.FederationCatalog{
+		Services:  []*spec.Service{},
+		Instances: []*spec.ServiceInstanceSpec{},
+	}
+	if s.spec.Federation != nil {
+		catalog.ClusterName = s.spec.Federation.ClusterName
+	}
+
+	for _, service := range s.ListServiceSpecs() {
+		if !service.IsFederated() {
+			catalog.Services = append(catalog.Services, service)
+		}
+	}
+
+	for _, instance := range s.ListAllServiceInstanceSpecs() {
+		if !instance.IsFederated() {
+			catalog.Instances = append(catalog.Instances, instance)
+		}
+	}
+
+	return catalog
+}
+
 // ListTenantSpecs lists tenant specs
 func (s *Service) ListTenantSpecs() []*spec.Tenant {
 	tenants := []*spec.Tenant{}
@@ -622,6 +668,307 @@ func (s *Service) DeleteIngressSpec(ingressName string) {
 	}
 }
 
+// GetTLSSecret gets the TLS secret
+func (s *Service) GetTLSSecret(name string) *spec.TLSSecret {
+	value, err := s.store.Get(layout.TLSSecretKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	secret := &spec.TLSSecret{}
+	err = codectool.Unmarshal([]byte(*value), secret)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unmarshal %s to json failed: %v", *value, err))
+	}
+
+	return secret
+}
+
+// PutTLSSecret writes the TLS secret
+func (s *Service) PutTLSSecret(secret *spec.TLSSecret) {
+	buff, err := codectool.MarshalJSON(secret)
+	if err != nil {
+		panic(fmt.Errorf("BUG: marshal %#v to json failed: %v", secret, err))
+	}
+
+	err = s.store.Put(layout.TLSSecretKey(secret.Name), string(buff))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// ListTLSSecrets lists TLS secrets
+func (s *Service) ListTLSSecrets() []*spec.TLSSecret {
+	secrets := []*spec.TLSSecret{}
+	kvs, err := s.store.GetRawPrefix(layout.TLSSecretPrefix())
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	for _, v := range kvs {
+		secret := &spec.TLSSecret{}
+		err := codectool.Unmarshal(v.Value, secret)
+		if err != nil {
+			logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+			continue
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets
+}
+
+// DeleteTLSSecret deletes the TLS secret
+func (s *Service) DeleteTLSSecret(name string) {
+	err := s.store.Delete(layout.TLSSecretKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// GetWasmModule gets the WebAssembly module
+func (s *Service) GetWasmModule(name string) *spec.WasmModule {
+	value, err := s.store.Get(layout.WasmModuleKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	module := &spec.WasmModule{}
+	err = codectool.Unmarshal([]byte(*value), module)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unmarshal %s to json failed: %v", *value, err))
+	}
+
+	return module
+}
+
+// PutWasmModule writes the WebAssembly module
+func (s *Service) PutWasmModule(module *spec.WasmModule) {
+	buff, err := codectool.MarshalJSON(module)
+	if err != nil {
+		panic(fmt.Errorf("BUG: marshal %#v to json failed: %v", module, err))
+	}
+
+	err = s.store.Put(layout.WasmModuleKey(module.Name), string(buff))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// ListWasmModules lists WebAssembly modules
+func (s *Service) ListWasmModules() []*spec.WasmModule {
+	modules := []*spec.WasmModule{}
+	kvs, err := s.store.GetRawPrefix(layout.WasmModulePrefix())
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	for _, v := range kvs {
+		module := &spec.WasmModule{}
+		err := codectool.Unmarshal(v.Value, module)
+		if err != nil {
+			logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+			continue
+		}
+		modules = append(modules, module)
+	}
+
+	return modules
+}
+
+// DeleteWasmModule deletes the WebAssembly module
+func (s *Service) DeleteWasmModule(name string) {
+	err := s.store.Delete(layout.WasmModuleKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// GetEgressGatewaySpec gets the egress gateway spec
+func (s *Service) GetEgressGatewaySpec(name string) *spec.EgressGateway {
+	value, err := s.store.Get(layout.EgressGatewaySpecKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	egressGateway := &spec.EgressGateway{}
+	err = codectool.Unmarshal([]byte(*value), egressGateway)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unmarshal %s to json failed: %v", *value, err))
+	}
+
+	return egressGateway
+}
+
+// PutEgressGatewaySpec writes the egress gateway spec
+func (s *Service) PutEgressGatewaySpec(egressGateway *spec.EgressGateway) {
+	buff, err := codectool.MarshalJSON(egressGateway)
+	if err != nil {
+		panic(fmt.Errorf("BUG: marshal %#v to json failed: %v", egressGateway, err))
+	}
+
+	err = s.store.Put(layout.EgressGatewaySpecKey(egressGateway.Name), string(buff))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// ListEgressGatewaySpecs lists the egress gateway specs
+func (s *Service) ListEgressGatewaySpecs() []*spec.EgressGateway {
+	egressGateways := []*spec.EgressGateway{}
+	kvs, err := s.store.GetRawPrefix(layout.EgressGatewayPrefix())
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	for _, v := range kvs {
+		egressGateway := &spec.EgressGateway{}
+		err := codectool.Unmarshal(v.Value, egressGateway)
+		if err != nil {
+			logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+			continue
+		}
+		egressGateways = append(egressGateways, egressGateway)
+	}
+
+	return egressGateways
+}
+
+// DeleteEgressGatewaySpec deletes the egress gateway spec
+func (s *Service) DeleteEgressGatewaySpec(name string) {
+	err := s.store.Delete(layout.EgressGatewaySpecKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// PutEgressGatewayInstanceSpec puts the spec of an egress gateway instance,
+// the ServiceName of the instance is the name of the egress gateway.
+func (s *Service) PutEgressGatewayInstanceSpec(instance *spec.ServiceInstanceSpec) {
+	buff, err := codectool.MarshalJSON(instance)
+	if err != nil {
+		panic(fmt.Errorf("BUG: marshal %#v to json failed: %v", instance, err))
+	}
+
+	err = s.store.Put(layout.EgressGatewayInstanceSpecKey(instance.ServiceName, instance.InstanceID), string(buff))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// GetEgressGatewayInstanceSpec gets the spec of an egress gateway instance
+func (s *Service) GetEgressGatewayInstanceSpec(name, instanceID string) *spec.ServiceInstanceSpec {
+	value, err := s.store.Get(layout.EgressGatewayInstanceSpecKey(name, instanceID))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	instanceSpec := &spec.ServiceInstanceSpec{}
+	err = codectool.Unmarshal([]byte(*value), instanceSpec)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unmarshal %s to json failed: %v", *value, err))
+	}
+
+	return instanceSpec
+}
+
+// ListEgressGatewayInstanceSpecs lists the instance specs of an egress gateway
+func (s *Service) ListEgressGatewayInstanceSpecs(name string) []*spec.ServiceInstanceSpec {
+	return s.listEgressGatewayInstanceSpecs(layout.EgressGatewayInstanceSpecPrefix(name))
+}
+
+// ListAllEgressGatewayInstanceSpecs lists the instance specs of all egress gateways
+func (s *Service) ListAllEgressGatewayInstanceSpecs() []*spec.ServiceInstanceSpec {
+	return s.listEgressGatewayInstanceSpecs(layout.AllEgressGatewayInstanceSpecPrefix())
+}
+
+func (s *Service) listEgressGatewayInstanceSpecs(prefix string) []*spec.ServiceInstanceSpec {
+	specs := []*spec.ServiceInstanceSpec{}
+	kvs, err := s.store.GetPrefix(prefix)
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	for _, v := range kvs {
+		instance := &spec.ServiceInstanceSpec{}
+		if err = codectool.Unmarshal([]byte(v), instance); err != nil {
+			logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+			continue
+		}
+
+		specs = append(specs, instance)
+	}
+
+	return specs
+}
+
+// DeleteEgressGatewayInstanceSpec deletes the spec of an egress gateway instance
+func (s *Service) DeleteEgressGatewayInstanceSpec(name, instanceID string) {
+	err := s.store.Delete(layout.EgressGatewayInstanceSpecKey(name, instanceID))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// PutEgressGatewayInstanceStatus puts the status of an egress gateway instance,
+// the ServiceName of the status is the name of the egress gateway.
+func (s *Service) PutEgressGatewayInstanceStatus(status *spec.ServiceInstanceStatus) {
+	buff, err := codectool.MarshalJSON(status)
+	if err != nil {
+		panic(fmt.Errorf("BUG: marshal %#v to json failed: %v", status, err))
+	}
+
+	err = s.store.Put(layout.EgressGatewayInstanceStatusKey(status.ServiceName, status.InstanceID), string(buff))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// ListAllEgressGatewayInstanceStatuses lists the instance statuses of all egress gateways
+func (s *Service) ListAllEgressGatewayInstanceStatuses() []*spec.ServiceInstanceStatus {
+	statuses := []*spec.ServiceInstanceStatus{}
+	kvs, err := s.store.GetPrefix(layout.AllEgressGatewayInstanceStatusPrefix())
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	for _, v := range kvs {
+		status := &spec.ServiceInstanceStatus{}
+		if err = codectool.Unmarshal([]byte(v), status); err != nil {
+			logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+			continue
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// DeleteEgressGatewayInstanceStatus deletes the status of an egress gateway instance
+func (s *Service) DeleteEgressGatewayInstanceStatus(name, instanceID string) {
+	err := s.store.Delete(layout.EgressGatewayInstanceStatusKey(name, instanceID))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
 // ListCustomResourceKinds lists custom resource kinds
 func (s *Service) ListCustomResourceKinds() []*spec.CustomResourceKind {
 	kinds, err := s.cds.ListKinds()
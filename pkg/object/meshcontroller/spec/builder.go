@@ -21,11 +21,14 @@ import (
 	"fmt"
 
 	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/filters/faultinjector"
 	"github.com/megaease/easegress/v2/pkg/filters/meshadaptor"
 	"github.com/megaease/easegress/v2/pkg/filters/mock"
 	"github.com/megaease/easegress/v2/pkg/filters/proxies"
+	"github.com/megaease/easegress/v2/pkg/filters/proxies/grpcproxy"
 	proxy "github.com/megaease/easegress/v2/pkg/filters/proxies/httpproxy"
 	"github.com/megaease/easegress/v2/pkg/filters/ratelimiter"
+	"github.com/megaease/easegress/v2/pkg/filters/requestdenier"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/object/pipeline"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpheader"
@@ -35,21 +38,42 @@ import (
 	"github.com/megaease/easegress/v2/pkg/util/stringtool"
 )
 
+const (
+	// wasmHostKind is the kind of the WasmHost filter, the filter package
+	// is only built with the wasmhost tag, so it is not imported here.
+	wasmHostKind = "WasmHost"
+
+	defaultWasmMaxConcurrency = 10
+	defaultWasmTimeout        = "100ms"
+)
+
 type (
 	pipelineSpecBuilder struct {
 		Kind string `json:"kind"`
 		Name string `json:"name"`
 
+		requestDenierName  string
 		mockName           string
+		faultInjectorName  string
 		rateLimiterName    string
 		circuitBreakerName string
 		retryName          string
 		meshAdaptorName    string
 		proxyName          string
+		wasmNamePrefix     string
 
 		pipeline.Spec `json:",inline"`
 	}
 
+	wasmHostSpec struct {
+		filters.BaseSpec `json:",inline"`
+
+		MaxConcurrency int32             `json:"maxConcurrency"`
+		Code           string            `json:"code"`
+		Timeout        string            `json:"timeout"`
+		Parameters     map[string]string `json:"parameters,omitempty"`
+	}
+
 	proxyParam struct {
 		instanceSpecs        []*ServiceInstanceSpec
 		canaries             []*ServiceCanary
@@ -68,12 +92,15 @@ func newPipelineSpecBuilder(name string) *pipelineSpecBuilder {
 		Kind: pipeline.Kind,
 		Name: name,
 
+		requestDenierName:  "requestDenier",
 		mockName:           "mock",
+		faultInjectorName:  "faultInjector",
 		rateLimiterName:    "rateLimiter",
 		circuitBreakerName: "circuitBreaker",
 		retryName:          "retry",
 		meshAdaptorName:    "meshAdaptor",
 		proxyName:          "proxy",
+		wasmNamePrefix:     "wasm-",
 
 		Spec: pipeline.Spec{},
 	}
@@ -166,6 +193,33 @@ func (b *pipelineSpecBuilder) appendRetry(rule *resilience.RetryRule) *pipelineS
 	return b
 }
 
+func (b *pipelineSpecBuilder) appendRequestDenier(rules *ServiceTrafficRules) *pipelineSpecBuilder {
+	if rules == nil || len(rules.Deny) == 0 {
+		return b
+	}
+
+	spec := &requestdenier.Spec{
+		BaseSpec: filters.BaseSpec{
+			MetaSpec: supervisor.MetaSpec{
+				Name: b.requestDenierName,
+				Kind: requestdenier.Kind,
+			},
+		},
+		Rules: rules.Deny,
+	}
+
+	m, err := codectool.StructToMap(spec)
+	if err != nil {
+		logger.Errorf("BUG: convert %#v to map failed: %v", spec, err)
+		return b
+	}
+
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: b.requestDenierName})
+	b.Filters = append(b.Filters, m)
+
+	return b
+}
+
 func (b *pipelineSpecBuilder) appendMock(rules []*mock.Rule) *pipelineSpecBuilder {
 	if len(rules) == 0 {
 		return b
@@ -193,6 +247,82 @@ func (b *pipelineSpecBuilder) appendMock(rules []*mock.Rule) *pipelineSpecBuilde
 	return b
 }
 
+func (b *pipelineSpecBuilder) appendFaultInjector(rule *faultinjector.Rule) *pipelineSpecBuilder {
+	if rule == nil || (rule.Delay == nil && rule.Abort == nil) {
+		return b
+	}
+
+	spec := &faultinjector.Spec{
+		BaseSpec: filters.BaseSpec{
+			MetaSpec: supervisor.MetaSpec{
+				Name: b.faultInjectorName,
+				Kind: faultinjector.Kind,
+			},
+		},
+		Rule: *rule,
+	}
+
+	m, err := codectool.StructToMap(spec)
+	if err != nil {
+		logger.Errorf("BUG: convert %#v to map failed: %v", spec, err)
+		return b
+	}
+
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: b.faultInjectorName})
+	b.Filters = append(b.Filters, m)
+
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendWasmHosts(wasmFilters []*WasmFilter) *pipelineSpecBuilder {
+	if len(wasmFilters) == 0 {
+		return b
+	}
+
+	if filters.GetKind(wasmHostKind) == nil {
+		logger.Errorf("wasm filters skipped: %s is not built in, please build with tag wasmhost", wasmHostKind)
+		return b
+	}
+
+	for _, f := range wasmFilters {
+		if f.codePath == "" {
+			logger.Errorf("wasm module %s of filter %s not found", f.Module, f.Name)
+			continue
+		}
+
+		name := b.wasmNamePrefix + f.Name
+		spec := &wasmHostSpec{
+			BaseSpec: filters.BaseSpec{
+				MetaSpec: supervisor.MetaSpec{
+					Name: name,
+					Kind: wasmHostKind,
+				},
+			},
+			MaxConcurrency: f.MaxConcurrency,
+			Code:           f.codePath,
+			Timeout:        f.Timeout,
+			Parameters:     f.Parameters,
+		}
+		if spec.MaxConcurrency == 0 {
+			spec.MaxConcurrency = defaultWasmMaxConcurrency
+		}
+		if spec.Timeout == "" {
+			spec.Timeout = defaultWasmTimeout
+		}
+
+		m, err := codectool.StructToMap(spec)
+		if err != nil {
+			logger.Errorf("BUG: convert %#v to map failed: %v", spec, err)
+			continue
+		}
+
+		b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: name})
+		b.Filters = append(b.Filters, m)
+	}
+
+	return b
+}
+
 func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipelineSpecBuilder {
 	if param.lb == nil {
 		param.lb = &proxy.LoadBalanceSpec{}
@@ -221,6 +351,17 @@ func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipeline
 	}
 
 	makeServer := func(instance *ServiceInstanceSpec) *proxy.Server {
+		// NOTE: Instances imported from federation peers are reached
+		// through the federation gateways of the peers, which route
+		// requests by the host, and they are not in the trust domain
+		// of this mesh.
+		if instance.IsFederated() {
+			return &proxy.Server{
+				URL:      fmt.Sprintf("http://%s:%d", instance.IP, instance.Port),
+				KeepHost: true,
+			}
+		}
+
 		var protocol string
 		if needMTLS {
 			protocol = "https"
@@ -311,6 +452,143 @@ func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipeline
 	return b
 }
 
+func (b *pipelineSpecBuilder) appendExternalProxy(es *ExternalService) *pipelineSpecBuilder {
+	protocol, port := "http", es.Port
+	if es.TLS {
+		protocol = "https"
+	}
+	if port == 0 {
+		if es.TLS {
+			port = 443
+		} else {
+			port = 80
+		}
+	}
+
+	proxySpec := &proxy.Spec{
+		BaseSpec: filters.BaseSpec{
+			MetaSpec: supervisor.MetaSpec{
+				Name: b.proxyName,
+				Kind: proxy.Kind,
+			},
+		},
+		ServerMaxBodySize: -1,
+		Pools: []*proxy.ServerPoolSpec{
+			{
+				BaseServerPoolSpec: proxy.BaseServerPoolSpec{
+					Servers: []*proxy.Server{
+						{URL: fmt.Sprintf("%s://%s:%d", protocol, es.Host, port)},
+					},
+					LoadBalance: &proxy.LoadBalanceSpec{},
+				},
+				Timeout: es.Timeout,
+			},
+		},
+	}
+
+	m, err := codectool.StructToMap(proxySpec)
+	if err != nil {
+		logger.Errorf("BUG: convert %#v to map failed: %v", proxySpec, err)
+		return b
+	}
+
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: b.proxyName})
+	b.Filters = append(b.Filters, m)
+
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendGRPCProxyWithCanary(param *proxyParam) *pipelineSpecBuilder {
+	if param.lb == nil {
+		param.lb = &proxy.LoadBalanceSpec{}
+	}
+
+	proxySpec := &grpcproxy.Spec{
+		BaseSpec: filters.BaseSpec{
+			MetaSpec: supervisor.MetaSpec{
+				Name: b.proxyName,
+				Kind: grpcproxy.Kind,
+			},
+		},
+		Timeout: param.timeout,
+	}
+
+	makePool := func() *grpcproxy.ServerPoolSpec {
+		return &grpcproxy.ServerPoolSpec{
+			BaseServerPoolSpec: grpcproxy.BaseServerPoolSpec{
+				LoadBalance: param.lb,
+			},
+			RetryPolicy:          param.retryPolicy,
+			CircuitBreakerPolicy: param.circuitBreakerPolicy,
+			FailureCodes:         param.failureCodes,
+		}
+	}
+
+	mainPool := makePool()
+	candidatePools := make([]*grpcproxy.ServerPoolSpec, len(param.canaries))
+
+	for _, instance := range param.instanceSpecs {
+		if instance.Status != ServiceStatusUp {
+			continue
+		}
+
+		server := &grpcproxy.Server{
+			URL: fmt.Sprintf("http://%s:%d", instance.IP, instance.Port),
+		}
+
+		isCanary := false
+		for i, canary := range param.canaries {
+			if !canary.Selector.MatchInstance(instance.ServiceName,
+				instance.Labels) {
+				continue
+			}
+
+			if candidatePools[i] == nil {
+				headers := canary.TrafficRules.Clone().Headers
+				headers[ServiceCanaryHeaderKey] = &stringtool.StringMatcher{
+					Exact: canary.Name,
+				}
+				candidatePools[i] = makePool()
+				candidatePools[i].Filter = &grpcproxy.RequestMatcherSpec{
+					RequestMatcherBaseSpec: proxies.RequestMatcherBaseSpec{
+						MatchAllHeaders: true,
+						Headers:         headers,
+					},
+				}
+			}
+
+			candidatePools[i].Servers = append(candidatePools[i].Servers, server)
+
+			isCanary = true
+		}
+
+		if !isCanary {
+			mainPool.Servers = append(mainPool.Servers, server)
+		}
+	}
+
+	proxySpec.Pools = append(proxySpec.Pools, mainPool)
+
+	for _, candidate := range candidatePools {
+		if candidate == nil || len(candidate.Servers) == 0 {
+			continue
+		}
+
+		proxySpec.Pools = append(proxySpec.Pools, candidate)
+	}
+
+	m, err := codectool.StructToMap(proxySpec)
+	if err != nil {
+		logger.Errorf("BUG: convert %#v to map failed: %v", proxySpec, err)
+		return b
+	}
+
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: b.proxyName})
+	b.Filters = append(b.Filters, m)
+
+	return b
+}
+
 func (b *pipelineSpecBuilder) appendMeshAdaptor(canaries []*ServiceCanary) *pipelineSpecBuilder {
 	if len(canaries) == 0 {
 		return b
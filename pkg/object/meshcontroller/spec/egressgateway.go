@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+// egressGatewayAccessLogFormat is the default access log format of egress
+// gateway, the host is logged for auditing the outbound calls.
+const egressGatewayAccessLogFormat = "[{{Time}}] [{{RemoteAddr}} {{RealIP}} {{Method}} {{Host}} {{URI}} {{Proto}} {{StatusCode}}] [{{Duration}} rx:{{ReqSize}}B tx:{{RespSize}}B] [{{Tags}}]"
+
+// ServerName returns the HTTP server name of the egress gateway.
+func (eg *EgressGateway) ServerName() string {
+	return fmt.Sprintf("egressgateway-server-%s", eg.Name)
+}
+
+// PipelineName returns the pipeline name of the external service.
+func (eg *EgressGateway) PipelineName(host string) string {
+	return fmt.Sprintf("egressgateway-pipeline-%s-%s", eg.Name, host)
+}
+
+// ListenPort returns the port of the HTTP server of the egress gateway.
+func (eg *EgressGateway) ListenPort() int {
+	if eg.Port == 0 {
+		return EgressGatewayPort
+	}
+	return eg.Port
+}
+
+// HTTPServerSpec generates the HTTP server spec of the egress gateway, only
+// the hosts of the external services are routed.
+func (eg *EgressGateway) HTTPServerSpec() (*supervisor.Spec, error) {
+	const specFmt = `
+kind: HTTPServer
+name: %s
+port: %d
+keepAlive: true
+https: false
+clientMaxBodySize: -1
+accessLogFormat: %s`
+
+	const ruleFmt = `
+  - host: %s
+    paths:
+      - pathPrefix: /
+        backend: %s`
+
+	accessLogFormat := eg.AccessLogFormat
+	if accessLogFormat == "" {
+		accessLogFormat = egressGatewayAccessLogFormat
+	}
+
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf(specFmt, eg.ServerName(), eg.ListenPort(), strconv.Quote(accessLogFormat)))
+
+	buf.WriteString("\nrules:")
+	for _, es := range eg.ExternalServices {
+		buf.WriteString(fmt.Sprintf(ruleFmt, strconv.Quote(es.Host), strconv.Quote(eg.PipelineName(es.Host))))
+	}
+
+	yamlConfig := buf.String()
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
+
+// PipelineSpec generates the pipeline spec of the external service.
+func (eg *EgressGateway) PipelineSpec(es *ExternalService) (*supervisor.Spec, error) {
+	pipelineSpecBuilder := newPipelineSpecBuilder(eg.PipelineName(es.Host))
+	pipelineSpecBuilder.appendExternalProxy(es)
+
+	jsonConfig := pipelineSpecBuilder.jsonConfig()
+	superSpec, err := supervisor.NewSpec(jsonConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", jsonConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
+
+// SidecarEgressGatewayPipelineName returns the egress pipeline name to the
+// egress gateway.
+func (s *Service) SidecarEgressGatewayPipelineName() string {
+	return fmt.Sprintf("sidecar-egress-gateway-pipeline-%s", s.Name)
+}
+
+// SidecarEgressGatewayPipelineSpec generates the spec of the egress pipeline
+// which forwards the traffic to external services to the egress gateway.
+func (s *Service) SidecarEgressGatewayPipelineSpec(instanceSpecs []*ServiceInstanceSpec) (*supervisor.Spec, error) {
+	pipelineSpecBuilder := newPipelineSpecBuilder(s.SidecarEgressGatewayPipelineName())
+	pipelineSpecBuilder.appendProxyWithCanary(&proxyParam{
+		instanceSpecs: instanceSpecs,
+	})
+
+	jsonConfig := pipelineSpecBuilder.jsonConfig()
+	superSpec, err := supervisor.NewSpec(jsonConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", jsonConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+const (
+	// FederationGatewayServerName is the HTTP server name of the federation gateway.
+	FederationGatewayServerName = "federation-gateway-server"
+
+	federationRegistryPrefix = "federation-"
+
+	defaultFederationSyncInterval = 10 * time.Second
+)
+
+// FederationRegistryName returns the registry name of the services and
+// instances imported from the cluster.
+func FederationRegistryName(clusterName string) string {
+	return federationRegistryPrefix + clusterName
+}
+
+// IsFederated returns whether the service is imported from a federation peer.
+func (s *Service) IsFederated() bool {
+	return strings.HasPrefix(s.RegistryName, federationRegistryPrefix)
+}
+
+// IsFederated returns whether the instance is imported from a federation peer.
+func (s *ServiceInstanceSpec) IsFederated() bool {
+	return strings.HasPrefix(s.RegistryName, federationRegistryPrefix)
+}
+
+// ListenPort returns the port of the federation gateway.
+func (f *Federation) ListenPort() int {
+	if f.GatewayPort == 0 {
+		return FederationGatewayPort
+	}
+	return f.GatewayPort
+}
+
+// SyncIntervalDuration returns the interval to pull catalogs from peers.
+func (f *Federation) SyncIntervalDuration() time.Duration {
+	d, err := time.ParseDuration(f.SyncInterval)
+	if err != nil || d <= 0 {
+		return defaultFederationSyncInterval
+	}
+	return d
+}
+
+func (f *Federation) validate() error {
+	if f.ClusterName == "" {
+		return fmt.Errorf("empty cluster name")
+	}
+
+	names := map[string]struct{}{f.ClusterName: {}}
+	for _, p := range f.Peers {
+		if _, exists := names[p.ClusterName]; exists {
+			return fmt.Errorf("cluster name %s occurred multiple times", p.ClusterName)
+		}
+		names[p.ClusterName] = struct{}{}
+
+		for _, gw := range p.Gateways {
+			if _, _, err := net.SplitHostPort(gw); err != nil {
+				return fmt.Errorf("invalid gateway %s of peer %s: %v", gw, p.ClusterName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ImportService converts the service exported by the peer to the local one.
+func (p *FederationPeer) ImportService(s *Service) *Service {
+	imported := *s
+	imported.RegistryName = FederationRegistryName(p.ClusterName)
+	return &imported
+}
+
+// ImportInstance converts the instance exported by the peer to the local
+// one, its address is replaced by one of the gateways of the peer, which is
+// chosen by the index of the instance.
+func (p *FederationPeer) ImportInstance(s *ServiceInstanceSpec, index int) *ServiceInstanceSpec {
+	if len(p.Gateways) == 0 {
+		return nil
+	}
+
+	host, portStr, err := net.SplitHostPort(p.Gateways[index%len(p.Gateways)])
+	if err != nil {
+		logger.Errorf("BUG: invalid gateway of peer %s: %v", p.ClusterName, err)
+		return nil
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	labels := make(map[string]string, len(s.Labels)+1)
+	for k, v := range s.Labels {
+		labels[k] = v
+	}
+	labels[FederationClusterLabel] = p.ClusterName
+
+	// NOTE: The named ports are not imported, because the federation
+	// gateway only routes the HTTP traffic of the default port.
+	return &ServiceInstanceSpec{
+		AgentType:    s.AgentType,
+		RegistryName: FederationRegistryName(p.ClusterName),
+		ServiceName:  s.ServiceName,
+		InstanceID:   fmt.Sprintf("%s-%s", p.ClusterName, s.InstanceID),
+		IP:           host,
+		Port:         uint32(port),
+		Labels:       labels,
+		RegistryTime: s.RegistryTime,
+		Status:       s.Status,
+	}
+}
+
+// FederationGatewayPipelineName returns the pipeline name of the service in
+// the federation gateway.
+func (s *Service) FederationGatewayPipelineName() string {
+	return fmt.Sprintf("federation-gateway-pipeline-%s", s.Name)
+}
+
+// FederationGatewayPipelineSpec generates the pipeline spec of the service
+// in the federation gateway, only local instances are routed, so that the
+// traffic from peers never goes out of this cluster again.
+func (s *Service) FederationGatewayPipelineSpec(instanceSpecs []*ServiceInstanceSpec,
+	canaries []*ServiceCanary, cert, rootCert *Certificate,
+) (*supervisor.Spec, error) {
+	var localInstances []*ServiceInstanceSpec
+	for _, instance := range instanceSpecs {
+		if !instance.IsFederated() {
+			localInstances = append(localInstances, instance)
+		}
+	}
+
+	pipelineSpecBuilder := newPipelineSpecBuilder(s.FederationGatewayPipelineName())
+
+	pipelineSpecBuilder.appendRequestDenier(s.TrafficRules)
+	pipelineSpecBuilder.appendMeshAdaptor(canaries)
+	pipelineSpecBuilder.appendProxyWithCanary(&proxyParam{
+		instanceSpecs: localInstances,
+		canaries:      canaries,
+		lb:            s.LoadBalance,
+		cert:          cert,
+		rootCert:      rootCert,
+	})
+
+	jsonConfig := pipelineSpecBuilder.jsonConfig()
+	superSpec, err := supervisor.NewSpec(jsonConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", jsonConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
+
+// FederationGatewayHTTPServerSpec generates the HTTP server spec of the
+// federation gateway, requests are routed to services by the header of the
+// target service name or by the host, the same as the sidecar egress.
+func FederationGatewayHTTPServerSpec(port int, services []*Service) (*supervisor.Spec, error) {
+	const specFmt = `
+kind: HTTPServer
+name: %s
+port: %d
+keepAlive: true
+https: false
+clientMaxBodySize: -1`
+
+	const ruleFmt = `
+  - paths:
+      - pathPrefix: /
+        headers:
+          - key: %s
+            values: [%s]
+        backend: %s
+  - host: %s
+    hostRegexp: %s
+    paths:
+      - pathPrefix: /
+        backend: %s`
+
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf(specFmt, FederationGatewayServerName, port))
+
+	buf.WriteString("\nrules:")
+	for _, s := range services {
+		pipelineName := s.FederationGatewayPipelineName()
+		hostRegexp := strconv.Quote(`^(\w+\.)*` + s.Name + `\.(\w+)\.svc\..+`)
+		buf.WriteString(fmt.Sprintf(ruleFmt, ServiceRPCHeaderKey, s.Name, pipelineName,
+			s.Name, hostRegexp, pipelineName))
+	}
+
+	yamlConfig := buf.String()
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
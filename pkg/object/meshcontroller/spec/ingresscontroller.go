@@ -38,17 +38,32 @@ func (s *Service) BackendName() string {
 	return s.Name
 }
 
+// IngressControllerTLSServerName is the TLS server name of ingress controller.
+const IngressControllerTLSServerName = "ingresscontroller-tls-server"
+
 // IngressControllerHTTPServerSpec generates HTTP server spec for ingress.
 // as ingress does not belong to a service, it is not a method of 'Service'
 func IngressControllerHTTPServerSpec(port int, rules []*IngressRule) (*supervisor.Spec, error) {
+	return ingressControllerServerSpec(IngressControllerServerName, port, rules, nil)
+}
+
+// IngressControllerTLSServerSpec generates HTTPS server spec for ingress,
+// the certificate is chosen by SNI from secrets.
+func IngressControllerTLSServerSpec(port int, rules []*IngressRule, secrets []*TLSSecret) (*supervisor.Spec, error) {
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no TLS secret")
+	}
+	return ingressControllerServerSpec(IngressControllerTLSServerName, port, rules, secrets)
+}
+
+func ingressControllerServerSpec(name string, port int, rules []*IngressRule, secrets []*TLSSecret) (*supervisor.Spec, error) {
 	const specFmt = `
 kind: HTTPServer
 name: %s
 port: %d
 keepAlive: true
-https: false
-clientMaxBodySize: -1
-rules:`
+https: %v
+clientMaxBodySize: -1`
 
 	const ruleFmt = `
   - host: %s
@@ -61,9 +76,21 @@ rules:`
 
 	buf := bytes.Buffer{}
 
-	str := fmt.Sprintf(specFmt, IngressControllerServerName, port)
+	str := fmt.Sprintf(specFmt, name, port, len(secrets) > 0)
 	buf.WriteString(str)
 
+	if len(secrets) > 0 {
+		buf.WriteString("\ncerts:")
+		for _, secret := range secrets {
+			buf.WriteString(fmt.Sprintf("\n  %s: %s", secret.Name, secret.CertBase64))
+		}
+		buf.WriteString("\nkeys:")
+		for _, secret := range secrets {
+			buf.WriteString(fmt.Sprintf("\n  %s: %s", secret.Name, secret.KeyBase64))
+		}
+	}
+
+	buf.WriteString("\nrules:")
 	for _, r := range rules {
 		str = fmt.Sprintf(ruleFmt, r.Host)
 		buf.WriteString(str)
@@ -90,6 +117,7 @@ func (s *Service) IngressControllerPipelineSpec(instanceSpecs []*ServiceInstance
 ) (*supervisor.Spec, error) {
 	pipelineSpecBuilder := newPipelineSpecBuilder(s.IngressControllerPipelineName())
 
+	pipelineSpecBuilder.appendRequestDenier(s.TrafficRules)
 	pipelineSpecBuilder.appendMeshAdaptor(canaries)
 	pipelineSpecBuilder.appendProxyWithCanary(&proxyParam{
 		instanceSpecs: instanceSpecs,
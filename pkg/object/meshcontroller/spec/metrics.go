@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"sort"
+)
+
+type (
+	// ServiceMetrics is the metrics of the inbound traffic of a service
+	// instance, a service or a tenant.
+	ServiceMetrics struct {
+		// RPS is the one-minute rate of requests.
+		RPS float64 `json:"rps"`
+		// ErrorRPS is the one-minute rate of failed requests.
+		ErrorRPS float64 `json:"errorRPS"`
+		// ErrorRate is the percentage of failed requests.
+		ErrorRate float64 `json:"errorRate"`
+
+		// Latency percentiles in milliseconds.
+		P50 float64 `json:"p50"`
+		P95 float64 `json:"p95"`
+		P99 float64 `json:"p99"`
+	}
+
+	// ServiceMetricsRollup is the aggregated metrics of a service or a tenant.
+	ServiceMetricsRollup struct {
+		Name           string `json:"name"`
+		Instances      int    `json:"instances"`
+		ServiceMetrics `json:",inline"`
+	}
+
+	// AggregatedMetrics is the metrics of all services and tenants.
+	AggregatedMetrics struct {
+		Services []*ServiceMetricsRollup `json:"services"`
+		Tenants  []*ServiceMetricsRollup `json:"tenants"`
+	}
+)
+
+// MergeServiceMetrics merges metrics into one, the latency percentiles are
+// averaged with RPS as the weight, so they are approximations.
+func MergeServiceMetrics(metrics []*ServiceMetrics) *ServiceMetrics {
+	result := &ServiceMetrics{}
+	if len(metrics) == 0 {
+		return result
+	}
+
+	for _, m := range metrics {
+		result.RPS += m.RPS
+		result.ErrorRPS += m.ErrorRPS
+	}
+
+	for _, m := range metrics {
+		weight := 1 / float64(len(metrics))
+		if result.RPS > 0 {
+			weight = m.RPS / result.RPS
+		}
+		result.P50 += m.P50 * weight
+		result.P95 += m.P95 * weight
+		result.P99 += m.P99 * weight
+	}
+
+	if result.RPS > 0 {
+		result.ErrorRate = result.ErrorRPS / result.RPS * 100
+	}
+
+	return result
+}
+
+// NewAggregatedMetrics rolls the metrics reported by the instances up into
+// per-service and per-tenant metrics, the metrics of instances not in UP
+// status are ignored.
+func NewAggregatedMetrics(services []*Service, instanceSpecs []*ServiceInstanceSpec,
+	statuses []*ServiceInstanceStatus,
+) *AggregatedMetrics {
+	upInstances := map[string]struct{}{}
+	for _, instance := range instanceSpecs {
+		if instance.Status == ServiceStatusUp {
+			upInstances[instance.ServiceName+"/"+instance.InstanceID] = struct{}{}
+		}
+	}
+
+	serviceMetrics := map[string][]*ServiceMetrics{}
+	for _, status := range statuses {
+		if _, exists := upInstances[status.ServiceName+"/"+status.InstanceID]; !exists {
+			continue
+		}
+		if status.Metrics == nil {
+			continue
+		}
+		serviceMetrics[status.ServiceName] = append(serviceMetrics[status.ServiceName], status.Metrics)
+	}
+
+	result := &AggregatedMetrics{
+		Services: []*ServiceMetricsRollup{},
+		Tenants:  []*ServiceMetricsRollup{},
+	}
+
+	tenantMetrics := map[string][]*ServiceMetrics{}
+	tenantInstances := map[string]int{}
+	for _, service := range services {
+		metrics := serviceMetrics[service.Name]
+		rollup := &ServiceMetricsRollup{
+			Name:           service.Name,
+			Instances:      len(metrics),
+			ServiceMetrics: *MergeServiceMetrics(metrics),
+		}
+		result.Services = append(result.Services, rollup)
+
+		tenantMetrics[service.RegisterTenant] = append(tenantMetrics[service.RegisterTenant], &rollup.ServiceMetrics)
+		tenantInstances[service.RegisterTenant] += rollup.Instances
+	}
+
+	for tenant, metrics := range tenantMetrics {
+		result.Tenants = append(result.Tenants, &ServiceMetricsRollup{
+			Name:           tenant,
+			Instances:      tenantInstances[tenant],
+			ServiceMetrics: *MergeServiceMetrics(metrics),
+		})
+	}
+
+	sort.Slice(result.Services, func(i, j int) bool {
+		return result.Services[i].Name < result.Services[j].Name
+	})
+	sort.Slice(result.Tenants, func(i, j int) bool {
+		return result.Tenants[i].Name < result.Tenants[j].Name
+	})
+
+	return result
+}
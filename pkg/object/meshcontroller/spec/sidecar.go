@@ -19,9 +19,14 @@ package spec
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/httpserver"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/tracing"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
 )
 
 // SidecarEgressServerName returns egress HTTP server name
@@ -44,6 +49,39 @@ func (s *Service) SidecarIngressPipelineName() string {
 	return fmt.Sprintf("sidecar-ingress-pipeline-%s", s.Name)
 }
 
+// SidecarEgressPortPipelineName returns egress pipeline name of the named port
+func (s *Service) SidecarEgressPortPipelineName(portName string) string {
+	return fmt.Sprintf("sidecar-egress-pipeline-%s-%s", s.Name, portName)
+}
+
+// SidecarIngressPortHTTPServerName returns the ingress server name of the named port
+func (s *Service) SidecarIngressPortHTTPServerName(portName string) string {
+	return fmt.Sprintf("sidecar-ingress-server-%s-%s", s.Name, portName)
+}
+
+// SidecarIngressPortPipelineName returns the ingress pipeline name of the named port
+func (s *Service) SidecarIngressPortPipelineName(portName string) string {
+	return fmt.Sprintf("sidecar-ingress-pipeline-%s-%s", s.Name, portName)
+}
+
+// SidecarEgressGRPCServerName returns egress gRPC server name
+func (s *Service) SidecarEgressGRPCServerName() string {
+	return fmt.Sprintf("sidecar-egress-grpc-server-%s", s.Name)
+}
+
+// SidecarInstancePorts returns the named ports to register for the instance.
+func (s *Service) SidecarInstancePorts() []*ServicePort {
+	var ports []*ServicePort
+	for _, p := range s.Sidecar.Ports {
+		ports = append(ports, &ServicePort{
+			Name:     p.Name,
+			Protocol: p.Protocol,
+			Port:     uint32(p.IngressPort),
+		})
+	}
+	return ports
+}
+
 // ApplicationInstanceSpec returns instance spec of application.
 func (s *Service) ApplicationInstanceSpec(port uint32) *ServiceInstanceSpec {
 	return &ServiceInstanceSpec{
@@ -53,6 +91,65 @@ func (s *Service) ApplicationInstanceSpec(port uint32) *ServiceInstanceSpec {
 	}
 }
 
+// SidecarTracingSpec returns the tracing spec of the sidecar HTTP servers,
+// it returns nil if OpenTelemetry tracing is not enabled.
+func (s *Service) SidecarTracingSpec() *tracing.Spec {
+	if s.Observability == nil || s.Observability.OpenTelemetry == nil ||
+		!s.Observability.OpenTelemetry.Enabled {
+		return nil
+	}
+	otel := s.Observability.OpenTelemetry
+
+	otlp := &tracing.OTLPSpec{
+		Protocol: "http",
+		Endpoint: otel.Endpoint,
+		Insecure: otel.Insecure,
+		Headers:  otel.Headers,
+	}
+	if otel.Protocol == "grpc" {
+		otlp.Protocol = "grpc"
+	}
+
+	sampleRate := otel.SampleRate
+	if sampleRate == 0 {
+		sampleRate = 1
+	}
+
+	return &tracing.Spec{
+		ServiceName:  s.Name,
+		Attributes:   otel.ResourceAttributes,
+		SampleRate:   sampleRate,
+		Exporter:     &tracing.ExporterSpec{OTLP: otlp},
+		HeaderFormat: "trace-context",
+	}
+}
+
+// SidecarAccessLogSpec returns the access log spec of the sidecar HTTP servers,
+// it returns nil if the default access log is used.
+func (s *Service) SidecarAccessLogSpec() *httpserver.AccessLogSpec {
+	if s.Observability == nil {
+		return nil
+	}
+	return s.Observability.AccessLog
+}
+
+// sidecarObservabilityConfig returns the tracing and access log config to be
+// appended to the YAML config of sidecar HTTP servers, JSON is used since it
+// is valid YAML.
+func (s *Service) sidecarObservabilityConfig() string {
+	config := ""
+	if tracingSpec := s.SidecarTracingSpec(); tracingSpec != nil {
+		config += fmt.Sprintf("\ntracing: %s", codectool.MustMarshalJSON(tracingSpec))
+	}
+	if accessLogSpec := s.SidecarAccessLogSpec(); accessLogSpec != nil {
+		config += fmt.Sprintf("\naccessLog: %s", codectool.MustMarshalJSON(accessLogSpec))
+	}
+	if config != "" {
+		config += "\n"
+	}
+	return config
+}
+
 // SidecarEgressHTTPServerSpec returns a spec for egress HTTP server
 func (s *Service) SidecarEgressHTTPServerSpec(keepalive bool, timeout string) (*supervisor.Spec, error) {
 	egressHTTPServerFormat := `
@@ -73,6 +170,13 @@ clientMaxBodySize: -1
 		keepalive,
 		timeout)
 
+	// NOTE: The egress doesn't know the original destination of raw TCP
+	// connections, so only HTTP/1.1 and HTTP/2 are detected.
+	if s.Sidecar.EgressProtocol == PortProtocolAuto {
+		yamlConfig += "protocolDetection: {}\n"
+	}
+	yamlConfig += s.sidecarObservabilityConfig()
+
 	superSpec, err := supervisor.NewSpec(yamlConfig)
 	if err != nil {
 		logger.Errorf("new spec for %s failed: %v", err)
@@ -82,15 +186,121 @@ clientMaxBodySize: -1
 	return superSpec, nil
 }
 
+// SidecarEgressGRPCServerSpec returns a spec for egress gRPC server
+func (s *Service) SidecarEgressGRPCServerSpec() (*supervisor.Spec, error) {
+	egressGRPCServerFormat := `
+kind: GRPCServer
+name: %s
+port: %d
+`
+	yamlConfig := fmt.Sprintf(egressGRPCServerFormat,
+		s.SidecarEgressGRPCServerName(),
+		s.Sidecar.EgressGRPCPort)
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
+
 // SidecarEgressPipelineSpec returns a spec for sidecar egress pipeline
 func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec,
 	canaries []*ServiceCanary, appCert, rootCert *Certificate,
 ) (*supervisor.Spec, error) {
+	return s.sidecarEgressPipelineSpec(s.SidecarEgressPipelineName(),
+		instanceSpecs, canaries, appCert, rootCert)
+}
+
+// SidecarEgressPortPipelineSpec returns a spec for sidecar egress pipeline
+// which visits the named port of instances, the instances without the port
+// are skipped.
+func (s *Service) SidecarEgressPortPipelineSpec(portName string, instanceSpecs []*ServiceInstanceSpec,
+	canaries []*ServiceCanary, appCert, rootCert *Certificate,
+) (*supervisor.Spec, error) {
+	return s.sidecarEgressPipelineSpec(s.SidecarEgressPortPipelineName(portName),
+		portInstanceSpecs(portName, instanceSpecs), canaries, appCert, rootCert)
+}
+
+// SidecarEgressPortGRPCPipelineSpec returns a spec for sidecar egress pipeline
+// which visits the named gRPC port of instances.
+func (s *Service) SidecarEgressPortGRPCPipelineSpec(portName string, instanceSpecs []*ServiceInstanceSpec,
+	canaries []*ServiceCanary,
+) (*supervisor.Spec, error) {
+	instanceSpecs = portInstanceSpecs(portName, instanceSpecs)
 	if len(instanceSpecs) == 0 {
 		return nil, fmt.Errorf("no instance")
 	}
 
-	pipelineSpecBuilder := newPipelineSpecBuilder(s.SidecarEgressPipelineName())
+	pipelineSpecBuilder := newPipelineSpecBuilder(s.SidecarEgressPortPipelineName(portName))
+
+	var timeout string
+	var retryPolicy string
+	var circuitBreakerPolicy string
+	var failureCodes []int
+	if s.Resilience != nil {
+		pipelineSpecBuilder.appendRetry(s.Resilience.Retry)
+		pipelineSpecBuilder.appendCircuitBreaker(s.Resilience.CircuitBreaker)
+		if s.Resilience.TimeLimiter != nil {
+			timeout = s.Resilience.TimeLimiter.Timeout
+		}
+		if s.Resilience.Retry != nil {
+			retryPolicy = pipelineSpecBuilder.retryName
+		}
+		if s.Resilience.CircuitBreaker != nil {
+			circuitBreakerPolicy = pipelineSpecBuilder.circuitBreakerName
+		}
+
+		failureCodes = s.Resilience.GRPCFailureCodes
+	}
+
+	pipelineSpecBuilder.appendGRPCProxyWithCanary(&proxyParam{
+		instanceSpecs:        instanceSpecs,
+		canaries:             canaries,
+		lb:                   s.LoadBalance,
+		timeout:              timeout,
+		retryPolicy:          retryPolicy,
+		circuitBreakerPolicy: circuitBreakerPolicy,
+		failureCodes:         failureCodes,
+	})
+
+	jsonConfig := pipelineSpecBuilder.jsonConfig()
+	superSpec, err := supervisor.NewSpec(jsonConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", jsonConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
+
+// portInstanceSpecs returns copies of instances whose port is replaced
+// by the named port, the instances without the port are skipped.
+func portInstanceSpecs(portName string, instanceSpecs []*ServiceInstanceSpec) []*ServiceInstanceSpec {
+	var result []*ServiceInstanceSpec
+	for _, instance := range instanceSpecs {
+		port := instance.GetPort(portName)
+		if port == nil {
+			continue
+		}
+
+		portInstance := *instance
+		portInstance.Port = port.Port
+		result = append(result, &portInstance)
+	}
+	return result
+}
+
+func (s *Service) sidecarEgressPipelineSpec(name string, instanceSpecs []*ServiceInstanceSpec,
+	canaries []*ServiceCanary, appCert, rootCert *Certificate,
+) (*supervisor.Spec, error) {
+	if len(instanceSpecs) == 0 {
+		return nil, fmt.Errorf("no instance")
+	}
+
+	pipelineSpecBuilder := newPipelineSpecBuilder(name)
 
 	pipelineSpecBuilder.appendMeshAdaptor(canaries)
 
@@ -98,6 +308,14 @@ func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec
 		pipelineSpecBuilder.appendMock(s.Mock.Rules)
 	}
 
+	if s.FaultInjection != nil && s.FaultInjection.Enabled {
+		pipelineSpecBuilder.appendFaultInjector(&s.FaultInjection.Rule)
+	}
+
+	if s.Wasm != nil {
+		pipelineSpecBuilder.appendWasmHosts(s.Wasm.Egress)
+	}
+
 	var timeout string
 	var retryPolicy string
 	var circuitBreakerPolicy string
@@ -141,8 +359,25 @@ func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec
 }
 
 // SidecarIngressHTTPServerSpec generates a spec for sidecar ingress HTTP server
-func (s *Service) SidecarIngressHTTPServerSpec(keepalive bool, timeout string,
+func (s *Service) SidecarIngressHTTPServerSpec(applicationPort uint32, keepalive bool, timeout string,
 	cert, rootCert *Certificate,
+) (*supervisor.Spec, error) {
+	return s.sidecarIngressHTTPServerSpec(s.SidecarIngressHTTPServerName(), s.Sidecar.IngressPort,
+		s.SidecarIngressPipelineName(), s.Sidecar.IngressProtocol, applicationPort,
+		keepalive, timeout, cert, rootCert)
+}
+
+// SidecarIngressPortHTTPServerSpec generates a spec for sidecar ingress HTTP server of the named port
+func (s *Service) SidecarIngressPortHTTPServerSpec(port *SidecarPort, keepalive bool, timeout string,
+	cert, rootCert *Certificate,
+) (*supervisor.Spec, error) {
+	return s.sidecarIngressHTTPServerSpec(s.SidecarIngressPortHTTPServerName(port.Name), port.IngressPort,
+		s.SidecarIngressPortPipelineName(port.Name), port.Protocol, port.ApplicationPort,
+		keepalive, timeout, cert, rootCert)
+}
+
+func (s *Service) sidecarIngressHTTPServerSpec(name string, port int, pipelineName, protocol string,
+	applicationPort uint32, keepalive bool, timeout string, cert, rootCert *Certificate,
 ) (*supervisor.Spec, error) {
 	ingressHTTPServerFormat := `
 kind: HTTPServer
@@ -160,8 +395,6 @@ rules:
     - pathPrefix: /
       backend: %s`
 
-	name := s.SidecarIngressHTTPServerName()
-	pipelineName := s.SidecarIngressPipelineName()
 	certBase64, keyBase64, rootCertBaser64, needHTTPS := "", "", "", "false"
 	if cert != nil && rootCert != nil {
 		certBase64 = cert.CertBase64
@@ -173,9 +406,44 @@ rules:
 		timeout = defaultKeepAliveTimeout
 	}
 	yamlConfig := fmt.Sprintf(ingressHTTPServerFormat, name,
-		s.Sidecar.IngressPort, keepalive, timeout, needHTTPS,
+		port, keepalive, timeout, needHTTPS,
 		certBase64, keyBase64, rootCertBaser64, pipelineName)
 
+	if protocol == PortProtocolAuto {
+		if needHTTPS == "true" {
+			logger.Warnf("%s: protocol detection is not supported in mTLS mode", name)
+		} else {
+			yamlConfig += fmt.Sprintf("\nprotocolDetection:\n  tcpBackend: %s",
+				net.JoinHostPort(s.Sidecar.Address, strconv.Itoa(int(applicationPort))))
+		}
+	}
+	yamlConfig += s.sidecarObservabilityConfig()
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
+
+// SidecarIngressPortGRPCServerSpec generates a spec for sidecar ingress gRPC server of the named port
+func (s *Service) SidecarIngressPortGRPCServerSpec(port *SidecarPort) (*supervisor.Spec, error) {
+	ingressGRPCServerFormat := `
+kind: GRPCServer
+name: %s
+port: %d
+rules:
+  - methods:
+    - methodPrefix: /
+      backend: %s`
+
+	yamlConfig := fmt.Sprintf(ingressGRPCServerFormat,
+		s.SidecarIngressPortHTTPServerName(port.Name),
+		port.IngressPort,
+		s.SidecarIngressPortPipelineName(port.Name))
+
 	superSpec, err := supervisor.NewSpec(yamlConfig)
 	if err != nil {
 		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
@@ -187,7 +455,24 @@ rules:
 
 // SidecarIngressPipelineSpec returns a spec for sidecar ingress pipeline
 func (s *Service) SidecarIngressPipelineSpec(applicationPort uint32) (*supervisor.Spec, error) {
-	pipelineSpecBuilder := newPipelineSpecBuilder(s.SidecarIngressPipelineName())
+	return s.sidecarIngressPipelineSpec(s.SidecarIngressPipelineName(), applicationPort)
+}
+
+// SidecarIngressPortPipelineSpec returns a spec for sidecar ingress pipeline of the named port
+func (s *Service) SidecarIngressPortPipelineSpec(port *SidecarPort) (*supervisor.Spec, error) {
+	return s.sidecarIngressPipelineSpec(s.SidecarIngressPortPipelineName(port.Name), port.ApplicationPort)
+}
+
+func (s *Service) sidecarIngressPipelineSpec(name string, applicationPort uint32) (*supervisor.Spec, error) {
+	pipelineSpecBuilder := newPipelineSpecBuilder(name)
+
+	pipelineSpecBuilder.appendRequestDenier(s.TrafficRules)
+
+	// Matching requests are answered by the sidecar without
+	// contacting the application.
+	if s.Mock != nil && s.Mock.Enabled {
+		pipelineSpecBuilder.appendMock(s.Mock.Rules)
+	}
 
 	var timeout string
 	if s.Resilience != nil {
@@ -197,6 +482,10 @@ func (s *Service) SidecarIngressPipelineSpec(applicationPort uint32) (*superviso
 		}
 	}
 
+	if s.Wasm != nil {
+		pipelineSpecBuilder.appendWasmHosts(s.Wasm.Ingress)
+	}
+
 	pipelineSpecBuilder.appendProxyWithCanary(&proxyParam{
 		instanceSpecs: []*ServiceInstanceSpec{s.ApplicationInstanceSpec(applicationPort)},
 		lb:            s.LoadBalance,
@@ -212,3 +501,28 @@ func (s *Service) SidecarIngressPipelineSpec(applicationPort uint32) (*superviso
 
 	return superSpec, nil
 }
+
+// SidecarIngressPortGRPCPipelineSpec returns a spec for sidecar ingress pipeline of the named gRPC port
+func (s *Service) SidecarIngressPortGRPCPipelineSpec(port *SidecarPort) (*supervisor.Spec, error) {
+	pipelineSpecBuilder := newPipelineSpecBuilder(s.SidecarIngressPortPipelineName(port.Name))
+
+	var timeout string
+	if s.Resilience != nil && s.Resilience.TimeLimiter != nil {
+		timeout = s.Resilience.TimeLimiter.Timeout
+	}
+
+	pipelineSpecBuilder.appendGRPCProxyWithCanary(&proxyParam{
+		instanceSpecs: []*ServiceInstanceSpec{s.ApplicationInstanceSpec(port.ApplicationPort)},
+		lb:            s.LoadBalance,
+		timeout:       timeout,
+	})
+
+	jsonConfig := pipelineSpecBuilder.jsonConfig()
+	superSpec, err := supervisor.NewSpec(jsonConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", jsonConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
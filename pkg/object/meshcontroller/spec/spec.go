@@ -20,17 +20,25 @@ package spec
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/megaease/easegress/v2/pkg/cluster/customdata"
+	"github.com/megaease/easegress/v2/pkg/filters/faultinjector"
 	"github.com/megaease/easegress/v2/pkg/filters/mock"
 	proxy "github.com/megaease/easegress/v2/pkg/filters/proxies/httpproxy"
 	"github.com/megaease/easegress/v2/pkg/filters/ratelimiter"
+	"github.com/megaease/easegress/v2/pkg/filters/requestdenier"
+	"github.com/megaease/easegress/v2/pkg/object/httpserver"
 	"github.com/megaease/easegress/v2/pkg/resilience"
 	"github.com/megaease/easegress/v2/pkg/util/stringtool"
 	"github.com/megaease/easegress/v2/pkg/util/urlrule"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
@@ -57,6 +65,19 @@ const (
 	// IngressPort is the default port for ingress controller
 	IngressPort = 13010
 
+	// EgressGatewayPort is the default port for egress gateway
+	EgressGatewayPort = 13011
+
+	// FederationGatewayPort is the default port for federation gateway
+	FederationGatewayPort = 13012
+
+	// ConfigPushPort is the default port for config push server of masters
+	ConfigPushPort = 13013
+
+	// identityScheme is the scheme of the URI SANs identifying the
+	// instances and masters in their certs.
+	identityScheme = "easemesh"
+
 	// HeartbeatInterval is the default heartbeat interval for checking service heartbeat
 	HeartbeatInterval = "5s"
 
@@ -86,6 +107,29 @@ const (
 	// ServiceCanaryHeaderKey is the http header key of service canary.
 	ServiceCanaryHeaderKey = "X-Mesh-Service-Canary"
 
+	// ServicePortHeaderKey is the http header key to choose the named port
+	// of the target service in egress.
+	ServicePortHeaderKey = "X-Mesh-Service-Port"
+
+	// ServiceRPCHeaderKey is the http header key of the target service name
+	// in egress.
+	ServiceRPCHeaderKey = "X-Mesh-Rpc-Service"
+
+	// FederationClusterLabel is the label key of the cluster name of the
+	// service instances imported from federation peers.
+	FederationClusterLabel = "mesh-cluster"
+
+	// PortProtocolHTTP is the HTTP protocol of a service port.
+	PortProtocolHTTP = "http"
+
+	// PortProtocolGRPC is the gRPC protocol of a service port.
+	PortProtocolGRPC = "grpc"
+
+	// PortProtocolAuto means the protocol of a port is detected for every
+	// connection, HTTP/1.1 and HTTP/2 traffic go through the pipeline while
+	// raw TCP traffic is forwarded to the application directly.
+	PortProtocolAuto = "auto"
+
 	defaultKeepAliveTimeout = "60s"
 )
 
@@ -117,6 +161,10 @@ type (
 		// IngressPort is the port for http server in mesh ingress
 		IngressPort int `json:"ingressPort" jsonschema:"required"`
 
+		// IngressTLSPort is the port for https server in mesh ingress,
+		// the TLS config of ingresses is ignored if it is zero.
+		IngressTLSPort int `json:"ingressTLSPort,omitempty"`
+
 		ExternalServiceRegistry string `json:"externalServiceRegistry,omitempty"`
 
 		CleanExternalRegistry bool `json:"cleanExternalRegistry,omitempty"`
@@ -132,6 +180,81 @@ type (
 
 		MonitorMTLS *MonitorMTLS `json:"monitorMTLS,omitempty"`
 		WorkerSpec  WorkerSpec   `json:"workerSpec,omitempty"`
+
+		// Federation federates the mesh with the meshes of other clusters.
+		Federation *Federation `json:"federation,omitempty"`
+
+		// ConfigPush pushes the configuration from masters to workers,
+		// workers watch etcd directly if it is nil.
+		ConfigPush *ConfigPush `json:"configPush,omitempty"`
+
+		// PodRegistry registers the service instances from the lifecycle
+		// of the Kubernetes pods annotated with the service name.
+		PodRegistry *PodRegistry `json:"podRegistry,omitempty"`
+	}
+
+	// PodRegistry is the spec of registering service instances from
+	// Kubernetes pods, the instance of a pod is UP when the pod is ready,
+	// and deleted when the pod is deleted.
+	PodRegistry struct {
+		// Namespaces are the namespaces to watch, empty means all.
+		Namespaces []string `json:"namespaces,omitempty"`
+		// KubeConfig and MasterURL are used to connect the Kubernetes
+		// API server, the in-cluster config is used if both are empty.
+		KubeConfig string `json:"kubeConfig,omitempty"`
+		MasterURL  string `json:"masterURL,omitempty"`
+	}
+
+	// ConfigPush is the spec of pushing configuration snapshots from
+	// masters to workers through gRPC streams, so that workers don't
+	// need to hold their own etcd watches.
+	ConfigPush struct {
+		// ListenPort is the port of the push server which runs in masters.
+		ListenPort int `json:"listenPort,omitempty"`
+
+		// Masters are the host:port addresses of the push servers,
+		// workers subscribe to them in order.
+		Masters []string `json:"masters" jsonschema:"required,minItems=1"`
+	}
+
+	// Federation is the spec of federating with the mesh control planes
+	// of other clusters, the services and instances of the peers are
+	// imported, and the traffic to the remote instances goes through the
+	// federation gateways of the peers.
+	Federation struct {
+		// ClusterName is the name of this cluster, it must be unique
+		// among the federated clusters.
+		ClusterName string `json:"clusterName" jsonschema:"required"`
+
+		// GatewayPort is the port of the federation gateway which runs
+		// in the ingress controllers, it accepts the traffic from peers.
+		GatewayPort int `json:"gatewayPort,omitempty"`
+
+		// SyncInterval is the interval to pull catalogs from peers.
+		SyncInterval string `json:"syncInterval,omitempty" jsonschema:"format=duration"`
+
+		Peers []*FederationPeer `json:"peers,omitempty"`
+	}
+
+	// FederationPeer is the spec of a federated cluster.
+	FederationPeer struct {
+		ClusterName string `json:"clusterName" jsonschema:"required"`
+
+		// APIAddresses are the addresses of the admin API of the peer,
+		// e.g. http://10.0.1.1:2381, they are tried in order.
+		APIAddresses []string `json:"apiAddresses" jsonschema:"required,minItems=1"`
+
+		// Gateways are the host:port addresses of the federation
+		// gateways of the peer.
+		Gateways []string `json:"gateways" jsonschema:"required,minItems=1"`
+	}
+
+	// FederationCatalog is the services and instances which a cluster
+	// exports to its federation peers.
+	FederationCatalog struct {
+		ClusterName string                 `json:"clusterName"`
+		Services    []*Service             `json:"services"`
+		Instances   []*ServiceInstanceSpec `json:"instances"`
 	}
 
 	// WorkerSpec is the spec of worker
@@ -157,7 +280,7 @@ type (
 		Enabled  bool   `json:"enabled" jsonschema:"required"`
 		URL      string `json:"url" jsonschema:"required"`
 		Username string `json:"username" jsonschema:"required"`
-		Password string `json:"password" jsonschema:"required"`
+		Password string `json:"password" jsonschema:"required,writeOnly=true"`
 
 		ReporterAppendType string         `json:"reporterAppendType,omitempty"`
 		CaCertBase64       string         `json:"caCertBase64" jsonschema:"required,format=base64"`
@@ -167,7 +290,7 @@ type (
 	// MonitorCert is the spec for single pack of mTLS.
 	MonitorCert struct {
 		CertBase64 string   `json:"certBase64" jsonschema:"required,format=base64"`
-		KeyBase64  string   `json:"keyBase64" jsonschema:"required,format=base64"`
+		KeyBase64  string   `json:"keyBase64" jsonschema:"required,format=base64,writeOnly=true"`
 		Services   []string `json:"services" jsonschema:"required"`
 	}
 
@@ -187,11 +310,18 @@ type (
 		Name           string `json:"name" jsonschema:"required"`
 		RegisterTenant string `json:"registerTenant" jsonschema:"required"`
 
-		Sidecar       *Sidecar       `json:"sidecar" jsonschema:"required"`
-		Mock          *Mock          `json:"mock,omitempty"`
-		Resilience    *Resilience    `json:"resilience,omitempty"`
-		LoadBalance   *LoadBalance   `json:"loadBalance,omitempty"`
-		Observability *Observability `json:"observability,omitempty"`
+		Sidecar        *Sidecar             `json:"sidecar" jsonschema:"required"`
+		Mock           *Mock                `json:"mock,omitempty"`
+		FaultInjection *FaultInjection      `json:"faultInjection,omitempty"`
+		TrafficRules   *ServiceTrafficRules `json:"trafficRules,omitempty"`
+		Resilience     *Resilience          `json:"resilience,omitempty"`
+		LoadBalance    *LoadBalance         `json:"loadBalance,omitempty"`
+		Observability  *Observability       `json:"observability,omitempty"`
+		Wasm           *Wasm                `json:"wasm,omitempty"`
+
+		// EgressGateway is the name of the egress gateway, the traffic
+		// to external services goes through it if it is not empty.
+		EgressGateway string `json:"egressGateway,omitempty"`
 	}
 
 	// ServiceDeployment contains the information of service deployment.
@@ -215,6 +345,54 @@ type (
 		Rules []*mock.Rule `json:"rules,omitempty"`
 	}
 
+	// Wasm is the spec of WebAssembly filters of this service.
+	Wasm struct {
+		// Ingress filters run in the ingress pipelines of the sidecars
+		// of this service.
+		Ingress []*WasmFilter `json:"ingress,omitempty"`
+		// Egress filters run in the egress pipelines of the sidecars of
+		// the callers of this service, for the traffic to this service.
+		Egress []*WasmFilter `json:"egress,omitempty"`
+	}
+
+	// WasmFilter is a WasmHost filter running a mesh WebAssembly module.
+	WasmFilter struct {
+		Name           string            `json:"name" jsonschema:"required,format=urlname"`
+		Module         string            `json:"module" jsonschema:"required"`
+		MaxConcurrency int32             `json:"maxConcurrency,omitempty" jsonschema:"minimum=1"`
+		Timeout        string            `json:"timeout,omitempty" jsonschema:"format=duration"`
+		Parameters     map[string]string `json:"parameters,omitempty"`
+
+		// codePath is the local path of the module code, it is resolved
+		// by the worker before building the pipelines.
+		codePath string
+	}
+
+	// WasmModule is a WebAssembly module stored in the mesh, it is
+	// distributed to the workers which run filters referencing it.
+	WasmModule struct {
+		Name string `json:"name" jsonschema:"required,format=urlname"`
+		// Code is the base64 encoded binary of the module.
+		Code string `json:"code" jsonschema:"required,format=base64"`
+	}
+
+	// FaultInjection is the spec of faults injected into the traffic
+	// to this service by the sidecars of its callers.
+	FaultInjection struct {
+		// Enabled is the fault injection switch for this service.
+		Enabled bool `json:"enabled" jsonschema:"required"`
+
+		faultinjector.Rule `json:",inline"`
+	}
+
+	// ServiceTrafficRules is the spec of rules applied to the traffic
+	// entering this service, both from the mesh ingress controller and
+	// from other services.
+	ServiceTrafficRules struct {
+		// Deny is the rules of requests to deny before routing.
+		Deny []*requestdenier.Rule `json:"deny,omitempty"`
+	}
+
 	// Resilience is the spec of service resilience.
 	Resilience struct {
 		RateLimiter    *ratelimiter.Rule              `json:"rateLimiter,omitempty"`
@@ -222,6 +400,10 @@ type (
 		Retry          *resilience.RetryRule          `json:"retry,omitempty"`
 		TimeLimiter    *TimeLimiterRule               `json:"timeLimiter,omitempty"`
 		FailureCodes   []int                          `json:"failureCodes,omitempty" jsonschema:"uniqueItems=true"`
+
+		// GRPCFailureCodes are the gRPC status codes which are treated as
+		// failures by the resilience policies of gRPC ports.
+		GRPCFailureCodes []int `json:"grpcFailureCodes,omitempty" jsonschema:"uniqueItems=true"`
 	}
 
 	// TimeLimiterRule is the spec of TimeLimiter.
@@ -263,6 +445,23 @@ type (
 		IngressProtocol string `json:"ingressProtocol" jsonschema:"required"`
 		EgressPort      int    `json:"egressPort" jsonschema:"required"`
 		EgressProtocol  string `json:"egressProtocol" jsonschema:"required"`
+
+		// EgressGRPCPort is the egress port for gRPC traffic, gRPC ports
+		// of other services are accessible from it if it is not zero.
+		EgressGRPCPort int `json:"egressGRPCPort,omitempty"`
+
+		// Ports are the additional named ports of the service,
+		// the default port above is still used if no port is chosen.
+		Ports []*SidecarPort `json:"ports,omitempty"`
+	}
+
+	// SidecarPort is one additional named port of the sidecar, the ingress
+	// traffic of IngressPort is forwarded to ApplicationPort of the application.
+	SidecarPort struct {
+		Name            string `json:"name" jsonschema:"required"`
+		Protocol        string `json:"protocol" jsonschema:"required,enum=http,enum=grpc,enum=auto"`
+		IngressPort     int    `json:"ingressPort" jsonschema:"required"`
+		ApplicationPort uint32 `json:"applicationPort" jsonschema:"required"`
 	}
 
 	// Observability is the spec of service observability.
@@ -270,6 +469,49 @@ type (
 		OutputServer *ObservabilityOutputServer `json:"outputServer,omitempty"`
 		Tracings     *ObservabilityTracings     `json:"tracings,omitempty"`
 		Metrics      *ObservabilityMetrics      `json:"metrics,omitempty"`
+
+		// MetricsExporter exports the service metrics collected by the
+		// sidecar to Prometheus.
+		MetricsExporter *ObservabilityMetricsExporter `json:"metricsExporter,omitempty"`
+
+		// OpenTelemetry makes the sidecar emit spans of ingress and egress
+		// traffic to an OTLP collector.
+		OpenTelemetry *ObservabilityOpenTelemetry `json:"openTelemetry,omitempty"`
+
+		// AccessLog is the access log of the sidecar ingress and egress,
+		// the default access log of Easegress is used if it is nil.
+		AccessLog *httpserver.AccessLogSpec `json:"accessLog,omitempty"`
+	}
+
+	// ObservabilityOpenTelemetry is the OpenTelemetry tracing of the sidecar,
+	// the trace context is propagated in W3C trace-context headers.
+	ObservabilityOpenTelemetry struct {
+		Enabled  bool              `json:"enabled" jsonschema:"required"`
+		Protocol string            `json:"protocol,omitempty" jsonschema:"enum=,enum=http,enum=grpc"`
+		Endpoint string            `json:"endpoint" jsonschema:"required"`
+		Insecure bool              `json:"insecure,omitempty"`
+		Headers  map[string]string `json:"headers,omitempty"`
+		// SampleRate is the ratio of sampled traces, default is 1.
+		SampleRate         float64           `json:"sampleRate,omitempty" jsonschema:"minimum=0,maximum=1"`
+		ResourceAttributes map[string]string `json:"resourceAttributes,omitempty"`
+	}
+
+	// ObservabilityMetricsExporter is the Prometheus exporter of the service
+	// metrics collected by the sidecar, the metrics can be pushed to a
+	// remote-write endpoint, or pulled from the Prometheus endpoint of the
+	// admin API of the sidecar, or both.
+	ObservabilityMetricsExporter struct {
+		RemoteWrite *PrometheusRemoteWrite `json:"remoteWrite,omitempty"`
+		Pull        bool                   `json:"pull,omitempty"`
+	}
+
+	// PrometheusRemoteWrite is the spec of Prometheus remote-write endpoint.
+	PrometheusRemoteWrite struct {
+		URL string `json:"url" jsonschema:"required,format=url"`
+		// Interval is the interval of pushing metrics, default is 15s.
+		Interval string            `json:"interval,omitempty" jsonschema:"format=duration"`
+		Timeout  string            `json:"timeout,omitempty" jsonschema:"format=duration"`
+		Headers  map[string]string `json:"headers,omitempty"`
 	}
 
 	// ObservabilityOutputServer is the output server of observability.
@@ -346,7 +588,7 @@ type (
 		IP          string `json:"ip" jsonschema:"required"`
 		ServiceName string `json:"servieName" jsonschema:"required"`
 		CertBase64  string `json:"certBase64" jsonschema:"required"`
-		KeyBase64   string `json:"keyBase64" jsonschema:"required"`
+		KeyBase64   string `json:"keyBase64" jsonschema:"required,writeOnly=true"`
 		TTL         string `json:"ttl" jsonschema:"required,format=duration"`
 		SignTime    string `json:"signTime" jsonschema:"required,format=timerfc3339"`
 		HOST        string `json:"host" jsonschema:"required"`
@@ -366,10 +608,20 @@ type (
 		RegistryTime string            `json:"registryTime,omitempty"`
 		Labels       map[string]string `json:"labels,omitempty"`
 
+		// Ports are the additional named ports of the instance.
+		Ports []*ServicePort `json:"ports,omitempty"`
+
 		// Set by heartbeat timer event or API
 		Status string `json:"status"`
 	}
 
+	// ServicePort is one named port of a service instance.
+	ServicePort struct {
+		Name     string `json:"name" jsonschema:"required"`
+		Protocol string `json:"protocol" jsonschema:"required,enum=http,enum=grpc,enum=auto"`
+		Port     uint32 `json:"port" jsonschema:"required"`
+	}
+
 	// IngressPath is the path for a mesh ingress rule
 	IngressPath struct {
 		Path          string `json:"path" jsonschema:"required,pattern=^/"`
@@ -387,6 +639,64 @@ type (
 	Ingress struct {
 		Name  string         `json:"name" jsonschema:"required"`
 		Rules []*IngressRule `json:"rules" jsonschema:"required"`
+		TLS   []*IngressTLS  `json:"tls,omitempty"`
+	}
+
+	// IngressTLS is the TLS termination config of the hosts of an ingress.
+	IngressTLS struct {
+		Hosts []string `json:"hosts" jsonschema:"required,uniqueItems=true"`
+		// SecretName is the name of the TLS secret, which is imported from
+		// the Kubernetes secret with the same name if it doesn't exist.
+		SecretName string `json:"secretName" jsonschema:"required"`
+		// SecretNamespace is the namespace of the Kubernetes secret,
+		// default is `default`.
+		SecretNamespace string `json:"secretNamespace,omitempty"`
+	}
+
+	// TLSSecret is a certificate and its private key for TLS termination.
+	TLSSecret struct {
+		Name       string `json:"name" jsonschema:"required"`
+		CertBase64 string `json:"certBase64" jsonschema:"required,format=base64"`
+		KeyBase64  string `json:"keyBase64" jsonschema:"required,format=base64,writeOnly=true"`
+		// KubernetesSecret is the Kubernetes secret (namespace/name) which
+		// the secret is imported from, it is imported again on changes.
+		KubernetesSecret string `json:"kubernetesSecret,omitempty"`
+	}
+
+	// EgressGateway is the spec of mesh egress gateway, it is served by a
+	// designated set of workers, and the traffic from the services to the
+	// external world is funneled through them.
+	EgressGateway struct {
+		Name string `json:"name" jsonschema:"required"`
+
+		// Port is the port of the HTTP server of the gateway instances.
+		Port int `json:"port,omitempty"`
+
+		// ExternalServices is the allow-list of outbound traffic, requests
+		// to other hosts are rejected.
+		ExternalServices []*ExternalService `json:"externalServices" jsonschema:"required"`
+
+		// AccessLogFormat is the format of the access log for auditing the
+		// outbound calls, the host of the request is logged by default.
+		AccessLogFormat string `json:"accessLogFormat,omitempty"`
+	}
+
+	// ExternalService is an external service allowed to be accessed via the
+	// egress gateway.
+	ExternalService struct {
+		// Host is the host name the services use to access the external
+		// service.
+		Host string `json:"host" jsonschema:"required"`
+
+		// Port is the port of the external service, default is 443 if TLS
+		// is enabled, otherwise 80.
+		Port int `json:"port,omitempty" jsonschema:"minimum=0,maximum=65535"`
+
+		// TLS enables TLS origination, the services send plain HTTP to the
+		// gateway, and the gateway talks HTTPS to the external service.
+		TLS bool `json:"tls,omitempty"`
+
+		Timeout string `json:"timeout,omitempty" jsonschema:"format=duration"`
 	}
 
 	// ServiceInstanceStatus is the status of service instance.
@@ -395,6 +705,52 @@ type (
 		InstanceID  string `json:"instanceID" jsonschema:"required"`
 		// RFC3339 format
 		LastHeartbeatTime string `json:"lastHeartbeatTime" jsonschema:"required,format=timerfc3339"`
+
+		// Dependencies are the services called by the instance, which are
+		// reported by the sidecar egress with the heartbeat.
+		Dependencies []*ServiceDependency `json:"dependencies,omitempty"`
+
+		// Metrics is the metrics of the inbound traffic of the instance,
+		// which is reported by the sidecar ingress with the heartbeat.
+		Metrics *ServiceMetrics `json:"metrics,omitempty"`
+	}
+
+	// SidecarConfig is the effective configuration of a sidecar instance,
+	// it contains the specs of the objects the sidecar is running, which
+	// are resolved from the service, tenant, canary and resilience specs.
+	SidecarConfig struct {
+		ServiceName string `json:"serviceName"`
+		InstanceID  string `json:"instanceID"`
+		// RFC3339 format
+		UpdatedAt string `json:"updatedAt"`
+
+		Ingress []map[string]interface{} `json:"ingress"`
+		Egress  []map[string]interface{} `json:"egress"`
+	}
+
+	// ServiceDependency is the traffic from a service instance to a callee.
+	ServiceDependency struct {
+		Callee string `json:"callee" jsonschema:"required"`
+		// RPS is the one-minute rate of requests.
+		RPS float64 `json:"rps"`
+		// ErrorRPS is the one-minute rate of failed requests.
+		ErrorRPS float64 `json:"errorRPS"`
+	}
+
+	// ServiceTopology is the live dependency graph of services.
+	ServiceTopology struct {
+		Services []string               `json:"services"`
+		Edges    []*ServiceTopologyEdge `json:"edges"`
+	}
+
+	// ServiceTopologyEdge is the aggregated traffic from a caller service to
+	// a callee service.
+	ServiceTopologyEdge struct {
+		Caller string  `json:"caller"`
+		Callee string  `json:"callee"`
+		RPS    float64 `json:"rps"`
+		// ErrorRate is the percentage of failed requests.
+		ErrorRate float64 `json:"errorRate"`
 	}
 
 	// CustomResourceKind defines the spec of a custom resource kind
@@ -471,6 +827,185 @@ type (
 	}
 )
 
+// Validate validates Sidecar.
+func (s Sidecar) Validate() error {
+	names := map[string]struct{}{}
+	ports := map[int]struct{}{s.IngressPort: {}, s.EgressPort: {}}
+	if s.EgressGRPCPort != 0 {
+		if _, exists := ports[s.EgressGRPCPort]; exists {
+			return fmt.Errorf("egress gRPC port %d conflicts with other ports", s.EgressGRPCPort)
+		}
+		ports[s.EgressGRPCPort] = struct{}{}
+	}
+
+	for _, p := range s.Ports {
+		if _, exists := names[p.Name]; exists {
+			return fmt.Errorf("port name %s occurred multiple times", p.Name)
+		}
+		names[p.Name] = struct{}{}
+
+		if _, exists := ports[p.IngressPort]; exists {
+			return fmt.Errorf("ingress port %d of %s conflicts with other ports", p.IngressPort, p.Name)
+		}
+		ports[p.IngressPort] = struct{}{}
+
+		switch p.Protocol {
+		case PortProtocolHTTP, PortProtocolGRPC, PortProtocolAuto:
+		default:
+			// Raw TCP ports are served by auto, which forwards the non-HTTP
+			// connections to the application.
+			return fmt.Errorf("unsupported protocol %s of port %s, must be http, grpc or auto", p.Protocol, p.Name)
+		}
+	}
+
+	return nil
+}
+
+// KubernetesSecretSource returns the source of the TLS secret imported from
+// the Kubernetes secret.
+func KubernetesSecretSource(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// ValidateMTLS validates the sidecar could run in the mTLS mode of the
+// mesh, gRPC ports are not supported as the gRPC servers have no TLS, and
+// the protocols of the ingress ports can't be detected as they are TLS.
+func (s Sidecar) ValidateMTLS() error {
+	if s.IngressProtocol == PortProtocolAuto {
+		return fmt.Errorf("ingress protocol auto is not supported in mTLS mode")
+	}
+	for _, p := range s.Ports {
+		switch p.Protocol {
+		case PortProtocolGRPC:
+			return fmt.Errorf("gRPC port %s is not supported in mTLS mode", p.Name)
+		case PortProtocolAuto:
+			return fmt.Errorf("protocol auto of port %s is not supported in mTLS mode", p.Name)
+		}
+	}
+	return nil
+}
+
+// Validate validates Wasm.
+func (w Wasm) Validate() error {
+	names := map[string]struct{}{}
+	for _, filters := range [][]*WasmFilter{w.Ingress, w.Egress} {
+		for _, f := range filters {
+			if _, exists := names[f.Name]; exists {
+				return fmt.Errorf("duplicated wasm filter name %s", f.Name)
+			}
+			names[f.Name] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// ResolveWasmModules sets the local code paths of the WebAssembly
+// filters, paths is indexed by module name.
+func (s *Service) ResolveWasmModules(paths map[string]string) {
+	if s.Wasm == nil {
+		return
+	}
+
+	for _, filters := range [][]*WasmFilter{s.Wasm.Ingress, s.Wasm.Egress} {
+		for _, f := range filters {
+			f.codePath = paths[f.Module]
+		}
+	}
+}
+
+// Validate validates FaultInjection.
+func (fi FaultInjection) Validate() error {
+	if !fi.Enabled {
+		return nil
+	}
+
+	return fi.Rule.Validate()
+}
+
+// Validate validates EgressGateway.
+func (eg EgressGateway) Validate() error {
+	hosts := map[string]struct{}{}
+	for _, es := range eg.ExternalServices {
+		if es.Host == "" {
+			return fmt.Errorf("empty host of external service")
+		}
+		// The host is used in the routing rules, the server URL and the
+		// names of the pipelines, so it must be a plain host name.
+		if errs := validation.IsDNS1123Subdomain(es.Host); len(errs) > 0 {
+			return fmt.Errorf("invalid host %s of external service: %s", es.Host, strings.Join(errs, ", "))
+		}
+		if _, exists := hosts[es.Host]; exists {
+			return fmt.Errorf("external service %s occurred multiple times", es.Host)
+		}
+		hosts[es.Host] = struct{}{}
+	}
+
+	return nil
+}
+
+// NewServiceTopology aggregates the dependencies reported by the instances
+// into the service topology, the dependencies of instances not in UP status
+// are ignored.
+func NewServiceTopology(instanceSpecs []*ServiceInstanceSpec, statuses []*ServiceInstanceStatus) *ServiceTopology {
+	type edgeKey struct {
+		caller, callee string
+	}
+
+	upInstances := map[string]struct{}{}
+	services := map[string]struct{}{}
+	for _, instance := range instanceSpecs {
+		services[instance.ServiceName] = struct{}{}
+		if instance.Status == ServiceStatusUp {
+			upInstances[instance.ServiceName+"/"+instance.InstanceID] = struct{}{}
+		}
+	}
+
+	edges := map[edgeKey]*ServiceTopologyEdge{}
+	errRPS := map[edgeKey]float64{}
+	for _, status := range statuses {
+		if _, exists := upInstances[status.ServiceName+"/"+status.InstanceID]; !exists {
+			continue
+		}
+
+		for _, dep := range status.Dependencies {
+			key := edgeKey{caller: status.ServiceName, callee: dep.Callee}
+			edge := edges[key]
+			if edge == nil {
+				edge = &ServiceTopologyEdge{Caller: key.caller, Callee: key.callee}
+				edges[key] = edge
+			}
+			edge.RPS += dep.RPS
+			errRPS[key] += dep.ErrorRPS
+			services[dep.Callee] = struct{}{}
+		}
+	}
+
+	topology := &ServiceTopology{
+		Services: make([]string, 0, len(services)),
+		Edges:    make([]*ServiceTopologyEdge, 0, len(edges)),
+	}
+	for service := range services {
+		topology.Services = append(topology.Services, service)
+	}
+	sort.Strings(topology.Services)
+
+	for key, edge := range edges {
+		if edge.RPS > 0 {
+			edge.ErrorRate = errRPS[key] / edge.RPS * 100
+		}
+		topology.Edges = append(topology.Edges, edge)
+	}
+	sort.Slice(topology.Edges, func(i, j int) bool {
+		if topology.Edges[i].Caller != topology.Edges[j].Caller {
+			return topology.Edges[i].Caller < topology.Edges[j].Caller
+		}
+		return topology.Edges[i].Callee < topology.Edges[j].Callee
+	})
+
+	return topology
+}
+
 // Validate validates ServiceCanary.
 func (sc ServiceCanary) Validate() error {
 	if sc.Priority < 0 || sc.Priority > 9 {
@@ -515,6 +1050,24 @@ func (a Admin) Validate() error {
 		}
 	}
 
+	if a.Federation != nil {
+		if err := a.Federation.validate(); err != nil {
+			return fmt.Errorf("federation: %v", err)
+		}
+	}
+
+	if a.ConfigPush != nil {
+		// the config is pushed over mTLS with the certs of the instances.
+		if !a.EnablemTLS() {
+			return fmt.Errorf("config push requires strict mTLS security")
+		}
+		for _, m := range a.ConfigPush.Masters {
+			if _, _, err := net.SplitHostPort(m); err != nil {
+				return fmt.Errorf("config push: invalid master %s: %v", m, err)
+			}
+		}
+	}
+
 	if a.EnablemTLS() {
 		appCertTTL, err := time.ParseDuration(a.Security.AppCertTTL)
 		if err != nil {
@@ -555,6 +1108,41 @@ func (a Admin) EnablemTLS() bool {
 	return false
 }
 
+// InstanceIdentity returns the identity of a service instance, which is
+// the URI SAN of the cert of the instance.
+func InstanceIdentity(serviceName, instanceID string) *url.URL {
+	return &url.URL{Scheme: identityScheme, Host: "service", Path: "/" + serviceName + "/" + instanceID}
+}
+
+// MasterIdentity returns the identity of a mesh master, which is the URI
+// SAN of the cert of the master.
+func MasterIdentity(memberName string) *url.URL {
+	return &url.URL{Scheme: identityScheme, Host: "master", Path: "/" + memberName}
+}
+
+// IsMasterIdentity returns whether the URI is the identity of a mesh master.
+func IsMasterIdentity(u *url.URL) bool {
+	return u.Scheme == identityScheme && u.Host == "master"
+}
+
+// ServerPort returns the port of the config push server.
+func (cp *ConfigPush) ServerPort() int {
+	if cp.ListenPort == 0 {
+		return ConfigPushPort
+	}
+	return cp.ListenPort
+}
+
+// GetPort returns the named port of the instance, nil if not found.
+func (s *ServiceInstanceSpec) GetPort(name string) *ServicePort {
+	for _, p := range s.Ports {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
 // Key returns the key of ServiceInstanceSpec.
 func (s *ServiceInstanceSpec) Key() string {
 	return fmt.Sprintf("%s/%s/%s", s.RegistryName, s.ServiceName, s.InstanceID)
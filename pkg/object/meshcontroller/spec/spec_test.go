@@ -20,14 +20,19 @@ package spec
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/filters/faultinjector"
 	"github.com/megaease/easegress/v2/pkg/filters/mock"
 	"github.com/megaease/easegress/v2/pkg/filters/proxies"
 	"github.com/megaease/easegress/v2/pkg/filters/ratelimiter"
+	"github.com/megaease/easegress/v2/pkg/filters/requestdenier"
 	"github.com/megaease/easegress/v2/pkg/logger"
-	_ "github.com/megaease/easegress/v2/pkg/object/httpserver"
+	_ "github.com/megaease/easegress/v2/pkg/object/grpcserver"
+	"github.com/megaease/easegress/v2/pkg/object/httpserver"
 	"github.com/megaease/easegress/v2/pkg/option"
 	"github.com/megaease/easegress/v2/pkg/resilience"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
@@ -343,6 +348,215 @@ func TestSidecarEgressPipelineSpecWithMock(t *testing.T) {
 	}
 }
 
+func TestSidecarIngressPipelineSpecWithMock(t *testing.T) {
+	s := &Service{
+		Name: "order-004-mock-ingress",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+
+		Mock: &Mock{
+			Enabled: true,
+			Rules: []*mock.Rule{
+				{
+					Match: mock.MatchRule{
+						Path:    "/orders",
+						Methods: []string{"POST"},
+					},
+					Code: 503,
+					Body: "orders are suspended",
+				},
+			},
+		},
+	}
+
+	superSpec, err := s.SidecarIngressPipelineSpec(8000)
+	if err != nil {
+		t.Fatalf("ingress pipeline spec failed: %v", err)
+	}
+
+	config := superSpec.JSONConfig()
+	if !strings.Contains(config, `"kind":"Mock"`) || !strings.Contains(config, `"methods":["POST"]`) {
+		t.Fatalf("mock filter not found in ingress pipeline: %s", config)
+	}
+
+	s.Mock.Enabled = false
+	superSpec, err = s.SidecarIngressPipelineSpec(8000)
+	if err != nil {
+		t.Fatalf("ingress pipeline spec failed: %v", err)
+	}
+	if strings.Contains(superSpec.JSONConfig(), `"kind":"Mock"`) {
+		t.Fatalf("disabled mock should not be in ingress pipeline: %s", superSpec.JSONConfig())
+	}
+}
+
+func TestSidecarEgressPipelineSpecWithFaultInjection(t *testing.T) {
+	s := &Service{
+		Name: "order-005-fault",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		FaultInjection: &FaultInjection{
+			Enabled: true,
+			Rule: faultinjector.Rule{
+				Headers: map[string]*stringtool.StringMatcher{
+					"X-Chaos": {Exact: "true"},
+				},
+				Abort: &faultinjector.AbortFault{
+					Percentage: 10,
+					Code:       503,
+				},
+			},
+		},
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{
+		{
+			ServiceName: "order-005-fault",
+			InstanceID:  "zxcvb",
+			IP:          "192.168.0.110",
+			Port:        80,
+			Status:      "UP",
+		},
+	}
+
+	superSpec, err := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("egress pipeline spec failed: %v", err)
+	}
+	config := superSpec.JSONConfig()
+	if !strings.Contains(config, `"kind":"FaultInjector"`) {
+		t.Fatalf("fault injector not found in egress pipeline: %s", config)
+	}
+
+	s.FaultInjection.Enabled = false
+	superSpec, err = s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("egress pipeline spec failed: %v", err)
+	}
+	if strings.Contains(superSpec.JSONConfig(), `"kind":"FaultInjector"`) {
+		t.Fatalf("disabled fault injection should not be in egress pipeline: %s", superSpec.JSONConfig())
+	}
+
+	if err := (FaultInjection{Enabled: true}).Validate(); err == nil {
+		t.Fatalf("fault injection without any fault should be invalid")
+	}
+}
+
+func TestSidecarPipelineSpecWithWasm(t *testing.T) {
+	s := &Service{
+		Name: "order-005-wasm",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		Wasm: &Wasm{
+			Ingress: []*WasmFilter{{Name: "auth", Module: "auth-module"}},
+			Egress:  []*WasmFilter{{Name: "sign", Module: "sign-module", MaxConcurrency: 2}},
+		},
+	}
+
+	// WasmHost is not built in without the wasmhost tag, the filters
+	// are skipped and the pipeline still works.
+	superSpec, err := s.SidecarIngressPipelineSpec(8080)
+	if err != nil {
+		t.Fatalf("ingress pipeline spec failed: %v", err)
+	}
+	if strings.Contains(superSpec.JSONConfig(), `"kind":"WasmHost"`) {
+		t.Fatalf("wasm filter should be skipped: %s", superSpec.JSONConfig())
+	}
+
+	filters.Register(&filters.Kind{
+		Name:           wasmHostKind,
+		DefaultSpec:    func() filters.Spec { return &wasmHostSpec{} },
+		CreateInstance: func(spec filters.Spec) filters.Filter { return nil },
+	})
+	defer filters.Unregister(wasmHostKind)
+
+	builder := newPipelineSpecBuilder("test-wasm")
+	builder.appendWasmHosts(s.Wasm.Ingress)
+	if len(builder.Filters) != 0 {
+		t.Fatalf("wasm filter with unresolved module should be skipped: %s", builder.jsonConfig())
+	}
+
+	s.ResolveWasmModules(map[string]string{
+		"auth-module": "/tmp/auth-module.wasm",
+		"sign-module": "/tmp/sign-module.wasm",
+	})
+
+	builder = newPipelineSpecBuilder("test-wasm")
+	builder.appendWasmHosts(s.Wasm.Ingress).appendWasmHosts(s.Wasm.Egress)
+	config := builder.jsonConfig()
+	for _, want := range []string{
+		`"name":"wasm-auth"`, `"code":"/tmp/auth-module.wasm"`, `"timeout":"100ms"`, `"maxConcurrency":10`,
+		`"name":"wasm-sign"`, `"code":"/tmp/sign-module.wasm"`, `"maxConcurrency":2`,
+	} {
+		if !strings.Contains(config, want) {
+			t.Fatalf("%s not found in pipeline: %s", want, config)
+		}
+	}
+
+	s.Wasm.Egress = append(s.Wasm.Egress, &WasmFilter{Name: "auth", Module: "sign-module"})
+	if err := s.Wasm.Validate(); err == nil {
+		t.Fatalf("duplicated wasm filter names should be invalid")
+	}
+}
+
+func TestDenyTrafficRules(t *testing.T) {
+	s := &Service{
+		Name: "order-006-deny",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		TrafficRules: &ServiceTrafficRules{
+			Deny: []*requestdenier.Rule{
+				{URL: stringtool.StringMatcher{Prefix: "/actuator/"}},
+			},
+		},
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{
+		{
+			ServiceName: "order-006-deny",
+			InstanceID:  "asdfg",
+			IP:          "192.168.0.110",
+			Port:        80,
+			Status:      "UP",
+		},
+	}
+
+	superSpec, err := s.SidecarIngressPipelineSpec(8000)
+	if err != nil {
+		t.Fatalf("ingress pipeline spec failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), `"flow":[{"filter":"requestDenier"}`) {
+		t.Fatalf("request denier is not the first filter of sidecar ingress: %s", superSpec.JSONConfig())
+	}
+
+	superSpec, err = s.IngressControllerPipelineSpec(instanceSpecs, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ingress controller pipeline spec failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), `"flow":[{"filter":"requestDenier"}`) {
+		t.Fatalf("request denier is not the first filter of ingress controller: %s", superSpec.JSONConfig())
+	}
+}
+
 func TestMockPBConvert(t *testing.T) {
 	pbSpec := &v2alpha1.Mock{
 		Enabled: true,
@@ -589,6 +803,42 @@ func TestIngressHTTPServerSpec(t *testing.T) {
 	}
 }
 
+func TestIngressTLSServerSpec(t *testing.T) {
+	rule := []*IngressRule{
+		{
+			Host: "megaease.com",
+			Paths: []*IngressPath{
+				{
+					Path:    "/",
+					Backend: "portal",
+				},
+			},
+		},
+	}
+
+	_, err := IngressControllerTLSServerSpec(1234, rule, nil)
+	if err == nil {
+		t.Errorf("ingress https server spec without secrets should fail")
+	}
+
+	secrets := []*TLSSecret{
+		{Name: "megaease-com", CertBase64: serviceCertBase64, KeyBase64: serviceKeyBase64},
+	}
+	superSpec, err := IngressControllerTLSServerSpec(1234, rule, secrets)
+	if err != nil {
+		t.Fatalf("ingress https server spec failed: %v", err)
+	}
+	if superSpec.Name() != IngressControllerTLSServerName {
+		t.Errorf("unexpected ingress https server name: %s", superSpec.Name())
+	}
+	config := superSpec.JSONConfig()
+	for _, want := range []string{`"https":true`, `"megaease-com":"` + serviceCertBase64 + `"`, `"megaease-com":"` + serviceKeyBase64 + `"`} {
+		if !strings.Contains(config, want) {
+			t.Errorf("ingress https server spec should contain %s: %s", want, config)
+		}
+	}
+}
+
 func TestSidecarIngressWithResiliencePipelineSpec(t *testing.T) {
 	s := &Service{
 		Name: "order-001",
@@ -830,7 +1080,7 @@ func TestSidecarIngressPipelineSpecCert(t *testing.T) {
 		SignTime:    "2021-10-13 12:33:10",
 	}
 
-	superSpec, err := s.SidecarIngressHTTPServerSpec(false, defaultKeepAliveTimeout, cert, rootCert)
+	superSpec, err := s.SidecarIngressHTTPServerSpec(8080, false, defaultKeepAliveTimeout, cert, rootCert)
 	if err != nil {
 		t.Fatalf("ingress http server spec failed: %v", err)
 	}
@@ -860,7 +1110,7 @@ func TestSidecarIngressPipelineSpec(t *testing.T) {
 		},
 	}
 
-	superSpec, err := s.SidecarIngressHTTPServerSpec(true, "", nil, nil)
+	superSpec, err := s.SidecarIngressHTTPServerSpec(8080, true, "", nil, nil)
 	if err != nil {
 		t.Fatalf("ingress http server spec failed: %v", err)
 	}
@@ -1003,3 +1253,598 @@ func TestAppendMeshAdaptor(t *testing.T) {
 	buff, _ := codectool.MarshalJSON(b.Spec)
 	t.Logf("%s", buff)
 }
+
+func TestSidecarPortsValidate(t *testing.T) {
+	s := Sidecar{
+		Address:     "127.0.0.1",
+		IngressPort: 8080,
+		EgressPort:  9090,
+		Ports: []*SidecarPort{
+			{Name: "grpc", Protocol: PortProtocolGRPC, IngressPort: 8081, ApplicationPort: 9000},
+			{Name: "admin", Protocol: PortProtocolHTTP, IngressPort: 8082, ApplicationPort: 9001},
+		},
+	}
+	if err := s.Validate(); err != nil {
+		t.Errorf("sidecar ports should be valid, err: %v", err)
+	}
+
+	s.Ports[1].Name = "grpc"
+	if err := s.Validate(); err == nil {
+		t.Errorf("duplicated port name should be invalid")
+	}
+
+	s.Ports[1].Name = "admin"
+	s.Ports[1].IngressPort = 8080
+	if err := s.Validate(); err == nil {
+		t.Errorf("conflicted ingress port should be invalid")
+	}
+
+	s.Ports[1].IngressPort = 8082
+	s.Ports[1].Protocol = "udp"
+	if err := s.Validate(); err == nil {
+		t.Errorf("unknown protocol should be invalid")
+	}
+
+	s.Ports[1].Protocol = "tcp"
+	if err := s.Validate(); err == nil {
+		t.Errorf("tcp protocol should be invalid")
+	}
+
+	if err := s.ValidateMTLS(); err == nil {
+		t.Errorf("gRPC port should be invalid in mTLS mode")
+	}
+	s.Ports[0].Protocol = PortProtocolHTTP
+	if err := s.ValidateMTLS(); err != nil {
+		t.Errorf("sidecar without gRPC port should be valid in mTLS mode, err: %v", err)
+	}
+	s.Ports[0].Protocol = PortProtocolAuto
+	if err := s.ValidateMTLS(); err == nil {
+		t.Errorf("auto port should be invalid in mTLS mode")
+	}
+	s.Ports[0].Protocol = PortProtocolHTTP
+	s.IngressProtocol = PortProtocolAuto
+	if err := s.ValidateMTLS(); err == nil {
+		t.Errorf("auto ingress protocol should be invalid in mTLS mode")
+	}
+	s.IngressProtocol = ""
+	s.Ports[0].Protocol = PortProtocolGRPC
+
+	s.Ports[1].Protocol = PortProtocolHTTP
+	s.EgressGRPCPort = 8081
+	if err := s.Validate(); err == nil {
+		t.Errorf("conflicted egress gRPC port should be invalid")
+	}
+
+	s.EgressGRPCPort = 9091
+	if err := s.Validate(); err != nil {
+		t.Errorf("egress gRPC port should be valid, err: %v", err)
+	}
+}
+
+func TestSidecarGRPCPortSpecs(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+			EgressGRPCPort:  9091,
+			Ports: []*SidecarPort{
+				{Name: "grpc", Protocol: PortProtocolGRPC, IngressPort: 8081, ApplicationPort: 9000},
+			},
+		},
+		Resilience: &Resilience{
+			Retry: &resilience.RetryRule{
+				MaxAttempts:         3,
+				WaitDuration:        "500ms",
+				BackOffPolicy:       "random",
+				RandomizationFactor: 0.5,
+			},
+			GRPCFailureCodes: []int{14},
+		},
+	}
+
+	port := s.Sidecar.Ports[0]
+	superSpec, err := s.SidecarIngressPortGRPCServerSpec(port)
+	if err != nil {
+		t.Fatalf("ingress port grpc server spec failed: %v", err)
+	}
+	if superSpec.Name() != s.SidecarIngressPortHTTPServerName("grpc") {
+		t.Errorf("unexpected ingress port grpc server name: %s", superSpec.Name())
+	}
+
+	superSpec, err = s.SidecarIngressPortGRPCPipelineSpec(port)
+	if err != nil {
+		t.Fatalf("ingress port grpc pipeline spec failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), "http://127.0.0.1:9000") {
+		t.Errorf("ingress port grpc pipeline should visit the application: %s", superSpec.JSONConfig())
+	}
+
+	superSpec, err = s.SidecarEgressGRPCServerSpec()
+	if err != nil {
+		t.Fatalf("egress grpc server spec failed: %v", err)
+	}
+	if superSpec.Name() != s.SidecarEgressGRPCServerName() {
+		t.Errorf("unexpected egress grpc server name: %s", superSpec.Name())
+	}
+
+	instances := []*ServiceInstanceSpec{
+		{
+			ServiceName: "order-001",
+			InstanceID:  "order-001-1",
+			IP:          "10.1.0.76",
+			Port:        8080,
+			Status:      ServiceStatusUp,
+			Ports:       s.SidecarInstancePorts(),
+		},
+	}
+
+	superSpec, err = s.SidecarEgressPortGRPCPipelineSpec("grpc", instances, nil)
+	if err != nil {
+		t.Fatalf("egress port grpc pipeline spec failed: %v", err)
+	}
+	config := superSpec.JSONConfig()
+	for _, want := range []string{`"kind":"GRPCProxy"`, "http://10.1.0.76:8081", `"retryPolicy":"retry"`, `"failureCodes":[14]`} {
+		if !strings.Contains(config, want) {
+			t.Errorf("egress port grpc pipeline should contain %s: %s", want, config)
+		}
+	}
+
+	_, err = s.SidecarEgressPortGRPCPipelineSpec("unknown", instances, nil)
+	if err == nil {
+		t.Errorf("egress port grpc pipeline spec without instances should fail")
+	}
+}
+
+func TestSidecarPortSpecs(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+			Ports: []*SidecarPort{
+				{Name: "admin", Protocol: PortProtocolHTTP, IngressPort: 8082, ApplicationPort: 9001},
+			},
+		},
+	}
+
+	ports := s.SidecarInstancePorts()
+	if len(ports) != 1 || ports[0].Port != 8082 || ports[0].Name != "admin" {
+		t.Fatalf("unexpected instance ports: %v", ports)
+	}
+
+	port := s.Sidecar.Ports[0]
+	superSpec, err := s.SidecarIngressPortHTTPServerSpec(port, true, "", nil, nil)
+	if err != nil {
+		t.Fatalf("ingress port http server spec failed: %v", err)
+	}
+	if superSpec.Name() != s.SidecarIngressPortHTTPServerName("admin") {
+		t.Errorf("unexpected ingress port http server name: %s", superSpec.Name())
+	}
+
+	superSpec, err = s.SidecarIngressPortPipelineSpec(port)
+	if err != nil {
+		t.Fatalf("ingress port pipeline spec failed: %v", err)
+	}
+	if superSpec.Name() != s.SidecarIngressPortPipelineName("admin") {
+		t.Errorf("unexpected ingress port pipeline name: %s", superSpec.Name())
+	}
+
+	instances := []*ServiceInstanceSpec{
+		{
+			ServiceName: "order-001",
+			InstanceID:  "order-001-1",
+			IP:          "10.1.0.76",
+			Port:        8080,
+			Status:      ServiceStatusUp,
+			Ports:       ports,
+		},
+		{
+			ServiceName: "order-001",
+			InstanceID:  "order-001-2",
+			IP:          "10.1.0.77",
+			Port:        8080,
+			Status:      ServiceStatusUp,
+		},
+	}
+
+	superSpec, err = s.SidecarEgressPortPipelineSpec("admin", instances, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("egress port pipeline spec failed: %v", err)
+	}
+	config := superSpec.JSONConfig()
+	if !strings.Contains(config, "http://10.1.0.76:8082") || strings.Contains(config, "10.1.0.77") {
+		t.Errorf("egress port pipeline should only visit the named port: %s", config)
+	}
+	if instances[0].Port != 8080 {
+		t.Errorf("instance spec should not be modified")
+	}
+
+	_, err = s.SidecarEgressPortPipelineSpec("unknown", instances, nil, nil, nil)
+	if err == nil {
+		t.Errorf("egress port pipeline spec without instances should fail")
+	}
+}
+
+func TestSidecarProtocolDetection(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: PortProtocolAuto,
+			EgressPort:      9090,
+			EgressProtocol:  PortProtocolAuto,
+		},
+	}
+
+	superSpec, err := s.SidecarIngressHTTPServerSpec(8000, true, "", nil, nil)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), `"tcpBackend":"127.0.0.1:8000"`) {
+		t.Errorf("ingress should forward tcp connections to application: %s", superSpec.JSONConfig())
+	}
+
+	superSpec, err = s.SidecarEgressHTTPServerSpec(true, "")
+	if err != nil {
+		t.Fatalf("egress http server spec failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), `"protocolDetection"`) {
+		t.Errorf("egress should enable protocol detection: %s", superSpec.JSONConfig())
+	}
+}
+
+func TestSidecarOpenTelemetry(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		Sidecar: &Sidecar{
+			Address:     "127.0.0.1",
+			IngressPort: 8080,
+			EgressPort:  9090,
+		},
+	}
+
+	if s.SidecarTracingSpec() != nil {
+		t.Errorf("tracing should be disabled without observability")
+	}
+
+	s.Observability = &Observability{
+		OpenTelemetry: &ObservabilityOpenTelemetry{
+			Enabled:            true,
+			Protocol:           "grpc",
+			Endpoint:           "otel-collector:4317",
+			Headers:            map[string]string{"Authorization": "Bearer token"},
+			ResourceAttributes: map[string]string{"deployment.environment": "test"},
+		},
+	}
+
+	tracingSpec := s.SidecarTracingSpec()
+	if tracingSpec == nil {
+		t.Fatalf("tracing should be enabled")
+	}
+	if tracingSpec.ServiceName != "order-001" || tracingSpec.SampleRate != 1 {
+		t.Errorf("unexpected tracing spec: %+v", tracingSpec)
+	}
+
+	superSpec, err := s.SidecarIngressHTTPServerSpec(8000, true, "", nil, nil)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+	for _, want := range []string{`"serviceName":"order-001"`, `"headerFormat":"trace-context"`,
+		`"endpoint":"otel-collector:4317"`, `"protocol":"grpc"`, `"Authorization":"Bearer token"`,
+		`"deployment.environment":"test"`} {
+		if !strings.Contains(superSpec.JSONConfig(), want) {
+			t.Errorf("ingress tracing should contain %s: %s", want, superSpec.JSONConfig())
+		}
+	}
+
+	superSpec, err = s.SidecarEgressHTTPServerSpec(true, "")
+	if err != nil {
+		t.Fatalf("egress http server spec failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), `"endpoint":"otel-collector:4317"`) {
+		t.Errorf("egress should enable tracing: %s", superSpec.JSONConfig())
+	}
+
+	s.Observability.OpenTelemetry.Enabled = false
+	if s.SidecarTracingSpec() != nil {
+		t.Errorf("tracing should be disabled")
+	}
+}
+
+func TestSidecarAccessLog(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		Sidecar: &Sidecar{
+			Address:     "127.0.0.1",
+			IngressPort: 8080,
+			EgressPort:  9090,
+		},
+		Observability: &Observability{
+			AccessLog: &httpserver.AccessLogSpec{
+				Format:        "json",
+				Destination:   "stdout",
+				RedactHeaders: []string{"Authorization"},
+			},
+		},
+	}
+
+	superSpec, err := s.SidecarIngressHTTPServerSpec(8000, true, "", nil, nil)
+	if err != nil {
+		t.Fatalf("ingress http server spec failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), `"accessLog":{"destination":"stdout","format":"json","redactHeaders":["Authorization"]}`) {
+		t.Errorf("ingress should set access log: %s", superSpec.JSONConfig())
+	}
+
+	superSpec, err = s.SidecarEgressHTTPServerSpec(true, "")
+	if err != nil {
+		t.Fatalf("egress http server spec failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), `"destination":"stdout"`) {
+		t.Errorf("egress should set access log: %s", superSpec.JSONConfig())
+	}
+
+	s.Observability.AccessLog = &httpserver.AccessLogSpec{Format: "custom"}
+	if _, err = s.SidecarEgressHTTPServerSpec(true, ""); err == nil {
+		t.Errorf("custom access log format without template should be invalid")
+	}
+}
+
+func TestEgressGatewaySpecs(t *testing.T) {
+	eg := &EgressGateway{
+		Name: "egress",
+		ExternalServices: []*ExternalService{
+			{Host: "api.megaease.com", TLS: true},
+			{Host: "www.megaease.com", Port: 8080},
+		},
+	}
+
+	if err := eg.Validate(); err != nil {
+		t.Errorf("validate egress gateway failed: %v", err)
+	}
+
+	superSpec, err := eg.HTTPServerSpec()
+	if err != nil {
+		t.Fatalf("egress gateway http server spec failed: %v", err)
+	}
+	if superSpec.Name() != eg.ServerName() {
+		t.Errorf("unexpected egress gateway server name: %s", superSpec.Name())
+	}
+	config := superSpec.JSONConfig()
+	for _, want := range []string{`"port":13011`, `"host":"api.megaease.com"`, `{{Host}}`, eg.PipelineName("www.megaease.com")} {
+		if !strings.Contains(config, want) {
+			t.Errorf("egress gateway http server spec should contain %s: %s", want, config)
+		}
+	}
+
+	for i, want := range []string{"https://api.megaease.com:443", "http://www.megaease.com:8080"} {
+		superSpec, err := eg.PipelineSpec(eg.ExternalServices[i])
+		if err != nil {
+			t.Fatalf("egress gateway pipeline spec failed: %v", err)
+		}
+		if !strings.Contains(superSpec.JSONConfig(), want) {
+			t.Errorf("egress gateway pipeline spec should contain %s: %s", want, superSpec.JSONConfig())
+		}
+	}
+
+	s := &Service{Name: "order-001", EgressGateway: eg.Name}
+	superSpec, err = s.SidecarEgressGatewayPipelineSpec([]*ServiceInstanceSpec{
+		{ServiceName: eg.Name, InstanceID: "egress-1", IP: "192.168.0.1", Port: 13011, Status: ServiceStatusUp},
+	})
+	if err != nil {
+		t.Fatalf("sidecar egress gateway pipeline spec failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), "http://192.168.0.1:13011") {
+		t.Errorf("sidecar egress gateway pipeline spec should contain gateway instance: %s", superSpec.JSONConfig())
+	}
+
+	eg.ExternalServices = append(eg.ExternalServices, &ExternalService{Host: "api.megaease.com"})
+	if err := eg.Validate(); err == nil {
+		t.Errorf("validate egress gateway with duplicated hosts should fail")
+	}
+
+	for _, host := range []string{"api.megaease.com\n  - host: evil.com", "*.megaease.com", "api.megaease.com:443", "API.megaease.com"} {
+		eg.ExternalServices = []*ExternalService{{Host: host}}
+		if err := eg.Validate(); err == nil {
+			t.Errorf("validate egress gateway with host %q should fail", host)
+		}
+	}
+}
+
+func TestNewServiceTopology(t *testing.T) {
+	instances := []*ServiceInstanceSpec{
+		{ServiceName: "order", InstanceID: "order-1", Status: ServiceStatusUp},
+		{ServiceName: "order", InstanceID: "order-2", Status: ServiceStatusUp},
+		{ServiceName: "order", InstanceID: "order-3", Status: ServiceStatusOutOfService},
+		{ServiceName: "delivery", InstanceID: "delivery-1", Status: ServiceStatusUp},
+	}
+	statuses := []*ServiceInstanceStatus{
+		{ServiceName: "order", InstanceID: "order-1", Dependencies: []*ServiceDependency{
+			{Callee: "delivery", RPS: 10, ErrorRPS: 1},
+			{Callee: "payment", RPS: 5},
+		}},
+		{ServiceName: "order", InstanceID: "order-2", Dependencies: []*ServiceDependency{
+			{Callee: "delivery", RPS: 10, ErrorRPS: 3},
+		}},
+		{ServiceName: "order", InstanceID: "order-3", Dependencies: []*ServiceDependency{
+			{Callee: "delivery", RPS: 100, ErrorRPS: 100},
+		}},
+	}
+
+	topology := NewServiceTopology(instances, statuses)
+
+	if got := strings.Join(topology.Services, ","); got != "delivery,order,payment" {
+		t.Errorf("unexpected services: %s", got)
+	}
+	if len(topology.Edges) != 2 {
+		t.Fatalf("want 2 edges, got %d", len(topology.Edges))
+	}
+
+	edge := topology.Edges[0]
+	if edge.Caller != "order" || edge.Callee != "delivery" || edge.RPS != 20 || edge.ErrorRate != 20 {
+		t.Errorf("unexpected edge: %+v", edge)
+	}
+	edge = topology.Edges[1]
+	if edge.Callee != "payment" || edge.RPS != 5 || edge.ErrorRate != 0 {
+		t.Errorf("unexpected edge: %+v", edge)
+	}
+}
+
+func TestNewAggregatedMetrics(t *testing.T) {
+	services := []*Service{
+		{Name: "order", RegisterTenant: "shop"},
+		{Name: "delivery", RegisterTenant: "shop"},
+		{Name: "user", RegisterTenant: "account"},
+	}
+	instances := []*ServiceInstanceSpec{
+		{ServiceName: "order", InstanceID: "order-1", Status: ServiceStatusUp},
+		{ServiceName: "order", InstanceID: "order-2", Status: ServiceStatusUp},
+		{ServiceName: "order", InstanceID: "order-3", Status: ServiceStatusOutOfService},
+		{ServiceName: "delivery", InstanceID: "delivery-1", Status: ServiceStatusUp},
+	}
+	statuses := []*ServiceInstanceStatus{
+		{ServiceName: "order", InstanceID: "order-1", Metrics: &ServiceMetrics{RPS: 30, ErrorRPS: 3, P50: 10, P95: 20, P99: 40}},
+		{ServiceName: "order", InstanceID: "order-2", Metrics: &ServiceMetrics{RPS: 10, ErrorRPS: 1, P50: 30, P95: 40, P99: 80}},
+		{ServiceName: "order", InstanceID: "order-3", Metrics: &ServiceMetrics{RPS: 100, ErrorRPS: 100}},
+		{ServiceName: "delivery", InstanceID: "delivery-1", Metrics: &ServiceMetrics{RPS: 10, P50: 5}},
+	}
+
+	metrics := NewAggregatedMetrics(services, instances, statuses)
+
+	if len(metrics.Services) != 3 {
+		t.Fatalf("want 3 services, got %d", len(metrics.Services))
+	}
+	order := metrics.Services[1]
+	if order.Name != "order" || order.Instances != 2 || order.RPS != 40 || order.ErrorRate != 10 {
+		t.Errorf("unexpected order metrics: %+v", order)
+	}
+	if order.P50 != 15 || order.P95 != 25 || order.P99 != 50 {
+		t.Errorf("unexpected order latency: %+v", order)
+	}
+	if user := metrics.Services[2]; user.Instances != 0 || user.RPS != 0 {
+		t.Errorf("unexpected user metrics: %+v", user)
+	}
+
+	if len(metrics.Tenants) != 2 {
+		t.Fatalf("want 2 tenants, got %d", len(metrics.Tenants))
+	}
+	shop := metrics.Tenants[1]
+	if shop.Name != "shop" || shop.Instances != 3 || shop.RPS != 50 || shop.ErrorRate != 8 {
+		t.Errorf("unexpected shop metrics: %+v", shop)
+	}
+}
+
+func TestAdminValidateFederation(t *testing.T) {
+	a := Admin{
+		RegistryType:      RegistryTypeNacos,
+		HeartbeatInterval: "10s",
+		Federation: &Federation{
+			ClusterName: "dc1",
+			Peers: []*FederationPeer{
+				{ClusterName: "dc2", APIAddresses: []string{"http://10.0.2.1:2381"}, Gateways: []string{"10.0.2.10:13012"}},
+			},
+		},
+	}
+	if err := a.Validate(); err != nil {
+		t.Fatalf("valid federation failed: %v", err)
+	}
+
+	a.Federation.Peers[0].ClusterName = "dc1"
+	if err := a.Validate(); err == nil {
+		t.Errorf("duplicated cluster name should failed")
+	}
+
+	a.Federation.Peers[0].ClusterName = "dc2"
+	a.Federation.Peers[0].Gateways = []string{"10.0.2.10"}
+	if err := a.Validate(); err == nil {
+		t.Errorf("gateway without port should failed")
+	}
+}
+
+func TestFederationImport(t *testing.T) {
+	peer := &FederationPeer{
+		ClusterName: "dc2",
+		Gateways:    []string{"10.0.2.10:13012", "gw.dc2.example.com:13012"},
+	}
+
+	s := peer.ImportService(&Service{Name: "order", RegisterTenant: "shop"})
+	if !s.IsFederated() || s.RegistryName != "federation-dc2" {
+		t.Errorf("unexpected imported service: %+v", s)
+	}
+
+	remote := &ServiceInstanceSpec{
+		RegistryName: "default",
+		ServiceName:  "order",
+		InstanceID:   "order-abc",
+		IP:           "192.168.2.3",
+		Port:         8080,
+		Labels:       map[string]string{"version": "v1"},
+		Status:       ServiceStatusUp,
+	}
+	instance := peer.ImportInstance(remote, 1)
+	if !instance.IsFederated() || instance.InstanceID != "dc2-order-abc" {
+		t.Errorf("unexpected imported instance: %+v", instance)
+	}
+	if instance.IP != "gw.dc2.example.com" || instance.Port != 13012 {
+		t.Errorf("imported instance should point to the gateway: %+v", instance)
+	}
+	if instance.Labels[FederationClusterLabel] != "dc2" || instance.Labels["version"] != "v1" {
+		t.Errorf("unexpected labels of imported instance: %v", instance.Labels)
+	}
+	if len(remote.Labels) != 1 {
+		t.Errorf("labels of the remote instance should not be changed: %v", remote.Labels)
+	}
+
+	service := &Service{
+		Name: "order",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+	}
+	local := &ServiceInstanceSpec{
+		ServiceName: "order",
+		InstanceID:  "order-xyz",
+		IP:          "192.168.1.3",
+		Port:        8080,
+		Status:      ServiceStatusUp,
+	}
+
+	superSpec, err := service.SidecarEgressPipelineSpec([]*ServiceInstanceSpec{local, instance}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("egress pipeline spec failed: %v", err)
+	}
+	config := superSpec.JSONConfig()
+	if !strings.Contains(config, `{"keepHost":true,"url":"http://gw.dc2.example.com:13012"}`) {
+		t.Errorf("imported instance should be routed to the gateway: %s", config)
+	}
+
+	superSpec, err = service.FederationGatewayPipelineSpec([]*ServiceInstanceSpec{local, instance}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("federation gateway pipeline spec failed: %v", err)
+	}
+	config = superSpec.JSONConfig()
+	if strings.Contains(config, "gw.dc2.example.com") || !strings.Contains(config, "192.168.1.3") {
+		t.Errorf("federation gateway should only route to local instances: %s", config)
+	}
+
+	superSpec, err = FederationGatewayHTTPServerSpec(13012, []*Service{service})
+	if err != nil {
+		t.Fatalf("federation gateway http server spec failed: %v", err)
+	}
+	config = superSpec.JSONConfig()
+	if !strings.Contains(config, `"host":"order"`) || !strings.Contains(config, ServiceRPCHeaderKey) {
+		t.Errorf("unexpected federation gateway http server spec: %s", config)
+	}
+}
@@ -43,6 +43,7 @@ func (worker *Worker) runAPIServer() {
 	default:
 		apis = worker.eurekaAPIs()
 	}
+	apis = append(apis, worker.sidecarConfigAPIs()...)
 	worker.apiServer.registerAPIs(apis)
 }
 
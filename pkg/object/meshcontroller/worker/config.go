@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/layout"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/object/pipeline"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// meshSidecarConfigPath is the path of the effective sidecar config.
+	meshSidecarConfigPath = "/mesh/config"
+
+	redactedValue = "<redacted>"
+
+	// writeOnlyTag is the json schema tag of the secret fields in specs,
+	// such as private keys, passwords and client secrets.
+	writeOnlyTag = "writeOnly=true"
+)
+
+func (worker *Worker) sidecarConfigAPIs() []*apiEntry {
+	return []*apiEntry{
+		{
+			Path:    meshSidecarConfigPath,
+			Method:  "GET",
+			Handler: worker.getSidecarConfig,
+		},
+	}
+}
+
+func (worker *Worker) getSidecarConfig(w http.ResponseWriter, r *http.Request) {
+	buff := codectool.MustMarshalJSON(worker.sidecarConfig())
+	worker.writeJSONBody(w, buff)
+}
+
+// sidecarConfig returns the effective config of the sidecar, the
+// objects are sorted by name to make the result stable.
+func (worker *Worker) sidecarConfig() *spec.SidecarConfig {
+	return &spec.SidecarConfig{
+		ServiceName: worker.serviceName,
+		InstanceID:  worker.instanceID,
+		UpdatedAt:   time.Now().Format(time.RFC3339),
+		Ingress:     objectSpecsToMaps(worker.ingressServer.Objects()),
+		Egress:      objectSpecsToMaps(worker.egressServer.Objects()),
+	}
+}
+
+func objectSpecsToMaps(specs []*supervisor.Spec) []map[string]interface{} {
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Name() < specs[j].Name()
+	})
+
+	maps := make([]map[string]interface{}, 0, len(specs))
+	for _, s := range specs {
+		m := map[string]interface{}{}
+		err := codectool.UnmarshalJSON([]byte(s.JSONConfig()), &m)
+		if err != nil {
+			logger.Errorf("BUG: unmarshal %s to json failed: %v", s.JSONConfig(), err)
+			continue
+		}
+		redactSecrets(m, s.ObjectSpec())
+		maps = append(maps, m)
+	}
+
+	return maps
+}
+
+// redactSecrets redacts the secret fields of the object spec, which are
+// marked writeOnly in the json schema tags of the spec and its filters.
+func redactSecrets(m map[string]interface{}, objectSpec interface{}) {
+	redactValue(m, reflect.TypeOf(objectSpec))
+
+	if _, ok := objectSpec.(*pipeline.Spec); !ok {
+		return
+	}
+	filterSpecs, _ := m["filters"].([]interface{})
+	for _, filterSpec := range filterSpecs {
+		fm, ok := filterSpec.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _ := fm["kind"].(string)
+		if k := filters.GetKind(kind); k != nil {
+			redactValue(fm, reflect.TypeOf(k.DefaultSpec()))
+		}
+	}
+}
+
+// redactValue walks the value unmarshaled from json along with the type
+// it is marshaled from.
+func redactValue(v interface{}, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if m, ok := v.(map[string]interface{}); ok {
+			redactStruct(m, t)
+		}
+	case reflect.Slice, reflect.Array:
+		values, _ := v.([]interface{})
+		for _, value := range values {
+			redactValue(value, t.Elem())
+		}
+	case reflect.Map:
+		m, _ := v.(map[string]interface{})
+		for _, value := range m {
+			redactValue(value, t.Elem())
+		}
+	}
+}
+
+func redactStruct(m map[string]interface{}, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		// The fields of inline structs are in the same level.
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				redactStruct(m, ft)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		value, ok := m[name]
+		if !ok || value == nil || value == "" {
+			continue
+		}
+		if isWriteOnly(field) {
+			m[name] = redactedValue
+			continue
+		}
+		redactValue(value, field.Type)
+	}
+}
+
+func isWriteOnly(field reflect.StructField) bool {
+	for _, tag := range strings.Split(field.Tag.Get("jsonschema"), ",") {
+		if tag == writeOnlyTag {
+			return true
+		}
+	}
+	return false
+}
+
+// updateSidecarConfig reports the effective config of the sidecar to
+// the mesh master, it only writes the storage when the config changes.
+func (worker *Worker) updateSidecarConfig() error {
+	config := worker.sidecarConfig()
+
+	objects, err := codectool.MarshalJSON([]interface{}{config.Ingress, config.Egress})
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to json failed: %v", config, err)
+		return err
+	}
+	if string(objects) == worker.lastSidecarObjects {
+		return nil
+	}
+
+	buff, err := codectool.MarshalJSON(config)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to json failed: %v", config, err)
+		return err
+	}
+
+	err = worker.store.Put(layout.ServiceInstanceConfigKey(worker.serviceName, worker.instanceID), string(buff))
+	if err != nil {
+		return err
+	}
+	worker.lastSidecarObjects = string(objects)
+
+	return nil
+}
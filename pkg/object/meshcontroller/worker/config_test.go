@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	_ "github.com/megaease/easegress/v2/pkg/filters/proxies/httpproxy"
+	_ "github.com/megaease/easegress/v2/pkg/filters/validator"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/layout"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/storage"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+const (
+	testHTTPServerYAML = `
+kind: HTTPServer
+name: mesh-ingress-server
+port: 13001
+keepAlive: true
+https: false
+keyBase64: a2V5
+keys:
+  example.com: a2V5
+rules:
+- paths:
+  - pathPrefix: /
+    backend: mesh-ingress-pipeline
+`
+
+	testPipelineYAML = `
+kind: Pipeline
+name: mesh-ingress-pipeline
+flow:
+- filter: validator
+- filter: proxy
+filters:
+- kind: Validator
+  name: validator
+  jwt:
+    algorithm: HS256
+    secret: 6d79736563726574
+- kind: Proxy
+  name: proxy
+  pools:
+  - servers:
+    - url: http://127.0.0.1:8080
+  mtls:
+    certBase64: Y2VydA==
+    keyBase64: a2V5
+    rootCertBase64: Y2VydA==
+`
+)
+
+func newTestEntity(t *testing.T, yaml string) *supervisor.ObjectEntity {
+	super := supervisor.NewDefaultMock()
+	entity, err := super.NewObjectEntityFromConfig(yaml)
+	if err != nil {
+		t.Fatalf("create entity failed: %v", err)
+	}
+	return entity
+}
+
+func TestRedactSecrets(t *testing.T) {
+	assert := assert.New(t)
+
+	maps := objectSpecsToMaps([]*supervisor.Spec{
+		newTestEntity(t, testPipelineYAML).Spec(),
+		newTestEntity(t, testHTTPServerYAML).Spec(),
+	})
+	assert.Len(maps, 2)
+
+	// the objects are sorted by name.
+	pipeline, server := maps[0], maps[1]
+	assert.Equal(redactedValue, server["keyBase64"])
+	assert.Equal(redactedValue, server["keys"])
+	assert.Equal(float64(13001), server["port"])
+
+	filters := pipeline["filters"].([]interface{})
+	jwt := filters[0].(map[string]interface{})["jwt"].(map[string]interface{})
+	assert.Equal(redactedValue, jwt["secret"])
+	assert.Equal("HS256", jwt["algorithm"])
+
+	mtls := filters[1].(map[string]interface{})["mtls"].(map[string]interface{})
+	assert.Equal(redactedValue, mtls["keyBase64"])
+	assert.Equal("Y2VydA==", mtls["certBase64"])
+
+	// the empty secrets are kept as they are.
+	m := map[string]interface{}{"keyBase64": "", "port": float64(13001)}
+	redactSecrets(m, newTestEntity(t, testHTTPServerYAML).Spec().ObjectSpec())
+	assert.Equal("", m["keyBase64"])
+}
+
+func TestUpdateSidecarConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	puts := map[string]string{}
+	cls := clustertest.NewMockedCluster()
+	cls.MockedPut = func(key, value string) error {
+		puts[key] = value
+		return nil
+	}
+
+	worker := &Worker{
+		serviceName: "order",
+		instanceID:  "order-1",
+		store:       storage.New("test", cls),
+		ingressServer: &IngressServer{
+			httpServer: newTestEntity(t, testHTTPServerYAML),
+			pipelines:  map[string]*supervisor.ObjectEntity{},
+		},
+		egressServer: &EgressServer{},
+	}
+	key := layout.ServiceInstanceConfigKey("order", "order-1")
+
+	assert.NoError(worker.updateSidecarConfig())
+	assert.Len(puts, 1)
+	config := &spec.SidecarConfig{}
+	assert.NoError(codectool.UnmarshalJSON([]byte(puts[key]), config))
+	assert.Equal("order-1", config.InstanceID)
+	assert.Len(config.Ingress, 1)
+	assert.Empty(config.Egress)
+	assert.False(strings.Contains(puts[key], "a2V5"))
+
+	// the storage is not written if the objects are not changed.
+	delete(puts, key)
+	assert.NoError(worker.updateSidecarConfig())
+	assert.Empty(puts)
+
+	worker.ingressServer.pipelines["mesh-ingress-pipeline"] = newTestEntity(t, testPipelineYAML)
+	assert.NoError(worker.updateSidecarConfig())
+	assert.NoError(codectool.UnmarshalJSON([]byte(puts[key]), config))
+	assert.Len(config.Ingress, 2)
+	assert.False(strings.Contains(puts[key], "6d79736563726574"))
+}
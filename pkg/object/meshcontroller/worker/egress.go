@@ -19,22 +19,26 @@ package worker
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/megaease/easegress/v2/pkg/object/httpserver/routers"
 
+	proxy "github.com/megaease/easegress/v2/pkg/filters/proxies/httpproxy"
 	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/grpcserver"
 	"github.com/megaease/easegress/v2/pkg/object/httpserver"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/informer"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/service"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/storage"
+	"github.com/megaease/easegress/v2/pkg/object/pipeline"
 	"github.com/megaease/easegress/v2/pkg/object/trafficcontroller"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 )
 
-const egressRPCKey = "X-Mesh-Rpc-Service"
+const egressRPCKey = spec.ServiceRPCHeaderKey
 
 type (
 	// EgressServer manages one/many ingress pipelines and one HTTPServer
@@ -44,11 +48,15 @@ type (
 
 		pipelines  map[string]*supervisor.ObjectEntity
 		httpServer *supervisor.ObjectEntity
+		// callees maps the keys of HTTP pipelines to the callee services.
+		callees    map[string]string
+		grpcServer *supervisor.ObjectEntity
 
 		tc         *trafficcontroller.TrafficController
 		namespace  string
 		inf        informer.Informer
 		instanceID string
+		wasm       *wasmModules
 
 		chReloadEvent chan struct{}
 
@@ -64,11 +72,18 @@ type (
 		httpserver.Spec `json:",inline"`
 		Cert            *spec.Certificate `json:"-"`
 	}
+
+	grpcServerSpecBuilder struct {
+		Kind            string `json:"kind"`
+		Name            string `json:"name"`
+		grpcserver.Spec `json:",inline"`
+	}
 )
 
 // NewEgressServer creates an initialized egress server
 func NewEgressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
-	serviceName, instanceID string, service *service.Service,
+	serviceName, instanceID string, service *service.Service, store storage.Storage,
+	wasm *wasmModules,
 ) *EgressServer {
 	entity, exists := super.GetSystemController(trafficcontroller.Kind)
 	if !exists {
@@ -80,7 +95,7 @@ func NewEgressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
 		panic(fmt.Errorf("BUG: want *TrafficController, got %T", entity.Instance()))
 	}
 
-	inf := informer.NewInformer(storage.New(superSpec.Name(), super.Cluster()), serviceName)
+	inf := informer.NewInformer(store, serviceName)
 
 	return &EgressServer{
 		super:     super,
@@ -93,6 +108,7 @@ func NewEgressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
 		serviceName: serviceName,
 		service:     service,
 		instanceID:  instanceID,
+		wasm:        wasm,
 
 		chReloadEvent: make(chan struct{}, 1),
 	}
@@ -114,6 +130,22 @@ func (b *httpServerSpecBuilder) jsonConfig() string {
 	return string(buff)
 }
 
+func newGRPCServerSpecBuilder(grpcServerName string, spec *grpcserver.Spec) *grpcServerSpecBuilder {
+	return &grpcServerSpecBuilder{
+		Kind: grpcserver.Kind,
+		Name: grpcServerName,
+		Spec: *spec,
+	}
+}
+
+func (b *grpcServerSpecBuilder) jsonConfig() string {
+	buff, err := codectool.MarshalJSON(b)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to json failed: %v", b, err)
+	}
+	return string(buff)
+}
+
 // InitEgress initializes the Egress HTTPServer.
 func (egs *EgressServer) InitEgress(service *spec.Service) error {
 	egs.mutex.Lock()
@@ -136,6 +168,19 @@ func (egs *EgressServer) InitEgress(service *spec.Service) error {
 	}
 	egs.httpServer = entity
 
+	if service.Sidecar.EgressGRPCPort != 0 {
+		superSpec, err := service.SidecarEgressGRPCServerSpec()
+		if err != nil {
+			return err
+		}
+
+		entity, err := egs.tc.CreateTrafficGateForSpec(egs.namespace, superSpec)
+		if err != nil {
+			return fmt.Errorf("create grpc server %s failed: %v", superSpec.Name(), err)
+		}
+		egs.grpcServer = entity
+	}
+
 	if err := egs.inf.OnAllServiceSpecs(egs.reloadBySpecs); err != nil {
 		// only return err when its type is not `AlreadyWatched`
 		if err != informer.ErrAlreadyWatched {
@@ -177,6 +222,13 @@ func (egs *EgressServer) InitEgress(service *spec.Service) error {
 		}
 	}
 
+	if err := egs.inf.OnAllWasmModules(egs.reloadByWasmModules); err != nil {
+		if err != informer.ErrAlreadyWatched {
+			logger.Errorf("add wasm modules watching failed: %v", err)
+			return err
+		}
+	}
+
 	if err := egs.inf.OnAllServiceCanaries(egs.reloadByServiceCanaries); err != nil {
 		if err != informer.ErrAlreadyWatched {
 			logger.Errorf("add service canary watching service: %s failed: %v", service.Name, err)
@@ -249,6 +301,78 @@ func (egs *EgressServer) reloadByServiceCanaries(value map[string]*spec.ServiceC
 	return true
 }
 
+func (egs *EgressServer) reloadByWasmModules(value map[string]*spec.WasmModule) bool {
+	egs.wasm.update(value)
+
+	select {
+	case egs.chReloadEvent <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (egs *EgressServer) reloadByEgressGateway(event informer.Event, value *spec.EgressGateway) bool {
+	select {
+	case egs.chReloadEvent <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (egs *EgressServer) watchEgressGateway(name string) {
+	if err := egs.inf.OnPartOfEgressGatewaySpec(name, egs.reloadByEgressGateway); err != nil {
+		if err != informer.ErrAlreadyWatched {
+			logger.Errorf("add egress gateway %s watching service: %s failed: %v", name, egs.serviceName, err)
+		}
+	}
+
+	if err := egs.inf.OnEgressGatewayInstanceSpecs(name, egs.reloadByInstances); err != nil {
+		if err != informer.ErrAlreadyWatched {
+			logger.Errorf("add egress gateway %s instance watching service: %s failed: %v", name, egs.serviceName, err)
+		}
+	}
+}
+
+// createEgressGatewayPipeline creates the pipeline to the egress gateway of
+// the service, it returns nil if the egress gateway is unavailable.
+func (egs *EgressServer) createEgressGatewayPipeline(svc *spec.Service,
+	pipelines map[string]*supervisor.ObjectEntity,
+) (*spec.EgressGateway, *supervisor.ObjectEntity) {
+	egs.watchEgressGateway(svc.EgressGateway)
+
+	egressGateway := egs.service.GetEgressGatewaySpec(svc.EgressGateway)
+	if egressGateway == nil {
+		logger.Warnf("egress gateway %s of service %s not found", svc.EgressGateway, svc.Name)
+		return nil, nil
+	}
+
+	var instances []*spec.ServiceInstanceSpec
+	for _, instance := range egs.service.ListEgressGatewayInstanceSpecs(svc.EgressGateway) {
+		if instance.Status == spec.ServiceStatusUp {
+			instances = append(instances, instance)
+		}
+	}
+	if len(instances) == 0 {
+		logger.Warnf("egress gateway %s has no instance in UP status", svc.EgressGateway)
+		return nil, nil
+	}
+
+	pipelineSpec, err := svc.SidecarEgressGatewayPipelineSpec(instances)
+	if err != nil {
+		logger.Errorf("generate sidecar egress gateway pipeline spec for service %s failed: %v", svc.Name, err)
+		return nil, nil
+	}
+
+	entity, err := egs.tc.ApplyPipelineForSpec(egs.namespace, pipelineSpec)
+	if err != nil {
+		logger.Errorf("update http pipeline failed: %v", err)
+		return nil, nil
+	}
+	pipelines[pipelineSpec.Name()] = entity
+
+	return egressGateway, entity
+}
+
 func (egs *EgressServer) listTrafficTargets(lgSvcs map[string]*spec.Service) []*spec.TrafficTarget {
 	var result []*spec.TrafficTarget
 
@@ -364,8 +488,9 @@ func (egs *EgressServer) buildHostRegex(serviceName string) string {
 	return `^(\w+\.)*` + serviceName + `\.(\w+)\.svc\..+`
 }
 
-func (egs *EgressServer) buildMuxRule(pipelineName, serviceName string, matches []spec.HTTPMatch) []*routers.Rule {
-	var rules []*routers.Rule
+// buildPortHeaders returns the headers to match requests to the service,
+// the named port is matched too if portName is not empty.
+func (egs *EgressServer) buildPortHeaders(serviceName, portName string) []*routers.Header {
 	headers := []*routers.Header{
 		{
 			Key: egressRPCKey,
@@ -374,6 +499,20 @@ func (egs *EgressServer) buildMuxRule(pipelineName, serviceName string, matches
 		},
 	}
 
+	if portName != "" {
+		headers = append(headers, &routers.Header{
+			Key:    spec.ServicePortHeaderKey,
+			Values: []string{portName},
+		})
+	}
+
+	return headers
+}
+
+func (egs *EgressServer) buildMuxRule(pipelineName, serviceName, portName string, matches []spec.HTTPMatch) []*routers.Rule {
+	var rules []*routers.Rule
+	headers := egs.buildPortHeaders(serviceName, portName)
+
 	for _, m := range matches {
 		methods := m.Methods
 		if len(methods) == 1 && methods[0] == "*" {
@@ -383,10 +522,11 @@ func (egs *EgressServer) buildMuxRule(pipelineName, serviceName string, matches
 		rule := &routers.Rule{
 			Paths: []*routers.Path{
 				{
-					Methods:    methods,
-					PathRegexp: "^" + m.PathRegex,
-					Headers:    headers,
-					Backend:    pipelineName,
+					Methods:        methods,
+					PathRegexp:     "^" + m.PathRegex,
+					Headers:        headers,
+					MatchAllHeader: true,
+					Backend:        pipelineName,
 				},
 			},
 		}
@@ -425,10 +565,17 @@ func (egs *EgressServer) reload() {
 	}
 
 	pipelines := make(map[string]*supervisor.ObjectEntity)
+	callees := make(map[string]string)
 	serverName2PipelineName := make(map[string]string)
+	// svcPortPipelineNames maps service name to pairs of port name and pipeline name.
+	svcPortPipelineNames := make(map[string][][2]string)
+	// svcGRPCPipelineNames is the same as svcPortPipelineNames, but for gRPC ports.
+	svcGRPCPipelineNames := make(map[string][][2]string)
 
 	canaries := egs.service.ListServiceCanaries()
+	wasmPaths := egs.wasm.codePaths()
 	createPipeline := func(svc *spec.Service) {
+		svc.ResolveWasmModules(wasmPaths)
 		instances := egs.listServiceInstances(svc.Name)
 		if len(instances) == 0 {
 			logger.Warnf("service %s has no instance in UP status", svc.Name)
@@ -442,13 +589,57 @@ func (egs *EgressServer) reload() {
 		}
 		logger.Infof("service: %s visit: %s pipeline init ok", egs.serviceName, svc.Name)
 
-		entity, err := egs.tc.CreatePipelineForSpec(egs.namespace, pipelineSpec)
+		entity, err := egs.tc.ApplyPipelineForSpec(egs.namespace, pipelineSpec)
 		if err != nil {
 			logger.Errorf("update http pipeline failed: %v", err)
 			return
 		}
 		pipelines[svc.Name] = entity
+		callees[svc.Name] = svc.Name
 		serverName2PipelineName[svc.Name] = pipelineSpec.Name()
+
+		for _, port := range svc.Sidecar.Ports {
+			// gRPC ports are not served in mTLS mode, see the ingress server.
+			if port.Protocol == spec.PortProtocolGRPC && egs.grpcServer != nil && cert == nil {
+				pipelineSpec, err := svc.SidecarEgressPortGRPCPipelineSpec(port.Name, instances, canaries)
+				if err != nil {
+					logger.Errorf("generate sidecar egress grpc pipeline spec for service %s port %s failed: %v",
+						svc.Name, port.Name, err)
+					continue
+				}
+
+				entity, err := egs.tc.ApplyPipelineForSpec(egs.namespace, pipelineSpec)
+				if err != nil {
+					logger.Errorf("update grpc pipeline failed: %v", err)
+					continue
+				}
+				pipelines[pipelineSpec.Name()] = entity
+				svcGRPCPipelineNames[svc.Name] = append(svcGRPCPipelineNames[svc.Name],
+					[2]string{port.Name, pipelineSpec.Name()})
+				continue
+			}
+
+			if port.Protocol != spec.PortProtocolHTTP && port.Protocol != spec.PortProtocolAuto {
+				continue
+			}
+
+			pipelineSpec, err := svc.SidecarEgressPortPipelineSpec(port.Name, instances, canaries, cert, rootCert)
+			if err != nil {
+				logger.Errorf("generate sidecar egress pipeline spec for service %s port %s failed: %v",
+					svc.Name, port.Name, err)
+				continue
+			}
+
+			entity, err := egs.tc.ApplyPipelineForSpec(egs.namespace, pipelineSpec)
+			if err != nil {
+				logger.Errorf("update http pipeline failed: %v", err)
+				continue
+			}
+			pipelines[pipelineSpec.Name()] = entity
+			callees[pipelineSpec.Name()] = svc.Name
+			svcPortPipelineNames[svc.Name] = append(svcPortPipelineNames[svc.Name],
+				[2]string{port.Name, pipelineSpec.Name()})
+		}
 	}
 
 	for _, svc := range lgSvcs {
@@ -458,10 +649,35 @@ func (egs *EgressServer) reload() {
 		createPipeline(svc)
 	}
 
+	var egressGateway *spec.EgressGateway
+	var egressGatewayPipeline *supervisor.ObjectEntity
+	self := egs.service.GetServiceSpec(egs.serviceName)
+	if self != nil && self.EgressGateway != "" {
+		egressGateway, egressGatewayPipeline = egs.createEgressGatewayPipeline(self, pipelines)
+	}
+
 	httpServerSpec := egs.httpServer.Spec().ObjectSpec().(*httpserver.Spec)
 	httpServerSpec.Rules = nil
+	if self != nil {
+		httpServerSpec.Tracing = self.SidecarTracingSpec()
+		httpServerSpec.AccessLog = self.SidecarAccessLogSpec()
+	}
 
 	for serviceName := range lgSvcs {
+		// rules of the named ports must precede the default one.
+		for _, pair := range svcPortPipelineNames[serviceName] {
+			httpServerSpec.Rules = append(httpServerSpec.Rules, &routers.Rule{
+				Paths: []*routers.Path{
+					{
+						PathPrefix:     "/",
+						Headers:        egs.buildPortHeaders(serviceName, pair[0]),
+						MatchAllHeader: true,
+						Backend:        pair[1],
+					},
+				},
+			})
+		}
+
 		rule := &routers.Rule{
 			Paths: []*routers.Path{
 				{
@@ -518,11 +734,32 @@ func (egs *EgressServer) reload() {
 				}
 			}
 
-			rules := egs.buildMuxRule(pipelineName, tt.Destination.Name, matches)
+			for _, pair := range svcPortPipelineNames[tt.Destination.Name] {
+				rules := egs.buildMuxRule(pair[1], tt.Destination.Name, pair[0], matches)
+				httpServerSpec.Rules = append(httpServerSpec.Rules, rules...)
+			}
+
+			rules := egs.buildMuxRule(pipelineName, tt.Destination.Name, "", matches)
 			httpServerSpec.Rules = append(httpServerSpec.Rules, rules...)
 		}
 	}
 
+	// rules of external services must be the last ones, so that traffic
+	// to mesh services never goes to the egress gateway.
+	if egressGatewayPipeline != nil {
+		for _, es := range egressGateway.ExternalServices {
+			httpServerSpec.Rules = append(httpServerSpec.Rules, &routers.Rule{
+				Host: es.Host,
+				Paths: []*routers.Path{
+					{
+						PathPrefix: "/",
+						Backend:    egressGatewayPipeline.Spec().Name(),
+					},
+				},
+			})
+		}
+	}
+
 	builder := newHTTPServerSpecBuilder(egs.egressServerName, httpServerSpec)
 	superSpec, err := supervisor.NewSpec(builder.jsonConfig())
 	if err != nil {
@@ -536,8 +773,215 @@ func (egs *EgressServer) reload() {
 	}
 
 	// update local storage
+	previousPipelines := egs.pipelines
 	egs.pipelines = pipelines
+	egs.callees = callees
 	egs.httpServer = entity
+
+	if egs.grpcServer != nil {
+		egs.reloadGRPCServer(lgSvcs, tts, groups, svcGRPCPipelineNames)
+	}
+
+	egs.deleteStalePipelines(previousPipelines)
+}
+
+// deleteStalePipelines deletes the previous pipelines which are not used
+// anymore. It must be called after the servers are updated, so that no
+// new requests are routed to them, and the in-flight requests are drained
+// by the pipelines before closing.
+func (egs *EgressServer) deleteStalePipelines(previousPipelines map[string]*supervisor.ObjectEntity) {
+	current := make(map[string]struct{}, len(egs.pipelines))
+	for _, entity := range egs.pipelines {
+		current[entity.Spec().Name()] = struct{}{}
+	}
+
+	for _, entity := range previousPipelines {
+		name := entity.Spec().Name()
+		if _, exists := current[name]; exists {
+			continue
+		}
+		if err := egs.tc.DeletePipeline(egs.namespace, name); err != nil {
+			logger.Errorf("delete stale pipeline %s failed: %v", name, err)
+		}
+	}
+}
+
+func (egs *EgressServer) reloadGRPCServer(lgSvcs map[string]*spec.Service, tts []*spec.TrafficTarget,
+	groups map[string]*spec.HTTPRouteGroup, svcGRPCPipelineNames map[string][][2]string,
+) {
+	grpcServerSpec := egs.grpcServer.Spec().ObjectSpec().(*grpcserver.Spec)
+	grpcServerSpec.Rules = nil
+
+	buildHeaders := func(serviceName, portName string) []*grpcserver.Header {
+		headers := []*grpcserver.Header{
+			{
+				Key:    egressRPCKey,
+				Values: []string{serviceName},
+			},
+		}
+		if portName != "" {
+			headers = append(headers, &grpcserver.Header{
+				Key:    spec.ServicePortHeaderKey,
+				Values: []string{portName},
+			})
+		}
+		return headers
+	}
+
+	for serviceName := range lgSvcs {
+		pairs := svcGRPCPipelineNames[serviceName]
+		if len(pairs) == 0 {
+			continue
+		}
+
+		for _, pair := range pairs {
+			grpcServerSpec.Rules = append(grpcServerSpec.Rules, &grpcserver.Rule{
+				Methods: []*grpcserver.Method{
+					{
+						MethodPrefix:   "/",
+						Headers:        buildHeaders(serviceName, pair[0]),
+						MatchAllHeader: true,
+						Backend:        pair[1],
+					},
+				},
+			})
+		}
+
+		// the first gRPC port is chosen if the port is not specified.
+		grpcServerSpec.Rules = append(grpcServerSpec.Rules, &grpcserver.Rule{
+			Methods: []*grpcserver.Method{
+				{
+					MethodPrefix: "/",
+					Headers:      buildHeaders(serviceName, ""),
+					Backend:      pairs[0][1],
+				},
+			},
+		}, &grpcserver.Rule{
+			Host:       serviceName,
+			HostRegexp: egs.buildHostRegex(serviceName),
+			Methods: []*grpcserver.Method{
+				{
+					MethodPrefix: "/",
+					Backend:      pairs[0][1],
+				},
+			},
+		})
+	}
+
+	for _, tt := range tts {
+		pairs := svcGRPCPipelineNames[tt.Destination.Name]
+		if len(pairs) == 0 {
+			continue
+		}
+
+		for _, r := range tt.Rules {
+			var matches []spec.HTTPMatch
+			if len(r.Matches) == 0 {
+				matches = groups[r.Name].Matches
+			} else {
+				allMatches := groups[r.Name].Matches
+				for _, name := range r.Matches {
+					for i := range allMatches {
+						if allMatches[i].Name == name {
+							matches = append(matches, allMatches[i])
+						}
+					}
+				}
+			}
+
+			// the full method name of gRPC is matched as the path.
+			for _, m := range matches {
+				for _, pair := range pairs {
+					grpcServerSpec.Rules = append(grpcServerSpec.Rules, &grpcserver.Rule{
+						Methods: []*grpcserver.Method{
+							{
+								MethodRegexp:   "^" + m.PathRegex,
+								Headers:        buildHeaders(tt.Destination.Name, pair[0]),
+								MatchAllHeader: true,
+								Backend:        pair[1],
+							},
+						},
+					})
+				}
+
+				grpcServerSpec.Rules = append(grpcServerSpec.Rules, &grpcserver.Rule{
+					Methods: []*grpcserver.Method{
+						{
+							MethodRegexp: "^" + m.PathRegex,
+							Headers:      buildHeaders(tt.Destination.Name, ""),
+							Backend:      pairs[0][1],
+						},
+					},
+				})
+			}
+		}
+	}
+
+	builder := newGRPCServerSpecBuilder(egs.grpcServer.Spec().Name(), grpcServerSpec)
+	superSpec, err := supervisor.NewSpec(builder.jsonConfig())
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", builder.Name, err)
+		return
+	}
+	entity, err := egs.tc.UpdateTrafficGateForSpec(egs.namespace, superSpec)
+	if err != nil {
+		logger.Errorf("update grpc server %s failed: %v", builder.Name, err)
+		return
+	}
+
+	egs.grpcServer = entity
+}
+
+// Dependencies returns the traffic to the callee services, which is
+// collected from the statistics of the HTTP pipelines.
+func (egs *EgressServer) Dependencies() []*spec.ServiceDependency {
+	egs.mutex.RLock()
+	defer egs.mutex.RUnlock()
+
+	deps := make(map[string]*spec.ServiceDependency)
+	for key, callee := range egs.callees {
+		entity := egs.pipelines[key]
+		if entity == nil {
+			continue
+		}
+
+		status, ok := entity.Instance().Status().ObjectStatus.(*pipeline.Status)
+		if !ok {
+			continue
+		}
+
+		dep := deps[callee]
+		if dep == nil {
+			dep = &spec.ServiceDependency{Callee: callee}
+			deps[callee] = dep
+		}
+
+		for _, filterStatus := range status.Filters {
+			proxyStatus, ok := filterStatus.(*proxy.Status)
+			if !ok {
+				continue
+			}
+
+			pools := append([]*proxy.ServerPoolStatus{proxyStatus.MainPool}, proxyStatus.CandidatePools...)
+			for _, pool := range pools {
+				if pool == nil || pool.Stat == nil {
+					continue
+				}
+				dep.RPS += pool.Stat.M1
+				dep.ErrorRPS += pool.Stat.M1Err
+			}
+		}
+	}
+
+	result := make([]*spec.ServiceDependency, 0, len(deps))
+	for _, dep := range deps {
+		result = append(result, dep)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Callee < result[j].Callee
+	})
+
+	return result
 }
 
 func (egs *EgressServer) watch() {
@@ -556,8 +1000,30 @@ func (egs *EgressServer) Close() {
 
 	if egs._ready() {
 		egs.tc.DeleteTrafficGate(egs.namespace, egs.httpServer.Spec().Name())
+		if egs.grpcServer != nil {
+			egs.tc.DeleteTrafficGate(egs.namespace, egs.grpcServer.Spec().Name())
+		}
 		for _, entity := range egs.pipelines {
 			egs.tc.DeletePipeline(egs.namespace, entity.Spec().Name())
 		}
 	}
 }
+
+// Objects returns the specs of the objects run by the egress server.
+func (egs *EgressServer) Objects() []*supervisor.Spec {
+	egs.mutex.RLock()
+	defer egs.mutex.RUnlock()
+
+	var specs []*supervisor.Spec
+	if egs.httpServer != nil {
+		specs = append(specs, egs.httpServer.Spec())
+	}
+	if egs.grpcServer != nil {
+		specs = append(specs, egs.grpcServer.Spec())
+	}
+	for _, entity := range egs.pipelines {
+		specs = append(specs, entity.Spec())
+	}
+
+	return specs
+}
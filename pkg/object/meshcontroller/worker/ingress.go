@@ -22,6 +22,7 @@ import (
 	"sync"
 
 	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/httpserver"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/informer"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/service"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
@@ -48,15 +49,19 @@ type (
 		namespace       string
 		inf             informer.Informer
 		instanceID      string
+		wasm            *wasmModules
 
 		pipelines  map[string]*supervisor.ObjectEntity
 		httpServer *supervisor.ObjectEntity
+		// portServers are the HTTP servers of the named ports.
+		portServers map[string]*supervisor.ObjectEntity
 	}
 )
 
 // NewIngressServer creates an initialized ingress server
 func NewIngressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
-	serviceName, instaceID string, service *service.Service,
+	serviceName, instaceID string, service *service.Service, store storage.Storage,
+	wasm *wasmModules,
 ) *IngressServer {
 	entity, exists := super.GetSystemController(trafficcontroller.Kind)
 	if !exists {
@@ -68,7 +73,7 @@ func NewIngressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
 		panic(fmt.Errorf("BUG: want *TrafficController, got %T", entity.Instance()))
 	}
 
-	inf := informer.NewInformer(storage.New(superSpec.Name(), super.Cluster()), serviceName)
+	inf := informer.NewInformer(store, serviceName)
 
 	return &IngressServer{
 		super:     super,
@@ -79,9 +84,11 @@ func NewIngressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
 
 		pipelines:   make(map[string]*supervisor.ObjectEntity),
 		httpServer:  nil,
+		portServers: make(map[string]*supervisor.ObjectEntity),
 		serviceName: serviceName,
 		instanceID:  instaceID,
 		inf:         inf,
+		wasm:        wasm,
 		mutex:       sync.RWMutex{},
 		service:     service,
 	}
@@ -111,6 +118,7 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 	defer ings.mutex.Unlock()
 
 	ings.applicationPort = port
+	service.ResolveWasmModules(ings.wasm.codePaths())
 
 	if _, ok := ings.pipelines[service.SidecarIngressPipelineName()]; !ok {
 		superSpec, err := service.SidecarIngressPipelineSpec(port)
@@ -133,7 +141,7 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 			logger.Infof("ingress enable TLS, init httpserver with cert: %#v", cert)
 		}
 
-		superSpec, err := service.SidecarIngressHTTPServerSpec(admSpec.WorkerSpec.Ingress.KeepAlive,
+		superSpec, err := service.SidecarIngressHTTPServerSpec(port, admSpec.WorkerSpec.Ingress.KeepAlive,
 			admSpec.WorkerSpec.Ingress.KeepAliveTimeout, cert, rootCert)
 		if err != nil {
 			return err
@@ -146,6 +154,10 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 		ings.httpServer = entity
 	}
 
+	if err := ings.initPorts(service); err != nil {
+		return err
+	}
+
 	if err := ings.inf.OnPartOfServiceSpec(service.Name, ings.reloadPipeline); err != nil {
 		// Only return err when its type is not `AlreadyWatched`
 		if err != informer.ErrAlreadyWatched {
@@ -154,6 +166,13 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 		}
 	}
 
+	if err := ings.inf.OnAllWasmModules(ings.reloadByWasmModules); err != nil {
+		if err != informer.ErrAlreadyWatched {
+			logger.Errorf("add ingress wasm modules watching failed: %v", err)
+			return err
+		}
+	}
+
 	if admSpec.EnablemTLS() {
 		logger.Infof("ingress in mtls mode, start listen ID: %s's cert", ings.instanceID)
 		if err := ings.inf.OnServerCert(ings.serviceName, ings.instanceID, ings.reloadHTTPServer); err != nil {
@@ -167,6 +186,84 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 	return nil
 }
 
+// initPorts creates the pipelines and servers of the named ports.
+func (ings *IngressServer) initPorts(service *spec.Service) error {
+	admSpec := ings.superSpec.ObjectSpec().(*spec.Admin)
+
+	for _, port := range service.Sidecar.Ports {
+		switch port.Protocol {
+		case spec.PortProtocolHTTP, spec.PortProtocolAuto:
+		case spec.PortProtocolGRPC:
+			if admSpec.EnablemTLS() {
+				logger.Warnf("ingress of port %s: gRPC is not supported in mTLS mode", port.Name)
+				continue
+			}
+		default:
+			logger.Warnf("ingress of port %s: protocol %s is not supported yet", port.Name, port.Protocol)
+			continue
+		}
+
+		pipelineName := service.SidecarIngressPortPipelineName(port.Name)
+		if _, ok := ings.pipelines[pipelineName]; !ok {
+			superSpec, err := ingressPortPipelineSpec(service, port)
+			if err != nil {
+				return err
+			}
+			entity, err := ings.tc.CreatePipelineForSpec(ings.namespace, superSpec)
+			if err != nil {
+				return fmt.Errorf("create http pipeline %s failed: %v", superSpec.Name(), err)
+			}
+			ings.pipelines[pipelineName] = entity
+		}
+
+		if _, ok := ings.portServers[port.Name]; ok {
+			continue
+		}
+
+		if port.Protocol == spec.PortProtocolGRPC {
+			superSpec, err := service.SidecarIngressPortGRPCServerSpec(port)
+			if err != nil {
+				return err
+			}
+
+			entity, err := ings.tc.CreateTrafficGateForSpec(ings.namespace, superSpec)
+			if err != nil {
+				return fmt.Errorf("create grpc server %s failed: %v", superSpec.Name(), err)
+			}
+			ings.portServers[port.Name] = entity
+			continue
+		}
+
+		var cert, rootCert *spec.Certificate
+		if admSpec.EnablemTLS() {
+			cert = ings.service.GetServiceInstanceCert(ings.serviceName, ings.instanceID)
+			rootCert = ings.service.GetRootCert()
+		}
+
+		superSpec, err := service.SidecarIngressPortHTTPServerSpec(port, admSpec.WorkerSpec.Ingress.KeepAlive,
+			admSpec.WorkerSpec.Ingress.KeepAliveTimeout, cert, rootCert)
+		if err != nil {
+			return err
+		}
+
+		entity, err := ings.tc.CreateTrafficGateForSpec(ings.namespace, superSpec)
+		if err != nil {
+			return fmt.Errorf("create http server %s failed: %v", superSpec.Name(), err)
+		}
+		ings.portServers[port.Name] = entity
+	}
+
+	return nil
+}
+
+// ingressPortPipelineSpec returns the ingress pipeline spec of the named port.
+func ingressPortPipelineSpec(service *spec.Service, port *spec.SidecarPort) (*supervisor.Spec, error) {
+	if port.Protocol == spec.PortProtocolGRPC {
+		return service.SidecarIngressPortGRPCPipelineSpec(port)
+	}
+	return service.SidecarIngressPortPipelineSpec(port)
+}
+
 func (ings *IngressServer) reloadHTTPServer(event informer.Event, value *spec.Certificate) bool {
 	ings.mutex.Lock()
 	defer ings.mutex.Unlock()
@@ -183,7 +280,8 @@ func (ings *IngressServer) reloadHTTPServer(event informer.Event, value *spec.Ce
 	}
 	admSpec := ings.superSpec.ObjectSpec().(*spec.Admin)
 	rootCert := ings.service.GetRootCert()
-	superSpec, err := serviceSpec.SidecarIngressHTTPServerSpec(admSpec.WorkerSpec.Ingress.KeepAlive, admSpec.WorkerSpec.Ingress.KeepAliveTimeout, value, rootCert)
+	superSpec, err := serviceSpec.SidecarIngressHTTPServerSpec(ings.applicationPort, admSpec.WorkerSpec.Ingress.KeepAlive,
+		admSpec.WorkerSpec.Ingress.KeepAliveTimeout, value, rootCert)
 	if err != nil {
 		logger.Errorf("BUG: update ingress pipeline spec: %s new super spec failed: %v",
 			superSpec.JSONConfig(), err)
@@ -199,6 +297,27 @@ func (ings *IngressServer) reloadHTTPServer(event informer.Event, value *spec.Ce
 	// update local storage
 	ings.httpServer = entity
 
+	for _, port := range serviceSpec.Sidecar.Ports {
+		// gRPC servers don't use certificates.
+		if _, ok := ings.portServers[port.Name]; !ok || port.Protocol == spec.PortProtocolGRPC {
+			continue
+		}
+
+		superSpec, err := serviceSpec.SidecarIngressPortHTTPServerSpec(port, admSpec.WorkerSpec.Ingress.KeepAlive,
+			admSpec.WorkerSpec.Ingress.KeepAliveTimeout, value, rootCert)
+		if err != nil {
+			logger.Errorf("BUG: new super spec of ingress port %s failed: %v", port.Name, err)
+			continue
+		}
+
+		entity, err := ings.tc.UpdateTrafficGateForSpec(ings.namespace, superSpec)
+		if err != nil {
+			logger.Errorf("update http server %s failed: %v", superSpec.Name(), err)
+			continue
+		}
+		ings.portServers[port.Name] = entity
+	}
+
 	return true
 }
 
@@ -211,6 +330,7 @@ func (ings *IngressServer) reloadPipeline(event informer.Event, serviceSpec *spe
 		return false
 	}
 
+	serviceSpec.ResolveWasmModules(ings.wasm.codePaths())
 	superSpec, err := serviceSpec.SidecarIngressPipelineSpec(ings.applicationPort)
 	if err != nil {
 		logger.Errorf("BUG: update ingress pipeline spec: %s new super spec failed: %v",
@@ -218,15 +338,83 @@ func (ings *IngressServer) reloadPipeline(event informer.Event, serviceSpec *spe
 		return true
 	}
 
-	entity, err := ings.tc.UpdatePipelineForSpec(ings.namespace, superSpec)
+	entity, err := ings.tc.ApplyPipelineForSpec(ings.namespace, superSpec)
 	if err != nil {
 		return true
 	}
 
 	ings.pipelines[ings.serviceName] = entity
+
+	for _, port := range serviceSpec.Sidecar.Ports {
+		pipelineName := serviceSpec.SidecarIngressPortPipelineName(port.Name)
+		if _, ok := ings.pipelines[pipelineName]; !ok {
+			continue
+		}
+
+		superSpec, err := ingressPortPipelineSpec(serviceSpec, port)
+		if err != nil {
+			logger.Errorf("BUG: new super spec of ingress port %s failed: %v", port.Name, err)
+			continue
+		}
+
+		entity, err := ings.tc.ApplyPipelineForSpec(ings.namespace, superSpec)
+		if err != nil {
+			continue
+		}
+		ings.pipelines[pipelineName] = entity
+	}
+
 	return true
 }
 
+// reloadByWasmModules reloads the pipelines with the updated modules, the
+// pipelines whose modules are unchanged are left intact.
+func (ings *IngressServer) reloadByWasmModules(value map[string]*spec.WasmModule) bool {
+	ings.wasm.update(value)
+
+	serviceSpec := ings.service.GetServiceSpec(ings.serviceName)
+	if serviceSpec == nil {
+		logger.Infof("ingress can't find its service: %s", ings.serviceName)
+		return true
+	}
+
+	return ings.reloadPipeline(informer.Event{EventType: informer.EventUpdate}, serviceSpec)
+}
+
+// Metrics returns the metrics of the inbound traffic, which is collected
+// from the statistics of the HTTP servers.
+func (ings *IngressServer) Metrics() *spec.ServiceMetrics {
+	ings.mutex.RLock()
+	defer ings.mutex.RUnlock()
+
+	if !ings._ready() {
+		return nil
+	}
+
+	entities := []*supervisor.ObjectEntity{ings.httpServer}
+	for _, entity := range ings.portServers {
+		entities = append(entities, entity)
+	}
+
+	var metrics []*spec.ServiceMetrics
+	for _, entity := range entities {
+		status, ok := entity.Instance().Status().ObjectStatus.(*httpserver.Status)
+		if !ok || status.Status == nil {
+			continue
+		}
+
+		metrics = append(metrics, &spec.ServiceMetrics{
+			RPS:      status.M1,
+			ErrorRPS: status.M1Err,
+			P50:      status.P50,
+			P95:      status.P95,
+			P99:      status.P99,
+		})
+	}
+
+	return spec.MergeServiceMetrics(metrics)
+}
+
 // Close closes the Ingress HTTPServer and Pipeline
 func (ings *IngressServer) Close() {
 	ings.mutex.Lock()
@@ -236,8 +424,30 @@ func (ings *IngressServer) Close() {
 
 	if ings._ready() {
 		ings.tc.DeleteTrafficGate(ings.namespace, ings.httpServer.Spec().Name())
+		for _, entity := range ings.portServers {
+			ings.tc.DeleteTrafficGate(ings.namespace, entity.Spec().Name())
+		}
 		for _, entity := range ings.pipelines {
 			ings.tc.DeletePipeline(ings.namespace, entity.Spec().Name())
 		}
 	}
 }
+
+// Objects returns the specs of the objects run by the ingress server.
+func (ings *IngressServer) Objects() []*supervisor.Spec {
+	ings.mutex.RLock()
+	defer ings.mutex.RUnlock()
+
+	var specs []*supervisor.Spec
+	if ings.httpServer != nil {
+		specs = append(specs, ings.httpServer.Spec())
+	}
+	for _, entity := range ings.portServers {
+		specs = append(specs, entity.Spec())
+	}
+	for _, entity := range ings.pipelines {
+		specs = append(specs, entity.Spec())
+	}
+
+	return specs
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultRemoteWriteInterval = 15 * time.Second
+	defaultRemoteWriteTimeout  = 10 * time.Second
+)
+
+type (
+	// metricsExporter exports the service metrics of the worker to
+	// Prometheus by remote write or pull.
+	metricsExporter struct {
+		worker *Worker
+		gauges map[string]*prometheus.GaugeVec
+	}
+
+	metricSample struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}
+)
+
+var metricLabelNames = map[string][]string{
+	"mesh_service_requests_rate":            {"service", "instance"},
+	"mesh_service_errors_rate":              {"service", "instance"},
+	"mesh_service_latency_milliseconds":     {"service", "instance", "quantile"},
+	"mesh_service_dependency_requests_rate": {"service", "instance", "callee"},
+	"mesh_service_dependency_errors_rate":   {"service", "instance", "callee"},
+}
+
+func newMetricsExporter(worker *Worker) *metricsExporter {
+	return &metricsExporter{
+		worker: worker,
+		gauges: make(map[string]*prometheus.GaugeVec),
+	}
+}
+
+func (me *metricsExporter) run() {
+	for {
+		interval := me.export()
+
+		select {
+		case <-me.worker.done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// export exports the metrics once and returns the interval to next export.
+func (me *metricsExporter) export() (interval time.Duration) {
+	interval = defaultRemoteWriteInterval
+
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("%s: recover from: %v, stack trace:\n%s\n",
+				me.worker.superSpec.Name(), err, debug.Stack())
+		}
+	}()
+
+	serviceSpec := me.worker.service.GetServiceSpec(me.worker.serviceName)
+	var exporterSpec *spec.ObservabilityMetricsExporter
+	if serviceSpec != nil && serviceSpec.Observability != nil {
+		exporterSpec = serviceSpec.Observability.MetricsExporter
+	}
+
+	if exporterSpec == nil || !exporterSpec.Pull {
+		for _, gauge := range me.gauges {
+			gauge.Reset()
+		}
+	}
+	if exporterSpec == nil || (!exporterSpec.Pull && exporterSpec.RemoteWrite == nil) {
+		return
+	}
+
+	samples := me.collect()
+
+	if exporterSpec.Pull {
+		me.setGauges(samples)
+	}
+
+	if rw := exporterSpec.RemoteWrite; rw != nil {
+		if d, err := time.ParseDuration(rw.Interval); err == nil && d > 0 {
+			interval = d
+		}
+		if err := me.remoteWrite(rw, samples); err != nil {
+			logger.Errorf("service %s remote write metrics failed: %v", me.worker.serviceName, err)
+		}
+	}
+
+	return
+}
+
+func (me *metricsExporter) collect() []*metricSample {
+	service, instance := me.worker.serviceName, me.worker.instanceID
+
+	var samples []*metricSample
+	add := func(name string, value float64, extraLabels ...string) {
+		labels := map[string]string{"service": service, "instance": instance}
+		for i := 0; i+1 < len(extraLabels); i += 2 {
+			labels[extraLabels[i]] = extraLabels[i+1]
+		}
+		samples = append(samples, &metricSample{name: name, labels: labels, value: value})
+	}
+
+	if m := me.worker.ingressServer.Metrics(); m != nil {
+		add("mesh_service_requests_rate", m.RPS)
+		add("mesh_service_errors_rate", m.ErrorRPS)
+		add("mesh_service_latency_milliseconds", m.P50, "quantile", "0.5")
+		add("mesh_service_latency_milliseconds", m.P95, "quantile", "0.95")
+		add("mesh_service_latency_milliseconds", m.P99, "quantile", "0.99")
+	}
+
+	for _, dep := range me.worker.egressServer.Dependencies() {
+		add("mesh_service_dependency_requests_rate", dep.RPS, "callee", dep.Callee)
+		add("mesh_service_dependency_errors_rate", dep.ErrorRPS, "callee", dep.Callee)
+	}
+
+	return samples
+}
+
+func (me *metricsExporter) setGauges(samples []*metricSample) {
+	for _, s := range samples {
+		gauge := me.gauges[s.name]
+		if gauge == nil {
+			gauge = prometheushelper.NewGauge(s.name, "the service metrics collected by mesh sidecar", metricLabelNames[s.name])
+			if gauge == nil {
+				continue
+			}
+			me.gauges[s.name] = gauge
+		}
+		gauge.With(s.labels).Set(s.value)
+	}
+}
+
+func (me *metricsExporter) remoteWrite(rw *spec.PrometheusRemoteWrite, samples []*metricSample) error {
+	timeout := defaultRemoteWriteTimeout
+	if d, err := time.ParseDuration(rw.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+
+	now := time.Now()
+	rwSamples := make([]*prometheushelper.RemoteWriteSample, 0, len(samples))
+	for _, s := range samples {
+		labels := map[string]string{"__name__": s.name}
+		for k, v := range s.labels {
+			labels[k] = v
+		}
+		rwSamples = append(rwSamples, &prometheushelper.RemoteWriteSample{
+			Labels:    labels,
+			Value:     s.value,
+			Timestamp: now,
+		})
+	}
+
+	client := &http.Client{Timeout: timeout}
+	return prometheushelper.RemoteWrite(client, rw.URL, rw.Headers, rwSamples)
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/spec"
+)
+
+// wasmModules materializes the WebAssembly modules of the mesh into local
+// files for the WasmHost filters of the sidecar pipelines. The file name
+// contains the hash of the code, so an updated module changes the spec of
+// the pipelines referencing it, which reloads them.
+type wasmModules struct {
+	dir string
+
+	mutex sync.RWMutex
+	// paths maps module name to the path of its code.
+	paths map[string]string
+}
+
+func newWasmModules(dir string) *wasmModules {
+	return &wasmModules{
+		dir:   dir,
+		paths: make(map[string]string),
+	}
+}
+
+// codePaths returns the local code paths of the modules indexed by module name.
+func (wm *wasmModules) codePaths() map[string]string {
+	wm.mutex.RLock()
+	defer wm.mutex.RUnlock()
+
+	paths := make(map[string]string, len(wm.paths))
+	for name, path := range wm.paths {
+		paths[name] = path
+	}
+	return paths
+}
+
+// update writes the code of the modules to local files and removes the
+// files of the deleted modules.
+func (wm *wasmModules) update(modules map[string]*spec.WasmModule) {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	if err := os.MkdirAll(wm.dir, 0o755); err != nil {
+		logger.Errorf("create wasm module directory %s failed: %v", wm.dir, err)
+		return
+	}
+
+	paths := make(map[string]string)
+	for _, module := range modules {
+		path, err := wm.writeModule(module)
+		if err != nil {
+			logger.Errorf("write wasm module %s failed: %v", module.Name, err)
+			continue
+		}
+		paths[module.Name] = path
+	}
+
+	inuse := make(map[string]struct{})
+	for _, path := range paths {
+		inuse[path] = struct{}{}
+	}
+	for _, path := range wm.paths {
+		if _, ok := inuse[path]; !ok {
+			os.Remove(path)
+		}
+	}
+
+	wm.paths = paths
+}
+
+func (wm *wasmModules) writeModule(module *spec.WasmModule) (string, error) {
+	code, err := base64.StdEncoding.DecodeString(module.Code)
+	if err != nil {
+		return "", fmt.Errorf("decode code failed: %v", err)
+	}
+
+	sum := sha256.Sum256(code)
+	path := filepath.Join(wm.dir, fmt.Sprintf("%s-%s.wasm", module.Name, hex.EncodeToString(sum[:8])))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, code, 0o644); err != nil {
+		return "", err
+	}
+
+	return path, os.Rename(tmp, path)
+}
@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"runtime/debug"
 	"sort"
 	"strconv"
@@ -31,6 +32,7 @@ import (
 	"time"
 
 	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/configpush"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/informer"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/label"
 	"github.com/megaease/easegress/v2/pkg/object/meshcontroller/layout"
@@ -60,9 +62,10 @@ type (
 		applicationIP   string
 		serviceLabels   map[string]string
 
-		store    storage.Storage
-		service  *service.Service
-		informer informer.Informer
+		store      storage.Storage
+		service    *service.Service
+		informer   informer.Informer
+		pushClient *configpush.Client
 
 		registryType         string
 		registryServer       *registrycenter.Server
@@ -71,37 +74,21 @@ type (
 		observabilityManager *ObservabilityManager
 		apiServer            *apiServer
 
+		// lastSidecarObjects is the last reported objects of the
+		// effective sidecar config.
+		lastSidecarObjects string
+
 		done chan struct{}
 	}
 )
 
-func decodeLabels(labelStr string) map[string]string {
-	labelMap := make(map[string]string)
-	if len(labelStr) == 0 {
-		return labelMap
-	}
-
-	labelSlice := strings.Split(labelStr, ",")
-
-	for _, v := range labelSlice {
-		kv := strings.Split(v, "=")
-		if len(kv) == 2 {
-			labelMap[kv[0]] = kv[1]
-		} else {
-			logger.Errorf("%s: invalid label: %s", labelStr, v)
-		}
-	}
-
-	return labelMap
-}
-
 // New creates a mesh worker.
 func New(superSpec *supervisor.Spec) *Worker {
 	super := superSpec.Super()
 	_spec := superSpec.ObjectSpec().(*spec.Admin)
 	serviceName := super.Options().Labels[label.KeyServiceName]
 	aliveProbe := super.Options().Labels[label.KeyAliveProbe]
-	serviceLabels := decodeLabels(super.Options().Labels[label.KeyServiceLabels])
+	serviceLabels := label.DecodeLabels(super.Options().Labels[label.KeyServiceLabels])
 	applicationPort, err := strconv.Atoi(super.Options().Labels[label.KeyApplicationPort])
 	if err != nil {
 		logger.Errorf("parse %s failed: %v", super.Options().Labels[label.KeyApplicationPort], err)
@@ -110,6 +97,11 @@ func New(superSpec *supervisor.Spec) *Worker {
 	instanceID := os.Getenv(spec.PodEnvHostname)
 	applicationIP := os.Getenv(spec.PodEnvApplicationIP)
 	store := storage.New(superSpec.Name(), super.Cluster())
+	var pushClient *configpush.Client
+	if _spec.ConfigPush != nil {
+		pushClient = configpush.NewClient(_spec.ConfigPush.Masters, serviceName, instanceID, store)
+		store = configpush.NewStorage(store, pushClient)
+	}
 	_service := service.New(superSpec)
 
 	_informer := informer.NewInformer(store, serviceName)
@@ -126,8 +118,9 @@ func New(superSpec *supervisor.Spec) *Worker {
 	registryCenterServer := registrycenter.NewRegistryCenterServer(_spec.RegistryType,
 		instanceSpec, _service, _informer, observabilityManager.agentClient)
 
-	ingressServer := NewIngressServer(superSpec, super, serviceName, instanceID, _service)
-	egressServer := NewEgressServer(superSpec, super, serviceName, instanceID, _service)
+	wasm := newWasmModules(filepath.Join(super.Options().AbsDataDir, "wasm-modules", superSpec.Name()))
+	ingressServer := NewIngressServer(superSpec, super, serviceName, instanceID, _service, store, wasm)
+	egressServer := NewEgressServer(superSpec, super, serviceName, instanceID, _service, store, wasm)
 
 	apiServer := newAPIServer(_spec.APIPort)
 
@@ -143,9 +136,10 @@ func New(superSpec *supervisor.Spec) *Worker {
 		applicationIP:   applicationIP,
 		serviceLabels:   serviceLabels,
 
-		store:    store,
-		service:  _service,
-		informer: _informer,
+		store:      store,
+		service:    _service,
+		informer:   _informer,
+		pushClient: pushClient,
 
 		registryType:         _spec.RegistryType,
 		registryServer:       registryCenterServer,
@@ -239,6 +233,7 @@ func (worker *Worker) run() {
 	}
 	go worker.heartbeat()
 	go worker.updateAgentConfig()
+	go newMetricsExporter(worker).run()
 }
 
 func (worker *Worker) heartbeat() {
@@ -266,6 +261,11 @@ func (worker *Worker) heartbeat() {
 			if err != nil {
 				logger.Errorf("update heartbeat failed: %v", err)
 			}
+
+			err = worker.updateSidecarConfig()
+			if err != nil {
+				logger.Errorf("update sidecar config failed: %v", err)
+			}
 		}
 	}
 
@@ -406,6 +406,8 @@ func (worker *Worker) updateHeartbeat() error {
 	}
 
 	status.LastHeartbeatTime = time.Now().Format(time.RFC3339)
+	status.Dependencies = worker.egressServer.Dependencies()
+	status.Metrics = worker.ingressServer.Metrics()
 	buff, err := codectool.MarshalJSON(status)
 	if err != nil {
 		logger.Errorf("BUG: marshal %#v to json failed: %v", status, err)
@@ -432,4 +434,7 @@ func (worker *Worker) Close() {
 	worker.ingressServer.Close()
 	worker.registryServer.Close()
 	worker.apiServer.Close()
+	if worker.pushClient != nil {
+		worker.pushClient.Close()
+	}
 }
@@ -477,8 +477,9 @@ func (b *Broker) handleConn(conn net.Conn) {
 	}
 
 	if oldClient != nil {
-		// delete old client
-		go oldClient.close()
+		// the old client must give up the session before the new client
+		// takes it, or its cleanup could remove the session of the new one.
+		oldClient.takeOver()
 	}
 
 	b.setSession(client, connect)
@@ -510,6 +511,9 @@ func (b *Broker) setSession(client *Client, connect *packets.ConnectPacket) {
 		client.session = prevSess
 	} else {
 		if prevSess != nil {
+			// the subscriptions of the previous session are discarded.
+			topics, _, _ := prevSess.allSubscribes()
+			b.topicMgr.unsubscribe(topics, connect.ClientIdentifier)
 			prevSess.close()
 		}
 		client.session = b.sessMgr.newSessionFromConn(connect)
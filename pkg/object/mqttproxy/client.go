@@ -95,6 +95,9 @@ type (
 		statusFlag int32
 		writeCh    chan packets.ControlPacket
 		done       chan struct{}
+		// takenOver is set when a new connection with the same client ID
+		// is established on the broker, which owns the session since then.
+		takenOver int32
 
 		// kv map is used for pipeline to share messages among filters during whole connection
 		kvMap sync.Map
@@ -295,6 +298,12 @@ func (c *Client) disconnected() bool {
 }
 
 func (c *Client) closeAndDelSession() {
+	// the session belongs to the new connection now.
+	if atomic.LoadInt32(&c.takenOver) == 1 {
+		c.close()
+		return
+	}
+
 	// session can be delete by kickOUt or closeAndDelSession
 	// only when session was delete by closeAndDelSession we should clean
 	// global store, otherwise it means that the device reconnect to
@@ -416,6 +425,23 @@ func (c *Client) kickOut() {
 	c.conn.Close()
 }
 
+// takeOver closes the connection of the client as a new connection with
+// the same client ID is established on the same broker. Like kickOut, the
+// Disconnect pipeline is not scheduled, and the session is left untouched
+// for the new connection.
+func (c *Client) takeOver() {
+	atomic.StoreInt32(&c.takenOver, 1)
+
+	c.Lock()
+	defer c.Unlock()
+	if c.disconnected() {
+		return
+	}
+	atomic.StoreInt32(&c.statusFlag, Disconnected)
+	close(c.done)
+	c.conn.Close()
+}
+
 func (c *Client) sessionCleanLocal() {
 	c.broker.sessMgr.delLocal(c.info.cid)
 	topics, _, _ := c.session.allSubscribes()
@@ -18,6 +18,7 @@
 package mqttproxy
 
 import (
+	stdcontext "context"
 	"fmt"
 	"reflect"
 	"strings"
@@ -55,12 +56,19 @@ func (m *mockCluster) PutAndDelete(map[string]*string) error
 func (m *mockCluster) PutAndDeleteUnderLease(map[string]*string) error                { return nil }
 func (m *mockCluster) DeletePrefix(prefix string) error                               { return nil }
 func (m *mockCluster) STM(apply func(concurrency.STM) error) error                    { return nil }
-func (m *mockCluster) Syncer(pullInterval time.Duration) (cluster.Syncer, error)      { return nil, nil }
-func (m *mockCluster) Mutex(name string) (cluster.Mutex, error)                       { return nil, nil }
-func (m *mockCluster) CloseServer(wg *sync.WaitGroup)                                 {}
-func (m *mockCluster) StartServer() (chan struct{}, chan struct{}, error)             { return nil, nil, nil }
-func (m *mockCluster) Close(wg *sync.WaitGroup)                                       {}
-func (m *mockCluster) PurgeMember(member string) error                                { return nil }
+func (m *mockCluster) STMWithContext(stdcontext.Context, func(concurrency.STM) error) error {
+	return nil
+}
+func (m *mockCluster) Syncer(pullInterval time.Duration) (cluster.Syncer, error) { return nil, nil }
+func (m *mockCluster) Mutex(name string) (cluster.Mutex, error)                  { return nil, nil }
+func (m *mockCluster) CloseServer(wg *sync.WaitGroup)                            {}
+func (m *mockCluster) StartServer() (chan struct{}, chan struct{}, error)        { return nil, nil, nil }
+func (m *mockCluster) Close(wg *sync.WaitGroup)                                  {}
+func (m *mockCluster) PurgeMember(member string) error                           { return nil }
+func (m *mockCluster) Health() (*cluster.Health, error)                          { return nil, nil }
+func (m *mockCluster) Election(name string, ttl time.Duration) (cluster.Election, error) {
+	return nil, nil
+}
 
 func (m *mockCluster) Watcher() (cluster.Watcher, error) {
 	m.Lock()
@@ -519,6 +519,63 @@ func TestSession(t *testing.T) {
 	client.Disconnect(200)
 }
 
+func TestSessionTakeOver(t *testing.T) {
+	assert := assert.New(t)
+
+	mapper := &mockMuxMapper{}
+	broker := getDefaultBroker(mapper)
+	defer broker.close()
+
+	cid := "takeOverClient"
+	topic := "test/takeOver"
+	connect := func(cleanSession bool, ch chan CheckMsg) paho.Client {
+		opts := paho.NewClientOptions().AddBroker("tcp://0.0.0.0:1883").SetClientID(cid).
+			SetUsername("test").SetPassword("test").SetCleanSession(cleanSession).
+			SetAutoReconnect(false).SetDefaultPublishHandler(getMQTTSubscribeHandler(ch))
+		c := paho.NewClient(opts)
+		token := c.Connect()
+		token.Wait()
+		assert.Nil(token.Error())
+		return c
+	}
+	subscribed := func() bool {
+		subscribers, _ := broker.topicMgr.findSubscribers(topic)
+		_, ok := subscribers[cid]
+		return ok
+	}
+
+	ch1 := make(chan CheckMsg, 10)
+	c1 := connect(false, ch1)
+	token := c1.Subscribe(topic, 0, nil)
+	token.Wait()
+	assert.Nil(token.Error())
+	assert.True(subscribed())
+
+	// the new connection takes over the session, and the cleanup of the
+	// old connection must not remove the subscriptions.
+	ch2 := make(chan CheckMsg, 10)
+	c2 := connect(false, ch2)
+	time.Sleep(200 * time.Millisecond)
+	assert.False(c1.IsConnected())
+	assert.True(subscribed())
+	assert.Same(broker.getClient(cid).session, broker.sessMgr.get(cid))
+
+	broker.sendMsgToClient(nil, topic, []byte("hello"), 0)
+	select {
+	case msg := <-ch2:
+		assert.Equal("hello", msg.payload)
+	case <-time.After(3 * time.Second):
+		t.Errorf("message is not received after taking over the session")
+	}
+
+	// the subscriptions are discarded by a clean session.
+	c3 := connect(true, make(chan CheckMsg, 10))
+	time.Sleep(200 * time.Millisecond)
+	assert.False(c2.IsConnected())
+	assert.False(subscribed())
+	c3.Disconnect(200)
+}
+
 func TestSpec(t *testing.T) {
 	yamlStr := `
     port: 1883
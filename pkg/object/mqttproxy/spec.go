@@ -101,7 +101,7 @@ type (
 	Certificate struct {
 		Name string `json:"name" jsonschema:"required"`
 		Cert string `json:"cert" jsonschema:"required"`
-		Key  string `json:"key" jsonschema:"required"`
+		Key  string `json:"key" jsonschema:"required,writeOnly=true"`
 	}
 )
 
@@ -88,7 +88,7 @@ type (
 		SyncInterval string        `json:"syncInterval" jsonschema:"required,format=duration"`
 		Namespace    string        `json:"namespace,omitempty"`
 		Username     string        `json:"username,omitempty"`
-		Password     string        `json:"password,omitempty"`
+		Password     string        `json:"password,omitempty" jsonschema:"writeOnly=true"`
 	}
 
 	// ServerSpec is the server config of Nacos.
@@ -21,6 +21,7 @@ package pipeline
 import (
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/v2/pkg/api"
@@ -42,6 +43,12 @@ const (
 
 	// BuiltInFilterEnd is the name of the build-in end filter.
 	BuiltInFilterEnd = "END"
+
+	// defaultDrainTimeout is the default max time to wait for the
+	// in-flight requests before closing the filters of a closed pipeline.
+	defaultDrainTimeout = 30 * time.Second
+
+	drainCheckInterval = 10 * time.Millisecond
 )
 
 func init() {
@@ -67,6 +74,10 @@ type (
 		filters    map[string]filters.Filter
 		flow       []FlowNode
 		resilience map[string]resilience.Policy
+
+		// inflight is the number of the requests being handled.
+		inflight     int64
+		drainTimeout time.Duration
 	}
 
 	// Spec describes the Pipeline.
@@ -75,6 +86,10 @@ type (
 		Filters    []map[string]interface{} `json:"filters" jsonschema:"required"`
 		Resilience []map[string]interface{} `json:"resilience,omitempty"`
 		Data       map[string]interface{}   `json:"data,omitempty"`
+		// DrainTimeout is the max time to wait for the in-flight requests
+		// before closing the filters once the pipeline is replaced or
+		// deleted, default is 30s.
+		DrainTimeout string `json:"drainTimeout,omitempty" jsonschema:"format=duration"`
 	}
 
 	// FlowNode describes one node of the pipeline flow.
@@ -297,6 +312,11 @@ func (p *Pipeline) reload(previousGeneration *Pipeline) {
 
 	p.flow = flow
 
+	p.drainTimeout = defaultDrainTimeout
+	if p.spec.DrainTimeout != "" {
+		p.drainTimeout, _ = time.ParseDuration(p.spec.DrainTimeout)
+	}
+
 	// bind filter instance to flow node.
 	for i := range flow {
 		node := &flow[i]
@@ -321,6 +341,9 @@ type HandleWithBeforeAfterOption struct {
 // HandleWithBeforeAfter handles the request, with additional flow defined by
 // the before/after pipeline.
 func (p *Pipeline) HandleWithBeforeAfter(ctx *context.Context, before, after *Pipeline, option HandleWithBeforeAfterOption) string {
+	atomic.AddInt64(&p.inflight, 1)
+	defer atomic.AddInt64(&p.inflight, -1)
+
 	if len(p.spec.Data) > 0 {
 		ctx.SetData("PIPELINE", p.spec.Data)
 	}
@@ -355,6 +378,9 @@ func (p *Pipeline) HandleWithBeforeAfter(ctx *context.Context, before, after *Pi
 
 // Handle is the handler to deal with the request.
 func (p *Pipeline) Handle(ctx *context.Context) string {
+	atomic.AddInt64(&p.inflight, 1)
+	defer atomic.AddInt64(&p.inflight, -1)
+
 	if len(p.spec.Data) > 0 {
 		ctx.SetData("PIPELINE", p.spec.Data)
 	}
@@ -424,8 +450,26 @@ func (p *Pipeline) Status() *supervisor.Status {
 	}
 }
 
-// Close closes Pipeline.
+// Close closes Pipeline. The pipeline has been replaced by a new
+// generation or deleted when it is closed, so no new requests come in,
+// but the in-flight ones are drained before closing the filters, which
+// makes reloading a pipeline hitless.
 func (p *Pipeline) Close() {
+	if atomic.LoadInt64(&p.inflight) == 0 {
+		p.closeFilters()
+		return
+	}
+
+	go func() {
+		deadline := time.Now().Add(p.drainTimeout)
+		for atomic.LoadInt64(&p.inflight) > 0 && time.Now().Before(deadline) {
+			time.Sleep(drainCheckInterval)
+		}
+		p.closeFilters()
+	}()
+}
+
+func (p *Pipeline) closeFilters() {
 	for _, filter := range p.filters {
 		filter.Close()
 	}
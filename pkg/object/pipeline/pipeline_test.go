@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters"
@@ -282,7 +284,7 @@ filters:
 	if err != nil {
 		t.Errorf("failed to create spec %s", err)
 	}
-	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil}
+	pipeline := Pipeline{filters: map[string]filters.Filter{}}
 	pipeline.Init(superSpec, nil)
 	pipeline.Inherit(superSpec, &pipeline, nil)
 
@@ -330,7 +332,7 @@ filters:
 	if err != nil {
 		t.Errorf("failed to create spec %s", err)
 	}
-	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil}
+	pipeline := Pipeline{filters: map[string]filters.Filter{}}
 	pipeline.Init(superSpec, nil)
 	pipeline.Inherit(superSpec, &pipeline, nil)
 
@@ -498,3 +500,110 @@ filters:
 	assert.NotContains(tags, "filter2")
 	assert.NotContains(tags, "filter3")
 }
+
+type blockingFilter struct {
+	MockedFilter
+	release chan struct{}
+	closed  int32
+}
+
+func (f *blockingFilter) Handle(ctx *context.Context) string {
+	<-f.release
+	return ""
+}
+
+func (f *blockingFilter) Close() {
+	atomic.StoreInt32(&f.closed, 1)
+}
+
+func TestCloseDrainsInflightRequests(t *testing.T) {
+	assert := assert.New(t)
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+filters:
+  - name: filter1
+    kind: BlockingFilter
+`
+	filter := &blockingFilter{release: make(chan struct{})}
+	kind := MockFilterKind("BlockingFilter", nil)
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		filter.kind = kind
+		filter.spec = spec.(*MockedSpec)
+		return filter
+	}
+	filters.Register(kind)
+	defer cleanup()
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+
+	done := make(chan struct{})
+	go func() {
+		pipeline.Handle(context.New(tracing.NoopSpan))
+		close(done)
+	}()
+	assert.Eventually(func() bool {
+		return atomic.LoadInt64(&pipeline.inflight) == 1
+	}, time.Second, time.Millisecond)
+
+	pipeline.Close()
+	time.Sleep(5 * drainCheckInterval)
+	assert.Equal(int32(0), atomic.LoadInt32(&filter.closed), "filter closed before the request is done")
+
+	close(filter.release)
+	<-done
+	assert.Eventually(func() bool {
+		return atomic.LoadInt32(&filter.closed) == 1
+	}, time.Second, drainCheckInterval)
+}
+
+func TestCloseDrainTimeout(t *testing.T) {
+	assert := assert.New(t)
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+drainTimeout: 50ms
+filters:
+  - name: filter1
+    kind: BlockingFilter
+`
+	filter := &blockingFilter{release: make(chan struct{})}
+	kind := MockFilterKind("BlockingFilter", nil)
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		filter.kind = kind
+		filter.spec = spec.(*MockedSpec)
+		return filter
+	}
+	filters.Register(kind)
+	defer cleanup()
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	assert.Equal(50*time.Millisecond, pipeline.drainTimeout)
+
+	done := make(chan struct{})
+	go func() {
+		pipeline.Handle(context.New(tracing.NoopSpan))
+		close(done)
+	}()
+	assert.Eventually(func() bool {
+		return atomic.LoadInt64(&pipeline.inflight) == 1
+	}, time.Second, time.Millisecond)
+
+	// the filters are closed after the timeout even if the request is
+	// not done.
+	pipeline.Close()
+	assert.Eventually(func() bool {
+		return atomic.LoadInt32(&filter.closed) == 1
+	}, time.Second, drainCheckInterval)
+
+	close(filter.release)
+	<-done
+}
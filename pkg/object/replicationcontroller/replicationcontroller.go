@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package replicationcontroller provides ReplicationController to push
+// object specs to the follower clusters.
+package replicationcontroller
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/option"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+)
+
+const (
+	// Category is the category of ReplicationController.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of ReplicationController.
+	Kind = "ReplicationController"
+
+	// ConflictPolicyOverwrite overwrites the conflicting objects in followers.
+	ConflictPolicyOverwrite = "overwrite"
+	// ConflictPolicySkip keeps the conflicting objects in followers.
+	ConflictPolicySkip = "skip"
+)
+
+var aliases = []string{"replication", "rc"}
+
+func init() {
+	supervisor.Register(&ReplicationController{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  aliases,
+	})
+}
+
+type (
+	// ReplicationController pushes the object specs selected by labels
+	// to the follower clusters asynchronously. Only the leader of the
+	// cluster pushes the specs.
+	ReplicationController struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		replicator *replicator
+
+		done chan struct{}
+		wg   sync.WaitGroup
+	}
+
+	// Spec describes the ReplicationController.
+	Spec struct {
+		// Selector selects the objects to replicate by their labels.
+		Selector map[string]string `json:"selector" jsonschema:"required"`
+		// Interval is the interval between two synchronizations.
+		Interval string `json:"interval,omitempty" jsonschema:"format=duration"`
+		// Timeout is the timeout of the requests to followers.
+		Timeout string `json:"timeout,omitempty" jsonschema:"format=duration"`
+		// ConflictPolicy decides what to do with the objects in followers
+		// which are not created by the replication or modified locally.
+		ConflictPolicy string `json:"conflictPolicy,omitempty" jsonschema:"enum=,enum=overwrite,enum=skip"`
+		// Prune deletes the replicated objects from followers once they
+		// are deleted or unselected in the source.
+		Prune     bool            `json:"prune,omitempty"`
+		Followers []*FollowerSpec `json:"followers" jsonschema:"required,minItems=1"`
+	}
+
+	// FollowerSpec describes a follower cluster.
+	FollowerSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		// Endpoints are the admin API addresses of the follower members,
+		// they are tried in order.
+		Endpoints          []string `json:"endpoints" jsonschema:"required,minItems=1,uniqueItems=true"`
+		Username           string   `json:"username,omitempty"`
+		Password           string   `json:"password,omitempty" jsonschema:"writeOnly=true"`
+		InsecureSkipVerify bool     `json:"insecureSkipVerify,omitempty"`
+	}
+
+	// Status is the status of ReplicationController.
+	Status struct {
+		Leader    bool              `json:"leader"`
+		Followers []*FollowerStatus `json:"followers"`
+	}
+
+	// FollowerStatus is the replication status of a follower.
+	FollowerStatus struct {
+		Name string `json:"name"`
+		// LastSyncTime is the last time the follower was in sync, in
+		// RFC3339 format.
+		LastSyncTime string `json:"lastSyncTime,omitempty"`
+		// Lag is the time since the follower was in sync.
+		Lag       string   `json:"lag,omitempty"`
+		Objects   int      `json:"objects"`
+		Conflicts []string `json:"conflicts,omitempty"`
+		Error     string   `json:"error,omitempty"`
+	}
+
+	metrics struct {
+		Lag       *prometheus.GaugeVec
+		Pushed    *prometheus.CounterVec
+		Conflicts *prometheus.CounterVec
+		Errors    *prometheus.CounterVec
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if len(spec.Selector) == 0 {
+		return fmt.Errorf("selector is empty, which selects all objects")
+	}
+
+	names := map[string]struct{}{}
+	for _, f := range spec.Followers {
+		if _, ok := names[f.Name]; ok {
+			return fmt.Errorf("follower %s is duplicated", f.Name)
+		}
+		names[f.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+func (spec *Spec) interval() time.Duration {
+	d, err := time.ParseDuration(spec.Interval)
+	if err != nil || d <= 0 {
+		return 10 * time.Second
+	}
+	return d
+}
+
+func (spec *Spec) timeout() time.Duration {
+	d, err := time.ParseDuration(spec.Timeout)
+	if err != nil || d <= 0 {
+		return 5 * time.Second
+	}
+	return d
+}
+
+func (spec *Spec) conflictPolicy() string {
+	if spec.ConflictPolicy == "" {
+		return ConflictPolicyOverwrite
+	}
+	return spec.ConflictPolicy
+}
+
+// Category returns the category of ReplicationController.
+func (rc *ReplicationController) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of ReplicationController.
+func (rc *ReplicationController) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of ReplicationController.
+func (rc *ReplicationController) DefaultSpec() interface{} {
+	return &Spec{
+		Interval:       "10s",
+		Timeout:        "5s",
+		ConflictPolicy: ConflictPolicyOverwrite,
+	}
+}
+
+// Init initializes ReplicationController.
+func (rc *ReplicationController) Init(superSpec *supervisor.Spec) {
+	rc.superSpec, rc.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	rc.reload()
+}
+
+// Inherit inherits previous generation of ReplicationController.
+func (rc *ReplicationController) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	rc.Init(superSpec)
+}
+
+func (rc *ReplicationController) reload() {
+	super := rc.superSpec.Super()
+	opt := super.Options()
+	source := opt.ClusterName + "/" + rc.superSpec.Name()
+
+	rc.replicator = newReplicator(super.Cluster(), rc.spec, source, newMetrics(rc.superSpec.Name(), opt))
+	rc.done = make(chan struct{})
+
+	rc.wg.Add(1)
+	go rc.run()
+}
+
+func (rc *ReplicationController) run() {
+	defer rc.wg.Done()
+
+	for {
+		select {
+		case <-time.After(rc.spec.interval()):
+			if !rc.replicator.cls.IsLeader() {
+				continue
+			}
+			rc.replicator.sync()
+		case <-rc.done:
+			return
+		}
+	}
+}
+
+// Status returns the status of ReplicationController.
+func (rc *ReplicationController) Status() *supervisor.Status {
+	return &supervisor.Status{
+		ObjectStatus: &Status{
+			Leader:    rc.replicator.cls.IsLeader(),
+			Followers: rc.replicator.status(),
+		},
+	}
+}
+
+// Close closes ReplicationController.
+func (rc *ReplicationController) Close() {
+	close(rc.done)
+	rc.wg.Wait()
+	logger.Infof("%s closed", rc.superSpec.Name())
+}
+
+func newMetrics(name string, opt *option.Options) *metrics {
+	commonLabels := prometheus.Labels{
+		"controllerName": name,
+		"kind":           Kind,
+		"clusterName":    opt.ClusterName,
+		"clusterRole":    opt.ClusterRole,
+		"instanceName":   opt.Name,
+	}
+	labels := []string{
+		"clusterName", "clusterRole", "instanceName",
+		"controllerName", "kind", "follower",
+	}
+
+	return &metrics{
+		Lag: prometheushelper.NewGauge(
+			"replication_lag_seconds",
+			"the seconds since the follower was in sync with the source cluster",
+			labels).MustCurryWith(commonLabels),
+		Pushed: prometheushelper.NewCounter(
+			"replication_pushed_objects_total",
+			"the total count of the objects created, updated or deleted in the follower",
+			labels).MustCurryWith(commonLabels),
+		Conflicts: prometheushelper.NewCounter(
+			"replication_conflicts_total",
+			"the total count of the conflicting objects found in the follower",
+			labels).MustCurryWith(commonLabels),
+		Errors: prometheushelper.NewCounter(
+			"replication_errors_total",
+			"the total count of the failed synchronizations to the follower",
+			labels).MustCurryWith(commonLabels),
+	}
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replicationcontroller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+// fakeFollower serves the object APIs of a follower cluster.
+type fakeFollower struct {
+	mutex   sync.Mutex
+	objects map[string]map[string]interface{}
+	writes  int
+}
+
+func (ff *fakeFollower) put(config string) {
+	spec := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &spec)
+	ff.objects[spec["name"].(string)] = spec
+}
+
+func (ff *fakeFollower) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ff.mutex.Lock()
+	defer ff.mutex.Unlock()
+
+	if user, pass, _ := r.BasicAuth(); user != "admin" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/apis/v2/objects")
+	name = strings.TrimPrefix(name, "/")
+
+	if r.Method == http.MethodGet {
+		specs := []map[string]interface{}{}
+		for _, spec := range ff.objects {
+			specs = append(specs, spec)
+		}
+		json.NewEncoder(w).Encode(specs)
+		return
+	}
+
+	ff.writes++
+	if r.Method == http.MethodDelete {
+		delete(ff.objects, name)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	spec := map[string]interface{}{}
+	json.Unmarshal(body, &spec)
+	spec["createdAt"] = "2023-10-01T00:00:00Z"
+	_, exists := ff.objects[spec["name"].(string)]
+	if r.Method == http.MethodPost && exists {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if r.Method == http.MethodPut && !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	ff.objects[spec["name"].(string)] = spec
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Followers: []*FollowerSpec{{Name: "us"}, {Name: "eu"}},
+	}
+	assert.Error(spec.Validate())
+
+	spec.Selector = map[string]string{"replicate": "true"}
+	assert.NoError(spec.Validate())
+
+	spec.Followers = append(spec.Followers, &FollowerSpec{Name: "us"})
+	assert.Error(spec.Validate())
+
+	assert.Equal(ConflictPolicyOverwrite, spec.conflictPolicy())
+	assert.Equal("10s", spec.interval().String())
+	assert.Equal("5s", spec.timeout().String())
+}
+
+func TestReplicator(t *testing.T) {
+	assert := assert.New(t)
+
+	layout := &cluster.Layout{}
+	source := map[string]string{
+		"server":   `{"name":"server","kind":"HTTPServer","port":80,"labels":{"replicate":"true"},"createdAt":"2023-09-01T00:00:00Z"}`,
+		"pipeline": `{"name":"pipeline","kind":"Pipeline","labels":{"replicate":"true"}}`,
+		"local":    `{"name":"local","kind":"Pipeline"}`,
+		"other":    `{"name":"other","kind":"Pipeline","labels":{"replicate":"true","replication.easegress.io/source":"dc0/rc"}}`,
+	}
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return layout
+	}
+	cls.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		result := map[string]string{}
+		for k, v := range source {
+			result[layout.ConfigObjectKey(k)] = v
+		}
+		return result, nil
+	}
+
+	ff := &fakeFollower{objects: map[string]map[string]interface{}{}}
+	ff.put(`{"name":"pipeline","kind":"Pipeline","flow":[]}`)
+	ff.put(`{"name":"removed","kind":"Pipeline","labels":{"replication.easegress.io/source":"dc1/rc"}}`)
+	ff.put(`{"name":"follower-only","kind":"Pipeline"}`)
+	server := httptest.NewServer(ff)
+	defer server.Close()
+
+	spec := &Spec{
+		Selector:       map[string]string{"replicate": "true"},
+		ConflictPolicy: ConflictPolicySkip,
+		Prune:          true,
+		Followers: []*FollowerSpec{{
+			Name:      "us",
+			Endpoints: []string{"http://127.0.0.1:1", server.URL},
+			Username:  "admin",
+			Password:  "secret",
+		}},
+	}
+	r := newReplicator(cls, spec, "dc1/rc", newMetrics("rc", option.New()))
+
+	// the conflicting pipeline is skipped, and the removed one is pruned.
+	r.sync()
+	status := r.status()[0]
+	assert.Empty(status.Error)
+	assert.NotEmpty(status.LastSyncTime)
+	assert.Equal(2, status.Objects)
+	assert.Equal([]string{"pipeline"}, status.Conflicts)
+	assert.Equal(2, ff.writes)
+	assert.Len(ff.objects, 3)
+	assert.NotContains(ff.objects, "removed")
+	assert.Contains(ff.objects["pipeline"], "flow")
+	labels := specLabels(ff.objects["server"])
+	assert.Equal("dc1/rc", labels[LabelSource])
+	assert.Equal("true", labels["replicate"])
+	assert.Equal(specHash(ff.objects["server"]), labels[LabelHash])
+
+	// nothing changes in the second time.
+	r.sync()
+	assert.Equal(2, ff.writes)
+
+	// the conflicting objects are overwritten.
+	spec.ConflictPolicy = ConflictPolicyOverwrite
+	ff.objects["server"]["port"] = 8080.0
+	r.sync()
+	assert.Equal([]string{"pipeline", "server"}, r.status()[0].Conflicts)
+	assert.Equal(4, ff.writes)
+	assert.Equal(80.0, ff.objects["server"]["port"])
+	assert.NotContains(ff.objects["pipeline"], "flow")
+
+	// the updates of the source are pushed.
+	source["server"] = strings.Replace(source["server"], `"port":80`, `"port":81`, 1)
+	r.sync()
+	assert.Empty(r.status()[0].Conflicts)
+	assert.Equal(5, ff.writes)
+	assert.Equal(81.0, ff.objects["server"]["port"])
+
+	// the unselected objects are pruned.
+	delete(source, "pipeline")
+	r.sync()
+	assert.NotContains(ff.objects, "pipeline")
+	assert.Contains(ff.objects, "follower-only")
+
+	// the follower is lost.
+	server.Close()
+	r.sync()
+	status = r.status()[0]
+	assert.NotEmpty(status.Error)
+	assert.NotEmpty(status.Lag)
+}
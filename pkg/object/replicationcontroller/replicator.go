@@ -0,0 +1,419 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replicationcontroller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// LabelSource is the label of the replicated objects in followers,
+	// its value is the cluster name and the name of the
+	// ReplicationController in the source cluster.
+	LabelSource = "replication.easegress.io/source"
+
+	// LabelHash is the label of the replicated objects in followers, its
+	// value is the hash of the spec when it is replicated, which is used
+	// to detect the local modifications in followers.
+	LabelHash = "replication.easegress.io/hash"
+)
+
+type (
+	replicator struct {
+		cls       cluster.Cluster
+		spec      *Spec
+		source    string
+		metrics   *metrics
+		followers []*follower
+		startTime time.Time
+	}
+
+	follower struct {
+		spec   *FollowerSpec
+		client *http.Client
+
+		mutex     sync.Mutex
+		lastSync  time.Time
+		objects   int
+		conflicts []string
+		err       error
+	}
+
+	// object is an object spec to replicate.
+	object struct {
+		name    string
+		kind    string
+		hash    string
+		payload []byte
+	}
+)
+
+func newReplicator(cls cluster.Cluster, spec *Spec, source string, m *metrics) *replicator {
+	r := &replicator{
+		cls:       cls,
+		spec:      spec,
+		source:    source,
+		metrics:   m,
+		startTime: time.Now(),
+	}
+
+	for _, fs := range spec.Followers {
+		r.followers = append(r.followers, &follower{
+			spec: fs,
+			client: &http.Client{
+				Timeout: spec.timeout(),
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{
+						InsecureSkipVerify: fs.InsecureSkipVerify,
+					},
+				},
+			},
+		})
+	}
+
+	return r
+}
+
+// sync pushes the selected objects to all followers concurrently.
+func (r *replicator) sync() {
+	objects, err := r.selectObjects()
+	if err != nil {
+		logger.Errorf("%s select objects failed: %v", r.source, err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, f := range r.followers {
+		wg.Add(1)
+		go func(f *follower) {
+			defer wg.Done()
+			r.syncFollower(f, objects)
+		}(f)
+	}
+	wg.Wait()
+}
+
+// selectObjects returns the objects matching the selector, the objects
+// replicated from other clusters are never selected to avoid loops.
+func (r *replicator) selectObjects() (map[string]*object, error) {
+	kvs, err := r.cls.GetPrefix(r.cls.Layout().ConfigObjectPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	objects := map[string]*object{}
+	for _, v := range kvs {
+		spec := map[string]interface{}{}
+		if err := codectool.UnmarshalJSON([]byte(v), &spec); err != nil {
+			logger.Errorf("%s unmarshal spec failed: %v", r.source, err)
+			continue
+		}
+
+		kind, _ := spec["kind"].(string)
+		labels := specLabels(spec)
+		if kind == Kind || labels[LabelSource] != "" || !r.selected(labels) {
+			continue
+		}
+
+		o := &object{kind: kind, hash: specHash(spec)}
+		o.name, _ = spec["name"].(string)
+
+		newLabels := map[string]interface{}{}
+		for k, v := range labels {
+			newLabels[k] = v
+		}
+		newLabels[LabelSource] = r.source
+		newLabels[LabelHash] = o.hash
+		spec["labels"] = newLabels
+		delete(spec, "createdAt")
+
+		o.payload, err = json.Marshal(spec)
+		if err != nil {
+			logger.Errorf("%s marshal spec of %s failed: %v", r.source, o.name, err)
+			continue
+		}
+		objects[o.name] = o
+	}
+
+	return objects, nil
+}
+
+func (r *replicator) selected(labels map[string]string) bool {
+	for k, v := range r.spec.Selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// syncFollower makes the objects in the follower consistent with the
+// source. An object is in conflict if it isn't created by the replicator,
+// or it has been modified in the follower.
+func (r *replicator) syncFollower(f *follower, objects map[string]*object) {
+	name := f.spec.Name
+	remote, err := f.list()
+	if err != nil {
+		r.metrics.Errors.WithLabelValues(name).Inc()
+		r.finishSync(f, len(objects), nil, err)
+		return
+	}
+
+	names := make([]string, 0, len(objects))
+	for n := range objects {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var errs []string
+	conflicts := []string{}
+	for _, n := range names {
+		o := objects[n]
+		existing, ok := remote[n]
+
+		var err error
+		switch {
+		case !ok:
+			err = f.create(o)
+		case r.managed(existing, o.kind):
+			if specLabels(existing)[LabelHash] == o.hash {
+				continue
+			}
+			err = f.update(o)
+		default:
+			conflicts = append(conflicts, n)
+			r.metrics.Conflicts.WithLabelValues(name).Inc()
+			if r.spec.conflictPolicy() == ConflictPolicySkip {
+				continue
+			}
+			if kind, _ := existing["kind"].(string); kind != o.kind {
+				if err = f.delete(n); err == nil {
+					err = f.create(o)
+				}
+			} else {
+				err = f.update(o)
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		r.metrics.Pushed.WithLabelValues(name).Inc()
+	}
+
+	if r.spec.Prune {
+		remoteNames := make([]string, 0, len(remote))
+		for n := range remote {
+			remoteNames = append(remoteNames, n)
+		}
+		sort.Strings(remoteNames)
+
+		for _, n := range remoteNames {
+			if _, ok := objects[n]; ok || specLabels(remote[n])[LabelSource] != r.source {
+				continue
+			}
+			if err := f.delete(n); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			r.metrics.Pushed.WithLabelValues(name).Inc()
+		}
+	}
+
+	if len(errs) != 0 {
+		err = fmt.Errorf("%s", strings.Join(errs, "; "))
+		r.metrics.Errors.WithLabelValues(name).Inc()
+	}
+	r.finishSync(f, len(objects), conflicts, err)
+}
+
+// managed returns whether the object in the follower is replicated by
+// the replicator and not modified since then.
+func (r *replicator) managed(spec map[string]interface{}, kind string) bool {
+	labels := specLabels(spec)
+	k, _ := spec["kind"].(string)
+	return k == kind && labels[LabelSource] == r.source && labels[LabelHash] == specHash(spec)
+}
+
+func (r *replicator) finishSync(f *follower, objects int, conflicts []string, err error) {
+	now := time.Now()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.objects, f.err = objects, err
+	if err != nil {
+		logger.Errorf("%s sync to follower %s failed: %v", r.source, f.spec.Name, err)
+	} else {
+		f.lastSync, f.conflicts = now, conflicts
+	}
+	r.metrics.Lag.WithLabelValues(f.spec.Name).Set(r.lag(f, now).Seconds())
+}
+
+// lag returns the time since the follower was in sync, the caller must
+// hold the lock of the follower.
+func (r *replicator) lag(f *follower, now time.Time) time.Duration {
+	if f.lastSync.IsZero() {
+		return now.Sub(r.startTime)
+	}
+	return now.Sub(f.lastSync)
+}
+
+func (r *replicator) status() []*FollowerStatus {
+	now := time.Now()
+	result := make([]*FollowerStatus, 0, len(r.followers))
+	for _, f := range r.followers {
+		f.mutex.Lock()
+		s := &FollowerStatus{
+			Name:      f.spec.Name,
+			Lag:       r.lag(f, now).Truncate(time.Second).String(),
+			Objects:   f.objects,
+			Conflicts: f.conflicts,
+		}
+		if !f.lastSync.IsZero() {
+			s.LastSyncTime = f.lastSync.Format(time.RFC3339)
+		}
+		if f.err != nil {
+			s.Error = f.err.Error()
+		}
+		f.mutex.Unlock()
+		result = append(result, s)
+	}
+	return result
+}
+
+// specLabels returns the labels of the spec.
+func specLabels(spec map[string]interface{}) map[string]string {
+	labels := map[string]string{}
+	m, _ := spec["labels"].(map[string]interface{})
+	for k, v := range m {
+		labels[k], _ = v.(string)
+	}
+	return labels
+}
+
+// specHash returns the hash of the spec, the creation time and the labels
+// of the replication are excluded.
+func specHash(spec map[string]interface{}) string {
+	m := make(map[string]interface{}, len(spec))
+	for k, v := range spec {
+		m[k] = v
+	}
+	delete(m, "createdAt")
+	delete(m, "labels")
+
+	labels := specLabels(spec)
+	delete(labels, LabelSource)
+	delete(labels, LabelHash)
+	if len(labels) != 0 {
+		m["labels"] = labels
+	}
+
+	// encoding/json sorts the keys of maps, so the result is stable.
+	buff, _ := json.Marshal(m)
+	sum := sha256.Sum256(buff)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (f *follower) list() (map[string]map[string]interface{}, error) {
+	body, err := f.do(http.MethodGet, api.ObjectPrefix, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []map[string]interface{}
+	if err := codectool.UnmarshalJSON(body, &specs); err != nil {
+		return nil, fmt.Errorf("unmarshal objects of follower %s failed: %v", f.spec.Name, err)
+	}
+
+	result := make(map[string]map[string]interface{}, len(specs))
+	for _, spec := range specs {
+		name, _ := spec["name"].(string)
+		result[name] = spec
+	}
+	return result, nil
+}
+
+func (f *follower) create(o *object) error {
+	_, err := f.do(http.MethodPost, api.ObjectPrefix, o.payload)
+	return err
+}
+
+func (f *follower) update(o *object) error {
+	_, err := f.do(http.MethodPut, api.ObjectPrefix+"/"+o.name, o.payload)
+	return err
+}
+
+func (f *follower) delete(name string) error {
+	_, err := f.do(http.MethodDelete, api.ObjectPrefix+"/"+name, nil)
+	return err
+}
+
+// do sends the request to the endpoints of the follower in order, until
+// one of them responds.
+func (f *follower) do(method, path string, body []byte) ([]byte, error) {
+	var lastErr error
+	for _, endpoint := range f.spec.Endpoints {
+		url := strings.TrimRight(endpoint, "/") + api.APIPrefixV2 + path
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if f.spec.Username != "" {
+			req.SetBasicAuth(f.spec.Username, f.spec.Password)
+		}
+
+		resp, err := f.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, fmt.Errorf("%s %s: %d %s", method, url, resp.StatusCode,
+				strings.TrimSpace(string(respBody)))
+		}
+		return respBody, nil
+	}
+
+	return nil, lastErr
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+// connTracker tracks the connections to close them on closing.
+type connTracker struct {
+	lock   sync.Mutex
+	conns  map[net.Conn]struct{}
+	active atomic.Int64
+	total  atomic.Uint64
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: map[net.Conn]struct{}{}}
+}
+
+func (ct *connTracker) add(conn net.Conn) {
+	ct.lock.Lock()
+	ct.conns[conn] = struct{}{}
+	ct.lock.Unlock()
+}
+
+func (ct *connTracker) remove(conn net.Conn) {
+	ct.lock.Lock()
+	delete(ct.conns, conn)
+	ct.lock.Unlock()
+	conn.Close()
+}
+
+func (ct *connTracker) closeAll() {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	for conn := range ct.conns {
+		conn.Close()
+	}
+}
+
+// activityReader records the time of the last read.
+type activityReader struct {
+	r        io.Reader
+	lastRead *atomic.Int64
+}
+
+func (r *activityReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.lastRead.Store(fasttime.Now().UnixNano())
+	}
+	return n, err
+}
+
+// pipe copies data between the client and the upstream until both
+// directions finish. Half-closed connections are kept until the other
+// direction finishes, and both connections are closed on errors or if
+// there's no traffic in the idle timeout.
+func pipe(client, upstream net.Conn, idleTimeout time.Duration) {
+	closeBoth := func() {
+		client.Close()
+		upstream.Close()
+	}
+
+	var lastRead atomic.Int64
+	lastRead.Store(fasttime.Now().UnixNano())
+
+	copyConn := func(dst, src net.Conn) {
+		var r io.Reader = src
+		if idleTimeout > 0 {
+			r = &activityReader{r: src, lastRead: &lastRead}
+		}
+		_, err := io.Copy(dst, r)
+		if c, ok := dst.(interface{ CloseWrite() error }); ok && err == nil {
+			c.CloseWrite()
+		} else {
+			closeBoth()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		copyConn(upstream, client)
+		close(done)
+	}()
+
+	if idleTimeout > 0 {
+		go func() {
+			ticker := time.NewTicker(idleTimeout / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+				}
+				if fasttime.Since(time.Unix(0, lastRead.Load())) >= idleTimeout {
+					closeBoth()
+					return
+				}
+			}
+		}()
+	}
+
+	copyConn(client, upstream)
+	<-done
+}
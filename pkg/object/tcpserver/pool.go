@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/filters/proxies"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/proxyprotocol"
+)
+
+const defaultDialTimeout = 10 * time.Second
+
+type (
+	// ServerPool is the backend servers of the TCPServer.
+	ServerPool struct {
+		proxies.ServerPoolBase
+
+		spec          *ServerPoolSpec
+		healthChecker proxies.HealthChecker
+		dialTimeout   time.Duration
+		proxyProtocol int
+	}
+
+	// connRequest is the request used to choose servers for connections,
+	// only the real IP is available, which is enough for the supported
+	// load balance policies.
+	connRequest struct {
+		protocols.Request
+		realIP string
+	}
+
+	tcpHealthChecker struct {
+		spec *proxies.HealthCheckSpec
+	}
+)
+
+// RealIP returns the IP of the client.
+func (r *connRequest) RealIP() string {
+	return r.realIP
+}
+
+// serverAddr returns the network and address of the server, which is
+// host:port for TCP servers and the path for unix sockets. The address is
+// empty if the URL of the server is invalid.
+func serverAddr(s *proxies.Server) (network, addr string) {
+	if path := s.UnixSocketPath(); path != "" {
+		return "unix", path
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || u.Host == "" {
+		return "tcp", ""
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return "tcp", ""
+	}
+	return "tcp", u.Host
+}
+
+func newTCPHealthChecker(spec *proxies.HealthCheckSpec) proxies.HealthChecker {
+	if spec == nil {
+		return nil
+	}
+	return &tcpHealthChecker{spec: spec}
+}
+
+// BaseSpec returns the base spec.
+func (hc *tcpHealthChecker) BaseSpec() proxies.HealthCheckSpec {
+	return *hc.spec
+}
+
+// Check checks the health of the server by connecting to it.
+func (hc *tcpHealthChecker) Check(svr *proxies.Server) bool {
+	network, addr := serverAddr(svr)
+	conn, err := net.DialTimeout(network, addr, hc.spec.GetTimeout())
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Close closes the health checker.
+func (hc *tcpHealthChecker) Close() {}
+
+func newServerPool(super *supervisor.Supervisor, spec *ServerPoolSpec, name string) *ServerPool {
+	sp := &ServerPool{
+		spec:          spec,
+		healthChecker: newTCPHealthChecker(spec.HealthCheck),
+		dialTimeout:   defaultDialTimeout,
+	}
+
+	if spec.DialTimeout != "" {
+		sp.dialTimeout, _ = time.ParseDuration(spec.DialTimeout)
+	}
+
+	switch spec.ProxyProtocol {
+	case "v1":
+		sp.proxyProtocol = 1
+	case "v2":
+		sp.proxyProtocol = 2
+	}
+
+	sp.ServerPoolBase.Init(sp, super, name, &spec.ServerPoolBaseSpec)
+	return sp
+}
+
+// CreateLoadBalancer creates a load balancer according to spec.
+func (sp *ServerPool) CreateLoadBalancer(spec *proxies.LoadBalanceSpec, servers []*proxies.Server) proxies.LoadBalancer {
+	lb := proxies.NewGeneralLoadBalancer(spec, servers)
+	lb.Init(nil, sp.healthChecker, nil)
+	return lb
+}
+
+// dial connects to a server for the connection of the client.
+func (sp *ServerPool) dial(client net.Conn) (net.Conn, error) {
+	req := &connRequest{}
+	req.realIP, _, _ = net.SplitHostPort(client.RemoteAddr().String())
+
+	svr := sp.LoadBalancer().ChooseServer(req)
+	if svr == nil {
+		return nil, fmt.Errorf("no available server")
+	}
+
+	network, addr := serverAddr(svr)
+	conn, err := net.DialTimeout(network, addr, sp.dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("dial server %s failed: %v", svr.URL, err)
+	}
+
+	if sp.proxyProtocol != 0 {
+		err = proxyprotocol.WriteHeader(conn, sp.proxyProtocol, client.RemoteAddr(), client.LocalAddr())
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("write proxy protocol header to server %s failed: %v", svr.URL, err)
+		}
+	}
+
+	logger.Debugf("%s: connection from %s is proxied to %s", sp.Name, client.RemoteAddr(), svr.URL)
+	return conn, nil
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/filters/proxies"
+	"github.com/megaease/easegress/v2/pkg/util/ipfilter"
+)
+
+type (
+	// Spec describes the TCPServer.
+	Spec struct {
+		Address string `json:"address,omitempty"`
+		// Port is required unless UnixSocket is set.
+		Port uint16 `json:"port"`
+		// UnixSocket is the path of the unix socket listening on instead
+		// of the TCP port.
+		UnixSocket     string `json:"unixSocket,omitempty"`
+		MaxConnections uint32 `json:"maxConnections,omitempty" jsonschema:"minimum=1"`
+		// IdleTimeout closes the connections without any traffic in both
+		// directions in the duration.
+		IdleTimeout string `json:"idleTimeout,omitempty" jsonschema:"format=duration"`
+		// ProxyProtocol makes the connections start with a PROXY protocol
+		// header, the client address in the header is used as the remote
+		// address, for the IP filter and the servers.
+		ProxyProtocol bool `json:"proxyProtocol,omitempty"`
+
+		IPFilter *ipfilter.Spec `json:"ipFilter,omitempty"`
+		// Pool is the servers of the connections matching none of the
+		// SNI routes, these connections are closed if it is nil.
+		Pool *ServerPoolSpec `json:"pool,omitempty"`
+
+		// SNIRoutes routes the TLS connections to the pools by the server
+		// name in the ClientHello, the TLS is not terminated. The non-TLS
+		// connections are closed if there are SNI routes.
+		SNIRoutes []*SNIRoute `json:"sniRoutes,omitempty"`
+		// SNITimeout is the timeout to wait for the ClientHello.
+		SNITimeout string `json:"sniTimeout,omitempty" jsonschema:"format=duration"`
+	}
+
+	// SNIRoute routes the TLS connections whose server name matches one
+	// of the hosts to the pool.
+	SNIRoute struct {
+		// Hosts are the server names, a host could be a wildcard like
+		// *.example.com.
+		Hosts []string        `json:"hosts" jsonschema:"required,minItems=1"`
+		Pool  *ServerPoolSpec `json:"pool" jsonschema:"required"`
+	}
+
+	// ServerPoolSpec describes the backend servers of the TCPServer, the
+	// URLs of the servers are in the format of tcp://host:port, or
+	// unix:///path for the ones listening on unix sockets.
+	ServerPoolSpec struct {
+		proxies.ServerPoolBaseSpec `json:",inline"`
+
+		DialTimeout string                   `json:"dialTimeout,omitempty" jsonschema:"format=duration"`
+		HealthCheck *proxies.HealthCheckSpec `json:"healthCheck,omitempty"`
+		// ProxyProtocol is the version of the PROXY protocol header sent to
+		// the servers, no header is sent if it is empty.
+		ProxyProtocol string `json:"proxyProtocol,omitempty" jsonschema:"enum=,enum=v1,enum=v2"`
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.UnixSocket == "" && spec.Port == 0 {
+		return fmt.Errorf("port is required if unixSocket is empty")
+	}
+	if spec.UnixSocket != "" && spec.Port != 0 {
+		return fmt.Errorf("port and unixSocket can't be set at the same time")
+	}
+
+	if spec.IdleTimeout != "" {
+		if _, err := time.ParseDuration(spec.IdleTimeout); err != nil {
+			return fmt.Errorf("invalid idleTimeout %s: %v", spec.IdleTimeout, err)
+		}
+	}
+
+	if spec.Pool == nil && len(spec.SNIRoutes) == 0 {
+		return fmt.Errorf("both pool and sniRoutes are empty")
+	}
+	if spec.Pool != nil {
+		if err := spec.Pool.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for i, r := range spec.SNIRoutes {
+		if len(r.Hosts) == 0 || r.Pool == nil {
+			return fmt.Errorf("sniRoutes %d: hosts and pool are required", i)
+		}
+		if err := r.Pool.Validate(); err != nil {
+			return fmt.Errorf("sniRoutes %d: %v", i, err)
+		}
+	}
+	if spec.SNITimeout != "" {
+		if _, err := time.ParseDuration(spec.SNITimeout); err != nil {
+			return fmt.Errorf("invalid sniTimeout %s: %v", spec.SNITimeout, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate validates ServerPoolSpec.
+func (spec *ServerPoolSpec) Validate() error {
+	if err := spec.ServerPoolBaseSpec.Validate(); err != nil {
+		return err
+	}
+
+	for _, s := range spec.Servers {
+		if _, addr := serverAddr(s); addr == "" {
+			return fmt.Errorf("invalid server url %s, it must be tcp://host:port or unix:///path", s.URL)
+		}
+	}
+
+	if spec.ServiceName != "" && spec.HealthCheck != nil {
+		return fmt.Errorf("can not open health check for service discovery")
+	}
+
+	if lb := spec.LoadBalance; lb != nil {
+		switch lb.Policy {
+		case "", proxies.LoadBalancePolicyRoundRobin, proxies.LoadBalancePolicyRandom,
+			proxies.LoadBalancePolicyWeightedRandom, proxies.LoadBalancePolicyIPHash:
+		default:
+			return fmt.Errorf("unsupported load balance policy %s", lb.Policy)
+		}
+		if lb.StickySession != nil {
+			return fmt.Errorf("sticky session is not supported")
+		}
+	}
+
+	if spec.DialTimeout != "" {
+		if _, err := time.ParseDuration(spec.DialTimeout); err != nil {
+			return fmt.Errorf("invalid dialTimeout %s: %v", spec.DialTimeout, err)
+		}
+	}
+
+	return nil
+}
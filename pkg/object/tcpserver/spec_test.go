@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"testing"
+
+	"github.com/megaease/easegress/v2/pkg/filters/proxies"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	pool := func() *ServerPoolSpec {
+		return &ServerPoolSpec{
+			ServerPoolBaseSpec: proxies.ServerPoolBaseSpec{
+				Servers: []*proxies.Server{{URL: "tcp://127.0.0.1:3306"}},
+			},
+		}
+	}
+
+	spec := &Spec{Port: 3306, IdleTimeout: "1m", Pool: pool()}
+	assert.Nil(spec.Validate())
+
+	spec.IdleTimeout = "abc"
+	assert.NotNil(spec.Validate())
+
+	spec = &Spec{Port: 3306, Pool: pool()}
+	spec.Pool.Servers[0].URL = "127.0.0.1:3306"
+	assert.NotNil(spec.Validate())
+	spec.Pool.Servers[0].URL = "tcp://127.0.0.1"
+	assert.NotNil(spec.Validate())
+	spec.Pool.Servers[0].URL = "unix:///var/run/mysqld.sock"
+	assert.Nil(spec.Validate())
+
+	spec = &Spec{UnixSocket: "/var/run/easegress.sock", Pool: pool()}
+	assert.Nil(spec.Validate())
+	spec.Port = 3306
+	assert.NotNil(spec.Validate())
+	spec = &Spec{Pool: pool()}
+	assert.NotNil(spec.Validate())
+
+	spec = &Spec{Port: 3306, Pool: pool()}
+	spec.Pool.DialTimeout = "abc"
+	assert.NotNil(spec.Validate())
+
+	spec = &Spec{Port: 3306, Pool: pool()}
+	spec.Pool.LoadBalance = &proxies.LoadBalanceSpec{Policy: proxies.LoadBalancePolicyIPHash}
+	assert.Nil(spec.Validate())
+	spec.Pool.LoadBalance.Policy = proxies.LoadBalancePolicyHeaderHash
+	assert.NotNil(spec.Validate())
+	spec.Pool.LoadBalance = &proxies.LoadBalanceSpec{StickySession: &proxies.StickySessionSpec{}}
+	assert.NotNil(spec.Validate())
+
+	spec = &Spec{Port: 3306, Pool: pool()}
+	spec.Pool.ServiceName = "mysql"
+	spec.Pool.HealthCheck = &proxies.HealthCheckSpec{}
+	assert.NotNil(spec.Validate())
+
+	spec = &Spec{Port: 443}
+	assert.NotNil(spec.Validate())
+	spec.SNIRoutes = []*SNIRoute{{Hosts: []string{"*.example.com"}, Pool: pool()}}
+	assert.Nil(spec.Validate())
+	spec.SNITimeout = "abc"
+	assert.NotNil(spec.Validate())
+	spec.SNITimeout = ""
+	spec.SNIRoutes[0].Hosts = nil
+	assert.NotNil(spec.Validate())
+}
@@ -0,0 +1,291 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tcpserver implements the TCPServer.
+package tcpserver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/ipfilter"
+	"github.com/megaease/easegress/v2/pkg/util/limitlistener"
+	"github.com/megaease/easegress/v2/pkg/util/proxyprotocol"
+	"github.com/megaease/easegress/v2/pkg/util/tlssni"
+	"github.com/megaease/easegress/v2/pkg/util/unixsocket"
+)
+
+const (
+	// Category is the category of TCPServer.
+	Category = supervisor.CategoryTrafficGate
+
+	// Kind is the kind of TCPServer.
+	Kind = "TCPServer"
+)
+
+var _ supervisor.TrafficObject = (*TCPServer)(nil)
+
+func init() {
+	supervisor.Register(&TCPServer{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  []string{"tcp"},
+	})
+}
+
+type (
+	// TCPServer is TrafficGate Object TCPServer, which proxies TCP
+	// connections to the backend servers.
+	TCPServer struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		listener    net.Listener
+		pool        *ServerPool
+		routes      []*sniRoute
+		sniTimeout  time.Duration
+		ipFilter    *ipfilter.IPFilter
+		idleTimeout time.Duration
+		err         error
+		done        chan struct{}
+
+		// conns is shared by all generations, so the connections of
+		// previous generations are closed on closing.
+		conns *connTracker
+	}
+
+	// sniRoute is the runtime of SNIRoute.
+	sniRoute struct {
+		hosts []string
+		pool  *ServerPool
+	}
+
+	// Status is the status of TCPServer.
+	Status struct {
+		Health            bool   `json:"health"`
+		Error             string `json:"error,omitempty"`
+		ActiveConnections int64  `json:"activeConnections"`
+		TotalConnections  uint64 `json:"totalConnections"`
+	}
+)
+
+// Category returns the category of TCPServer.
+func (t *TCPServer) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of TCPServer.
+func (t *TCPServer) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of TCPServer.
+func (t *TCPServer) DefaultSpec() interface{} {
+	return &Spec{
+		MaxConnections: 10240,
+	}
+}
+
+// Init initializes TCPServer.
+func (t *TCPServer) Init(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
+	t.conns = newConnTracker()
+	t.reload(superSpec)
+}
+
+// Inherit inherits previous generation of TCPServer. The previous
+// generation stops accepting new connections, but its connections are
+// kept until they finish.
+func (t *TCPServer) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object, muxMapper context.MuxMapper) {
+	prev := previousGeneration.(*TCPServer)
+	prev.stop()
+
+	t.conns = prev.conns
+	t.reload(superSpec)
+}
+
+func (t *TCPServer) reload(superSpec *supervisor.Spec) {
+	t.superSpec = superSpec
+	t.spec = superSpec.ObjectSpec().(*Spec)
+	t.done = make(chan struct{})
+
+	if t.spec.IPFilter != nil {
+		t.ipFilter = ipfilter.New(t.spec.IPFilter)
+	}
+	if t.spec.IdleTimeout != "" {
+		t.idleTimeout, _ = time.ParseDuration(t.spec.IdleTimeout)
+	}
+
+	if t.spec.Pool != nil {
+		t.pool = newServerPool(superSpec.Super(), t.spec.Pool, superSpec.Name())
+	}
+	for i, r := range t.spec.SNIRoutes {
+		name := fmt.Sprintf("%s/sniRoutes/%d", superSpec.Name(), i)
+		t.routes = append(t.routes, &sniRoute{
+			hosts: r.Hosts,
+			pool:  newServerPool(superSpec.Super(), r.Pool, name),
+		})
+	}
+	t.sniTimeout = tlssni.DefaultTimeout
+	if t.spec.SNITimeout != "" {
+		t.sniTimeout, _ = time.ParseDuration(t.spec.SNITimeout)
+	}
+
+	network, addr := "tcp", fmt.Sprintf("%s:%d", t.spec.Address, t.spec.Port)
+	if t.spec.UnixSocket != "" {
+		network, addr = "unix", t.spec.UnixSocket
+		if err := unixsocket.RemoveStale(addr); err != nil {
+			logger.Warnf("tcpserver %s: remove stale unix socket %s failed: %v", superSpec.Name(), addr, err)
+		}
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		logger.Errorf("tcpserver %s: listen on %s failed: %v", superSpec.Name(), addr, err)
+		t.err = err
+		return
+	}
+	t.listener = limitlistener.NewLimitListener(l, t.spec.MaxConnections)
+
+	var serveListener net.Listener = t.listener
+	if t.spec.ProxyProtocol {
+		serveListener = proxyprotocol.NewListener(serveListener, proxyprotocol.DefaultHeaderTimeout)
+	}
+	go t.serve(serveListener)
+}
+
+func (t *TCPServer) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-t.done:
+				return
+			default:
+			}
+			logger.Warnf("tcpserver %s: accept failed: %v", t.superSpec.Name(), err)
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		go t.handleConn(conn)
+	}
+}
+
+func (t *TCPServer) handleConn(conn net.Conn) {
+	name := t.superSpec.Name()
+	t.conns.total.Add(1)
+	t.conns.active.Add(1)
+	defer t.conns.active.Add(-1)
+
+	t.conns.add(conn)
+	defer t.conns.remove(conn)
+
+	// read the PROXY header first to avoid dialing the servers for the
+	// connections without a valid one.
+	if pc, ok := conn.(*proxyprotocol.Conn); ok {
+		if err := pc.Err(); err != nil {
+			logger.Debugf("tcpserver %s: read proxy protocol header from %s failed: %v", name, pc.Conn.RemoteAddr(), err)
+			return
+		}
+	}
+
+	if t.ipFilter != nil {
+		ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if !t.ipFilter.Allow(ip) {
+			logger.Debugf("tcpserver %s: connection from %s is not allowed", name, conn.RemoteAddr())
+			return
+		}
+	}
+
+	conn, pool := t.choosePool(conn)
+	if pool == nil {
+		logger.Debugf("tcpserver %s: no pool for connection from %s", name, conn.RemoteAddr())
+		return
+	}
+
+	upstream, err := pool.dial(conn)
+	if err != nil {
+		logger.Errorf("tcpserver %s: %v", name, err)
+		return
+	}
+	t.conns.add(upstream)
+	defer t.conns.remove(upstream)
+
+	pipe(conn, upstream, t.idleTimeout)
+}
+
+// choosePool chooses the pool of the connection by the server name of
+// its ClientHello if there are SNI routes, the returned connection must
+// be used instead of conn afterwards. The pool is nil if none matches.
+func (t *TCPServer) choosePool(conn net.Conn) (net.Conn, *ServerPool) {
+	if len(t.routes) == 0 {
+		return conn, t.pool
+	}
+
+	c, err := tlssni.Peek(conn, t.sniTimeout)
+	if err != nil {
+		logger.Debugf("tcpserver %s: read server name from %s failed: %v",
+			t.superSpec.Name(), conn.RemoteAddr(), err)
+		return conn, nil
+	}
+
+	for _, r := range t.routes {
+		if tlssni.MatchHost(r.hosts, c.ServerName()) {
+			return c, r.pool
+		}
+	}
+	return c, t.pool
+}
+
+// stop stops accepting new connections.
+func (t *TCPServer) stop() {
+	close(t.done)
+	if t.listener != nil {
+		t.listener.Close()
+	}
+	if t.pool != nil {
+		t.pool.Close()
+	}
+	for _, r := range t.routes {
+		r.pool.Close()
+	}
+}
+
+// Status returns the status of TCPServer.
+func (t *TCPServer) Status() *supervisor.Status {
+	s := &Status{
+		Health:            t.err == nil,
+		ActiveConnections: t.conns.active.Load(),
+		TotalConnections:  t.conns.total.Load(),
+	}
+	if t.err != nil {
+		s.Error = t.err.Error()
+	}
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes TCPServer and all of its connections.
+func (t *TCPServer) Close() {
+	t.stop()
+	t.conns.closeAll()
+}
@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"bufio"
+	stdcontext "context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context/contexttest"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/proxyprotocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startBackend starts a server which writes the source address in the
+// PROXY header if there is one, and then echoes the data.
+func startBackend(t *testing.T, proxyProtocol bool) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if proxyProtocol {
+					src, _, err := proxyprotocol.ReadHeader(r)
+					if err != nil {
+						return
+					}
+					fmt.Fprintf(conn, "%s\n", src)
+				}
+				io.Copy(conn, r)
+			}()
+		}
+	}()
+	return l
+}
+
+func newTCPServer(t *testing.T, yamlConfig string, prev *TCPServer) *TCPServer {
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(t, err)
+
+	svr := &TCPServer{}
+	if prev == nil {
+		svr.Init(superSpec, &contexttest.MockedMuxMapper{})
+	} else {
+		svr.Inherit(superSpec, prev, &contexttest.MockedMuxMapper{})
+	}
+	return svr
+}
+
+func TestTCPServer(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := startBackend(t, false)
+	defer backend.Close()
+
+	port := freePort(t)
+	svr := newTCPServer(t, fmt.Sprintf(`
+kind: TCPServer
+name: tcp-server
+port: %d
+pool:
+  servers:
+  - url: tcp://%s
+`, port, backend.Addr()), nil)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(err)
+	conn.Write([]byte("hello"))
+	conn.(*net.TCPConn).CloseWrite()
+	data, err := io.ReadAll(conn)
+	assert.Nil(err)
+	assert.Equal("hello", string(data))
+	conn.Close()
+
+	status := svr.Status().ObjectStatus.(*Status)
+	assert.True(status.Health)
+	assert.Equal(uint64(1), status.TotalConnections)
+
+	// the connections are closed on idle timeout.
+	svr = newTCPServer(t, fmt.Sprintf(`
+kind: TCPServer
+name: tcp-server
+port: %d
+idleTimeout: 100ms
+pool:
+  servers:
+  - url: tcp://%s
+`, port, backend.Addr()), svr)
+
+	conn, err = net.Dial("tcp", addr)
+	assert.Nil(err)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+	conn.Close()
+
+	// the servers failing the health check are not used.
+	svr = newTCPServer(t, fmt.Sprintf(`
+kind: TCPServer
+name: tcp-server
+port: %d
+pool:
+  servers:
+  - url: tcp://127.0.0.1:%d
+  healthCheck:
+    interval: 1h
+`, port, freePort(t)), svr)
+
+	conn, err = net.Dial("tcp", addr)
+	assert.Nil(err)
+	_, err = io.ReadAll(conn)
+	assert.Nil(err)
+	conn.Close()
+
+	svr.Close()
+	_, err = net.Dial("tcp", addr)
+	assert.Error(err)
+}
+
+func TestTCPServerProxyProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := startBackend(t, true)
+	defer backend.Close()
+
+	port := freePort(t)
+	svr := newTCPServer(t, fmt.Sprintf(`
+kind: TCPServer
+name: tcp-server
+port: %d
+ipFilter:
+  blockByDefault: true
+  allowIPs: [127.0.0.1]
+pool:
+  proxyProtocol: v2
+  servers:
+  - url: tcp://%s
+`, port, backend.Addr()), nil)
+	defer svr.Close()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	assert.Nil(err)
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Nil(err)
+	assert.Equal(conn.LocalAddr().String()+"\n", line)
+}
+
+func TestTCPServerAcceptProxyProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := startBackend(t, true)
+	defer backend.Close()
+
+	port := freePort(t)
+	svr := newTCPServer(t, fmt.Sprintf(`
+kind: TCPServer
+name: tcp-server
+port: %d
+proxyProtocol: true
+ipFilter:
+  blockByDefault: true
+  allowIPs: [203.0.113.7]
+pool:
+  proxyProtocol: v1
+  servers:
+  - url: tcp://%s
+`, port, backend.Addr()), nil)
+	defer svr.Close()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(err)
+	defer conn.Close()
+
+	// the address in the header is checked by the IP filter and passed
+	// to the servers.
+	conn.Write([]byte("PROXY TCP4 203.0.113.7 192.168.0.11 56324 443\r\n"))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Nil(err)
+	assert.Equal("203.0.113.7:56324\n", line)
+
+	// the connections without the header are closed.
+	conn2, err := net.Dial("tcp", addr)
+	assert.Nil(err)
+	defer conn2.Close()
+	conn2.Write([]byte("hello\n"))
+	data, err := io.ReadAll(conn2)
+	assert.Nil(err)
+	assert.Empty(data)
+}
+
+func TestTCPServerUnixSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	backendPath := filepath.Join(dir, "backend.sock")
+	backend, err := net.Listen("unix", backendPath)
+	assert.Nil(err)
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	path := filepath.Join(dir, "server.sock")
+	svr := newTCPServer(t, fmt.Sprintf(`
+kind: TCPServer
+name: tcp-server
+unixSocket: %s
+pool:
+  servers:
+  - url: unix://%s
+`, path, backendPath), nil)
+	defer svr.Close()
+
+	conn, err := net.Dial("unix", path)
+	assert.Nil(err)
+	conn.Write([]byte("hello"))
+	conn.(*net.UnixConn).CloseWrite()
+	data, err := io.ReadAll(conn)
+	assert.Nil(err)
+	assert.Equal("hello", string(data))
+	conn.Close()
+}
+
+func TestTCPServerSNIRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	b1, b2 := newBackend("b1"), newBackend("b2")
+	defer b1.Close()
+	defer b2.Close()
+
+	port := freePort(t)
+	svr := newTCPServer(t, fmt.Sprintf(`
+kind: TCPServer
+name: tcp-server
+port: %d
+sniTimeout: 1s
+sniRoutes:
+- hosts: [a.example.com]
+  pool:
+    servers:
+    - url: tcp://%s
+- hosts: ["*.example.org"]
+  pool:
+    servers:
+    - url: tcp://%s
+`, port, b1.Listener.Addr(), b2.Listener.Addr()), nil)
+	defer svr.Close()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	get := func(serverName string) string {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{ServerName: serverName, InsecureSkipVerify: true},
+			DialContext: func(ctx stdcontext.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}}
+		resp, err := client.Get("https://" + serverName)
+		if err != nil {
+			return ""
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	assert.Equal("b1", get("a.example.com"))
+	assert.Equal("b2", get("www.example.org"))
+	assert.Equal("", get("b.example.com"))
+
+	// non-TLS connections are closed.
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(err)
+	conn.Write([]byte("hello"))
+	_, err = io.ReadAll(conn)
+	assert.Nil(err)
+	conn.Close()
+}
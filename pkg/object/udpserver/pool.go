@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package udpserver
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/filters/proxies"
+	"github.com/megaease/easegress/v2/pkg/protocols"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+const maxDatagramSize = 65535
+
+type (
+	// ServerPool is the backend servers of the UDPServer.
+	ServerPool struct {
+		proxies.ServerPoolBase
+
+		spec          *ServerPoolSpec
+		healthChecker proxies.HealthChecker
+	}
+
+	// connRequest is the request used to choose servers for sessions,
+	// only the real IP is available, which is enough for the supported
+	// load balance policies.
+	connRequest struct {
+		protocols.Request
+		realIP string
+	}
+
+	udpHealthChecker struct {
+		spec *HealthCheckSpec
+	}
+)
+
+// RealIP returns the IP of the client.
+func (r *connRequest) RealIP() string {
+	return r.realIP
+}
+
+// serverAddr returns the host:port of the server, or empty if the URL of
+// the server is invalid.
+func serverAddr(s *proxies.Server) string {
+	u, err := url.Parse(s.URL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func newUDPHealthChecker(spec *HealthCheckSpec) proxies.HealthChecker {
+	if spec == nil {
+		return nil
+	}
+	return &udpHealthChecker{spec: spec}
+}
+
+// BaseSpec returns the base spec.
+func (hc *udpHealthChecker) BaseSpec() proxies.HealthCheckSpec {
+	return hc.spec.HealthCheckSpec
+}
+
+// Check checks the health of the server by sending the probe datagram.
+func (hc *udpHealthChecker) Check(svr *proxies.Server) bool {
+	conn, err := net.Dial("udp", serverAddr(svr))
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(hc.spec.GetTimeout()))
+	if _, err = conn.Write([]byte(hc.spec.Send)); err != nil {
+		return false
+	}
+
+	buf := make([]byte, maxDatagramSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(buf[:n]), hc.spec.Expect)
+}
+
+// Close closes the health checker.
+func (hc *udpHealthChecker) Close() {}
+
+func newServerPool(super *supervisor.Supervisor, spec *ServerPoolSpec, name string) *ServerPool {
+	sp := &ServerPool{
+		spec:          spec,
+		healthChecker: newUDPHealthChecker(spec.HealthCheck),
+	}
+	sp.ServerPoolBase.Init(sp, super, name, &spec.ServerPoolBaseSpec)
+	return sp
+}
+
+// CreateLoadBalancer creates a load balancer according to spec.
+func (sp *ServerPool) CreateLoadBalancer(spec *proxies.LoadBalanceSpec, servers []*proxies.Server) proxies.LoadBalancer {
+	lb := proxies.NewGeneralLoadBalancer(spec, servers)
+	lb.Init(nil, sp.healthChecker, nil)
+	return lb
+}
+
+// dial creates the connection to a server for the session of the client.
+func (sp *ServerPool) dial(client *net.UDPAddr) (*net.UDPConn, error) {
+	svr := sp.LoadBalancer().ChooseServer(&connRequest{realIP: client.IP.String()})
+	if svr == nil {
+		return nil, fmt.Errorf("no available server")
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", serverAddr(svr))
+	if err != nil {
+		return nil, fmt.Errorf("resolve server %s failed: %v", svr.URL, err)
+	}
+
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial server %s failed: %v", svr.URL, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package udpserver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/filters/proxies"
+	"github.com/megaease/easegress/v2/pkg/util/ipfilter"
+)
+
+type (
+	// Spec describes the UDPServer.
+	Spec struct {
+		Address     string `json:"address,omitempty"`
+		Port        uint16 `json:"port" jsonschema:"required,minimum=1"`
+		MaxSessions uint32 `json:"maxSessions,omitempty" jsonschema:"minimum=1"`
+		// SessionIdleTimeout removes the sessions without any datagram in
+		// both directions in the duration.
+		SessionIdleTimeout string `json:"sessionIdleTimeout,omitempty" jsonschema:"format=duration"`
+
+		IPFilter *ipfilter.Spec  `json:"ipFilter,omitempty"`
+		Pool     *ServerPoolSpec `json:"pool" jsonschema:"required"`
+	}
+
+	// ServerPoolSpec describes the backend servers of the UDPServer, the
+	// URLs of the servers are in the format of udp://host:port.
+	ServerPoolSpec struct {
+		proxies.ServerPoolBaseSpec `json:",inline"`
+
+		HealthCheck *HealthCheckSpec `json:"healthCheck,omitempty"`
+	}
+
+	// HealthCheckSpec is the spec of UDP health check, the servers are
+	// healthy if they reply to the probe datagram.
+	HealthCheckSpec struct {
+		proxies.HealthCheckSpec `json:",inline"`
+
+		// Send is the payload of the probe datagram.
+		Send string `json:"send" jsonschema:"required"`
+		// Expect is the string the reply must contain, any reply is
+		// accepted if it is empty.
+		Expect string `json:"expect,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.SessionIdleTimeout != "" {
+		if _, err := time.ParseDuration(spec.SessionIdleTimeout); err != nil {
+			return fmt.Errorf("invalid sessionIdleTimeout %s: %v", spec.SessionIdleTimeout, err)
+		}
+	}
+	return spec.Pool.Validate()
+}
+
+// Validate validates ServerPoolSpec.
+func (spec *ServerPoolSpec) Validate() error {
+	if err := spec.ServerPoolBaseSpec.Validate(); err != nil {
+		return err
+	}
+
+	for _, s := range spec.Servers {
+		if serverAddr(s) == "" {
+			return fmt.Errorf("invalid server url %s, it must be udp://host:port", s.URL)
+		}
+	}
+
+	if spec.ServiceName != "" && spec.HealthCheck != nil {
+		return fmt.Errorf("can not open health check for service discovery")
+	}
+
+	if lb := spec.LoadBalance; lb != nil {
+		switch lb.Policy {
+		case "", proxies.LoadBalancePolicyRoundRobin, proxies.LoadBalancePolicyRandom,
+			proxies.LoadBalancePolicyWeightedRandom, proxies.LoadBalancePolicyIPHash:
+		default:
+			return fmt.Errorf("unsupported load balance policy %s", lb.Policy)
+		}
+		if lb.StickySession != nil {
+			return fmt.Errorf("sticky session is not supported")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package udpserver implements the UDPServer.
+package udpserver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+	"github.com/megaease/easegress/v2/pkg/util/ipfilter"
+)
+
+const (
+	// Category is the category of UDPServer.
+	Category = supervisor.CategoryTrafficGate
+
+	// Kind is the kind of UDPServer.
+	Kind = "UDPServer"
+
+	defaultSessionIdleTimeout = time.Minute
+)
+
+var _ supervisor.TrafficObject = (*UDPServer)(nil)
+
+func init() {
+	supervisor.Register(&UDPServer{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  []string{"udp"},
+	})
+}
+
+type (
+	// UDPServer is TrafficGate Object UDPServer, which proxies UDP
+	// datagrams to the backend servers.
+	//
+	// The datagrams from the same client address belong to a session, and
+	// are sent to the same server. The listening address and the protocol
+	// are fixed, so the client address identifies the 5-tuple.
+	UDPServer struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		conn        *net.UDPConn
+		pool        *ServerPool
+		ipFilter    *ipfilter.IPFilter
+		idleTimeout time.Duration
+		err         error
+		done        chan struct{}
+
+		lock          sync.Mutex
+		sessions      map[string]*session
+		totalSessions atomic.Uint64
+	}
+
+	// session is the datagrams between a client and a server.
+	session struct {
+		client     *net.UDPAddr
+		upstream   *net.UDPConn
+		lastActive atomic.Int64
+	}
+
+	// Status is the status of UDPServer.
+	Status struct {
+		Health         bool   `json:"health"`
+		Error          string `json:"error,omitempty"`
+		ActiveSessions int    `json:"activeSessions"`
+		TotalSessions  uint64 `json:"totalSessions"`
+	}
+)
+
+func (s *session) touch() {
+	s.lastActive.Store(fasttime.Now().UnixNano())
+}
+
+func (s *session) idle(timeout time.Duration) bool {
+	return fasttime.Since(time.Unix(0, s.lastActive.Load())) >= timeout
+}
+
+// Category returns the category of UDPServer.
+func (u *UDPServer) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of UDPServer.
+func (u *UDPServer) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of UDPServer.
+func (u *UDPServer) DefaultSpec() interface{} {
+	return &Spec{
+		MaxSessions: 10240,
+	}
+}
+
+// Init initializes UDPServer.
+func (u *UDPServer) Init(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
+	u.reload(superSpec)
+}
+
+// Inherit inherits previous generation of UDPServer. The sessions of the
+// previous generation are removed, as the replies can't be sent back
+// after the previous generation releases the port.
+func (u *UDPServer) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object, muxMapper context.MuxMapper) {
+	previousGeneration.Close()
+	u.reload(superSpec)
+}
+
+func (u *UDPServer) reload(superSpec *supervisor.Spec) {
+	u.superSpec = superSpec
+	u.spec = superSpec.ObjectSpec().(*Spec)
+	u.done = make(chan struct{})
+	u.sessions = map[string]*session{}
+
+	if u.spec.IPFilter != nil {
+		u.ipFilter = ipfilter.New(u.spec.IPFilter)
+	}
+	u.idleTimeout = defaultSessionIdleTimeout
+	if u.spec.SessionIdleTimeout != "" {
+		u.idleTimeout, _ = time.ParseDuration(u.spec.SessionIdleTimeout)
+	}
+
+	u.pool = newServerPool(superSpec.Super(), u.spec.Pool, superSpec.Name())
+
+	addr := fmt.Sprintf("%s:%d", u.spec.Address, u.spec.Port)
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err == nil {
+		u.conn, err = net.ListenUDP("udp", udpAddr)
+	}
+	if err != nil {
+		logger.Errorf("udpserver %s: listen on %s failed: %v", superSpec.Name(), addr, err)
+		u.err = err
+		return
+	}
+
+	go u.serve()
+	go u.removeIdleSessions()
+}
+
+func (u *UDPServer) serve() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := u.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-u.done:
+				return
+			default:
+			}
+			logger.Warnf("udpserver %s: read failed: %v", u.superSpec.Name(), err)
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		s := u.getSession(addr)
+		if s == nil {
+			continue
+		}
+		s.touch()
+		if _, err = s.upstream.Write(buf[:n]); err != nil {
+			logger.Debugf("udpserver %s: send datagram from %s failed: %v", u.superSpec.Name(), addr, err)
+		}
+	}
+}
+
+// getSession returns the session of the client, a new session is created
+// if it doesn't exist. It returns nil if the datagram should be dropped.
+func (u *UDPServer) getSession(addr *net.UDPAddr) *session {
+	key := addr.String()
+	name := u.superSpec.Name()
+
+	u.lock.Lock()
+	s := u.sessions[key]
+	count := len(u.sessions)
+	u.lock.Unlock()
+	if s != nil {
+		return s
+	}
+
+	if u.ipFilter != nil && !u.ipFilter.Allow(addr.IP.String()) {
+		logger.Debugf("udpserver %s: datagram from %s is not allowed", name, addr)
+		return nil
+	}
+	if u.spec.MaxSessions > 0 && count >= int(u.spec.MaxSessions) {
+		logger.Warnf("udpserver %s: drop datagram from %s, too many sessions", name, addr)
+		return nil
+	}
+
+	upstream, err := u.pool.dial(addr)
+	if err != nil {
+		logger.Errorf("udpserver %s: %v", name, err)
+		return nil
+	}
+
+	s = &session{client: addr, upstream: upstream}
+	s.touch()
+	u.lock.Lock()
+	u.sessions[key] = s
+	u.lock.Unlock()
+	u.totalSessions.Add(1)
+
+	go u.relay(key, s)
+	return s
+}
+
+// relay sends the replies of the server back to the client until the
+// session is closed. The session is also removed if the server refuses
+// the datagrams, so a new server is chosen for the next one.
+func (u *UDPServer) relay(key string, s *session) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, err := s.upstream.Read(buf)
+		if err != nil {
+			logger.Debugf("udpserver %s: session of %s finished: %v", u.superSpec.Name(), s.client, err)
+			break
+		}
+		s.touch()
+		u.conn.WriteToUDP(buf[:n], s.client)
+	}
+
+	u.lock.Lock()
+	if u.sessions[key] == s {
+		delete(u.sessions, key)
+	}
+	u.lock.Unlock()
+	s.upstream.Close()
+}
+
+func (u *UDPServer) removeIdleSessions() {
+	ticker := time.NewTicker(u.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-u.done:
+			return
+		case <-ticker.C:
+		}
+
+		u.lock.Lock()
+		for _, s := range u.sessions {
+			if s.idle(u.idleTimeout) {
+				// relay removes the session.
+				s.upstream.Close()
+			}
+		}
+		u.lock.Unlock()
+	}
+}
+
+// Status returns the status of UDPServer.
+func (u *UDPServer) Status() *supervisor.Status {
+	u.lock.Lock()
+	active := len(u.sessions)
+	u.lock.Unlock()
+
+	s := &Status{
+		Health:         u.err == nil,
+		ActiveSessions: active,
+		TotalSessions:  u.totalSessions.Load(),
+	}
+	if u.err != nil {
+		s.Error = u.err.Error()
+	}
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes UDPServer and all of its sessions.
+func (u *UDPServer) Close() {
+	close(u.done)
+	if u.conn != nil {
+		u.conn.Close()
+	}
+	u.pool.Close()
+
+	u.lock.Lock()
+	for _, s := range u.sessions {
+		s.upstream.Close()
+	}
+	u.lock.Unlock()
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package udpserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context/contexttest"
+	"github.com/megaease/easegress/v2/pkg/filters/proxies"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func freePort(t *testing.T) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// startBackend starts a server which replies the datagrams with its name.
+func startBackend(t *testing.T, name string) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.Nil(t, err)
+
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP([]byte(name+":"+string(buf[:n])), addr)
+		}
+	}()
+	return conn
+}
+
+func newUDPServer(t *testing.T, yamlConfig string) *UDPServer {
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(t, err)
+
+	svr := &UDPServer{}
+	svr.Init(superSpec, &contexttest.MockedMuxMapper{})
+	return svr
+}
+
+func exchange(t *testing.T, conn net.Conn, msg string) string {
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	_, err := conn.Write([]byte(msg))
+	assert.Nil(t, err)
+
+	buf := make([]byte, maxDatagramSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+func TestUDPServer(t *testing.T) {
+	assert := assert.New(t)
+
+	b1, b2 := startBackend(t, "b1"), startBackend(t, "b2")
+	defer b1.Close()
+	defer b2.Close()
+
+	port := freePort(t)
+	svr := newUDPServer(t, fmt.Sprintf(`
+kind: UDPServer
+name: udp-server
+port: %d
+sessionIdleTimeout: 200ms
+pool:
+  servers:
+  - url: udp://%s
+  - url: udp://%s
+`, port, b1.LocalAddr(), b2.LocalAddr()))
+	defer svr.Close()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	c1, err := net.Dial("udp", addr)
+	assert.Nil(err)
+	defer c1.Close()
+	c2, err := net.Dial("udp", addr)
+	assert.Nil(err)
+	defer c2.Close()
+
+	// the datagrams of a session are sent to the same server.
+	r1 := exchange(t, c1, "a")
+	assert.Equal(r1[:3]+"b", exchange(t, c1, "b"))
+	r2 := exchange(t, c2, "a")
+	assert.NotEqual(r1, r2)
+
+	status := svr.Status().ObjectStatus.(*Status)
+	assert.True(status.Health)
+	assert.Equal(2, status.ActiveSessions)
+	assert.Equal(uint64(2), status.TotalSessions)
+
+	time.Sleep(500 * time.Millisecond)
+	status = svr.Status().ObjectStatus.(*Status)
+	assert.Equal(0, status.ActiveSessions)
+
+	// a new session is created after the idle timeout.
+	assert.NotEmpty(exchange(t, c1, "c"))
+	status = svr.Status().ObjectStatus.(*Status)
+	assert.Equal(uint64(3), status.TotalSessions)
+}
+
+func TestUDPServerHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	b1 := startBackend(t, "b1")
+	defer b1.Close()
+
+	port := freePort(t)
+	svr := newUDPServer(t, fmt.Sprintf(`
+kind: UDPServer
+name: udp-server
+port: %d
+pool:
+  servers:
+  - url: udp://127.0.0.1:%d
+  - url: udp://%s
+  healthCheck:
+    interval: 1h
+    timeout: 200ms
+    send: ping
+    expect: "b1:ping"
+`, port, freePort(t), b1.LocalAddr()))
+	defer svr.Close()
+
+	conn, err := net.Dial("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	assert.Nil(err)
+	defer conn.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.Equal("b1:hello", exchange(t, conn, "hello"))
+	}
+
+	hc := newUDPHealthChecker(&HealthCheckSpec{Send: "ping", Expect: "pong"})
+	assert.False(hc.Check(&proxies.Server{URL: "udp://" + b1.LocalAddr().String()}))
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	pool := func() *ServerPoolSpec {
+		return &ServerPoolSpec{
+			ServerPoolBaseSpec: proxies.ServerPoolBaseSpec{
+				Servers: []*proxies.Server{{URL: "udp://127.0.0.1:53"}},
+			},
+		}
+	}
+
+	spec := &Spec{Port: 53, SessionIdleTimeout: "30s", Pool: pool()}
+	assert.Nil(spec.Validate())
+	spec.SessionIdleTimeout = "abc"
+	assert.NotNil(spec.Validate())
+
+	spec = &Spec{Port: 53, Pool: pool()}
+	spec.Pool.Servers[0].URL = "udp://127.0.0.1"
+	assert.NotNil(spec.Validate())
+
+	spec = &Spec{Port: 53, Pool: pool()}
+	spec.Pool.LoadBalance = &proxies.LoadBalanceSpec{Policy: proxies.LoadBalancePolicyCookieHash}
+	assert.NotNil(spec.Validate())
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhooknotifier
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// HeaderEvent is the header of the event type.
+	HeaderEvent = "X-Easegress-Event"
+	// HeaderDelivery is the header of the event ID.
+	HeaderDelivery = "X-Easegress-Delivery"
+	// HeaderSignature is the header of the HMAC-SHA256 signature of the
+	// body, in the format of sha256=<hex>.
+	HeaderSignature = "X-Easegress-Signature"
+
+	queueSize = 1024
+)
+
+// webhook delivers the events to a webhook in order, the failed requests
+// are retried with exponential backoff.
+type webhook struct {
+	spec          *WebhookSpec
+	client        *http.Client
+	maxRetries    int
+	retryInterval time.Duration
+
+	kinds  map[string]struct{}
+	events map[string]struct{}
+
+	queue chan *Event
+	done  chan struct{}
+	wg    sync.WaitGroup
+
+	mutex            sync.Mutex
+	delivered        uint64
+	failed           uint64
+	lastDeliveryTime time.Time
+	lastError        string
+}
+
+func newWebhook(ws *WebhookSpec, spec *Spec) *webhook {
+	w := &webhook{
+		spec:          ws,
+		client:        &http.Client{Timeout: spec.timeout()},
+		maxRetries:    spec.MaxRetries,
+		retryInterval: spec.retryInterval(),
+		kinds:         map[string]struct{}{},
+		events:        map[string]struct{}{},
+		queue:         make(chan *Event, queueSize),
+		done:          make(chan struct{}),
+	}
+	for _, k := range ws.Kinds {
+		w.kinds[k] = struct{}{}
+	}
+	for _, e := range ws.Events {
+		w.events[e] = struct{}{}
+	}
+
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+func (w *webhook) accept(e *Event) bool {
+	if _, ok := w.kinds[e.Kind]; len(w.kinds) != 0 && !ok {
+		return false
+	}
+	if _, ok := w.events[e.Type]; len(w.events) != 0 && !ok {
+		return false
+	}
+	return true
+}
+
+// enqueue queues the event, the event is dropped if the queue is full.
+func (w *webhook) enqueue(e *Event) {
+	select {
+	case w.queue <- e:
+	default:
+		w.record(fmt.Errorf("queue is full, event %s of %s dropped", e.Type, e.Name))
+	}
+}
+
+func (w *webhook) run() {
+	defer w.wg.Done()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case e := <-w.queue:
+			w.record(w.deliver(e))
+		}
+	}
+}
+
+// deliver posts the event, it retries on network errors and 5xx and 429
+// responses.
+func (w *webhook) deliver(e *Event) error {
+	body, err := codectool.MarshalJSON(e)
+	if err != nil {
+		return fmt.Errorf("marshal event failed: %v", err)
+	}
+
+	interval := w.retryInterval
+	for i := 0; ; i++ {
+		retry, err := w.post(e, body)
+		if err == nil || !retry || i >= w.maxRetries {
+			return err
+		}
+
+		select {
+		case <-w.done:
+			return err
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+func (w *webhook) post(e *Event, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.spec.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range w.spec.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, e.Type)
+	req.Header.Set(HeaderDelivery, e.ID)
+	if w.spec.Secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+sign(w.spec.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook %s responded %d", w.spec.Name, resp.StatusCode)
+}
+
+func (w *webhook) record(err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.lastDeliveryTime = time.Now()
+	if err != nil {
+		logger.Errorf("notify webhook %s failed: %v", w.spec.Name, err)
+		w.failed++
+		w.lastError = err.Error()
+		return
+	}
+	w.delivered++
+}
+
+func (w *webhook) status() *WebhookStatus {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	s := &WebhookStatus{
+		Name:      w.spec.Name,
+		Delivered: w.delivered,
+		Failed:    w.failed,
+		LastError: w.lastError,
+	}
+	if !w.lastDeliveryTime.IsZero() {
+		s.LastDeliveryTime = w.lastDeliveryTime.Format(time.RFC3339)
+	}
+	return s
+}
+
+func (w *webhook) close() {
+	close(w.done)
+	w.wg.Wait()
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the body.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
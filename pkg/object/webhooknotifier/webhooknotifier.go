@@ -0,0 +1,303 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package webhooknotifier provides WebhookNotifier to notify the changes of
+// object specs to webhooks.
+package webhooknotifier
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+const (
+	// Category is the category of WebhookNotifier.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of WebhookNotifier.
+	Kind = "WebhookNotifier"
+
+	// EventCreated is the event type of object creation.
+	EventCreated = "created"
+	// EventUpdated is the event type of object update.
+	EventUpdated = "updated"
+	// EventDeleted is the event type of object deletion.
+	EventDeleted = "deleted"
+)
+
+var aliases = []string{"webhook", "webhooks"}
+
+func init() {
+	supervisor.Register(&WebhookNotifier{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  aliases,
+	})
+}
+
+type (
+	// WebhookNotifier posts an event to the webhooks whenever an object
+	// spec is created, updated or deleted. Every member watches the
+	// changes, but only the leader of the cluster posts the events.
+	WebhookNotifier struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		watcher  *supervisor.ObjectEntityWatcher
+		webhooks []*webhook
+
+		done chan struct{}
+	}
+
+	// Spec describes the WebhookNotifier.
+	Spec struct {
+		// Timeout is the timeout of a request to webhooks.
+		Timeout string `json:"timeout,omitempty" jsonschema:"format=duration"`
+		// MaxRetries is the max number of retries of a failed request.
+		MaxRetries int `json:"maxRetries,omitempty" jsonschema:"minimum=0"`
+		// RetryInterval is the interval before the first retry, it is
+		// doubled for every following retry.
+		RetryInterval string         `json:"retryInterval,omitempty" jsonschema:"format=duration"`
+		Webhooks      []*WebhookSpec `json:"webhooks" jsonschema:"required,minItems=1"`
+	}
+
+	// WebhookSpec describes a webhook.
+	WebhookSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		URL  string `json:"url" jsonschema:"required,format=uri"`
+		// Secret signs the body of requests with HMAC-SHA256, the
+		// signature is in the header X-Easegress-Signature.
+		Secret  string            `json:"secret,omitempty" jsonschema:"writeOnly=true"`
+		Headers map[string]string `json:"headers,omitempty"`
+		// Kinds are the kinds of objects to notify, all kinds if empty.
+		Kinds []string `json:"kinds,omitempty" jsonschema:"uniqueItems=true"`
+		// Events are the types of events to notify, all types if empty.
+		Events []string `json:"events,omitempty" jsonschema:"uniqueItems=true"`
+	}
+
+	// Event is the event posted to webhooks.
+	Event struct {
+		ID          string                 `json:"id"`
+		Type        string                 `json:"type"`
+		Time        string                 `json:"time"`
+		ClusterName string                 `json:"clusterName"`
+		Name        string                 `json:"name"`
+		Kind        string                 `json:"kind"`
+		Spec        map[string]interface{} `json:"spec"`
+	}
+
+	// Status is the status of WebhookNotifier.
+	Status struct {
+		Leader   bool             `json:"leader"`
+		Webhooks []*WebhookStatus `json:"webhooks"`
+	}
+
+	// WebhookStatus is the delivery status of a webhook.
+	WebhookStatus struct {
+		Name      string `json:"name"`
+		Delivered uint64 `json:"delivered"`
+		Failed    uint64 `json:"failed"`
+		// LastDeliveryTime is in RFC3339 format.
+		LastDeliveryTime string `json:"lastDeliveryTime,omitempty"`
+		LastError        string `json:"lastError,omitempty"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	names := map[string]struct{}{}
+	for _, w := range spec.Webhooks {
+		if _, ok := names[w.Name]; ok {
+			return fmt.Errorf("webhook %s is duplicated", w.Name)
+		}
+		names[w.Name] = struct{}{}
+
+		for _, e := range w.Events {
+			if e != EventCreated && e != EventUpdated && e != EventDeleted {
+				return fmt.Errorf("webhook %s: unknown event %s", w.Name, e)
+			}
+		}
+	}
+	return nil
+}
+
+func (spec *Spec) timeout() time.Duration {
+	d, err := time.ParseDuration(spec.Timeout)
+	if err != nil || d <= 0 {
+		return 5 * time.Second
+	}
+	return d
+}
+
+func (spec *Spec) retryInterval() time.Duration {
+	d, err := time.ParseDuration(spec.RetryInterval)
+	if err != nil || d <= 0 {
+		return time.Second
+	}
+	return d
+}
+
+// Category returns the category of WebhookNotifier.
+func (wn *WebhookNotifier) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of WebhookNotifier.
+func (wn *WebhookNotifier) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of WebhookNotifier.
+func (wn *WebhookNotifier) DefaultSpec() interface{} {
+	return &Spec{
+		Timeout:       "5s",
+		MaxRetries:    3,
+		RetryInterval: "1s",
+	}
+}
+
+// Init initializes WebhookNotifier.
+func (wn *WebhookNotifier) Init(superSpec *supervisor.Spec) {
+	wn.superSpec, wn.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	wn.reload(nil)
+}
+
+// Inherit inherits previous generation of WebhookNotifier, the watcher is
+// kept so that no changes are missed.
+func (wn *WebhookNotifier) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	wn.superSpec, wn.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+
+	prev := previousGeneration.(*WebhookNotifier)
+	watcher := prev.watcher
+	prev.watcher = nil
+	prev.Close()
+
+	wn.reload(watcher)
+}
+
+func (wn *WebhookNotifier) reload(watcher *supervisor.ObjectEntityWatcher) {
+	wn.done = make(chan struct{})
+	for _, ws := range wn.spec.Webhooks {
+		wn.webhooks = append(wn.webhooks, newWebhook(ws, wn.spec))
+	}
+
+	wn.watcher = watcher
+	if wn.watcher == nil {
+		wn.watcher = wn.superSpec.Super().ObjectRegistry().NewWatcher(wn.watcherName(),
+			supervisor.FilterCategory(supervisor.CategoryAll))
+		// the first event contains the existing objects.
+		<-wn.watcher.Watch()
+	}
+
+	go wn.run()
+}
+
+func (wn *WebhookNotifier) watcherName() string {
+	return Kind + "/" + wn.superSpec.Name()
+}
+
+func (wn *WebhookNotifier) run() {
+	for {
+		select {
+		case <-wn.done:
+			return
+		case event := <-wn.watcher.Watch():
+			if !wn.superSpec.Super().Cluster().IsLeader() {
+				continue
+			}
+			wn.notify(newEvents(wn.superSpec.Super().Options().ClusterName, event))
+		}
+	}
+}
+
+func (wn *WebhookNotifier) notify(events []*Event) {
+	for _, e := range events {
+		for _, w := range wn.webhooks {
+			if w.accept(e) {
+				w.enqueue(e)
+			}
+		}
+	}
+}
+
+// newEvents converts the watcher event to webhook events, the deletions
+// come first.
+func newEvents(clusterName string, event *supervisor.ObjectEntityWatcherEvent) []*Event {
+	now := time.Now().Format(time.RFC3339)
+
+	var events []*Event
+	add := func(typ string, entities map[string]*supervisor.ObjectEntity) {
+		names := make([]string, 0, len(entities))
+		for name := range entities {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			spec := entities[name].Spec()
+			events = append(events, &Event{
+				ID:          uuid.NewString(),
+				Type:        typ,
+				Time:        now,
+				ClusterName: clusterName,
+				Name:        spec.Name(),
+				Kind:        spec.Kind(),
+				Spec:        spec.RawSpec(),
+			})
+		}
+	}
+	add(EventDeleted, event.Delete)
+	add(EventCreated, event.Create)
+	add(EventUpdated, event.Update)
+
+	return events
+}
+
+// Status returns the status of WebhookNotifier.
+func (wn *WebhookNotifier) Status() *supervisor.Status {
+	status := &Status{
+		Leader: wn.superSpec.Super().Cluster().IsLeader(),
+	}
+	for _, w := range wn.webhooks {
+		status.Webhooks = append(status.Webhooks, w.status())
+	}
+	return &supervisor.Status{ObjectStatus: status}
+}
+
+// Close closes WebhookNotifier.
+func (wn *WebhookNotifier) Close() {
+	// the watcher is closed first, the running loop keeps draining the
+	// events until then, so that the registry is never blocked.
+	if wn.watcher != nil {
+		wn.superSpec.Super().ObjectRegistry().CloseWatcher(wn.watcherName())
+	}
+	close(wn.done)
+	for _, w := range wn.webhooks {
+		w.close()
+	}
+	logger.Infof("%s closed", wn.superSpec.Name())
+}
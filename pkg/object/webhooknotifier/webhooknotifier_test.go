@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhooknotifier
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+const notifierConfig = `
+name: notifier
+kind: WebhookNotifier
+webhooks:
+- name: cmdb
+  url: http://127.0.0.1:8080/hooks
+`
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Webhooks: []*WebhookSpec{{Name: "a"}, {Name: "b", Events: []string{EventCreated}}}}
+	assert.NoError(spec.Validate())
+
+	spec.Webhooks[1].Events = append(spec.Webhooks[1].Events, "renamed")
+	assert.Error(spec.Validate())
+
+	spec.Webhooks[1].Name = "a"
+	assert.Error(spec.Validate())
+
+	assert.Equal(5*time.Second, spec.timeout())
+	assert.Equal(time.Second, spec.retryInterval())
+}
+
+func TestNewEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	super := supervisor.NewDefaultMock()
+	entity, err := super.NewObjectEntityFromConfig(notifierConfig)
+	assert.NoError(err)
+
+	events := newEvents("test-cluster", &supervisor.ObjectEntityWatcherEvent{
+		Create: map[string]*supervisor.ObjectEntity{"notifier": entity},
+		Update: map[string]*supervisor.ObjectEntity{},
+		Delete: map[string]*supervisor.ObjectEntity{"notifier": entity},
+	})
+	assert.Len(events, 2)
+	assert.Equal(EventDeleted, events[0].Type)
+	assert.Equal(EventCreated, events[1].Type)
+	assert.Equal("notifier", events[1].Name)
+	assert.Equal(Kind, events[1].Kind)
+	assert.Equal("test-cluster", events[1].ClusterName)
+	assert.NotEmpty(events[1].ID)
+	assert.NotEqual(events[0].ID, events[1].ID)
+	assert.Contains(events[1].Spec, "webhooks")
+}
+
+func TestWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	var mutex sync.Mutex
+	var received []*Event
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		attempts++
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(HeaderSignature) != "sha256="+sign("secret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal("chatops", r.Header.Get("X-Source"))
+
+		e := &Event{}
+		json.Unmarshal(body, e)
+		assert.Equal(e.Type, r.Header.Get(HeaderEvent))
+		assert.Equal(e.ID, r.Header.Get(HeaderDelivery))
+
+		// the first attempt of the update fails.
+		if e.Type == EventUpdated && attempts == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received = append(received, e)
+	}))
+	defer server.Close()
+
+	spec := &Spec{MaxRetries: 2, RetryInterval: "10ms"}
+	w := newWebhook(&WebhookSpec{
+		Name:    "chatops",
+		URL:     server.URL,
+		Secret:  "secret",
+		Headers: map[string]string{"X-Source": "chatops"},
+		Kinds:   []string{"HTTPServer"},
+	}, spec)
+	defer w.close()
+
+	events := []*Event{
+		{ID: "1", Type: EventCreated, Name: "server", Kind: "HTTPServer"},
+		{ID: "2", Type: EventCreated, Name: "pipeline", Kind: "Pipeline"},
+		{ID: "3", Type: EventUpdated, Name: "server", Kind: "HTTPServer"},
+	}
+	for _, e := range events {
+		if w.accept(e) {
+			w.enqueue(e)
+		}
+	}
+
+	assert.Eventually(func() bool {
+		return w.status().Delivered == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	mutex.Lock()
+	assert.Len(received, 2)
+	assert.Equal("1", received[0].ID)
+	assert.Equal("3", received[1].ID)
+	assert.Equal(3, attempts)
+	mutex.Unlock()
+
+	// the events are not retried for 4xx responses.
+	w.spec.Secret = "wrong"
+	w.enqueue(events[0])
+	assert.Eventually(func() bool {
+		return w.status().Failed == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	status := w.status()
+	assert.Contains(status.LastError, "401")
+	assert.NotEmpty(status.LastDeliveryTime)
+	mutex.Lock()
+	assert.Equal(4, attempts)
+	mutex.Unlock()
+
+	w.spec.Events = []string{EventDeleted}
+	w2 := newWebhook(w.spec, spec)
+	defer w2.close()
+	assert.False(w2.accept(events[0]))
+	assert.True(w2.accept(&Event{Type: EventDeleted, Kind: "HTTPServer"}))
+}
@@ -35,6 +35,9 @@ import (
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 )
 
+// EtcdRootUser is the user of the authentication of the embedded etcd.
+const EtcdRootUser = "root"
+
 // ClusterOptions defines the cluster members.
 type ClusterOptions struct {
 	// Primary members define following URLs to form a cluster.
@@ -47,6 +50,64 @@ type ClusterOptions struct {
 	// Secondary members define URLs to connect to cluster formed by primary members.
 	PrimaryListenPeerURLs []string `yaml:"primary-listen-peer-urls"`
 	MaxCallSendMsgSize    int      `yaml:"max-call-send-msg-size"`
+
+	// Primary members define the TLS of the client and peer traffic of
+	// the embedded etcd.
+	ClientCertFile      string `yaml:"client-cert-file"`
+	ClientKeyFile       string `yaml:"client-key-file"`
+	ClientTrustedCAFile string `yaml:"client-trusted-ca-file"`
+	ClientCertAuth      bool   `yaml:"client-cert-auth"`
+	PeerCertFile        string `yaml:"peer-cert-file"`
+	PeerKeyFile         string `yaml:"peer-key-file"`
+	PeerTrustedCAFile   string `yaml:"peer-trusted-ca-file"`
+	PeerClientCertAuth  bool   `yaml:"peer-client-cert-auth"`
+
+	// All members define the TLS and authentication of the etcd client,
+	// members using standalone etcd define the client URLs of the external
+	// etcd cluster.
+	EtcdEndpoints []string `yaml:"etcd-endpoints"`
+	EtcdCAFile    string   `yaml:"etcd-ca-file"`
+	EtcdCertFile  string   `yaml:"etcd-cert-file"`
+	EtcdKeyFile   string   `yaml:"etcd-key-file"`
+	EtcdUsername  string   `yaml:"etcd-username"`
+	EtcdPassword  string   `yaml:"etcd-password" json:"-"`
+
+	// All members could discover the primary members instead of defining
+	// initial-cluster or primary-listen-peer-urls.
+	Discovery DiscoveryOptions `yaml:"discovery"`
+
+	// Learner members could be promoted automatically to replace the lost
+	// voting members.
+	Promotion PromotionOptions `yaml:"promotion"`
+}
+
+// DiscoveryOptions defines how the members discover the peer URLs of the
+// primary members while bootstrapping. Primary members fill initial-cluster
+// with them, and the others fill primary-listen-peer-urls.
+type DiscoveryOptions struct {
+	Type         string `yaml:"type"`
+	Timeout      string `yaml:"timeout"`
+	ExpectedSize int    `yaml:"expected-size"`
+	PeerPort     int    `yaml:"peer-port"`
+
+	SRVDomain string `yaml:"srv-domain"`
+	SRVName   string `yaml:"srv-name"`
+
+	Tags        map[string]string `yaml:"tags"`
+	EC2Region   string            `yaml:"ec2-region"`
+	EC2Endpoint string            `yaml:"ec2-endpoint"`
+	GCEProject  string            `yaml:"gce-project"`
+
+	KubernetesNamespace string `yaml:"kubernetes-namespace"`
+	KubernetesService   string `yaml:"kubernetes-service"`
+}
+
+// PromotionOptions defines the policy to promote learner members to voting
+// members of the embedded etcd.
+type PromotionOptions struct {
+	Policy      string `yaml:"policy"`
+	Voters      int    `yaml:"voters"`
+	LostTimeout string `yaml:"lost-timeout"`
 }
 
 // Options is the start-up options.
@@ -77,6 +138,8 @@ type Options struct {
 	DisableAccessLog         bool              `yaml:"disable-access-log"`
 	InitialObjectConfigFiles []string          `yaml:"initial-object-config-files"`
 	ObjectsDumpInterval      string            `yaml:"objects-dump-interval"`
+	AutoMigrate              bool              `yaml:"auto-migrate"`
+	ObjectHistoryLimit       int               `yaml:"object-history-limit"`
 	BasicAuth                map[string]string `yaml:"basic-auth"`
 
 	// cluster options
@@ -100,18 +163,39 @@ type Options struct {
 	// Status
 	StatusUpdateMaxBatchSize int `yaml:"status-update-max-batch-size"`
 
+	// Snapshot.
+	Snapshot SnapshotOptions `yaml:"snapshot"`
+
 	// Prepare the items below in advance.
 	AbsHomeDir string `yaml:"-"`
 	AbsDataDir string `yaml:"-"`
 	AbsWALDir  string `yaml:"-"`
 	AbsLogDir  string `yaml:"-"`
 	// AbsMemberDir string `yaml:"-"`
+	AbsSnapshotDir string `yaml:"-"`
+}
+
+// SnapshotOptions defines the snapshots of the cluster data, they are
+// stored in the S3 compatible object storage if s3-bucket is defined,
+// otherwise in the local directory.
+type SnapshotOptions struct {
+	Dir        string `yaml:"dir"`
+	Interval   string `yaml:"interval"`
+	MaxBackups int    `yaml:"max-backups"`
+
+	S3Endpoint        string `yaml:"s3-endpoint"`
+	S3Region          string `yaml:"s3-region"`
+	S3Bucket          string `yaml:"s3-bucket"`
+	S3Prefix          string `yaml:"s3-prefix"`
+	S3AccessKeyID     string `yaml:"s3-access-key-id"`
+	S3SecretAccessKey string `yaml:"s3-secret-access-key" json:"-"`
+	S3ForcePathStyle  bool   `yaml:"s3-force-path-style"`
 }
 
 // addClusterVars introduces cluster arguments.
 func addClusterVars(opt *Options) {
 	opt.flags.StringVar(&opt.ClusterName, "cluster-name", "eg-cluster-default-name", "Human-readable name for the new cluster, ignored while joining an existed cluster.")
-	opt.flags.StringVar(&opt.ClusterRole, "cluster-role", "primary", "Cluster role for this member (primary, secondary).")
+	opt.flags.StringVar(&opt.ClusterRole, "cluster-role", "primary", "Cluster role for this member (primary, secondary, learner).")
 	opt.flags.StringVar(&opt.ClusterRequestTimeout, "cluster-request-timeout", "10s", "Timeout to handle request in the cluster.")
 
 	// Cluster connection configuration
@@ -121,8 +205,45 @@ func addClusterVars(opt *Options) {
 	opt.flags.StringSliceVar(&opt.Cluster.InitialAdvertisePeerURLs, "initial-advertise-peer-urls", []string{"http://localhost:2380"}, "List of this member's peer URLs to advertise to the rest of the cluster.")
 	opt.flags.StringToStringVarP(&opt.Cluster.InitialCluster, "initial-cluster", "", nil, "List of (member name, URL) pairs that will form the cluster. E.g. primary-1=http://localhost:2380.")
 	opt.flags.StringVar(&opt.Cluster.StateFlag, "state-flag", "new", "Cluster state (new, existing)")
-	opt.flags.StringSliceVar(&opt.Cluster.PrimaryListenPeerURLs, "primary-listen-peer-urls", []string{"http://localhost:2380"}, "List of peer URLs of primary members. Define this only, when cluster-role is secondary.")
+	opt.flags.StringSliceVar(&opt.Cluster.PrimaryListenPeerURLs, "primary-listen-peer-urls", []string{"http://localhost:2380"}, "List of peer URLs of primary members. Define this only, when cluster-role is secondary or learner.")
 	opt.flags.IntVar(&opt.Cluster.MaxCallSendMsgSize, "max-call-send-msg-size", 10*1024*1024, "Maximum size in bytes for cluster synchronization messages.")
+
+	// Embedded etcd TLS configuration
+	opt.flags.StringVar(&opt.Cluster.ClientCertFile, "client-cert-file", "", "Path to the certificate file of the client traffic of the embedded etcd.")
+	opt.flags.StringVar(&opt.Cluster.ClientKeyFile, "client-key-file", "", "Path to the private key file of the client traffic of the embedded etcd.")
+	opt.flags.StringVar(&opt.Cluster.ClientTrustedCAFile, "client-trusted-ca-file", "", "Path to the CA file verifying the client certificates of the embedded etcd.")
+	opt.flags.BoolVar(&opt.Cluster.ClientCertAuth, "client-cert-auth", false, "Flag to require client certificates for the client traffic of the embedded etcd.")
+	opt.flags.StringVar(&opt.Cluster.PeerCertFile, "peer-cert-file", "", "Path to the certificate file of the peer traffic of the embedded etcd.")
+	opt.flags.StringVar(&opt.Cluster.PeerKeyFile, "peer-key-file", "", "Path to the private key file of the peer traffic of the embedded etcd.")
+	opt.flags.StringVar(&opt.Cluster.PeerTrustedCAFile, "peer-trusted-ca-file", "", "Path to the CA file verifying the peer certificates of the embedded etcd.")
+	opt.flags.BoolVar(&opt.Cluster.PeerClientCertAuth, "peer-client-cert-auth", false, "Flag to require client certificates for the peer traffic of the embedded etcd.")
+
+	// Etcd client configuration
+	opt.flags.StringSliceVar(&opt.Cluster.EtcdEndpoints, "etcd-endpoints", nil, "List of client URLs of the external etcd cluster. Define this only, when use-standalone-etcd is true.")
+	opt.flags.StringVar(&opt.Cluster.EtcdCAFile, "etcd-ca-file", "", "Path to the CA file verifying the etcd servers.")
+	opt.flags.StringVar(&opt.Cluster.EtcdCertFile, "etcd-cert-file", "", "Path to the client certificate file for the etcd servers.")
+	opt.flags.StringVar(&opt.Cluster.EtcdKeyFile, "etcd-key-file", "", "Path to the client private key file for the etcd servers.")
+	opt.flags.StringVar(&opt.Cluster.EtcdUsername, "etcd-username", "", "Username to authenticate to etcd, primary members enable the authentication of the embedded etcd with the root user if it is root.")
+	opt.flags.StringVar(&opt.Cluster.EtcdPassword, "etcd-password", "", "Password to authenticate to etcd.")
+
+	// Discovery configuration
+	opt.flags.StringVar(&opt.Cluster.Discovery.Type, "discovery-type", "", "Type to discover the primary members (dns-srv, ec2, gce, kubernetes), initial-cluster and primary-listen-peer-urls are used if it is empty.")
+	opt.flags.StringVar(&opt.Cluster.Discovery.Timeout, "discovery-timeout", "5m", "Timeout to discover the primary members.")
+	opt.flags.IntVar(&opt.Cluster.Discovery.ExpectedSize, "discovery-expected-size", 0, "Number of primary members to discover before forming a new cluster. Define this only, when cluster-role is primary.")
+	opt.flags.IntVar(&opt.Cluster.Discovery.PeerPort, "discovery-peer-port", 2380, "Peer port of the primary members discovered by ec2, gce and kubernetes.")
+	opt.flags.StringVar(&opt.Cluster.Discovery.SRVDomain, "discovery-srv-domain", "", "Domain of the DNS SRV records of the primary members.")
+	opt.flags.StringVar(&opt.Cluster.Discovery.SRVName, "discovery-srv-name", "", "Suffix of the service name of the DNS SRV records of the primary members.")
+	opt.flags.StringToStringVar(&opt.Cluster.Discovery.Tags, "discovery-tags", nil, "Tags of the EC2 instances or labels of the GCE instances of the primary members.")
+	opt.flags.StringVar(&opt.Cluster.Discovery.EC2Region, "discovery-ec2-region", "", "Region of the EC2 instances, the one of the current instance by default.")
+	opt.flags.StringVar(&opt.Cluster.Discovery.EC2Endpoint, "discovery-ec2-endpoint", "", "Endpoint of the EC2 API, the one of the region by default.")
+	opt.flags.StringVar(&opt.Cluster.Discovery.GCEProject, "discovery-gce-project", "", "Project of the GCE instances, the one of the current instance by default.")
+	opt.flags.StringVar(&opt.Cluster.Discovery.KubernetesNamespace, "discovery-kubernetes-namespace", "", "Namespace of the Kubernetes service, the one of the current pod by default.")
+	opt.flags.StringVar(&opt.Cluster.Discovery.KubernetesService, "discovery-kubernetes-service", "", "Headless Kubernetes service selecting the pods of the primary members.")
+
+	// Promotion configuration
+	opt.flags.StringVar(&opt.Cluster.Promotion.Policy, "promotion-policy", "manual", "Policy to promote learner members to voting members (manual, auto), auto promotes healthy learners to replace the lost voting members.")
+	opt.flags.IntVar(&opt.Cluster.Promotion.Voters, "promotion-voters", 0, "Number of voting members to keep when promotion-policy is auto, the size of initial-cluster by default.")
+	opt.flags.StringVar(&opt.Cluster.Promotion.LostTimeout, "promotion-lost-timeout", "1m", "Time without heartbeat after which a member is considered lost, for example: 1m.")
 }
 
 // New creates a default Options.
@@ -149,6 +270,8 @@ func New() *Options {
 	opt.flags.BoolVar(&opt.Debug, "debug", false, "Flag to set lowest log level from INFO downgrade DEBUG.")
 	opt.flags.StringSliceVar(&opt.InitialObjectConfigFiles, "initial-object-config-files", nil, "List of configuration files for initial objects, these objects will be created at startup if not already exist.")
 	opt.flags.StringVar(&opt.ObjectsDumpInterval, "objects-dump-interval", "", "The time interval to dump running objects config, for example: 30m")
+	opt.flags.BoolVar(&opt.AutoMigrate, "auto-migrate", true, "Flag to migrate the object specs stored by older versions to the current schema at startup.")
+	opt.flags.IntVar(&opt.ObjectHistoryLimit, "object-history-limit", 20, "Number of versions to keep for every object, 0 disables the history.")
 	opt.flags.BoolVar(&opt.DisableAccessLog, "disable-access", false, "Flag to set whether to disable access logs")
 	opt.flags.StringVar(&opt.HomeDir, "home-dir", "./", "Path to the home directory.")
 	opt.flags.StringVar(&opt.DataDir, "data-dir", "data", "Path to the data directory.")
@@ -160,11 +283,27 @@ func New() *Options {
 
 	opt.flags.IntVar(&opt.StatusUpdateMaxBatchSize, "status-update-max-batch-size", 20, "Number of object statuses to update at maximum in one transaction.")
 
+	addSnapshotVars(opt)
+
 	_ = opt.viper.BindPFlags(opt.flags)
 
 	return opt
 }
 
+// addSnapshotVars introduces snapshot arguments.
+func addSnapshotVars(opt *Options) {
+	opt.flags.StringVar(&opt.Snapshot.Dir, "snapshot-dir", "snapshots", "Path to the directory storing the snapshots of the cluster data.")
+	opt.flags.StringVar(&opt.Snapshot.Interval, "snapshot-interval", "", "The time interval to take snapshots of the cluster data, for example: 1h. Scheduled snapshots are disabled if it is empty.")
+	opt.flags.IntVar(&opt.Snapshot.MaxBackups, "snapshot-max-backups", 10, "Number of snapshots to keep at maximum, 0 means unlimited.")
+	opt.flags.StringVar(&opt.Snapshot.S3Endpoint, "snapshot-s3-endpoint", "", "Endpoint of the S3 compatible object storage storing the snapshots, the AWS S3 endpoint of the region by default.")
+	opt.flags.StringVar(&opt.Snapshot.S3Region, "snapshot-s3-region", "", "Region of the S3 bucket, us-east-1 by default.")
+	opt.flags.StringVar(&opt.Snapshot.S3Bucket, "snapshot-s3-bucket", "", "S3 bucket storing the snapshots, the snapshots are stored in snapshot-dir if it is empty.")
+	opt.flags.StringVar(&opt.Snapshot.S3Prefix, "snapshot-s3-prefix", "", "Prefix of the object keys of the snapshots in the S3 bucket.")
+	opt.flags.StringVar(&opt.Snapshot.S3AccessKeyID, "snapshot-s3-access-key-id", "", "Access key ID of the S3 bucket, AWS_ACCESS_KEY_ID is used if it is empty.")
+	opt.flags.StringVar(&opt.Snapshot.S3SecretAccessKey, "snapshot-s3-secret-access-key", "", "Secret access key of the S3 bucket, AWS_SECRET_ACCESS_KEY is used if it is empty.")
+	opt.flags.BoolVar(&opt.Snapshot.S3ForcePathStyle, "snapshot-s3-force-path-style", false, "Flag to use the path style URLs of the S3 bucket, which is required by most S3 compatible object storages.")
+}
+
 // YAML returns yaml string of option, need to be called after calling Parse.
 func (opt *Options) YAML() string {
 	return opt.yamlStr
@@ -244,7 +383,7 @@ func (opt *Options) Parse() error {
 	if opt.UseStandaloneEtcd {
 		opt.ClusterRole = "secondary" // when using external standalone etcd, the cluster role cannot be "primary"
 	}
-	if opt.ClusterRole == "primary" && len(opt.Cluster.InitialCluster) == 0 {
+	if opt.ClusterRole == "primary" && len(opt.Cluster.InitialCluster) == 0 && opt.Cluster.Discovery.Type == "" {
 		opt.Cluster.InitialCluster = map[string]string{opt.Name: opt.Cluster.InitialAdvertisePeerURLs[0]}
 	}
 
@@ -301,16 +440,23 @@ func (opt *Options) validate() error {
 		if opt.ForceNewCluster {
 			return fmt.Errorf("secondary got force-new-cluster")
 		}
-		if len(opt.Cluster.PrimaryListenPeerURLs) == 0 {
+		if len(opt.GetEtcdEndpoints()) == 0 && opt.Cluster.Discovery.Type == "" {
 			return fmt.Errorf("secondary got empty cluster.primary-listen-peer-urls")
 		}
-	case "primary":
-		argumentsToValidate := map[string][]string{
-			"listen-client-urls":          opt.Cluster.ListenClientURLs,
-			"listen-peer-urls":            opt.Cluster.ListenPeerURLs,
-			"advertise-client-urls":       opt.Cluster.AdvertiseClientURLs,
-			"initial-advertise-peer-urls": opt.Cluster.InitialAdvertisePeerURLs,
+	case "learner":
+		if opt.ForceNewCluster {
+			return fmt.Errorf("learner got force-new-cluster")
+		}
+		if len(opt.Cluster.PrimaryListenPeerURLs) == 0 && opt.Cluster.Discovery.Type == "" {
+			return fmt.Errorf("learner got empty cluster.primary-listen-peer-urls")
 		}
+		if _, err := ParseURLs(opt.Cluster.PrimaryListenPeerURLs); err != nil {
+			return fmt.Errorf("invalid primary-listen-peer-urls: %v", err)
+		}
+		if err := opt.validateEtcdServerURLs(); err != nil {
+			return err
+		}
+	case "primary":
 		initialClusterUrls := make([]string, 0, len(opt.Cluster.InitialCluster))
 		for _, value := range opt.Cluster.InitialCluster {
 			initialClusterUrls = append(initialClusterUrls, value)
@@ -318,16 +464,20 @@ func (opt *Options) validate() error {
 		if _, err := ParseURLs(initialClusterUrls); err != nil {
 			return fmt.Errorf("invalid initial-cluster: %v", err)
 		}
-		for arg, urls := range argumentsToValidate {
-			if len(urls) == 0 {
-				return fmt.Errorf("empty %s", arg)
-			}
-			if _, err := ParseURLs(urls); err != nil {
-				return fmt.Errorf("invalid %s: %v", arg, err)
-			}
+		if err := opt.validateEtcdServerURLs(); err != nil {
+			return err
 		}
 	default:
-		return fmt.Errorf("invalid cluster-role: supported roles are primary/secondary")
+		return fmt.Errorf("invalid cluster-role: supported roles are primary/secondary/learner")
+	}
+	if err := opt.validateEtcdSecurity(); err != nil {
+		return err
+	}
+	if err := opt.validateDiscovery(); err != nil {
+		return err
+	}
+	if err := opt.validatePromotion(); err != nil {
+		return err
 	}
 
 	_, err := time.ParseDuration(opt.ClusterRequestTimeout)
@@ -351,6 +501,10 @@ func (opt *Options) validate() error {
 		return fmt.Errorf("empty cert file or key file")
 	}
 
+	if err := opt.validateSnapshot(); err != nil {
+		return err
+	}
+
 	// profile: nothing to validate
 
 	// meta
@@ -365,6 +519,195 @@ func (opt *Options) validate() error {
 	return common.ValidateName(opt.Name)
 }
 
+func (opt *Options) validateSnapshot() error {
+	s := &opt.Snapshot
+	if s.Interval != "" {
+		d, err := time.ParseDuration(s.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid snapshot.interval: %v", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid snapshot.interval: must be positive")
+		}
+	}
+	if s.MaxBackups < 0 {
+		return fmt.Errorf("invalid snapshot.max-backups: must not be negative")
+	}
+	if s.S3Bucket == "" {
+		if s.Dir == "" {
+			return fmt.Errorf("empty snapshot.dir")
+		}
+		return nil
+	}
+	if s.S3Endpoint != "" {
+		if _, err := ParseURLs([]string{s.S3Endpoint}); err != nil {
+			return fmt.Errorf("invalid snapshot.s3-endpoint: %v", err)
+		}
+	}
+	if (s.S3AccessKeyID == "") != (s.S3SecretAccessKey == "") {
+		return fmt.Errorf("snapshot.s3-access-key-id and snapshot.s3-secret-access-key must be specified together")
+	}
+	return nil
+}
+
+func (opt *Options) validateDiscovery() error {
+	d := &opt.Cluster.Discovery
+	if d.Type == "" {
+		return nil
+	}
+	if opt.UseStandaloneEtcd && len(opt.Cluster.EtcdEndpoints) > 0 {
+		return fmt.Errorf("cluster.discovery conflicts with cluster.etcd-endpoints")
+	}
+
+	switch d.Type {
+	case "dns-srv":
+		if d.SRVDomain == "" {
+			return fmt.Errorf("discovery type dns-srv requires discovery.srv-domain")
+		}
+	case "ec2", "gce":
+		if len(d.Tags) == 0 {
+			return fmt.Errorf("discovery type %s requires discovery.tags", d.Type)
+		}
+	case "kubernetes":
+		if d.KubernetesService == "" {
+			return fmt.Errorf("discovery type kubernetes requires discovery.kubernetes-service")
+		}
+	default:
+		return fmt.Errorf("invalid discovery.type: supported types are dns-srv/ec2/gce/kubernetes")
+	}
+
+	if d.Type != "dns-srv" && (d.PeerPort <= 0 || d.PeerPort > 65535) {
+		return fmt.Errorf("invalid discovery.peer-port: %d", d.PeerPort)
+	}
+	// primary members must discover all of them before forming a new
+	// cluster, otherwise they may form different clusters.
+	if opt.ClusterRole == "primary" && d.Type != "dns-srv" && d.ExpectedSize <= 0 {
+		return fmt.Errorf("discovery type %s requires discovery.expected-size for primary members", d.Type)
+	}
+	if d.ExpectedSize < 0 {
+		return fmt.Errorf("invalid discovery.expected-size: must not be negative")
+	}
+	timeout, err := time.ParseDuration(d.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid discovery.timeout: %v", err)
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("invalid discovery.timeout: must be positive")
+	}
+	return nil
+}
+
+func (opt *Options) validatePromotion() error {
+	p := &opt.Cluster.Promotion
+	switch p.Policy {
+	case "", "manual":
+	case "auto":
+		if opt.UseStandaloneEtcd {
+			return fmt.Errorf("promotion-policy auto conflicts with use-standalone-etcd")
+		}
+	default:
+		return fmt.Errorf("invalid promotion-policy: supported policies are manual/auto")
+	}
+
+	if p.Voters < 0 {
+		return fmt.Errorf("invalid promotion-voters: must not be negative")
+	}
+	timeout, err := time.ParseDuration(p.LostTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid promotion-lost-timeout: %v", err)
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("invalid promotion-lost-timeout: must be positive")
+	}
+	return nil
+}
+
+// validateEtcdServerURLs validates the URLs of the embedded etcd server.
+func (opt *Options) validateEtcdServerURLs() error {
+	argumentsToValidate := map[string][]string{
+		"listen-client-urls":          opt.Cluster.ListenClientURLs,
+		"listen-peer-urls":            opt.Cluster.ListenPeerURLs,
+		"advertise-client-urls":       opt.Cluster.AdvertiseClientURLs,
+		"initial-advertise-peer-urls": opt.Cluster.InitialAdvertisePeerURLs,
+	}
+	for arg, urls := range argumentsToValidate {
+		if len(urls) == 0 {
+			return fmt.Errorf("empty %s", arg)
+		}
+		if _, err := ParseURLs(urls); err != nil {
+			return fmt.Errorf("invalid %s: %v", arg, err)
+		}
+	}
+	return nil
+}
+
+func (opt *Options) validateEtcdSecurity() error {
+	c := &opt.Cluster
+	if !opt.UseStandaloneEtcd && len(c.EtcdEndpoints) > 0 {
+		return fmt.Errorf("cluster.etcd-endpoints requires use-standalone-etcd")
+	}
+	if _, err := ParseURLs(c.EtcdEndpoints); err != nil {
+		return fmt.Errorf("invalid etcd-endpoints: %v", err)
+	}
+
+	pairs := [][3]string{
+		{"etcd", c.EtcdCertFile, c.EtcdKeyFile},
+		{"client", c.ClientCertFile, c.ClientKeyFile},
+		{"peer", c.PeerCertFile, c.PeerKeyFile},
+	}
+	for _, p := range pairs {
+		if (p[1] == "") != (p[2] == "") {
+			return fmt.Errorf("%s-cert-file and %s-key-file must be specified together", p[0], p[0])
+		}
+	}
+	if c.ClientCertAuth && c.ClientTrustedCAFile == "" {
+		return fmt.Errorf("client-cert-auth requires client-trusted-ca-file")
+	}
+	if c.PeerClientCertAuth && c.PeerTrustedCAFile == "" {
+		return fmt.Errorf("peer-client-cert-auth requires peer-trusted-ca-file")
+	}
+
+	if c.EtcdUsername == "" && c.EtcdPassword != "" {
+		return fmt.Errorf("etcd-password requires etcd-username")
+	}
+
+	if !opt.RunEtcdServer() {
+		return nil
+	}
+
+	// the URLs must be https once the TLS is enabled, otherwise the
+	// traffic falls back to plaintext silently.
+	if c.ClientCertFile != "" {
+		if err := requireHTTPS("client", c.ListenClientURLs, c.AdvertiseClientURLs); err != nil {
+			return err
+		}
+	}
+	if c.PeerCertFile != "" {
+		initialCluster := make([]string, 0, len(c.InitialCluster))
+		for _, u := range c.InitialCluster {
+			initialCluster = append(initialCluster, u)
+		}
+		if err := requireHTTPS("peer", c.ListenPeerURLs, c.InitialAdvertisePeerURLs, initialCluster); err != nil {
+			return err
+		}
+	}
+	if opt.ClusterRole == "primary" && c.EtcdUsername != "" && c.EtcdUsername != EtcdRootUser {
+		return fmt.Errorf("etcd-username of primary members must be %s", EtcdRootUser)
+	}
+	return nil
+}
+
+func requireHTTPS(kind string, urlLists ...[]string) error {
+	for _, urls := range urlLists {
+		for _, u := range urls {
+			if !strings.HasPrefix(u, "https://") {
+				return fmt.Errorf("%s url %s must be https when %s-cert-file is specified", kind, u, kind)
+			}
+		}
+	}
+	return nil
+}
+
 func (opt *Options) prepare() error {
 	abs, isAbs, clean, join := filepath.Abs, filepath.IsAbs, filepath.Clean, filepath.Join
 	if isAbs(opt.HomeDir) {
@@ -388,6 +731,9 @@ func (opt *Options) prepare() error {
 	if opt.LogDir != "" {
 		table = append(table, dirItem{dir: opt.LogDir, absDir: &opt.AbsLogDir})
 	}
+	if opt.Snapshot.Dir != "" {
+		table = append(table, dirItem{dir: opt.Snapshot.Dir, absDir: &opt.AbsSnapshotDir})
+	}
 	for _, di := range table {
 		if di.dir == "" {
 			continue
@@ -412,9 +758,9 @@ func (opt *Options) InitialClusterToString() string {
 }
 
 // GetPeerURLs returns URLs listed in cluster.initial-cluster for primary (a.k.a writer) and
-// for secondary (a.k.a reader) the ones listed in cluster.primary-listen-peer-url.
+// for secondary (a.k.a reader) and learner the ones listed in cluster.primary-listen-peer-url.
 func (opt *Options) GetPeerURLs() []string {
-	if opt.ClusterRole == "secondary" {
+	if opt.ClusterRole != "primary" {
 		return opt.Cluster.PrimaryListenPeerURLs
 	}
 	peerURLs := make([]string, 0)
@@ -424,6 +770,47 @@ func (opt *Options) GetPeerURLs() []string {
 	return peerURLs
 }
 
+// GetEtcdEndpoints returns the endpoints the etcd client connects to, they
+// are the ones listed in cluster.etcd-endpoints for the members using
+// standalone etcd if defined, otherwise the peer URLs.
+func (opt *Options) GetEtcdEndpoints() []string {
+	if opt.UseStandaloneEtcd && len(opt.Cluster.EtcdEndpoints) > 0 {
+		return opt.Cluster.EtcdEndpoints
+	}
+	return opt.GetPeerURLs()
+}
+
+// GetEtcdClientTLS returns the certificate, private key and CA files of the
+// etcd client, primary and learner members use the ones of the peer traffic
+// of the embedded etcd if the client ones are not defined, as the client
+// connects to the peer URLs.
+func (opt *Options) GetEtcdClientTLS() (certFile, keyFile, caFile string) {
+	c := &opt.Cluster
+	certFile, keyFile, caFile = c.EtcdCertFile, c.EtcdKeyFile, c.EtcdCAFile
+	if !opt.RunEtcdServer() {
+		return
+	}
+	if certFile == "" {
+		certFile, keyFile = c.PeerCertFile, c.PeerKeyFile
+	}
+	if caFile == "" {
+		caFile = c.PeerTrustedCAFile
+	}
+	return
+}
+
+// RunEtcdServer returns true if the member runs an embedded etcd server,
+// which are the primary members and the learner members.
+func (opt *Options) RunEtcdServer() bool {
+	return opt.ClusterRole == "primary" || opt.ClusterRole == "learner"
+}
+
+// UseEtcdTLS returns true if the etcd client connects to etcd with TLS.
+func (opt *Options) UseEtcdTLS() bool {
+	certFile, _, caFile := opt.GetEtcdClientTLS()
+	return certFile != "" || caFile != ""
+}
+
 // GetFirstAdvertiseClientURL returns the first advertised client url.
 func (opt *Options) GetFirstAdvertiseClientURL() (string, error) {
 	if len(opt.Cluster.AdvertiseClientURLs) == 0 {
@@ -133,6 +133,234 @@ func TestOption(t *testing.T) {
 			assert.Error(options.validate())
 		}()
 
+		// learner
+		func() {
+			role := options.ClusterRole
+			force := options.ForceNewCluster
+			cluster := options.Cluster
+			defer func() {
+				options.ClusterRole = role
+				options.ForceNewCluster = force
+				options.Cluster = cluster
+			}()
+
+			options.ClusterRole = "learner"
+			options.Cluster.InitialCluster = nil
+			options.Cluster.PrimaryListenPeerURLs = []string{"http://10.0.0.1:2380"}
+			assert.Nil(options.validate())
+			assert.True(options.RunEtcdServer())
+			assert.Equal([]string{"http://10.0.0.1:2380"}, options.GetPeerURLs())
+
+			options.ForceNewCluster = true
+			assert.Error(options.validate())
+			options.ForceNewCluster = false
+
+			options.Cluster.ListenPeerURLs = nil
+			assert.Error(options.validate())
+			options.Cluster.ListenPeerURLs = cluster.ListenPeerURLs
+
+			options.Cluster.PrimaryListenPeerURLs = nil
+			assert.Error(options.validate())
+		}()
+
+		// external etcd
+		func() {
+			role := options.ClusterRole
+			standalone := options.UseStandaloneEtcd
+			cluster := options.Cluster
+			defer func() {
+				options.ClusterRole = role
+				options.UseStandaloneEtcd = standalone
+				options.Cluster = cluster
+			}()
+
+			options.Cluster.EtcdEndpoints = []string{"https://10.0.0.1:2379"}
+			assert.Error(options.validate())
+
+			options.ClusterRole = "secondary"
+			options.UseStandaloneEtcd = true
+			options.Cluster.PrimaryListenPeerURLs = nil
+			assert.Nil(options.validate())
+			assert.Equal([]string{"https://10.0.0.1:2379"}, options.GetEtcdEndpoints())
+			assert.False(options.UseEtcdTLS())
+
+			options.Cluster.EtcdCAFile = "ca.pem"
+			assert.True(options.UseEtcdTLS())
+			options.Cluster.EtcdCertFile = "cert.pem"
+			assert.Error(options.validate())
+			options.Cluster.EtcdKeyFile = "key.pem"
+			assert.Nil(options.validate())
+
+			options.Cluster.EtcdPassword = "password"
+			assert.Error(options.validate())
+			options.Cluster.EtcdUsername = "root"
+			assert.Nil(options.validate())
+
+			options.Cluster.EtcdEndpoints = []string{"://10.0.0.1"}
+			assert.Error(options.validate())
+		}()
+
+		// embedded etcd TLS and authentication
+		func() {
+			role := options.ClusterRole
+			cluster := options.Cluster
+			defer func() {
+				options.ClusterRole = role
+				options.Cluster = cluster
+			}()
+
+			options.ClusterRole = "primary"
+			options.Cluster.ListenClientURLs = []string{"https://localhost:2379"}
+			options.Cluster.AdvertiseClientURLs = []string{"https://localhost:2379"}
+			options.Cluster.ListenPeerURLs = []string{"https://localhost:2380"}
+			options.Cluster.InitialAdvertisePeerURLs = []string{"https://localhost:2380"}
+			options.Cluster.InitialCluster = map[string]string{options.Name: "https://localhost:2380"}
+			assert.Nil(options.validate())
+
+			options.Cluster.ClientCertFile = "client-cert.pem"
+			assert.Error(options.validate())
+			options.Cluster.ClientKeyFile = "client-key.pem"
+			assert.Nil(options.validate())
+			options.Cluster.ClientCertAuth = true
+			assert.Error(options.validate())
+			options.Cluster.ClientTrustedCAFile = "client-ca.pem"
+			assert.Nil(options.validate())
+
+			options.Cluster.PeerCertFile = "peer-cert.pem"
+			options.Cluster.PeerKeyFile = "peer-key.pem"
+			options.Cluster.PeerTrustedCAFile = "peer-ca.pem"
+			options.Cluster.PeerClientCertAuth = true
+			assert.Nil(options.validate())
+
+			// the client falls back to the TLS of the peer traffic.
+			certFile, keyFile, caFile := options.GetEtcdClientTLS()
+			assert.Equal("peer-cert.pem", certFile)
+			assert.Equal("peer-key.pem", keyFile)
+			assert.Equal("peer-ca.pem", caFile)
+			assert.True(options.UseEtcdTLS())
+
+			options.Cluster.InitialCluster = map[string]string{options.Name: "http://localhost:2380"}
+			assert.Error(options.validate())
+			options.Cluster.InitialCluster = map[string]string{options.Name: "https://localhost:2380"}
+			options.Cluster.AdvertiseClientURLs = []string{"http://localhost:2379"}
+			assert.Error(options.validate())
+			options.Cluster.AdvertiseClientURLs = []string{"https://localhost:2379"}
+
+			options.Cluster.EtcdUsername = "admin"
+			assert.Error(options.validate())
+			options.Cluster.EtcdUsername = EtcdRootUser
+			options.Cluster.EtcdPassword = "password"
+			assert.Nil(options.validate())
+		}()
+
+		// snapshot
+		func() {
+			snapshot := options.Snapshot
+			defer func() {
+				options.Snapshot = snapshot
+			}()
+
+			options.Snapshot.Interval = "1h"
+			assert.Nil(options.validate())
+			options.Snapshot.Interval = "-1h"
+			assert.Error(options.validate())
+			options.Snapshot.Interval = "invalid"
+			assert.Error(options.validate())
+			options.Snapshot.Interval = ""
+
+			options.Snapshot.MaxBackups = -1
+			assert.Error(options.validate())
+			options.Snapshot.MaxBackups = 0
+
+			options.Snapshot.Dir = ""
+			assert.Error(options.validate())
+			options.Snapshot.S3Bucket = "backup"
+			assert.Nil(options.validate())
+			options.Snapshot.S3AccessKeyID = "key-id"
+			assert.Error(options.validate())
+			options.Snapshot.S3SecretAccessKey = "secret"
+			assert.Nil(options.validate())
+			options.Snapshot.S3Endpoint = "://minio"
+			assert.Error(options.validate())
+		}()
+
+		// discovery
+		func() {
+			role := options.ClusterRole
+			standalone := options.UseStandaloneEtcd
+			cluster := options.Cluster
+			defer func() {
+				options.ClusterRole = role
+				options.UseStandaloneEtcd = standalone
+				options.Cluster = cluster
+			}()
+
+			options.ClusterRole = "primary"
+			options.Cluster.Discovery.Type = "not-exist"
+			assert.Error(options.validate())
+
+			options.Cluster.Discovery.Type = "dns-srv"
+			assert.Error(options.validate())
+			options.Cluster.Discovery.SRVDomain = "example.com"
+			assert.Nil(options.validate())
+
+			options.Cluster.Discovery.Type = "ec2"
+			assert.Error(options.validate())
+			options.Cluster.Discovery.Tags = map[string]string{"cluster": "easegress"}
+			assert.Error(options.validate())
+			options.Cluster.Discovery.ExpectedSize = 3
+			assert.Nil(options.validate())
+			options.Cluster.Discovery.PeerPort = 0
+			assert.Error(options.validate())
+			options.Cluster.Discovery.PeerPort = 2380
+
+			options.Cluster.Discovery.Type = "kubernetes"
+			assert.Error(options.validate())
+			options.Cluster.Discovery.KubernetesService = "easegress"
+			assert.Nil(options.validate())
+
+			options.Cluster.Discovery.Timeout = "0s"
+			assert.Error(options.validate())
+			options.Cluster.Discovery.Timeout = "1m"
+
+			// secondary members discover the primary listen peer urls.
+			options.ClusterRole = "secondary"
+			options.Cluster.PrimaryListenPeerURLs = nil
+			options.Cluster.Discovery.ExpectedSize = 0
+			assert.Nil(options.validate())
+
+			options.UseStandaloneEtcd = true
+			options.Cluster.EtcdEndpoints = []string{"http://10.0.0.1:2379"}
+			assert.Error(options.validate())
+		}()
+
+		// promotion
+		func() {
+			standalone := options.UseStandaloneEtcd
+			promotion := options.Cluster.Promotion
+			defer func() {
+				options.UseStandaloneEtcd = standalone
+				options.Cluster.Promotion = promotion
+			}()
+
+			options.Cluster.Promotion.Policy = "auto"
+			assert.Nil(options.validate())
+			options.Cluster.Promotion.Voters = -1
+			assert.Error(options.validate())
+			options.Cluster.Promotion.Voters = 3
+			options.Cluster.Promotion.LostTimeout = "0s"
+			assert.Error(options.validate())
+			options.Cluster.Promotion.LostTimeout = "30s"
+			assert.Nil(options.validate())
+
+			options.UseStandaloneEtcd = true
+			assert.Error(options.validate())
+			options.UseStandaloneEtcd = false
+
+			options.Cluster.Promotion.Policy = "not-exist"
+			assert.Error(options.validate())
+		}()
+
 		// invalid cluster role
 		func() {
 			role := options.ClusterRole
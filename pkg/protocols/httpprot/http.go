@@ -31,6 +31,15 @@ import (
 // DefaultMaxPayloadSize is the default max allowed payload size.
 const DefaultMaxPayloadSize = 4 * 1024 * 1024
 
+const (
+	// BodyModeBuffer reads the whole body into memory before it is
+	// processed, the size of the body is limited by the max body size.
+	BodyModeBuffer = "buffer"
+	// BodyModeStream never reads the body into memory, the body is
+	// streamed to its destination, and the max body size is optional.
+	BodyModeStream = "stream"
+)
+
 func init() {
 	protocols.Register("http", &Protocol{})
 }
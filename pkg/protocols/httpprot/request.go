@@ -143,6 +143,29 @@ func (r *Request) FetchPayload(maxPayloadSize int64) error {
 	return err
 }
 
+// StreamPayload initializes the payload as a stream of the body of the
+// underlying http.Request, which is never buffered in memory.
+//
+// if maxPayloadSize is a positive number, reading the stream fails with
+// ErrRequestEntityTooLarge once more data is received, and ErrRequestEntityTooLarge
+// is returned directly if the content length is already larger.
+func (r *Request) StreamPayload(maxPayloadSize int64) error {
+	stdr := r.Request
+	if maxPayloadSize > 0 && stdr.ContentLength > maxPayloadSize {
+		return ErrRequestEntityTooLarge
+	}
+
+	// For an HTTP request, it is the caller's responsibility to close
+	// its body, wrap it with io.NopCloser, so httpprot.Request will
+	// never close it.
+	body := io.Reader(io.NopCloser(stdr.Body))
+	if maxPayloadSize > 0 {
+		body = readers.NewLimitReader(body, maxPayloadSize, ErrRequestEntityTooLarge)
+	}
+	r.SetPayload(body)
+	return nil
+}
+
 // SetPayload set the payload of the request to payload. The payload
 // could be a string, a byte slice, or an io.Reader, and if it is an
 // io.Reader, it will be treated as a stream, if this is not desired,
@@ -335,6 +358,11 @@ func (r *Request) Context() context.Context {
 	return r.Std().Context()
 }
 
+// SetContext replaces the context of the request.
+func (r *Request) SetContext(ctx context.Context) {
+	r.Request = r.Std().WithContext(ctx)
+}
+
 // SetMethod sets the request method.
 func (r *Request) SetMethod(method string) {
 	r.Std().Method = method
@@ -209,6 +209,28 @@ func TestRequest2(t *testing.T) {
 	}
 }
 
+func TestRequestStreamPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	req := getRequest(t, http.MethodPost, "http://127.0.0.1:8888", strings.NewReader("123"))
+	assert.Nil(req.StreamPayload(0))
+	assert.True(req.IsStream())
+	data, err := io.ReadAll(req.GetPayload())
+	assert.Nil(err)
+	assert.Equal("123", string(data))
+
+	// the content length is larger than the limit.
+	req = getRequest(t, http.MethodPost, "http://127.0.0.1:8888", strings.NewReader("123"))
+	assert.Equal(ErrRequestEntityTooLarge, req.StreamPayload(2))
+
+	// the actual body is larger than the limit.
+	req = getRequest(t, http.MethodPost, "http://127.0.0.1:8888", strings.NewReader("123123"))
+	req.Std().ContentLength = -1
+	assert.Nil(req.StreamPayload(4))
+	_, err = io.ReadAll(req.GetPayload())
+	assert.Equal(ErrRequestEntityTooLarge, err)
+}
+
 func TestBuilderRequest(t *testing.T) {
 	assert := assert.New(t)
 
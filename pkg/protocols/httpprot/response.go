@@ -21,6 +21,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
 
@@ -65,6 +66,14 @@ func NewResponse(stdr *http.Response) (*Response, error) {
 	return &Response{Response: stdr}, nil
 }
 
+// IsEventStream returns whether the response is a stream of Server-Sent
+// Events, whose MIME type is defined in
+// https://www.w3.org/TR/eventsource/#text-event-stream.
+func (r *Response) IsEventStream() bool {
+	ct, _, err := mime.ParseMediaType(r.HTTPHeader().Get("Content-Type"))
+	return err == nil && ct == "text/event-stream"
+}
+
 // IsStream returns whether the payload of the response is a stream.
 func (r *Response) IsStream() bool {
 	return r.stream != nil
@@ -131,6 +140,26 @@ func (r *Response) FetchPayload(maxPayloadSize int64) error {
 	return err
 }
 
+// StreamPayload initializes the payload as a stream of the body of the
+// underlying http.Response, which is never buffered in memory.
+//
+// if maxPayloadSize is a positive number, reading the stream fails with
+// ErrResponseEntityTooLarge once more data is received, and ErrResponseEntityTooLarge
+// is returned directly if the content length is already larger.
+func (r *Response) StreamPayload(maxPayloadSize int64) error {
+	stdr := r.Response
+	if maxPayloadSize > 0 && stdr.ContentLength > maxPayloadSize {
+		return ErrResponseEntityTooLarge
+	}
+
+	body := io.Reader(stdr.Body)
+	if maxPayloadSize > 0 {
+		body = readers.NewLimitReader(body, maxPayloadSize, ErrResponseEntityTooLarge)
+	}
+	r.SetPayload(body)
+	return nil
+}
+
 // SetPayload set the payload of the response to payload. The payload
 // could be a string, a byte slice, or an io.Reader, and if it is an
 // io.Reader, it will be treated as a stream, if this is not desired,
@@ -194,6 +194,38 @@ func TestResponse2(t *testing.T) {
 	}
 }
 
+func TestResponseStreamPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	newResponse := func(body string, contentLength int64) *Response {
+		resp, err := NewResponse(&http.Response{
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: contentLength,
+		})
+		assert.Nil(err)
+		return resp
+	}
+
+	resp := newResponse("123", 3)
+	assert.Nil(resp.StreamPayload(-1))
+	assert.True(resp.IsStream())
+	data, err := io.ReadAll(resp.GetPayload())
+	assert.Nil(err)
+	assert.Equal("123", string(data))
+
+	// the content length is larger than the limit.
+	resp = newResponse("123", 3)
+	assert.Equal(ErrResponseEntityTooLarge, resp.StreamPayload(2))
+
+	// the actual body is larger than the limit.
+	resp = newResponse("123123", -1)
+	assert.Nil(resp.StreamPayload(4))
+	data, err = io.ReadAll(resp.GetPayload())
+	assert.Equal(ErrResponseEntityTooLarge, err)
+	assert.Equal("1231", string(data))
+	resp.Close()
+}
+
 func TestBuilderResponse(t *testing.T) {
 	assert := assert.New(t)
 	{
@@ -20,27 +20,52 @@ package registry
 
 import (
 	// Filters
+	_ "github.com/megaease/easegress/v2/pkg/filters/bodytransformer"
 	_ "github.com/megaease/easegress/v2/pkg/filters/builder"
 	_ "github.com/megaease/easegress/v2/pkg/filters/certextractor"
 	_ "github.com/megaease/easegress/v2/pkg/filters/connectcontrol"
 	_ "github.com/megaease/easegress/v2/pkg/filters/corsadaptor"
+	_ "github.com/megaease/easegress/v2/pkg/filters/csrfprotector"
+	_ "github.com/megaease/easegress/v2/pkg/filters/datamasker"
+	_ "github.com/megaease/easegress/v2/pkg/filters/experimenter"
+	_ "github.com/megaease/easegress/v2/pkg/filters/extauthz"
 	_ "github.com/megaease/easegress/v2/pkg/filters/fallback"
+	_ "github.com/megaease/easegress/v2/pkg/filters/faultinjector"
+	_ "github.com/megaease/easegress/v2/pkg/filters/geoip"
+	_ "github.com/megaease/easegress/v2/pkg/filters/grpctranscoder"
 	_ "github.com/megaease/easegress/v2/pkg/filters/headerlookup"
+	_ "github.com/megaease/easegress/v2/pkg/filters/headerrewriter"
 	_ "github.com/megaease/easegress/v2/pkg/filters/headertojson"
+	_ "github.com/megaease/easegress/v2/pkg/filters/ipfilter"
 	_ "github.com/megaease/easegress/v2/pkg/filters/kafka"
 	_ "github.com/megaease/easegress/v2/pkg/filters/kafkabackend"
+	_ "github.com/megaease/easegress/v2/pkg/filters/loadshedder"
+	_ "github.com/megaease/easegress/v2/pkg/filters/luascript"
 	_ "github.com/megaease/easegress/v2/pkg/filters/meshadaptor"
 	_ "github.com/megaease/easegress/v2/pkg/filters/mock"
 	_ "github.com/megaease/easegress/v2/pkg/filters/mqttclientauth"
+	_ "github.com/megaease/easegress/v2/pkg/filters/mqttpublisher"
 	_ "github.com/megaease/easegress/v2/pkg/filters/oidcadaptor"
 	_ "github.com/megaease/easegress/v2/pkg/filters/opafilter"
+	_ "github.com/megaease/easegress/v2/pkg/filters/openapivalidator"
 	_ "github.com/megaease/easegress/v2/pkg/filters/proxies/grpcproxy"
 	_ "github.com/megaease/easegress/v2/pkg/filters/proxies/httpproxy"
 	_ "github.com/megaease/easegress/v2/pkg/filters/ratelimiter"
 	_ "github.com/megaease/easegress/v2/pkg/filters/redirector"
 	_ "github.com/megaease/easegress/v2/pkg/filters/remotefilter"
+	_ "github.com/megaease/easegress/v2/pkg/filters/requestbodylimiter"
+	_ "github.com/megaease/easegress/v2/pkg/filters/requestdecompressor"
+	_ "github.com/megaease/easegress/v2/pkg/filters/requestdenier"
+	_ "github.com/megaease/easegress/v2/pkg/filters/requestmirror"
+	_ "github.com/megaease/easegress/v2/pkg/filters/requestrecorder"
+	_ "github.com/megaease/easegress/v2/pkg/filters/responsecache"
+	_ "github.com/megaease/easegress/v2/pkg/filters/responsecompressor"
+	_ "github.com/megaease/easegress/v2/pkg/filters/stickycanary"
+	_ "github.com/megaease/easegress/v2/pkg/filters/timeout"
 	_ "github.com/megaease/easegress/v2/pkg/filters/topicmapper"
+	_ "github.com/megaease/easegress/v2/pkg/filters/urlrewriter"
 	_ "github.com/megaease/easegress/v2/pkg/filters/validator"
+	_ "github.com/megaease/easegress/v2/pkg/filters/waf"
 	_ "github.com/megaease/easegress/v2/pkg/filters/wasmhost"
 
 	// Objects
@@ -61,7 +86,11 @@ import (
 	_ "github.com/megaease/easegress/v2/pkg/object/nacosserviceregistry"
 	_ "github.com/megaease/easegress/v2/pkg/object/pipeline"
 	_ "github.com/megaease/easegress/v2/pkg/object/rawconfigtrafficcontroller"
+	_ "github.com/megaease/easegress/v2/pkg/object/replicationcontroller"
+	_ "github.com/megaease/easegress/v2/pkg/object/tcpserver"
 	_ "github.com/megaease/easegress/v2/pkg/object/trafficcontroller"
+	_ "github.com/megaease/easegress/v2/pkg/object/udpserver"
+	_ "github.com/megaease/easegress/v2/pkg/object/webhooknotifier"
 	_ "github.com/megaease/easegress/v2/pkg/object/zookeeperserviceregistry"
 
 	// Routers
@@ -20,12 +20,19 @@ package resilience
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/megaease/easegress/v2/pkg/logger"
 	libcb "github.com/megaease/easegress/v2/pkg/util/circuitbreaker"
 )
 
+// maxCircuitBreakerEvents is the max number of state change events kept
+// in the status of a circuit breaker.
+const maxCircuitBreakerEvents = 20
+
 // CircuitBreakerKind is the kind of CircuitBreaker.
 var CircuitBreakerKind = &Kind{
 	Name: "CircuitBreaker",
@@ -70,12 +77,67 @@ type (
 		SlowCallDurationThreshold        string `json:"slowCallDurationThreshold,omitempty" jsonschema:"format=duration"`
 		MaxWaitDurationInHalfOpen        string `json:"maxWaitDurationInHalfOpenState,omitempty" jsonschema:"format=duration"`
 		WaitDurationInOpen               string `json:"waitDurationInOpenState,omitempty" jsonschema:"format=duration"`
+		PerBackend                       bool   `json:"perBackend,omitempty"`
+	}
+
+	// CircuitBreakerWrapper is the Wrapper created by CircuitBreakerPolicy.
+	CircuitBreakerWrapper interface {
+		Wrapper
+
+		// Status returns the statistics and the recent state change
+		// events of the circuit breakers.
+		Status() *CircuitBreakerStatus
+	}
+
+	// CircuitBreakerStatus is the status of a CircuitBreakerWrapper.
+	CircuitBreakerStatus struct {
+		Stats    *libcb.Stats            `json:"stats,omitempty"`
+		Backends map[string]*libcb.Stats `json:"backends,omitempty"`
+		Events   []*CircuitBreakerEvent  `json:"events,omitempty"`
+	}
+
+	// CircuitBreakerEvent is a state change event of a circuit breaker.
+	CircuitBreakerEvent struct {
+		Backend     string `json:"backend,omitempty"`
+		libcb.Event `json:",inline"`
 	}
 )
 
 // Validate validates the CircuitBreakPolicy.
 func (p *CircuitBreakerPolicy) Validate() error {
-	// TODO
+	switch strings.ToUpper(p.SlidingWindowType) {
+	case "COUNT_BASED", "TIME_BASED":
+	default:
+		return fmt.Errorf("unknown sliding window type %s", p.SlidingWindowType)
+	}
+
+	if p.FailureRateThreshold == 0 || p.FailureRateThreshold > 100 {
+		return fmt.Errorf("failureRateThreshold must be in [1, 100]")
+	}
+	if p.SlowCallRateThreshold == 0 || p.SlowCallRateThreshold > 100 {
+		return fmt.Errorf("slowCallRateThreshold must be in [1, 100]")
+	}
+	if p.SlidingWindowSize == 0 {
+		return fmt.Errorf("slidingWindowSize must be greater than 0")
+	}
+	if p.PermittedNumberOfCallsInHalfOpen == 0 {
+		return fmt.Errorf("permittedNumberOfCallsInHalfOpenState must be greater than 0")
+	}
+
+	durations := map[string]string{
+		"slowCallDurationThreshold":      p.SlowCallDurationThreshold,
+		"maxWaitDurationInHalfOpenState": p.MaxWaitDurationInHalfOpen,
+		"waitDurationInOpenState":        p.WaitDurationInOpen,
+	}
+	for name, d := range durations {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid %s %s: %v", name, d, err)
+		}
+	}
+
 	return nil
 }
 
@@ -110,36 +172,154 @@ func (p *CircuitBreakerPolicy) CreateWrapper() Wrapper {
 		policy.WaitDurationInOpen = time.Minute
 	}
 
-	return circuitBreakerWrapper{CircuitBreaker: libcb.New(policy)}
+	w := &circuitBreakerWrapper{name: p.Name(), policy: policy}
+	if p.PerBackend {
+		w.backends = map[string]*libcb.CircuitBreaker{}
+	} else {
+		w.shared = w.newCircuitBreaker("")
+	}
+	return w
+}
+
+type (
+	// circuitBreakerWrapper uses a shared circuit breaker for all calls,
+	// or a circuit breaker for each backend if backends is not nil.
+	circuitBreakerWrapper struct {
+		name   string
+		policy *libcb.Policy
+		shared *libcb.CircuitBreaker
+
+		lock     sync.Mutex
+		backends map[string]*libcb.CircuitBreaker
+		events   []*CircuitBreakerEvent
+		next     int
+	}
+
+	// backendGate is passed to the handler in the context, the handler
+	// calls EnterBackend with it after choosing a backend.
+	backendGate struct {
+		w *circuitBreakerWrapper
+	}
+
+	backendGateKey struct{}
+)
+
+var _ CircuitBreakerWrapper = (*circuitBreakerWrapper)(nil)
+
+func (w *circuitBreakerWrapper) newCircuitBreaker(backend string) *libcb.CircuitBreaker {
+	cb := libcb.New(w.policy)
+	cb.SetStateListener(func(event *libcb.Event) {
+		logger.Infof("circuit breaker %s (backend: %q) transited from %s to %s: %s",
+			w.name, backend, event.OldState, event.NewState, event.Reason)
+		w.addEvent(&CircuitBreakerEvent{Backend: backend, Event: *event})
+	})
+	return cb
 }
 
-type circuitBreakerWrapper struct {
-	*libcb.CircuitBreaker
+func (w *circuitBreakerWrapper) addEvent(event *CircuitBreakerEvent) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(w.events) < maxCircuitBreakerEvents {
+		w.events = append(w.events, event)
+		return
+	}
+	w.events[w.next] = event
+	w.next = (w.next + 1) % maxCircuitBreakerEvents
+}
+
+func (w *circuitBreakerWrapper) backend(name string) *libcb.CircuitBreaker {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	cb := w.backends[name]
+	if cb == nil {
+		cb = w.newCircuitBreaker(name)
+		w.backends[name] = cb
+	}
+	return cb
 }
 
 // Wrap wraps the handler function.
-func (w circuitBreakerWrapper) Wrap(handler HandlerFunc) HandlerFunc {
+func (w *circuitBreakerWrapper) Wrap(handler HandlerFunc) HandlerFunc {
+	if w.shared == nil {
+		return func(ctx context.Context) error {
+			return handler(context.WithValue(ctx, backendGateKey{}, &backendGate{w: w}))
+		}
+	}
 	return func(ctx context.Context) error {
-		var err error
+		return execute(ctx, w.shared, handler)
+	}
+}
 
-		permitted, stateID := w.AcquirePermission()
-		if !permitted {
-			return ErrShortCircuited
+// Status returns the status of the circuit breakers.
+func (w *circuitBreakerWrapper) Status() *CircuitBreakerStatus {
+	s := &CircuitBreakerStatus{}
+	if w.shared != nil {
+		s.Stats = w.shared.Stats()
+	}
+
+	w.lock.Lock()
+	backends := make(map[string]*libcb.CircuitBreaker, len(w.backends))
+	for name, cb := range w.backends {
+		backends[name] = cb
+	}
+	s.Events = append(s.Events, w.events[w.next:]...)
+	s.Events = append(s.Events, w.events[:w.next]...)
+	w.lock.Unlock()
+
+	if len(backends) > 0 {
+		s.Backends = make(map[string]*libcb.Stats, len(backends))
+		for name, cb := range backends {
+			s.Backends[name] = cb.Stats()
+		}
+	}
+	return s
+}
+
+func execute(ctx context.Context, cb *libcb.CircuitBreaker, handler HandlerFunc) error {
+	var err error
+
+	permitted, stateID := cb.AcquirePermission()
+	if !permitted {
+		return ErrShortCircuited
+	}
+
+	start := time.Now()
+
+	panicked := true
+	defer func() {
+		if panicked {
+			cb.RecordResult(stateID, true, time.Since(start))
 		}
+	}()
 
-		start := time.Now()
+	err = handler(ctx)
+	cb.RecordResult(stateID, err != nil, time.Since(start))
 
-		panicked := true
-		defer func() {
-			if panicked {
-				w.RecordResult(stateID, true, time.Since(start))
-			}
-		}()
+	panicked = false
+	return err
+}
 
-		err = handler(ctx)
-		w.RecordResult(stateID, err != nil, time.Since(start))
+// EnterBackend is called by a handler wrapped by a per-backend circuit
+// breaker after it chooses the backend, it returns ErrShortCircuited if
+// the circuit breaker of the backend rejects the call. Otherwise, the
+// handler must call the returned function with the result of the call.
+// It always succeeds if there is no per-backend circuit breaker.
+func EnterBackend(ctx context.Context, backend string) (func(err error), error) {
+	gate, _ := ctx.Value(backendGateKey{}).(*backendGate)
+	if gate == nil {
+		return func(error) {}, nil
+	}
 
-		panicked = false
-		return err
+	cb := gate.w.backend(backend)
+	permitted, stateID := cb.AcquirePermission()
+	if !permitted {
+		return nil, ErrShortCircuited
 	}
+
+	start := time.Now()
+	return func(err error) {
+		cb.RecordResult(stateID, err != nil, time.Since(start))
+	}, nil
 }
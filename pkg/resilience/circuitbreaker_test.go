@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resilience
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newCircuitBreakerPolicy(t *testing.T, yamlConfig string) *CircuitBreakerPolicy {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	p, err := NewPolicy(rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return p.(*CircuitBreakerPolicy)
+}
+
+func TestCircuitBreakerValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewPolicy(map[string]interface{}{
+		"kind":                  "CircuitBreaker",
+		"name":                  "cb",
+		"slowCallRateThreshold": 0,
+		"slidingWindowType":     "UNKNOWN",
+	})
+	assert.Error(err)
+
+	_, err = NewPolicy(map[string]interface{}{
+		"kind":                    "CircuitBreaker",
+		"name":                    "cb",
+		"waitDurationInOpenState": "abc",
+	})
+	assert.Error(err)
+
+	_, err = NewPolicy(map[string]interface{}{
+		"kind":                  "CircuitBreaker",
+		"name":                  "cb",
+		"slowCallRateThreshold": 50,
+		"perBackend":            true,
+	})
+	assert.NoError(err)
+}
+
+func TestCircuitBreakerPerBackend(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewPolicy(map[string]interface{}{
+		"kind":                                  "CircuitBreaker",
+		"name":                                  "cb",
+		"slidingWindowSize":                     4,
+		"minimumNumberOfCalls":                  4,
+		"permittedNumberOfCallsInHalfOpenState": 1,
+		"waitDurationInOpenState":               "1h",
+		"perBackend":                            true,
+	})
+	assert.NoError(err)
+
+	w := p.CreateWrapper().(CircuitBreakerWrapper)
+	errBackend := errors.New("backend error")
+
+	call := func(backend string, fail bool) error {
+		return w.Wrap(func(ctx context.Context) (err error) {
+			done, err := EnterBackend(ctx, backend)
+			if err != nil {
+				return err
+			}
+			defer func() { done(err) }()
+			if fail {
+				return errBackend
+			}
+			return nil
+		})(context.Background())
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(errBackend, call("a", true))
+		assert.NoError(call("b", false))
+	}
+
+	// only the circuit breaker of backend a is open.
+	assert.Equal(ErrShortCircuited, call("a", false))
+	assert.NoError(call("b", false))
+
+	// wait for the listener goroutine to record the event.
+	time.Sleep(10 * time.Millisecond)
+
+	s := w.Status()
+	assert.Nil(s.Stats)
+	assert.Equal("Open", s.Backends["a"].State)
+	assert.Equal(uint64(1), s.Backends["a"].NotPermittedCalls)
+	assert.Equal("Closed", s.Backends["b"].State)
+	assert.Len(s.Events, 1)
+	assert.Equal("a", s.Events[0].Backend)
+	assert.Equal("Open", s.Events[0].NewState)
+}
+
+func TestCircuitBreakerShared(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newCircuitBreakerPolicy(t, `
+kind: CircuitBreaker
+name: cb
+slidingWindowSize: 2
+minimumNumberOfCalls: 2
+`)
+	w := p.CreateWrapper().(CircuitBreakerWrapper)
+	handler := w.Wrap(func(ctx context.Context) error {
+		// there is no per-backend circuit breaker.
+		done, err := EnterBackend(ctx, "a")
+		assert.NoError(err)
+		done(nil)
+		return errors.New("error")
+	})
+
+	handler(context.Background())
+	handler(context.Background())
+	assert.Equal(ErrShortCircuited, handler(context.Background()))
+	assert.Equal("Open", w.Status().Stats.State)
+	assert.Nil(w.Status().Backends)
+}
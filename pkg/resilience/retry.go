@@ -19,7 +19,9 @@ package resilience
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 )
 
@@ -54,15 +56,113 @@ type (
 		waitDuration        time.Duration
 		BackOffPolicy       string  `json:"backOffPolicy,omitempty" jsonschema:"enum=random,enum=exponential"`
 		RandomizationFactor float64 `json:"randomizationFactor,omitempty" jsonschema:"minimum=0,maximum=1"`
+		MaxWaitDuration     string  `json:"maxWaitDuration,omitempty" jsonschema:"format=duration"`
+		maxWaitDuration     time.Duration
+		PerTryTimeout       string `json:"perTryTimeout,omitempty" jsonschema:"format=duration"`
+		perTryTimeout       time.Duration
+		RetryOnCodes        []int  `json:"retryOnCodes,omitempty" jsonschema:"uniqueItems=true"`
+		IdempotentOnly      bool   `json:"idempotentOnly,omitempty"`
+		HedgingDelay        string `json:"hedgingDelay,omitempty"`
 	}
 )
 
+// CodedError is the error which carries a status code, for example, an
+// HTTP status code or a gRPC status code.
+type CodedError interface {
+	error
+	Code() int
+}
+
+type nonIdempotentKey struct{}
+
+// WithNonIdempotent marks the call as non-idempotent, which is not retried
+// by policies which only retry idempotent calls.
+func WithNonIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nonIdempotentKey{}, true)
+}
+
+func isNonIdempotent(ctx context.Context) bool {
+	v, _ := ctx.Value(nonIdempotentKey{}).(bool)
+	return v
+}
+
+// RetryableError is the error which knows whether the failed call
+// could be retried, errors not implementing it are always retried.
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
 // Validate validates the retry policy.
 func (p *RetryPolicy) Validate() error {
-	// TODO
+	durations := map[string]string{
+		"waitDuration":    p.WaitDuration,
+		"maxWaitDuration": p.MaxWaitDuration,
+		"perTryTimeout":   p.PerTryTimeout,
+	}
+	for name, d := range durations {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid %s %s: %v", name, d, err)
+		}
+	}
+
+	if _, _, err := p.ParseHedgingDelay(); err != nil {
+		return err
+	}
 	return nil
 }
 
+// ParseHedgingDelay parses the hedging delay, which is either a duration
+// or a percentile of the latency, like p95. It returns zero values if
+// hedging is disabled.
+func (p *RetryPolicy) ParseHedgingDelay() (time.Duration, float64, error) {
+	d := p.HedgingDelay
+	if d == "" {
+		return 0, 0, nil
+	}
+
+	if strings.HasPrefix(d, "p") {
+		var percentile float64
+		if _, err := fmt.Sscanf(d, "p%g", &percentile); err != nil || percentile <= 0 || percentile >= 100 {
+			return 0, 0, fmt.Errorf("invalid hedgingDelay %s", d)
+		}
+		return 0, percentile, nil
+	}
+
+	delay, err := time.ParseDuration(d)
+	if err != nil || delay <= 0 {
+		return 0, 0, fmt.Errorf("invalid hedgingDelay %s", d)
+	}
+	return delay, 0, nil
+}
+
+// retryable returns whether the failed call could be retried.
+func (p *RetryPolicy) retryable(ctx context.Context, err error) bool {
+	if re, ok := err.(RetryableError); ok && !re.Retryable() {
+		return false
+	}
+	if p.IdempotentOnly && isNonIdempotent(ctx) {
+		return false
+	}
+	if len(p.RetryOnCodes) == 0 {
+		return true
+	}
+
+	ce, ok := err.(CodedError)
+	if !ok {
+		return false
+	}
+	for _, code := range p.RetryOnCodes {
+		if code == ce.Code() {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateWrapper creates a Wrapper. For the RetryPolicy, just reuse itself.
 func (p *RetryPolicy) CreateWrapper() Wrapper {
 	if d := p.WaitDuration; d != "" {
@@ -71,9 +171,24 @@ func (p *RetryPolicy) CreateWrapper() Wrapper {
 	if p.waitDuration <= 0 {
 		p.waitDuration = time.Millisecond * 500
 	}
+	if d := p.MaxWaitDuration; d != "" {
+		p.maxWaitDuration, _ = time.ParseDuration(d)
+	}
+	if d := p.PerTryTimeout; d != "" {
+		p.perTryTimeout, _ = time.ParseDuration(d)
+	}
 	return p
 }
 
+func (p *RetryPolicy) callOnce(ctx context.Context, handler HandlerFunc) error {
+	if p.perTryTimeout <= 0 {
+		return handler(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.perTryTimeout)
+	defer cancel()
+	return handler(ctx)
+}
+
 // Wrap wraps the handler function.
 func (p *RetryPolicy) Wrap(handler HandlerFunc) HandlerFunc {
 	return func(ctx context.Context) error {
@@ -81,14 +196,25 @@ func (p *RetryPolicy) Wrap(handler HandlerFunc) HandlerFunc {
 		base := float64(p.waitDuration)
 
 		for attempt := 0; attempt < p.MaxAttempts; attempt++ {
-			err = handler(ctx)
+			err = p.callOnce(ctx, handler)
 			if err == nil {
 				return nil
 			}
+			if attempt == p.MaxAttempts-1 || !p.retryable(ctx, err) {
+				return err
+			}
 
+			if p.maxWaitDuration > 0 && base > float64(p.maxWaitDuration) {
+				base = float64(p.maxWaitDuration)
+			}
 			delta := base * p.RandomizationFactor
 			d := base - delta + float64(rand.Intn(int(delta*2+1)))
 
+			// no time left for another attempt.
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < time.Duration(d) {
+				return err
+			}
+
 			select {
 			case <-ctx.Done():
 				return err
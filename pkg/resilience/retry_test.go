@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type codedError int
+
+func (ce codedError) Error() string {
+	return "coded error"
+}
+
+func (ce codedError) Code() int {
+	return int(ce)
+}
+
+func newRetryPolicy(t *testing.T, rawSpec map[string]interface{}) *RetryPolicy {
+	rawSpec["kind"] = "Retry"
+	rawSpec["name"] = "retry"
+	p, err := NewPolicy(rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return p.(*RetryPolicy)
+}
+
+func TestRetryValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, spec := range []map[string]interface{}{
+		{"perTryTimeout": "abc"},
+		{"maxWaitDuration": "abc"},
+		{"hedgingDelay": "p100"},
+		{"hedgingDelay": "-1s"},
+	} {
+		spec["kind"], spec["name"] = "Retry", "retry"
+		_, err := NewPolicy(spec)
+		assert.Error(err)
+	}
+
+	p := newRetryPolicy(t, map[string]interface{}{"hedgingDelay": "p95"})
+	d, percentile, err := p.ParseHedgingDelay()
+	assert.NoError(err)
+	assert.Equal(time.Duration(0), d)
+	assert.Equal(95.0, percentile)
+
+	p = newRetryPolicy(t, map[string]interface{}{"hedgingDelay": "50ms"})
+	d, percentile, err = p.ParseHedgingDelay()
+	assert.NoError(err)
+	assert.Equal(50*time.Millisecond, d)
+	assert.Equal(0.0, percentile)
+}
+
+func TestRetryConditions(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newRetryPolicy(t, map[string]interface{}{
+		"maxAttempts":    3,
+		"waitDuration":   "1ms",
+		"retryOnCodes":   []int{503},
+		"idempotentOnly": true,
+	})
+
+	attempts := 0
+	handler := p.CreateWrapper().Wrap(func(ctx context.Context) error {
+		attempts++
+		return codedError(503)
+	})
+	assert.Error(handler(context.Background()))
+	assert.Equal(3, attempts)
+
+	// non-idempotent calls are not retried.
+	attempts = 0
+	assert.Error(handler(WithNonIdempotent(context.Background())))
+	assert.Equal(1, attempts)
+
+	// codes not in retryOnCodes are not retried.
+	attempts = 0
+	handler = p.CreateWrapper().Wrap(func(ctx context.Context) error {
+		attempts++
+		return codedError(500)
+	})
+	assert.Error(handler(context.Background()))
+	assert.Equal(1, attempts)
+}
+
+func TestRetryPerTryTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newRetryPolicy(t, map[string]interface{}{
+		"maxAttempts":   2,
+		"waitDuration":  "1ms",
+		"perTryTimeout": "10ms",
+	})
+
+	attempts := 0
+	handler := p.CreateWrapper().Wrap(func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	assert.NoError(handler(context.Background()))
+	assert.Equal(2, attempts)
+
+	// no more attempts if the request has no time left.
+	p = newRetryPolicy(t, map[string]interface{}{
+		"maxAttempts":  3,
+		"waitDuration": "1s",
+	})
+	attempts = 0
+	handler = p.CreateWrapper().Wrap(func(ctx context.Context) error {
+		attempts++
+		return codedError(503)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(handler(ctx))
+	assert.Equal(1, attempts)
+	assert.Less(time.Since(start), 100*time.Millisecond)
+}
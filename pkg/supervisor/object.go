@@ -31,7 +31,10 @@ import (
 	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/option"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type (
@@ -79,6 +82,8 @@ type (
 		entities map[string]*ObjectEntity
 		watchers map[string]*ObjectEntityWatcher
 
+		objects *prometheus.GaugeVec
+
 		done chan struct{}
 	}
 )
@@ -164,6 +169,7 @@ func newObjectRegistry(super *Supervisor, initObjs map[string]string, interval s
 		backupConfigLocalPath: filepath.Join(super.Options().AbsHomeDir, backupdConfigFilePath),
 		entities:              make(map[string]*ObjectEntity),
 		watchers:              map[string]*ObjectEntityWatcher{},
+		objects:               newObjectsGauge(super.Options()),
 		done:                  make(chan struct{}),
 	}
 
@@ -172,6 +178,40 @@ func newObjectRegistry(super *Supervisor, initObjs map[string]string, interval s
 	return or
 }
 
+func newObjectsGauge(opt *option.Options) *prometheus.GaugeVec {
+	commonLabels := prometheus.Labels{
+		"clusterName":  opt.ClusterName,
+		"clusterRole":  opt.ClusterRole,
+		"instanceName": opt.Name,
+	}
+	labels := []string{"clusterName", "clusterRole", "instanceName", "category", "kind"}
+
+	return prometheushelper.NewGauge(
+		"supervisor_objects",
+		"the count of objects loaded by the member",
+		labels).MustCurryWith(commonLabels)
+}
+
+// updateObjectsGauge counts the entities by category and kind, the caller
+// must hold the lock.
+func (or *ObjectRegistry) updateObjectsGauge() {
+	type key struct{ category, kind string }
+	counts := map[key]int{}
+	for _, entity := range or.entities {
+		k := key{string(entity.instance.Category()), entity.Spec().Kind()}
+		counts[k]++
+	}
+
+	// the gauges of the deleted kinds are removed by reset.
+	or.objects.Reset()
+	for k, count := range counts {
+		or.objects.With(prometheus.Labels{
+			"category": k.category,
+			"kind":     k.kind,
+		}).Set(float64(count))
+	}
+}
+
 func (or *ObjectRegistry) run() {
 	for {
 		select {
@@ -226,6 +266,8 @@ func (or *ObjectRegistry) applyConfig(config map[string]string) {
 		or.entities[name] = entity
 	}
 
+	or.updateObjectsGauge()
+
 	for _, watcher := range or.watchers {
 		func() {
 			watcher.mutex.Lock()
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+type fakeObject struct {
+	category ObjectCategory
+	kind     string
+}
+
+func (o *fakeObject) Category() ObjectCategory { return o.category }
+func (o *fakeObject) Kind() string             { return o.kind }
+func (o *fakeObject) DefaultSpec() interface{} { return &struct{}{} }
+func (o *fakeObject) Status() *Status          { return &Status{} }
+func (o *fakeObject) Close()                   {}
+
+func newFakeEntity(o *fakeObject, name string) *ObjectEntity {
+	return &ObjectEntity{
+		instance: o,
+		spec:     &Spec{meta: &MetaSpec{Name: name, Kind: o.kind}},
+	}
+}
+
+func TestUpdateObjectsGauge(t *testing.T) {
+	assert := assert.New(t)
+	logger.InitNop()
+
+	opt := &option.Options{Name: "member-1", ClusterName: "test", ClusterRole: "primary"}
+	or := &ObjectRegistry{
+		entities: map[string]*ObjectEntity{},
+		objects:  newObjectsGauge(opt),
+	}
+	value := func(category ObjectCategory, kind string) float64 {
+		return testutil.ToFloat64(or.objects.WithLabelValues(string(category), kind))
+	}
+
+	server := &fakeObject{category: CategoryTrafficGate, kind: "HTTPServer"}
+	pipeline := &fakeObject{category: CategoryPipeline, kind: "Pipeline"}
+	or.entities["server-1"] = newFakeEntity(server, "server-1")
+	or.entities["pipeline-1"] = newFakeEntity(pipeline, "pipeline-1")
+	or.entities["pipeline-2"] = newFakeEntity(pipeline, "pipeline-2")
+
+	or.updateObjectsGauge()
+	assert.Equal(1.0, value(CategoryTrafficGate, "HTTPServer"))
+	assert.Equal(2.0, value(CategoryPipeline, "Pipeline"))
+	assert.Equal(2, testutil.CollectAndCount(or.objects))
+
+	// the gauges of the deleted kinds are removed.
+	delete(or.entities, "server-1")
+	delete(or.entities, "pipeline-2")
+	or.updateObjectsGauge()
+	assert.Equal(1, testutil.CollectAndCount(or.objects))
+	assert.Equal(1.0, value(CategoryPipeline, "Pipeline"))
+}
@@ -22,12 +22,13 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/megaease/easegress/v2/pkg/cluster/migration"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 	"github.com/megaease/easegress/v2/pkg/v"
 )
 
 // DefaultSpecVersion is the default value of the Version field in MetaSpec.
-const DefaultSpecVersion = "easegress.megaease.com/v2"
+const DefaultSpecVersion = migration.CurrentVersion
 
 type (
 	// Spec is the universal spec for all objects.
@@ -47,6 +48,9 @@ type (
 		Kind    string `json:"kind" jsonschema:"required"`
 		Version string `json:"version,omitempty"`
 
+		// Labels are the key/value pairs to organize and select objects.
+		Labels map[string]string `json:"labels,omitempty"`
+
 		// RFC3339 format
 		CreatedAt string `json:"createdAt,omitempty"`
 	}
@@ -174,6 +178,9 @@ func (s *Spec) Kind() string { return s.meta.Kind }
 // Version returns version.
 func (s *Spec) Version() string { return s.meta.Version }
 
+// Labels returns labels.
+func (s *Spec) Labels() map[string]string { return s.meta.Labels }
+
 // JSONConfig returns the config in json format.
 func (s *Spec) JSONConfig() string {
 	return s.jsonConfig
@@ -25,6 +25,7 @@ import (
 	"sync"
 
 	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/migration"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/option"
 )
@@ -69,7 +70,14 @@ func loadInitialObjects(s *Supervisor, paths []string) map[string]string {
 			logger.Errorf("failed to load initial object, path: %s, error: %v", path, e)
 			continue
 		}
-		spec, e := s.NewSpec(string(data))
+		config := string(data)
+		if s.options.AutoMigrate {
+			if config, _, e = migration.Migrate(config); e != nil {
+				logger.Errorf("failed to migrate initial object, path: %s, error: %v", path, e)
+				continue
+			}
+		}
+		spec, e := s.NewSpec(config)
 		if e != nil {
 			logger.Errorf("failed to create spec for initial object, path: %s, error: %v", path, e)
 			continue
@@ -79,6 +87,22 @@ func loadInitialObjects(s *Supervisor, paths []string) map[string]string {
 	return objs
 }
 
+// migrateObjects migrates the object specs stored by older versions, the
+// ones failed to migrate are kept and reported.
+func migrateObjects(cls cluster.Cluster) {
+	report, err := migration.Run(cls, false)
+	if err != nil {
+		logger.Errorf("migrate objects failed: %v", err)
+		return
+	}
+	for _, r := range report.Migrated {
+		logger.Infof("migrated object %s from %s to %s: %v", r.Name, r.From, r.To, r.Changes)
+	}
+	for _, r := range report.Failed {
+		logger.Errorf("failed to migrate object %s from %s: %s", r.Name, r.From, r.Error)
+	}
+}
+
 // MustNew creates a Supervisor.
 func MustNew(opt *option.Options, cls cluster.Cluster) *Supervisor {
 	s := &Supervisor{
@@ -90,6 +114,10 @@ func MustNew(opt *option.Options, cls cluster.Cluster) *Supervisor {
 		done:            make(chan struct{}),
 	}
 
+	if opt.AutoMigrate {
+		migrateObjects(cls)
+	}
+
 	initObjs := loadInitialObjects(s, opt.InitialObjectConfigFiles)
 
 	s.objectRegistry = newObjectRegistry(s, initObjs, opt.ObjectsDumpInterval)
@@ -148,7 +148,7 @@ type (
 		Mode     jaegerMode `json:"mode" jsonschema:"required,enum=agent,enum=collector"`
 		Endpoint string     `json:"endpoint,omitempty"`
 		Username string     `json:"username,omitempty"`
-		Password string     `json:"password,omitempty"`
+		Password string     `json:"password,omitempty" jsonschema:"writeOnly=true"`
 	}
 
 	// ZipkinSpec describes Zipkin.
@@ -163,6 +163,8 @@ type (
 		Endpoint    string       `json:"endpoint" jsonschema:"required"`
 		Insecure    bool         `json:"insecure,omitempty"`
 		Compression string       `json:"compression,omitempty" jsonschema:"enum=,enum=gzip"`
+		// Headers are sent with every export request, e.g. for authentication.
+		Headers map[string]string `json:"headers,omitempty"`
 	}
 
 	// ZipkinDeprecatedSpec describes Zipkin.
@@ -474,6 +476,9 @@ func (spec *OTLPSpec) newExporter() (sdktrace.SpanExporter, error) {
 		if spec.Insecure {
 			opts = append(opts, otlptracegrpc.WithInsecure())
 		}
+		if len(spec.Headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(spec.Headers))
+		}
 		return otlptracegrpc.New(context.Background(), opts...)
 	default:
 		compression := otlptracehttp.NoCompression
@@ -484,6 +489,9 @@ func (spec *OTLPSpec) newExporter() (sdktrace.SpanExporter, error) {
 		if spec.Insecure {
 			opts = append(opts, otlptracehttp.WithInsecure())
 		}
+		if len(spec.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(spec.Headers))
+		}
 
 		return otlptracehttp.New(context.Background(), opts...)
 	}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package acceptretry retries the temporary Accept errors of listeners
+// with backoff, as net/http does.
+package acceptretry
+
+import (
+	"time"
+)
+
+const (
+	minDelay = 5 * time.Millisecond
+	maxDelay = time.Second
+)
+
+// Backoff is the backoff of retrying Accept, the zero value is ready to use.
+type Backoff struct {
+	delay time.Duration
+}
+
+// Reset resets the backoff after a successful Accept.
+func (b *Backoff) Reset() {
+	b.delay = 0
+}
+
+// Retry reports whether Accept should be retried after err, it waits
+// for the backoff delay if err is temporary, such as too many open files.
+// It returns false if err is not temporary or done is closed.
+func (b *Backoff) Retry(err error, done <-chan struct{}) bool {
+	te, ok := err.(interface{ Temporary() bool })
+	if !ok || !te.Temporary() {
+		return false
+	}
+
+	b.delay = nextDelay(b.delay)
+	select {
+	case <-time.After(b.delay):
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// nextDelay returns the delay to retry Accept after the last one.
+func nextDelay(last time.Duration) time.Duration {
+	if last == 0 {
+		return minDelay
+	}
+	if last *= 2; last > maxDelay {
+		return maxDelay
+	}
+	return last
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package acceptretry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Temporary() bool { return true }
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	done := make(chan struct{})
+	b := &Backoff{}
+	assert.False(b.Retry(errors.New("closed"), done))
+	assert.True(b.Retry(temporaryError{}, done))
+	assert.Equal(minDelay, b.delay)
+	assert.True(b.Retry(temporaryError{}, done))
+	assert.Equal(2*minDelay, b.delay)
+
+	b.Reset()
+	assert.Equal(minDelay, nextDelay(b.delay))
+	assert.Equal(maxDelay, nextDelay(maxDelay))
+
+	close(done)
+	assert.False(b.Retry(temporaryError{}, done))
+}
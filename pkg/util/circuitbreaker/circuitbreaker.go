@@ -263,10 +263,24 @@ type (
 
 	// Event stores the state change event
 	Event struct {
-		Time     time.Time
-		OldState string
-		NewState string
-		Reason   string
+		Time     time.Time `json:"time"`
+		OldState string    `json:"oldState"`
+		NewState string    `json:"newState"`
+		Reason   string    `json:"reason"`
+	}
+
+	// Stats is the statistics of a circuit breaker, the rates and the
+	// number of calls are of the current window, and the probe counters
+	// are of the current (or the last) half open state.
+	Stats struct {
+		State                  string `json:"state"`
+		FailureRate            uint8  `json:"failureRate"`
+		SlowCallRate           uint8  `json:"slowCallRate"`
+		NumberOfCalls          uint32 `json:"numberOfCalls"`
+		NotPermittedCalls      uint64 `json:"notPermittedCalls"`
+		HalfOpenProbes         uint32 `json:"halfOpenProbes"`
+		HalfOpenProbeSuccesses uint32 `json:"halfOpenProbeSuccesses"`
+		HalfOpenProbeFailures  uint32 `json:"halfOpenProbeFailures"`
 	}
 
 	// EventListenerFunc is a listener function to listen state transit event
@@ -287,6 +301,10 @@ type (
 		// result is discarded as it does not belong to current state.
 		stateID  uint32
 		listener EventListenerFunc
+
+		notPermittedCalls      uint64
+		halfOpenProbeSuccesses uint32
+		halfOpenProbeFailures  uint32
 	}
 )
 
@@ -373,6 +391,8 @@ func (cb *CircuitBreaker) transitTo(state State, reason string) {
 		// always use count based window in half open state to avoid results being evicted
 		cb.window = NewCountBasedWindow(cb.policy.PermittedNumberOfCallsInHalfOpen)
 		cb.numberOfCallsInHalfOpen = 0
+		cb.halfOpenProbeSuccesses = 0
+		cb.halfOpenProbeFailures = 0
 	}
 
 	if cb.listener != nil {
@@ -393,6 +413,26 @@ func (cb *CircuitBreaker) State() State {
 	return cb.state
 }
 
+// Stats returns the statistics of the circuit breaker
+func (cb *CircuitBreaker) Stats() *Stats {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	stats := &Stats{
+		State:                  stateStrings[cb.state],
+		NotPermittedCalls:      cb.notPermittedCalls,
+		HalfOpenProbes:         cb.numberOfCallsInHalfOpen,
+		HalfOpenProbeSuccesses: cb.halfOpenProbeSuccesses,
+		HalfOpenProbeFailures:  cb.halfOpenProbeFailures,
+	}
+	if cb.window != nil && cb.window.Total() > 0 {
+		stats.NumberOfCalls = cb.window.Total()
+		stats.FailureRate = cb.window.FailureRate()
+		stats.SlowCallRate = cb.window.SlowRate()
+	}
+	return stats
+}
+
 // AcquirePermission acquires a permission from the circuit breaker
 // returns true & stateID if the request is permitted
 // returns false & stateID if the request is rejected
@@ -400,14 +440,23 @@ func (cb *CircuitBreaker) AcquirePermission() (bool, uint32) {
 	cb.lock.Lock()
 	defer cb.lock.Unlock()
 
+	permitted := cb.acquirePermission()
+	if !permitted {
+		cb.notPermittedCalls++
+	}
+	return permitted, cb.stateID
+}
+
+func (cb *CircuitBreaker) acquirePermission() bool {
+
 	// always return true when disabled
 	if cb.state == StateDisabled {
-		return true, cb.stateID
+		return true
 	}
 
 	// always return false when force open
 	if cb.state == StateForceOpen {
-		return false, cb.stateID
+		return false
 	}
 
 	// always return true when closed.
@@ -416,14 +465,14 @@ func (cb *CircuitBreaker) AcquirePermission() (bool, uint32) {
 	// open if success results are evicted by time. but we just rely on the
 	// state here and leave state transition to RecordResult to keep code simple.
 	if cb.state == StateClosed {
-		return true, cb.stateID
+		return true
 	}
 
 	// when state is open, return false if open duration is less than
 	// WaitDurationInOpenState. transit to half open otherwise
 	if cb.state == StateOpen {
 		if nowFunc().Sub(cb.transitTime) < cb.policy.WaitDurationInOpen {
-			return false, cb.stateID
+			return false
 		}
 		cb.transitTo(StateHalfOpen, "wait duration in open state elapsed")
 	}
@@ -431,7 +480,7 @@ func (cb *CircuitBreaker) AcquirePermission() (bool, uint32) {
 	// circuit breaker is in half open state
 	if cb.numberOfCallsInHalfOpen < cb.policy.PermittedNumberOfCallsInHalfOpen {
 		cb.numberOfCallsInHalfOpen++
-		return true, cb.stateID
+		return true
 	}
 
 	// if state is still half open after MaxWaitDurationInHalfOpenState, transit
@@ -442,7 +491,7 @@ func (cb *CircuitBreaker) AcquirePermission() (bool, uint32) {
 		cb.transitTo(StateOpen, "max wait duration in half open state elapsed")
 	}
 
-	return false, cb.stateID
+	return false
 }
 
 // RecordResult records the result in window
@@ -467,6 +516,13 @@ func (cb *CircuitBreaker) RecordResult(stateID uint32, hasErr bool, d time.Durat
 	// after the stateID check, state can only be Closed & HalfOpen now.
 
 	cb.window.Push(result)
+	if cb.state == StateHalfOpen {
+		if result == CallResultSuccess {
+			cb.halfOpenProbeSuccesses++
+		} else {
+			cb.halfOpenProbeFailures++
+		}
+	}
 
 	// check if enough results were collected
 	minNumOfCalls := cb.policy.MinimumNumberOfCalls
@@ -222,3 +222,43 @@ func TestTimeBased(t *testing.T) {
 		t.Errorf("circuit breaker state should be Open")
 	}
 }
+
+func TestStats(t *testing.T) {
+	policy := NewPolicy(50, 60, CountBased, 10, 4, 10,
+		10*time.Millisecond, 0, 5*time.Second)
+	cb := New(policy)
+
+	for i := 0; i < 10; i++ {
+		permitted, stateID := cb.AcquirePermission()
+		if !permitted {
+			t.Fatalf("acquire permission should succeeded, i = %d", i)
+		}
+		cb.RecordResult(stateID, i%2 == 0, time.Millisecond)
+	}
+
+	stats := cb.Stats()
+	if stats.State != "Open" || stats.FailureRate != 50 || stats.NumberOfCalls != 10 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	cb.AcquirePermission()
+	if stats = cb.Stats(); stats.NotPermittedCalls != 1 {
+		t.Errorf("not permitted calls should be 1, but got %d", stats.NotPermittedCalls)
+	}
+
+	// probe in half open state
+	now = now.Add(5 * time.Second)
+	for i := 0; i < 3; i++ {
+		permitted, stateID := cb.AcquirePermission()
+		if !permitted {
+			t.Fatalf("acquire permission should succeeded, i = %d", i)
+		}
+		cb.RecordResult(stateID, i == 0, time.Millisecond)
+	}
+
+	stats = cb.Stats()
+	if stats.State != "HalfOpen" || stats.HalfOpenProbes != 3 ||
+		stats.HalfOpenProbeSuccesses != 2 || stats.HalfOpenProbeFailures != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package deadline propagates the deadline of a request to upstreams.
+package deadline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// FormatMilliseconds formats the remaining time in milliseconds.
+	FormatMilliseconds = "milliseconds"
+	// FormatSeconds formats the remaining time in seconds, with a
+	// precision of milliseconds.
+	FormatSeconds = "seconds"
+	// FormatGRPC formats the remaining time as the grpc-timeout header.
+	FormatGRPC = "grpc"
+	// FormatUnixMilli formats the absolute deadline as a Unix time in
+	// milliseconds.
+	FormatUnixMilli = "unixMilli"
+
+	// maxGRPCTimeoutValue is the max value of grpc-timeout, which has at
+	// most 8 digits.
+	maxGRPCTimeoutValue = 99999999
+)
+
+// Propagation defines how to propagate the deadline to upstreams.
+type Propagation struct {
+	Header string `json:"header" jsonschema:"required"`
+	Format string `json:"format,omitempty" jsonschema:"enum=,enum=milliseconds,enum=seconds,enum=grpc,enum=unixMilli"`
+}
+
+type propagationKey struct{}
+
+// Validate validates the propagation.
+func (p *Propagation) Validate() error {
+	switch p.Format {
+	case "", FormatMilliseconds, FormatSeconds, FormatGRPC, FormatUnixMilli:
+		return nil
+	default:
+		return fmt.Errorf("unknown deadline format %s", p.Format)
+	}
+}
+
+// WithPropagation returns a copy of ctx which propagates its deadline with p.
+func WithPropagation(ctx context.Context, p *Propagation) context.Context {
+	return context.WithValue(ctx, propagationKey{}, p)
+}
+
+// Propagate sets the remaining time of ctx to the header, it does nothing
+// if ctx has no deadline or no propagation.
+func Propagate(ctx context.Context, h http.Header) {
+	p, _ := ctx.Value(propagationKey{}).(*Propagation)
+	if p == nil {
+		return
+	}
+	d, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	h.Set(p.Header, Format(d, p.Format, time.Now()))
+}
+
+// Format formats the deadline with the format.
+func Format(deadline time.Time, format string, now time.Time) string {
+	remaining := deadline.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	switch format {
+	case FormatSeconds:
+		return strconv.FormatFloat(remaining.Seconds(), 'f', 3, 64)
+	case FormatGRPC:
+		return formatGRPC(remaining)
+	case FormatUnixMilli:
+		return strconv.FormatInt(deadline.UnixMilli(), 10)
+	default:
+		return strconv.FormatInt(remaining.Milliseconds(), 10)
+	}
+}
+
+// Parse parses the header value with the format, and returns the
+// remaining time.
+func Parse(value string, format string, now time.Time) (time.Duration, error) {
+	switch format {
+	case FormatSeconds:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(f * float64(time.Second)), nil
+	case FormatGRPC:
+		return parseGRPC(value)
+	case FormatUnixMilli:
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.UnixMilli(ms).Sub(now), nil
+	default:
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+}
+
+var grpcUnits = []struct {
+	unit byte
+	d    time.Duration
+}{
+	{'n', time.Nanosecond},
+	{'u', time.Microsecond},
+	{'m', time.Millisecond},
+	{'S', time.Second},
+	{'M', time.Minute},
+	{'H', time.Hour},
+}
+
+// formatGRPC formats d with the finest unit which fits in 8 digits, the
+// value is rounded up.
+func formatGRPC(d time.Duration) string {
+	for _, u := range grpcUnits {
+		v := int64(d / u.d)
+		if d%u.d != 0 {
+			v++
+		}
+		if v <= maxGRPCTimeoutValue {
+			return strconv.FormatInt(v, 10) + string(u.unit)
+		}
+	}
+	return strconv.Itoa(maxGRPCTimeoutValue) + "H"
+}
+
+func parseGRPC(value string) (time.Duration, error) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("invalid grpc-timeout %s", value)
+	}
+
+	v, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid grpc-timeout %s", value)
+	}
+
+	unit := value[len(value)-1]
+	for _, u := range grpcUnits {
+		if u.unit == unit {
+			return time.Duration(v) * u.d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid grpc-timeout %s", value)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadline
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatAndParse(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	deadline := now.Add(1500 * time.Millisecond)
+
+	cases := []struct {
+		format string
+		value  string
+	}{
+		{FormatMilliseconds, "1500"},
+		{"", "1500"},
+		{FormatSeconds, "1.500"},
+		{FormatGRPC, "1500000u"},
+		{FormatUnixMilli, ""},
+	}
+	for _, c := range cases {
+		v := Format(deadline, c.format, now)
+		if c.value != "" {
+			assert.Equal(c.value, v)
+		}
+		d, err := Parse(v, c.format, now)
+		assert.NoError(err)
+		assert.InDelta(float64(1500*time.Millisecond), float64(d), float64(time.Millisecond))
+	}
+
+	assert.Equal("0", Format(now.Add(-time.Second), FormatMilliseconds, now))
+	assert.Equal("100000S", formatGRPC(100000*time.Second))
+
+	for _, v := range []string{"1", "1x", "abcS", "1234567890S"} {
+		_, err := Parse(v, FormatGRPC, now)
+		assert.Error(err)
+	}
+	_, err := Parse("abc", FormatMilliseconds, now)
+	assert.Error(err)
+}
+
+func TestPropagate(t *testing.T) {
+	assert := assert.New(t)
+
+	h := http.Header{}
+	Propagate(context.Background(), h)
+	assert.Empty(h)
+
+	p := &Propagation{Header: "X-Deadline"}
+	assert.NoError(p.Validate())
+	assert.Error((&Propagation{Header: "X-Deadline", Format: "unknown"}).Validate())
+
+	// no deadline.
+	ctx := WithPropagation(context.Background(), p)
+	Propagate(ctx, h)
+	assert.Empty(h)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	Propagate(ctx, h)
+	d, err := Parse(h.Get("X-Deadline"), p.Format, time.Now())
+	assert.NoError(err)
+	assert.True(d > 900*time.Millisecond && d <= time.Second)
+}
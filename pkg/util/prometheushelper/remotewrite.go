@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prometheushelper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWriteSample is a sample of a time series to be written to a
+// Prometheus remote-write endpoint.
+type RemoteWriteSample struct {
+	// Labels must contain the metric name with key __name__.
+	Labels    map[string]string
+	Value     float64
+	Timestamp time.Time
+}
+
+// EncodeRemoteWriteRequest encodes samples to a snappy compressed
+// WriteRequest of the Prometheus remote-write protocol, every sample
+// is a time series.
+func EncodeRemoteWriteRequest(samples []*RemoteWriteSample) []byte {
+	var req []byte
+	for _, s := range samples {
+		var ts []byte
+
+		names := make([]string, 0, len(s.Labels))
+		for name := range s.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, s.Labels[name])
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.Timestamp.UnixMilli()))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+
+	return snappy.Encode(nil, req)
+}
+
+// RemoteWrite writes samples to the Prometheus remote-write endpoint.
+func RemoteWrite(client *http.Client, url string, headers map[string]string, samples []*RemoteWriteSample) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(EncodeRemoteWriteRequest(samples)))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("remote write to %s failed: %s %s", url, resp.Status, body)
+	}
+
+	return nil
+}
@@ -0,0 +1,294 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package protosniff detects the protocol of a connection by peeking its first bytes.
+package protosniff
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/acceptretry"
+)
+
+// Protocol is the detected protocol of a connection.
+type Protocol string
+
+const (
+	// ProtocolHTTP1 is HTTP/1.x.
+	ProtocolHTTP1 Protocol = "http1"
+	// ProtocolHTTP2 is HTTP/2 with prior knowledge (h2c).
+	ProtocolHTTP2 Protocol = "http2"
+	// ProtocolTLS is TLS, its inner protocol is unknown.
+	ProtocolTLS Protocol = "tls"
+	// ProtocolTCP is any other protocol.
+	ProtocolTCP Protocol = "tcp"
+
+	// DefaultTimeout is the default timeout to wait for the first bytes,
+	// server-first protocols never send them, so they are detected as TCP
+	// after the timeout.
+	DefaultTimeout = 200 * time.Millisecond
+
+	// maxMethodSize is the max size of HTTP/1 extension methods, the
+	// longest registered one, UPDATEREDIRECTREF, has 17 bytes.
+	maxMethodSize = 20
+
+	// maxPeekSize is large enough to hold the HTTP/2 preface and
+	// the longest HTTP/1 method followed by the request target.
+	maxPeekSize = 24
+)
+
+var (
+	http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+	http1Methods = [][]byte{
+		[]byte("GET "), []byte("HEAD "), []byte("POST "), []byte("PUT "),
+		[]byte("DELETE "), []byte("CONNECT "), []byte("OPTIONS "),
+		[]byte("TRACE "), []byte("PATCH "),
+	}
+)
+
+// Detect detects the protocol from the first bytes of a connection, the
+// second return value is false if more bytes are needed to decide.
+func Detect(b []byte) (Protocol, bool) {
+	if len(b) == 0 {
+		return "", false
+	}
+
+	if len(b) >= 3 && b[0] == 0x16 && b[1] == 0x03 && b[2] <= 0x04 {
+		return ProtocolTLS, true
+	}
+
+	if bytes.HasPrefix(b, http2Preface) {
+		return ProtocolHTTP2, true
+	}
+	if bytes.HasPrefix(http2Preface, b) {
+		return "", false
+	}
+
+	for _, m := range http1Methods {
+		if bytes.HasPrefix(b, m) {
+			return ProtocolHTTP1, true
+		}
+	}
+
+	return detectExtensionMethod(b)
+}
+
+// detectExtensionMethod detects HTTP/1 requests of extension methods, such
+// as the WebDAV ones. As other text protocols, e.g. the inline commands of
+// Redis, look alike, the method must be followed by an origin-form or
+// asterisk-form request target.
+func detectExtensionMethod(b []byte) (Protocol, bool) {
+	i := 0
+	for i < len(b) && isMethodByte(b[i]) {
+		i++
+	}
+
+	switch {
+	case i == len(b):
+		if i < maxMethodSize {
+			return "", false
+		}
+		return ProtocolTCP, true
+	case i == 0 || b[i] != ' ':
+		return ProtocolTCP, true
+	case i+1 == len(b):
+		return "", false
+	case b[i+1] == '/' || b[i+1] == '*':
+		return ProtocolHTTP1, true
+	default:
+		return ProtocolTCP, true
+	}
+}
+
+func isMethodByte(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c == '-' || c == '_'
+}
+
+// Conn is a connection whose first bytes have been peeked, reading from it
+// returns the peeked bytes first.
+type Conn struct {
+	net.Conn
+	r        *bufio.Reader
+	protocol Protocol
+}
+
+// Read reads data from the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// Protocol returns the detected protocol.
+func (c *Conn) Protocol() Protocol {
+	return c.protocol
+}
+
+// Sniff peeks the first bytes of conn to detect its protocol, the returned
+// connection must be used instead of conn afterwards.
+func Sniff(conn net.Conn, timeout time.Duration) (*Conn, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	c := &Conn{
+		Conn: conn,
+		r:    bufio.NewReaderSize(conn, maxPeekSize),
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	for n := 1; n <= maxPeekSize; n++ {
+		b, err := c.r.Peek(n)
+		if p, ok := Detect(b); ok {
+			c.protocol = p
+			return c, nil
+		}
+
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				c.protocol = ProtocolTCP
+				return c, nil
+			}
+			return nil, err
+		}
+
+		// Peek more bytes if they are already buffered.
+		if buffered := c.r.Buffered(); buffered > n {
+			n = buffered - 1
+		}
+	}
+
+	c.protocol = ProtocolTCP
+	return c, nil
+}
+
+// Listener is a listener which sniffs the protocol of accepted connections,
+// HTTP connections are returned by Accept, the others are passed to the
+// fallback handler.
+type Listener struct {
+	net.Listener
+
+	timeout  time.Duration
+	fallback func(*Conn)
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewListener creates a sniffing Listener, connections which are neither
+// HTTP/1 nor HTTP/2 are passed to fallback, or closed if fallback is nil.
+func NewListener(l net.Listener, timeout time.Duration, fallback func(*Conn)) *Listener {
+	sl := &Listener{
+		Listener: l,
+		timeout:  timeout,
+		fallback: fallback,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+
+	go sl.run()
+
+	return sl
+}
+
+func (l *Listener) run() {
+	backoff := &acceptretry.Backoff{}
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case <-l.done:
+				return
+			default:
+			}
+
+			// Retry the temporary errors, such as too many open files.
+			if backoff.Retry(err, l.done) {
+				continue
+			}
+
+			select {
+			case l.errs <- err:
+			case <-l.done:
+			}
+			return
+		}
+
+		backoff.Reset()
+		go l.sniff(conn)
+	}
+}
+
+func (l *Listener) sniff(conn net.Conn) {
+	c, err := Sniff(conn, l.timeout)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	switch c.Protocol() {
+	case ProtocolHTTP1, ProtocolHTTP2:
+		select {
+		case l.conns <- c:
+		case <-l.done:
+			c.Close()
+		}
+	default:
+		if l.fallback == nil {
+			c.Close()
+			return
+		}
+		l.fallback(c)
+	}
+}
+
+// Accept accepts one HTTP connection, it returns net.ErrClosed once the
+// listener is closed.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case <-l.done:
+		return nil, net.ErrClosed
+	default:
+	}
+
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package protosniff
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		data     string
+		protocol Protocol
+		decided  bool
+	}{
+		{"", "", false},
+		{"G", "", false},
+		{"GET / HTTP/1.1\r\n", ProtocolHTTP1, true},
+		{"OPTIONS * HTTP/1.1\r\n", ProtocolHTTP1, true},
+		{"P", "", false},
+		{"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", ProtocolHTTP2, true},
+		{"PRI * HTTP", "", false},
+		{"\x16\x03\x01\x02\x00", ProtocolTLS, true},
+		{"\x00\x01\x02", ProtocolTCP, true},
+		{"GETX", "", false},
+		{"GETX\r\n", ProtocolTCP, true},
+		{"PROPFIND /dav HTTP/1.1\r\n", ProtocolHTTP1, true},
+		{"MKCOL /dav/new HTTP/1.1\r\n", ProtocolHTTP1, true},
+		{"VERSION-CONTROL ", "", false},
+		{"SET key value\r\n", ProtocolTCP, true},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZ", ProtocolTCP, true},
+		{" / HTTP/1.1\r\n", ProtocolTCP, true},
+	}
+
+	for _, c := range cases {
+		p, decided := Detect([]byte(c.data))
+		assert.Equal(c.decided, decided, c.data)
+		assert.Equal(c.protocol, p, c.data)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	assert := assert.New(t)
+
+	client, server := net.Pipe()
+	go client.Write([]byte("GET / HTTP/1.1\r\n"))
+
+	c, err := Sniff(server, time.Second)
+	assert.Nil(err)
+	assert.Equal(ProtocolHTTP1, c.Protocol())
+
+	buf := make([]byte, 16)
+	_, err = io.ReadFull(c, buf)
+	assert.Nil(err)
+	assert.Equal("GET / HTTP/1.1\r\n", string(buf))
+
+	// Server-first protocols send nothing.
+	client, server = net.Pipe()
+	c, err = Sniff(server, 50*time.Millisecond)
+	assert.Nil(err)
+	assert.Equal(ProtocolTCP, c.Protocol())
+	client.Close()
+}
+
+func TestListener(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+
+	fallback := make(chan Protocol, 1)
+	sl := NewListener(l, 100*time.Millisecond, func(c *Conn) {
+		fallback <- c.Protocol()
+		c.Close()
+	})
+	defer sl.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(err)
+	conn.Write([]byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"))
+
+	accepted, err := sl.Accept()
+	assert.Nil(err)
+	assert.Equal(ProtocolHTTP2, accepted.(*Conn).Protocol())
+	accepted.Close()
+	conn.Close()
+
+	conn, err = net.Dial("tcp", l.Addr().String())
+	assert.Nil(err)
+	conn.Write([]byte{0x00, 0x01})
+	assert.Equal(ProtocolTCP, <-fallback)
+	conn.Close()
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Temporary() bool { return true }
+func (temporaryError) Timeout() bool   { return false }
+
+// flakyListener fails the first Accepts with temporary errors.
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, temporaryError{}
+	}
+	return l.Listener.Accept()
+}
+
+func TestListenerAcceptErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+
+	// the temporary errors are retried.
+	sl := NewListener(&flakyListener{Listener: l, failures: 3}, 100*time.Millisecond, nil)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(err)
+	conn.Write([]byte("GET / HTTP/1.1\r\n"))
+
+	accepted, err := sl.Accept()
+	assert.Nil(err)
+	assert.Equal(ProtocolHTTP1, accepted.(*Conn).Protocol())
+	accepted.Close()
+	conn.Close()
+
+	sl.Close()
+	_, err = sl.Accept()
+	assert.ErrorIs(err, net.ErrClosed)
+}
@@ -0,0 +1,365 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package proxyprotocol implements the PROXY protocol, version 1 and 2,
+// which passes the address of the client through proxies.
+//
+// Reference: https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHeaderTimeout is the default timeout to read the PROXY header.
+const DefaultHeaderTimeout = 5 * time.Second
+
+const (
+	// the longest version 1 header, including the CRLF.
+	maxV1HeaderSize = 107
+
+	v2HeaderSize = 16
+	v2Version    = 0x20
+	v2CmdLocal   = 0x0
+	v2CmdProxy   = 0x1
+	v2FamilyIPv4 = 0x1
+	v2FamilyIPv6 = 0x2
+	v2TransTCP   = 0x1
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// ErrNoHeader means the connection doesn't start with a PROXY header.
+	ErrNoHeader = errors.New("proxy protocol header not found")
+)
+
+// Conn is a connection which starts with a PROXY header, the header is
+// read on the first call of Read, RemoteAddr or LocalAddr.
+type Conn struct {
+	net.Conn
+
+	r       *bufio.Reader
+	timeout time.Duration
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+
+	deadlineLock sync.Mutex
+	readDeadline time.Time
+}
+
+// NewConn wraps conn to a Conn.
+func NewConn(conn net.Conn, timeout time.Duration) *Conn {
+	if timeout <= 0 {
+		timeout = DefaultHeaderTimeout
+	}
+	return &Conn{
+		Conn:    conn,
+		r:       bufio.NewReader(conn),
+		timeout: timeout,
+	}
+}
+
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.remoteAddr, c.localAddr, c.err = ReadHeader(c.r)
+
+		// restore the deadline set by the user.
+		c.deadlineLock.Lock()
+		c.Conn.SetReadDeadline(c.readDeadline)
+		c.deadlineLock.Unlock()
+	})
+}
+
+// Err reads the PROXY header if it is not read yet, and returns the error
+// of reading it.
+func (c *Conn) Err() error {
+	c.readHeader()
+	return c.err
+}
+
+// Read reads data from the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+// RemoteAddr returns the source address in the PROXY header, or the
+// address of the peer if the header doesn't carry one.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address in the PROXY header, or the
+// local address if the header doesn't carry one.
+func (c *Conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	c.readDeadline = t
+	c.deadlineLock.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	c.readDeadline = t
+	c.deadlineLock.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// Listener is a listener whose connections start with a PROXY header.
+type Listener struct {
+	net.Listener
+	timeout time.Duration
+}
+
+// NewListener wraps l to a Listener, timeout is the timeout to read the
+// PROXY header of accepted connections.
+func NewListener(l net.Listener, timeout time.Duration) *Listener {
+	return &Listener{Listener: l, timeout: timeout}
+}
+
+// Accept accepts a connection, the header is not read here to avoid
+// blocking the accepting by slow clients.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, l.timeout), nil
+}
+
+// ReadHeader reads a version 1 or 2 PROXY header from r, and returns the
+// source and destination addresses in it. The addresses are nil if the
+// header doesn't carry them, e.g. for health checks from the proxy.
+func ReadHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch b[0] {
+	case v1Prefix[0]:
+		return readV1Header(r)
+	case v2Signature[0]:
+		return readV2Header(r)
+	default:
+		return nil, nil, ErrNoHeader
+	}
+}
+
+func readV1Header(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < maxV1HeaderSize {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+
+	if !bytes.HasPrefix(line, v1Prefix) || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, ErrNoHeader
+	}
+
+	fields := strings.Fields(string(line[len(v1Prefix) : len(line)-2]))
+	if len(fields) == 0 {
+		return nil, nil, fmt.Errorf("invalid proxy protocol v1 header: %q", line)
+	}
+	if fields[0] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 5 || (fields[0] != "TCP4" && fields[0] != "TCP6") {
+		return nil, nil, fmt.Errorf("invalid proxy protocol v1 header: %q", line)
+	}
+
+	src, err := parseV1Addr(fields[1], fields[3])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func parseV1Addr(ip, port string) (net.Addr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil {
+		return nil, fmt.Errorf("invalid ip %q in proxy protocol v1 header", ip)
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q in proxy protocol v1 header", port)
+	}
+	addr.Port = int(p)
+
+	return addr, nil
+}
+
+func readV2Header(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, v2HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(header[:len(v2Signature)], v2Signature) {
+		return nil, nil, ErrNoHeader
+	}
+
+	if header[12]>>4 != 0x2 {
+		return nil, nil, fmt.Errorf("unsupported proxy protocol version %d", header[12]>>4)
+	}
+	cmd := header[12] & 0x0f
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch cmd {
+	case v2CmdLocal:
+		return nil, nil, nil
+	case v2CmdProxy:
+	default:
+		return nil, nil, fmt.Errorf("unsupported proxy protocol command %d", cmd)
+	}
+
+	var ipLen int
+	switch header[13] >> 4 {
+	case v2FamilyIPv4:
+		ipLen = net.IPv4len
+	case v2FamilyIPv6:
+		ipLen = net.IPv6len
+	default:
+		// unix sockets and unspecified families carry no usable address.
+		return nil, nil, nil
+	}
+
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, fmt.Errorf("proxy protocol v2 address block is too short")
+	}
+
+	src := &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+	return src, dst, nil
+}
+
+// WriteHeader writes a PROXY header of version 1 or 2 to w, which carries
+// the source and destination addresses. A header without addresses is
+// written if they are not TCP addresses.
+func WriteHeader(w io.Writer, version int, src, dst net.Addr) error {
+	srcAddr, _ := src.(*net.TCPAddr)
+	dstAddr, _ := dst.(*net.TCPAddr)
+	if srcAddr == nil || dstAddr == nil {
+		srcAddr, dstAddr = nil, nil
+	}
+
+	var header []byte
+	switch version {
+	case 1:
+		header = buildV1Header(srcAddr, dstAddr)
+	case 2:
+		header = buildV2Header(srcAddr, dstAddr)
+	default:
+		return fmt.Errorf("unsupported proxy protocol version %d", version)
+	}
+
+	_, err := w.Write(header)
+	return err
+}
+
+func buildV1Header(src, dst *net.TCPAddr) []byte {
+	if src == nil {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+
+	family := "TCP4"
+	if src.IP.To4() == nil || dst.IP.To4() == nil {
+		family = "TCP6"
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, src.IP, dst.IP, src.Port, dst.Port))
+}
+
+func buildV2Header(src, dst *net.TCPAddr) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(v2Signature)
+
+	if src == nil {
+		buf.WriteByte(v2Version | v2CmdLocal)
+		buf.WriteByte(0)
+		binary.Write(buf, binary.BigEndian, uint16(0))
+		return buf.Bytes()
+	}
+
+	family := byte(v2FamilyIPv4)
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP == nil || dstIP == nil {
+		family = v2FamilyIPv6
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	}
+
+	buf.WriteByte(v2Version | v2CmdProxy)
+	buf.WriteByte(family<<4 | v2TransTCP)
+	binary.Write(buf, binary.BigEndian, uint16(2*len(srcIP)+4))
+	buf.Write(srcIP)
+	buf.Write(dstIP)
+	binary.Write(buf, binary.BigEndian, uint16(src.Port))
+	binary.Write(buf, binary.BigEndian, uint16(dst.Port))
+	return buf.Bytes()
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func v2Header(cmd, family byte, addrs []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(v2Signature)
+	buf.WriteByte(0x20 | cmd)
+	buf.WriteByte(family<<4 | 0x1)
+	binary.Write(buf, binary.BigEndian, uint16(len(addrs)))
+	buf.Write(addrs)
+	return buf.Bytes()
+}
+
+func TestReadHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	src, dst, err := ReadHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET /")))
+	assert.Nil(err)
+	assert.Equal("192.168.0.1:56324", src.String())
+	assert.Equal("192.168.0.11:443", dst.String())
+
+	src, _, err = ReadHeader(bufio.NewReader(strings.NewReader("PROXY TCP6 2001:db8::1 2001:db8::2 1234 80\r\n")))
+	assert.Nil(err)
+	assert.Equal("[2001:db8::1]:1234", src.String())
+
+	src, dst, err = ReadHeader(bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n")))
+	assert.Nil(err)
+	assert.Nil(src)
+	assert.Nil(dst)
+
+	_, _, err = ReadHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 192.168.0.1 192.168.0.11 56324\r\n")))
+	assert.Error(err)
+	_, _, err = ReadHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 1.1.1.1 2.2.2.2 1 70000\r\n")))
+	assert.Error(err)
+	_, _, err = ReadHeader(bufio.NewReader(strings.NewReader("PROXY " + strings.Repeat("x", 200))))
+	assert.Error(err)
+	_, _, err = ReadHeader(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n")))
+	assert.Equal(ErrNoHeader, err)
+
+	addrs := []byte{10, 0, 0, 1, 10, 0, 0, 2, 0x1f, 0x90, 0x01, 0xbb}
+	r := bufio.NewReader(bytes.NewReader(append(v2Header(v2CmdProxy, v2FamilyIPv4, addrs), "data"...)))
+	src, dst, err = ReadHeader(r)
+	assert.Nil(err)
+	assert.Equal("10.0.0.1:8080", src.String())
+	assert.Equal("10.0.0.2:443", dst.String())
+	rest, _ := io.ReadAll(r)
+	assert.Equal("data", string(rest))
+
+	src, _, err = ReadHeader(bufio.NewReader(bytes.NewReader(v2Header(v2CmdLocal, 0, nil))))
+	assert.Nil(err)
+	assert.Nil(src)
+
+	_, _, err = ReadHeader(bufio.NewReader(bytes.NewReader(v2Header(v2CmdProxy, v2FamilyIPv6, addrs))))
+	assert.Error(err)
+}
+
+func TestListener(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	pl := NewListener(l, time.Second)
+	defer pl.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("PROXY TCP4 203.0.113.7 192.168.0.11 56324 443\r\nhello"))
+	}()
+
+	conn, err := pl.Accept()
+	assert.Nil(err)
+	defer conn.Close()
+
+	assert.Nil(conn.(*Conn).Err())
+	assert.Equal("203.0.113.7:56324", conn.RemoteAddr().String())
+	assert.Equal("192.168.0.11:443", conn.LocalAddr().String())
+	data, err := io.ReadAll(conn)
+	assert.Nil(err)
+	assert.Equal("hello", string(data))
+
+	// the header timeout.
+	go func() {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		time.Sleep(2 * time.Second)
+		conn.Close()
+	}()
+
+	pl.timeout = 100 * time.Millisecond
+	conn, err = pl.Accept()
+	assert.Nil(err)
+	defer conn.Close()
+	assert.Error(conn.(*Conn).Err())
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(err)
+}
+
+func TestWriteHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.168.0.11"), Port: 443}
+	src6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234}
+
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(WriteHeader(buf, 1, src, dst))
+	assert.Equal("PROXY TCP4 203.0.113.7 192.168.0.11 56324 443\r\n", buf.String())
+
+	for _, version := range []int{1, 2} {
+		buf.Reset()
+		assert.Nil(WriteHeader(buf, version, src, dst))
+		s, d, err := ReadHeader(bufio.NewReader(buf))
+		assert.Nil(err)
+		assert.Equal(src.String(), s.String())
+		assert.Equal(dst.String(), d.String())
+
+		buf.Reset()
+		assert.Nil(WriteHeader(buf, version, src6, dst))
+		s, _, err = ReadHeader(bufio.NewReader(buf))
+		assert.Nil(err)
+		assert.Equal(src6.String(), s.String())
+
+		buf.Reset()
+		assert.Nil(WriteHeader(buf, version, &net.UnixAddr{Name: "/tmp/sock"}, dst))
+		s, d, err = ReadHeader(bufio.NewReader(buf))
+		assert.Nil(err)
+		assert.Nil(s)
+		assert.Nil(d)
+	}
+
+	assert.Error(WriteHeader(buf, 3, src, dst))
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Quota is the quota of a limiter after a request is checked.
+	Quota struct {
+		// Limit is the number of requests permitted in a window.
+		Limit int
+		// Remaining is the number of requests could still be permitted
+		// in the current window.
+		Remaining int
+		// Reset is the duration until the quota is fully restored.
+		Reset time.Duration
+	}
+
+	// QuotaLimiter is a rate limiter which rejects requests immediately
+	// once the quota is used up, and reports the quota to the caller.
+	QuotaLimiter interface {
+		Allow() (bool, *Quota)
+	}
+
+	// SlidingWindow is a sliding window rate limiter, the number of
+	// requests in the sliding window is estimated by the counts of the
+	// current fixed window and the previous one.
+	SlidingWindow struct {
+		lock      sync.Mutex
+		limit     int
+		window    time.Duration
+		startTime time.Time
+		current   int64
+		currCount int
+		prevCount int
+	}
+
+	// GCRA is a rate limiter based on the generic cell rate algorithm,
+	// it spreads the requests evenly and permits bursts up to a limit.
+	GCRA struct {
+		lock      sync.Mutex
+		limit     int
+		interval  time.Duration
+		tolerance time.Duration
+		tat       time.Time
+	}
+)
+
+// NewSlidingWindow creates a sliding window rate limiter which permits
+// `limit` requests in any `window`.
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		limit:     limit,
+		window:    window,
+		startTime: nowFunc(),
+	}
+}
+
+// Allow checks whether a request is permitted.
+func (sw *SlidingWindow) Allow() (bool, *Quota) {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	now := nowFunc()
+
+	elapsed := now.Sub(sw.startTime)
+	current := int64(elapsed / sw.window)
+	switch current - sw.current {
+	case 0:
+	case 1:
+		sw.prevCount, sw.currCount = sw.currCount, 0
+	default:
+		sw.prevCount, sw.currCount = 0, 0
+	}
+	sw.current = current
+
+	// weight of the previous window in the sliding window.
+	offset := elapsed - time.Duration(current)*sw.window
+	weight := float64(sw.window-offset) / float64(sw.window)
+	count := int(float64(sw.prevCount)*weight) + sw.currCount
+
+	// requests are rejected at least until the current window ends.
+	untilNext := sw.window - offset
+	if count >= sw.limit {
+		return false, &Quota{Limit: sw.limit, Reset: untilNext}
+	}
+
+	// the requests in the current window are counted until the end of the
+	// next window.
+	sw.currCount++
+	quota := &Quota{
+		Limit:     sw.limit,
+		Remaining: sw.limit - count - 1,
+		Reset:     untilNext + sw.window,
+	}
+	return true, quota
+}
+
+// NewGCRA creates a GCRA rate limiter which permits `limit` requests in
+// `period` evenly, and at most `burst` requests at once.
+func NewGCRA(limit int, period time.Duration, burst int) *GCRA {
+	if burst <= 0 {
+		burst = 1
+	}
+	interval := period / time.Duration(limit)
+	return &GCRA{
+		limit:     burst,
+		interval:  interval,
+		tolerance: interval * time.Duration(burst-1),
+	}
+}
+
+// Allow checks whether a request is permitted.
+func (g *GCRA) Allow() (bool, *Quota) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	now := nowFunc()
+
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+
+	quota := &Quota{Limit: g.limit}
+
+	// the request is too early if the theoretical arrival time is
+	// later than the tolerance.
+	if tat.Sub(now) > g.tolerance {
+		quota.Reset = tat.Sub(now) - g.tolerance
+		return false, quota
+	}
+
+	g.tat = tat.Add(g.interval)
+	quota.Reset = g.tat.Sub(now)
+	quota.Remaining = int((g.tolerance - tat.Sub(now)) / g.interval)
+	return true, quota
+}
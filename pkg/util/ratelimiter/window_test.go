@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	sw := NewSlidingWindow(10, time.Second)
+	var _ QuotaLimiter = sw
+
+	for i := 0; i < 10; i++ {
+		ok, quota := sw.Allow()
+		assert.True(ok)
+		assert.Equal(9-i, quota.Remaining)
+	}
+	ok, quota := sw.Allow()
+	assert.False(ok)
+	assert.Equal(time.Second, quota.Reset)
+
+	// half of the previous window is still in the sliding window.
+	now = now.Add(1500 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		ok, _ = sw.Allow()
+		assert.True(ok)
+	}
+	ok, _ = sw.Allow()
+	assert.False(ok)
+
+	// both windows are out of the sliding window.
+	now = now.Add(2 * time.Second)
+	ok, quota = sw.Allow()
+	assert.True(ok)
+	assert.Equal(9, quota.Remaining)
+}
+
+func TestGCRA(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGCRA(10, time.Second, 3)
+	var _ QuotaLimiter = g
+
+	for i := 0; i < 3; i++ {
+		ok, quota := g.Allow()
+		assert.True(ok)
+		assert.Equal(2-i, quota.Remaining)
+	}
+	ok, quota := g.Allow()
+	assert.False(ok)
+	assert.Equal(100*time.Millisecond, quota.Reset)
+
+	now = now.Add(100 * time.Millisecond)
+	ok, quota = g.Allow()
+	assert.True(ok)
+	assert.Equal(0, quota.Remaining)
+	ok, _ = g.Allow()
+	assert.False(ok)
+
+	now = now.Add(time.Second)
+	ok, quota = g.Allow()
+	assert.True(ok)
+	assert.Equal(2, quota.Remaining)
+	assert.Equal(3, quota.Limit)
+}
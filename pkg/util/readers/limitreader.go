@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package readers
+
+import (
+	"io"
+)
+
+// LimitReader wraps an io.Reader, it reads at most n bytes from the
+// underlying io.Reader, and fails with a specified error if there is
+// more data.
+type LimitReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+// NewLimitReader creates a LimitReader which reads at most n bytes from
+// r, err is returned once r has more data.
+func NewLimitReader(r io.Reader, n int64, err error) *LimitReader {
+	return &LimitReader{r: r, remaining: n, err: err}
+}
+
+// Read implements io.Reader.
+func (r *LimitReader) Read(p []byte) (int, error) {
+	// read one more byte to detect whether there is more data.
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.r.Read(p)
+	if int64(n) > r.remaining {
+		n = int(r.remaining)
+		r.remaining = 0
+		return n, r.err
+	}
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// Close implements io.Closer and closes the underlying io.Reader if
+// it is an io.Closer.
+func (r *LimitReader) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package readers
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitReader(t *testing.T) {
+	assert := assert.New(t)
+
+	errTooLarge := errors.New("too large")
+
+	r := NewLimitReader(strings.NewReader("hello"), 5, errTooLarge)
+	data, err := io.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal("hello", string(data))
+
+	r = NewLimitReader(strings.NewReader("hello world"), 5, errTooLarge)
+	data, err = io.ReadAll(r)
+	assert.Equal(errTooLarge, err)
+	assert.Equal("hello", string(data))
+
+	// reads in small pieces.
+	r = NewLimitReader(io.NopCloser(strings.NewReader("hello world")), 8, errTooLarge)
+	buf := make([]byte, 3)
+	total := 0
+	for {
+		n, err := r.Read(buf)
+		total += n
+		if err != nil {
+			assert.Equal(errTooLarge, err)
+			break
+		}
+	}
+	assert.Equal(8, total)
+	assert.Nil(r.Close())
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package redact finds and replaces sensitive data, such as credit card
+// numbers, in text.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+)
+
+const (
+	// BuiltinCreditCard matches credit card numbers, which may be
+	// separated by spaces or dashes, and pass the Luhn check.
+	BuiltinCreditCard = "creditCard"
+	// BuiltinEmail matches email addresses.
+	BuiltinEmail = "email"
+	// BuiltinSSN matches US social security numbers like 123-45-6789.
+	BuiltinSSN = "ssn"
+
+	tokenPrefix = "tok_"
+	tokenLength = 16
+)
+
+type (
+	// Replacer returns the replacement of a sensitive value.
+	Replacer func(value string) string
+
+	// Matcher finds sensitive data in text by regular expressions.
+	Matcher struct {
+		patterns []*pattern
+	}
+
+	pattern struct {
+		re *regexp.Regexp
+		// valid filters out false positives of the regular expression.
+		valid func(string) bool
+	}
+)
+
+var builtins = map[string]*pattern{
+	BuiltinCreditCard: {
+		re:    regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		valid: luhn,
+	},
+	BuiltinEmail: {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	BuiltinSSN: {
+		re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	},
+}
+
+// NewMatcher creates a Matcher of the regular expressions and the builtin
+// patterns, it returns nil if there are no patterns.
+func NewMatcher(patterns []string, builtinPatterns []string) (*Matcher, error) {
+	if len(patterns) == 0 && len(builtinPatterns) == 0 {
+		return nil, nil
+	}
+
+	m := &Matcher{}
+	for _, name := range builtinPatterns {
+		p, ok := builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown builtin pattern %s", name)
+		}
+		m.patterns = append(m.patterns, p)
+	}
+	for _, s := range patterns {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", s, err)
+		}
+		m.patterns = append(m.patterns, &pattern{re: re})
+	}
+	return m, nil
+}
+
+// Replace replaces the sensitive data in s with the replacer.
+func (m *Matcher) Replace(s string, replace Replacer) string {
+	for _, p := range m.patterns {
+		s = p.re.ReplaceAllStringFunc(s, func(match string) string {
+			if p.valid != nil && !p.valid(match) {
+				return match
+			}
+			return replace(match)
+		})
+	}
+	return s
+}
+
+// Mask returns a Replacer that replaces values with the mask.
+func Mask(mask string) Replacer {
+	return func(string) string {
+		return mask
+	}
+}
+
+// Tokenize returns a Replacer that replaces values with tokens derived
+// from the key, the same value always has the same token, so the values
+// can still be correlated without being revealed.
+func Tokenize(key []byte) Replacer {
+	return func(value string) string {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(value))
+		return tokenPrefix + hex.EncodeToString(h.Sum(nil))[:tokenLength]
+	}
+}
+
+// luhn checks the digits in s with the Luhn algorithm.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redact
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := NewMatcher(nil, nil)
+	assert.Nil(m)
+	assert.Nil(err)
+
+	_, err = NewMatcher(nil, []string{"unknown"})
+	assert.Error(err)
+
+	_, err = NewMatcher([]string{"[a-"}, nil)
+	assert.Error(err)
+}
+
+func TestReplace(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := NewMatcher([]string{`secret-\w+`}, []string{BuiltinCreditCard, BuiltinEmail, BuiltinSSN})
+	assert.Nil(err)
+
+	mask := Mask("***")
+	cases := map[string]string{
+		"card 4111 1111 1111 1111 paid":     "card *** paid",
+		"card 4111-1111-1111-1111":          "card ***",
+		"card 4111111111111111":             "card ***",
+		"order 4111111111111112 is not one": "order 4111111111111112 is not one",
+		"mail to john.doe@example.co.uk":    "mail to ***",
+		"ssn 123-45-6789":                   "ssn ***",
+		"token secret-abc":                  "token ***",
+		"nothing here":                      "nothing here",
+	}
+	for in, out := range cases {
+		assert.Equal(out, m.Replace(in, mask), in)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	assert := assert.New(t)
+
+	tokenize := Tokenize([]byte("key"))
+	token := tokenize("4111111111111111")
+	assert.True(strings.HasPrefix(token, "tok_"))
+	assert.Len(token, len("tok_")+16)
+	assert.Equal(token, tokenize("4111111111111111"))
+	assert.NotEqual(token, tokenize("5500000000000004"))
+	assert.NotEqual(token, Tokenize([]byte("other"))("4111111111111111"))
+}
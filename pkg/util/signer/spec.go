@@ -27,8 +27,8 @@ type Spec struct {
 	ExcludeBody     bool              `json:"excludeBody,omitempty"`
 	TTL             string            `json:"ttl,omitempty" jsonschema:"format=duration"`
 	AccessKeyID     string            `json:"accessKeyId,omitempty"`
-	AccessKeySecret string            `json:"accessKeySecret,omitempty"`
-	AccessKeys      map[string]string `json:"accessKeys,omitempty"`
+	AccessKeySecret string            `json:"accessKeySecret,omitempty" jsonschema:"writeOnly=true"`
+	AccessKeys      map[string]string `json:"accessKeys,omitempty" jsonschema:"writeOnly=true"`
 	// TODO: AccessKeys is used as an internal access key store, but an external store is also needed
 }
 
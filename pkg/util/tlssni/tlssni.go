@@ -0,0 +1,276 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tlssni reads the server name (SNI) from the TLS ClientHello of a
+// connection without terminating the TLS.
+package tlssni
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/acceptretry"
+)
+
+const (
+	// DefaultTimeout is the default timeout to wait for the ClientHello.
+	DefaultTimeout = 5 * time.Second
+
+	recordHeaderLen      = 5
+	recordTypeHandshake  = 0x16
+	maxPlaintextLen      = 16384
+	maxClientHelloRecord = recordHeaderLen + maxPlaintextLen
+)
+
+var (
+	// ErrNotTLS is returned if the connection doesn't start with a TLS
+	// handshake record.
+	ErrNotTLS = errors.New("not a tls handshake")
+
+	errClientHelloRead = errors.New("client hello read")
+)
+
+// Conn is a connection whose ClientHello has been peeked, reading from it
+// returns the ClientHello first, so it could be forwarded or terminated
+// as if it was never read.
+type Conn struct {
+	net.Conn
+	r          *bufio.Reader
+	serverName string
+}
+
+// Read reads data from the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// CloseWrite shuts down the writing side of the connection if the
+// underlying connection supports it, or closes the connection otherwise.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// ServerName returns the server name of the ClientHello, it is empty if
+// the client doesn't send it.
+func (c *Conn) ServerName() string {
+	return c.serverName
+}
+
+// Peek peeks the ClientHello of conn to get the server name, the returned
+// connection must be used instead of conn afterwards.
+func Peek(conn net.Conn, timeout time.Duration) (*Conn, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	c := &Conn{
+		Conn: conn,
+		r:    bufio.NewReaderSize(conn, maxClientHelloRecord),
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	hdr, err := c.r.Peek(recordHeaderLen)
+	if err != nil {
+		return nil, err
+	}
+	if hdr[0] != recordTypeHandshake || hdr[1] != 0x03 {
+		return nil, ErrNotTLS
+	}
+
+	n := int(hdr[3])<<8 | int(hdr[4])
+	if n > maxPlaintextLen {
+		return nil, fmt.Errorf("tls record too large: %d", n)
+	}
+	record, err := c.r.Peek(recordHeaderLen + n)
+	if err != nil {
+		return nil, err
+	}
+
+	c.serverName, err = parseServerName(record)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseServerName parses the server name from the ClientHello record by
+// starting a TLS server handshake on it, the handshake is aborted once
+// the ClientHello is parsed.
+func parseServerName(record []byte) (string, error) {
+	var serverName string
+	conf := &tls.Config{
+		GetConfigForClient: func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = chi.ServerName
+			return nil, errClientHelloRead
+		},
+	}
+
+	err := tls.Server(&readOnlyConn{r: bytes.NewReader(record)}, conf).Handshake()
+	if !errors.Is(err, errClientHelloRead) {
+		return "", fmt.Errorf("parse client hello failed: %v", err)
+	}
+	return serverName, nil
+}
+
+// readOnlyConn is a connection which reads from r, and discards the
+// writes.
+type readOnlyConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *readOnlyConn) Read(p []byte) (int, error)         { return c.r.Read(p) }
+func (c *readOnlyConn) Write(p []byte) (int, error)        { return len(p), nil }
+func (c *readOnlyConn) Close() error                       { return nil }
+func (c *readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c *readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// MatchHost reports whether the server name matches one of the hosts, a
+// host could be a wildcard like *.example.com, which matches exactly one
+// label of subdomain. The comparison is case-insensitive.
+func MatchHost(hosts []string, serverName string) bool {
+	serverName = strings.ToLower(serverName)
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if h == serverName {
+			return true
+		}
+		if !strings.HasPrefix(h, "*.") {
+			continue
+		}
+		dot := strings.IndexByte(serverName, '.')
+		if dot > 0 && serverName[dot:] == h[1:] {
+			return true
+		}
+	}
+	return false
+}
+
+// Listener is a listener which peeks the server name of accepted TLS
+// connections, and passes them to the passthrough handler, the
+// connections not taken over by the handler are returned by Accept.
+type Listener struct {
+	net.Listener
+
+	timeout     time.Duration
+	passthrough func(*Conn) bool
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewListener creates a Listener, passthrough returns false if the
+// connection should be returned by Accept, otherwise it owns the
+// connection. The connections failed to peek are closed.
+func NewListener(l net.Listener, timeout time.Duration, passthrough func(*Conn) bool) *Listener {
+	sl := &Listener{
+		Listener:    l,
+		timeout:     timeout,
+		passthrough: passthrough,
+		conns:       make(chan net.Conn),
+		errs:        make(chan error, 1),
+		done:        make(chan struct{}),
+	}
+
+	go sl.run()
+
+	return sl
+}
+
+func (l *Listener) run() {
+	backoff := &acceptretry.Backoff{}
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			// The temporary errors are retried with backoff like
+			// net/http, the listener keeps serving after them.
+			if backoff.Retry(err, l.done) {
+				continue
+			}
+
+			select {
+			case l.errs <- err:
+			case <-l.done:
+			}
+			return
+		}
+
+		backoff.Reset()
+		go l.peek(conn)
+	}
+}
+
+func (l *Listener) peek(conn net.Conn) {
+	c, err := Peek(conn, l.timeout)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	if l.passthrough(c) {
+		return
+	}
+
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+// Accept accepts one connection which is not passed through, it returns
+// net.ErrClosed once the listener is closed.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case <-l.done:
+		return nil, net.ErrClosed
+	default:
+	}
+
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tlssni
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeek(t *testing.T) {
+	assert := assert.New(t)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go tls.Client(client, &tls.Config{ServerName: "www.example.com"}).Handshake()
+
+	c, err := Peek(server, time.Second)
+	assert.Nil(err)
+	assert.Equal("www.example.com", c.ServerName())
+
+	// the ClientHello is still readable.
+	b := make([]byte, recordHeaderLen)
+	_, err = io.ReadFull(c, b)
+	assert.Nil(err)
+	assert.Equal(byte(recordTypeHandshake), b[0])
+
+	client2, server2 := net.Pipe()
+	defer client2.Close()
+	defer server2.Close()
+	go client2.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	_, err = Peek(server2, time.Second)
+	assert.Equal(ErrNotTLS, err)
+
+	client3, server3 := net.Pipe()
+	defer client3.Close()
+	defer server3.Close()
+	_, err = Peek(server3, 50*time.Millisecond)
+	assert.NotNil(err)
+}
+
+func TestMatchHost(t *testing.T) {
+	assert := assert.New(t)
+
+	hosts := []string{"example.com", "*.Example.org"}
+	assert.True(MatchHost(hosts, "example.com"))
+	assert.True(MatchHost(hosts, "EXAMPLE.com"))
+	assert.False(MatchHost(hosts, "www.example.com"))
+	assert.True(MatchHost(hosts, "www.example.org"))
+	assert.False(MatchHost(hosts, "example.org"))
+	assert.False(MatchHost(hosts, "a.b.example.org"))
+	assert.False(MatchHost(hosts, ""))
+}
+
+func TestListener(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+
+	passed := make(chan string, 1)
+	sl := NewListener(l, time.Second, func(c *Conn) bool {
+		if c.ServerName() != "passthrough.example.com" {
+			return false
+		}
+		passed <- c.ServerName()
+		c.Close()
+		return true
+	})
+	defer sl.Close()
+
+	handshake := func(serverName string) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		assert.Nil(err)
+		go func() {
+			tls.Client(conn, &tls.Config{ServerName: serverName}).Handshake()
+			conn.Close()
+		}()
+	}
+
+	handshake("passthrough.example.com")
+	assert.Equal("passthrough.example.com", <-passed)
+
+	handshake("www.example.com")
+	conn, err := sl.Accept()
+	assert.Nil(err)
+	assert.Equal("www.example.com", conn.(*Conn).ServerName())
+	conn.Close()
+
+	sl.Close()
+	_, err = sl.Accept()
+	assert.ErrorIs(err, net.ErrClosed)
+}
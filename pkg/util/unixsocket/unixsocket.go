@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package unixsocket provides helpers to listen on unix sockets.
+package unixsocket
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"time"
+)
+
+// dialTimeout is the timeout to check whether a socket is in use.
+const dialTimeout = time.Second
+
+// RemoveStale removes the socket file at path if no one is listening on
+// it, which is left by a process exited without removing it, so a new
+// listener could be created at the path. A socket in use is kept, e.g.
+// the one inherited from the previous process on graceful update.
+func RemoveStale(path string) error {
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a unix socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err == nil {
+		conn.Close()
+		return nil
+	}
+	return os.Remove(path)
+}
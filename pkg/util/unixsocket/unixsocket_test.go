@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package unixsocket
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveStale(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.sock")
+	assert.Nil(RemoveStale(path))
+
+	// a socket in use is kept.
+	l, err := net.Listen("unix", path)
+	assert.Nil(err)
+	assert.Nil(RemoveStale(path))
+	_, err = os.Stat(path)
+	assert.Nil(err)
+
+	// a stale socket is removed.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	_, err = os.Stat(path)
+	assert.Nil(err)
+	assert.Nil(RemoveStale(path))
+	_, err = os.Stat(path)
+	assert.True(os.IsNotExist(err))
+
+	// a regular file is not a socket.
+	file := filepath.Join(dir, "file")
+	assert.Nil(os.WriteFile(file, nil, 0o600))
+	assert.Error(RemoveStale(file))
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package urlrewriter rewrites the path, query and host of HTTP requests
+// with regular expressions.
+package urlrewriter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// MaxRestarts is the maximum number of times the rules can be restarted
+// when rewriting a request, it protects the rewriter from endless loops.
+const MaxRestarts = 10
+
+// ErrRewriteLoop is returned when the rules are restarted too many times.
+var ErrRewriteLoop = errors.New("rewrite loop detected")
+
+type (
+	// Rule describes a rewrite rule. Match is a regular expression which is
+	// matched against the path, or against the path and raw query joined by
+	// '?' if MatchQuery is true. Path, Query and Host are the replacements,
+	// they can reference the capture groups of Match with $1 or ${name}, an
+	// empty replacement keeps the original value.
+	Rule struct {
+		Match       string `json:"match" jsonschema:"required,format=regexp"`
+		MatchQuery  bool   `json:"matchQuery,omitempty"`
+		Path        string `json:"path,omitempty"`
+		Query       string `json:"query,omitempty"`
+		AppendQuery bool   `json:"appendQuery,omitempty"`
+		Host        string `json:"host,omitempty"`
+
+		// Last stops processing the remaining rules once this rule matches.
+		Last bool `json:"last,omitempty"`
+		// Restart processes the rules from the first one again once this
+		// rule matches.
+		Restart bool `json:"restart,omitempty"`
+
+		re *regexp.Regexp
+	}
+
+	// Rewriter rewrites requests with a list of rules.
+	Rewriter struct {
+		rules []*Rule
+	}
+)
+
+// Validate validates the rule.
+func (r *Rule) Validate() error {
+	if _, err := regexp.Compile(r.Match); err != nil {
+		return fmt.Errorf("invalid match %q: %v", r.Match, err)
+	}
+	if r.Last && r.Restart {
+		return fmt.Errorf("last and restart are mutually exclusive")
+	}
+	if r.Path == "" && r.Query == "" && r.Host == "" && !r.Restart {
+		return fmt.Errorf("none of path, query and host is specified")
+	}
+	return nil
+}
+
+// New creates a Rewriter, it returns an error if any of the rules is invalid.
+func New(rules []*Rule) (*Rewriter, error) {
+	for i, r := range rules {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		r.re = regexp.MustCompile(r.Match)
+	}
+	return &Rewriter{rules: rules}, nil
+}
+
+// Rewrite rewrites the request in place and reports whether the request was
+// changed. ErrRewriteLoop is returned if the rules are restarted more than
+// MaxRestarts times, the request could have been partly rewritten in this
+// case.
+func (rw *Rewriter) Rewrite(req *http.Request) (bool, error) {
+	changed, restarts := false, 0
+
+	for i := 0; i < len(rw.rules); {
+		r := rw.rules[i]
+
+		subject := req.URL.Path
+		if r.MatchQuery {
+			subject += "?" + req.URL.RawQuery
+		}
+
+		match := r.re.FindStringSubmatchIndex(subject)
+		if match == nil {
+			i++
+			continue
+		}
+
+		changed = r.apply(req, subject, match) || changed
+
+		if r.Last {
+			break
+		}
+		if r.Restart {
+			restarts++
+			if restarts > MaxRestarts {
+				return changed, ErrRewriteLoop
+			}
+			i = 0
+			continue
+		}
+		i++
+	}
+
+	return changed, nil
+}
+
+func (r *Rule) apply(req *http.Request, subject string, match []int) bool {
+	expand := func(template string) string {
+		return string(r.re.ExpandString(nil, template, subject, match))
+	}
+
+	changed := false
+
+	if r.Path != "" {
+		if path := expand(r.Path); path != req.URL.Path {
+			req.URL.Path = path
+			req.URL.RawPath = ""
+			changed = true
+		}
+	}
+
+	if r.Query != "" {
+		query := expand(r.Query)
+		if r.AppendQuery && req.URL.RawQuery != "" {
+			query += "&" + req.URL.RawQuery
+		}
+		if query != req.URL.RawQuery {
+			req.URL.RawQuery = query
+			changed = true
+		}
+	}
+
+	if r.Host != "" {
+		if host := expand(r.Host); host != req.Host {
+			req.Host = host
+			changed = true
+		}
+	}
+
+	return changed
+}
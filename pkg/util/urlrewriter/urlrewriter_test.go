@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package urlrewriter
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Rule{Match: "("}).Validate())
+	assert.Error((&Rule{Match: "^/a", Path: "/b", Last: true, Restart: true}).Validate())
+	assert.Error((&Rule{Match: "^/a"}).Validate())
+	assert.NoError((&Rule{Match: "^/a", Path: "/b"}).Validate())
+
+	_, err := New([]*Rule{{Match: "^/a", Path: "/b"}, {Match: "["}})
+	assert.Error(err)
+}
+
+func TestRewrite(t *testing.T) {
+	assert := assert.New(t)
+
+	rw, err := New([]*Rule{
+		{
+			Match: `^/users/(\d+)/orders/(?P<order>\d+)$`,
+			Path:  "/orders/${order}",
+			Query: "user=$1",
+			Host:  "orders.example.com",
+		},
+	})
+	assert.NoError(err)
+
+	req := httptest.NewRequest("GET", "http://www.example.com/users/12/orders/34", nil)
+	changed, err := rw.Rewrite(req)
+	assert.NoError(err)
+	assert.True(changed)
+	assert.Equal("/orders/34", req.URL.Path)
+	assert.Equal("user=12", req.URL.RawQuery)
+	assert.Equal("orders.example.com", req.Host)
+
+	req = httptest.NewRequest("GET", "http://www.example.com/users/12", nil)
+	changed, err = rw.Rewrite(req)
+	assert.NoError(err)
+	assert.False(changed)
+	assert.Equal("/users/12", req.URL.Path)
+}
+
+func TestRewriteQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	rw, err := New([]*Rule{
+		{
+			Match:      `^/search\?q=([^&]*)`,
+			MatchQuery: true,
+			Path:       "/find/$1",
+		},
+		{
+			Match:       `^/find/`,
+			Query:       "v=2",
+			AppendQuery: true,
+		},
+	})
+	assert.NoError(err)
+
+	req := httptest.NewRequest("GET", "http://www.example.com/search?q=go&page=2", nil)
+	changed, err := rw.Rewrite(req)
+	assert.NoError(err)
+	assert.True(changed)
+	assert.Equal("/find/go", req.URL.Path)
+	assert.Equal("v=2&q=go&page=2", req.URL.RawQuery)
+}
+
+func TestRewriteLastAndRestart(t *testing.T) {
+	assert := assert.New(t)
+
+	rw, err := New([]*Rule{
+		{Match: `^/v1/(.*)$`, Path: "/v2/$1", Restart: true},
+		{Match: `^/v2/(.*)$`, Path: "/api/$1", Last: true},
+		{Match: `^/api/(.*)$`, Path: "/never/$1"},
+	})
+	assert.NoError(err)
+
+	req := httptest.NewRequest("GET", "http://www.example.com/v1/pets", nil)
+	_, err = rw.Rewrite(req)
+	assert.NoError(err)
+	assert.Equal("/api/pets", req.URL.Path)
+
+	rw, err = New([]*Rule{
+		{Match: `^/a$`, Path: "/b", Restart: true},
+		{Match: `^/b$`, Path: "/a", Restart: true},
+	})
+	assert.NoError(err)
+
+	req = httptest.NewRequest("GET", "http://www.example.com/a", nil)
+	_, err = rw.Rewrite(req)
+	assert.ErrorIs(err, ErrRewriteLoop)
+}